@@ -25,8 +25,11 @@ import (
 
 	"github.com/skydive-project/skydive/analyzer"
 	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/clockskew"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/exporter/ipfix"
+	"github.com/skydive-project/skydive/featureflag"
 	"github.com/skydive-project/skydive/flow"
 	ondemand "github.com/skydive-project/skydive/flow/ondemand/server"
 	fprobes "github.com/skydive-project/skydive/flow/probes"
@@ -38,7 +41,9 @@ import (
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/packetinjector"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/throughput"
 	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/opencontrail"
 	"github.com/skydive-project/skydive/ui"
 	"github.com/skydive-project/skydive/websocket"
 	ws "github.com/skydive-project/skydive/websocket"
@@ -55,10 +60,16 @@ type Agent struct {
 	topologyProbeBundle *probe.Bundle
 	flowProbeBundle     *probe.Bundle
 	flowTableAllocator  *flow.TableAllocator
+	tableStatsReporter  *fprobes.TableStatsReporter
+	dnsStatsReporter    *fprobes.DNSStatsReporter
 	flowClientPool      *analyzer.FlowClientPool
+	ipfixExporter       *ipfix.Exporter
 	onDemandProbeServer *ondemand.OnDemandProbeServer
 	httpServer          *shttp.Server
 	tidMapper           *topology.TIDMapper
+	ownershipTracker    *topology.OwnershipTracker
+	throughputServer    *throughput.Server
+	limiter             *resourceLimiter
 }
 
 // NewAnalyzerStructClientPool creates a new http WebSocket client Pool
@@ -94,6 +105,7 @@ type Status struct {
 	Analyzers      map[string]pod.ConnStatus
 	TopologyProbes []string
 	FlowProbes     []string
+	FeatureFlags   map[string]featureflag.State
 }
 
 // GetStatus returns the status of an agent
@@ -105,6 +117,21 @@ func (a *Agent) GetStatus() interface{} {
 		Analyzers:      podStatus.Hubs,
 		TopologyProbes: a.topologyProbeBundle.ActiveProbes(),
 		FlowProbes:     a.flowProbeBundle.ActiveProbes(),
+		FeatureFlags:   featureflag.States(),
+	}
+}
+
+// DebugStats represents the internal statistics of an agent
+type DebugStats struct {
+	Graph      *api.GraphStats
+	FlowTables []*flow.TableStats
+}
+
+// GetDebugStats returns the internal statistics of an agent
+func (a *Agent) GetDebugStats() interface{} {
+	return &DebugStats{
+		Graph:      api.NewGraphStats(a.graph),
+		FlowTables: a.flowTableAllocator.Stats(),
 	}
 }
 
@@ -114,10 +141,14 @@ func (a *Agent) Start() {
 		logging.GetLogger().Warning("Agent needs root permissions for some feature like capture, network namespace introspection, some feature might not work as expected")
 	}
 
+	a.limiter.Start()
+
 	go a.httpServer.Serve()
 
 	a.topologyProbeBundle.Start()
 	a.flowProbeBundle.Start()
+	a.tableStatsReporter.Start()
+	a.dnsStatsReporter.Start()
 	a.onDemandProbeServer.Start()
 
 	// everything is ready, then initiate the websocket connection
@@ -126,12 +157,21 @@ func (a *Agent) Start() {
 
 // Stop agent services
 func (a *Agent) Stop() {
+	// keep the in-progress flows in the checkpoints for the next run
+	a.flowTableAllocator.Suspend()
+	a.tableStatsReporter.Stop()
+	a.dnsStatsReporter.Stop()
 	a.flowProbeBundle.Stop()
 	a.analyzerClientPool.Stop()
 	a.topologyProbeBundle.Stop()
 	a.httpServer.Stop()
 	a.flowClientPool.Close()
+	if a.ipfixExporter != nil {
+		a.ipfixExporter.Close()
+	}
 	a.onDemandProbeServer.Stop()
+	a.throughputServer.Stop()
+	a.limiter.Stop()
 
 	if tr, ok := http.DefaultTransport.(interface {
 		CloseIdleConnections()
@@ -140,6 +180,7 @@ func (a *Agent) Stop() {
 	}
 
 	a.tidMapper.Stop()
+	a.ownershipTracker.Stop()
 }
 
 // NewAgent instanciates a new Agent aiming to launch probes (topology and flow)
@@ -186,6 +227,7 @@ func NewAgent() (*Agent, error) {
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewNextHopTraversalExtension())
+	tr.AddTraversalExtension(ge.NewShortestPathTraversalExtension())
 
 	rootNode, err := createRootNode(g)
 	if err != nil {
@@ -193,6 +235,11 @@ func NewAgent() (*Agent, error) {
 	}
 
 	api.RegisterTopologyAPI(hserver, g, tr, apiAuthBackend)
+	api.RegisterGraphQLAPI(hserver, g, apiAuthBackend)
+
+	if err := api.RegisterSearchAPI(hserver, g, apiAuthBackend); err != nil {
+		return nil, err
+	}
 
 	clusterAuthOptions := &shttp.AuthenticationOpts{
 		Username: config.GetString("agent.auth.cluster.username"),
@@ -205,7 +252,12 @@ func NewAgent() (*Agent, error) {
 		return nil, err
 	}
 
-	pod, err := pod.NewPod(apiServer, analyzerClientPool, g, apiAuthBackend, clusterAuthOptions, tr, true, 10000, 2*time.Second, 5*time.Second)
+	exportFilter, err := config.NewExportFilter("agent.topology.export")
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := pod.NewPod(apiServer, analyzerClientPool, g, apiAuthBackend, clusterAuthOptions, tr, true, 10000, 2*time.Second, 5*time.Second, exportFilter, config.GetInt("agent.topology.journal_size"))
 	if err != nil {
 		return nil, err
 	}
@@ -215,25 +267,58 @@ func NewAgent() (*Agent, error) {
 		return nil, err
 	}
 
+	ownershipTracker := NewOwnershipTrackerFromBundle(g, topologyProbeBundle)
+	ownershipTracker.Start()
+	api.RegisterProbeAPI(hserver, g, topologyProbeBundle, ownershipTracker, apiAuthBackend)
+
+	if p, ok := topologyProbeBundle.GetProbe("opencontrail").(*opencontrail.Probe); ok {
+		opencontrail.RegisterRoutingTableAPI(hserver, p, apiAuthBackend)
+	}
+
 	updateTime := time.Duration(config.GetInt("flow.update")) * time.Second
 	expireTime := time.Duration(config.GetInt("flow.expire")) * time.Second
 
-	flowTableAllocator := flow.NewTableAllocator(updateTime, expireTime)
+	var checkpoint *flow.Checkpoint
+	if path := config.GetString("agent.flow.checkpoint.path"); path != "" {
+		interval := time.Duration(config.GetInt("agent.flow.checkpoint.interval")) * time.Second
+		if checkpoint, err = flow.NewCheckpoint(path, interval); err != nil {
+			return nil, err
+		}
+	}
+
+	dnsStats := flow.NewDNSStats(config.GetInt("agent.flow.dns_stats.max_domains"))
+	flowTableAllocator := flow.NewTableAllocator(updateTime, expireTime, checkpoint, dnsStats)
+
+	limiter, err := newResourceLimiterFromConfig(flowTableAllocator.Flush)
+	if err != nil {
+		return nil, err
+	}
 
 	// exposes a flow server through the client connections
 	flow.NewWSTableServer(flowTableAllocator, analyzerClientPool)
 
 	packetinjector.NewServer(g, analyzerClientPool)
+	throughputServer := throughput.NewServer(analyzerClientPool)
+	featureflag.NewServer(analyzerClientPool)
+	clockskew.NewServer(analyzerClientPool, g, rootNode)
 
 	flowClientPool := analyzer.NewFlowClientPool(analyzerClientPool, clusterAuthOptions)
 
-	flowProbeBundle := fprobes.NewFlowProbeBundle(topologyProbeBundle, g, flowTableAllocator, flowClientPool)
+	ipfixExporter, err := ipfix.NewExporterFromConfig()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to initialize IPFIX exporter: %s", err)
+	}
+
+	flowProbeBundle := fprobes.NewFlowProbeBundle(topologyProbeBundle, g, flowTableAllocator, flowClientPool, ipfixExporter)
 
 	onDemandProbeServer, err := ondemand.NewOnDemandProbeServer(flowProbeBundle, g, analyzerClientPool)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to initialize on-demand flow probe %s", err)
 	}
 
+	dnsStatsInterval := time.Duration(config.GetInt("agent.flow.dns_stats.interval")) * time.Second
+	dnsStatsReporter := fprobes.NewDNSStatsReporter(g, rootNode, dnsStats, dnsStatsInterval, config.GetInt("agent.flow.dns_stats.top"))
+
 	agent := &Agent{
 		pod:                 pod,
 		graph:               g,
@@ -242,13 +327,20 @@ func NewAgent() (*Agent, error) {
 		topologyProbeBundle: topologyProbeBundle,
 		flowProbeBundle:     flowProbeBundle,
 		flowTableAllocator:  flowTableAllocator,
+		tableStatsReporter:  fprobes.NewTableStatsReporter(g, flowTableAllocator),
+		dnsStatsReporter:    dnsStatsReporter,
 		flowClientPool:      flowClientPool,
+		ipfixExporter:       ipfixExporter,
 		onDemandProbeServer: onDemandProbeServer,
 		httpServer:          hserver,
 		tidMapper:           tm,
+		ownershipTracker:    ownershipTracker,
+		throughputServer:    throughputServer,
+		limiter:             limiter,
 	}
 
 	api.RegisterStatusAPI(hserver, agent, apiAuthBackend)
+	api.RegisterDebugAPI(hserver, agent, apiAuthBackend)
 
 	return agent, nil
 }
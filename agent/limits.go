@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// IO scheduling classes of the agent
+const (
+	ioClassBestEffort = "best-effort"
+	ioClassIdle       = "idle"
+)
+
+// resourceLimiter bounds the cost of the agent on its host. Its CPU and IO
+// priorities are lowered once for all its threads, the threads created
+// later inheriting them, and its resident memory is watched: above the
+// ceiling, onPressure is called to release memory, the flow tables being
+// flushed, instead of letting the agent grow until killed.
+type resourceLimiter struct {
+	maxRSS     int64
+	interval   time.Duration
+	onPressure func()
+	quit       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// applyPriorities lowers the CPU and IO priorities of the agent and moves it
+// to a cgroup with the given CPU shares, according to the agent.limits
+// configuration
+func applyPriorities() error {
+	if nice := config.GetInt("agent.limits.nice"); nice != 0 {
+		if err := setNice(nice); err != nil {
+			return fmt.Errorf("Unable to set the nice value of the agent: %s", err)
+		}
+		logging.GetLogger().Infof("Agent nice value set to %d", nice)
+	}
+
+	if class := config.GetString("agent.limits.io_class"); class != "" {
+		level := config.GetInt("agent.limits.io_priority")
+		if class != ioClassBestEffort && class != ioClassIdle {
+			return fmt.Errorf("Unknown IO scheduling class %s", class)
+		}
+		if level < 0 || level > 7 {
+			return fmt.Errorf("Invalid IO priority %d, should be between 0 and 7", level)
+		}
+		if err := setIOPriority(class, level); err != nil {
+			return fmt.Errorf("Unable to set the IO priority of the agent: %s", err)
+		}
+		logging.GetLogger().Infof("Agent IO scheduling class set to %s", class)
+	}
+
+	if shares := config.GetInt("agent.limits.cpu_shares"); shares > 0 {
+		if shares < 2 || shares > 262144 {
+			return fmt.Errorf("Invalid CPU shares %d, should be between 2 and 262144", shares)
+		}
+		path, err := joinCgroup(config.GetString("agent.limits.cgroup"), shares)
+		if err != nil {
+			return fmt.Errorf("Unable to confine the agent in a cgroup: %s", err)
+		}
+		logging.GetLogger().Infof("Agent moved to cgroup %s with %d CPU shares", path, shares)
+	}
+
+	return nil
+}
+
+func (l *resourceLimiter) check() {
+	rss, err := readRSS()
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to read the agent memory usage: %s", err)
+		return
+	}
+	if rss <= l.maxRSS {
+		return
+	}
+
+	logging.GetLogger().Warningf("Agent resident memory %d MB exceeds %d MB, flushing the flow tables", rss>>20, l.maxRSS>>20)
+	if l.onPressure != nil {
+		l.onPressure()
+	}
+	debug.FreeOSMemory()
+}
+
+func (l *resourceLimiter) run() {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.check()
+		case <-l.quit:
+			return
+		}
+	}
+}
+
+// Start watching the memory of the agent
+func (l *resourceLimiter) Start() {
+	if l.maxRSS <= 0 {
+		return
+	}
+	l.wg.Add(1)
+	go l.run()
+}
+
+// Stop watching the memory of the agent
+func (l *resourceLimiter) Stop() {
+	if l.maxRSS <= 0 {
+		return
+	}
+	close(l.quit)
+	l.wg.Wait()
+}
+
+// newResourceLimiterFromConfig applies the CPU and IO limits of the agent
+// and returns the watcher of its memory, onPressure being called when the
+// memory ceiling is exceeded
+func newResourceLimiterFromConfig(onPressure func()) (*resourceLimiter, error) {
+	if err := applyPriorities(); err != nil {
+		return nil, err
+	}
+
+	interval := config.GetInt("agent.limits.memory_check_interval")
+	maxRSS := int64(config.GetInt("agent.limits.max_rss")) << 20
+	if maxRSS > 0 && interval <= 0 {
+		return nil, fmt.Errorf("Invalid memory check interval %d", interval)
+	}
+
+	return &resourceLimiter{
+		maxRSS:     maxRSS,
+		interval:   time.Duration(interval) * time.Second,
+		onPressure: onPressure,
+		quit:       make(chan struct{}),
+	}, nil
+}
@@ -0,0 +1,148 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	cgroupRoot = "/sys/fs/cgroup"
+	cgroupName = "skydive-agent"
+)
+
+// ioprio_set arguments, from linux/ioprio.h
+const (
+	ioprioWhoProcess      = 1
+	ioprioClassBestEffort = 2
+	ioprioClassIdle       = 3
+	ioprioClassShift      = 13
+)
+
+// forEachThread calls fn for all the threads of the agent, the nice value
+// and the IO priority being attributes of the threads on Linux
+func forEachThread(fn func(tid int) error) error {
+	tasks, err := ioutil.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		// a thread may have exited meanwhile
+		if err := fn(tid); err != nil && err != unix.ESRCH {
+			return err
+		}
+	}
+	return nil
+}
+
+func setNice(nice int) error {
+	return forEachThread(func(tid int) error {
+		return unix.Setpriority(unix.PRIO_PROCESS, tid, nice)
+	})
+}
+
+func setIOPriority(class string, level int) error {
+	prio := ioprioClassBestEffort<<ioprioClassShift | level
+	if class == ioClassIdle {
+		prio = ioprioClassIdle << ioprioClassShift
+	}
+
+	return forEachThread(func(tid int) error {
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+			return errno
+		}
+		return nil
+	})
+}
+
+// cpuWeight converts cgroup v1 CPU shares to a cgroup v2 CPU weight
+func cpuWeight(shares int) int {
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// joinCgroup moves the agent to the given cgroup, created if needed, with
+// the given CPU shares. Both cgroup v1, with the cpu controller, and the
+// unified hierarchy are supported.
+func joinCgroup(path string, shares int) (string, error) {
+	unified := false
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err == nil {
+		unified = true
+	}
+
+	if path == "" {
+		if unified {
+			path = filepath.Join(cgroupRoot, cgroupName)
+		} else {
+			path = filepath.Join(cgroupRoot, "cpu", cgroupName)
+		}
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return "", err
+	}
+
+	file, value := "cpu.shares", shares
+	if unified {
+		// enabling the cpu controller fails if already enabled by the
+		// parent owner, the weight being then written anyway
+		ioutil.WriteFile(filepath.Join(filepath.Dir(path), "cgroup.subtree_control"), []byte("+cpu"), 0644)
+		file, value = "cpu.weight", cpuWeight(shares)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(path, file), []byte(strconv.Itoa(value)), 0644); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readRSS returns the resident memory of the agent in bytes
+func readRSS() (int64, error) {
+	data, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("Unexpected /proc/self/statm content: %s", data)
+	}
+
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
@@ -0,0 +1,42 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"testing"
+)
+
+func TestCPUWeight(t *testing.T) {
+	for shares, weight := range map[int]int{2: 1, 1024: 39, 262144: 10000} {
+		if w := cpuWeight(shares); w != weight {
+			t.Errorf("Expected weight %d for %d shares, got %d", weight, shares, w)
+		}
+	}
+}
+
+func TestReadRSS(t *testing.T) {
+	rss, err := readRSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rss <= 0 {
+		t.Errorf("Expected a positive resident memory, got %d", rss)
+	}
+}
@@ -0,0 +1,42 @@
+// +build !linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package agent
+
+import (
+	"errors"
+)
+
+var errLimitsNotSupported = errors.New("Resource limits are only supported on Linux")
+
+func setNice(nice int) error {
+	return errLimitsNotSupported
+}
+
+func setIOPriority(class string, level int) error {
+	return errLimitsNotSupported
+}
+
+func joinCgroup(path string, shares int) (string, error) {
+	return "", errLimitsNotSupported
+}
+
+func readRSS() (int64, error) {
+	return 0, errLimitsNotSupported
+}
@@ -25,20 +25,56 @@ import (
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/cilium"
 	"github.com/skydive-project/skydive/topology/probes/docker"
+	"github.com/skydive-project/skydive/topology/probes/frr"
 	"github.com/skydive-project/skydive/topology/probes/libvirt"
 	"github.com/skydive-project/skydive/topology/probes/lldp"
 	"github.com/skydive-project/skydive/topology/probes/lxd"
 	"github.com/skydive-project/skydive/topology/probes/netlink"
 	"github.com/skydive-project/skydive/topology/probes/netns"
 	"github.com/skydive-project/skydive/topology/probes/neutron"
+	"github.com/skydive-project/skydive/topology/probes/nftables"
 	"github.com/skydive-project/skydive/topology/probes/opencontrail"
 	"github.com/skydive-project/skydive/topology/probes/ovsdb"
 	"github.com/skydive-project/skydive/topology/probes/runc"
 	"github.com/skydive-project/skydive/topology/probes/socketinfo"
 	"github.com/skydive-project/skydive/topology/probes/vpp"
+	"github.com/skydive-project/skydive/topology/probes/wireguard"
 )
 
+// probeOwnerships describes the elements and the metadata namespaces owned
+// by the topology probes which can be disabled
+var probeOwnerships = map[string]topology.Ownership{
+	"cilium":       {Managers: []string{"cilium"}},
+	"docker":       {Managers: []string{"docker"}, Namespaces: []string{"Docker"}},
+	"frr":          {Namespaces: []string{"FRR"}},
+	"libvirt":      {Namespaces: []string{"Libvirt"}},
+	"lldp":         {Types: []string{"switch", "switchport"}, Namespaces: []string{"LLDP"}},
+	"lxd":          {Types: []string{"container"}, Namespaces: []string{"LXD"}},
+	"neutron":      {Managers: []string{"neutron"}, Namespaces: []string{"Neutron"}},
+	"nftables":     {Namespaces: []string{"Nftables"}},
+	"opencontrail": {Managers: []string{"opencontrail"}, Namespaces: []string{"Contrail"}},
+	"ovsdb":        {Types: []string{"ovsbridge", "ovsport", "ofrule", "ofgroup"}, Namespaces: []string{"Ovs"}},
+	"runc":         {Managers: []string{"runc"}, Namespaces: []string{"Runc"}},
+	"socketinfo":   {Namespaces: []string{"Sockets"}},
+	"vpp":          {Types: []string{"vpp"}},
+	"wireguard":    {Namespaces: []string{"WireGuard"}},
+}
+
+// NewOwnershipTrackerFromBundle returns a tracker of the elements owned by
+// the active topology probes
+func NewOwnershipTrackerFromBundle(g *graph.Graph, bundle *probe.Bundle) *topology.OwnershipTracker {
+	tracker := topology.NewOwnershipTracker(g)
+	for _, name := range bundle.ActiveProbes() {
+		if ownership, ok := probeOwnerships[name]; ok {
+			tracker.Register(name, ownership)
+		}
+	}
+	return tracker
+}
+
 // NewTopologyProbeBundleFromConfig creates a new topology probe.Bundle based on the configuration
 func NewTopologyProbeBundleFromConfig(g *graph.Graph, hostNode *graph.Node) (*probe.Bundle, error) {
 	list := config.GetStringSlice("agent.topology.probes")
@@ -91,6 +127,18 @@ func NewTopologyProbeBundleFromConfig(g *graph.Graph, hostNode *graph.Node) (*pr
 				return nil, fmt.Errorf("Failed to initialize Docker probe: %s", err)
 			}
 			probes[t] = dockerProbe
+		case "cilium":
+			ciliumProbe, err := cilium.NewProbeFromConfig(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize Cilium probe: %s", err)
+			}
+			probes[t] = ciliumProbe
+		case "frr":
+			frrProbe, err := frr.NewProbeFromConfig(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize FRR probe: %s", err)
+			}
+			probes[t] = frrProbe
 		case "lldp":
 			interfaces := config.GetStringSlice("agent.topology.lldp.interfaces")
 			lldpProbe, err := lldp.NewProbe(g, hostNode, interfaces)
@@ -130,6 +178,18 @@ func NewTopologyProbeBundleFromConfig(g *graph.Graph, hostNode *graph.Node) (*pr
 				return nil, fmt.Errorf("Failed to initialize vpp probe: %s", err)
 			}
 			probes[t] = vpp
+		case "wireguard":
+			wireguard, err := wireguard.NewProbeFromConfig(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize WireGuard probe: %s", err)
+			}
+			probes[t] = wireguard
+		case "nftables":
+			nftables, err := nftables.NewProbeFromConfig(g, hostNode)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to initialize nftables probe: %s", err)
+			}
+			probes[t] = nftables
 		default:
 			logging.GetLogger().Errorf("unknown probe type %s", t)
 		}
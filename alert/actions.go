@@ -0,0 +1,191 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// ActionsMessage describes a websocket message that is sent by the alerting
+// server once the actions of a triggered alert were run, Occurrence linking
+// it to the alert message
+type ActionsMessage struct {
+	UUID       string
+	Occurrence string
+	Timestamp  time.Time
+	Results    []types.AlertActionResult
+}
+
+// collectNodeIDs walks the JSON representation of the reason data of an
+// alert looking for nodes, ie. objects with an ID and metadata but no parent
+func collectNodeIDs(value interface{}, ids []string, seen map[string]bool) []string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		id, isString := value["ID"].(string)
+		_, hasMetadata := value["Metadata"]
+		_, hasParent := value["Parent"]
+		if isString && hasMetadata && !hasParent {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+			return ids
+		}
+		for _, v := range value {
+			ids = collectNodeIDs(v, ids, seen)
+		}
+	case []interface{}:
+		for _, v := range value {
+			ids = collectNodeIDs(v, ids, seen)
+		}
+	}
+	return ids
+}
+
+// affectedNodes returns the identifiers of the nodes that triggered the alert
+func affectedNodes(data interface{}) []string {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return nil
+	}
+
+	return collectNodeIDs(value, nil, make(map[string]bool))
+}
+
+// nodesQuery returns the Gremlin query selecting the given nodes
+func nodesQuery(ids []string) string {
+	quoted := make([]string, len(ids))
+	for i, id := range ids {
+		quoted[i] = "'" + id + "'"
+	}
+	return fmt.Sprintf("G.V().Has('ID', Within(%s))", strings.Join(quoted, ", "))
+}
+
+func (a *Server) startCapture(al *GremlinAlert, action *types.AlertAction, nodes []string, msg *Message) (string, error) {
+	query := action.GremlinQuery
+	if query == "" {
+		if len(nodes) == 0 {
+			return "", errors.New("No node to capture on")
+		}
+		query = nodesQuery(nodes)
+	}
+
+	capture := types.NewCapture(query, action.BPFFilter)
+	capture.Type = action.CaptureType
+	capture.Name = fmt.Sprintf("alert-%s", al.Name)
+	capture.Description = fmt.Sprintf("Started by alert %s, occurrence %s", al.UUID, msg.Occurrence)
+
+	handler := a.apiServer.GetHandler("capture")
+	if err := handler.Create(capture); err != nil {
+		return "", err
+	}
+
+	if action.Duration > 0 {
+		id := capture.ID()
+		time.AfterFunc(time.Duration(action.Duration)*time.Second, func() {
+			if err := handler.Delete(id); err != nil {
+				logging.GetLogger().Errorf("Failed to stop capture %s started by alert %s: %s", id, al.UUID, err)
+			}
+		})
+	}
+
+	return capture.ID(), nil
+}
+
+func (a *Server) runWorkflow(action *types.AlertAction, msg *Message) (interface{}, error) {
+	resource, ok := a.apiServer.GetHandler("workflow").Get(action.Workflow)
+	if !ok {
+		return nil, fmt.Errorf("No workflow found with ID: %s", action.Workflow)
+	}
+
+	// the alert message is given as the last parameter of the workflow
+	params := append(append([]interface{}{}, action.Params...), msg)
+	value, err := a.runtime.ExecFunction(resource.(*types.Workflow).Source, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	return value.Export()
+}
+
+func (a *Server) injectPackets(action *types.AlertAction, nodes []string) (string, error) {
+	injection := *action.Injection
+	if injection.Src == "" {
+		if len(nodes) == 0 {
+			return "", errors.New("No source node to inject packets from")
+		}
+		injection.Src = fmt.Sprintf("G.V('%s')", nodes[0])
+	}
+
+	if err := a.apiServer.GetHandler("injectpacket").Create(&injection); err != nil {
+		return "", err
+	}
+
+	return injection.ID(), nil
+}
+
+// runActions runs the actions of a triggered alert and broadcasts their
+// results. It must not be called with the graph lock held.
+func (a *Server) runActions(al *GremlinAlert, msg *Message) {
+	nodes := affectedNodes(msg.ReasonData)
+
+	results := make([]types.AlertActionResult, len(al.Actions))
+	for i := range al.Actions {
+		action := &al.Actions[i]
+		result := &results[i]
+		result.Type = action.Type
+
+		var err error
+		switch action.Type {
+		case "capture":
+			result.ID, err = a.startCapture(al, action, nodes, msg)
+		case "workflow":
+			result.Result, err = a.runWorkflow(action, msg)
+		case "injection":
+			result.ID, err = a.injectPackets(action, nodes)
+		default:
+			err = fmt.Errorf("Unsupported action type '%s'", action.Type)
+		}
+
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to run %s action of alert %s: %s", action.Type, al.UUID, err)
+			result.Error = err.Error()
+		}
+	}
+
+	actionsMsg := ActionsMessage{
+		UUID:       al.UUID,
+		Occurrence: msg.Occurrence,
+		Timestamp:  time.Now().UTC(),
+		Results:    results,
+	}
+	a.Pool.BroadcastMessage(ws.NewStructMessage(Namespace, "AlertActions", actionsMsg))
+}
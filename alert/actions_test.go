@@ -0,0 +1,197 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	etcd "github.com/coreos/etcd/client"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	shttp "github.com/skydive-project/skydive/http"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeKeysAPI struct {
+	etcd.KeysAPI
+}
+
+func (k *fakeKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value, Dir: opts != nil && opts.Dir}}, nil
+}
+
+// fakeHandler records the resources created by the actions
+type fakeHandler struct {
+	api.Handler
+	name    string
+	created []types.Resource
+}
+
+func (h *fakeHandler) Name() string {
+	return h.name
+}
+
+func (h *fakeHandler) Get(id string) (types.Resource, bool) {
+	return nil, false
+}
+
+func (h *fakeHandler) Create(resource types.Resource) error {
+	h.created = append(h.created, resource)
+	resource.SetID(fmt.Sprintf("%s-%d", h.name, len(h.created)))
+	return nil
+}
+
+type fakePool struct {
+	ws.StructSpeakerPool
+	messages []*ws.StructMessage
+}
+
+// BroadcastMessage records the messages as received by the clients
+func (p *fakePool) BroadcastMessage(m ws.Message) {
+	b, err := m.Bytes(ws.JSONProtocol)
+	if err != nil {
+		return
+	}
+
+	var msg ws.StructMessage
+	if err := json.Unmarshal(b, &msg); err == nil {
+		p.messages = append(p.messages, &msg)
+	}
+}
+
+func TestAffectedNodes(t *testing.T) {
+	node := func(id string) map[string]interface{} {
+		return map[string]interface{}{"ID": id, "Metadata": map[string]interface{}{"Name": id}}
+	}
+	edge := map[string]interface{}{"ID": "edge", "Metadata": map[string]interface{}{}, "Parent": "n1", "Child": "n2"}
+
+	for _, test := range []struct {
+		name     string
+		data     interface{}
+		expected []string
+	}{
+		{"nothing", true, nil},
+		{"single node", node("n1"), []string{"n1"}},
+		{"nodes and edges", []interface{}{node("n1"), edge, node("n2")}, []string{"n1", "n2"}},
+		{"duplicates", []interface{}{node("n1"), node("n1")}, []string{"n1"}},
+		{"nested", map[string]interface{}{"result": []interface{}{node("n1")}}, []string{"n1"}},
+	} {
+		if ids := affectedNodes(test.data); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, ids)
+		}
+	}
+}
+
+func TestRunActions(t *testing.T) {
+	apiServer, err := api.NewAPI(shttp.NewServer("testhost", common.AnalyzerService, "localhost", 0, nil), &fakeKeysAPI{}, common.Service{ID: "testhost", Type: common.AnalyzerService}, shttp.NewNoAuthenticationBackend())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	captures := &fakeHandler{name: "capture"}
+	injections := &fakeHandler{name: "injectpacket"}
+	for _, handler := range []api.Handler{captures, injections, &fakeHandler{name: "workflow"}} {
+		if err := apiServer.RegisterAPIHandler(handler, shttp.NewNoAuthenticationBackend()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node := map[string]interface{}{"ID": "n1", "Metadata": map[string]interface{}{"Name": "eth0"}}
+
+	for _, test := range []struct {
+		name   string
+		action types.AlertAction
+		data   interface{}
+		result types.AlertActionResult
+	}{
+		{
+			name:   "capture on the affected nodes",
+			action: types.AlertAction{Type: "capture", BPFFilter: "tcp"},
+			data:   []interface{}{node},
+			result: types.AlertActionResult{Type: "capture", ID: "capture-1"},
+		},
+		{
+			name:   "capture without any node",
+			action: types.AlertAction{Type: "capture"},
+			data:   true,
+			result: types.AlertActionResult{Type: "capture", Error: "No node to capture on"},
+		},
+		{
+			name:   "capture with a query",
+			action: types.AlertAction{Type: "capture", GremlinQuery: "G.V().Has('Name', 'eth1')"},
+			data:   true,
+			result: types.AlertActionResult{Type: "capture", ID: "capture-2"},
+		},
+		{
+			name:   "injection from the affected node",
+			action: types.AlertAction{Type: "injection", Injection: &types.PacketInjection{Dst: "G.V().Has('Name', 'eth1')", Type: "icmp4", Count: 1}},
+			data:   node,
+			result: types.AlertActionResult{Type: "injection", ID: "injectpacket-1"},
+		},
+		{
+			name:   "unknown workflow",
+			action: types.AlertAction{Type: "workflow", Workflow: "unknown"},
+			data:   node,
+			result: types.AlertActionResult{Type: "workflow", Error: "No workflow found with ID: unknown"},
+		},
+		{
+			name:   "unsupported action",
+			action: types.AlertAction{Type: "reboot"},
+			data:   node,
+			result: types.AlertActionResult{Type: "reboot", Error: "Unsupported action type 'reboot'"},
+		},
+	} {
+		pool := &fakePool{}
+		server := &Server{Pool: pool, apiServer: apiServer}
+		al := &GremlinAlert{Alert: &types.Alert{
+			BasicResource: types.BasicResource{UUID: "alert"},
+			Name:          "test",
+			Actions:       []types.AlertAction{test.action},
+		}}
+
+		server.runActions(al, &Message{UUID: "alert", Occurrence: "occurrence", ReasonData: test.data})
+
+		if len(pool.messages) != 1 || pool.messages[0].Type != "AlertActions" {
+			t.Errorf("%s: expected the results to be broadcasted, got %v", test.name, pool.messages)
+			continue
+		}
+
+		var actionsMsg ActionsMessage
+		if err := json.Unmarshal(pool.messages[0].Obj, &actionsMsg); err != nil {
+			t.Fatal(err)
+		}
+
+		if actionsMsg.Occurrence != "occurrence" || len(actionsMsg.Results) != 1 || !reflect.DeepEqual(actionsMsg.Results[0], test.result) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.result, actionsMsg)
+		}
+	}
+
+	if capture := captures.created[0].(*types.Capture); capture.GremlinQuery != "G.V().Has('ID', Within('n1'))" || capture.BPFFilter != "tcp" {
+		t.Errorf("Expected a capture on the affected node, got %+v", capture)
+	}
+
+	if injection := injections.created[0].(*types.PacketInjection); injection.Src != "G.V('n1')" {
+		t.Errorf("Expected the packets to be injected from the affected node, got %+v", injection)
+	}
+}
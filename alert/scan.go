@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package alert
+
+import (
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/skydive-project/skydive/flow/scan"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// ScanAlertPrefix prefixes the UUID of the alerts raised by scanning
+// behaviors, it is followed by the behavior, portscan or sweep
+const ScanAlertPrefix = "scan:"
+
+// OnScanDetected raises an alert for a scanning behavior, the detection
+// holding the topology context of the source
+func (a *Server) OnScanDetected(d *scan.Detection) {
+	occurrence, _ := uuid.NewV4()
+	msg := Message{
+		UUID:       ScanAlertPrefix + d.Type,
+		Occurrence: occurrence.String(),
+		Timestamp:  time.Now().UTC(),
+		ReasonData: d,
+	}
+
+	a.Pool.BroadcastMessage(ws.NewStructMessage(Namespace, "Alert", msg))
+	a.notifyListeners(&msg)
+}
@@ -28,6 +28,8 @@ import (
 	"strings"
 	"time"
 
+	uuid "github.com/nu7hatch/gouuid"
+
 	api "github.com/skydive-project/skydive/api/server"
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
@@ -182,6 +184,11 @@ func NewGremlinAlert(alert *types.Alert, g *graph.Graph, p *traversal.GremlinTra
 	return ga, nil
 }
 
+// Listener is notified of the alerts triggered by the server
+type Listener interface {
+	OnAlert(msg *Message)
+}
+
 // Server describes an alerting alerts that evaluates registered
 // alerts on graph events or periodically and trigger them if their condition
 // evaluates to true
@@ -197,19 +204,37 @@ type Server struct {
 	alertTimers   map[string]chan bool
 	gremlinParser *traversal.GremlinTraversalParser
 	runtime       *js.Runtime
+	listeners     []Listener
 }
 
 // Message describes a websocket message that is sent by the alerting
-// server when an alert was triggered
+// server when an alert was triggered, Occurrence identifying this trigger
 type Message struct {
 	UUID       string
+	Occurrence string
 	Timestamp  time.Time
 	ReasonData interface{}
 }
 
+// AddListener registers a listener notified of the triggered alerts, the
+// listeners have to be registered before the server is started
+func (a *Server) AddListener(l Listener) {
+	a.Lock()
+	a.listeners = append(a.listeners, l)
+	a.Unlock()
+}
+
+func (a *Server) notifyListeners(msg *Message) {
+	for _, l := range a.listeners {
+		l.OnAlert(msg)
+	}
+}
+
 func (a *Server) triggerAlert(al *GremlinAlert, data interface{}) error {
+	occurrence, _ := uuid.NewV4()
 	msg := Message{
 		UUID:       al.UUID,
+		Occurrence: occurrence.String(),
 		Timestamp:  time.Now().UTC(),
 		ReasonData: data,
 	}
@@ -229,6 +254,13 @@ func (a *Server) triggerAlert(al *GremlinAlert, data interface{}) error {
 
 	wsMsg := ws.NewStructMessage(Namespace, "Alert", msg)
 	a.Pool.BroadcastMessage(wsMsg)
+	a.notifyListeners(&msg)
+
+	// the actions are run asynchronously as the alerts may be evaluated
+	// with the graph lock held
+	if len(al.Actions) > 0 {
+		go a.runActions(al, &msg)
+	}
 
 	logging.GetLogger().Debugf("Alert %s of type %s was triggerred", al.UUID, al.Action)
 	return nil
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package alert
+
+import (
+	"strings"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/skydive-project/skydive/flow/spoofing"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// SpoofingAlertPrefix prefixes the UUID of the alerts raised by conflicting
+// address claims, it is followed by the protocol, arp or ndp
+const SpoofingAlertPrefix = "spoofing:"
+
+// OnSpoofingDetected raises an alert for a claim conflicting with a known
+// address binding
+func (a *Server) OnSpoofingDetected(c *spoofing.Conflict) {
+	occurrence, _ := uuid.NewV4()
+	msg := Message{
+		UUID:       SpoofingAlertPrefix + strings.ToLower(c.Protocol),
+		Occurrence: occurrence.String(),
+		Timestamp:  time.Now().UTC(),
+		ReasonData: c,
+	}
+
+	a.Pool.BroadcastMessage(ws.NewStructMessage(Namespace, "Alert", msg))
+	a.notifyListeners(&msg)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package alert
+
+import (
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/threatintel"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// ThreatAlertPrefix prefixes the UUID of the alerts raised by the threat
+// intelligence sources, it is followed by the source name
+const ThreatAlertPrefix = "threat-intel:"
+
+// ThreatReason describes the flow and the indicators that raised a threat alert
+type ThreatReason struct {
+	Flow      *flow.Flow
+	Indicator string
+	Type      string
+	Endpoint  string
+}
+
+// OnThreatMatched raises an alert for each indicator matched by a flow
+func (a *Server) OnThreatMatched(f *flow.Flow, matches []threatintel.Match) {
+	for _, match := range matches {
+		msg := Message{
+			UUID:      ThreatAlertPrefix + match.Source,
+			Timestamp: time.Now().UTC(),
+			ReasonData: ThreatReason{
+				Flow:      f,
+				Indicator: match.Indicator,
+				Type:      match.Type,
+				Endpoint:  match.Endpoint,
+			},
+		}
+
+		logging.GetLogger().Infof("Flow %s matches indicator %s of threat intelligence source %s", f.UUID, match.Indicator, match.Source)
+
+		a.Pool.BroadcastMessage(ws.NewStructMessage(Namespace, "Alert", msg))
+		a.notifyListeners(&msg)
+	}
+}
@@ -18,6 +18,7 @@
 package analyzer
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net"
@@ -33,12 +34,25 @@ import (
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
-// FlowClientPool describes a flow client pool.
+// FlowClientPool describes a flow client pool. Flows are spread across the
+// analyzers according to the load they advertise, the flows sent to an
+// analyzer are kept for a while to be sent again to another one if the
+// analyzer fails.
 type FlowClientPool struct {
 	common.RWMutex
 	ws.DefaultSpeakerEventHandler
-	flowClients []*FlowClient
-	authOpts    *shttp.AuthenticationOpts
+	flowClients  []*FlowClient
+	authOpts     *shttp.AuthenticationOpts
+	pending      [][]byte
+	maxPending   int
+	replayWindow time.Duration
+	retryDelay   time.Duration
+}
+
+// sentFlows holds the flows sent to an analyzer
+type sentFlows struct {
+	time  time.Time
+	flows [][]byte
 }
 
 // FlowClient describes a flow client connection
@@ -46,6 +60,10 @@ type FlowClient struct {
 	addr           string
 	port           int
 	flowClientConn FlowClientConn
+	load           *FlowServerLoad
+	loadTime       time.Time
+	failedUntil    time.Time
+	sent           []sentFlows
 }
 
 // FlowClientConn is the interface to be implemented by the flow clients
@@ -126,11 +144,12 @@ func NewFlowClientWebSocketConn(url *url.URL, authOpts *shttp.AuthenticationOpts
 	return &FlowClientWebSocketConn{url: url, authOpts: authOpts}, nil
 }
 
-func (c *FlowClient) connect() {
+func (c *FlowClient) connect() error {
 	if err := c.flowClientConn.Connect(); err != nil {
 		logging.GetLogger().Errorf("Connection error to %s:%d : %s", c.addr, c.port, err)
-		time.Sleep(200 * time.Millisecond)
+		return err
 	}
+	return nil
 }
 
 func (c *FlowClient) close() {
@@ -139,6 +158,28 @@ func (c *FlowClient) close() {
 	}
 }
 
+// send sends marshaled flows, the connection being re-established once
+// in case of error
+func (c *FlowClient) send(flows [][]byte) error {
+	for i, data := range flows {
+		if err := c.flowClientConn.Send(data); err != nil {
+			logging.GetLogger().Errorf("flows connection to analyzer %s:%d error %s : try to reconnect", c.addr, c.port, err)
+			c.close()
+			if err := c.connect(); err != nil {
+				return err
+			}
+
+			for _, data := range flows[i:] {
+				if err := c.flowClientConn.Send(data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
 // SendFlow sends a flow to the server
 func (c *FlowClient) SendFlow(f *flow.Flow) error {
 	data, err := f.Marshal()
@@ -146,16 +187,7 @@ func (c *FlowClient) SendFlow(f *flow.Flow) error {
 		return err
 	}
 
-retry:
-	err = c.flowClientConn.Send(data)
-	if err != nil {
-		logging.GetLogger().Errorf("flows connection to analyzer error %s : try to reconnect", err)
-		c.close()
-		c.connect()
-		goto retry
-	}
-
-	return nil
+	return c.send([][]byte{data})
 }
 
 // SendFlows sends flows to the server
@@ -169,6 +201,35 @@ func (c *FlowClient) SendFlows(flowArray *flow.FlowArray) {
 	}
 }
 
+// weight returns the share of the flows to send to the analyzer, the
+// analyzers which didn't advertise their load recently getting an average
+// share
+func (c *FlowClient) weight(now time.Time) float64 {
+	if c.load == nil || now.Sub(c.loadTime) > 3*time.Duration(c.load.Period)*time.Second {
+		return 0.5
+	}
+
+	// overloaded analyzers still get a few flows so that the others
+	// are not overloaded in turn
+	if w := 1 - c.load.Load; w > 0.05 {
+		return w
+	}
+	return 0.05
+}
+
+func (c *FlowClient) healthy(now time.Time) bool {
+	return now.After(c.failedUntil)
+}
+
+// recordSent keeps the flows sent during the replay window
+func (c *FlowClient) recordSent(now time.Time, flows [][]byte, window time.Duration) {
+	i := 0
+	for i < len(c.sent) && now.Sub(c.sent[i].time) > window {
+		i++
+	}
+	c.sent = append(c.sent[i:], sentFlows{time: now, flows: flows})
+}
+
 // NewFlowClient creates a flow client and creates a new connection to the server
 func NewFlowClient(addr string, port int, authOpts *shttp.AuthenticationOpts) (*FlowClient, error) {
 	var (
@@ -196,19 +257,28 @@ func NewFlowClient(addr string, port int, authOpts *shttp.AuthenticationOpts) (*
 	return fc, nil
 }
 
+func (p *FlowClientPool) removeClient(addr string, port int) (removed []*FlowClient) {
+	flowClients := p.flowClients[:0]
+	for _, fc := range p.flowClients {
+		if fc.addr == addr && fc.port == port {
+			fc.close()
+			removed = append(removed, fc)
+		} else {
+			flowClients = append(flowClients, fc)
+		}
+	}
+	p.flowClients = flowClients
+	return
+}
+
 // OnConnected websocket event handler
 func (p *FlowClientPool) OnConnected(c ws.Speaker) {
 	p.Lock()
 	defer p.Unlock()
 
 	addr, port := c.GetAddrPort()
-	for i, fc := range p.flowClients {
-		if fc.addr == addr && fc.port == port {
-			logging.GetLogger().Warningf("Got a connected event on already connected client: %s:%d", addr, port)
-			fc.close()
-
-			p.flowClients = append(p.flowClients[:i], p.flowClients[i+1:]...)
-		}
+	if removed := p.removeClient(addr, port); len(removed) > 0 {
+		logging.GetLogger().Warningf("Got a connected event on already connected client: %s:%d", addr, port)
 	}
 
 	flowClient, err := NewFlowClient(addr, port, p.authOpts)
@@ -218,34 +288,125 @@ func (p *FlowClientPool) OnConnected(c ws.Speaker) {
 	}
 
 	p.flowClients = append(p.flowClients, flowClient)
+
+	// send the flows kept while no analyzer was available
+	if len(p.pending) > 0 {
+		pending := p.pending
+		p.pending = nil
+		p.sendFlows(pending)
+	}
 }
 
-// OnDisconnected websocket event handler
+// OnDisconnected websocket event handler, the flows recently sent to the
+// analyzer are sent to the other ones as they may have been lost
 func (p *FlowClientPool) OnDisconnected(c ws.Speaker) {
 	p.Lock()
 	defer p.Unlock()
 
 	addr, port := c.GetAddrPort()
-	for i, fc := range p.flowClients {
+	for _, fc := range p.removeClient(addr, port) {
+		for _, sent := range fc.sent {
+			p.sendFlows(sent.flows)
+		}
+	}
+}
+
+// OnStructMessage websocket event handler, receiving the load advertised
+// by the analyzers
+func (p *FlowClientPool) OnStructMessage(c ws.Speaker, m *ws.StructMessage) {
+	if m.Type != FlowServerLoadMsgType {
+		return
+	}
+
+	var load FlowServerLoad
+	if err := json.Unmarshal(m.Obj, &load); err != nil {
+		logging.GetLogger().Errorf("Unable to decode flow server load %v", m)
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	addr, port := c.GetAddrPort()
+	for _, fc := range p.flowClients {
 		if fc.addr == addr && fc.port == port {
-			fc.close()
+			fc.load, fc.loadTime = &load, time.Now()
+		}
+	}
+}
+
+// pickClient returns a healthy client using a random selection weighted by
+// the load of the analyzers
+func (p *FlowClientPool) pickClient(now time.Time) *FlowClient {
+	var total float64
+	var candidates []*FlowClient
+	for _, fc := range p.flowClients {
+		if fc.healthy(now) {
+			candidates = append(candidates, fc)
+			total += fc.weight(now)
+		}
+	}
 
-			p.flowClients = append(p.flowClients[:i], p.flowClients[i+1:]...)
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	r := rand.Float64() * total
+	for _, fc := range candidates {
+		if r -= fc.weight(now); r < 0 {
+			return fc
 		}
 	}
+	return candidates[len(candidates)-1]
 }
 
-// SendFlows sends flows using a random connection
-func (p *FlowClientPool) SendFlows(flowArray *flow.FlowArray) {
-	p.RLock()
-	defer p.RUnlock()
+// sendFlows sends marshaled flows to one analyzer, failing over to the
+// others in case of error. The flows are kept, up to a limit, when no
+// analyzer is available.
+func (p *FlowClientPool) sendFlows(flows [][]byte) {
+	now := time.Now()
+	for {
+		fc := p.pickClient(now)
+		if fc == nil {
+			break
+		}
+
+		if err := fc.send(flows); err != nil {
+			logging.GetLogger().Errorf("Unable to send flows to %s:%d, failing over: %s", fc.addr, fc.port, err)
+			fc.failedUntil = now.Add(p.retryDelay)
+			continue
+		}
 
-	if len(p.flowClients) == 0 {
+		fc.recordSent(now, flows, p.replayWindow)
 		return
 	}
 
-	fc := p.flowClients[rand.Intn(len(p.flowClients))]
-	fc.SendFlows(flowArray)
+	p.pending = append(p.pending, flows...)
+	if dropped := len(p.pending) - p.maxPending; dropped > 0 {
+		logging.GetLogger().Warningf("No analyzer available, dropping %d flows", dropped)
+		p.pending = p.pending[dropped:]
+	}
+}
+
+// SendFlows sends flows to one of the analyzers
+func (p *FlowClientPool) SendFlows(flowArray *flow.FlowArray) {
+	if len(flowArray.Flows) == 0 {
+		return
+	}
+
+	flows := make([][]byte, 0, len(flowArray.Flows))
+	for _, f := range flowArray.Flows {
+		data, err := f.Marshal()
+		if err != nil {
+			logging.GetLogger().Errorf("Unable to marshal flow: %s", err)
+			continue
+		}
+		flows = append(flows, data)
+	}
+
+	p.Lock()
+	p.sendFlows(flows)
+	p.Unlock()
 }
 
 // Close all connections
@@ -258,11 +419,15 @@ func (p *FlowClientPool) Close() {
 // NewFlowClientPool returns a new FlowClientPool using the websocket connections
 // to maintain the pool of client up to date according to the websocket connections
 // status.
-func NewFlowClientPool(pool ws.SpeakerPool, authOpts *shttp.AuthenticationOpts) *FlowClientPool {
+func NewFlowClientPool(pool ws.StructSpeakerPool, authOpts *shttp.AuthenticationOpts) *FlowClientPool {
 	p := &FlowClientPool{
-		flowClients: make([]*FlowClient, 0),
-		authOpts:    authOpts,
+		flowClients:  make([]*FlowClient, 0),
+		authOpts:     authOpts,
+		maxPending:   config.GetInt("agent.flow.failover.max_buffer_size"),
+		replayWindow: time.Duration(config.GetInt("agent.flow.failover.replay_window")) * time.Second,
+		retryDelay:   time.Duration(config.GetInt("agent.flow.failover.retry_delay")) * time.Second,
 	}
 	pool.AddEventHandler(p)
+	pool.AddStructMessageHandler(p, []string{FlowServerNamespace})
 	return p
 }
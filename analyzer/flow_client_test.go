@@ -0,0 +1,135 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeFlowConn struct {
+	failed   bool
+	closed   bool
+	received [][]byte
+}
+
+func (c *fakeFlowConn) Connect() error {
+	if c.failed {
+		return errors.New("connection refused")
+	}
+	c.closed = false
+	return nil
+}
+
+func (c *fakeFlowConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeFlowConn) Send(data []byte) error {
+	if c.failed || c.closed {
+		return errors.New("connection closed")
+	}
+	c.received = append(c.received, data)
+	return nil
+}
+
+type fakeAnalyzerSpeaker struct {
+	ws.Speaker
+	addr string
+	port int
+}
+
+func (s *fakeAnalyzerSpeaker) GetAddrPort() (string, int) {
+	return s.addr, s.port
+}
+
+func newFakeFlowClient(addr string) (*FlowClient, *fakeFlowConn) {
+	conn := &fakeFlowConn{}
+	return &FlowClient{addr: addr, port: 8082, flowClientConn: conn}, conn
+}
+
+func newTestFlowClientPool(clients ...*FlowClient) *FlowClientPool {
+	return &FlowClientPool{
+		flowClients:  clients,
+		maxPending:   2,
+		replayWindow: time.Minute,
+		retryDelay:   time.Minute,
+	}
+}
+
+func TestFlowClientFailover(t *testing.T) {
+	active, activeConn := newFakeFlowClient("analyzer1")
+	pool := newTestFlowClientPool(active)
+
+	flows := [][]byte{[]byte("flow1"), []byte("flow2")}
+	pool.sendFlows(flows)
+	if !reflect.DeepEqual(activeConn.received, flows) {
+		t.Fatalf("Expected the flows to be sent to the active analyzer, got %q", activeConn.received)
+	}
+
+	// the flows sent to the dropped analyzer are sent again to the next one
+	next, nextConn := newFakeFlowClient("analyzer2")
+	pool.flowClients = append(pool.flowClients, next)
+	pool.OnDisconnected(&fakeAnalyzerSpeaker{addr: "analyzer1", port: 8082})
+
+	if !activeConn.closed || len(pool.flowClients) != 1 {
+		t.Errorf("Expected the dropped analyzer to be removed, got %v", pool.flowClients)
+	}
+	if !reflect.DeepEqual(nextConn.received, flows) {
+		t.Errorf("Expected the flows to be resent to the next analyzer, got %q", nextConn.received)
+	}
+
+	// an analyzer failing while sending is skipped until the retry delay
+	failing, failingConn := newFakeFlowClient("analyzer3")
+	failingConn.failed = true
+	pool.flowClients = []*FlowClient{failing, next}
+	nextConn.received = nil
+
+	for i := 0; i < 10; i++ {
+		pool.sendFlows([][]byte{[]byte("flow3")})
+	}
+	if len(nextConn.received) != 10 || len(failingConn.received) != 0 {
+		t.Errorf("Expected all the flows to be sent to the healthy analyzer, got %d", len(nextConn.received))
+	}
+	if failing.healthy(time.Now()) {
+		t.Error("Expected the failing analyzer to be marked as failed")
+	}
+}
+
+func TestFlowClientPending(t *testing.T) {
+	pool := newTestFlowClientPool()
+
+	// the oldest flows are dropped when no analyzer is available
+	pool.sendFlows([][]byte{[]byte("flow1"), []byte("flow2"), []byte("flow3")})
+	if expected := [][]byte{[]byte("flow2"), []byte("flow3")}; !reflect.DeepEqual(pool.pending, expected) {
+		t.Errorf("Expected %q to be kept, got %q", expected, pool.pending)
+	}
+
+	fc, conn := newFakeFlowClient("analyzer1")
+	conn.failed = true
+	pool.flowClients = []*FlowClient{fc}
+	pool.sendFlows([][]byte{[]byte("flow4")})
+	if len(pool.pending) != 2 || string(pool.pending[1]) != "flow4" {
+		t.Errorf("Expected the flows to be kept while the analyzer fails, got %q", pool.pending)
+	}
+}
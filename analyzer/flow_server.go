@@ -49,6 +49,28 @@ const (
 	FlowBulkMaxDelayDefault int = 5
 )
 
+const (
+	// FlowServerNamespace websocket namespace of the flow server messages
+	FlowServerNamespace = "FlowServer"
+
+	// FlowServerLoadMsgType message type of the load advertised to the agents
+	FlowServerLoadMsgType = "FlowServerLoad"
+)
+
+// FlowServerLoad describes the load advertised by an analyzer to the agents
+// so that they spread the flows across the analyzers
+type FlowServerLoad struct {
+	// Load between 0 and 1, the highest of the flow rate compared to the
+	// configured capacity and the usage of the flow buffer
+	Load float64
+	// FlowRate number of flows received per second
+	FlowRate float64
+	// BufferUsage usage of the flow buffer between 0 and 1
+	BufferUsage float64
+	// Period in seconds between two advertisements
+	Period int
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
@@ -92,6 +114,17 @@ type FlowServer struct {
 	quit               chan struct{}
 	auth               shttp.AuthenticationBackend
 	subscriberEndpoint *FlowSubscriberEndpoint
+	taggers            []FlowTagger
+	agentPool          ws.StructSpeakerPool
+	loadPeriod         int
+	capacity           int
+	maxBufferSize      int
+}
+
+// FlowTagger is the interface of the enhancers applied to the flows received
+// by the flow server before they get stored
+type FlowTagger interface {
+	Tag(f *flow.Flow)
 }
 
 // OnMessage event
@@ -201,6 +234,28 @@ func NewFlowServerUDPConn(addr string, port int) (*FlowServerUDPConn, error) {
 	return &FlowServerUDPConn{conn: conn, maxFlowBufferSize: flowsMax}, err
 }
 
+// advertiseLoad sends the load of the flow server to the agents
+func (s *FlowServer) advertiseLoad(received int) {
+	load := &FlowServerLoad{
+		FlowRate: float64(received) / float64(s.loadPeriod),
+		Period:   s.loadPeriod,
+	}
+
+	if s.maxBufferSize > 0 {
+		load.BufferUsage = float64(len(s.ch)) / float64(s.maxBufferSize)
+	}
+
+	load.Load = load.BufferUsage
+	if s.capacity > 0 && load.FlowRate/float64(s.capacity) > load.Load {
+		load.Load = load.FlowRate / float64(s.capacity)
+	}
+	if load.Load > 1 {
+		load.Load = 1
+	}
+
+	s.agentPool.BroadcastMessage(ws.NewStructMessage(FlowServerNamespace, FlowServerLoadMsgType, load))
+}
+
 func (s *FlowServer) storeFlows(flows *flow.FlowArray) {
 	if len(flows.Flows) > 0 {
 		if s.storage != nil {
@@ -227,9 +282,13 @@ func (s *FlowServer) Start() {
 		dlTimer := time.NewTicker(s.bulkInsertDeadline)
 		defer dlTimer.Stop()
 
+		loadTicker := time.NewTicker(time.Duration(s.loadPeriod) * time.Second)
+		defer loadTicker.Stop()
+
 		var flowArray flow.FlowArray
 		defer s.storeFlows(&flowArray)
 
+		received := 0
 		for {
 			select {
 			case <-s.quit:
@@ -237,7 +296,14 @@ func (s *FlowServer) Start() {
 			case <-dlTimer.C:
 				s.storeFlows(&flowArray)
 				flowArray.Flows = flowArray.Flows[:0]
+			case <-loadTicker.C:
+				s.advertiseLoad(received)
+				received = 0
 			case f := <-s.ch:
+				received++
+				for _, tagger := range s.taggers {
+					tagger.Tag(f)
+				}
 				flowArray.Flows = append(flowArray.Flows, f)
 				if len(flowArray.Flows) >= s.bulkInsert {
 					s.storeFlows(&flowArray)
@@ -275,12 +341,13 @@ func (s *FlowServer) setupBulkConfigFromBackend() error {
 
 	flowsMax := config.GetConfig().GetInt("analyzer.flow.max_buffer_size")
 	s.ch = make(chan *flow.Flow, max(flowsMax, s.bulkInsert*2))
+	s.maxBufferSize = flowsMax
 
 	return nil
 }
 
 // NewFlowServer creates a new flow server listening at address/port, based on configuration
-func NewFlowServer(s *shttp.Server, g *graph.Graph, store storage.Storage, endpoint *FlowSubscriberEndpoint, probe *probe.Bundle, auth shttp.AuthenticationBackend) (*FlowServer, error) {
+func NewFlowServer(s *shttp.Server, g *graph.Graph, store storage.Storage, endpoint *FlowSubscriberEndpoint, probe *probe.Bundle, auth shttp.AuthenticationBackend, agentPool ws.StructSpeakerPool, taggers ...FlowTagger) (*FlowServer, error) {
 	var conn FlowServerConn
 	protocol := strings.ToLower(config.GetString("flow.protocol"))
 
@@ -304,6 +371,10 @@ func NewFlowServer(s *shttp.Server, g *graph.Graph, store storage.Storage, endpo
 		quit:               make(chan struct{}, 2),
 		auth:               auth,
 		subscriberEndpoint: endpoint,
+		taggers:            taggers,
+		agentPool:          agentPool,
+		loadPeriod:         config.GetInt("analyzer.flow.load_update"),
+		capacity:           config.GetInt("analyzer.flow.capacity"),
 	}
 	err = fs.setupBulkConfigFromBackend()
 	if err != nil {
@@ -22,15 +22,30 @@ import (
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
+// FlowListener is notified of the flows received by the analyzer
+type FlowListener interface {
+	OnFlows(flowArray *flow.FlowArray)
+}
+
 // FlowSubscriberEndpoint sends all the flows to its subscribers.
 type FlowSubscriberEndpoint struct {
-	pool ws.StructSpeakerPool
+	pool      ws.StructSpeakerPool
+	listeners []FlowListener
+}
+
+// AddFlowListener registers a listener notified of the flows sent
+func (fs *FlowSubscriberEndpoint) AddFlowListener(l FlowListener) {
+	fs.listeners = append(fs.listeners, l)
 }
 
 // SendFlows sends flow to the subscribers
 func (fs *FlowSubscriberEndpoint) SendFlows(flowArray *flow.FlowArray) {
 	msg := ws.NewStructMessage("flow", "store", flowArray.Flows)
 	fs.pool.BroadcastMessage(msg)
+
+	for _, l := range fs.listeners {
+		l.OnFlows(flowArray)
+	}
 }
 
 // NewFlowSubscriberEndpoint returns a new server to be used by external flow subscribers
@@ -0,0 +1,253 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// FlowTailNamespace is the WebSocket namespace of the flow live tails
+	FlowTailNamespace = "FlowTail"
+)
+
+// FlowTailSubscription is sent by the clients with the Subscribe message to
+// follow the updates of flows, given by their UUIDs or selected by a
+// Gremlin query evaluated once at subscription, and with the Unsubscribe
+// message to stop
+type FlowTailSubscription struct {
+	ID           string
+	UUIDs        []string `json:",omitempty"`
+	GremlinQuery string   `json:",omitempty"`
+}
+
+// FlowTailUpdate is sent with the Update message as soon as an update of a
+// followed flow is received from an agent. Delta holds the metric since the
+// previous update.
+type FlowTailUpdate struct {
+	ID         string
+	UUID       string
+	Delta      *flow.FlowMetric `json:",omitempty"`
+	Metric     *flow.FlowMetric `json:",omitempty"`
+	TCPMetric  *flow.TCPMetric  `json:",omitempty"`
+	Last       int64
+	FinishType string `json:",omitempty"`
+}
+
+type flowTail struct {
+	speaker ws.Speaker
+	id      string
+	uuids   []string
+}
+
+// FlowTailEndpoint sends to its subscribers the updates of the flows they
+// follow, to watch a connection while troubleshooting
+type FlowTailEndpoint struct {
+	sync.RWMutex
+	ws.DefaultSpeakerEventHandler
+	graph         *graph.Graph
+	gremlinParser *traversal.GremlinTraversalParser
+	tails         map[ws.Speaker]map[string]*flowTail
+	byUUID        map[string]map[*flowTail]bool
+	maxFlows      int
+}
+
+// selectFlows returns the UUIDs of the flows returned by a Gremlin query
+func (t *FlowTailEndpoint) selectFlows(gremlinQuery string) ([]string, error) {
+	ts, err := t.gremlinParser.Parse(strings.NewReader(gremlinQuery))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ts.Exec(t.graph, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var uuids []string
+	for _, v := range res.Values() {
+		f, ok := v.(*flow.Flow)
+		if !ok {
+			return nil, fmt.Errorf("Query doesn't return flows")
+		}
+		uuids = append(uuids, f.UUID)
+	}
+
+	return uuids, nil
+}
+
+func (t *FlowTailEndpoint) remove(tail *flowTail) {
+	for _, uuid := range tail.uuids {
+		if tails := t.byUUID[uuid]; tails != nil {
+			delete(tails, tail)
+			if len(tails) == 0 {
+				delete(t.byUUID, uuid)
+			}
+		}
+	}
+	delete(t.tails[tail.speaker], tail.id)
+}
+
+func (t *FlowTailEndpoint) subscribe(c ws.Speaker, msg *ws.StructMessage) {
+	var subscription FlowTailSubscription
+	if err := json.Unmarshal(msg.Obj, &subscription); err != nil || subscription.ID == "" || (len(subscription.UUIDs) == 0 && subscription.GremlinQuery == "") {
+		c.SendMessage(msg.Reply("Subscription ID and flow UUIDs or GremlinQuery expected", "SubscribeReply", http.StatusBadRequest))
+		return
+	}
+
+	uuids := subscription.UUIDs
+	if subscription.GremlinQuery != "" {
+		selected, err := t.selectFlows(subscription.GremlinQuery)
+		if err != nil {
+			c.SendMessage(msg.Reply(fmt.Sprintf("Invalid Gremlin query: %s", err), "SubscribeReply", http.StatusBadRequest))
+			return
+		}
+		uuids = append(uuids, selected...)
+	}
+
+	if t.maxFlows > 0 && len(uuids) > t.maxFlows {
+		c.SendMessage(msg.Reply(fmt.Sprintf("%d flows selected, a maximum of %d can be followed", len(uuids), t.maxFlows), "SubscribeReply", http.StatusForbidden))
+		return
+	}
+
+	tail := &flowTail{speaker: c, id: subscription.ID, uuids: uuids}
+
+	t.Lock()
+	if previous, ok := t.tails[c][tail.id]; ok {
+		t.remove(previous)
+	}
+	if _, ok := t.tails[c]; !ok {
+		t.tails[c] = make(map[string]*flowTail)
+	}
+	t.tails[c][tail.id] = tail
+	for _, uuid := range uuids {
+		if _, ok := t.byUUID[uuid]; !ok {
+			t.byUUID[uuid] = make(map[*flowTail]bool)
+		}
+		t.byUUID[uuid][tail] = true
+	}
+	t.Unlock()
+
+	logging.GetLogger().Infof("Client %s following flows %v", c.GetRemoteHost(), uuids)
+
+	c.SendMessage(msg.Reply(uuids, "SubscribeReply", http.StatusOK))
+}
+
+func (t *FlowTailEndpoint) unsubscribe(c ws.Speaker, msg *ws.StructMessage) {
+	var subscription FlowTailSubscription
+	if err := json.Unmarshal(msg.Obj, &subscription); err != nil {
+		c.SendMessage(msg.Reply("Subscription ID expected", "UnsubscribeReply", http.StatusBadRequest))
+		return
+	}
+
+	t.Lock()
+	if tail, ok := t.tails[c][subscription.ID]; ok {
+		t.remove(tail)
+	}
+	t.Unlock()
+
+	c.SendMessage(msg.Reply(nil, "UnsubscribeReply", http.StatusOK))
+}
+
+// OnStructMessage is triggered when receiving a message from a subscriber
+func (t *FlowTailEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	switch msg.Type {
+	case "Subscribe":
+		t.subscribe(c, msg)
+	case "Unsubscribe":
+		t.unsubscribe(c, msg)
+	}
+}
+
+// OnDisconnected called when a subscriber got disconnected
+func (t *FlowTailEndpoint) OnDisconnected(c ws.Speaker) {
+	t.Lock()
+	for _, tail := range t.tails[c] {
+		t.remove(tail)
+	}
+	delete(t.tails, c)
+	t.Unlock()
+}
+
+// OnFlows sends the updates of the followed flows received from the agents
+func (t *FlowTailEndpoint) OnFlows(flowArray *flow.FlowArray) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if len(t.byUUID) == 0 {
+		return
+	}
+
+	for _, f := range flowArray.Flows {
+		tails, ok := t.byUUID[f.UUID]
+		if !ok {
+			continue
+		}
+
+		// copied as the messages are encoded asynchronously
+		update := FlowTailUpdate{UUID: f.UUID, Last: f.Last}
+		if m := f.LastUpdateMetric; m != nil {
+			delta := *m
+			update.Delta = &delta
+		}
+		if m := f.Metric; m != nil {
+			metric := *m
+			update.Metric = &metric
+		}
+		if m := f.TCPMetric; m != nil {
+			tcpMetric := *m
+			update.TCPMetric = &tcpMetric
+		}
+		if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+			update.FinishType = f.FinishType.String()
+		}
+
+		for tail := range tails {
+			update.ID = tail.id
+			tail.speaker.SendMessage(ws.NewStructMessage(FlowTailNamespace, "Update", update))
+		}
+	}
+}
+
+// NewFlowTailEndpoint returns a new server to be used by the clients
+// following the updates of flows
+func NewFlowTailEndpoint(pool ws.StructSpeakerPool, g *graph.Graph, tr *traversal.GremlinTraversalParser) *FlowTailEndpoint {
+	t := &FlowTailEndpoint{
+		graph:         g,
+		gremlinParser: tr,
+		tails:         make(map[ws.Speaker]map[string]*flowTail),
+		byUUID:        make(map[string]map[*flowTail]bool),
+		maxFlows:      config.GetInt("analyzer.flow_tail.max_flows"),
+	}
+
+	pool.AddEventHandler(t)
+	pool.AddStructMessageHandler(t, []string{FlowTailNamespace})
+
+	return t
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeSpeaker struct {
+	ws.Speaker
+	messages []*ws.StructMessage
+}
+
+func (s *fakeSpeaker) GetRemoteHost() string {
+	return "fake"
+}
+
+// SendMessage records the messages as received by a client
+func (s *fakeSpeaker) SendMessage(m ws.Message) error {
+	b, err := m.Bytes(ws.JSONProtocol)
+	if err != nil {
+		return err
+	}
+
+	var msg ws.StructMessage
+	if err := json.Unmarshal(b, &msg); err != nil {
+		return err
+	}
+	s.messages = append(s.messages, &msg)
+
+	return nil
+}
+
+type fakeSpeakerPool struct {
+	ws.StructSpeakerPool
+}
+
+func (p *fakeSpeakerPool) AddEventHandler(h ws.SpeakerEventHandler) {
+}
+
+func (p *fakeSpeakerPool) AddStructMessageHandler(h ws.SpeakerStructMessageHandler, namespaces []string) {
+}
+
+func tailMessage(t *testing.T, kind string, subscription *FlowTailSubscription) *ws.StructMessage {
+	obj, err := json.Marshal(subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ws.StructMessage{Namespace: FlowTailNamespace, Type: kind, UUID: "uuid", Obj: obj}
+}
+
+func TestFlowTail(t *testing.T) {
+	endpoint := NewFlowTailEndpoint(&fakeSpeakerPool{}, nil, nil)
+	c := &fakeSpeaker{}
+
+	endpoint.OnStructMessage(c, tailMessage(t, "Subscribe", &FlowTailSubscription{ID: "tail1"}))
+	if len(c.messages) != 1 || c.messages[0].Status != http.StatusBadRequest {
+		t.Fatalf("Expected a subscription without flow to be refused, got %+v", c.messages)
+	}
+	c.messages = nil
+
+	endpoint.OnStructMessage(c, tailMessage(t, "Subscribe", &FlowTailSubscription{ID: "tail1", UUIDs: []string{"flow1"}}))
+	if len(c.messages) != 1 || c.messages[0].Type != "SubscribeReply" || c.messages[0].Status != http.StatusOK {
+		t.Fatalf("Expected the subscription to be accepted, got %+v", c.messages)
+	}
+	c.messages = nil
+
+	endpoint.OnFlows(&flow.FlowArray{Flows: []*flow.Flow{
+		{
+			UUID:             "flow1",
+			Last:             2000,
+			Metric:           &flow.FlowMetric{ABPackets: 3, ABBytes: 300},
+			LastUpdateMetric: &flow.FlowMetric{ABPackets: 1, ABBytes: 100},
+		},
+		{
+			UUID:   "flow2",
+			Last:   2000,
+			Metric: &flow.FlowMetric{ABPackets: 1, ABBytes: 100},
+		},
+	}})
+
+	if len(c.messages) != 1 || c.messages[0].Type != "Update" {
+		t.Fatalf("Expected only the update of the followed flow, got %+v", c.messages)
+	}
+
+	var update FlowTailUpdate
+	if err := json.Unmarshal(c.messages[0].Obj, &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.ID != "tail1" || update.UUID != "flow1" || update.Last != 2000 || update.FinishType != "" {
+		t.Errorf("Unexpected update: %+v", update)
+	}
+	if update.Metric == nil || update.Metric.ABBytes != 300 || update.Delta == nil || update.Delta.ABBytes != 100 {
+		t.Errorf("Expected the metric and its delta, got %+v", update)
+	}
+	c.messages = nil
+
+	endpoint.OnFlows(&flow.FlowArray{Flows: []*flow.Flow{
+		{UUID: "flow1", Last: 3000, FinishType: flow.FlowFinishType_TCP_FIN},
+	}})
+
+	if len(c.messages) != 1 {
+		t.Fatalf("Expected the update of the finished flow, got %+v", c.messages)
+	}
+	if err := json.Unmarshal(c.messages[0].Obj, &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.FinishType != flow.FlowFinishType_TCP_FIN.String() {
+		t.Errorf("Expected the flow to be finished, got %+v", update)
+	}
+	c.messages = nil
+
+	endpoint.OnStructMessage(c, tailMessage(t, "Unsubscribe", &FlowTailSubscription{ID: "tail1"}))
+	endpoint.OnFlows(&flow.FlowArray{Flows: []*flow.Flow{{UUID: "flow1", Last: 4000}}})
+
+	if len(c.messages) != 1 || c.messages[0].Type != "UnsubscribeReply" {
+		t.Errorf("Expected no update after unsubscribing, got %+v", c.messages)
+	}
+	if len(endpoint.byUUID) != 0 || len(endpoint.tails[c]) != 0 {
+		t.Errorf("Expected the tail to be removed, got %+v", endpoint.tails)
+	}
+}
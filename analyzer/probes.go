@@ -22,11 +22,14 @@ import (
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/topology/probes/contrailconfig"
 	"github.com/skydive-project/skydive/topology/probes/fabric"
+	"github.com/skydive-project/skydive/topology/probes/gnmi"
 	"github.com/skydive-project/skydive/topology/probes/istio"
 	"github.com/skydive-project/skydive/topology/probes/k8s"
 	"github.com/skydive-project/skydive/topology/probes/ovn"
 	"github.com/skydive-project/skydive/topology/probes/peering"
+	"github.com/skydive-project/skydive/topology/probes/snmp"
 )
 
 // NewTopologyProbeBundleFromConfig creates a new topology server probes from configuration
@@ -53,11 +56,18 @@ func NewTopologyProbeBundleFromConfig(g *graph.Graph) (*probe.Bundle, error) {
 		switch t {
 		case "ovn":
 			addr := config.GetString("analyzer.topology.ovn.address")
-			probes[t], err = ovn.NewProbe(g, addr)
+			sbAddr := config.GetString("analyzer.topology.ovn.sb_address")
+			probes[t], err = ovn.NewProbe(g, addr, sbAddr)
 		case "k8s":
 			probes[t], err = k8s.NewK8sProbe(g)
 		case "istio":
 			probes[t], err = istio.NewIstioProbe(g)
+		case "snmp":
+			probes[t], err = snmp.NewProbeFromConfig(g)
+		case "gnmi":
+			probes[t], err = gnmi.NewProbeFromConfig(g)
+		case "contrail":
+			probes[t], err = contrailconfig.NewProbeFromConfig(g)
 		default:
 			logging.GetLogger().Errorf("unknown probe type: %s", t)
 			continue
@@ -0,0 +1,377 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// QuerySubscriptionNamespace is the WebSocket namespace of the Gremlin
+	// query subscriptions
+	QuerySubscriptionNamespace = "QuerySubscription"
+)
+
+// QuerySubscription is sent by the clients with the Subscribe message to
+// register a Gremlin query and with the Unsubscribe message to stop
+// receiving its results
+type QuerySubscription struct {
+	ID           string
+	GremlinQuery string `json:",omitempty"`
+}
+
+// QueryDiff is sent with the Diff message whenever the results of a query
+// change, the first one holding all the results as added. The elements are
+// keyed by their ID, or UUID for the flows, or by their index for the
+// other values.
+type QueryDiff struct {
+	ID        string
+	Added     map[string]json.RawMessage `json:",omitempty"`
+	Updated   map[string]json.RawMessage `json:",omitempty"`
+	Removed   map[string]json.RawMessage `json:",omitempty"`
+	Truncated bool                       `json:",omitempty"`
+	Error     string                     `json:",omitempty"`
+}
+
+func (d *QueryDiff) isEmpty() bool {
+	return len(d.Added) == 0 && len(d.Updated) == 0 && len(d.Removed) == 0 && d.Error == ""
+}
+
+type querySubscriber struct {
+	speaker      ws.Speaker
+	id           string
+	gremlinQuery string
+	results      map[string]json.RawMessage
+	lastError    string
+}
+
+// QuerySubscriberEndpoint evaluates the Gremlin queries registered by its
+// subscribers whenever the graph or the flows change, and sends them the
+// differences with the previous results
+type QuerySubscriberEndpoint struct {
+	sync.RWMutex
+	ws.DefaultSpeakerEventHandler
+	graph.DefaultGraphListener
+	graph         *graph.Graph
+	gremlinParser *traversal.GremlinTraversalParser
+	subscribers   map[ws.Speaker]map[string]*querySubscriber
+	maxPerClient  int
+	interval      time.Duration
+	queryTimeout  time.Duration
+	changed       bool
+	changedLock   sync.Mutex
+	quit          chan struct{}
+	wg            sync.WaitGroup
+}
+
+func elementKey(i int, v interface{}) string {
+	switch v := v.(type) {
+	case *graph.Node:
+		return string(v.ID)
+	case *graph.Edge:
+		return string(v.ID)
+	case *flow.Flow:
+		return v.UUID
+	}
+	return strconv.Itoa(i)
+}
+
+func diffResults(prev, curr map[string]json.RawMessage) *QueryDiff {
+	diff := &QueryDiff{
+		Added:   make(map[string]json.RawMessage),
+		Updated: make(map[string]json.RawMessage),
+		Removed: make(map[string]json.RawMessage),
+	}
+
+	for key, raw := range curr {
+		if prevRaw, ok := prev[key]; !ok {
+			diff.Added[key] = raw
+		} else if string(prevRaw) != string(raw) {
+			diff.Updated[key] = raw
+		}
+	}
+
+	for key, raw := range prev {
+		if _, ok := curr[key]; !ok {
+			diff.Removed[key] = raw
+		}
+	}
+
+	return diff
+}
+
+// evaluate executes a query and returns its results keyed by element
+func (q *QuerySubscriberEndpoint) evaluate(gremlinQuery string) (map[string]json.RawMessage, bool, error) {
+	// parsed for each execution as the steps keep some state when reduced
+	ts, err := q.gremlinParser.Parse(strings.NewReader(gremlinQuery))
+	if err != nil {
+		return nil, false, err
+	}
+
+	var deadline time.Time
+	if q.queryTimeout > 0 {
+		deadline = time.Now().Add(q.queryTimeout)
+	}
+
+	res, err := ts.ExecWithDeadline(q.graph, true, deadline)
+	if err != nil {
+		return nil, false, err
+	}
+
+	q.graph.RLock()
+	defer q.graph.RUnlock()
+
+	results := make(map[string]json.RawMessage)
+	for i, v := range res.Values() {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, false, err
+		}
+		results[elementKey(i, v)] = raw
+	}
+
+	return results, ts.GraphTraversal.Truncated(), nil
+}
+
+// refresh evaluates the query of a subscriber and returns the differences
+// with its previous results, nil if none
+func (q *QuerySubscriberEndpoint) refresh(s *querySubscriber) *QueryDiff {
+	results, truncated, err := q.evaluate(s.gremlinQuery)
+	if err != nil {
+		// reported once, the previous results being kept
+		if err.Error() == s.lastError {
+			return nil
+		}
+		s.lastError = err.Error()
+		return &QueryDiff{ID: s.id, Error: s.lastError}
+	}
+	s.lastError = ""
+
+	diff := diffResults(s.results, results)
+	diff.ID, diff.Truncated = s.id, truncated
+	s.results = results
+
+	if diff.isEmpty() {
+		return nil
+	}
+	return diff
+}
+
+func (q *QuerySubscriberEndpoint) subscribe(c ws.Speaker, msg *ws.StructMessage) {
+	var subscription QuerySubscription
+	if err := json.Unmarshal(msg.Obj, &subscription); err != nil || subscription.ID == "" || subscription.GremlinQuery == "" {
+		c.SendMessage(msg.Reply("Subscription ID and GremlinQuery expected", "SubscribeReply", http.StatusBadRequest))
+		return
+	}
+
+	if _, err := q.gremlinParser.Parse(strings.NewReader(subscription.GremlinQuery)); err != nil {
+		c.SendMessage(msg.Reply(fmt.Sprintf("Invalid Gremlin query: %s", err), "SubscribeReply", http.StatusBadRequest))
+		return
+	}
+
+	q.Lock()
+	subscribers, ok := q.subscribers[c]
+	if !ok {
+		subscribers = make(map[string]*querySubscriber)
+		q.subscribers[c] = subscribers
+	}
+	if _, ok := subscribers[subscription.ID]; !ok && q.maxPerClient > 0 && len(subscribers) >= q.maxPerClient {
+		q.Unlock()
+		c.SendMessage(msg.Reply(fmt.Sprintf("Maximum of %d subscriptions reached", q.maxPerClient), "SubscribeReply", http.StatusForbidden))
+		return
+	}
+
+	s := &querySubscriber{speaker: c, id: subscription.ID, gremlinQuery: subscription.GremlinQuery}
+	subscribers[subscription.ID] = s
+	q.Unlock()
+
+	logging.GetLogger().Infof("Client %s subscribed to query %s", c.GetRemoteHost(), subscription.GremlinQuery)
+
+	// the initial results are sent with the reply
+	diff := q.refresh(s)
+	if diff == nil {
+		diff = &QueryDiff{ID: s.id}
+	}
+	c.SendMessage(msg.Reply(diff, "SubscribeReply", http.StatusOK))
+}
+
+func (q *QuerySubscriberEndpoint) unsubscribe(c ws.Speaker, msg *ws.StructMessage) {
+	var subscription QuerySubscription
+	if err := json.Unmarshal(msg.Obj, &subscription); err != nil {
+		c.SendMessage(msg.Reply("Subscription ID expected", "UnsubscribeReply", http.StatusBadRequest))
+		return
+	}
+
+	q.Lock()
+	delete(q.subscribers[c], subscription.ID)
+	q.Unlock()
+
+	c.SendMessage(msg.Reply(nil, "UnsubscribeReply", http.StatusOK))
+}
+
+// OnStructMessage is triggered when receiving a message from a subscriber
+func (q *QuerySubscriberEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	switch msg.Type {
+	case "Subscribe":
+		q.subscribe(c, msg)
+	case "Unsubscribe":
+		q.unsubscribe(c, msg)
+	}
+}
+
+// OnDisconnected called when a subscriber got disconnected
+func (q *QuerySubscriberEndpoint) OnDisconnected(c ws.Speaker) {
+	q.Lock()
+	delete(q.subscribers, c)
+	q.Unlock()
+}
+
+func (q *QuerySubscriberEndpoint) setChanged() {
+	q.changedLock.Lock()
+	q.changed = true
+	q.changedLock.Unlock()
+}
+
+// OnNodeUpdated graph node updated event
+func (q *QuerySubscriberEndpoint) OnNodeUpdated(n *graph.Node) {
+	q.setChanged()
+}
+
+// OnNodeAdded graph node added event
+func (q *QuerySubscriberEndpoint) OnNodeAdded(n *graph.Node) {
+	q.setChanged()
+}
+
+// OnNodeDeleted graph node deleted event
+func (q *QuerySubscriberEndpoint) OnNodeDeleted(n *graph.Node) {
+	q.setChanged()
+}
+
+// OnEdgeUpdated graph edge updated event
+func (q *QuerySubscriberEndpoint) OnEdgeUpdated(e *graph.Edge) {
+	q.setChanged()
+}
+
+// OnEdgeAdded graph edge added event
+func (q *QuerySubscriberEndpoint) OnEdgeAdded(e *graph.Edge) {
+	q.setChanged()
+}
+
+// OnEdgeDeleted graph edge deleted event
+func (q *QuerySubscriberEndpoint) OnEdgeDeleted(e *graph.Edge) {
+	q.setChanged()
+}
+
+// OnFlows is called when flows are received from the agents
+func (q *QuerySubscriberEndpoint) OnFlows(flowArray *flow.FlowArray) {
+	q.setChanged()
+}
+
+// refreshAll evaluates all the queries if the graph or the flows changed
+// since the last evaluation
+func (q *QuerySubscriberEndpoint) refreshAll() {
+	q.changedLock.Lock()
+	changed := q.changed
+	q.changed = false
+	q.changedLock.Unlock()
+
+	if !changed {
+		return
+	}
+
+	q.RLock()
+	var subscribers []*querySubscriber
+	for _, s := range q.subscribers {
+		for _, subscriber := range s {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	q.RUnlock()
+
+	for _, s := range subscribers {
+		if diff := q.refresh(s); diff != nil {
+			s.speaker.SendMessage(ws.NewStructMessage(QuerySubscriptionNamespace, "Diff", diff))
+		}
+	}
+}
+
+func (q *QuerySubscriberEndpoint) run() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.quit:
+			return
+		case <-ticker.C:
+			q.refreshAll()
+		}
+	}
+}
+
+// Start the evaluation of the queries
+func (q *QuerySubscriberEndpoint) Start() {
+	q.wg.Add(1)
+	go q.run()
+}
+
+// Stop the evaluation of the queries
+func (q *QuerySubscriberEndpoint) Stop() {
+	close(q.quit)
+	q.wg.Wait()
+}
+
+// NewQuerySubscriberEndpoint returns a new server to be used by the clients
+// subscribing to the results of Gremlin queries, the queries being evaluated
+// at most once per configured interval
+func NewQuerySubscriberEndpoint(pool ws.StructSpeakerPool, g *graph.Graph, tr *traversal.GremlinTraversalParser) *QuerySubscriberEndpoint {
+	q := &QuerySubscriberEndpoint{
+		graph:         g,
+		gremlinParser: tr,
+		subscribers:   make(map[ws.Speaker]map[string]*querySubscriber),
+		maxPerClient:  config.GetInt("analyzer.query_subscription.max_per_client"),
+		interval:      time.Duration(config.GetInt("analyzer.query_subscription.interval")) * time.Second,
+		queryTimeout:  time.Duration(config.GetInt("analyzer.query_timeout")) * time.Second,
+		quit:          make(chan struct{}),
+	}
+
+	if q.interval <= 0 {
+		q.interval = time.Second
+	}
+
+	pool.AddEventHandler(q)
+	pool.AddStructMessageHandler(q, []string{QuerySubscriptionNamespace})
+	g.AddEventListener(q)
+
+	return q
+}
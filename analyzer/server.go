@@ -27,26 +27,46 @@ import (
 	"github.com/skydive-project/skydive/alert"
 	api "github.com/skydive-project/skydive/api/server"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/clockskew"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/correlation"
 	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/exporter/splunk"
+	"github.com/skydive-project/skydive/exporter/syslog"
+	ffclient "github.com/skydive-project/skydive/featureflag/client"
 	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/flow/apptag"
+	"github.com/skydive-project/skydive/flow/communication"
+	"github.com/skydive-project/skydive/flow/multicast"
 	ondemand "github.com/skydive-project/skydive/flow/ondemand/client"
+	"github.com/skydive-project/skydive/flow/scan"
+	"github.com/skydive-project/skydive/flow/spoofing"
 	"github.com/skydive-project/skydive/flow/storage"
+	"github.com/skydive-project/skydive/flow/threatintel"
+	"github.com/skydive-project/skydive/forecast"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 	"github.com/skydive-project/skydive/graffiti/hub"
 	"github.com/skydive-project/skydive/graffiti/pod"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/health"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/packetinjector"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/report"
+	"github.com/skydive-project/skydive/scratch"
 	"github.com/skydive-project/skydive/sflow"
+	"github.com/skydive-project/skydive/throughput"
 	"github.com/skydive-project/skydive/topology"
 	usertopology "github.com/skydive-project/skydive/topology/enhancers"
+	"github.com/skydive-project/skydive/topology/probes/istio"
+	"github.com/skydive-project/skydive/topology/probes/k8s"
 	"github.com/skydive-project/skydive/topology/probes/netlink"
 	"github.com/skydive-project/skydive/topology/probes/ovsdb"
+	"github.com/skydive-project/skydive/topology/rollup"
 	"github.com/skydive-project/skydive/ui"
 	"github.com/skydive-project/skydive/websocket"
 	ws "github.com/skydive-project/skydive/websocket"
@@ -66,6 +86,7 @@ type Status struct {
 	Alerts      ElectionStatus
 	Captures    ElectionStatus
 	Probes      []string
+	ReadOnly    bool
 }
 
 // Server describes an Analyzer servers mechanism like http, websocket, topology, ondemand probes, ...
@@ -73,16 +94,34 @@ type Server struct {
 	httpServer      *shttp.Server
 	uiServer        *ui.Server
 	hub             *hub.Hub
+	graph           *graph.Graph
 	alertServer     *alert.Server
+	reportServer    *report.Server
+	correlator      *correlation.Correlator
+	healthChecker   *health.Checker
 	onDemandClient  *ondemand.OnDemandProbeClient
+	k8sCaptures     *k8s.CaptureController
 	piClient        *packetinjector.Client
+	ttClient        *throughput.Client
+	ffClient        *ffclient.Client
 	topologyManager *usertopology.TopologyManager
 	flowServer      *FlowServer
+	threatMatcher   *threatintel.Matcher
+	appTagger       *apptag.Tagger
+	mcastTracker    *multicast.Tracker
+	commLinker      *communication.Linker
+	accessLogServer *istio.AccessLogServer
+	skewMonitor     *clockskew.Monitor
+	metricsRollup   *rollup.Rollup
+	querySubscriber *QuerySubscriberEndpoint
+	syslogExporter  *syslog.Exporter
+	splunkExporter  *splunk.Exporter
 	probeBundle     *probe.Bundle
 	storage         storage.Storage
 	embeddedEtcd    *etcd.EmbeddedEtcd
 	etcdClient      *etcd.Client
 	wgServers       sync.WaitGroup
+	readOnly        bool
 }
 
 // GetStatus returns the status of an analyzer
@@ -97,6 +136,19 @@ func (s *Server) GetStatus() interface{} {
 		Alerts:      ElectionStatus{IsMaster: s.alertServer.IsMaster()},
 		Captures:    ElectionStatus{IsMaster: s.onDemandClient.IsMaster()},
 		Probes:      s.probeBundle.ActiveProbes(),
+		ReadOnly:    s.readOnly,
+	}
+}
+
+// DebugStats describes the internal statistics of an analyzer
+type DebugStats struct {
+	Graph *api.GraphStats
+}
+
+// GetDebugStats returns the internal statistics of an analyzer
+func (s *Server) GetDebugStats() interface{} {
+	return &DebugStats{
+		Graph: api.NewGraphStats(s.graph),
 	}
 }
 
@@ -125,12 +177,53 @@ func (s *Server) Start() error {
 	}
 
 	s.hub.Start()
-	s.probeBundle.Start()
-	s.onDemandClient.Start()
-	s.piClient.Start()
-	s.alertServer.Start()
-	s.topologyManager.Start()
-	s.flowServer.Start()
+	s.querySubscriber.Start()
+
+	// a read-only analyzer only receives the replicated topology and
+	// serves queries, nothing that could modify the cluster is started
+	if !s.readOnly {
+		s.probeBundle.Start()
+		s.onDemandClient.Start()
+		if s.k8sCaptures != nil {
+			s.k8sCaptures.Start()
+		}
+		s.piClient.Start()
+		s.ttClient.Start()
+		s.ffClient.Start()
+		s.alertServer.Start()
+		s.reportServer.Start()
+		if s.correlator != nil {
+			s.correlator.Start()
+		}
+		s.healthChecker.Start()
+		s.topologyManager.Start()
+		if s.threatMatcher != nil {
+			s.threatMatcher.Start()
+		}
+		s.appTagger.Start()
+		if s.mcastTracker != nil {
+			s.mcastTracker.Start()
+		}
+		if s.commLinker != nil {
+			s.commLinker.Start()
+		}
+		if s.accessLogServer != nil {
+			s.accessLogServer.Start()
+		}
+		if s.skewMonitor != nil {
+			s.skewMonitor.Start()
+		}
+		if s.metricsRollup != nil {
+			s.metricsRollup.Start()
+		}
+		if s.syslogExporter != nil {
+			s.syslogExporter.Start()
+		}
+		if s.splunkExporter != nil {
+			s.splunkExporter.Start()
+		}
+		s.flowServer.Start()
+	}
 
 	s.wgServers.Add(1)
 	go func() {
@@ -144,7 +237,35 @@ func (s *Server) Start() error {
 // Stop the analyzer server
 func (s *Server) Stop() {
 	s.hub.Stop()
-	s.flowServer.Stop()
+	s.querySubscriber.Stop()
+	if !s.readOnly {
+		s.flowServer.Stop()
+		if s.threatMatcher != nil {
+			s.threatMatcher.Stop()
+		}
+		s.appTagger.Stop()
+		if s.mcastTracker != nil {
+			s.mcastTracker.Stop()
+		}
+		if s.commLinker != nil {
+			s.commLinker.Stop()
+		}
+		if s.accessLogServer != nil {
+			s.accessLogServer.Stop()
+		}
+		if s.skewMonitor != nil {
+			s.skewMonitor.Stop()
+		}
+		if s.metricsRollup != nil {
+			s.metricsRollup.Stop()
+		}
+		if s.syslogExporter != nil {
+			s.syslogExporter.Stop()
+		}
+		if s.splunkExporter != nil {
+			s.splunkExporter.Stop()
+		}
+	}
 	s.httpServer.Stop()
 	if s.embeddedEtcd != nil {
 		s.embeddedEtcd.Stop()
@@ -152,11 +273,23 @@ func (s *Server) Stop() {
 	if s.storage != nil {
 		s.storage.Stop()
 	}
-	s.probeBundle.Stop()
-	s.onDemandClient.Stop()
-	s.piClient.Stop()
-	s.alertServer.Stop()
-	s.topologyManager.Stop()
+	if !s.readOnly {
+		s.probeBundle.Stop()
+		s.onDemandClient.Stop()
+		if s.k8sCaptures != nil {
+			s.k8sCaptures.Stop()
+		}
+		s.piClient.Stop()
+		s.ttClient.Stop()
+		s.ffClient.Stop()
+		s.alertServer.Stop()
+		s.reportServer.Stop()
+		if s.correlator != nil {
+			s.correlator.Stop()
+		}
+		s.healthChecker.Stop()
+		s.topologyManager.Stop()
+	}
 	s.etcdClient.Stop()
 	s.wgServers.Wait()
 	if tr, ok := http.DefaultTransport.(interface {
@@ -210,6 +343,12 @@ func NewServerFromConfig() (*Server, error) {
 		return nil, err
 	}
 
+	readOnly := config.GetBool("analyzer.read_only")
+	if readOnly {
+		logging.GetLogger().Info("Analyzer running in read-only mode")
+		rbac.SetReadOnly(true)
+	}
+
 	hserver, err := config.NewHTTPServer(service.Type)
 	if err != nil {
 		return nil, err
@@ -263,10 +402,15 @@ func NewServerFromConfig() (*Server, error) {
 		QueueSize:        10000,
 		PingDelay:        2 * time.Second,
 		PongTimeout:      5 * time.Second,
+		MaxConnRate:      config.GetConfig().GetFloat64("analyzer.admission.max_conn_rate"),
+		MaxConnBurst:     config.GetInt("analyzer.admission.max_conn_burst"),
+		MaxRetryDelay:    time.Duration(config.GetInt("analyzer.admission.max_retry_delay")) * time.Second,
 	}
 
+	agentGracePeriod := time.Duration(config.GetInt("analyzer.topology.agent_grace_period")) * time.Second
+
 	clusterAuthOptions := ClusterAuthenticationOpts()
-	hub, err := hub.NewHub(hserver, g, cached, apiAuthBackend, clusterAuthBackend, clusterAuthOptions, "/ws/agent/topology", peers, opts)
+	hub, err := hub.NewHub(hserver, g, cached, apiAuthBackend, clusterAuthBackend, clusterAuthOptions, "/ws/agent/topology", peers, opts, agentGracePeriod)
 	if err != nil {
 		return nil, err
 	}
@@ -283,38 +427,69 @@ func NewServerFromConfig() (*Server, error) {
 	tr.AddTraversalExtension(ge.NewMetricsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewRawPacketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(tableClient, storage))
+	tr.AddTraversalExtension(ge.NewGroupByTraversalExtension())
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewNextHopTraversalExtension())
+	tr.AddTraversalExtension(ge.NewShortestPathTraversalExtension())
 
 	subscriberWSServer := ws.NewStructServer(config.NewWSServer(hserver, "/ws/subscriber", apiAuthBackend))
 	pod.NewTopologySubscriberEndpoint(subscriberWSServer, g, tr)
 
-	probeBundle, err := NewTopologyProbeBundleFromConfig(g)
-	if err != nil {
-		return nil, err
+	probeBundle := probe.NewBundle(make(map[string]probe.Probe))
+	if !readOnly {
+		if probeBundle, err = NewTopologyProbeBundleFromConfig(g); err != nil {
+			return nil, err
+		}
 	}
 
 	// new flow subscriber endpoints
 	flowSubscriberWSServer := ws.NewStructServer(config.NewWSServer(hserver, "/ws/subscriber/flow", apiAuthBackend))
 	flowSubscriberEndpoint := NewFlowSubscriberEndpoint(flowSubscriberWSServer)
 
+	// continuous Gremlin query results
+	querySubscriberWSServer := ws.NewStructServer(config.NewWSServer(hserver, "/ws/subscriber/query", apiAuthBackend))
+	querySubscriber := NewQuerySubscriberEndpoint(querySubscriberWSServer, g, tr)
+	flowSubscriberEndpoint.AddFlowListener(querySubscriber)
+
+	// live tail of flow updates
+	flowTailWSServer := ws.NewStructServer(config.NewWSServer(hserver, "/ws/subscriber/flow/tail", apiAuthBackend))
+	flowSubscriberEndpoint.AddFlowListener(NewFlowTailEndpoint(flowTailWSServer, g, tr))
+
 	apiServer, err := api.NewAPI(hserver, etcdClient.KeysAPI, service, apiAuthBackend)
 	if err != nil {
 		return nil, err
 	}
 
-	captureAPIHandler, err := api.RegisterCaptureAPI(apiServer, g, apiAuthBackend)
+	captureProfileAPIHandler, err := api.RegisterCaptureProfileAPI(apiServer, apiAuthBackend)
 	if err != nil {
 		return nil, err
 	}
 
+	captureAPIHandler, err := api.RegisterCaptureAPI(apiServer, g, captureProfileAPIHandler, apiAuthBackend)
+	if err != nil {
+		return nil, err
+	}
+	api.RegisterCapturePlacementAPI(apiServer, g, captureAPIHandler, apiAuthBackend)
+
 	piAPIHandler, err := api.RegisterPacketInjectorAPI(g, apiServer, apiAuthBackend)
 	if err != nil {
 		return nil, err
 	}
 	piClient := packetinjector.NewClient(hub.PodServer(), etcdClient, piAPIHandler, g)
 
+	ttAPIHandler, err := api.RegisterThroughputTestAPI(g, apiServer, apiAuthBackend)
+	if err != nil {
+		return nil, err
+	}
+	ttClient := throughput.NewClient(hub.PodServer(), etcdClient, ttAPIHandler, g)
+
+	ffAPIHandler, err := api.RegisterFeatureFlagAPI(apiServer, apiAuthBackend)
+	if err != nil {
+		return nil, err
+	}
+	ffClient := ffclient.NewClient(hub.PodServer(), ffAPIHandler)
+
 	nodeAPIHandler, err := api.RegisterNodeRuleAPI(apiServer, g, apiAuthBackend)
 	if err != nil {
 		return nil, err
@@ -323,9 +498,19 @@ func NewServerFromConfig() (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	if !readOnly {
+		if err := usertopology.SeedInventoryFromConfig(nodeAPIHandler, edgeAPIHandler); err != nil {
+			return nil, err
+		}
+	}
 	topologyManager := usertopology.NewTopologyManager(etcdClient, nodeAPIHandler, edgeAPIHandler, g)
 
-	if _, err = api.RegisterAlertAPI(apiServer, apiAuthBackend); err != nil {
+	alertAPIHandler, err := api.RegisterAlertAPI(apiServer, apiAuthBackend)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := api.RegisterDecommissionAPI(apiServer, g, captureAPIHandler, alertAPIHandler, apiAuthBackend); err != nil {
 		return nil, err
 	}
 
@@ -333,38 +518,189 @@ func NewServerFromConfig() (*Server, error) {
 		return nil, err
 	}
 
+	if _, err := api.RegisterReportAPI(apiServer, apiAuthBackend); err != nil {
+		return nil, err
+	}
+
 	onDemandClient := ondemand.NewOnDemandProbeClient(g, captureAPIHandler, hub.PodServer(), hub.SubscriberServer(), etcdClient)
 
-	flowServer, err := NewFlowServer(hserver, g, storage, flowSubscriberEndpoint, probeBundle, clusterAuthBackend)
+	k8sCaptures, err := k8s.NewCaptureControllerFromConfig(captureAPIHandler, etcdClient.NewElection("k8s-captures"))
+	if err != nil {
+		return nil, err
+	}
+
+	threatMatcher, err := threatintel.NewMatcherFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	appRuleAPIHandler, err := api.RegisterApplicationRuleAPI(apiServer, apiAuthBackend)
+	if err != nil {
+		return nil, err
+	}
+	appTagger := apptag.NewTagger(g, appRuleAPIHandler)
+	mcastTracker := multicast.NewTrackerFromConfig(g)
+	commLinker := communication.NewLinkerFromConfig(g)
+	spoofingDetector := spoofing.NewDetectorFromConfig(g)
+
+	scanDetector, err := scan.NewDetectorFromConfig(g)
+	if err != nil {
+		return nil, err
+	}
+
+	accessLogServer, err := istio.NewAccessLogServerFromConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	skewMonitor := clockskew.NewMonitorFromConfig(hub.PodServer(), g)
+
+	metricsRollup := rollup.NewRollupFromConfig(g)
+
+	var flowServer *FlowServer
+	if !readOnly {
+		taggers := []FlowTagger{appTagger}
+		if threatMatcher != nil {
+			taggers = append(taggers, threatMatcher)
+		}
+		if mcastTracker != nil {
+			taggers = append(taggers, mcastTracker)
+		}
+		if commLinker != nil {
+			taggers = append(taggers, commLinker)
+		}
+		if spoofingDetector != nil {
+			taggers = append(taggers, spoofingDetector)
+		}
+		if scanDetector != nil {
+			taggers = append(taggers, scanDetector)
+		}
+		if accessLogServer != nil {
+			taggers = append(taggers, accessLogServer)
+		}
+		if skewMonitor != nil {
+			taggers = append(taggers, skewMonitor)
+		}
+
+		if flowServer, err = NewFlowServer(hserver, g, storage, flowSubscriberEndpoint, probeBundle, clusterAuthBackend, hub.PodServer(), taggers...); err != nil {
+			return nil, err
+		}
+	}
+
 	alertServer, err := alert.NewServer(apiServer, hub.SubscriberServer(), g, tr, etcdClient)
 	if err != nil {
 		return nil, err
 	}
 
+	if threatMatcher != nil {
+		threatMatcher.AddListener(alertServer)
+	}
+
+	if spoofingDetector != nil {
+		spoofingDetector.AddListener(alertServer)
+	}
+
+	if scanDetector != nil {
+		scanDetector.AddListener(alertServer)
+	}
+
+	reportServer := report.NewServer(apiServer, g, tr, etcdClient)
+	alertServer.AddListener(reportServer)
+
+	if forecaster := forecast.NewForecasterFromConfig(g, tr); forecaster != nil {
+		forecaster.RegisterEndpoints(hserver, apiAuthBackend)
+		reportServer.Forecaster = forecaster
+	}
+
+	if scratchManager := scratch.NewManagerFromConfig(g, tr); scratchManager != nil {
+		scratchManager.RegisterEndpoints(hserver, apiAuthBackend)
+	}
+
+	healthChecker, err := health.NewCheckerFromConfig(g)
+	if err != nil {
+		return nil, err
+	}
+	healthChecker.RegisterEndpoints(hserver, apiAuthBackend)
+
+	correlator := correlation.NewCorrelatorFromConfig(g, hub.SubscriberServer())
+	if correlator != nil {
+		alertServer.AddListener(correlator)
+		correlator.RegisterEndpoints(hserver, apiAuthBackend)
+	}
+
+	var syslogExporter *syslog.Exporter
+	if !readOnly {
+		if syslogExporter, err = syslog.NewExporterFromConfig(); err != nil {
+			return nil, err
+		}
+		if syslogExporter != nil {
+			flowSubscriberEndpoint.AddFlowListener(syslogExporter)
+			alertServer.AddListener(syslogExporter)
+		}
+	}
+
+	var splunkExporter *splunk.Exporter
+	if !readOnly {
+		if splunkExporter, err = splunk.NewExporterFromConfig(); err != nil {
+			return nil, err
+		}
+		if splunkExporter != nil {
+			flowSubscriberEndpoint.AddFlowListener(splunkExporter)
+			if config.GetBool("analyzer.splunk_exporter.alerts") {
+				alertServer.AddListener(splunkExporter)
+			}
+			if config.GetBool("analyzer.splunk_exporter.topology") {
+				g.AddEventListener(splunkExporter)
+			}
+		}
+	}
+
 	s := &Server{
 		httpServer:      hserver,
 		hub:             hub,
+		graph:           g,
 		probeBundle:     probeBundle,
 		embeddedEtcd:    embeddedEtcd,
 		etcdClient:      etcdClient,
 		onDemandClient:  onDemandClient,
+		k8sCaptures:     k8sCaptures,
 		piClient:        piClient,
+		ttClient:        ttClient,
+		ffClient:        ffClient,
 		topologyManager: topologyManager,
 		storage:         storage,
 		flowServer:      flowServer,
+		threatMatcher:   threatMatcher,
+		appTagger:       appTagger,
+		mcastTracker:    mcastTracker,
+		commLinker:      commLinker,
+		accessLogServer: accessLogServer,
+		skewMonitor:     skewMonitor,
+		metricsRollup:   metricsRollup,
+		querySubscriber: querySubscriber,
+		syslogExporter:  syslogExporter,
+		splunkExporter:  splunkExporter,
 		alertServer:     alertServer,
+		reportServer:    reportServer,
+		correlator:      correlator,
+		healthChecker:   healthChecker,
+		readOnly:        readOnly,
 	}
 
-	s.createStartupCapture(captureAPIHandler)
+	if !readOnly {
+		s.createStartupCapture(captureAPIHandler)
+	}
 
 	api.RegisterTopologyAPI(hserver, g, tr, apiAuthBackend)
+	api.RegisterGraphQLAPI(hserver, g, apiAuthBackend)
+
+	if err := api.RegisterSearchAPI(hserver, g, apiAuthBackend); err != nil {
+		return nil, err
+	}
 	api.RegisterPcapAPI(hserver, storage, apiAuthBackend)
 	api.RegisterConfigAPI(hserver, apiAuthBackend)
 	api.RegisterStatusAPI(hserver, s, apiAuthBackend)
+	api.RegisterDebugAPI(hserver, s, apiAuthBackend)
 	api.RegisterWorkflowCallAPI(hserver, apiAuthBackend, apiServer, g, tr)
 
 	if config.GetBool("analyzer.ssh_enabled") {
@@ -397,4 +733,7 @@ func init() {
 	graph.NodeMetadataDecoders["LastUpdateMetric"] = topology.InterfaceMetricMetadataDecoder
 	graph.NodeMetadataDecoders["SFlow"] = sflow.SFMetadataDecoder
 	graph.NodeMetadataDecoders["Ovs"] = ovsdb.OvsMetadataDecoder
+	graph.NodeMetadataDecoders["Rollup"] = rollup.MetadataDecoder
+	graph.EdgeMetadataDecoders["Metric"] = topology.EdgeMetricMetadataDecoder
+	graph.EdgeMetadataDecoders["LastUpdateMetric"] = topology.EdgeMetricMetadataDecoder
 }
@@ -23,13 +23,25 @@ import (
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/etcd"
 	"github.com/skydive-project/skydive/flow/storage"
+	"github.com/skydive-project/skydive/flow/storage/clickhouse"
 	"github.com/skydive-project/skydive/flow/storage/elasticsearch"
+	"github.com/skydive-project/skydive/flow/storage/kafka"
 	"github.com/skydive-project/skydive/flow/storage/orientdb"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
+	ch "github.com/skydive-project/skydive/storage/clickhouse"
 	es "github.com/skydive-project/skydive/storage/elasticsearch"
+	"github.com/skydive-project/skydive/storage/migration"
 )
 
+// newMigrationOptions returns the options of the storage schema migrations
+func newMigrationOptions() migration.Options {
+	return migration.Options{
+		DryRun: config.GetBool("analyzer.storage_migration.dry_run"),
+		Target: config.GetInt("analyzer.storage_migration.target_version"),
+	}
+}
+
 // NewESConfig returns a new elasticsearch configuration for the given backend name
 func NewESConfig(name ...string) es.Config {
 	cfg := es.Config{}
@@ -48,9 +60,30 @@ func NewESConfig(name ...string) es.Config {
 	cfg.AgeLimit = config.GetInt(path + ".index_age_limit")
 	cfg.IndicesLimit = config.GetInt(path + ".indices_to_keep")
 
+	cfg.ReadHosts = config.GetStringSlice(path + ".read_hosts")
+	cfg.HedgeDelay = config.GetInt(path + ".hedge_delay")
+	cfg.HedgeMaxRequests = config.GetInt(path + ".hedge_max_requests")
+
+	cfg.Migration = newMigrationOptions()
+
 	return cfg
 }
 
+// NewClickHouseConfig returns a new ClickHouse configuration for the given backend name
+func NewClickHouseConfig(name string) ch.Config {
+	path := "storage." + name
+
+	return ch.Config{
+		URL:          config.GetString(path + ".url"),
+		Database:     config.GetString(path + ".database"),
+		Username:     config.GetString(path + ".username"),
+		Password:     config.GetString(path + ".password"),
+		BulkSize:     config.GetInt(path + ".bulk_size"),
+		BulkMaxDelay: config.GetInt(path + ".bulk_maxdelay"),
+		TTL:          config.GetInt(path + ".ttl"),
+	}
+}
+
 func newGraphBackendFromConfig(etcdClient *etcd.Client) (graph.Backend, error) {
 	backend := config.GetString("analyzer.topology.backend")
 	configPath := "storage." + backend
@@ -59,6 +92,8 @@ func newGraphBackendFromConfig(etcdClient *etcd.Client) (graph.Backend, error) {
 	logging.GetLogger().Infof("Using %s (driver %s) as graph storage backend", backend, driver)
 
 	switch driver {
+	case "clickhouse":
+		return graph.NewClickHouseBackendFromConfig(NewClickHouseConfig(backend), etcdClient)
 	case "elasticsearch":
 		cfg := NewESConfig(backend)
 		return graph.NewElasticSearchBackendFromConfig(cfg, etcdClient)
@@ -70,7 +105,7 @@ func newGraphBackendFromConfig(etcdClient *etcd.Client) (graph.Backend, error) {
 		database := config.GetString(configPath + ".database")
 		username := config.GetString(configPath + ".username")
 		password := config.GetString(configPath + ".password")
-		return graph.NewOrientDBBackend(addr, database, username, password, etcdClient)
+		return graph.NewOrientDBBackend(addr, database, username, password, etcdClient, newMigrationOptions())
 	default:
 		return nil, fmt.Errorf("Topology backend driver '%s' not supported", driver)
 	}
@@ -85,9 +120,13 @@ func newFlowBackendFromConfig(etcdClient *etcd.Client) (s storage.Storage, err e
 	logging.GetLogger().Infof("Using %s (driver %s) as flow storage backend", backend, driver)
 
 	switch driver {
+	case "clickhouse":
+		return clickhouse.New(NewClickHouseConfig(backend))
 	case "elasticsearch":
 		cfg := NewESConfig(backend)
 		return elasticsearch.New(cfg, etcdClient)
+	case "kafka":
+		return kafka.New(backend)
 	case "memory":
 		return nil, nil
 	case "orientdb":
@@ -18,6 +18,7 @@
 package client
 
 import (
+	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
@@ -36,7 +37,12 @@ func NewCrudClientFromConfig(authOptions *shttp.AuthenticationOpts) (*shttp.Crud
 		return nil, err
 	}
 
-	return shttp.NewCrudClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOptions, tlsConfig), nil
+	client := shttp.NewCrudClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOptions, tlsConfig)
+	if path := config.GetString("client.unix_socket"); path != "" {
+		client.SetUnixSocket(path)
+	}
+
+	return client, nil
 }
 
 // NewRestClientFromConfig creates a new REST client
@@ -52,5 +58,26 @@ func NewRestClientFromConfig(authOptions *shttp.AuthenticationOpts) (*shttp.Rest
 		return nil, err
 	}
 
+	client := shttp.NewRestClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOptions, tlsConfig)
+	if path := config.GetString("client.unix_socket"); path != "" {
+		client.SetUnixSocket(path)
+	}
+
+	return client, nil
+}
+
+// NewRestClientForAnalyzer creates a new REST client for the given analyzer
+// address instead of the configured ones
+func NewRestClientForAnalyzer(address string, authOptions *shttp.AuthenticationOpts) (*shttp.RestClient, error) {
+	tlsConfig, err := config.GetTLSClientConfig(true)
+	if err != nil {
+		return nil, err
+	}
+
+	sa, err := common.ServiceAddressFromString(address)
+	if err != nil {
+		return nil, err
+	}
+
 	return shttp.NewRestClient(config.GetURL("http", sa.Addr, sa.Port, "/api/"), authOptions, tlsConfig), nil
 }
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
@@ -35,9 +36,26 @@ import (
 	"github.com/skydive-project/skydive/topology/probes/socketinfo"
 )
 
+// queryTimeoutGrace is the time given to the analyzer to send the partial
+// results of a query after its deadline before giving up
+const queryTimeoutGrace = 5 * time.Second
+
 // GremlinQueryHelper describes a gremlin query request query helper mechanism
 type GremlinQueryHelper struct {
 	authOptions *shttp.AuthenticationOpts
+	timeout     time.Duration
+}
+
+// SetTimeout sets the execution deadline requested for the queries, 0 for
+// the one of the analyzer
+func (g *GremlinQueryHelper) SetTimeout(timeout time.Duration) {
+	g.timeout = timeout
+}
+
+// Truncated returns whether the response holds partial results, the
+// deadline of the query being reached
+func Truncated(resp *http.Response) bool {
+	return resp.Header.Get(types.TruncatedHeader) != ""
 }
 
 // Request send a Gremlin request to the topology API
@@ -48,6 +66,11 @@ func (g *GremlinQueryHelper) Request(query interface{}, header http.Header) (*ht
 	}
 
 	gq := types.TopologyParam{GremlinQuery: gremlin.NewQueryStringFromArgument(query).String()}
+	if g.timeout > 0 {
+		gq.Timeout = int64(g.timeout / time.Millisecond)
+		client.SetTimeout(g.timeout + queryTimeoutGrace)
+	}
+
 	s, err := json.Marshal(gq)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// ApplicationRuleResourceHandler describes an application rule resource handler
+type ApplicationRuleResourceHandler struct {
+	ResourceHandler
+}
+
+// ApplicationRuleAPI based on BasicAPIHandler
+type ApplicationRuleAPI struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "applicationrule"
+func (arh *ApplicationRuleResourceHandler) Name() string {
+	return "applicationrule"
+}
+
+// New creates a new application rule
+func (arh *ApplicationRuleResourceHandler) New() types.Resource {
+	return &types.ApplicationRule{}
+}
+
+// RegisterApplicationRuleAPI registers an application rule API to a designated API Server
+func RegisterApplicationRuleAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*ApplicationRuleAPI, error) {
+	ara := &ApplicationRuleAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &ApplicationRuleResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(ara, authBackend); err != nil {
+		return nil, err
+	}
+
+	return ara, nil
+}
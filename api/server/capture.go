@@ -19,14 +19,22 @@ package server
 
 import (
 	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
 )
 
 // CaptureResourceHandler describes a capture ressouce handler
@@ -37,7 +45,8 @@ type CaptureResourceHandler struct {
 // CaptureAPIHandler based on BasicAPIHandler
 type CaptureAPIHandler struct {
 	BasicAPIHandler
-	Graph *graph.Graph
+	Graph    *graph.Graph
+	Profiles *CaptureProfileAPI
 }
 
 // Name returns "capture"
@@ -58,6 +67,7 @@ func (c *CaptureAPIHandler) Decorate(resource types.Resource) {
 
 	count := 0
 	pcapSocket := ""
+	var memory, evicted int64
 
 	c.Graph.RLock()
 	defer c.Graph.RUnlock()
@@ -78,6 +88,12 @@ func (c *CaptureAPIHandler) Decorate(resource types.Resource) {
 			if p, _ := n.GetFieldString("Capture.PCAPSocket"); p != "" {
 				pcapSocket = p
 			}
+			if m, err := n.GetFieldInt64("Capture.FlowTableMemory"); err == nil {
+				memory += m
+			}
+			if e, err := n.GetFieldInt64("Capture.EvictedFlows"); err == nil {
+				evicted += e
+			}
 		case []*graph.Node:
 			for _, n := range value.([]*graph.Node) {
 				if cuuid, _ := n.GetFieldString("Capture.ID"); cuuid != "" {
@@ -86,6 +102,12 @@ func (c *CaptureAPIHandler) Decorate(resource types.Resource) {
 				if p, _ := n.GetFieldString("Capture.PCAPSocket"); p != "" {
 					pcapSocket = p
 				}
+				if m, err := n.GetFieldInt64("Capture.FlowTableMemory"); err == nil {
+					memory += m
+				}
+				if e, err := n.GetFieldInt64("Capture.EvictedFlows"); err == nil {
+					evicted += e
+				}
 			}
 		default:
 			count = 0
@@ -94,12 +116,43 @@ func (c *CaptureAPIHandler) Decorate(resource types.Resource) {
 
 	capture.Count = count
 	capture.PCAPSocket = pcapSocket
+	capture.FlowTableMemory = memory
+	capture.EvictedFlows = evicted
+}
+
+// applyProfile sets the parameters of the capture from its profile, the
+// default profile being used if the capture doesn't reference any
+func (c *CaptureAPIHandler) applyProfile(capture *types.Capture) error {
+	name := capture.Profile
+	if name == "" {
+		name = config.GetString("analyzer.capture.default_profile")
+	}
+
+	if name == "" || c.Profiles == nil {
+		return nil
+	}
+
+	profile, found := c.Profiles.Lookup(name)
+	if !found {
+		if capture.Profile != "" {
+			return fmt.Errorf("Unknown capture profile %s", name)
+		}
+		logging.GetLogger().Warningf("Default capture profile %s not found", name)
+		return nil
+	}
+
+	capture.ApplyProfile(profile)
+	return nil
 }
 
 // Create tests that resource GremlinQuery does not exists already
 func (c *CaptureAPIHandler) Create(r types.Resource) error {
 	capture := r.(*types.Capture)
 
+	if err := c.applyProfile(capture); err != nil {
+		return err
+	}
+
 	// check capabilities
 	if capture.Type != "" {
 		if capture.BPFFilter != "" {
@@ -119,28 +172,147 @@ func (c *CaptureAPIHandler) Create(r types.Resource) error {
 		}
 	}
 
-	resources := c.Index()
-	for _, resource := range resources {
+	var captures []*types.Capture
+	for _, resource := range c.Index() {
 		resource := resource.(*types.Capture)
 		if resource.GremlinQuery == capture.GremlinQuery {
 			return fmt.Errorf("Duplicate capture, uuid=%s", capture.UUID)
 		}
+		captures = append(captures, resource)
+	}
+
+	capture.Overlaps = c.overlaps(capture, captures)
+	for _, overlap := range capture.Overlaps {
+		if overlap.Shared {
+			logging.GetLogger().Infof("Capture %s shares %d nodes with capture %s", capture.GremlinQuery, len(overlap.Nodes), overlap.Capture)
+			continue
+		}
+
+		if config.GetString("analyzer.capture.overlap") == CaptureOverlapReject {
+			return fmt.Errorf("Capture conflicts with capture %s on %d nodes: %s", overlap.Capture, len(overlap.Nodes), overlap.Reason)
+		}
+		logging.GetLogger().Warningf("Capture %s conflicts with capture %s on %d nodes, %s", capture.GremlinQuery, overlap.Capture, len(overlap.Nodes), overlap.Reason)
 	}
 
 	return c.BasicAPIHandler.Create(r)
 }
 
+// requiresApproval returns whether the captures created by the user have
+// to be approved before being started, that is when the user has one of
+// the roles configured without the permission to approve captures
+func requiresApproval(user string) bool {
+	roles := config.GetStringSlice("analyzer.capture.approval.roles")
+	if len(roles) == 0 || rbac.Enforce(user, "capture", "approve") {
+		return false
+	}
+
+	for _, role := range rbac.GetUserRoles(user) {
+		for _, r := range roles {
+			if role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CreateAs creates the capture on behalf of the user, the capture staying
+// pending until approved when the roles of the user require it
+func (c *CaptureAPIHandler) CreateAs(r types.Resource, user string) error {
+	capture := r.(*types.Capture)
+
+	// the approval state can only be set by the analyzer
+	capture.Creator = user
+	capture.Approval = ""
+	capture.Reviewer = ""
+	capture.ReviewReason = ""
+	capture.ReviewTime = 0
+
+	if requiresApproval(user) {
+		capture.Approval = types.CaptureApprovalPending
+	}
+
+	return c.Create(capture)
+}
+
+// review approves or rejects a pending capture
+func (c *CaptureAPIHandler) review(id, reviewer, approval, reason string) (*types.Capture, int, error) {
+	resource, ok := c.Get(id)
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("Capture %s not found", id)
+	}
+
+	capture := resource.(*types.Capture)
+	if capture.Approval != types.CaptureApprovalPending {
+		return nil, http.StatusConflict, fmt.Errorf("Capture %s is not pending approval", id)
+	}
+
+	capture.Approval = approval
+	capture.Reviewer = reviewer
+	capture.ReviewReason = reason
+	capture.ReviewTime = common.UnixMillis(time.Now())
+
+	if err := c.Update(id, capture); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return capture, http.StatusOK, nil
+}
+
+func (c *CaptureAPIHandler) reviewHandler(approval string) func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	return func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		if !rbac.Enforce(r.Username, "capture", "write") || !rbac.Enforce(r.Username, "capture", "approve") {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		// the reason of the review is optional
+		var review types.CaptureReview
+		if err := common.JSONDecode(r.Body, &review); err != nil && err != io.EOF {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		id := mux.Vars(&r.Request)["ID"]
+		capture, status, err := c.review(id, r.Username, approval, review.Reason)
+		if err != nil {
+			writeError(w, status, err)
+			return
+		}
+		logging.GetLogger().Infof("Capture %s %s by %s", id, approval, r.Username)
+
+		shttp.WriteJSON(w, http.StatusOK, capture)
+	}
+}
+
 // RegisterCaptureAPI registers an new resource, capture
-func RegisterCaptureAPI(apiServer *Server, g *graph.Graph, authBackend shttp.AuthenticationBackend) (*CaptureAPIHandler, error) {
+func RegisterCaptureAPI(apiServer *Server, g *graph.Graph, profiles *CaptureProfileAPI, authBackend shttp.AuthenticationBackend) (*CaptureAPIHandler, error) {
 	captureAPIHandler := &CaptureAPIHandler{
 		BasicAPIHandler: BasicAPIHandler{
 			ResourceHandler: &CaptureResourceHandler{},
 			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
 		},
-		Graph: g,
+		Graph:    g,
+		Profiles: profiles,
 	}
 	if err := apiServer.RegisterAPIHandler(captureAPIHandler, authBackend); err != nil {
 		return nil, err
 	}
+
+	routes := []shttp.Route{
+		{
+			Name:        "CaptureApprove",
+			Method:      "POST",
+			Path:        "/api/capture/{ID}/approve",
+			HandlerFunc: captureAPIHandler.reviewHandler(types.CaptureApprovalApproved),
+		},
+		{
+			Name:        "CaptureReject",
+			Method:      "POST",
+			Path:        "/api/capture/{ID}/reject",
+			HandlerFunc: captureAPIHandler.reviewHandler(types.CaptureApprovalRejected),
+		},
+	}
+	apiServer.HTTPServer.RegisterRoutes(routes, authBackend)
+
 	return captureAPIHandler, nil
 }
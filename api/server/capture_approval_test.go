@@ -0,0 +1,239 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/casbin/casbin/model"
+	etcd "github.com/coreos/etcd/client"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+const approvalPolicy = `p, admin, capture, write, allow
+p, admin, capture, approve, allow
+p, operator, capture, write, allow
+p, operator, capture, approve, deny
+g, root, admin
+g, alice, operator
+`
+
+// fakeKeysAPI stores the keys in memory, the watchers never returning
+type fakeKeysAPI struct {
+	etcd.KeysAPI
+	values map[string]string
+}
+
+type fakeWatcher struct {
+}
+
+func (w *fakeWatcher) Next(ctx context.Context) (*etcd.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (k *fakeKeysAPI) Get(ctx context.Context, key string, opts *etcd.GetOptions) (*etcd.Response, error) {
+	if strings.HasSuffix(key, "/") {
+		dir := &etcd.Node{Key: key, Dir: true}
+		for path, value := range k.values {
+			if strings.HasPrefix(path, key) {
+				dir.Nodes = append(dir.Nodes, &etcd.Node{Key: path, Value: value})
+			}
+		}
+		return &etcd.Response{Action: "get", Node: dir}, nil
+	}
+
+	value, ok := k.values[key]
+	if !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound, Message: "Key not found"}
+	}
+	return &etcd.Response{Action: "get", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (k *fakeKeysAPI) Set(ctx context.Context, key, value string, opts *etcd.SetOptions) (*etcd.Response, error) {
+	k.values[key] = value
+	return &etcd.Response{Action: "set", Node: &etcd.Node{Key: key, Value: value}}, nil
+}
+
+func (k *fakeKeysAPI) Update(ctx context.Context, key, value string) (*etcd.Response, error) {
+	if _, ok := k.values[key]; !ok {
+		return nil, etcd.Error{Code: etcd.ErrorCodeKeyNotFound, Message: "Key not found"}
+	}
+	return k.Set(ctx, key, value, nil)
+}
+
+func (k *fakeKeysAPI) Watcher(key string, opts *etcd.WatcherOptions) etcd.Watcher {
+	return &fakeWatcher{}
+}
+
+// newApprovalHandler returns a capture handler requiring the approval of
+// the captures created by the operators
+func newApprovalHandler(t *testing.T) *CaptureAPIHandler {
+	kapi := &fakeKeysAPI{values: map[string]string{"/casbinPolicy": approvalPolicy}}
+
+	m := model.Model{}
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act, eft")
+	m.AddDef("g", "g", "_, _")
+	m.AddDef("e", "e", "some(where (p_eft == allow)) && !some(where (p_eft == deny))")
+	m.AddDef("m", "m", "g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act")
+
+	if err := rbac.Init(m, kapi, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &CaptureAPIHandler{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &CaptureResourceHandler{},
+			EtcdKeyAPI:      kapi,
+		},
+		Graph: graph.NewGraph("testhost", b, common.UnknownService),
+	}
+}
+
+func getCapture(t *testing.T, handler *CaptureAPIHandler, id string) *types.Capture {
+	resource, ok := handler.Get(id)
+	if !ok {
+		t.Fatalf("Capture %s not found", id)
+	}
+	return resource.(*types.Capture)
+}
+
+func TestCaptureApprovalState(t *testing.T) {
+	config.GetConfig().Set("analyzer.capture.approval.roles", []string{"operator"})
+	defer config.GetConfig().Set("analyzer.capture.approval.roles", []string{})
+
+	handler := newApprovalHandler(t)
+
+	// the approval state given by the client is ignored
+	pending := &types.Capture{
+		GremlinQuery: "G.V().Has('Name', 'eth0')",
+		Approval:     types.CaptureApprovalApproved,
+		Reviewer:     "alice",
+	}
+	if err := handler.CreateAs(pending, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	capture := getCapture(t, handler, pending.ID())
+	if capture.Approval != types.CaptureApprovalPending || capture.Reviewer != "" || capture.Creator != "alice" {
+		t.Errorf("Expected a pending capture created by alice, got %+v", capture)
+	}
+	if capture.IsApproved() {
+		t.Error("A pending capture should not be started")
+	}
+
+	// the captures created by an admin don't need any approval
+	direct := &types.Capture{GremlinQuery: "G.V().Has('Name', 'eth1')"}
+	if err := handler.CreateAs(direct, "root"); err != nil {
+		t.Fatal(err)
+	}
+
+	if capture = getCapture(t, handler, direct.ID()); capture.Approval != "" || !capture.IsApproved() {
+		t.Errorf("Expected a capture without approval, got %+v", capture)
+	}
+}
+
+func TestCaptureReview(t *testing.T) {
+	config.GetConfig().Set("analyzer.capture.approval.roles", []string{"operator"})
+	defer config.GetConfig().Set("analyzer.capture.approval.roles", []string{})
+
+	handler := newApprovalHandler(t)
+
+	pending := &types.Capture{GremlinQuery: "G.V().Has('Name', 'eth0')"}
+	if err := handler.CreateAs(pending, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	direct := &types.Capture{GremlinQuery: "G.V().Has('Name', 'eth1')"}
+	if err := handler.CreateAs(direct, "root"); err != nil {
+		t.Fatal(err)
+	}
+
+	review := func(user, action, id string) *httptest.ResponseRecorder {
+		router := mux.NewRouter()
+		router.HandleFunc("/api/capture/{ID}/approve", func(w http.ResponseWriter, r *http.Request) {
+			handler.reviewHandler(types.CaptureApprovalApproved)(w, &auth.AuthenticatedRequest{Request: *r, Username: user})
+		})
+		router.HandleFunc("/api/capture/{ID}/reject", func(w http.ResponseWriter, r *http.Request) {
+			handler.reviewHandler(types.CaptureApprovalRejected)(w, &auth.AuthenticatedRequest{Request: *r, Username: user})
+		})
+
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"Reason": "maintenance"}`)
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/capture/"+id+"/"+action, body))
+		return w
+	}
+
+	if w := review("alice", "approve", pending.ID()); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected an operator not to approve captures, got %d", w.Code)
+	}
+	if capture := getCapture(t, handler, pending.ID()); capture.Approval != types.CaptureApprovalPending {
+		t.Errorf("Expected the capture to stay pending, got %+v", capture)
+	}
+
+	w := review("root", "approve", pending.ID())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the capture to be approved, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var approved types.Capture
+	if err := json.Unmarshal(w.Body.Bytes(), &approved); err != nil {
+		t.Fatal(err)
+	}
+	if approved.Approval != types.CaptureApprovalApproved || approved.Reviewer != "root" || approved.ReviewReason != "maintenance" {
+		t.Errorf("Unexpected reviewed capture: %+v", approved)
+	}
+	if capture := getCapture(t, handler, pending.ID()); capture.Approval != types.CaptureApprovalApproved {
+		t.Errorf("Expected the approval to be stored, got %+v", capture)
+	}
+
+	// only the pending captures can be reviewed
+	for _, test := range []struct {
+		action string
+		id     string
+		status int
+	}{
+		{"approve", pending.ID(), http.StatusConflict},
+		{"reject", pending.ID(), http.StatusConflict},
+		{"approve", direct.ID(), http.StatusConflict},
+		{"reject", direct.ID(), http.StatusConflict},
+		{"reject", "unknown", http.StatusNotFound},
+	} {
+		if w := review("root", test.action, test.id); w.Code != test.status {
+			t.Errorf("Expected %d when trying to %s capture %s, got %d", test.status, test.action, test.id, w.Code)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+)
+
+// Capture overlap policies
+const (
+	CaptureOverlapWarn   = "warn"
+	CaptureOverlapReject = "reject"
+)
+
+// captureNodes returns the identifiers of the nodes selected by a capture
+func (c *CaptureAPIHandler) captureNodes(query string) map[graph.Identifier]bool {
+	ids := make(map[graph.Identifier]bool)
+
+	res, err := ge.TopologyGremlinQuery(c.Graph, query)
+	if err != nil {
+		return ids
+	}
+
+	for _, value := range res.Values() {
+		switch value.(type) {
+		case *graph.Node:
+			ids[value.(*graph.Node).ID] = true
+		case []*graph.Node:
+			for _, n := range value.([]*graph.Node) {
+				ids[n.ID] = true
+			}
+		}
+	}
+
+	return ids
+}
+
+// trimParens removes the parenthesis enclosing a whole expression
+func trimParens(expr string) string {
+	for strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+		depth := 0
+		for i, r := range expr {
+			switch r {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			// the first parenthesis is closed before the end
+			if depth == 0 && i != len(expr)-1 {
+				return expr
+			}
+		}
+		expr = strings.TrimSpace(expr[1 : len(expr)-1])
+	}
+	return expr
+}
+
+// bpfConjuncts splits a BPF filter on its top level "and" operators. As
+// "and" and "or" have the same precedence, a filter with a top level "or"
+// is kept as a whole.
+func bpfConjuncts(filter string) []string {
+	filter = strings.Replace(strings.ToLower(filter), "&&", " and ", -1)
+	filter = strings.Replace(filter, "||", " or ", -1)
+	filter = trimParens(strings.Join(strings.Fields(filter), " "))
+	if filter == "" {
+		return nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(filter); i++ {
+		switch filter[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ':
+			if depth != 0 {
+				continue
+			}
+			if strings.HasPrefix(filter[i:], " or ") {
+				return []string{filter}
+			}
+			if strings.HasPrefix(filter[i:], " and ") {
+				parts = append(parts, filter[start:i])
+				i += len(" and ") - 1
+				start = i + 1
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return []string{filter}
+	}
+	parts = append(parts, filter[start:])
+
+	var conjuncts []string
+	for _, part := range parts {
+		conjuncts = append(conjuncts, bpfConjuncts(part)...)
+	}
+
+	return conjuncts
+}
+
+// bpfCovers statically checks that all the packets matched by the filter
+// are matched by the covering filter, ie. that the filter is the covering
+// filter restricted by additional terms. It can report false negatives.
+func bpfCovers(covering, filter string) bool {
+	terms := make(map[string]bool)
+	for _, term := range bpfConjuncts(filter) {
+		terms[term] = true
+	}
+
+	for _, term := range bpfConjuncts(covering) {
+		if !terms[term] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rawPacketsCovers returns whether the raw packets retained by the existing
+// capture include the ones the capture requests: no other port is excluded
+// and the flows it samples are sampled too
+func rawPacketsCovers(existing, capture *types.Capture) bool {
+	excluded := make(map[int]bool)
+	for _, port := range capture.RawPacketExcludedPorts {
+		excluded[port] = true
+	}
+	for _, port := range existing.RawPacketExcludedPorts {
+		if !excluded[port] {
+			return false
+		}
+	}
+
+	sampling := capture.RawPacketSampling
+	if sampling < 1 {
+		sampling = 1
+	}
+	return existing.RawPacketSampling <= 1 || sampling%existing.RawPacketSampling == 0
+}
+
+// captureCovers returns whether the existing capture already provides what
+// the new capture requests, the reason why it doesn't otherwise
+func captureCovers(existing, capture *types.Capture) (bool, string) {
+	switch {
+	case existing.Type != "" && capture.Type != "" && existing.Type != capture.Type:
+		return false, "capture type differs: " + existing.Type
+	case !bpfCovers(existing.BPFFilter, capture.BPFFilter):
+		return false, "BPF filter not included in: " + existing.BPFFilter
+	case capture.RawPacketLimit > existing.RawPacketLimit:
+		return false, "raw packet limit is lower"
+	case capture.RawPacketLimit != 0 && !rawPacketsCovers(existing, capture):
+		return false, "raw packets excluded or sampled"
+	case capture.HeaderSize > existing.HeaderSize && existing.HeaderSize != 0:
+		return false, "header size is lower"
+	case capture.ExtraTCPMetric && !existing.ExtraTCPMetric:
+		return false, "extra TCP metrics disabled"
+	case capture.IPDefrag && !existing.IPDefrag:
+		return false, "IP defragmentation disabled"
+	case capture.ReassembleTCP && !existing.ReassembleTCP:
+		return false, "TCP reassembly disabled"
+	case capture.LayerKeyMode != existing.LayerKeyMode:
+		return false, "layer key mode differs: " + existing.LayerKeyMode
+	case capture.ExtraLayers&^existing.ExtraLayers != 0:
+		return false, "extra layers disabled"
+	case existing.PacketSampling > 1 && capture.PacketSampling != existing.PacketSampling:
+		return false, "packets sampled"
+	case existing.FlowByteLimit != 0 && (capture.FlowByteLimit == 0 || capture.FlowByteLimit > existing.FlowByteLimit):
+		return false, "flow byte limit is lower"
+	case existing.MaxFlows != 0 && (capture.MaxFlows == 0 || capture.MaxFlows > existing.MaxFlows):
+		return false, "max flows is lower"
+	}
+
+	return true, ""
+}
+
+// overlaps returns the overlaps of a new capture with the existing ones.
+// As a node can only be captured once, the existing captures take
+// precedence on the common nodes.
+func (c *CaptureAPIHandler) overlaps(capture *types.Capture, existing []*types.Capture) []types.CaptureOverlap {
+	c.Graph.RLock()
+	defer c.Graph.RUnlock()
+
+	nodes := c.captureNodes(capture.GremlinQuery)
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	var overlaps []types.CaptureOverlap
+	for _, e := range existing {
+		var commonNodes []string
+		for id := range c.captureNodes(e.GremlinQuery) {
+			if nodes[id] {
+				commonNodes = append(commonNodes, string(id))
+			}
+		}
+
+		if len(commonNodes) == 0 {
+			continue
+		}
+		sort.Strings(commonNodes)
+
+		shared, reason := captureCovers(e, capture)
+		overlaps = append(overlaps, types.CaptureOverlap{
+			Capture: e.UUID,
+			Nodes:   commonNodes,
+			Shared:  shared,
+			Reason:  reason,
+		})
+	}
+
+	return overlaps
+}
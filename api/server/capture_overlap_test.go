@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestBPFCovers(t *testing.T) {
+	tests := []struct {
+		covering, filter string
+		covers           bool
+	}{
+		{"", "tcp port 80", true},
+		{"tcp port 80", "", false},
+		{"tcp", "(TCP) && port 80", true},
+		{"tcp and port 80", "port 80", false},
+		{"host 10.0.0.1 and (tcp or udp)", "(tcp or udp) and host 10.0.0.1 and port 53", true},
+		{"a", "a and b or c", false},
+	}
+
+	for _, test := range tests {
+		if covers := bpfCovers(test.covering, test.filter); covers != test.covers {
+			t.Errorf("Expected %s covering %s to be %v", test.covering, test.filter, test.covers)
+		}
+	}
+}
+
+func TestCaptureCovers(t *testing.T) {
+	existing := &types.Capture{Type: "afpacket", BPFFilter: "tcp", RawPacketLimit: 10}
+
+	if shared, reason := captureCovers(existing, &types.Capture{BPFFilter: "tcp and port 80"}); !shared {
+		t.Errorf("Capture should be shared: %s", reason)
+	}
+
+	if shared, _ := captureCovers(existing, &types.Capture{Type: "pcap", BPFFilter: "tcp"}); shared {
+		t.Error("Capture of a different type should not be shared")
+	}
+
+	if shared, _ := captureCovers(existing, &types.Capture{BPFFilter: "tcp", RawPacketLimit: 20}); shared {
+		t.Error("Capture requesting more raw packets should not be shared")
+	}
+
+	sampled := &types.Capture{BPFFilter: "tcp", RawPacketLimit: 10, RawPacketExcludedPorts: []int{22}, RawPacketSampling: 2}
+
+	if shared, reason := captureCovers(sampled, &types.Capture{BPFFilter: "tcp", RawPacketLimit: 5, RawPacketExcludedPorts: []int{22, 443}, RawPacketSampling: 4}); !shared {
+		t.Errorf("Capture retaining less raw packets should be shared: %s", reason)
+	}
+
+	if shared, _ := captureCovers(sampled, &types.Capture{BPFFilter: "tcp", RawPacketLimit: 5}); shared {
+		t.Error("Capture retaining the raw packets of all the flows should not be shared")
+	}
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	auth "github.com/abbot/go-http-auth"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/validator"
+)
+
+type capturePlacementAPI struct {
+	graph    *graph.Graph
+	captures *CaptureAPIHandler
+}
+
+// layer2Paths returns the shortest layer2 path from a node to each of the
+// nodes it is connected to, as a map of the predecessor of each node
+func layer2Paths(g *graph.Graph, from *graph.Node) map[graph.Identifier]*graph.Node {
+	previous := map[graph.Identifier]*graph.Node{from.ID: nil}
+
+	queue := []*graph.Node{from}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		for _, edge := range g.GetNodeEdges(node, graph.Metadata{"RelationType": topology.Layer2Link}) {
+			peerID := edge.Child
+			if peerID == node.ID {
+				peerID = edge.Parent
+			}
+
+			if _, visited := previous[peerID]; visited {
+				continue
+			}
+
+			if peer := g.GetNode(peerID); peer != nil {
+				previous[peerID] = node
+				queue = append(queue, peer)
+			}
+		}
+	}
+
+	return previous
+}
+
+func isCaptureAllowed(node *graph.Node) bool {
+	nodeType, _ := node.GetFieldString("Type")
+	return common.IsCaptureAllowed(nodeType)
+}
+
+// placeCaptures returns the interfaces to capture on to observe the traffic
+// between all the pairs of endpoints, along with the pairs for which no
+// interface of their path supports captures. Each pair being covered by the
+// interfaces of its shortest path, the set of interfaces covering all the
+// pairs is built greedily, picking first the interfaces covering the most
+// pairs.
+func placeCaptures(g *graph.Graph, endpoints []*graph.Node) ([]*graph.Node, [][]*graph.Node) {
+	var uncovered [][]*graph.Node
+
+	candidates := make(map[graph.Identifier]*graph.Node)
+	covers := make(map[graph.Identifier]map[int]bool)
+	pairs := 0
+
+	for i, from := range endpoints {
+		previous := layer2Paths(g, from)
+
+		for _, to := range endpoints[i+1:] {
+			if _, found := previous[to.ID]; !found {
+				uncovered = append(uncovered, []*graph.Node{from, to})
+				continue
+			}
+
+			covered := false
+			for node := to; node != nil; node = previous[node.ID] {
+				if !isCaptureAllowed(node) {
+					continue
+				}
+
+				candidates[node.ID] = node
+				if covers[node.ID] == nil {
+					covers[node.ID] = make(map[int]bool)
+				}
+				covers[node.ID][pairs] = true
+				covered = true
+			}
+
+			if covered {
+				pairs++
+			} else {
+				uncovered = append(uncovered, []*graph.Node{from, to})
+			}
+		}
+	}
+
+	var interfaces []*graph.Node
+	for remaining := pairs; remaining > 0; {
+		var best *graph.Node
+		for id, node := range candidates {
+			if best == nil || len(covers[id]) > len(covers[best.ID]) || (len(covers[id]) == len(covers[best.ID]) && id < best.ID) {
+				best = node
+			}
+		}
+
+		interfaces = append(interfaces, best)
+		remaining -= len(covers[best.ID])
+
+		picked := covers[best.ID]
+		delete(candidates, best.ID)
+		for id := range candidates {
+			for pair := range picked {
+				delete(covers[id], pair)
+			}
+		}
+	}
+
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].ID < interfaces[j].ID })
+
+	return interfaces, uncovered
+}
+
+// endpoints returns the nodes selected by the Gremlin query
+func (p *capturePlacementAPI) endpoints(query string) ([]*graph.Node, error) {
+	res, err := ge.TopologyGremlinQuery(p.graph, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*graph.Node
+	for _, value := range res.Values() {
+		switch value := value.(type) {
+		case *graph.Node:
+			nodes = append(nodes, value)
+		case []*graph.Node:
+			nodes = append(nodes, value...)
+		}
+	}
+	return nodes, nil
+}
+
+// placement resolves the endpoints and recommends the interfaces to
+// capture on, along with the query selecting them by their TID
+func (p *capturePlacementAPI) placement(query string) (*types.CapturePlacement, error) {
+	p.graph.RLock()
+	defer p.graph.RUnlock()
+
+	endpoints, err := p.endpoints(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(endpoints) < 2 {
+		return nil, fmt.Errorf("At least 2 endpoints are required, %d selected", len(endpoints))
+	}
+
+	interfaces, uncovered := placeCaptures(p.graph, endpoints)
+
+	placement := &types.CapturePlacement{
+		Endpoints:  make([]string, len(endpoints)),
+		Interfaces: make([]string, len(interfaces)),
+	}
+
+	for i, endpoint := range endpoints {
+		placement.Endpoints[i] = string(endpoint.ID)
+	}
+
+	var tids []string
+	for i, intf := range interfaces {
+		placement.Interfaces[i] = string(intf.ID)
+		if tid, _ := intf.GetFieldString("TID"); tid != "" {
+			tids = append(tids, fmt.Sprintf("'%s'", tid))
+		}
+	}
+
+	if len(tids) > 0 {
+		placement.GremlinQuery = fmt.Sprintf("G.V().Has('TID', Within(%s))", strings.Join(tids, ", "))
+	}
+
+	for _, pair := range uncovered {
+		placement.Uncovered = append(placement.Uncovered, []string{string(pair[0].ID), string(pair[1].ID)})
+	}
+
+	return placement, nil
+}
+
+func (p *capturePlacementAPI) capturePlacement(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the capture parameters default to the ones of the capture API
+	request := types.CapturePlacementRequest{Capture: p.captures.New().(*types.Capture)}
+	if err := common.JSONDecode(r.Body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validator.Validate(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if request.Create && !rbac.Enforce(r.Username, "capture", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	placement, err := p.placement(request.GremlinQuery)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if request.Create {
+		if placement.GremlinQuery == "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("No interface to capture on between the endpoints"))
+			return
+		}
+
+		capture := request.Capture
+		if capture == nil {
+			capture = p.captures.New().(*types.Capture)
+		}
+		capture.GremlinQuery = placement.GremlinQuery
+
+		if err := validator.Validate(capture); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := p.captures.CreateAs(capture, r.Username); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		placement.Capture = capture
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(placement); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+// RegisterCapturePlacementAPI registers the API recommending the interfaces
+// to capture on to observe the traffic between a set of endpoints, the
+// capture being created on them when requested
+func RegisterCapturePlacementAPI(apiServer *Server, g *graph.Graph, captures *CaptureAPIHandler, authBackend shttp.AuthenticationBackend) {
+	p := &capturePlacementAPI{
+		graph:    g,
+		captures: captures,
+	}
+
+	routes := []shttp.Route{
+		{
+			Name:        "CapturePlacement",
+			Method:      "POST",
+			Path:        "/api/capture/placement",
+			HandlerFunc: p.capturePlacement,
+		},
+	}
+	apiServer.HTTPServer.RegisterRoutes(routes, authBackend)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func TestPlaceCaptures(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	g.Lock()
+	defer g.Unlock()
+
+	newNode := func(id, nodeType string) *graph.Node {
+		n, _ := g.NewNode(graph.Identifier(id), graph.Metadata{"Name": id, "Type": nodeType})
+		return n
+	}
+
+	host := newNode("host", "host")
+	br0 := newNode("br0", "bridge")
+	topology.AddOwnershipLink(g, host, br0, nil)
+
+	// three containers attached to the bridge and a disconnected one
+	var endpoints []*graph.Node
+	for _, id := range []string{"c1", "c2", "c3"} {
+		eth0 := newNode(id+"-eth0", "veth")
+		peer := newNode(id+"-peer", "veth")
+		topology.AddLayer2Link(g, eth0, peer, nil)
+		topology.AddLayer2Link(g, br0, peer, nil)
+		topology.AddOwnershipLink(g, host, peer, nil)
+		endpoints = append(endpoints, eth0)
+	}
+	endpoints = append(endpoints, newNode("c4-eth0", "veth"))
+
+	interfaces, uncovered := placeCaptures(g, endpoints)
+	if len(interfaces) != 1 || interfaces[0].ID != br0.ID {
+		t.Errorf("Expected the traffic to be captured on the bridge, got %v", interfaces)
+	}
+	if len(uncovered) != 3 {
+		t.Errorf("Expected the 3 pairs with the disconnected endpoint to be uncovered, got %v", uncovered)
+	}
+
+	// any interface of the path is enough between two endpoints
+	if interfaces, uncovered = placeCaptures(g, endpoints[:2]); len(interfaces) != 1 || len(uncovered) != 0 {
+		t.Errorf("Expected a single interface, got %v", interfaces)
+	}
+}
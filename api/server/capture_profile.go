@@ -0,0 +1,99 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// CaptureProfileResourceHandler describes a capture profile resource handler
+type CaptureProfileResourceHandler struct {
+	ResourceHandler
+}
+
+// CaptureProfileAPI based on BasicAPIHandler
+type CaptureProfileAPI struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "captureprofile"
+func (cph *CaptureProfileResourceHandler) Name() string {
+	return "captureprofile"
+}
+
+// New creates a new capture profile
+func (cph *CaptureProfileResourceHandler) New() types.Resource {
+	return &types.CaptureProfile{}
+}
+
+// Lookup returns the capture profile with the given name
+func (cpa *CaptureProfileAPI) Lookup(name string) (*types.CaptureProfile, bool) {
+	for _, resource := range cpa.Index() {
+		if profile := resource.(*types.CaptureProfile); profile.Name == name {
+			return profile, true
+		}
+	}
+	return nil, false
+}
+
+func validateOverrides(profile *types.CaptureProfile) error {
+	for namespace, override := range profile.Overrides {
+		if namespace == "" {
+			return fmt.Errorf("Capture profile overrides require a namespace")
+		}
+		if err := validator.Validate(override); err != nil {
+			return fmt.Errorf("Invalid override for namespace %s: %s", namespace, err)
+		}
+	}
+	return nil
+}
+
+// Create checks the profile name is unique and validates the namespace
+// overrides before storing the profile
+func (cpa *CaptureProfileAPI) Create(r types.Resource) error {
+	profile := r.(*types.CaptureProfile)
+
+	if _, found := cpa.Lookup(profile.Name); found {
+		return fmt.Errorf("Duplicate capture profile, name=%s", profile.Name)
+	}
+
+	if err := validateOverrides(profile); err != nil {
+		return err
+	}
+
+	return cpa.BasicAPIHandler.Create(r)
+}
+
+// RegisterCaptureProfileAPI registers a capture profile API to a designated API Server
+func RegisterCaptureProfileAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*CaptureProfileAPI, error) {
+	cpa := &CaptureProfileAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &CaptureProfileResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(cpa, authBackend); err != nil {
+		return nil, err
+	}
+
+	return cpa, nil
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	profile := &types.CaptureProfile{
+		Name: "default",
+		CaptureSettings: types.CaptureSettings{
+			BPFFilter:    "tcp",
+			HeaderSize:   256,
+			SamplingRate: 100,
+		},
+		Overrides: map[string]types.CaptureSettings{
+			"prod": {BPFFilter: "tcp port 443", IPDefrag: true},
+		},
+	}
+
+	capture := &types.Capture{GremlinQuery: "G.V()", HeaderSize: 128}
+	capture.ApplyProfile(profile)
+
+	if capture.BPFFilter != "tcp" || capture.HeaderSize != 128 || capture.SamplingRate != 100 || capture.IPDefrag || capture.Profile != "default" {
+		t.Errorf("Unexpected capture parameters: %+v", capture)
+	}
+
+	capture = &types.Capture{GremlinQuery: "G.V()", Namespace: "prod"}
+	capture.ApplyProfile(profile)
+
+	if capture.BPFFilter != "tcp port 443" || capture.HeaderSize != 256 || !capture.IPDefrag {
+		t.Errorf("Unexpected capture parameters for the namespace override: %+v", capture)
+	}
+
+	invalid := &types.CaptureProfile{
+		Name:      "invalid",
+		Overrides: map[string]types.CaptureSettings{"": {BPFFilter: "tcp"}},
+	}
+	if err := validateOverrides(invalid); err == nil {
+		t.Error("Overrides without namespace should be rejected")
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// maxCPUProfileDuration limits the duration of a CPU profile
+const maxCPUProfileDuration = 5 * time.Minute
+
+// DebugStatsReporter is the interface to report internal statistics of a service
+type DebugStatsReporter interface {
+	GetDebugStats() interface{}
+}
+
+// GraphStats describes the size of a graph
+type GraphStats struct {
+	Nodes int
+	Edges int
+}
+
+// NewGraphStats returns the statistics of the given graph
+func NewGraphStats(g *graph.Graph) *GraphStats {
+	g.RLock()
+	defer g.RUnlock()
+
+	return &GraphStats{
+		Nodes: len(g.GetNodes(nil)),
+		Edges: len(g.GetEdges(nil)),
+	}
+}
+
+// RuntimeStats describes the state of the Go runtime
+type RuntimeStats struct {
+	Goroutines   int
+	GOMAXPROCS   int
+	GCPercent    int
+	NumGC        uint32
+	HeapAlloc    uint64
+	HeapInuse    uint64
+	HeapObjects  uint64
+	HeapReleased uint64
+	Sys          uint64
+	PauseTotalNs uint64
+}
+
+// RuntimeSettings describes the runtime tuning actions, a nil GCPercent
+// leaves the garbage collector target untouched
+type RuntimeSettings struct {
+	GCPercent    *int
+	GC           bool
+	FreeOSMemory bool
+}
+
+type debugAPI struct {
+	sync.RWMutex
+	reporter  DebugStatsReporter
+	gcPercent int
+}
+
+func (d *debugAPI) runtimeStats() *RuntimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	d.RLock()
+	gcPercent := d.gcPercent
+	d.RUnlock()
+
+	return &RuntimeStats{
+		Goroutines:   runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		GCPercent:    gcPercent,
+		NumGC:        ms.NumGC,
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapObjects:  ms.HeapObjects,
+		HeapReleased: ms.HeapReleased,
+		Sys:          ms.Sys,
+		PauseTotalNs: ms.PauseTotalNs,
+	}
+}
+
+func (d *debugAPI) profileGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "debug", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := mux.Vars(&r.Request)["profile"]
+
+	if name == "cpu" {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || seconds <= 0 {
+			seconds = 30
+		}
+		duration := time.Duration(seconds) * time.Second
+		if duration > maxCPUProfileDuration {
+			duration = maxCPUProfileDuration
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := pprof.StartCPUProfile(w); err != nil {
+			// a CPU profile is already running
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		time.Sleep(duration)
+		pprof.StopCPUProfile()
+		return
+	}
+
+	profile := pprof.Lookup(name)
+	if profile == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if name == "heap" && r.URL.Query().Get("gc") != "" {
+		runtime.GC()
+	}
+
+	debugLevel, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+	if debugLevel > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	if err := profile.WriteTo(w, debugLevel); err != nil {
+		logging.GetLogger().Warningf("Error while writing %s profile: %s", name, err)
+	}
+}
+
+func (d *debugAPI) runtimeGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "debug", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, d.runtimeStats())
+}
+
+func (d *debugAPI) runtimeUpdate(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "debug", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings RuntimeSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if settings.GCPercent != nil {
+		d.Lock()
+		previous := debug.SetGCPercent(*settings.GCPercent)
+		d.gcPercent = *settings.GCPercent
+		d.Unlock()
+
+		logging.GetLogger().Infof("GC percent changed from %d to %d by %s", previous, *settings.GCPercent, r.Username)
+	}
+
+	if settings.FreeOSMemory {
+		// FreeOSMemory forces a garbage collection as well
+		debug.FreeOSMemory()
+	} else if settings.GC {
+		runtime.GC()
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, d.runtimeStats())
+}
+
+func (d *debugAPI) statsGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "debug", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, d.reporter.GetDebugStats())
+}
+
+func (d *debugAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "DebugProfileGet",
+			Method:      "GET",
+			Path:        "/api/debug/pprof/{profile}",
+			HandlerFunc: d.profileGet,
+		},
+		{
+			Name:        "DebugRuntimeGet",
+			Method:      "GET",
+			Path:        "/api/debug/runtime",
+			HandlerFunc: d.runtimeGet,
+		},
+		{
+			Name:        "DebugRuntimeUpdate",
+			Method:      "PUT",
+			Path:        "/api/debug/runtime",
+			HandlerFunc: d.runtimeUpdate,
+		},
+		{
+			Name:        "DebugStatsGet",
+			Method:      "GET",
+			Path:        "/api/debug/stats",
+			HandlerFunc: d.statsGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterDebugAPI registers the profiling and runtime tuning endpoints
+func RegisterDebugAPI(s *shttp.Server, r DebugStatsReporter, authBackend shttp.AuthenticationBackend) {
+	// SetGCPercent is the only way to read the current value
+	gcPercent := debug.SetGCPercent(100)
+	debug.SetGCPercent(gcPercent)
+
+	a := &debugAPI{
+		reporter:  r,
+		gcPercent: gcPercent,
+	}
+
+	a.registerEndpoints(s, authBackend)
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// DecommissionResourceHandler describes a decommission resource handler
+type DecommissionResourceHandler struct {
+	ResourceHandler
+}
+
+// DecommissionAPIHandler based on BasicAPIHandler
+type DecommissionAPIHandler struct {
+	BasicAPIHandler
+	Graph    *graph.Graph
+	Captures *CaptureAPIHandler
+	Alerts   *AlertAPIHandler
+}
+
+// Name returns resource name "decommission"
+func (d *DecommissionResourceHandler) Name() string {
+	return "decommission"
+}
+
+// New creates a new decommission
+func (d *DecommissionResourceHandler) New() types.Resource {
+	return &types.Decommission{
+		CreateTime: time.Now().UTC(),
+	}
+}
+
+// decommissionedNodes returns the nodes removed by a decommission, the
+// nodes reported by the host or the node, and the nodes they own. The graph
+// lock has to be held.
+func (d *DecommissionAPIHandler) decommissionedNodes(decommission *types.Decommission) ([]*graph.Node, error) {
+	var roots []*graph.Node
+	if decommission.Host != "" {
+		for _, n := range d.Graph.GetNodes(nil) {
+			if n.Host == decommission.Host {
+				roots = append(roots, n)
+			}
+		}
+		if host := d.Graph.LookupFirstNode(graph.Metadata{"Type": "host", "Name": decommission.Host}); host != nil {
+			roots = append(roots, host)
+		}
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("No node for host %s", decommission.Host)
+		}
+	} else {
+		n := d.Graph.GetNode(graph.Identifier(decommission.NodeID))
+		if n == nil {
+			return nil, fmt.Errorf("Node %s not found", decommission.NodeID)
+		}
+		roots = append(roots, n)
+	}
+
+	var nodes []*graph.Node
+	visited := make(map[graph.Identifier]bool)
+	for len(roots) > 0 {
+		n := roots[0]
+		roots = roots[1:]
+
+		if visited[n.ID] {
+			continue
+		}
+		visited[n.ID] = true
+		nodes = append(nodes, n)
+
+		roots = append(roots, d.Graph.LookupChildren(n, nil, topology.OwnershipMetadata())...)
+	}
+
+	return nodes, nil
+}
+
+// selects returns whether a Gremlin query returns one of the removed nodes,
+// ok being false if the query is not a valid Gremlin query
+func (d *DecommissionAPIHandler) selects(query string, removed map[graph.Identifier]bool) (selected bool, ok bool) {
+	res, err := ge.TopologyGremlinQuery(d.Graph, query)
+	if err != nil {
+		return false, false
+	}
+
+	for _, value := range res.Values() {
+		switch value := value.(type) {
+		case *graph.Node:
+			if removed[value.ID] {
+				return true, true
+			}
+		case []*graph.Node:
+			for _, n := range value {
+				if removed[n.ID] {
+					return true, true
+				}
+			}
+		}
+	}
+	return false, true
+}
+
+// referencingAlert returns whether an alert or its actions select one of the
+// removed nodes. Javascript expressions are looked up for the identifiers of
+// the removed nodes.
+func (d *DecommissionAPIHandler) referencingAlert(alert *types.Alert, removed map[graph.Identifier]bool, identifiers []string) bool {
+	if selected, ok := d.selects(alert.Expression, removed); ok {
+		if selected {
+			return true
+		}
+	} else {
+		for _, identifier := range identifiers {
+			if strings.Contains(alert.Expression, identifier) {
+				return true
+			}
+		}
+	}
+
+	for _, action := range alert.Actions {
+		if action.GremlinQuery != "" {
+			if selected, _ := d.selects(action.GremlinQuery, removed); selected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Create removes the decommissioned nodes from the graph and flags the
+// captures and the alerts referencing them
+func (d *DecommissionAPIHandler) Create(r types.Resource) error {
+	decommission := r.(*types.Decommission)
+
+	if (decommission.Host == "") == (decommission.NodeID == "") {
+		return fmt.Errorf("Either a host or a node ID is required")
+	}
+
+	id, _ := uuid.NewV4()
+	decommission.SetID(id.String())
+
+	captures := d.Captures.Index()
+	alerts := d.Alerts.Index()
+
+	d.Graph.Lock()
+
+	nodes, err := d.decommissionedNodes(decommission)
+	if err != nil {
+		d.Graph.Unlock()
+		return err
+	}
+
+	removed := make(map[graph.Identifier]bool)
+	identifiers := []string{decommission.Host}
+	for _, n := range nodes {
+		removed[n.ID] = true
+		decommission.Nodes = append(decommission.Nodes, string(n.ID))
+		identifiers = append(identifiers, string(n.ID))
+		if tid, _ := n.GetFieldString("TID"); tid != "" {
+			identifiers = append(identifiers, tid)
+		}
+	}
+	if decommission.Host == "" {
+		identifiers = identifiers[1:]
+	}
+
+	var flagged []types.Resource
+	for id, resource := range captures {
+		if selected, _ := d.selects(resource.(*types.Capture).GremlinQuery, removed); selected {
+			decommission.Captures = append(decommission.Captures, id)
+			flagged = append(flagged, resource)
+		}
+	}
+	for id, resource := range alerts {
+		if d.referencingAlert(resource.(*types.Alert), removed, identifiers) {
+			decommission.Alerts = append(decommission.Alerts, id)
+			flagged = append(flagged, resource)
+		}
+	}
+
+	// the metadata is kept by the archived nodes so that the decommissioned
+	// nodes can be told apart in the history
+	metadata := map[string]interface{}{
+		"ID":     decommission.ID(),
+		"Time":   common.UnixMillis(decommission.CreateTime),
+		"Reason": decommission.Reason,
+	}
+	for _, n := range nodes {
+		if err := d.Graph.AddMetadata(n, "Decommissioned", metadata); err != nil {
+			logging.GetLogger().Errorf("Unable to flag decommissioned node %s: %s", n.ID, err)
+		}
+		if err := d.Graph.DelNode(n); err != nil {
+			logging.GetLogger().Errorf("Unable to remove decommissioned node %s: %s", n.ID, err)
+		}
+	}
+
+	d.Graph.Unlock()
+
+	logging.GetLogger().Infof("Decommissioned %d nodes, %d captures and %d alerts flagged", len(nodes), len(decommission.Captures), len(decommission.Alerts))
+
+	for _, resource := range flagged {
+		var err error
+		switch resource := resource.(type) {
+		case *types.Capture:
+			resource.Decommissions = append(resource.Decommissions, decommission.ID())
+			err = d.Captures.Set(resource)
+		case *types.Alert:
+			resource.Decommissions = append(resource.Decommissions, decommission.ID())
+			err = d.Alerts.Set(resource)
+		}
+		if err != nil {
+			logging.GetLogger().Errorf("Unable to flag %s: %s", resource.ID(), err)
+		}
+	}
+
+	return d.BasicAPIHandler.Set(decommission)
+}
+
+// RegisterDecommissionAPI registers the decommission API to a designated API Server
+func RegisterDecommissionAPI(apiServer *Server, g *graph.Graph, captures *CaptureAPIHandler, alerts *AlertAPIHandler, authBackend shttp.AuthenticationBackend) (*DecommissionAPIHandler, error) {
+	decommissionAPIHandler := &DecommissionAPIHandler{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &DecommissionResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+		Graph:    g,
+		Captures: captures,
+		Alerts:   alerts,
+	}
+	if err := apiServer.RegisterAPIHandler(decommissionAPIHandler, authBackend); err != nil {
+		return nil, err
+	}
+	return decommissionAPIHandler, nil
+}
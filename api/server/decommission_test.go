@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func TestDecommissionedNodes(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+	d := &DecommissionAPIHandler{Graph: g}
+
+	g.Lock()
+	defer g.Unlock()
+
+	newNode := func(id, nodeType string) *graph.Node {
+		n, _ := g.NewNode(graph.Identifier(id), graph.Metadata{"Name": id, "Type": nodeType, "TID": id + "-tid"})
+		return n
+	}
+
+	host := newNode("testhost", "host")
+	br0 := newNode("br0", "bridge")
+	eth0 := newNode("eth0", "device")
+	tap0 := newNode("tap0", "tun")
+	topology.AddOwnershipLink(g, host, br0, nil)
+	topology.AddOwnershipLink(g, br0, eth0, nil)
+	topology.AddLayer2Link(g, br0, tap0, nil)
+
+	nodes, err := d.decommissionedNodes(&types.Decommission{NodeID: "br0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].ID != br0.ID || nodes[1].ID != eth0.ID {
+		t.Errorf("Expected the bridge and the interface it owns, got %v", nodes)
+	}
+
+	if nodes, err = d.decommissionedNodes(&types.Decommission{Host: "testhost"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 4 {
+		t.Errorf("Expected all the nodes of the host, got %v", nodes)
+	}
+
+	if _, err = d.decommissionedNodes(&types.Decommission{Host: "otherhost"}); err == nil {
+		t.Error("Expected an error for an unknown host")
+	}
+
+	removed := map[graph.Identifier]bool{br0.ID: true, eth0.ID: true}
+	identifiers := []string{"br0", "br0-tid", "eth0", "eth0-tid"}
+
+	for _, test := range []struct {
+		alert      *types.Alert
+		referenced bool
+	}{
+		{&types.Alert{Expression: "G.V().Has('Name', 'eth0')"}, true},
+		{&types.Alert{Expression: "G.V().Has('Name', 'tap0')"}, false},
+		{&types.Alert{Expression: "Gremlin(\"G.V().Has('TID', 'eth0-tid')\").length > 0"}, true},
+		{&types.Alert{Expression: "Gremlin(\"G.V().Has('TID', 'tap0-tid')\").length > 0"}, false},
+		{&types.Alert{
+			Expression: "G.V().Has('Name', 'tap0')",
+			Actions:    []types.AlertAction{{Type: "capture", GremlinQuery: "G.V().Has('Type', 'bridge')"}},
+		}, true},
+	} {
+		if referenced := d.referencingAlert(test.alert, removed, identifiers); referenced != test.referenced {
+			t.Errorf("Expected %s to be referenced: %v", test.alert.Expression, test.referenced)
+		}
+	}
+}
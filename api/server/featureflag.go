@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// FeatureFlagResourceHandler describes a feature flag resource handler
+type FeatureFlagResourceHandler struct {
+	ResourceHandler
+}
+
+// FeatureFlagAPI based on BasicAPIHandler
+type FeatureFlagAPI struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "featureflag"
+func (ffh *FeatureFlagResourceHandler) Name() string {
+	return "featureflag"
+}
+
+// New creates a new feature flag
+func (ffh *FeatureFlagResourceHandler) New() types.Resource {
+	return &types.FeatureFlag{}
+}
+
+// Create checks a flag is set only once for a host, or globally, before
+// storing it
+func (ffa *FeatureFlagAPI) Create(r types.Resource) error {
+	flag := r.(*types.FeatureFlag)
+
+	for _, resource := range ffa.Index() {
+		if f := resource.(*types.FeatureFlag); f.Name == flag.Name && f.Host == flag.Host {
+			return fmt.Errorf("Duplicate feature flag, name=%s, host=%s", flag.Name, flag.Host)
+		}
+	}
+
+	return ffa.BasicAPIHandler.Create(r)
+}
+
+// RegisterFeatureFlagAPI registers a feature flag API to a designated API Server
+func RegisterFeatureFlagAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*FeatureFlagAPI, error) {
+	ffa := &FeatureFlagAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &FeatureFlagResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(ffa, authBackend); err != nil {
+		return nil, err
+	}
+
+	return ffa, nil
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graphql"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// GraphQLAPI exposes a GraphQL API for topology reads
+type GraphQLAPI struct {
+	graph    *graph.Graph
+	executor *graphql.Executor
+}
+
+func (g *GraphQLAPI) execute(w http.ResponseWriter, request *graphql.Request) {
+	g.graph.RLock()
+	response := g.executor.Execute(request)
+	g.graph.RUnlock()
+
+	status := http.StatusOK
+	if response.Data == nil && len(response.Errors) > 0 {
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (g *GraphQLAPI) graphqlGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	request := &graphql.Request{
+		Query:         query.Get("query"),
+		OperationName: query.Get("operationName"),
+	}
+
+	if variables := query.Get("variables"); variables != "" {
+		if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	g.execute(w, request)
+}
+
+func (g *GraphQLAPI) graphqlPost(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request graphql.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	g.execute(w, &request)
+}
+
+func (g *GraphQLAPI) schemaGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	g.graph.RLock()
+	schema := g.executor.Schema()
+	g.graph.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(schema))
+}
+
+func (g *GraphQLAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "GraphQLGet",
+			Method:      "GET",
+			Path:        "/api/graphql",
+			HandlerFunc: g.graphqlGet,
+		},
+		{
+			Name:        "GraphQLPost",
+			Method:      "POST",
+			Path:        "/api/graphql",
+			HandlerFunc: g.graphqlPost,
+		},
+		{
+			Name:        "GraphQLSchema",
+			Method:      "GET",
+			Path:        "/api/graphql/schema",
+			HandlerFunc: g.schemaGet,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterGraphQLAPI registers the GraphQL API, its schema is generated
+// from the metadata of the graph
+func RegisterGraphQLAPI(r *shttp.Server, g *graph.Graph, authBackend shttp.AuthenticationBackend) {
+	api := &GraphQLAPI{
+		graph:    g,
+		executor: graphql.NewExecutor(g),
+	}
+
+	api.registerEndpoints(r, authBackend)
+}
@@ -45,6 +45,12 @@ type Handler interface {
 	AsyncWatch(f WatcherCallback) StoppableWatcher
 }
 
+// UserCreator is implemented by the handlers recording which user created
+// a resource, the resource being created on behalf of the API user
+type UserCreator interface {
+	CreateAs(resource types.Resource, user string) error
+}
+
 // ResourceHandler aims to creates new resource of an API
 type ResourceHandler interface {
 	Name() string
@@ -166,6 +172,18 @@ func (h *BasicAPIHandler) Create(resource types.Resource) error {
 	return err
 }
 
+// Set stores a resource under its own identifier, creating or replacing it
+func (h *BasicAPIHandler) Set(resource types.Resource) error {
+	data, err := json.Marshal(&resource)
+	if err != nil {
+		return err
+	}
+
+	etcdPath := fmt.Sprintf("/%s/%s", h.ResourceHandler.Name(), resource.ID())
+	_, err = h.EtcdKeyAPI.Set(context.Background(), etcdPath, string(data), nil)
+	return err
+}
+
 // Delete a resource
 func (h *BasicAPIHandler) Delete(id string) error {
 	etcdPath := fmt.Sprintf("/%s/%s", h.ResourceHandler.Name(), id)
@@ -18,24 +18,42 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
 
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
 )
 
 type packetInjectorResourceHandler struct {
 	ResourceHandler
 }
 
-// PacketInjectorAPI exposes the packet injector API
+// PacketInjectionPreviewer resolves the parameters of a packet injection
+// without injecting, forging the first packet if requested
+type PacketInjectionPreviewer func(pi *types.PacketInjection, packet bool) (*types.PacketInjectionPreview, error)
+
+// PacketInjectorAPI exposes the packet injector API. The number of packets
+// of an injection and their rate are limited by MaxCount and MaxRate, in
+// packets per second, when positive.
 type PacketInjectorAPI struct {
 	BasicAPIHandler
 	Graph      *graph.Graph
 	TrackingID chan string
+	MaxCount   int64
+	MaxRate    int64
+	Previewer  PacketInjectionPreviewer
 }
 
 func (pirh *packetInjectorResourceHandler) Name() string {
@@ -58,7 +76,30 @@ func (pi *PacketInjectorAPI) Create(r types.Resource) error {
 	return e
 }
 
+// checkLimits verifies the injection does not exceed the packet count and
+// rate limits
+func (pi *PacketInjectorAPI) checkLimits(ppr *types.PacketInjection) error {
+	if len(ppr.Pcap) > 0 {
+		return nil
+	}
+
+	if pi.MaxCount > 0 && ppr.Count > pi.MaxCount {
+		return fmt.Errorf("Injection of %d packets exceeds the limit of %d packets", ppr.Count, pi.MaxCount)
+	}
+
+	if pi.MaxRate > 0 && ppr.Count > 1 {
+		if ppr.Interval <= 0 || 1000/ppr.Interval > pi.MaxRate {
+			return fmt.Errorf("Injection interval of %d ms exceeds the limit of %d packets per second", ppr.Interval, pi.MaxRate)
+		}
+	}
+	return nil
+}
+
 func (pi *PacketInjectorAPI) validateRequest(ppr *types.PacketInjection) error {
+	if err := pi.checkLimits(ppr); err != nil {
+		return err
+	}
+
 	pi.Graph.RLock()
 	defer pi.Graph.RUnlock()
 
@@ -123,7 +164,61 @@ func (pi *PacketInjectorAPI) getNode(gremlinQuery string) *graph.Node {
 	return nil
 }
 
-// RegisterPacketInjectorAPI registers a new packet injector resource in the API
+// preview checks a packet injection against the permissions of the user,
+// the limits and the topology, previewing it when valid
+func (pi *PacketInjectorAPI) preview(username string, ppr *types.PacketInjection, packet bool) *types.PacketInjectionPreview {
+	var violations []string
+	if !rbac.Enforce(username, "injectpacket", "write") {
+		violations = append(violations, fmt.Sprintf("User %s is not allowed to inject packets", username))
+	}
+
+	if err := validator.Validate(ppr); err != nil {
+		violations = append(violations, err.Error())
+	} else if err := pi.validateRequest(ppr); err != nil {
+		violations = append(violations, err.Error())
+	}
+
+	preview := &types.PacketInjectionPreview{}
+	if len(violations) == 0 {
+		if pi.Previewer == nil {
+			violations = append(violations, "Packet injection is not available")
+		} else if p, err := pi.Previewer(ppr, packet); err != nil {
+			violations = append(violations, err.Error())
+		} else {
+			preview = p
+		}
+	}
+
+	preview.Violations = violations
+	preview.Valid = len(violations) == 0
+	return preview
+}
+
+func (pi *PacketInjectorAPI) dryRun(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "injectpacket", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var ppr types.PacketInjection
+	if err := common.JSONDecode(r.Body, &ppr); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	preview := pi.preview(r.Username, &ppr, r.URL.Query().Get("packet") == "true")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(preview); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+// RegisterPacketInjectorAPI registers a new packet injector resource in the
+// API, along with its dry-run endpoint checking an injection against the
+// policies without injecting, the exact first packet being returned when
+// the packet query parameter is true
 func RegisterPacketInjectorAPI(g *graph.Graph, apiServer *Server, authBackend shttp.AuthenticationBackend) (*PacketInjectorAPI, error) {
 	pia := &PacketInjectorAPI{
 		BasicAPIHandler: BasicAPIHandler{
@@ -132,10 +227,22 @@ func RegisterPacketInjectorAPI(g *graph.Graph, apiServer *Server, authBackend sh
 		},
 		Graph:      g,
 		TrackingID: make(chan string),
+		MaxCount:   int64(config.GetInt("analyzer.packet_injection.max_count")),
+		MaxRate:    int64(config.GetInt("analyzer.packet_injection.max_rate")),
 	}
 	if err := apiServer.RegisterAPIHandler(pia, authBackend); err != nil {
 		return nil, err
 	}
 
+	routes := []shttp.Route{
+		{
+			Name:        "InjectpacketDryRun",
+			Method:      "POST",
+			Path:        "/api/injectpacket/dryrun",
+			HandlerFunc: pia.dryRun,
+		},
+	}
+	apiServer.HTTPServer.RegisterRoutes(routes, authBackend)
+
 	return pia, nil
 }
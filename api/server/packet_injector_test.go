@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestPacketInjectionLimits(t *testing.T) {
+	pi := &PacketInjectorAPI{MaxCount: 100, MaxRate: 10}
+
+	tests := []struct {
+		name      string
+		injection types.PacketInjection
+		valid     bool
+	}{
+		{"within limits", types.PacketInjection{Count: 10, Interval: 100}, true},
+		{"single packet", types.PacketInjection{Count: 1}, true},
+		{"too many packets", types.PacketInjection{Count: 1000, Interval: 1000}, false},
+		{"too fast", types.PacketInjection{Count: 10, Interval: 10}, false},
+		{"no interval", types.PacketInjection{Count: 2}, false},
+		{"pcap", types.PacketInjection{Count: 1000, Pcap: []byte{0}}, true},
+	}
+
+	for _, test := range tests {
+		if err := pi.checkLimits(&test.injection); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %v, got error %v", test.name, test.valid, err)
+		}
+	}
+
+	unlimited := &PacketInjectorAPI{}
+	if err := unlimited.checkLimits(&types.PacketInjection{Count: 100000}); err != nil {
+		t.Errorf("Expected no limit, got %s", err)
+	}
+}
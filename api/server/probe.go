@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// ProbeOwnership describes the elements owned by a topology probe
+type ProbeOwnership struct {
+	topology.Ownership
+	Active bool
+	Nodes  int
+	Edges  int
+}
+
+type probeAPI struct {
+	graph   *graph.Graph
+	bundle  *probe.Bundle
+	tracker *topology.OwnershipTracker
+}
+
+func (p *probeAPI) probeIndex(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "probe", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	p.graph.RLock()
+	probes := make(map[string]ProbeOwnership)
+	for name, ownership := range p.tracker.Ownerships() {
+		nodes, edges := p.tracker.Owned(name)
+		probes[name] = ProbeOwnership{
+			Ownership: ownership,
+			Active:    p.bundle.GetProbe(name) != nil,
+			Nodes:     len(nodes),
+			Edges:     len(edges),
+		}
+	}
+	p.graph.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(probes); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (p *probeAPI) probeDelete(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "probe", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := mux.Vars(&r.Request)["ID"]
+	if _, ok := p.tracker.Ownerships()[name]; !ok {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Probe %s can not be disabled", name))
+		return
+	}
+
+	if p.bundle.RemoveProbe(name) == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("Probe %s is not active", name))
+		return
+	}
+
+	// the probe being stopped, its elements are not updated anymore
+	p.graph.Lock()
+	p.tracker.Cleanup(name)
+	p.graph.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (p *probeAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "ProbeIndex",
+			Method:      "GET",
+			Path:        "/api/probe",
+			HandlerFunc: p.probeIndex,
+		},
+		{
+			Name:        "ProbeDelete",
+			Method:      "DELETE",
+			Path:        "/api/probe/{ID}",
+			HandlerFunc: p.probeDelete,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterProbeAPI registers the API reporting the elements owned by the
+// topology probes and disabling a probe, its elements being removed
+func RegisterProbeAPI(s *shttp.Server, g *graph.Graph, bundle *probe.Bundle, tracker *topology.OwnershipTracker, authBackend shttp.AuthenticationBackend) {
+	p := &probeAPI{
+		graph:   g,
+		bundle:  bundle,
+		tracker: tracker,
+	}
+
+	p.registerEndpoints(s, authBackend)
+}
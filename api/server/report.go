@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+// ReportResourceHandler describes a report resource handler
+type ReportResourceHandler struct {
+	ResourceHandler
+}
+
+// ReportAPI based on BasicAPIHandler
+type ReportAPI struct {
+	BasicAPIHandler
+}
+
+// Name returns resource name "report"
+func (rh *ReportResourceHandler) Name() string {
+	return "report"
+}
+
+// New creates a new report
+func (rh *ReportResourceHandler) New() types.Resource {
+	return &types.Report{}
+}
+
+// RegisterReportAPI registers a report API to a designated API Server
+func RegisterReportAPI(apiServer *Server, authBackend shttp.AuthenticationBackend) (*ReportAPI, error) {
+	ra := &ReportAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &ReportResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+	}
+	if err := apiServer.RegisterAPIHandler(ra, authBackend); err != nil {
+		return nil, err
+	}
+
+	return ra, nil
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// SearchAPI exposes a full-text search on the metadata of the nodes
+type SearchAPI struct {
+	graph  *graph.Graph
+	fields []graph.SearchField
+	limit  int
+}
+
+func parseSearchFields(names []string) ([]graph.SearchField, error) {
+	var fields []graph.SearchField
+	for _, name := range names {
+		field, err := graph.ParseSearchField(name)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func (s *SearchAPI) search(w http.ResponseWriter, param *types.SearchParam) {
+	if strings.TrimSpace(param.Text) == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("No search text provided"))
+		return
+	}
+
+	fields := s.fields
+	if len(param.Fields) > 0 {
+		var err error
+		if fields, err = parseSearchFields(param.Fields); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	limit := param.Limit
+	if limit <= 0 {
+		limit = s.limit
+	}
+
+	s.graph.RLock()
+	defer s.graph.RUnlock()
+
+	results := graph.Search(s.graph.GetNodes(nil), param.Text, fields, limit)
+	if results == nil {
+		results = []*graph.SearchResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(w).Encode(results)
+
+	if err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+func (s *SearchAPI) searchGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	param := &types.SearchParam{Text: query.Get("q")}
+
+	if fields := query.Get("fields"); fields != "" {
+		param.Fields = strings.Split(fields, ",")
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if param.Limit, err = strconv.Atoi(limit); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("Invalid limit: %s", limit))
+			return
+		}
+	}
+
+	s.search(w, param)
+}
+
+func (s *SearchAPI) searchPost(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var param types.SearchParam
+	if err := json.NewDecoder(r.Body).Decode(&param); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.search(w, &param)
+}
+
+func (s *SearchAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "SearchGet",
+			Method:      "GET",
+			Path:        "/api/search",
+			HandlerFunc: s.searchGet,
+		},
+		{
+			Name:        "SearchPost",
+			Method:      "POST",
+			Path:        "/api/search",
+			HandlerFunc: s.searchPost,
+		},
+	}
+
+	r.RegisterRoutes(routes, authBackend)
+}
+
+// RegisterSearchAPI registers the full-text search API, the searched fields
+// are defined by the configuration
+func RegisterSearchAPI(r *shttp.Server, g *graph.Graph, authBackend shttp.AuthenticationBackend) error {
+	fields, err := parseSearchFields(config.GetStringSlice("http.search.fields"))
+	if err != nil {
+		return err
+	}
+
+	api := &SearchAPI{
+		graph:  g,
+		fields: fields,
+		limit:  config.GetInt("http.search.limit"),
+	}
+
+	api.registerEndpoints(r, authBackend)
+	return nil
+}
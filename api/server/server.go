@@ -152,7 +152,12 @@ func (a *Server) RegisterAPIHandler(handler Handler, authBackend shttp.Authentic
 					return
 				}
 
-				if err := handler.Create(resource); err != nil {
+				if creator, ok := handler.(UserCreator); ok {
+					err = creator.CreateAs(resource, r.Username)
+				} else {
+					err = handler.Create(resource)
+				}
+				if err != nil {
 					writeError(w, http.StatusBadRequest, err)
 					return
 				}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"fmt"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+)
+
+const (
+	defaultThroughputDuration  = 10
+	defaultTCPThroughputWrite  = 32768
+	defaultUDPThroughputPacket = 1400
+)
+
+// ThroughputTestResourceHandler describes a throughput test resource handler
+type ThroughputTestResourceHandler struct {
+	ResourceHandler
+}
+
+// ThroughputTestAPI exposes the throughput test API
+type ThroughputTestAPI struct {
+	BasicAPIHandler
+	Graph *graph.Graph
+}
+
+// Name returns resource name "throughputtest"
+func (tth *ThroughputTestResourceHandler) Name() string {
+	return "throughputtest"
+}
+
+// New creates a new throughput test
+func (tth *ThroughputTestResourceHandler) New() types.Resource {
+	return &types.ThroughputTest{}
+}
+
+func (tta *ThroughputTestAPI) getNode(gremlinQuery string) *graph.Node {
+	res, err := ge.TopologyGremlinQuery(tta.Graph, gremlinQuery)
+	if err != nil {
+		return nil
+	}
+
+	for _, value := range res.Values() {
+		if node, ok := value.(*graph.Node); ok {
+			return node
+		}
+		return nil
+	}
+	return nil
+}
+
+func (tta *ThroughputTestAPI) validateRequest(tt *types.ThroughputTest) error {
+	tta.Graph.RLock()
+	defer tta.Graph.RUnlock()
+
+	srcNode := tta.getNode(tt.Src)
+	if srcNode == nil {
+		return fmt.Errorf("Not able to find a source node for '%s'", tt.Src)
+	}
+
+	dstNode := tta.getNode(tt.Dst)
+	if dstNode == nil {
+		return fmt.Errorf("Not able to find a destination node for '%s'", tt.Dst)
+	}
+
+	if srcNode.Host == "" || dstNode.Host == "" {
+		return fmt.Errorf("The source and destination nodes have to be reported by an agent")
+	}
+
+	if tt.DstIP == "" {
+		if ips, _ := dstNode.GetFieldStringList("IPV4"); len(ips) == 0 {
+			return fmt.Errorf("No destination IP in node and user input")
+		}
+	}
+
+	return nil
+}
+
+// Create checks the source and destination nodes and sets the default
+// settings before storing the test
+func (tta *ThroughputTestAPI) Create(r types.Resource) error {
+	tt := r.(*types.ThroughputTest)
+
+	if err := tta.validateRequest(tt); err != nil {
+		return err
+	}
+
+	if tt.Protocol == "" {
+		tt.Protocol = "tcp"
+	}
+	if tt.Duration == 0 {
+		tt.Duration = defaultThroughputDuration
+	}
+	if tt.PacketSize == 0 {
+		if tt.Protocol == "udp" {
+			tt.PacketSize = defaultUDPThroughputPacket
+		} else {
+			tt.PacketSize = defaultTCPThroughputWrite
+		}
+	}
+	tt.State = "pending"
+
+	return tta.BasicAPIHandler.Create(tt)
+}
+
+// RegisterThroughputTestAPI registers a throughput test API to a designated API Server
+func RegisterThroughputTestAPI(g *graph.Graph, apiServer *Server, authBackend shttp.AuthenticationBackend) (*ThroughputTestAPI, error) {
+	tta := &ThroughputTestAPI{
+		BasicAPIHandler: BasicAPIHandler{
+			ResourceHandler: &ThroughputTestResourceHandler{},
+			EtcdKeyAPI:      apiServer.EtcdKeyAPI,
+		},
+		Graph: g,
+	}
+	if err := apiServer.RegisterAPIHandler(tta, authBackend); err != nil {
+		return nil, err
+	}
+
+	return tta, nil
+}
@@ -24,9 +24,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	auth "github.com/abbot/go-http-auth"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
@@ -35,12 +37,14 @@ import (
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/rbac"
 	"github.com/skydive-project/skydive/validator"
+	"github.com/skydive-project/skydive/version"
 )
 
 // TopologyAPI exposes the topology query API
 type TopologyAPI struct {
 	graph         *graph.Graph
 	gremlinParser *traversal.GremlinTraversalParser
+	queryTimeout  time.Duration
 }
 
 func shortID(s graph.Identifier) graph.Identifier {
@@ -118,6 +122,20 @@ func (t *TopologyAPI) topologyIndex(w http.ResponseWriter, r *auth.Authenticated
 	}
 }
 
+// deadline returns the execution deadline of a query, the shortest of the
+// timeout requested by the client and of the configured one
+func (t *TopologyAPI) deadline(timeout int64) time.Time {
+	d := t.queryTimeout
+	if requested := time.Duration(timeout) * time.Millisecond; requested > 0 && (d == 0 || requested < d) {
+		d = requested
+	}
+
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d)
+}
+
 func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
 	if !rbac.Enforce(r.Username, "topology", "read") {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -137,23 +155,34 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 		}
 	}
 
-	if resource.GremlinQuery == "" {
+	query, err := resource.Query()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if query == "" {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	ts, err := t.gremlinParser.Parse(strings.NewReader(resource.GremlinQuery))
+	ts, err := t.gremlinParser.Parse(strings.NewReader(query))
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
-	res, err := ts.Exec(t.graph, true)
+	res, err := ts.ExecWithDeadline(t.graph, true, t.deadline(resource.Timeout))
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err)
 		return
 	}
 
+	if ts.GraphTraversal.Truncated() {
+		logging.GetLogger().Warningf("Partial results returned for query %s", query)
+		w.Header().Set(types.TruncatedHeader, "true")
+	}
+
 	if strings.Contains(r.Header.Get("Accept"), "vnd.graphviz") {
 		if graphTraversal, ok := res.(*traversal.GraphTraversal); ok {
 			w.Header().Set("Content-Type", "text/vnd.graphviz; charset=UTF-8")
@@ -162,6 +191,31 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 		} else {
 			writeError(w, http.StatusNotAcceptable, errors.New("Only graph can be outputted as dot"))
 		}
+	} else if strings.Contains(r.Header.Get("Accept"), "x-pcapng") {
+		if rawPacketsTraversal, ok := res.(*ge.RawPacketsTraversalStep); ok {
+			values := rawPacketsTraversal.Values()
+			if len(values) == 0 {
+				writeError(w, http.StatusNotFound, errors.New("No raw packet found, please check your Gremlin request and the time context"))
+			} else {
+				w.Header().Set("Content-Type", "application/x-pcapng")
+				w.WriteHeader(http.StatusOK)
+
+				pw, err := flow.NewPcapNgWriter(w, "Skydive "+version.Version)
+				if err != nil {
+					logging.GetLogger().Errorf("Error while writing pcap-ng header: %s", err)
+					return
+				}
+
+				for _, pf := range values {
+					if err = pw.WriteRawPacketsMap(pf.(map[string]*flow.RawPackets)); err != nil {
+						logging.GetLogger().Errorf("Error while writing pcap-ng packets: %s", err)
+						return
+					}
+				}
+			}
+		} else {
+			writeError(w, http.StatusNotAcceptable, errors.New("Only RawPackets step result can be outputted as pcap-ng"))
+		}
 	} else if strings.Contains(r.Header.Get("Accept"), "vnd.tcpdump.pcap") {
 		if rawPacketsTraversal, ok := res.(*ge.RawPacketsTraversalStep); ok {
 			values := rawPacketsTraversal.Values()
@@ -193,6 +247,96 @@ func (t *TopologyAPI) topologySearch(w http.ResponseWriter, r *auth.Authenticate
 	}
 }
 
+// topologySnapshot returns a copy of the topology returned by the query so
+// that it can be compared while the graph keeps being updated
+func (t *TopologyAPI) topologySnapshot(query string) (*graph.Elements, error) {
+	ts, err := t.gremlinParser.Parse(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ts.Exec(t.graph, true)
+	if err != nil {
+		return nil, err
+	}
+
+	graphTraversal, ok := res.(*traversal.GraphTraversal)
+	if !ok {
+		return nil, fmt.Errorf("Query %s doesn't return a topology", query)
+	}
+
+	g := graphTraversal.Graph
+	g.RLock()
+	data, err := json.Marshal(g.Elements())
+	g.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var elements graph.Elements
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+
+	return &elements, nil
+}
+
+func (t *TopologyAPI) topologyDiff(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	resource := types.TopologyDiffParam{}
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validator.Validate(resource); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if resource.From == "" {
+		resource.From = "G"
+	}
+	if resource.To == "" {
+		resource.To = "G"
+	}
+	if resource.Ignore == nil {
+		resource.Ignore = types.DefaultTopologyDiffIgnore
+	}
+
+	from, err := t.topologySnapshot(resource.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	to, err := t.topologySnapshot(resource.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	diff, err := graph.DiffElements(from, to, graph.DiffOptions{
+		Fields:  resource.Fields,
+		Ignore:  resource.Ignore,
+		MatchBy: resource.MatchBy,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		logging.GetLogger().Errorf("Error while writing response: %s", err)
+	}
+}
+
 func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.AuthenticationBackend) {
 	routes := []shttp.Route{
 		{
@@ -207,6 +351,12 @@ func (t *TopologyAPI) registerEndpoints(r *shttp.Server, authBackend shttp.Authe
 			Path:        "/api/topology",
 			HandlerFunc: t.topologySearch,
 		},
+		{
+			Name:        "TopologyDiff",
+			Method:      "POST",
+			Path:        "/api/topology/diff",
+			HandlerFunc: t.topologyDiff,
+		},
 	}
 
 	r.RegisterRoutes(routes, authBackend)
@@ -217,6 +367,7 @@ func RegisterTopologyAPI(r *shttp.Server, g *graph.Graph, parser *traversal.Grem
 	t := &TopologyAPI{
 		gremlinParser: parser,
 		graph:         g,
+		queryTimeout:  time.Duration(config.GetInt("analyzer.query_timeout")) * time.Second,
 	}
 
 	t.registerEndpoints(r, authBackend)
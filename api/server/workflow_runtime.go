@@ -100,7 +100,12 @@ func NewWorkflowRuntime(g *graph.Graph, tr *traversal.GremlinTraversalParser, se
 				return runtime.MakeCustomError("WrongArgument", fmt.Sprintf("Invalid query %s", string(data)))
 			}
 
-			return queryGremlin(query.GremlinQuery)
+			gremlinQuery, err := query.Query()
+			if err != nil {
+				return runtime.MakeCustomError("WrongArgument", err.Error())
+			}
+
+			return queryGremlin(gremlinQuery)
 		}
 
 		// This a CRUD call
@@ -19,11 +19,16 @@ package types
 
 import (
 	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/gremlin/sql"
 	"github.com/skydive-project/skydive/topology"
 )
 
@@ -53,14 +58,65 @@ func (b *BasicResource) SetID(i string) {
 // Alert is a set of parameters, the Alert Action will Trigger according to its Expression.
 type Alert struct {
 	BasicResource `yaml:",inline"`
-	Name          string `json:",omitempty" yaml:"Name"`
-	Description   string `json:",omitempty" yaml:"Description"`
-	Expression    string `json:",omitempty" valid:"nonzero" yaml:"Expression"`
-	Action        string `json:",omitempty" valid:"regexp=^(|http://|https://|file://).*$" yaml:"Action"`
-	Trigger       string `json:",omitempty" valid:"regexp=^(graph|duration:.+|)$" yaml:"Trigger"`
+	Name          string        `json:",omitempty" yaml:"Name"`
+	Description   string        `json:",omitempty" yaml:"Description"`
+	Expression    string        `json:",omitempty" valid:"nonzero" yaml:"Expression"`
+	Action        string        `json:",omitempty" valid:"regexp=^(|http://|https://|file://).*$" yaml:"Action"`
+	Trigger       string        `json:",omitempty" valid:"regexp=^(graph|duration:.+|)$" yaml:"Trigger"`
+	Actions       []AlertAction `json:",omitempty" yaml:"Actions"`
+	Decommissions []string      `json:",omitempty" yaml:"Decommissions"`
 	CreateTime    time.Time
 }
 
+// AlertAction describes an action automatically run when an alert is
+// triggered. Captures and packet injections apply by default to the nodes
+// returned by the alert expression.
+type AlertAction struct {
+	Type         string           `json:",omitempty" valid:"regexp=^(capture|workflow|injection)$" yaml:"Type"`
+	GremlinQuery string           `json:",omitempty" valid:"isGremlinOrEmpty" yaml:"GremlinQuery"`
+	BPFFilter    string           `json:",omitempty" valid:"isBPFFilter" yaml:"BPFFilter"`
+	CaptureType  string           `json:",omitempty" yaml:"CaptureType"`
+	Duration     int              `json:",omitempty" yaml:"Duration"`
+	Workflow     string           `json:",omitempty" yaml:"Workflow"`
+	Params       []interface{}    `json:",omitempty" yaml:"Params"`
+	Injection    *PacketInjection `json:",omitempty" yaml:"Injection"`
+}
+
+// AlertActionResult describes the outcome of an alert action, ID being the
+// identifier of the created capture or packet injection
+type AlertActionResult struct {
+	Type   string
+	ID     string      `json:",omitempty"`
+	Result interface{} `json:",omitempty"`
+	Error  string      `json:",omitempty"`
+}
+
+// Validate verifies the parameters of the alert actions
+func (a *Alert) Validate() error {
+	for i, action := range a.Actions {
+		switch action.Type {
+		case "capture":
+			if action.Duration < 0 {
+				return fmt.Errorf("Action %d: invalid capture duration %d", i, action.Duration)
+			}
+		case "workflow":
+			if action.Workflow == "" {
+				return fmt.Errorf("Action %d: a workflow is required", i)
+			}
+		case "injection":
+			if action.Injection == nil {
+				return fmt.Errorf("Action %d: injection parameters are required", i)
+			}
+			if err := action.Injection.Validate(); err != nil {
+				return fmt.Errorf("Action %d: %s", i, err)
+			}
+		default:
+			return fmt.Errorf("Action %d: unsupported type '%s'", i, action.Type)
+		}
+	}
+	return nil
+}
+
 // NewAlert creates a New empty Alert, only CreateTime is set.
 func NewAlert() *Alert {
 	return &Alert{
@@ -70,24 +126,95 @@ func NewAlert() *Alert {
 
 // Capture describes a capture API
 type Capture struct {
-	BasicResource   `yaml:",inline"`
-	GremlinQuery    string           `json:"GremlinQuery,omitempty" valid:"isGremlinExpr" yaml:"GremlinQuery"`
-	BPFFilter       string           `json:"BPFFilter,omitempty" valid:"isBPFFilter" yaml:"BPFFilter"`
-	Name            string           `json:"Name,omitempty" yaml:"Name"`
-	Description     string           `json:"Description,omitempty" yaml:"Description"`
-	Type            string           `json:"Type,omitempty" valid:"isValidCaptureType" yaml:"Type"`
-	Count           int              `json:"Count" yaml:"Count"`
-	PCAPSocket      string           `json:"PCAPSocket,omitempty" yaml:"PCAPSocket"`
-	Port            int              `json:"Port,omitempty" yaml:"Port"`
-	SamplingRate    uint32           `json:"SamplingRate" yaml:"SamplingRate"`
-	PollingInterval uint32           `json:"PollingInterval" yaml:"PollingInterval"`
-	RawPacketLimit  int              `json:"RawPacketLimit,omitempty" valid:"isValidRawPacketLimit" yaml:"RawPacketLimit"`
-	HeaderSize      int              `json:"HeaderSize,omitempty" valid:"isValidCaptureHeaderSize" yaml:"HeaderSize"`
-	ExtraTCPMetric  bool             `json:"ExtraTCPMetric" yaml:"ExtraTCPMetric"`
-	IPDefrag        bool             `json:"IPDefrag" yaml:"IPDefrag"`
-	ReassembleTCP   bool             `json:"ReassembleTCP" yaml:"ReassembleTCP"`
-	LayerKeyMode    string           `json:"LayerKeyMode,omitempty" valid:"isValidLayerKeyMode" yaml:"LayerKeyMode"`
-	ExtraLayers     flow.ExtraLayers `json:"ExtraLayers,omitempty" yaml:"ExtraLayers"`
+	BasicResource          `yaml:",inline"`
+	GremlinQuery           string           `json:"GremlinQuery,omitempty" valid:"isGremlinExpr" yaml:"GremlinQuery"`
+	BPFFilter              string           `json:"BPFFilter,omitempty" valid:"isBPFFilter" yaml:"BPFFilter"`
+	Name                   string           `json:"Name,omitempty" yaml:"Name"`
+	Description            string           `json:"Description,omitempty" yaml:"Description"`
+	Type                   string           `json:"Type,omitempty" valid:"isValidCaptureType" yaml:"Type"`
+	Count                  int              `json:"Count" yaml:"Count"`
+	PCAPSocket             string           `json:"PCAPSocket,omitempty" yaml:"PCAPSocket"`
+	Port                   int              `json:"Port,omitempty" yaml:"Port"`
+	SamplingRate           uint32           `json:"SamplingRate" yaml:"SamplingRate"`
+	PollingInterval        uint32           `json:"PollingInterval" yaml:"PollingInterval"`
+	RawPacketLimit         int              `json:"RawPacketLimit,omitempty" valid:"isValidRawPacketLimit" yaml:"RawPacketLimit"`
+	RawPacketExcludedPorts []int            `json:"RawPacketExcludedPorts,omitempty" valid:"isValidPorts" yaml:"RawPacketExcludedPorts"`
+	RawPacketSampling      int              `json:"RawPacketSampling,omitempty" valid:"min=0" yaml:"RawPacketSampling"`
+	HeaderSize             int              `json:"HeaderSize,omitempty" valid:"isValidCaptureHeaderSize" yaml:"HeaderSize"`
+	ExtraTCPMetric         bool             `json:"ExtraTCPMetric" yaml:"ExtraTCPMetric"`
+	IPDefrag               bool             `json:"IPDefrag" yaml:"IPDefrag"`
+	ReassembleTCP          bool             `json:"ReassembleTCP" yaml:"ReassembleTCP"`
+	LayerKeyMode           string           `json:"LayerKeyMode,omitempty" valid:"isValidLayerKeyMode" yaml:"LayerKeyMode"`
+	ExtraLayers            flow.ExtraLayers `json:"ExtraLayers,omitempty" yaml:"ExtraLayers"`
+	Profile                string           `json:"Profile,omitempty" yaml:"Profile"`
+	Namespace              string           `json:"Namespace,omitempty" yaml:"Namespace"`
+	Overlaps               []CaptureOverlap `json:"Overlaps,omitempty" yaml:"Overlaps"`
+	MaxFlowTableMemory     int              `json:"MaxFlowTableMemory,omitempty" valid:"min=0" yaml:"MaxFlowTableMemory"`
+	EvictionPolicy         string           `json:"EvictionPolicy,omitempty" valid:"regexp=^(|lru|largest)$" yaml:"EvictionPolicy"`
+	PacketSampling         int              `json:"PacketSampling,omitempty" valid:"min=0" yaml:"PacketSampling"`
+	FlowByteLimit          int64            `json:"FlowByteLimit,omitempty" valid:"min=0" yaml:"FlowByteLimit"`
+	MaxFlows               int              `json:"MaxFlows,omitempty" valid:"min=0" yaml:"MaxFlows"`
+	FlowTableMemory        int64            `json:"FlowTableMemory,omitempty" yaml:"FlowTableMemory"`
+	EvictedFlows           int64            `json:"EvictedFlows,omitempty" yaml:"EvictedFlows"`
+	Decommissions          []string         `json:"Decommissions,omitempty" yaml:"Decommissions"`
+	Creator                string           `json:"Creator,omitempty" yaml:"Creator"`
+	Approval               string           `json:"Approval,omitempty" valid:"regexp=^(|pending|approved|rejected)$" yaml:"Approval"`
+	Reviewer               string           `json:"Reviewer,omitempty" yaml:"Reviewer"`
+	ReviewReason           string           `json:"ReviewReason,omitempty" yaml:"ReviewReason"`
+	ReviewTime             int64            `json:"ReviewTime,omitempty" yaml:"ReviewTime"`
+}
+
+// Approval states of a capture. Captures created by a role requiring an
+// approval stay pending, and are not started by the agents, until an admin
+// approves or rejects them. Captures without any approval state don't
+// require one.
+const (
+	CaptureApprovalPending  = "pending"
+	CaptureApprovalApproved = "approved"
+	CaptureApprovalRejected = "rejected"
+)
+
+// CaptureReview holds the reason given when approving or rejecting a
+// pending capture
+type CaptureReview struct {
+	Reason string `json:"Reason,omitempty" yaml:"Reason"`
+}
+
+// IsApproved returns whether the capture can be started by the agents
+func (c *Capture) IsApproved() bool {
+	return c.Approval == "" || c.Approval == CaptureApprovalApproved
+}
+
+// CapturePlacementRequest asks for the interfaces to capture on to observe
+// the traffic between the endpoints selected by GremlinQuery. When Create
+// is true, a capture with the parameters of Capture is created on them.
+type CapturePlacementRequest struct {
+	GremlinQuery string   `json:"GremlinQuery" valid:"isGremlinExpr" yaml:"GremlinQuery"`
+	Create       bool     `json:"Create" yaml:"Create"`
+	Capture      *Capture `json:"Capture,omitempty" valid:"-" yaml:"Capture"`
+}
+
+// CapturePlacement describes the interfaces recommended to observe the
+// traffic between the endpoints. GremlinQuery selects these interfaces,
+// Uncovered holding the pairs of endpoints without any path going through
+// an interface a capture can be started on.
+type CapturePlacement struct {
+	Endpoints    []string   `json:"Endpoints" yaml:"Endpoints"`
+	Interfaces   []string   `json:"Interfaces" yaml:"Interfaces"`
+	GremlinQuery string     `json:"GremlinQuery,omitempty" yaml:"GremlinQuery"`
+	Uncovered    [][]string `json:"Uncovered,omitempty" yaml:"Uncovered"`
+	Capture      *Capture   `json:"Capture,omitempty" yaml:"Capture"`
+}
+
+// CaptureOverlap describes the nodes a capture shares with an existing one,
+// as detected when the capture was created. When Shared is true the existing
+// capture already processes the packets requested on these nodes, otherwise
+// the capture settings conflict and the existing capture takes precedence.
+type CaptureOverlap struct {
+	Capture string   `json:"Capture" yaml:"Capture"`
+	Nodes   []string `json:"Nodes" yaml:"Nodes"`
+	Shared  bool     `json:"Shared" yaml:"Shared"`
+	Reason  string   `json:"Reason,omitempty" yaml:"Reason"`
 }
 
 // NewCapture creates a new capture
@@ -98,6 +225,253 @@ func NewCapture(query string, bpfFilter string) *Capture {
 	}
 }
 
+// CaptureSettings holds the capture parameters that can be defined by a
+// capture profile
+type CaptureSettings struct {
+	Type            string           `json:"Type,omitempty" valid:"isValidCaptureType" yaml:"Type"`
+	BPFFilter       string           `json:"BPFFilter,omitempty" valid:"isBPFFilter" yaml:"BPFFilter"`
+	HeaderSize      int              `json:"HeaderSize,omitempty" valid:"isValidCaptureHeaderSize" yaml:"HeaderSize"`
+	RawPacketLimit  int              `json:"RawPacketLimit,omitempty" valid:"isValidRawPacketLimit" yaml:"RawPacketLimit"`
+	SamplingRate    uint32           `json:"SamplingRate,omitempty" yaml:"SamplingRate"`
+	PollingInterval uint32           `json:"PollingInterval,omitempty" yaml:"PollingInterval"`
+	ExtraTCPMetric  bool             `json:"ExtraTCPMetric,omitempty" yaml:"ExtraTCPMetric"`
+	IPDefrag        bool             `json:"IPDefrag,omitempty" yaml:"IPDefrag"`
+	ReassembleTCP   bool             `json:"ReassembleTCP,omitempty" yaml:"ReassembleTCP"`
+	ExtraLayers     flow.ExtraLayers `json:"ExtraLayers,omitempty" yaml:"ExtraLayers"`
+	PacketSampling  int              `json:"PacketSampling,omitempty" valid:"min=0" yaml:"PacketSampling"`
+	FlowByteLimit   int64            `json:"FlowByteLimit,omitempty" valid:"min=0" yaml:"FlowByteLimit"`
+	MaxFlows        int              `json:"MaxFlows,omitempty" valid:"min=0" yaml:"MaxFlows"`
+}
+
+// merge returns the settings with the unset parameters taken from defaults
+func (s CaptureSettings) merge(defaults CaptureSettings) CaptureSettings {
+	if s.Type == "" {
+		s.Type = defaults.Type
+	}
+	if s.BPFFilter == "" {
+		s.BPFFilter = defaults.BPFFilter
+	}
+	if s.HeaderSize == 0 {
+		s.HeaderSize = defaults.HeaderSize
+	}
+	if s.RawPacketLimit == 0 {
+		s.RawPacketLimit = defaults.RawPacketLimit
+	}
+	if s.SamplingRate == 0 {
+		s.SamplingRate = defaults.SamplingRate
+	}
+	if s.PollingInterval == 0 {
+		s.PollingInterval = defaults.PollingInterval
+	}
+	if s.ExtraLayers == 0 {
+		s.ExtraLayers = defaults.ExtraLayers
+	}
+	if s.PacketSampling == 0 {
+		s.PacketSampling = defaults.PacketSampling
+	}
+	if s.FlowByteLimit == 0 {
+		s.FlowByteLimit = defaults.FlowByteLimit
+	}
+	if s.MaxFlows == 0 {
+		s.MaxFlows = defaults.MaxFlows
+	}
+	s.ExtraTCPMetric = s.ExtraTCPMetric || defaults.ExtraTCPMetric
+	s.IPDefrag = s.IPDefrag || defaults.IPDefrag
+	s.ReassembleTCP = s.ReassembleTCP || defaults.ReassembleTCP
+	return s
+}
+
+// CaptureProfile is a named set of capture parameters, managed by the
+// analyzer, used by the captures referencing it by name. Overrides holds the
+// parameters specific to the captures of a tenant or namespace.
+type CaptureProfile struct {
+	BasicResource   `yaml:",inline"`
+	Name            string `json:"Name" valid:"nonzero" yaml:"Name"`
+	Description     string `json:"Description,omitempty" yaml:"Description"`
+	CaptureSettings `yaml:",inline"`
+	Overrides       map[string]CaptureSettings `json:"Overrides,omitempty" yaml:"Overrides"`
+}
+
+// Settings returns the parameters of the profile for a namespace, the
+// namespace overrides taking precedence over the profile parameters
+func (p *CaptureProfile) Settings(namespace string) CaptureSettings {
+	if override, found := p.Overrides[namespace]; found && namespace != "" {
+		return override.merge(p.CaptureSettings)
+	}
+	return p.CaptureSettings
+}
+
+// ApplyProfile sets the parameters of the capture not explicitly given from
+// the profile settings of the capture namespace. The boolean parameters
+// can only be enabled by a profile.
+func (c *Capture) ApplyProfile(p *CaptureProfile) {
+	s := CaptureSettings{
+		Type:            c.Type,
+		BPFFilter:       c.BPFFilter,
+		HeaderSize:      c.HeaderSize,
+		RawPacketLimit:  c.RawPacketLimit,
+		SamplingRate:    c.SamplingRate,
+		PollingInterval: c.PollingInterval,
+		ExtraTCPMetric:  c.ExtraTCPMetric,
+		IPDefrag:        c.IPDefrag,
+		ReassembleTCP:   c.ReassembleTCP,
+		ExtraLayers:     c.ExtraLayers,
+		PacketSampling:  c.PacketSampling,
+		FlowByteLimit:   c.FlowByteLimit,
+		MaxFlows:        c.MaxFlows,
+	}.merge(p.Settings(c.Namespace))
+
+	c.Type = s.Type
+	c.BPFFilter = s.BPFFilter
+	c.HeaderSize = s.HeaderSize
+	c.RawPacketLimit = s.RawPacketLimit
+	c.SamplingRate = s.SamplingRate
+	c.PollingInterval = s.PollingInterval
+	c.ExtraTCPMetric = s.ExtraTCPMetric
+	c.IPDefrag = s.IPDefrag
+	c.ReassembleTCP = s.ReassembleTCP
+	c.ExtraLayers = s.ExtraLayers
+	c.PacketSampling = s.PacketSampling
+	c.FlowByteLimit = s.FlowByteLimit
+	c.MaxFlows = s.MaxFlows
+	c.Profile = p.Name
+}
+
+// ApplicationRule maps the flows matching all its criteria to a logical
+// application name. Ports is a comma separated list of ports or port ranges
+// matched against both transport endpoints, CIDR is matched against both
+// network endpoints and GremlinQuery selects the nodes the flows have to be
+// captured on. Rules with the highest priority are applied first.
+type ApplicationRule struct {
+	BasicResource `yaml:",inline"`
+	Name          string `json:"Name" valid:"nonzero" yaml:"Name"`
+	Description   string `json:"Description,omitempty" yaml:"Description"`
+	Priority      int64  `json:"Priority" yaml:"Priority"`
+	Protocol      string `json:"Protocol,omitempty" yaml:"Protocol"`
+	Ports         string `json:"Ports,omitempty" yaml:"Ports"`
+	CIDR          string `json:"CIDR,omitempty" yaml:"CIDR"`
+	GremlinQuery  string `json:"GremlinQuery,omitempty" valid:"isGremlinOrEmpty" yaml:"GremlinQuery"`
+}
+
+// PortRange describes an inclusive range of ports
+type PortRange struct {
+	Min, Max int64
+}
+
+// PortRanges returns the port ranges of the rule
+func (a *ApplicationRule) PortRanges() ([]PortRange, error) {
+	var ranges []PortRange
+	for _, item := range strings.Split(a.Ports, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(item, "-", 2)
+		min, err := strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid port: %s", item)
+		}
+		max := min
+		if len(bounds) == 2 {
+			if max, err = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64); err != nil {
+				return nil, fmt.Errorf("Invalid port: %s", item)
+			}
+		}
+
+		if min < 0 || max > 65535 || min > max {
+			return nil, fmt.Errorf("Invalid port range: %s", item)
+		}
+		ranges = append(ranges, PortRange{Min: min, Max: max})
+	}
+
+	return ranges, nil
+}
+
+// Validate verifies the criteria of the application rule
+func (a *ApplicationRule) Validate() error {
+	if a.Protocol == "" && a.Ports == "" && a.CIDR == "" && a.GremlinQuery == "" {
+		return errors.New("At least one of Protocol, Ports, CIDR or GremlinQuery is required")
+	}
+
+	if a.Protocol != "" {
+		if _, ok := flow.FlowProtocol_value[strings.ToUpper(a.Protocol)]; !ok {
+			return fmt.Errorf("Invalid protocol: %s", a.Protocol)
+		}
+	}
+
+	if _, err := a.PortRanges(); err != nil {
+		return err
+	}
+
+	if a.CIDR != "" {
+		if _, _, err := net.ParseCIDR(a.CIDR); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReportSection describes a section of a report. A query section renders
+// the result of its Gremlin query, Fields selecting the columns, while the
+// top-talkers, topology-changes and alerts sections summarize the flows,
+// the topology events and the alerts of the reporting period.
+type ReportSection struct {
+	Title        string   `json:"Title,omitempty" yaml:"Title"`
+	Type         string   `json:"Type" valid:"regexp=^(query|top-talkers|topology-changes|alerts|link-forecast)$" yaml:"Type"`
+	GremlinQuery string   `json:"GremlinQuery,omitempty" valid:"isGremlinOrEmpty" yaml:"GremlinQuery"`
+	Fields       []string `json:"Fields,omitempty" yaml:"Fields"`
+	Limit        int      `json:"Limit,omitempty" yaml:"Limit"`
+}
+
+// Report describes a report generated periodically from its sections and
+// delivered to its destinations, either email addresses (mailto:) or
+// webhooks (http:// or https://)
+type Report struct {
+	BasicResource `yaml:",inline"`
+	Name          string          `json:"Name" valid:"nonzero" yaml:"Name"`
+	Description   string          `json:"Description,omitempty" yaml:"Description"`
+	Schedule      string          `json:"Schedule" valid:"nonzero" yaml:"Schedule"`
+	Format        string          `json:"Format,omitempty" valid:"regexp=^(|html|csv|pdf)$" yaml:"Format"`
+	Sections      []ReportSection `json:"Sections" yaml:"Sections"`
+	Destinations  []string        `json:"Destinations,omitempty" yaml:"Destinations"`
+}
+
+// Interval returns the period of the report
+func (r *Report) Interval() (time.Duration, error) {
+	return time.ParseDuration(r.Schedule)
+}
+
+// Validate verifies the schedule, the sections and the destinations of the report
+func (r *Report) Validate() error {
+	interval, err := r.Interval()
+	if err != nil {
+		return fmt.Errorf("Invalid schedule: %s", err)
+	}
+	if interval < time.Minute {
+		return errors.New("Reports can not be scheduled more than once a minute")
+	}
+
+	if len(r.Sections) == 0 {
+		return errors.New("At least one section is required")
+	}
+
+	for _, section := range r.Sections {
+		if section.Type == "query" && section.GremlinQuery == "" {
+			return fmt.Errorf("Query section '%s' requires a Gremlin query", section.Title)
+		}
+	}
+
+	for _, destination := range r.Destinations {
+		if !strings.HasPrefix(destination, "mailto:") && !strings.HasPrefix(destination, "http://") && !strings.HasPrefix(destination, "https://") {
+			return fmt.Errorf("Invalid destination: %s", destination)
+		}
+	}
+
+	return nil
+}
+
 // EdgeRule describes a edge rule
 type EdgeRule struct {
 	BasicResource `yaml:",inline"`
@@ -166,6 +540,18 @@ type PacketInjection struct {
 	TTL              uint8  `yaml:"TTL"`
 }
 
+// PacketInjectionPreview describes the outcome of a packet injection
+// dry-run: the policy violations preventing the injection or the agent
+// which would inject the packets, the injection with its parameters
+// resolved from the nodes and optionally the bytes of the first packet
+type PacketInjectionPreview struct {
+	Valid      bool
+	Violations []string         `json:",omitempty"`
+	Host       string           `json:",omitempty"`
+	Injection  *PacketInjection `json:",omitempty"`
+	Packet     []byte           `json:",omitempty"`
+}
+
 // Validate verifies the packet injection type is supported
 func (pi *PacketInjection) Validate() error {
 	allowedTypes := map[string]bool{"icmp4": true, "icmp6": true, "tcp4": true, "tcp6": true, "udp4": true, "udp6": true}
@@ -175,9 +561,86 @@ func (pi *PacketInjection) Validate() error {
 	return nil
 }
 
-// TopologyParam topology API parameter
+// ThroughputTest describes a throughput test between two agents, the agent
+// of the destination node receiving the traffic generated during Duration
+// seconds by the agent of the source node
+type ThroughputTest struct {
+	BasicResource `yaml:",inline"`
+	Name          string            `json:",omitempty" yaml:"Name"`
+	Src           string            `valid:"isGremlinExpr" yaml:"Src"`
+	Dst           string            `valid:"isGremlinExpr" yaml:"Dst"`
+	DstIP         string            `json:",omitempty" valid:"isIPOrEmpty" yaml:"DstIP"`
+	Protocol      string            `valid:"regexp=^(|tcp|udp)$" yaml:"Protocol"`
+	Port          int               `json:",omitempty" valid:"min=0,max=65535" yaml:"Port"`
+	Duration      int               `json:",omitempty" valid:"min=0,max=300" yaml:"Duration"`
+	Bandwidth     int64             `json:",omitempty" valid:"min=0" yaml:"Bandwidth"`
+	PacketSize    int               `json:",omitempty" valid:"min=0,max=65000" yaml:"PacketSize"`
+	State         string            `json:",omitempty"`
+	Error         string            `json:",omitempty"`
+	StartTime     time.Time         `json:",omitempty"`
+	Result        *ThroughputResult `json:",omitempty"`
+}
+
+// ThroughputResult describes the traffic sent and received during a
+// throughput test, the duration and the rate being the ones measured by the
+// receiver
+type ThroughputResult struct {
+	Time            int64
+	Protocol        string
+	Duration        int64
+	SentBytes       int64
+	SentPackets     int64
+	ReceivedBytes   int64
+	ReceivedPackets int64
+	LostPackets     int64 `json:",omitempty"`
+	BitsPerSecond   int64
+}
+
+// TopologyParam topology API parameter, the query being given either in
+// Gremlin or in the SQL-like syntax compiled to Gremlin. Timeout, in
+// milliseconds, is the execution deadline requested by the client.
 type TopologyParam struct {
-	GremlinQuery string `json:"GremlinQuery,omitempty" valid:"isGremlinExpr" yaml:"GremlinQuery"`
+	GremlinQuery string `json:"GremlinQuery,omitempty" valid:"isGremlinOrEmpty" yaml:"GremlinQuery"`
+	SQLQuery     string `json:"SQLQuery,omitempty" valid:"isSQLOrEmpty" yaml:"SQLQuery"`
+	Timeout      int64  `json:"Timeout,omitempty" yaml:"Timeout"`
+}
+
+// TruncatedHeader is the header of the topology API responses set when the
+// execution deadline of the query was reached before all the results, the
+// flows of some agents for instance, were retrieved
+const TruncatedHeader = "X-Truncated"
+
+// Query returns the Gremlin query of the parameter, compiling the SQL-like
+// query if given
+func (t *TopologyParam) Query() (string, error) {
+	if t.SQLQuery == "" {
+		return t.GremlinQuery, nil
+	}
+	if t.GremlinQuery != "" {
+		return "", errors.New("Only one of GremlinQuery or SQLQuery can be given")
+	}
+	return sql.Compile(t.SQLQuery)
+}
+
+// DefaultTopologyDiffIgnore lists the metadata not compared by default by
+// the topology diff, as they change continuously
+var DefaultTopologyDiffIgnore = []string{"Metric", "LastUpdateMetric", "SFlow", "Captures"}
+
+// TopologyDiffParam topology diff API parameter, the compared topologies are
+// selected by Gremlin queries returning a graph like G.At('-1h')
+type TopologyDiffParam struct {
+	From    string   `json:"From,omitempty" valid:"isGremlinOrEmpty" yaml:"From"`
+	To      string   `json:"To,omitempty" valid:"isGremlinOrEmpty" yaml:"To"`
+	Fields  []string `json:"Fields,omitempty" yaml:"Fields"`
+	Ignore  []string `json:"Ignore,omitempty" yaml:"Ignore"`
+	MatchBy []string `json:"MatchBy,omitempty" yaml:"MatchBy"`
+}
+
+// SearchParam search API parameter
+type SearchParam struct {
+	Text   string   `yaml:"Text"`
+	Fields []string `json:"Fields,omitempty" yaml:"Fields"`
+	Limit  int      `json:"Limit,omitempty" yaml:"Limit"`
 }
 
 // WorkflowChoice describes one value within a choice
@@ -204,6 +667,30 @@ type Workflow struct {
 	Source        string          `valid:"isValidWorkflow" yaml:"Source"`
 }
 
+// FeatureFlag toggles an experimental behavior of the agents and of the
+// analyzers. A flag with an empty Host applies to the whole cluster, a flag
+// for a given host taking precedence over it.
+type FeatureFlag struct {
+	BasicResource `yaml:",inline"`
+	Name          string `json:"Name" valid:"nonzero" yaml:"Name"`
+	Host          string `json:"Host,omitempty" yaml:"Host"`
+	Enabled       bool   `json:"Enabled" yaml:"Enabled"`
+}
+
+// Decommission removes a host, or a node, and the nodes it owns from the
+// live graph. The removed nodes keep a Decommissioned metadata in the
+// history. Captures and Alerts list the resources referencing them.
+type Decommission struct {
+	BasicResource `yaml:",inline"`
+	Host          string    `json:"Host,omitempty" yaml:"Host"`
+	NodeID        string    `json:"NodeID,omitempty" yaml:"NodeID"`
+	Reason        string    `json:"Reason,omitempty" yaml:"Reason"`
+	CreateTime    time.Time `json:"CreateTime" yaml:"CreateTime"`
+	Nodes         []string  `json:"Nodes,omitempty" yaml:"Nodes"`
+	Captures      []string  `json:"Captures,omitempty" yaml:"Captures"`
+	Alerts        []string  `json:"Alerts,omitempty" yaml:"Alerts"`
+}
+
 // WorkflowCall describes workflow call
 type WorkflowCall struct {
 	Params []interface{}
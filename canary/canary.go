@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package canary
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// maxReportedValues limits the number of missing values listed by a regression
+const maxReportedValues = 10
+
+// Client describes the API used by the checks to reach the analyzer
+type Client interface {
+	Query(query interface{}) ([]byte, error)
+	List(resource string, values interface{}) error
+	Create(resource string, value interface{}, res ...interface{}) error
+	Delete(resource string, id string) error
+}
+
+// Outcome describes the result of a check. Count and Values are a signature
+// of the returned data used to detect the regressions against a baseline,
+// Latency is the median duration of the iterations.
+type Outcome struct {
+	Check   string        `json:"Check"`
+	Count   int64         `json:"Count"`
+	Values  []string      `json:"Values,omitempty"`
+	Latency time.Duration `json:"Latency"`
+	Error   string        `json:"Error,omitempty"`
+}
+
+// Regression describes a difference of a check with its baseline outcome
+type Regression struct {
+	Check  string `json:"Check"`
+	Reason string `json:"Reason"`
+}
+
+// Report holds the outcomes of a run of the suite and the regressions found
+// against the baseline, if any
+type Report struct {
+	Time        int64         `json:"Time"`
+	Outcomes    []*Outcome    `json:"Outcomes"`
+	Regressions []*Regression `json:"Regressions"`
+}
+
+// Opts describes the way the checks are run and compared to the baseline
+type Opts struct {
+	// number of times each check is run, the median latency is kept
+	Iterations int
+	// a latency is a regression when above the baseline one multiplied by
+	// LatencyFactor and by at least LatencyMinDelta
+	LatencyFactor   float64
+	LatencyMinDelta time.Duration
+	// relative decrease of a count considered as a regression
+	CountTolerance float64
+}
+
+// Check describes an operation of the suite. The results of the volatile
+// checks, like the flows, are expected to change and only their latency is
+// compared to the baseline.
+type Check struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+	Volatile    bool   `json:"Volatile"`
+	run         func(c Client) (int64, []string, error)
+}
+
+var checks = map[string]*Check{}
+
+func registerCheck(name, description string, volatile bool, run func(c Client) (int64, []string, error)) {
+	checks[name] = &Check{Name: name, Description: description, Volatile: volatile, run: run}
+}
+
+// Checks returns the checks of the suite sorted by name
+func Checks() []*Check {
+	list := make([]*Check, 0, len(checks))
+	for _, check := range checks {
+		list = append(list, check)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+func (check *Check) execute(c Client, iterations int) *Outcome {
+	outcome := &Outcome{Check: check.Name}
+
+	if iterations < 1 {
+		iterations = 1
+	}
+
+	latencies := make([]time.Duration, 0, iterations)
+	for i := 0; i < iterations; i++ {
+		start := time.Now()
+		count, values, err := check.run(c)
+		latencies = append(latencies, time.Since(start))
+
+		if err != nil {
+			outcome.Error = err.Error()
+			break
+		}
+		outcome.Count, outcome.Values = count, values
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	outcome.Latency = latencies[len(latencies)/2]
+
+	return outcome
+}
+
+// Run the checks of the given names, all the checks if none is given, and
+// compare their outcomes to the baseline report if not nil
+func Run(c Client, names []string, baseline *Report, opts Opts) (*Report, error) {
+	if len(names) == 0 {
+		for _, check := range Checks() {
+			names = append(names, check.Name)
+		}
+	}
+
+	var selected []*Check
+	for _, name := range names {
+		check, found := checks[name]
+		if !found {
+			return nil, fmt.Errorf("Unknown check %s", name)
+		}
+		selected = append(selected, check)
+	}
+
+	report := &Report{
+		Time:        common.UnixMillis(time.Now()),
+		Regressions: []*Regression{},
+	}
+
+	for _, check := range selected {
+		outcome := check.execute(c, opts.Iterations)
+		report.Outcomes = append(report.Outcomes, outcome)
+
+		var previous *Outcome
+		if baseline != nil {
+			previous = baseline.outcome(check.Name)
+		}
+
+		for _, reason := range check.compare(outcome, previous, opts) {
+			report.Regressions = append(report.Regressions, &Regression{Check: check.Name, Reason: reason})
+		}
+	}
+
+	return report, nil
+}
+
+func (r *Report) outcome(check string) *Outcome {
+	for _, outcome := range r.Outcomes {
+		if outcome.Check == check {
+			return outcome
+		}
+	}
+	return nil
+}
+
+// compare returns the reasons why an outcome is a regression of the baseline
+// one, a failure always being reported
+func (check *Check) compare(outcome, baseline *Outcome, opts Opts) (reasons []string) {
+	if outcome.Error != "" {
+		return []string{"Failed: " + outcome.Error}
+	}
+
+	if baseline == nil || baseline.Error != "" {
+		return nil
+	}
+
+	if outcome.Latency > time.Duration(float64(baseline.Latency)*opts.LatencyFactor) && outcome.Latency-baseline.Latency > opts.LatencyMinDelta {
+		reasons = append(reasons, fmt.Sprintf("Latency increased from %s to %s", baseline.Latency, outcome.Latency))
+	}
+
+	if check.Volatile {
+		return
+	}
+
+	if float64(outcome.Count) < float64(baseline.Count)*(1-opts.CountTolerance) {
+		reasons = append(reasons, fmt.Sprintf("Count dropped from %d to %d", baseline.Count, outcome.Count))
+	}
+
+	present := make(map[string]bool, len(outcome.Values))
+	for _, value := range outcome.Values {
+		present[value] = true
+	}
+
+	var missing []string
+	for _, value := range baseline.Values {
+		if !present[value] {
+			missing = append(missing, value)
+		}
+	}
+
+	if len(missing) > 0 {
+		reason := fmt.Sprintf("%d values missing: ", len(missing))
+		if len(missing) > maxReportedValues {
+			missing = append(missing[:maxReportedValues], "...")
+		}
+		reasons = append(reasons, reason+strings.Join(missing, ", "))
+	}
+
+	return
+}
+
+// queryCount runs a Gremlin query returning a count
+func queryCount(query string) func(c Client) (int64, []string, error) {
+	return func(c Client) (int64, []string, error) {
+		data, err := c.Query(query)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var count int64
+		if err := json.Unmarshal(data, &count); err != nil {
+			return 0, nil, err
+		}
+		return count, nil, nil
+	}
+}
+
+// queryValues runs a Gremlin query returning a list of values, reported
+// sorted and deduplicated
+func queryValues(query string) func(c Client) (int64, []string, error) {
+	return func(c Client) (int64, []string, error) {
+		data, err := c.Query(query)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var values []interface{}
+		if err := json.Unmarshal(data, &values); err != nil {
+			return 0, nil, err
+		}
+
+		return int64(len(values)), sortedSet(values), nil
+	}
+}
+
+// listResources lists the API resources of a type, reported by ID
+func listResources(resource string) func(c Client) (int64, []string, error) {
+	return func(c Client) (int64, []string, error) {
+		var resources map[string]interface{}
+		if err := c.List(resource, &resources); err != nil {
+			return 0, nil, err
+		}
+
+		ids := make([]interface{}, 0, len(resources))
+		for id := range resources {
+			ids = append(ids, id)
+		}
+		return int64(len(resources)), sortedSet(ids), nil
+	}
+}
+
+func sortedSet(values []interface{}) []string {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[fmt.Sprintf("%v", value)] = true
+	}
+
+	list := make([]string, 0, len(set))
+	for value := range set {
+		list = append(list, value)
+	}
+	sort.Strings(list)
+
+	return list
+}
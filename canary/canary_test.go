@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package canary
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClient struct {
+	nodes   string
+	hosts   string
+	delay   time.Duration
+	created int
+	deleted int
+}
+
+func (c *fakeClient) Query(query interface{}) ([]byte, error) {
+	time.Sleep(c.delay)
+
+	switch query {
+	case "G.V().Count()":
+		return []byte(c.nodes), nil
+	case "G.V().Has('Type', 'host').Values('Name')":
+		return []byte(c.hosts), nil
+	}
+	return nil, errors.New("unexpected query")
+}
+
+func (c *fakeClient) List(resource string, values interface{}) error {
+	return nil
+}
+
+func (c *fakeClient) Create(resource string, value interface{}, res ...interface{}) error {
+	c.created++
+	return nil
+}
+
+func (c *fakeClient) Delete(resource string, id string) error {
+	c.deleted++
+	return nil
+}
+
+func TestCanaryRegressions(t *testing.T) {
+	opts := Opts{Iterations: 3, LatencyFactor: 2, LatencyMinDelta: 10 * time.Millisecond, CountTolerance: 0.1}
+	names := []string{"topology-nodes", "hosts", "capture-lifecycle"}
+
+	c := &fakeClient{nodes: "100", hosts: `["host1", "host2", "host1"]`}
+	baseline, err := Run(c, names, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(baseline.Regressions) != 0 {
+		t.Fatalf("No regression expected without baseline, got %+v", baseline.Regressions)
+	}
+
+	if hosts := baseline.outcome("hosts"); hosts.Count != 3 || strings.Join(hosts.Values, ",") != "host1,host2" {
+		t.Errorf("Wrong hosts outcome: %+v", hosts)
+	}
+
+	if c.created != opts.Iterations || c.deleted != opts.Iterations {
+		t.Errorf("Capture should be created and deleted at each iteration: %d, %d", c.created, c.deleted)
+	}
+
+	// small changes are tolerated
+	c.nodes = "95"
+	report, _ := Run(c, names, baseline, opts)
+	if len(report.Regressions) != 0 {
+		t.Errorf("No regression expected, got %+v", report.Regressions)
+	}
+
+	c.nodes, c.hosts, c.delay = "80", `["host1"]`, 30*time.Millisecond
+	report, _ = Run(c, names, baseline, opts)
+
+	regressions := map[string][]string{}
+	for _, r := range report.Regressions {
+		regressions[r.Check] = append(regressions[r.Check], r.Reason)
+	}
+
+	if len(regressions["topology-nodes"]) != 2 || len(regressions["hosts"]) != 3 {
+		t.Errorf("Expected count, values and latency regressions, got %+v", regressions)
+	}
+
+	if len(regressions["capture-lifecycle"]) != 0 {
+		t.Errorf("No regression expected for the capture lifecycle, got %+v", regressions)
+	}
+
+	if _, err = Run(c, []string{"unknown"}, nil, opts); err == nil {
+		t.Error("Unknown check should be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package canary
+
+import (
+	"github.com/skydive-project/skydive/api/types"
+)
+
+// canaryCaptureQuery selects no node so that the capture created by the
+// suite never starts
+const canaryCaptureQuery = "G.V().Has('Name', 'skydive-canary-no-such-node')"
+
+func captureLifecycle(c Client) (int64, []string, error) {
+	capture := types.NewCapture(canaryCaptureQuery, "")
+	capture.Name = "skydive-canary"
+
+	if err := c.Create("capture", capture); err != nil {
+		return 0, nil, err
+	}
+
+	if err := c.Delete("capture", capture.ID()); err != nil {
+		return 0, nil, err
+	}
+
+	return 0, nil, nil
+}
+
+func init() {
+	registerCheck("topology-nodes", "Count the nodes of the topology", false,
+		queryCount("G.V().Count()"))
+	registerCheck("topology-edges", "Count the edges of the topology", false,
+		queryCount("G.E().Count()"))
+	registerCheck("hosts", "List the names of the hosts", false,
+		queryValues("G.V().Has('Type', 'host').Values('Name')"))
+	registerCheck("node-types", "List the types of the nodes", false,
+		queryValues("G.V().Values('Type').Dedup()"))
+	registerCheck("host-descendants", "Count the nodes owned by the hosts", false,
+		queryCount("G.V().Has('Type', 'host').Descendants().Count()"))
+	registerCheck("flows", "Count the flows of the agent tables", true,
+		queryCount("G.Flows().Count()"))
+	registerCheck("flows-filter", "Count the IPv4 TCP flows of the agent tables", true,
+		queryCount("G.Flows().Has('Network.Protocol', 'IPV4', 'Transport.Protocol', 'TCP').Count()"))
+	registerCheck("captures", "List the captures", false,
+		listResources("capture"))
+	registerCheck("alerts", "List the alerts", false,
+		listResources("alert"))
+	registerCheck("capture-lifecycle", "Create and delete a capture", true,
+		captureLifecycle)
+}
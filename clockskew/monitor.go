@@ -0,0 +1,284 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clockskew
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// Monitor periodically measures the clock skew of the agents connected to
+// the analyzer, the same way NTP does, keeping the sample of the shortest
+// round trip. The skews are sent back to the agents so that they report
+// them on their host node, and can be used to correct the timestamps of the
+// flows they capture.
+type Monitor struct {
+	sync.RWMutex
+	pool      ws.StructSpeakerPool
+	graph     *graph.Graph
+	interval  time.Duration
+	samples   int
+	maxOffset time.Duration
+	correct   bool
+	skews     map[string]*Skew
+	tidHosts  map[string]string
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// estimate returns the skew of an agent from a time request sent and
+// answered at the given times, the agent being assumed to reply in the
+// middle of the round trip
+func estimate(sent time.Time, agentTime int64, received time.Time) *Skew {
+	rtt := received.Sub(sent).Nanoseconds()
+	return &Skew{Offset: agentTime - (sent.UnixNano() + rtt/2), RTT: rtt}
+}
+
+func (m *Monitor) measure(host string) (*Skew, error) {
+	var best *Skew
+	for i := 0; i < m.samples; i++ {
+		sent := time.Now()
+		resp, err := m.pool.Request(host, ws.NewStructMessage(Namespace, "TimeRequest", nil), ws.DefaultRequestTimeout)
+		received := time.Now()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to send message to agent %s: %s", host, err)
+		}
+
+		if resp.Status != http.StatusOK {
+			return nil, fmt.Errorf("Time request failed on agent %s with status %d", host, resp.Status)
+		}
+
+		var reply TimeReply
+		if err := json.Unmarshal(resp.Obj, &reply); err != nil {
+			return nil, fmt.Errorf("Failed to parse response from %s: %s", host, err)
+		}
+
+		if skew := estimate(sent, reply.Time, received); best == nil || skew.RTT < best.RTT {
+			best = skew
+		}
+	}
+
+	best.Time = common.UnixMillis(time.Now())
+	return best, nil
+}
+
+func (m *Monitor) update(host string) {
+	skew, err := m.measure(host)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to measure the clock skew of %s: %s", host, err)
+		return
+	}
+
+	offset := time.Duration(skew.Offset)
+	if offset < -m.maxOffset || offset > m.maxOffset {
+		logging.GetLogger().Warningf("Clock of agent %s is skewed by %s (round trip %s)", host, offset, time.Duration(skew.RTT))
+	}
+
+	m.Lock()
+	m.skews[host] = skew
+	m.Unlock()
+
+	if err := m.pool.SendMessageTo(ws.NewStructMessage(Namespace, "Skew", skew), host); err != nil {
+		logging.GetLogger().Errorf("Unable to send the clock skew to %s: %s", host, err)
+	}
+}
+
+func (m *Monitor) updateAll() {
+	connected := make(map[string]bool)
+
+	var wg sync.WaitGroup
+	for _, speaker := range m.pool.GetSpeakers() {
+		if speaker.GetServiceType() != common.AgentService {
+			continue
+		}
+
+		host := speaker.GetRemoteHost()
+		connected[host] = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.update(host)
+		}()
+	}
+	wg.Wait()
+
+	m.Lock()
+	for host := range m.skews {
+		if !connected[host] {
+			delete(m.skews, host)
+		}
+	}
+	m.Unlock()
+}
+
+// Skews returns the last skews measured, indexed by agent host
+func (m *Monitor) Skews() map[string]Skew {
+	m.RLock()
+	defer m.RUnlock()
+
+	skews := make(map[string]Skew, len(m.skews))
+	for host, skew := range m.skews {
+		skews[host] = *skew
+	}
+	return skews
+}
+
+// hostOf returns the host of the agent owning the node of the given TID
+func (m *Monitor) hostOf(tid string) string {
+	m.RLock()
+	host, found := m.tidHosts[tid]
+	m.RUnlock()
+
+	if found {
+		return host
+	}
+
+	m.graph.RLock()
+	node := m.graph.LookupFirstNode(graph.Metadata{"TID": tid})
+	if node != nil {
+		host = node.Host
+	}
+	m.graph.RUnlock()
+
+	if host != "" {
+		m.Lock()
+		m.tidHosts[tid] = host
+		m.Unlock()
+	}
+	return host
+}
+
+// shiftTimestamps shifts the timestamps of a flow by the given number of
+// milliseconds, leaving the ones not set
+func shiftTimestamps(f *flow.Flow, delta int64) {
+	timestamps := []*int64{&f.Start, &f.Last}
+	for _, metric := range []*flow.FlowMetric{f.Metric, f.LastUpdateMetric} {
+		if metric != nil {
+			timestamps = append(timestamps, &metric.Start, &metric.Last)
+		}
+	}
+	if m := f.TCPMetric; m != nil {
+		timestamps = append(timestamps, &m.ABSynStart, &m.BASynStart, &m.ABFinStart, &m.BAFinStart, &m.ABRstStart, &m.BARstStart)
+	}
+	for _, r := range f.LastRawPackets {
+		timestamps = append(timestamps, &r.Timestamp)
+	}
+
+	for _, ts := range timestamps {
+		if *ts != 0 {
+			*ts += delta
+		}
+	}
+}
+
+// Tag corrects the timestamps of a flow with the skew of the agent that
+// captured it, when enabled
+func (m *Monitor) Tag(f *flow.Flow) {
+	if !m.correct || f.NodeTID == "" {
+		return
+	}
+
+	host := m.hostOf(f.NodeTID)
+	if host == "" {
+		return
+	}
+
+	m.RLock()
+	skew := m.skews[host]
+	m.RUnlock()
+
+	if skew != nil {
+		shiftTimestamps(f, -skew.Offset/int64(time.Millisecond))
+	}
+}
+
+func (m *Monitor) run() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.updateAll()
+
+		select {
+		case <-ticker.C:
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+// Start the monitor
+func (m *Monitor) Start() {
+	m.wg.Add(1)
+	go m.run()
+}
+
+// Stop the monitor
+func (m *Monitor) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// NewMonitor returns a new monitor measuring the clock skew of the agents
+// of the pool every interval
+func NewMonitor(pool ws.StructSpeakerPool, g *graph.Graph, interval time.Duration, samples int, maxOffset time.Duration, correct bool) *Monitor {
+	if samples <= 0 {
+		samples = 1
+	}
+
+	return &Monitor{
+		pool:      pool,
+		graph:     g,
+		interval:  interval,
+		samples:   samples,
+		maxOffset: maxOffset,
+		correct:   correct,
+		skews:     make(map[string]*Skew),
+		tidHosts:  make(map[string]string),
+		quit:      make(chan struct{}),
+	}
+}
+
+// NewMonitorFromConfig returns a new monitor based on the configuration,
+// nil if the measures are disabled
+func NewMonitorFromConfig(pool ws.StructSpeakerPool, g *graph.Graph) *Monitor {
+	interval := config.GetInt("analyzer.clock_skew.interval")
+	if interval <= 0 {
+		return nil
+	}
+
+	return NewMonitor(pool, g,
+		time.Duration(interval)*time.Second,
+		config.GetInt("analyzer.clock_skew.samples"),
+		time.Duration(config.GetInt("analyzer.clock_skew.max_offset"))*time.Millisecond,
+		config.GetBool("analyzer.clock_skew.correct_flows"),
+	)
+}
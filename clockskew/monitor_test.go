@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clockskew
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func TestEstimate(t *testing.T) {
+	sent := time.Unix(1000, 0)
+	received := sent.Add(10 * time.Millisecond)
+
+	// the agent is 2s ahead and replied in the middle of the round trip
+	agentTime := sent.Add(5*time.Millisecond + 2*time.Second).UnixNano()
+
+	skew := estimate(sent, agentTime, received)
+	if skew.RTT != int64(10*time.Millisecond) {
+		t.Errorf("Expected a round trip of 10ms, got %s", time.Duration(skew.RTT))
+	}
+	if skew.Offset != int64(2*time.Second) {
+		t.Errorf("Expected an offset of 2s, got %s", time.Duration(skew.Offset))
+	}
+}
+
+func TestShiftTimestamps(t *testing.T) {
+	f := &flow.Flow{
+		Start:            5000,
+		Last:             6000,
+		Metric:           &flow.FlowMetric{Start: 5000, Last: 6000},
+		LastUpdateMetric: &flow.FlowMetric{Start: 5500, Last: 6000},
+		TCPMetric:        &flow.TCPMetric{ABSynStart: 5000, BASynStart: 5001},
+		LastRawPackets:   []*flow.RawPacket{{Timestamp: 5900}},
+	}
+
+	shiftTimestamps(f, -2000)
+
+	if f.Start != 3000 || f.Last != 4000 {
+		t.Errorf("Flow timestamps not corrected: %d, %d", f.Start, f.Last)
+	}
+	if f.Metric.Start != 3000 || f.LastUpdateMetric.Start != 3500 || f.LastUpdateMetric.Last != 4000 {
+		t.Errorf("Metric timestamps not corrected: %+v, %+v", f.Metric, f.LastUpdateMetric)
+	}
+	if f.TCPMetric.BASynStart != 3001 || f.TCPMetric.ABFinStart != 0 {
+		t.Errorf("TCP timestamps not corrected: %+v", f.TCPMetric)
+	}
+	if f.LastRawPackets[0].Timestamp != 3900 {
+		t.Errorf("Raw packet timestamp not corrected: %d", f.LastRawPackets[0].Timestamp)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clockskew
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// Namespace ClockSkew
+	Namespace = "ClockSkew"
+)
+
+// TimeReply holds the time of an agent when it replied to a time request,
+// in nanoseconds
+type TimeReply struct {
+	Time int64
+}
+
+// Skew describes the clock skew of an agent measured by an analyzer, Offset
+// being the time of the agent minus the time of the analyzer and RTT the
+// round trip time of the measure, both in nanoseconds, Time being the time
+// of the measure in milliseconds
+type Skew struct {
+	Offset int64
+	RTT    int64
+	Time   int64
+}
+
+// Server answers the time requests of the analyzers and reports the skew
+// they measured in the ClockSkew metadata of the host node
+type Server struct {
+	graph    *graph.Graph
+	hostNode *graph.Node
+}
+
+func (s *Server) setSkew(skew *Skew) {
+	s.graph.Lock()
+	defer s.graph.Unlock()
+
+	s.graph.AddMetadata(s.hostNode, "ClockSkew", map[string]interface{}{
+		"Offset": skew.Offset,
+		"RTT":    skew.RTT,
+		"Time":   skew.Time,
+	})
+}
+
+// OnStructMessage event, websocket clock skew requests
+func (s *Server) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	switch msg.Type {
+	case "TimeRequest":
+		c.SendMessage(msg.Reply(&TimeReply{Time: time.Now().UnixNano()}, "TimeReply", http.StatusOK))
+	case "Skew":
+		var skew Skew
+		if err := json.Unmarshal(msg.Obj, &skew); err != nil {
+			logging.GetLogger().Errorf("Unable to decode clock skew message %v", msg)
+			return
+		}
+		s.setSkew(&skew)
+	}
+}
+
+// NewServer creates a new clock skew server handling the messages of the
+// analyzers
+func NewServer(pool ws.StructSpeakerPool, g *graph.Graph, hostNode *graph.Node) *Server {
+	s := &Server{graph: g, hostNode: hostNode}
+	pool.AddStructMessageHandler(s, []string{Namespace})
+	return s
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	appPriority int64
+	appProtocol string
+	appPorts    string
+	appCIDR     string
+)
+
+// ApplicationRuleCmd skydive application rule root command
+var ApplicationRuleCmd = &cobra.Command{
+	Use:          "application-rule",
+	Short:        "application-rule",
+	Long:         "application-rule",
+	SilenceUsage: false,
+}
+
+// ApplicationRuleCreate skydive application rule create command
+var ApplicationRuleCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		rule := &api.ApplicationRule{
+			Name:         name,
+			Description:  description,
+			Priority:     appPriority,
+			Protocol:     appProtocol,
+			Ports:        appPorts,
+			CIDR:         appCIDR,
+			GremlinQuery: query,
+		}
+
+		if err = validator.Validate(rule); err != nil {
+			exitOnError(fmt.Errorf("Error while validating application rule: %s", err))
+		}
+
+		if err = client.Create("applicationrule", &rule); err != nil {
+			exitOnError(err)
+		}
+
+		printJSON(rule)
+	},
+}
+
+// ApplicationRuleGet skydive application rule get command
+var ApplicationRuleGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var rule api.ApplicationRule
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("applicationrule", args[0], &rule); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&rule)
+	},
+}
+
+// ApplicationRuleList skydive application rule list command
+var ApplicationRuleList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var rules map[string]api.ApplicationRule
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("applicationrule", &rules); err != nil {
+			exitOnError(err)
+		}
+		printJSON(rules)
+	},
+}
+
+// ApplicationRuleDelete skydive application rule delete command
+var ApplicationRuleDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("applicationrule", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	ApplicationRuleCmd.AddCommand(ApplicationRuleCreate)
+	ApplicationRuleCmd.AddCommand(ApplicationRuleList)
+	ApplicationRuleCmd.AddCommand(ApplicationRuleGet)
+	ApplicationRuleCmd.AddCommand(ApplicationRuleDelete)
+
+	ApplicationRuleCreate.Flags().StringVarP(&name, "name", "", "", "application name")
+	ApplicationRuleCreate.Flags().StringVarP(&description, "description", "", "", "rule description")
+	ApplicationRuleCreate.Flags().Int64VarP(&appPriority, "priority", "", 0, "rule priority, highest first")
+	ApplicationRuleCreate.Flags().StringVarP(&appProtocol, "protocol", "", "", "flow protocol, ex: TCP")
+	ApplicationRuleCreate.Flags().StringVarP(&appPorts, "ports", "", "", "ports or port ranges, ex: 80,8000-8080")
+	ApplicationRuleCreate.Flags().StringVarP(&appCIDR, "cidr", "", "", "network of one of the endpoints")
+	ApplicationRuleCreate.Flags().StringVarP(&query, "gremlin", "", "", "gremlin query selecting the capture nodes")
+}
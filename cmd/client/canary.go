@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/canary"
+	shttp "github.com/skydive-project/skydive/http"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	canaryChecks          []string
+	canaryBaseline        string
+	canarySave            string
+	canaryIterations      int
+	canaryLatencyFactor   float64
+	canaryLatencyMinDelta time.Duration
+	canaryCountTolerance  float64
+)
+
+// canaryClient gives the canary checks access to the Gremlin and CRUD APIs
+type canaryClient struct {
+	*client.GremlinQueryHelper
+	*shttp.CrudClient
+}
+
+// CanaryCmd skydive canary root command
+var CanaryCmd = &cobra.Command{
+	Use:          "canary",
+	Short:        "Run the canary query suite",
+	Long:         "Run a suite of representative operations to validate an analyzer, after an upgrade for instance",
+	SilenceUsage: false,
+}
+
+// CanaryList describes the command to list the canary checks
+var CanaryList = &cobra.Command{
+	Use:   "list",
+	Short: "List canary checks",
+	Long:  "List the checks of the canary suite",
+	Run: func(cmd *cobra.Command, args []string) {
+		printJSON(canary.Checks())
+	},
+}
+
+// CanaryRun describes the command to run the canary checks
+var CanaryRun = &cobra.Command{
+	Use:   "run",
+	Short: "Run canary checks",
+	Long: "Run the canary checks and report their outcomes. The report can be saved and used as the baseline " +
+		"of a later run, regressions of the results or latencies against the baseline making the command fail",
+	Run: func(cmd *cobra.Command, args []string) {
+		var baseline *canary.Report
+		if canaryBaseline != "" {
+			data, err := ioutil.ReadFile(canaryBaseline)
+			if err != nil {
+				exitOnError(err)
+			}
+			if err = json.Unmarshal(data, &baseline); err != nil {
+				exitOnError(err)
+			}
+		}
+
+		crudClient, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		c := &canaryClient{
+			GremlinQueryHelper: client.NewGremlinQueryHelper(&AuthenticationOpts),
+			CrudClient:         crudClient,
+		}
+
+		opts := canary.Opts{
+			Iterations:      canaryIterations,
+			LatencyFactor:   canaryLatencyFactor,
+			LatencyMinDelta: canaryLatencyMinDelta,
+			CountTolerance:  canaryCountTolerance,
+		}
+
+		report, err := canary.Run(c, canaryChecks, baseline, opts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if canarySave != "" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				exitOnError(err)
+			}
+			if err = ioutil.WriteFile(canarySave, data, 0644); err != nil {
+				exitOnError(err)
+			}
+		}
+
+		printJSON(report)
+
+		if len(report.Regressions) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	CanaryCmd.AddCommand(CanaryList)
+	CanaryCmd.AddCommand(CanaryRun)
+
+	CanaryRun.Flags().StringSliceVarP(&canaryChecks, "check", "", nil, "checks to run, all if not specified")
+	CanaryRun.Flags().StringVarP(&canaryBaseline, "baseline", "", "", "report of a previous run to compare the outcomes with")
+	CanaryRun.Flags().StringVarP(&canarySave, "save", "", "", "file to save the report to, to be used as a baseline")
+	CanaryRun.Flags().IntVarP(&canaryIterations, "iterations", "", 3, "number of runs of each check, the median latency being kept")
+	CanaryRun.Flags().Float64VarP(&canaryLatencyFactor, "latency-factor", "", 2, "latency increase factor reported as a regression")
+	CanaryRun.Flags().DurationVarP(&canaryLatencyMinDelta, "latency-min-delta", "", 50*time.Millisecond, "minimal latency increase reported as a regression")
+	CanaryRun.Flags().Float64VarP(&canaryCountTolerance, "count-tolerance", "", 0.1, "relative decrease of a count reported as a regression")
+}
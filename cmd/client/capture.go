@@ -18,8 +18,12 @@
 package client
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 
 	"github.com/skydive-project/skydive/api/client"
@@ -42,13 +46,69 @@ var (
 	pollingInterval    uint32
 	headerSize         int
 	rawPacketLimit     int
+	rawPacketExcluded  []int
+	rawPacketSampling  int
 	extraTCPMetric     bool
 	ipDefrag           bool
 	reassembleTCP      bool
 	layerKeyMode       string
 	extraLayers        []string
+	captureProfile     string
+	captureNamespace   string
+	placementCreate    bool
+	maxTableMemory     int
+	evictionPolicy     string
+	packetSampling     int
+	flowByteLimit      int64
+	maxFlows           int
+	reviewReason       string
 )
 
+// newCaptureFromFlags returns a capture with the parameters given on the
+// command line
+func newCaptureFromFlags(cmd *cobra.Command, gremlinQuery string) *api.Capture {
+	var layers flow.ExtraLayers
+	if err := layers.Parse(extraLayers...); err != nil {
+		exitOnError(err)
+	}
+
+	capture := api.NewCapture(gremlinQuery, bpfFilter)
+	capture.Name = captureName
+	capture.Description = captureDescription
+	capture.Type = captureType
+	capture.Port = port
+	capture.SamplingRate = samplingRate
+	capture.PollingInterval = pollingInterval
+	capture.HeaderSize = headerSize
+	capture.ExtraTCPMetric = extraTCPMetric
+	capture.IPDefrag = ipDefrag
+	capture.ReassembleTCP = reassembleTCP
+	capture.LayerKeyMode = layerKeyMode
+	capture.RawPacketLimit = rawPacketLimit
+	capture.RawPacketExcludedPorts = rawPacketExcluded
+	capture.RawPacketSampling = rawPacketSampling
+	capture.ExtraLayers = layers
+	capture.Profile = captureProfile
+	capture.Namespace = captureNamespace
+	capture.MaxFlowTableMemory = maxTableMemory
+	capture.EvictionPolicy = evictionPolicy
+	capture.PacketSampling = packetSampling
+	capture.FlowByteLimit = flowByteLimit
+	capture.MaxFlows = maxFlows
+
+	// let the profile define the sFlow parameters not explicitly given
+	if captureProfile != "" {
+		if !cmd.Flags().Changed("samplingrate") {
+			capture.SamplingRate = 0
+		}
+		if !cmd.Flags().Changed("pollinginterval") {
+			capture.PollingInterval = 0
+		}
+	}
+
+	return capture
+}
+
 // CaptureCmd skydive capture root command
 var CaptureCmd = &cobra.Command{
 	Use:          "capture",
@@ -76,25 +136,7 @@ var CaptureCreate = &cobra.Command{
 			exitOnError(err)
 		}
 
-		var layers flow.ExtraLayers
-		if err := layers.Parse(extraLayers...); err != nil {
-			exitOnError(err)
-		}
-
-		capture := api.NewCapture(gremlinQuery, bpfFilter)
-		capture.Name = captureName
-		capture.Description = captureDescription
-		capture.Type = captureType
-		capture.Port = port
-		capture.SamplingRate = samplingRate
-		capture.PollingInterval = pollingInterval
-		capture.HeaderSize = headerSize
-		capture.ExtraTCPMetric = extraTCPMetric
-		capture.IPDefrag = ipDefrag
-		capture.ReassembleTCP = reassembleTCP
-		capture.LayerKeyMode = layerKeyMode
-		capture.RawPacketLimit = rawPacketLimit
-		capture.ExtraLayers = layers
+		capture := newCaptureFromFlags(cmd, gremlinQuery)
 
 		if err := validator.Validate(capture); err != nil {
 			exitOnError(err)
@@ -176,6 +218,102 @@ var CaptureDelete = &cobra.Command{
 	},
 }
 
+// CapturePlacement skydive capture placement command
+var CapturePlacement = &cobra.Command{
+	Use:   "placement",
+	Short: "Recommend the interfaces to capture on",
+	Long:  "Recommend the interfaces to capture on to observe the traffic between the endpoints selected by the Gremlin query",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if gremlinQuery == "" {
+			exitOnError(errors.New("Option --gremlin selecting the endpoints is required"))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		request := &api.CapturePlacementRequest{
+			GremlinQuery: gremlinQuery,
+			Create:       placementCreate,
+			Capture:      newCaptureFromFlags(cmd, ""),
+		}
+
+		body, err := json.Marshal(request)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		resp, err := client.Request("POST", "capture/placement", bytes.NewReader(body), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			exitOnError(fmt.Errorf("Failed to compute the capture placement, %s: %s", resp.Status, data))
+		}
+
+		var placement api.CapturePlacement
+		if err := json.Unmarshal(data, &placement); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&placement)
+	},
+}
+
+// newCaptureReviewCmd returns the command approving or rejecting pending
+// captures
+func newCaptureReviewCmd(action, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   action + " [capture]",
+		Short: short,
+		Long:  short,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				cmd.Usage()
+				os.Exit(1)
+			}
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+			if err != nil {
+				exitOnError(err)
+			}
+
+			body, err := json.Marshal(&api.CaptureReview{Reason: reviewReason})
+			if err != nil {
+				exitOnError(err)
+			}
+
+			for _, id := range args {
+				resp, err := client.Request("POST", "capture/"+id+"/"+action, bytes.NewReader(body), nil)
+				if err != nil {
+					exitOnError(err)
+				}
+
+				data, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					logging.GetLogger().Errorf("Failed to %s capture %s, %s: %s", action, id, resp.Status, data)
+					continue
+				}
+
+				var capture api.Capture
+				if err := json.Unmarshal(data, &capture); err != nil {
+					exitOnError(err)
+				}
+				printJSON(&capture)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&reviewReason, "reason", "", "", "reason of the review")
+	return cmd
+}
+
 func addCaptureFlags(cmd *cobra.Command) {
 	helpText := fmt.Sprintf("Allowed capture types: %v", common.ProbeTypes)
 	cmd.Flags().StringVarP(&gremlinQuery, "gremlin", "", "", "Gremlin Query")
@@ -189,11 +327,20 @@ func addCaptureFlags(cmd *cobra.Command) {
 	cmd.Flags().Uint32VarP(&pollingInterval, "pollinginterval", "", 10, "Polling Interval for SFlow Counter Sampling, 0 - no counter samples, default: 10")
 	cmd.Flags().IntVarP(&headerSize, "header-size", "", 0, fmt.Sprintf("Header size of packet used, default: %d", flow.MaxCaptureLength))
 	cmd.Flags().IntVarP(&rawPacketLimit, "rawpacket-limit", "", 0, "Set the limit of raw packet captured, 0 no packet, -1 infinite, default: 0")
+	cmd.Flags().IntSliceVarP(&rawPacketExcluded, "rawpacket-exclude-port", "", []int{}, "Ports whose flows never retain raw packets")
+	cmd.Flags().IntVarP(&rawPacketSampling, "rawpacket-sampling", "", 0, "Retain the raw packets of one flow out of N, default: all the flows")
 	cmd.Flags().BoolVarP(&extraTCPMetric, "extra-tcp-metric", "", false, "Add additional TCP metric to flows, default: false")
 	cmd.Flags().BoolVarP(&ipDefrag, "ip-defrag", "", false, "Defragment IPv4 packets, default: false")
 	cmd.Flags().BoolVarP(&reassembleTCP, "reassamble-tcp", "", false, "Reassemble TCP packets, default: false")
 	cmd.Flags().StringVarP(&layerKeyMode, "layer-key-mode", "", "L2", "Defines the first layer used by flow key calculation, L2 or L3")
 	cmd.Flags().StringArrayVarP(&extraLayers, "extra-layer", "", []string{}, fmt.Sprintf("List of extra layers to be added to the flow, available: %s", flow.ExtraLayers(flow.ALLLayer)))
+	cmd.Flags().StringVarP(&captureProfile, "profile", "", "", "capture profile providing the parameters not given")
+	cmd.Flags().StringVarP(&captureNamespace, "namespace", "", "", "namespace of the capture, selecting the profile overrides")
+	cmd.Flags().IntVarP(&maxTableMemory, "max-table-memory", "", 0, "Memory limit in MB of the flow table, default: agent setting")
+	cmd.Flags().StringVarP(&evictionPolicy, "eviction-policy", "", "", "Flows evicted when the flow table reaches its memory limit, lru or largest, default: agent setting")
+	cmd.Flags().IntVarP(&packetSampling, "packet-sampling", "", 0, "Process one packet out of N, default: agent setting")
+	cmd.Flags().Int64VarP(&flowByteLimit, "flow-byte-limit", "", 0, "Bytes after which the packets of a flow are only counted, default: agent setting")
+	cmd.Flags().IntVarP(&maxFlows, "max-flows", "", 0, "Max number of flows, the least recently seen being evicted, default: agent setting")
 }
 
 func init() {
@@ -201,6 +348,12 @@ func init() {
 	CaptureCmd.AddCommand(CaptureCreate)
 	CaptureCmd.AddCommand(CaptureGet)
 	CaptureCmd.AddCommand(CaptureDelete)
+	CaptureCmd.AddCommand(newCaptureReviewCmd("approve", "Approve pending capture"))
+	CaptureCmd.AddCommand(newCaptureReviewCmd("reject", "Reject pending capture"))
 
 	addCaptureFlags(CaptureCreate)
+
+	CaptureCmd.AddCommand(CapturePlacement)
+	addCaptureFlags(CapturePlacement)
+	CapturePlacement.Flags().BoolVarP(&placementCreate, "create", "", false, "create the capture on the recommended interfaces")
 }
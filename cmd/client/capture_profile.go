@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var profileOverrides string
+
+// CaptureProfileCmd skydive capture profile root command
+var CaptureProfileCmd = &cobra.Command{
+	Use:          "capture-profile",
+	Short:        "Manage capture profiles",
+	Long:         "Manage capture profiles",
+	SilenceUsage: false,
+}
+
+// CaptureProfileCreate skydive capture profile create command
+var CaptureProfileCreate = &cobra.Command{
+	Use:   "create",
+	Short: "Create capture profile",
+	Long:  "Create capture profile",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		var layers flow.ExtraLayers
+		if err := layers.Parse(extraLayers...); err != nil {
+			exitOnError(err)
+		}
+
+		profile := &api.CaptureProfile{
+			Name:        captureName,
+			Description: captureDescription,
+			CaptureSettings: api.CaptureSettings{
+				Type:            captureType,
+				BPFFilter:       bpfFilter,
+				HeaderSize:      headerSize,
+				RawPacketLimit:  rawPacketLimit,
+				SamplingRate:    samplingRate,
+				PollingInterval: pollingInterval,
+				ExtraTCPMetric:  extraTCPMetric,
+				IPDefrag:        ipDefrag,
+				ReassembleTCP:   reassembleTCP,
+				ExtraLayers:     layers,
+			},
+		}
+
+		if profileOverrides != "" {
+			data, err := ioutil.ReadFile(profileOverrides)
+			if err != nil {
+				exitOnError(err)
+			}
+			if err := json.Unmarshal(data, &profile.Overrides); err != nil {
+				exitOnError(fmt.Errorf("Unable to decode overrides %s: %s", profileOverrides, err))
+			}
+		}
+
+		if err := validator.Validate(profile); err != nil {
+			exitOnError(fmt.Errorf("Error while validating capture profile: %s", err))
+		}
+
+		if err := client.Create("captureprofile", &profile); err != nil {
+			exitOnError(err)
+		}
+		printJSON(profile)
+	},
+}
+
+// CaptureProfileList skydive capture profile list command
+var CaptureProfileList = &cobra.Command{
+	Use:   "list",
+	Short: "List capture profiles",
+	Long:  "List capture profiles",
+	Run: func(cmd *cobra.Command, args []string) {
+		var profiles map[string]api.CaptureProfile
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("captureprofile", &profiles); err != nil {
+			exitOnError(err)
+		}
+		printJSON(profiles)
+	},
+}
+
+// CaptureProfileGet skydive capture profile get command
+var CaptureProfileGet = &cobra.Command{
+	Use:   "get [profile]",
+	Short: "Display capture profile",
+	Long:  "Display capture profile",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var profile api.CaptureProfile
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.Get("captureprofile", args[0], &profile); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&profile)
+	},
+}
+
+// CaptureProfileDelete skydive capture profile delete command
+var CaptureProfileDelete = &cobra.Command{
+	Use:   "delete [profile]",
+	Short: "Delete capture profile",
+	Long:  "Delete capture profile",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("captureprofile", id); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	},
+}
+
+func init() {
+	CaptureProfileCmd.AddCommand(CaptureProfileCreate)
+	CaptureProfileCmd.AddCommand(CaptureProfileList)
+	CaptureProfileCmd.AddCommand(CaptureProfileGet)
+	CaptureProfileCmd.AddCommand(CaptureProfileDelete)
+
+	flags := CaptureProfileCreate.Flags()
+	flags.StringVarP(&captureName, "name", "", "", "profile name")
+	flags.StringVarP(&captureDescription, "description", "", "", "profile description")
+	flags.StringVarP(&captureType, "type", "", "", fmt.Sprintf("Allowed capture types: %v", common.ProbeTypes))
+	flags.StringVarP(&bpfFilter, "bpf", "", "", "BPF filter")
+	flags.IntVarP(&headerSize, "header-size", "", 0, "Header size of packet used")
+	flags.IntVarP(&rawPacketLimit, "rawpacket-limit", "", 0, "Set the limit of raw packet captured, 0 no packet, -1 infinite")
+	flags.Uint32VarP(&samplingRate, "samplingrate", "", 0, "Sampling Rate for SFlow Flow Sampling")
+	flags.Uint32VarP(&pollingInterval, "pollinginterval", "", 0, "Polling Interval for SFlow Counter Sampling")
+	flags.BoolVarP(&extraTCPMetric, "extra-tcp-metric", "", false, "Add additional TCP metric to flows")
+	flags.BoolVarP(&ipDefrag, "ip-defrag", "", false, "Defragment IPv4 packets")
+	flags.BoolVarP(&reassembleTCP, "reassamble-tcp", "", false, "Reassemble TCP packets")
+	flags.StringArrayVarP(&extraLayers, "extra-layer", "", []string{}, fmt.Sprintf("List of extra layers to be added to the flow, available: %s", flow.ExtraLayers(flow.ALLLayer)))
+	flags.StringVarP(&profileOverrides, "overrides", "", "", `JSON file of the settings by namespace, ex: {"prod": {"BPFFilter": "port 443"}}`)
+}
@@ -25,7 +25,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var analyzerAddr string
+var (
+	analyzerAddr string
+	unixSocket   string
+)
 
 // ClientCmd describe the skydive client root command
 var ClientCmd = &cobra.Command{
@@ -40,22 +43,35 @@ var ClientCmd = &cobra.Command{
 		} else {
 			config.SetDefault("analyzers", []string{"localhost:8082"})
 		}
+		if unixSocket != "" {
+			config.Set("client.unix_socket", unixSocket)
+		}
 	},
 }
 
 // RegisterClientCommands registers the 'client' CLI subcommands
 func RegisterClientCommands(cmd *cobra.Command) {
 	cmd.AddCommand(AlertCmd)
+	cmd.AddCommand(CanaryCmd)
 	cmd.AddCommand(CaptureCmd)
+	cmd.AddCommand(CaptureProfileCmd)
 	cmd.AddCommand(PacketInjectorCmd)
 	cmd.AddCommand(PcapCmd)
 	cmd.AddCommand(QueryCmd)
 	cmd.AddCommand(ShellCmd)
 	cmd.AddCommand(StatusCmd)
+	cmd.AddCommand(ThroughputTestCmd)
 	cmd.AddCommand(TopologyCmd)
 	cmd.AddCommand(WorkflowCmd)
 	cmd.AddCommand(NodeRuleCmd)
 	cmd.AddCommand(EdgeRuleCmd)
+	cmd.AddCommand(ApplicationRuleCmd)
+	cmd.AddCommand(FeatureFlagCmd)
+	cmd.AddCommand(ReportCmd)
+	cmd.AddCommand(SearchCmd)
+	cmd.AddCommand(ScratchCmd)
+	cmd.AddCommand(HealthCmd)
+	cmd.AddCommand(DecommissionCmd)
 }
 
 func exitOnError(err error) {
@@ -67,6 +83,7 @@ func init() {
 	ClientCmd.PersistentFlags().StringVarP(&AuthenticationOpts.Username, "username", "", os.Getenv("SKYDIVE_USERNAME"), "username auth parameter")
 	ClientCmd.PersistentFlags().StringVarP(&AuthenticationOpts.Password, "password", "", os.Getenv("SKYDIVE_PASSWORD"), "password auth parameter")
 	ClientCmd.PersistentFlags().StringVarP(&analyzerAddr, "analyzer", "", os.Getenv("SKYDIVE_ANALYZER"), "analyzer address")
+	ClientCmd.PersistentFlags().StringVarP(&unixSocket, "unix-socket", "", os.Getenv("SKYDIVE_UNIX_SOCKET"), "path of the analyzer unix socket, used instead of the analyzer address")
 
 	RegisterClientCommands(ClientCmd)
 }
@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	decommissionHost   string
+	decommissionNode   string
+	decommissionReason string
+)
+
+// DecommissionCmd skydive decommission root command
+var DecommissionCmd = &cobra.Command{
+	Use:          "decommission",
+	Short:        "decommission",
+	Long:         "decommission",
+	SilenceUsage: false,
+}
+
+// DecommissionCreate skydive decommission create command
+var DecommissionCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "remove a host, or a node, and the nodes it owns from the topology",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if (decommissionHost == "") == (decommissionNode == "") {
+			exitOnError(fmt.Errorf("Either --host or --node is required"))
+		}
+
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		decommission := &api.Decommission{
+			Host:   decommissionHost,
+			NodeID: decommissionNode,
+			Reason: decommissionReason,
+		}
+
+		if err = client.Create("decommission", &decommission); err != nil {
+			exitOnError(err)
+		}
+
+		printJSON(decommission)
+	},
+}
+
+// DecommissionGet skydive decommission get command
+var DecommissionGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var decommission api.Decommission
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("decommission", args[0], &decommission); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&decommission)
+	},
+}
+
+// DecommissionList skydive decommission list command
+var DecommissionList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var decommissions map[string]api.Decommission
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("decommission", &decommissions); err != nil {
+			exitOnError(err)
+		}
+		printJSON(decommissions)
+	},
+}
+
+// DecommissionDelete skydive decommission delete command
+var DecommissionDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete the decommission records, the removed nodes are not restored",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("decommission", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	DecommissionCmd.AddCommand(DecommissionCreate)
+	DecommissionCmd.AddCommand(DecommissionList)
+	DecommissionCmd.AddCommand(DecommissionGet)
+	DecommissionCmd.AddCommand(DecommissionDelete)
+
+	DecommissionCreate.Flags().StringVarP(&decommissionHost, "host", "", "", "host to decommission")
+	DecommissionCreate.Flags().StringVarP(&decommissionNode, "node", "", "", "ID of the node to decommission")
+	DecommissionCreate.Flags().StringVarP(&decommissionReason, "reason", "", "", "reason of the decommission")
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	flagHost    string
+	flagEnabled bool
+)
+
+// FeatureFlagCmd skydive feature flag root command
+var FeatureFlagCmd = &cobra.Command{
+	Use:          "feature-flag",
+	Short:        "feature-flag",
+	Long:         "feature-flag",
+	SilenceUsage: false,
+}
+
+// FeatureFlagCreate skydive feature flag create command
+var FeatureFlagCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		flag := &api.FeatureFlag{
+			Name:    name,
+			Host:    flagHost,
+			Enabled: flagEnabled,
+		}
+
+		if err = validator.Validate(flag); err != nil {
+			exitOnError(fmt.Errorf("Error while validating feature flag: %s", err))
+		}
+
+		if err = client.Create("featureflag", &flag); err != nil {
+			exitOnError(err)
+		}
+
+		printJSON(flag)
+	},
+}
+
+// FeatureFlagGet skydive feature flag get command
+var FeatureFlagGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var flag api.FeatureFlag
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("featureflag", args[0], &flag); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&flag)
+	},
+}
+
+// FeatureFlagList skydive feature flag list command
+var FeatureFlagList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var flags map[string]api.FeatureFlag
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("featureflag", &flags); err != nil {
+			exitOnError(err)
+		}
+		printJSON(flags)
+	},
+}
+
+// FeatureFlagDelete skydive feature flag delete command
+var FeatureFlagDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("featureflag", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	FeatureFlagCmd.AddCommand(FeatureFlagCreate)
+	FeatureFlagCmd.AddCommand(FeatureFlagList)
+	FeatureFlagCmd.AddCommand(FeatureFlagGet)
+	FeatureFlagCmd.AddCommand(FeatureFlagDelete)
+
+	FeatureFlagCreate.Flags().StringVarP(&name, "name", "", "", "feature flag name")
+	FeatureFlagCreate.Flags().StringVarP(&flagHost, "host", "", "", "host the flag applies to, all the hosts if empty")
+	FeatureFlagCreate.Flags().BoolVarP(&flagEnabled, "enabled", "", true, "enable or disable the feature")
+}
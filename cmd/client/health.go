@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"github.com/skydive-project/skydive/health"
+
+	"github.com/spf13/cobra"
+)
+
+var healthChecks []string
+
+// HealthCmd skydive health root command
+var HealthCmd = &cobra.Command{
+	Use:          "health",
+	Short:        "Run topology health checks",
+	Long:         "Run the built-in topology health checks",
+	SilenceUsage: false,
+}
+
+// HealthList describes the command to list the health checks
+var HealthList = &cobra.Command{
+	Use:   "list",
+	Short: "List health checks",
+	Long:  "List the built-in health checks",
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("GET", "health/checks", nil)
+	},
+}
+
+// HealthRun describes the command to run the health checks
+var HealthRun = &cobra.Command{
+	Use:   "run",
+	Short: "Run health checks",
+	Long:  "Run health checks against the topology and display their findings",
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("POST", "health/run", &health.RunParams{Checks: healthChecks})
+	},
+}
+
+// HealthReport describes the command to display the last scheduled report
+var HealthReport = &cobra.Command{
+	Use:   "report",
+	Short: "Display the last health report",
+	Long:  "Display the findings of the last periodic run of the health checks",
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("GET", "health/report", nil)
+	},
+}
+
+func init() {
+	HealthCmd.AddCommand(HealthList)
+	HealthCmd.AddCommand(HealthRun)
+	HealthCmd.AddCommand(HealthReport)
+
+	HealthRun.Flags().StringSliceVarP(&healthChecks, "check", "", nil, "checks to run, all if not specified")
+}
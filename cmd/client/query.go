@@ -25,34 +25,65 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/gremlin/sql"
 	"github.com/skydive-project/skydive/logging"
 )
 
+var (
+	sqlQuery     string
+	queryTimeout time.Duration
+)
+
+func warnIfTruncated(resp *http.Response) {
+	if client.Truncated(resp) {
+		logging.GetLogger().Warning("Partial results, the deadline of the query was reached")
+	}
+}
+
 // QueryCmd skydive topology query command
 var QueryCmd = &cobra.Command{
 	Use:   "query [gremlin]",
 	Short: "Issue Gremlin queries",
-	Long:  "Issue Gremlin queries",
+	Long:  "Issue Gremlin queries, or SQL-like queries compiled to Gremlin with --sql",
 	PreRun: func(cmd *cobra.Command, args []string) {
-		if len(args) == 0 || args[0] == "" {
+		if sqlQuery == "" && (len(args) == 0 || args[0] == "") {
 			cmd.Usage()
 			os.Exit(1)
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		gremlinQuery = args[0]
+		if sqlQuery != "" {
+			var err error
+			if gremlinQuery, err = sql.Compile(sqlQuery); err != nil {
+				exitOnError(err)
+			}
+		} else {
+			gremlinQuery = args[0]
+		}
 		queryHelper := client.NewGremlinQueryHelper(&AuthenticationOpts)
+		queryHelper.SetTimeout(queryTimeout)
 
 		switch outputFormat {
 		case "json":
-			data, err := queryHelper.Query(gremlinQuery)
+			resp, err := queryHelper.Request(gremlinQuery, nil)
+			if err != nil {
+				exitOnError(err)
+			}
+			defer resp.Body.Close()
+
+			data, err := ioutil.ReadAll(resp.Body)
 			if err != nil {
 				exitOnError(err)
 			}
+			if resp.StatusCode != http.StatusOK {
+				exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
+			}
+			warnIfTruncated(resp)
 
 			var out bytes.Buffer
 			json.Indent(&out, data, "", "\t")
@@ -70,10 +101,15 @@ var QueryCmd = &cobra.Command{
 				data, _ := ioutil.ReadAll(resp.Body)
 				exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
 			}
+			warnIfTruncated(resp)
 			bufio.NewReader(resp.Body).WriteTo(os.Stdout)
-		case "pcap":
+		case "pcap", "pcapng":
 			header := make(http.Header)
-			header.Set("Accept", "vnd.tcpdump.pcap")
+			if outputFormat == "pcapng" {
+				header.Set("Accept", "application/x-pcapng")
+			} else {
+				header.Set("Accept", "vnd.tcpdump.pcap")
+			}
 			resp, err := queryHelper.Request(gremlinQuery, header)
 			if err != nil {
 				exitOnError(err)
@@ -84,6 +120,7 @@ var QueryCmd = &cobra.Command{
 				data, _ := ioutil.ReadAll(resp.Body)
 				exitOnError(fmt.Errorf("%s: %s", resp.Status, string(data)))
 			}
+			warnIfTruncated(resp)
 
 			bufio.NewReader(resp.Body).WriteTo(os.Stdout)
 		default:
@@ -94,5 +131,7 @@ var QueryCmd = &cobra.Command{
 }
 
 func init() {
-	QueryCmd.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot or pcap)")
+	QueryCmd.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot, pcap or pcapng)")
+	QueryCmd.Flags().StringVarP(&sqlQuery, "sql", "", "", "SQL-like query, ex: SELECT Name FROM nodes WHERE Type = 'veth'")
+	QueryCmd.Flags().DurationVarP(&queryTimeout, "timeout", "", 0, "Execution deadline of the query, partial results being returned when reached, ex: 5s")
 }
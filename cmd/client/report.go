@@ -0,0 +1,192 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportSchedule        string
+	reportFormat          string
+	reportQueries         []string
+	reportDestinations    []string
+	reportTopTalkers      bool
+	reportTopologyChanges bool
+	reportAlerts          bool
+	reportLinkForecast    bool
+)
+
+// ReportCmd skydive report root command
+var ReportCmd = &cobra.Command{
+	Use:          "report",
+	Short:        "report",
+	Long:         "report",
+	SilenceUsage: false,
+}
+
+// ReportCreate skydive report create command
+var ReportCreate = &cobra.Command{
+	Use:          "create",
+	Short:        "create",
+	Long:         "create",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		report := &api.Report{
+			Name:         name,
+			Description:  description,
+			Schedule:     reportSchedule,
+			Format:       reportFormat,
+			Destinations: reportDestinations,
+		}
+
+		for _, query := range reportQueries {
+			report.Sections = append(report.Sections, api.ReportSection{Title: query, Type: "query", GremlinQuery: query})
+		}
+		if reportTopTalkers {
+			report.Sections = append(report.Sections, api.ReportSection{Title: "Top talkers", Type: "top-talkers"})
+		}
+		if reportTopologyChanges {
+			report.Sections = append(report.Sections, api.ReportSection{Title: "Topology changes", Type: "topology-changes"})
+		}
+		if reportAlerts {
+			report.Sections = append(report.Sections, api.ReportSection{Title: "Alerts", Type: "alerts"})
+		}
+		if reportLinkForecast {
+			report.Sections = append(report.Sections, api.ReportSection{Title: "Link utilization forecast", Type: "link-forecast"})
+		}
+
+		if err = validator.Validate(report); err != nil {
+			exitOnError(fmt.Errorf("Error while validating report: %s", err))
+		}
+
+		if err = client.Create("report", &report); err != nil {
+			exitOnError(err)
+		}
+
+		printJSON(report)
+	},
+}
+
+// ReportGet skydive report get command
+var ReportGet = &cobra.Command{
+	Use:          "get",
+	Short:        "get",
+	Long:         "get",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var report api.Report
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+		if err := client.Get("report", args[0], &report); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&report)
+	},
+}
+
+// ReportList skydive report list command
+var ReportList = &cobra.Command{
+	Use:          "list",
+	Short:        "list",
+	Long:         "list",
+	SilenceUsage: false,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		var reports map[string]api.Report
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("report", &reports); err != nil {
+			exitOnError(err)
+		}
+		printJSON(reports)
+	},
+}
+
+// ReportDelete skydive report delete command
+var ReportDelete = &cobra.Command{
+	Use:          "delete",
+	Short:        "delete",
+	Long:         "delete",
+	SilenceUsage: false,
+
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("report", id); err != nil {
+				logging.GetLogger().Error(err.Error())
+			}
+		}
+	},
+}
+
+func init() {
+	ReportCmd.AddCommand(ReportCreate)
+	ReportCmd.AddCommand(ReportList)
+	ReportCmd.AddCommand(ReportGet)
+	ReportCmd.AddCommand(ReportDelete)
+
+	ReportCreate.Flags().StringVarP(&name, "name", "", "", "report name")
+	ReportCreate.Flags().StringVarP(&description, "description", "", "", "report description")
+	ReportCreate.Flags().StringVarP(&reportSchedule, "schedule", "", "24h", "report period, ex: 1h, 24h")
+	ReportCreate.Flags().StringVarP(&reportFormat, "format", "", "html", "report format: html, csv or pdf")
+	ReportCreate.Flags().StringArrayVarP(&reportQueries, "query", "", nil, "gremlin query whose result is reported, can be repeated")
+	ReportCreate.Flags().BoolVarP(&reportTopTalkers, "top-talkers", "", false, "report the top talkers")
+	ReportCreate.Flags().BoolVarP(&reportTopologyChanges, "topology-changes", "", false, "report the topology changes")
+	ReportCreate.Flags().BoolVarP(&reportAlerts, "alerts", "", false, "report the alert counts")
+	ReportCreate.Flags().BoolVarP(&reportLinkForecast, "link-forecast", "", false, "report the utilization trend of the links")
+	ReportCreate.Flags().StringArrayVarP(&reportDestinations, "destination", "", nil, "mailto:address or webhook URL, can be repeated")
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/scratch"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	scratchQuery   string
+	scratchChanges string
+)
+
+// apiRequest sends a request to the API and prints the JSON response
+func apiRequest(method, path string, value interface{}) {
+	client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	var body io.Reader
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			exitOnError(err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	resp, err := client.Request(method, path, body, nil)
+	if err != nil {
+		exitOnError(err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		exitOnError(fmt.Errorf("Request %s %s failed, %s: %s", method, path, resp.Status, data))
+	}
+
+	if len(data) > 0 {
+		var out bytes.Buffer
+		json.Indent(&out, data, "", "\t")
+		out.WriteTo(os.Stdout)
+	}
+}
+
+func requireArgs(n int) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if len(args) != n {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	}
+}
+
+// ScratchCmd skydive scratch root command
+var ScratchCmd = &cobra.Command{
+	Use:          "scratch",
+	Short:        "Manage scratch contexts",
+	Long:         "Manage scratch contexts, writable copies of the topology used to simulate changes",
+	SilenceUsage: false,
+}
+
+// ScratchCreate describes the command to create a scratch context
+var ScratchCreate = &cobra.Command{
+	Use:    "create [name]",
+	Short:  "Create scratch context",
+	Long:   "Create scratch context from the topology returned by a Gremlin query",
+	PreRun: requireArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("POST", "scratch", &scratch.CreateParams{Name: args[0], GremlinQuery: scratchQuery})
+	},
+}
+
+// ScratchList describes the command to list the scratch contexts
+var ScratchList = &cobra.Command{
+	Use:   "list",
+	Short: "List scratch contexts",
+	Long:  "List scratch contexts",
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("GET", "scratch", nil)
+	},
+}
+
+// ScratchGet describes the command to display a scratch context
+var ScratchGet = &cobra.Command{
+	Use:    "get [name]",
+	Short:  "Display scratch context",
+	Long:   "Display scratch context and the changes applied to it",
+	PreRun: requireArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("GET", "scratch/"+args[0], nil)
+	},
+}
+
+// ScratchDelete describes the command to delete a scratch context
+var ScratchDelete = &cobra.Command{
+	Use:    "delete [name]",
+	Short:  "Delete scratch context",
+	Long:   "Delete scratch context",
+	PreRun: requireArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("DELETE", "scratch/"+args[0], nil)
+	},
+}
+
+// ScratchApply describes the command to apply changes to a scratch context
+var ScratchApply = &cobra.Command{
+	Use:    "apply [name]",
+	Short:  "Apply changes to scratch context",
+	Long:   "Apply a JSON list of changes to scratch context, ex: [{\"Op\": \"remove-edge\", \"Parent\": \"...\", \"Child\": \"...\"}]",
+	PreRun: requireArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var data []byte
+		var err error
+		if scratchChanges == "-" {
+			data, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			data, err = ioutil.ReadFile(scratchChanges)
+		}
+		if err != nil {
+			exitOnError(err)
+		}
+
+		var changes []scratch.Change
+		if err := json.Unmarshal(data, &changes); err != nil {
+			exitOnError(fmt.Errorf("Invalid changes: %s", err))
+		}
+
+		apiRequest("POST", "scratch/"+args[0]+"/changes", changes)
+	},
+}
+
+// ScratchQuery describes the command to query the topology of a scratch context
+var ScratchQuery = &cobra.Command{
+	Use:    "query [name] [gremlin]",
+	Short:  "Query scratch context",
+	Long:   "Run a Gremlin query against the topology of a scratch context",
+	PreRun: requireArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiRequest("POST", "scratch/"+args[0]+"/topology", &types.TopologyParam{GremlinQuery: args[1]})
+	},
+}
+
+func init() {
+	ScratchCmd.AddCommand(ScratchCreate)
+	ScratchCmd.AddCommand(ScratchList)
+	ScratchCmd.AddCommand(ScratchGet)
+	ScratchCmd.AddCommand(ScratchDelete)
+	ScratchCmd.AddCommand(ScratchApply)
+	ScratchCmd.AddCommand(ScratchQuery)
+
+	ScratchCreate.Flags().StringVarP(&scratchQuery, "gremlin", "", "G", "Gremlin query returning the topology copied, ex: G.V().Has('Host', 'h1').SubGraph()")
+	ScratchApply.Flags().StringVarP(&scratchChanges, "changes", "", "-", "file of the JSON list of changes, - for the standard input")
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchFields []string
+	searchLimit  int
+)
+
+// SearchCmd skydive full-text search command
+var SearchCmd = &cobra.Command{
+	Use:          "search [text]",
+	Short:        "Search nodes by name or metadata",
+	Long:         "Search nodes whose name or metadata match all the words of the text",
+	SilenceUsage: false,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 || strings.TrimSpace(strings.Join(args, " ")) == "" {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		param := types.SearchParam{
+			Text:   strings.Join(args, " "),
+			Fields: searchFields,
+			Limit:  searchLimit,
+		}
+
+		body, err := json.Marshal(param)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		resp, err := client.Request("POST", "search", bytes.NewReader(body), nil)
+		if err != nil {
+			exitOnError(err)
+		}
+		defer resp.Body.Close()
+
+		data, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			exitOnError(fmt.Errorf("Failed to search, %s: %s", resp.Status, data))
+		}
+
+		var out bytes.Buffer
+		json.Indent(&out, data, "", "\t")
+		out.WriteTo(os.Stdout)
+	},
+}
+
+func init() {
+	SearchCmd.Flags().StringArrayVarP(&searchFields, "field", "", nil, "metadata field to search, Name^Boost syntax supported, can be repeated")
+	SearchCmd.Flags().IntVarP(&searchLimit, "limit", "", 0, "maximum number of results")
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/skydive-project/skydive/api/client"
+	api "github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	throughputName       string
+	throughputProtocol   string
+	throughputPort       int
+	throughputDuration   int
+	throughputBandwidth  int64
+	throughputPacketSize int
+)
+
+// ThroughputTestCmd skydive throughput-test root command
+var ThroughputTestCmd = &cobra.Command{
+	Use:          "throughput-test",
+	Short:        "Manage throughput tests between agents",
+	Long:         "Manage throughput tests between agents",
+	SilenceUsage: false,
+}
+
+// ThroughputTestCreate describes the command to create a throughput test
+var ThroughputTestCreate = &cobra.Command{
+	Use:   "create",
+	Short: "Create throughput test",
+	Long:  "Create throughput test, the result being reported in the test and in the Throughput metadata of the edge between the nodes",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		test := &api.ThroughputTest{
+			Name:       throughputName,
+			Src:        srcNode,
+			Dst:        dstNode,
+			DstIP:      dstIP,
+			Protocol:   throughputProtocol,
+			Port:       throughputPort,
+			Duration:   throughputDuration,
+			Bandwidth:  throughputBandwidth,
+			PacketSize: throughputPacketSize,
+		}
+
+		if err := validator.Validate(test); err != nil {
+			exitOnError(fmt.Errorf("Error while validating throughput test: %s", err))
+		}
+
+		if err := client.Create("throughputtest", &test); err != nil {
+			exitOnError(err)
+		}
+		printJSON(test)
+	},
+}
+
+// ThroughputTestList describes the command to list the throughput tests
+var ThroughputTestList = &cobra.Command{
+	Use:   "list",
+	Short: "List throughput tests",
+	Long:  "List throughput tests",
+	Run: func(cmd *cobra.Command, args []string) {
+		var tests map[string]api.ThroughputTest
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.List("throughputtest", &tests); err != nil {
+			exitOnError(err)
+		}
+		printJSON(tests)
+	},
+}
+
+// ThroughputTestGet describes the command to retrieve a throughput test
+var ThroughputTestGet = &cobra.Command{
+	Use:   "get [test]",
+	Short: "Display throughput test",
+	Long:  "Display throughput test",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var test api.ThroughputTest
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		if err := client.Get("throughputtest", args[0], &test); err != nil {
+			exitOnError(err)
+		}
+		printJSON(&test)
+	},
+}
+
+// ThroughputTestDelete describes the command to delete a throughput test,
+// stopping it if running
+var ThroughputTestDelete = &cobra.Command{
+	Use:   "delete [test]",
+	Short: "Delete throughput test",
+	Long:  "Delete throughput test",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := client.NewCrudClientFromConfig(&AuthenticationOpts)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		for _, id := range args {
+			if err := client.Delete("throughputtest", id); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	},
+}
+
+func init() {
+	ThroughputTestCmd.AddCommand(ThroughputTestCreate)
+	ThroughputTestCmd.AddCommand(ThroughputTestList)
+	ThroughputTestCmd.AddCommand(ThroughputTestGet)
+	ThroughputTestCmd.AddCommand(ThroughputTestDelete)
+
+	flags := ThroughputTestCreate.Flags()
+	flags.StringVarP(&throughputName, "name", "", "", "test name")
+	flags.StringVarP(&srcNode, "src", "", "", "source node gremlin expression (mandatory)")
+	flags.StringVarP(&dstNode, "dst", "", "", "destination node gremlin expression (mandatory)")
+	flags.StringVarP(&dstIP, "dst-ip", "", "", "destination IP, the first IPv4 address of the destination node by default")
+	flags.StringVarP(&throughputProtocol, "protocol", "", "tcp", "protocol: tcp or udp")
+	flags.IntVarP(&throughputPort, "port", "", 0, "destination port, a random one by default")
+	flags.IntVarP(&throughputDuration, "duration", "", 10, "test duration in seconds")
+	flags.Int64VarP(&throughputBandwidth, "bandwidth", "", 0, "bandwidth in bits per second, unlimited by default")
+	flags.IntVarP(&throughputPacketSize, "packet-size", "", 0, "size of the datagrams or of the writes")
+}
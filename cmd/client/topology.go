@@ -18,17 +18,21 @@
 package client
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 
+	"github.com/skydive-project/skydive/api/client"
+	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/hub"
 	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	shttp "github.com/skydive-project/skydive/http"
 	"github.com/skydive-project/skydive/websocket"
 	"github.com/spf13/cobra"
 )
@@ -37,6 +41,16 @@ var (
 	gremlinQuery string
 	outputFormat string
 	filename     string
+
+	diffFrom         string
+	diffTo           string
+	diffFromAnalyzer string
+	diffToAnalyzer   string
+	diffFromFile     string
+	diffToFile       string
+	diffFields       []string
+	diffIgnore       []string
+	diffMatchBy      []string
 )
 
 // TopologyCmd skydive topology root command
@@ -123,13 +137,163 @@ var TopologyExport = &cobra.Command{
 	},
 }
 
+// loadTopologyFile reads a topology exported with the export command or
+// returned by the topology API
+func loadTopologyFile(filename string) (*graph.Elements, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTopology(content)
+}
+
+func decodeTopology(data []byte) (*graph.Elements, error) {
+	// Gremlin queries return the graph within a list
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var graphs []*graph.Elements
+		if err := json.Unmarshal(data, &graphs); err != nil {
+			return nil, err
+		}
+		if len(graphs) != 1 {
+			return nil, fmt.Errorf("Expected a single topology, got %d", len(graphs))
+		}
+		return graphs[0], nil
+	}
+
+	els := new(graph.Elements)
+	if err := json.Unmarshal(data, els); err != nil {
+		return nil, err
+	}
+	return els, nil
+}
+
+// fetchTopology returns the topology returned by a query to an analyzer,
+// the configured one being used if no address is given
+func fetchTopology(address, query string) (*graph.Elements, error) {
+	var restClient *shttp.RestClient
+	var err error
+	if address != "" {
+		restClient, err = client.NewRestClientForAnalyzer(address, &AuthenticationOpts)
+	} else {
+		restClient, err = client.NewRestClientFromConfig(&AuthenticationOpts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(types.TopologyParam{GremlinQuery: query})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := restClient.Request("POST", "topology", bytes.NewReader(body), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get topology, %s: %s", resp.Status, data)
+	}
+
+	return decodeTopology(data)
+}
+
+func loadTopology(filename, address, query string) (*graph.Elements, error) {
+	if filename != "" {
+		return loadTopologyFile(filename)
+	}
+	return fetchTopology(address, query)
+}
+
+// TopologyDiff skydive topology diff command
+var TopologyDiff = &cobra.Command{
+	Use:   "diff",
+	Short: "compare two topologies",
+	Long:  "compare two topologies, from an analyzer at different times, from two analyzers or from exported files",
+	Run: func(cmd *cobra.Command, args []string) {
+		ignore := diffIgnore
+		if !cmd.Flags().Changed("ignore") {
+			ignore = types.DefaultTopologyDiffIgnore
+		}
+
+		// both topologies are on the same analyzer, let it compute the diff
+		if diffFromAnalyzer == "" && diffToAnalyzer == "" && diffFromFile == "" && diffToFile == "" {
+			client, err := client.NewRestClientFromConfig(&AuthenticationOpts)
+			if err != nil {
+				exitOnError(err)
+			}
+
+			body, err := json.Marshal(types.TopologyDiffParam{
+				From:    diffFrom,
+				To:      diffTo,
+				Fields:  diffFields,
+				Ignore:  ignore,
+				MatchBy: diffMatchBy,
+			})
+			if err != nil {
+				exitOnError(err)
+			}
+
+			resp, err := client.Request("POST", "topology/diff", bytes.NewReader(body), nil)
+			if err != nil {
+				exitOnError(err)
+			}
+			defer resp.Body.Close()
+
+			data, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK {
+				exitOnError(fmt.Errorf("Failed to compare topologies, %s: %s", resp.Status, data))
+			}
+
+			var out bytes.Buffer
+			json.Indent(&out, data, "", "  ")
+			out.WriteTo(os.Stdout)
+			return
+		}
+
+		from, err := loadTopology(diffFromFile, diffFromAnalyzer, diffFrom)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		to, err := loadTopology(diffToFile, diffToAnalyzer, diffTo)
+		if err != nil {
+			exitOnError(err)
+		}
+
+		diff, err := graph.DiffElements(from, to, graph.DiffOptions{
+			Fields:  diffFields,
+			Ignore:  ignore,
+			MatchBy: diffMatchBy,
+		})
+		if err != nil {
+			exitOnError(err)
+		}
+
+		printJSON(diff)
+	},
+}
+
 func init() {
+	TopologyDiff.Flags().StringVarP(&diffFrom, "from", "", "G", "Gremlin query returning the reference topology, ex: G.At('-1d')")
+	TopologyDiff.Flags().StringVarP(&diffTo, "to", "", "G", "Gremlin query returning the compared topology")
+	TopologyDiff.Flags().StringVarP(&diffFromAnalyzer, "from-analyzer", "", "", "analyzer address of the reference topology")
+	TopologyDiff.Flags().StringVarP(&diffToAnalyzer, "to-analyzer", "", "", "analyzer address of the compared topology")
+	TopologyDiff.Flags().StringVarP(&diffFromFile, "from-file", "", "", "exported reference topology")
+	TopologyDiff.Flags().StringVarP(&diffToFile, "to-file", "", "", "exported compared topology")
+	TopologyDiff.Flags().StringArrayVarP(&diffFields, "field", "", nil, "compare only the given metadata, can be repeated")
+	TopologyDiff.Flags().StringArrayVarP(&diffIgnore, "ignore", "", nil, "metadata not compared, can be repeated (default Metric, LastUpdateMetric, SFlow, Captures)")
+	TopologyDiff.Flags().StringArrayVarP(&diffMatchBy, "match-by", "", nil, "metadata identifying the nodes in both topologies, ex: --match-by Type --match-by Name (default ID)")
+	TopologyCmd.AddCommand(TopologyDiff)
+
 	TopologyCmd.AddCommand(TopologyExport)
 
 	TopologyImport.Flags().StringVarP(&filename, "file", "", "graph.json", "Input file")
 	TopologyCmd.AddCommand(TopologyImport)
 
 	TopologyRequest.Flags().StringVarP(&gremlinQuery, "gremlin", "", "G", "Gremlin Query")
-	TopologyRequest.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot or pcap)")
+	TopologyRequest.Flags().StringVarP(&outputFormat, "format", "", "json", "Output format (json, dot, pcap or pcapng)")
 	TopologyCmd.AddCommand(TopologyRequest)
 }
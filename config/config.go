@@ -72,16 +72,65 @@ func init() {
 	cfg = viper.New()
 
 	cfg.SetDefault("agent.auth.api.backend", "noauth")
+	cfg.SetDefault("agent.capture.persistence.path", "/var/lib/skydive/captures.json")
+	cfg.SetDefault("agent.capture.persistence.restore_timeout", 300)
 	cfg.SetDefault("agent.capture.stats_update", 1)
+	cfg.SetDefault("agent.flow.afxdp.frame_size", 2048)
+	cfg.SetDefault("agent.flow.afxdp.frames", 4096)
+	cfg.SetDefault("agent.flow.afxdp.queues", []int{})
+	cfg.SetDefault("agent.flow.afxdp.ring_size", 2048)
+	cfg.SetDefault("agent.flow.afxdp.zero_copy", true)
+	cfg.SetDefault("agent.flow.checkpoint.interval", 30)
+	cfg.SetDefault("agent.flow.checkpoint.path", "")
+	cfg.SetDefault("agent.flow.dns_stats.interval", 60)
+	cfg.SetDefault("agent.flow.dns_stats.max_domains", 1000)
+	cfg.SetDefault("agent.flow.dns_stats.top", 10)
+	cfg.SetDefault("agent.flow.ebpf.tcp_metrics", true)
+	cfg.SetDefault("agent.flow.failover.max_buffer_size", 10000)
+	cfg.SetDefault("agent.flow.failover.replay_window", 10)
+	cfg.SetDefault("agent.flow.failover.retry_delay", 5)
+	cfg.SetDefault("agent.flow.http.max_transactions", 16)
+	cfg.SetDefault("agent.flow.http.tls_key_log", "")
+	cfg.SetDefault("agent.flow.ipfix_exporter.address", "")
+	cfg.SetDefault("agent.flow.ipfix_exporter.domain_id", 0)
+	cfg.SetDefault("agent.flow.ipfix_exporter.enterprise_id", 32473)
+	cfg.SetDefault("agent.flow.ipfix_exporter.fields", []string{
+		"sourceIPv4Address", "destinationIPv4Address", "sourceIPv6Address", "destinationIPv6Address",
+		"sourceTransportPort", "destinationTransportPort", "protocolIdentifier",
+		"octetDeltaCount", "packetDeltaCount", "flowStartMilliseconds", "flowEndMilliseconds", "flowEndReason",
+		"skydiveNodeTID", "skydiveCaptureID", "skydiveApplication",
+	})
+	cfg.SetDefault("agent.flow.ipfix_exporter.max_packet_size", 1400)
+	cfg.SetDefault("agent.flow.ipfix_exporter.protocol", "ipfix")
+	cfg.SetDefault("agent.flow.ipfix_exporter.template_refresh", 60)
 	cfg.SetDefault("agent.flow.probes", []string{"gopacket", "pcapsocket"})
 	cfg.SetDefault("agent.flow.pcapsocket.bind_address", "127.0.0.1")
 	cfg.SetDefault("agent.flow.pcapsocket.min_port", 8100)
 	cfg.SetDefault("agent.flow.pcapsocket.max_port", 8132)
+	cfg.SetDefault("agent.flow.sampling.flow_bytes", 0)
+	cfg.SetDefault("agent.flow.sampling.max_flows", 0)
+	cfg.SetDefault("agent.flow.sampling.packets", 0)
+	cfg.SetDefault("agent.flow.table_memory.eviction_policy", "lru")
+	cfg.SetDefault("agent.flow.table_memory.limit", 0)
+	cfg.SetDefault("agent.flow.tunnels.gtpu_port", 0)
+	cfg.SetDefault("agent.limits.io_priority", 7)
+	cfg.SetDefault("agent.limits.memory_check_interval", 10)
 	cfg.SetDefault("agent.listen", "127.0.0.1:8081")
 	cfg.SetDefault("agent.topology.probes", []string{"ovsdb"})
+	cfg.SetDefault("agent.topology.cilium.interval", 10)
+	cfg.SetDefault("agent.topology.cilium.url", "unix:///var/run/cilium/cilium.sock")
 	cfg.SetDefault("agent.topology.docker.url", "unix:///var/run/docker.sock")
 	cfg.SetDefault("agent.topology.docker.netns.run_path", "/var/run/docker/netns")
+	cfg.SetDefault("agent.topology.fdb.max_moves", 10)
+	cfg.SetDefault("agent.topology.fdb.update", 10)
+	cfg.SetDefault("agent.topology.frr.interval", 30)
+	cfg.SetDefault("agent.topology.frr.max_routes", 1000)
+	cfg.SetDefault("agent.topology.frr.vtysh_path", "vtysh")
+	cfg.SetDefault("agent.topology.journal_size", 10000)
+	cfg.SetDefault("agent.topology.netlink.bonding_update", 10)
 	cfg.SetDefault("agent.topology.netlink.metrics_update", 30)
+	cfg.SetDefault("agent.topology.netlink.multicast_update", 10)
+	cfg.SetDefault("agent.topology.netlink.stp_update", 5)
 	cfg.SetDefault("agent.topology.netns.run_path", "/var/run/netns")
 	cfg.SetDefault("agent.topology.neutron.domain_name", "Default")
 	cfg.SetDefault("agent.topology.neutron.endpoint_type", "public")
@@ -89,21 +138,117 @@ func init() {
 	cfg.SetDefault("agent.topology.neutron.region_name", "RegionOne")
 	cfg.SetDefault("agent.topology.neutron.tenant_name", "service")
 	cfg.SetDefault("agent.topology.neutron.username", "neutron")
+	cfg.SetDefault("agent.topology.nftables.resync", 300)
 	cfg.SetDefault("agent.topology.runc.run_path", []string{"/run/containerd/runc", "/run/runc", "/run/runc-ctrs"})
 	cfg.SetDefault("agent.topology.socketinfo.host_update", 10)
 	cfg.SetDefault("agent.topology.vpp.connect", "")
-
+	cfg.SetDefault("agent.topology.wireguard.interval", 30)
+	cfg.SetDefault("agent.unix_socket.mode", "0660")
+	cfg.SetDefault("agent.unix_socket.path", "")
+	cfg.SetDefault("agent.unix_socket.users", map[string]string{"root": "admin"})
+
+	cfg.SetDefault("analyzer.admission.max_conn_burst", 100)
+	cfg.SetDefault("analyzer.admission.max_conn_rate", 50)
+	cfg.SetDefault("analyzer.admission.max_retry_delay", 60)
 	cfg.SetDefault("analyzer.auth.cluster.backend", "noauth")
 	cfg.SetDefault("analyzer.auth.api.backend", "noauth")
+	cfg.SetDefault("analyzer.capture.approval.roles", []string{})
+	cfg.SetDefault("analyzer.capture.default_profile", "")
+	cfg.SetDefault("analyzer.capture.overlap", "warn")
+	cfg.SetDefault("analyzer.clock_skew.correct_flows", false)
+	cfg.SetDefault("analyzer.clock_skew.interval", 60)
+	cfg.SetDefault("analyzer.clock_skew.max_offset", 100)
+	cfg.SetDefault("analyzer.clock_skew.samples", 5)
+	cfg.SetDefault("analyzer.correlation.delay", 10)
+	cfg.SetDefault("analyzer.correlation.max_changes", 100)
+	cfg.SetDefault("analyzer.correlation.window", 60)
+	cfg.SetDefault("analyzer.flow.application_rules_refresh", 30)
 	cfg.SetDefault("analyzer.flow.backend", "memory")
+	cfg.SetDefault("analyzer.flow.capacity", 10000)
+	cfg.SetDefault("analyzer.flow.communication.expire", 300)
+	cfg.SetDefault("analyzer.flow.communication.interval", 10)
+	cfg.SetDefault("analyzer.flow.load_update", 5)
 	cfg.SetDefault("analyzer.flow.max_buffer_size", 100000)
+	cfg.SetDefault("analyzer.flow.multicast_update", 10)
+	cfg.SetDefault("analyzer.flow_tail.max_flows", 32)
+	cfg.SetDefault("analyzer.forecast.bucket", 3600)
+	cfg.SetDefault("analyzer.forecast.enabled", false)
+	cfg.SetDefault("analyzer.forecast.history", 604800)
+	cfg.SetDefault("analyzer.forecast.min_samples", 6)
+	cfg.SetDefault("analyzer.forecast.threshold", 0.9)
+	cfg.SetDefault("analyzer.health.checks", []string{})
+	cfg.SetDefault("analyzer.health.interval", 0)
 	cfg.SetDefault("analyzer.listen", "127.0.0.1:8082")
+	cfg.SetDefault("analyzer.metrics_rollup.interval", 30)
+	cfg.SetDefault("analyzer.metrics_rollup.tenant_field", "Neutron.TenantID")
+	cfg.SetDefault("analyzer.packet_injection.max_count", 0)
+	cfg.SetDefault("analyzer.packet_injection.max_rate", 0)
+	cfg.SetDefault("analyzer.query_subscription.interval", 1)
+	cfg.SetDefault("analyzer.query_subscription.max_per_client", 16)
+	cfg.SetDefault("analyzer.query_timeout", 0)
+	cfg.SetDefault("analyzer.read_only", false)
 	cfg.SetDefault("analyzer.replication.debug", false)
+	cfg.SetDefault("analyzer.report.smtp.address", "127.0.0.1:25")
+	cfg.SetDefault("analyzer.report.smtp.from", "skydive@localhost")
+	cfg.SetDefault("analyzer.scan.enabled", false)
+	cfg.SetDefault("analyzer.scan.exclude", []string{})
+	cfg.SetDefault("analyzer.scan.hosts", 50)
+	cfg.SetDefault("analyzer.scan.ports", 100)
+	cfg.SetDefault("analyzer.scan.window", 60)
+	cfg.SetDefault("analyzer.scratch.max_contexts", 5)
+	cfg.SetDefault("analyzer.scratch.ttl", 3600)
+	cfg.SetDefault("analyzer.spoofing.enabled", false)
+	cfg.SetDefault("analyzer.spoofing.window", 300)
+	cfg.SetDefault("analyzer.storage_migration.dry_run", false)
+	cfg.SetDefault("analyzer.storage_migration.target_version", 0)
+	cfg.SetDefault("analyzer.splunk_exporter.ack", false)
+	cfg.SetDefault("analyzer.splunk_exporter.ack_timeout", 60)
+	cfg.SetDefault("analyzer.splunk_exporter.alerts", true)
+	cfg.SetDefault("analyzer.splunk_exporter.batch_maxdelay", 1)
+	cfg.SetDefault("analyzer.splunk_exporter.batch_size", 100)
+	cfg.SetDefault("analyzer.splunk_exporter.flows", "finished")
+	cfg.SetDefault("analyzer.splunk_exporter.mappings.alert.sourcetype", "skydive:alert")
+	cfg.SetDefault("analyzer.splunk_exporter.mappings.flow.sourcetype", "skydive:flow")
+	cfg.SetDefault("analyzer.splunk_exporter.mappings.topology.sourcetype", "skydive:topology")
+	cfg.SetDefault("analyzer.splunk_exporter.queue_size", 10000)
+	cfg.SetDefault("analyzer.splunk_exporter.ssl_insecure", false)
+	cfg.SetDefault("analyzer.splunk_exporter.token", "")
+	cfg.SetDefault("analyzer.splunk_exporter.topology", false)
+	cfg.SetDefault("analyzer.splunk_exporter.url", "")
+	cfg.SetDefault("analyzer.syslog_exporter.address", "")
+	cfg.SetDefault("analyzer.syslog_exporter.app_name", "skydive")
+	cfg.SetDefault("analyzer.syslog_exporter.facility", 16)
+	cfg.SetDefault("analyzer.syslog_exporter.flows", "finished")
+	cfg.SetDefault("analyzer.syslog_exporter.format", "cef")
+	cfg.SetDefault("analyzer.syslog_exporter.protocol", "udp")
+	cfg.SetDefault("analyzer.syslog_exporter.queue_size", 10000)
+	cfg.SetDefault("analyzer.threat_intel.refresh", 3600)
+	cfg.SetDefault("analyzer.topology.agent_grace_period", 0)
 	cfg.SetDefault("analyzer.topology.backend", "memory")
 	cfg.SetDefault("analyzer.topology.probes", []string{})
+	cfg.SetDefault("analyzer.topology.contrail.domain_name", "Default")
+	cfg.SetDefault("analyzer.topology.contrail.interval", 60)
+	cfg.SetDefault("analyzer.topology.contrail.tenant_name", "admin")
+	cfg.SetDefault("analyzer.topology.contrail.url", "http://localhost:8082")
+	cfg.SetDefault("analyzer.topology.contrail.username", "admin")
+	cfg.SetDefault("analyzer.topology.k8s.captures", false)
 	cfg.SetDefault("analyzer.topology.k8s.config_file", "/etc/skydive/kubeconfig")
+	cfg.SetDefault("analyzer.topology.k8s.reachability", true)
 	cfg.SetDefault("analyzer.topology.ovn.address", "unix:///var/run/openvswitch/ovnnb_db.sock")
+	cfg.SetDefault("analyzer.topology.ovn.sb_address", "")
+	cfg.SetDefault("analyzer.topology.istio.access_log.listen", "")
+	cfg.SetDefault("analyzer.topology.istio.access_log.ttl", 300)
 	cfg.SetDefault("analyzer.topology.istio.config_file", "/etc/skydive/kubeconfig")
+	cfg.SetDefault("analyzer.topology.gnmi.encoding", "json_ietf")
+	cfg.SetDefault("analyzer.topology.gnmi.sample_interval", 10)
+	cfg.SetDefault("analyzer.topology.snmp.community", "public")
+	cfg.SetDefault("analyzer.topology.snmp.interval", 60)
+	cfg.SetDefault("analyzer.topology.snmp.max_moves", 10)
+	cfg.SetDefault("analyzer.topology.snmp.retries", 2)
+	cfg.SetDefault("analyzer.topology.snmp.timeout", 5)
+	cfg.SetDefault("analyzer.unix_socket.mode", "0660")
+	cfg.SetDefault("analyzer.unix_socket.path", "")
+	cfg.SetDefault("analyzer.unix_socket.users", map[string]string{"root": "admin"})
 
 	cfg.SetDefault("auth.basic.type", "basic") // defined for backward compatibility
 	cfg.SetDefault("auth.keystone.tenant_name", "admin")
@@ -123,12 +268,19 @@ func init() {
 	cfg.SetDefault("flow.expire", 600)
 	cfg.SetDefault("flow.update", 60)
 	cfg.SetDefault("flow.protocol", "udp")
+	cfg.SetDefault("flow.port_masking.bucket_size", 1024)
+	cfg.SetDefault("flow.port_masking.ephemeral_min", 32768)
+	cfg.SetDefault("flow.raw_packets.excluded_ports", []string{})
 	cfg.SetDefault("flow.application_timeout.arp", 10)
 	cfg.SetDefault("flow.application_timeout.dns", 10)
 
+	cfg.SetDefault("feature_flags", []string{})
+
 	cfg.SetDefault("host_id", host)
 
 	cfg.SetDefault("http.rest.debug", false)
+	cfg.SetDefault("http.search.fields", []string{"Name^3", "Type", "MAC", "IPV4", "IPV6", "Driver", "Docker.ContainerName^2", "K8s.Namespace", "Neutron.PortID", "Neutron.NetworkName"})
+	cfg.SetDefault("http.search.limit", 50)
 	cfg.SetDefault("http.ws.ping_delay", 2)
 	cfg.SetDefault("http.ws.pong_timeout", 5)
 	cfg.SetDefault("http.ws.queue_size", 10000)
@@ -141,9 +293,28 @@ func init() {
 	cfg.SetDefault("logging.level", "INFO")
 	cfg.SetDefault("logging.syslog.tag", "skydive")
 
+	cfg.SetDefault("opencontrail.agent_check_interval", 5)
+	cfg.SetDefault("opencontrail.drop_stats.history", 10)
+	cfg.SetDefault("opencontrail.drop_stats.interval", 30)
+	cfg.SetDefault("opencontrail.drop_stats.path", "dropstats")
+	cfg.SetDefault("opencontrail.drop_stats.source", "dropstats")
 	cfg.SetDefault("opencontrail.host", "localhost")
+	cfg.SetDefault("opencontrail.label_table.interval", 30)
+	cfg.SetDefault("opencontrail.label_table.mpls_path", "mpls")
+	cfg.SetDefault("opencontrail.label_table.vxlan_path", "vxlan")
+	cfg.SetDefault("opencontrail.metadata_update_interval", 1)
 	cfg.SetDefault("opencontrail.mpls_udp_port", 51234)
+	cfg.SetDefault("opencontrail.nh.path", "nh")
 	cfg.SetDefault("opencontrail.port", 8085)
+	cfg.SetDefault("opencontrail.route_update_window", 1)
+	cfg.SetDefault("opencontrail.routing_table.inet_aggregation", 16)
+	cfg.SetDefault("opencontrail.routing_table.inet6_aggregation", 48)
+	cfg.SetDefault("opencontrail.routing_table.max_routes", 1000)
+	cfg.SetDefault("opencontrail.routing_table.policy", "truncate")
+	cfg.SetDefault("opencontrail.rt.backend", "auto")
+	cfg.SetDefault("opencontrail.rt.path", "rt")
+	cfg.SetDefault("opencontrail.rt.ssh.port", 22)
+	cfg.SetDefault("opencontrail.rt.ssh.user", "root")
 
 	cfg.SetDefault("ovs.ovsdb", "unix:///var/run/openvswitch/db.sock")
 	cfg.SetDefault("ovs.oflow.enable", false)
@@ -159,18 +330,39 @@ func init() {
 	cfg.SetDefault("rbac.model.policy_effect", []string{"some(where (p_eft == allow)) && !some(where (p_eft == deny))"})
 	cfg.SetDefault("rbac.model.matchers", []string{"g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act"})
 
-	cfg.SetDefault("storage.elasticsearch.driver", "elasticsearch")  // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.elasticsearch.host", "127.0.0.1:9200")   // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.elasticsearch.bulk_maxdelay", 5)         // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.elasticsearch.index_age_limit", 0)       // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.elasticsearch.index_entries_limit", 0)   // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.elasticsearch.indices_to_keep", 0)       // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.memory.driver", "memory")                // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.orientdb.driver", "orientdb")            // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.orientdb.addr", "http://localhost:2480") // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.orientdb.database", "Skydive")           // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.orientdb.username", "root")              // defined for backward compatibility and to set defaults
-	cfg.SetDefault("storage.orientdb.password", "root")              // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.clickhouse.driver", "clickhouse")         // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.url", "http://127.0.0.1:8123") // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.database", "skydive")          // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.username", "default")          // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.password", "")                 // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.bulk_size", 10000)             // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.bulk_maxdelay", 5)             // defined to set defaults
+	cfg.SetDefault("storage.clickhouse.ttl", 90)                      // defined to set defaults
+	cfg.SetDefault("storage.elasticsearch.driver", "elasticsearch")   // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.host", "127.0.0.1:9200")    // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.bulk_maxdelay", 5)          // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.hedge_delay", 0)            // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.hedge_max_requests", 2)     // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.index_age_limit", 0)        // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.index_entries_limit", 0)    // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.indices_to_keep", 0)        // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.elasticsearch.read_hosts", []string{})    // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.kafka.driver", "kafka")                   // defined to set defaults
+	cfg.SetDefault("storage.kafka.acks", 1)                           // defined to set defaults
+	cfg.SetDefault("storage.kafka.brokers", "127.0.0.1:9092")         // defined to set defaults
+	cfg.SetDefault("storage.kafka.client_id", "skydive")              // defined to set defaults
+	cfg.SetDefault("storage.kafka.encoding", "json")                  // defined to set defaults
+	cfg.SetDefault("storage.kafka.partition_key", "nodetid")          // defined to set defaults
+	cfg.SetDefault("storage.kafka.timeout", 10)                       // defined to set defaults
+	cfg.SetDefault("storage.kafka.tls", false)                        // defined to set defaults
+	cfg.SetDefault("storage.kafka.topic", "skydive-flows")            // defined to set defaults
+	cfg.SetDefault("storage.kafka.updates_topic", "")                 // defined to set defaults
+	cfg.SetDefault("storage.memory.driver", "memory")                 // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.orientdb.driver", "orientdb")             // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.orientdb.addr", "http://localhost:2480")  // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.orientdb.database", "Skydive")            // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.orientdb.username", "root")               // defined for backward compatibility and to set defaults
+	cfg.SetDefault("storage.orientdb.password", "root")               // defined for backward compatibility and to set defaults
 
 	cfg.SetDefault("ui", map[string]interface{}{})
 
@@ -206,6 +398,10 @@ func checkConfig() error {
 		return err
 	}
 
+	if err := checkStrictPositiveInt("analyzer.flow.load_update"); err != nil {
+		return err
+	}
+
 	if err := checkPositiveInt("etcd.max_wal_files"); err != nil {
 		return err
 	}
@@ -215,7 +411,7 @@ func checkConfig() error {
 
 func setStorageDefaults() {
 	for key := range cfg.GetStringMap("storage") {
-		if key == "elasticsearch" || key == "orientdb" || key == "memory" {
+		if key == "clickhouse" || key == "elasticsearch" || key == "kafka" || key == "orientdb" || key == "memory" {
 			continue
 		}
 
@@ -0,0 +1,32 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// NewExportFilter creates a graph export filter based on the nodes,
+// include_metadata and exclude_metadata values of the given section
+func NewExportFilter(key string) (*graph.ExportFilter, error) {
+	return graph.NewExportFilter(
+		GetStringSlice(key+".nodes"),
+		GetStringSlice(key+".include_metadata"),
+		GetStringSlice(key+".exclude_metadata"),
+	)
+}
@@ -20,6 +20,8 @@ package config
 import (
 	"crypto/tls"
 	"fmt"
+	"os"
+	"strconv"
 
 	"github.com/skydive-project/skydive/common"
 	shttp "github.com/skydive-project/skydive/http"
@@ -40,5 +42,17 @@ func NewHTTPServer(serviceType common.ServiceType) (*shttp.Server, error) {
 		}
 	}
 
-	return shttp.NewServer(GetString("host_id"), serviceType, sa.Addr, sa.Port, tlsConfig), nil
+	mode, err := strconv.ParseUint(GetString(serviceType.String()+".unix_socket.mode"), 8, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Configuration error: invalid unix socket mode: %s", err)
+	}
+
+	server := shttp.NewServer(GetString("host_id"), serviceType, sa.Addr, sa.Port, tlsConfig)
+	server.UnixSocket = &shttp.UnixSocketOpts{
+		Path:  GetString(serviceType.String() + ".unix_socket.path"),
+		Mode:  os.FileMode(mode),
+		Users: GetStringMapString(serviceType.String() + ".unix_socket.users"),
+	}
+
+	return server, nil
 }
@@ -0,0 +1,368 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package correlation attaches to the triggered alerts the topology changes
+// and the route updates that happened around them, helping to find out
+// whether a traffic spike follows a link going down or a route churn.
+package correlation
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// maxChanges is the number of topology changes kept to correlate the alerts
+	maxChanges = 10000
+
+	// maxReports is the number of correlation reports kept for the API
+	maxReports = 1000
+)
+
+// routeFields are the metadata holding the routes of the nodes, the netlink
+// routing tables of the interfaces and the Contrail VRF routes
+var routeFields = []string{"RoutingTables", "Contrail.RoutingTable"}
+
+// Change describes a topology change or a route update
+type Change struct {
+	Time   time.Time
+	Action string
+	Type   string
+	ID     string
+	Name   string
+	Field  string `json:",omitempty"`
+}
+
+// Report describes the changes that happened in the time window
+// surrounding an alert occurrence
+type Report struct {
+	UUID            string
+	Occurrence      string
+	Timestamp       time.Time
+	Start           time.Time
+	End             time.Time
+	TopologyChanges []Change
+	RouteUpdates    []Change
+	Truncated       bool `json:",omitempty"`
+}
+
+// Correlator records the topology changes and the route updates of the graph
+// and builds a correlation report for every alert triggered. The report is
+// sent on the alerting WebSocket namespace once the window following the
+// alert is elapsed.
+type Correlator struct {
+	sync.RWMutex
+	graph.DefaultGraphListener
+	Graph      *graph.Graph
+	Pool       ws.StructSpeakerPool
+	window     time.Duration
+	delay      time.Duration
+	maxChanges int
+	changes    []Change
+	routes     map[graph.Identifier]map[string]uint64
+	reports    []*Report
+	timers     map[string]*time.Timer
+}
+
+func routesHash(value interface{}) uint64 {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func nodeName(n *graph.Node) string {
+	name, _ := n.GetFieldString("Name")
+	return name
+}
+
+func (c *Correlator) record(change Change) {
+	c.changes = append(c.changes, change)
+	if len(c.changes) > maxChanges {
+		c.changes = c.changes[len(c.changes)-maxChanges:]
+	}
+}
+
+// updateRoutes refreshes the routes of a node and records a route update
+// for every route metadata that changed, with the lock held
+func (c *Correlator) updateRoutes(n *graph.Node, notify bool) {
+	now := time.Now().UTC()
+
+	for _, field := range routeFields {
+		previous, known := c.routes[n.ID][field]
+
+		value, err := n.GetField(field)
+		if err != nil {
+			if known {
+				delete(c.routes[n.ID], field)
+				c.record(Change{Time: now, Action: "deleted", Type: "route", ID: string(n.ID), Name: nodeName(n), Field: field})
+			}
+			continue
+		}
+
+		hash := routesHash(value)
+		if known && hash == previous {
+			continue
+		}
+
+		if c.routes[n.ID] == nil {
+			c.routes[n.ID] = make(map[string]uint64)
+		}
+		c.routes[n.ID][field] = hash
+
+		if notify {
+			action := "updated"
+			if !known {
+				action = "added"
+			}
+			c.record(Change{Time: now, Action: action, Type: "route", ID: string(n.ID), Name: nodeName(n), Field: field})
+		}
+	}
+}
+
+// OnNodeAdded event
+func (c *Correlator) OnNodeAdded(n *graph.Node) {
+	c.Lock()
+	c.record(Change{Time: time.Now().UTC(), Action: "added", Type: "node", ID: string(n.ID), Name: nodeName(n)})
+	c.updateRoutes(n, false)
+	c.Unlock()
+}
+
+// OnNodeUpdated event
+func (c *Correlator) OnNodeUpdated(n *graph.Node) {
+	c.Lock()
+	c.updateRoutes(n, true)
+	c.Unlock()
+}
+
+// OnNodeDeleted event
+func (c *Correlator) OnNodeDeleted(n *graph.Node) {
+	c.Lock()
+	c.record(Change{Time: time.Now().UTC(), Action: "deleted", Type: "node", ID: string(n.ID), Name: nodeName(n)})
+	delete(c.routes, n.ID)
+	c.Unlock()
+}
+
+// OnEdgeAdded event
+func (c *Correlator) OnEdgeAdded(e *graph.Edge) {
+	relationType, _ := e.GetFieldString("RelationType")
+
+	c.Lock()
+	c.record(Change{Time: time.Now().UTC(), Action: "added", Type: "edge", ID: string(e.ID), Name: relationType})
+	c.Unlock()
+}
+
+// OnEdgeDeleted event
+func (c *Correlator) OnEdgeDeleted(e *graph.Edge) {
+	relationType, _ := e.GetFieldString("RelationType")
+
+	c.Lock()
+	c.record(Change{Time: time.Now().UTC(), Action: "deleted", Type: "edge", ID: string(e.ID), Name: relationType})
+	c.Unlock()
+}
+
+// correlate returns the report of the changes surrounding an alert occurrence
+func (c *Correlator) correlate(msg *alert.Message) *Report {
+	report := &Report{
+		UUID:       msg.UUID,
+		Occurrence: msg.Occurrence,
+		Timestamp:  msg.Timestamp,
+		Start:      msg.Timestamp.Add(-c.window),
+		End:        msg.Timestamp.Add(c.delay),
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, change := range c.changes {
+		if change.Time.Before(report.Start) || change.Time.After(report.End) {
+			continue
+		}
+
+		if c.maxChanges > 0 && len(report.TopologyChanges)+len(report.RouteUpdates) >= c.maxChanges {
+			report.Truncated = true
+			break
+		}
+
+		if change.Type == "route" {
+			report.RouteUpdates = append(report.RouteUpdates, change)
+		} else {
+			report.TopologyChanges = append(report.TopologyChanges, change)
+		}
+	}
+
+	return report
+}
+
+func (c *Correlator) publish(msg *alert.Message) {
+	report := c.correlate(msg)
+
+	c.Lock()
+	delete(c.timers, msg.Occurrence)
+	c.reports = append(c.reports, report)
+	if len(c.reports) > maxReports {
+		c.reports = c.reports[len(c.reports)-maxReports:]
+	}
+	c.Unlock()
+
+	logging.GetLogger().Debugf("Alert %s occurrence %s correlated with %d topology changes and %d route updates",
+		report.UUID, report.Occurrence, len(report.TopologyChanges), len(report.RouteUpdates))
+
+	c.Pool.BroadcastMessage(ws.NewStructMessage(alert.Namespace, "Correlation", report))
+}
+
+// OnAlert schedules the correlation report of an alert occurrence, once the
+// changes following the alert are known
+func (c *Correlator) OnAlert(msg *alert.Message) {
+	c.Lock()
+	c.timers[msg.Occurrence] = time.AfterFunc(c.delay, func() { c.publish(msg) })
+	c.Unlock()
+}
+
+// Reports returns the correlation reports of an alert, of all the alerts if
+// the UUID is empty
+func (c *Correlator) Reports(uuid string) []*Report {
+	c.RLock()
+	defer c.RUnlock()
+
+	reports := []*Report{}
+	for _, report := range c.reports {
+		if uuid == "" || report.UUID == uuid {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+// Report returns the correlation report of an alert occurrence
+func (c *Correlator) Report(occurrence string) (*Report, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, report := range c.reports {
+		if report.Occurrence == occurrence {
+			return report, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Correlator) reportsGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "alert", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, c.Reports(r.URL.Query().Get("alert")))
+}
+
+func (c *Correlator) reportGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "alert", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, found := c.Report(mux.Vars(&r.Request)["occurrence"])
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, report)
+}
+
+// RegisterEndpoints registers the endpoints returning the correlation reports
+func (c *Correlator) RegisterEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "CorrelationIndex",
+			Method:      "GET",
+			Path:        "/api/correlation",
+			HandlerFunc: c.reportsGet,
+		},
+		{
+			Name:        "CorrelationGet",
+			Method:      "GET",
+			Path:        "/api/correlation/{occurrence}",
+			HandlerFunc: c.reportGet,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// Start records the changes of the graph
+func (c *Correlator) Start() {
+	c.Graph.RLock()
+	c.Lock()
+	for _, n := range c.Graph.GetNodes(nil) {
+		c.updateRoutes(n, false)
+	}
+	c.Unlock()
+	c.Graph.AddEventListener(c)
+	c.Graph.RUnlock()
+}
+
+// Stop the correlator, the pending reports are dropped
+func (c *Correlator) Stop() {
+	c.Graph.RemoveEventListener(c)
+
+	c.Lock()
+	for occurrence, timer := range c.timers {
+		timer.Stop()
+		delete(c.timers, occurrence)
+	}
+	c.Unlock()
+}
+
+// NewCorrelatorFromConfig returns a new correlator using the window, the
+// delay and the limit of changes of the configuration, nil if the
+// correlation is disabled
+func NewCorrelatorFromConfig(g *graph.Graph, pool ws.StructSpeakerPool) *Correlator {
+	window := time.Duration(config.GetInt("analyzer.correlation.window")) * time.Second
+	if window <= 0 {
+		return nil
+	}
+
+	return &Correlator{
+		Graph:      g,
+		Pool:       pool,
+		window:     window,
+		delay:      time.Duration(config.GetInt("analyzer.correlation.delay")) * time.Second,
+		maxChanges: config.GetInt("analyzer.correlation.max_changes"),
+		routes:     make(map[graph.Identifier]map[string]uint64),
+		timers:     make(map[string]*time.Timer),
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package correlation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func newCorrelator(t *testing.T) *Correlator {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Correlator{
+		Graph:      graph.NewGraph("testhost", b, common.AnalyzerService),
+		window:     time.Minute,
+		delay:      10 * time.Second,
+		maxChanges: 100,
+		routes:     make(map[graph.Identifier]map[string]uint64),
+		timers:     make(map[string]*time.Timer),
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	c := newCorrelator(t)
+	c.Start()
+	defer c.Stop()
+
+	g := c.Graph
+	g.Lock()
+	n, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "vrf1", "Contrail": map[string]interface{}{"VRFID": int64(1)}})
+	g.AddMetadata(n, "Contrail.RoutingTable", []string{"10.0.0.0/24"})
+	g.AddMetadata(n, "MTU", int64(1500))
+	g.AddMetadata(n, "Contrail.RoutingTable", []string{"10.0.0.0/24", "10.0.1.0/24"})
+	g.DelNode(n)
+	g.Unlock()
+
+	report := c.correlate(&alert.Message{UUID: "alert", Occurrence: "1", Timestamp: time.Now().UTC()})
+
+	if len(report.TopologyChanges) != 2 {
+		t.Fatalf("Expected the node addition and deletion, got %+v", report.TopologyChanges)
+	}
+
+	if len(report.RouteUpdates) != 2 {
+		t.Fatalf("Expected 2 route updates, got %+v", report.RouteUpdates)
+	}
+
+	if u := report.RouteUpdates[1]; u.Action != "updated" || u.Field != "Contrail.RoutingTable" || u.Name != "vrf1" {
+		t.Errorf("Unexpected route update %+v", u)
+	}
+
+	report = c.correlate(&alert.Message{UUID: "alert", Occurrence: "2", Timestamp: time.Now().Add(time.Hour)})
+	if len(report.TopologyChanges) != 0 || len(report.RouteUpdates) != 0 {
+		t.Errorf("Expected no change outside of the window, got %+v", report)
+	}
+
+	c.maxChanges = 3
+	report = c.correlate(&alert.Message{UUID: "alert", Occurrence: "3", Timestamp: time.Now().UTC()})
+	if !report.Truncated || len(report.TopologyChanges)+len(report.RouteUpdates) != 3 {
+		t.Errorf("Expected a truncated report, got %+v", report)
+	}
+}
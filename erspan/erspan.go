@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package erspan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// GRE protocol types of the mirrored traffic
+const (
+	ProtocolTransparentEthernet = 0x6558
+	ProtocolERSPANTypeII        = 0x88be
+	ProtocolERSPANTypeIII       = 0x22eb
+)
+
+// Encapsulation of a mirrored frame
+const (
+	EncapGRETAP    = "gretap"
+	EncapERSPANI   = "erspan1"
+	EncapERSPANII  = "erspan2"
+	EncapERSPANIII = "erspan3"
+)
+
+const (
+	greFlagChecksum = 0x8000
+	greFlagRouting  = 0x4000
+	greFlagKey      = 0x2000
+	greFlagSequence = 0x1000
+	greVersionMask  = 0x0007
+)
+
+var (
+	// ErrTruncated is returned when a packet is shorter than its headers
+	ErrTruncated = errors.New("truncated GRE packet")
+	// ErrNotMirrored is returned for GRE packets not carrying mirrored frames
+	ErrNotMirrored = errors.New("not a mirrored frame")
+)
+
+// Frame is an Ethernet frame extracted from a mirror session
+type Frame struct {
+	Encapsulation string
+	// SessionID is the ERSPAN session ID or the GRE key of GRE-TAP sessions
+	SessionID uint32
+	// VLAN is the original VLAN of the frame reported by ERSPAN
+	VLAN uint16
+	Data []byte
+}
+
+// Decapsulate extracts the mirrored Ethernet frame of a GRE packet, data
+// starting at the GRE header
+func Decapsulate(data []byte) (*Frame, error) {
+	if len(data) < 4 {
+		return nil, ErrTruncated
+	}
+
+	flags := binary.BigEndian.Uint16(data)
+	protocol := binary.BigEndian.Uint16(data[2:])
+
+	if flags&greVersionMask != 0 || flags&greFlagRouting != 0 {
+		return nil, fmt.Errorf("unsupported GRE flags 0x%04x", flags)
+	}
+
+	offset := 4
+	if flags&greFlagChecksum != 0 {
+		offset += 4
+	}
+
+	var key uint32
+	if flags&greFlagKey != 0 {
+		if len(data) < offset+4 {
+			return nil, ErrTruncated
+		}
+		key = binary.BigEndian.Uint32(data[offset:])
+		offset += 4
+	}
+
+	hasSequence := flags&greFlagSequence != 0
+	if hasSequence {
+		offset += 4
+	}
+
+	if len(data) < offset {
+		return nil, ErrTruncated
+	}
+	data = data[offset:]
+
+	switch protocol {
+	case ProtocolTransparentEthernet:
+		return &Frame{Encapsulation: EncapGRETAP, SessionID: key, Data: data}, nil
+	case ProtocolERSPANTypeII:
+		// ERSPAN Type I has no ERSPAN header nor GRE sequence number
+		if !hasSequence {
+			return &Frame{Encapsulation: EncapERSPANI, Data: data}, nil
+		}
+		if len(data) < 8 {
+			return nil, ErrTruncated
+		}
+		return &Frame{
+			Encapsulation: EncapERSPANII,
+			VLAN:          binary.BigEndian.Uint16(data) & 0x0fff,
+			SessionID:     uint32(binary.BigEndian.Uint16(data[2:]) & 0x03ff),
+			Data:          data[8:],
+		}, nil
+	case ProtocolERSPANTypeIII:
+		if len(data) < 12 {
+			return nil, ErrTruncated
+		}
+
+		// frame type, only Ethernet frames are supported
+		if ft := (data[10] >> 2) & 0x1f; ft != 0 {
+			return nil, fmt.Errorf("unsupported ERSPAN frame type %d", ft)
+		}
+
+		header := 12
+		// optional platform specific sub-header
+		if data[11]&0x01 != 0 {
+			header += 8
+		}
+		if len(data) < header {
+			return nil, ErrTruncated
+		}
+
+		return &Frame{
+			Encapsulation: EncapERSPANIII,
+			VLAN:          binary.BigEndian.Uint16(data) & 0x0fff,
+			SessionID:     uint32(binary.BigEndian.Uint16(data[2:]) & 0x03ff),
+			Data:          data[header:],
+		}, nil
+	}
+
+	return nil, ErrNotMirrored
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package erspan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+var innerFrame = []byte{
+	0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0x08, 0x00,
+}
+
+func greHeader(flags, protocol uint16, extra ...uint32) []byte {
+	b := make([]byte, 4+4*len(extra))
+	binary.BigEndian.PutUint16(b, flags)
+	binary.BigEndian.PutUint16(b[2:], protocol)
+	for i, v := range extra {
+		binary.BigEndian.PutUint32(b[4+4*i:], v)
+	}
+	return b
+}
+
+func TestDecapsulateGRETAP(t *testing.T) {
+	data := append(greHeader(greFlagKey, ProtocolTransparentEthernet, 42), innerFrame...)
+
+	frame, err := Decapsulate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Encapsulation != EncapGRETAP || frame.SessionID != 42 || !bytes.Equal(frame.Data, innerFrame) {
+		t.Errorf("Wrong frame: %+v", frame)
+	}
+}
+
+func TestDecapsulateERSPAN(t *testing.T) {
+	// type I
+	frame, err := Decapsulate(append(greHeader(0, ProtocolERSPANTypeII), innerFrame...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Encapsulation != EncapERSPANI || !bytes.Equal(frame.Data, innerFrame) {
+		t.Errorf("Wrong frame: %+v", frame)
+	}
+
+	// type II, version 1, VLAN 100, session 513
+	header := []byte{0x10, 0x64, 0x02, 0x01, 0x00, 0x00, 0x00, 0x05}
+	data := append(append(greHeader(greFlagSequence, ProtocolERSPANTypeII, 1), header...), innerFrame...)
+	if frame, err = Decapsulate(data); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Encapsulation != EncapERSPANII || frame.VLAN != 100 || frame.SessionID != 513 || !bytes.Equal(frame.Data, innerFrame) {
+		t.Errorf("Wrong frame: %+v", frame)
+	}
+
+	// type III with the platform specific sub-header
+	header = []byte{0x20, 0x0a, 0x00, 0x07, 0, 0, 0, 0, 0, 0, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0}
+	data = append(append(greHeader(greFlagSequence, ProtocolERSPANTypeIII, 1), header...), innerFrame...)
+	if frame, err = Decapsulate(data); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Encapsulation != EncapERSPANIII || frame.VLAN != 10 || frame.SessionID != 7 || !bytes.Equal(frame.Data, innerFrame) {
+		t.Errorf("Wrong frame: %+v", frame)
+	}
+
+	// type III carrying an IP frame
+	header = []byte{0x20, 0x0a, 0x00, 0x07, 0, 0, 0, 0, 0, 0, 0x08, 0x00}
+	data = append(append(greHeader(greFlagSequence, ProtocolERSPANTypeIII, 1), header...), innerFrame...)
+	if _, err = Decapsulate(data); err == nil {
+		t.Error("Expected an error for non Ethernet frames")
+	}
+}
+
+func TestDecapsulateNotMirrored(t *testing.T) {
+	if _, err := Decapsulate(greHeader(0, 0x0800)); err != ErrNotMirrored {
+		t.Errorf("Expected ErrNotMirrored, got %v", err)
+	}
+	if _, err := Decapsulate(greHeader(greFlagKey, ProtocolTransparentEthernet)); err != ErrTruncated {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestSourceTID(t *testing.T) {
+	session := uint32(12)
+	r := NewReceiver("0.0.0.0", "capture", []MirrorSource{
+		{Address: "192.168.1.254", SessionID: &session, TID: "session"},
+		{Address: "192.168.1.254", TID: "switch"},
+	}, nil, flow.TableOpts{}, "", 0)
+
+	peer := net.ParseIP("192.168.1.254")
+	for _, test := range []struct {
+		peer    net.IP
+		session uint32
+		tid     string
+	}{
+		{peer, 12, "session"},
+		{peer, 13, "switch"},
+		{net.ParseIP("192.168.1.1"), 12, "capture"},
+	} {
+		if tid := r.sourceTID(test.peer, test.session); tid != test.tid {
+			t.Errorf("Expected %s for %s/%d, got %s", test.tid, test.peer, test.session, tid)
+		}
+	}
+}
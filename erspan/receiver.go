@@ -0,0 +1,178 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package erspan
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	maxDgramSize = 65535
+)
+
+// MirrorSource attributes the flows of the mirror sessions sent from
+// Address, or only of the session SessionID, to the node TID
+type MirrorSource struct {
+	Address   string
+	SessionID *uint32 `mapstructure:"session_id"`
+	TID       string
+}
+
+// TableAllocator allocates the flow table of a mirror source
+type TableAllocator interface {
+	Alloc(nodeTID string, opts flow.TableOpts) *flow.Table
+	Release(t *flow.Table)
+}
+
+// Receiver terminates the ERSPAN and GRE-TAP mirror sessions sent to an
+// address and feeds the flow tables with the mirrored frames
+type Receiver struct {
+	sync.RWMutex
+	Addr       string
+	NodeTID    string
+	conn       *net.IPConn
+	sources    []MirrorSource
+	allocator  TableAllocator
+	opts       flow.TableOpts
+	bpfFilter  string
+	headerSize uint32
+	tables     map[string]*flow.Table
+	wg         sync.WaitGroup
+}
+
+// sourceTID returns the TID of the node the frames of a session are
+// attributed to, the capture node by default
+func (r *Receiver) sourceTID(peer net.IP, sessionID uint32) string {
+	tid := r.NodeTID
+	for _, source := range r.sources {
+		if source.Address != "" && !peer.Equal(net.ParseIP(source.Address)) {
+			continue
+		}
+		if source.SessionID != nil {
+			if *source.SessionID != sessionID {
+				continue
+			}
+			// a session specific source takes precedence
+			return source.TID
+		}
+		tid = source.TID
+	}
+	return tid
+}
+
+func (r *Receiver) table(tid string) *flow.Table {
+	r.Lock()
+	defer r.Unlock()
+
+	ft, ok := r.tables[tid]
+	if !ok {
+		ft = r.allocator.Alloc(tid, r.opts)
+		ft.Start()
+		r.tables[tid] = ft
+	}
+	return ft
+}
+
+func (r *Receiver) run() {
+	defer r.wg.Done()
+
+	var bpf *flow.BPF
+	if b, err := flow.NewBPF(layers.LinkTypeEthernet, r.headerSize, r.bpfFilter); err == nil {
+		bpf = b
+	} else {
+		logging.GetLogger().Error(err)
+	}
+
+	var buf [maxDgramSize]byte
+	for {
+		n, from, err := r.conn.ReadFrom(buf[:])
+		if err != nil {
+			return
+		}
+
+		frame, err := Decapsulate(buf[:n])
+		if err != nil {
+			if err != ErrNotMirrored {
+				logging.GetLogger().Debugf("Unable to decapsulate GRE packet from %s: %s", from, err)
+			}
+			continue
+		}
+
+		packet := gopacket.NewPacket(frame.Data, layers.LayerTypeEthernet, gopacket.Default)
+		m := packet.Metadata()
+		m.CaptureInfo.Timestamp = time.Now()
+		m.CaptureInfo.CaptureLength = len(frame.Data)
+		m.CaptureInfo.Length = len(frame.Data)
+
+		r.table(r.sourceTID(from.(*net.IPAddr).IP, frame.SessionID)).FeedWithGoPacket(packet, bpf)
+	}
+}
+
+// Start receiving the mirror sessions
+func (r *Receiver) Start() error {
+	conn, err := net.ListenIP("ip4:gre", &net.IPAddr{IP: net.ParseIP(r.Addr)})
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+
+	r.wg.Add(1)
+	go r.run()
+
+	return nil
+}
+
+// Stop the receiver and release its flow tables
+func (r *Receiver) Stop() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.wg.Wait()
+
+	r.Lock()
+	defer r.Unlock()
+
+	for tid, ft := range r.tables {
+		ft.Stop()
+		r.allocator.Release(ft)
+		delete(r.tables, tid)
+	}
+}
+
+// NewReceiver returns a receiver of the mirror sessions sent to addr, the
+// flows being attributed to the node nodeTID unless a mirror source matches
+func NewReceiver(addr string, nodeTID string, sources []MirrorSource, allocator TableAllocator, opts flow.TableOpts, bpfFilter string, headerSize uint32) *Receiver {
+	return &Receiver{
+		Addr:       addr,
+		NodeTID:    nodeTID,
+		sources:    sources,
+		allocator:  allocator,
+		opts:       opts,
+		bpfFilter:  bpfFilter,
+		headerSize: headerSize,
+		tables:     make(map[string]*flow.Table),
+	}
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ipfix
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+// address families of the templates, a template being built for each of
+// them without the address elements of the other ones
+const (
+	familyAny = iota
+	familyIPv4
+	familyIPv6
+)
+
+// variableLength is the length of the variable length elements
+const variableLength = 0xffff
+
+// record is a flow seen in one direction, the Skydive flows being
+// bidirectional
+type record struct {
+	flow    *flow.Flow
+	reverse bool
+	packets int64
+	bytes   int64
+}
+
+// element is an information element, encoded by value
+type element struct {
+	id         uint16
+	length     uint16
+	enterprise bool
+	family     int
+	value      func(r *record) []byte
+}
+
+func uint8Value(v uint8) []byte {
+	return []byte{v}
+}
+
+func uint16Value(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func uint64Value(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func endpoints(r *record, l *flow.FlowLayer) (string, string) {
+	if l == nil {
+		return "", ""
+	}
+	if r.reverse {
+		return l.B, l.A
+	}
+	return l.A, l.B
+}
+
+func ipValue(s string, length int) []byte {
+	ip := net.ParseIP(s)
+	if length == net.IPv4len {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		return make([]byte, length)
+	}
+	return ip
+}
+
+func macValue(s string) []byte {
+	mac, err := net.ParseMAC(s)
+	if err != nil || len(mac) != 6 {
+		return make([]byte, 6)
+	}
+	return mac
+}
+
+func ports(r *record) (int64, int64) {
+	t := r.flow.Transport
+	if t == nil {
+		return 0, 0
+	}
+	if r.reverse {
+		return t.B, t.A
+	}
+	return t.A, t.B
+}
+
+func protocolIdentifier(f *flow.Flow) uint8 {
+	if f.Transport != nil {
+		switch f.Transport.Protocol {
+		case flow.FlowProtocol_TCP:
+			return 6
+		case flow.FlowProtocol_UDP:
+			return 17
+		case flow.FlowProtocol_SCTP:
+			return 132
+		}
+	}
+	if f.ICMP != nil && f.Network != nil {
+		if f.Network.Protocol == flow.FlowProtocol_IPV6 {
+			return 58
+		}
+		return 1
+	}
+	return 0
+}
+
+// flowEndReason returns the IPFIX flow end reason, the updates of the
+// active flows being reported as active timeouts
+func flowEndReason(f *flow.Flow) uint8 {
+	switch f.FinishType {
+	case flow.FlowFinishType_NOT_FINISHED:
+		return 2
+	case flow.FlowFinishType_TIMEOUT:
+		return 1
+	case flow.FlowFinishType_EVICTED:
+		// lack of resources
+		return 5
+	default:
+		return 3
+	}
+}
+
+func stringValue(s string) []byte {
+	return []byte(s)
+}
+
+func captureID(f *flow.Flow) string {
+	if f.Provenance == nil {
+		return ""
+	}
+	return f.Provenance.CaptureID
+}
+
+// elements are the supported information elements, the IANA ones and the
+// Skydive enterprise ones, only available with IPFIX
+var elements = map[string]*element{
+	"octetDeltaCount": {id: 1, length: 8, value: func(r *record) []byte {
+		return uint64Value(uint64(r.bytes))
+	}},
+	"packetDeltaCount": {id: 2, length: 8, value: func(r *record) []byte {
+		return uint64Value(uint64(r.packets))
+	}},
+	"protocolIdentifier": {id: 4, length: 1, value: func(r *record) []byte {
+		return uint8Value(protocolIdentifier(r.flow))
+	}},
+	"sourceTransportPort": {id: 7, length: 2, value: func(r *record) []byte {
+		a, _ := ports(r)
+		return uint16Value(uint16(a))
+	}},
+	"sourceIPv4Address": {id: 8, length: 4, family: familyIPv4, value: func(r *record) []byte {
+		a, _ := endpoints(r, r.flow.Network)
+		return ipValue(a, net.IPv4len)
+	}},
+	"destinationTransportPort": {id: 11, length: 2, value: func(r *record) []byte {
+		_, b := ports(r)
+		return uint16Value(uint16(b))
+	}},
+	"destinationIPv4Address": {id: 12, length: 4, family: familyIPv4, value: func(r *record) []byte {
+		_, b := endpoints(r, r.flow.Network)
+		return ipValue(b, net.IPv4len)
+	}},
+	"sourceIPv6Address": {id: 27, length: 16, family: familyIPv6, value: func(r *record) []byte {
+		a, _ := endpoints(r, r.flow.Network)
+		return ipValue(a, net.IPv6len)
+	}},
+	"destinationIPv6Address": {id: 28, length: 16, family: familyIPv6, value: func(r *record) []byte {
+		_, b := endpoints(r, r.flow.Network)
+		return ipValue(b, net.IPv6len)
+	}},
+	"sourceMacAddress": {id: 56, length: 6, value: func(r *record) []byte {
+		a, _ := endpoints(r, r.flow.Link)
+		return macValue(a)
+	}},
+	"destinationMacAddress": {id: 80, length: 6, value: func(r *record) []byte {
+		_, b := endpoints(r, r.flow.Link)
+		return macValue(b)
+	}},
+	"flowEndReason": {id: 136, length: 1, value: func(r *record) []byte {
+		return uint8Value(flowEndReason(r.flow))
+	}},
+	"flowStartMilliseconds": {id: 152, length: 8, value: func(r *record) []byte {
+		return uint64Value(uint64(r.flow.Start))
+	}},
+	"flowEndMilliseconds": {id: 153, length: 8, value: func(r *record) []byte {
+		return uint64Value(uint64(r.flow.Last))
+	}},
+	"skydiveNodeTID": {id: 1, length: variableLength, enterprise: true, value: func(r *record) []byte {
+		return stringValue(r.flow.NodeTID)
+	}},
+	"skydiveCaptureID": {id: 2, length: variableLength, enterprise: true, value: func(r *record) []byte {
+		return stringValue(captureID(r.flow))
+	}},
+	"skydiveApplication": {id: 3, length: variableLength, enterprise: true, value: func(r *record) []byte {
+		return stringValue(r.flow.Application)
+	}},
+	"skydiveTrackingID": {id: 4, length: variableLength, enterprise: true, value: func(r *record) []byte {
+		return stringValue(r.flow.TrackingID)
+	}},
+	"skydiveFlowUUID": {id: 5, length: variableLength, enterprise: true, value: func(r *record) []byte {
+		return stringValue(r.flow.UUID)
+	}},
+	"skydiveLayersPath": {id: 6, length: variableLength, enterprise: true, value: func(r *record) []byte {
+		return stringValue(r.flow.LayersPath)
+	}},
+}
@@ -0,0 +1,348 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Export protocols
+const (
+	ProtocolIPFIX    = "ipfix"
+	ProtocolNetFlow9 = "netflow9"
+)
+
+// template set IDs and first data template ID
+const (
+	ipfixTemplateSetID    = 2
+	netflow9TemplateSetID = 0
+	firstTemplateID       = 256
+)
+
+type template struct {
+	id       uint16
+	elements []*element
+}
+
+// Exporter sends the flows of the agent flow tables to an IPFIX or a
+// NetFlow v9 collector over UDP. As the Skydive flows are bidirectional,
+// each flow is exported as two records, one per direction, reporting the
+// traffic since the previous update.
+type Exporter struct {
+	sync.Mutex
+	conn          net.Conn
+	protocol      string
+	domainID      uint32
+	enterpriseID  uint32
+	maxPacketSize int
+	refresh       time.Duration
+	templates     []*template
+	lastTemplates time.Time
+	sequence      uint32
+	started       time.Time
+}
+
+// packet is an export packet being built
+type packet struct {
+	sets        bytes.Buffer
+	setStart    int
+	setID       uint16
+	records     int
+	dataRecords int
+}
+
+func (e *Exporter) header(p *packet) []byte {
+	var h bytes.Buffer
+	now := time.Now()
+
+	if e.protocol == ProtocolIPFIX {
+		binary.Write(&h, binary.BigEndian, uint16(10))
+		binary.Write(&h, binary.BigEndian, uint16(16+p.sets.Len()))
+		binary.Write(&h, binary.BigEndian, uint32(now.Unix()))
+		binary.Write(&h, binary.BigEndian, e.sequence)
+		binary.Write(&h, binary.BigEndian, e.domainID)
+	} else {
+		binary.Write(&h, binary.BigEndian, uint16(9))
+		binary.Write(&h, binary.BigEndian, uint16(p.records))
+		binary.Write(&h, binary.BigEndian, uint32(now.Sub(e.started)/time.Millisecond))
+		binary.Write(&h, binary.BigEndian, uint32(now.Unix()))
+		binary.Write(&h, binary.BigEndian, e.sequence)
+		binary.Write(&h, binary.BigEndian, e.domainID)
+	}
+
+	return h.Bytes()
+}
+
+func (e *Exporter) openSet(p *packet, id uint16) {
+	p.setStart, p.setID = p.sets.Len(), id
+	binary.Write(&p.sets, binary.BigEndian, id)
+	binary.Write(&p.sets, binary.BigEndian, uint16(0))
+}
+
+// closeSet sets the length of the current set, the NetFlow v9 sets being
+// padded to 32 bits
+func (e *Exporter) closeSet(p *packet) {
+	if p.sets.Len() == 0 || p.sets.Len() == p.setStart {
+		return
+	}
+
+	if e.protocol == ProtocolNetFlow9 {
+		for (p.sets.Len()-p.setStart)%4 != 0 {
+			p.sets.WriteByte(0)
+		}
+	}
+
+	binary.BigEndian.PutUint16(p.sets.Bytes()[p.setStart+2:], uint16(p.sets.Len()-p.setStart))
+	p.setStart = p.sets.Len()
+}
+
+func (e *Exporter) flush(p *packet) error {
+	e.closeSet(p)
+	if p.sets.Len() == 0 {
+		return nil
+	}
+
+	data := append(e.header(p), p.sets.Bytes()...)
+
+	if e.protocol == ProtocolIPFIX {
+		e.sequence += uint32(p.dataRecords)
+	} else {
+		e.sequence++
+	}
+	*p = packet{}
+
+	_, err := e.conn.Write(data)
+	return err
+}
+
+func (e *Exporter) templateSet() []byte {
+	var p packet
+
+	setID := uint16(ipfixTemplateSetID)
+	if e.protocol == ProtocolNetFlow9 {
+		setID = netflow9TemplateSetID
+	}
+	e.openSet(&p, setID)
+
+	for _, t := range e.templates {
+		binary.Write(&p.sets, binary.BigEndian, t.id)
+		binary.Write(&p.sets, binary.BigEndian, uint16(len(t.elements)))
+		for _, el := range t.elements {
+			if el.enterprise {
+				binary.Write(&p.sets, binary.BigEndian, el.id|0x8000)
+				binary.Write(&p.sets, binary.BigEndian, el.length)
+				binary.Write(&p.sets, binary.BigEndian, e.enterpriseID)
+			} else {
+				binary.Write(&p.sets, binary.BigEndian, el.id)
+				binary.Write(&p.sets, binary.BigEndian, el.length)
+			}
+		}
+	}
+	e.closeSet(&p)
+
+	return p.sets.Bytes()
+}
+
+// encodeRecord returns a data record, the variable length elements being
+// prefixed by their length
+func encodeRecord(t *template, r *record) []byte {
+	var b bytes.Buffer
+	for _, el := range t.elements {
+		value := el.value(r)
+		if el.length == variableLength {
+			if len(value) > 0xffff-3 {
+				value = value[:0xffff-3]
+			}
+			if len(value) < 255 {
+				b.WriteByte(byte(len(value)))
+			} else {
+				b.WriteByte(255)
+				binary.Write(&b, binary.BigEndian, uint16(len(value)))
+			}
+		}
+		b.Write(value)
+	}
+	return b.Bytes()
+}
+
+func familyOf(f *flow.Flow) int {
+	if f.Network != nil {
+		switch f.Network.Protocol {
+		case flow.FlowProtocol_IPV4:
+			return familyIPv4
+		case flow.FlowProtocol_IPV6:
+			return familyIPv6
+		}
+	}
+	return familyAny
+}
+
+// records returns the records of both directions of a flow, the finished
+// flows being always reported
+func records(f *flow.Flow) []*record {
+	metric := f.LastUpdateMetric
+	if metric == nil {
+		metric = f.Metric
+	}
+	if metric == nil {
+		return nil
+	}
+
+	var records []*record
+	if metric.ABPackets > 0 || f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+		records = append(records, &record{flow: f, packets: metric.ABPackets, bytes: metric.ABBytes})
+	}
+	if metric.BAPackets > 0 {
+		records = append(records, &record{flow: f, reverse: true, packets: metric.BAPackets, bytes: metric.BABytes})
+	}
+	return records
+}
+
+func (e *Exporter) sendFlows(flows []*flow.Flow) error {
+	var p packet
+
+	if time.Since(e.lastTemplates) >= e.refresh {
+		p.sets.Write(e.templateSet())
+		p.setStart = p.sets.Len()
+		p.records += len(e.templates)
+		e.lastTemplates = time.Now()
+	}
+
+	headerSize := 16
+	if e.protocol == ProtocolNetFlow9 {
+		headerSize = 20
+	}
+
+	for _, f := range flows {
+		t := e.templates[familyOf(f)]
+		for _, r := range records(f) {
+			data := encodeRecord(t, r)
+
+			if headerSize+p.sets.Len()+len(data)+4+3 > e.maxPacketSize {
+				if err := e.flush(&p); err != nil {
+					return err
+				}
+			}
+
+			if p.sets.Len() == p.setStart || p.setID != t.id {
+				e.closeSet(&p)
+				e.openSet(&p, t.id)
+			}
+
+			p.sets.Write(data)
+			p.records++
+			p.dataRecords++
+		}
+	}
+
+	return e.flush(&p)
+}
+
+// SendFlows exports the flows, to be called with the flow table updates
+func (e *Exporter) SendFlows(flowArray *flow.FlowArray) {
+	e.Lock()
+	defer e.Unlock()
+
+	if err := e.sendFlows(flowArray.Flows); err != nil {
+		logging.GetLogger().Errorf("Failed to export flows to %s: %s", e.conn.RemoteAddr(), err)
+	}
+}
+
+// Close the connection to the collector
+func (e *Exporter) Close() {
+	e.conn.Close()
+}
+
+// NewExporter returns a new exporter sending the given information elements
+// to a collector
+func NewExporter(address, protocol string, fields []string, domainID, enterpriseID uint32, maxPacketSize int, refresh time.Duration) (*Exporter, error) {
+	if protocol != ProtocolIPFIX && protocol != ProtocolNetFlow9 {
+		return nil, fmt.Errorf("Unsupported flow export protocol '%s'", protocol)
+	}
+
+	var selected []*element
+	for _, name := range fields {
+		el, ok := elements[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown information element '%s'", name)
+		}
+		if el.enterprise && protocol != ProtocolIPFIX {
+			return nil, fmt.Errorf("Information element '%s' is only supported with IPFIX", name)
+		}
+		selected = append(selected, el)
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No information element to export")
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
+		conn:          conn,
+		protocol:      protocol,
+		domainID:      domainID,
+		enterpriseID:  enterpriseID,
+		maxPacketSize: maxPacketSize,
+		refresh:       refresh,
+		started:       time.Now(),
+	}
+
+	for _, family := range []int{familyAny, familyIPv4, familyIPv6} {
+		t := &template{id: uint16(firstTemplateID + family)}
+		for _, el := range selected {
+			if el.family == familyAny || el.family == family {
+				t.elements = append(t.elements, el)
+			}
+		}
+		e.templates = append(e.templates, t)
+	}
+
+	return e, nil
+}
+
+// NewExporterFromConfig returns a new exporter according to the
+// configuration, nil if no collector is configured
+func NewExporterFromConfig() (*Exporter, error) {
+	address := config.GetString("agent.flow.ipfix_exporter.address")
+	if address == "" {
+		return nil, nil
+	}
+
+	return NewExporter(
+		address,
+		config.GetString("agent.flow.ipfix_exporter.protocol"),
+		config.GetStringSlice("agent.flow.ipfix_exporter.fields"),
+		uint32(config.GetInt("agent.flow.ipfix_exporter.domain_id")),
+		uint32(config.GetInt("agent.flow.ipfix_exporter.enterprise_id")),
+		config.GetInt("agent.flow.ipfix_exporter.max_packet_size"),
+		time.Duration(config.GetInt("agent.flow.ipfix_exporter.template_refresh"))*time.Second,
+	)
+}
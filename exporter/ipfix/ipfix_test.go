@@ -0,0 +1,104 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ipfix
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func TestExportIPFIX(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fields := []string{"sourceIPv4Address", "destinationIPv4Address", "sourceIPv6Address", "sourceTransportPort", "destinationTransportPort", "protocolIdentifier", "packetDeltaCount", "skydiveNodeTID"}
+	exporter, err := NewExporter(conn.LocalAddr().String(), ProtocolIPFIX, fields, 7, 32473, 1400, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.Close()
+
+	f := &flow.Flow{
+		NodeTID:          "node1",
+		Network:          &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: "192.168.0.1", B: "192.168.0.2"},
+		Transport:        &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: 47838, B: 80},
+		LastUpdateMetric: &flow.FlowMetric{ABPackets: 3, BAPackets: 2},
+	}
+	exporter.SendFlows(&flow.FlowArray{Flows: []*flow.Flow{f}})
+
+	buf := make([]byte, 1500)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := buf[:n]
+
+	if version := binary.BigEndian.Uint16(data); version != 10 {
+		t.Fatalf("Wrong version %d", version)
+	}
+	if length := binary.BigEndian.Uint16(data[2:]); int(length) != n {
+		t.Fatalf("Wrong message length %d, expected %d", length, n)
+	}
+	if domain := binary.BigEndian.Uint32(data[12:]); domain != 7 {
+		t.Fatalf("Wrong observation domain %d", domain)
+	}
+
+	// template set, then the IPv4 data set
+	sets := data[16:]
+	if setID := binary.BigEndian.Uint16(sets); setID != ipfixTemplateSetID {
+		t.Fatalf("Expected a template set, got %d", setID)
+	}
+	sets = sets[binary.BigEndian.Uint16(sets[2:]):]
+
+	if setID := binary.BigEndian.Uint16(sets); setID != firstTemplateID+familyIPv4 {
+		t.Fatalf("Expected the IPv4 data set, got %d", setID)
+	}
+
+	record := func(src, dst string, sport, dport uint16, packets uint64) []byte {
+		var b bytes.Buffer
+		b.Write(net.ParseIP(src).To4())
+		b.Write(net.ParseIP(dst).To4())
+		binary.Write(&b, binary.BigEndian, sport)
+		binary.Write(&b, binary.BigEndian, dport)
+		b.WriteByte(6)
+		binary.Write(&b, binary.BigEndian, packets)
+		b.WriteByte(5)
+		b.WriteString("node1")
+		return b.Bytes()
+	}
+
+	expected := append(record("192.168.0.1", "192.168.0.2", 47838, 80, 3), record("192.168.0.2", "192.168.0.1", 80, 47838, 2)...)
+	if !bytes.Equal(sets[4:binary.BigEndian.Uint16(sets[2:])], expected) {
+		t.Errorf("Wrong data records %v, expected %v", sets[4:], expected)
+	}
+}
+
+func TestNetFlow9EnterpriseElements(t *testing.T) {
+	if _, err := NewExporter("127.0.0.1:2055", ProtocolNetFlow9, []string{"skydiveNodeTID"}, 0, 32473, 1400, time.Minute); err == nil {
+		t.Error("Enterprise elements should not be supported with NetFlow v9")
+	}
+}
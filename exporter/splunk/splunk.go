@@ -0,0 +1,422 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package splunk
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Flows exported
+const (
+	FlowsNone     = "none"
+	FlowsFinished = "finished"
+	FlowsAll      = "all"
+)
+
+// Event classes, used to map the events to an index and a source type
+const (
+	ClassFlow     = "flow"
+	ClassAlert    = "alert"
+	ClassTopology = "topology"
+)
+
+// Mapping defines the index and the source type of an event class, the
+// token defaults being used when empty
+type Mapping struct {
+	Index      string
+	SourceType string
+}
+
+// Event is a HTTP Event Collector event
+type Event struct {
+	Time       float64     `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// TopologyEvent is the event of a topology change
+type TopologyEvent struct {
+	Type string      `json:"Type"`
+	Node *graph.Node `json:"Node,omitempty"`
+	Edge *graph.Edge `json:"Edge,omitempty"`
+}
+
+type hecResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+type ackResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// batch is a set of events sent in one request, kept until acknowledged
+// when the indexer acknowledgment is enabled
+type batch struct {
+	data []byte
+	sent time.Time
+}
+
+// Exporter sends the flows, the alerts and the topology changes to a
+// Splunk HTTP Event Collector. The events are sent by batches and, when the
+// indexer acknowledgment is enabled, sent again if not acknowledged in time.
+type Exporter struct {
+	graph.DefaultGraphListener
+	url           string
+	token         string
+	channel       string
+	hostname      string
+	flows         string
+	mappings      map[string]Mapping
+	client        *http.Client
+	batchSize     int
+	batchMaxDelay time.Duration
+	ack           bool
+	ackTimeout    time.Duration
+	pending       map[int64]*batch
+	queue         chan []byte
+	dropped       uint64
+	quit          chan struct{}
+	wg            sync.WaitGroup
+}
+
+func (s *Exporter) enqueue(class string, t time.Time, data interface{}) {
+	mapping := s.mappings[class]
+	e := &Event{
+		Time:       float64(t.UnixNano()) / float64(time.Second),
+		Host:       s.hostname,
+		Source:     "skydive:" + class,
+		SourceType: mapping.SourceType,
+		Index:      mapping.Index,
+		Event:      data,
+	}
+
+	// the events are encoded right away as the graph elements and the
+	// flows are modified afterwards
+	b, err := json.Marshal(e)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to encode %s event: %s", class, err)
+		return
+	}
+
+	select {
+	case s.queue <- b:
+	default:
+		if atomic.AddUint64(&s.dropped, 1)%1000 == 1 {
+			logging.GetLogger().Warningf("Splunk exporter queue full, %d events dropped", atomic.LoadUint64(&s.dropped))
+		}
+	}
+}
+
+// OnFlows exports the flows received from the agents
+func (s *Exporter) OnFlows(flowArray *flow.FlowArray) {
+	if s.flows == FlowsNone {
+		return
+	}
+
+	for _, f := range flowArray.Flows {
+		if s.flows == FlowsAll || f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+			s.enqueue(ClassFlow, time.Unix(0, f.Last*int64(time.Millisecond)), f)
+		}
+	}
+}
+
+// OnAlert exports the triggered alerts
+func (s *Exporter) OnAlert(msg *alert.Message) {
+	s.enqueue(ClassAlert, msg.Timestamp, msg)
+}
+
+// OnNodeAdded event
+func (s *Exporter) OnNodeAdded(n *graph.Node) {
+	s.enqueue(ClassTopology, time.Now(), &TopologyEvent{Type: "NodeAdded", Node: n})
+}
+
+// OnNodeUpdated event
+func (s *Exporter) OnNodeUpdated(n *graph.Node) {
+	s.enqueue(ClassTopology, time.Now(), &TopologyEvent{Type: "NodeUpdated", Node: n})
+}
+
+// OnNodeDeleted event
+func (s *Exporter) OnNodeDeleted(n *graph.Node) {
+	s.enqueue(ClassTopology, time.Now(), &TopologyEvent{Type: "NodeDeleted", Node: n})
+}
+
+// OnEdgeAdded event
+func (s *Exporter) OnEdgeAdded(e *graph.Edge) {
+	s.enqueue(ClassTopology, time.Now(), &TopologyEvent{Type: "EdgeAdded", Edge: e})
+}
+
+// OnEdgeUpdated event
+func (s *Exporter) OnEdgeUpdated(e *graph.Edge) {
+	s.enqueue(ClassTopology, time.Now(), &TopologyEvent{Type: "EdgeUpdated", Edge: e})
+}
+
+// OnEdgeDeleted event
+func (s *Exporter) OnEdgeDeleted(e *graph.Edge) {
+	s.enqueue(ClassTopology, time.Now(), &TopologyEvent{Type: "EdgeDeleted", Edge: e})
+}
+
+func (s *Exporter) request(path string, body []byte, result interface{}) error {
+	req, err := http.NewRequest("POST", s.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	if s.ack {
+		req.Header.Set("X-Splunk-Request-Channel", s.channel)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// send posts a batch, keeping it until acknowledged if required
+func (s *Exporter) send(b *batch) error {
+	var resp hecResponse
+	if err := s.request("/services/collector/event", b.data, &resp); err != nil {
+		return err
+	}
+
+	if s.ack {
+		if resp.AckID == nil {
+			return fmt.Errorf("No acknowledgment ID returned, check that indexer acknowledgment is enabled for the token")
+		}
+		b.sent = time.Now()
+		s.pending[*resp.AckID] = b
+	}
+
+	return nil
+}
+
+// checkAcks queries the acknowledgment status of the pending batches, the
+// ones not acknowledged in time being sent again
+func (s *Exporter) checkAcks() {
+	if len(s.pending) == 0 {
+		return
+	}
+
+	ids := make([]int64, 0, len(s.pending))
+	for id := range s.pending {
+		ids = append(ids, id)
+	}
+
+	body, _ := json.Marshal(map[string][]int64{"acks": ids})
+
+	var resp ackResponse
+	if err := s.request("/services/collector/ack", body, &resp); err != nil {
+		logging.GetLogger().Errorf("Unable to query Splunk acknowledgments: %s", err)
+	}
+
+	var expired []*batch
+	for id, b := range s.pending {
+		if resp.Acks[fmt.Sprintf("%d", id)] {
+			delete(s.pending, id)
+		} else if time.Since(b.sent) > s.ackTimeout {
+			delete(s.pending, id)
+			expired = append(expired, b)
+		}
+	}
+
+	for _, b := range expired {
+		logging.GetLogger().Warningf("Splunk batch not acknowledged after %s, sending it again", s.ackTimeout)
+		s.sendBatch(b)
+	}
+}
+
+// flush sends the events as a batch
+func (s *Exporter) flush(events [][]byte) {
+	if len(events) > 0 {
+		s.sendBatch(&batch{data: bytes.Join(events, []byte("\n"))})
+	}
+}
+
+// sendBatch sends a batch, retrying until it succeeds or the exporter is
+// stopped
+func (s *Exporter) sendBatch(b *batch) {
+	for {
+		err := s.send(b)
+		if err == nil {
+			return
+		}
+
+		logging.GetLogger().Errorf("Unable to send events to Splunk %s: %s", s.url, err)
+		select {
+		case <-s.quit:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Exporter) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.batchMaxDelay)
+	defer ticker.Stop()
+
+	var events [][]byte
+	for {
+		select {
+		case <-s.quit:
+			s.flush(events)
+			return
+		case e := <-s.queue:
+			events = append(events, e)
+			if len(events) >= s.batchSize {
+				s.flush(events)
+				events = nil
+			}
+		case <-ticker.C:
+			s.flush(events)
+			events = nil
+
+			if s.ack {
+				s.checkAcks()
+			}
+		}
+	}
+}
+
+// Start the exporter
+func (s *Exporter) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop the exporter
+func (s *Exporter) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// NewExporter returns a new exporter sending the events to the HTTP Event
+// Collector at the given URL. flows selects the flows exported, none, all
+// the flow updates or only the finished flows.
+func NewExporter(url, token, flows string, mappings map[string]Mapping, batchSize int, batchMaxDelay time.Duration, ack bool, ackTimeout time.Duration, queueSize int, tlsConfig *tls.Config) (*Exporter, error) {
+	switch flows {
+	case FlowsNone, FlowsFinished, FlowsAll:
+	default:
+		return nil, fmt.Errorf("Unsupported Splunk flows selection: %s", flows)
+	}
+
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("Invalid Splunk batch size: %d", batchSize)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+
+	channel, err := uuid.NewV4()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Exporter{
+		url:           strings.TrimSuffix(url, "/"),
+		token:         token,
+		channel:       channel.String(),
+		hostname:      hostname,
+		flows:         flows,
+		mappings:      mappings,
+		client:        &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		batchSize:     batchSize,
+		batchMaxDelay: batchMaxDelay,
+		ack:           ack,
+		ackTimeout:    ackTimeout,
+		pending:       make(map[int64]*batch),
+		queue:         make(chan []byte, queueSize),
+		quit:          make(chan struct{}),
+	}, nil
+}
+
+// NewExporterFromConfig returns a new Splunk exporter from the analyzer
+// configuration, nil if no URL is configured
+func NewExporterFromConfig() (*Exporter, error) {
+	url := config.GetString("analyzer.splunk_exporter.url")
+	if url == "" {
+		return nil, nil
+	}
+
+	mappings := make(map[string]Mapping)
+	for _, class := range []string{ClassFlow, ClassAlert, ClassTopology} {
+		path := "analyzer.splunk_exporter.mappings." + class
+		mappings[class] = Mapping{
+			Index:      config.GetString(path + ".index"),
+			SourceType: config.GetString(path + ".sourcetype"),
+		}
+	}
+
+	tlsConfig, err := config.GetTLSClientConfig(true)
+	if err != nil {
+		return nil, err
+	}
+	if config.GetBool("analyzer.splunk_exporter.ssl_insecure") {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return NewExporter(
+		url,
+		config.GetString("analyzer.splunk_exporter.token"),
+		config.GetString("analyzer.splunk_exporter.flows"),
+		mappings,
+		config.GetInt("analyzer.splunk_exporter.batch_size"),
+		time.Duration(config.GetInt("analyzer.splunk_exporter.batch_maxdelay"))*time.Second,
+		config.GetBool("analyzer.splunk_exporter.ack"),
+		time.Duration(config.GetInt("analyzer.splunk_exporter.ack_timeout"))*time.Second,
+		config.GetInt("analyzer.splunk_exporter.queue_size"),
+		tlsConfig,
+	)
+}
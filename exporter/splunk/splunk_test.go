@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package splunk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+)
+
+func TestSendAlerts(t *testing.T) {
+	events := make(chan []*Event, 1)
+	acks := make(chan []int64, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Splunk secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("X-Splunk-Request-Channel") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+
+		switch r.URL.Path {
+		case "/services/collector/event":
+			var batch []*Event
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for scanner.Scan() {
+				var e Event
+				if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+					t.Error(err)
+				}
+				batch = append(batch, &e)
+			}
+			events <- batch
+			w.Write([]byte(`{"text":"Success","code":0,"ackId":3}`))
+		case "/services/collector/ack":
+			var req struct{ Acks []int64 }
+			json.Unmarshal(data, &req)
+			acks <- req.Acks
+			w.Write([]byte(`{"acks":{"3":true}}`))
+		}
+	}))
+	defer server.Close()
+
+	mappings := map[string]Mapping{ClassAlert: {Index: "security", SourceType: "skydive:alert"}}
+	exporter, err := NewExporter(server.URL, "secret", FlowsNone, mappings, 2, 100*time.Millisecond, true, time.Minute, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exporter.Start()
+	defer exporter.Stop()
+
+	exporter.OnAlert(&alert.Message{UUID: "alert1", Timestamp: time.Now()})
+	exporter.OnAlert(&alert.Message{UUID: "alert2", Timestamp: time.Now()})
+
+	select {
+	case batch := <-events:
+		if len(batch) != 2 {
+			t.Fatalf("Expected a batch of 2 events, got %d", len(batch))
+		}
+		if batch[0].Index != "security" || batch[0].SourceType != "skydive:alert" {
+			t.Errorf("Wrong event mapping: %+v", batch[0])
+		}
+		if uuid := batch[0].Event.(map[string]interface{})["UUID"]; uuid != "alert1" {
+			t.Errorf("Wrong alert exported: %v", batch[0].Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No events received")
+	}
+
+	select {
+	case ids := <-acks:
+		if len(ids) != 1 || ids[0] != 3 {
+			t.Errorf("Wrong acknowledgment query: %v", ids)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No acknowledgment query received")
+	}
+}
@@ -0,0 +1,397 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package syslog
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/version"
+)
+
+// Message formats
+const (
+	FormatCEF     = "cef"
+	FormatRFC5424 = "rfc5424"
+)
+
+// Flows exported
+const (
+	FlowsNone     = "none"
+	FlowsFinished = "finished"
+	FlowsAll      = "all"
+)
+
+// syslog severities
+const (
+	severityWarning       = 4
+	severityInformational = 6
+)
+
+// Field is an event field, named Key in the CEF extension and Name in the
+// RFC 5424 messages
+type Field struct {
+	Key   string
+	Name  string
+	Value string
+}
+
+// Event is a flow or an alert to be sent, Severity being the CEF one, from
+// 0 to 10
+type Event struct {
+	Class    string
+	Name     string
+	Severity int
+	Time     time.Time
+	Fields   []Field
+}
+
+func (e *Event) add(key, name, value string) {
+	if value != "" {
+		e.Fields = append(e.Fields, Field{Key: key, Name: name, Value: value})
+	}
+}
+
+func (e *Event) addInt(key, name string, value int64) {
+	e.add(key, name, strconv.FormatInt(value, 10))
+}
+
+func (e *Event) addLabeled(i int, label, value string) {
+	if value != "" {
+		e.add(fmt.Sprintf("cs%dLabel", i), "", label)
+		e.add(fmt.Sprintf("cs%d", i), label, value)
+	}
+}
+
+// FlowEvent returns the event of a flow, flows with threat indicators being
+// reported with a higher severity
+func FlowEvent(f *flow.Flow) *Event {
+	e := &Event{Class: "flow", Name: "Flow", Severity: 1, Time: time.Unix(0, f.Last*int64(time.Millisecond))}
+	if f.Threat != nil {
+		e.Name, e.Severity = "Threat flow", 7
+	}
+
+	e.add("externalId", "UUID", f.UUID)
+	e.addInt("start", "Start", f.Start)
+	e.addInt("end", "Last", f.Last)
+	e.add("app", "Application", f.Application)
+
+	if f.Link != nil {
+		e.add("smac", "SrcMAC", f.Link.A)
+		e.add("dmac", "DstMAC", f.Link.B)
+	}
+	if f.Network != nil {
+		e.add("src", "SrcIP", f.Network.A)
+		e.add("dst", "DstIP", f.Network.B)
+	}
+
+	proto := ""
+	if f.Network != nil {
+		proto = f.Network.Protocol.String()
+	}
+	if f.Transport != nil {
+		proto = f.Transport.Protocol.String()
+		e.addInt("spt", "SrcPort", f.Transport.A)
+		e.addInt("dpt", "DstPort", f.Transport.B)
+	}
+	e.add("proto", "Protocol", proto)
+
+	if m := f.Metric; m != nil {
+		e.addInt("out", "ABBytes", m.ABBytes)
+		e.addInt("in", "BABytes", m.BABytes)
+		e.addInt("cnt", "Packets", m.ABPackets+m.BAPackets)
+	}
+
+	e.addLabeled(1, "TrackingID", f.TrackingID)
+	e.addLabeled(2, "NodeTID", f.NodeTID)
+	if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+		e.addLabeled(3, "FinishType", f.FinishType.String())
+	}
+	if f.Threat != nil {
+		e.addLabeled(4, "ThreatSources", strings.Join(f.Threat.Sources, ","))
+	}
+	e.addLabeled(5, "AppName", f.AppName)
+
+	return e
+}
+
+// AlertEvent returns the event of a triggered alert
+func AlertEvent(msg *alert.Message) *Event {
+	e := &Event{Class: "alert", Name: "Alert", Severity: 7, Time: msg.Timestamp}
+
+	e.add("externalId", "Occurrence", msg.Occurrence)
+	e.addInt("rt", "Timestamp", msg.Timestamp.UnixNano()/int64(time.Millisecond))
+	e.addLabeled(1, "AlertUUID", msg.UUID)
+	if data, err := json.Marshal(msg.ReasonData); err == nil {
+		e.add("msg", "Reason", string(data))
+	}
+
+	return e
+}
+
+func escapeCEFHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(s)
+}
+
+func escapeCEFValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+func escapeValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// CEF returns the event in the Common Event Format
+func (e *Event) CEF() string {
+	var ext []string
+	for _, f := range e.Fields {
+		ext = append(ext, f.Key+"="+escapeCEFValue(f.Value))
+	}
+
+	return fmt.Sprintf("CEF:0|Skydive|Skydive|%s|%s|%s|%d|%s",
+		escapeCEFHeader(version.Version), escapeCEFHeader(e.Class), escapeCEFHeader(e.Name), e.Severity, strings.Join(ext, " "))
+}
+
+// KeyValues returns the event fields as a list of key="value"
+func (e *Event) KeyValues() string {
+	kv := []string{fmt.Sprintf(`Event="%s"`, escapeValue(e.Name))}
+	for _, f := range e.Fields {
+		if f.Name != "" {
+			kv = append(kv, fmt.Sprintf(`%s="%s"`, f.Name, escapeValue(f.Value)))
+		}
+	}
+	return strings.Join(kv, " ")
+}
+
+// Exporter sends the flows and the alerts to a syslog server, in the
+// Common Event Format or as RFC 5424 messages
+type Exporter struct {
+	address   string
+	protocol  string
+	format    string
+	flows     string
+	facility  int
+	appName   string
+	hostname  string
+	tlsConfig *tls.Config
+	conn      net.Conn
+	queue     chan string
+	dropped   uint64
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Message returns the syslog message of an event, the CEF events being
+// sent with a RFC 5424 header as well
+func (s *Exporter) Message(e *Event) string {
+	severity := severityInformational
+	if e.Severity >= 7 {
+		severity = severityWarning
+	}
+
+	body := e.KeyValues()
+	if s.format == FormatCEF {
+		body = e.CEF()
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		s.facility*8+severity, e.Time.UTC().Format(time.RFC3339Nano), s.hostname, s.appName, os.Getpid(), e.Class, body)
+}
+
+func (s *Exporter) enqueue(e *Event) {
+	select {
+	case s.queue <- s.Message(e):
+	default:
+		if atomic.AddUint64(&s.dropped, 1)%1000 == 1 {
+			logging.GetLogger().Warningf("Syslog exporter queue full, %d messages dropped", atomic.LoadUint64(&s.dropped))
+		}
+	}
+}
+
+// OnFlows exports the flows received from the agents
+func (s *Exporter) OnFlows(flowArray *flow.FlowArray) {
+	if s.flows == FlowsNone {
+		return
+	}
+
+	for _, f := range flowArray.Flows {
+		if s.flows == FlowsAll || f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+			s.enqueue(FlowEvent(f))
+		}
+	}
+}
+
+// OnAlert exports the triggered alerts
+func (s *Exporter) OnAlert(msg *alert.Message) {
+	s.enqueue(AlertEvent(msg))
+}
+
+func (s *Exporter) dial() (net.Conn, error) {
+	switch s.protocol {
+	case "tls":
+		return tls.Dial("tcp", s.address, s.tlsConfig)
+	default:
+		return net.DialTimeout(s.protocol, s.address, 5*time.Second)
+	}
+}
+
+func (s *Exporter) send(msg string) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	// stream transports use the octet counting framing of RFC 6587
+	if s.protocol != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *Exporter) run() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case msg := <-s.queue:
+			for {
+				err := s.send(msg)
+				if err == nil {
+					break
+				}
+
+				logging.GetLogger().Errorf("Unable to send message to syslog server %s: %s", s.address, err)
+				select {
+				case <-s.quit:
+					return
+				case <-time.After(time.Second):
+				}
+			}
+		}
+	}
+}
+
+// Start the exporter
+func (s *Exporter) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop the exporter
+func (s *Exporter) Stop() {
+	close(s.quit)
+	s.wg.Wait()
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// NewExporter returns a new syslog exporter sending to the given address
+// using udp, tcp or tls. flows selects the flows exported, none, all the
+// flow updates or only the finished flows.
+func NewExporter(address, protocol, format, flows string, facility int, appName string, queueSize int) (*Exporter, error) {
+	switch protocol {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("Unsupported syslog protocol: %s", protocol)
+	}
+
+	switch format {
+	case FormatCEF, FormatRFC5424:
+	default:
+		return nil, fmt.Errorf("Unsupported syslog format: %s", format)
+	}
+
+	switch flows {
+	case FlowsNone, FlowsFinished, FlowsAll:
+	default:
+		return nil, fmt.Errorf("Unsupported syslog flows selection: %s", flows)
+	}
+
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("Invalid syslog facility: %d", facility)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	s := &Exporter{
+		address:  address,
+		protocol: protocol,
+		format:   format,
+		flows:    flows,
+		facility: facility,
+		appName:  appName,
+		hostname: hostname,
+		queue:    make(chan string, queueSize),
+		quit:     make(chan struct{}),
+	}
+
+	if protocol == "tls" {
+		if s.tlsConfig, err = config.GetTLSClientConfig(true); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// NewExporterFromConfig returns a new syslog exporter from the analyzer
+// configuration, nil if no address is configured
+func NewExporterFromConfig() (*Exporter, error) {
+	address := config.GetString("analyzer.syslog_exporter.address")
+	if address == "" {
+		return nil, nil
+	}
+
+	return NewExporter(
+		address,
+		config.GetString("analyzer.syslog_exporter.protocol"),
+		config.GetString("analyzer.syslog_exporter.format"),
+		config.GetString("analyzer.syslog_exporter.flows"),
+		config.GetInt("analyzer.syslog_exporter.facility"),
+		config.GetString("analyzer.syslog_exporter.app_name"),
+		config.GetInt("analyzer.syslog_exporter.queue_size"),
+	)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package syslog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	"github.com/skydive-project/skydive/flow"
+)
+
+func TestFlowCEF(t *testing.T) {
+	f := &flow.Flow{
+		UUID:       "uuid1",
+		TrackingID: "tid1",
+		Network:    &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: "192.168.0.1", B: "192.168.0.2"},
+		Transport:  &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: 47838, B: 80},
+		Metric:     &flow.FlowMetric{ABBytes: 100, BABytes: 2000, ABPackets: 2, BAPackets: 3},
+		Start:      1000,
+		Last:       2000,
+		FinishType: flow.FlowFinishType_TCP_FIN,
+		Threat:     &flow.ThreatLayer{Sources: []string{"feodo"}},
+	}
+
+	cef := FlowEvent(f).CEF()
+
+	if !strings.HasPrefix(cef, "CEF:0|Skydive|Skydive|") || !strings.Contains(cef, "|flow|Threat flow|7|") {
+		t.Errorf("Wrong CEF header: %s", cef)
+	}
+
+	for _, field := range []string{"externalId=uuid1", "src=192.168.0.1", "dst=192.168.0.2", "spt=47838", "dpt=80", "proto=TCP", "out=100", "in=2000", "cnt=5", "cs3Label=FinishType cs3=TCP_FIN", "cs4=feodo"} {
+		if !strings.Contains(cef, field) {
+			t.Errorf("Expected %s in %s", field, cef)
+		}
+	}
+}
+
+func TestAlertMessage(t *testing.T) {
+	exporter, err := NewExporter("127.0.0.1:514", "udp", FormatRFC5424, FlowsFinished, 16, "skydive", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := exporter.Message(AlertEvent(&alert.Message{
+		UUID:       "alert1",
+		Occurrence: "occ1",
+		Timestamp:  time.Unix(1, 0),
+		ReasonData: map[string]string{"a": "b=\"c\""},
+	}))
+
+	// local0 facility and warning severity
+	if !strings.HasPrefix(msg, "<132>1 1970-01-01T00:00:01Z ") {
+		t.Errorf("Wrong syslog header: %s", msg)
+	}
+
+	if !strings.Contains(msg, ` alert - Event="Alert" Occurrence="occ1" Timestamp="1000" AlertUUID="alert1" Reason="{\"a\":\"b=\\\"c\\\"\"}"`) {
+		t.Errorf("Wrong syslog message: %s", msg)
+	}
+}
+
+func TestEscapeCEF(t *testing.T) {
+	if s := escapeCEFValue("a=b\\c\nd"); s != `a\=b\\c\nd` {
+		t.Errorf("Wrong escaping of the extension values: %s", s)
+	}
+	if s := escapeCEFHeader("a|b=c"); s != `a\|b=c` {
+		t.Errorf("Wrong escaping of the header: %s", s)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/featureflag"
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// Client sends to the agents the feature flags set through the API and
+// applies them to the analyzer
+type Client struct {
+	ws.DefaultSpeakerEventHandler
+	pool    ws.StructSpeakerPool
+	handler *api.FeatureFlagAPI
+	watcher api.StoppableWatcher
+}
+
+// Resolve returns the state of the flags for a host, the flags set for the
+// host taking precedence over the ones set for the whole cluster
+func Resolve(flags []*types.FeatureFlag, host string) map[string]bool {
+	values := make(map[string]bool)
+	for _, flag := range flags {
+		if flag.Host == "" {
+			values[flag.Name] = flag.Enabled
+		}
+	}
+	for _, flag := range flags {
+		if flag.Host != "" && flag.Host == host {
+			values[flag.Name] = flag.Enabled
+		}
+	}
+	return values
+}
+
+func (c *Client) flags() []*types.FeatureFlag {
+	var flags []*types.FeatureFlag
+	for _, resource := range c.handler.Index() {
+		flags = append(flags, resource.(*types.FeatureFlag))
+	}
+	return flags
+}
+
+func (c *Client) send(speaker ws.Speaker, flags []*types.FeatureFlag) {
+	msg := ws.NewStructMessage(featureflag.Namespace, "Set", Resolve(flags, speaker.GetRemoteHost()))
+	if err := speaker.SendMessage(msg); err != nil {
+		logging.GetLogger().Errorf("Unable to send the feature flags to %s: %s", speaker.GetRemoteHost(), err)
+	}
+}
+
+// update applies the flags to the analyzer and to all the connected agents
+func (c *Client) update() {
+	flags := c.flags()
+
+	featureflag.Set(Resolve(flags, config.GetString("host_id")))
+
+	for _, speaker := range c.pool.GetSpeakers() {
+		c.send(speaker, flags)
+	}
+}
+
+// OnConnected websocket event, the flags being sent to the new agents
+func (c *Client) OnConnected(speaker ws.Speaker) {
+	c.send(speaker, c.flags())
+}
+
+func (c *Client) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	logging.GetLogger().Debugf("Feature flag %s %s, updating the agents", id, action)
+	c.update()
+}
+
+// Start the feature flag client
+func (c *Client) Start() {
+	c.update()
+	c.watcher = c.handler.AsyncWatch(c.onAPIWatcherEvent)
+}
+
+// Stop the feature flag client
+func (c *Client) Stop() {
+	c.watcher.Stop()
+}
+
+// NewClient returns a new feature flag client
+func NewClient(pool ws.StructSpeakerPool, handler *api.FeatureFlagAPI) *Client {
+	featureflag.Reset()
+
+	c := &Client{
+		pool:    pool,
+		handler: handler,
+	}
+	pool.AddEventHandler(c)
+
+	return c
+}
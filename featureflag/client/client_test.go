@@ -0,0 +1,44 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestResolve(t *testing.T) {
+	flags := []*types.FeatureFlag{
+		{Name: "a", Host: "host1", Enabled: false},
+		{Name: "a", Enabled: true},
+		{Name: "b", Enabled: true},
+		{Name: "c", Host: "host2", Enabled: true},
+	}
+
+	expected := map[string]bool{"a": false, "b": true}
+	if values := Resolve(flags, "host1"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	expected = map[string]bool{"a": true, "b": true, "c": true}
+	if values := Resolve(flags, "host2"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package featureflag toggles experimental behaviors at runtime. The flags
+// are registered by the packages implementing the behaviors, enabled by
+// default through the feature_flags configuration entry and toggled per
+// agent or for the whole cluster through the featureflag API.
+package featureflag
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Flag describes an experimental behavior which can be toggled at runtime
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+	enabled     int32
+}
+
+// State describes the current state of a flag
+type State struct {
+	Description string
+	Default     bool
+	Enabled     bool
+}
+
+var (
+	lock  sync.RWMutex
+	flags = make(map[string]*Flag)
+)
+
+// Enabled returns whether the behavior is enabled
+func (f *Flag) Enabled() bool {
+	return atomic.LoadInt32(&f.enabled) == 1
+}
+
+func (f *Flag) set(enabled bool) bool {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	return atomic.SwapInt32(&f.enabled, value) != value
+}
+
+// Register declares a flag, Default being its state when neither the
+// configuration nor the API enable it
+func Register(name, description string, def bool) *Flag {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, found := flags[name]; found {
+		panic("feature flag " + name + " registered twice")
+	}
+
+	f := &Flag{Name: name, Description: description, Default: def}
+	f.set(def)
+	flags[name] = f
+
+	return f
+}
+
+// Lookup returns the flag with the given name
+func Lookup(name string) (*Flag, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	f, found := flags[name]
+	return f, found
+}
+
+// IsEnabled returns whether the flag with the given name is enabled, an
+// unknown flag being disabled
+func IsEnabled(name string) bool {
+	if f, found := Lookup(name); found {
+		return f.Enabled()
+	}
+	return false
+}
+
+// Set toggles the flags, the flags not given being reset to their default
+// state. The unknown flags, registered by another version of the agent,
+// are ignored.
+func Set(values map[string]bool) {
+	defaults := make(map[string]bool)
+	for _, name := range config.GetStringSlice("feature_flags") {
+		defaults[name] = true
+	}
+
+	lock.RLock()
+	defer lock.RUnlock()
+
+	for name, f := range flags {
+		enabled, found := values[name]
+		if !found {
+			enabled = f.Default || defaults[name]
+		}
+
+		if f.set(enabled) {
+			logging.GetLogger().Infof("Feature flag %s set to %t", name, enabled)
+		}
+	}
+}
+
+// Reset sets the flags to their default state
+func Reset() {
+	Set(nil)
+}
+
+// States returns the state of the registered flags
+func States() map[string]State {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	states := make(map[string]State, len(flags))
+	for name, f := range flags {
+		states[name] = State{Description: f.Description, Default: f.Default, Enabled: f.Enabled()}
+	}
+	return states
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package featureflag
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/config"
+)
+
+func TestSet(t *testing.T) {
+	enabled := Register("test.enabled", "enabled by default", true)
+	disabled := Register("test.disabled", "disabled by default", false)
+	configured := Register("test.configured", "enabled by the configuration", false)
+
+	config.GetConfig().Set("feature_flags", []string{"test.configured"})
+	defer config.GetConfig().Set("feature_flags", []string{})
+
+	Reset()
+	if !enabled.Enabled() || disabled.Enabled() || !configured.Enabled() {
+		t.Fatalf("Wrong default states: %+v", States())
+	}
+
+	Set(map[string]bool{"test.enabled": false, "test.disabled": true, "test.unknown": true})
+	if enabled.Enabled() || !disabled.Enabled() || !configured.Enabled() {
+		t.Fatalf("Flags not toggled: %+v", States())
+	}
+
+	if IsEnabled("test.unknown") {
+		t.Error("Unknown flags should be disabled")
+	}
+
+	// the flags not set anymore are reset to their default state
+	Set(map[string]bool{"test.configured": false})
+	if !enabled.Enabled() || disabled.Enabled() || configured.Enabled() {
+		t.Errorf("Flags not reset: %+v", States())
+	}
+}
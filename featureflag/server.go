@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package featureflag
+
+import (
+	"encoding/json"
+
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// Namespace FeatureFlag
+	Namespace = "FeatureFlag"
+)
+
+// Server applies the feature flags sent by the analyzers
+type Server struct {
+}
+
+// OnStructMessage event, the analyzers sending the state of all the flags
+// set through the API for this host
+func (s *Server) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	if msg.Type != "Set" {
+		return
+	}
+
+	var values map[string]bool
+	if err := json.Unmarshal(msg.Obj, &values); err != nil {
+		logging.GetLogger().Errorf("Unable to decode feature flags message %v", msg)
+		return
+	}
+
+	Set(values)
+}
+
+// NewServer creates a new feature flag server handling the messages of the
+// analyzers
+func NewServer(pool ws.StructSpeakerPool) *Server {
+	Reset()
+
+	s := &Server{}
+	pool.AddStructMessageHandler(s, []string{Namespace})
+	return s
+}
@@ -27,9 +27,12 @@ import (
 // TableAllocator aims to create/allocate a new flow table
 type TableAllocator struct {
 	common.RWMutex
-	update time.Duration
-	expire time.Duration
-	tables map[*Table]bool
+	update     time.Duration
+	expire     time.Duration
+	checkpoint *Checkpoint
+	dnsStats   *DNSStats
+	suspended  bool
+	tables     map[*Table]bool
 }
 
 // Expire returns the expire parameter used by allocated tables
@@ -60,6 +63,21 @@ func (a *TableAllocator) QueryTable(tq *TableQuery) *TableReply {
 	return reply
 }
 
+// Stats returns the statistics of all the running tables
+func (a *TableAllocator) Stats() []*TableStats {
+	a.RLock()
+	defer a.RUnlock()
+
+	var stats []*TableStats
+	for table := range a.tables {
+		if s := table.Stats(); s != nil {
+			stats = append(stats, s)
+		}
+	}
+
+	return stats
+}
+
 // Alloc instanciate/allocate a new table
 func (a *TableAllocator) Alloc(flowCallBack ExpireUpdateFunc, nodeTID string, opts TableOpts) *Table {
 	a.Lock()
@@ -68,11 +86,38 @@ func (a *TableAllocator) Alloc(flowCallBack ExpireUpdateFunc, nodeTID string, op
 	updateHandler := NewFlowHandler(flowCallBack, a.update)
 	expireHandler := NewFlowHandler(flowCallBack, a.expire)
 	t := NewTable(updateHandler, expireHandler, nodeTID, opts)
+	t.checkpoint = a.checkpoint
+	t.flowOpts.DNSStats = a.dnsStats
+	if a.suspended {
+		t.Suspend()
+	}
 	a.tables[t] = true
 
 	return t
 }
 
+// Suspend makes all the tables checkpoint their flows instead of expiring
+// them when stopped, used for planned restarts of the agent
+func (a *TableAllocator) Suspend() {
+	a.Lock()
+	defer a.Unlock()
+
+	a.suspended = true
+	for table := range a.tables {
+		table.Suspend()
+	}
+}
+
+// Flush expires the flows of all the tables
+func (a *TableAllocator) Flush() {
+	a.RLock()
+	defer a.RUnlock()
+
+	for table := range a.tables {
+		table.Flush()
+	}
+}
+
 // Release release/destroy a flow table
 func (a *TableAllocator) Release(t *Table) {
 	a.Lock()
@@ -80,11 +125,15 @@ func (a *TableAllocator) Release(t *Table) {
 	a.Unlock()
 }
 
-// NewTableAllocator creates a new flow table
-func NewTableAllocator(update, expire time.Duration) *TableAllocator {
+// NewTableAllocator creates a new flow table allocator, the flows of the
+// tables being checkpointed if checkpoint is not nil and their DNS messages
+// aggregated in dnsStats if not nil
+func NewTableAllocator(update, expire time.Duration, checkpoint *Checkpoint, dnsStats *DNSStats) *TableAllocator {
 	return &TableAllocator{
-		update: update,
-		expire: expire,
-		tables: make(map[*Table]bool),
+		update:     update,
+		expire:     expire,
+		checkpoint: checkpoint,
+		dnsStats:   dnsStats,
+		tables:     make(map[*Table]bool),
 	}
 }
@@ -0,0 +1,271 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package apptag
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/logging"
+)
+
+type rule struct {
+	name     string
+	priority int64
+	protocol string
+	ports    []types.PortRange
+	ipnet    *net.IPNet
+	query    string
+	nodes    map[string]bool
+}
+
+// Tagger sets the logical application name of the flows according to the
+// application rules
+type Tagger struct {
+	sync.RWMutex
+	graph   *graph.Graph
+	handler *api.ApplicationRuleAPI
+	watcher api.StoppableWatcher
+	rules   []*rule
+	refresh time.Duration
+	quit    chan bool
+	wg      sync.WaitGroup
+}
+
+func newRule(ar *types.ApplicationRule) (*rule, error) {
+	ports, err := ar.PortRanges()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rule{
+		name:     ar.Name,
+		priority: ar.Priority,
+		protocol: strings.ToUpper(ar.Protocol),
+		ports:    ports,
+		query:    ar.GremlinQuery,
+	}
+
+	if ar.CIDR != "" {
+		if _, r.ipnet, err = net.ParseCIDR(ar.CIDR); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *rule) matchProtocol(f *flow.Flow) bool {
+	for _, layer := range []*flow.FlowLayer{f.Link, f.Network} {
+		if layer != nil && layer.Protocol.String() == r.protocol {
+			return true
+		}
+	}
+	return f.Transport != nil && f.Transport.Protocol.String() == r.protocol
+}
+
+func (r *rule) matchPort(f *flow.Flow) bool {
+	if f.Transport == nil {
+		return false
+	}
+
+	for _, pr := range r.ports {
+		if (f.Transport.A >= pr.Min && f.Transport.A <= pr.Max) || (f.Transport.B >= pr.Min && f.Transport.B <= pr.Max) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) matchCIDR(f *flow.Flow) bool {
+	if f.Network == nil {
+		return false
+	}
+
+	for _, addr := range []string{f.Network.A, f.Network.B} {
+		if ip := net.ParseIP(addr); ip != nil && r.ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rule) match(f *flow.Flow) bool {
+	if r.protocol != "" && !r.matchProtocol(f) {
+		return false
+	}
+
+	if len(r.ports) > 0 && !r.matchPort(f) {
+		return false
+	}
+
+	if r.ipnet != nil && !r.matchCIDR(f) {
+		return false
+	}
+
+	if r.query != "" && !r.nodes[f.NodeTID] {
+		return false
+	}
+
+	return true
+}
+
+// resolveNodes returns the TIDs of the nodes selected by a Gremlin query
+func (t *Tagger) resolveNodes(query string) map[string]bool {
+	t.graph.RLock()
+	defer t.graph.RUnlock()
+
+	tids := make(map[string]bool)
+
+	res, err := ge.TopologyGremlinQuery(t.graph, query)
+	if err != nil {
+		logging.GetLogger().Errorf("Gremlin error for application rule: %s", err)
+		return tids
+	}
+
+	addNode := func(n *graph.Node) {
+		if tid, _ := n.GetFieldString("TID"); tid != "" {
+			tids[tid] = true
+		}
+	}
+
+	for _, value := range res.Values() {
+		switch value.(type) {
+		case *graph.Node:
+			addNode(value.(*graph.Node))
+		case []*graph.Node:
+			for _, n := range value.([]*graph.Node) {
+				addNode(n)
+			}
+		}
+	}
+
+	return tids
+}
+
+// setRules compiles the rules, sorted by decreasing priority
+func (t *Tagger) setRules(resources []*types.ApplicationRule) {
+	var rules []*rule
+	for _, resource := range resources {
+		r, err := newRule(resource)
+		if err != nil {
+			logging.GetLogger().Errorf("Invalid application rule %s: %s", resource.Name, err)
+			continue
+		}
+
+		if r.query != "" {
+			r.nodes = t.resolveNodes(r.query)
+		}
+		rules = append(rules, r)
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].priority != rules[j].priority {
+			return rules[i].priority > rules[j].priority
+		}
+		return rules[i].name < rules[j].name
+	})
+
+	t.Lock()
+	t.rules = rules
+	t.Unlock()
+}
+
+// Load (re)loads the application rules and resolves their Gremlin queries
+func (t *Tagger) Load() {
+	var resources []*types.ApplicationRule
+	for _, resource := range t.handler.Index() {
+		resources = append(resources, resource.(*types.ApplicationRule))
+	}
+
+	t.setRules(resources)
+}
+
+// Tag sets the application name of the first matching rule on the flow
+func (t *Tagger) Tag(f *flow.Flow) {
+	t.RLock()
+	defer t.RUnlock()
+
+	for _, r := range t.rules {
+		if r.match(f) {
+			f.AppName = r.name
+			return
+		}
+	}
+}
+
+func (t *Tagger) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	logging.GetLogger().Debugf("Application rule %s %s, reloading rules", id, action)
+	t.Load()
+}
+
+// Start loads the rules, watches their changes and periodically refreshes
+// the nodes selected by their Gremlin queries
+func (t *Tagger) Start() {
+	t.Load()
+
+	t.watcher = t.handler.AsyncWatch(t.onAPIWatcherEvent)
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.refresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				t.Load()
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the tagger
+func (t *Tagger) Stop() {
+	t.watcher.Stop()
+	t.quit <- true
+	t.wg.Wait()
+}
+
+// NewTagger returns a new tagger applying the rules of the given API handler
+func NewTagger(g *graph.Graph, handler *api.ApplicationRuleAPI) *Tagger {
+	refresh := time.Duration(config.GetInt("analyzer.flow.application_rules_refresh")) * time.Second
+	if refresh <= 0 {
+		refresh = 30 * time.Second
+	}
+
+	return &Tagger{
+		graph:   g,
+		handler: handler,
+		refresh: refresh,
+		quit:    make(chan bool),
+	}
+}
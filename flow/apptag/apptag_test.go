@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package apptag
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/flow"
+)
+
+func TestTag(t *testing.T) {
+	tagger := NewTagger(nil, nil)
+	tagger.setRules([]*types.ApplicationRule{
+		{Name: "web", Protocol: "tcp", Ports: "80,8000-8080"},
+		{Name: "backend", Priority: 10, CIDR: "10.0.1.0/24", Ports: "8080"},
+		{Name: "invalid", Ports: "80-70"},
+	})
+
+	newFlow := func(a, b string, port int64) *flow.Flow {
+		return &flow.Flow{
+			Network:   &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: a, B: b},
+			Transport: &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: 43210, B: port},
+		}
+	}
+
+	tests := []struct {
+		flow    *flow.Flow
+		appName string
+	}{
+		{newFlow("10.0.0.1", "10.0.0.2", 80), "web"},
+		{newFlow("10.0.0.1", "10.0.1.2", 8080), "backend"},
+		{newFlow("10.0.0.1", "10.0.0.2", 8080), "web"},
+		{newFlow("10.0.0.1", "10.0.1.2", 443), ""},
+	}
+
+	for _, test := range tests {
+		tagger.Tag(test.flow)
+		if test.flow.AppName != test.appName {
+			t.Errorf("Expected application %s for %+v, got %s", test.appName, test.flow.Transport, test.flow.AppName)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package flow
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/google/gopacket/layers"
+	"github.com/skydive-project/skydive/common"
+)
+
+// ARP operations
+const (
+	ARPRequest = "request"
+	ARPReply   = "reply"
+)
+
+// ARPOperation returns the name of an ARP operation
+func ARPOperation(op uint16) string {
+	switch op {
+	case layers.ARPRequest:
+		return ARPRequest
+	case layers.ARPReply:
+		return ARPReply
+	}
+	return ""
+}
+
+func (f *Flow) newARPLayer(packet *Packet) error {
+	arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || arp.Protocol != layers.EthernetTypeIPv4 {
+		return ErrLayerNotFound
+	}
+
+	f.ARP = &ARPLayer{
+		Operation: ARPOperation(arp.Operation),
+		SenderMAC: net.HardwareAddr(arp.SourceHwAddress).String(),
+		SenderIP:  net.IP(arp.SourceProtAddress).String(),
+		TargetIP:  net.IP(arp.DstProtAddress).String(),
+		// a probe, sent with an unspecified sender address, claims nothing
+		Gratuitous: bytes.Equal(arp.SourceProtAddress, arp.DstProtAddress) && !net.IP(arp.SourceProtAddress).IsUnspecified(),
+	}
+
+	return nil
+}
+
+// GetStringField returns the value of an ARP field
+func (a *ARPLayer) GetStringField(field string) (string, error) {
+	if a == nil {
+		return "", common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "Operation":
+		return a.Operation, nil
+	case "SenderMAC":
+		return a.SenderMAC, nil
+	case "SenderIP":
+		return a.SenderIP, nil
+	case "TargetIP":
+		return a.TargetIP, nil
+	default:
+		return "", common.ErrFieldNotFound
+	}
+}
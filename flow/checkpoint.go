@@ -0,0 +1,226 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointMagic identifies the flow table checkpoint files, the last byte
+// being the version of the format
+var checkpointMagic = []byte{'S', 'K', 'F', 'C', 1}
+
+// maxCheckpointChunk bounds the size of a decoded key or flow
+const maxCheckpointChunk = 16 * 1024 * 1024
+
+// ErrInvalidCheckpoint is returned when a checkpoint file can't be decoded
+var ErrInvalidCheckpoint = errors.New("Invalid flow table checkpoint")
+
+// Checkpoint saves the in-progress flows of the tables to disk so that they
+// keep their UUIDs and metrics when the tables are allocated again, after an
+// agent restart
+type Checkpoint struct {
+	dir   string
+	every time.Duration
+}
+
+// checkpointEntry is a flow of a table along with its table key and the
+// metric at the time of its last update
+type checkpointEntry struct {
+	key        string
+	flow       *Flow
+	lastMetric *FlowMetric
+}
+
+func (c *Checkpoint) filename(nodeTID string) string {
+	return filepath.Join(c.dir, nodeTID+".flows")
+}
+
+func writeChunk(w io.Writer, data []byte) error {
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(data)))
+	if _, err := w.Write(length[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readChunk(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxCheckpointChunk {
+		return nil, ErrInvalidCheckpoint
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// encodeCheckpoint marshals the last update time of a table followed by its entries
+func encodeCheckpoint(w io.Writer, lastUpdate int64, entries []*checkpointEntry) error {
+	if _, err := w.Write(checkpointMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, lastUpdate); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		flow, err := entry.flow.Marshal()
+		if err != nil {
+			return err
+		}
+
+		var lastMetric []byte
+		if entry.lastMetric != nil {
+			if lastMetric, err = entry.lastMetric.Marshal(); err != nil {
+				return err
+			}
+		}
+
+		for _, chunk := range [][]byte{[]byte(entry.key), flow, lastMetric} {
+			if err := writeChunk(w, chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func decodeCheckpoint(r io.Reader) (int64, []*checkpointEntry, error) {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(checkpointMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, checkpointMagic) {
+		return 0, nil, ErrInvalidCheckpoint
+	}
+
+	var lastUpdate int64
+	if err := binary.Read(br, binary.BigEndian, &lastUpdate); err != nil {
+		return 0, nil, ErrInvalidCheckpoint
+	}
+
+	var entries []*checkpointEntry
+	for {
+		key, err := readChunk(br)
+		if err == io.EOF {
+			return lastUpdate, entries, nil
+		}
+		if err != nil {
+			return 0, nil, ErrInvalidCheckpoint
+		}
+
+		entry := &checkpointEntry{key: string(key), flow: &Flow{}}
+
+		data, err := readChunk(br)
+		if err != nil {
+			return 0, nil, ErrInvalidCheckpoint
+		}
+		if err := entry.flow.Unmarshal(data); err != nil {
+			return 0, nil, fmt.Errorf("Unable to decode checkpointed flow: %s", err)
+		}
+
+		if data, err = readChunk(br); err != nil {
+			return 0, nil, ErrInvalidCheckpoint
+		}
+		if len(data) > 0 {
+			entry.lastMetric = &FlowMetric{}
+			if err := entry.lastMetric.Unmarshal(data); err != nil {
+				return 0, nil, fmt.Errorf("Unable to decode checkpointed flow metric: %s", err)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// save atomically replaces the checkpoint of a table
+func (c *Checkpoint) save(nodeTID string, lastUpdate int64, entries []*checkpointEntry) error {
+	tmp, err := ioutil.TempFile(c.dir, nodeTID)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	if err = encodeCheckpoint(w, lastUpdate, entries); err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.filename(nodeTID))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// load returns the checkpointed flows of a table, none if the table was not
+// checkpointed
+func (c *Checkpoint) load(nodeTID string) (int64, []*checkpointEntry, error) {
+	f, err := os.Open(c.filename(nodeTID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil, nil
+		}
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	return decodeCheckpoint(f)
+}
+
+// remove deletes the checkpoint of a table whose flows have been expired
+func (c *Checkpoint) remove(nodeTID string) error {
+	if err := os.Remove(c.filename(nodeTID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// NewCheckpoint returns a new checkpoint storing the flow tables into the
+// given directory every given duration
+func NewCheckpoint(dir string, every time.Duration) (*Checkpoint, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("Unable to create flow checkpoint directory %s: %s", dir, err)
+	}
+
+	return &Checkpoint{dir: dir, every: every}, nil
+}
@@ -18,6 +18,8 @@
 package flow
 
 import (
+	"time"
+
 	"github.com/golang/protobuf/proto"
 
 	"github.com/skydive-project/skydive/common"
@@ -27,10 +29,12 @@ import (
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
-// TableClient describes a mechanism to query a flow table
+// TableClient describes a mechanism to query a flow table. The lookups
+// return the flows received before the deadline, if not zero, reporting
+// whether some of the tables did not reply.
 type TableClient interface {
-	LookupFlows(flowSearchQuery filters.SearchQuery) (*FlowSet, error)
-	LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*FlowSet, error)
+	LookupFlows(flowSearchQuery filters.SearchQuery, deadline time.Time) (*FlowSet, bool, error)
+	LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery, deadline time.Time) (*FlowSet, bool, error)
 }
 
 // WSTableClient implements a flow table client using WebSocket
@@ -38,21 +42,42 @@ type WSTableClient struct {
 	structServer *ws.StructServer
 }
 
-func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSearchQuery filters.SearchQuery) {
+// requestTimeout returns the timeout of the requests to the agents so that
+// they don't last after the deadline
+func requestTimeout(deadline time.Time) time.Duration {
+	if deadline.IsZero() {
+		return ws.DefaultRequestTimeout
+	}
+	if timeout := time.Until(deadline); timeout < ws.DefaultRequestTimeout {
+		return timeout
+	}
+	return ws.DefaultRequestTimeout
+}
+
+// lookupFlows sends the flows of an agent to the channel, nil if the agent
+// didn't reply in time
+func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSearchQuery filters.SearchQuery, deadline time.Time) {
+	timeout := requestTimeout(deadline)
+	if timeout <= 0 {
+		flowset <- nil
+		return
+	}
+
 	tq := &TableQuery{Type: "SearchQuery", Query: &flowSearchQuery}
 	msg := ws.NewStructMessage(Namespace, "TableQuery", tq)
 
-	resp, err := f.structServer.Request(host, msg, ws.DefaultRequestTimeout)
+	resp, err := f.structServer.Request(host, msg, timeout)
 	if err != nil {
 		logging.GetLogger().Errorf("Unable to send message to agent %s: %s", host, err)
-		flowset <- NewFlowSet()
+		flowset <- nil
 		return
 	}
 
 	var reply TableReply
 	if resp == nil || proto.Unmarshal(resp.Obj, &reply) != nil {
 		logging.GetLogger().Errorf("Error returned while reading TableReply from: %s", host)
-		flowset <- NewFlowSet()
+		flowset <- nil
+		return
 	}
 
 	fs := NewFlowSet()
@@ -67,7 +92,8 @@ func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSear
 		var f FlowSet
 		if err := f.Unmarshal(b); err != nil {
 			logging.GetLogger().Errorf("Error returned while reading TableReply from: %s", host)
-			flowset <- NewFlowSet()
+			flowset <- nil
+			return
 		}
 
 		fs.Merge(&f, context)
@@ -75,17 +101,32 @@ func (f *WSTableClient) lookupFlows(flowset chan *FlowSet, host string, flowSear
 	flowset <- fs
 }
 
+// mergeFlowSets merges the flows of the agents, reporting whether some of
+// them didn't reply
+func mergeFlowSets(ch chan *FlowSet, count int, context MergeContext) (*FlowSet, bool, error) {
+	flowset := NewFlowSet()
+
+	var truncated bool
+	for i := 0; i != count; i++ {
+		if fs := <-ch; fs != nil {
+			flowset.Merge(fs, context)
+		} else {
+			truncated = true
+		}
+	}
+
+	return flowset, truncated, nil
+}
+
 // LookupFlows query flow table based on a filter search query
-func (f *WSTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
+func (f *WSTableClient) LookupFlows(flowSearchQuery filters.SearchQuery, deadline time.Time) (*FlowSet, bool, error) {
 	speakers := f.structServer.GetSpeakersByType(common.AgentService)
 	ch := make(chan *FlowSet, len(speakers))
 
 	for _, c := range speakers {
-		go f.lookupFlows(ch, c.GetRemoteHost(), flowSearchQuery)
+		go f.lookupFlows(ch, c.GetRemoteHost(), flowSearchQuery, deadline)
 	}
 
-	flowset := NewFlowSet()
-
 	// for sort order we assume that the SortOrder of a flowSearchQuery comes from
 	// an already validated entry.
 	context := MergeContext{
@@ -95,27 +136,20 @@ func (f *WSTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*FlowS
 		Dedup:     flowSearchQuery.Dedup,
 		DedupBy:   flowSearchQuery.DedupBy,
 	}
-	for i := 0; i != len(speakers); i++ {
-		fs := <-ch
-		flowset.Merge(fs, context)
-	}
-
-	return flowset, nil
+	return mergeFlowSets(ch, len(speakers), context)
 }
 
 // LookupFlowsByNodes query flow table based on multiple nodes
-func (f *WSTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*FlowSet, error) {
+func (f *WSTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery, deadline time.Time) (*FlowSet, bool, error) {
 	ch := make(chan *FlowSet, len(hnmap))
 
 	// We conserve the original filter to reuse it for each host
 	searchQuery := flowSearchQuery.Filter
 	for host, tids := range hnmap {
 		flowSearchQuery.Filter = filters.NewAndFilter(NewFilterForNodeTIDs(tids), searchQuery)
-		go f.lookupFlows(ch, host, flowSearchQuery)
+		go f.lookupFlows(ch, host, flowSearchQuery, deadline)
 	}
 
-	flowset := NewFlowSet()
-
 	// for sort order we assume that the SortOrder of a flowSearchQuery comes from
 	// an already validated entry.
 	context := MergeContext{
@@ -125,12 +159,7 @@ func (f *WSTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSe
 		Dedup:     flowSearchQuery.Dedup,
 		DedupBy:   flowSearchQuery.DedupBy,
 	}
-	for i := 0; i != len(hnmap); i++ {
-		fs := <-ch
-		flowset.Merge(fs, context)
-	}
-
-	return flowset, nil
+	return mergeFlowSets(ch, len(hnmap), context)
 }
 
 // NewWSTableClient creates a new table client based on websocket
@@ -0,0 +1,424 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package communication
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// RelationType of the edges linking the nodes communicating together
+const RelationType = "communicates-with"
+
+// endpoint of a flow, the MAC being empty when the flow has no ethernet layer
+type endpoint struct {
+	ip  string
+	mac string
+}
+
+// pair of endpoints communicating together, as seen on the capture node TID
+type pair struct {
+	a   endpoint
+	b   endpoint
+	tid string
+}
+
+// traffic exchanged by a pair of endpoints since the last update
+type traffic struct {
+	bytes        int64
+	packets      int64
+	last         int64
+	flows        map[string]bool
+	applications map[string]bool
+}
+
+// Linker aggregates the traffic of the flows and periodically links the
+// nodes owning their endpoints with communicates-with edges, reporting the
+// time the communication was last seen and its rate. The endpoints are
+// resolved by IP, the MAC and the namespace of the capture node being used
+// to pick one node when several share the address. The edges are removed
+// when no traffic was seen for expire.
+type Linker struct {
+	sync.Mutex
+	graph    *graph.Graph
+	traffic  map[pair]*traffic
+	edges    map[graph.Identifier]time.Time
+	interval time.Duration
+	expire   time.Duration
+	last     time.Time
+	quit     chan bool
+	wg       sync.WaitGroup
+}
+
+// edgeTraffic is the traffic between two nodes, as seen by each capture
+type edgeTraffic struct {
+	from     *graph.Node
+	to       *graph.Node
+	captures map[string]*traffic
+}
+
+// resolver looks up the nodes of the endpoints, the lookups being cached for
+// one update
+type resolver struct {
+	graph      *graph.Graph
+	ips        map[string][]*graph.Node
+	namespaces map[graph.Identifier]graph.Identifier
+	captures   map[string]graph.Identifier
+}
+
+func isUnicast(ip string) bool {
+	addr := net.ParseIP(ip)
+	return addr != nil && !addr.IsMulticast() && !addr.IsUnspecified() && !addr.Equal(net.IPv4bcast)
+}
+
+// Tag accounts the traffic of the flow, the flow is left untouched
+func (l *Linker) Tag(f *flow.Flow) {
+	if f.Network == nil || f.LastUpdateMetric == nil || f.NodeTID == "" {
+		return
+	}
+	if !isUnicast(f.Network.A) || !isUnicast(f.Network.B) {
+		return
+	}
+
+	p := pair{a: endpoint{ip: f.Network.A}, b: endpoint{ip: f.Network.B}, tid: f.NodeTID}
+	if f.Link != nil && f.Link.Protocol == flow.FlowProtocol_ETHERNET {
+		p.a.mac, p.b.mac = strings.ToLower(f.Link.A), strings.ToLower(f.Link.B)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	t, found := l.traffic[p]
+	if !found {
+		t = &traffic{flows: make(map[string]bool), applications: make(map[string]bool)}
+		l.traffic[p] = t
+	}
+
+	m := f.LastUpdateMetric
+	t.bytes += m.ABBytes + m.BABytes
+	t.packets += m.ABPackets + m.BAPackets
+	if f.Last > t.last {
+		t.last = f.Last
+	}
+	t.flows[f.UUID] = true
+	if f.Application != "" {
+		t.applications[f.Application] = true
+	}
+}
+
+func newResolver(g *graph.Graph) *resolver {
+	r := &resolver{
+		graph:      g,
+		ips:        make(map[string][]*graph.Node),
+		namespaces: make(map[graph.Identifier]graph.Identifier),
+		captures:   make(map[string]graph.Identifier),
+	}
+
+	for _, node := range g.GetNodes(nil) {
+		for _, key := range []string{"IPV4", "IPV6"} {
+			addrs, _ := node.GetFieldStringList(key)
+			for _, addr := range addrs {
+				ip := strings.Split(addr, "/")[0]
+				r.ips[ip] = append(r.ips[ip], node)
+			}
+		}
+	}
+
+	return r
+}
+
+// namespace returns the ID of the netns or host node owning a node, walking
+// up the ownership edges
+func (r *resolver) namespace(node *graph.Node) graph.Identifier {
+	if ns, found := r.namespaces[node.ID]; found {
+		return ns
+	}
+
+	var ns graph.Identifier
+	visited := map[graph.Identifier]bool{}
+	for n := node; n != nil && !visited[n.ID]; {
+		visited[n.ID] = true
+		if tp, _ := n.GetFieldString("Type"); tp == "netns" || tp == "host" {
+			ns = n.ID
+			break
+		}
+
+		parents := r.graph.LookupParents(n, nil, topology.OwnershipMetadata())
+		if len(parents) == 0 {
+			break
+		}
+		n = parents[0]
+	}
+
+	r.namespaces[node.ID] = ns
+	return ns
+}
+
+// captureNamespace returns the namespace of the capture node with the TID
+func (r *resolver) captureNamespace(tid string) graph.Identifier {
+	if ns, found := r.captures[tid]; found {
+		return ns
+	}
+
+	var ns graph.Identifier
+	if node := r.graph.LookupFirstNode(graph.Metadata{"TID": tid}); node != nil {
+		ns = r.namespace(node)
+	}
+	r.captures[tid] = ns
+	return ns
+}
+
+func filterNodes(nodes []*graph.Node, keep func(n *graph.Node) bool) (filtered []*graph.Node) {
+	for _, n := range nodes {
+		if keep(n) {
+			filtered = append(filtered, n)
+		}
+	}
+	return
+}
+
+// resolve returns the node owning an endpoint, nil if unknown or ambiguous.
+// The MAC is only used when one of the nodes has it, the MAC of a routed
+// flow being the one of the router.
+func (r *resolver) resolve(e endpoint, ns graph.Identifier) *graph.Node {
+	candidates := r.ips[e.ip]
+
+	if e.mac != "" && len(candidates) > 1 {
+		byMAC := filterNodes(candidates, func(n *graph.Node) bool {
+			mac, _ := n.GetFieldString("MAC")
+			return strings.EqualFold(mac, e.mac)
+		})
+		if len(byMAC) > 0 {
+			candidates = byMAC
+		}
+	}
+
+	if ns != "" && len(candidates) > 1 {
+		byNamespace := filterNodes(candidates, func(n *graph.Node) bool {
+			return r.namespace(n) == ns
+		})
+		if len(byNamespace) > 0 {
+			candidates = byNamespace
+		}
+	}
+
+	if len(candidates) != 1 {
+		return nil
+	}
+	return candidates[0]
+}
+
+func keys(m map[string]bool) []string {
+	l := make([]string, 0, len(m))
+	for k := range m {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// aggregate returns the traffic of the pairs per edge, a communication
+// captured on several nodes being accounted once per capture
+func (l *Linker) aggregate(traffics map[pair]*traffic) map[graph.Identifier]*edgeTraffic {
+	r := newResolver(l.graph)
+
+	edges := make(map[graph.Identifier]*edgeTraffic)
+	for p, t := range traffics {
+		ns := r.captureNamespace(p.tid)
+
+		from, to := r.resolve(p.a, ns), r.resolve(p.b, ns)
+		if from == nil || to == nil || from.ID == to.ID {
+			continue
+		}
+
+		id := graph.GenID(string(from.ID), string(to.ID), "RelationType", RelationType)
+		et, found := edges[id]
+		if !found {
+			et = &edgeTraffic{from: from, to: to, captures: make(map[string]*traffic)}
+			edges[id] = et
+		}
+
+		if ct, found := et.captures[p.tid]; found {
+			ct.bytes += t.bytes
+			ct.packets += t.packets
+			if t.last > ct.last {
+				ct.last = t.last
+			}
+			for k := range t.flows {
+				ct.flows[k] = true
+			}
+			for k := range t.applications {
+				ct.applications[k] = true
+			}
+		} else {
+			et.captures[p.tid] = t
+		}
+	}
+
+	return edges
+}
+
+// metadata returns the metadata of an edge, the rate being the one of the
+// capture that saw the most traffic
+func (et *edgeTraffic) metadata(seconds float64) graph.Metadata {
+	var bytes, packets, last int64
+	flows, applications := make(map[string]bool), make(map[string]bool)
+	for _, t := range et.captures {
+		if t.bytes > bytes {
+			bytes, packets = t.bytes, t.packets
+		}
+		if t.last > last {
+			last = t.last
+		}
+		for k := range t.flows {
+			flows[k] = true
+		}
+		for k := range t.applications {
+			applications[k] = true
+		}
+	}
+
+	return graph.Metadata{
+		"RelationType": RelationType,
+		"LastSeen":     last,
+		"Rate": map[string]interface{}{
+			"BytesPerSecond":   float64(bytes) / seconds,
+			"PacketsPerSecond": float64(packets) / seconds,
+		},
+		"Flows":        int64(len(flows)),
+		"Applications": keys(applications),
+	}
+}
+
+func (l *Linker) update(now time.Time) {
+	l.Lock()
+	traffics := l.traffic
+	l.traffic = make(map[pair]*traffic)
+	seconds := now.Sub(l.last).Seconds()
+	l.last = now
+	l.Unlock()
+
+	if seconds <= 0 {
+		return
+	}
+
+	l.graph.Lock()
+	defer l.graph.Unlock()
+
+	for id, et := range l.aggregate(traffics) {
+		m := et.metadata(seconds)
+		l.edges[id] = now
+
+		if edge := l.graph.GetEdge(id); edge != nil {
+			if err := l.graph.SetMetadata(edge, m); err != nil {
+				logging.GetLogger().Error(err)
+			}
+			continue
+		}
+
+		if err := l.graph.AddEdge(l.graph.CreateEdge(id, et.from, et.to, m, graph.TimeUTC(), "")); err != nil {
+			logging.GetLogger().Error(err)
+		}
+	}
+
+	idle := map[string]interface{}{"BytesPerSecond": float64(0), "PacketsPerSecond": float64(0)}
+	for id, seen := range l.edges {
+		if seen.Equal(now) {
+			continue
+		}
+
+		edge := l.graph.GetEdge(id)
+		switch {
+		case edge == nil:
+			delete(l.edges, id)
+		case now.Sub(seen) >= l.expire:
+			if err := l.graph.DelEdge(edge); err != nil {
+				logging.GetLogger().Error(err)
+			}
+			delete(l.edges, id)
+		default:
+			if err := l.graph.AddMetadata(edge, "Rate", idle); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+}
+
+// Start periodically updates the communicates-with edges
+func (l *Linker) Start() {
+	l.Lock()
+	l.last = time.Now().UTC()
+	l.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				l.update(now.UTC())
+			case <-l.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the linker
+func (l *Linker) Stop() {
+	l.quit <- true
+	l.wg.Wait()
+}
+
+// NewLinker returns a new linker updating the edges every interval and
+// removing them after expire without traffic
+func NewLinker(g *graph.Graph, interval, expire time.Duration) *Linker {
+	return &Linker{
+		graph:    g,
+		traffic:  make(map[pair]*traffic),
+		edges:    make(map[graph.Identifier]time.Time),
+		interval: interval,
+		expire:   expire,
+		quit:     make(chan bool),
+	}
+}
+
+// NewLinkerFromConfig returns a new linker, nil if disabled by the
+// configuration
+func NewLinkerFromConfig(g *graph.Graph) *Linker {
+	interval := config.GetInt("analyzer.flow.communication.interval")
+	if interval <= 0 {
+		return nil
+	}
+
+	expire := config.GetInt("analyzer.flow.communication.expire")
+	return NewLinker(g, time.Duration(interval)*time.Second, time.Duration(expire)*time.Second)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package communication
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func newFlow(uuid, tid, a, b string, bytes int64) *flow.Flow {
+	return &flow.Flow{
+		UUID:             uuid,
+		NodeTID:          tid,
+		Application:      "TCP",
+		Network:          &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: a, B: b},
+		LastUpdateMetric: &flow.FlowMetric{ABBytes: bytes, BABytes: bytes, ABPackets: 1, BAPackets: 1},
+		Last:             1000,
+	}
+}
+
+func TestLinker(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AnalyzerService)
+
+	g.Lock()
+	host, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host", "Type": "host"})
+	ns1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "ns1", "Type": "netns"})
+	ns2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "ns2", "Type": "netns"})
+	topology.AddOwnershipLink(g, host, ns1, nil)
+	topology.AddOwnershipLink(g, host, ns2, nil)
+
+	// the same address is used in both namespaces
+	client1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "veth", "TID": "tid1", "IPV4": []string{"10.0.0.1/24"}})
+	client2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "veth", "TID": "tid2", "IPV4": []string{"10.0.0.1/24"}})
+	topology.AddOwnershipLink(g, ns1, client1, nil)
+	topology.AddOwnershipLink(g, ns2, client2, nil)
+	server, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Type": "device", "IPV4": []string{"10.0.0.2/24"}})
+	topology.AddOwnershipLink(g, host, server, nil)
+	g.Unlock()
+
+	l := NewLinker(g, 10*time.Second, time.Minute)
+	start := time.Now().UTC()
+	l.last = start
+
+	l.Tag(newFlow("f1", "tid1", "10.0.0.1", "10.0.0.2", 500))
+	l.Tag(newFlow("f2", "tid1", "10.0.0.1", "10.0.0.2", 500))
+	l.Tag(newFlow("f3", "tid1", "10.0.0.1", "10.0.0.99", 500))
+	l.Tag(newFlow("f4", "tid1", "10.0.0.1", "224.0.0.1", 500))
+	l.update(start.Add(10 * time.Second))
+
+	g.RLock()
+	edges := g.GetEdges(graph.Metadata{"RelationType": RelationType})
+	g.RUnlock()
+	if len(edges) != 1 {
+		t.Fatalf("Expected one edge, got %+v", edges)
+	}
+
+	edge := edges[0]
+	if edge.Parent != client1.ID || edge.Child != server.ID {
+		t.Errorf("Expected an edge from the client in the namespace of the capture, got %+v", edge)
+	}
+	if rate, _ := edge.GetFieldInt64("Rate.BytesPerSecond"); rate != 200 {
+		t.Errorf("Expected a rate of 200 bytes per second, got %+v", edge.Metadata)
+	}
+	if flows, _ := edge.GetFieldInt64("Flows"); flows != 2 {
+		t.Errorf("Expected 2 flows, got %+v", edge.Metadata)
+	}
+
+	// no traffic, the rate drops to 0
+	l.update(start.Add(20 * time.Second))
+	g.RLock()
+	edge = g.GetEdge(edge.ID)
+	g.RUnlock()
+	if edge == nil {
+		t.Fatal("Expected the edge to be kept until it expires")
+	}
+	if rate, _ := edge.GetFieldInt64("Rate.BytesPerSecond"); rate != 0 {
+		t.Errorf("Expected an idle edge, got %+v", edge.Metadata)
+	}
+
+	// expired
+	l.update(start.Add(80 * time.Second))
+	g.RLock()
+	edges = g.GetEdges(graph.Metadata{"RelationType": RelationType})
+	g.RUnlock()
+	if len(edges) != 0 {
+		t.Errorf("Expected the edge to expire, got %+v", edges)
+	}
+}
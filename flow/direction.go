@@ -0,0 +1,132 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"net"
+	"strings"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Endpoint scopes
+const (
+	ScopeInternal = "INTERNAL"
+	ScopeExternal = "EXTERNAL"
+)
+
+// Flow directions
+const (
+	DirectionIngress  = "INGRESS"
+	DirectionEgress   = "EGRESS"
+	DirectionInternal = "INTERNAL"
+	DirectionExternal = "EXTERNAL"
+)
+
+// InternalNetworks holds the networks considered as internal and used
+// to classify flow endpoints and direction
+type InternalNetworks struct {
+	nets []*net.IPNet
+}
+
+// NewInternalNetworks returns a classifier for the given list of CIDRs.
+// A plain IP address is considered as a host network.
+func NewInternalNetworks(cidrs []string) (*InternalNetworks, error) {
+	in := &InternalNetworks{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		in.nets = append(in.nets, ipnet)
+	}
+
+	return in, nil
+}
+
+// NewInternalNetworksFromConfig returns a classifier loaded from the
+// flow.internal_networks configuration entry
+func NewInternalNetworksFromConfig() *InternalNetworks {
+	var cidrs []string
+	for _, cidr := range config.GetStringSlice("flow.internal_networks") {
+		if _, err := NewInternalNetworks([]string{cidr}); err != nil {
+			logging.GetLogger().Errorf("Unable to parse internal network %s: %s", cidr, err)
+			continue
+		}
+		cidrs = append(cidrs, cidr)
+	}
+
+	in, _ := NewInternalNetworks(cidrs)
+	return in
+}
+
+// IsInternal returns whether the given address belongs to an internal network
+func (in *InternalNetworks) IsInternal(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipnet := range in.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scope returns the scope, internal or external, of an address
+func (in *InternalNetworks) Scope(addr string) string {
+	if in.IsInternal(addr) {
+		return ScopeInternal
+	}
+	return ScopeExternal
+}
+
+// Direction returns the direction of a flow initiated by a toward b
+func (in *InternalNetworks) Direction(a, b string) string {
+	switch aInternal, bInternal := in.IsInternal(a), in.IsInternal(b); {
+	case aInternal && bInternal:
+		return DirectionInternal
+	case aInternal:
+		return DirectionEgress
+	case bInternal:
+		return DirectionIngress
+	default:
+		return DirectionExternal
+	}
+}
+
+func (f *Flow) classify(in *InternalNetworks) {
+	if in == nil || len(in.nets) == 0 || f.Network == nil {
+		return
+	}
+
+	f.AScope = in.Scope(f.Network.A)
+	f.BScope = in.Scope(f.Network.B)
+	f.Direction = in.Direction(f.Network.A, f.Network.B)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import "testing"
+
+func TestFlowDirection(t *testing.T) {
+	in, err := NewInternalNetworks([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		a, b      string
+		direction string
+		aScope    string
+		bScope    string
+	}{
+		{"10.0.0.1", "10.1.0.1", DirectionInternal, ScopeInternal, ScopeInternal},
+		{"10.0.0.1", "8.8.8.8", DirectionEgress, ScopeInternal, ScopeExternal},
+		{"8.8.8.8", "192.168.1.1", DirectionIngress, ScopeExternal, ScopeInternal},
+		{"8.8.8.8", "192.168.1.2", DirectionExternal, ScopeExternal, ScopeExternal},
+		{"fd00::1", "2001:db8::1", DirectionEgress, ScopeInternal, ScopeExternal},
+	}
+
+	for _, test := range tests {
+		f := &Flow{Network: &FlowLayer{Protocol: FlowProtocol_IPV4, A: test.a, B: test.b}}
+		f.classify(in)
+
+		if f.Direction != test.direction || f.AScope != test.aScope || f.BScope != test.bScope {
+			t.Errorf("Wrong classification for %s -> %s: %s %s %s", test.a, test.b, f.Direction, f.AScope, f.BScope)
+		}
+	}
+
+	if _, err := NewInternalNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Invalid network should be rejected")
+	}
+}
@@ -0,0 +1,315 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+	fl "github.com/skydive-project/skydive/flow/layers"
+)
+
+const (
+	// DefaultDNSMaxDomains is the default number of domains whose
+	// statistics are kept between two reports
+	DefaultDNSMaxDomains = 1000
+
+	// dnsMaxRecords is the maximum number of questions and answers kept in
+	// the DNS layer of a flow
+	dnsMaxRecords = 32
+	// dnsMaxNames is the maximum number of distinct names counted by domain
+	dnsMaxNames = 1024
+)
+
+var dnsResponseCodes = map[layers.DNSResponseCode]string{
+	0:  "NOERROR",
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+// DNSResponseCodeString returns the mnemonic of a DNS response code
+func DNSResponseCodeString(code layers.DNSResponseCode) string {
+	if s, ok := dnsResponseCodes[code]; ok {
+		return s
+	}
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+// dnsBaseDomain returns the last two labels of a name, the statistics
+// being aggregated by base domain so that the names generated to tunnel
+// data are accounted in the same entry
+func dnsBaseDomain(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		if j := strings.LastIndexByte(name[:i], '.'); j >= 0 {
+			return name[j+1:]
+		}
+	}
+	return name
+}
+
+// dnsAnswer returns the data of a resource record as a string
+func dnsAnswer(rr *layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return rr.IP.String()
+	case layers.DNSTypeCNAME:
+		return string(rr.CNAME)
+	case layers.DNSTypeNS:
+		return string(rr.NS)
+	case layers.DNSTypePTR:
+		return string(rr.PTR)
+	case layers.DNSTypeMX:
+		return string(rr.MX.Name)
+	case layers.DNSTypeSRV:
+		return fmt.Sprintf("%s:%d", rr.SRV.Name, rr.SRV.Port)
+	case layers.DNSTypeTXT:
+		txts := make([]string, len(rr.TXTs))
+		for i, txt := range rr.TXTs {
+			txts[i] = string(txt)
+		}
+		return strings.Join(txts, " ")
+	default:
+		return rr.Type.String()
+	}
+}
+
+func containsString(s string, values []string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// updateDNS reports the DNS messages of a flow, the questions and answers
+// of the successive messages being merged
+func (f *Flow) updateDNS(packet *Packet, opts Opts) {
+	if (opts.ExtraLayers & DNSLayer) == 0 {
+		return
+	}
+
+	layer := packet.Layer(layers.LayerTypeDNS)
+	if layer == nil {
+		return
+	}
+	d := layer.(*layers.DNS)
+
+	if opts.DNSStats != nil {
+		opts.DNSStats.add(d, packet.GoPacket.Metadata().CaptureInfo.Timestamp)
+	}
+
+	dns := f.DNS
+	if dns == nil {
+		dns = &fl.DNS{}
+		f.DNS = dns
+	}
+
+	dns.AA, dns.ID, dns.QR, dns.RA, dns.RD, dns.TC = d.AA, d.ID, d.QR, d.RA, d.RD, d.TC
+	dns.ANCount, dns.ARCount, dns.NSCount, dns.QDCount = d.ANCount, d.ARCount, d.NSCount, d.QDCount
+
+	for _, q := range d.Questions {
+		if len(dns.DNSQuestions) < dnsMaxRecords && !containsString(string(q.Name), dns.DNSQuestions) {
+			dns.DNSQuestions = append(dns.DNSQuestions, string(q.Name))
+		}
+		if qtype := q.Type.String(); !containsString(qtype, dns.DNSQueryTypes) {
+			dns.DNSQueryTypes = append(dns.DNSQueryTypes, qtype)
+		}
+	}
+
+	if !d.QR {
+		return
+	}
+	dns.DNSRcode = DNSResponseCodeString(d.ResponseCode)
+
+	for i := range d.Answers {
+		answer := dnsAnswer(&d.Answers[i])
+		if len(dns.DNSAnswers) < dnsMaxRecords && !containsString(answer, dns.DNSAnswers) {
+			dns.DNSAnswers = append(dns.DNSAnswers, answer)
+			dns.DNSAnswerTTLs = append(dns.DNSAnswerTTLs, d.Answers[i].TTL)
+		}
+	}
+}
+
+type dnsDomainStats struct {
+	queries  int64
+	nxdomain int64
+	names    map[string]bool
+}
+
+// DNSDomainStats holds the statistics of a domain
+type DNSDomainStats struct {
+	Domain   string
+	Queries  int64
+	NXDomain int64
+	// number of distinct names queried, up to 1024
+	Names int64
+}
+
+// DNSStatsReport holds the DNS statistics of an interval
+type DNSStatsReport struct {
+	Start         int64
+	Last          int64
+	Queries       int64
+	Responses     int64
+	NXDomain      int64
+	NXDomainRate  float64
+	ResponseCodes map[string]int64
+	TopDomains    []DNSDomainStats
+}
+
+// DNSStats aggregates the DNS queries and responses of the flow tables of an
+// agent, by response code and by base domain
+type DNSStats struct {
+	sync.Mutex
+	maxDomains int
+	start      int64
+	last       int64
+	queries    int64
+	responses  int64
+	rcodes     map[string]int64
+	domains    map[string]*dnsDomainStats
+}
+
+func (s *DNSStats) domain(name string) *dnsDomainStats {
+	base := dnsBaseDomain(name)
+	if ds, found := s.domains[base]; found {
+		return ds
+	}
+
+	if len(s.domains) >= s.maxDomains {
+		// make room by dropping the least queried domain
+		var evicted string
+		var min int64 = -1
+		for domain, ds := range s.domains {
+			if min == -1 || ds.queries < min {
+				evicted, min = domain, ds.queries
+			}
+		}
+		delete(s.domains, evicted)
+	}
+
+	ds := &dnsDomainStats{names: make(map[string]bool)}
+	s.domains[base] = ds
+	return ds
+}
+
+func (s *DNSStats) add(d *layers.DNS, ts time.Time) {
+	if len(d.Questions) == 0 {
+		return
+	}
+	name := strings.ToLower(string(d.Questions[0].Name))
+
+	s.Lock()
+	defer s.Unlock()
+
+	now := common.UnixMillis(ts)
+	if s.start == 0 {
+		s.start = now
+	}
+	s.last = now
+
+	ds := s.domain(name)
+	if !d.QR {
+		s.queries++
+		ds.queries++
+		if len(ds.names) < dnsMaxNames {
+			ds.names[name] = true
+		}
+		return
+	}
+
+	s.responses++
+	s.rcodes[DNSResponseCodeString(d.ResponseCode)]++
+	if d.ResponseCode == layers.DNSResponseCodeNXDomain {
+		ds.nxdomain++
+	}
+}
+
+// Report returns the statistics since the previous report with the top
+// domains by number of queries, the statistics being reset
+func (s *DNSStats) Report(top int) *DNSStatsReport {
+	s.Lock()
+	defer s.Unlock()
+
+	report := &DNSStatsReport{
+		Start:         s.start,
+		Last:          s.last,
+		Queries:       s.queries,
+		Responses:     s.responses,
+		NXDomain:      s.rcodes["NXDOMAIN"],
+		ResponseCodes: s.rcodes,
+	}
+	if s.responses > 0 {
+		report.NXDomainRate = float64(report.NXDomain) / float64(s.responses)
+	}
+
+	domains := make([]DNSDomainStats, 0, len(s.domains))
+	for domain, ds := range s.domains {
+		domains = append(domains, DNSDomainStats{
+			Domain:   domain,
+			Queries:  ds.queries,
+			NXDomain: ds.nxdomain,
+			Names:    int64(len(ds.names)),
+		})
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Queries != domains[j].Queries {
+			return domains[i].Queries > domains[j].Queries
+		}
+		return domains[i].Domain < domains[j].Domain
+	})
+	if len(domains) > top {
+		domains = domains[:top]
+	}
+	report.TopDomains = domains
+
+	s.start, s.last, s.queries, s.responses = 0, 0, 0, 0
+	s.rcodes = make(map[string]int64)
+	s.domains = make(map[string]*dnsDomainStats)
+
+	return report
+}
+
+// NewDNSStats returns a new DNS statistics table keeping at most maxDomains domains
+func NewDNSStats(maxDomains int) *DNSStats {
+	if maxDomains <= 0 {
+		maxDomains = DefaultDNSMaxDomains
+	}
+
+	return &DNSStats{
+		maxDomains: maxDomains,
+		rcodes:     make(map[string]int64),
+		domains:    make(map[string]*dnsDomainStats),
+	}
+}
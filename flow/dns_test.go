@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/filters"
+)
+
+func dnsPacket(t *testing.T, ts time.Time, response bool, dns *layers.DNS) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{192, 168, 0, 1},
+		DstIP:    net.IP{192, 168, 0, 53},
+	}
+	udp := &layers.UDP{SrcPort: 41000, DstPort: 53}
+	if response {
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		udp.SrcPort, udp.DstPort = udp.DstPort, udp.SrcPort
+	}
+	return forgeEthernetPacket(t, ts, eth, ip, udp, dns)
+}
+
+func dnsQuestion(name string, qtype layers.DNSType) layers.DNSQuestion {
+	return layers.DNSQuestion{Name: []byte(name), Type: qtype, Class: layers.DNSClassIN}
+}
+
+func TestFlowDNS(t *testing.T) {
+	stats := NewDNSStats(10)
+	table := NewTable(nil, nil, "", TableOpts{ExtraLayers: DNSLayer})
+	table.flowOpts.DNSStats = stats
+
+	a := dnsQuestion("www.example.org", layers.DNSTypeA)
+	aaaa := dnsQuestion("www.example.org", layers.DNSTypeAAAA)
+	nx := dnsQuestion("x1.tunnel.example.net", layers.DNSTypeTXT)
+
+	now := time.Now()
+	packets := []gopacket.Packet{
+		dnsPacket(t, now, false, &layers.DNS{ID: 1, RD: true, Questions: []layers.DNSQuestion{a}}),
+		dnsPacket(t, now, false, &layers.DNS{ID: 2, RD: true, Questions: []layers.DNSQuestion{aaaa}}),
+		dnsPacket(t, now, true, &layers.DNS{ID: 1, QR: true, RD: true, RA: true, Questions: []layers.DNSQuestion{a},
+			Answers: []layers.DNSResourceRecord{
+				{Name: []byte("www.example.org"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 3600, CNAME: []byte("web.example.org")},
+				{Name: []byte("web.example.org"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 300, IP: net.IP{10, 0, 0, 1}},
+			}}),
+		dnsPacket(t, now, true, &layers.DNS{ID: 2, QR: true, RD: true, RA: true, Questions: []layers.DNSQuestion{aaaa}}),
+		dnsPacket(t, now, false, &layers.DNS{ID: 3, RD: true, Questions: []layers.DNSQuestion{nx}}),
+		dnsPacket(t, now, true, &layers.DNS{ID: 3, QR: true, ResponseCode: layers.DNSResponseCodeNXDomain, Questions: []layers.DNSQuestion{nx}}),
+	}
+
+	for _, packet := range packets {
+		table.processPacketSeq(PacketSeqFromGoPacket(packet, 0, nil, nil))
+	}
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should get 1 flow, got %d", len(flows))
+	}
+
+	dns := flows[0].DNS
+	if dns == nil {
+		t.Fatalf("DNS layer missing: %+v", flows[0])
+	}
+
+	expected := map[string][]string{
+		"questions": {"www.example.org", "x1.tunnel.example.net"},
+		"types":     {"A", "AAAA", "TXT"},
+		"answers":   {"web.example.org", "10.0.0.1"},
+	}
+	for key, values := range map[string][]string{"questions": dns.DNSQuestions, "types": dns.DNSQueryTypes, "answers": dns.DNSAnswers} {
+		if len(values) != len(expected[key]) {
+			t.Errorf("Wrong DNS %s, expected %v, got %v", key, expected[key], values)
+			continue
+		}
+		for i := range values {
+			if values[i] != expected[key][i] {
+				t.Errorf("Wrong DNS %s, expected %v, got %v", key, expected[key], values)
+			}
+		}
+	}
+
+	if len(dns.DNSAnswerTTLs) != 2 || dns.DNSAnswerTTLs[0] != 3600 || dns.DNSAnswerTTLs[1] != 300 {
+		t.Errorf("Wrong DNS answer TTLs: %v", dns.DNSAnswerTTLs)
+	}
+
+	if rcode, err := flows[0].GetFieldString("DNS.DNSRcode"); err != nil || rcode != "NXDOMAIN" {
+		t.Errorf("Wrong DNS response code: %s, %v", rcode, err)
+	}
+
+	report := stats.Report(1)
+	if report.Queries != 3 || report.Responses != 3 || report.NXDomain != 1 || report.ResponseCodes["NOERROR"] != 2 {
+		t.Errorf("Wrong DNS statistics: %+v", report)
+	}
+
+	if len(report.TopDomains) != 1 || report.TopDomains[0] != (DNSDomainStats{Domain: "example.org", Queries: 2, Names: 1}) {
+		t.Errorf("Wrong DNS top domains: %+v", report.TopDomains)
+	}
+
+	if report = stats.Report(10); report.Queries != 0 || len(report.TopDomains) != 0 {
+		t.Errorf("DNS statistics not reset: %+v", report)
+	}
+}
+
+func TestDNSStatsEviction(t *testing.T) {
+	stats := NewDNSStats(2)
+
+	now := time.Now()
+	for _, name := range []string{"a.example.org", "b.example.org", "example.com", "c.test.io"} {
+		stats.add(&layers.DNS{Questions: []layers.DNSQuestion{dnsQuestion(name, layers.DNSTypeA)}}, now)
+	}
+
+	report := stats.Report(10)
+	if len(report.TopDomains) != 2 || report.TopDomains[0].Domain != "example.org" || report.TopDomains[0].Names != 2 ||
+		report.TopDomains[1].Domain != "test.io" {
+		t.Errorf("Wrong DNS top domains: %+v", report.TopDomains)
+	}
+}
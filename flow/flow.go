@@ -62,6 +62,10 @@ type flowState struct {
 	lastMetric    *FlowMetric
 	rtt1stPacket  int64
 	updateVersion int64
+	memory        int64
+	tlsRecords    [2][]byte
+	tlsSession    *tlsSession
+	http          *httpState
 }
 
 // Packet describes one packet
@@ -72,6 +76,7 @@ type Packet struct {
 	Data     []byte           // byte of the sub packet
 	Length   int64            // length of the original packet meaning layers + payload
 	IPMetric *IPMetric
+	Tunnel   *TunnelLayer // tunnel the sub packet was encapsulated in
 
 	linkLayer      gopacket.LinkLayer      // fast access to link layer
 	networkLayer   gopacket.NetworkLayer   // fast access to network layer
@@ -81,12 +86,16 @@ type Packet struct {
 // PacketSequence represents a suite of parent/child Packet
 type PacketSequence struct {
 	Packets []*Packet
+	// Weight is the number of packets the sequence stands for when sampled
+	Weight int64
 }
 
-// RawPackets embeds flow RawPacket array with the associated link type
+// RawPackets embeds flow RawPacket array with the associated link type and
+// the TID of the node they were captured on
 type RawPackets struct {
 	LinkType   layers.LinkType
 	RawPackets []*RawPacket
+	NodeTID    string `json:",omitempty"`
 }
 
 // LayerKeyMode defines what are the layers used for the flow key calculation
@@ -109,6 +118,8 @@ const (
 	DNSLayer ExtraLayers = 2
 	// DHCPv4Layer extra layer
 	DHCPv4Layer ExtraLayers = 4
+	// HTTPLayer extra layer
+	HTTPLayer ExtraLayers = 8
 	// ALLLayer all extra layers
 	ALLLayer ExtraLayers = 255
 )
@@ -117,6 +128,7 @@ var extraLayersMap = map[string]ExtraLayers{
 	"VRRP":   VRRPLayer,
 	"DNS":    DNSLayer,
 	"DHCPv4": DHCPv4Layer,
+	"HTTP":   HTTPLayer,
 }
 
 // Parse set the ExtraLayers struct with the given list of protocol strings
@@ -169,6 +181,9 @@ type Opts struct {
 	LayerKeyMode LayerKeyMode
 	AppPortMap   *ApplicationPortMap
 	ExtraLayers  ExtraLayers
+	InternalNets *InternalNetworks
+	PortMask     *PortMask
+	DNSStats     *DNSStats
 }
 
 // UUIDs describes UUIDs that can be applied to flows
@@ -273,7 +288,18 @@ func (p *Packet) ApplicationFlow() (gopacket.Flow, error) {
 		l := layer.(*layers.ICMPv6)
 		t := ICMPv6TypeToFlowICMPType(l.TypeCode.Type())
 		binary.BigEndian.PutUint32(value32, uint32(t)<<24|uint32(l.TypeCode.Code())<<16)
+
+		// neighbor discovery messages for distinct targets are distinct flows
+		if target := ICMPv6Target(p); target != nil {
+			return gopacket.NewFlow(0, value32, target.To16()), nil
+		}
 		return gopacket.NewFlow(0, value32, nil), nil
+	} else if layer := p.Layer(layers.LayerTypeARP); layer != nil {
+		l := layer.(*layers.ARP)
+		binary.BigEndian.PutUint32(value32, uint32(l.Operation))
+
+		// distinct bindings claimed are distinct flows
+		return gopacket.NewFlow(0, value32, append(append([]byte{}, l.SourceHwAddress...), l.SourceProtAddress...)), nil
 	}
 
 	return gopacket.Flow{}, ErrLayerNotFound
@@ -324,7 +350,7 @@ func (p *Packet) Key(parentUUID string, opts Opts) string {
 		uuid ^= layer.NetworkFlow().FastHash()
 	}
 	if tf, err := p.TransportFlow(); err == nil {
-		uuid ^= tf.FastHash()
+		uuid ^= opts.PortMask.maskFlow(tf).FastHash()
 	}
 	if af, err := p.ApplicationFlow(); err == nil {
 		uuid ^= af.FastHash()
@@ -398,6 +424,10 @@ func LayersPath(ls []gopacket.Layer) (string, string) {
 		if tp == gopacket.LayerTypePayload || tp == gopacket.LayerTypeDecodeFailure {
 			break
 		}
+		// SCTP chunks are reported in the SCTP layer, not as application
+		if _, ok := SCTPChunkName(layer); ok {
+			break
+		}
 		if i > 0 {
 			path += "/"
 		}
@@ -435,6 +465,9 @@ func networkID(p *Packet) int64 {
 		if layer.LayerType() == layers.LayerTypeGeneve {
 			return int64(layer.(*layers.Geneve).VNI)
 		}
+		if layer.LayerType() == LayerTypeGTPU {
+			return int64(layer.(*GTPU).TEID)
+		}
 	}
 	return id
 }
@@ -474,6 +507,7 @@ func (f *Flow) UpdateUUID(key string, opts Opts) {
 	hasher := murmur3.New64()
 	f.Network.Hash(hasher)
 	f.ICMP.Hash(hasher)
+	f.ARP.Hash(hasher)
 	f.Transport.Hash(hasher)
 
 	// only need network and transport to compute l3trackingID
@@ -536,13 +570,17 @@ func (f *Flow) initFromPacket(key string, packet *Packet, nodeTID string, uuids
 	now := common.UnixMillis(packet.GoPacket.Metadata().CaptureInfo.Timestamp)
 	f.Init(now, nodeTID, uuids)
 
+	f.Tunnel = packet.Tunnel
 	f.newLinkLayer(packet)
 
 	f.LayersPath, f.Application = LayersPath(packet.Layers)
 
 	// no network layer then no transport layer
 	if err := f.newNetworkLayer(packet); err == nil {
+		f.classify(opts.InternalNets)
 		f.newTransportLayer(packet, opts)
+	} else {
+		f.newARPLayer(packet)
 	}
 
 	// add optional application layer
@@ -557,6 +595,23 @@ func (f *Flow) initFromPacket(key string, packet *Packet, nodeTID string, uuids
 
 // Update a flow metrics and latency
 func (f *Flow) Update(packet *Packet, opts Opts) {
+	f.updateCounters(packet, opts)
+
+	f.updateRTT(packet)
+	f.updateSCTP(packet)
+	f.updateTLS(packet)
+	f.updateHTTP(packet, opts)
+	f.updateDNS(packet, opts)
+
+	// depends on options
+	if f.TCPMetric != nil {
+		f.updateTCPMetrics(packet)
+	}
+}
+
+// updateCounters updates the last time and the packets and bytes counters of
+// a flow, without dissecting the packet
+func (f *Flow) updateCounters(packet *Packet, opts Opts) {
 	now := common.UnixMillis(packet.GoPacket.Metadata().CaptureInfo.Timestamp)
 	f.Last = now
 	f.Metric.Last = now
@@ -577,13 +632,6 @@ func (f *Flow) Update(packet *Packet, opts Opts) {
 			f.updateMetricsWithNetworkLayer(packet, 0)
 		}
 	}
-
-	f.updateRTT(packet)
-
-	// depends on options
-	if f.TCPMetric != nil {
-		f.updateTCPMetrics(packet)
-	}
 }
 
 func (f *Flow) newLinkLayer(packet *Packet) error {
@@ -735,6 +783,18 @@ func (f *Flow) newNetworkLayer(packet *Packet) error {
 					f.ICMP.ID = uint32(echo.Identifier)
 				}
 			}
+
+			if target := ICMPv6Target(packet); target != nil {
+				f.ICMP.Target = target.String()
+			}
+
+			if mac := ICMPv6TargetMAC(packet); mac != nil {
+				f.ICMP.TargetMAC = mac.String()
+			}
+
+			if mtu, ok := ICMPv6PacketTooBigMTU(icmp); ok {
+				f.ICMP.MTU = mtu
+			}
 		}
 		return nil
 	}
@@ -859,7 +919,7 @@ func (f *Flow) newTransportLayer(packet *Packet, opts Opts) error {
 
 		transportPacket := layer.(*layers.TCP)
 		srcPort, dstPort := int(transportPacket.SrcPort), int(transportPacket.DstPort)
-		f.Transport.A, f.Transport.B = int64(srcPort), int64(dstPort)
+		f.Transport.A, f.Transport.B = opts.PortMask.Mask(int64(srcPort), int64(dstPort))
 
 		if app, ok := opts.AppPortMap.tcpApplication(srcPort, dstPort); ok {
 			f.Application = app
@@ -879,17 +939,22 @@ func (f *Flow) newTransportLayer(packet *Packet, opts Opts) error {
 
 		transportPacket := layer.(*layers.UDP)
 		srcPort, dstPort := int(transportPacket.SrcPort), int(transportPacket.DstPort)
-		f.Transport.A, f.Transport.B = int64(srcPort), int64(dstPort)
+		f.Transport.A, f.Transport.B = opts.PortMask.Mask(int64(srcPort), int64(dstPort))
 
 		if app, ok := opts.AppPortMap.udpApplication(srcPort, dstPort); ok {
 			f.Application = app
 		}
+
+		if IsQUICLongHeader(transportPacket.Payload) {
+			f.newQUICLayer(transportPacket.Payload)
+		}
 	} else if layer := packet.Layer(layers.LayerTypeSCTP); layer != nil {
 		f.Transport = &TransportLayer{Protocol: FlowProtocol_SCTP}
 
 		transportPacket := layer.(*layers.SCTP)
-		f.Transport.A = int64(transportPacket.SrcPort)
-		f.Transport.B = int64(transportPacket.DstPort)
+		f.Transport.A, f.Transport.B = opts.PortMask.Mask(int64(transportPacket.SrcPort), int64(transportPacket.DstPort))
+
+		f.SCTP = &SCTPLayer{}
 	} else {
 		return ErrLayerNotFound
 	}
@@ -913,39 +978,6 @@ func (f *Flow) newApplicationLayer(packet *Packet, opts Opts) error {
 		}
 	}
 
-	if (opts.ExtraLayers & DNSLayer) != 0 {
-		if layer := packet.Layer(layers.LayerTypeDNS); layer != nil {
-			d := layer.(*layers.DNS)
-			f.DNS = &fl.DNS{
-				AA:      d.AA,
-				ID:      d.ID,
-				QR:      d.QR,
-				RA:      d.RA,
-				RD:      d.RD,
-				TC:      d.TC,
-				ANCount: d.ANCount,
-				ARCount: d.ARCount,
-				NSCount: d.NSCount,
-				QDCount: d.QDCount,
-			}
-			if len(d.Questions) > 0 {
-				questions := make([]string, len(d.Questions))
-				for i, v := range d.Questions {
-					questions[i] = string(v.Name)
-				}
-				f.DNS.DNSQuestions = questions
-			}
-			if len(d.Answers) > 0 {
-				answers := make([]string, len(d.Answers))
-				for i, v := range d.Answers {
-					answers[i] = string(v.IP)
-				}
-				f.DNS.DNSAnswers = answers
-			}
-			return nil
-		}
-	}
-
 	if (opts.ExtraLayers & VRRPLayer) != 0 {
 		if layer := packet.Layer(layers.LayerTypeVRRP); layer != nil {
 			d := layer.(*layers.VRRPv2)
@@ -1013,6 +1045,9 @@ func PacketSeqFromGoPacket(packet gopacket.Packet, outerLength int64, bpf *BPF,
 	// length of the encapsulation header + the inner packet
 	topLayerIndex, topLayerOffset, topLayerLength := 0, 0, int(outerLength)
 
+	// tunnel in which the current sub packet is encapsulated
+	var tunnel *TunnelLayer
+
 	offset, length := topLayerOffset, topLayerLength
 	for i, layer := range packetLayers {
 		length -= len(layer.LayerContents())
@@ -1027,12 +1062,13 @@ func PacketSeqFromGoPacket(packet gopacket.Packet, outerLength int64, bpf *BPF,
 			}
 			fallthrough
 			// We don't split on vlan layers.LayerTypeDot1Q
-		case layers.LayerTypeVXLAN, layers.LayerTypeMPLS, layers.LayerTypeGeneve:
+		case layers.LayerTypeVXLAN, layers.LayerTypeMPLS, layers.LayerTypeGeneve, LayerTypeGTPU:
 			p := &Packet{
 				GoPacket: packet,
 				Layers:   packetLayers[topLayerIndex : i+1],
 				Data:     packetData[topLayerOffset:],
 				Length:   int64(topLayerLength),
+				Tunnel:   tunnel,
 			}
 			// As this is the top flow, we can use the layer pointer from GoPacket
 			// This avoid to parse them later.
@@ -1046,6 +1082,7 @@ func PacketSeqFromGoPacket(packet gopacket.Packet, outerLength int64, bpf *BPF,
 			topLayerIndex = i + 1
 			topLayerLength = length
 			topLayerOffset = offset
+			tunnel = newTunnelLayer(layer)
 		}
 	}
 
@@ -1055,6 +1092,7 @@ func PacketSeqFromGoPacket(packet gopacket.Packet, outerLength int64, bpf *BPF,
 		Data:     packetData[topLayerOffset:],
 		Length:   int64(topLayerLength),
 		IPMetric: ipMetric,
+		Tunnel:   tunnel,
 	}
 	if len(ps.Packets) == 0 {
 		// As this is the top flow, we can use the layer pointer from GoPacket
@@ -1164,6 +1202,10 @@ func (i *ICMPLayer) GetStringField(field string) (string, error) {
 	switch field {
 	case "Type":
 		return i.Type.String(), nil
+	case "Target":
+		return i.Target, nil
+	case "TargetMAC":
+		return i.TargetMAC, nil
 	default:
 		return "", common.ErrFieldNotFound
 	}
@@ -1178,6 +1220,8 @@ func (i *ICMPLayer) GetFieldInt64(field string) (int64, error) {
 	switch field {
 	case "ID":
 		return int64(i.ID), nil
+	case "MTU":
+		return int64(i.MTU), nil
 	default:
 		return 0, common.ErrFieldNotFound
 	}
@@ -1249,6 +1293,18 @@ func (i *TCPMetric) GetFieldInt64(field string) (int64, error) {
 		return i.BASawStart, nil
 	case "BASawEnd":
 		return i.BASawEnd, nil
+	case "ABSRTT":
+		return i.ABSRTT, nil
+	case "BASRTT":
+		return i.BASRTT, nil
+	case "ABRetransmits":
+		return i.ABRetransmits, nil
+	case "BARetransmits":
+		return i.BARetransmits, nil
+	case "ABZeroWindows":
+		return i.ABZeroWindows, nil
+	case "BAZeroWindows":
+		return i.BAZeroWindows, nil
 	default:
 		return 0, common.ErrFieldNotFound
 	}
@@ -1278,6 +1334,14 @@ func (f *Flow) GetFieldString(field string) (string, error) {
 		return f.NodeTID, nil
 	case "Application":
 		return f.Application, nil
+	case "Direction":
+		return f.Direction, nil
+	case "AScope":
+		return f.AScope, nil
+	case "BScope":
+		return f.BScope, nil
+	case "AppName":
+		return f.AppName, nil
 	}
 
 	// sub field
@@ -1292,6 +1356,18 @@ func (f *Flow) GetFieldString(field string) (string, error) {
 		return f.Network.GetStringField(fields[1])
 	case "ICMP":
 		return f.ICMP.GetStringField(fields[1])
+	case "ARP":
+		return f.ARP.GetStringField(fields[1])
+	case "QUIC":
+		return f.QUIC.GetStringField(fields[1])
+	case "Tunnel":
+		return f.Tunnel.GetStringField(fields[1])
+	case "TLS":
+		return f.TLS.GetStringField(fields[1])
+	case "Provenance":
+		return f.Provenance.GetStringField(fields[1])
+	case "L7":
+		return f.L7.GetStringField(fields[1])
 	case "Transport":
 		return f.Transport.GetStringField(fields[1])
 	case "UDP", "TCP", "SCTP":
@@ -1341,8 +1417,16 @@ func (f *Flow) GetFieldInt64(field string) (_ int64, err error) {
 		return f.Network.GetFieldInt64(fields[1])
 	case "ICMP":
 		return f.ICMP.GetFieldInt64(fields[1])
+	case "SCTP":
+		return f.SCTP.GetFieldInt64(fields[1])
 	case "Transport":
 		return f.Transport.GetFieldInt64(fields[1])
+	case "Provenance":
+		return f.Provenance.GetFieldInt64(fields[1])
+	case "L7":
+		return f.L7.GetFieldInt64(fields[1])
+	case "Tunnel":
+		return f.Tunnel.GetFieldInt64(fields[1])
 	case "RawPacketsCaptured":
 		return f.RawPacketsCaptured, nil
 	}
@@ -1374,6 +1458,22 @@ func (f *Flow) getFieldInterface(field string) (_ interface{}, err error) {
 		return f.Network, nil
 	case "ICMP":
 		return f.ICMP, nil
+	case "ARP":
+		return f.ARP, nil
+	case "SCTP":
+		return f.SCTP, nil
+	case "QUIC":
+		return f.QUIC, nil
+	case "Threat":
+		return f.Threat, nil
+	case "Tunnel":
+		return f.Tunnel, nil
+	case "TLS":
+		return f.TLS, nil
+	case "Provenance":
+		return f.Provenance, nil
+	case "L7":
+		return f.L7, nil
 	case "Transport":
 		return f.Transport, nil
 	}
@@ -18,13 +18,16 @@
 package flow
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	v "github.com/gima/govalid/v1"
 	"github.com/google/gopacket"
@@ -1572,3 +1575,226 @@ func TestLayerKeyMode(t *testing.T) {
 
 	validatePCAP(t, "pcaptraces/layer-key-mode.pcap", layers.LinkTypeEthernet, nil, expected, TableOpts{LayerKeyMode: L2KeyMode})
 }
+
+func forgeEthernetPacket(t *testing.T, ts time.Time, l ...gopacket.SerializableLayer) gopacket.Packet {
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+
+	p := gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+	p.Metadata().CaptureInfo.Timestamp = ts
+	return p
+}
+
+func sctpPacket(t *testing.T, ts time.Time, src, dst uint16, tag uint32, chunks []byte) gopacket.Packet {
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint16(header[0:2], src)
+	binary.BigEndian.PutUint16(header[2:4], dst)
+	binary.BigEndian.PutUint32(header[4:8], tag)
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolSCTP,
+		SrcIP:    net.IP{192, 168, 0, 1},
+		DstIP:    net.IP{192, 168, 0, 2},
+	}
+	if src > dst {
+		eth.SrcMAC, eth.DstMAC = eth.DstMAC, eth.SrcMAC
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+	}
+
+	return forgeEthernetPacket(t, ts, eth, ip, gopacket.Payload(append(header, chunks...)))
+}
+
+func TestFlowSCTP(t *testing.T) {
+	table := NewTable(nil, nil, "", TableOpts{})
+	now := time.Now()
+
+	// INIT chunk, 10 outbound streams, 5 inbound streams
+	init := []byte{1, 0, 0, 20, 0, 0, 0, 42, 0, 0, 0x10, 0, 0, 10, 0, 5, 0, 0, 0, 1}
+	table.processPacketSeq(PacketSeqFromGoPacket(sctpPacket(t, now, 5000, 38412, 0, init), 0, nil, nil))
+
+	// ABORT chunk
+	abort := []byte{6, 0, 0, 4}
+	table.processPacketSeq(PacketSeqFromGoPacket(sctpPacket(t, now.Add(time.Second), 38412, 5000, 42, abort), 0, nil, nil))
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should get 1 flow, got %d", len(flows))
+	}
+
+	f := flows[0]
+	if f.LayersPath != "Ethernet/IPv4/SCTP" {
+		t.Errorf("Wrong layers path: %s", f.LayersPath)
+	}
+
+	if f.SCTP == nil {
+		t.Fatal("SCTP layer missing")
+	}
+
+	if f.SCTP.BAVerificationTag != 42 || f.SCTP.ABVerificationTag != 0 {
+		t.Errorf("Wrong verification tags: %+v", f.SCTP)
+	}
+
+	if f.SCTP.OutboundStreams != 10 || f.SCTP.InboundStreams != 5 {
+		t.Errorf("Wrong number of streams: %+v", f.SCTP)
+	}
+
+	if !reflect.DeepEqual(f.SCTP.Chunks, []string{"INIT", "ABORT"}) {
+		t.Errorf("Wrong chunks: %v", f.SCTP.Chunks)
+	}
+
+	if f.FinishType != FlowFinishType_SCTP_ABORT {
+		t.Errorf("Wrong finish type: %s", f.FinishType)
+	}
+
+	if streams, err := f.GetFieldInt64("SCTP.OutboundStreams"); err != nil || streams != 10 {
+		t.Errorf("Wrong SCTP.OutboundStreams field: %d, %v", streams, err)
+	}
+}
+
+func icmpv6Packet(t *testing.T, ts time.Time, icmp *layers.ICMPv6, payload gopacket.SerializableLayer) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x33, 0x33, 0xff, 0x00, 0x00, 0x02},
+		EthernetType: layers.EthernetTypeIPv6,
+	}
+	ip := &layers.IPv6{
+		Version:    6,
+		HopLimit:   255,
+		NextHeader: layers.IPProtocolICMPv6,
+		SrcIP:      net.ParseIP("fe80::1"),
+		DstIP:      net.ParseIP("ff02::1:ff00:2"),
+	}
+
+	return forgeEthernetPacket(t, ts, eth, ip, icmp, payload)
+}
+
+func TestFlowICMPv6NeighborDiscovery(t *testing.T) {
+	table := NewTable(nil, nil, "", TableOpts{})
+	now := time.Now()
+
+	for i, target := range []string{"fe80::2", "fe80::3"} {
+		icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborSolicitation, 0)}
+		ns := &layers.ICMPv6NeighborSolicitation{TargetAddress: net.ParseIP(target)}
+		table.processPacketSeq(PacketSeqFromGoPacket(icmpv6Packet(t, now.Add(time.Duration(i)*time.Second), icmp, ns), 0, nil, nil))
+	}
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 2 {
+		t.Fatalf("Should get one flow per target, got %d", len(flows))
+	}
+
+	targets := map[string]bool{}
+	for _, f := range flows {
+		if f.ICMP == nil {
+			t.Fatal("ICMP layer missing")
+		}
+		targets[f.ICMP.Target] = true
+	}
+
+	if !targets["fe80::2"] || !targets["fe80::3"] {
+		t.Errorf("Wrong neighbor discovery targets: %v", targets)
+	}
+}
+
+func TestFlowICMPv6PacketTooBig(t *testing.T) {
+	table := NewTable(nil, nil, "", TableOpts{})
+
+	icmp := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypePacketTooBig, 0)}
+	payload := gopacket.Payload([]byte{0, 0, 0x05, 0xdc, 0x60, 0, 0, 0})
+	table.processPacketSeq(PacketSeqFromGoPacket(icmpv6Packet(t, time.Now(), icmp, payload), 0, nil, nil))
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should get 1 flow, got %d", len(flows))
+	}
+
+	if mtu, err := flows[0].GetFieldInt64("ICMP.MTU"); err != nil || mtu != 1500 {
+		t.Errorf("Wrong ICMP.MTU field: %d, %v", mtu, err)
+	}
+}
+
+func TestGTPUInnerFlow(t *testing.T) {
+	RegisterGTPUPort(DefaultGTPUPort)
+
+	inner := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(inner, gopacket.SerializeOptions{FixLengths: true},
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: net.ParseIP("10.45.0.2"), DstIP: net.ParseIP("8.8.8.8")},
+		&layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0), Id: 1, Seq: 1},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// G-PDU with a PDU session container extension header
+	gtpu := []byte{0x34, 0xff, 0, 0, 0, 0, 0x12, 0x34, 0, 0, 0, 0x85, 1, 0x10, 0x09, 0}
+	binary.BigEndian.PutUint16(gtpu[2:4], uint16(len(gtpu)-8+len(inner.Bytes())))
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.ParseIP("192.168.0.1"), DstIP: net.ParseIP("192.168.0.2")}
+	udp := &layers.UDP{SrcPort: DefaultGTPUPort, DstPort: DefaultGTPUPort}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	packet := forgeEthernetPacket(t, time.Now(), eth, ip, udp, gopacket.Payload(append(gtpu, inner.Bytes()...)))
+
+	table := NewTable(nil, nil, "", TableOpts{})
+	table.processPacketSeq(PacketSeqFromGoPacket(packet, 0, nil, nil))
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 2 {
+		t.Fatalf("Should get an outer and an inner flow, got %d", len(flows))
+	}
+
+	outer, in := flows[0], flows[1]
+	if outer.ParentUUID != "" {
+		outer, in = in, outer
+	}
+
+	if outer.LayersPath != "Ethernet/IPv4/UDP/GTPU" || outer.Network.ID != 0x1234 || outer.Tunnel != nil {
+		t.Errorf("Wrong outer flow: %+v", outer)
+	}
+
+	if in.ParentUUID != outer.UUID || in.Network.A != "10.45.0.2" {
+		t.Errorf("Wrong inner flow: %+v", in)
+	}
+
+	if protocol, _ := in.GetFieldString("Tunnel.Protocol"); protocol != "GTPU" {
+		t.Errorf("Wrong tunnel protocol: %s", protocol)
+	}
+
+	if vni, _ := in.GetFieldInt64("Tunnel.VNI"); vni != 0x1234 {
+		t.Errorf("Wrong tunnel TEID: %d", vni)
+	}
+}
+
+func TestGeneveInnerFlowTunnel(t *testing.T) {
+	flows := flowsFromPCAP(t, "pcaptraces/geneve.pcap", layers.LinkTypeEthernet, nil)
+
+	inner := 0
+	for _, f := range flows {
+		if f.ParentUUID == "" {
+			continue
+		}
+		inner++
+
+		if f.Tunnel == nil || f.Tunnel.Protocol != "GENEVE" || (f.Tunnel.VNI != 10 && f.Tunnel.VNI != 11) {
+			t.Errorf("Wrong tunnel for flow %s: %+v", f.LayersPath, f.Tunnel)
+		}
+	}
+
+	if inner == 0 {
+		t.Error("Should get inner flows")
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"encoding/binary"
 	"hash"
 	"strings"
+
+	"github.com/google/gopacket/layers"
 )
 
 // Hash computes the hash of a ICMP layer
@@ -32,6 +34,27 @@ func (fl *ICMPLayer) Hash(hasher hash.Hash) {
 	value32 := make([]byte, 4)
 	binary.BigEndian.PutUint32(value32, uint32(fl.Type)<<24|uint32(fl.Code<<16|uint32(fl.ID)))
 	hasher.Write(value32)
+
+	if fl.Target != "" {
+		hasher.Write([]byte(fl.Target))
+	}
+}
+
+// Hash computes the hash of an ARP layer
+func (a *ARPLayer) Hash(hasher hash.Hash) {
+	if a == nil {
+		return
+	}
+
+	value16 := make([]byte, 2)
+	if a.Operation == ARPReply {
+		binary.BigEndian.PutUint16(value16, layers.ARPReply)
+	} else {
+		binary.BigEndian.PutUint16(value16, layers.ARPRequest)
+	}
+	hasher.Write(value16)
+	hasher.Write([]byte(a.SenderMAC))
+	hasher.Write([]byte(a.SenderIP))
 }
 
 // Hash computes the hash of a transport layer
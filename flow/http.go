@@ -0,0 +1,471 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// DefaultHTTPMaxTransactions is the default number of transactions
+	// kept in the L7 layer of a flow
+	DefaultHTTPMaxTransactions = 16
+
+	// httpMaxBuffer is the maximum number of bytes of a direction kept
+	// while waiting for the end of a HTTP/2 frame or of a TLS record
+	httpMaxBuffer = 65536
+	// httpMaxPending is the maximum number of requests of a flow waiting
+	// for their response
+	httpMaxPending = 64
+
+	http2Preface             = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	http2FrameHeaderLength   = 9
+	http2FrameData           = 0x0
+	http2FrameHeaders        = 0x1
+	http2FrameSettings       = 0x4
+	http2FrameContinuation   = 0x9
+	http2FlagAck             = 0x1
+	http2FlagEndHeaders      = 0x4
+	http2FlagPadded          = 0x8
+	http2FlagPriority        = 0x20
+	http2SettingsTableSize   = 0x1
+	http2DefaultTableSize    = 4096
+	http2SettingsEntryLength = 6
+)
+
+var httpMaxTransactions = DefaultHTTPMaxTransactions
+
+var httpMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"DELETE":  true,
+	"CONNECT": true,
+	"OPTIONS": true,
+	"TRACE":   true,
+	"PATCH":   true,
+}
+
+// SetHTTPMaxTransactions sets the number of transactions kept in the L7
+// layer of the flows, the oldest ones being dropped first
+func SetHTTPMaxTransactions(max int) {
+	if max > 0 {
+		httpMaxTransactions = max
+	}
+}
+
+// httpPending is a request waiting for its response
+type httpPending struct {
+	transaction *L7Transaction
+	time        int64
+}
+
+// http2Direction holds the HTTP/2 framing state of one direction of a flow
+type http2Direction struct {
+	started bool
+	buf     []byte
+	// number of bytes of the current frame payload to skip
+	skip    int
+	decoder *hpack.Decoder
+	// header block being assembled from HEADERS and CONTINUATION frames
+	block     []byte
+	inHeaders bool
+	stream    uint32
+}
+
+// httpState holds the HTTP dissection state of a flow
+type httpState struct {
+	http2      bool
+	upgrade    bool
+	pending    []httpPending
+	streams    map[uint32]httpPending
+	directions [2]http2Direction
+}
+
+// httpRequestLine holds the request line of a HTTP/1.x request and the
+// headers looked for
+type httpRequestLine struct {
+	method  string
+	path    string
+	version string
+	host    string
+	upgrade bool
+}
+
+// httpHeaderLines returns the start line and the header lines of a HTTP/1.x
+// message, and the offset of its body, -1 if the header is truncated
+func httpHeaderLines(data []byte) (string, []string, int) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	header := data
+	if end >= 0 {
+		header, end = data[:end], end+4
+	}
+
+	lines := strings.Split(string(header), "\r\n")
+	return lines[0], lines[1:], end
+}
+
+// parseHTTP1Request parses the request line of a HTTP/1.x request and the
+// Host and Upgrade headers
+func parseHTTP1Request(data []byte) *httpRequestLine {
+	if i := bytes.IndexByte(data, ' '); i <= 0 || !httpMethods[string(data[:i])] {
+		return nil
+	}
+
+	line, headers, _ := httpHeaderLines(data)
+	fields := strings.Split(line, " ")
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/1.") {
+		return nil
+	}
+
+	r := &httpRequestLine{method: fields[0], path: fields[1], version: fields[2]}
+	for _, header := range headers {
+		i := strings.IndexByte(header, ':')
+		if i <= 0 {
+			continue
+		}
+		value := strings.TrimSpace(header[i+1:])
+		switch strings.ToLower(header[:i]) {
+		case "host":
+			r.host = value
+		case "upgrade":
+			r.upgrade = strings.EqualFold(value, "h2c")
+		}
+	}
+
+	return r
+}
+
+// parseHTTP1Response returns the status code of a HTTP/1.x response and the
+// offset of its body
+func parseHTTP1Response(data []byte) (int64, int, bool) {
+	if !bytes.HasPrefix(data, []byte("HTTP/1.")) {
+		return 0, 0, false
+	}
+
+	line, _, end := httpHeaderLines(data)
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 {
+		return 0, 0, false
+	}
+
+	code, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || code < 100 || code > 999 {
+		return 0, 0, false
+	}
+
+	return code, end, true
+}
+
+func (s *httpState) addPending(t *L7Transaction, now int64) {
+	if len(s.pending) >= httpMaxPending {
+		s.pending = s.pending[1:]
+	}
+	s.pending = append(s.pending, httpPending{transaction: t, time: now})
+}
+
+func (s *httpState) addStream(stream uint32, t *L7Transaction, now int64) {
+	if s.streams == nil {
+		s.streams = make(map[uint32]httpPending)
+	}
+
+	if len(s.streams) >= httpMaxPending {
+		var oldest uint32
+		for id := range s.streams {
+			if oldest == 0 || id < oldest {
+				oldest = id
+			}
+		}
+		delete(s.streams, oldest)
+	}
+	s.streams[stream] = httpPending{transaction: t, time: now}
+}
+
+// isHTTP2Preface returns whether a segment starts with the client preface
+// of a HTTP/2 connection with prior knowledge
+func isHTTP2Preface(data []byte) bool {
+	n := len(data)
+	if n > len(http2Preface) {
+		n = len(http2Preface)
+	}
+	return n >= 4 && string(data[:n]) == http2Preface[:n]
+}
+
+// startHTTP2 switches the flow to HTTP/2, after the client preface or an
+// upgrade of a HTTP/1.1 connection
+func (s *httpState) startHTTP2() {
+	s.http2 = true
+	for i := range s.directions {
+		s.directions[i].decoder = hpack.NewDecoder(http2DefaultTableSize, nil)
+	}
+}
+
+// feedHTTP1 looks for a request or a response at the beginning of a
+// segment. When a h2c upgrade is accepted the bytes following the response
+// are returned, to be dissected as HTTP/2.
+func (s *httpState) feedHTTP1(f *Flow, data []byte, now int64) []byte {
+	if r := parseHTTP1Request(data); r != nil {
+		t := &L7Transaction{
+			Protocol: r.version,
+			Method:   r.method,
+			Host:     r.host,
+			Path:     r.path,
+			Start:    now / int64(time.Millisecond),
+		}
+		s.addPending(t, now)
+		s.upgrade = r.upgrade
+		return nil
+	}
+
+	code, end, ok := parseHTTP1Response(data)
+	if !ok || len(s.pending) == 0 {
+		return nil
+	}
+
+	switch {
+	case code == 101 && s.upgrade:
+		// the upgrade request is answered on the stream 1
+		p := s.pending[0]
+		s.pending = nil
+		p.transaction.Protocol = "HTTP/2"
+		s.startHTTP2()
+		s.addStream(1, p.transaction, p.time)
+		if end > 0 {
+			return data[end:]
+		}
+	case code >= 200:
+		p := s.pending[0]
+		s.pending = s.pending[1:]
+		f.addL7Transaction(p.transaction, code, now-p.time)
+	}
+
+	return nil
+}
+
+// feedHTTP2 reassembles the HTTP/2 frames of a direction, only the header
+// blocks and the settings being decoded
+func (s *httpState) feedHTTP2(f *Flow, dir int, data []byte, now int64) {
+	d := &s.directions[dir]
+
+	if d.skip > 0 {
+		n := d.skip
+		if n > len(data) {
+			n = len(data)
+		}
+		d.skip -= n
+		data = data[n:]
+	}
+
+	buf := append(d.buf, data...)
+	if !d.started {
+		if len(buf) < len(http2Preface) && strings.HasPrefix(http2Preface, string(buf)) {
+			d.buf = buf
+			return
+		}
+		buf = bytes.TrimPrefix(buf, []byte(http2Preface))
+		d.started = true
+	}
+
+	for len(buf) >= http2FrameHeaderLength {
+		length := int(buf[0])<<16 | int(buf[1])<<8 | int(buf[2])
+		frameType, flags := buf[3], buf[4]
+		stream := binary.BigEndian.Uint32(buf[5:9]) & 0x7fffffff
+
+		if frameType == http2FrameData || length > httpMaxBuffer {
+			buf = buf[http2FrameHeaderLength:]
+			if length > len(buf) {
+				d.skip = length - len(buf)
+				buf = nil
+				break
+			}
+			buf = buf[length:]
+			continue
+		}
+
+		if len(buf) < http2FrameHeaderLength+length {
+			break
+		}
+		payload := buf[http2FrameHeaderLength : http2FrameHeaderLength+length]
+		buf = buf[http2FrameHeaderLength+length:]
+
+		switch frameType {
+		case http2FrameSettings:
+			if flags&http2FlagAck != 0 {
+				continue
+			}
+			// the settings of a peer bound the table used by the encoder of the other one
+			for i := 0; i+http2SettingsEntryLength <= len(payload); i += http2SettingsEntryLength {
+				if binary.BigEndian.Uint16(payload[i:]) == http2SettingsTableSize {
+					s.directions[1-dir].decoder.SetMaxDynamicTableSize(binary.BigEndian.Uint32(payload[i+2:]))
+				}
+			}
+			continue
+		case http2FrameHeaders:
+			if flags&http2FlagPadded != 0 {
+				if len(payload) == 0 || int(payload[0]) > len(payload)-1 {
+					continue
+				}
+				payload = payload[1 : len(payload)-int(payload[0])]
+			}
+			if flags&http2FlagPriority != 0 {
+				if len(payload) < 5 {
+					continue
+				}
+				payload = payload[5:]
+			}
+			d.block = append(d.block[:0], payload...)
+			d.inHeaders, d.stream = true, stream
+		case http2FrameContinuation:
+			if !d.inHeaders || stream != d.stream {
+				continue
+			}
+			// a header block is bounded as a frame is, the remaining
+			// CONTINUATION frames of a dropped block are ignored
+			if len(d.block)+len(payload) > httpMaxBuffer {
+				d.block, d.inHeaders = nil, false
+				continue
+			}
+			d.block = append(d.block, payload...)
+		default:
+			continue
+		}
+
+		if flags&http2FlagEndHeaders != 0 {
+			d.inHeaders = false
+			s.http2Headers(f, d, d.block, now)
+		}
+	}
+
+	d.buf = append(d.buf[:0], buf...)
+}
+
+// http2Headers decodes a header block, keeping the request of a stream
+// until its response
+func (s *httpState) http2Headers(f *Flow, d *http2Direction, block []byte, now int64) {
+	fields, err := d.decoder.DecodeFull(block)
+	if err != nil {
+		return
+	}
+
+	t := &L7Transaction{Protocol: "HTTP/2", Start: now / int64(time.Millisecond)}
+	var status string
+	for _, field := range fields {
+		switch field.Name {
+		case ":method":
+			t.Method = field.Value
+		case ":path":
+			t.Path = field.Value
+		case ":authority":
+			t.Host = field.Value
+		case "host":
+			if t.Host == "" {
+				t.Host = field.Value
+			}
+		case ":status":
+			status = field.Value
+		}
+	}
+
+	if t.Method != "" {
+		s.addStream(d.stream, t, now)
+		return
+	}
+
+	code, err := strconv.ParseInt(status, 10, 64)
+	if err != nil || code < 200 {
+		// trailers or informational responses
+		return
+	}
+
+	if p, found := s.streams[d.stream]; found {
+		delete(s.streams, d.stream)
+		f.addL7Transaction(p.transaction, code, now-p.time)
+	}
+}
+
+// addL7Transaction reports a completed transaction in the L7 layer of the
+// flow, keeping the last ones
+func (f *Flow) addL7Transaction(t *L7Transaction, code int64, latency int64) {
+	t.ResponseCode, t.Latency = code, latency
+
+	if f.L7 == nil {
+		f.L7 = &L7Layer{}
+	}
+	l := f.L7
+
+	l.Protocol, l.Method, l.Host, l.Path, l.ResponseCode = t.Protocol, t.Method, t.Host, t.Path, code
+	l.Requests++
+	if code >= 500 {
+		l.Errors++
+	}
+
+	if n := len(l.Transactions) + 1 - httpMaxTransactions; n > 0 {
+		l.Transactions = append([]*L7Transaction{}, l.Transactions[n:]...)
+	}
+	l.Transactions = append(l.Transactions, t)
+}
+
+// updateHTTP dissects the HTTP/1.x and HTTP/2 requests and responses of a
+// TCP flow, the TLS flows being decrypted when their secrets are known
+func (f *Flow) updateHTTP(packet *Packet, opts Opts) {
+	if opts.ExtraLayers&HTTPLayer == 0 || f.Transport == nil || f.Transport.Protocol != FlowProtocol_TCP {
+		return
+	}
+
+	tcpPacket, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || len(tcpPacket.Payload) == 0 {
+		return
+	}
+
+	dir := 0
+	if int64(tcpPacket.SrcPort) != f.Transport.A {
+		dir = 1
+	}
+
+	payload := tcpPacket.Payload
+	if f.TLS != nil {
+		if payload = f.decryptTLS(dir, payload); len(payload) == 0 {
+			return
+		}
+	}
+
+	s := f.XXX_state.http
+	if s == nil {
+		s = &httpState{}
+		f.XXX_state.http = s
+	}
+
+	now := packet.GoPacket.Metadata().CaptureInfo.Timestamp.UnixNano()
+	if !s.http2 {
+		if isHTTP2Preface(payload) {
+			s.startHTTP2()
+		} else if payload = s.feedHTTP1(f, payload, now); len(payload) == 0 {
+			return
+		}
+	}
+
+	s.feedHTTP2(f, dir, payload, now)
+}
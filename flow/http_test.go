@@ -0,0 +1,302 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/skydive-project/skydive/filters"
+)
+
+type httpSegment struct {
+	server  bool
+	delay   time.Duration
+	payload []byte
+}
+
+// httpFlow returns the flow of a TCP connection carrying the given segments
+func httpFlow(t *testing.T, segments []httpSegment) *Flow {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IP{192, 168, 0, 1},
+		DstIP:    net.IP{192, 168, 0, 2},
+	}
+	rip := *ip
+	rip.SrcIP, rip.DstIP = ip.DstIP, ip.SrcIP
+
+	table := NewTable(nil, nil, "", TableOpts{ExtraLayers: HTTPLayer})
+
+	now := time.Now()
+	for _, segment := range segments {
+		now = now.Add(segment.delay)
+
+		var packet gopacket.Packet
+		if segment.server {
+			packet = forgeEthernetPacket(t, now, eth, &rip, &layers.TCP{SrcPort: 8080, DstPort: 51234, PSH: true}, gopacket.Payload(segment.payload))
+		} else {
+			packet = forgeEthernetPacket(t, now, eth, ip, &layers.TCP{SrcPort: 51234, DstPort: 8080, PSH: true}, gopacket.Payload(segment.payload))
+		}
+		table.processPacketSeq(PacketSeqFromGoPacket(packet, 0, nil, nil))
+	}
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should get 1 flow, got %d", len(flows))
+	}
+	return flows[0]
+}
+
+func checkTransactions(t *testing.T, f *Flow, expected []L7Transaction) {
+	if f.L7 == nil || len(f.L7.Transactions) != len(expected) {
+		t.Fatalf("Expected %d transactions, got %+v", len(expected), f.L7)
+	}
+
+	for i, e := range expected {
+		tr := f.L7.Transactions[i]
+		if tr.Protocol != e.Protocol || tr.Method != e.Method || tr.Host != e.Host || tr.Path != e.Path ||
+			tr.ResponseCode != e.ResponseCode || tr.Latency != e.Latency {
+			t.Errorf("Wrong transaction %d, expected %+v, got %+v", i, e, tr)
+		}
+	}
+}
+
+func TestFlowHTTP1(t *testing.T) {
+	f := httpFlow(t, []httpSegment{
+		{payload: []byte("GET /index.html HTTP/1.1\r\nHost: www.example.org\r\nAccept: */*\r\n\r\n")},
+		{server: true, delay: 20 * time.Millisecond, payload: []byte("HTTP/1.1 200 OK\r\nContent-Length: 12\r\n\r\n")},
+		{server: true, payload: []byte("Hello world!")},
+		{delay: time.Second, payload: []byte("POST /api/items HTTP/1.1\r\nhost: www.example.org\r\nContent-Length: 2\r\n\r\n{}")},
+		{server: true, delay: 5 * time.Millisecond, payload: []byte("HTTP/1.1 100 Continue\r\n\r\n")},
+		{server: true, delay: 5 * time.Millisecond, payload: []byte("HTTP/1.1 503 Service Unavailable\r\n\r\n")},
+	})
+
+	checkTransactions(t, f, []L7Transaction{
+		{Protocol: "HTTP/1.1", Method: "GET", Host: "www.example.org", Path: "/index.html", ResponseCode: 200, Latency: int64(20 * time.Millisecond)},
+		{Protocol: "HTTP/1.1", Method: "POST", Host: "www.example.org", Path: "/api/items", ResponseCode: 503, Latency: int64(10 * time.Millisecond)},
+	})
+
+	if f.L7.Method != "POST" || f.L7.ResponseCode != 503 || f.L7.Requests != 2 || f.L7.Errors != 1 {
+		t.Errorf("Wrong L7 layer: %+v", f.L7)
+	}
+
+	if code, err := f.GetFieldInt64("L7.ResponseCode"); err != nil || code != 503 {
+		t.Errorf("Wrong L7.ResponseCode field: %d, %v", code, err)
+	}
+}
+
+func TestFlowHTTP1MaxTransactions(t *testing.T) {
+	SetHTTPMaxTransactions(2)
+	defer SetHTTPMaxTransactions(DefaultHTTPMaxTransactions)
+
+	var segments []httpSegment
+	for _, path := range []string{"/a", "/b", "/c"} {
+		segments = append(segments,
+			httpSegment{payload: []byte("GET " + path + " HTTP/1.0\r\n\r\n")},
+			httpSegment{server: true, payload: []byte("HTTP/1.0 404 Not Found\r\n\r\n")},
+		)
+	}
+
+	checkTransactions(t, httpFlow(t, segments), []L7Transaction{
+		{Protocol: "HTTP/1.0", Method: "GET", Path: "/b", ResponseCode: 404},
+		{Protocol: "HTTP/1.0", Method: "GET", Path: "/c", ResponseCode: 404},
+	})
+}
+
+func http2Frame(frameType, flags byte, stream uint32, payload []byte) []byte {
+	frame := []byte{byte(len(payload) >> 16), byte(len(payload) >> 8), byte(len(payload)), frameType, flags, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[5:], stream)
+	return append(frame, payload...)
+}
+
+func http2Headers(t *testing.T, encoder *hpack.Encoder, buf *bytes.Buffer, fields ...string) []byte {
+	buf.Reset()
+	for i := 0; i+1 < len(fields); i += 2 {
+		if err := encoder.WriteField(hpack.HeaderField{Name: fields[i], Value: fields[i+1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return append([]byte{}, buf.Bytes()...)
+}
+
+func TestFlowHTTP2(t *testing.T) {
+	var clientBuf, serverBuf bytes.Buffer
+	clientEncoder, serverEncoder := hpack.NewEncoder(&clientBuf), hpack.NewEncoder(&serverBuf)
+
+	request1 := http2Headers(t, clientEncoder, &clientBuf, ":method", "GET", ":scheme", "http", ":authority", "www.example.org", ":path", "/")
+	request3 := http2Headers(t, clientEncoder, &clientBuf, ":method", "POST", ":scheme", "http", ":authority", "www.example.org", ":path", "/upload")
+	response3 := http2Headers(t, serverEncoder, &serverBuf, ":status", "201")
+	response1 := http2Headers(t, serverEncoder, &serverBuf, ":status", "200", "content-type", "text/html")
+
+	client := []byte(http2Preface)
+	client = append(client, http2Frame(http2FrameSettings, 0, 0, nil)...)
+	client = append(client, http2Frame(http2FrameHeaders, http2FlagEndHeaders, 1, request1)...)
+	// the header block of the second request is split in a CONTINUATION frame
+	client = append(client, http2Frame(http2FrameHeaders, 0, 3, request3[:4])...)
+	client = append(client, http2Frame(http2FrameContinuation, http2FlagEndHeaders, 3, request3[4:])...)
+	client = append(client, http2Frame(http2FrameData, 0, 3, make([]byte, 3000))...)
+
+	server := http2Frame(http2FrameSettings, 0, 0, nil)
+	server = append(server, http2Frame(http2FrameHeaders, http2FlagEndHeaders, 3, response3)...)
+	server = append(server, http2Frame(http2FrameHeaders, http2FlagEndHeaders, 1, response1)...)
+
+	f := httpFlow(t, []httpSegment{
+		{payload: client[:10]},
+		{payload: client[10:1000]},
+		{payload: client[1000:]},
+		{server: true, delay: 30 * time.Millisecond, payload: server},
+	})
+
+	checkTransactions(t, f, []L7Transaction{
+		{Protocol: "HTTP/2", Method: "POST", Host: "www.example.org", Path: "/upload", ResponseCode: 201, Latency: int64(30 * time.Millisecond)},
+		{Protocol: "HTTP/2", Method: "GET", Host: "www.example.org", Path: "/", ResponseCode: 200, Latency: int64(30 * time.Millisecond)},
+	})
+}
+
+func TestFlowHTTP2MaxHeaderBlock(t *testing.T) {
+	var buf bytes.Buffer
+	request := http2Headers(t, hpack.NewEncoder(&buf), &buf, ":method", "GET", ":scheme", "http", ":authority", "www.example.org", ":path", "/")
+
+	s := &httpState{}
+	s.startHTTP2()
+
+	f := &Flow{}
+	s.feedHTTP2(f, 0, []byte(http2Preface), 0)
+
+	// an endless header block, without END_HEADERS flag
+	s.feedHTTP2(f, 0, http2Frame(http2FrameHeaders, 0, 1, make([]byte, 16384)), 0)
+	for i := 0; i < 10; i++ {
+		s.feedHTTP2(f, 0, http2Frame(http2FrameContinuation, 0, 1, make([]byte, 16384)), 0)
+
+		if d := &s.directions[0]; len(d.block) > httpMaxBuffer {
+			t.Fatalf("Header block should be bounded, got %d bytes", len(d.block))
+		}
+	}
+
+	if s.directions[0].inHeaders {
+		t.Error("Header block should have been dropped")
+	}
+
+	// the end of the dropped block is ignored, the next requests are dissected
+	s.feedHTTP2(f, 0, http2Frame(http2FrameContinuation, http2FlagEndHeaders, 1, make([]byte, 16)), 0)
+	s.feedHTTP2(f, 0, http2Frame(http2FrameHeaders, http2FlagEndHeaders, 3, request), 0)
+
+	if _, found := s.streams[3]; !found {
+		t.Error("Request following the dropped header block should be dissected")
+	}
+}
+
+func TestFlowHTTP2Upgrade(t *testing.T) {
+	var buf bytes.Buffer
+	response := http2Headers(t, hpack.NewEncoder(&buf), &buf, ":status", "200")
+
+	upgrade := []byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n")
+	upgrade = append(upgrade, http2Frame(http2FrameSettings, 0, 0, nil)...)
+
+	f := httpFlow(t, []httpSegment{
+		{payload: []byte("GET /status HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n")},
+		{server: true, delay: time.Millisecond, payload: upgrade},
+		{payload: append([]byte(http2Preface), http2Frame(http2FrameSettings, 0, 0, nil)...)},
+		{server: true, delay: time.Millisecond, payload: http2Frame(http2FrameHeaders, http2FlagEndHeaders, 1, response)},
+	})
+
+	checkTransactions(t, f, []L7Transaction{
+		{Protocol: "HTTP/2", Method: "GET", Host: "localhost", Path: "/status", ResponseCode: 200, Latency: int64(2 * time.Millisecond)},
+	})
+}
+
+// tls13Record encrypts an application data record of a TLS 1.3 session
+func tls13Record(t *testing.T, suite uint16, secret []byte, seq uint64, contentType byte, data []byte) []byte {
+	d, err := newTLSDecrypter(suite, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := append(append([]byte{}, data...), contentType, 0, 0)
+	header := []byte{tlsRecordApplicationData, 0x03, 0x03, 0, 0}
+	binary.BigEndian.PutUint16(header[3:], uint16(len(inner)+d.aead.Overhead()))
+
+	nonce := append([]byte{}, d.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(seq >> uint(8*i))
+	}
+	return d.aead.Seal(header, nonce, inner, header)
+}
+
+func TestFlowHTTPTLS13(t *testing.T) {
+	clientSecret := bytes.Repeat([]byte{0x11}, 48)
+	serverSecret := bytes.Repeat([]byte{0x22}, 48)
+	handshakeSecret := bytes.Repeat([]byte{0x33}, 48)
+
+	file, err := ioutil.TempFile("", "sslkeylog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	random := strings.Repeat("00", 32)
+	file.WriteString("CLIENT_HANDSHAKE_TRAFFIC_SECRET " + random + " " + hex.EncodeToString(handshakeSecret) + "\n")
+	file.WriteString("CLIENT_TRAFFIC_SECRET_0 " + random + " " + hex.EncodeToString(clientSecret) + "\n")
+	file.WriteString("SERVER_TRAFFIC_SECRET_0 " + random + " " + hex.EncodeToString(serverSecret) + "\n")
+	file.Close()
+
+	SetTLSKeyLogFile(file.Name())
+	defer func() { tlsKeyLog = nil }()
+
+	// the client Finished protected by the handshake keys and the session
+	// ticket are skipped
+	client := tls13Record(t, 0x1302, handshakeSecret, 0, tlsRecordHandshake, []byte("finished"))
+	client = append(client, tls13Record(t, 0x1302, clientSecret, 0, tlsRecordApplicationData, []byte("GET /secret HTTP/1.1\r\nHost: www.example.org\r\n\r\n"))...)
+	server := tls13Record(t, 0x1302, serverSecret, 0, tlsRecordHandshake, []byte("session ticket"))
+	server = append(server, tls13Record(t, 0x1302, serverSecret, 1, tlsRecordApplicationData, []byte("HTTP/1.1 403 Forbidden\r\n\r\n"))...)
+
+	f := httpFlow(t, []httpSegment{
+		{payload: tlsRecord(clientHello("www.example.org", "http/1.1"))},
+		{server: true, payload: tlsRecord(serverHello(0x0304, 0x1302))},
+		{payload: client[:30]},
+		{payload: client[30:]},
+		{server: true, delay: 10 * time.Millisecond, payload: server},
+	})
+
+	if f.TLS == nil || f.TLS.CipherSuite != "TLS_AES_256_GCM_SHA384" {
+		t.Fatalf("Wrong TLS layer: %+v", f.TLS)
+	}
+
+	checkTransactions(t, f, []L7Transaction{
+		{Protocol: "HTTP/1.1", Method: "GET", Host: "www.example.org", Path: "/secret", ResponseCode: 403, Latency: int64(10 * time.Millisecond)},
+	})
+}
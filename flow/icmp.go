@@ -17,7 +17,12 @@
 
 package flow
 
-import "github.com/google/gopacket/layers"
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/google/gopacket/layers"
+)
 
 // ICMPv4TypeToFlowICMPType converts an ICMP type to a Flow ICMPType
 func ICMPv4TypeToFlowICMPType(kind uint8) ICMPType {
@@ -70,3 +75,39 @@ func ICMPv6TypeToFlowICMPType(kind uint8) ICMPType {
 
 	return ICMPType_UNKNOWN
 }
+
+// ICMPv6Target returns the target address carried by IPv6 neighbor discovery
+// and redirect messages
+func ICMPv6Target(packet *Packet) net.IP {
+	if layer := packet.Layer(layers.LayerTypeICMPv6NeighborSolicitation); layer != nil {
+		return layer.(*layers.ICMPv6NeighborSolicitation).TargetAddress
+	}
+	if layer := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement); layer != nil {
+		return layer.(*layers.ICMPv6NeighborAdvertisement).TargetAddress
+	}
+	if layer := packet.Layer(layers.LayerTypeICMPv6Redirect); layer != nil {
+		return layer.(*layers.ICMPv6Redirect).TargetAddress
+	}
+	return nil
+}
+
+// ICMPv6TargetMAC returns the link-layer address advertised by a neighbor
+// advertisement
+func ICMPv6TargetMAC(packet *Packet) net.HardwareAddr {
+	if layer := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement); layer != nil {
+		for _, opt := range layer.(*layers.ICMPv6NeighborAdvertisement).Options {
+			if opt.Type == layers.ICMPv6OptTargetAddress && len(opt.Data) >= 6 {
+				return net.HardwareAddr(opt.Data[:6])
+			}
+		}
+	}
+	return nil
+}
+
+// ICMPv6PacketTooBigMTU returns the next-hop MTU of a packet too big message
+func ICMPv6PacketTooBigMTU(icmp *layers.ICMPv6) (uint32, bool) {
+	if icmp.TypeCode.Type() != layers.ICMPv6TypePacketTooBig || len(icmp.Payload) < 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(icmp.Payload[:4]), true
+}
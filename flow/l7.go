@@ -0,0 +1,66 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"github.com/skydive-project/skydive/common"
+)
+
+// GetStringField returns the value of a L7 field
+func (l *L7Layer) GetStringField(field string) (string, error) {
+	if l == nil {
+		return "", common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "Protocol":
+		return l.Protocol, nil
+	case "Method":
+		return l.Method, nil
+	case "Host":
+		return l.Host, nil
+	case "Path":
+		return l.Path, nil
+	case "SourcePrincipal":
+		return l.SourcePrincipal, nil
+	case "DestinationPrincipal":
+		return l.DestinationPrincipal, nil
+	case "UpstreamCluster":
+		return l.UpstreamCluster, nil
+	default:
+		return "", common.ErrFieldNotFound
+	}
+}
+
+// GetFieldInt64 returns the value of a L7 field
+func (l *L7Layer) GetFieldInt64(field string) (int64, error) {
+	if l == nil {
+		return 0, common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "ResponseCode":
+		return l.ResponseCode, nil
+	case "Requests":
+		return l.Requests, nil
+	case "Errors":
+		return l.Errors, nil
+	default:
+		return 0, common.ErrFieldNotFound
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+func TestL7LayerFields(t *testing.T) {
+	l := &L7Layer{
+		Method:          "GET",
+		Path:            "/reviews/0",
+		SourcePrincipal: "spiffe://cluster.local/ns/default/sa/productpage",
+		ResponseCode:    503,
+		Requests:        2,
+		Errors:          1,
+	}
+
+	for field, expected := range map[string]string{
+		"Method":          "GET",
+		"Path":            "/reviews/0",
+		"SourcePrincipal": "spiffe://cluster.local/ns/default/sa/productpage",
+	} {
+		if value, err := l.GetStringField(field); err != nil || value != expected {
+			t.Errorf("Expected %s for %s, got %s (%v)", expected, field, value, err)
+		}
+	}
+
+	for field, expected := range map[string]int64{
+		"ResponseCode": 503,
+		"Requests":     2,
+		"Errors":       1,
+	} {
+		if value, err := l.GetFieldInt64(field); err != nil || value != expected {
+			t.Errorf("Expected %d for %s, got %d (%v)", expected, field, value, err)
+		}
+	}
+
+	if _, err := l.GetStringField("ResponseCode"); err != common.ErrFieldNotFound {
+		t.Errorf("Expected a field not found error, got %v", err)
+	}
+
+	var missing *L7Layer
+	if _, err := missing.GetStringField("Method"); err != common.ErrFieldNotFound {
+		t.Errorf("Expected a field not found error on a missing layer, got %v", err)
+	}
+	if _, err := missing.GetFieldInt64("Requests"); err != common.ErrFieldNotFound {
+		t.Errorf("Expected a field not found error on a missing layer, got %v", err)
+	}
+}
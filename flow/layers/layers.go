@@ -29,8 +29,11 @@ type LayerDHCPv4 struct {
 //proteus:generate
 type LayerDNS struct {
 	*layers.DNS
-	DNSQuestions []string
-	DNSAnswers   []string
+	DNSQuestions  []string
+	DNSQueryTypes []string
+	DNSRcode      string
+	DNSAnswers    []string
+	DNSAnswerTTLs []uint32
 }
 
 // LayerVRRPv2 wrapper to generate extra layer
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"sort"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Eviction policies applied when a flow table reaches its memory limit
+const (
+	// EvictionLRU evicts the flows not seen for the longest time first
+	EvictionLRU = "lru"
+	// EvictionLargest evicts the flows using the most memory first
+	EvictionLargest = "largest"
+)
+
+const (
+	// estimated overhead of a table entry, map bucket and flow state
+	flowEntryOverhead = 256
+	// estimated overhead of a raw packet
+	rawPacketOverhead = 32
+	// the flows are evicted until the memory used by the table is back
+	// under this percentage of its limit
+	evictionLowWatermark = 90
+)
+
+// accountFlow estimates the memory used by a flow entry, updating the
+// memory used by the table
+func (ft *Table) accountFlow(key string, f *Flow) {
+	memory := flowEntryOverhead + int64(len(key)+f.ProtoSize())
+	ft.memory += memory - f.XXX_state.memory
+	f.XXX_state.memory = memory
+}
+
+// accountRawPacket adds the memory of a raw packet retained by a flow
+func (ft *Table) accountRawPacket(f *Flow, data *RawPacket) {
+	memory := rawPacketOverhead + int64(len(data.Data))
+	ft.memory += memory
+	f.XXX_state.memory += memory
+}
+
+func (ft *Table) deleteFlow(key string, f *Flow) {
+	ft.memory -= f.XXX_state.memory
+	f.XXX_state.memory = 0
+	delete(ft.table, key)
+}
+
+// evictFlows evicts flows according to the eviction policy of the table
+// when it uses more memory than its limit, the least recently seen flows
+// first when it holds more flows than its maximum. The evicted flows are
+// reported as expired with the EVICTED finish type.
+func (ft *Table) evictFlows() {
+	overMemory := ft.Opts.MemoryLimit > 0 && ft.memory > ft.Opts.MemoryLimit
+	overFlows := ft.Opts.MaxFlows > 0 && len(ft.table) > ft.Opts.MaxFlows
+	if !overMemory && !overFlows {
+		return
+	}
+
+	keys := make([]string, 0, len(ft.table))
+	for k := range ft.table {
+		keys = append(keys, k)
+	}
+
+	if overMemory && ft.Opts.EvictionPolicy == EvictionLargest {
+		sort.Slice(keys, func(i, j int) bool {
+			return ft.table[keys[i]].XXX_state.memory > ft.table[keys[j]].XXX_state.memory
+		})
+	} else {
+		sort.Slice(keys, func(i, j int) bool {
+			return ft.table[keys[i]].Last < ft.table[keys[j]].Last
+		})
+	}
+
+	memoryTarget, flowsTarget := ft.memory, len(ft.table)
+	if overMemory {
+		memoryTarget = ft.Opts.MemoryLimit * evictionLowWatermark / 100
+	}
+	if overFlows {
+		flowsTarget = ft.Opts.MaxFlows * evictionLowWatermark / 100
+	}
+
+	var evictedFlows []*Flow
+	for _, k := range keys {
+		if ft.memory <= memoryTarget && len(ft.table) <= flowsTarget {
+			break
+		}
+
+		f := ft.table[k]
+		if f.XXX_state.updateVersion > ft.updateVersion {
+			ft.updateMetric(f, ft.lastUpdate, f.Last)
+		}
+		if f.FinishType == FlowFinishType_NOT_FINISHED {
+			f.FinishType = FlowFinishType_EVICTED
+		}
+		evictedFlows = append(evictedFlows, f)
+
+		ft.deleteFlow(k, f)
+	}
+
+	ft.evicted += int64(len(evictedFlows))
+	logging.GetLogger().Debugf("Flow table %s evicted %d flows, memory %d/%d, flows %d/%d", ft.nodeTID, len(evictedFlows), ft.memory, ft.Opts.MemoryLimit, len(ft.table), ft.Opts.MaxFlows)
+
+	/* Advise Clients */
+	ft.expireHandler.callback(&FlowArray{Flows: evictedFlows})
+}
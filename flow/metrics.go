@@ -68,6 +68,12 @@ func (tm *TCPMetric) Copy() *TCPMetric {
 		BABytes:               tm.BABytes,
 		BASawStart:            tm.BASawStart,
 		BASawEnd:              tm.BASawEnd,
+		ABSRTT:                tm.ABSRTT,
+		BASRTT:                tm.BASRTT,
+		ABRetransmits:         tm.ABRetransmits,
+		BARetransmits:         tm.BARetransmits,
+		ABZeroWindows:         tm.ABZeroWindows,
+		BAZeroWindows:         tm.BAZeroWindows,
 	}
 }
 
@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package multicast
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// reportApplications lists the applications of the flows carrying the
+// group membership reports
+var reportApplications = map[string]bool{
+	"IGMP":                         true,
+	"MLDv1MulticastListenerReport": true,
+	"MLDv2MulticastListenerReport": true,
+}
+
+// groupTraffic holds the traffic sent to a group since the last update
+type groupTraffic struct {
+	packets   int64
+	bytes     int64
+	reports   int64
+	sources   map[string]bool
+	reporters map[string]bool
+}
+
+// Tracker aggregates the traffic of the flows sent to multicast groups and
+// periodically reports it in the Multicast.Traffic metadata of the multicast
+// group nodes. The membership reports captured are counted apart.
+type Tracker struct {
+	sync.Mutex
+	graph    *graph.Graph
+	traffic  map[string]*groupTraffic
+	interval time.Duration
+	last     time.Time
+	quit     chan bool
+	wg       sync.WaitGroup
+}
+
+// Tag accounts the traffic of the flow when its destination is a multicast
+// group, the flow is left untouched
+func (t *Tracker) Tag(f *flow.Flow) {
+	if f.Network == nil || f.LastUpdateMetric == nil {
+		return
+	}
+
+	if ip := net.ParseIP(f.Network.B); ip == nil || !ip.IsMulticast() {
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	traffic, found := t.traffic[f.Network.B]
+	if !found {
+		traffic = &groupTraffic{
+			sources:   make(map[string]bool),
+			reporters: make(map[string]bool),
+		}
+		t.traffic[f.Network.B] = traffic
+	}
+
+	m := f.LastUpdateMetric
+	if reportApplications[f.Application] {
+		traffic.reports += m.ABPackets
+		traffic.reporters[f.Network.A] = true
+		return
+	}
+
+	traffic.packets += m.ABPackets + m.BAPackets
+	traffic.bytes += m.ABBytes + m.BABytes
+	traffic.sources[f.Network.A] = true
+}
+
+func keys(m map[string]bool) []string {
+	l := make([]string, 0, len(m))
+	for k := range m {
+		l = append(l, k)
+	}
+	return l
+}
+
+func (t *Tracker) update(now time.Time) {
+	t.Lock()
+	traffics := t.traffic
+	t.traffic = make(map[string]*groupTraffic)
+	start := t.last
+	t.last = now
+	t.Unlock()
+
+	if len(traffics) == 0 {
+		return
+	}
+
+	t.graph.Lock()
+	defer t.graph.Unlock()
+
+	for group, traffic := range traffics {
+		metadata := map[string]interface{}{
+			"Packets":   traffic.packets,
+			"Bytes":     traffic.bytes,
+			"Reports":   traffic.reports,
+			"Sources":   keys(traffic.sources),
+			"Reporters": keys(traffic.reporters),
+			"Start":     common.UnixMillis(start),
+			"Last":      common.UnixMillis(now),
+		}
+
+		for _, node := range t.graph.GetNodes(graph.Metadata{"Type": "multicastgroup", "Name": group}) {
+			t.graph.AddMetadata(node, "Multicast.Traffic", metadata)
+		}
+	}
+}
+
+// Start periodically updates the multicast group nodes
+func (t *Tracker) Start() {
+	t.Lock()
+	t.last = time.Now().UTC()
+	t.Unlock()
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				t.update(now.UTC())
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the tracker
+func (t *Tracker) Stop() {
+	t.quit <- true
+	t.wg.Wait()
+}
+
+// NewTrackerFromConfig returns a new multicast traffic tracker, nil if
+// disabled by the configuration
+func NewTrackerFromConfig(g *graph.Graph) *Tracker {
+	interval := config.GetInt("analyzer.flow.multicast_update")
+	if interval <= 0 {
+		return nil
+	}
+
+	return &Tracker{
+		graph:    g,
+		traffic:  make(map[string]*groupTraffic),
+		interval: time.Duration(interval) * time.Second,
+		quit:     make(chan bool),
+	}
+}
@@ -295,6 +295,12 @@ func (o *OnDemandProbeClient) onCaptureAdded(capture *types.Capture) {
 		return
 	}
 
+	// the capture is registered once approved, through its update event
+	if !capture.IsApproved() {
+		logging.GetLogger().Infof("Capture %s not started, approval %s", capture.UUID, capture.Approval)
+		return
+	}
+
 	o.registerCapture(capture)
 }
 
@@ -388,7 +394,9 @@ func NewOnDemandProbeClient(g *graph.Graph, ch *api.CaptureAPIHandler, agentPool
 	resources := ch.Index()
 	captures := make(map[string]*types.Capture)
 	for _, resource := range resources {
-		captures[resource.ID()] = resource.(*types.Capture)
+		if capture := resource.(*types.Capture); capture.IsApproved() {
+			captures[resource.ID()] = capture
+		}
 	}
 
 	election := etcdClient.NewElection("ondemand-client")
@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	etcdclient "github.com/coreos/etcd/client"
+
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// fakeKeysAPI returns the captures stored in memory
+type fakeKeysAPI struct {
+	etcdclient.KeysAPI
+	values map[string]string
+}
+
+func (k *fakeKeysAPI) Get(ctx context.Context, key string, opts *etcdclient.GetOptions) (*etcdclient.Response, error) {
+	dir := &etcdclient.Node{Key: key, Dir: true}
+	for path, value := range k.values {
+		if strings.HasPrefix(path, key) {
+			dir.Nodes = append(dir.Nodes, &etcdclient.Node{Key: path, Value: value})
+		}
+	}
+	return &etcdclient.Response{Action: "get", Node: dir}, nil
+}
+
+type fakeSpeakerPool struct {
+	ws.StructSpeakerPool
+}
+
+func (p *fakeSpeakerPool) AddStructMessageHandler(h ws.SpeakerStructMessageHandler, namespaces []string) {
+}
+
+func (p *fakeSpeakerPool) BroadcastMessage(m ws.Message) {
+}
+
+type fakeElection struct {
+	common.MasterElection
+}
+
+func (e *fakeElection) IsMaster() bool {
+	return true
+}
+
+func TestPendingCaptures(t *testing.T) {
+	captures := []*types.Capture{
+		{BasicResource: types.BasicResource{UUID: "pending"}, GremlinQuery: "G.V().Has('Name', 'eth0')", Approval: types.CaptureApprovalPending},
+		{BasicResource: types.BasicResource{UUID: "approved"}, GremlinQuery: "G.V().Has('Name', 'eth1')", Approval: types.CaptureApprovalApproved},
+		{BasicResource: types.BasicResource{UUID: "rejected"}, GremlinQuery: "G.V().Has('Name', 'eth2')", Approval: types.CaptureApprovalRejected},
+		{BasicResource: types.BasicResource{UUID: "unreviewed"}, GremlinQuery: "G.V().Has('Name', 'eth3')"},
+	}
+
+	kapi := &fakeKeysAPI{values: make(map[string]string)}
+	for _, capture := range captures {
+		data, err := json.Marshal(capture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kapi.values["/capture/"+capture.UUID] = string(data)
+	}
+
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	ch := &api.CaptureAPIHandler{
+		BasicAPIHandler: api.BasicAPIHandler{
+			ResourceHandler: &api.CaptureResourceHandler{},
+			EtcdKeyAPI:      kapi,
+		},
+		Graph: g,
+	}
+
+	// the captures waiting for an approval are not restored on restart
+	o := NewOnDemandProbeClient(g, ch, &fakeSpeakerPool{}, &fakeSpeakerPool{}, &etcd.Client{KeysAPI: kapi})
+	if len(o.captures) != 2 || o.captures["approved"] == nil || o.captures["unreviewed"] == nil {
+		t.Errorf("Expected only the approved captures to be registered, got %v", o.captures)
+	}
+
+	o.MasterElection = &fakeElection{}
+	o.captures = make(map[string]*types.Capture)
+
+	pending := captures[0]
+	o.onAPIWatcherEvent("create", pending.UUID, pending)
+	if _, found := o.captures[pending.UUID]; found {
+		t.Error("A pending capture should not be registered")
+	}
+
+	o.onAPIWatcherEvent("update", captures[2].UUID, captures[2])
+	if _, found := o.captures[captures[2].UUID]; found {
+		t.Error("A rejected capture should not be registered")
+	}
+
+	approved := *pending
+	approved.Approval = types.CaptureApprovalApproved
+	o.onAPIWatcherEvent("update", approved.UUID, &approved)
+	if _, found := o.captures[approved.UUID]; !found {
+		t.Error("An approved capture should be registered")
+	}
+}
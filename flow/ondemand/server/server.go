@@ -21,9 +21,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow/ondemand"
 	"github.com/skydive-project/skydive/flow/probes"
 	"github.com/skydive-project/skydive/graffiti/graph"
@@ -48,6 +50,8 @@ type OnDemandProbeServer struct {
 	Probes       *probe.Bundle
 	clientPool   *ws.StructClientPool
 	activeProbes map[graph.Identifier]*activeProbe
+	store        *captureStore
+	restoreTimer *time.Timer
 }
 
 func (o *OnDemandProbeServer) getProbe(n *graph.Node, capture *types.Capture) (probes.FlowProbe, error) {
@@ -176,6 +180,102 @@ func (p *activeProbe) OnStopped() {
 	p.graph.Unlock()
 }
 
+// startCapture registers the probe of the capture and reports it in the
+// node metadata, it should be executed under graph lock
+func (o *OnDemandProbeServer) startCapture(n *graph.Node, capture *types.Capture) bool {
+	if ok := o.registerProbe(n, capture); !ok {
+		return false
+	}
+
+	tr := o.Graph.StartMetadataTransaction(n)
+	tr.AddMetadata("Capture.ID", capture.UUID)
+	if capture.Name != "" {
+		tr.AddMetadata("Capture.Name", capture.Name)
+	}
+	if capture.Description != "" {
+		tr.AddMetadata("Capture.Description", capture.Description)
+	}
+	if capture.Type != "" {
+		tr.AddMetadata("Capture.Type", capture.Type)
+	}
+	if capture.BPFFilter != "" {
+		tr.AddMetadata("Capture.BPFFilter", capture.BPFFilter)
+	}
+	tr.Commit()
+
+	return true
+}
+
+// persistCapture saves the capture of a node so that it is restarted if
+// the agent restarts
+func (o *OnDemandProbeServer) persistCapture(n *graph.Node, capture *types.Capture) {
+	if o.store == nil {
+		return
+	}
+
+	tid, _ := n.GetFieldString("TID")
+	if err := o.store.add(tid, capture); err != nil {
+		logging.GetLogger().Errorf("Failed to persist capture %s: %s", capture.UUID, err)
+	}
+}
+
+func (o *OnDemandProbeServer) unpersistCapture(n *graph.Node) {
+	if o.store == nil {
+		return
+	}
+
+	tid, _ := n.GetFieldString("TID")
+	if err := o.store.remove(tid); err != nil {
+		logging.GetLogger().Errorf("Failed to remove persisted capture of node %s: %s", n.ID, err)
+	}
+}
+
+// restoreCapture restarts the capture persisted by a previous run for the
+// node, without waiting for the analyzer to request it. The analyzer stops
+// the capture once connected if it was deleted in the meantime.
+func (o *OnDemandProbeServer) restoreCapture(n *graph.Node) {
+	if o.store == nil {
+		return
+	}
+
+	tid, _ := n.GetFieldString("TID")
+	if tid == "" {
+		return
+	}
+
+	capture := o.store.takePending(tid)
+	if capture == nil {
+		return
+	}
+
+	// graph events are notified under graph lock
+	go func() {
+		o.Graph.Lock()
+		defer o.Graph.Unlock()
+
+		if n := o.Graph.GetNode(n.ID); n != nil {
+			if _, err := n.GetFieldString("Capture.ID"); err == nil {
+				return
+			}
+
+			logging.GetLogger().Infof("Restoring capture %s on node %s", capture.UUID, n.ID)
+			if !o.startCapture(n, capture) {
+				o.unpersistCapture(n)
+			}
+		}
+	}()
+}
+
+// OnNodeAdded graph event
+func (o *OnDemandProbeServer) OnNodeAdded(n *graph.Node) {
+	o.restoreCapture(n)
+}
+
+// OnNodeUpdated graph event, the TID of a node may be set after its creation
+func (o *OnDemandProbeServer) OnNodeUpdated(n *graph.Node) {
+	o.restoreCapture(n)
+}
+
 // OnStructMessage websocket message, valid message type are CaptureStart, CaptureStop
 func (o *OnDemandProbeServer) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
 	var query ondemand.CaptureQuery
@@ -200,26 +300,10 @@ func (o *OnDemandProbeServer) OnStructMessage(c ws.Speaker, msg *ws.StructMessag
 		status = http.StatusOK
 		if _, err := n.GetFieldString("Capture.ID"); err == nil {
 			logging.GetLogger().Debugf("Capture already started on node %s", n.ID)
+		} else if ok := o.startCapture(n, &query.Capture); ok {
+			o.persistCapture(n, &query.Capture)
 		} else {
-			if ok := o.registerProbe(n, &query.Capture); ok {
-				tr := o.Graph.StartMetadataTransaction(n)
-				tr.AddMetadata("Capture.ID", query.Capture.UUID)
-				if query.Capture.Name != "" {
-					tr.AddMetadata("Capture.Name", query.Capture.Name)
-				}
-				if query.Capture.Description != "" {
-					tr.AddMetadata("Capture.Description", query.Capture.Description)
-				}
-				if query.Capture.Type != "" {
-					tr.AddMetadata("Capture.Type", query.Capture.Type)
-				}
-				if query.Capture.BPFFilter != "" {
-					tr.AddMetadata("Capture.BPFFilter", query.Capture.BPFFilter)
-				}
-				tr.Commit()
-			} else {
-				status = http.StatusInternalServerError
-			}
+			status = http.StatusInternalServerError
 		}
 
 	case "CaptureStop":
@@ -234,6 +318,7 @@ func (o *OnDemandProbeServer) OnStructMessage(c ws.Speaker, msg *ws.StructMessag
 		if ok := o.unregisterProbe(n); !ok {
 			status = http.StatusInternalServerError
 		}
+		o.unpersistCapture(n)
 	}
 
 	// be sure to unlock before sending message
@@ -254,6 +339,26 @@ func (o *OnDemandProbeServer) OnNodeDeleted(n *graph.Node) {
 
 // Start the probe
 func (o *OnDemandProbeServer) Start() error {
+	if o.store != nil {
+		if err := o.store.load(); err != nil {
+			logging.GetLogger().Errorf("Failed to load persisted captures from %s: %s", o.store.path, err)
+		}
+
+		o.Graph.RLock()
+		for _, n := range o.Graph.GetNodes(nil) {
+			o.restoreCapture(n)
+		}
+		o.Graph.RUnlock()
+
+		// forget the captures of the nodes that don't come back
+		timeout := time.Duration(config.GetInt("agent.capture.persistence.restore_timeout")) * time.Second
+		o.restoreTimer = time.AfterFunc(timeout, func() {
+			if err := o.store.dropPending(); err != nil {
+				logging.GetLogger().Errorf("Failed to persist captures: %s", err)
+			}
+		})
+	}
+
 	o.Graph.AddEventListener(o)
 	o.clientPool.AddStructMessageHandler(o, []string{ondemand.Namespace})
 
@@ -264,6 +369,10 @@ func (o *OnDemandProbeServer) Start() error {
 func (o *OnDemandProbeServer) Stop() {
 	o.Graph.RemoveEventListener(o)
 
+	if o.restoreTimer != nil {
+		o.restoreTimer.Stop()
+	}
+
 	o.Graph.Lock()
 	defer o.Graph.Unlock()
 
@@ -274,10 +383,16 @@ func (o *OnDemandProbeServer) Stop() {
 
 // NewOnDemandProbeServer creates a new Ondemand probes server based on graph and websocket
 func NewOnDemandProbeServer(fb *probe.Bundle, g *graph.Graph, pool *ws.StructClientPool) (*OnDemandProbeServer, error) {
-	return &OnDemandProbeServer{
+	o := &OnDemandProbeServer{
 		Graph:        g,
 		Probes:       fb,
 		clientPool:   pool,
 		activeProbes: make(map[graph.Identifier]*activeProbe),
-	}, nil
+	}
+
+	if path := config.GetString("agent.capture.persistence.path"); path != "" {
+		o.store = newCaptureStore(path)
+	}
+
+	return o, nil
 }
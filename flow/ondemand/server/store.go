@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+// captureStore persists the captures of the agent indexed by node TID, as
+// the node identifiers may change across restarts
+type captureStore struct {
+	sync.Mutex
+	path     string
+	captures map[string]*types.Capture
+	// captures loaded at startup whose node hasn't been seen yet
+	pending map[string]*types.Capture
+}
+
+// load reads the captures persisted by a previous run of the agent
+func (s *captureStore) load() error {
+	s.Lock()
+	defer s.Unlock()
+
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	captures := make(map[string]*types.Capture)
+	if err := json.Unmarshal(data, &captures); err != nil {
+		return err
+	}
+
+	for tid, capture := range captures {
+		s.captures[tid] = capture
+		s.pending[tid] = capture
+	}
+
+	return nil
+}
+
+// save writes the captures to a temporary file first so that a crash
+// while writing doesn't corrupt the previous state
+func (s *captureStore) save() error {
+	data, err := json.Marshal(s.captures)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *captureStore) add(tid string, capture *types.Capture) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.captures[tid] = capture
+	delete(s.pending, tid)
+	return s.save()
+}
+
+func (s *captureStore) remove(tid string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, found := s.captures[tid]; !found {
+		return nil
+	}
+
+	delete(s.captures, tid)
+	delete(s.pending, tid)
+	return s.save()
+}
+
+// takePending returns the capture to restore on a node, if any
+func (s *captureStore) takePending(tid string) *types.Capture {
+	s.Lock()
+	defer s.Unlock()
+
+	capture, found := s.pending[tid]
+	if found {
+		delete(s.pending, tid)
+	}
+	return capture
+}
+
+// dropPending forgets the captures whose node didn't come back
+func (s *captureStore) dropPending() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	for tid := range s.pending {
+		delete(s.captures, tid)
+	}
+	s.pending = make(map[string]*types.Capture)
+
+	return s.save()
+}
+
+func newCaptureStore(path string) *captureStore {
+	return &captureStore{
+		path:     path,
+		captures: make(map[string]*types.Capture),
+		pending:  make(map[string]*types.Capture),
+	}
+}
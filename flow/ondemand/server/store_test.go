@@ -0,0 +1,78 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+)
+
+func TestCaptureStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skydive-captures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state", "captures.json")
+
+	store := newCaptureStore(path)
+	if err := store.load(); err != nil {
+		t.Fatalf("Missing file should be ignored: %s", err)
+	}
+
+	if err := store.add("tid1", types.NewCapture("G.V().Has('Name', 'eth0')", "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.add("tid2", types.NewCapture("G.V().Has('Name', 'eth1')", "")); err != nil {
+		t.Fatal(err)
+	}
+
+	// restart
+	store = newCaptureStore(path)
+	if err := store.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	capture := store.takePending("tid1")
+	if capture == nil || capture.GremlinQuery != "G.V().Has('Name', 'eth0')" {
+		t.Fatalf("Capture of tid1 not restored: %+v", capture)
+	}
+
+	if store.takePending("tid1") != nil {
+		t.Error("Capture should be restored only once")
+	}
+
+	// tid2 never came back
+	if err := store.dropPending(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = newCaptureStore(path)
+	if err := store.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.captures) != 1 || store.captures["tid1"] == nil {
+		t.Errorf("Only the capture of tid1 should be persisted, got %+v", store.captures)
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/gopacket/layers"
+)
+
+// pcap-ng block types and options, see
+// https://github.com/pcapng/pcapng/blob/master/draft-tuexen-opsawg-pcapng.xml
+const (
+	pcapngSectionHeaderBlock   = 0x0A0D0D0A
+	pcapngInterfaceDescBlock   = 0x00000001
+	pcapngEnhancedPacketBlock  = 0x00000006
+	pcapngByteOrderMagic       = 0x1A2B3C4D
+	pcapngOptEndOfOpt          = 0
+	pcapngOptComment           = 1
+	pcapngOptShbUserAppl       = 4
+	pcapngOptIfName            = 2
+	pcapngOptIfDescription     = 3
+	pcapngOptIfTsResol         = 9
+	pcapngTimestampsResolution = 3 // milliseconds, the resolution of the raw packets
+)
+
+type pcapngInterface struct {
+	nodeTID  string
+	linkType layers.LinkType
+}
+
+// PcapNgWriter writes raw packets in the pcap-ng format, with an interface
+// per capture node and the flow of each packet in its comment, so that the
+// Skydive context is kept when analyzing the packets with other tools.
+type PcapNgWriter struct {
+	w          io.Writer
+	interfaces map[pcapngInterface]uint32
+}
+
+type pcapngOption struct {
+	code  uint16
+	value []byte
+}
+
+func pcapngPad(n int) int {
+	return (4 - n%4) % 4
+}
+
+func writePcapNgBlock(w io.Writer, blockType uint32, body []byte, options []pcapngOption) error {
+	var buf bytes.Buffer
+	buf.Write(body)
+
+	if len(options) > 0 {
+		for _, option := range options {
+			binary.Write(&buf, binary.LittleEndian, option.code)
+			binary.Write(&buf, binary.LittleEndian, uint16(len(option.value)))
+			buf.Write(option.value)
+			buf.Write(make([]byte, pcapngPad(len(option.value))))
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(pcapngOptEndOfOpt))
+	}
+
+	// block type, total length twice and the body
+	length := uint32(12 + buf.Len())
+
+	var block bytes.Buffer
+	binary.Write(&block, binary.LittleEndian, blockType)
+	binary.Write(&block, binary.LittleEndian, length)
+	block.Write(buf.Bytes())
+	binary.Write(&block, binary.LittleEndian, length)
+
+	_, err := w.Write(block.Bytes())
+	return err
+}
+
+func (p *PcapNgWriter) writeSectionHeader(application string) error {
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+	binary.Write(&body, binary.LittleEndian, uint16(1))
+	binary.Write(&body, binary.LittleEndian, uint16(0))
+	// section length not specified
+	binary.Write(&body, binary.LittleEndian, int64(-1))
+
+	return writePcapNgBlock(p.w, pcapngSectionHeaderBlock, body.Bytes(), []pcapngOption{
+		{code: pcapngOptShbUserAppl, value: []byte(application)},
+	})
+}
+
+// interfaceID returns the ID of the interface of a capture node, writing
+// its description first if needed
+func (p *PcapNgWriter) interfaceID(nodeTID string, linkType layers.LinkType) (uint32, error) {
+	key := pcapngInterface{nodeTID: nodeTID, linkType: linkType}
+	if id, found := p.interfaces[key]; found {
+		return id, nil
+	}
+
+	var body bytes.Buffer
+	binary.Write(&body, binary.LittleEndian, uint16(linkType))
+	binary.Write(&body, binary.LittleEndian, uint16(0))
+	binary.Write(&body, binary.LittleEndian, uint32(MaxCaptureLength))
+
+	name, description := nodeTID, fmt.Sprintf("Skydive node %s", nodeTID)
+	if nodeTID == "" {
+		name, description = "unknown", "Unknown Skydive node"
+	}
+
+	options := []pcapngOption{
+		{code: pcapngOptIfName, value: []byte(name)},
+		{code: pcapngOptIfDescription, value: []byte(description)},
+		{code: pcapngOptIfTsResol, value: []byte{pcapngTimestampsResolution}},
+	}
+
+	if err := writePcapNgBlock(p.w, pcapngInterfaceDescBlock, body.Bytes(), options); err != nil {
+		return 0, err
+	}
+
+	id := uint32(len(p.interfaces))
+	p.interfaces[key] = id
+	return id, nil
+}
+
+// WriteRawPackets writes the raw packets of a flow
+func (p *PcapNgWriter) WriteRawPackets(flowUUID string, fr *RawPackets) error {
+	id, err := p.interfaceID(fr.NodeTID, fr.LinkType)
+	if err != nil {
+		return err
+	}
+
+	comment := []byte(fmt.Sprintf("Skydive flow %s, node %s", flowUUID, fr.NodeTID))
+
+	for _, r := range fr.RawPackets {
+		var body bytes.Buffer
+		binary.Write(&body, binary.LittleEndian, id)
+		binary.Write(&body, binary.LittleEndian, uint32(uint64(r.Timestamp)>>32))
+		binary.Write(&body, binary.LittleEndian, uint32(r.Timestamp))
+		binary.Write(&body, binary.LittleEndian, uint32(len(r.Data)))
+		binary.Write(&body, binary.LittleEndian, uint32(len(r.Data)))
+		body.Write(r.Data)
+		body.Write(make([]byte, pcapngPad(len(r.Data))))
+
+		if err := writePcapNgBlock(p.w, pcapngEnhancedPacketBlock, body.Bytes(), []pcapngOption{{code: pcapngOptComment, value: comment}}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteRawPacketsMap writes the raw packets of flows, indexed by flow UUID,
+// sorted by UUID
+func (p *PcapNgWriter) WriteRawPacketsMap(m map[string]*RawPackets) error {
+	uuids := make([]string, 0, len(m))
+	for uuid := range m {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	for _, uuid := range uuids {
+		if err := p.WriteRawPackets(uuid, m[uuid]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewPcapNgWriter returns a new PcapNgWriter based on the given io.Writer,
+// application being recorded in the section header
+func NewPcapNgWriter(w io.Writer, application string) (*PcapNgWriter, error) {
+	p := &PcapNgWriter{
+		w:          w,
+		interfaces: make(map[pcapngInterface]uint32),
+	}
+
+	if err := p.writeSectionHeader(application); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
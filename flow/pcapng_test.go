@@ -0,0 +1,140 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+type pcapngTestBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+func readPcapNgBlocks(t *testing.T, data []byte) []pcapngTestBlock {
+	var blocks []pcapngTestBlock
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block: %v", data)
+		}
+
+		blockType := binary.LittleEndian.Uint32(data[0:4])
+		length := binary.LittleEndian.Uint32(data[4:8])
+		if length%4 != 0 || int(length) > len(data) {
+			t.Fatalf("wrong block length %d", length)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[length-4 : length]); trailer != length {
+			t.Fatalf("block lengths mismatch: %d != %d", length, trailer)
+		}
+
+		blocks = append(blocks, pcapngTestBlock{blockType: blockType, body: data[8 : length-4]})
+		data = data[length:]
+	}
+	return blocks
+}
+
+func TestPcapNgWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	pw, err := NewPcapNgWriter(&buf, "Skydive test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := map[string]*RawPackets{
+		"flow2": {
+			LinkType: layers.LinkTypeEthernet,
+			NodeTID:  "node1",
+			RawPackets: []*RawPacket{
+				{Timestamp: 1000, Data: []byte{1, 2, 3}},
+			},
+		},
+		"flow1": {
+			LinkType: layers.LinkTypeEthernet,
+			NodeTID:  "node1",
+			RawPackets: []*RawPacket{
+				{Timestamp: 2000, Data: []byte{1, 2, 3, 4, 5}},
+				{Timestamp: 3000, Data: []byte{1, 2, 3, 4}},
+			},
+		},
+		"flow3": {
+			LinkType: layers.LinkTypeEthernet,
+			NodeTID:  "node2",
+			RawPackets: []*RawPacket{
+				{Timestamp: 4000, Data: []byte{1}},
+			},
+		},
+	}
+
+	if err := pw.WriteRawPacketsMap(packets); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := readPcapNgBlocks(t, buf.Bytes())
+
+	var types []uint32
+	for _, block := range blocks {
+		types = append(types, block.blockType)
+	}
+
+	expected := []uint32{
+		pcapngSectionHeaderBlock,
+		pcapngInterfaceDescBlock, pcapngEnhancedPacketBlock, pcapngEnhancedPacketBlock, pcapngEnhancedPacketBlock,
+		pcapngInterfaceDescBlock, pcapngEnhancedPacketBlock,
+	}
+	if len(types) != len(expected) {
+		t.Fatalf("expected blocks %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("expected blocks %v, got %v", expected, types)
+		}
+	}
+
+	if magic := binary.LittleEndian.Uint32(blocks[0].body[0:4]); magic != pcapngByteOrderMagic {
+		t.Errorf("wrong byte order magic %x", magic)
+	}
+
+	if !strings.Contains(string(blocks[5].body), "Skydive node node2") {
+		t.Errorf("interface description not found: %v", blocks[5].body)
+	}
+
+	// first packet is the one of flow1, sorted by UUID, on the first interface
+	epb := blocks[2].body
+	if id := binary.LittleEndian.Uint32(epb[0:4]); id != 0 {
+		t.Errorf("wrong interface id %d", id)
+	}
+	if ts := binary.LittleEndian.Uint32(epb[8:12]); ts != 2000 {
+		t.Errorf("wrong timestamp %d", ts)
+	}
+	if caplen := binary.LittleEndian.Uint32(epb[12:16]); caplen != 5 {
+		t.Errorf("wrong captured length %d", caplen)
+	}
+	if !strings.Contains(string(epb), "Skydive flow flow1, node node1") {
+		t.Errorf("packet comment not found: %v", epb)
+	}
+
+	if id := binary.LittleEndian.Uint32(blocks[6].body[0:4]); id != 1 {
+		t.Errorf("wrong interface id %d", id)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Port masking modes
+const (
+	PortMaskNone   = ""
+	PortMaskZero   = "zero"
+	PortMaskBucket = "bucket"
+)
+
+// PortMask normalizes the ephemeral ports of the flows, so that the
+// connections of a client to a service port are aggregated in a single
+// flow. A port is ephemeral when not lower than the ephemeral minimum while
+// the other port of the flow is, the service port being kept. It is
+// replaced by 0 or by the first port of its bucket.
+type PortMask struct {
+	mode         string
+	ephemeralMin int
+	bucketSize   int
+}
+
+// NewPortMask returns a port mask, nil if no masking mode is given
+func NewPortMask(mode string, ephemeralMin, bucketSize int) (*PortMask, error) {
+	switch mode {
+	case PortMaskNone:
+		return nil, nil
+	case PortMaskZero:
+	case PortMaskBucket:
+		if bucketSize <= 0 {
+			return nil, fmt.Errorf("Invalid port masking bucket size %d", bucketSize)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown port masking mode %s", mode)
+	}
+
+	if ephemeralMin <= 0 || ephemeralMin > 65535 {
+		return nil, fmt.Errorf("Invalid ephemeral port minimum %d", ephemeralMin)
+	}
+
+	return &PortMask{mode: mode, ephemeralMin: ephemeralMin, bucketSize: bucketSize}, nil
+}
+
+// NewPortMaskFromConfig returns the port mask defined by the
+// flow.port_masking configuration entry, nil if disabled
+func NewPortMaskFromConfig() *PortMask {
+	pm, err := NewPortMask(
+		config.GetString("flow.port_masking.mode"),
+		config.GetInt("flow.port_masking.ephemeral_min"),
+		config.GetInt("flow.port_masking.bucket_size"))
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to set up flow port masking: %s", err)
+		return nil
+	}
+	return pm
+}
+
+func (pm *PortMask) maskPort(port int64) int64 {
+	if pm.mode == PortMaskZero {
+		return 0
+	}
+	min, size := int64(pm.ephemeralMin), int64(pm.bucketSize)
+	return min + (port-min)/size*size
+}
+
+// Mask returns the ports of a flow, the ephemeral one being masked
+func (pm *PortMask) Mask(a, b int64) (int64, int64) {
+	if pm == nil {
+		return a, b
+	}
+
+	min := int64(pm.ephemeralMin)
+	switch {
+	case a >= min && b < min:
+		a = pm.maskPort(a)
+	case b >= min && a < min:
+		b = pm.maskPort(b)
+	}
+	return a, b
+}
+
+// maskFlow masks the ports of a TCP, UDP or SCTP transport flow, used to
+// compute the key of the flows
+func (pm *PortMask) maskFlow(tf gopacket.Flow) gopacket.Flow {
+	if pm == nil {
+		return tf
+	}
+
+	switch tf.EndpointType() {
+	case layers.EndpointTCPPort, layers.EndpointUDPPort, layers.EndpointSCTPPort:
+	default:
+		return tf
+	}
+
+	src, dst := tf.Endpoints()
+	if len(src.Raw()) != 2 || len(dst.Raw()) != 2 {
+		return tf
+	}
+
+	a, b := pm.Mask(int64(binary.BigEndian.Uint16(src.Raw())), int64(binary.BigEndian.Uint16(dst.Raw())))
+
+	srcPort, dstPort := make([]byte, 2), make([]byte, 2)
+	binary.BigEndian.PutUint16(srcPort, uint16(a))
+	binary.BigEndian.PutUint16(dstPort, uint16(b))
+
+	return gopacket.NewFlow(tf.EndpointType(), srcPort, dstPort)
+}
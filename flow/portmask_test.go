@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewPortMask(t *testing.T) {
+	if pm, err := NewPortMask(PortMaskNone, 32768, 1024); pm != nil || err != nil {
+		t.Errorf("Masking should be disabled without mode, got %v, %v", pm, err)
+	}
+
+	for _, c := range []struct {
+		mode               string
+		ephemeralMin, size int
+	}{
+		{"random", 32768, 1024},
+		{PortMaskBucket, 32768, 0},
+		{PortMaskZero, 0, 0},
+		{PortMaskZero, 70000, 0},
+	} {
+		if _, err := NewPortMask(c.mode, c.ephemeralMin, c.size); err == nil {
+			t.Errorf("Expected an error for %+v", c)
+		}
+	}
+}
+
+func TestPortMask(t *testing.T) {
+	zero, _ := NewPortMask(PortMaskZero, 32768, 0)
+	bucket, _ := NewPortMask(PortMaskBucket, 32768, 1024)
+
+	for _, c := range []struct {
+		pm         *PortMask
+		a, b       int64
+		expA, expB int64
+	}{
+		{nil, 40000, 80, 40000, 80},
+		{zero, 40000, 80, 0, 80},
+		{zero, 443, 51000, 443, 0},
+		{zero, 40000, 50000, 40000, 50000},
+		{zero, 22, 80, 22, 80},
+		{bucket, 40000, 80, 39936, 80},
+		{bucket, 53, 32768, 53, 32768},
+		{bucket, 53, 65535, 53, 65536 - 1024},
+	} {
+		if a, b := c.pm.Mask(c.a, c.b); a != c.expA || b != c.expB {
+			t.Errorf("Wrong masked ports for %d/%d, expected %d/%d, got %d/%d", c.a, c.b, c.expA, c.expB, a, b)
+		}
+	}
+}
+
+func portFlow(t gopacket.EndpointType, src, dst uint16) gopacket.Flow {
+	a, b := make([]byte, 2), make([]byte, 2)
+	binary.BigEndian.PutUint16(a, src)
+	binary.BigEndian.PutUint16(b, dst)
+	return gopacket.NewFlow(t, a, b)
+}
+
+func TestPortMaskFlow(t *testing.T) {
+	pm, _ := NewPortMask(PortMaskZero, 32768, 0)
+
+	f1 := pm.maskFlow(portFlow(layers.EndpointTCPPort, 40000, 80))
+	f2 := pm.maskFlow(portFlow(layers.EndpointTCPPort, 45000, 80))
+	if f1.FastHash() != f2.FastHash() {
+		t.Error("Flows from different ephemeral ports should share the same hash")
+	}
+
+	if f := pm.maskFlow(portFlow(layers.EndpointTCPPort, 80, 40000)); f != portFlow(layers.EndpointTCPPort, 80, 0) {
+		t.Errorf("Wrong masked flow: %s", f)
+	}
+
+	raw := portFlow(gopacket.EndpointType(999), 40000, 80)
+	if f := pm.maskFlow(raw); f != raw {
+		t.Errorf("Non transport flows should not be masked, got %s", f)
+	}
+}
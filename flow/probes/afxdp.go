@@ -0,0 +1,758 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/safchain/ethtool"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// AF_XDP socket options and flags, from linux/if_xdp.h
+const (
+	afXDP  = 44
+	solXDP = 283
+
+	xdpOptMmapOffsets       = 1
+	xdpOptRxRing            = 2
+	xdpOptUmemReg           = 4
+	xdpOptUmemFillRing      = 5
+	xdpOptCompletionRing    = 6
+	xdpOptStatistics        = 7
+	xdpCopy                 = 1 << 1
+	xdpZeroCopy             = 1 << 2
+	xdpPgoffRxRing          = 0
+	xdpUmemPgoffFillRing    = 0x100000000
+	xdpUmemPgoffCompletion  = 0x180000000
+	xdpDescSize             = 16
+	xdpMinFrameSize         = 2048
+	xdpFlagsUpdateIfNoExist = 1 << 0
+	xdpFlagsDrvMode         = 1 << 2
+)
+
+// bpf syscall commands and types, netlink attributes and ethtool command, from
+// linux/bpf.h, linux/if_link.h and linux/ethtool.h
+const (
+	bpfMapCreate       = 0
+	bpfMapUpdateElem   = 2
+	bpfProgLoad        = 5
+	bpfMapTypeXSKMap   = 17
+	bpfProgTypeXDP     = 6
+	bpfPseudoMapFd     = 1
+	bpfFuncRedirectMap = 51
+	iflaXDP            = 43
+	iflaXDPFd          = 1
+	iflaXDPFlags       = 3
+	ethtoolGChannels   = 0x3c
+)
+
+var errAFXDPTimeout = errors.New("afxdp: poll timeout")
+
+type xdpUmemReg struct {
+	addr      uint64
+	len       uint64
+	chunkSize uint32
+	headroom  uint32
+}
+
+type xdpRingOffset struct {
+	producer uint64
+	consumer uint64
+	desc     uint64
+}
+
+type sockaddrXDP struct {
+	family       uint16
+	flags        uint16
+	ifindex      uint32
+	queueID      uint32
+	sharedUmemFd uint32
+}
+
+type xdpDesc struct {
+	addr    uint64
+	len     uint32
+	options uint32
+}
+
+type xdpStatistics struct {
+	rxDropped      uint64
+	rxInvalidDescs uint64
+	txInvalidDescs uint64
+}
+
+type bpfInsn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+type ethtoolChannels struct {
+	cmd           uint32
+	maxRx         uint32
+	maxTx         uint32
+	maxOther      uint32
+	maxCombined   uint32
+	rxCount       uint32
+	txCount       uint32
+	otherCount    uint32
+	combinedCount uint32
+}
+
+type ethtoolIfreq struct {
+	ifrName [ethtool.IFNAMSIZ]byte
+	ifrData unsafe.Pointer
+}
+
+// afxdpOptions describes the sizes and the mode of the AF_XDP sockets
+type afxdpOptions struct {
+	frameSize int
+	frames    int
+	ringSize  int
+	zeroCopy  bool
+	queues    []int
+}
+
+// xdpRing is a single producer single consumer ring shared with the kernel,
+// either holding frame descriptors (rx) or frame addresses (fill, completion)
+type xdpRing struct {
+	mem      []byte
+	producer *uint32
+	consumer *uint32
+	desc     uint64
+	mask     uint32
+	size     uint32
+}
+
+// afxdpSocket is an AF_XDP socket bound to one receive queue of an interface,
+// with its own umem
+type afxdpSocket struct {
+	fd        int
+	queue     int
+	frameSize uint64
+	umem      []byte
+	mmaps     [][]byte
+	fill      *xdpRing
+	rx        *xdpRing
+	received  uint64
+}
+
+// AFXDPHandle describes a set of AF_XDP sockets, one per receive queue of an
+// interface, fed by an XDP program redirecting all the received packets
+type AFXDPHandle struct {
+	ifIndex  int
+	snaplen  int
+	sockets  []*afxdpSocket
+	pollFds  []unix.PollFd
+	next     int
+	mapFd    int
+	progFd   int
+	nlFd     int
+	attached bool
+	zeroCopy bool
+	filter   *flow.BPF
+}
+
+// AFXDPPacketProbe describes an AF_XDP based packet probe
+type AFXDPPacketProbe struct {
+	handle       *AFXDPHandle
+	packetSource *gopacket.PacketSource
+	layerType    gopacket.LayerType
+	linkType     layers.LinkType
+	headerSize   uint32
+}
+
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
+
+func (o *afxdpOptions) validate() error {
+	if !isPowerOfTwo(o.frameSize) || o.frameSize < xdpMinFrameSize || o.frameSize > unix.Getpagesize() {
+		return fmt.Errorf("frame size %d must be a power of 2 between %d and the page size", o.frameSize, xdpMinFrameSize)
+	}
+	if !isPowerOfTwo(o.frames) {
+		return fmt.Errorf("frames count %d must be a power of 2", o.frames)
+	}
+	if !isPowerOfTwo(o.ringSize) {
+		return fmt.Errorf("ring size %d must be a power of 2", o.ringSize)
+	}
+	return nil
+}
+
+func afxdpOptionsFromConfig() (*afxdpOptions, error) {
+	opts := &afxdpOptions{
+		frameSize: config.GetInt("agent.flow.afxdp.frame_size"),
+		frames:    config.GetInt("agent.flow.afxdp.frames"),
+		ringSize:  config.GetInt("agent.flow.afxdp.ring_size"),
+		zeroCopy:  config.GetBool("agent.flow.afxdp.zero_copy"),
+	}
+
+	for _, q := range config.GetStringSlice("agent.flow.afxdp.queues") {
+		queue, err := strconv.Atoi(q)
+		if err != nil || queue < 0 {
+			return nil, fmt.Errorf("invalid AF_XDP queue %s", q)
+		}
+		opts.queues = append(opts.queues, queue)
+	}
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func newXDPRing(mem []byte, off xdpRingOffset, size uint32) *xdpRing {
+	return &xdpRing{
+		mem:      mem,
+		producer: (*uint32)(unsafe.Pointer(&mem[off.producer])),
+		consumer: (*uint32)(unsafe.Pointer(&mem[off.consumer])),
+		desc:     off.desc,
+		mask:     size - 1,
+		size:     size,
+	}
+}
+
+// peek returns the descriptor at the head of a ring consumed by the user
+func (r *xdpRing) peek() (*xdpDesc, bool) {
+	cons := atomic.LoadUint32(r.consumer)
+	if atomic.LoadUint32(r.producer) == cons {
+		return nil, false
+	}
+	return (*xdpDesc)(unsafe.Pointer(&r.mem[r.desc+uint64(cons&r.mask)*xdpDescSize])), true
+}
+
+// release gives the descriptor at the head of the ring back to the kernel
+func (r *xdpRing) release() {
+	atomic.AddUint32(r.consumer, 1)
+}
+
+// enqueue adds a frame address to a ring produced by the user
+func (r *xdpRing) enqueue(addr uint64) bool {
+	prod := atomic.LoadUint32(r.producer)
+	if prod-atomic.LoadUint32(r.consumer) >= r.size {
+		return false
+	}
+	*(*uint64)(unsafe.Pointer(&r.mem[r.desc+uint64(prod&r.mask)*8])) = addr
+	atomic.StoreUint32(r.producer, prod+1)
+	return true
+}
+
+func bpfSyscall(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(r), nil
+}
+
+func xdpSetsockopt(fd int, opt int, value unsafe.Pointer, size uintptr) error {
+	_, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd), solXDP, uintptr(opt), uintptr(value), size, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func xdpGetsockopt(fd int, opt int, value unsafe.Pointer, size uintptr) (uintptr, error) {
+	l := uint32(size)
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), solXDP, uintptr(opt), uintptr(value), uintptr(unsafe.Pointer(&l)), 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return uintptr(l), nil
+}
+
+// xdpMmapOffsets returns the offsets of the rx, tx, fill and completion rings.
+// Since Linux 5.4 each ring offset ends with a flags field.
+func xdpMmapOffsets(fd int) (offsets [4]xdpRingOffset, err error) {
+	var raw [16]uint64
+	size, err := xdpGetsockopt(fd, xdpOptMmapOffsets, unsafe.Pointer(&raw), unsafe.Sizeof(raw))
+	if err != nil {
+		return offsets, err
+	}
+
+	stride := 4
+	if size == 4*unsafe.Sizeof(xdpRingOffset{}) {
+		stride = 3
+	}
+	for i := range offsets {
+		offsets[i] = xdpRingOffset{producer: raw[i*stride], consumer: raw[i*stride+1], desc: raw[i*stride+2]}
+	}
+	return offsets, nil
+}
+
+// rxQueues returns the number of receive queues of an interface
+func rxQueues(ifName string) int {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return 1
+	}
+	defer unix.Close(fd)
+
+	channels := ethtoolChannels{cmd: ethtoolGChannels}
+	ifr := ethtoolIfreq{ifrData: unsafe.Pointer(&channels)}
+	copy(ifr.ifrName[:], ifName)
+
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCETHTOOL, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return 1
+	}
+	if n := int(channels.rxCount + channels.combinedCount); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// xdpRedirectProgram returns the XDP program redirecting the packets to the
+// AF_XDP socket bound to their receive queue, as the kernel samples do:
+//
+//	r2 = ctx->rx_queue_index
+//	r1 = xsks_map
+//	r3 = 0
+//	return bpf_redirect_map(r1, r2, r3)
+func xdpRedirectProgram(mapFd int) []bpfInsn {
+	regs := func(dst, src uint8) uint8 {
+		if nl.NativeEndian() == binary.BigEndian {
+			return dst<<4 | src
+		}
+		return src<<4 | dst
+	}
+
+	return []bpfInsn{
+		{code: 0x61, regs: regs(2, 1), off: 16},
+		{code: 0x18, regs: regs(1, bpfPseudoMapFd), imm: int32(mapFd)},
+		{},
+		{code: 0xb7, regs: regs(3, 0)},
+		{code: 0x85, imm: bpfFuncRedirectMap},
+		{code: 0x95},
+	}
+}
+
+func newXSKMap(entries int) (int, error) {
+	attr := struct {
+		mapType    uint32
+		keySize    uint32
+		valueSize  uint32
+		maxEntries uint32
+		mapFlags   uint32
+	}{
+		mapType:    bpfMapTypeXSKMap,
+		keySize:    4,
+		valueSize:  4,
+		maxEntries: uint32(entries),
+	}
+	return bpfSyscall(bpfMapCreate, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+}
+
+// the pointers of the bpf syscall attributes are kept as unsafe.Pointer, on 64
+// bits, so that the memory they reference is not moved before the syscall
+func updateXSKMap(mapFd int, queue int, fd int) error {
+	key, value := uint32(queue), uint32(fd)
+	attr := struct {
+		mapFd uint32
+		_     uint32
+		key   unsafe.Pointer
+		value unsafe.Pointer
+		flags uint64
+	}{
+		mapFd: uint32(mapFd),
+		key:   unsafe.Pointer(&key),
+		value: unsafe.Pointer(&value),
+	}
+	_, err := bpfSyscall(bpfMapUpdateElem, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+func loadXDPRedirectProgram(mapFd int) (int, error) {
+	insns := xdpRedirectProgram(mapFd)
+	license := []byte("GPL\x00")
+	attr := struct {
+		progType    uint32
+		insnCnt     uint32
+		insns       unsafe.Pointer
+		license     unsafe.Pointer
+		logLevel    uint32
+		logSize     uint32
+		logBuf      unsafe.Pointer
+		kernVersion uint32
+		progFlags   uint32
+	}{
+		progType: bpfProgTypeXDP,
+		insnCnt:  uint32(len(insns)),
+		insns:    unsafe.Pointer(&insns[0]),
+		license:  unsafe.Pointer(&license[0]),
+	}
+	return bpfSyscall(bpfProgLoad, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+}
+
+// setXDP attaches, or detaches with a -1 fd, the XDP program of an interface
+// in native mode, so that drivers without XDP support are reported as errors
+// instead of falling back to the generic mode
+func (h *AFXDPHandle) setXDP(fd int, flags uint32) error {
+	req := nl.NewNetlinkRequest(unix.RTM_SETLINK, unix.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = int32(h.ifIndex)
+	req.AddData(msg)
+
+	xdp := nl.NewRtAttr(iflaXDP|unix.NLA_F_NESTED, nil)
+	nl.NewRtAttrChild(xdp, iflaXDPFd, nl.Uint32Attr(uint32(int32(fd))))
+	nl.NewRtAttrChild(xdp, iflaXDPFlags, nl.Uint32Attr(flags|xdpFlagsDrvMode))
+	req.AddData(xdp)
+
+	if err := unix.Sendto(h.nlFd, req.Serialize(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	n, _, err := unix.Recvfrom(h.nlFd, buf, 0)
+	if err != nil {
+		return err
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if m.Header.Type == unix.NLMSG_ERROR && len(m.Data) >= 4 {
+			if errno := int32(nl.NativeEndian().Uint32(m.Data[0:4])); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *afxdpSocket) close() {
+	for _, m := range s.mmaps {
+		unix.Munmap(m)
+	}
+	if s.umem != nil {
+		unix.Munmap(s.umem)
+	}
+	unix.Close(s.fd)
+}
+
+func (s *afxdpSocket) mmapRing(off xdpRingOffset, entrySize, entries int, pgoff int64) (*xdpRing, error) {
+	mem, err := unix.Mmap(s.fd, pgoff, int(off.desc)+entrySize*entries, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return nil, err
+	}
+	s.mmaps = append(s.mmaps, mem)
+	return newXDPRing(mem, off, uint32(entries)), nil
+}
+
+func (s *afxdpSocket) setup(ifIndex int, opts *afxdpOptions, zeroCopy bool) (err error) {
+	if s.umem, err = unix.Mmap(-1, 0, opts.frameSize*opts.frames, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE); err != nil {
+		return fmt.Errorf("failed to allocate umem: %s", err)
+	}
+
+	reg := xdpUmemReg{
+		addr:      uint64(uintptr(unsafe.Pointer(&s.umem[0]))),
+		len:       uint64(len(s.umem)),
+		chunkSize: uint32(opts.frameSize),
+	}
+	if err = xdpSetsockopt(s.fd, xdpOptUmemReg, unsafe.Pointer(&reg), unsafe.Sizeof(reg)); err != nil {
+		return fmt.Errorf("failed to register umem: %s", err)
+	}
+
+	// every frame sits either in the fill ring, in the rx ring or is being
+	// read, so the fill ring never overflows
+	rings := []struct{ opt, size int }{
+		{xdpOptUmemFillRing, opts.frames},
+		{xdpOptCompletionRing, opts.ringSize},
+		{xdpOptRxRing, opts.ringSize},
+	}
+	for _, ring := range rings {
+		if err = unix.SetsockoptInt(s.fd, solXDP, ring.opt, ring.size); err != nil {
+			return fmt.Errorf("failed to set ring size: %s", err)
+		}
+	}
+
+	offsets, err := xdpMmapOffsets(s.fd)
+	if err != nil {
+		return fmt.Errorf("failed to get ring offsets: %s", err)
+	}
+
+	if s.rx, err = s.mmapRing(offsets[0], xdpDescSize, opts.ringSize, xdpPgoffRxRing); err != nil {
+		return fmt.Errorf("failed to map rx ring: %s", err)
+	}
+	if s.fill, err = s.mmapRing(offsets[2], 8, opts.frames, xdpUmemPgoffFillRing); err != nil {
+		return fmt.Errorf("failed to map fill ring: %s", err)
+	}
+	// the completion ring is only used for transmission but it is required by
+	// the bind
+	if _, err = s.mmapRing(offsets[3], 8, opts.ringSize, xdpUmemPgoffCompletion); err != nil {
+		return fmt.Errorf("failed to map completion ring: %s", err)
+	}
+
+	for i := 0; i < opts.frames; i++ {
+		s.fill.enqueue(uint64(i * opts.frameSize))
+	}
+
+	flags := uint16(xdpCopy)
+	if zeroCopy {
+		flags = xdpZeroCopy
+	}
+	sa := sockaddrXDP{family: afXDP, flags: flags, ifindex: uint32(ifIndex), queueID: uint32(s.queue)}
+	if _, _, errno := unix.Syscall(unix.SYS_BIND, uintptr(s.fd), uintptr(unsafe.Pointer(&sa)), unsafe.Sizeof(sa)); errno != 0 {
+		return fmt.Errorf("failed to bind to queue %d: %s", s.queue, errno)
+	}
+
+	return nil
+}
+
+func newAFXDPSocket(ifIndex int, queue int, opts *afxdpOptions, zeroCopy bool) (*afxdpSocket, error) {
+	fd, err := unix.Socket(afXDP, unix.SOCK_RAW, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AF_XDP socket: %s", err)
+	}
+
+	s := &afxdpSocket{fd: fd, queue: queue, frameSize: uint64(opts.frameSize)}
+	if err = s.setup(ifIndex, opts, zeroCopy); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// receive returns a copy, truncated to snaplen, of the next received packet
+func (s *afxdpSocket) receive(snaplen int) ([]byte, gopacket.CaptureInfo, bool) {
+	desc, ok := s.rx.peek()
+	if !ok {
+		return nil, gopacket.CaptureInfo{}, false
+	}
+
+	length := int(desc.len)
+	captureLength := length
+	if captureLength > snaplen {
+		captureLength = snaplen
+	}
+
+	data := make([]byte, captureLength)
+	copy(data, s.umem[desc.addr:desc.addr+uint64(captureLength)])
+
+	s.fill.enqueue(desc.addr &^ (s.frameSize - 1))
+	s.rx.release()
+	s.received++
+
+	return data, gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: captureLength, Length: length}, true
+}
+
+// ReadPacketData reads one packet from the sockets in a round robin manner
+func (h *AFXDPHandle) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	for {
+		for i := range h.sockets {
+			idx := (h.next + i) % len(h.sockets)
+			if data, ci, ok := h.sockets[idx].receive(h.snaplen); ok {
+				h.next = (idx + 1) % len(h.sockets)
+				if h.filter != nil && !h.filter.Matches(data) {
+					continue
+				}
+				return data, ci, nil
+			}
+		}
+
+		n, err := unix.Poll(h.pollFds, 1000)
+		if err != nil && err != unix.EINTR {
+			return nil, gopacket.CaptureInfo{}, err
+		}
+		if n == 0 {
+			return nil, gopacket.CaptureInfo{}, errAFXDPTimeout
+		}
+	}
+}
+
+// Stats returns the number of received and dropped packets of all the queues
+func (h *AFXDPHandle) Stats() (received uint64, dropped uint64) {
+	for _, s := range h.sockets {
+		received += s.received
+
+		var stats xdpStatistics
+		if _, err := xdpGetsockopt(s.fd, xdpOptStatistics, unsafe.Pointer(&stats), unsafe.Sizeof(stats)); err == nil {
+			dropped += stats.rxDropped
+		}
+	}
+	return
+}
+
+// Close detaches the XDP program and releases the sockets
+func (h *AFXDPHandle) Close() {
+	if h.attached {
+		h.setXDP(-1, 0)
+	}
+	if h.nlFd >= 0 {
+		unix.Close(h.nlFd)
+	}
+	for _, s := range h.sockets {
+		s.close()
+	}
+	if h.progFd >= 0 {
+		unix.Close(h.progFd)
+	}
+	if h.mapFd >= 0 {
+		unix.Close(h.mapFd)
+	}
+}
+
+func (h *AFXDPHandle) addSocket(queue int, opts *afxdpOptions) error {
+	s, err := newAFXDPSocket(h.ifIndex, queue, opts, h.zeroCopy)
+	if err != nil && h.zeroCopy {
+		// the driver may support XDP but not the zero-copy mode
+		h.zeroCopy = false
+		s, err = newAFXDPSocket(h.ifIndex, queue, opts, false)
+	}
+	if err != nil {
+		return err
+	}
+
+	h.sockets = append(h.sockets, s)
+	h.pollFds = append(h.pollFds, unix.PollFd{Fd: int32(s.fd), Events: unix.POLLIN})
+
+	return updateXSKMap(h.mapFd, queue, s.fd)
+}
+
+// NewAFXDPHandle creates the AF_XDP sockets of an interface and attaches the
+// XDP program redirecting the received packets to them. It has to be called
+// within the namespace of the interface.
+func NewAFXDPHandle(ifName string, snaplen int, opts *afxdpOptions) (_ *AFXDPHandle, err error) {
+	intf, err := net.InterfaceByName(ifName)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := opts.queues
+	if len(queues) == 0 {
+		for i := 0; i < rxQueues(ifName); i++ {
+			queues = append(queues, i)
+		}
+	}
+
+	maxQueue := 0
+	for _, q := range queues {
+		if q > maxQueue {
+			maxQueue = q
+		}
+	}
+
+	h := &AFXDPHandle{ifIndex: intf.Index, snaplen: snaplen, mapFd: -1, progFd: -1, nlFd: -1, zeroCopy: opts.zeroCopy}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+
+	if h.mapFd, err = newXSKMap(maxQueue + 1); err != nil {
+		return nil, fmt.Errorf("failed to create XSKMAP: %s", err)
+	}
+	if h.progFd, err = loadXDPRedirectProgram(h.mapFd); err != nil {
+		return nil, fmt.Errorf("failed to load XDP program: %s", err)
+	}
+
+	for _, q := range queues {
+		if err = h.addSocket(q, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// the netlink socket is kept to detach the program from within the
+	// namespace of the interface
+	if h.nlFd, err = unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE); err != nil {
+		return nil, err
+	}
+	if err = unix.Bind(h.nlFd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, err
+	}
+
+	if err = h.setXDP(h.progFd, xdpFlagsUpdateIfNoExist); err != nil {
+		return nil, fmt.Errorf("failed to attach XDP program in native mode: %s", err)
+	}
+	h.attached = true
+
+	return h, nil
+}
+
+// Close the probe
+func (a *AFXDPPacketProbe) Close() {
+	a.handle.Close()
+}
+
+// Stats returns statistics about captured packets
+func (a *AFXDPPacketProbe) Stats() (graph.Metadata, error) {
+	received, dropped := a.handle.Stats()
+	return graph.Metadata{
+		"PacketsReceived": int64(received),
+		"PacketsDropped":  int64(dropped),
+		"ZeroCopy":        a.handle.zeroCopy,
+	}, nil
+}
+
+// SetBPFFilter applies a BPF filter to the probe. AF_XDP sockets do not
+// support socket filters, the filter is applied in userspace.
+func (a *AFXDPPacketProbe) SetBPFFilter(filter string) error {
+	bpfFilter, err := flow.NewBPF(a.linkType, a.headerSize, filter)
+	if err != nil {
+		return err
+	}
+	a.handle.filter = bpfFilter
+	return nil
+}
+
+// PacketSource returns the Gopacket packet source for the probe
+func (a *AFXDPPacketProbe) PacketSource() *gopacket.PacketSource {
+	return a.packetSource
+}
+
+// NewAFXDPPacketProbe returns a new AF_XDP capture probe
+func NewAFXDPPacketProbe(ifName string, headerSize int, layerType gopacket.LayerType, linkType layers.LinkType) (*AFXDPPacketProbe, error) {
+	opts, err := afxdpOptionsFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := NewAFXDPHandle(ifName, headerSize, opts)
+	if err != nil {
+		return nil, fmt.Errorf("Error while opening AF_XDP sockets on %s: %s", ifName, err)
+	}
+
+	return &AFXDPPacketProbe{
+		handle:       handle,
+		packetSource: gopacket.NewPacketSource(handle, layerType),
+		layerType:    layerType,
+		linkType:     linkType,
+		headerSize:   uint32(headerSize),
+	}, nil
+}
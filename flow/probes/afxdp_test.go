@@ -0,0 +1,99 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestXDPRing(t *testing.T) {
+	mem := make([]byte, 64+4*xdpDescSize)
+	off := xdpRingOffset{producer: 0, consumer: 32, desc: 64}
+
+	fill := newXDPRing(mem, off, 4)
+	for i := 0; i < 4; i++ {
+		if !fill.enqueue(uint64(i * 2048)) {
+			t.Fatalf("fill ring full after %d frames", i)
+		}
+	}
+	if fill.enqueue(4 * 2048) {
+		t.Fatal("fill ring should be full")
+	}
+
+	// the kernel consumes a frame
+	*fill.consumer++
+	if !fill.enqueue(4 * 2048) {
+		t.Fatal("fill ring should have room for a frame")
+	}
+	if addr := *(*uint64)(unsafe.Pointer(&mem[64])); addr != 4*2048 {
+		t.Fatalf("expected the frame address to wrap to the first entry, got %d", addr)
+	}
+
+	mem = make([]byte, 64+4*xdpDescSize)
+	rx := newXDPRing(mem, off, 4)
+	if _, ok := rx.peek(); ok {
+		t.Fatal("rx ring should be empty")
+	}
+
+	// the kernel produces a descriptor
+	*(*xdpDesc)(unsafe.Pointer(&mem[64])) = xdpDesc{addr: 2048 + 256, len: 60}
+	*rx.producer++
+
+	desc, ok := rx.peek()
+	if !ok || desc.addr != 2048+256 || desc.len != 60 {
+		t.Fatalf("unexpected descriptor: %+v", desc)
+	}
+	rx.release()
+	if _, ok := rx.peek(); ok {
+		t.Fatal("rx ring should be empty once the descriptor is released")
+	}
+}
+
+func TestAFXDPOptions(t *testing.T) {
+	valid := afxdpOptions{frameSize: 2048, frames: 4096, ringSize: 2048}
+	if err := valid.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []afxdpOptions{
+		{frameSize: 1024, frames: 4096, ringSize: 2048},
+		{frameSize: 3000, frames: 4096, ringSize: 2048},
+		{frameSize: 2048, frames: 4000, ringSize: 2048},
+		{frameSize: 2048, frames: 4096, ringSize: 0},
+	} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("options %+v should be rejected", opts)
+		}
+	}
+}
+
+func TestXDPRedirectProgram(t *testing.T) {
+	insns := xdpRedirectProgram(42)
+	if len(insns) != 6 {
+		t.Fatalf("expected 6 instructions, got %d", len(insns))
+	}
+	if insns[1].code != 0x18 || insns[1].imm != 42 {
+		t.Errorf("expected the map fd to be loaded, got %+v", insns[1])
+	}
+	if insns[4].imm != bpfFuncRedirectMap || insns[5].code != 0x95 {
+		t.Errorf("expected a call to bpf_redirect_map followed by exit, got %+v", insns[4:])
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// Defaults of the DNS statistics reports
+const (
+	DefaultDNSStatsInterval = 60 * time.Second
+	DefaultDNSStatsTop      = 10
+)
+
+// DNSStatsReporter periodically reports the DNS statistics of the flow
+// tables in the DNS metadata of the host node
+type DNSStatsReporter struct {
+	graph    *graph.Graph
+	node     *graph.Node
+	stats    *flow.DNSStats
+	interval time.Duration
+	top      int
+	quit     chan bool
+	wg       sync.WaitGroup
+}
+
+func (r *DNSStatsReporter) report() {
+	report := r.stats.Report(r.top)
+
+	domains := make([]interface{}, len(report.TopDomains))
+	for i, d := range report.TopDomains {
+		domains[i] = map[string]interface{}{
+			"Domain":   d.Domain,
+			"Queries":  d.Queries,
+			"NXDomain": d.NXDomain,
+			"Names":    d.Names,
+		}
+	}
+
+	rcodes := make(map[string]interface{}, len(report.ResponseCodes))
+	for rcode, count := range report.ResponseCodes {
+		rcodes[rcode] = count
+	}
+
+	r.graph.Lock()
+	defer r.graph.Unlock()
+
+	if report.Queries == 0 && report.Responses == 0 {
+		// nothing to report unless the previous interval was not empty
+		if queries, err := r.node.GetFieldInt64("DNS.Queries"); err != nil || queries == 0 {
+			return
+		}
+	}
+
+	r.graph.AddMetadata(r.node, "DNS", map[string]interface{}{
+		"Start":         report.Start,
+		"Last":          report.Last,
+		"Queries":       report.Queries,
+		"Responses":     report.Responses,
+		"NXDomain":      report.NXDomain,
+		"NXDomainRate":  report.NXDomainRate,
+		"ResponseCodes": rcodes,
+		"TopDomains":    domains,
+	})
+}
+
+// Start the reporter
+func (r *DNSStatsReporter) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.report()
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the reporter
+func (r *DNSStatsReporter) Stop() {
+	r.quit <- true
+	r.wg.Wait()
+}
+
+// NewDNSStatsReporter returns a new reporter of the DNS statistics to node,
+// reporting the top domains by number of queries every interval. The
+// defaults are used for invalid intervals or numbers of domains.
+func NewDNSStatsReporter(g *graph.Graph, node *graph.Node, stats *flow.DNSStats, interval time.Duration, top int) *DNSStatsReporter {
+	if interval <= 0 {
+		interval = DefaultDNSStatsInterval
+	}
+	if top <= 0 {
+		top = DefaultDNSStatsTop
+	}
+
+	return &DNSStatsReporter{
+		graph:    g,
+		node:     node,
+		stats:    stats,
+		interval: interval,
+		top:      top,
+		quit:     make(chan bool),
+	}
+}
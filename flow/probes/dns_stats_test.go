@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func TestDNSStatsReporterDefaults(t *testing.T) {
+	for _, test := range []struct {
+		interval         time.Duration
+		top              int
+		expectedInterval time.Duration
+		expectedTop      int
+	}{
+		{30 * time.Second, 5, 30 * time.Second, 5},
+		{0, 0, DefaultDNSStatsInterval, DefaultDNSStatsTop},
+		{-time.Second, -1, DefaultDNSStatsInterval, DefaultDNSStatsTop},
+	} {
+		r := NewDNSStatsReporter(nil, nil, flow.NewDNSStats(0), test.interval, test.top)
+		if r.interval != test.expectedInterval || r.top != test.expectedTop {
+			t.Errorf("Expected interval %s and top %d, got %s and %d", test.expectedInterval, test.expectedTop, r.interval, r.top)
+		}
+
+		// the report must not panic on the top domains
+		r.stats.Report(r.top)
+	}
+}
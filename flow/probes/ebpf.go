@@ -37,6 +37,7 @@ import (
 
 	"github.com/skydive-project/skydive/api/types"
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
@@ -67,6 +68,7 @@ type EBPFProbe struct {
 	flowTable    *flow.Table
 	module       *elf.Module
 	fmap         *elf.Map
+	tcp          *tcpTracer
 	expire       time.Duration
 	quit         chan bool
 }
@@ -78,6 +80,8 @@ type EBPFProbesHandler struct {
 	probesLock common.RWMutex
 	fpta       *FlowProbeTableAllocator
 	wg         sync.WaitGroup
+	tcp        *tcpTracer
+	tcpFailed  bool
 }
 
 func kernFlowKeyOuter(kernFlow *C.struct_flow) string {
@@ -142,6 +146,17 @@ func kernLayersPath(kernFlow *C.struct_flow) (layersPath string, hasGRE bool) {
 	return layersPath, hasGRE
 }
 
+// fillTCPMetric adds the metrics of the local sockets of the flow
+func (p *EBPFProbe) fillTCPMetric(kernFlow *C.struct_flow, tm *flow.TCPMetric) {
+	if p.tcp == nil || uint8(kernFlow.layers_info)&uint8(C.NETWORK_LAYER_INFO) == 0 {
+		return
+	}
+
+	ipA := C.GoBytes(unsafe.Pointer(&kernFlow.network_layer.ip_src[0]), net.IPv6len)
+	ipB := C.GoBytes(unsafe.Pointer(&kernFlow.network_layer.ip_dst[0]), net.IPv6len)
+	p.tcp.fillTCPMetric(ipA, ipB, uint16(kernFlow.transport_layer.port_src), uint16(kernFlow.transport_layer.port_dst), tm)
+}
+
 func (p *EBPFProbe) newFlowOperation(ebpfFlow *EBPFFlow, kernFlow *C.struct_flow, startKTimeNs int64, start time.Time) []*flow.Operation {
 
 	var fops []*flow.Operation
@@ -270,6 +285,7 @@ func (p *EBPFProbe) newFlowOperation(ebpfFlow *EBPFFlow, kernFlow *C.struct_flow
 				ABRstStart: tcpFlagTime(kernFlow.transport_layer.ab_rst, startKTimeNs, start),
 				BARstStart: tcpFlagTime(kernFlow.transport_layer.ba_rst, startKTimeNs, start),
 			}
+			p.fillTCPMetric(kernFlow, f.TCPMetric)
 			/* disabled for now as no payload is sent
 			p := gopacket.NewPacket(C.GoBytes(unsafe.Pointer(&kernFlow.payload[0]), C.PAYLOAD_LENGTH), layers.LayerTypeTCP, gopacket.DecodeOptions{})
 			if p.Layer(gopacket.LayerTypeDecodeFailure) == nil {
@@ -338,6 +354,7 @@ func (p *EBPFProbe) updateFlowOperation(ebpfFlow *EBPFFlow, kernFlow *C.struct_f
 				ABRstStart: tcpFlagTime(kernFlow.transport_layer.ab_rst, startKTimeNs, start),
 				BARstStart: tcpFlagTime(kernFlow.transport_layer.ba_rst, startKTimeNs, start),
 			}
+			p.fillTCPMetric(kernFlow, f.TCPMetric)
 		}
 	}
 	f.Metric = &flow.FlowMetric{
@@ -501,7 +518,16 @@ func (p *EBPFProbesHandler) registerProbe(n *graph.Node, capture *types.Capture,
 		return fmt.Errorf("Unable to attach socket filter to node: %s", n.ID)
 	}
 
-	ft := p.fpta.Alloc(tid, flow.TableOpts{})
+	// the TCP metrics are reported by the sockets of the host, shared by
+	// all the probes
+	if p.tcp == nil && !p.tcpFailed && config.GetBool("agent.flow.ebpf.tcp_metrics") {
+		if p.tcp, err = newTCPTracer(); err != nil {
+			logging.GetLogger().Warningf("eBPF TCP metrics disabled: %s", err)
+			p.tcpFailed = true
+		}
+	}
+
+	ft := p.fpta.Alloc(tid, flow.TableOpts{Provenance: provenanceFromCapture(capture, 0, 0, 0)})
 
 	probe := &EBPFProbe{
 		probeNodeTID: tid,
@@ -509,6 +535,7 @@ func (p *EBPFProbesHandler) registerProbe(n *graph.Node, capture *types.Capture,
 		flowTable:    ft,
 		module:       module,
 		fmap:         fmap,
+		tcp:          p.tcp,
 		expire:       p.fpta.Expire(),
 		quit:         make(chan bool),
 	}
@@ -578,6 +605,11 @@ func (p *EBPFProbesHandler) Stop() {
 		p.unregisterProbe(id)
 	}
 	p.wg.Wait()
+
+	if p.tcp != nil {
+		p.tcp.close()
+		p.tcp = nil
+	}
 }
 
 func LoadJumpMap(module *elf.Module) error {
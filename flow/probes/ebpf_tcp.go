@@ -0,0 +1,182 @@
+// +build ebpf
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/iovisor/gobpf/elf"
+
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/statics"
+)
+
+// #cgo CFLAGS: -I../../probe/ebpf
+// #include "tcp.h"
+import "C"
+
+// tcpTracepointFields are the fields of the tcp tracepoints read by the
+// eBPF program, with the index of their offset in the tcp_offsets map and
+// the minimal size expected
+var tcpTracepointFields = map[string][]struct {
+	name  string
+	index uint32
+	size  int
+}{
+	"tcp_probe": {
+		{"saddr", C.TCP_PROBE_SADDR, 28},
+		{"daddr", C.TCP_PROBE_DADDR, 28},
+		{"sport", C.TCP_PROBE_SPORT, 2},
+		{"dport", C.TCP_PROBE_DPORT, 2},
+		{"snd_wnd", C.TCP_PROBE_SND_WND, 4},
+		{"srtt", C.TCP_PROBE_SRTT, 4},
+	},
+	"tcp_retransmit_skb": {
+		{"saddr_v6", C.TCP_RETRANSMIT_SADDR_V6, 16},
+		{"daddr_v6", C.TCP_RETRANSMIT_DADDR_V6, 16},
+		{"sport", C.TCP_RETRANSMIT_SPORT, 2},
+		{"dport", C.TCP_RETRANSMIT_DPORT, 2},
+	},
+}
+
+// tcpSocketStats holds the metrics of a local TCP socket
+type tcpSocketStats struct {
+	srtt        time.Duration
+	retransmits int64
+	zeroWindows int64
+}
+
+// tcpTracer reports the smoothed RTT, the retransmissions and the zero
+// windows of the local TCP sockets, maintained by an eBPF program attached
+// to the tcp tracepoints
+type tcpTracer struct {
+	module *elf.Module
+	stats  *elf.Map
+}
+
+// enableTracepoint sets the offsets of the fields of a tracepoint read by
+// the eBPF program, then attaches the program to the tracepoint
+func (t *tcpTracer) enableTracepoint(name string, offsets *elf.Map) error {
+	format, err := tracepointFormat("tcp", name)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range tcpTracepointFields[name] {
+		field, ok := format[f.name]
+		if !ok || field.size < f.size {
+			return fmt.Errorf("Unsupported layout of the tcp/%s tracepoint, field %s", name, f.name)
+		}
+
+		index, offset := f.index, uint32(field.offset)
+		if err := t.module.UpdateElement(offsets, unsafe.Pointer(&index), unsafe.Pointer(&offset), BPF_ANY); err != nil {
+			return err
+		}
+	}
+
+	return t.module.EnableTracepoint("tracepoint/tcp/" + name)
+}
+
+// lookup returns the metrics of the socket of the local endpoint src
+func (t *tcpTracer) lookup(ipSrc, ipDst []byte, portSrc, portDst uint16) (*tcpSocketStats, bool) {
+	var key C.struct_tcp_key
+	for i := range key.ip_src {
+		key.ip_src[i] = C.__u8(ipSrc[i])
+		key.ip_dst[i] = C.__u8(ipDst[i])
+	}
+	key.port_src = C.__u16(portSrc)
+	key.port_dst = C.__u16(portDst)
+
+	var stats C.struct_tcp_stats
+	if err := t.module.LookupElement(t.stats, unsafe.Pointer(&key), unsafe.Pointer(&stats)); err != nil {
+		return nil, false
+	}
+
+	return &tcpSocketStats{
+		srtt:        time.Duration(stats.srtt_us) * time.Microsecond,
+		retransmits: int64(stats.retransmits),
+		zeroWindows: int64(stats.zero_windows),
+	}, true
+}
+
+// fillTCPMetric sets the metrics of the local sockets of a flow, the socket
+// of A sending to B and the one of B sending to A. The zero windows seen by
+// a socket are the ones advertised by its peer.
+func (t *tcpTracer) fillTCPMetric(ipA, ipB []byte, portA, portB uint16, tm *flow.TCPMetric) {
+	if stats, ok := t.lookup(ipA, ipB, portA, portB); ok {
+		tm.ABSRTT = int64(stats.srtt)
+		tm.ABRetransmits = stats.retransmits
+		tm.BAZeroWindows = stats.zeroWindows
+	}
+
+	if stats, ok := t.lookup(ipB, ipA, portB, portA); ok {
+		tm.BASRTT = int64(stats.srtt)
+		tm.BARetransmits = stats.retransmits
+		tm.ABZeroWindows = stats.zeroWindows
+	}
+}
+
+func (t *tcpTracer) close() {
+	t.module.Close()
+}
+
+// newTCPTracer loads the eBPF program and attaches it to the tcp
+// tracepoints available, tcp_probe reporting the RTT and the windows since
+// Linux 4.16, tcp_retransmit_skb the retransmissions since Linux 4.15
+func newTCPTracer() (*tcpTracer, error) {
+	data, err := statics.Asset("probe/ebpf/tcp.o")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to find the eBPF tcp elf binary in bindata")
+	}
+
+	module := elf.NewModuleFromReader(bytes.NewReader(data))
+	if err := module.Load(nil); err != nil {
+		return nil, fmt.Errorf("Unable to load the eBPF tcp elf binary: %s", err)
+	}
+
+	offsets, stats := module.Map("tcp_offsets"), module.Map("tcp_stats")
+	if offsets == nil || stats == nil {
+		module.Close()
+		return nil, errors.New("Unable to find the tcp maps")
+	}
+
+	t := &tcpTracer{module: module, stats: stats}
+
+	enabled := 0
+	for _, name := range []string{"tcp_probe", "tcp_retransmit_skb"} {
+		if err := t.enableTracepoint(name, offsets); err != nil {
+			logging.GetLogger().Warningf("TCP metrics of tcp/%s not available: %s", name, err)
+			continue
+		}
+		enabled++
+	}
+
+	if enabled == 0 {
+		module.Close()
+		return nil, errors.New("No tcp tracepoint available")
+	}
+
+	return t, nil
+}
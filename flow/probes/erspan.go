@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/erspan"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// ERSPANProbesHandler describes an ERSPAN and GRE-TAP mirror session probe
+// in the graph
+type ERSPANProbesHandler struct {
+	Graph      *graph.Graph
+	fpta       *FlowProbeTableAllocator
+	sources    []erspan.MirrorSource
+	probes     map[string]*erspan.Receiver
+	probesLock common.RWMutex
+}
+
+// UnregisterProbe unregisters a probe from the graph
+func (d *ERSPANProbesHandler) UnregisterProbe(n *graph.Node, e FlowProbeEventHandler) error {
+	var tid string
+	if tid, _ = n.GetFieldString("TID"); tid == "" {
+		return fmt.Errorf("No TID for node %v", n)
+	}
+
+	d.probesLock.Lock()
+	receiver, ok := d.probes[tid]
+	if !ok {
+		d.probesLock.Unlock()
+		return fmt.Errorf("No registered probe for %s", tid)
+	}
+	delete(d.probes, tid)
+	d.probesLock.Unlock()
+
+	receiver.Stop()
+
+	if e != nil {
+		go e.OnStopped()
+	}
+
+	return nil
+}
+
+func (d *ERSPANProbesHandler) registerProbe(n *graph.Node, capture *types.Capture, e FlowProbeEventHandler) error {
+	var tid string
+	if tid, _ = n.GetFieldString("TID"); tid == "" {
+		return fmt.Errorf("No TID for node %v", n)
+	}
+
+	d.probesLock.RLock()
+	_, ok := d.probes[tid]
+	d.probesLock.RUnlock()
+	if ok {
+		return fmt.Errorf("Already registered %s", tid)
+	}
+
+	addresses, _ := n.GetFieldStringList("IPV4")
+	if len(addresses) == 0 {
+		return fmt.Errorf("No IP for node %v", n)
+	}
+
+	address := "0.0.0.0"
+	if len(addresses) == 1 {
+		address = strings.Split(addresses[0], "/")[0]
+	}
+
+	headerSize := flow.DefaultCaptureLength
+	if capture.HeaderSize != 0 {
+		headerSize = uint32(capture.HeaderSize)
+	}
+
+	receiver := erspan.NewReceiver(address, tid, d.sources, d.fpta, tableOptsFromCapture(capture), capture.BPFFilter, headerSize)
+	if err := receiver.Start(); err != nil {
+		return err
+	}
+
+	d.probesLock.Lock()
+	d.probes[tid] = receiver
+	d.probesLock.Unlock()
+
+	go e.OnStarted()
+
+	d.Graph.AddMetadata(n, "Capture.MirrorAddress", address)
+
+	return nil
+}
+
+// RegisterProbe registers a probe in the graph
+func (d *ERSPANProbesHandler) RegisterProbe(n *graph.Node, capture *types.Capture, e FlowProbeEventHandler) error {
+	err := d.registerProbe(n, capture, e)
+	if err != nil {
+		go e.OnError(err)
+	}
+	return err
+}
+
+// Start a probe
+func (d *ERSPANProbesHandler) Start() {
+}
+
+// Stop a probe
+func (d *ERSPANProbesHandler) Stop() {
+	d.probesLock.Lock()
+	defer d.probesLock.Unlock()
+
+	for tid, receiver := range d.probes {
+		receiver.Stop()
+		delete(d.probes, tid)
+	}
+}
+
+// NewERSPANProbesHandler creates a new ERSPAN and GRE-TAP probe in the graph
+func NewERSPANProbesHandler(g *graph.Graph, fpta *FlowProbeTableAllocator) (*ERSPANProbesHandler, error) {
+	var sources []erspan.MirrorSource
+	if cfg := config.Get("agent.flow.erspan.mirror_sources"); cfg != nil {
+		if err := mapstructure.Decode(cfg, &sources); err != nil {
+			return nil, fmt.Errorf("Unable to read agent.flow.erspan.mirror_sources: %s", err)
+		}
+	}
+
+	for _, source := range sources {
+		if source.TID == "" {
+			return nil, fmt.Errorf("ERSPAN mirror sources require a TID: %+v", source)
+		}
+	}
+
+	return &ERSPANProbesHandler{
+		Graph:   g,
+		fpta:    fpta,
+		sources: sources,
+		probes:  make(map[string]*erspan.Receiver),
+	}, nil
+}
@@ -42,6 +42,8 @@ import (
 const (
 	// AFPacket probe type
 	AFPacket = "afpacket"
+	// AFXDP probe type
+	AFXDP = "afxdp"
 	// PCAP probe type
 	PCAP = "pcap"
 )
@@ -118,7 +120,7 @@ func (p *GoPacketProbe) listen(packetCallback func(gopacket.Packet)) {
 			}
 		case io.EOF:
 			time.Sleep(20 * time.Millisecond)
-		case afpacket.ErrTimeout:
+		case afpacket.ErrTimeout, errAFXDPTimeout:
 			// nothing to do, poll wait for new packet or timeout
 		default:
 			time.Sleep(200 * time.Millisecond)
@@ -148,6 +150,18 @@ func (p *GoPacketProbe) Run(packetCallback func(gopacket.Packet), e FlowProbeEve
 			return err
 		}
 		logging.GetLogger().Infof("PCAP Capture started on %s with First layer: %s", p.ifName, p.layerType)
+	case AFXDP:
+		// the sockets of a previous capture on the same queues are released
+		// asynchronously by the kernel
+		if err = common.Retry(func() error {
+			p.packetProbe, err = NewAFXDPPacketProbe(p.ifName, int(p.headerSize), p.layerType, p.linkType)
+			return err
+		}, 2, 100*time.Millisecond); err == nil {
+			logging.GetLogger().Infof("AF_XDP Capture started on %s with First layer: %s", p.ifName, p.layerType)
+			break
+		}
+		logging.GetLogger().Warningf("AF_XDP not available on %s, falling back to afpacket: %s", p.ifName, err)
+		fallthrough
 	default:
 		if err = common.Retry(func() error {
 			p.packetProbe, err = NewAfpacketPacketProbe(p.ifName, int(p.headerSize), p.layerType, p.linkType)
@@ -202,7 +216,7 @@ func (p *GoPacketProbe) Stop() {
 	atomic.StoreInt64(&p.state, common.StoppingState)
 }
 
-// NewGoPacketProbe returns a new Gopacket flow probe. It can use either `pcap` or `afpacket`
+// NewGoPacketProbe returns a new Gopacket flow probe. It can use either `pcap`, `afpacket` or `afxdp`
 func NewGoPacketProbe(g *graph.Graph, n *graph.Node, captureType string, bpf string, headerSize uint32) (*GoPacketProbe, error) {
 	ifName, _ := n.GetFieldString("Name")
 	if ifName == "" {
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/netflow"
+)
+
+const (
+	defaultNetFlowPort = 2055
+)
+
+// NetFlowProbesHandler describes a NetFlow/IPFIX collector probe in the graph
+type NetFlowProbesHandler struct {
+	Graph      *graph.Graph
+	fpta       *FlowProbeTableAllocator
+	probes     map[string]*netflow.Collector
+	probesLock common.RWMutex
+}
+
+// UnregisterProbe unregisters a probe from the graph
+func (d *NetFlowProbesHandler) UnregisterProbe(n *graph.Node, e FlowProbeEventHandler) error {
+	var tid string
+	if tid, _ = n.GetFieldString("TID"); tid == "" {
+		return fmt.Errorf("No TID for node %v", n)
+	}
+
+	d.probesLock.Lock()
+	collector, ok := d.probes[tid]
+	if !ok {
+		d.probesLock.Unlock()
+		return fmt.Errorf("No registered probe for %s", tid)
+	}
+	delete(d.probes, tid)
+	d.probesLock.Unlock()
+
+	collector.Stop()
+
+	if e != nil {
+		go e.OnStopped()
+	}
+
+	return nil
+}
+
+func (d *NetFlowProbesHandler) registerProbe(n *graph.Node, capture *types.Capture, e FlowProbeEventHandler) error {
+	var tid string
+	if tid, _ = n.GetFieldString("TID"); tid == "" {
+		return fmt.Errorf("No TID for node %v", n)
+	}
+
+	d.probesLock.RLock()
+	_, ok := d.probes[tid]
+	d.probesLock.RUnlock()
+	if ok {
+		return fmt.Errorf("Already registered %s", tid)
+	}
+
+	addresses, _ := n.GetFieldStringList("IPV4")
+	if len(addresses) == 0 {
+		return fmt.Errorf("No IP for node %v", n)
+	}
+
+	address := "0.0.0.0"
+	if len(addresses) == 1 {
+		address = strings.Split(addresses[0], "/")[0]
+	}
+
+	if capture.Port <= 0 {
+		capture.Port = defaultNetFlowPort
+	}
+
+	addr := common.ServiceAddress{Addr: address, Port: capture.Port}
+	collector := netflow.NewCollector(&addr, d.Graph, n, d.fpta, tableOptsFromCapture(capture))
+	if err := collector.Start(); err != nil {
+		return err
+	}
+
+	d.probesLock.Lock()
+	d.probes[tid] = collector
+	d.probesLock.Unlock()
+
+	go e.OnStarted()
+
+	d.Graph.AddMetadata(n, "Capture.NetFlowSocket", addr.String())
+
+	return nil
+}
+
+// RegisterProbe registers a probe in the graph
+func (d *NetFlowProbesHandler) RegisterProbe(n *graph.Node, capture *types.Capture, e FlowProbeEventHandler) error {
+	err := d.registerProbe(n, capture, e)
+	if err != nil {
+		go e.OnError(err)
+	}
+	return err
+}
+
+// Start a probe
+func (d *NetFlowProbesHandler) Start() {
+}
+
+// Stop a probe
+func (d *NetFlowProbesHandler) Stop() {
+	d.probesLock.Lock()
+	defer d.probesLock.Unlock()
+
+	for tid, collector := range d.probes {
+		collector.Stop()
+		delete(d.probes, tid)
+	}
+}
+
+// NewNetFlowProbesHandler creates a new NetFlow/IPFIX collector probe in the graph
+func NewNetFlowProbesHandler(g *graph.Graph, fpta *FlowProbeTableAllocator) (*NetFlowProbesHandler, error) {
+	return &NetFlowProbesHandler{
+		Graph:  g,
+		fpta:   fpta,
+		probes: make(map[string]*netflow.Collector),
+	}, nil
+}
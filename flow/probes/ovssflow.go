@@ -181,13 +181,13 @@ func (o *OvsSFlowProbesHandler) RegisterProbeOnBridge(bridgeUUID string, tid str
 		headerSize = uint32(capture.HeaderSize)
 	}
 
-	opts := tableOptsFromCapture(capture)
-	ft := o.fpta.Alloc(tid, opts)
-
 	if capture.SamplingRate < 1 {
 		capture.SamplingRate = math.MaxUint32
 	}
 
+	opts := tableOptsFromCapture(capture)
+	ft := o.fpta.Alloc(tid, opts)
+
 	probe := OvsSFlowProbe{
 		ID:         bridgeUUID,
 		Interface:  "lo",
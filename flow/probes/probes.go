@@ -22,10 +22,13 @@ import (
 
 	"github.com/skydive-project/skydive/analyzer"
 	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/exporter/ipfix"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/probe"
+	"github.com/skydive-project/skydive/version"
 )
 
 // ErrProbeNotCompiled is thrown when a flow probe was not compiled within the binary
@@ -48,19 +51,37 @@ type FlowProbeEventHandler interface {
 // FlowProbeTableAllocator allocates table and set the table update callback
 type FlowProbeTableAllocator struct {
 	*flow.TableAllocator
-	fcpool *analyzer.FlowClientPool
+	fcpool   *analyzer.FlowClientPool
+	exporter *ipfix.Exporter
+}
+
+// sendFlows sends the flows to the analyzers and to the IPFIX collector
+func (a *FlowProbeTableAllocator) sendFlows(flows *flow.FlowArray) {
+	if a.exporter != nil {
+		a.exporter.SendFlows(flows)
+	}
+	a.fcpool.SendFlows(flows)
 }
 
 // Alloc override the default implementation provide a default update function
 func (a *FlowProbeTableAllocator) Alloc(nodeTID string, opts flow.TableOpts) *flow.Table {
-	return a.TableAllocator.Alloc(a.fcpool.SendFlows, nodeTID, opts)
+	return a.TableAllocator.Alloc(a.sendFlows, nodeTID, opts)
 }
 
 // NewFlowProbeBundle returns a new bundle of flow probes
-func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocator, fcpool *analyzer.FlowClientPool) *probe.Bundle {
-	list := []string{"pcapsocket", "ovssflow", "sflow", "gopacket", "dpdk", "ebpf", "ovsmirror"}
+func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocator, fcpool *analyzer.FlowClientPool, exporter *ipfix.Exporter) *probe.Bundle {
+	list := []string{"pcapsocket", "ovssflow", "sflow", "netflow", "erspan", "gopacket", "dpdk", "ebpf", "ovsmirror"}
 	logging.GetLogger().Infof("Flow probes: %v", list)
 
+	if port := config.GetInt("agent.flow.tunnels.gtpu_port"); port != 0 {
+		flow.RegisterGTPUPort(port)
+	}
+
+	flow.SetHTTPMaxTransactions(config.GetInt("agent.flow.http.max_transactions"))
+	if path := config.GetString("agent.flow.http.tls_key_log"); path != "" {
+		flow.SetTLSKeyLogFile(path)
+	}
+
 	var captureTypes []string
 	var fp FlowProbe
 	var err error
@@ -68,6 +89,7 @@ func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocat
 	fpta := &FlowProbeTableAllocator{
 		TableAllocator: fta,
 		fcpool:         fcpool,
+		exporter:       exporter,
 	}
 
 	fb := probe.NewBundle(make(map[string]probe.Probe))
@@ -89,10 +111,16 @@ func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocat
 			captureTypes = []string{"ovsmirror"}
 		case "gopacket":
 			fp, err = NewGoPacketProbesHandler(g, fpta)
-			captureTypes = []string{"afpacket", "pcap"}
+			captureTypes = []string{"afpacket", "afxdp", "pcap"}
 		case "sflow":
 			fp, err = NewSFlowProbesHandler(g, fpta)
 			captureTypes = []string{"sflow"}
+		case "netflow":
+			fp, err = NewNetFlowProbesHandler(g, fpta)
+			captureTypes = []string{"netflow"}
+		case "erspan":
+			fp, err = NewERSPANProbesHandler(g, fpta)
+			captureTypes = []string{"erspan"}
 		case "dpdk":
 			if fp, err = NewDPDKProbesHandler(g, fpta); err == nil {
 				captureTypes = []string{"dpdk"}
@@ -125,12 +153,69 @@ func NewFlowProbeBundle(tb *probe.Bundle, g *graph.Graph, fta *flow.TableAllocat
 func tableOptsFromCapture(capture *types.Capture) flow.TableOpts {
 	layerKeyMode, _ := flow.LayerKeyModeByName(capture.LayerKeyMode)
 
+	memoryLimit := capture.MaxFlowTableMemory
+	if memoryLimit == 0 {
+		memoryLimit = config.GetInt("agent.flow.table_memory.limit")
+	}
+
+	evictionPolicy := capture.EvictionPolicy
+	if evictionPolicy == "" {
+		evictionPolicy = config.GetString("agent.flow.table_memory.eviction_policy")
+	}
+
+	packetSampling := capture.PacketSampling
+	if packetSampling == 0 {
+		packetSampling = config.GetInt("agent.flow.sampling.packets")
+	}
+
+	flowByteLimit := capture.FlowByteLimit
+	if flowByteLimit == 0 {
+		flowByteLimit = int64(config.GetInt("agent.flow.sampling.flow_bytes"))
+	}
+
+	maxFlows := capture.MaxFlows
+	if maxFlows == 0 {
+		maxFlows = config.GetInt("agent.flow.sampling.max_flows")
+	}
+
 	return flow.TableOpts{
-		RawPacketLimit: int64(capture.RawPacketLimit),
-		ExtraTCPMetric: capture.ExtraTCPMetric,
-		IPDefrag:       capture.IPDefrag,
-		ReassembleTCP:  capture.ReassembleTCP,
-		LayerKeyMode:   layerKeyMode,
-		ExtraLayers:    capture.ExtraLayers,
+		RawPacketLimit:         int64(capture.RawPacketLimit),
+		RawPacketExcludedPorts: capture.RawPacketExcludedPorts,
+		RawPacketSampling:      capture.RawPacketSampling,
+		ExtraTCPMetric:         capture.ExtraTCPMetric,
+		IPDefrag:               capture.IPDefrag,
+		ReassembleTCP:          capture.ReassembleTCP,
+		LayerKeyMode:           layerKeyMode,
+		ExtraLayers:            capture.ExtraLayers,
+		Provenance:             provenanceFromCapture(capture, packetSampling, flowByteLimit, maxFlows),
+		MemoryLimit:            int64(memoryLimit) * 1024 * 1024,
+		EvictionPolicy:         evictionPolicy,
+		PacketSampling:         packetSampling,
+		FlowByteLimit:          flowByteLimit,
+		MaxFlows:               maxFlows,
+	}
+}
+
+// provenanceFromCapture returns the provenance recorded in the flows of a
+// capture, with the parameters actually applied by the agent
+func provenanceFromCapture(capture *types.Capture, packetSampling int, flowByteLimit int64, maxFlows int) *flow.Provenance {
+	headerSize := int64(flow.DefaultCaptureLength)
+	if capture.HeaderSize != 0 {
+		headerSize = int64(capture.HeaderSize)
+	}
+
+	return &flow.Provenance{
+		CaptureID:         capture.UUID,
+		CaptureType:       capture.Type,
+		AgentVersion:      version.Version,
+		BPFFilter:         capture.BPFFilter,
+		HeaderSize:        headerSize,
+		SamplingRate:      int64(capture.SamplingRate),
+		PollingInterval:   int64(capture.PollingInterval),
+		RawPacketLimit:    int64(capture.RawPacketLimit),
+		RawPacketSampling: int64(capture.RawPacketSampling),
+		PacketSampling:    int64(packetSampling),
+		FlowByteLimit:     flowByteLimit,
+		MaxFlows:          int64(maxFlows),
 	}
 }
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// TableStatsReporter periodically reports the memory used by the flow
+// tables of the captures, and the flows they evicted, in the Capture
+// metadata of the captured nodes
+type TableStatsReporter struct {
+	graph *graph.Graph
+	fta   *flow.TableAllocator
+	quit  chan bool
+	wg    sync.WaitGroup
+}
+
+func (r *TableStatsReporter) report() {
+	stats := r.fta.Stats()
+
+	r.graph.Lock()
+	defer r.graph.Unlock()
+
+	for _, s := range stats {
+		n := r.graph.LookupFirstNode(graph.Metadata{"TID": s.NodeTID})
+		if n == nil {
+			continue
+		}
+
+		// tables not allocated for a capture of the node
+		if _, err := n.GetFieldString("Capture.ID"); err != nil {
+			continue
+		}
+
+		tr := r.graph.StartMetadataTransaction(n)
+		tr.AddMetadata("Capture.FlowTableMemory", s.Memory)
+		tr.AddMetadata("Capture.EvictedFlows", s.EvictedFlows)
+		tr.Commit()
+	}
+}
+
+// Start the reporter
+func (r *TableStatsReporter) Start() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(time.Duration(config.GetInt("agent.capture.stats_update")) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.report()
+			case <-r.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the reporter
+func (r *TableStatsReporter) Stop() {
+	r.quit <- true
+	r.wg.Wait()
+}
+
+// NewTableStatsReporter returns a new reporter of the flow tables of fta
+func NewTableStatsReporter(g *graph.Graph, fta *flow.TableAllocator) *TableStatsReporter {
+	return &TableStatsReporter{
+		graph: g,
+		fta:   fta,
+		quit:  make(chan bool),
+	}
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tracingPaths are the mount points of the tracing file system
+var tracingPaths = []string{"/sys/kernel/debug/tracing", "/sys/kernel/tracing"}
+
+// tracepointField describes a field of the record of a tracepoint
+type tracepointField struct {
+	offset int
+	size   int
+}
+
+// parseTracepointFormat parses the format of a tracepoint, made of lines
+// like "field:__u16 sport; offset:64; size:2; signed:0;", and returns its
+// fields by name
+func parseTracepointFormat(r io.Reader) (map[string]tracepointField, error) {
+	fields := make(map[string]tracepointField)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "field:") {
+			continue
+		}
+
+		var name string
+		var field tracepointField
+		for _, attr := range strings.Split(line, ";") {
+			kv := strings.SplitN(strings.TrimSpace(attr), ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+
+			switch kv[0] {
+			case "field":
+				// the name is the last word of the declaration,
+				// without the array size
+				decl := kv[1]
+				if i := strings.IndexByte(decl, '['); i >= 0 {
+					decl = decl[:i]
+				}
+				if words := strings.Fields(decl); len(words) > 0 {
+					name = words[len(words)-1]
+				}
+			case "offset":
+				field.offset, _ = strconv.Atoi(kv[1])
+			case "size":
+				field.size, _ = strconv.Atoi(kv[1])
+			}
+		}
+
+		if name != "" && field.size > 0 {
+			fields[name] = field
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// tracepointFormat returns the fields of a tracepoint of the running kernel
+func tracepointFormat(category, name string) (map[string]tracepointField, error) {
+	for _, path := range tracingPaths {
+		f, err := os.Open(filepath.Join(path, "events", category, name, "format"))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		return parseTracepointFormat(f)
+	}
+	return nil, fmt.Errorf("Tracepoint %s/%s not found, is the tracing file system mounted ?", category, name)
+}
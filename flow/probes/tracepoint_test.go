@@ -0,0 +1,76 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package probes
+
+import (
+	"strings"
+	"testing"
+)
+
+const tcpProbeFormat = `name: tcp_probe
+ID: 1415
+format:
+	field:unsigned short common_type;	offset:0;	size:2;	signed:0;
+	field:unsigned char common_flags;	offset:2;	size:1;	signed:0;
+	field:unsigned char common_preempt_count;	offset:3;	size:1;	signed:0;
+	field:int common_pid;	offset:4;	size:4;	signed:1;
+
+	field:__u8 saddr[sizeof(struct sockaddr_in6)];	offset:8;	size:28;	signed:0;
+	field:__u8 daddr[sizeof(struct sockaddr_in6)];	offset:36;	size:28;	signed:0;
+	field:__u16 sport;	offset:64;	size:2;	signed:0;
+	field:__u16 dport;	offset:66;	size:2;	signed:0;
+	field:__u32 mark;	offset:68;	size:4;	signed:0;
+	field:__u16 data_len;	offset:72;	size:2;	signed:0;
+	field:__u32 snd_nxt;	offset:76;	size:4;	signed:0;
+	field:__u32 snd_una;	offset:80;	size:4;	signed:0;
+	field:__u32 snd_cwnd;	offset:84;	size:4;	signed:0;
+	field:__u32 ssthresh;	offset:88;	size:4;	signed:0;
+	field:__u32 snd_wnd;	offset:92;	size:4;	signed:0;
+	field:__u32 srtt;	offset:96;	size:4;	signed:0;
+	field:__u32 rcv_wnd;	offset:100;	size:4;	signed:0;
+	field:__u64 sock_cookie;	offset:104;	size:8;	signed:0;
+
+print fmt: "src=%pISpc dest=%pISpc mark=%#x data_len=%d snd_nxt=%#x"
+`
+
+func TestParseTracepointFormat(t *testing.T) {
+	fields, err := parseTracepointFormat(strings.NewReader(tcpProbeFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]tracepointField{
+		"common_type": {offset: 0, size: 2},
+		"saddr":       {offset: 8, size: 28},
+		"daddr":       {offset: 36, size: 28},
+		"sport":       {offset: 64, size: 2},
+		"snd_wnd":     {offset: 92, size: 4},
+		"srtt":        {offset: 96, size: 4},
+		"sock_cookie": {offset: 104, size: 8},
+	}
+	for name, field := range expected {
+		if fields[name] != field {
+			t.Errorf("Expected %+v for %s, got %+v", field, name, fields[name])
+		}
+	}
+	if len(fields) != 18 {
+		t.Errorf("Expected 18 fields, got %d", len(fields))
+	}
+}
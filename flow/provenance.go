@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"github.com/skydive-project/skydive/common"
+)
+
+// GetStringField returns the value of a Provenance field
+func (p *Provenance) GetStringField(field string) (string, error) {
+	if p == nil {
+		return "", common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "CaptureID":
+		return p.CaptureID, nil
+	case "CaptureType":
+		return p.CaptureType, nil
+	case "AgentVersion":
+		return p.AgentVersion, nil
+	case "BPFFilter":
+		return p.BPFFilter, nil
+	default:
+		return "", common.ErrFieldNotFound
+	}
+}
+
+// GetFieldInt64 returns the value of a Provenance field
+func (p *Provenance) GetFieldInt64(field string) (int64, error) {
+	if p == nil {
+		return 0, common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "HeaderSize":
+		return p.HeaderSize, nil
+	case "SamplingRate":
+		return p.SamplingRate, nil
+	case "PollingInterval":
+		return p.PollingInterval, nil
+	case "RawPacketLimit":
+		return p.RawPacketLimit, nil
+	case "RawPacketSampling":
+		return p.RawPacketSampling, nil
+	case "PacketSampling":
+		return p.PacketSampling, nil
+	case "FlowByteLimit":
+		return p.FlowByteLimit, nil
+	case "MaxFlows":
+		return p.MaxFlows, nil
+	default:
+		return 0, common.ErrFieldNotFound
+	}
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+const (
+	quicVersion1 = 0x00000001
+	quicVersion2 = 0x6b3343cf
+)
+
+var (
+	// ErrQUICNotInitial is returned when a UDP payload is not a QUIC initial packet
+	ErrQUICNotInitial = errors.New("Not a QUIC initial packet")
+	// ErrQUICTruncated is returned when a QUIC initial packet is truncated
+	ErrQUICTruncated = errors.New("QUIC packet truncated")
+
+	// initial salts, RFC 9001 section 5.2, RFC 9369 section 3.3.1 and draft-ietf-quic-tls-29
+	quicSaltV1      = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
+	quicSaltV2      = []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9}
+	quicSaltDraft29 = []byte{0xaf, 0xbf, 0xec, 0x28, 0x99, 0x93, 0xd2, 0x4c, 0x9e, 0x97, 0x86, 0xf1, 0x9c, 0x61, 0x11, 0xe0, 0x43, 0x90, 0xa8, 0x99}
+)
+
+// QUICInitial holds the informations extracted from a client QUIC initial packet
+type QUICInitial struct {
+	Version uint32
+	DCID    []byte
+	SNI     string
+	ALPN    []string
+}
+
+// QUICVersionString returns a human readable QUIC version
+func QUICVersionString(version uint32) string {
+	switch {
+	case version == quicVersion1:
+		return "v1"
+	case version == quicVersion2:
+		return "v2"
+	case version&0xffffff00 == 0xff000000:
+		return fmt.Sprintf("draft-%d", version&0xff)
+	default:
+		return fmt.Sprintf("0x%08x", version)
+	}
+}
+
+type quicReader struct {
+	data []byte
+	off  int
+}
+
+func (r *quicReader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.off+n > len(r.data) {
+		return nil, ErrQUICTruncated
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b, nil
+}
+
+func (r *quicReader) uint8() (uint8, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *quicReader) uint16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// varint reads a QUIC variable-length integer, RFC 9000 section 16
+func (r *quicReader) varint() (uint64, error) {
+	first, err := r.uint8()
+	if err != nil {
+		return 0, err
+	}
+
+	length := 1 << (first >> 6)
+	value := uint64(first & 0x3f)
+	rest, err := r.bytes(length - 1)
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+func hkdfExtract(salt, secret []byte) []byte {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label of RFC 8446 with an empty context
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	return hkdfExpandLabelHash(sha256.New, secret, label, length)
+}
+
+// hkdfExpandLabelHash implements HKDF-Expand-Label with the given hash function
+func hkdfExpandLabelHash(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := make([]byte, 0, 4+len(label))
+	info = append(info, byte(length>>8), byte(length), byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	var out, prev []byte
+	for i := byte(1); len(out) < length; i++ {
+		mac := hmac.New(h, secret)
+		mac.Write(prev)
+		mac.Write(info)
+		mac.Write([]byte{i})
+		prev = mac.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length]
+}
+
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+func newQUICClientInitialKeys(version uint32, dcid []byte) (*quicKeys, error) {
+	salt, prefix := quicSaltV1, "quic"
+	switch {
+	case version == quicVersion2:
+		salt, prefix = quicSaltV2, "quicv2"
+	case version&0xffffff00 == 0xff000000 && version&0xff < 33:
+		salt = quicSaltDraft29
+	}
+
+	secret := hkdfExpandLabel(hkdfExtract(salt, dcid), "client in", sha256.Size)
+
+	block, err := aes.NewCipher(hkdfExpandLabel(secret, prefix+" key", 16))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(secret, prefix+" hp", 16))
+	if err != nil {
+		return nil, err
+	}
+
+	return &quicKeys{aead: aead, iv: hkdfExpandLabel(secret, prefix+" iv", 12), hp: hp}, nil
+}
+
+// IsQUICLongHeader returns whether the UDP payload looks like a QUIC long header packet
+func IsQUICLongHeader(payload []byte) bool {
+	// header form and fixed bits set, a version and at least the connection ID lengths
+	return len(payload) >= 7 && payload[0]&0xc0 == 0xc0 && binary.BigEndian.Uint32(payload[1:5]) != 0
+}
+
+// DecodeQUICInitial parses a client QUIC initial packet, removes its
+// protection and extracts the TLS ClientHello server name and ALPN list.
+// The version is returned even if the payload can't be decrypted.
+func DecodeQUICInitial(payload []byte) (*QUICInitial, error) {
+	if !IsQUICLongHeader(payload) {
+		return nil, ErrQUICNotInitial
+	}
+
+	r := &quicReader{data: payload, off: 1}
+	vb, _ := r.bytes(4)
+	initial := &QUICInitial{Version: binary.BigEndian.Uint32(vb)}
+
+	initialType := byte(0x00)
+	if initial.Version == quicVersion2 {
+		initialType = 0x01
+	}
+	if (payload[0]>>4)&0x03 != initialType {
+		return initial, ErrQUICNotInitial
+	}
+
+	dcidLen, err := r.uint8()
+	if err != nil {
+		return initial, err
+	}
+	if initial.DCID, err = r.bytes(int(dcidLen)); err != nil {
+		return initial, err
+	}
+	scidLen, err := r.uint8()
+	if err != nil {
+		return initial, err
+	}
+	if _, err = r.bytes(int(scidLen)); err != nil {
+		return initial, err
+	}
+	tokenLen, err := r.varint()
+	if err != nil {
+		return initial, err
+	}
+	if _, err = r.bytes(int(tokenLen)); err != nil {
+		return initial, err
+	}
+	length, err := r.varint()
+	if err != nil {
+		return initial, err
+	}
+
+	pnOffset := r.off
+	if length < 20 || pnOffset+int(length) > len(payload) {
+		return initial, ErrQUICTruncated
+	}
+
+	keys, err := newQUICClientInitialKeys(initial.Version, initial.DCID)
+	if err != nil {
+		return initial, err
+	}
+
+	// remove header protection, RFC 9001 section 5.4
+	header := make([]byte, pnOffset+4)
+	copy(header, payload[:pnOffset+4])
+
+	mask := make([]byte, aes.BlockSize)
+	keys.hp.Encrypt(mask, payload[pnOffset+4:pnOffset+4+aes.BlockSize])
+	header[0] ^= mask[0] & 0x0f
+
+	pnLen := int(header[0]&0x03) + 1
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+	header = header[:pnOffset+pnLen]
+
+	nonce := make([]byte, len(keys.iv))
+	copy(nonce, keys.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * uint(i)))
+	}
+
+	plaintext, err := keys.aead.Open(nil, nonce, payload[pnOffset+pnLen:pnOffset+int(length)], header)
+	if err != nil {
+		return initial, err
+	}
+
+	crypto, err := quicCryptoData(plaintext)
+	if err != nil {
+		return initial, err
+	}
+
+	if hello := parseTLSHello(crypto); hello != nil && hello.client {
+		initial.SNI, initial.ALPN = hello.sni, hello.alpn
+	}
+
+	return initial, nil
+}
+
+// quicCryptoData returns the contiguous CRYPTO stream data starting at offset 0
+func quicCryptoData(plaintext []byte) ([]byte, error) {
+	type chunk struct {
+		offset uint64
+		data   []byte
+	}
+	var chunks []chunk
+
+	r := &quicReader{data: plaintext}
+	for r.off < len(plaintext) {
+		frameType, err := r.varint()
+		if err != nil {
+			return nil, err
+		}
+
+		switch frameType {
+		case 0x00, 0x01: // PADDING, PING
+		case 0x02, 0x03: // ACK
+			var rangeCount uint64
+			fields := []*uint64{nil, nil, &rangeCount, nil}
+			for _, field := range fields {
+				v, err := r.varint()
+				if err != nil {
+					return nil, err
+				}
+				if field != nil {
+					*field = v
+				}
+			}
+			extra := 2 * rangeCount
+			if frameType == 0x03 {
+				extra += 3
+			}
+			for i := uint64(0); i < extra; i++ {
+				if _, err := r.varint(); err != nil {
+					return nil, err
+				}
+			}
+		case 0x06: // CRYPTO
+			offset, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			length, err := r.varint()
+			if err != nil {
+				return nil, err
+			}
+			data, err := r.bytes(int(length))
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, chunk{offset: offset, data: data})
+		default:
+			// other frames can't carry the ClientHello, stop there
+			r.off = len(plaintext)
+		}
+	}
+
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].offset < chunks[j].offset })
+
+	var crypto []byte
+	for _, c := range chunks {
+		end := c.offset + uint64(len(c.data))
+		if c.offset > uint64(len(crypto)) {
+			break
+		}
+		if end > uint64(len(crypto)) {
+			crypto = append(crypto, c.data[uint64(len(crypto))-c.offset:]...)
+		}
+	}
+
+	return crypto, nil
+}
+
+func isQUICVersionKnown(version uint32) bool {
+	return version == quicVersion1 || version == quicVersion2 || version&0xffffff00 == 0xff000000
+}
+
+func (f *Flow) newQUICLayer(payload []byte) {
+	initial, err := DecodeQUICInitial(payload)
+	if initial == nil || !isQUICVersionKnown(initial.Version) {
+		return
+	}
+
+	f.QUIC = &QUICLayer{Version: QUICVersionString(initial.Version)}
+	f.Application = "QUIC"
+
+	// not a client initial packet or not decryptable, keep the version only
+	if err != nil {
+		return
+	}
+
+	f.QUIC.SNI = initial.SNI
+	f.QUIC.ALPN = initial.ALPN
+	f.Application = QUICApplication(initial.ALPN)
+}
+
+// GetStringField returns the value of a QUIC field
+func (q *QUICLayer) GetStringField(field string) (string, error) {
+	if q == nil {
+		return "", common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "Version":
+		return q.Version, nil
+	case "SNI":
+		return q.SNI, nil
+	default:
+		return "", common.ErrFieldNotFound
+	}
+}
+
+// QUICApplication returns the application name of a QUIC flow according
+// to the ALPN protocols offered by the client
+func QUICApplication(alpn []string) string {
+	for _, proto := range alpn {
+		if proto == "h3" || strings.HasPrefix(proto, "h3-") {
+			return "HTTP3"
+		}
+	}
+	return "QUIC"
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/skydive-project/skydive/filters"
+)
+
+func clientHello(sni string, alpn ...string) []byte {
+	var ext []byte
+
+	name := []byte(sni)
+	ext = append(ext, 0x00, 0x00)
+	ext = append(ext, byte((len(name)+5)>>8), byte(len(name)+5))
+	ext = append(ext, byte((len(name)+3)>>8), byte(len(name)+3))
+	ext = append(ext, 0x00)
+	ext = append(ext, byte(len(name)>>8), byte(len(name)))
+	ext = append(ext, name...)
+
+	var protos []byte
+	for _, proto := range alpn {
+		protos = append(protos, byte(len(proto)))
+		protos = append(protos, proto...)
+	}
+	ext = append(ext, 0x00, 0x10)
+	ext = append(ext, byte((len(protos)+2)>>8), byte(len(protos)+2))
+	ext = append(ext, byte(len(protos)>>8), byte(len(protos)))
+	ext = append(ext, protos...)
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0x00)
+	body = append(body, 0x00, 0x02, 0x13, 0x01)
+	body = append(body, 0x01, 0x00)
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+
+	msg := []byte{0x01, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(msg, body...)
+}
+
+// forgeQUICInitial builds a protected client initial packet carrying the
+// given handshake data splitted in two out of order CRYPTO frames
+func forgeQUICInitial(t *testing.T, version uint32, dcid []byte, hello []byte) []byte {
+	keys, err := newQUICClientInitialKeys(version, dcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	half := len(hello) / 2
+	frames := []byte{0x06, 0x40 | byte(half>>8), byte(half)}
+	frames = append(frames, 0x40|byte((len(hello)-half)>>8), byte(len(hello)-half))
+	frames = append(frames, hello[half:]...)
+	frames = append(frames, 0x06, 0x00, 0x40|byte(half>>8), byte(half))
+	frames = append(frames, hello[:half]...)
+	frames = append(frames, make([]byte, 1100-len(frames))...)
+
+	pn := []byte{0x00, 0x02}
+	length := len(pn) + len(frames) + keys.aead.Overhead()
+
+	first := byte(0xc1)
+	if version == quicVersion2 {
+		first |= 0x10
+	}
+	header := []byte{first}
+	header = append(header, byte(version>>24), byte(version>>16), byte(version>>8), byte(version))
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, 0x00, 0x00)
+	header = append(header, 0x40|byte(length>>8), byte(length))
+	pnOffset := len(header)
+	header = append(header, pn...)
+
+	nonce := make([]byte, len(keys.iv))
+	copy(nonce, keys.iv)
+	nonce[len(nonce)-1] ^= pn[1]
+
+	packet := keys.aead.Seal(header, nonce, frames, header)
+
+	mask := make([]byte, aes.BlockSize)
+	keys.hp.Encrypt(mask, packet[pnOffset+4:pnOffset+4+aes.BlockSize])
+	packet[0] ^= mask[0] & 0x0f
+	for i := range pn {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+
+	return packet
+}
+
+func TestQUICInitialKeys(t *testing.T) {
+	// RFC 9001 appendix A.1
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	secret := hkdfExpandLabel(hkdfExtract(quicSaltV1, dcid), "client in", 32)
+
+	expected := map[string]string{
+		"quic key": "1f369613dd76d5467730efcbe3b1a22d",
+		"quic iv":  "fa044b2f42a3fd3b46fb255c",
+		"quic hp":  "9f50449e04a0e810283a1e9933adedd2",
+	}
+	for label, value := range expected {
+		if key := hex.EncodeToString(hkdfExpandLabel(secret, label, len(value)/2)); key != value {
+			t.Errorf("Wrong %s, expected %s, got %s", label, value, key)
+		}
+	}
+}
+
+func TestDecodeQUICInitial(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+
+	for _, version := range []uint32{quicVersion1, quicVersion2, 0xff00001d} {
+		packet := forgeQUICInitial(t, version, dcid, clientHello("www.Example.org", "h3", "h3-29"))
+
+		initial, err := DecodeQUICInitial(packet)
+		if err != nil {
+			t.Fatalf("Unable to decode %s initial packet: %s", QUICVersionString(version), err)
+		}
+
+		if initial.Version != version || initial.SNI != "www.example.org" {
+			t.Errorf("Wrong initial decoded: %+v", initial)
+		}
+
+		if !reflect.DeepEqual(initial.ALPN, []string{"h3", "h3-29"}) {
+			t.Errorf("Wrong ALPN: %v", initial.ALPN)
+		}
+	}
+
+	// corrupted payload can't be decrypted but the version is reported
+	packet := forgeQUICInitial(t, quicVersion1, dcid, clientHello("www.example.org"))
+	packet[len(packet)-1] ^= 0xff
+
+	if initial, err := DecodeQUICInitial(packet); err == nil || initial == nil || initial.Version != quicVersion1 {
+		t.Errorf("Expected an error with the version, got %+v, %v", initial, err)
+	}
+}
+
+func TestFlowQUIC(t *testing.T) {
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IP{192, 168, 0, 1},
+		DstIP:    net.IP{192, 168, 0, 2},
+	}
+	udp := &layers.UDP{SrcPort: 51234, DstPort: 443}
+	payload := gopacket.Payload(forgeQUICInitial(t, quicVersion1, dcid, clientHello("www.example.org", "h3")))
+
+	table := NewTable(nil, nil, "", TableOpts{})
+	table.processPacketSeq(PacketSeqFromGoPacket(forgeEthernetPacket(t, time.Now(), eth, ip, udp, payload), 0, nil, nil))
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should get 1 flow, got %d", len(flows))
+	}
+
+	f := flows[0]
+	if f.Application != "HTTP3" {
+		t.Errorf("Wrong application: %s", f.Application)
+	}
+
+	if f.QUIC == nil || f.QUIC.Version != "v1" {
+		t.Fatalf("Wrong QUIC layer: %+v", f.QUIC)
+	}
+
+	if sni, err := f.GetFieldString("QUIC.SNI"); err != nil || sni != "www.example.org" {
+		t.Errorf("Wrong QUIC.SNI field: %s, %v", sni, err)
+	}
+}
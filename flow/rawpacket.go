@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// RawPacketFilter selects the flows whose raw packets are retained. The
+// flows of a sensitive port, either as source or as destination, are never
+// retained, and only one flow out of sampling ones is. The sampling relies
+// on the tracking ID so that a flow is selected on all the interfaces it is
+// captured on.
+type RawPacketFilter struct {
+	excludedPorts map[int64]bool
+	sampling      uint32
+}
+
+// NewRawPacketFilter returns a raw packet filter excluding the given ports,
+// along with the ones of the flow.raw_packets.excluded_ports configuration
+// entry, and retaining one flow out of sampling. It returns nil if all the
+// flows are retained.
+func NewRawPacketFilter(excludedPorts []int, sampling int) *RawPacketFilter {
+	var ports []int
+	for _, s := range config.GetStringSlice("flow.raw_packets.excluded_ports") {
+		port, err := strconv.Atoi(s)
+		if err != nil {
+			logging.GetLogger().Errorf("Invalid raw packet excluded port %s: %s", s, err)
+			continue
+		}
+		ports = append(ports, port)
+	}
+	ports = append(ports, excludedPorts...)
+
+	if len(ports) == 0 && sampling <= 1 {
+		return nil
+	}
+
+	f := &RawPacketFilter{excludedPorts: make(map[int64]bool)}
+	for _, port := range ports {
+		f.excludedPorts[int64(port)] = true
+	}
+	if sampling > 1 {
+		f.sampling = uint32(sampling)
+	}
+	return f
+}
+
+// Retain returns whether the raw packets of a flow have to be retained
+func (f *RawPacketFilter) Retain(flow *Flow) bool {
+	if f == nil {
+		return true
+	}
+
+	if t := flow.Transport; t != nil && (f.excludedPorts[t.A] || f.excludedPorts[t.B]) {
+		return false
+	}
+
+	if f.sampling > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(flow.TrackingID))
+		return h.Sum32()%f.sampling == 0
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRawPacketFilter(t *testing.T) {
+	if f := NewRawPacketFilter(nil, 1); f != nil {
+		t.Errorf("Expected no filter when retaining all the flows, got %+v", f)
+	}
+
+	f := NewRawPacketFilter([]int{22, 443}, 0)
+
+	ssh := &Flow{Transport: &TransportLayer{A: 51234, B: 22}}
+	if f.Retain(ssh) {
+		t.Error("Expected the flows of an excluded port not to be retained")
+	}
+
+	http := &Flow{Transport: &TransportLayer{A: 80, B: 51234}}
+	if !f.Retain(http) {
+		t.Error("Expected the flows of the other ports to be retained")
+	}
+
+	f = NewRawPacketFilter(nil, 4)
+
+	retained := 0
+	for i := 0; i < 1000; i++ {
+		flow := &Flow{TrackingID: fmt.Sprintf("flow-%d", i)}
+		if f.Retain(flow) {
+			retained++
+		}
+
+		if f.Retain(flow) != f.Retain(flow) {
+			t.Fatal("Expected the sampling of a flow to be stable")
+		}
+	}
+
+	if retained < 150 || retained > 350 {
+		t.Errorf("Expected about a quarter of the flows to be retained, got %d", retained)
+	}
+}
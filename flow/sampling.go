@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// packetSampler selects one packet out of rate. The number of packets
+// between two samples is random, with a mean of rate, so that periodic
+// traffic does not bias the samples.
+type packetSampler struct {
+	rate int64
+	skip int64
+}
+
+// sample returns whether the next packet is sampled
+func (s *packetSampler) sample() bool {
+	if s == nil {
+		return true
+	}
+
+	if atomic.AddInt64(&s.skip, -1) > 0 {
+		return false
+	}
+	atomic.StoreInt64(&s.skip, 1+rand.Int63n(2*s.rate-1))
+
+	return true
+}
+
+// newPacketSampler returns a sampler of one packet out of rate, nil when all
+// the packets are kept
+func newPacketSampler(rate int) *packetSampler {
+	if rate <= 1 {
+		return nil
+	}
+	return &packetSampler{rate: int64(rate), skip: 1 + rand.Int63n(int64(rate))}
+}
+
+// flowMetricCounters holds the counters of a flow metric before a packet is
+// accounted
+type flowMetricCounters struct {
+	abPackets, abBytes, baPackets, baBytes int64
+}
+
+func countersOf(m *FlowMetric) flowMetricCounters {
+	return flowMetricCounters{abPackets: m.ABPackets, abBytes: m.ABBytes, baPackets: m.BAPackets, baBytes: m.BABytes}
+}
+
+// scaleMetric extrapolates the counters of a sampled packet to the weight
+// packets it stands for
+func scaleMetric(m *FlowMetric, before flowMetricCounters, weight int64) {
+	if weight <= 1 {
+		return
+	}
+
+	m.ABPackets += (m.ABPackets - before.abPackets) * (weight - 1)
+	m.ABBytes += (m.ABBytes - before.abBytes) * (weight - 1)
+	m.BAPackets += (m.BAPackets - before.baPackets) * (weight - 1)
+	m.BABytes += (m.BABytes - before.baBytes) * (weight - 1)
+}
+
+// capped returns whether the flow reached the byte limit of the table, its
+// packets being then only counted, not dissected
+func (ft *Table) capped(f *Flow) bool {
+	return ft.Opts.FlowByteLimit > 0 && f.Metric != nil && f.Metric.ABBytes+f.Metric.BABytes >= ft.Opts.FlowByteLimit
+}
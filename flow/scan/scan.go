@@ -0,0 +1,310 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package scan
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Scanning behaviors
+const (
+	// PortScan is the probing of many ports of a host
+	PortScan = "portscan"
+	// Sweep is the probing of a port, or of the ICMP echo, on many hosts
+	Sweep = "sweep"
+)
+
+// maxSamples is the number of ports or hosts reported in a detection
+const maxSamples = 20
+
+// NodeContext describes a node owning the source of a scan
+type NodeContext struct {
+	ID     graph.Identifier
+	Name   string
+	Type   string
+	Host   string
+	Parent string `json:",omitempty"`
+}
+
+// Detection describes a scanning behavior of a source, Target being the
+// host scanned for a port scan, the port swept for a sweep. Count is the
+// number of distinct ports or hosts probed within the window, from Start to
+// Last in milliseconds.
+type Detection struct {
+	Type     string
+	Source   string
+	Target   string
+	Count    int
+	Samples  []string
+	Start    int64
+	Last     int64
+	NodeTID  string
+	FlowUUID string
+	Context  []NodeContext `json:",omitempty"`
+}
+
+// Listener is notified of the scanning behaviors detected
+type Listener interface {
+	OnScanDetected(d *Detection)
+}
+
+// activity holds the time the ports and hosts were last probed by a
+// source, indexed by host and by port
+type activity struct {
+	sync.Mutex
+	portsByHost map[string]map[string]int64
+	hostsByPort map[string]map[string]int64
+}
+
+// Detector identifies the sources of the flows probing many ports of a host
+// or a port of many hosts within a window
+type Detector struct {
+	sync.RWMutex
+	graph     *graph.Graph
+	window    time.Duration
+	maxPorts  int
+	maxHosts  int
+	exclude   []*net.IPNet
+	sources   *cache.Cache
+	notified  *cache.Cache
+	listeners []Listener
+}
+
+// port returns the port probed by a flow, the ICMP echo being handled as a
+// port so that ping sweeps are detected
+func port(f *flow.Flow) string {
+	switch {
+	case f.Transport != nil:
+		return f.Transport.Protocol.String() + "/" + strconv.FormatInt(f.Transport.B, 10)
+	case f.ICMP != nil && f.ICMP.Type == flow.ICMPType_ECHO:
+		return "ICMP"
+	}
+	return ""
+}
+
+// record stores the probe and returns the ports of the host and the hosts of
+// the port probed within the window, the oldest entries being removed
+func (a *activity) record(host, port string, last, since int64) (ports, hosts map[string]int64) {
+	a.Lock()
+	defer a.Unlock()
+
+	add := func(index map[string]map[string]int64, key, value string) map[string]int64 {
+		entries, found := index[key]
+		if !found {
+			entries = make(map[string]int64)
+			index[key] = entries
+		}
+		entries[value] = last
+
+		for k, t := range entries {
+			if t < since {
+				delete(entries, k)
+			}
+		}
+
+		// copy as the detection is made without the lock
+		c := make(map[string]int64, len(entries))
+		for k, t := range entries {
+			c[k] = t
+		}
+		return c
+	}
+
+	return add(a.portsByHost, host, port), add(a.hostsByPort, port, host)
+}
+
+func (d *Detector) isExcluded(ip net.IP) bool {
+	for _, ipnet := range d.exclude {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Detector) activity(source string) *activity {
+	if a, found := d.sources.Get(source); found {
+		d.sources.Set(source, a, cache.DefaultExpiration)
+		return a.(*activity)
+	}
+
+	a := &activity{
+		portsByHost: make(map[string]map[string]int64),
+		hostsByPort: make(map[string]map[string]int64),
+	}
+	d.sources.Set(source, a, cache.DefaultExpiration)
+	return a
+}
+
+func newDetection(typ string, f *flow.Flow, target string, entries map[string]int64) *Detection {
+	det := &Detection{
+		Type:     typ,
+		Source:   f.Network.A,
+		Target:   target,
+		Count:    len(entries),
+		NodeTID:  f.NodeTID,
+		FlowUUID: f.UUID,
+	}
+
+	for k, t := range entries {
+		if det.Start == 0 || t < det.Start {
+			det.Start = t
+		}
+		if t > det.Last {
+			det.Last = t
+		}
+		det.Samples = append(det.Samples, k)
+	}
+
+	sort.Strings(det.Samples)
+	if len(det.Samples) > maxSamples {
+		det.Samples = det.Samples[:maxSamples]
+	}
+
+	return det
+}
+
+// sourceContext returns the nodes owning the source of a scan along with
+// the name of their owner, a namespace or a host for instance
+func (d *Detector) sourceContext(ip string) (nodes []NodeContext) {
+	d.graph.RLock()
+	defer d.graph.RUnlock()
+
+	for _, node := range topology.LookupNodesByIP(d.graph, ip) {
+		nc := NodeContext{ID: node.ID, Host: node.Host}
+		nc.Name, _ = node.GetFieldString("Name")
+		nc.Type, _ = node.GetFieldString("Type")
+
+		if parents := d.graph.LookupParents(node, nil, topology.OwnershipMetadata()); len(parents) > 0 {
+			nc.Parent, _ = parents[0].GetFieldString("Name")
+		}
+		nodes = append(nodes, nc)
+	}
+
+	return
+}
+
+// Tag records the port and the host probed by the flow and notifies the
+// listeners when its source exceeds the thresholds, the flow is left untouched
+func (d *Detector) Tag(f *flow.Flow) {
+	if f.Network == nil {
+		return
+	}
+
+	p := port(f)
+	if p == "" {
+		return
+	}
+
+	ip := net.ParseIP(f.Network.A)
+	if ip == nil || ip.IsMulticast() || d.isExcluded(ip) {
+		return
+	}
+	if dst := net.ParseIP(f.Network.B); dst == nil || dst.IsMulticast() {
+		return
+	}
+
+	since := f.Last - int64(d.window/time.Millisecond)
+	ports, hosts := d.activity(f.Network.A).record(f.Network.B, p, f.Last, since)
+
+	var detections []*Detection
+	if len(ports) >= d.maxPorts {
+		detections = append(detections, newDetection(PortScan, f, f.Network.B, ports))
+	}
+	if len(hosts) >= d.maxHosts {
+		detections = append(detections, newDetection(Sweep, f, p, hosts))
+	}
+
+	for _, det := range detections {
+		key := det.Type + "/" + det.Source + "/" + det.Target
+		if _, found := d.notified.Get(key); found {
+			continue
+		}
+		d.notified.Set(key, true, cache.DefaultExpiration)
+
+		det.Context = d.sourceContext(det.Source)
+
+		if det.Type == PortScan {
+			logging.GetLogger().Warningf("Port scan of %s by %s: %d ports probed within %s", det.Target, det.Source, det.Count, d.window)
+		} else {
+			logging.GetLogger().Warningf("Sweep of %s by %s: %d hosts probed within %s", det.Target, det.Source, det.Count, d.window)
+		}
+
+		d.RLock()
+		listeners := d.listeners
+		d.RUnlock()
+
+		for _, l := range listeners {
+			l.OnScanDetected(det)
+		}
+	}
+}
+
+// AddListener registers a listener notified of the scanning behaviors
+func (d *Detector) AddListener(l Listener) {
+	d.Lock()
+	d.listeners = append(d.listeners, l)
+	d.Unlock()
+}
+
+// NewDetector returns a new scan detector, a source being reported once
+// per window when probing at least maxPorts ports of a host or a port of at
+// least maxHosts hosts. The sources in the exclude networks are ignored.
+func NewDetector(g *graph.Graph, window time.Duration, maxPorts, maxHosts int, exclude []*net.IPNet) *Detector {
+	return &Detector{
+		graph:    g,
+		window:   window,
+		maxPorts: maxPorts,
+		maxHosts: maxHosts,
+		exclude:  exclude,
+		sources:  cache.New(window, window),
+		notified: cache.New(window, window),
+	}
+}
+
+// NewDetectorFromConfig returns a new scan detector, nil if disabled by the
+// configuration
+func NewDetectorFromConfig(g *graph.Graph) (*Detector, error) {
+	if !config.GetBool("analyzer.scan.enabled") {
+		return nil, nil
+	}
+
+	var exclude []*net.IPNet
+	for _, cidr := range config.GetStringSlice("analyzer.scan.exclude") {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid network %s in analyzer.scan.exclude: %s", cidr, err)
+		}
+		exclude = append(exclude, ipnet)
+	}
+
+	window := time.Duration(config.GetInt("analyzer.scan.window")) * time.Second
+	return NewDetector(g, window, config.GetInt("analyzer.scan.ports"), config.GetInt("analyzer.scan.hosts"), exclude), nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package scan
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+type fakeListener struct {
+	detections []*Detection
+}
+
+func (l *fakeListener) OnScanDetected(d *Detection) {
+	l.detections = append(l.detections, d)
+}
+
+func tcpFlow(src, dst string, port int64, last int64) *flow.Flow {
+	return &flow.Flow{
+		UUID:      fmt.Sprintf("%s-%s-%d", src, dst, port),
+		Last:      last,
+		Network:   &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: src, B: dst},
+		Transport: &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: 40000, B: port},
+	}
+}
+
+func newDetector(t *testing.T) (*Detector, *fakeListener) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AnalyzerService)
+
+	g.Lock()
+	ns, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "ns1", "Type": "netns"})
+	intf, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "veth", "IPV4": []string{"10.0.0.1/24"}})
+	topology.AddOwnershipLink(g, ns, intf, nil)
+	g.Unlock()
+
+	_, excluded, _ := net.ParseCIDR("10.0.1.0/24")
+	d := NewDetector(g, time.Minute, 10, 5, []*net.IPNet{excluded})
+
+	listener := &fakeListener{}
+	d.AddListener(listener)
+
+	return d, listener
+}
+
+func TestPortScan(t *testing.T) {
+	d, listener := newDetector(t)
+
+	now := common.UnixMillis(time.Now())
+	for port := int64(1); port <= 20; port++ {
+		d.Tag(tcpFlow("10.0.0.1", "10.0.0.2", port, now))
+	}
+
+	if len(listener.detections) != 1 {
+		t.Fatalf("Expected one port scan detection, got %+v", listener.detections)
+	}
+
+	det := listener.detections[0]
+	if det.Type != PortScan || det.Source != "10.0.0.1" || det.Target != "10.0.0.2" || det.Count != 10 {
+		t.Errorf("Unexpected detection %+v", det)
+	}
+
+	if len(det.Context) != 1 || det.Context[0].Name != "eth0" || det.Context[0].Parent != "ns1" {
+		t.Errorf("Expected the source node in the context, got %+v", det.Context)
+	}
+
+	// probes outside of the window are not counted
+	d, listener = newDetector(t)
+	for port := int64(1); port <= 20; port++ {
+		d.Tag(tcpFlow("10.0.0.1", "10.0.0.2", port, now+port*int64(10*time.Second/time.Millisecond)))
+	}
+	if len(listener.detections) != 0 {
+		t.Errorf("Expected no detection of slow probes, got %+v", listener.detections)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	d, listener := newDetector(t)
+
+	now := common.UnixMillis(time.Now())
+	for i := 1; i <= 10; i++ {
+		d.Tag(tcpFlow("10.0.0.1", fmt.Sprintf("10.0.0.%d", 100+i), 22, now))
+		d.Tag(tcpFlow("10.0.1.1", fmt.Sprintf("10.0.0.%d", 100+i), 22, now))
+	}
+
+	if len(listener.detections) != 1 {
+		t.Fatalf("Expected one sweep detection, the excluded source being ignored, got %+v", listener.detections)
+	}
+
+	if det := listener.detections[0]; det.Type != Sweep || det.Target != "TCP/22" || det.Count != 5 || len(det.Samples) != 5 {
+		t.Errorf("Unexpected detection %+v", det)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// sctpChunkNames maps the gopacket SCTP chunk layers to the chunk names of RFC 4960
+var sctpChunkNames = map[gopacket.LayerType]string{
+	layers.LayerTypeSCTPData:             "DATA",
+	layers.LayerTypeSCTPInit:             "INIT",
+	layers.LayerTypeSCTPInitAck:          "INIT_ACK",
+	layers.LayerTypeSCTPSack:             "SACK",
+	layers.LayerTypeSCTPHeartbeat:        "HEARTBEAT",
+	layers.LayerTypeSCTPHeartbeatAck:     "HEARTBEAT_ACK",
+	layers.LayerTypeSCTPAbort:            "ABORT",
+	layers.LayerTypeSCTPShutdown:         "SHUTDOWN",
+	layers.LayerTypeSCTPShutdownAck:      "SHUTDOWN_ACK",
+	layers.LayerTypeSCTPError:            "ERROR",
+	layers.LayerTypeSCTPCookieEcho:       "COOKIE_ECHO",
+	layers.LayerTypeSCTPCookieAck:        "COOKIE_ACK",
+	layers.LayerTypeSCTPShutdownComplete: "SHUTDOWN_COMPLETE",
+	layers.LayerTypeSCTPUnknownChunkType: "UNKNOWN",
+}
+
+// SCTPChunkName returns the name of the SCTP chunk type of the given layer
+func SCTPChunkName(layer gopacket.Layer) (string, bool) {
+	name, ok := sctpChunkNames[layer.LayerType()]
+	return name, ok
+}
+
+func (s *SCTPLayer) addChunk(name string) {
+	for _, chunk := range s.Chunks {
+		if chunk == name {
+			return
+		}
+	}
+	s.Chunks = append(s.Chunks, name)
+}
+
+func (f *Flow) updateSCTP(packet *Packet) {
+	if f.SCTP == nil || f.Transport == nil || f.Transport.Protocol != FlowProtocol_SCTP {
+		return
+	}
+
+	sctpLayer := packet.Layer(layers.LayerTypeSCTP)
+	sctpPacket, ok := sctpLayer.(*layers.SCTP)
+	if !ok {
+		return
+	}
+
+	// INIT chunks are sent with a zero verification tag
+	if tag := sctpPacket.VerificationTag; tag != 0 {
+		if int64(sctpPacket.SrcPort) == f.Transport.A {
+			f.SCTP.ABVerificationTag = tag
+		} else {
+			f.SCTP.BAVerificationTag = tag
+		}
+	}
+
+	for _, layer := range packet.Layers {
+		name, ok := SCTPChunkName(layer)
+		if !ok {
+			continue
+		}
+		f.SCTP.addChunk(name)
+
+		switch name {
+		case "INIT", "INIT_ACK":
+			if init, ok := layer.(*layers.SCTPInit); ok && f.SCTP.OutboundStreams == 0 {
+				f.SCTP.OutboundStreams = uint32(init.OutboundStreams)
+				f.SCTP.InboundStreams = uint32(init.InboundStreams)
+			}
+		case "ABORT":
+			f.FinishType = FlowFinishType_SCTP_ABORT
+		case "SHUTDOWN_COMPLETE":
+			f.FinishType = FlowFinishType_SCTP_SHUTDOWN
+		}
+	}
+}
+
+// GetFieldInt64 returns the value of a SCTP field
+func (s *SCTPLayer) GetFieldInt64(field string) (int64, error) {
+	if s == nil {
+		return 0, common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "ABVerificationTag":
+		return int64(s.ABVerificationTag), nil
+	case "BAVerificationTag":
+		return int64(s.BAVerificationTag), nil
+	case "OutboundStreams":
+		return int64(s.OutboundStreams), nil
+	case "InboundStreams":
+		return int64(s.InboundStreams), nil
+	default:
+		return 0, common.ErrFieldNotFound
+	}
+}
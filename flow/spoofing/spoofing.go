@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package spoofing
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Protocols announcing the address bindings
+const (
+	ProtocolARP = "ARP"
+	ProtocolNDP = "NDP"
+)
+
+// Claim describes an IP/MAC binding announced by an ARP reply, a gratuitous
+// ARP or a neighbor advertisement, Segment being the TID of the node the
+// claim was captured on
+type Claim struct {
+	Protocol string
+	IP       string
+	MAC      string
+	Segment  string
+	FlowUUID string
+}
+
+// Conflict describes a claim contradicting a known binding, either the one
+// of the Nodes owning the address or a previous claim on the same segment
+type Conflict struct {
+	Claim
+	KnownMAC string
+	Nodes    []graph.Identifier `json:",omitempty"`
+}
+
+// Listener is notified of the conflicting claims
+type Listener interface {
+	OnSpoofingDetected(c *Conflict)
+}
+
+// Detector compares the bindings claimed by the captured ARP and neighbor
+// discovery messages with the addresses of the interfaces of the graph and
+// with the bindings previously claimed on the same segment
+type Detector struct {
+	sync.RWMutex
+	graph     *graph.Graph
+	bindings  *cache.Cache
+	seen      *cache.Cache
+	listeners []Listener
+}
+
+// isVirtualMAC returns whether the MAC is shared by design, as the VRRP
+// virtual router addresses are
+func isVirtualMAC(mac string) bool {
+	return strings.HasPrefix(mac, "00:00:5e:00:01:") || strings.HasPrefix(mac, "00:00:5e:00:02:")
+}
+
+// claim returns the binding announced by a flow if any
+func claim(f *flow.Flow) *Claim {
+	c := &Claim{Segment: f.NodeTID, FlowUUID: f.UUID}
+
+	switch {
+	case f.ARP != nil && (f.ARP.Operation == flow.ARPReply || f.ARP.Gratuitous):
+		c.Protocol, c.IP, c.MAC = ProtocolARP, f.ARP.SenderIP, f.ARP.SenderMAC
+	case f.ICMP != nil && f.ICMP.TargetMAC != "":
+		c.Protocol, c.IP, c.MAC = ProtocolNDP, f.ICMP.Target, f.ICMP.TargetMAC
+	default:
+		return nil
+	}
+
+	ip := net.ParseIP(c.IP)
+	if ip == nil || ip.IsUnspecified() || c.MAC == "" || isVirtualMAC(c.MAC) {
+		return nil
+	}
+	c.IP = ip.String()
+
+	return c
+}
+
+// checkGraph returns a conflict if the address claimed is owned by
+// interfaces of the graph but none of them has the MAC claimed
+func (d *Detector) checkGraph(c *Claim) *Conflict {
+	d.graph.RLock()
+	defer d.graph.RUnlock()
+
+	var conflict *Conflict
+	for _, node := range topology.LookupNodesByIP(d.graph, c.IP) {
+		mac, _ := node.GetFieldString("MAC")
+		if mac == "" {
+			continue
+		}
+		if strings.EqualFold(mac, c.MAC) {
+			return nil
+		}
+
+		if conflict == nil {
+			conflict = &Conflict{Claim: *c, KnownMAC: strings.ToLower(mac)}
+		}
+		conflict.Nodes = append(conflict.Nodes, node.ID)
+	}
+
+	return conflict
+}
+
+// checkSegment returns a conflict if another MAC claimed the address on the
+// same segment, the first binding being kept until it expires
+func (d *Detector) checkSegment(c *Claim) *Conflict {
+	key := c.Segment + "/" + c.IP
+	if known, found := d.bindings.Get(key); found && known.(string) != c.MAC {
+		return &Conflict{Claim: *c, KnownMAC: known.(string)}
+	}
+	d.bindings.Set(key, c.MAC, cache.DefaultExpiration)
+	return nil
+}
+
+// Tag checks the binding claimed by the flow, the flow is left untouched
+func (d *Detector) Tag(f *flow.Flow) {
+	c := claim(f)
+	if c == nil {
+		return
+	}
+
+	// flows are tagged at each update, a claim is only checked once per window
+	key := c.Segment + "/" + c.IP + "/" + c.MAC
+	if _, found := d.seen.Get(key); found {
+		return
+	}
+	d.seen.Set(key, true, cache.DefaultExpiration)
+
+	conflict := d.checkGraph(c)
+	if segmentConflict := d.checkSegment(c); conflict == nil {
+		conflict = segmentConflict
+	}
+	if conflict == nil {
+		return
+	}
+
+	logging.GetLogger().Warningf("%s claim of %s by %s on %s conflicts with %s", c.Protocol, c.IP, c.MAC, c.Segment, conflict.KnownMAC)
+
+	d.RLock()
+	listeners := d.listeners
+	d.RUnlock()
+
+	for _, l := range listeners {
+		l.OnSpoofingDetected(conflict)
+	}
+}
+
+// AddListener registers a listener notified of the conflicting claims
+func (d *Detector) AddListener(l Listener) {
+	d.Lock()
+	d.listeners = append(d.listeners, l)
+	d.Unlock()
+}
+
+// NewDetector returns a new spoofing detector, the bindings claimed being
+// remembered during window
+func NewDetector(g *graph.Graph, window time.Duration) *Detector {
+	return &Detector{
+		graph:    g,
+		bindings: cache.New(window, window),
+		seen:     cache.New(window, window),
+	}
+}
+
+// NewDetectorFromConfig returns a new spoofing detector, nil if disabled by
+// the configuration
+func NewDetectorFromConfig(g *graph.Graph) *Detector {
+	if !config.GetBool("analyzer.spoofing.enabled") {
+		return nil
+	}
+	return NewDetector(g, time.Duration(config.GetInt("analyzer.spoofing.window"))*time.Second)
+}
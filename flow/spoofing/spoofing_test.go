@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package spoofing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+type fakeListener struct {
+	conflicts []*Conflict
+}
+
+func (l *fakeListener) OnSpoofingDetected(c *Conflict) {
+	l.conflicts = append(l.conflicts, c)
+}
+
+func arpFlow(uuid, segment, op, ip, mac string) *flow.Flow {
+	return &flow.Flow{
+		UUID:    uuid,
+		NodeTID: segment,
+		ARP:     &flow.ARPLayer{Operation: op, SenderIP: ip, SenderMAC: mac, TargetIP: ip, Gratuitous: true},
+	}
+}
+
+func TestSpoofingDetector(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AnalyzerService)
+
+	g.Lock()
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "MAC": "52:54:00:00:00:01", "IPV4": []string{"10.0.0.1/24"}})
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "MAC": "52:54:00:00:00:02", "IPV6": []string{"2001:db8::2/64"}})
+	g.Unlock()
+
+	d := NewDetector(g, time.Minute)
+	listener := &fakeListener{}
+	d.AddListener(listener)
+
+	// legitimate claim, twice
+	d.Tag(arpFlow("1", "seg1", flow.ARPReply, "10.0.0.1", "52:54:00:00:00:01"))
+	d.Tag(arpFlow("1", "seg1", flow.ARPReply, "10.0.0.1", "52:54:00:00:00:01"))
+	if len(listener.conflicts) != 0 {
+		t.Fatalf("Expected no conflict, got %+v", listener.conflicts)
+	}
+
+	// claim of an address of the graph by another MAC
+	d.Tag(arpFlow("2", "seg1", flow.ARPReply, "10.0.0.1", "52:54:00:00:00:66"))
+	if len(listener.conflicts) != 1 {
+		t.Fatalf("Expected a conflict with the graph, got %+v", listener.conflicts)
+	}
+	if c := listener.conflicts[0]; c.KnownMAC != "52:54:00:00:00:01" || len(c.Nodes) != 1 || c.Protocol != ProtocolARP {
+		t.Errorf("Unexpected conflict %+v", c)
+	}
+
+	// already notified
+	d.Tag(arpFlow("2", "seg1", flow.ARPReply, "10.0.0.1", "52:54:00:00:00:66"))
+	if len(listener.conflicts) != 1 {
+		t.Fatalf("Expected the conflict to be notified once, got %+v", listener.conflicts)
+	}
+
+	// unknown address claimed by two MACs on the same segment
+	d.Tag(arpFlow("3", "seg1", flow.ARPReply, "10.0.0.9", "52:54:00:00:00:09"))
+	d.Tag(arpFlow("4", "seg2", flow.ARPReply, "10.0.0.9", "52:54:00:00:00:10"))
+	if len(listener.conflicts) != 1 {
+		t.Fatalf("Expected no conflict between segments, got %+v", listener.conflicts)
+	}
+	d.Tag(arpFlow("5", "seg1", flow.ARPReply, "10.0.0.9", "52:54:00:00:00:10"))
+	if len(listener.conflicts) != 2 || listener.conflicts[1].KnownMAC != "52:54:00:00:00:09" || len(listener.conflicts[1].Nodes) != 0 {
+		t.Fatalf("Expected a conflict with the previous claim, got %+v", listener.conflicts)
+	}
+
+	// requests and VRRP virtual addresses claim nothing
+	request := arpFlow("6", "seg1", flow.ARPRequest, "10.0.0.1", "52:54:00:00:00:67")
+	request.ARP.Gratuitous = false
+	d.Tag(request)
+	d.Tag(arpFlow("7", "seg1", flow.ARPReply, "10.0.0.1", "00:00:5e:00:01:01"))
+	if len(listener.conflicts) != 2 {
+		t.Fatalf("Expected no new conflict, got %+v", listener.conflicts)
+	}
+
+	// neighbor advertisement
+	d.Tag(&flow.Flow{
+		UUID:    "8",
+		NodeTID: "seg1",
+		ICMP:    &flow.ICMPLayer{Type: flow.ICMPType_NEIGHBOR, Target: "2001:db8::2", TargetMAC: "52:54:00:00:00:66"},
+	})
+	if len(listener.conflicts) != 3 || listener.conflicts[2].Protocol != ProtocolNDP {
+		t.Fatalf("Expected a neighbor discovery conflict, got %+v", listener.conflicts)
+	}
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clickhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	ch "github.com/skydive-project/skydive/storage/clickhouse"
+)
+
+const (
+	flowTable      = "flows"
+	metricTable    = "flow_metrics"
+	rawpacketTable = "flow_rawpackets"
+)
+
+// flows are updated at each flow update, the replacing engine keeping only
+// the latest version
+const flowTableSchema = `CREATE TABLE IF NOT EXISTS flows (
+	UUID String,
+	TrackingID String,
+	L3TrackingID String,
+	ParentUUID String,
+	NodeTID String,
+	Application String,
+	LayersPath String,
+	Start Int64,
+	Last Int64,
+	Doc String
+) ENGINE = ReplacingMergeTree(Last)
+PARTITION BY toYYYYMMDD(toDateTime(intDiv(Start, 1000)))
+ORDER BY UUID`
+
+const metricTableSchema = `CREATE TABLE IF NOT EXISTS flow_metrics (
+	UUID String,
+	ABPackets Int64,
+	ABBytes Int64,
+	BAPackets Int64,
+	BABytes Int64,
+	RTT Int64,
+	Start Int64,
+	Last Int64
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMMDD(toDateTime(intDiv(Last, 1000)))
+ORDER BY (UUID, Last)`
+
+const rawpacketTableSchema = `CREATE TABLE IF NOT EXISTS flow_rawpackets (
+	UUID String,
+	NodeTID String,
+	LinkType Int64,
+	Timestamp Int64,
+	Index Int64,
+	Data String
+) ENGINE = MergeTree()
+PARTITION BY toYYYYMMDD(toDateTime(intDiv(Timestamp, 1000)))
+ORDER BY (UUID, Timestamp)`
+
+var flowColumns = ch.Columns{
+	Types: map[string]string{
+		"UUID":         "String",
+		"TrackingID":   "String",
+		"L3TrackingID": "String",
+		"ParentUUID":   "String",
+		"NodeTID":      "String",
+		"Application":  "String",
+		"LayersPath":   "String",
+		"Start":        "Int64",
+		"Last":         "Int64",
+	},
+	JSON: "Doc",
+}
+
+var metricColumns = ch.Columns{}
+
+// Storage describes a ClickHouse flow backend
+type Storage struct {
+	client *ch.Client
+}
+
+// easyjson:json
+type flowRow struct {
+	UUID         string
+	TrackingID   string
+	L3TrackingID string
+	ParentUUID   string
+	NodeTID      string
+	Application  string
+	LayersPath   string
+	Start        int64
+	Last         int64
+	Doc          string
+}
+
+// easyjson:json
+type metricRow struct {
+	UUID string
+	*flow.FlowMetric
+}
+
+// easyjson:json
+type rawpacketRow struct {
+	UUID     string
+	NodeTID  string
+	LinkType layers.LinkType
+	*flow.RawPacket
+}
+
+func (c *Storage) flowSubQuery(filter *filters.Filter) string {
+	subQuery := "SELECT UUID FROM " + flowTable + " FINAL"
+	if conditional := ch.FilterToExpression(filter, flowColumns); conditional != "" {
+		subQuery += " WHERE " + conditional
+	}
+	return subQuery
+}
+
+func sortAndPaginate(fsq filters.SearchQuery, columns ch.Columns) (sql string) {
+	if fsq.Sort {
+		sql += " ORDER BY " + columns.Value(fsq.SortBy, "Int64")
+		if fsq.SortOrder != "" {
+			sql += " " + strings.ToUpper(fsq.SortOrder)
+		}
+	}
+
+	if interval := fsq.PaginationRange; interval != nil {
+		sql += fmt.Sprintf(" LIMIT %d, %d", interval.From, interval.To-interval.From)
+	}
+
+	return
+}
+
+// StoreFlows pushes a set of flows in the database
+func (c *Storage) StoreFlows(flows []*flow.Flow) error {
+	for _, f := range flows {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("Error while pushing flow %s: %s", f.UUID, err)
+		}
+
+		row := &flowRow{
+			UUID:         f.UUID,
+			TrackingID:   f.TrackingID,
+			L3TrackingID: f.L3TrackingID,
+			ParentUUID:   f.ParentUUID,
+			NodeTID:      f.NodeTID,
+			Application:  f.Application,
+			LayersPath:   f.LayersPath,
+			Start:        f.Start,
+			Last:         f.Last,
+			Doc:          string(data),
+		}
+
+		if err := c.client.BulkInsert(flowTable, row); err != nil {
+			return fmt.Errorf("Error while pushing flow %s: %s", f.UUID, err)
+		}
+
+		if f.LastUpdateMetric != nil {
+			if err := c.client.BulkInsert(metricTable, &metricRow{UUID: f.UUID, FlowMetric: f.LastUpdateMetric}); err != nil {
+				return fmt.Errorf("Error while pushing metric %s: %s", f.UUID, err)
+			}
+		}
+
+		linkType, err := f.LinkType()
+		if err != nil {
+			return fmt.Errorf("Error while indexing: %s", err)
+		}
+		for _, r := range f.LastRawPackets {
+			row := &rawpacketRow{UUID: f.UUID, NodeTID: f.NodeTID, LinkType: linkType, RawPacket: r}
+			if err := c.client.BulkInsert(rawpacketTable, row); err != nil {
+				return fmt.Errorf("Error while pushing raw packet %s: %s", f.UUID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SearchFlows search flow matching filters in the database
+func (c *Storage) SearchFlows(fsq filters.SearchQuery) (*flow.FlowSet, error) {
+	sql := "SELECT Doc FROM " + flowTable + " FINAL"
+	if conditional := ch.FilterToExpression(fsq.Filter, flowColumns); conditional != "" {
+		sql += " WHERE " + conditional
+	}
+	sql += sortAndPaginate(fsq, flowColumns)
+
+	rows, err := c.client.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	flowset := flow.NewFlowSet()
+	for _, data := range rows {
+		var row flowRow
+		if err := json.Unmarshal(data, &row); err != nil {
+			logging.GetLogger().Errorf("Error while decoding flows %s, %s", err, string(data))
+			return nil, err
+		}
+
+		f := new(flow.Flow)
+		if err := json.Unmarshal([]byte(row.Doc), f); err != nil {
+			logging.GetLogger().Errorf("Error while decoding flows %s, %s", err, row.Doc)
+			return nil, err
+		}
+		flowset.Flows = append(flowset.Flows, f)
+	}
+
+	if fsq.Dedup {
+		if err := flowset.Dedup(fsq.DedupBy); err != nil {
+			return nil, err
+		}
+	}
+
+	return flowset, nil
+}
+
+// SearchRawPackets searches flow raw packets matching filters in the database
+func (c *Storage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filters.Filter) (map[string]*flow.RawPackets, error) {
+	sql := fmt.Sprintf("SELECT * FROM %s WHERE UUID IN (%s)", rawpacketTable, c.flowSubQuery(fsq.Filter))
+	if conditional := ch.FilterToExpression(packetFilter, metricColumns); conditional != "" {
+		sql += " AND " + conditional
+	}
+	sql += sortAndPaginate(fsq, metricColumns)
+
+	rows, err := c.client.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	rawpackets := make(map[string]*flow.RawPackets)
+	for _, data := range rows {
+		row := rawpacketRow{RawPacket: new(flow.RawPacket)}
+		if err := json.Unmarshal(data, &row); err != nil {
+			logging.GetLogger().Errorf("Error while decoding raw packets %s, %s", err, string(data))
+			return nil, err
+		}
+
+		if fr, ok := rawpackets[row.UUID]; ok {
+			fr.RawPackets = append(fr.RawPackets, row.RawPacket)
+		} else {
+			rawpackets[row.UUID] = &flow.RawPackets{
+				LinkType:   row.LinkType,
+				RawPackets: []*flow.RawPacket{row.RawPacket},
+				NodeTID:    row.NodeTID,
+			}
+		}
+	}
+
+	return rawpackets, nil
+}
+
+// SearchMetrics searches flow metrics matching filters in the database
+func (c *Storage) SearchMetrics(fsq filters.SearchQuery, metricFilter *filters.Filter) (map[string][]common.Metric, error) {
+	sql := fmt.Sprintf("SELECT * FROM %s WHERE UUID IN (%s)", metricTable, c.flowSubQuery(fsq.Filter))
+	if conditional := ch.FilterToExpression(metricFilter, metricColumns); conditional != "" {
+		sql += " AND " + conditional
+	}
+	sql += sortAndPaginate(fsq, metricColumns)
+
+	rows, err := c.client.Query(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make(map[string][]common.Metric)
+	for _, data := range rows {
+		row := metricRow{FlowMetric: new(flow.FlowMetric)}
+		if err := json.Unmarshal(data, &row); err != nil {
+			logging.GetLogger().Errorf("Error while decoding metrics %s, %s", err, string(data))
+			return nil, err
+		}
+		metrics[row.UUID] = append(metrics[row.UUID], row.FlowMetric)
+	}
+
+	return metrics, nil
+}
+
+// OnStarted implements storage client listener interface
+func (c *Storage) OnStarted() {
+	tables := []struct {
+		schema string
+		ttl    string
+	}{
+		{flowTableSchema, "Last"},
+		{metricTableSchema, "Last"},
+		{rawpacketTableSchema, "Timestamp"},
+	}
+
+	for _, table := range tables {
+		if err := c.client.Exec(table.schema + c.client.TTL(table.ttl, "")); err != nil {
+			logging.GetLogger().Errorf("Failed to create ClickHouse table: %s", err)
+		}
+	}
+}
+
+// Start the database client
+func (c *Storage) Start() {
+	c.client.Start()
+}
+
+// Stop the database client
+func (c *Storage) Stop() {
+	c.client.Stop()
+}
+
+// New creates a new ClickHouse flow storage
+func New(cfg ch.Config) (*Storage, error) {
+	client, err := ch.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Storage{client: client}
+
+	client.AddEventListener(s)
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
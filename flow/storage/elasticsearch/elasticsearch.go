@@ -130,10 +130,22 @@ type embeddedFlow struct {
 	UUID         *string
 	LayersPath   *string
 	Application  *string
+	AppName      string               `json:"AppName,omitempty"`
+	Direction    string               `json:"Direction,omitempty"`
+	AScope       string               `json:"AScope,omitempty"`
+	BScope       string               `json:"BScope,omitempty"`
 	Link         *flow.FlowLayer      `json:"Link,omitempty"`
 	Network      *flow.FlowLayer      `json:"Network,omitempty"`
 	Transport    *flow.TransportLayer `json:"Transport,omitempty"`
 	ICMP         *flow.ICMPLayer      `json:"ICMP,omitempty"`
+	ARP          *flow.ARPLayer       `json:"ARP,omitempty"`
+	SCTP         *flow.SCTPLayer      `json:"SCTP,omitempty"`
+	QUIC         *flow.QUICLayer      `json:"QUIC,omitempty"`
+	TLS          *flow.TLSLayer       `json:"TLS,omitempty"`
+	Tunnel       *flow.TunnelLayer    `json:"Tunnel,omitempty"`
+	Threat       *flow.ThreatLayer    `json:"Threat,omitempty"`
+	Provenance   *flow.Provenance     `json:"Provenance,omitempty"`
+	L7           *flow.L7Layer        `json:"L7,omitempty"`
 	DHCPv4       *fl.DHCPv4           `json:"DHCPv4,omitempty"`
 	DNS          *fl.DNS              `json:"DNS,omitempty"`
 	VRRPv2       *fl.VRRPv2           `json:"VRRPv2,omitempty"`
@@ -150,10 +162,22 @@ func flowToEmbbedFlow(f *flow.Flow) *embeddedFlow {
 		UUID:         &f.UUID,
 		LayersPath:   &f.LayersPath,
 		Application:  &f.Application,
+		AppName:      f.AppName,
+		Direction:    f.Direction,
+		AScope:       f.AScope,
+		BScope:       f.BScope,
 		Link:         f.Link,
 		Network:      f.Network,
 		Transport:    f.Transport,
 		ICMP:         f.ICMP,
+		ARP:          f.ARP,
+		SCTP:         f.SCTP,
+		QUIC:         f.QUIC,
+		TLS:          f.TLS,
+		Tunnel:       f.Tunnel,
+		Threat:       f.Threat,
+		Provenance:   f.Provenance,
+		L7:           f.L7,
 		DHCPv4:       f.DHCPv4,
 		DNS:          f.DNS,
 		VRRPv2:       f.VRRPv2,
@@ -271,10 +295,14 @@ func (c *Storage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filter
 			if fr, ok := rawpackets[*record.Flow.UUID]; ok {
 				fr.RawPackets = append(fr.RawPackets, record.RawPacket)
 			} else {
-				rawpackets[*record.Flow.UUID] = &flow.RawPackets{
+				fr := &flow.RawPackets{
 					LinkType:   record.LinkType,
 					RawPackets: []*flow.RawPacket{record.RawPacket},
 				}
+				if record.Flow.NodeTID != nil {
+					fr.NodeTID = *record.Flow.NodeTID
+				}
+				rawpackets[*record.Flow.UUID] = fr
 			}
 		}
 	}
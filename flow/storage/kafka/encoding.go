@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package kafka
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+// AvroSchema is the schema, in its parsing canonical form, of the Avro
+// encoded flows
+const AvroSchema = `{"name":"skydive.Flow","type":"record","fields":[` +
+	`{"name":"UUID","type":"string"},` +
+	`{"name":"LayersPath","type":"string"},` +
+	`{"name":"Application","type":"string"},` +
+	`{"name":"TrackingID","type":"string"},` +
+	`{"name":"L3TrackingID","type":"string"},` +
+	`{"name":"ParentUUID","type":"string"},` +
+	`{"name":"NodeTID","type":"string"},` +
+	`{"name":"LinkA","type":"string"},` +
+	`{"name":"LinkB","type":"string"},` +
+	`{"name":"NetworkProtocol","type":"string"},` +
+	`{"name":"NetworkA","type":"string"},` +
+	`{"name":"NetworkB","type":"string"},` +
+	`{"name":"TransportProtocol","type":"string"},` +
+	`{"name":"TransportA","type":"long"},` +
+	`{"name":"TransportB","type":"long"},` +
+	`{"name":"ABPackets","type":"long"},` +
+	`{"name":"ABBytes","type":"long"},` +
+	`{"name":"BAPackets","type":"long"},` +
+	`{"name":"BABytes","type":"long"},` +
+	`{"name":"RTT","type":"long"},` +
+	`{"name":"Start","type":"long"},` +
+	`{"name":"Last","type":"long"},` +
+	`{"name":"FinishType","type":"string"}]}`
+
+// avroEmpty is the CRC-64-AVRO fingerprint initial value
+const avroEmpty = 0xc15d213aa4d7a795
+
+var avroFingerprint []byte
+
+func init() {
+	var table [256]uint64
+	for i := range table {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (avroEmpty & -(fp & 1))
+		}
+		table[i] = fp
+	}
+
+	fp := uint64(avroEmpty)
+	for _, b := range []byte(AvroSchema) {
+		fp = (fp >> 8) ^ table[byte(fp)^b]
+	}
+
+	avroFingerprint = make([]byte, 8)
+	binary.LittleEndian.PutUint64(avroFingerprint, fp)
+}
+
+type avroEncoder []byte
+
+func (a *avroEncoder) long(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	*a = append(*a, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func (a *avroEncoder) string(s string) {
+	a.long(int64(len(s)))
+	*a = append(*a, s...)
+}
+
+// encodeAvro returns the flow using the Avro single object encoding, the
+// payload being prefixed by the schema fingerprint
+func encodeAvro(f *flow.Flow) ([]byte, error) {
+	a := avroEncoder{0xc3, 0x01}
+	a = append(a, avroFingerprint...)
+
+	a.string(f.UUID)
+	a.string(f.LayersPath)
+	a.string(f.Application)
+	a.string(f.TrackingID)
+	a.string(f.L3TrackingID)
+	a.string(f.ParentUUID)
+	a.string(f.NodeTID)
+
+	var linkA, linkB string
+	if f.Link != nil {
+		linkA, linkB = f.Link.A, f.Link.B
+	}
+	a.string(linkA)
+	a.string(linkB)
+
+	var networkProtocol, networkA, networkB string
+	if f.Network != nil {
+		networkProtocol, networkA, networkB = f.Network.Protocol.String(), f.Network.A, f.Network.B
+	}
+	a.string(networkProtocol)
+	a.string(networkA)
+	a.string(networkB)
+
+	var transportProtocol string
+	var transportA, transportB int64
+	if f.Transport != nil {
+		transportProtocol, transportA, transportB = f.Transport.Protocol.String(), f.Transport.A, f.Transport.B
+	}
+	a.string(transportProtocol)
+	a.long(transportA)
+	a.long(transportB)
+
+	metric := f.Metric
+	if metric == nil {
+		metric = &flow.FlowMetric{}
+	}
+	a.long(metric.ABPackets)
+	a.long(metric.ABBytes)
+	a.long(metric.BAPackets)
+	a.long(metric.BABytes)
+	a.long(metric.RTT)
+
+	a.long(f.Start)
+	a.long(f.Last)
+	a.string(f.FinishType.String())
+
+	return a, nil
+}
+
+func encodeJSON(f *flow.Flow) ([]byte, error) {
+	return json.Marshal(f)
+}
+
+func encodeProtobuf(f *flow.Flow) ([]byte, error) {
+	return f.Marshal()
+}
+
+// nodeTIDKey partitions the flows by capture node
+func nodeTIDKey(f *flow.Flow) []byte {
+	return []byte(f.NodeTID)
+}
+
+// fiveTupleKey partitions the flows by 5-tuple, both directions of a
+// conversation sharing the same key
+func fiveTupleKey(f *flow.Flow) []byte {
+	if f.Network == nil {
+		return []byte(f.L3TrackingID)
+	}
+
+	a, b := f.Network.A, f.Network.B
+	var protocol string
+	if f.Transport != nil {
+		protocol = f.Transport.Protocol.String()
+		a = fmt.Sprintf("%s:%d", a, f.Transport.A)
+		b = fmt.Sprintf("%s:%d", b, f.Transport.B)
+	}
+	if a > b {
+		a, b = b, a
+	}
+
+	h := sha1.Sum([]byte(protocol + "|" + a + "|" + b))
+	return h[:8]
+}
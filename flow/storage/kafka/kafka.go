@@ -0,0 +1,173 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package kafka
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	kafka "github.com/skydive-project/skydive/storage/kafka"
+)
+
+// ErrSearchNotSupported is returned as flows published to Kafka can not be
+// queried back
+var ErrSearchNotSupported = errors.New("Kafka flow backend doesn't support searching")
+
+// Storage publishes the flows to Kafka topics
+type Storage struct {
+	producer     *kafka.Producer
+	topic        string
+	updatesTopic string
+	encode       func(f *flow.Flow) ([]byte, error)
+	key          func(f *flow.Flow) []byte
+}
+
+func (s *Storage) message(f *flow.Flow) (kafka.Message, error) {
+	value, err := s.encode(f)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+
+	msg := kafka.Message{Value: value, Timestamp: time.Unix(0, f.Last*int64(time.Millisecond))}
+	if s.key != nil {
+		msg.Key = s.key(f)
+	}
+	return msg, nil
+}
+
+// StoreFlows publishes the finished flows, and the flow updates when an
+// updates topic is configured
+func (s *Storage) StoreFlows(flows []*flow.Flow) error {
+	var finished, updates []kafka.Message
+	for _, f := range flows {
+		if f.FinishType == flow.FlowFinishType_NOT_FINISHED && s.updatesTopic == "" {
+			continue
+		}
+
+		msg, err := s.message(f)
+		if err != nil {
+			return fmt.Errorf("Error while encoding flow %s: %s", f.UUID, err)
+		}
+
+		if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+			finished = append(finished, msg)
+		} else {
+			updates = append(updates, msg)
+		}
+	}
+
+	if err := s.producer.Produce(s.topic, finished); err != nil {
+		return fmt.Errorf("Error while publishing flows to %s: %s", s.topic, err)
+	}
+
+	if err := s.producer.Produce(s.updatesTopic, updates); err != nil {
+		return fmt.Errorf("Error while publishing flow updates to %s: %s", s.updatesTopic, err)
+	}
+
+	return nil
+}
+
+// SearchFlows is not supported by the Kafka backend
+func (s *Storage) SearchFlows(fsq filters.SearchQuery) (*flow.FlowSet, error) {
+	return nil, ErrSearchNotSupported
+}
+
+// SearchMetrics is not supported by the Kafka backend
+func (s *Storage) SearchMetrics(fsq filters.SearchQuery, metricFilter *filters.Filter) (map[string][]common.Metric, error) {
+	return nil, ErrSearchNotSupported
+}
+
+// SearchRawPackets is not supported by the Kafka backend
+func (s *Storage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filters.Filter) (map[string]*flow.RawPackets, error) {
+	return nil, ErrSearchNotSupported
+}
+
+// Start the Kafka backend
+func (s *Storage) Start() {
+}
+
+// Stop the Kafka backend
+func (s *Storage) Stop() {
+	s.producer.Close()
+}
+
+// New returns a new Kafka flow backend
+func New(backend string) (*Storage, error) {
+	path := "storage." + backend
+
+	s := &Storage{
+		topic:        config.GetString(path + ".topic"),
+		updatesTopic: config.GetString(path + ".updates_topic"),
+	}
+
+	switch encoding := config.GetString(path + ".encoding"); encoding {
+	case "avro":
+		s.encode = encodeAvro
+	case "json":
+		s.encode = encodeJSON
+	case "protobuf":
+		s.encode = encodeProtobuf
+	default:
+		return nil, fmt.Errorf("Kafka encoding '%s' not supported", encoding)
+	}
+
+	switch partitionKey := config.GetString(path + ".partition_key"); partitionKey {
+	case "5tuple":
+		s.key = fiveTupleKey
+	case "nodetid":
+		s.key = nodeTIDKey
+	case "none":
+	default:
+		return nil, fmt.Errorf("Kafka partition key '%s' not supported", partitionKey)
+	}
+
+	cfg := kafka.Config{
+		Brokers:  config.GetStringSlice(path + ".brokers"),
+		ClientID: config.GetString(path + ".client_id"),
+		Acks:     config.GetInt(path + ".acks"),
+		Timeout:  time.Duration(config.GetInt(path+".timeout")) * time.Second,
+	}
+
+	if config.GetBool(path + ".tls") {
+		tlsConfig, err := config.GetTLSClientConfig(true)
+		if err != nil {
+			return nil, err
+		}
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{}
+		}
+		cfg.TLSConfig = tlsConfig
+	}
+
+	producer, err := kafka.NewProducer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.producer = producer
+
+	logging.GetLogger().Infof("Publishing flows to Kafka topic %s using %s", s.topic, cfg.Brokers)
+
+	return s, nil
+}
@@ -43,10 +43,22 @@ type flowDoc struct {
 	UUID               *string
 	LayersPath         *string
 	Application        *string
+	AppName            string               `json:"AppName,omitempty"`
+	Direction          string               `json:"Direction,omitempty"`
+	AScope             string               `json:"AScope,omitempty"`
+	BScope             string               `json:"BScope,omitempty"`
 	Link               *flow.FlowLayer      `json:"Link,omitempty"`
 	Network            *flow.FlowLayer      `json:"Network,omitempty"`
 	Transport          *flow.TransportLayer `json:"Transport,omitempty"`
 	ICMP               *flow.ICMPLayer      `json:"ICMP,omitempty"`
+	ARP                *flow.ARPLayer       `json:"ARP,omitempty"`
+	SCTP               *flow.SCTPLayer      `json:"SCTP,omitempty"`
+	QUIC               *flow.QUICLayer      `json:"QUIC,omitempty"`
+	TLS                *flow.TLSLayer       `json:"TLS,omitempty"`
+	Tunnel             *flow.TunnelLayer    `json:"Tunnel,omitempty"`
+	Threat             *flow.ThreatLayer    `json:"Threat,omitempty"`
+	Provenance         *flow.Provenance     `json:"Provenance,omitempty"`
+	L7                 *flow.L7Layer        `json:"L7,omitempty"`
 	Metric             *flow.FlowMetric     `json:"Metric,omitempty"`
 	TCPMetric          *flow.TCPMetric      `json:"TCPMetric,omitempty"`
 	IPMetric           *flow.IPMetric       `json:"IPMetric,omitempty"`
@@ -67,6 +79,7 @@ type rawpacketDoc struct {
 	Class     string `json:"@class"`
 	Type      string `json:"@type"`
 	Flow      string
+	NodeTID   string `json:",omitempty"`
 	LinkType  layers.LinkType
 	Timestamp int64
 	Index     int64
@@ -93,10 +106,22 @@ func flowToDoc(f *flow.Flow) *flowDoc {
 		UUID:               &f.UUID,
 		LayersPath:         &f.LayersPath,
 		Application:        &f.Application,
+		AppName:            f.AppName,
+		Direction:          f.Direction,
+		AScope:             f.AScope,
+		BScope:             f.BScope,
 		Link:               f.Link,
 		Network:            f.Network,
 		Transport:          f.Transport,
 		ICMP:               f.ICMP,
+		ARP:                f.ARP,
+		SCTP:               f.SCTP,
+		QUIC:               f.QUIC,
+		TLS:                f.TLS,
+		Tunnel:             f.Tunnel,
+		Threat:             f.Threat,
+		Provenance:         f.Provenance,
+		L7:                 f.L7,
 		Metric:             f.Metric,
 		TCPMetric:          f.TCPMetric,
 		IPMetric:           f.IPMetric,
@@ -251,7 +276,7 @@ func (c *Storage) SearchFlows(fsq filters.SearchQuery) (*flow.FlowSet, error) {
 // SearchRawPackets searches flow raw packets matching filters in the database
 func (c *Storage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filters.Filter) (map[string]*flow.RawPackets, error) {
 	filter := fsq.Filter
-	sql := "SELECT LinkType, Timestamp, Index, Data, Flow.UUID FROM FlowRawPacket"
+	sql := "SELECT LinkType, Timestamp, Index, Data, Flow.UUID, Flow.NodeTID AS NodeTID FROM FlowRawPacket"
 
 	where := false
 	if packetFilter != nil {
@@ -296,6 +321,7 @@ func (c *Storage) SearchRawPackets(fsq filters.SearchQuery, packetFilter *filter
 			rawpackets[doc.Flow] = &flow.RawPackets{
 				LinkType:   doc.LinkType,
 				RawPackets: []*flow.RawPacket{r},
+				NodeTID:    doc.NodeTID,
 			}
 		}
 	}
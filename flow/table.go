@@ -18,6 +18,7 @@
 package flow
 
 import (
+	"encoding/json"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -54,12 +55,20 @@ func NewFlowHandler(callback ExpireUpdateFunc, every time.Duration) *Handler {
 
 // TableOpts defines flow table options
 type TableOpts struct {
-	RawPacketLimit int64
-	ExtraTCPMetric bool
-	IPDefrag       bool
-	ReassembleTCP  bool
-	LayerKeyMode   LayerKeyMode
-	ExtraLayers    ExtraLayers
+	RawPacketLimit         int64
+	RawPacketExcludedPorts []int
+	RawPacketSampling      int
+	ExtraTCPMetric         bool
+	IPDefrag               bool
+	ReassembleTCP          bool
+	LayerKeyMode           LayerKeyMode
+	ExtraLayers            ExtraLayers
+	Provenance             *Provenance
+	MemoryLimit            int64
+	EvictionPolicy         string
+	PacketSampling         int
+	FlowByteLimit          int64
+	MaxFlows               int
 }
 
 // Table store the flow table and related metrics mechanism
@@ -86,7 +95,15 @@ type Table struct {
 	tcpAssembler      *TCPAssembler
 	flowOpts          Opts
 	appPortMap        *ApplicationPortMap
+	internalNets      *InternalNetworks
+	portMask          *PortMask
+	rawPacketFilter   *RawPacketFilter
+	sampler           *packetSampler
 	appTimeout        map[string]int64
+	checkpoint        *Checkpoint
+	suspended         int32
+	memory            int64
+	evicted           int64
 }
 
 // OperationType operation type of a Flow in a flow table
@@ -113,6 +130,15 @@ func updateTCPFlagTime(prevFlagTime int64, currFlagTime int64) int64 {
 	return currFlagTime
 }
 
+// updateTCPSocketMetric returns the last value reported for a metric of a
+// socket, the metrics being reported only while the socket is known
+func updateTCPSocketMetric(prevValue int64, currValue int64) int64 {
+	if currValue != 0 {
+		return currValue
+	}
+	return prevValue
+}
+
 // NewTable creates a new flow table
 func NewTable(updateHandler *Handler, expireHandler *Handler, nodeTID string, opts ...TableOpts) *Table {
 	appTimeout := make(map[string]int64)
@@ -135,11 +161,17 @@ func NewTable(updateHandler *Handler, expireHandler *Handler, nodeTID string, op
 		ipDefragger:       NewIPDefragger(),
 		tcpAssembler:      NewTCPAssembler(),
 		appPortMap:        NewApplicationPortMapFromConfig(),
+		internalNets:      NewInternalNetworksFromConfig(),
+		portMask:          NewPortMaskFromConfig(),
 		appTimeout:        appTimeout,
 	}
 	if len(opts) > 0 {
 		t.Opts = opts[0]
 	}
+	if t.Opts.RawPacketLimit != 0 {
+		t.rawPacketFilter = NewRawPacketFilter(t.Opts.RawPacketExcludedPorts, t.Opts.RawPacketSampling)
+	}
+	t.sampler = newPacketSampler(t.Opts.PacketSampling)
 
 	t.flowOpts = Opts{
 		TCPMetric:    t.Opts.ExtraTCPMetric,
@@ -147,6 +179,8 @@ func NewTable(updateHandler *Handler, expireHandler *Handler, nodeTID string, op
 		LayerKeyMode: t.Opts.LayerKeyMode,
 		AppPortMap:   t.appPortMap,
 		ExtraLayers:  t.Opts.ExtraLayers,
+		InternalNets: t.internalNets,
+		PortMask:     t.portMask,
 	}
 
 	t.updateVersion = 0
@@ -221,7 +255,7 @@ func (ft *Table) expire(expireBefore int64) {
 			}
 
 			// need to use the key as the key could be not equal to the UUID
-			delete(ft.table, k)
+			ft.deleteFlow(k, f)
 		}
 	}
 
@@ -275,7 +309,7 @@ func (ft *Table) update(updateFrom, updateTime int64) {
 		} else if updateTime-f.Last > ft.appTimeout[f.Application] && ft.appTimeout[f.Application] > 0 {
 			updatedFlows = append(updatedFlows, f)
 			f.FinishType = FlowFinishType_TIMEOUT
-			delete(ft.table, k)
+			ft.deleteFlow(k, f)
 		} else {
 			f.LastUpdateMetric = &FlowMetric{Start: updateFrom, Last: updateTime}
 		}
@@ -283,7 +317,7 @@ func (ft *Table) update(updateFrom, updateTime int64) {
 		f.XXX_state.lastMetric = f.Metric.Copy()
 
 		if f.FinishType != FlowFinishType_NOT_FINISHED && updateTime-f.Last >= HoldTimeoutMilliseconds {
-			delete(ft.table, k)
+			ft.deleteFlow(k, f)
 		}
 	}
 
@@ -299,6 +333,11 @@ func (ft *Table) update(updateFrom, updateTime int64) {
 			}
 		}
 	}
+
+	// refresh the estimates with the flows as updated since the last update
+	for k, f := range ft.table {
+		ft.accountFlow(k, f)
+	}
 }
 
 func (ft *Table) expireNow() {
@@ -311,6 +350,57 @@ func (ft *Table) expireAt(now time.Time) {
 	ft.lastExpire = common.UnixMillis(now)
 }
 
+func (ft *Table) saveCheckpoint() {
+	var entries []*checkpointEntry
+	for k, f := range ft.table {
+		if f.FinishType == FlowFinishType_NOT_FINISHED {
+			entries = append(entries, &checkpointEntry{key: k, flow: f, lastMetric: f.XXX_state.lastMetric})
+		}
+	}
+
+	if err := ft.checkpoint.save(ft.nodeTID, ft.lastUpdate, entries); err != nil {
+		logging.GetLogger().Errorf("Unable to checkpoint flow table %s: %s", ft.nodeTID, err)
+		return
+	}
+	logging.GetLogger().Debugf("Flow table %s checkpointed with %d flows", ft.nodeTID, len(entries))
+}
+
+func (ft *Table) restoreCheckpoint() {
+	lastUpdate, entries, err := ft.checkpoint.load(ft.nodeTID)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to restore flow table %s checkpoint: %s", ft.nodeTID, err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	ft.lastUpdate = lastUpdate
+	for _, entry := range entries {
+		f := entry.flow
+		f.XXX_state.lastMetric = entry.lastMetric
+
+		// send the restored flows with the next update so that the metrics
+		// not reported before the restart are not lost
+		f.XXX_state.updateVersion = ft.updateVersion + 1
+
+		ft.table[entry.key] = f
+		ft.accountFlow(entry.key, f)
+	}
+
+	logging.GetLogger().Infof("Flow table %s restored %d flows from checkpoint", ft.nodeTID, len(entries))
+}
+
+// TableStats describes the statistics of a flow table
+type TableStats struct {
+	NodeTID       string
+	Flows         int
+	UpdateVersion int64
+	Memory        int64
+	EvictedFlows  int64
+	Opts          TableOpts
+}
+
 func (ft *Table) onQuery(tq *TableQuery) []byte {
 	switch tq.Type {
 	case "SearchQuery":
@@ -322,12 +412,43 @@ func (ft *Table) onQuery(tq *TableQuery) []byte {
 			return nil
 		}
 
+		return b
+	case "StatsQuery":
+		stats := &TableStats{
+			NodeTID:       ft.nodeTID,
+			Flows:         len(ft.table),
+			UpdateVersion: ft.updateVersion,
+			Memory:        ft.memory,
+			EvictedFlows:  ft.evicted,
+			Opts:          ft.Opts,
+		}
+
+		b, err := json.Marshal(stats)
+		if err != nil {
+			return nil
+		}
+
 		return b
 	}
 
 	return nil
 }
 
+// Stats returns the statistics of the flow table, nil if not running
+func (ft *Table) Stats() *TableStats {
+	b := ft.Query(&TableQuery{Type: "StatsQuery"})
+	if b == nil {
+		return nil
+	}
+
+	var stats TableStats
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return nil
+	}
+
+	return &stats
+}
+
 // Query a flow table
 func (ft *Table) Query(query *TableQuery) []byte {
 	ft.lockState.Lock()
@@ -353,10 +474,19 @@ func (ft *Table) Query(query *TableQuery) []byte {
 	return nil
 }
 
-func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
+func (ft *Table) packetToFlow(packet *Packet, parentUUID string, weight int64) *Flow {
 	key := packet.Key(parentUUID, ft.flowOpts)
 	flow, new := ft.getOrCreateFlow(key)
-	if new {
+
+	var before flowMetricCounters
+	if flow.Metric != nil {
+		before = countersOf(flow.Metric)
+	}
+
+	capped := !new && ft.capped(flow)
+	if capped {
+		flow.updateCounters(packet, ft.flowOpts)
+	} else if new {
 		uuids := UUIDs{
 			ParentUUID: parentUUID,
 		}
@@ -368,6 +498,8 @@ func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
 		}
 
 		flow.initFromPacket(key, packet, ft.nodeTID, uuids, ft.flowOpts)
+		flow.Provenance = ft.Opts.Provenance
+		ft.accountFlow(key, flow)
 	} else {
 		if ft.Opts.ReassembleTCP {
 			if layer := packet.GoPacket.TransportLayer(); layer != nil && layer.LayerType() == layers.LayerTypeTCP {
@@ -377,10 +509,11 @@ func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
 
 		flow.Update(packet, ft.flowOpts)
 	}
+	scaleMetric(flow.Metric, before, weight)
 
 	flow.XXX_state.updateVersion = ft.updateVersion + 1
 
-	if ft.Opts.RawPacketLimit != 0 && flow.RawPacketsCaptured < ft.Opts.RawPacketLimit {
+	if !capped && ft.Opts.RawPacketLimit != 0 && flow.RawPacketsCaptured < ft.Opts.RawPacketLimit && ft.rawPacketFilter.Retain(flow) {
 		flow.RawPacketsCaptured++
 		data := &RawPacket{
 			Timestamp: common.UnixMillis(packet.GoPacket.Metadata().CaptureInfo.Timestamp),
@@ -388,6 +521,7 @@ func (ft *Table) packetToFlow(packet *Packet, parentUUID string) *Flow {
 			Data:      packet.Data,
 		}
 		flow.LastRawPackets = append(flow.LastRawPackets, data)
+		ft.accountRawPacket(flow, data)
 	}
 
 	return flow
@@ -397,15 +531,18 @@ func (ft *Table) processPacketSeq(ps *PacketSequence) {
 	var parentUUID string
 	logging.GetLogger().Debugf("%d Packets received for capture node %s", len(ps.Packets), ft.nodeTID)
 	for _, packet := range ps.Packets {
-		f := ft.packetToFlow(packet, parentUUID)
+		f := ft.packetToFlow(packet, parentUUID, ps.Weight)
 		parentUUID = f.UUID
 	}
+
+	ft.evictFlows()
 }
 
 func (ft *Table) processFlowOP(op *Operation) {
 	switch op.Type {
 	case ReplaceOperation:
 		fl := op.Flow
+		fl.Provenance = ft.Opts.Provenance
 
 		prev := ft.replaceFlow(op.Key, fl)
 		if prev != nil {
@@ -414,6 +551,7 @@ func (ft *Table) processFlowOP(op *Operation) {
 			fl.XXX_state = prev.XXX_state
 			fl.XXX_state.updateVersion = ft.updateVersion + 1
 		}
+		ft.accountFlow(op.Key, fl)
 	case UpdateOperation:
 		fl := ft.table[op.Key]
 		if fl == nil {
@@ -434,6 +572,13 @@ func (ft *Table) processFlowOP(op *Operation) {
 				BAFinStart: updateTCPFlagTime(fl.TCPMetric.BAFinStart, op.Flow.TCPMetric.BAFinStart),
 				ABRstStart: updateTCPFlagTime(fl.TCPMetric.ABRstStart, op.Flow.TCPMetric.ABRstStart),
 				BARstStart: updateTCPFlagTime(fl.TCPMetric.BARstStart, op.Flow.TCPMetric.BARstStart),
+
+				ABSRTT:        updateTCPSocketMetric(fl.TCPMetric.ABSRTT, op.Flow.TCPMetric.ABSRTT),
+				BASRTT:        updateTCPSocketMetric(fl.TCPMetric.BASRTT, op.Flow.TCPMetric.BASRTT),
+				ABRetransmits: updateTCPSocketMetric(fl.TCPMetric.ABRetransmits, op.Flow.TCPMetric.ABRetransmits),
+				BARetransmits: updateTCPSocketMetric(fl.TCPMetric.BARetransmits, op.Flow.TCPMetric.BARetransmits),
+				ABZeroWindows: updateTCPSocketMetric(fl.TCPMetric.ABZeroWindows, op.Flow.TCPMetric.ABZeroWindows),
+				BAZeroWindows: updateTCPSocketMetric(fl.TCPMetric.BAZeroWindows, op.Flow.TCPMetric.BAZeroWindows),
 			}
 		}
 
@@ -443,6 +588,8 @@ func (ft *Table) processFlowOP(op *Operation) {
 			fl.Metric.RTT = fl.Last - fl.Start
 		}
 	}
+
+	ft.evictFlows()
 }
 
 // State returns the state of the flow table, stopped, running...
@@ -470,6 +617,15 @@ func (ft *Table) Run() {
 	nowTicker := time.NewTicker(time.Second * 1)
 	defer nowTicker.Stop()
 
+	var checkpointChan <-chan time.Time
+	if ft.checkpoint != nil {
+		ft.restoreCheckpoint()
+
+		checkpointTicker := time.NewTicker(ft.checkpoint.every)
+		defer checkpointTicker.Stop()
+		checkpointChan = checkpointTicker.C
+	}
+
 	ft.query = make(chan *TableQuery, 100)
 	ft.reply = make(chan []byte, 100)
 
@@ -499,6 +655,8 @@ func (ft *Table) Run() {
 			t := now.Add(-ctDuration)
 			ft.tcpAssembler.FlushOlderThan(t)
 			ft.ipDefragger.FlushOlderThan(t)
+		case <-checkpointChan:
+			ft.saveCheckpoint()
 		}
 	}
 }
@@ -511,9 +669,17 @@ func (ft *Table) IPDefragger() *IPDefragger {
 	return nil
 }
 
-// FeedWithGoPacket feeds the table with a gopacket
+// FeedWithGoPacket feeds the table with a gopacket, one packet out of
+// PacketSampling being kept when the table samples the packets
 func (ft *Table) FeedWithGoPacket(packet gopacket.Packet, bpf *BPF) {
+	if !ft.sampler.sample() {
+		return
+	}
+
 	if ps := PacketSeqFromGoPacket(packet, 0, bpf, ft.ipDefragger); len(ps.Packets) > 0 {
+		if ft.sampler != nil {
+			ps.Weight = ft.sampler.rate
+		}
 		ft.packetSeqChan <- ps
 	}
 }
@@ -555,7 +721,36 @@ func (ft *Table) Stop() {
 
 		close(ft.packetSeqChan)
 		close(ft.flowChanOperation)
+
+		if ft.checkpoint != nil {
+			if atomic.LoadInt32(&ft.suspended) == 1 {
+				// keep the in-progress flows for the next run instead of
+				// reporting them as expired
+				ft.saveCheckpoint()
+				ft.table = make(map[string]*Flow)
+				ft.memory = 0
+			} else if err := ft.checkpoint.remove(ft.nodeTID); err != nil {
+				logging.GetLogger().Errorf("Unable to remove flow table %s checkpoint: %s", ft.nodeTID, err)
+			}
+		}
 	}
 
 	ft.expireNow()
 }
+
+// Flush expires all the flows of a running table, releasing their memory
+func (ft *Table) Flush() {
+	ft.lockState.RLock()
+	defer ft.lockState.RUnlock()
+
+	if atomic.LoadInt64(&ft.state) == common.RunningState {
+		ft.flush <- true
+		<-ft.flushDone
+	}
+}
+
+// Suspend makes the table checkpoint its flows instead of expiring them when
+// stopped, if checkpointing is enabled
+func (ft *Table) Suspend() {
+	atomic.StoreInt32(&ft.suspended, 1)
+}
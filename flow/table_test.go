@@ -18,6 +18,10 @@
 package flow
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -269,3 +273,232 @@ func TestHold(t *testing.T) {
 		t.Error("Updated flow should not have been deleted by update")
 	}
 }
+
+func TestTableStats(t *testing.T) {
+	table := NewTable(nil, nil, "probe-1", TableOpts{RawPacketLimit: 10})
+
+	fillTableFromPCAP(t, table, "pcaptraces/icmpv4-symetric.pcap", layers.LinkTypeEthernet, nil)
+
+	var stats TableStats
+	if err := json.Unmarshal(table.onQuery(&TableQuery{Type: "StatsQuery"}), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.NodeTID != "probe-1" || stats.Flows != 100 || stats.Opts.RawPacketLimit != 10 {
+		t.Errorf("Unexpected table statistics: %+v", stats)
+	}
+}
+
+func TestTableProvenance(t *testing.T) {
+	provenance := &Provenance{CaptureID: "capture-1", CaptureType: "pcap", BPFFilter: "icmp", SamplingRate: 10}
+	table := NewTable(nil, nil, "probe-1", TableOpts{Provenance: provenance})
+
+	fillTableFromPCAP(t, table, "pcaptraces/icmpv4-symetric.pcap", layers.LinkTypeEthernet, nil)
+
+	for _, f := range table.getFlows(&filters.SearchQuery{}).Flows {
+		if captureID, err := f.GetFieldString("Provenance.CaptureID"); err != nil || captureID != "capture-1" {
+			t.Fatalf("Expected the flow to come from capture-1, got %s", captureID)
+		}
+
+		if rate, err := f.GetFieldInt64("Provenance.SamplingRate"); err != nil || rate != 10 {
+			t.Fatalf("Expected a sampling rate of 10, got %d", rate)
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "skydive-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpoint, err := NewCheckpoint(dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := NewTable(nil, nil, "probe-1", TableOpts{})
+	table.checkpoint = checkpoint
+
+	fillTableFromPCAP(t, table, "pcaptraces/icmpv4-symetric.pcap", layers.LinkTypeEthernet, nil)
+	table.lastUpdate = 1000
+	table.saveCheckpoint()
+
+	restored := NewTable(nil, nil, "probe-1", TableOpts{})
+	restored.checkpoint = checkpoint
+	restored.restoreCheckpoint()
+
+	if len(restored.table) != len(table.table) || restored.lastUpdate != 1000 {
+		t.Fatalf("Expected %d flows, got %d", len(table.table), len(restored.table))
+	}
+
+	for key, f := range table.table {
+		r, found := restored.table[key]
+		if !found {
+			t.Fatalf("Flow %s not restored", key)
+		}
+		if r.UUID != f.UUID || r.Metric.ABBytes != f.Metric.ABBytes || r.Metric.BAPackets != f.Metric.BAPackets {
+			t.Errorf("Restored flow differs, expected %+v, got %+v", f, r)
+		}
+		if r.XXX_state.updateVersion <= restored.updateVersion {
+			t.Errorf("Restored flow should be sent with the next update: %+v", r)
+		}
+	}
+
+	// a table of another capture doesn't restore the flows
+	other := NewTable(nil, nil, "probe-2", TableOpts{})
+	other.checkpoint = checkpoint
+	other.restoreCheckpoint()
+
+	if len(other.table) != 0 {
+		t.Errorf("Expected no flow, got %d", len(other.table))
+	}
+}
+
+func TestMemoryAccounting(t *testing.T) {
+	table := NewTable(nil, nil, "", TableOpts{})
+
+	f, _ := table.getOrCreateFlow("flow1")
+	table.accountFlow("flow1", f)
+
+	expected := int64(flowEntryOverhead + len("flow1") + f.ProtoSize())
+	if table.memory != expected || f.XXX_state.memory != expected {
+		t.Fatalf("Expected %d bytes accounted, got %d for the table and %d for the flow", expected, table.memory, f.XXX_state.memory)
+	}
+
+	// growing flows are accounted again, not twice
+	f.UUID = "a-flow-uuid"
+	f.Metric = &FlowMetric{ABPackets: 1, ABBytes: 100}
+	table.accountFlow("flow1", f)
+
+	grown := int64(flowEntryOverhead + len("flow1") + f.ProtoSize())
+	if grown <= expected || table.memory != grown {
+		t.Fatalf("Expected %d bytes accounted for the grown flow, got %d", grown, table.memory)
+	}
+
+	table.accountRawPacket(f, &RawPacket{Data: make([]byte, 128)})
+	if table.memory != grown+rawPacketOverhead+128 {
+		t.Fatalf("Expected the raw packet to be accounted, got %d", table.memory)
+	}
+
+	table.deleteFlow("flow1", f)
+	if table.memory != 0 || len(table.table) != 0 {
+		t.Errorf("Expected the memory of the deleted flow to be released, got %d", table.memory)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	for _, test := range []struct {
+		policy  string
+		evicted string
+	}{
+		{EvictionLRU, "flow1"},
+		{EvictionLargest, "flow2"},
+	} {
+		var evicted []*Flow
+		expHandler := NewFlowHandler(func(f *FlowArray) { evicted = append(evicted, f.Flows...) }, 300*time.Second)
+
+		table := NewTable(nil, expHandler, "", TableOpts{EvictionPolicy: test.policy})
+
+		for i, key := range []string{"flow1", "flow2", "flow3"} {
+			f, _ := table.getOrCreateFlow(key)
+			f.UUID = key
+			f.Last = int64(i + 1)
+			table.accountFlow(key, f)
+		}
+		table.accountRawPacket(table.table["flow2"], &RawPacket{Data: make([]byte, 128)})
+
+		// no eviction under the limit
+		table.Opts.MemoryLimit = table.memory
+		table.evictFlows()
+		if len(evicted) != 0 {
+			t.Fatalf("No flow should have been evicted, got %+v", evicted)
+		}
+
+		table.Opts.MemoryLimit = table.memory - 1
+		table.evictFlows()
+
+		if len(evicted) != 1 || evicted[0].UUID != test.evicted {
+			t.Fatalf("Expected %s to be evicted with %s policy, got %+v", test.evicted, test.policy, evicted)
+		}
+		if evicted[0].FinishType != FlowFinishType_EVICTED {
+			t.Errorf("Evicted flow should have the EVICTED finish type: %+v", evicted[0])
+		}
+		if len(table.table) != 2 || table.evicted != 1 {
+			t.Errorf("Expected 2 flows left and 1 evicted, got %d and %d", len(table.table), table.evicted)
+		}
+
+		var memory int64
+		for _, f := range table.table {
+			memory += f.XXX_state.memory
+		}
+		if memory != table.memory {
+			t.Errorf("Table memory %d doesn't match the flows memory %d", table.memory, memory)
+		}
+	}
+}
+
+func TestMaxFlows(t *testing.T) {
+	var evicted []*Flow
+	expHandler := NewFlowHandler(func(f *FlowArray) { evicted = append(evicted, f.Flows...) }, 300*time.Second)
+
+	table := NewTable(nil, expHandler, "", TableOpts{MaxFlows: 10})
+
+	for i := 0; i < 11; i++ {
+		key := fmt.Sprintf("flow%d", i)
+		f, _ := table.getOrCreateFlow(key)
+		f.UUID = key
+		f.Last = int64(i + 1)
+		table.accountFlow(key, f)
+	}
+	table.evictFlows()
+
+	// the least recently seen flows are evicted down to the low watermark
+	if len(evicted) != 2 || evicted[0].UUID != "flow0" || evicted[1].UUID != "flow1" {
+		t.Fatalf("Expected flow0 and flow1 to be evicted, got %+v", evicted)
+	}
+	if len(table.table) != 9 || table.evicted != 2 {
+		t.Errorf("Expected 9 flows left and 2 evicted, got %d and %d", len(table.table), table.evicted)
+	}
+}
+
+func TestFlowByteLimit(t *testing.T) {
+	table := NewTable(nil, nil, "", TableOpts{RawPacketLimit: 10, FlowByteLimit: 1})
+
+	fillTableFromPCAP(t, table, "pcaptraces/icmpv4-symetric.pcap", layers.LinkTypeEthernet, nil)
+
+	for _, f := range table.getFlows(&filters.SearchQuery{}).Flows {
+		// capped flows are still counted but their packets not retained
+		if f.Metric.ABPackets+f.Metric.BAPackets != 2 || f.RawPacketsCaptured != 1 {
+			t.Fatalf("Expected 2 packets counted and 1 raw packet captured: %+v", f)
+		}
+	}
+}
+
+func TestPacketSampling(t *testing.T) {
+	if newPacketSampler(1) != nil {
+		t.Fatal("No sampler expected for a rate of 1")
+	}
+
+	sampler := newPacketSampler(10)
+
+	var sampled int
+	for i := 0; i < 100000; i++ {
+		if sampler.sample() {
+			sampled++
+		}
+	}
+	if sampled < 9000 || sampled > 11000 {
+		t.Errorf("Expected about 10000 packets sampled, got %d", sampled)
+	}
+
+	m := &FlowMetric{ABPackets: 1, ABBytes: 100}
+	before := countersOf(m)
+	m.ABPackets, m.ABBytes = 2, 160
+	scaleMetric(m, before, 10)
+
+	if m.ABPackets != 11 || m.ABBytes != 700 {
+		t.Errorf("Expected the sampled packet to be extrapolated, got %+v", m)
+	}
+}
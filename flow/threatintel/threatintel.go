@@ -0,0 +1,417 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package threatintel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Indicator types
+const (
+	IndicatorIP     = "ip"
+	IndicatorCIDR   = "cidr"
+	IndicatorDomain = "domain"
+)
+
+// Source describes a list of indicators. Column is the CSV column holding
+// the indicators.
+type Source struct {
+	Name   string
+	URL    string
+	Format string
+	Column int
+}
+
+// Match describes an indicator found in a flow
+type Match struct {
+	Source    string
+	Indicator string
+	Type      string
+	Endpoint  string
+}
+
+// Listener is notified when a flow matches an indicator for the first time
+type Listener interface {
+	OnThreatMatched(f *flow.Flow, matches []Match)
+}
+
+type cidrIndicator struct {
+	ipnet  *net.IPNet
+	source string
+}
+
+type indicators struct {
+	ips     map[string]string
+	cidrs   []cidrIndicator
+	domains map[string]string
+}
+
+// Matcher tags flows touching indicators of the loaded sources
+type Matcher struct {
+	sync.RWMutex
+	sources    []Source
+	indicators *indicators
+	refresh    time.Duration
+	notified   *cache.Cache
+	listeners  []Listener
+	quit       chan bool
+	wg         sync.WaitGroup
+}
+
+// sourceTimeout bounds the retrieval of a remote source
+const sourceTimeout = 30 * time.Second
+
+var sourceClient = &http.Client{Timeout: sourceTimeout}
+
+var stixPattern = regexp.MustCompile(`(ipv4-addr|ipv6-addr|domain-name):value\s*=\s*'([^']+)'`)
+
+func newIndicators() *indicators {
+	return &indicators{
+		ips:     make(map[string]string),
+		domains: make(map[string]string),
+	}
+}
+
+func (i *indicators) add(value, source string) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return
+	}
+
+	if ip := net.ParseIP(value); ip != nil {
+		i.ips[ip.String()] = source
+	} else if _, ipnet, err := net.ParseCIDR(value); err == nil {
+		i.cidrs = append(i.cidrs, cidrIndicator{ipnet: ipnet, source: source})
+	} else if strings.Contains(value, ".") && !strings.ContainsAny(value, " /:") {
+		i.domains[strings.TrimSuffix(value, ".")] = source
+	}
+}
+
+func (i *indicators) matchIP(addr string) (string, string, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return "", "", false
+	}
+
+	if source, ok := i.ips[ip.String()]; ok {
+		return source, ip.String(), true
+	}
+
+	for _, c := range i.cidrs {
+		if c.ipnet.Contains(ip) {
+			return c.source, c.ipnet.String(), true
+		}
+	}
+
+	return "", "", false
+}
+
+// matchDomain matches the domain or one of its parent domains
+func (i *indicators) matchDomain(domain string) (string, string, bool) {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	for domain != "" {
+		if source, ok := i.domains[domain]; ok {
+			return source, domain, true
+		}
+
+		dot := strings.Index(domain, ".")
+		if dot == -1 {
+			break
+		}
+		domain = domain[dot+1:]
+	}
+
+	return "", "", false
+}
+
+// parseCSV reads the indicators from a column of a CSV list, lines
+// starting with a # are ignored
+func parseCSV(r io.Reader, source string, column int, i *indicators) error {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(record) > column {
+			i.add(record[column], source)
+		}
+	}
+}
+
+// parseSTIX reads the indicators of a STIX 2 bundle, both indicator
+// patterns and cyber observable objects are supported
+func parseSTIX(r io.Reader, source string, i *indicators) error {
+	var bundle struct {
+		Objects []struct {
+			Type    string `json:"type"`
+			Pattern string `json:"pattern"`
+			Value   string `json:"value"`
+		} `json:"objects"`
+	}
+
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return err
+	}
+
+	for _, object := range bundle.Objects {
+		switch object.Type {
+		case "indicator":
+			for _, match := range stixPattern.FindAllStringSubmatch(object.Pattern, -1) {
+				i.add(match[2], source)
+			}
+		case "ipv4-addr", "ipv6-addr", "domain-name":
+			i.add(object.Value, source)
+		}
+	}
+
+	return nil
+}
+
+func openSource(url string) (io.ReadCloser, error) {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		resp, err := sourceClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Unexpected status code: %d", resp.StatusCode)
+		}
+		return resp.Body, nil
+	}
+
+	return os.Open(strings.TrimPrefix(url, "file://"))
+}
+
+func (s *Source) load(i *indicators) error {
+	rc, err := openSource(s.URL)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	switch strings.ToLower(s.Format) {
+	case "stix":
+		return parseSTIX(bufio.NewReader(rc), s.Name, i)
+	case "csv", "":
+		return parseCSV(bufio.NewReader(rc), s.Name, s.Column, i)
+	default:
+		return fmt.Errorf("Unsupported format: %s", s.Format)
+	}
+}
+
+// Load (re)loads all the sources, a source failing to load is skipped
+func (m *Matcher) Load() {
+	i := newIndicators()
+	for _, source := range m.sources {
+		if err := source.load(i); err != nil {
+			logging.GetLogger().Errorf("Unable to load threat intelligence source %s: %s", source.Name, err)
+			continue
+		}
+		logging.GetLogger().Debugf("Threat intelligence source %s loaded", source.Name)
+	}
+
+	logging.GetLogger().Infof("%d threat intelligence indicators loaded", len(i.ips)+len(i.cidrs)+len(i.domains))
+
+	m.Lock()
+	m.indicators = i
+	m.Unlock()
+}
+
+// AddListener registers a listener notified of flows matching indicators
+func (m *Matcher) AddListener(l Listener) {
+	m.Lock()
+	m.listeners = append(m.listeners, l)
+	m.Unlock()
+}
+
+func (m *Matcher) match(f *flow.Flow) []Match {
+	m.RLock()
+	defer m.RUnlock()
+
+	var matches []Match
+	if f.Network != nil {
+		endpoints := []struct{ name, addr string }{{"A", f.Network.A}, {"B", f.Network.B}}
+		for _, endpoint := range endpoints {
+			if source, indicator, ok := m.indicators.matchIP(endpoint.addr); ok {
+				typ := IndicatorIP
+				if strings.Contains(indicator, "/") {
+					typ = IndicatorCIDR
+				}
+				matches = append(matches, Match{Source: source, Indicator: indicator, Type: typ, Endpoint: endpoint.name})
+			}
+		}
+	}
+
+	var domains []string
+	if f.DNS != nil {
+		domains = append(domains, f.DNS.DNSQuestions...)
+	}
+	if f.QUIC != nil && f.QUIC.SNI != "" {
+		domains = append(domains, f.QUIC.SNI)
+	}
+	for _, domain := range domains {
+		if source, indicator, ok := m.indicators.matchDomain(domain); ok {
+			matches = append(matches, Match{Source: source, Indicator: indicator, Type: IndicatorDomain, Endpoint: "B"})
+		}
+	}
+
+	return matches
+}
+
+// Tag adds the matching indicators to the flow and notifies the listeners
+// the first time a flow matches an indicator
+func (m *Matcher) Tag(f *flow.Flow) {
+	matches := m.match(f)
+	if len(matches) == 0 {
+		return
+	}
+
+	f.Threat = &flow.ThreatLayer{}
+
+	var newMatches []Match
+	for _, match := range matches {
+		f.Threat.Sources = appendUnique(f.Threat.Sources, match.Source)
+		f.Threat.Indicators = appendUnique(f.Threat.Indicators, match.Indicator)
+
+		key := f.UUID + "/" + match.Source + "/" + match.Indicator
+		if _, found := m.notified.Get(key); !found {
+			m.notified.Set(key, true, cache.DefaultExpiration)
+			newMatches = append(newMatches, match)
+		}
+	}
+
+	if len(newMatches) > 0 {
+		m.RLock()
+		listeners := m.listeners
+		m.RUnlock()
+
+		for _, l := range listeners {
+			l.OnThreatMatched(f, newMatches)
+		}
+	}
+}
+
+func appendUnique(l []string, s string) []string {
+	for _, e := range l {
+		if e == s {
+			return l
+		}
+	}
+	return append(l, s)
+}
+
+// Start loads the sources and refreshes them periodically. The sources are
+// loaded in background so that an unreachable feed doesn't delay the startup.
+func (m *Matcher) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		m.Load()
+
+		if m.refresh == 0 {
+			return
+		}
+
+		ticker := time.NewTicker(m.refresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Load()
+			case <-m.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the periodic refresh
+func (m *Matcher) Stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+
+// NewMatcher returns a new matcher for the given sources
+func NewMatcher(sources []Source, refresh time.Duration) *Matcher {
+	expire := time.Duration(config.GetInt("flow.expire")) * time.Second
+	return &Matcher{
+		sources:    sources,
+		indicators: newIndicators(),
+		refresh:    refresh,
+		notified:   cache.New(expire, expire),
+		quit:       make(chan bool),
+	}
+}
+
+// NewMatcherFromConfig returns a matcher for the sources defined in the
+// analyzer.threat_intel section, nil if no source is defined
+func NewMatcherFromConfig() (*Matcher, error) {
+	cfg := config.Get("analyzer.threat_intel.sources")
+	if cfg == nil {
+		return nil, nil
+	}
+
+	var sources []Source
+	if err := mapstructure.Decode(cfg, &sources); err != nil {
+		return nil, fmt.Errorf("Unable to read analyzer.threat_intel.sources: %s", err)
+	}
+
+	for _, source := range sources {
+		if source.Name == "" || source.URL == "" {
+			return nil, fmt.Errorf("Threat intelligence sources require a name and an url: %+v", source)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	refresh := time.Duration(config.GetInt("analyzer.threat_intel.refresh")) * time.Second
+	return NewMatcher(sources, refresh), nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package threatintel
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/skydive-project/skydive/flow"
+	fl "github.com/skydive-project/skydive/flow/layers"
+)
+
+const csvList = `# first seen, indicator
+2019-01-01,198.51.100.7
+2019-01-02,"203.0.113.0/24"
+2019-01-03,evil.example.com
+`
+
+const stixBundle = `{
+  "type": "bundle",
+  "objects": [
+    {"type": "indicator", "pattern": "[ipv4-addr:value = '192.0.2.1'] OR [domain-name:value = 'bad.example.org']"},
+    {"type": "ipv6-addr", "value": "2001:db8::666"}
+  ]
+}`
+
+type fakeListener struct {
+	matches []Match
+}
+
+func (l *fakeListener) OnThreatMatched(f *flow.Flow, matches []Match) {
+	l.matches = append(l.matches, matches...)
+}
+
+func writeSource(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "threat-intel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestThreatIntelMatcher(t *testing.T) {
+	csvFile := writeSource(t, csvList)
+	defer os.Remove(csvFile)
+
+	stixFile := writeSource(t, stixBundle)
+	defer os.Remove(stixFile)
+
+	m := NewMatcher([]Source{
+		{Name: "csv", URL: csvFile, Format: "csv", Column: 1},
+		{Name: "stix", URL: "file://" + stixFile, Format: "stix"},
+	}, 0)
+	m.Load()
+
+	listener := &fakeListener{}
+	m.AddListener(listener)
+
+	tests := []struct {
+		flow      *flow.Flow
+		source    string
+		indicator string
+	}{
+		{&flow.Flow{UUID: "1", Network: &flow.FlowLayer{A: "10.0.0.1", B: "198.51.100.7"}}, "csv", "198.51.100.7"},
+		{&flow.Flow{UUID: "2", Network: &flow.FlowLayer{A: "203.0.113.42", B: "10.0.0.1"}}, "csv", "203.0.113.0/24"},
+		{&flow.Flow{UUID: "3", DNS: &fl.DNS{DNSQuestions: []string{"www.evil.example.com"}}}, "csv", "evil.example.com"},
+		{&flow.Flow{UUID: "4", Network: &flow.FlowLayer{A: "10.0.0.1", B: "192.0.2.1"}}, "stix", "192.0.2.1"},
+		{&flow.Flow{UUID: "5", QUIC: &flow.QUICLayer{SNI: "bad.example.org"}}, "stix", "bad.example.org"},
+		{&flow.Flow{UUID: "6", Network: &flow.FlowLayer{A: "2001:db8::666", B: "2001:db8::1"}}, "stix", "2001:db8::666"},
+	}
+
+	for _, test := range tests {
+		m.Tag(test.flow)
+
+		if test.flow.Threat == nil {
+			t.Errorf("Flow %s should be tagged", test.flow.UUID)
+			continue
+		}
+
+		if len(test.flow.Threat.Sources) != 1 || test.flow.Threat.Sources[0] != test.source {
+			t.Errorf("Flow %s, wrong sources: %v", test.flow.UUID, test.flow.Threat.Sources)
+		}
+
+		if len(test.flow.Threat.Indicators) != 1 || test.flow.Threat.Indicators[0] != test.indicator {
+			t.Errorf("Flow %s, wrong indicators: %v", test.flow.UUID, test.flow.Threat.Indicators)
+		}
+	}
+
+	if len(listener.matches) != len(tests) {
+		t.Errorf("Expected %d alerts, got %d", len(tests), len(listener.matches))
+	}
+
+	// flow updates must not raise new alerts
+	m.Tag(tests[0].flow)
+	if len(listener.matches) != len(tests) {
+		t.Errorf("Flow update should not raise an alert")
+	}
+
+	clean := &flow.Flow{UUID: "7", Network: &flow.FlowLayer{A: "10.0.0.1", B: "10.0.0.2"}}
+	if m.Tag(clean); clean.Threat != nil {
+		t.Errorf("Flow should not be tagged: %+v", clean.Threat)
+	}
+}
@@ -0,0 +1,389 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+const (
+	tlsRecordHandshake       = 0x16
+	tlsRecordApplicationData = 0x17
+	tlsRecordHeaderLength    = 5
+	tlsMaxRecordLength       = 16384 + 2048
+	tlsHandshakeClientHello  = 0x01
+	tlsHandshakeServerHello  = 0x02
+
+	// tlsMaxHandshakePackets is the number of packets of a TCP flow after
+	// which the handshake is not looked for anymore
+	tlsMaxHandshakePackets = 16
+)
+
+var tlsVersions = map[uint16]string{
+	0x0300: "SSL 3.0",
+	0x0301: "TLS 1.0",
+	0x0302: "TLS 1.1",
+	0x0303: "TLS 1.2",
+	0x0304: "TLS 1.3",
+}
+
+var tlsCipherSuites = map[uint16]string{
+	0x000a: "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	0x002f: "TLS_RSA_WITH_AES_128_CBC_SHA",
+	0x0035: "TLS_RSA_WITH_AES_256_CBC_SHA",
+	0x009c: "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	0x009d: "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+	0xc009: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	0xc00a: "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	0xc013: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	0xc014: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	0xc02b: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0xc02c: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	0xc02f: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xc030: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	0xcca8: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xcca9: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+// TLSVersionString returns a human readable TLS protocol version
+func TLSVersionString(version uint16) string {
+	if s, ok := tlsVersions[version]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// TLSCipherSuiteName returns the IANA name of a TLS cipher suite
+func TLSCipherSuiteName(suite uint16) string {
+	if s, ok := tlsCipherSuites[suite]; ok {
+		return s
+	}
+	return fmt.Sprintf("0x%04x", suite)
+}
+
+// tlsHello holds the fields of a ClientHello or ServerHello handshake
+// message used for the flow metadata and the JA3/JA3S fingerprints
+type tlsHello struct {
+	client       bool
+	version      uint16
+	random       []byte
+	cipherSuites []uint16
+	extensions   []uint16
+	curves       []uint16
+	pointFormats []uint8
+	// version selected by the server with the supported_versions extension
+	selectedVersion uint16
+	sni             string
+	alpn            []string
+	// whether all the extensions were parsed
+	complete bool
+}
+
+// isGREASE returns whether the value is one of the reserved values of RFC 8701
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func joinTLSValues(values []uint16) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			s = append(s, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(s, "-")
+}
+
+// ja3 returns the JA3 string of a ClientHello or the JA3S string of a ServerHello
+func (h *tlsHello) ja3() string {
+	if !h.client {
+		var suite uint16
+		if len(h.cipherSuites) > 0 {
+			suite = h.cipherSuites[0]
+		}
+		return fmt.Sprintf("%d,%d,%s", h.version, suite, joinTLSValues(h.extensions))
+	}
+
+	formats := make([]string, len(h.pointFormats))
+	for i, f := range h.pointFormats {
+		formats[i] = strconv.Itoa(int(f))
+	}
+
+	return fmt.Sprintf("%d,%s,%s,%s,%s", h.version, joinTLSValues(h.cipherSuites),
+		joinTLSValues(h.extensions), joinTLSValues(h.curves), strings.Join(formats, "-"))
+}
+
+// fingerprint returns the MD5 hash of the JA3 or JA3S string
+func (h *tlsHello) fingerprint() string {
+	sum := md5.Sum([]byte(h.ja3()))
+	return hex.EncodeToString(sum[:])
+}
+
+// negotiatedVersion returns the protocol version selected by the server
+func (h *tlsHello) negotiatedVersion() uint16 {
+	if h.selectedVersion != 0 {
+		return h.selectedVersion
+	}
+	return h.version
+}
+
+// parseTLSHello parses a ClientHello or ServerHello handshake message. The
+// message can be truncated, in that case the extensions seen so far are
+// reported and the hello is flagged as not complete.
+func parseTLSHello(data []byte) *tlsHello {
+	r := &quicReader{data: data}
+
+	msgType, err := r.uint8()
+	if err != nil || (msgType != tlsHandshakeClientHello && msgType != tlsHandshakeServerHello) {
+		return nil
+	}
+	h := &tlsHello{client: msgType == tlsHandshakeClientHello}
+
+	// length
+	if _, err = r.bytes(3); err != nil {
+		return nil
+	}
+	if h.version, err = r.uint16(); err != nil {
+		return nil
+	}
+	if h.random, err = r.bytes(32); err != nil {
+		return nil
+	}
+	sessionIDLen, err := r.uint8()
+	if err != nil {
+		return nil
+	}
+	if _, err = r.bytes(int(sessionIDLen)); err != nil {
+		return nil
+	}
+
+	if h.client {
+		suitesLen, err := r.uint16()
+		if err != nil {
+			return nil
+		}
+		suites, err := r.bytes(int(suitesLen))
+		if err != nil {
+			return nil
+		}
+		for i := 0; i+1 < len(suites); i += 2 {
+			h.cipherSuites = append(h.cipherSuites, binary.BigEndian.Uint16(suites[i:]))
+		}
+		compressionLen, err := r.uint8()
+		if err != nil {
+			return h
+		}
+		if _, err = r.bytes(int(compressionLen)); err != nil {
+			return h
+		}
+	} else {
+		suite, err := r.uint16()
+		if err != nil {
+			return nil
+		}
+		h.cipherSuites = []uint16{suite}
+		if _, err = r.uint8(); err != nil {
+			return h
+		}
+	}
+
+	extsLen, err := r.uint16()
+	if err != nil {
+		// extensions are optional
+		h.complete = r.off == len(data)
+		return h
+	}
+	end := r.off + int(extsLen)
+
+	for r.off < end {
+		extType, err := r.uint16()
+		if err != nil {
+			return h
+		}
+		extLen, err := r.uint16()
+		if err != nil {
+			return h
+		}
+		ext, err := r.bytes(int(extLen))
+		if err != nil {
+			return h
+		}
+		h.extensions = append(h.extensions, extType)
+
+		er := &quicReader{data: ext}
+		switch extType {
+		case 0x0000: // server_name
+			er.off = 2
+			if nameType, err := er.uint8(); err != nil || nameType != 0 {
+				continue
+			}
+			nameLen, err := er.uint16()
+			if err != nil {
+				continue
+			}
+			if name, err := er.bytes(int(nameLen)); err == nil {
+				h.sni = strings.ToLower(string(name))
+			}
+		case 0x000a: // supported_groups
+			er.off = 2
+			for {
+				group, err := er.uint16()
+				if err != nil {
+					break
+				}
+				h.curves = append(h.curves, group)
+			}
+		case 0x000b: // ec_point_formats
+			if len(ext) > 0 {
+				h.pointFormats = append([]uint8{}, ext[1:]...)
+			}
+		case 0x0010: // application_layer_protocol_negotiation
+			er.off = 2
+			for er.off < len(ext) {
+				protoLen, err := er.uint8()
+				if err != nil {
+					break
+				}
+				proto, err := er.bytes(int(protoLen))
+				if err != nil {
+					break
+				}
+				h.alpn = append(h.alpn, string(proto))
+			}
+		case 0x002b: // supported_versions
+			if !h.client {
+				h.selectedVersion, _ = er.uint16()
+			}
+		}
+	}
+	h.complete = true
+
+	return h
+}
+
+// newTLSLayer reports the metadata of a ClientHello or ServerHello in the flow
+func (f *Flow) newTLSLayer(h *tlsHello) {
+	if f.TLS == nil {
+		f.TLS = &TLSLayer{}
+		if f.Application == "TCP" {
+			f.Application = "TLS"
+		}
+	}
+
+	if h.client {
+		f.TLS.SNI = h.sni
+		f.TLS.ALPN = h.alpn
+		if h.complete {
+			f.TLS.JA3 = h.fingerprint()
+		}
+	} else {
+		f.TLS.Version = TLSVersionString(h.negotiatedVersion())
+		f.TLS.CipherSuite = TLSCipherSuiteName(h.cipherSuites[0])
+		if h.complete {
+			f.TLS.JA3S = h.fingerprint()
+		}
+	}
+}
+
+// updateTLS looks for the ClientHello and ServerHello in the first packets
+// of a TCP flow. The handshake record of each direction is buffered until
+// complete as it is often split across several segments.
+func (f *Flow) updateTLS(packet *Packet) {
+	if f.Transport == nil || f.Transport.Protocol != FlowProtocol_TCP {
+		return
+	}
+
+	if (f.TLS != nil && f.TLS.Version != "") || f.Metric.ABPackets+f.Metric.BAPackets > tlsMaxHandshakePackets {
+		f.XXX_state.tlsRecords = [2][]byte{}
+		return
+	}
+
+	tcpPacket, ok := packet.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok || len(tcpPacket.Payload) == 0 {
+		return
+	}
+
+	dir := 0
+	if int64(tcpPacket.SrcPort) != f.Transport.A {
+		dir = 1
+	}
+
+	record := append(f.XXX_state.tlsRecords[dir], tcpPacket.Payload...)
+	if record[0] != tlsRecordHandshake || (len(record) > 1 && record[1] != 0x03) {
+		f.XXX_state.tlsRecords[dir] = nil
+		return
+	}
+
+	if len(record) < tlsRecordHeaderLength {
+		f.XXX_state.tlsRecords[dir] = record
+		return
+	}
+
+	length := int(binary.BigEndian.Uint16(record[3:5]))
+	if length > tlsMaxRecordLength {
+		f.XXX_state.tlsRecords[dir] = nil
+		return
+	}
+
+	if len(record) < tlsRecordHeaderLength+length {
+		f.XXX_state.tlsRecords[dir] = record
+		return
+	}
+	f.XXX_state.tlsRecords[dir] = nil
+
+	if h := parseTLSHello(record[tlsRecordHeaderLength : tlsRecordHeaderLength+length]); h != nil {
+		f.newTLSLayer(h)
+		if tlsKeyLog != nil {
+			f.newTLSSession(dir, h)
+		}
+	}
+}
+
+// GetStringField returns the value of a TLS field
+func (t *TLSLayer) GetStringField(field string) (string, error) {
+	if t == nil {
+		return "", common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "Version":
+		return t.Version, nil
+	case "CipherSuite":
+		return t.CipherSuite, nil
+	case "SNI":
+		return t.SNI, nil
+	case "JA3":
+		return t.JA3, nil
+	case "JA3S":
+		return t.JA3S, nil
+	default:
+		return "", common.ErrFieldNotFound
+	}
+}
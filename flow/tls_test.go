@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/skydive-project/skydive/filters"
+)
+
+func serverHello(version, suite uint16) []byte {
+	ext := []byte{0x00, 0x2b, 0x00, 0x02, byte(version >> 8), byte(version)}
+	ext = append(ext, 0x00, 0x33, 0x00, 0x04, 0x00, 0x1d, 0x00, 0x00)
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0x00)
+	body = append(body, byte(suite>>8), byte(suite), 0x00)
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+
+	msg := []byte{0x02, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(msg, body...)
+}
+
+func tlsRecord(msg []byte) []byte {
+	return append([]byte{0x16, 0x03, 0x01, byte(len(msg) >> 8), byte(len(msg))}, msg...)
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTLSHelloJA3(t *testing.T) {
+	// GREASE values are ignored, supported_groups and ec_point_formats added
+	ext := []byte{0x1a, 0x1a, 0x00, 0x00}
+	ext = append(ext, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x06, 0x0a, 0x0a, 0x00, 0x1d, 0x00, 0x17)
+	ext = append(ext, 0x00, 0x0b, 0x00, 0x02, 0x01, 0x00)
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, 0x00)
+	body = append(body, 0x00, 0x06, 0x2a, 0x2a, 0x13, 0x01, 0xc0, 0x2f)
+	body = append(body, 0x01, 0x00)
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+	msg := append([]byte{0x01, 0x00, byte(len(body) >> 8), byte(len(body))}, body...)
+
+	h := parseTLSHello(msg)
+	if h == nil || !h.client || !h.complete {
+		t.Fatalf("Wrong ClientHello parsed: %+v", h)
+	}
+
+	if ja3 := h.ja3(); ja3 != "771,4865-49199,10-11,29-23,0" {
+		t.Errorf("Wrong JA3 string: %s", ja3)
+	}
+
+	if h.fingerprint() != md5Hex("771,4865-49199,10-11,29-23,0") {
+		t.Errorf("Wrong JA3 fingerprint: %s", h.fingerprint())
+	}
+
+	// a truncated hello reports the extensions seen but no fingerprint
+	if h = parseTLSHello(clientHello("www.example.org", "h2")[:76]); h == nil || h.complete || h.sni != "www.example.org" {
+		t.Errorf("Wrong truncated ClientHello parsed: %+v", h)
+	}
+
+	h = parseTLSHello(serverHello(0x0304, 0x1302))
+	if h == nil || h.client || h.negotiatedVersion() != 0x0304 || h.ja3() != "771,4866,43-51" {
+		t.Errorf("Wrong ServerHello parsed: %+v", h)
+	}
+}
+
+func TestFlowTLS(t *testing.T) {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x00},
+		DstMAC:       net.HardwareAddr{0x00, 0x0f, 0xaa, 0xfa, 0xaa, 0x01},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.IP{192, 168, 0, 1},
+		DstIP:    net.IP{192, 168, 0, 2},
+	}
+	rip := *ip
+	rip.SrcIP, rip.DstIP = ip.DstIP, ip.SrcIP
+
+	client := tlsRecord(clientHello("www.Example.org", "h2", "http/1.1"))
+	server := tlsRecord(serverHello(0x0304, 0x1301))
+
+	now := time.Now()
+	packets := []gopacket.Packet{
+		// the ClientHello is split across two segments
+		forgeEthernetPacket(t, now, eth, ip, &layers.TCP{SrcPort: 51234, DstPort: 8443, PSH: true}, gopacket.Payload(client[:20])),
+		forgeEthernetPacket(t, now, eth, ip, &layers.TCP{SrcPort: 51234, DstPort: 8443, PSH: true}, gopacket.Payload(client[20:])),
+		forgeEthernetPacket(t, now, eth, &rip, &layers.TCP{SrcPort: 8443, DstPort: 51234, PSH: true}, gopacket.Payload(server)),
+	}
+
+	table := NewTable(nil, nil, "", TableOpts{})
+	for _, packet := range packets {
+		table.processPacketSeq(PacketSeqFromGoPacket(packet, 0, nil, nil))
+	}
+
+	flows := table.getFlows(&filters.SearchQuery{}).Flows
+	if len(flows) != 1 {
+		t.Fatalf("Should get 1 flow, got %d", len(flows))
+	}
+
+	f := flows[0]
+	if f.TLS == nil || f.Application != "TLS" {
+		t.Fatalf("Wrong TLS flow: %+v", f)
+	}
+
+	expected := map[string]string{
+		"TLS.SNI":         "www.example.org",
+		"TLS.Version":     "TLS 1.3",
+		"TLS.CipherSuite": "TLS_AES_128_GCM_SHA256",
+		"TLS.JA3":         md5Hex("771,4865,0-16,,"),
+		"TLS.JA3S":        md5Hex("771,4865,43-51"),
+	}
+	for field, value := range expected {
+		if v, err := f.GetFieldString(field); err != nil || v != value {
+			t.Errorf("Wrong %s field, expected %s, got %s, %v", field, value, v, err)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	tlsVersion13 = 0x0304
+
+	// tlsKeyLogReloadInterval is the minimum interval between two reads of
+	// the key log file when the secrets of a session are not found
+	tlsKeyLogReloadInterval = time.Second
+)
+
+// tlsTrafficSecrets holds the application traffic secrets of a TLS 1.3 session
+type tlsTrafficSecrets struct {
+	client []byte
+	server []byte
+}
+
+// tlsKeyLogFile holds the secrets of a NSS key log file, as written by the
+// applications honoring the SSLKEYLOGFILE environment variable, indexed by
+// the client random of the sessions
+type tlsKeyLogFile struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	checked time.Time
+	secrets map[string]*tlsTrafficSecrets
+}
+
+var tlsKeyLog *tlsKeyLogFile
+
+// SetTLSKeyLogFile enables the decryption of the TLS 1.3 flows whose
+// secrets are logged in the given NSS key log file
+func SetTLSKeyLogFile(path string) {
+	tlsKeyLog = &tlsKeyLogFile{path: path, secrets: make(map[string]*tlsTrafficSecrets)}
+}
+
+func (k *tlsKeyLogFile) load() error {
+	fi, err := os.Stat(k.path)
+	if err != nil {
+		return err
+	}
+
+	if fi.ModTime().Equal(k.modTime) {
+		return nil
+	}
+
+	file, err := os.Open(k.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	secrets := make(map[string]*tlsTrafficSecrets)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			continue
+		}
+
+		random := strings.ToLower(fields[1])
+		s, found := secrets[random]
+		if !found {
+			s = &tlsTrafficSecrets{}
+		}
+
+		switch fields[0] {
+		case "CLIENT_TRAFFIC_SECRET_0":
+			s.client = secret
+		case "SERVER_TRAFFIC_SECRET_0":
+			s.server = secret
+		default:
+			continue
+		}
+		secrets[random] = s
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	k.secrets, k.modTime = secrets, fi.ModTime()
+	return nil
+}
+
+// lookup returns the secrets of the session with the given client random,
+// the file being read again when they are not known yet
+func (k *tlsKeyLogFile) lookup(random []byte) *tlsTrafficSecrets {
+	k.Lock()
+	defer k.Unlock()
+
+	key := hex.EncodeToString(random)
+	if s := k.secrets[key]; s != nil && s.client != nil && s.server != nil {
+		return s
+	}
+
+	if time.Since(k.checked) < tlsKeyLogReloadInterval {
+		return nil
+	}
+	k.checked = time.Now()
+
+	if err := k.load(); err != nil {
+		logging.GetLogger().Debugf("Unable to read TLS key log file %s: %s", k.path, err)
+		return nil
+	}
+
+	if s := k.secrets[key]; s != nil && s.client != nil && s.server != nil {
+		return s
+	}
+	return nil
+}
+
+// tlsDecrypter decrypts the application data records of one direction of
+// a TLS 1.3 session
+type tlsDecrypter struct {
+	aead cipher.AEAD
+	iv   []byte
+	seq  uint64
+	buf  []byte
+}
+
+func newTLSDecrypter(suite uint16, secret []byte) (*tlsDecrypter, error) {
+	var h func() hash.Hash
+	var keyLength int
+
+	switch suite {
+	case 0x1301:
+		h, keyLength = sha256.New, 16
+	case 0x1302:
+		h, keyLength = sha512.New384, 32
+	default:
+		return nil, fmt.Errorf("unsupported cipher suite %s", TLSCipherSuiteName(suite))
+	}
+
+	block, err := aes.NewCipher(hkdfExpandLabelHash(h, secret, "key", keyLength))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tlsDecrypter{aead: aead, iv: hkdfExpandLabelHash(h, secret, "iv", aead.NonceSize())}, nil
+}
+
+// decrypt returns the application data of the complete records of the
+// stream. The records protected by the handshake keys fail to decrypt with
+// the application keys and are skipped.
+func (d *tlsDecrypter) decrypt(data []byte) (plaintext []byte) {
+	buf := append(d.buf, data...)
+
+	for len(buf) >= tlsRecordHeaderLength {
+		length := int(binary.BigEndian.Uint16(buf[3:5]))
+		if buf[1] != 0x03 || length > tlsMaxRecordLength {
+			// out of sync, likely after a lost segment
+			buf = nil
+			break
+		}
+
+		if len(buf) < tlsRecordHeaderLength+length {
+			break
+		}
+		header, record := buf[:tlsRecordHeaderLength], buf[tlsRecordHeaderLength:tlsRecordHeaderLength+length]
+		buf = buf[tlsRecordHeaderLength+length:]
+
+		if header[0] != tlsRecordApplicationData {
+			continue
+		}
+
+		nonce := make([]byte, len(d.iv))
+		copy(nonce, d.iv)
+		for i := 0; i < 8; i++ {
+			nonce[len(nonce)-1-i] ^= byte(d.seq >> uint(8*i))
+		}
+
+		inner, err := d.aead.Open(nil, nonce, record, header)
+		if err != nil {
+			continue
+		}
+		d.seq++
+
+		// strip the padding, the last non zero byte being the content type
+		i := len(inner) - 1
+		for i >= 0 && inner[i] == 0 {
+			i--
+		}
+		if i >= 0 && inner[i] == tlsRecordApplicationData {
+			plaintext = append(plaintext, inner[:i]...)
+		}
+	}
+
+	d.buf = append(d.buf[:0], buf...)
+	return
+}
+
+// tlsSession holds what is needed to decrypt a TLS 1.3 flow once its
+// secrets are found in the key log file
+type tlsSession struct {
+	clientDir  int
+	random     []byte
+	suite      uint16
+	failed     bool
+	decrypters [2]*tlsDecrypter
+	// records received before the secrets were found
+	pending [2][]byte
+}
+
+// newTLSSession keeps the client random of a ClientHello and the cipher
+// suite selected by the ServerHello of a TLS 1.3 session
+func (f *Flow) newTLSSession(dir int, h *tlsHello) {
+	if h.client {
+		f.XXX_state.tlsSession = &tlsSession{clientDir: dir, random: append([]byte{}, h.random...)}
+		return
+	}
+
+	if s := f.XXX_state.tlsSession; s != nil {
+		if h.negotiatedVersion() == tlsVersion13 {
+			s.suite = h.cipherSuites[0]
+		} else {
+			s.failed = true
+		}
+	}
+}
+
+// decryptTLS returns the application data of a TLS payload, the payload
+// being kept until the secrets of the session are found
+func (f *Flow) decryptTLS(dir int, payload []byte) []byte {
+	s := f.XXX_state.tlsSession
+	if s == nil || s.failed || s.suite == 0 || tlsKeyLog == nil {
+		return nil
+	}
+
+	if s.decrypters[dir] == nil {
+		secrets := tlsKeyLog.lookup(s.random)
+		if secrets == nil {
+			if len(s.pending[dir])+len(payload) > httpMaxBuffer {
+				s.failed, s.pending = true, [2][]byte{}
+				return nil
+			}
+			s.pending[dir] = append(s.pending[dir], payload...)
+			return nil
+		}
+
+		for i, secret := range [2][]byte{secrets.client, secrets.server} {
+			d, err := newTLSDecrypter(s.suite, secret)
+			if err != nil {
+				logging.GetLogger().Debugf("Unable to decrypt TLS flow %s: %s", f.UUID, err)
+				s.failed = true
+				return nil
+			}
+			if i == 0 {
+				s.decrypters[s.clientDir] = d
+			} else {
+				s.decrypters[1-s.clientDir] = d
+			}
+		}
+
+		payload = append(s.pending[dir], payload...)
+		s.pending[dir] = nil
+	}
+
+	if pending := s.pending[dir]; pending != nil {
+		payload = append(pending, payload...)
+		s.pending[dir] = nil
+	}
+
+	return s.decrypters[dir].decrypt(payload)
+}
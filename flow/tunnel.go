@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package flow
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// DefaultGTPUPort is the UDP port used by the GTP user plane
+const DefaultGTPUPort = 2152
+
+const (
+	gtpuHeaderLength   = 8
+	gtpuOptionalLength = 4
+	gtpuFlagsOptional  = 0x07
+	gtpuFlagExtension  = 0x04
+	gtpuMessageTPDU    = 0xff
+)
+
+// ErrGTPUTruncated is returned when a GTP-U header is truncated
+var ErrGTPUTruncated = errors.New("GTP-U header truncated")
+
+// LayerTypeGTPU is the layer type of the GTPv1 user plane encapsulation, decoded
+// only when enabled with RegisterGTPUPort
+var LayerTypeGTPU = gopacket.RegisterLayerType(55557, gopacket.LayerTypeMetadata{Name: "GTPU", Decoder: gopacket.DecodeFunc(decodeGTPU)})
+
+// GTPU holds the header of a GTPv1-U packet
+type GTPU struct {
+	layers.BaseLayer
+	Flags       uint8
+	MessageType uint8
+	TEID        uint32
+}
+
+// LayerType returns the GTP-U layer type
+func (g *GTPU) LayerType() gopacket.LayerType {
+	return LayerTypeGTPU
+}
+
+// DecodeFromBytes decodes the GTP-U header, the optional fields and the
+// extension headers chain
+func (g *GTPU) DecodeFromBytes(data []byte) error {
+	if len(data) < gtpuHeaderLength {
+		return ErrGTPUTruncated
+	}
+
+	g.Flags = data[0]
+	g.MessageType = data[1]
+	g.TEID = binary.BigEndian.Uint32(data[4:8])
+
+	offset := gtpuHeaderLength
+	if g.Flags&gtpuFlagsOptional != 0 {
+		if len(data) < offset+gtpuOptionalLength {
+			return ErrGTPUTruncated
+		}
+		offset += gtpuOptionalLength
+
+		if g.Flags&gtpuFlagExtension != 0 {
+			// the next extension header type is the last byte of each header
+			for next := data[offset-1]; next != 0; next = data[offset-1] {
+				if len(data) < offset+1 || data[offset] == 0 {
+					return ErrGTPUTruncated
+				}
+				offset += int(data[offset]) * 4
+				if len(data) < offset {
+					return ErrGTPUTruncated
+				}
+			}
+		}
+	}
+
+	g.Contents = data[:offset]
+	g.Payload = data[offset:]
+
+	return nil
+}
+
+func decodeGTPU(data []byte, p gopacket.PacketBuilder) error {
+	g := &GTPU{}
+	if err := g.DecodeFromBytes(data); err != nil {
+		return err
+	}
+	p.AddLayer(g)
+
+	// only the G-PDU messages carry user packets, the other ones are signaling
+	if g.MessageType == gtpuMessageTPDU && len(g.Payload) > 0 {
+		if ipPrefix, err := ipDecoderFromRawData(g.Payload, p); ipPrefix {
+			return err
+		}
+	}
+	return p.NextDecoder(gopacket.LayerTypePayload)
+}
+
+// RegisterGTPUPort enables the dissection of the GTP-U packets received on
+// the given UDP port
+func RegisterGTPUPort(port int) {
+	layers.RegisterUDPPortLayerType(layers.UDPPort(port), LayerTypeGTPU)
+}
+
+// newTunnelLayer returns the tunnel metadata of an encapsulation layer,
+// nil if the layer does not carry a virtual network identifier
+func newTunnelLayer(layer gopacket.Layer) *TunnelLayer {
+	switch l := layer.(type) {
+	case *layers.VXLAN:
+		return &TunnelLayer{Protocol: "VXLAN", VNI: int64(l.VNI)}
+	case *layers.Geneve:
+		return &TunnelLayer{Protocol: "GENEVE", VNI: int64(l.VNI)}
+	case *GTPU:
+		return &TunnelLayer{Protocol: "GTPU", VNI: int64(l.TEID)}
+	case *layers.GRE:
+		return &TunnelLayer{Protocol: "GRE", VNI: int64(l.Key)}
+	}
+	return nil
+}
+
+// GetStringField returns the value of a tunnel field
+func (t *TunnelLayer) GetStringField(field string) (string, error) {
+	if t == nil {
+		return "", common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "Protocol":
+		return t.Protocol, nil
+	default:
+		return "", common.ErrFieldNotFound
+	}
+}
+
+// GetFieldInt64 returns the value of a tunnel field
+func (t *TunnelLayer) GetFieldInt64(field string) (int64, error) {
+	if t == nil {
+		return 0, common.ErrFieldNotFound
+	}
+
+	switch field {
+	case "VNI":
+		return t.VNI, nil
+	default:
+		return 0, common.ErrFieldNotFound
+	}
+}
@@ -0,0 +1,373 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+// Package forecast fits linear trends to the utilization of the links,
+// computed from the metrics of the edges stored in the topology history, and
+// projects when the links will saturate, for capacity planning.
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// Forecast describes the utilization trend of an edge. The rates are in
+// bits per second, the Trend being their variation per day. Capacity is the
+// lowest speed of the interfaces of the edge, 0 if unknown, and Fit the
+// coefficient of determination of the trend. SaturationTime, in
+// milliseconds, is set when the trend reaches the saturation threshold of
+// the capacity, TimeToSaturation being the number of seconds left.
+type Forecast struct {
+	EdgeID           string
+	RelationType     string `json:",omitempty"`
+	Parent           string `json:",omitempty"`
+	Child            string `json:",omitempty"`
+	Capacity         int64
+	Current          float64
+	Trend            float64
+	Utilization      float64 `json:",omitempty"`
+	Fit              float64
+	Samples          int
+	Start            int64
+	Last             int64
+	SaturationTime   int64 `json:",omitempty"`
+	TimeToSaturation int64 `json:",omitempty"`
+}
+
+// Forecaster computes the forecasts of the edges from the metrics stored
+// during the history period, aggregated by bucket
+type Forecaster struct {
+	graph         *graph.Graph
+	gremlinParser *traversal.GremlinTraversalParser
+	history       time.Duration
+	bucket        time.Duration
+	threshold     float64
+	minSamples    int
+}
+
+// sample is the rate observed at a time, in seconds
+type sample struct {
+	time float64
+	rate float64
+}
+
+// fit returns the slope and the intercept of the least squares line of the
+// samples along with its coefficient of determination
+func fit(samples []sample) (slope, intercept, r2 float64) {
+	n := float64(len(samples))
+
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		sumX += s.time
+		sumY += s.rate
+		sumXY += s.time * s.rate
+		sumXX += s.time * s.time
+	}
+
+	if d := n*sumXX - sumX*sumX; d != 0 {
+		slope = (n*sumXY - sumX*sumY) / d
+	}
+	intercept = (sumY - slope*sumX) / n
+
+	meanY := sumY / n
+	var ssTot, ssRes float64
+	for _, s := range samples {
+		e := s.rate - (intercept + slope*s.time)
+		ssRes += e * e
+		ssTot += (s.rate - meanY) * (s.rate - meanY)
+	}
+	if ssTot > 0 {
+		r2 = 1 - ssRes/ssTot
+	}
+
+	return
+}
+
+// samples returns the rates of the metrics of an edge by bucket of the
+// given length in milliseconds, sorted by time
+func samples(metrics []common.Metric, bucket int64) (l []sample, start, last int64) {
+	type total struct {
+		bytes, duration int64
+	}
+	totals := make(map[int64]*total)
+
+	for _, m := range metrics {
+		duration := m.GetLast() - m.GetStart()
+		if duration <= 0 {
+			continue
+		}
+
+		k := m.GetStart() / bucket
+		t, found := totals[k]
+		if !found {
+			t = &total{}
+			totals[k] = t
+		}
+		bytes, _ := m.GetFieldInt64("Bytes")
+		t.bytes += bytes
+		t.duration += duration
+
+		if start == 0 || m.GetStart() < start {
+			start = m.GetStart()
+		}
+		if m.GetLast() > last {
+			last = m.GetLast()
+		}
+	}
+
+	for k, t := range totals {
+		l = append(l, sample{
+			time: float64(k*bucket+bucket/2) / 1000,
+			rate: float64(t.bytes) * 8 * 1000 / float64(t.duration),
+		})
+	}
+
+	sort.Slice(l, func(i, j int) bool { return l[i].time < l[j].time })
+	return
+}
+
+// capacity returns the lowest speed, in bits per second, of the interfaces
+// of an edge. The graph lock has to be held.
+func (f *Forecaster) capacity(e *graph.Edge) (capacity int64) {
+	for _, id := range []graph.Identifier{e.Parent, e.Child} {
+		node := f.graph.GetNode(id)
+		if node == nil {
+			continue
+		}
+
+		// Mbit/s as reported by ethtool
+		if speed, err := node.GetFieldInt64("Speed"); err == nil && speed > 0 {
+			if capacity == 0 || speed*1000000 < capacity {
+				capacity = speed * 1000000
+			}
+		}
+	}
+	return
+}
+
+// forecast computes the forecast of an edge from its metrics, nil if not
+// enough samples are available
+func (f *Forecaster) forecast(id string, metrics []common.Metric) *Forecast {
+	l, start, last := samples(metrics, int64(f.bucket/time.Millisecond))
+	if len(l) < f.minSamples || len(l) < 2 {
+		return nil
+	}
+
+	slope, intercept, r2 := fit(l)
+
+	fc := &Forecast{
+		EdgeID:  id,
+		Current: intercept + slope*float64(last)/1000,
+		Trend:   slope * 86400,
+		Fit:     r2,
+		Samples: len(l),
+		Start:   start,
+		Last:    last,
+	}
+	if fc.Current < 0 {
+		fc.Current = 0
+	}
+
+	if e := f.graph.GetEdge(graph.Identifier(id)); e != nil {
+		fc.RelationType, _ = e.GetFieldString("RelationType")
+		fc.Parent, fc.Child = string(e.Parent), string(e.Child)
+		fc.Capacity = f.capacity(e)
+	}
+
+	if fc.Capacity == 0 {
+		return fc
+	}
+
+	fc.Utilization = fc.Current / float64(fc.Capacity)
+
+	level := f.threshold * float64(fc.Capacity)
+	switch {
+	case fc.Current >= level:
+		fc.SaturationTime = last
+	case slope > 0:
+		fc.TimeToSaturation = int64((level - fc.Current) / slope)
+		fc.SaturationTime = last + fc.TimeToSaturation*1000
+	}
+
+	return fc
+}
+
+// Forecasts returns the forecasts of the edges having metrics during the
+// history period, the edges closest to saturation first
+func (f *Forecaster) Forecasts() ([]*Forecast, error) {
+	query := fmt.Sprintf("G.At('0s', %d).E().HasKey('LastUpdateMetric').Metrics()", int64(f.history/time.Second))
+
+	ts, err := f.gremlinParser.Parse(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ts.Exec(f.graph, false)
+	if err != nil {
+		return nil, err
+	}
+
+	forecasts := []*Forecast{}
+
+	values := res.Values()
+	if len(values) == 0 {
+		return forecasts, nil
+	}
+
+	metrics, ok := values[0].(map[string][]common.Metric)
+	if !ok {
+		return nil, errors.New("Unexpected edge metrics type")
+	}
+
+	f.graph.RLock()
+	for id, m := range metrics {
+		if fc := f.forecast(id, m); fc != nil {
+			forecasts = append(forecasts, fc)
+		}
+	}
+	f.graph.RUnlock()
+
+	sort.Slice(forecasts, func(i, j int) bool {
+		ti, tj := forecasts[i].SaturationTime, forecasts[j].SaturationTime
+		if (ti == 0) != (tj == 0) {
+			return tj == 0
+		}
+		if ti != tj {
+			return ti < tj
+		}
+		return forecasts[i].EdgeID < forecasts[j].EdgeID
+	})
+
+	return forecasts, nil
+}
+
+func (f *Forecaster) forecastsGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	forecasts, err := f.Forecasts()
+	if err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// only the edges saturating before the given number of seconds
+	if within := r.URL.Query().Get("within"); within != "" {
+		seconds, err := strconv.ParseInt(within, 10, 64)
+		if err != nil {
+			shttp.WriteError(w, http.StatusBadRequest, fmt.Errorf("Invalid within parameter: %s", within))
+			return
+		}
+
+		filtered := []*Forecast{}
+		for _, fc := range forecasts {
+			if fc.SaturationTime != 0 && fc.TimeToSaturation <= seconds {
+				filtered = append(filtered, fc)
+			}
+		}
+		forecasts = filtered
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, forecasts)
+}
+
+func (f *Forecaster) forecastGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	forecasts, err := f.Forecasts()
+	if err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id := mux.Vars(&r.Request)["id"]
+	for _, fc := range forecasts {
+		if fc.EdgeID == id {
+			shttp.WriteJSON(w, http.StatusOK, fc)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// RegisterEndpoints registers the endpoints returning the forecasts
+func (f *Forecaster) RegisterEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "ForecastIndex",
+			Method:      "GET",
+			Path:        "/api/forecast",
+			HandlerFunc: f.forecastsGet,
+		},
+		{
+			Name:        "ForecastGet",
+			Method:      "GET",
+			Path:        "/api/forecast/{id}",
+			HandlerFunc: f.forecastGet,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
+
+// NewForecaster returns a new forecaster of the edges whose trend is fitted
+// on the metrics of the history period, aggregated by bucket, a link being
+// saturated when its rate reaches the threshold ratio of its capacity
+func NewForecaster(g *graph.Graph, parser *traversal.GremlinTraversalParser, history, bucket time.Duration, threshold float64, minSamples int) *Forecaster {
+	return &Forecaster{
+		graph:         g,
+		gremlinParser: parser,
+		history:       history,
+		bucket:        bucket,
+		threshold:     threshold,
+		minSamples:    minSamples,
+	}
+}
+
+// NewForecasterFromConfig returns a new forecaster, nil if disabled by the
+// configuration
+func NewForecasterFromConfig(g *graph.Graph, parser *traversal.GremlinTraversalParser) *Forecaster {
+	if !config.GetBool("analyzer.forecast.enabled") {
+		return nil
+	}
+
+	return NewForecaster(g, parser,
+		time.Duration(config.GetInt("analyzer.forecast.history"))*time.Second,
+		time.Duration(config.GetInt("analyzer.forecast.bucket"))*time.Second,
+		config.GetConfig().GetFloat64("analyzer.forecast.threshold"),
+		config.GetInt("analyzer.forecast.min_samples"))
+}
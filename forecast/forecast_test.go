@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+package forecast
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func TestFit(t *testing.T) {
+	slope, intercept, r2 := fit([]sample{{0, 10}, {1, 12}, {2, 14}, {3, 16}})
+	if slope != 2 || intercept != 10 || r2 != 1 {
+		t.Errorf("Expected a perfect fit of slope 2 and intercept 10, got %f, %f, %f", slope, intercept, r2)
+	}
+}
+
+func TestForecast(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AnalyzerService)
+
+	g.Lock()
+	n1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Speed": int64(1000)})
+	n2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth1", "Speed": int64(100)})
+	e, _ := topology.AddLayer2Link(g, n1, n2, nil)
+	g.Unlock()
+
+	f := NewForecaster(g, nil, 24*time.Hour, time.Hour, 0.9, 6)
+
+	// 10 Mbit/s growing by 1 Mbit/s per hour, 2 metrics per hour
+	start := common.UnixMillis(time.Now().Add(-24 * time.Hour).Truncate(time.Hour))
+	var metrics []common.Metric
+	for i := int64(0); i < 48; i++ {
+		rate := 10000000 + (i/2)*1000000
+		metrics = append(metrics, &topology.EdgeMetric{
+			Bytes: rate / 8 * 1800,
+			Start: start + i*1800000,
+			Last:  start + (i+1)*1800000,
+		})
+	}
+
+	g.RLock()
+	fc := f.forecast(string(e.ID), metrics)
+	g.RUnlock()
+
+	if fc == nil {
+		t.Fatal("Expected a forecast")
+	}
+
+	if fc.Capacity != 100000000 || fc.Samples != 24 {
+		t.Errorf("Expected a capacity of 100 Mbit/s and 24 samples, got %+v", fc)
+	}
+
+	if math.Abs(fc.Trend-24000000) > 1 || fc.Fit < 0.99 {
+		t.Errorf("Expected a trend of 24 Mbit/s per day, got %+v", fc)
+	}
+
+	// 90 Mbit/s reached after 80 hours from the first sample
+	expected := start + 80*3600000 + 1800000
+	if fc.SaturationTime < expected-1000 || fc.SaturationTime > expected+1000 {
+		t.Errorf("Expected saturation at %d, got %+v", expected, fc)
+	}
+
+	if fc.TimeToSaturation != (fc.SaturationTime-fc.Last)/1000 {
+		t.Errorf("Inconsistent time to saturation %+v", fc)
+	}
+
+	// not enough samples
+	g.RLock()
+	fc = f.forecast(string(e.ID), metrics[:4])
+	g.RUnlock()
+
+	if fc != nil {
+		t.Errorf("Expected no forecast, got %+v", fc)
+	}
+}
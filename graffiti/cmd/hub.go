@@ -109,7 +109,7 @@ var HubCmd = &cobra.Command{
 			PongTimeout:      time.Second * time.Duration(pongTimeout),
 		}
 
-		hub, err := hub.NewHub(httpServer, g, cached, authBackend, authBackend, nil, "/ws/pod", nil, serverOpts)
+		hub, err := hub.NewHub(httpServer, g, cached, authBackend, authBackend, nil, "/ws/pod", nil, serverOpts, 0)
 		if err != nil {
 			logging.GetLogger().Error(err)
 			os.Exit(1)
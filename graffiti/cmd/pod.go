@@ -129,7 +129,7 @@ var PodCmd = &cobra.Command{
 
 		clientPool := newHubClientPool(hostname, addresses, opts)
 
-		pod, err := pod.NewPod(apiServer, clientPool, g, authBackend, nil, tr, writeCompression, queueSize, time.Second*time.Duration(pingDelay), time.Second*time.Duration(pongTimeout))
+		pod, err := pod.NewPod(apiServer, clientPool, g, authBackend, nil, tr, writeCompression, queueSize, time.Second*time.Duration(pingDelay), time.Second*time.Duration(pongTimeout), nil, 0)
 		if err != nil {
 			logging.GetLogger().Error(err)
 			os.Exit(1)
@@ -0,0 +1,433 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/storage/clickhouse"
+)
+
+const (
+	clickHouseNodeTable = "nodes"
+	clickHouseEdgeTable = "edges"
+)
+
+// the revisions are archived by inserting them again with a newer version,
+// the replacing engine only keeping the latest one
+const clickHouseGraphTable = `CREATE TABLE IF NOT EXISTS %s (
+	ID String,
+	Host String,
+	Origin String,
+	CreatedAt Int64,
+	UpdatedAt Int64,
+	DeletedAt Nullable(Int64),
+	ArchivedAt Nullable(Int64),
+	Revision Int64,
+	Metadata String,
+	Parent String,
+	Child String,
+	Version UInt64
+) ENGINE = ReplacingMergeTree(Version)
+PARTITION BY toYYYYMM(toDateTime(intDiv(UpdatedAt, 1000)))
+ORDER BY (ID, Revision)`
+
+var clickHouseTimeColumns = clickhouse.Columns{
+	Types: map[string]string{
+		"CreatedAt":  "Int64",
+		"UpdatedAt":  "Int64",
+		"DeletedAt":  "Nullable(Int64)",
+		"ArchivedAt": "Nullable(Int64)",
+	},
+}
+
+var clickHouseMetadataColumns = clickhouse.Columns{JSON: "Metadata"}
+
+// ClickHouseBackend describes a ClickHouse backend
+type ClickHouseBackend struct {
+	Backend
+	client       clickhouse.ClientInterface
+	prevRevision map[Identifier]*clickHouseRow
+	election     common.MasterElection
+}
+
+// easyjson:json
+type clickHouseRow struct {
+	ID         string
+	Host       string
+	Origin     string
+	CreatedAt  int64
+	UpdatedAt  int64
+	DeletedAt  *int64
+	ArchivedAt *int64
+	Revision   int64
+	Metadata   string
+	Parent     string
+	Child      string
+	Version    int64
+}
+
+func graphElementToClickHouseRow(e *graphElement) (*clickHouseRow, error) {
+	data, err := json.Marshal(e.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("Error while adding graph element %s: %s", e.ID, err)
+	}
+
+	row := &clickHouseRow{
+		ID:        string(e.ID),
+		Host:      e.Host,
+		Origin:    e.Origin,
+		CreatedAt: e.CreatedAt.Unix(),
+		UpdatedAt: e.UpdatedAt.Unix(),
+		Metadata:  string(data),
+		Revision:  e.Revision,
+		Version:   time.Now().UnixNano(),
+	}
+
+	if !e.DeletedAt.IsZero() {
+		deletedAt := e.DeletedAt.Unix()
+		row.DeletedAt = &deletedAt
+	}
+
+	return row, nil
+}
+
+// element returns the JSON representation of the graph element of the row
+func (r *clickHouseRow) element() ([]byte, error) {
+	raw := &rawData{
+		ID:        r.ID,
+		Host:      r.Host,
+		Origin:    r.Origin,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+		Revision:  r.Revision,
+		Metadata:  json.RawMessage(r.Metadata),
+		Parent:    r.Parent,
+		Child:     r.Child,
+	}
+
+	if r.DeletedAt != nil {
+		raw.DeletedAt = *r.DeletedAt
+	}
+
+	return json.Marshal(raw)
+}
+
+func metadataToClickHouseExpression(m ElementMatcher) string {
+	if m == nil {
+		return ""
+	}
+
+	filter, err := m.Filter()
+	if err != nil {
+		return ""
+	}
+
+	return clickhouse.FilterToExpression(filter, clickHouseMetadataColumns)
+}
+
+func timeToClickHouseExpression(t Context) string {
+	return clickhouse.FilterToExpression(getTimeFilter(t.TimeSlice), clickHouseTimeColumns)
+}
+
+func (c *ClickHouseBackend) insert(table string, row *clickHouseRow) error {
+	if err := c.client.BulkInsert(table, row); err != nil {
+		return fmt.Errorf("Error while adding %s: %s", row.ID, err)
+	}
+	c.prevRevision[Identifier(row.ID)] = row
+	return nil
+}
+
+func (c *ClickHouseBackend) archive(table string, id Identifier, at Time, deleted bool) error {
+	prev := c.prevRevision[id]
+	if prev == nil {
+		return fmt.Errorf("Unable to archive an unknown graph element: %s", id)
+	}
+
+	row := *prev
+	archivedAt := at.Unix()
+	row.ArchivedAt = &archivedAt
+	if deleted {
+		row.DeletedAt = &archivedAt
+	}
+	row.Version = time.Now().UnixNano()
+
+	if err := c.client.BulkInsert(table, &row); err != nil {
+		return fmt.Errorf("Error while archiving %s: %s", id, err)
+	}
+	return nil
+}
+
+func (c *ClickHouseBackend) search(table string, t Context, where string) (elements []json.RawMessage) {
+	query := fmt.Sprintf("SELECT * FROM %s FINAL WHERE %s", table, where)
+	if !t.TimePoint {
+		query += " ORDER BY UpdatedAt"
+	}
+
+	rows, err := c.client.Query(query)
+	if err != nil {
+		logging.GetLogger().Errorf("Error while retrieving graph elements: %s", err)
+		return nil
+	}
+
+	for _, data := range rows {
+		var row clickHouseRow
+		if err := json.Unmarshal(data, &row); err != nil {
+			logging.GetLogger().Errorf("Error while parsing graph element: %s, %s", err, string(data))
+			continue
+		}
+
+		element, err := row.element()
+		if err != nil {
+			logging.GetLogger().Errorf("Error while parsing graph element: %s, %s", err, string(data))
+			continue
+		}
+		elements = append(elements, element)
+	}
+
+	return
+}
+
+func (c *ClickHouseBackend) searchNodes(t Context, where string) (nodes []*Node) {
+	for _, data := range c.search(clickHouseNodeTable, t, where) {
+		var node Node
+		if err := json.Unmarshal(data, &node); err != nil {
+			logging.GetLogger().Errorf("Error while parsing node: %s, %s", err, string(data))
+			continue
+		}
+		nodes = append(nodes, &node)
+	}
+
+	if len(nodes) > 1 && t.TimePoint {
+		nodes = dedupNodes(nodes)
+	}
+
+	return
+}
+
+func (c *ClickHouseBackend) searchEdges(t Context, where string) (edges []*Edge) {
+	for _, data := range c.search(clickHouseEdgeTable, t, where) {
+		var edge Edge
+		if err := json.Unmarshal(data, &edge); err != nil {
+			logging.GetLogger().Errorf("Error while parsing edge: %s, %s", err, string(data))
+			continue
+		}
+		edges = append(edges, &edge)
+	}
+
+	if len(edges) > 1 && t.TimePoint {
+		edges = dedupEdges(edges)
+	}
+
+	return
+}
+
+func (c *ClickHouseBackend) indexNode(n *Node) error {
+	row, err := graphElementToClickHouseRow(&n.graphElement)
+	if err != nil {
+		return err
+	}
+	return c.insert(clickHouseNodeTable, row)
+}
+
+func (c *ClickHouseBackend) indexEdge(e *Edge) error {
+	row, err := graphElementToClickHouseRow(&e.graphElement)
+	if err != nil {
+		return err
+	}
+	row.Parent, row.Child = string(e.Parent), string(e.Child)
+	return c.insert(clickHouseEdgeTable, row)
+}
+
+// NodeAdded add a node in the database
+func (c *ClickHouseBackend) NodeAdded(n *Node) error {
+	return c.indexNode(n)
+}
+
+// NodeDeleted delete a node in the database
+func (c *ClickHouseBackend) NodeDeleted(n *Node) error {
+	err := c.archive(clickHouseNodeTable, n.ID, n.DeletedAt, true)
+	delete(c.prevRevision, n.ID)
+	return err
+}
+
+// GetNode get a node within a time slice
+func (c *ClickHouseBackend) GetNode(i Identifier, t Context) []*Node {
+	query := timeToClickHouseExpression(t)
+	query += fmt.Sprintf(" AND ID = %s", clickhouse.Quote(string(i)))
+	if t.TimePoint {
+		query += " ORDER BY Revision DESC LIMIT 1"
+	}
+	return c.searchNodes(t, query)
+}
+
+// GetNodeEdges returns a list of a node edges within time slice
+func (c *ClickHouseBackend) GetNodeEdges(n *Node, t Context, m ElementMatcher) []*Edge {
+	id := clickhouse.Quote(string(n.ID))
+	query := timeToClickHouseExpression(t)
+	query += fmt.Sprintf(" AND (Parent = %s OR Child = %s)", id, id)
+	if metadataQuery := metadataToClickHouseExpression(m); metadataQuery != "" {
+		query += " AND " + metadataQuery
+	}
+	return c.searchEdges(t, query)
+}
+
+// EdgeAdded add an edge in the database
+func (c *ClickHouseBackend) EdgeAdded(e *Edge) error {
+	return c.indexEdge(e)
+}
+
+// EdgeDeleted delete an edge in the database
+func (c *ClickHouseBackend) EdgeDeleted(e *Edge) error {
+	err := c.archive(clickHouseEdgeTable, e.ID, e.DeletedAt, true)
+	delete(c.prevRevision, e.ID)
+	return err
+}
+
+// GetEdge get an edge within a time slice
+func (c *ClickHouseBackend) GetEdge(i Identifier, t Context) []*Edge {
+	query := timeToClickHouseExpression(t)
+	query += fmt.Sprintf(" AND ID = %s", clickhouse.Quote(string(i)))
+	if t.TimePoint {
+		query += " ORDER BY Revision DESC LIMIT 1"
+	}
+	return c.searchEdges(t, query)
+}
+
+// GetEdgeNodes returns the parents and child nodes of an edge within time slice, matching metadata
+func (c *ClickHouseBackend) GetEdgeNodes(e *Edge, t Context, parentMetadata, childMetadata ElementMatcher) (parents []*Node, children []*Node) {
+	query := timeToClickHouseExpression(t)
+	query += fmt.Sprintf(" AND ID IN (%s, %s)", clickhouse.Quote(string(e.Parent)), clickhouse.Quote(string(e.Child)))
+
+	for _, node := range c.searchNodes(t, query) {
+		if node.ID == e.Parent && node.MatchMetadata(parentMetadata) {
+			parents = append(parents, node)
+		} else if node.MatchMetadata(childMetadata) {
+			children = append(children, node)
+		}
+	}
+
+	return
+}
+
+// MetadataUpdated archives the previous revision and adds the new one
+func (c *ClickHouseBackend) MetadataUpdated(i interface{}) error {
+	switch i := i.(type) {
+	case *Node:
+		if err := c.archive(clickHouseNodeTable, i.ID, i.UpdatedAt, false); err != nil {
+			return err
+		}
+		return c.indexNode(i)
+	case *Edge:
+		if err := c.archive(clickHouseEdgeTable, i.ID, i.UpdatedAt, false); err != nil {
+			return err
+		}
+		return c.indexEdge(i)
+	}
+
+	return nil
+}
+
+// GetNodes returns a list of nodes within time slice, matching metadata
+func (c *ClickHouseBackend) GetNodes(t Context, m ElementMatcher) []*Node {
+	query := timeToClickHouseExpression(t)
+	if metadataQuery := metadataToClickHouseExpression(m); metadataQuery != "" {
+		query += " AND " + metadataQuery
+	}
+	return c.searchNodes(t, query)
+}
+
+// GetEdges returns a list of edges within time slice, matching metadata
+func (c *ClickHouseBackend) GetEdges(t Context, m ElementMatcher) []*Edge {
+	query := timeToClickHouseExpression(t)
+	if metadataQuery := metadataToClickHouseExpression(m); metadataQuery != "" {
+		query += " AND " + metadataQuery
+	}
+	return c.searchEdges(t, query)
+}
+
+// IsHistorySupported returns that this backend does support history
+func (c *ClickHouseBackend) IsHistorySupported() bool {
+	return true
+}
+
+func (c *ClickHouseBackend) flushGraph() error {
+	logging.GetLogger().Info("Flush graph elements")
+
+	now := TimeUTC().Unix()
+	for _, table := range []string{clickHouseNodeTable, clickHouseEdgeTable} {
+		query := fmt.Sprintf("ALTER TABLE %s UPDATE DeletedAt = ifNull(DeletedAt, %d), ArchivedAt = %d WHERE isNull(ArchivedAt)", table, now, now)
+		if err := c.client.Exec(query); err != nil {
+			return fmt.Errorf("Error while flushing graph: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// OnStarted implements storage client listener interface
+func (c *ClickHouseBackend) OnStarted() {
+	for _, table := range []string{clickHouseNodeTable, clickHouseEdgeTable} {
+		// only the archived revisions expire
+		query := fmt.Sprintf(clickHouseGraphTable, table) + c.client.TTL("assumeNotNull(ArchivedAt)", "isNotNull(ArchivedAt)")
+		if err := c.client.Exec(query); err != nil {
+			logging.GetLogger().Errorf("Failed to create ClickHouse table %s: %s", table, err)
+		}
+	}
+
+	if c.election != nil && c.election.IsMaster() {
+		if err := c.flushGraph(); err != nil {
+			logging.GetLogger().Error(err)
+		}
+	}
+}
+
+// NewClickHouseBackendFromClient creates a new graph backend using the given ClickHouse client
+func NewClickHouseBackendFromClient(client clickhouse.ClientInterface, electionService common.MasterElectionService) (*ClickHouseBackend, error) {
+	c := &ClickHouseBackend{
+		client:       client,
+		prevRevision: make(map[Identifier]*clickHouseRow),
+	}
+
+	if electionService != nil {
+		c.election = electionService.NewElection("clickhouse-graph-flush")
+		c.election.StartAndWait()
+	}
+
+	client.AddEventListener(c)
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	client.Start()
+
+	return c, nil
+}
+
+// NewClickHouseBackendFromConfig creates a new graph backend from a ClickHouse configuration
+func NewClickHouseBackendFromConfig(cfg clickhouse.Config, electionService common.MasterElectionService) (*ClickHouseBackend, error) {
+	client, err := clickhouse.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClickHouseBackendFromClient(client, electionService)
+}
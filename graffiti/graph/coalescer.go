@@ -0,0 +1,189 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+type metadataOp struct {
+	key     string
+	value   interface{}
+	deleted bool
+}
+
+type coalescedNode struct {
+	timer *time.Timer
+	ops   []metadataOp
+}
+
+// MetadataCoalescer batches the metadata updates of the nodes. The first
+// update of a node is applied right away, the following ones being queued
+// and applied at once at the end of the interval, so that a node is updated
+// at most once per interval whatever the rate of the updates.
+type MetadataCoalescer struct {
+	sync.Mutex
+	graph    *Graph
+	interval time.Duration
+	nodes    map[Identifier]*coalescedNode
+	stopped  bool
+}
+
+// queue replaces the pending operations overridden by op and appends it
+func (cn *coalescedNode) queue(op metadataOp) {
+	ops := cn.ops[:0]
+	for _, o := range cn.ops {
+		if o.key != op.key && !strings.HasPrefix(o.key, op.key+".") {
+			ops = append(ops, o)
+		}
+	}
+	cn.ops = append(ops, op)
+}
+
+func (c *MetadataCoalescer) update(n *Node, op metadataOp) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.interval <= 0 || c.stopped {
+		return c.graph.applyMetadataOps(n, []metadataOp{op})
+	}
+
+	if cn, found := c.nodes[n.ID]; found {
+		cn.queue(op)
+		return nil
+	}
+
+	id := n.ID
+	c.nodes[id] = &coalescedNode{timer: time.AfterFunc(c.interval, func() { c.flush(id) })}
+	return c.graph.applyMetadataOps(n, []metadataOp{op})
+}
+
+// flush applies the operations queued for a node during the last interval,
+// a new interval starting if there were any
+func (c *MetadataCoalescer) flush(id Identifier) {
+	c.graph.Lock()
+	defer c.graph.Unlock()
+
+	c.Lock()
+	defer c.Unlock()
+
+	cn, found := c.nodes[id]
+	if !found {
+		return
+	}
+
+	if len(cn.ops) == 0 || c.stopped {
+		delete(c.nodes, id)
+		return
+	}
+
+	if n := c.graph.GetNode(id); n != nil {
+		c.graph.applyMetadataOps(n, cn.ops)
+	}
+	cn.ops = nil
+	cn.timer.Reset(c.interval)
+}
+
+// AddMetadata sets the metadata k of a node, the graph lock being held
+func (c *MetadataCoalescer) AddMetadata(n *Node, k string, v interface{}) error {
+	return c.update(n, metadataOp{key: k, value: v})
+}
+
+// DelMetadata removes the metadata k of a node, the graph lock being held
+func (c *MetadataCoalescer) DelMetadata(n *Node, k string) error {
+	return c.update(n, metadataOp{key: k, deleted: true})
+}
+
+// Flush applies all the pending updates, the graph lock being held
+func (c *MetadataCoalescer) Flush() {
+	c.Lock()
+	defer c.Unlock()
+
+	for id, cn := range c.nodes {
+		if len(cn.ops) > 0 {
+			if n := c.graph.GetNode(id); n != nil {
+				c.graph.applyMetadataOps(n, cn.ops)
+			}
+			cn.ops = nil
+		}
+	}
+}
+
+// Stop applies the pending updates and stops coalescing them, the following
+// updates being applied right away
+func (c *MetadataCoalescer) Stop() {
+	c.graph.Lock()
+	c.Flush()
+	c.graph.Unlock()
+
+	c.Lock()
+	for id, cn := range c.nodes {
+		cn.timer.Stop()
+		delete(c.nodes, id)
+	}
+	c.stopped = true
+	c.Unlock()
+}
+
+// NewMetadataCoalescer returns a coalescer applying the metadata updates of
+// a node at most once per interval, the updates being applied right away if
+// the interval is not positive
+func NewMetadataCoalescer(g *Graph, interval time.Duration) *MetadataCoalescer {
+	return &MetadataCoalescer{
+		graph:    g,
+		interval: interval,
+		nodes:    make(map[Identifier]*coalescedNode),
+	}
+}
+
+// applyMetadataOps applies a list of metadata operations to a node as a
+// single update
+func (g *Graph) applyMetadataOps(n *Node, ops []metadataOp) error {
+	e := &n.graphElement
+
+	var updated bool
+	for _, op := range ops {
+		if op.deleted {
+			updated = common.DelField(e.Metadata, op.key) || updated
+			continue
+		}
+
+		if o, ok := e.Metadata[op.key]; ok && reflect.DeepEqual(o, op.value) {
+			continue
+		}
+		updated = e.Metadata.SetField(op.key, op.value) || updated
+	}
+	if !updated {
+		return nil
+	}
+
+	e.UpdatedAt = TimeUTC()
+	e.Revision++
+
+	if err := g.backend.MetadataUpdated(n); err != nil {
+		return err
+	}
+
+	g.eventHandler.NotifyEvent(NodeUpdated, n)
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type updateCounter struct {
+	DefaultGraphListener
+	updates int64
+}
+
+func (c *updateCounter) OnNodeUpdated(n *Node) {
+	atomic.AddInt64(&c.updates, 1)
+}
+
+func TestMetadataCoalescer(t *testing.T) {
+	g := newGraph(t)
+
+	g.Lock()
+	n, _ := g.NewNode(GenID(), Metadata{"Type": "intf", "Contrail": map[string]interface{}{"Routes": 0}})
+	g.Unlock()
+
+	counter := &updateCounter{}
+	g.AddEventListener(counter)
+
+	c := NewMetadataCoalescer(g, 100*time.Millisecond)
+
+	g.Lock()
+	for i := 1; i <= 10; i++ {
+		c.AddMetadata(n, "Contrail.Routes", i)
+	}
+	c.AddMetadata(n, "Summary", true)
+	c.DelMetadata(n, "Summary")
+	g.Unlock()
+
+	// the first update is applied right away
+	if updates := atomic.LoadInt64(&counter.updates); updates != 1 {
+		t.Errorf("Expected a single update, got %d", updates)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	// the others at the end of the interval, at once
+	if updates := atomic.LoadInt64(&counter.updates); updates != 2 {
+		t.Errorf("Expected 2 updates, got %d", updates)
+	}
+
+	g.RLock()
+	if v, _ := n.GetFieldInt64("Contrail.Routes"); v != 10 {
+		t.Errorf("Expected the last value to be applied, got %d", v)
+	}
+	if _, err := n.GetField("Summary"); err == nil {
+		t.Error("Expected the deleted metadata to be removed")
+	}
+	g.RUnlock()
+
+	c.Stop()
+
+	g.Lock()
+	c.AddMetadata(n, "Contrail.Routes", 11)
+	c.AddMetadata(n, "Contrail.Routes", 12)
+	g.Unlock()
+
+	if updates := atomic.LoadInt64(&counter.updates); updates != 4 {
+		t.Errorf("Expected the updates to be applied right away once stopped, got %d", updates)
+	}
+}
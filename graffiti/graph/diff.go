@@ -0,0 +1,312 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffOptions describes how two sets of graph elements are compared
+type DiffOptions struct {
+	// Fields restricts the comparison to the given metadata, all the
+	// metadata are compared when empty
+	Fields []string `json:"Fields,omitempty"`
+	// Ignore lists the metadata not compared, such as metrics
+	Ignore []string `json:"Ignore,omitempty"`
+	// MatchBy lists the metadata identifying a node in both sets, allowing
+	// to compare graphs whose identifiers differ. Nodes are matched by ID
+	// when empty.
+	MatchBy []string `json:"MatchBy,omitempty"`
+}
+
+// MetadataChange describes a metadata whose value differs
+type MetadataChange struct {
+	Key  string
+	From interface{}
+	To   interface{}
+}
+
+// NodeChange describes a node present in both sets with different metadata
+type NodeChange struct {
+	Key     string
+	From    *Node
+	To      *Node
+	Changes []MetadataChange
+}
+
+// EdgeChange describes an edge present in both sets with different metadata
+type EdgeChange struct {
+	Key     string
+	From    *Edge
+	To      *Edge
+	Changes []MetadataChange
+}
+
+// ElementsDiff describes the differences between two sets of graph elements
+type ElementsDiff struct {
+	AddedNodes    []*Node
+	RemovedNodes  []*Node
+	ModifiedNodes []*NodeChange
+	AddedEdges    []*Edge
+	RemovedEdges  []*Edge
+	ModifiedEdges []*EdgeChange
+}
+
+// IsEmpty returns whether no difference was found
+func (d *ElementsDiff) IsEmpty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.ModifiedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.ModifiedEdges) == 0
+}
+
+// flattenMetadata returns the leaf values of the metadata indexed by their
+// dotted keys. The metadata are normalized through JSON so that decoded and
+// raw metadata can be compared.
+func flattenMetadata(m Metadata) (map[string]interface{}, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{})
+
+	var flatten func(prefix string, obj map[string]interface{})
+	flatten = func(prefix string, obj map[string]interface{}) {
+		for k, v := range obj {
+			key := prefix + k
+			if sub, ok := v.(map[string]interface{}); ok && len(sub) > 0 {
+				flatten(key+".", sub)
+			} else {
+				values[key] = v
+			}
+		}
+	}
+	flatten("", raw)
+
+	return values, nil
+}
+
+// keyMatches returns whether a dotted key is one of the given keys or one
+// of their children
+func keyMatches(key string, keys []string) bool {
+	for _, k := range keys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *DiffOptions) compared(key string) bool {
+	if len(o.Fields) > 0 && !keyMatches(key, o.Fields) {
+		return false
+	}
+	return !keyMatches(key, o.Ignore)
+}
+
+func (o *DiffOptions) metadataChanges(from, to Metadata) ([]MetadataChange, error) {
+	fromValues, err := flattenMetadata(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toValues, err := flattenMetadata(to)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for k := range fromValues {
+		keys[k] = true
+	}
+	for k := range toValues {
+		keys[k] = true
+	}
+
+	var changes []MetadataChange
+	for k := range keys {
+		if !o.compared(k) {
+			continue
+		}
+
+		fromValue, toValue := fromValues[k], toValues[k]
+		if !reflect.DeepEqual(fromValue, toValue) {
+			changes = append(changes, MetadataChange{Key: k, From: fromValue, To: toValue})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes, nil
+}
+
+// nodeKey returns the key identifying a node in both sets
+func (o *DiffOptions) nodeKey(n *Node) string {
+	if len(o.MatchBy) == 0 {
+		return string(n.ID)
+	}
+
+	var values []string
+	found := false
+	for _, field := range o.MatchBy {
+		if value, err := n.GetField(field); err == nil {
+			values = append(values, fmt.Sprintf("%v", value))
+			found = true
+		} else {
+			values = append(values, "")
+		}
+	}
+
+	// the node can't be identified by its metadata
+	if !found {
+		return string(n.ID)
+	}
+
+	return strings.Join(values, "/")
+}
+
+// edgeKey returns the key identifying an edge in both sets, edges being
+// identified by their nodes and relation type when nodes are matched by
+// metadata
+func (o *DiffOptions) edgeKey(e *Edge, nodeKeys map[Identifier]string) string {
+	if len(o.MatchBy) == 0 {
+		return string(e.ID)
+	}
+
+	parent, ok := nodeKeys[e.Parent]
+	if !ok {
+		parent = string(e.Parent)
+	}
+
+	child, ok := nodeKeys[e.Child]
+	if !ok {
+		child = string(e.Child)
+	}
+
+	relationType, _ := e.GetFieldString("RelationType")
+	return parent + " -" + relationType + "-> " + child
+}
+
+func (o *DiffOptions) indexNodes(nodes []*Node) (map[string]*Node, map[Identifier]string) {
+	byKey := make(map[string]*Node, len(nodes))
+	keys := make(map[Identifier]string, len(nodes))
+	for _, n := range nodes {
+		key := o.nodeKey(n)
+		keys[n.ID] = key
+		if _, found := byKey[key]; !found {
+			byKey[key] = n
+		}
+	}
+	return byKey, keys
+}
+
+func (o *DiffOptions) indexEdges(edges []*Edge, nodeKeys map[Identifier]string) map[string]*Edge {
+	byKey := make(map[string]*Edge, len(edges))
+	for _, e := range edges {
+		key := o.edgeKey(e, nodeKeys)
+		if _, found := byKey[key]; !found {
+			byKey[key] = e
+		}
+	}
+	return byKey
+}
+
+func sortedKeys(keys map[string]bool) []string {
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// DiffElements compares two sets of graph elements, from being the
+// reference. The elements must not be modified during the comparison.
+func DiffElements(from, to *Elements, opts DiffOptions) (*ElementsDiff, error) {
+	diff := &ElementsDiff{}
+
+	fromNodes, fromNodeKeys := opts.indexNodes(from.Nodes)
+	toNodes, toNodeKeys := opts.indexNodes(to.Nodes)
+
+	keys := make(map[string]bool)
+	for k := range fromNodes {
+		keys[k] = true
+	}
+	for k := range toNodes {
+		keys[k] = true
+	}
+
+	for _, k := range sortedKeys(keys) {
+		fromNode, toNode := fromNodes[k], toNodes[k]
+		switch {
+		case fromNode == nil:
+			diff.AddedNodes = append(diff.AddedNodes, toNode)
+		case toNode == nil:
+			diff.RemovedNodes = append(diff.RemovedNodes, fromNode)
+		default:
+			changes, err := opts.metadataChanges(fromNode.Metadata, toNode.Metadata)
+			if err != nil {
+				return nil, err
+			}
+			if len(changes) > 0 {
+				diff.ModifiedNodes = append(diff.ModifiedNodes, &NodeChange{Key: k, From: fromNode, To: toNode, Changes: changes})
+			}
+		}
+	}
+
+	fromEdges := opts.indexEdges(from.Edges, fromNodeKeys)
+	toEdges := opts.indexEdges(to.Edges, toNodeKeys)
+
+	keys = make(map[string]bool)
+	for k := range fromEdges {
+		keys[k] = true
+	}
+	for k := range toEdges {
+		keys[k] = true
+	}
+
+	for _, k := range sortedKeys(keys) {
+		fromEdge, toEdge := fromEdges[k], toEdges[k]
+		switch {
+		case fromEdge == nil:
+			diff.AddedEdges = append(diff.AddedEdges, toEdge)
+		case toEdge == nil:
+			diff.RemovedEdges = append(diff.RemovedEdges, fromEdge)
+		default:
+			changes, err := opts.metadataChanges(fromEdge.Metadata, toEdge.Metadata)
+			if err != nil {
+				return nil, err
+			}
+			if len(changes) > 0 {
+				diff.ModifiedEdges = append(diff.ModifiedEdges, &EdgeChange{Key: k, From: fromEdge, To: toEdge, Changes: changes})
+			}
+		}
+	}
+
+	return diff, nil
+}
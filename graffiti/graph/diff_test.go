@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"testing"
+)
+
+func TestDiffElements(t *testing.T) {
+	g1 := newGraph(t)
+	host1, _ := g1.NewNode(GenID(), Metadata{"Name": "host", "Type": "host"})
+	eth1, _ := g1.NewNode(GenID(), Metadata{"Name": "eth0", "Type": "device", "MTU": 1500, "Metric": Metadata{"RxBytes": 10}})
+	g1.NewNode(GenID(), Metadata{"Name": "eth1", "Type": "device"})
+	g1.Link(host1, eth1, Metadata{"RelationType": "ownership"})
+
+	g2 := newGraph(t)
+	host2, _ := g2.NewNode(GenID(), Metadata{"Name": "host", "Type": "host"})
+	eth2, _ := g2.NewNode(GenID(), Metadata{"Name": "eth0", "Type": "device", "MTU": 9000, "Metric": Metadata{"RxBytes": 20}})
+	br, _ := g2.NewNode(GenID(), Metadata{"Name": "br0", "Type": "bridge"})
+	g2.Link(host2, eth2, Metadata{"RelationType": "ownership"})
+	g2.Link(host2, br, Metadata{"RelationType": "ownership"})
+
+	opts := DiffOptions{MatchBy: []string{"Type", "Name"}, Ignore: []string{"Metric"}}
+	diff, err := DiffElements(g1.Elements(), g2.Elements(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.AddedNodes) != 1 || diff.AddedNodes[0] != br {
+		t.Errorf("Expected br0 to be added, got %+v", diff.AddedNodes)
+	}
+
+	if len(diff.RemovedNodes) != 1 {
+		t.Errorf("Expected eth1 to be removed, got %+v", diff.RemovedNodes)
+	}
+
+	if len(diff.ModifiedNodes) != 1 || len(diff.ModifiedNodes[0].Changes) != 1 {
+		t.Fatalf("Expected only the MTU of eth0 to be modified, got %+v", diff.ModifiedNodes)
+	}
+
+	if change := diff.ModifiedNodes[0].Changes[0]; change.Key != "MTU" || change.From != float64(1500) || change.To != float64(9000) {
+		t.Errorf("Wrong change: %+v", change)
+	}
+
+	if len(diff.AddedEdges) != 1 || len(diff.RemovedEdges) != 0 || len(diff.ModifiedEdges) != 0 {
+		t.Errorf("Expected only one added edge, got %+v", diff)
+	}
+
+	// nodes are matched by identifiers by default
+	if diff, _ = DiffElements(g1.Elements(), g2.Elements(), DiffOptions{}); len(diff.AddedNodes) != 3 || len(diff.RemovedNodes) != 3 {
+		t.Errorf("Nodes shouldn't be matched, got %+v", diff)
+	}
+
+	if diff, _ = DiffElements(g1.Elements(), g1.Elements(), opts); !diff.IsEmpty() {
+		t.Errorf("Expected no difference, got %+v", diff)
+	}
+}
@@ -89,6 +89,24 @@ const graphElementMapping = `
 					"format": "epoch_millis"
 				}
 			}
+		},
+		{
+			"metricstart": {
+				"path_match": "*Metric.Start",
+				"mapping": {
+					"type": "date",
+					"format": "epoch_millis"
+				}
+			}
+		},
+		{
+			"metriclast": {
+				"path_match": "*Metric.Last",
+				"mapping": {
+					"type": "date",
+					"format": "epoch_millis"
+				}
+			}
 		}
 	]
 }
@@ -99,17 +117,24 @@ const (
 	edgeType = "edge"
 )
 
+// graphElementMigrations lists the changes of graphElementMapping
+var graphElementMigrations = []es.MappingMigration{
+	{Version: 2, Description: "map the metadata metrics times as dates"},
+}
+
 var topologyLiveIndex = es.Index{
-	Name:    "topology_live",
-	Type:    "graph_element",
-	Mapping: graphElementMapping,
+	Name:       "topology_live",
+	Type:       "graph_element",
+	Mapping:    graphElementMapping,
+	Migrations: graphElementMigrations,
 }
 
 var topologyArchiveIndex = es.Index{
-	Name:      "topology_archive",
-	Type:      "graph_element",
-	Mapping:   graphElementMapping,
-	RollIndex: true,
+	Name:       "topology_archive",
+	Type:       "graph_element",
+	Mapping:    graphElementMapping,
+	RollIndex:  true,
+	Migrations: graphElementMigrations,
 }
 
 // ElasticSearchBackend describes a persistent backend based on ElasticSearch
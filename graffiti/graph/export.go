@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// ExportFilter selects the nodes and the metadata of a graph sent to a remote
+// graph, for instance to reduce the bandwidth used by specialized consumers.
+// Edges are exported when both their nodes are exported.
+type ExportFilter struct {
+	nodes   []map[string]string
+	include []string
+	exclude []string
+}
+
+// parseNodeSelector parses a node selector using the "Key=Value,Key=Value"
+// syntax, a node matching the selector when all the values match
+func parseNodeSelector(s string) (map[string]string, error) {
+	selector := make(map[string]string)
+	for _, term := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(term), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid node selector '%s', expected Key=Value", s)
+		}
+		selector[kv[0]] = kv[1]
+	}
+	return selector, nil
+}
+
+// IsEmpty returns whether the filter exports the whole graph
+func (f *ExportFilter) IsEmpty() bool {
+	return len(f.nodes) == 0 && !f.FiltersMetadata()
+}
+
+// FiltersMetadata returns whether the metadata of the exported elements
+// differ from the ones of the graph
+func (f *ExportFilter) FiltersMetadata() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0
+}
+
+// MatchNode returns whether the node is exported
+func (f *ExportFilter) MatchNode(n *Node) bool {
+	if len(f.nodes) == 0 {
+		return true
+	}
+
+	for _, selector := range f.nodes {
+		matched := true
+		for k, v := range selector {
+			value, err := n.GetField(k)
+			if err != nil || fmt.Sprintf("%v", value) != v {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeField removes a dotted key from the metadata, the intermediate maps
+// being copied so that the original metadata are left untouched
+func removeField(m map[string]interface{}, key string) {
+	components := strings.SplitN(key, ".", 2)
+	value, found := m[components[0]]
+	if !found {
+		return
+	}
+
+	if len(components) == 1 {
+		delete(m, key)
+		return
+	}
+
+	var sub map[string]interface{}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		sub = value
+	case Metadata:
+		sub = value
+	default:
+		return
+	}
+
+	copied := make(map[string]interface{}, len(sub))
+	for k, v := range sub {
+		copied[k] = v
+	}
+	removeField(copied, components[1])
+
+	if len(copied) == 0 {
+		delete(m, components[0])
+	} else {
+		m[components[0]] = copied
+	}
+}
+
+// Metadata returns the exported metadata
+func (f *ExportFilter) Metadata(m Metadata) Metadata {
+	if !f.FiltersMetadata() {
+		return m
+	}
+
+	exported := make(Metadata)
+	if len(f.include) > 0 {
+		for _, key := range f.include {
+			if value, err := common.GetField(m, key); err == nil {
+				common.SetField(exported, key, value)
+			}
+		}
+	} else {
+		for k, v := range m {
+			exported[k] = v
+		}
+	}
+
+	for _, key := range f.exclude {
+		removeField(exported, key)
+	}
+
+	return exported
+}
+
+// Node returns the node as exported, a copy being returned when the metadata
+// are filtered
+func (f *ExportFilter) Node(n *Node) *Node {
+	if !f.FiltersMetadata() {
+		return n
+	}
+
+	exported := *n
+	exported.Metadata = f.Metadata(n.Metadata)
+	return &exported
+}
+
+// Edge returns the edge as exported, a copy being returned when the metadata
+// are filtered
+func (f *ExportFilter) Edge(e *Edge) *Edge {
+	if !f.FiltersMetadata() {
+		return e
+	}
+
+	exported := *e
+	exported.Metadata = f.Metadata(e.Metadata)
+	return &exported
+}
+
+// Elements returns the exported elements
+func (f *ExportFilter) Elements(elements *Elements) *Elements {
+	exported := &Elements{}
+
+	nodes := make(map[Identifier]bool)
+	for _, n := range elements.Nodes {
+		if f.MatchNode(n) {
+			nodes[n.ID] = true
+			exported.Nodes = append(exported.Nodes, f.Node(n))
+		}
+	}
+
+	for _, e := range elements.Edges {
+		if nodes[e.Parent] && nodes[e.Child] {
+			exported.Edges = append(exported.Edges, f.Edge(e))
+		}
+	}
+
+	return exported
+}
+
+// NewExportFilter returns a filter exporting the nodes matching one of the
+// node selectors, all the nodes being exported when no selector is given. The
+// exported metadata are restricted to the included keys, when given, minus
+// the excluded ones. Keys use the dotted notation.
+func NewExportFilter(nodes, include, exclude []string) (*ExportFilter, error) {
+	f := &ExportFilter{include: include, exclude: exclude}
+	for _, s := range nodes {
+		selector, err := parseNodeSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		f.nodes = append(f.nodes, selector)
+	}
+	return f, nil
+}
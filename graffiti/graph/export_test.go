@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+func TestExportFilterNodes(t *testing.T) {
+	g := newGraph(t)
+
+	host, _ := g.NewNode(GenID(), Metadata{"Name": "host", "Type": "host"})
+	pod, _ := g.NewNode(GenID(), Metadata{"Name": "pod", "Type": "pod", "Manager": "k8s"})
+	intf, _ := g.NewNode(GenID(), Metadata{"Name": "eth0", "Type": "device"})
+	g.NewEdge(GenID(), host, pod, Metadata{"RelationType": "ownership"})
+	g.NewEdge(GenID(), host, intf, Metadata{"RelationType": "ownership"})
+
+	filter, err := NewExportFilter([]string{"Type=host", "Manager=k8s,Type=pod"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !filter.MatchNode(host) || !filter.MatchNode(pod) || filter.MatchNode(intf) {
+		t.Error("Wrong node selection")
+	}
+
+	elements := filter.Elements(g.Elements())
+	if len(elements.Nodes) != 2 || len(elements.Edges) != 1 {
+		t.Errorf("Expected 2 nodes and 1 edge, got %+v", elements)
+	}
+
+	if _, err := NewExportFilter([]string{"Type"}, nil, nil); err == nil {
+		t.Error("Invalid node selector should be refused")
+	}
+}
+
+func TestExportFilterMetadata(t *testing.T) {
+	m := Metadata{
+		"Name":   "eth0",
+		"Metric": map[string]interface{}{"RxBytes": 1},
+		"Docker": map[string]interface{}{"ContainerName": "c1", "Labels": map[string]interface{}{"a": "b"}},
+	}
+
+	filter, _ := NewExportFilter(nil, nil, []string{"Metric", "Docker.Labels"})
+	expected := Metadata{
+		"Name":   "eth0",
+		"Docker": map[string]interface{}{"ContainerName": "c1"},
+	}
+	if exported := filter.Metadata(m); !reflect.DeepEqual(exported, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, exported)
+	}
+
+	if _, err := common.GetField(m, "Docker.Labels.a"); err != nil {
+		t.Error("Original metadata should be left untouched")
+	}
+
+	filter, _ = NewExportFilter(nil, []string{"Name", "Docker.ContainerName"}, nil)
+	if exported := filter.Metadata(m); !reflect.DeepEqual(exported, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, exported)
+	}
+}
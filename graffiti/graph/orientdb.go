@@ -25,6 +25,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/storage/migration"
 	"github.com/skydive-project/skydive/storage/orientdb"
 )
 
@@ -33,6 +34,7 @@ type OrientDBBackend struct {
 	Backend
 	client   orientdb.ClientInterface
 	election common.MasterElection
+	created  bool
 }
 
 type eventTime struct {
@@ -376,11 +378,13 @@ func newOrientDBBackend(client orientdb.ClientInterface, electionService common.
 			},
 			Indexes: []orientdb.Index{
 				{Name: "Node.TimeSpan", Fields: []string{"CreatedAt", "DeletedAt"}, Type: "NOTUNIQUE"},
+				{Name: "Node.ID", Fields: []string{"ID"}, Type: "NOTUNIQUE"},
 			},
 		}
 		if err := client.CreateDocumentClass(class); err != nil {
 			return nil, fmt.Errorf("Failed to register class Node: %s", err)
 		}
+		o.created = true
 	}
 
 	if _, err := client.GetDocumentClass("Link"); err != nil {
@@ -402,6 +406,7 @@ func newOrientDBBackend(client orientdb.ClientInterface, electionService common.
 			},
 			Indexes: []orientdb.Index{
 				{Name: "Link.TimeSpan", Fields: []string{"CreatedAt", "DeletedAt"}, Type: "NOTUNIQUE"},
+				{Name: "Link.ID", Fields: []string{"ID"}, Type: "NOTUNIQUE"},
 			},
 		}
 		if err := client.CreateDocumentClass(class); err != nil {
@@ -412,13 +417,64 @@ func newOrientDBBackend(client orientdb.ClientInterface, electionService common.
 	return o, nil
 }
 
+// migrations lists the changes of the Node and Link classes
+func (o *OrientDBBackend) migrations() []migration.Step {
+	return []migration.Step{
+		{
+			Version:     2,
+			Description: "index the nodes and links by ID",
+			Up: func() error {
+				if err := o.client.CreateIndex("Node", orientdb.Index{Name: "Node.ID", Fields: []string{"ID"}, Type: "NOTUNIQUE"}); err != nil {
+					return err
+				}
+				return o.client.CreateIndex("Link", orientdb.Index{Name: "Link.ID", Fields: []string{"ID"}, Type: "NOTUNIQUE"})
+			},
+			Down: func() error {
+				if _, err := o.client.SQL("DROP INDEX Node.ID"); err != nil {
+					return err
+				}
+				_, err := o.client.SQL("DROP INDEX Link.ID")
+				return err
+			},
+		},
+	}
+}
+
+// migrate upgrades the schema of the classes, the classes just created
+// being up to date
+func (o *OrientDBBackend) migrate(opts migration.Options) error {
+	store, err := orientdb.NewVersionStore(o.client)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := migration.NewMigrator("graph", store, o.migrations()...)
+	if err != nil {
+		return err
+	}
+
+	if o.created {
+		return migrator.Stamp()
+	}
+	return migrator.Migrate(opts)
+}
+
 // NewOrientDBBackend creates a new graph backend and
 // connect to an OrientDB instance
-func NewOrientDBBackend(addr string, database string, username string, password string, electionService common.MasterElectionService) (*OrientDBBackend, error) {
+func NewOrientDBBackend(addr string, database string, username string, password string, electionService common.MasterElectionService, migrationOpts migration.Options) (*OrientDBBackend, error) {
 	client, err := orientdb.NewClient(addr, database, username, password)
 	if err != nil {
 		return nil, err
 	}
 
-	return newOrientDBBackend(client, electionService)
+	o, err := newOrientDBBackend(client, electionService)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := o.migrate(migrationOpts); err != nil {
+		return nil, err
+	}
+
+	return o, nil
 }
@@ -0,0 +1,249 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Markers surrounding the matching parts of the highlighted values
+const (
+	HighlightPreTag  = "<em>"
+	HighlightPostTag = "</em>"
+)
+
+// Scores of a term matching a value
+const (
+	searchScoreContains = 1
+	searchScorePrefix   = 2
+	searchScoreExact    = 4
+)
+
+// SearchField describes a metadata field used by a full-text search, the
+// score of the matches on this field being multiplied by its boost
+type SearchField struct {
+	Name  string
+	Boost float64
+}
+
+// ParseSearchField parses a field definition using the "Name^Boost" syntax,
+// the boost being optional
+func ParseSearchField(s string) (SearchField, error) {
+	field := SearchField{Name: s, Boost: 1}
+	if i := strings.LastIndex(s, "^"); i != -1 {
+		boost, err := strconv.ParseFloat(s[i+1:], 64)
+		if err != nil || boost <= 0 {
+			return field, fmt.Errorf("Invalid boost for search field %s", s)
+		}
+		field.Name, field.Boost = s[:i], boost
+	}
+	if field.Name == "" {
+		return field, fmt.Errorf("Invalid search field %s", s)
+	}
+	return field, nil
+}
+
+// SearchMatch describes a value of a node matching a search
+type SearchMatch struct {
+	Field     string
+	Value     string
+	Highlight string
+}
+
+// SearchResult describes a node matching a search
+type SearchResult struct {
+	Node    *Node
+	Score   float64
+	Matches []SearchMatch
+}
+
+// fieldValues returns the string representations of a field, lists
+// returning one value per item
+func fieldValues(n *Node, name string) (values []string) {
+	value, err := n.GetField(name)
+	if err != nil {
+		return nil
+	}
+
+	var add func(v interface{})
+	add = func(v interface{}) {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			values = append(values, v)
+		case []string:
+			values = append(values, v...)
+		case []interface{}:
+			for _, item := range v {
+				add(item)
+			}
+		case map[string]interface{}, Metadata:
+		case fmt.Stringer:
+			values = append(values, v.String())
+		default:
+			values = append(values, fmt.Sprintf("%v", v))
+		}
+	}
+	add(value)
+
+	return values
+}
+
+// matchScore returns the score of a lower case term against a value
+func matchScore(value, term string) int {
+	lower := strings.ToLower(value)
+	switch {
+	case lower == term:
+		return searchScoreExact
+	case strings.HasPrefix(lower, term):
+		return searchScorePrefix
+	case strings.Contains(lower, term):
+		return searchScoreContains
+	}
+	return 0
+}
+
+// highlight surrounds the occurrences of the terms within the value. The
+// matches are computed rune by rune on the value itself as lowering a string
+// may change its length in bytes.
+func highlight(value string, terms []string) string {
+	// byte offsets and lower case of the runes of the value
+	var offsets []int
+	var lower []rune
+	for i, r := range value {
+		offsets = append(offsets, i)
+		lower = append(lower, unicode.ToLower(r))
+	}
+	offsets = append(offsets, len(value))
+
+	// flag the matching runes first so that overlapping terms are merged
+	matched := make([]bool, len(lower))
+	for _, term := range terms {
+		runes := []rune(term)
+		if len(runes) == 0 {
+			continue
+		}
+		for i := 0; i+len(runes) <= len(lower); {
+			if !runesEqual(lower[i:i+len(runes)], runes) {
+				i++
+				continue
+			}
+			for j := i; j < i+len(runes); j++ {
+				matched[j] = true
+			}
+			i += len(runes)
+		}
+	}
+
+	var b bytes.Buffer
+	for i := range lower {
+		if matched[i] && (i == 0 || !matched[i-1]) {
+			b.WriteString(HighlightPreTag)
+		}
+		b.WriteString(value[offsets[i]:offsets[i+1]])
+		if matched[i] && (i == len(lower)-1 || !matched[i+1]) {
+			b.WriteString(HighlightPostTag)
+		}
+	}
+	return b.String()
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// searchNode returns the result of the search on a node, nil if one of the
+// terms doesn't match any field
+func searchNode(n *Node, terms []string, fields []SearchField) *SearchResult {
+	result := &SearchResult{Node: n}
+	matches := make(map[string]bool)
+
+	for _, term := range terms {
+		var best float64
+		for _, field := range fields {
+			for _, value := range fieldValues(n, field.Name) {
+				score := matchScore(value, term)
+				if score == 0 {
+					continue
+				}
+
+				if s := float64(score) * field.Boost; s > best {
+					best = s
+				}
+
+				key := field.Name + "\x00" + value
+				if !matches[key] {
+					matches[key] = true
+					result.Matches = append(result.Matches, SearchMatch{Field: field.Name, Value: value})
+				}
+			}
+		}
+
+		if best == 0 {
+			return nil
+		}
+		result.Score += best
+	}
+
+	for i, match := range result.Matches {
+		result.Matches[i].Highlight = highlight(match.Value, terms)
+	}
+
+	return result
+}
+
+// Search returns the nodes whose fields match all the terms of the text,
+// ordered by decreasing score. Exact matches score higher than prefix
+// matches which score higher than partial matches. A limit of 0 returns
+// all the results.
+func Search(nodes []*Node, text string, fields []SearchField, limit int) []*SearchResult {
+	terms := strings.Fields(strings.ToLower(text))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	var results []*SearchResult
+	for _, n := range nodes {
+		if result := searchNode(n, terms, fields); result != nil {
+			results = append(results, result)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Node.ID < results[j].Node.ID
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
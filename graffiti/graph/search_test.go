@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	g := newGraph(t)
+
+	eth0, _ := g.NewNode(GenID(), Metadata{"Name": "eth0", "Type": "device", "IPV4": []interface{}{"192.168.0.1/24"}})
+	veth, _ := g.NewNode(GenID(), Metadata{"Name": "veth-eth0", "Type": "veth"})
+	g.NewNode(GenID(), Metadata{"Name": "br0", "Type": "bridge"})
+
+	fields := []SearchField{{Name: "Name", Boost: 2}, {Name: "Type", Boost: 1}, {Name: "IPV4", Boost: 1}}
+
+	results := Search(g.GetNodes(nil), "ETH0", fields, 0)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+
+	if results[0].Node != eth0 || results[1].Node != veth {
+		t.Error("Exact match should be ranked first")
+	}
+
+	if results[1].Matches[0].Highlight != "veth-<em>eth0</em>" {
+		t.Errorf("Wrong highlight: %s", results[1].Matches[0].Highlight)
+	}
+
+	// all the terms have to match
+	results = Search(g.GetNodes(nil), "eth0 192.168", fields, 0)
+	if len(results) != 1 || results[0].Node != eth0 {
+		t.Fatalf("Expected eth0 only, got %+v", results)
+	}
+
+	if results[0].Matches[1].Field != "IPV4" || results[0].Matches[1].Highlight != "<em>192.168</em>.0.1/24" {
+		t.Errorf("Wrong list match: %+v", results[0].Matches[1])
+	}
+
+	if results = Search(g.GetNodes(nil), "e", fields, 1); len(results) != 1 {
+		t.Errorf("Expected results to be limited, got %d", len(results))
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		terms    []string
+		expected string
+	}{
+		{"veth-eth0", []string{"eth0"}, "veth-<em>eth0</em>"},
+		{"eth0-eth1", []string{"eth", "h0"}, "<em>eth0</em>-<em>eth</em>1"},
+		// lowering these runes makes the string longer
+		{"ȺȺȺx", []string{"x"}, "ȺȺȺ<em>x</em>"},
+		{"ȺȺȺx", []string{"ⱥⱥ"}, "<em>ȺȺ</em>Ⱥx"},
+		{"Éric", []string{"é"}, "<em>É</em>ric"},
+	} {
+		if h := highlight(test.value, test.terms); h != test.expected {
+			t.Errorf("Expected %s for %s, got %s", test.expected, test.value, h)
+		}
+	}
+}
+
+func TestParseSearchField(t *testing.T) {
+	field, err := ParseSearchField("Docker.ContainerName^2.5")
+	if err != nil || field.Name != "Docker.ContainerName" || field.Boost != 2.5 {
+		t.Errorf("Wrong field: %+v, %v", field, err)
+	}
+
+	if field, err = ParseSearchField("Name"); err != nil || field.Boost != 1 {
+		t.Errorf("Wrong default boost: %+v, %v", field, err)
+	}
+
+	if _, err = ParseSearchField("Name^a"); err == nil {
+		t.Error("Invalid boost should be refused")
+	}
+}
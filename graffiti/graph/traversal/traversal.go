@@ -64,6 +64,14 @@ type GraphTraversal struct {
 	error     error
 	lockGraph bool
 	as        map[string]*GraphTraversalAs
+	exec      *execution
+}
+
+// execution holds the state of a traversal execution, shared by the
+// traversals derived from the same query
+type execution struct {
+	deadline  time.Time
+	truncated bool
 }
 
 // GraphTraversalV traversal steps on nodes
@@ -440,7 +448,39 @@ func NewGraphTraversal(g *graph.Graph, lockGraph bool) *GraphTraversal {
 		Graph:     g,
 		lockGraph: lockGraph,
 		as:        make(map[string]*GraphTraversalAs),
+		exec:      &execution{},
+	}
+}
+
+// derive returns a new traversal on another graph sharing the execution
+// state of the traversal
+func (t *GraphTraversal) derive(g *graph.Graph) *GraphTraversal {
+	nt := NewGraphTraversal(g, t.lockGraph)
+	if t.exec != nil {
+		nt.exec = t.exec
 	}
+	return nt
+}
+
+// Deadline returns the time after which the steps waiting for remote
+// results have to return what they got so far, zero if none
+func (t *GraphTraversal) Deadline() time.Time {
+	if t.exec == nil {
+		return time.Time{}
+	}
+	return t.exec.deadline
+}
+
+// Truncate flags the results of the traversal as partial
+func (t *GraphTraversal) Truncate() {
+	if t.exec != nil {
+		t.exec.truncated = true
+	}
+}
+
+// Truncated returns whether the results of the traversal are partial
+func (t *GraphTraversal) Truncated() bool {
+	return t.exec != nil && t.exec.truncated
 }
 
 // RLock reads lock the graph
@@ -527,7 +567,7 @@ func (t *GraphTraversal) Context(s ...interface{}) *GraphTraversal {
 		return &GraphTraversal{error: err}
 	}
 
-	return &GraphTraversal{Graph: g}
+	return &GraphTraversal{Graph: g, exec: t.exec}
 }
 
 // V step : [node ID]
@@ -849,6 +889,11 @@ func (te *GraphTraversalE) G() *GraphTraversal {
 	return te.GraphTraversal
 }
 
+// GetEdges returns the step edges
+func (te *GraphTraversalE) GetEdges() (edges []*graph.Edge) {
+	return te.edges
+}
+
 // ParseSortParameter helper
 func ParseSortParameter(keys ...interface{}) (order common.SortOrder, sortBy string, err error) {
 	order = common.SortAscending
@@ -1380,7 +1425,7 @@ func (tv *GraphTraversalV) SubGraph(ctx StepContext, s ...interface{}) *GraphTra
 
 	ng := graph.NewGraph(tv.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
 
-	return NewGraphTraversal(ng, tv.GraphTraversal.lockGraph)
+	return tv.GraphTraversal.derive(ng)
 }
 
 // SubGraph step, node/edge out
@@ -1420,7 +1465,7 @@ func (sp *GraphTraversalShortestPath) SubGraph(ctx StepContext, s ...interface{}
 
 	ng := graph.NewGraph(sp.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
 
-	return NewGraphTraversal(ng, sp.GraphTraversal.lockGraph)
+	return sp.GraphTraversal.derive(ng)
 }
 
 // Count step
@@ -1468,6 +1513,28 @@ func (te *GraphTraversalE) Limit(ctx StepContext, s ...interface{}) *GraphTraver
 	return te.Range(ctx, int64(0), s[0])
 }
 
+// Sort step
+func (te *GraphTraversalE) Sort(ctx StepContext, keys ...interface{}) *GraphTraversalE {
+	if te.error != nil {
+		return te
+	}
+
+	sortOrder, sortBy, err := ParseSortParameter(keys...)
+	if err != nil {
+		return &GraphTraversalE{GraphTraversal: te.GraphTraversal, error: err}
+	}
+
+	if sortBy == "" {
+		sortBy = defaultSortBy
+	}
+
+	te.GraphTraversal.RLock()
+	graph.SortEdges(te.edges, sortBy, sortOrder)
+	te.GraphTraversal.RUnlock()
+
+	return te
+}
+
 // Dedup step : deduplicate
 func (te *GraphTraversalE) Dedup(ctx StepContext, s ...interface{}) *GraphTraversalE {
 	if te.error != nil {
@@ -1741,7 +1808,7 @@ func (te *GraphTraversalE) SubGraph(ctx StepContext, s ...interface{}) *GraphTra
 
 	ng := graph.NewGraph(te.GraphTraversal.Graph.GetHost(), memory, common.UnknownService)
 
-	return NewGraphTraversal(ng, te.GraphTraversal.lockGraph)
+	return te.GraphTraversal.derive(ng)
 }
 
 // NewGraphTraversalValue creates a new traversal value step
@@ -773,6 +773,8 @@ func (s *GremlinTraversalStepSort) Exec(last GraphTraversalStep) (GraphTraversal
 	switch last.(type) {
 	case *GraphTraversalV:
 		return last.(*GraphTraversalV).Sort(s.StepContext, s.Params...), nil
+	case *GraphTraversalE:
+		return last.(*GraphTraversalE).Sort(s.StepContext, s.Params...), nil
 	}
 
 	return invokeStepFnc(last, "Sort", s)
@@ -865,11 +867,19 @@ func (s *GremlinTraversalStepSelect) Reduce(next GremlinTraversalStep) (GremlinT
 
 // Exec sequence step
 func (s *GremlinTraversalSequence) Exec(g *graph.Graph, lockGraph bool) (GraphTraversalStep, error) {
+	return s.ExecWithDeadline(g, lockGraph, time.Time{})
+}
+
+// ExecWithDeadline executes the gremlin query sequence, the steps waiting
+// for remote results returning what they got at the deadline and flagging
+// the traversal as truncated
+func (s *GremlinTraversalSequence) ExecWithDeadline(g *graph.Graph, lockGraph bool, deadline time.Time) (GraphTraversalStep, error) {
 	var step GremlinTraversalStep
 	var last GraphTraversalStep
 	var err error
 
 	s.GraphTraversal = NewGraphTraversal(g, lockGraph)
+	s.GraphTraversal.exec.deadline = deadline
 	last = s.GraphTraversal
 
 	for i := 0; i < len(s.steps); {
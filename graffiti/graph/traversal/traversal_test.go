@@ -20,6 +20,7 @@ package traversal
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
@@ -842,3 +843,34 @@ func TestDedupMultiplefields(t *testing.T) {
 		t.Fatalf("Should return 3 nodes, returned: %v", res.Values())
 	}
 }
+
+func TestTraversalDeadline(t *testing.T) {
+	g := newTransversalGraph(t)
+
+	query := `G.V().Has("Type", "intf").SubGraph()`
+	ts, err := NewGremlinTraversalParser().Parse(strings.NewReader(query))
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	deadline := time.Now().Add(time.Minute)
+	res, err := ts.ExecWithDeadline(g, false, deadline)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	// the sub graph traversal shares the execution state of the query
+	sub := res.(*GraphTraversal)
+	if !sub.Deadline().Equal(deadline) {
+		t.Fatalf("Deadline not propagated, got: %s", sub.Deadline())
+	}
+
+	if ts.GraphTraversal.Truncated() {
+		t.Fatal("Results should not be truncated")
+	}
+
+	sub.Truncate()
+	if !ts.GraphTraversal.Truncated() {
+		t.Fatal("Truncation not reported to the query")
+	}
+}
@@ -0,0 +1,492 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// Object is a response object, keeping the order of the requested fields
+type Object []ObjectField
+
+// ObjectField is a field of a response object
+type ObjectField struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON serializes the object keeping the order of its fields
+func (o Object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Error describes an error of a GraphQL request
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// Response describes the response to a GraphQL request
+type Response struct {
+	Data   interface{} `json:"data"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// Request describes a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Executor executes GraphQL queries against a graph. The Node and Edge
+// types expose the graph element attributes, their metadata and their
+// relations, metadata keys being queryable as fields.
+type Executor struct {
+	graph *graph.Graph
+}
+
+type execution struct {
+	doc       *Document
+	variables map[string]interface{}
+	errors    []Error
+}
+
+// arguments reserved by the relation fields, all the other arguments are
+// metadata filters
+var reservedArgs = map[string]bool{
+	"first":        true,
+	"relationType": true,
+}
+
+func (ex *execution) errorf(path []interface{}, format string, args ...interface{}) {
+	ex.errors = append(ex.errors, Error{
+		Message: fmt.Sprintf(format, args...),
+		Path:    append([]interface{}{}, path...),
+	})
+}
+
+// resolve replaces the variables and enum values of an argument value
+func (ex *execution) resolve(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Variable:
+		return ex.variables[string(v)]
+	case EnumValue:
+		return string(v)
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = ex.resolve(item)
+		}
+		return list
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			object[k] = ex.resolve(item)
+		}
+		return object
+	}
+	return value
+}
+
+func (ex *execution) args(s *Selection) map[string]interface{} {
+	args := make(map[string]interface{}, len(s.Args))
+	for k, v := range s.Args {
+		args[k] = ex.resolve(v)
+	}
+	return args
+}
+
+func (ex *execution) included(directives []Directive) bool {
+	for _, d := range directives {
+		cond, _ := ex.resolve(d.Args["if"]).(bool)
+		switch d.Name {
+		case "skip":
+			if cond {
+				return false
+			}
+		case "include":
+			if !cond {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collectFields expands the fragments of a selection set for the given type
+func (ex *execution) collectFields(typeName string, selections []*Selection, visited map[string]bool) []*Selection {
+	var fields []*Selection
+	for _, s := range selections {
+		if !ex.included(s.Directives) {
+			continue
+		}
+
+		switch {
+		case s.Inline:
+			if s.TypeCondition == "" || s.TypeCondition == typeName {
+				fields = append(fields, ex.collectFields(typeName, s.Selections, visited)...)
+			}
+		case s.Fragment != "":
+			fragment, ok := ex.doc.Fragments[s.Fragment]
+			if !ok {
+				ex.errorf(nil, "Unknown fragment %s", s.Fragment)
+				continue
+			}
+			if visited[s.Fragment] || fragment.TypeCondition != typeName {
+				continue
+			}
+			visited[s.Fragment] = true
+			fields = append(fields, ex.collectFields(typeName, fragment.Selections, visited)...)
+		default:
+			fields = append(fields, s)
+		}
+	}
+	return fields
+}
+
+// flattenFilter converts nested objects to dotted metadata keys
+func flattenFilter(prefix string, args map[string]interface{}, m graph.Metadata) {
+	for k, v := range args {
+		if prefix == "" && reservedArgs[k] {
+			continue
+		}
+
+		if object, ok := v.(map[string]interface{}); ok {
+			flattenFilter(prefix+k+".", object, m)
+		} else {
+			m[prefix+k] = v
+		}
+	}
+}
+
+// matcher returns the metadata filter corresponding to the arguments
+func matcher(args map[string]interface{}) (graph.ElementMatcher, error) {
+	m := graph.Metadata{}
+	flattenFilter("", args, m)
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	for k, v := range m {
+		switch v.(type) {
+		case string, bool, int64, float64:
+		default:
+			return nil, fmt.Errorf("Unsupported value for filter %s", k)
+		}
+	}
+
+	filter, err := m.Filter()
+	if err != nil {
+		return nil, err
+	}
+	return graph.NewElementFilter(filter), nil
+}
+
+func edgeMatcher(args map[string]interface{}) graph.ElementMatcher {
+	if relationType, ok := args["relationType"].(string); ok {
+		return graph.Metadata{"RelationType": relationType}
+	}
+	return nil
+}
+
+func first(args map[string]interface{}) int {
+	switch v := args["first"].(type) {
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return -1
+}
+
+func sortNodes(nodes []*graph.Node, limit int) []*graph.Node {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	if limit >= 0 && limit < len(nodes) {
+		nodes = nodes[:limit]
+	}
+	return nodes
+}
+
+func sortEdges(edges []*graph.Edge, limit int) []*graph.Edge {
+	sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+	if limit >= 0 && limit < len(edges) {
+		edges = edges[:limit]
+	}
+	return edges
+}
+
+// hasSelection checks that a field of an object type has a selection
+func (ex *execution) hasSelection(s *Selection, typeName string, path []interface{}) bool {
+	if len(s.Selections) == 0 {
+		ex.errorf(path, "Field %s of type %s must have a selection", s.Name, typeName)
+		return false
+	}
+	return true
+}
+
+func (e *Executor) nodeList(ex *execution, nodes []*graph.Node, s *Selection, path []interface{}) []interface{} {
+	if !ex.hasSelection(s, "[Node]", path) {
+		return nil
+	}
+
+	list := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		list[i] = e.node(ex, n, s.Selections, append(path, i))
+	}
+	return list
+}
+
+func (e *Executor) edgeList(ex *execution, edges []*graph.Edge, s *Selection, path []interface{}) []interface{} {
+	if !ex.hasSelection(s, "[Edge]", path) {
+		return nil
+	}
+
+	list := make([]interface{}, len(edges))
+	for i, edge := range edges {
+		list[i] = e.edge(ex, edge, s.Selections, append(path, i))
+	}
+	return list
+}
+
+// element resolves the fields common to nodes and edges
+func (e *Executor) element(ex *execution, getter interface {
+	GetField(string) (interface{}, error)
+}, s *Selection, path []interface{}) interface{} {
+	if len(s.Selections) > 0 {
+		ex.errorf(path, "Field %s of scalar type can't have a selection", s.Name)
+		return nil
+	}
+
+	name := s.Name
+	switch name {
+	case "id":
+		name = "ID"
+	case "host":
+		name = "Host"
+	case "origin":
+		name = "Origin"
+	case "createdAt":
+		name = "CreatedAt"
+	case "updatedAt":
+		name = "UpdatedAt"
+	case "revision":
+		name = "Revision"
+	case "metadata":
+		key, _ := ex.args(s)["key"].(string)
+		if key == "" {
+			value, _ := getter.GetField("Metadata")
+			return value
+		}
+		name = key
+	}
+
+	// unknown metadata keys are null as the schema is open
+	value, err := getter.GetField(name)
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+func (e *Executor) node(ex *execution, n *graph.Node, selections []*Selection, path []interface{}) Object {
+	var object Object
+	for _, s := range ex.collectFields("Node", selections, map[string]bool{}) {
+		path := append(path, s.ResponseKey())
+
+		var value interface{}
+		switch s.Name {
+		case "__typename":
+			value = "Node"
+		case "children", "parents":
+			args := ex.args(s)
+			m, err := matcher(args)
+			if err != nil {
+				ex.errorf(path, "%s", err)
+				break
+			}
+
+			var nodes []*graph.Node
+			if s.Name == "children" {
+				nodes = e.graph.LookupChildren(n, m, edgeMatcher(args))
+			} else {
+				nodes = e.graph.LookupParents(n, m, edgeMatcher(args))
+			}
+			value = e.nodeList(ex, sortNodes(nodes, first(args)), s, path)
+		case "edges":
+			args := ex.args(s)
+			value = e.edgeList(ex, sortEdges(e.graph.GetNodeEdges(n, edgeMatcher(args)), first(args)), s, path)
+		default:
+			value = e.element(ex, &metadataGetter{n.Metadata, n}, s, path)
+		}
+
+		object = append(object, ObjectField{Key: s.ResponseKey(), Value: value})
+	}
+	return object
+}
+
+func (e *Executor) edge(ex *execution, edge *graph.Edge, selections []*Selection, path []interface{}) Object {
+	var object Object
+	for _, s := range ex.collectFields("Edge", selections, map[string]bool{}) {
+		path := append(path, s.ResponseKey())
+
+		var value interface{}
+		switch s.Name {
+		case "__typename":
+			value = "Edge"
+		case "parent", "child":
+			id := edge.Parent
+			if s.Name == "child" {
+				id = edge.Child
+			}
+			if n := e.graph.GetNode(id); n != nil && ex.hasSelection(s, "Node", path) {
+				value = e.node(ex, n, s.Selections, path)
+			}
+		default:
+			value = e.element(ex, &metadataGetter{edge.Metadata, edge}, s, path)
+		}
+
+		object = append(object, ObjectField{Key: s.ResponseKey(), Value: value})
+	}
+	return object
+}
+
+// metadataGetter adds the whole metadata to the fields of an element
+type metadataGetter struct {
+	metadata graph.Metadata
+	getter   interface {
+		GetField(string) (interface{}, error)
+	}
+}
+
+func (m *metadataGetter) GetField(name string) (interface{}, error) {
+	if name == "Metadata" {
+		return m.metadata, nil
+	}
+	return m.getter.GetField(name)
+}
+
+func (e *Executor) query(ex *execution, selections []*Selection) Object {
+	var object Object
+	for _, s := range ex.collectFields("Query", selections, map[string]bool{}) {
+		path := []interface{}{s.ResponseKey()}
+		args := ex.args(s)
+
+		var value interface{}
+		switch s.Name {
+		case "__typename":
+			value = "Query"
+		case "nodes":
+			m, err := matcher(args)
+			if err != nil {
+				ex.errorf(path, "%s", err)
+				break
+			}
+			value = e.nodeList(ex, sortNodes(e.graph.GetNodes(m), first(args)), s, path)
+		case "node":
+			id, _ := args["id"].(string)
+			if n := e.graph.GetNode(graph.Identifier(id)); n != nil && ex.hasSelection(s, "Node", path) {
+				value = e.node(ex, n, s.Selections, path)
+			}
+		case "edges":
+			m, err := matcher(args)
+			if err != nil {
+				ex.errorf(path, "%s", err)
+				break
+			}
+			value = e.edgeList(ex, sortEdges(e.graph.GetEdges(m), first(args)), s, path)
+		default:
+			ex.errorf(path, "Cannot query field %s on type Query", s.Name)
+		}
+
+		object = append(object, ObjectField{Key: s.ResponseKey(), Value: value})
+	}
+	return object
+}
+
+// Execute runs a GraphQL request against the graph, the graph has to be
+// locked by the caller
+func (e *Executor) Execute(request *Request) *Response {
+	doc, err := Parse(request.Query)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	op, err := selectOperation(doc, request.OperationName)
+	if err != nil {
+		return &Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	if op.Type != "query" {
+		return &Response{Errors: []Error{{Message: fmt.Sprintf("Unsupported operation type %s, only queries are supported", op.Type)}}}
+	}
+
+	ex := &execution{doc: doc, variables: make(map[string]interface{})}
+	for k, v := range op.Defaults {
+		ex.variables[k] = v
+	}
+	for k, v := range request.Variables {
+		ex.variables[k] = v
+	}
+
+	data := e.query(ex, op.Selections)
+	return &Response{Data: data, Errors: ex.errors}
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, errors.New("An operation name is required when the document contains several operations")
+		}
+		return doc.Operations[0], nil
+	}
+
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown operation %s", name)
+}
+
+// NewExecutor returns a new executor for the given graph
+func NewExecutor(g *graph.Graph) *Executor {
+	return &Executor{graph: g}
+}
@@ -0,0 +1,626 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// Variable is a reference to a variable of the operation
+type Variable string
+
+// EnumValue is an enum value literal
+type EnumValue string
+
+// Directive describes a directive applied to a selection
+type Directive struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// Selection is either a field, a fragment spread or an inline fragment
+type Selection struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Directives []Directive
+	Selections []*Selection
+
+	// Fragment is the name of the fragment of a spread
+	Fragment string
+	// TypeCondition is the type of an inline fragment or a fragment spread
+	TypeCondition string
+	Inline        bool
+}
+
+// ResponseKey returns the key of the field in the response
+func (s *Selection) ResponseKey() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	return s.Name
+}
+
+// Operation describes a query operation
+type Operation struct {
+	Type       string
+	Name       string
+	Defaults   map[string]interface{}
+	Selections []*Selection
+}
+
+// Fragment describes a named fragment
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Selections    []*Selection
+}
+
+// Document describes a parsed GraphQL document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// SyntaxError describes an error in a GraphQL document
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("Syntax error at position %d: %s", e.Pos, e.Message)
+}
+
+type parser struct {
+	src   string
+	pos   int
+	token token
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &SyntaxError{Pos: p.token.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// next reads the next token, commas are insignificant in GraphQL
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else {
+			break
+		}
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.token = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.token = token{kind: tokenPunct, value: "...", pos: start}
+	case strings.IndexByte("!$():=@[]{}|", c) != -1:
+		p.pos++
+		p.token = token{kind: tokenPunct, value: string(c), pos: start}
+	case isNameStart(c):
+		for p.pos < len(p.src) && isNameChar(p.src[p.pos]) {
+			p.pos++
+		}
+		p.token = token{kind: tokenName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.readNumber()
+	case c == '"':
+		return p.readString()
+	default:
+		return &SyntaxError{Pos: start, Message: fmt.Sprintf("unexpected character %q", c)}
+	}
+
+	return nil
+}
+
+func (p *parser) readNumber() error {
+	start := p.pos
+	kind := tokenInt
+
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c >= '0' && c <= '9' {
+			p.pos++
+		} else if c == '.' || c == 'e' || c == 'E' || ((c == '+' || c == '-') && kind == tokenFloat) {
+			kind = tokenFloat
+			p.pos++
+		} else {
+			break
+		}
+	}
+
+	p.token = token{kind: kind, value: p.src[start:p.pos], pos: start}
+	return nil
+}
+
+func (p *parser) readString() error {
+	start := p.pos
+	p.pos++
+
+	var sb bytes.Buffer
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			return &SyntaxError{Pos: start, Message: "unterminated string"}
+		}
+
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			p.token = token{kind: tokenString, value: sb.String(), pos: start}
+			return nil
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				return &SyntaxError{Pos: start, Message: "unterminated string"}
+			}
+			p.pos++
+			switch e := p.src[p.pos]; e {
+			case '"', '\\', '/':
+				sb.WriteByte(e)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if p.pos+5 > len(p.src) {
+					return &SyntaxError{Pos: p.pos, Message: "invalid unicode escape"}
+				}
+				r, err := strconv.ParseUint(p.src[p.pos+1:p.pos+5], 16, 32)
+				if err != nil {
+					return &SyntaxError{Pos: p.pos, Message: "invalid unicode escape"}
+				}
+				sb.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				return &SyntaxError{Pos: p.pos, Message: fmt.Sprintf("invalid escape sequence \\%c", e)}
+			}
+			p.pos++
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			sb.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+func (p *parser) peek(value string) bool {
+	return (p.token.kind == tokenPunct || p.token.kind == tokenName) && p.token.value == value
+}
+
+func (p *parser) expect(value string) error {
+	if !p.peek(value) {
+		return p.errorf("expected %q, got %q", value, p.token.value)
+	}
+	return p.next()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.errorf("expected a name, got %q", p.token.value)
+	}
+	name := p.token.value
+	return name, p.next()
+}
+
+func (p *parser) value(constant bool) (interface{}, error) {
+	tok := p.token
+
+	switch tok.kind {
+	case tokenInt:
+		i, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", tok.value)
+		}
+		return i, p.next()
+	case tokenFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %s", tok.value)
+		}
+		return f, p.next()
+	case tokenString:
+		return tok.value, p.next()
+	case tokenName:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return EnumValue(tok.value), nil
+	case tokenPunct:
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, p.errorf("unexpected variable")
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			return Variable(name), err
+		case "[":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			list := []interface{}{}
+			for !p.peek("]") {
+				if p.token.kind == tokenEOF {
+					return nil, p.errorf("unterminated list")
+				}
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, p.next()
+		case "{":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			object := map[string]interface{}{}
+			for !p.peek("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if object[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return object, p.next()
+		}
+	}
+
+	return nil, p.errorf("unexpected %q", tok.value)
+}
+
+func (p *parser) arguments(constant bool) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if !p.peek("(") {
+		return args, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(constant); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, p.next()
+}
+
+func (p *parser) directives() ([]Directive, error) {
+	var directives []Directive
+	for p.peek("@") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, Directive{Name: name, Args: args})
+	}
+	return directives, nil
+}
+
+func (p *parser) selectionSet() ([]*Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var selections []*Selection
+	for !p.peek("}") {
+		if p.token.kind == tokenEOF {
+			return nil, p.errorf("unterminated selection set")
+		}
+
+		selection, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+
+	if len(selections) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+
+	return selections, p.next()
+}
+
+func (p *parser) selection() (*Selection, error) {
+	var err error
+
+	if p.peek("...") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+
+		s := &Selection{}
+		if p.token.kind == tokenName && p.token.value != "on" {
+			if s.Fragment, err = p.name(); err != nil {
+				return nil, err
+			}
+			s.Directives, err = p.directives()
+			return s, err
+		}
+
+		s.Inline = true
+		if p.peek("on") {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			if s.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if s.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		s.Selections, err = p.selectionSet()
+		return s, err
+	}
+
+	s := &Selection{}
+	if s.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+
+	if p.peek(":") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		s.Alias = s.Name
+		if s.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Args, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+
+	if s.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+
+	if p.peek("{") {
+		if s.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// skipType skips a variable type, types are not checked
+func (p *parser) skipType() error {
+	if p.peek("[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+
+	if p.peek("!") {
+		return p.next()
+	}
+	return nil
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: "query", Defaults: map[string]interface{}{}}
+
+	var err error
+	if p.token.kind == tokenName {
+		if op.Type, err = p.name(); err != nil {
+			return nil, err
+		}
+		if op.Type != "query" && op.Type != "mutation" && op.Type != "subscription" {
+			return nil, p.errorf("unknown operation type %s", op.Type)
+		}
+
+		if p.token.kind == tokenName {
+			if op.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+
+		if p.peek("(") {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			for !p.peek(")") {
+				if err = p.expect("$"); err != nil {
+					return nil, err
+				}
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err = p.expect(":"); err != nil {
+					return nil, err
+				}
+				if err = p.skipType(); err != nil {
+					return nil, err
+				}
+				if p.peek("=") {
+					if err = p.next(); err != nil {
+						return nil, err
+					}
+					if op.Defaults[name], err = p.value(true); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err = p.directives(); err != nil {
+			return nil, err
+		}
+	}
+
+	op.Selections, err = p.selectionSet()
+	return op, err
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	if err := p.expect("fragment"); err != nil {
+		return nil, err
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = p.expect("on"); err != nil {
+		return nil, err
+	}
+
+	f := &Fragment{Name: name}
+	if f.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+
+	if _, err = p.directives(); err != nil {
+		return nil, err
+	}
+
+	f.Selections, err = p.selectionSet()
+	return f, err
+}
+
+// Parse parses a GraphQL document
+func Parse(src string) (*Document, error) {
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Fragments: make(map[string]*Fragment)}
+	for p.token.kind != tokenEOF {
+		if p.peek("fragment") {
+			f, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			doc.Fragments[f.Name] = f
+			continue
+		}
+
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+
+	if len(doc.Operations) == 0 {
+		return nil, &SyntaxError{Pos: 0, Message: "no operation defined"}
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graphql
+
+import (
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	doc, err := Parse(`
+		query Hosts($type: String = "host") {
+			hosts: nodes(Type: $type, first: 2) {
+				Name
+				... on Node { id }
+				children(Type: "device", Labels: ["a", "b"]) @include(if: true) {
+					...iface
+				}
+			}
+		}
+
+		fragment iface on Node {
+			Name
+			IPV4: metadata(key: "IPV4")
+		}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Operations) != 1 || doc.Operations[0].Name != "Hosts" {
+		t.Fatalf("expected one operation named Hosts, got %+v", doc.Operations)
+	}
+
+	op := doc.Operations[0]
+	if op.Defaults["type"] != "host" {
+		t.Errorf("wrong default value for $type: %v", op.Defaults["type"])
+	}
+
+	hosts := op.Selections[0]
+	if hosts.ResponseKey() != "hosts" || hosts.Name != "nodes" {
+		t.Errorf("wrong alias or name: %+v", hosts)
+	}
+	if hosts.Args["Type"] != Variable("type") {
+		t.Errorf("expected a variable argument, got %v", hosts.Args["Type"])
+	}
+
+	if len(hosts.Selections) != 3 || !hosts.Selections[1].Inline || hosts.Selections[1].TypeCondition != "Node" {
+		t.Fatalf("wrong selections: %+v", hosts.Selections)
+	}
+
+	children := hosts.Selections[2]
+	if labels, ok := children.Args["Labels"].([]interface{}); !ok || len(labels) != 2 {
+		t.Errorf("expected a list argument, got %v", children.Args["Labels"])
+	}
+	if len(children.Directives) != 1 || children.Directives[0].Name != "include" {
+		t.Errorf("wrong directives: %+v", children.Directives)
+	}
+	if children.Selections[0].Fragment != "iface" {
+		t.Errorf("expected a fragment spread, got %+v", children.Selections[0])
+	}
+
+	if f := doc.Fragments["iface"]; f == nil || f.TypeCondition != "Node" || len(f.Selections) != 2 {
+		t.Errorf("wrong fragment: %+v", f)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"{ nodes { Name }",
+		"{ nodes(Type: ) { Name } }",
+		`{ nodes(Name: "unterminated) { Name } }`,
+		"subscribe { nodes }",
+	} {
+		if _, err := Parse(query); err == nil {
+			t.Errorf("expected a syntax error for %q", query)
+		}
+	}
+}
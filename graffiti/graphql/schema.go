@@ -0,0 +1,214 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graphql
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+const (
+	typeJSON = "JSON"
+	typeLong = "Long"
+)
+
+// fields resolved by the executor, metadata keys with the same name are
+// only reachable through the metadata field
+var (
+	nodeFields = []string{
+		"id: ID!",
+		"host: String",
+		"origin: String",
+		"createdAt: Long",
+		"updatedAt: Long",
+		"revision: Long",
+		"metadata(key: String): JSON",
+		"children(relationType: String, first: Int%s): [Node!]",
+		"parents(relationType: String, first: Int%s): [Node!]",
+		"edges(relationType: String, first: Int): [Edge!]",
+	}
+	edgeFields = []string{
+		"id: ID!",
+		"host: String",
+		"origin: String",
+		"createdAt: Long",
+		"updatedAt: Long",
+		"revision: Long",
+		"metadata(key: String): JSON",
+		"parent: Node",
+		"child: Node",
+	}
+	builtinFields = map[string]bool{
+		"id": true, "host": true, "origin": true, "createdAt": true, "updatedAt": true,
+		"revision": true, "metadata": true, "children": true, "parents": true,
+		"edges": true, "parent": true, "child": true, "first": true, "relationType": true,
+	}
+)
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) || (len(s) > 1 && s[0] == '_' && s[1] == '_') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// valueType returns the GraphQL type of a metadata value
+func valueType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "String"
+	case bool:
+		return "Boolean"
+	case int, int32, int64, uint32, uint64:
+		return typeLong
+	case float32, float64:
+		return "Float"
+	case []string:
+		return "[String]"
+	case []interface{}:
+		if len(v) == 0 {
+			return typeJSON
+		}
+		itemType := valueType(v[0])
+		for _, item := range v[1:] {
+			if valueType(item) != itemType {
+				return typeJSON
+			}
+		}
+		if itemType == typeJSON || itemType[0] == '[' {
+			return typeJSON
+		}
+		return "[" + itemType + "]"
+	}
+	return typeJSON
+}
+
+// metadataTypes merges the types of the metadata keys, conflicting types
+// falling back to JSON
+type metadataTypes map[string]string
+
+func (m metadataTypes) add(key, typ string) {
+	if !isName(key) || builtinFields[key] {
+		return
+	}
+
+	if previous, ok := m[key]; ok && previous != typ {
+		typ = typeJSON
+	}
+	m[key] = typ
+}
+
+func (m metadataTypes) addMetadata(metadata graph.Metadata) {
+	for k, v := range metadata {
+		m.add(k, valueType(v))
+	}
+}
+
+func (m metadataTypes) addDecoders(decoders map[string]graph.MetadataDecoder) {
+	for k := range decoders {
+		m.add(k, typeJSON)
+	}
+}
+
+func (m metadataTypes) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// filterArgs returns the arguments used to filter on the scalar metadata
+func (m metadataTypes) filterArgs() string {
+	var buf bytes.Buffer
+	for _, k := range m.keys() {
+		typ := m[k]
+		if typ == typeJSON {
+			continue
+		}
+		// lists are filtered by one of their items
+		if typ[0] == '[' {
+			typ = typ[1 : len(typ)-1]
+		}
+		fmt.Fprintf(&buf, ", %s: %s", k, typ)
+	}
+	return buf.String()
+}
+
+func writeType(buf *bytes.Buffer, name string, builtins []string, metadata metadataTypes) {
+	fmt.Fprintf(buf, "type %s {\n", name)
+	for _, field := range builtins {
+		fmt.Fprintf(buf, "  %s\n", field)
+	}
+	for _, k := range metadata.keys() {
+		fmt.Fprintf(buf, "  %s: %s\n", k, metadata[k])
+	}
+	buf.WriteString("}\n")
+}
+
+// Schema returns the schema in the GraphQL schema definition language. The
+// metadata fields are generated from the registered metadata decoders and
+// from the metadata of the elements of the graph, the graph has to be locked
+// by the caller.
+func (e *Executor) Schema() string {
+	nodeMetadata, edgeMetadata := metadataTypes{}, metadataTypes{}
+
+	nodeMetadata.addDecoders(graph.NodeMetadataDecoders)
+	for _, n := range e.graph.GetNodes(nil) {
+		nodeMetadata.addMetadata(n.Metadata)
+	}
+
+	edgeMetadata.addDecoders(graph.EdgeMetadataDecoders)
+	for _, edge := range e.graph.GetEdges(nil) {
+		edgeMetadata.addMetadata(edge.Metadata)
+	}
+
+	nodeArgs, edgeArgs := nodeMetadata.filterArgs(), edgeMetadata.filterArgs()
+
+	var buf bytes.Buffer
+	buf.WriteString("scalar JSON\n\nscalar Long\n\n")
+
+	buf.WriteString("type Query {\n")
+	fmt.Fprintf(&buf, "  nodes(first: Int%s): [Node!]\n", nodeArgs)
+	buf.WriteString("  node(id: ID!): Node\n")
+	fmt.Fprintf(&buf, "  edges(first: Int%s): [Edge!]\n", edgeArgs)
+	buf.WriteString("}\n\n")
+
+	var fields []string
+	for _, field := range nodeFields {
+		if strings.Contains(field, "%s") {
+			field = fmt.Sprintf(field, nodeArgs)
+		}
+		fields = append(fields, field)
+	}
+	writeType(&buf, "Node", fields, nodeMetadata)
+	buf.WriteString("\n")
+	writeType(&buf, "Edge", edgeFields, edgeMetadata)
+
+	return buf.String()
+}
@@ -18,12 +18,17 @@
 package hub
 
 import (
+	"reflect"
+	"time"
+
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
 	"github.com/skydive-project/skydive/graffiti/pod"
+	gws "github.com/skydive-project/skydive/graffiti/websocket"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/websocket"
 )
 
@@ -105,14 +110,16 @@ func (h *Hub) SubscriberServer() *websocket.StructServer {
 	return h.subscriberWSServer
 }
 
-// NewHub returns a new hub
-func NewHub(server *shttp.Server, g *graph.Graph, cached *graph.CachedBackend, apiAuthBackend, clusterAuthBackend shttp.AuthenticationBackend, clusterAuthOptions *shttp.AuthenticationOpts, podEndpoint string, peers []common.ServiceAddress, opts websocket.ServerOpts) (*Hub, error) {
+// NewHub returns a new hub. The resources of a disconnected pod are kept
+// during podGracePeriod, so that a pod reconnecting meanwhile only has its
+// changes applied.
+func NewHub(server *shttp.Server, g *graph.Graph, cached *graph.CachedBackend, apiAuthBackend, clusterAuthBackend shttp.AuthenticationBackend, clusterAuthOptions *shttp.AuthenticationOpts, podEndpoint string, peers []common.ServiceAddress, opts websocket.ServerOpts, podGracePeriod time.Duration) (*Hub, error) {
 	newWSServer := func(endpoint string, authBackend shttp.AuthenticationBackend) *websocket.Server {
 		return websocket.NewServer(server, endpoint, authBackend, opts)
 	}
 
 	podWSServer := websocket.NewStructServer(newWSServer(podEndpoint, clusterAuthBackend))
-	_, err := NewTopologyPodEndpoint(podWSServer, cached, g)
+	_, err := NewTopologyPodEndpoint(podWSServer, cached, g, podGracePeriod)
 	if err != nil {
 		return nil, err
 	}
@@ -161,3 +168,55 @@ func clientOrigin(c websocket.Speaker) string {
 func delSubGraphOfOrigin(cached *graph.CachedBackend, g *graph.Graph, origin string) {
 	g.DelNodes(graph.Metadata{"Origin": origin})
 }
+
+// syncSubGraphOfOrigin replaces the subgraph of an origin by the elements
+// of a sync message. Only the differences are applied, so that the sync of
+// a reconnecting client does not delete and recreate all its elements.
+func syncSubGraphOfOrigin(g *graph.Graph, origin string, r *gws.SyncMsg) {
+	nodes := make(map[graph.Identifier]bool, len(r.Nodes))
+	for _, n := range r.Nodes {
+		nodes[n.ID] = true
+	}
+	edges := make(map[graph.Identifier]bool, len(r.Edges))
+	for _, e := range r.Edges {
+		edges[e.ID] = true
+	}
+
+	for _, e := range g.GetEdges(graph.Metadata{"Origin": origin}) {
+		if !edges[e.ID] {
+			g.DelEdge(e)
+		}
+	}
+	for _, n := range g.GetNodes(graph.Metadata{"Origin": origin}) {
+		if !nodes[n.ID] {
+			g.DelNode(n)
+		}
+	}
+
+	for _, n := range r.Nodes {
+		current := g.GetNode(n.ID)
+		switch {
+		case current == nil:
+			if err := g.NodeAdded(n); err != nil {
+				logging.GetLogger().Errorf("%s, %+v", err, n)
+			}
+		case current.Origin == origin && (current.Revision != n.Revision || !reflect.DeepEqual(current.Metadata, n.Metadata)):
+			if err := g.NodeUpdated(n); err != nil {
+				logging.GetLogger().Errorf("%s, %+v", err, n)
+			}
+		}
+	}
+	for _, e := range r.Edges {
+		current := g.GetEdge(e.ID)
+		switch {
+		case current == nil:
+			if err := g.EdgeAdded(e); err != nil {
+				logging.GetLogger().Errorf("%s, %+v", err, e)
+			}
+		case current.Origin == origin && (current.Revision != e.Revision || !reflect.DeepEqual(current.Metadata, e.Metadata)):
+			if err := g.EdgeUpdated(e); err != nil {
+				logging.GetLogger().Errorf("%s, %+v", err, e)
+			}
+		}
+	}
+}
@@ -18,6 +18,8 @@
 package hub
 
 import (
+	"time"
+
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	gws "github.com/skydive-project/skydive/graffiti/websocket"
@@ -25,38 +27,105 @@ import (
 	ws "github.com/skydive-project/skydive/websocket"
 )
 
-// TopologyAgentEndpoint serves the graph for agents.
+// TopologyAgentEndpoint serves the graph for agents. The resources of a
+// disconnected agent are kept during the grace period, its sync being
+// applied incrementally if it reconnects meanwhile. The position of the
+// agents keeping a journal is tracked so that they only have to send the
+// events missed when reconnecting.
 type TopologyAgentEndpoint struct {
 	common.RWMutex
 	ws.DefaultSpeakerEventHandler
-	pool    ws.StructSpeakerPool
-	Graph   *graph.Graph
-	cached  *graph.CachedBackend
-	authors map[string]bool
+	pool        ws.StructSpeakerPool
+	Graph       *graph.Graph
+	cached      *graph.CachedBackend
+	authors     map[string]bool
+	gracePeriod time.Duration
+	expiring    map[string]*time.Timer
+	positions   map[string]*gws.ResumeMsg
+}
+
+// delAuthor deletes the resources of an agent, the endpoint lock being held
+func (t *TopologyAgentEndpoint) delAuthor(origin string) {
+	logging.GetLogger().Debugf("Authoritative client unregistered, delete resources of %s", origin)
+
+	t.Graph.Lock()
+	delSubGraphOfOrigin(t.cached, t.Graph, origin)
+	t.Graph.Unlock()
+
+	delete(t.authors, origin)
+	delete(t.positions, origin)
+}
+
+// updatePosition tracks the last event of the agent journal received
+func (t *TopologyAgentEndpoint) updatePosition(origin string, msgType string, obj interface{}) {
+	t.Lock()
+	defer t.Unlock()
+
+	switch msgType {
+	case gws.SyncMsgType, gws.SyncReplyMsgType:
+		if msg := obj.(*gws.SyncMsg); msg.Epoch != "" {
+			t.positions[origin] = &gws.ResumeMsg{Epoch: msg.Epoch, Seq: msg.Seq}
+		} else {
+			delete(t.positions, origin)
+		}
+	case gws.NodeUpdatedMsgType, gws.NodeDeletedMsgType, gws.NodeAddedMsgType,
+		gws.EdgeUpdatedMsgType, gws.EdgeDeletedMsgType, gws.EdgeAddedMsgType:
+		if position, ok := t.positions[origin]; ok {
+			position.Seq++
+		}
+	}
+}
+
+// resumeReply returns the position of the agent in the given journal epoch
+func (t *TopologyAgentEndpoint) resumeReply(origin string, epoch string) *gws.ResumeMsg {
+	t.RLock()
+	defer t.RUnlock()
+
+	if position, ok := t.positions[origin]; ok && position.Epoch == epoch {
+		return &gws.ResumeMsg{Epoch: position.Epoch, Seq: position.Seq}
+	}
+	return &gws.ResumeMsg{}
+}
+
+// expire deletes the resources of a disconnected agent, unless it
+// reconnected during the grace period
+func (t *TopologyAgentEndpoint) expire(origin string, timer *time.Timer) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.expiring[origin] != timer {
+		return
+	}
+	delete(t.expiring, origin)
+	t.delAuthor(origin)
 }
 
 // OnDisconnected called when an agent disconnected.
 func (t *TopologyAgentEndpoint) OnDisconnected(c ws.Speaker) {
 	origin := clientOrigin(c)
 
-	t.RLock()
-	_, ok := t.authors[origin]
-	t.RUnlock()
+	t.Lock()
+	defer t.Unlock()
 
 	// not an author so do not delete resources
-	if !ok {
+	if _, ok := t.authors[origin]; !ok {
 		return
 	}
 
-	logging.GetLogger().Debugf("Authoritative client unregistered, delete resources of %s", origin)
+	if t.gracePeriod <= 0 {
+		t.delAuthor(origin)
+		return
+	}
 
-	t.Graph.Lock()
-	delSubGraphOfOrigin(t.cached, t.Graph, origin)
-	t.Graph.Unlock()
+	if previous, ok := t.expiring[origin]; ok {
+		previous.Stop()
+	}
 
-	t.Lock()
-	delete(t.authors, origin)
-	t.Unlock()
+	logging.GetLogger().Debugf("Authoritative client %s disconnected, resources kept during %s", origin, t.gracePeriod)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(t.gracePeriod, func() { t.expire(origin, timer) })
+	t.expiring[origin] = timer
 }
 
 // OnStructMessage is triggered when a message from the agent is received.
@@ -69,6 +138,11 @@ func (t *TopologyAgentEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMess
 		t.authors[origin] = true
 		logging.GetLogger().Debugf("Authoritative client registered %s", origin)
 	}
+	if timer, ok := t.expiring[origin]; ok {
+		timer.Stop()
+		delete(t.expiring, origin)
+		logging.GetLogger().Debugf("Authoritative client %s reconnected, resources resumed", origin)
+	}
 	t.Unlock()
 
 	msgType, obj, err := gws.UnmarshalMessage(msg)
@@ -77,29 +151,19 @@ func (t *TopologyAgentEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMess
 		return
 	}
 
+	if msgType == gws.ResumeRequestMsgType {
+		reply := t.resumeReply(origin, obj.(*gws.ResumeMsg).Epoch)
+		c.SendMessage(gws.NewStructMessage(gws.ResumeReplyMsgType, reply))
+		return
+	}
+	t.updatePosition(origin, msgType, obj)
+
 	t.Graph.Lock()
 	defer t.Graph.Unlock()
 
 	switch msgType {
 	case gws.SyncMsgType, gws.SyncReplyMsgType:
-		r := obj.(*gws.SyncMsg)
-
-		delSubGraphOfOrigin(t.cached, t.Graph, origin)
-
-		for _, n := range r.Nodes {
-			if t.Graph.GetNode(n.ID) == nil {
-				if err := t.Graph.NodeAdded(n); err != nil {
-					logging.GetLogger().Errorf("%s, %+v", err, n)
-				}
-			}
-		}
-		for _, e := range r.Edges {
-			if t.Graph.GetEdge(e.ID) == nil {
-				if err := t.Graph.EdgeAdded(e); err != nil {
-					logging.GetLogger().Errorf("%s, %+v", err, e)
-				}
-			}
-		}
+		syncSubGraphOfOrigin(t.Graph, origin, obj.(*gws.SyncMsg))
 	case gws.NodeUpdatedMsgType:
 		err = t.Graph.NodeUpdated(obj.(*graph.Node))
 	case gws.NodeDeletedMsgType:
@@ -122,12 +186,15 @@ func (t *TopologyAgentEndpoint) OnStructMessage(c ws.Speaker, msg *ws.StructMess
 }
 
 // NewTopologyPodEndpoint returns a new server that handles messages from the agents
-func NewTopologyPodEndpoint(pool ws.StructSpeakerPool, cached *graph.CachedBackend, g *graph.Graph) (*TopologyAgentEndpoint, error) {
+func NewTopologyPodEndpoint(pool ws.StructSpeakerPool, cached *graph.CachedBackend, g *graph.Graph, gracePeriod time.Duration) (*TopologyAgentEndpoint, error) {
 	t := &TopologyAgentEndpoint{
-		Graph:   g,
-		pool:    pool,
-		cached:  cached,
-		authors: make(map[string]bool),
+		Graph:       g,
+		pool:        pool,
+		cached:      cached,
+		authors:     make(map[string]bool),
+		gracePeriod: gracePeriod,
+		expiring:    make(map[string]*time.Timer),
+		positions:   make(map[string]*gws.ResumeMsg),
 	}
 
 	pool.AddEventHandler(t)
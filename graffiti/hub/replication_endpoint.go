@@ -19,6 +19,7 @@ package hub
 
 import (
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -60,12 +61,50 @@ type TopologyReplicationEndpoint struct {
 	cached       *graph.CachedBackend
 	replicateMsg atomic.Value
 	wg           sync.WaitGroup
+	// export filters of the peers, indexed by lower case host id
+	exportFilters       map[string]*graph.ExportFilter
+	defaultExportFilter *graph.ExportFilter
+	exportersLock       sync.RWMutex
+	exporters           map[ws.Speaker]*gws.Exporter
 }
 
 func (t *TopologyReplicationEndpoint) debug() bool {
 	return config.GetBool("analyzer.replication.debug")
 }
 
+// readOnly returns whether the local graph must not be sent to the peers
+func (t *TopologyReplicationEndpoint) readOnly() bool {
+	return config.GetBool("analyzer.read_only")
+}
+
+// syncMsg returns the message initializing the graph of a peer, an exporter
+// being used for the following messages when the graph sent to the peer is
+// filtered. The graph lock has to be held.
+func (t *TopologyReplicationEndpoint) syncMsg(c ws.Speaker) *ws.StructMessage {
+	filter, found := t.exportFilters[strings.ToLower(c.GetRemoteHost())]
+	if !found {
+		filter = t.defaultExportFilter
+	}
+
+	if filter.IsEmpty() {
+		return gws.NewStructMessage(gws.SyncMsgType, &gws.SyncMsg{Elements: t.Graph.Elements()})
+	}
+
+	exporter := gws.NewExporter(t.Graph, filter)
+
+	t.exportersLock.Lock()
+	t.exporters[c] = exporter
+	t.exportersLock.Unlock()
+
+	return exporter.SyncMsg()
+}
+
+func (t *TopologyReplicationEndpoint) removeExporter(c ws.Speaker) {
+	t.exportersLock.Lock()
+	delete(t.exporters, c)
+	t.exportersLock.Unlock()
+}
+
 // OnConnected is called when the peer gets connected then the whole graph
 // is send to initialize it.
 func (p *TopologyReplicatorPeer) OnConnected(c ws.Speaker) {
@@ -97,11 +136,11 @@ func (p *TopologyReplicatorPeer) OnConnected(c ws.Speaker) {
 		return
 	}
 
-	msg := &gws.SyncMsg{
-		Elements: p.Graph.Elements(),
+	if p.endpoint.readOnly() {
+		return
 	}
 
-	p.wsspeaker.SendMessage(gws.NewStructMessage(gws.SyncMsgType, msg))
+	p.wsspeaker.SendMessage(p.endpoint.syncMsg(c))
 
 	p.endpoint.out.AddClient(c)
 }
@@ -119,6 +158,8 @@ func (p *TopologyReplicatorPeer) OnDisconnected(c ws.Speaker) {
 		return
 	}
 
+	p.endpoint.removeExporter(c)
+
 	origin := clientOrigin(c)
 	if p.Graph.Origin() == origin {
 		return
@@ -268,22 +309,45 @@ func (t *TopologyReplicationEndpoint) OnStructMessage(c ws.Speaker, msg *ws.Stru
 	}
 }
 
-// SendToPeers sends the message to all the peers
-func (t *TopologyReplicationEndpoint) notifyPeers(msg *ws.StructMessage) {
+// notifyPeers sends the message to all the peers, the peers whose graph is
+// filtered receiving the messages returned by their exporter instead
+func (t *TopologyReplicationEndpoint) notifyPeers(msg *ws.StructMessage, export func(e *gws.Exporter) []*ws.StructMessage) {
+	if t.readOnly() {
+		return
+	}
+
 	if t.debug() {
 		b, _ := msg.Bytes(ws.JSONProtocol)
 		logging.GetLogger().Debugf("Broadcasting message to all peers: %s", string(b))
 	}
 
-	t.in.BroadcastMessage(msg)
-	t.out.BroadcastMessage(msg)
+	t.exportersLock.RLock()
+	defer t.exportersLock.RUnlock()
+
+	if len(t.exporters) == 0 {
+		t.in.BroadcastMessage(msg)
+		t.out.BroadcastMessage(msg)
+		return
+	}
+
+	for _, c := range t.GetSpeakers() {
+		exporter, found := t.exporters[c]
+		if !found {
+			c.SendMessage(msg)
+			continue
+		}
+
+		for _, m := range export(exporter) {
+			c.SendMessage(m)
+		}
+	}
 }
 
 // OnNodeUpdated graph node updated event. Implements the EventListener interface.
 func (t *TopologyReplicationEndpoint) OnNodeUpdated(n *graph.Node) {
 	if t.replicateMsg.Load() == true {
 		msg := gws.NewStructMessage(gws.NodeUpdatedMsgType, n)
-		t.notifyPeers(msg)
+		t.notifyPeers(msg, func(x *gws.Exporter) []*ws.StructMessage { return x.NodeUpdated(n) })
 	}
 }
 
@@ -291,7 +355,7 @@ func (t *TopologyReplicationEndpoint) OnNodeUpdated(n *graph.Node) {
 func (t *TopologyReplicationEndpoint) OnNodeAdded(n *graph.Node) {
 	if t.replicateMsg.Load() == true {
 		msg := gws.NewStructMessage(gws.NodeAddedMsgType, n)
-		t.notifyPeers(msg)
+		t.notifyPeers(msg, func(x *gws.Exporter) []*ws.StructMessage { return x.NodeAdded(n) })
 	}
 }
 
@@ -299,7 +363,7 @@ func (t *TopologyReplicationEndpoint) OnNodeAdded(n *graph.Node) {
 func (t *TopologyReplicationEndpoint) OnNodeDeleted(n *graph.Node) {
 	if t.replicateMsg.Load() == true {
 		msg := gws.NewStructMessage(gws.NodeDeletedMsgType, n)
-		t.notifyPeers(msg)
+		t.notifyPeers(msg, func(x *gws.Exporter) []*ws.StructMessage { return x.NodeDeleted(n) })
 	}
 }
 
@@ -307,7 +371,7 @@ func (t *TopologyReplicationEndpoint) OnNodeDeleted(n *graph.Node) {
 func (t *TopologyReplicationEndpoint) OnEdgeUpdated(e *graph.Edge) {
 	if t.replicateMsg.Load() == true {
 		msg := gws.NewStructMessage(gws.EdgeUpdatedMsgType, e)
-		t.notifyPeers(msg)
+		t.notifyPeers(msg, func(x *gws.Exporter) []*ws.StructMessage { return x.EdgeUpdated(e) })
 	}
 }
 
@@ -315,7 +379,7 @@ func (t *TopologyReplicationEndpoint) OnEdgeUpdated(e *graph.Edge) {
 func (t *TopologyReplicationEndpoint) OnEdgeAdded(e *graph.Edge) {
 	if t.replicateMsg.Load() == true {
 		msg := gws.NewStructMessage(gws.EdgeAddedMsgType, e)
-		t.notifyPeers(msg)
+		t.notifyPeers(msg, func(x *gws.Exporter) []*ws.StructMessage { return x.EdgeAdded(e) })
 	}
 }
 
@@ -323,7 +387,7 @@ func (t *TopologyReplicationEndpoint) OnEdgeAdded(e *graph.Edge) {
 func (t *TopologyReplicationEndpoint) OnEdgeDeleted(e *graph.Edge) {
 	if t.replicateMsg.Load() == true {
 		msg := gws.NewStructMessage(gws.EdgeDeletedMsgType, e)
-		t.notifyPeers(msg)
+		t.notifyPeers(msg, func(x *gws.Exporter) []*ws.StructMessage { return x.EdgeDeleted(e) })
 	}
 }
 
@@ -359,11 +423,11 @@ func (t *TopologyReplicationEndpoint) OnConnected(c ws.Speaker) {
 	// subscribe to websocket structured messages
 	c.(*ws.StructSpeaker).AddStructMessageHandler(t, []string{gws.Namespace})
 
-	msg := &gws.SyncMsg{
-		Elements: t.Graph.Elements(),
+	if t.readOnly() {
+		return
 	}
 
-	c.SendMessage(gws.NewStructMessage(gws.SyncMsgType, msg))
+	c.SendMessage(t.syncMsg(c))
 }
 
 // OnDisconnected is called when an incoming peer got disconnected.
@@ -379,6 +443,8 @@ func (t *TopologyReplicationEndpoint) OnDisconnected(c ws.Speaker) {
 		return
 	}
 
+	t.removeExporter(c)
+
 	origin := clientOrigin(c)
 	if t.Graph.Origin() == origin {
 		return
@@ -395,12 +461,27 @@ func (t *TopologyReplicationEndpoint) OnDisconnected(c ws.Speaker) {
 
 // NewTopologyReplicationEndpoint returns a new server to be used by other analyzers for replication.
 func NewTopologyReplicationEndpoint(pool ws.StructSpeakerPool, auth *shttp.AuthenticationOpts, cached *graph.CachedBackend, g *graph.Graph, peers []common.ServiceAddress) (*TopologyReplicationEndpoint, error) {
+	defaultExportFilter, err := config.NewExportFilter("analyzer.replication.export")
+	if err != nil {
+		return nil, err
+	}
+
+	exportFilters := make(map[string]*graph.ExportFilter)
+	for host := range config.GetConfig().GetStringMap("analyzer.replication.export.peers") {
+		if exportFilters[host], err = config.NewExportFilter("analyzer.replication.export.peers." + host); err != nil {
+			return nil, err
+		}
+	}
+
 	t := &TopologyReplicationEndpoint{
-		Graph:      g,
-		cached:     cached,
-		in:         pool,
-		out:        ws.NewStructClientPool("TopologyReplicationEndpoint"),
-		peerStates: make(map[string]*peerState),
+		Graph:               g,
+		cached:              cached,
+		in:                  pool,
+		out:                 ws.NewStructClientPool("TopologyReplicationEndpoint"),
+		peerStates:          make(map[string]*peerState),
+		exportFilters:       exportFilters,
+		defaultExportFilter: defaultExportFilter,
+		exporters:           make(map[ws.Speaker]*gws.Exporter),
 	}
 	t.replicateMsg.Store(true)
 
@@ -0,0 +1,123 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package hub
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	gws "github.com/skydive-project/skydive/graffiti/websocket"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+type fakeSpeaker struct {
+	ws.Speaker
+	types []string
+}
+
+func (s *fakeSpeaker) SendMessage(m ws.Message) error {
+	s.types = append(s.types, m.(*ws.StructMessage).Type)
+	return nil
+}
+
+func (s *fakeSpeaker) reset() []string {
+	types := s.types
+	s.types = nil
+	return types
+}
+
+type fakeSpeakerPool struct {
+	ws.StructSpeakerPool
+	speakers []ws.Speaker
+}
+
+func (p *fakeSpeakerPool) GetSpeakers() []ws.Speaker {
+	return p.speakers
+}
+
+func checkMessages(t *testing.T, step string, s *fakeSpeaker, expected ...string) {
+	types := s.reset()
+	if len(types) != len(expected) {
+		t.Errorf("%s: expected messages %v, got %v", step, expected, types)
+		return
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("%s: expected messages %v, got %v", step, expected, types)
+			return
+		}
+	}
+}
+
+func TestReplicationEdgeExport(t *testing.T) {
+	b, _ := graph.NewMemoryBackend()
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	host1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host1", "Type": "host"})
+	host2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host2", "Type": "host"})
+	intf, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "eth0", "Type": "device"})
+
+	filter, err := graph.NewExportFilter([]string{"Type=host"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered, unfiltered := &fakeSpeaker{}, &fakeSpeaker{}
+	exporter := gws.NewExporter(g, filter)
+	exporter.Sync()
+
+	endpoint := &TopologyReplicationEndpoint{
+		Graph:     g,
+		in:        &fakeSpeakerPool{speakers: []ws.Speaker{filtered, unfiltered}},
+		out:       ws.NewStructClientPool("TestReplicationEdgeExport"),
+		exporters: map[ws.Speaker]*gws.Exporter{filtered: exporter},
+	}
+	endpoint.replicateMsg.Store(true)
+
+	exported, _ := g.NewEdge(graph.GenID(), host1, host2, graph.Metadata{"RelationType": "layer2"})
+	hidden, _ := g.NewEdge(graph.GenID(), host1, intf, graph.Metadata{"RelationType": "ownership"})
+
+	endpoint.OnEdgeAdded(exported)
+	checkMessages(t, "exported edge added", filtered, gws.EdgeAddedMsgType)
+	checkMessages(t, "exported edge added", unfiltered, gws.EdgeAddedMsgType)
+
+	endpoint.OnEdgeAdded(hidden)
+	checkMessages(t, "filtered edge added", filtered)
+	checkMessages(t, "filtered edge added", unfiltered, gws.EdgeAddedMsgType)
+
+	endpoint.OnEdgeUpdated(exported)
+	checkMessages(t, "exported edge updated", filtered, gws.EdgeUpdatedMsgType)
+	checkMessages(t, "exported edge updated", unfiltered, gws.EdgeUpdatedMsgType)
+
+	endpoint.OnEdgeUpdated(hidden)
+	checkMessages(t, "filtered edge updated", filtered)
+	checkMessages(t, "filtered edge updated", unfiltered, gws.EdgeUpdatedMsgType)
+
+	endpoint.OnEdgeDeleted(exported)
+	checkMessages(t, "exported edge deleted", filtered, gws.EdgeDeletedMsgType)
+	checkMessages(t, "exported edge deleted", unfiltered, gws.EdgeDeletedMsgType)
+
+	endpoint.OnEdgeDeleted(hidden)
+	checkMessages(t, "filtered edge deleted", filtered)
+	checkMessages(t, "filtered edge deleted", unfiltered, gws.EdgeDeletedMsgType)
+
+	// an edge deleted once is not exported anymore
+	endpoint.OnEdgeUpdated(exported)
+	checkMessages(t, "deleted edge updated", filtered)
+}
@@ -18,6 +18,11 @@
 package pod
 
 import (
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
 	"github.com/skydive-project/skydive/graffiti/graph"
 	gws "github.com/skydive-project/skydive/graffiti/websocket"
 	"github.com/skydive-project/skydive/logging"
@@ -26,11 +31,40 @@ import (
 
 // TopologyForwarder forwards the topology to only one master server.
 // When switching from one analyzer to another one the agent does a full
-// re-sync since some messages could have been lost.
+// re-sync since some messages could have been lost. An export filter may
+// restrict the forwarded nodes and metadata. When a journal is kept, the
+// new master is first asked for the last event it got from this pod so that
+// only the missing events are sent.
 type TopologyForwarder struct {
+	sync.Mutex
 	masterElection *ws.MasterElection
 	graph          *graph.Graph
 	host           string
+	exporter       *gws.Exporter
+	journal        *journal
+	epoch          string
+	resuming       bool
+	resumeMaster   ws.Speaker
+	resumeTimer    *time.Timer
+}
+
+const resumeTimeout = 5 * time.Second
+
+// syncMsg returns the message re-adding all the nodes and edges, has to be
+// called with the graph and the forwarder locked
+func (t *TopologyForwarder) syncMsg() *ws.StructMessage {
+	var msg *gws.SyncMsg
+	if t.exporter != nil {
+		msg = t.exporter.Sync()
+	} else {
+		msg = &gws.SyncMsg{Elements: t.graph.Elements()}
+	}
+
+	if t.journal != nil {
+		msg.Epoch, msg.Seq = t.epoch, t.journal.lastSeq
+	}
+
+	return gws.NewStructMessage(gws.SyncMsgType, msg)
 }
 
 func (t *TopologyForwarder) triggerResync() {
@@ -39,11 +73,55 @@ func (t *TopologyForwarder) triggerResync() {
 	t.graph.RLock()
 	defer t.graph.RUnlock()
 
-	// re-add all the nodes and edges
-	msg := &gws.SyncMsg{
-		Elements: t.graph.Elements(),
+	t.Lock()
+	defer t.Unlock()
+
+	t.masterElection.SendMessageToMaster(t.syncMsg())
+}
+
+// resume sends to the given master the events it missed according to its
+// reply, or the whole graph if they are not in the journal anymore
+func (t *TopologyForwarder) resume(c ws.Speaker, reply *gws.ResumeMsg) {
+	t.graph.RLock()
+	defer t.graph.RUnlock()
+
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.resuming || t.resumeMaster != c {
+		return
+	}
+	t.resumeTimer.Stop()
+	t.resuming, t.resumeMaster = false, nil
+
+	if reply != nil && reply.Epoch == t.epoch {
+		if msgs, ok := t.journal.since(reply.Seq); ok {
+			logging.GetLogger().Infof("Resume the sync for %s from event %d, %d events to send", t.host, reply.Seq, len(msgs))
+			for _, msg := range msgs {
+				c.SendMessage(msg)
+			}
+			return
+		}
+	}
+
+	logging.GetLogger().Infof("Start a re-sync for %s", t.host)
+	c.SendMessage(t.syncMsg())
+}
+
+// forward journals and sends the messages to the master, unless a resume is
+// in progress in which case they will be part of it
+func (t *TopologyForwarder) forward(msgs ...*ws.StructMessage) {
+	t.Lock()
+	defer t.Unlock()
+
+	for _, msg := range msgs {
+		if t.journal != nil {
+			t.journal.add(msg)
+		}
+		if !t.resuming {
+			t.masterElection.SendMessageToMaster(msg)
+		}
 	}
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.SyncMsgType, msg))
 }
 
 // OnNewMaster is called by the master election mechanism when a new master is elected. In
@@ -51,42 +129,103 @@ func (t *TopologyForwarder) triggerResync() {
 func (t *TopologyForwarder) OnNewMaster(c ws.Speaker) {
 	if c == nil {
 		logging.GetLogger().Warn("Lost connection to master")
-	} else {
-		addr, port := c.GetAddrPort()
-		logging.GetLogger().Infof("Using %s:%d as master of topology forwarder", addr, port)
 
+		t.Lock()
+		if t.resuming {
+			t.resumeTimer.Stop()
+			t.resuming, t.resumeMaster = false, nil
+		}
+		t.Unlock()
+		return
+	}
+
+	addr, port := c.GetAddrPort()
+	logging.GetLogger().Infof("Using %s:%d as master of topology forwarder", addr, port)
+
+	if t.journal == nil {
 		t.triggerResync()
+		return
+	}
+
+	t.Lock()
+	if t.resuming {
+		t.resumeTimer.Stop()
+	}
+	t.resuming, t.resumeMaster = true, c
+	t.resumeTimer = time.AfterFunc(resumeTimeout, func() { t.resume(c, nil) })
+	t.Unlock()
+
+	c.SendMessage(gws.NewStructMessage(gws.ResumeRequestMsgType, &gws.ResumeMsg{Epoch: t.epoch}))
+}
+
+// OnStructMessage websocket message, resumes the sync with the reply of the master
+func (t *TopologyForwarder) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	if msg.Type != gws.ResumeReplyMsgType {
+		return
+	}
+
+	_, obj, err := gws.UnmarshalMessage(msg)
+	if err != nil {
+		logging.GetLogger().Errorf("Unable to parse resume reply from %s: %s", c.GetRemoteHost(), err)
+		obj = nil
 	}
+
+	reply, _ := obj.(*gws.ResumeMsg)
+	t.resume(c, reply)
 }
 
 // OnNodeUpdated graph node updated event. Implements the EventListener interface.
 func (t *TopologyForwarder) OnNodeUpdated(n *graph.Node) {
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.NodeUpdatedMsgType, n))
+	if t.exporter != nil {
+		t.forward(t.exporter.NodeUpdated(n)...)
+		return
+	}
+	t.forward(gws.NewStructMessage(gws.NodeUpdatedMsgType, n))
 }
 
 // OnNodeAdded graph node added event. Implements the EventListener interface.
 func (t *TopologyForwarder) OnNodeAdded(n *graph.Node) {
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.NodeAddedMsgType, n))
+	if t.exporter != nil {
+		t.forward(t.exporter.NodeAdded(n)...)
+		return
+	}
+	t.forward(gws.NewStructMessage(gws.NodeAddedMsgType, n))
 }
 
 // OnNodeDeleted graph node deleted event. Implements the EventListener interface.
 func (t *TopologyForwarder) OnNodeDeleted(n *graph.Node) {
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.NodeDeletedMsgType, n))
+	if t.exporter != nil {
+		t.forward(t.exporter.NodeDeleted(n)...)
+		return
+	}
+	t.forward(gws.NewStructMessage(gws.NodeDeletedMsgType, n))
 }
 
 // OnEdgeUpdated graph edge updated event. Implements the EventListener interface.
 func (t *TopologyForwarder) OnEdgeUpdated(e *graph.Edge) {
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.EdgeUpdatedMsgType, e))
+	if t.exporter != nil {
+		t.forward(t.exporter.EdgeUpdated(e)...)
+		return
+	}
+	t.forward(gws.NewStructMessage(gws.EdgeUpdatedMsgType, e))
 }
 
 // OnEdgeAdded graph edge added event. Implements the EventListener interface.
 func (t *TopologyForwarder) OnEdgeAdded(e *graph.Edge) {
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.EdgeAddedMsgType, e))
+	if t.exporter != nil {
+		t.forward(t.exporter.EdgeAdded(e)...)
+		return
+	}
+	t.forward(gws.NewStructMessage(gws.EdgeAddedMsgType, e))
 }
 
 // OnEdgeDeleted graph edge deleted event. Implements the EventListener interface.
 func (t *TopologyForwarder) OnEdgeDeleted(e *graph.Edge) {
-	t.masterElection.SendMessageToMaster(gws.NewStructMessage(gws.EdgeDeletedMsgType, e))
+	if t.exporter != nil {
+		t.forward(t.exporter.EdgeDeleted(e)...)
+		return
+	}
+	t.forward(gws.NewStructMessage(gws.EdgeDeletedMsgType, e))
 }
 
 // GetMaster returns the current analyzer the agent is sending its events to
@@ -95,8 +234,10 @@ func (t *TopologyForwarder) GetMaster() ws.Speaker {
 }
 
 // NewTopologyForwarder returns a new Graph forwarder which forwards event of the given graph
-// to the given WebSocket JSON speakers.
-func NewTopologyForwarder(host string, g *graph.Graph, pool ws.StructSpeakerPool) *TopologyForwarder {
+// to the given WebSocket JSON speakers. The whole graph is forwarded when the export
+// filter is nil. A journal of the last journalSize events is kept when
+// journalSize is positive.
+func NewTopologyForwarder(host string, g *graph.Graph, pool ws.StructSpeakerPool, exportFilter *graph.ExportFilter, journalSize int) *TopologyForwarder {
 	masterElection := ws.NewMasterElection(pool)
 
 	t := &TopologyForwarder{
@@ -105,6 +246,17 @@ func NewTopologyForwarder(host string, g *graph.Graph, pool ws.StructSpeakerPool
 		host:           host,
 	}
 
+	if exportFilter != nil && !exportFilter.IsEmpty() {
+		t.exporter = gws.NewExporter(g, exportFilter)
+	}
+
+	if journalSize > 0 {
+		u, _ := uuid.NewV4()
+		t.journal = newJournal(journalSize)
+		t.epoch = u.String()
+		pool.AddStructMessageHandler(t, []string{gws.Namespace})
+	}
+
 	masterElection.AddEventHandler(t)
 	g.AddEventListener(t)
 
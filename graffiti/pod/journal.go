@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pod
+
+import (
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// journal keeps the last messages forwarded to the hubs, indexed by their
+// sequence number, so that a hub missing the last ones can be resumed by
+// replaying them instead of a full sync
+type journal struct {
+	entries []*ws.StructMessage
+	lastSeq int64
+	count   int
+}
+
+// add records the next message and returns its sequence number
+func (j *journal) add(msg *ws.StructMessage) int64 {
+	j.lastSeq++
+	j.entries[j.lastSeq%int64(len(j.entries))] = msg
+	if j.count < len(j.entries) {
+		j.count++
+	}
+	return j.lastSeq
+}
+
+// since returns the messages following the given sequence number, false
+// if some of them are not in the journal anymore
+func (j *journal) since(seq int64) ([]*ws.StructMessage, bool) {
+	if seq > j.lastSeq || seq < j.lastSeq-int64(j.count) {
+		return nil, false
+	}
+
+	msgs := make([]*ws.StructMessage, 0, j.lastSeq-seq)
+	for s := seq + 1; s <= j.lastSeq; s++ {
+		msgs = append(msgs, j.entries[s%int64(len(j.entries))])
+	}
+	return msgs, true
+}
+
+func newJournal(size int) *journal {
+	return &journal{entries: make([]*ws.StructMessage, size)}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package pod
+
+import (
+	"testing"
+
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+func newJournalMessages(n int) []*ws.StructMessage {
+	msgs := make([]*ws.StructMessage, n)
+	for i := range msgs {
+		msgs[i] = ws.NewStructMessage("Graph", "NodeUpdated", i)
+	}
+	return msgs
+}
+
+func TestJournalSince(t *testing.T) {
+	j := newJournal(3)
+	msgs := newJournalMessages(5)
+
+	if replay, ok := j.since(0); !ok || len(replay) != 0 {
+		t.Fatalf("Expected nothing to replay on an empty journal, got %v, %v", replay, ok)
+	}
+
+	for i, msg := range msgs {
+		if seq := j.add(msg); seq != int64(i+1) {
+			t.Fatalf("Expected sequence number %d, got %d", i+1, seq)
+		}
+	}
+
+	replay, ok := j.since(3)
+	if !ok || len(replay) != 2 || replay[0] != msgs[3] || replay[1] != msgs[4] {
+		t.Fatalf("Expected the last 2 messages to be replayed, got %v, %v", replay, ok)
+	}
+
+	if replay, ok := j.since(2); !ok || len(replay) != 3 || replay[0] != msgs[2] {
+		t.Fatalf("Expected the last 3 messages to be replayed, got %v, %v", replay, ok)
+	}
+
+	if replay, ok := j.since(5); !ok || len(replay) != 0 {
+		t.Fatalf("Expected nothing to replay when up to date, got %v, %v", replay, ok)
+	}
+
+	if _, ok := j.since(1); ok {
+		t.Fatal("Expected the journal not to cover dropped messages")
+	}
+
+	if _, ok := j.since(6); ok {
+		t.Fatal("Expected the journal not to cover an unknown sequence number")
+	}
+}
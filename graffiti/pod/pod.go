@@ -90,8 +90,10 @@ func (p *Pod) TopologyForwarder() *TopologyForwarder {
 	return p.tforwarder
 }
 
-// NewPod returns a new pod
-func NewPod(server *api.Server, clientPool *websocket.StructClientPool, g *graph.Graph, apiAuthBackend shttp.AuthenticationBackend, clusterAuthOptions *shttp.AuthenticationOpts, tr *traversal.GremlinTraversalParser, writeCompression bool, queueSize int, pingDelay, pongTimeout time.Duration) (*Pod, error) {
+// NewPod returns a new pod, the export filter restricting the part of the graph
+// forwarded to the hubs and journalSize the number of events kept to resume
+// the synchronization with a hub
+func NewPod(server *api.Server, clientPool *websocket.StructClientPool, g *graph.Graph, apiAuthBackend shttp.AuthenticationBackend, clusterAuthOptions *shttp.AuthenticationOpts, tr *traversal.GremlinTraversalParser, writeCompression bool, queueSize int, pingDelay, pongTimeout time.Duration, exportFilter *graph.ExportFilter, journalSize int) (*Pod, error) {
 	opts := websocket.ServerOpts{
 		WriteCompression: writeCompression,
 		QueueSize:        queueSize,
@@ -106,7 +108,7 @@ func NewPod(server *api.Server, clientPool *websocket.StructClientPool, g *graph
 	subscriberWSServer := websocket.NewStructServer(newWSServer("/ws/subscriber", apiAuthBackend))
 	topologyEndpoint := NewTopologySubscriberEndpoint(subscriberWSServer, g, tr)
 
-	tforwarder := NewTopologyForwarder(server.HTTPServer.Host, g, clientPool)
+	tforwarder := NewTopologyForwarder(server.HTTPServer.Host, g, clientPool, exportFilter, journalSize)
 
 	return &Pod{
 		subscriberWSServer: subscriberWSServer,
@@ -0,0 +1,210 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package graph
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+// Exporter converts the events of a graph into the messages sent to a remote
+// graph according to an export filter. It keeps track of the exported
+// elements so that the nodes starting or stopping to match the filter are
+// added to or deleted from the remote graph. The graph lock has to be held
+// when calling its methods.
+type Exporter struct {
+	sync.Mutex
+	graph  *graph.Graph
+	filter *graph.ExportFilter
+	nodes  map[graph.Identifier]bool
+	edges  map[graph.Identifier]bool
+	// exported metadata of the nodes, used to skip the updates of the
+	// filtered out metadata only
+	metadata map[graph.Identifier][]byte
+}
+
+// metadataChanged records the exported metadata of a node and returns
+// whether they changed since the last time
+func (e *Exporter) metadataChanged(n *graph.Node) bool {
+	if !e.filter.FiltersMetadata() {
+		return true
+	}
+
+	data, err := json.Marshal(n.Metadata)
+	if err != nil {
+		return true
+	}
+
+	if previous, found := e.metadata[n.ID]; found && string(previous) == string(data) {
+		return false
+	}
+	e.metadata[n.ID] = data
+
+	return true
+}
+
+func (e *Exporter) forgetNode(id graph.Identifier) {
+	delete(e.nodes, id)
+	delete(e.metadata, id)
+}
+
+// SyncMsg returns the message initializing the remote graph
+func (e *Exporter) SyncMsg() *ws.StructMessage {
+	return NewStructMessage(SyncMsgType, e.Sync())
+}
+
+// Sync returns the elements initializing the remote graph
+func (e *Exporter) Sync() *SyncMsg {
+	e.Lock()
+	defer e.Unlock()
+
+	elements := e.filter.Elements(e.graph.Elements())
+
+	e.nodes = make(map[graph.Identifier]bool)
+	e.edges = make(map[graph.Identifier]bool)
+	e.metadata = make(map[graph.Identifier][]byte)
+
+	for _, n := range elements.Nodes {
+		e.nodes[n.ID] = true
+		e.metadataChanged(n)
+	}
+	for _, edge := range elements.Edges {
+		e.edges[edge.ID] = true
+	}
+
+	return &SyncMsg{Elements: elements}
+}
+
+func (e *Exporter) addNode(n *graph.Node) (msgs []*ws.StructMessage) {
+	exported := e.filter.Node(n)
+	e.nodes[n.ID] = true
+	e.metadataChanged(exported)
+	msgs = append(msgs, NewStructMessage(NodeAddedMsgType, exported))
+
+	// the edges linking the node to the already exported ones
+	for _, edge := range e.graph.GetNodeEdges(n, nil) {
+		if !e.edges[edge.ID] && e.nodes[edge.Parent] && e.nodes[edge.Child] {
+			e.edges[edge.ID] = true
+			msgs = append(msgs, NewStructMessage(EdgeAddedMsgType, e.filter.Edge(edge)))
+		}
+	}
+
+	return msgs
+}
+
+// NodeAdded returns the messages to send when a node is added
+func (e *Exporter) NodeAdded(n *graph.Node) []*ws.StructMessage {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.filter.MatchNode(n) {
+		return nil
+	}
+	return e.addNode(n)
+}
+
+// NodeUpdated returns the messages to send when a node is updated
+func (e *Exporter) NodeUpdated(n *graph.Node) []*ws.StructMessage {
+	e.Lock()
+	defer e.Unlock()
+
+	matched, exported := e.filter.MatchNode(n), e.nodes[n.ID]
+	switch {
+	case matched && exported:
+		node := e.filter.Node(n)
+		if e.metadataChanged(node) {
+			return []*ws.StructMessage{NewStructMessage(NodeUpdatedMsgType, node)}
+		}
+	case matched:
+		return e.addNode(n)
+	case exported:
+		// the remote graph deletes the edges of the node
+		for _, edge := range e.graph.GetNodeEdges(n, nil) {
+			delete(e.edges, edge.ID)
+		}
+		e.forgetNode(n.ID)
+		return []*ws.StructMessage{NewStructMessage(NodeDeletedMsgType, e.filter.Node(n))}
+	}
+
+	return nil
+}
+
+// NodeDeleted returns the messages to send when a node is deleted
+func (e *Exporter) NodeDeleted(n *graph.Node) []*ws.StructMessage {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.nodes[n.ID] {
+		return nil
+	}
+	e.forgetNode(n.ID)
+
+	return []*ws.StructMessage{NewStructMessage(NodeDeletedMsgType, e.filter.Node(n))}
+}
+
+// EdgeAdded returns the messages to send when an edge is added
+func (e *Exporter) EdgeAdded(edge *graph.Edge) []*ws.StructMessage {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.nodes[edge.Parent] || !e.nodes[edge.Child] {
+		return nil
+	}
+	e.edges[edge.ID] = true
+
+	return []*ws.StructMessage{NewStructMessage(EdgeAddedMsgType, e.filter.Edge(edge))}
+}
+
+// EdgeUpdated returns the messages to send when an edge is updated
+func (e *Exporter) EdgeUpdated(edge *graph.Edge) []*ws.StructMessage {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.edges[edge.ID] {
+		return nil
+	}
+
+	return []*ws.StructMessage{NewStructMessage(EdgeUpdatedMsgType, e.filter.Edge(edge))}
+}
+
+// EdgeDeleted returns the messages to send when an edge is deleted
+func (e *Exporter) EdgeDeleted(edge *graph.Edge) []*ws.StructMessage {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.edges[edge.ID] {
+		return nil
+	}
+	delete(e.edges, edge.ID)
+
+	return []*ws.StructMessage{NewStructMessage(EdgeDeletedMsgType, e.filter.Edge(edge))}
+}
+
+// NewExporter returns a new exporter of the graph
+func NewExporter(g *graph.Graph, filter *graph.ExportFilter) *Exporter {
+	return &Exporter{
+		graph:    g,
+		filter:   filter,
+		nodes:    make(map[graph.Identifier]bool),
+		edges:    make(map[graph.Identifier]bool),
+		metadata: make(map[graph.Identifier][]byte),
+	}
+}
@@ -42,6 +42,9 @@ const (
 	EdgeUpdatedMsgType = "EdgeUpdated"
 	EdgeDeletedMsgType = "EdgeDeleted"
 	EdgeAddedMsgType   = "EdgeAdded"
+
+	ResumeRequestMsgType = "ResumeRequest"
+	ResumeReplyMsgType   = "ResumeReply"
 )
 
 // Graph error message
@@ -56,9 +59,22 @@ type SyncRequestMsg struct {
 	GremlinFilter string
 }
 
-// SyncMsg describes graph synchro message
+// SyncMsg describes graph synchro message. Epoch and Seq are set by the
+// pods keeping a journal of their events, Seq being the sequence number of
+// the last event included in the elements.
 type SyncMsg struct {
 	*graph.Elements
+	Epoch string `json:",omitempty"`
+	Seq   int64  `json:",omitempty"`
+}
+
+// ResumeMsg describes a position in the journal of a pod. A pod sends its
+// epoch to its new hub in a ResumeRequest, the hub replying with the
+// sequence number of the last event of that epoch it applied, the epoch
+// being empty if unknown.
+type ResumeMsg struct {
+	Epoch string
+	Seq   int64
 }
 
 // NewStructMessage returns a new graffiti websocket StructMessage
@@ -100,6 +116,12 @@ func UnmarshalMessage(msg *ws.StructMessage) (string, interface{}, error) {
 			return "", msg, err
 		}
 		return msg.Type, &syncMsg, nil
+	case ResumeRequestMsgType, ResumeReplyMsgType:
+		var resumeMsg ResumeMsg
+		if err := json.Unmarshal(msg.Obj, &resumeMsg); err != nil {
+			return "", msg, err
+		}
+		return msg.Type, &resumeMsg, nil
 	case NodeUpdatedMsgType, NodeDeletedMsgType, NodeAddedMsgType:
 		var node graph.Node
 		if err := json.Unmarshal(msg.Obj, &node); err != nil {
@@ -78,6 +78,11 @@ func (q QueryString) At(list ...interface{}) QueryString {
 	return q.newQueryString("At", list...)
 }
 
+// Avg append a Avg() operation to query
+func (q QueryString) Avg(list ...interface{}) QueryString {
+	return q.newQueryString("Avg", list...)
+}
+
 // Both append a Both() operation to query
 func (q QueryString) Both(list ...interface{}) QueryString {
 	return q.newQueryString("Both", list...)
@@ -142,21 +147,41 @@ func (q QueryString) Dedup() QueryString {
 	return q.newQueryString("Dedup")
 }
 
+// E append a E() operation to query
+func (q QueryString) E(list ...interface{}) QueryString {
+	return q.newQueryString("E", list...)
+}
+
 // Flows append a Flows() operation to query
 func (q QueryString) Flows(list ...interface{}) QueryString {
 	return q.newQueryString("Flows", list...)
 }
 
+// GroupBy append a GroupBy() operation to query
+func (q QueryString) GroupBy(list ...interface{}) QueryString {
+	return q.newQueryString("GroupBy", list...)
+}
+
 // Has append a Has() operation to query
 func (q QueryString) Has(list ...interface{}) QueryString {
 	return q.newQueryString("Has", list...)
 }
 
+// HasEither append a HasEither() operation to query
+func (q QueryString) HasEither(list ...interface{}) QueryString {
+	return q.newQueryString("HasEither", list...)
+}
+
 // HasKey append a HasKey() operation to query
 func (q QueryString) HasKey(v interface{}) QueryString {
 	return q.newQueryString("HasKey", v)
 }
 
+// HasNot append a HasNot() operation to query
+func (q QueryString) HasNot(v interface{}) QueryString {
+	return q.newQueryString("HasNot", v)
+}
+
 // Hops append a Hops() operation to query
 func (q QueryString) Hops() QueryString {
 	return q.newQueryString("Hops")
@@ -187,6 +212,16 @@ func (q QueryString) BothV(list ...interface{}) QueryString {
 	return q.newQueryString("BothV", list...)
 }
 
+// Limit append a Limit() operation to query
+func (q QueryString) Limit(v interface{}) QueryString {
+	return q.newQueryString("Limit", v)
+}
+
+// Max append a Max() operation to query
+func (q QueryString) Max(list ...interface{}) QueryString {
+	return q.newQueryString("Max", list...)
+}
+
 // Metrics append a Metrics() operation to query
 func (q QueryString) Metrics(key ...interface{}) QueryString {
 	return q.newQueryString("Metrics", key...)
@@ -217,11 +252,21 @@ func (q QueryString) OutV(list ...interface{}) QueryString {
 	return q.newQueryString("OutV", list...)
 }
 
+// Percentile append a Percentile() operation to query
+func (q QueryString) Percentile(list ...interface{}) QueryString {
+	return q.newQueryString("Percentile", list...)
+}
+
 // RawPackets append a RawPackets() operation to query
 func (q QueryString) RawPackets() QueryString {
 	return q.newQueryString("RawPackets")
 }
 
+// ShortestPath append a ShortestPath() operation to query
+func (q QueryString) ShortestPath(list ...interface{}) QueryString {
+	return q.newQueryString("ShortestPath", list...)
+}
+
 // ShortestPathTo append a ShortestPathTo() operation to query
 func (q QueryString) ShortestPathTo(list ...interface{}) QueryString {
 	return q.newQueryString("ShortestPathTo", list...)
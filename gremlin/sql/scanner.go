@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	eofToken tokenType = iota
+	identToken
+	keywordToken
+	stringToken
+	numberToken
+	symbolToken
+)
+
+type token struct {
+	typ   tokenType
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	if t.typ == eofToken {
+		return "end of query"
+	}
+	return fmt.Sprintf("'%s' at position %d", t.value, t.pos+1)
+}
+
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true,
+	"NOT": true, "IN": true, "LIKE": true, "IS": true, "NULL": true,
+	"ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true,
+	"COUNT": true, "SUM": true, "TRUE": true, "FALSE": true,
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// scan splits a query into tokens, the keywords being upper cased
+func scan(query string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case r == '\'' || r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("Unterminated string at position %d", start+1)
+			}
+			tokens = append(tokens, token{typ: stringToken, value: string(runes[i+1 : end]), pos: start})
+			i = end + 1
+
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{typ: numberToken, value: string(runes[start:i]), pos: start})
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && isIdentRune(runes[i]) {
+				i++
+			}
+			value := string(runes[start:i])
+			if upper := strings.ToUpper(value); keywords[upper] {
+				tokens = append(tokens, token{typ: keywordToken, value: upper, pos: start})
+			} else {
+				tokens = append(tokens, token{typ: identToken, value: value, pos: start})
+			}
+
+		default:
+			symbol := string(r)
+			if i+1 < len(runes) {
+				switch two := string(runes[i : i+2]); two {
+				case "!=", "<>", "<=", ">=":
+					symbol = two
+				}
+			}
+			if !strings.Contains("*,()=<>", symbol) && len(symbol) == 1 {
+				return nil, fmt.Errorf("Unexpected character '%c' at position %d", r, start+1)
+			}
+			tokens = append(tokens, token{typ: symbolToken, value: symbol, pos: start})
+			i += len(symbol)
+		}
+	}
+
+	return append(tokens, token{typ: eofToken, pos: len(runes)}), nil
+}
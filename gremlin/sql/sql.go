@@ -0,0 +1,390 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package sql implements a SQL-like frontend to the Gremlin queries,
+// limited to the flat filtering and projection of nodes, edges or flows, like
+//
+//	SELECT Name FROM nodes WHERE Type = 'veth' AND MTU >= 1500 ORDER BY Name LIMIT 10
+//
+// which is compiled to
+//
+//	G.V().Has("Type", "veth", "MTU", Gte(1500)).Sort("Name").Limit(10).Values("Name")
+package sql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/skydive-project/skydive/gremlin"
+)
+
+var sources = map[string]gremlin.QueryString{
+	"NODES": gremlin.G.V(),
+	"EDGES": gremlin.G.E(),
+	"FLOWS": gremlin.G.Flows(),
+}
+
+type projection struct {
+	function string
+	field    string
+}
+
+// predicate is either a metadata filter or a check of the metadata presence
+type predicate struct {
+	field   string
+	value   gremlin.ValueString
+	present *bool
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != eofToken {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given keyword or symbol
+func (p *parser) accept(typ tokenType, value string) bool {
+	if t := p.peek(); t.typ == typ && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(typ tokenType, value string) error {
+	if !p.accept(typ, value) {
+		return fmt.Errorf("Expected %s, got %s", value, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) field() (string, error) {
+	t := p.next()
+	if t.typ != identToken {
+		return "", fmt.Errorf("Expected a field name, got %s", t)
+	}
+	return t.value, nil
+}
+
+func (p *parser) value() (gremlin.ValueString, error) {
+	t := p.next()
+	switch t.typ {
+	case stringToken:
+		if strings.ContainsAny(t.value, `'"`) {
+			return "", fmt.Errorf("Quotes are not supported within the string %s", t)
+		}
+		return gremlin.Quote("%s", t.value), nil
+	case numberToken:
+		if _, err := strconv.ParseFloat(t.value, 64); err != nil {
+			return "", fmt.Errorf("Invalid number %s", t)
+		}
+		return gremlin.ValueString(t.value), nil
+	case keywordToken:
+		if t.value == "TRUE" || t.value == "FALSE" {
+			return gremlin.NewValueStringFromArgument(t.value == "TRUE"), nil
+		}
+	}
+	return "", fmt.Errorf("Expected a value, got %s", t)
+}
+
+func (p *parser) projection() (*projection, error) {
+	if p.accept(symbolToken, "*") {
+		return &projection{}, nil
+	}
+
+	for _, function := range []string{"COUNT", "SUM"} {
+		if !p.accept(keywordToken, function) {
+			continue
+		}
+
+		if err := p.expect(symbolToken, "("); err != nil {
+			return nil, err
+		}
+
+		proj := &projection{function: function}
+		if function == "COUNT" {
+			if err := p.expect(symbolToken, "*"); err != nil {
+				return nil, err
+			}
+		} else {
+			field, err := p.field()
+			if err != nil {
+				return nil, err
+			}
+			proj.field = field
+		}
+
+		return proj, p.expect(symbolToken, ")")
+	}
+
+	field, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().value == "," {
+		return nil, fmt.Errorf("Only one field can be selected, got %s", p.peek())
+	}
+
+	return &projection{field: field}, nil
+}
+
+// likeToRegex converts a LIKE pattern to an anchored regular expression
+func likeToRegex(pattern string) string {
+	var re string
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			re += ".*"
+		case '_':
+			re += "."
+		default:
+			re += regexp.QuoteMeta(string(r))
+		}
+	}
+	return "^" + re + "$"
+}
+
+func (p *parser) predicate() (*predicate, error) {
+	field, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	pred := &predicate{field: field}
+
+	if p.accept(keywordToken, "IS") {
+		present := p.accept(keywordToken, "NOT")
+		pred.present = &present
+		return pred, p.expect(keywordToken, "NULL")
+	}
+
+	not := p.accept(keywordToken, "NOT")
+
+	switch t := p.next(); {
+	case t.typ == keywordToken && t.value == "IN":
+		if err := p.expect(symbolToken, "("); err != nil {
+			return nil, err
+		}
+
+		var values []interface{}
+		for {
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+
+			if !p.accept(symbolToken, ",") {
+				break
+			}
+		}
+
+		if err := p.expect(symbolToken, ")"); err != nil {
+			return nil, err
+		}
+
+		if not {
+			pred.value = gremlin.Without(values...)
+		} else {
+			pred.value = gremlin.Within(values...)
+		}
+
+	case t.typ == keywordToken && t.value == "LIKE":
+		if not {
+			return nil, fmt.Errorf("NOT LIKE is not supported")
+		}
+
+		pattern := p.next()
+		if pattern.typ != stringToken || strings.ContainsAny(pattern.value, `'"`) {
+			return nil, fmt.Errorf("Expected a pattern, got %s", pattern)
+		}
+		pred.value = gremlin.Regex("%s", likeToRegex(pattern.value))
+
+	case not:
+		return nil, fmt.Errorf("Expected IN or LIKE, got %s", t)
+
+	case t.typ == symbolToken:
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t.value {
+		case "=":
+			pred.value = value
+		case "!=", "<>":
+			pred.value = gremlin.Ne(value)
+		case "<":
+			pred.value = gremlin.Lt(value)
+		case "<=":
+			pred.value = gremlin.Lte(value)
+		case ">":
+			pred.value = gremlin.Gt(value)
+		case ">=":
+			pred.value = gremlin.Gte(value)
+		default:
+			return nil, fmt.Errorf("Expected an operator, got %s", t)
+		}
+
+	default:
+		return nil, fmt.Errorf("Expected an operator, got %s", t)
+	}
+
+	return pred, nil
+}
+
+// where parses the predicates of the WHERE clause, either all joined by AND
+// or all joined by OR as the Gremlin steps can't nest the filters
+func (p *parser) where() ([]*predicate, bool, error) {
+	var predicates []*predicate
+	var connective string
+	for {
+		pred, err := p.predicate()
+		if err != nil {
+			return nil, false, err
+		}
+		predicates = append(predicates, pred)
+
+		t := p.peek()
+		if t.typ != keywordToken || (t.value != "AND" && t.value != "OR") {
+			return predicates, connective == "OR", nil
+		}
+		if connective != "" && connective != t.value {
+			return nil, false, fmt.Errorf("Mixing AND and OR is not supported, got %s", t)
+		}
+		connective = p.next().value
+	}
+}
+
+// Compile translates a SQL-like query into a Gremlin query. The supported
+// syntax is
+//
+//	SELECT <* | field | COUNT(*) | SUM(field)> FROM <nodes | edges | flows>
+//	  [WHERE predicate [AND predicate ...] | predicate [OR predicate ...]]
+//	  [ORDER BY field [ASC | DESC]] [LIMIT count]
+//
+// where a predicate is one of field <op> value with op being =, !=, <>, <,
+// <=, > or >=, field [NOT] IN (value, ...), field LIKE pattern or
+// field IS [NOT] NULL.
+func Compile(query string) (string, error) {
+	tokens, err := scan(query)
+	if err != nil {
+		return "", err
+	}
+	p := &parser{tokens: tokens}
+
+	if err := p.expect(keywordToken, "SELECT"); err != nil {
+		return "", err
+	}
+
+	proj, err := p.projection()
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.expect(keywordToken, "FROM"); err != nil {
+		return "", err
+	}
+
+	from := p.next()
+	q, found := sources[strings.ToUpper(from.value)]
+	if from.typ != identToken || !found {
+		return "", fmt.Errorf("Expected nodes, edges or flows, got %s", from)
+	}
+
+	if p.accept(keywordToken, "WHERE") {
+		predicates, or, err := p.where()
+		if err != nil {
+			return "", err
+		}
+
+		var filters []interface{}
+		for _, pred := range predicates {
+			switch {
+			case pred.present == nil:
+				filters = append(filters, gremlin.Quote("%s", pred.field), pred.value)
+			case or:
+				return "", fmt.Errorf("IS NULL can't be used with OR")
+			case *pred.present:
+				q = q.HasKey(pred.field)
+			default:
+				q = q.HasNot(pred.field)
+			}
+		}
+
+		if or {
+			q = q.HasEither(filters...)
+		} else if len(filters) > 0 {
+			q = q.Has(filters...)
+		}
+	}
+
+	if p.accept(keywordToken, "ORDER") {
+		if err := p.expect(keywordToken, "BY"); err != nil {
+			return "", err
+		}
+
+		field, err := p.field()
+		if err != nil {
+			return "", err
+		}
+
+		if p.accept(keywordToken, "DESC") {
+			q = q.Sort(gremlin.DESC, field)
+		} else {
+			p.accept(keywordToken, "ASC")
+			q = q.Sort(field)
+		}
+	}
+
+	if p.accept(keywordToken, "LIMIT") {
+		t := p.next()
+		limit, err := strconv.ParseUint(t.value, 10, 32)
+		if t.typ != numberToken || err != nil {
+			return "", fmt.Errorf("Expected a positive limit, got %s", t)
+		}
+		q = q.Limit(limit)
+	}
+
+	if t := p.peek(); t.typ != eofToken {
+		return "", fmt.Errorf("Unexpected %s", t)
+	}
+
+	switch {
+	case proj.function == "COUNT":
+		q = q.Count()
+	case proj.function == "SUM":
+		q = q.Sum(proj.field)
+	case proj.field != "":
+		q = q.Values(proj.field)
+	}
+
+	return q.String(), nil
+}
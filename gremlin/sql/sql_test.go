@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package sql
+
+import (
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT * FROM nodes", `G.V()`},
+		{"select * from Edges where RelationType = 'layer2'", `G.E().Has("RelationType", "layer2")`},
+		{
+			"SELECT Name FROM nodes WHERE Type = 'veth' AND MTU >= 1500 ORDER BY Name LIMIT 10",
+			`G.V().Has("Type", "veth", "MTU", Gte(1500)).Sort("Name").Limit(10).Values("Name")`,
+		},
+		{
+			`SELECT COUNT(*) FROM nodes WHERE Type IN ("host", 'netns') OR Name LIKE 'eth%'`,
+			`G.V().HasEither("Type", Within("host", "netns"), "Name", Regex("^eth.*$")).Count()`,
+		},
+		{
+			"SELECT * FROM nodes WHERE Neutron.PortID IS NOT NULL AND Docker IS NULL AND State <> 'DOWN' ORDER BY Name DESC",
+			`G.V().HasKey("Neutron.PortID").HasNot("Docker").Has("State", Ne("DOWN")).Sort(DESC, "Name")`,
+		},
+		{
+			"SELECT SUM(Metric.ABBytes) FROM flows WHERE Application NOT IN ('ARP') AND Metric.RTT < 0.5",
+			`G.Flows().Has("Application", Without("ARP"), "Metric.RTT", Lt(0.5)).Sum("Metric.ABBytes")`,
+		},
+		{"SELECT * FROM nodes WHERE Manager != 'k8s' AND Capture.PCAPSocket = false", `G.V().Has("Manager", Ne("k8s"), "Capture.PCAPSocket", false)`},
+		{"SELECT * FROM nodes WHERE Name LIKE 'a.b_c'", `G.V().Has("Name", Regex("^a\.b.c$"))`},
+	}
+
+	for _, test := range tests {
+		actual, err := Compile(test.query)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %s", test.query, err)
+			continue
+		}
+		if actual != test.expected {
+			t.Errorf("Wrong query for %s,\nexpected: %s,\nactual: %s", test.query, test.expected, actual)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"SELECT * FROM",
+		"SELECT * FROM hosts",
+		"SELECT Name, Type FROM nodes",
+		"SELECT * FROM nodes WHERE Type = 'host' AND Name = 'a' OR Name = 'b'",
+		"SELECT * FROM nodes WHERE Type IS NULL OR Name = 'a'",
+		"SELECT * FROM nodes WHERE Type = 'host",
+		"SELECT * FROM nodes WHERE Name = 'it\"s'",
+		"SELECT * FROM nodes WHERE Name NOT LIKE 'a%'",
+		"SELECT * FROM nodes LIMIT -1",
+		"SELECT * FROM nodes WHERE MTU ! 1500",
+		"SELECT * FROM nodes ORDER Name",
+		"SELECT * FROM nodes extra",
+	} {
+		if q, err := Compile(query); err == nil {
+			t.Errorf("Expected an error for %s, got %s", query, q)
+		}
+	}
+}
@@ -65,19 +65,19 @@ type fakeTableClient struct {
 	t *flow.Table
 }
 
-func (tc *fakeTableClient) LookupFlows(flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
+func (tc *fakeTableClient) LookupFlows(flowSearchQuery filters.SearchQuery, deadline time.Time) (*flow.FlowSet, bool, error) {
 	resp := tc.t.Query(&flow.TableQuery{Type: "SearchQuery", Query: &flowSearchQuery})
 
 	fs := flow.NewFlowSet()
 	if err := proto.Unmarshal(resp, fs); err != nil {
-		return nil, errors.New("Unable to decode flow search reply")
+		return nil, false, errors.New("Unable to decode flow search reply")
 	}
 
-	return fs, nil
+	return fs, false, nil
 }
 
-func (tc *fakeTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery) (*flow.FlowSet, error) {
-	return tc.LookupFlows(flowSearchQuery)
+func (tc *fakeTableClient) LookupFlowsByNodes(hnmap topology.HostNodeTIDMap, flowSearchQuery filters.SearchQuery, deadline time.Time) (*flow.FlowSet, bool, error) {
+	return tc.LookupFlows(flowSearchQuery, deadline)
 }
 
 func execTraversalQuery(t *testing.T, tc *fakeTableClient, query string) traversal.GraphTraversalStep {
@@ -643,6 +643,7 @@ func (f *FlowTraversalStep) RawPackets(ctx traversal.StepContext) *RawPacketsTra
 				rawPackets[fl.UUID] = &flow.RawPackets{
 					LinkType:   linkType,
 					RawPackets: fl.LastRawPackets,
+					NodeTID:    fl.NodeTID,
 				}
 			}
 		}
@@ -899,13 +900,18 @@ func (s *FlowGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (trav
 			return nil, err
 		}
 	} else {
+		var truncated bool
 		if len(nodes) != 0 {
 			graphTraversal.RLock()
 			hnmap := topology.BuildHostNodeTIDMap(nodes)
 			graphTraversal.RUnlock()
-			flowset, err = s.TableClient.LookupFlowsByNodes(hnmap, flowSearchQuery)
+			flowset, truncated, err = s.TableClient.LookupFlowsByNodes(hnmap, flowSearchQuery, graphTraversal.Deadline())
 		} else {
-			flowset, err = s.TableClient.LookupFlows(flowSearchQuery)
+			flowset, truncated, err = s.TableClient.LookupFlows(flowSearchQuery, graphTraversal.Deadline())
+		}
+
+		if truncated {
+			graphTraversal.Truncate()
 		}
 	}
 
@@ -0,0 +1,303 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+// GroupByTraversalExtension describes a new extension to group the flows
+// and to reduce their metrics
+type GroupByTraversalExtension struct {
+	GroupByToken    traversal.Token
+	AvgToken        traversal.Token
+	MaxToken        traversal.Token
+	PercentileToken traversal.Token
+}
+
+// GroupByGremlinTraversalStep groups the flows by the value of a field
+type GroupByGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+	key string
+}
+
+// ReducerGremlinTraversalStep reduces a field of the flows to a value,
+// per group if the flows were grouped
+type ReducerGremlinTraversalStep struct {
+	traversal.GremlinTraversalContext
+	reducer    string
+	key        string
+	percentile float64
+}
+
+// FlowGroupTraversalStep flows grouped by the value of a field
+type FlowGroupTraversalStep struct {
+	GraphTraversal *traversal.GraphTraversal
+	groups         map[string][]*flow.Flow
+	error          error
+}
+
+// NewGroupByTraversalExtension returns a new graph traversal extension
+func NewGroupByTraversalExtension() *GroupByTraversalExtension {
+	return &GroupByTraversalExtension{
+		GroupByToken:    traversalGroupByToken,
+		AvgToken:        traversalAvgToken,
+		MaxToken:        traversalMaxToken,
+		PercentileToken: traversalPercentileToken,
+	}
+}
+
+// ScanIdent returns an associated graph token
+func (e *GroupByTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
+	switch s {
+	case "GROUPBY":
+		return e.GroupByToken, true
+	case "AVG":
+		return e.AvgToken, true
+	case "MAX":
+		return e.MaxToken, true
+	case "PERCENTILE":
+		return e.PercentileToken, true
+	}
+	return traversal.IDENT, false
+}
+
+// ParseStep parses group by and reducer steps
+func (e *GroupByTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	var reducer string
+	switch t {
+	case e.GroupByToken:
+		reducer = "GroupBy"
+	case e.AvgToken:
+		reducer = "Avg"
+	case e.MaxToken:
+		reducer = "Max"
+	case e.PercentileToken:
+		reducer = "Percentile"
+	default:
+		return nil, nil
+	}
+
+	expected := 1
+	if reducer == "Percentile" {
+		expected = 2
+	}
+
+	if len(p.Params) != expected {
+		return nil, fmt.Errorf("%s requires %d parameter(s): %v", reducer, expected, p.Params)
+	}
+
+	key, ok := p.Params[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s first parameter has to be a string key", reducer)
+	}
+
+	if reducer == "GroupBy" {
+		return &GroupByGremlinTraversalStep{GremlinTraversalContext: p, key: key}, nil
+	}
+
+	step := &ReducerGremlinTraversalStep{GremlinTraversalContext: p, reducer: reducer, key: key}
+
+	if reducer == "Percentile" {
+		percentile, err := common.ToFloat64(p.Params[1])
+		if err != nil || percentile <= 0 || percentile > 100 {
+			return nil, errors.New("Percentile second parameter has to be a number between 0 and 100")
+		}
+		step.percentile = percentile
+	}
+
+	return step, nil
+}
+
+// Exec GroupBy step
+func (s *GroupByGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch f := last.(type) {
+	case *FlowTraversalStep:
+		if f.error != nil {
+			return nil, f.error
+		}
+		return NewFlowGroupTraversalStep(f.GraphTraversal, groupFlows(f.flowset.Flows, s.key)), nil
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce GroupBy step
+func (s *GroupByGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Exec reducer step
+func (s *ReducerGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	var value *traversal.GraphTraversalValue
+	switch f := last.(type) {
+	case *FlowTraversalStep:
+		if f.error != nil {
+			return nil, f.error
+		}
+		value = reduceFlowsValue(f.GraphTraversal, f.flowset.Flows, s.reducer, s.key, s.percentile)
+	case *FlowGroupTraversalStep:
+		value = f.reduce(s.reducer, s.key, s.percentile)
+	default:
+		return nil, traversal.ErrExecutionError
+	}
+	return value, value.Error()
+}
+
+// Reduce reducer step
+func (s *ReducerGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// groupFlows groups the flows by the value of a field, the flows without
+// this field being left apart
+func groupFlows(flows []*flow.Flow, key string) map[string][]*flow.Flow {
+	groups := make(map[string][]*flow.Flow)
+	for _, fl := range flows {
+		v, err := fl.GetField(key)
+		if err != nil {
+			continue
+		}
+		group := fmt.Sprintf("%v", v)
+		groups[group] = append(groups[group], fl)
+	}
+	return groups
+}
+
+// reduceFlows reduces the integer values of a field of the flows
+func reduceFlows(flows []*flow.Flow, reducer, key string, percentile float64) (float64, error) {
+	values := make([]float64, len(flows))
+	for i, fl := range flows {
+		v, err := fl.GetFieldInt64(key)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s", key, err)
+		}
+		values[i] = float64(v)
+	}
+
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	var r float64
+	switch reducer {
+	case "Sum", "Avg":
+		for _, v := range values {
+			r += v
+		}
+		if reducer == "Avg" {
+			r /= float64(len(values))
+		}
+	case "Max":
+		r = values[0]
+		for _, v := range values[1:] {
+			r = math.Max(r, v)
+		}
+	case "Percentile":
+		// nearest rank method
+		sort.Float64s(values)
+		rank := int(math.Ceil(percentile / 100 * float64(len(values))))
+		if rank < 1 {
+			rank = 1
+		}
+		r = values[rank-1]
+	default:
+		return 0, fmt.Errorf("Unknown reducer %s", reducer)
+	}
+	return r, nil
+}
+
+func reduceFlowsValue(gt *traversal.GraphTraversal, flows []*flow.Flow, reducer, key string, percentile float64) *traversal.GraphTraversalValue {
+	r, err := reduceFlows(flows, reducer, key, percentile)
+	if err != nil {
+		return traversal.NewGraphTraversalValueFromError(err)
+	}
+	return traversal.NewGraphTraversalValue(gt, r)
+}
+
+// NewFlowGroupTraversalStep creates a new traversal step of grouped flows
+func NewFlowGroupTraversalStep(gt *traversal.GraphTraversal, groups map[string][]*flow.Flow) *FlowGroupTraversalStep {
+	return &FlowGroupTraversalStep{
+		GraphTraversal: gt,
+		groups:         groups,
+	}
+}
+
+func (f *FlowGroupTraversalStep) reduce(reducer, key string, percentile float64) *traversal.GraphTraversalValue {
+	if f.error != nil {
+		return traversal.NewGraphTraversalValueFromError(f.error)
+	}
+
+	values := make(map[string]float64, len(f.groups))
+	for group, flows := range f.groups {
+		r, err := reduceFlows(flows, reducer, key, percentile)
+		if err != nil {
+			return traversal.NewGraphTraversalValueFromError(err)
+		}
+		values[group] = r
+	}
+	return traversal.NewGraphTraversalValue(f.GraphTraversal, values)
+}
+
+// Sum step, sums a field of the flows of each group
+func (f *FlowGroupTraversalStep) Sum(ctx traversal.StepContext, keys ...interface{}) *traversal.GraphTraversalValue {
+	if len(keys) != 1 {
+		return traversal.NewGraphTraversalValueFromError(errors.New("Sum requires 1 parameter"))
+	}
+
+	key, ok := keys[0].(string)
+	if !ok {
+		return traversal.NewGraphTraversalValueFromError(errors.New("Sum parameter has to be a string key"))
+	}
+
+	return f.reduce("Sum", key, 0)
+}
+
+// Count step, counts the flows of each group
+func (f *FlowGroupTraversalStep) Count(ctx traversal.StepContext, s ...interface{}) *traversal.GraphTraversalValue {
+	if f.error != nil {
+		return traversal.NewGraphTraversalValueFromError(f.error)
+	}
+
+	counts := make(map[string]int, len(f.groups))
+	for group, flows := range f.groups {
+		counts[group] = len(flows)
+	}
+	return traversal.NewGraphTraversalValue(f.GraphTraversal, counts)
+}
+
+// Values returns the groups of flows
+func (f *FlowGroupTraversalStep) Values() []interface{} {
+	return []interface{}{f.groups}
+}
+
+// MarshalJSON serialize in JSON
+func (f *FlowGroupTraversalStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Values())
+}
+
+func (f *FlowGroupTraversalStep) Error() error {
+	return f.error
+}
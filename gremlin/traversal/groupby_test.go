@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func execGroupByQuery(t *testing.T, tc *fakeTableClient, query string) interface{} {
+	tr := traversal.NewGremlinTraversalParser()
+	tr.AddTraversalExtension(NewFlowTraversalExtension(tc, nil))
+	tr.AddTraversalExtension(NewGroupByTraversalExtension())
+
+	ts, err := tr.Parse(strings.NewReader(query))
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	res, err := ts.Exec(tc.g, false)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	values := res.Values()
+	if len(values) != 1 {
+		t.Fatalf("%s: should return 1 result, returned: %v", query, values)
+	}
+	return values[0]
+}
+
+func newMetricFlow(nodeTID string, bytes int64) *flow.Flow {
+	f := newICMPFlow(uint32(bytes))
+	f.NodeTID = nodeTID
+	f.Metric = &flow.FlowMetric{ABBytes: bytes}
+	return f
+}
+
+func TestGroupByStep(t *testing.T) {
+	tc := newFakeTableClient()
+
+	_, flowChan := tc.t.Start()
+	defer tc.t.Stop()
+	for tc.t.State() != common.RunningState {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, f := range []*flow.Flow{newMetricFlow("node1", 100), newMetricFlow("node1", 300), newMetricFlow("node2", 50)} {
+		flowChan <- &flow.Operation{Type: flow.ReplaceOperation, Flow: f, Key: strconv.Itoa(rand.Int())}
+	}
+
+	time.Sleep(time.Second)
+
+	tests := []struct {
+		query    string
+		expected interface{}
+	}{
+		{`G.Flows().GroupBy("NodeTID").Sum("Metric.ABBytes")`, map[string]float64{"node1": 400, "node2": 50}},
+		{`G.Flows().GroupBy("NodeTID").Avg("Metric.ABBytes")`, map[string]float64{"node1": 200, "node2": 50}},
+		{`G.Flows().GroupBy("NodeTID").Max("Metric.ABBytes")`, map[string]float64{"node1": 300, "node2": 50}},
+		{`G.Flows().GroupBy("NodeTID").Count()`, map[string]int{"node1": 2, "node2": 1}},
+		{`G.Flows().Has("NodeTID", "node1").GroupBy("NodeTID").Percentile("Metric.ABBytes", 50)`, map[string]float64{"node1": 100}},
+		{`G.Flows().Max("Metric.ABBytes")`, float64(300)},
+		{`G.Flows().Percentile("Metric.ABBytes", 50)`, float64(100)},
+		{`G.Flows().Percentile("Metric.ABBytes", 100)`, float64(300)},
+	}
+
+	for _, test := range tests {
+		if value := execGroupByQuery(t, tc, test.query); !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.expected, value)
+		}
+	}
+}
+
+func TestGroupByParse(t *testing.T) {
+	tr := traversal.NewGremlinTraversalParser()
+	tr.AddTraversalExtension(NewFlowTraversalExtension(nil, nil))
+	tr.AddTraversalExtension(NewGroupByTraversalExtension())
+
+	for _, query := range []string{
+		`G.Flows().GroupBy()`,
+		`G.Flows().Avg(1)`,
+		`G.Flows().Percentile("Metric.ABBytes")`,
+		`G.Flows().Percentile("Metric.ABBytes", 150)`,
+	} {
+		if _, err := tr.Parse(strings.NewReader(query)); err == nil {
+			t.Errorf("%s: error expected", query)
+		}
+	}
+}
@@ -81,6 +81,8 @@ func (e *MetricsTraversalExtension) ParseStep(t traversal.Token, p traversal.Gre
 			key = "SFlow.LastUpdateMetric"
 		case "Ovs.LastUpdateMetric", "Ovs":
 			key = "Ovs.LastUpdateMetric"
+		case "Rollup.LastUpdateMetric", "Rollup":
+			key = "Rollup.LastUpdateMetric"
 		default:
 			return nil, fmt.Errorf("Metric field unknown : %v", p.Params)
 		}
@@ -96,6 +98,8 @@ func (s *MetricsGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (t
 	switch tv := last.(type) {
 	case *traversal.GraphTraversalV:
 		return InterfaceMetrics(s.StepContext, tv, s.key), nil
+	case *traversal.GraphTraversalE:
+		return EdgeMetrics(s.StepContext, tv, s.key), nil
 	case *FlowTraversalStep:
 		return tv.FlowMetrics(s.StepContext), nil
 	}
@@ -0,0 +1,306 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+// maxShortestPaths bounds the number of equal cost paths returned for a
+// single source node, meshed topologies can have a lot of them
+const maxShortestPaths = 64
+
+// ShortestPathTraversalExtension describes a new extension to enhance the topology
+type ShortestPathTraversalExtension struct {
+	ShortestPathToken traversal.Token
+}
+
+// ShortestPathGremlinTraversalStep shortest path step
+type ShortestPathGremlinTraversalStep struct {
+	context     traversal.GremlinTraversalContext
+	target      *filters.Filter
+	edgeMatcher graph.ElementMatcher
+}
+
+// ShortestPath is an ordered list of the nodes and of the edges between them
+type ShortestPath struct {
+	Nodes []*graph.Node
+	Edges []*graph.Edge
+}
+
+// NewShortestPathTraversalExtension returns a new graph traversal extension
+func NewShortestPathTraversalExtension() *ShortestPathTraversalExtension {
+	return &ShortestPathTraversalExtension{
+		ShortestPathToken: traversalShortestPathToken,
+	}
+}
+
+// ScanIdent returns an associated graph token
+func (e *ShortestPathTraversalExtension) ScanIdent(s string) (traversal.Token, bool) {
+	switch s {
+	case "SHORTESTPATH":
+		return e.ShortestPathToken, true
+	}
+	return traversal.IDENT, false
+}
+
+// metadataToFilter turns a Metadata() parameter into a filter so that
+// predicates like Within() or Regex() can be used as values
+func metadataToFilter(m graph.Metadata) (*filters.Filter, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var params []interface{}
+	for _, k := range keys {
+		params = append(params, k, m[k])
+	}
+	return traversal.ParamsToFilter(filters.BoolFilterOp_AND, params...)
+}
+
+// ParseStep parses shortest path step
+func (e *ShortestPathTraversalExtension) ParseStep(t traversal.Token, p traversal.GremlinTraversalContext) (traversal.GremlinTraversalStep, error) {
+	switch t {
+	case e.ShortestPathToken:
+	default:
+		return nil, nil
+	}
+
+	if len(p.Params) < 1 || len(p.Params) > 2 {
+		return nil, fmt.Errorf("ShortestPath accepts one or two parameters : %v", p.Params)
+	}
+
+	target, ok := p.Params[0].(graph.Metadata)
+	if !ok {
+		return nil, errors.New("ShortestPath first parameter have to be a Metadata of the target nodes")
+	}
+
+	targetFilter, err := metadataToFilter(target)
+	if err != nil {
+		return nil, err
+	}
+
+	step := &ShortestPathGremlinTraversalStep{context: p, target: targetFilter}
+
+	if len(p.Params) == 2 {
+		edges, ok := p.Params[1].(graph.Metadata)
+		if !ok {
+			return nil, errors.New("ShortestPath second parameter have to be a Metadata of the edges")
+		}
+
+		edgeFilter, err := metadataToFilter(edges)
+		if err != nil {
+			return nil, err
+		}
+		step.edgeMatcher = graph.NewElementFilter(edgeFilter)
+	}
+
+	return step, nil
+}
+
+type hop struct {
+	node *graph.Node
+	edge *graph.Edge
+}
+
+// neighbors returns the nodes reachable from a node through the edges
+// matching the edge filter, whatever the direction of the edges
+func neighbors(g *graph.Graph, n *graph.Node, em graph.ElementMatcher) []hop {
+	edges := g.GetNodeEdges(n, em)
+	sort.Slice(edges, func(i, j int) bool { return edges[i].ID < edges[j].ID })
+
+	var hops []hop
+	for _, e := range edges {
+		peer := e.Child
+		if peer == n.ID {
+			peer = e.Parent
+		}
+		if node := g.GetNode(peer); node != nil {
+			hops = append(hops, hop{node: node, edge: e})
+		}
+	}
+	return hops
+}
+
+// getShortestPaths returns all the equal cost paths from a node to the
+// closest nodes matching the target filter
+func getShortestPaths(g *graph.Graph, from *graph.Node, target *filters.Filter, em graph.ElementMatcher) []*ShortestPath {
+	if target.Eval(from) {
+		return []*ShortestPath{{Nodes: []*graph.Node{from}, Edges: []*graph.Edge{}}}
+	}
+
+	depth := map[graph.Identifier]int{from.ID: 0}
+	previous := make(map[graph.Identifier][]hop)
+
+	var found []*graph.Node
+	for level, frontier := 0, []*graph.Node{from}; len(frontier) > 0 && len(found) == 0; level++ {
+		var next []*graph.Node
+		for _, n := range frontier {
+			for _, h := range neighbors(g, n, em) {
+				d, seen := depth[h.node.ID]
+				if seen && d != level+1 {
+					continue
+				}
+				if !seen {
+					depth[h.node.ID] = level + 1
+					next = append(next, h.node)
+					if target.Eval(h.node) {
+						found = append(found, h.node)
+					}
+				}
+				previous[h.node.ID] = append(previous[h.node.ID], hop{node: n, edge: h.edge})
+			}
+		}
+		frontier = next
+	}
+
+	var paths []*ShortestPath
+
+	// walk back from the targets to the source, paths are built reversed
+	var walk func(n *graph.Node, nodes []*graph.Node, edges []*graph.Edge)
+	walk = func(n *graph.Node, nodes []*graph.Node, edges []*graph.Edge) {
+		if len(paths) >= maxShortestPaths {
+			return
+		}
+
+		nodes = append(nodes, n)
+		if n.ID == from.ID {
+			path := &ShortestPath{
+				Nodes: make([]*graph.Node, len(nodes)),
+				Edges: make([]*graph.Edge, len(edges)),
+			}
+			for i, node := range nodes {
+				path.Nodes[len(nodes)-1-i] = node
+			}
+			for i, edge := range edges {
+				path.Edges[len(edges)-1-i] = edge
+			}
+			paths = append(paths, path)
+			return
+		}
+
+		for _, h := range previous[n.ID] {
+			walk(h.node, nodes[:len(nodes):len(nodes)], append(edges[:len(edges):len(edges)], h.edge))
+		}
+	}
+
+	for _, n := range found {
+		walk(n, nil, nil)
+	}
+
+	return paths
+}
+
+// Exec ShortestPath step
+func (s *ShortestPathGremlinTraversalStep) Exec(last traversal.GraphTraversalStep) (traversal.GraphTraversalStep, error) {
+	switch tv := last.(type) {
+	case *traversal.GraphTraversalV:
+		tv.GraphTraversal.RLock()
+		defer tv.GraphTraversal.RUnlock()
+
+		var paths []*ShortestPath
+		for _, n := range tv.GetNodes() {
+			paths = append(paths, getShortestPaths(tv.GraphTraversal.Graph, n, s.target, s.edgeMatcher)...)
+		}
+
+		return NewShortestPathTraversalStep(tv.GraphTraversal, paths), nil
+	}
+	return nil, traversal.ErrExecutionError
+}
+
+// Reduce shortest path step
+func (s *ShortestPathGremlinTraversalStep) Reduce(next traversal.GremlinTraversalStep) (traversal.GremlinTraversalStep, error) {
+	return next, nil
+}
+
+// Context ShortestPath step
+func (s *ShortestPathGremlinTraversalStep) Context() *traversal.GremlinTraversalContext {
+	return &s.context
+}
+
+// ShortestPathTraversalStep traversal step of shortest paths
+type ShortestPathTraversalStep struct {
+	GraphTraversal *traversal.GraphTraversal
+	paths          []*ShortestPath
+	error          error
+}
+
+// NewShortestPathTraversalStep creates a new traversal shortest path step
+func NewShortestPathTraversalStep(gt *traversal.GraphTraversal, paths []*ShortestPath) *ShortestPathTraversalStep {
+	return &ShortestPathTraversalStep{
+		GraphTraversal: gt,
+		paths:          paths,
+	}
+}
+
+// Values returns the paths, each one being the ordered list of
+// nodes and edges from the source to the target
+func (t *ShortestPathTraversalStep) Values() []interface{} {
+	values := make([]interface{}, len(t.paths))
+	for i, path := range t.paths {
+		elements := make([]interface{}, 0, len(path.Nodes)+len(path.Edges))
+		for j, n := range path.Nodes {
+			if j > 0 {
+				elements = append(elements, path.Edges[j-1])
+			}
+			elements = append(elements, n)
+		}
+		values[i] = elements
+	}
+	return values
+}
+
+// GetNodes returns the nodes of all the paths
+func (t *ShortestPathTraversalStep) GetNodes() (nodes []*graph.Node) {
+	seen := make(map[graph.Identifier]bool)
+	for _, path := range t.paths {
+		for _, n := range path.Nodes {
+			if !seen[n.ID] {
+				seen[n.ID] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	return
+}
+
+// Paths returns the shortest paths
+func (t *ShortestPathTraversalStep) Paths() []*ShortestPath {
+	return t.paths
+}
+
+// MarshalJSON serialize in JSON
+func (t *ShortestPathTraversalStep) MarshalJSON() ([]byte, error) {
+	values := t.Values()
+	t.GraphTraversal.RLock()
+	defer t.GraphTraversal.RUnlock()
+	return json.Marshal(values)
+}
+
+func (t *ShortestPathTraversalStep) Error() error {
+	return t.error
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package traversal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func execShortestPathQuery(t *testing.T, g *graph.Graph, query string) *ShortestPathTraversalStep {
+	tr := traversal.NewGremlinTraversalParser()
+	tr.AddTraversalExtension(NewShortestPathTraversalExtension())
+
+	ts, err := tr.Parse(strings.NewReader(query))
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	res, err := ts.Exec(g, false)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+
+	return res.(*ShortestPathTraversalStep)
+}
+
+func pathNames(path *ShortestPath) string {
+	var names []string
+	for _, n := range path.Nodes {
+		name, _ := n.GetFieldString("Name")
+		names = append(names, name)
+	}
+	return strings.Join(names, "-")
+}
+
+// newShortestPathGraph creates a square a-b-d-c of layer2 links with an
+// ownership link across, between a and d
+func newShortestPathGraph(t *testing.T) *graph.Graph {
+	g := newGraph(t)
+
+	nodes := map[string]*graph.Node{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		nodes[name], _ = g.NewNode(graph.GenID(), graph.Metadata{"Name": name})
+	}
+
+	for _, link := range [][2]string{{"a", "b"}, {"b", "d"}, {"a", "c"}, {"c", "d"}} {
+		g.NewEdge(graph.GenID(), nodes[link[0]], nodes[link[1]], graph.Metadata{"RelationType": "layer2"})
+	}
+	g.NewEdge(graph.GenID(), nodes["a"], nodes["d"], graph.Metadata{"RelationType": "ownership"})
+
+	return g
+}
+
+func TestShortestPath(t *testing.T) {
+	g := newShortestPathGraph(t)
+
+	res := execShortestPathQuery(t, g, "G.V().Has('Name', 'a').ShortestPath(Metadata('Name', 'd'))")
+	if paths := res.Paths(); len(paths) != 1 || pathNames(paths[0]) != "a-d" {
+		t.Fatalf("Expected the direct path a-d, got: %v", res.Values())
+	}
+
+	values := res.Values()
+	elements := values[0].([]interface{})
+	if len(elements) != 3 {
+		t.Fatalf("Expected node, edge, node, got: %v", elements)
+	}
+	if e, ok := elements[1].(*graph.Edge); !ok || e.Metadata["RelationType"] != "ownership" {
+		t.Fatalf("Expected the ownership edge, got: %v", elements[1])
+	}
+}
+
+func TestShortestPathEdgeConstraint(t *testing.T) {
+	g := newShortestPathGraph(t)
+
+	// reverse direction to check that edges are followed both ways
+	for _, query := range []string{
+		"G.V().Has('Name', 'd').ShortestPath(Metadata('Name', 'a'), Metadata('RelationType', 'layer2'))",
+		"G.V().Has('Name', 'd').ShortestPath(Metadata('Name', 'a'), Metadata('RelationType', Within('layer2', 'layer3')))",
+	} {
+		res := execShortestPathQuery(t, g, query)
+
+		paths := res.Paths()
+		if len(paths) != 2 {
+			t.Fatalf("%s: expected 2 paths, got: %v", query, res.Values())
+		}
+
+		found := map[string]bool{}
+		for _, path := range paths {
+			found[pathNames(path)] = true
+			for _, e := range path.Edges {
+				if e.Metadata["RelationType"] != "layer2" {
+					t.Fatalf("%s: unexpected edge %v", query, e)
+				}
+			}
+		}
+		if !found["d-b-a"] || !found["d-c-a"] {
+			t.Fatalf("%s: expected paths d-b-a and d-c-a, got: %v", query, found)
+		}
+
+		if len(res.GetNodes()) != 4 {
+			t.Fatalf("%s: expected 4 distinct nodes, got: %v", query, res.GetNodes())
+		}
+	}
+}
+
+func TestShortestPathNoPath(t *testing.T) {
+	g := newShortestPathGraph(t)
+
+	res := execShortestPathQuery(t, g, "G.V().Has('Name', 'a').ShortestPath(Metadata('Name', 'd'), Metadata('RelationType', 'layer3'))")
+	if len(res.Values()) != 0 {
+		t.Fatalf("Expected no path, got: %v", res.Values())
+	}
+
+	res = execShortestPathQuery(t, g, "G.V().Has('Name', 'a').ShortestPath(Metadata('Name', Regex('[ab]')))")
+	if paths := res.Paths(); len(paths) != 1 || pathNames(paths[0]) != "a" {
+		t.Fatalf("Expected a single node path, got: %v", res.Values())
+	}
+}
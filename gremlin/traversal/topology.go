@@ -71,6 +71,50 @@ nodeloop:
 	return NewMetricsTraversalStep(tv.GraphTraversal, metrics)
 }
 
+// EdgeMetrics returns a Metrics step from edge metric metadata
+func EdgeMetrics(ctx traversal.StepContext, te *traversal.GraphTraversalE, key string) *MetricsTraversalStep {
+	if te.Error() != nil {
+		return NewMetricsTraversalStepFromError(te.Error())
+	}
+
+	startField := key + ".Start"
+	te = te.Dedup(ctx, "ID", startField).Sort(ctx, common.SortAscending, startField)
+
+	if te.Error() != nil {
+		return NewMetricsTraversalStepFromError(te.Error())
+	}
+
+	te.GraphTraversal.RLock()
+	defer te.GraphTraversal.RUnlock()
+
+	metrics := make(map[string][]common.Metric)
+	it := ctx.PaginationRange.Iterator()
+	gslice := te.GraphTraversal.Graph.GetContext().TimeSlice
+
+edgeloop:
+	for _, e := range te.GetEdges() {
+		if it.Done() {
+			break edgeloop
+		}
+
+		m, _ := e.GetField(key)
+		if m == nil {
+			continue
+		}
+
+		lastmetric, ok := m.(common.Metric)
+		if !ok {
+			return NewMetricsTraversalStepFromError(errors.New("wrong edge metric type"))
+		}
+
+		if gslice == nil || (lastmetric.GetStart() > gslice.Start && lastmetric.GetLast() < gslice.Last) && it.Next() {
+			metrics[string(e.ID)] = append(metrics[string(e.ID)], lastmetric)
+		}
+	}
+
+	return NewMetricsTraversalStep(te.GraphTraversal, metrics)
+}
+
 // Sockets returns a sockets step from host/namespace sockets
 func Sockets(ctx traversal.StepContext, tv *traversal.GraphTraversalV) *SocketsTraversalStep {
 	if tv.Error() != nil {
@@ -125,3 +125,8 @@ func Ne(v interface{}) ValueString {
 func Within(list ...interface{}) ValueString {
 	return newValueString("Within", list...)
 }
+
+// Without append a Without() operation to query
+func Without(list ...interface{}) ValueString {
+	return newValueString("Without", list...)
+}
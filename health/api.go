@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+// RunParams describes the checks to run, all of them if empty
+type RunParams struct {
+	Checks []string
+}
+
+func (c *Checker) checkIndex(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "health", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, Checks())
+}
+
+func (c *Checker) checkRun(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "health", "read") || !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params RunParams
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			shttp.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	report, err := c.Run(params.Checks...)
+	if err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, report)
+}
+
+func (c *Checker) checkReport(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "health", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := c.LastReport()
+	if report == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, report)
+}
+
+// RegisterEndpoints registers the endpoints of the health checks
+func (c *Checker) RegisterEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "HealthCheckIndex",
+			Method:      "GET",
+			Path:        "/api/health/checks",
+			HandlerFunc: c.checkIndex,
+		},
+		{
+			Name:        "HealthCheckRun",
+			Method:      "POST",
+			Path:        "/api/health/run",
+			HandlerFunc: c.checkRun,
+		},
+		{
+			Name:        "HealthCheckReport",
+			Method:      "GET",
+			Path:        "/api/health/report",
+			HandlerFunc: c.checkReport,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
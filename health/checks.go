@@ -0,0 +1,451 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package health
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/netlink"
+)
+
+const mainRoutingTable = 254
+
+func init() {
+	registerCheck("asymmetric-routes", "Interfaces whose subnet is routed through another interface, the replies to the traffic they receive leaving elsewhere", checkAsymmetricRoutes)
+	registerCheck("bridge-loops", "Loops of layer 2 links going through a bridge without spanning tree", checkBridgeLoops)
+	registerCheck("clock-skew", "Hosts whose clock is skewed from the one of the analyzer by more than the allowed offset", checkClockSkew)
+	registerCheck("duplicate-ips", "IP addresses configured on several interfaces of the same layer 2 domain", checkDuplicateIPs)
+	registerCheck("interfaces-down", "Interfaces down while traffic is expected, as they have addresses, a peer up or a capture", checkInterfacesDown)
+	registerCheck("mtu-mismatches", "Interfaces linked at layer 2 with different MTUs", checkMTUMismatches)
+}
+
+func nodeName(n *graph.Node) string {
+	if name, _ := n.GetFieldString("Name"); name != "" {
+		return name
+	}
+	return string(n.ID)
+}
+
+func nodeType(n *graph.Node) string {
+	typ, _ := n.GetFieldString("Type")
+	return typ
+}
+
+func isBridge(n *graph.Node) bool {
+	switch nodeType(n) {
+	case "bridge", "ovsbridge":
+		return true
+	}
+	return false
+}
+
+// interfaceNetworks returns the addresses of an interface, leaving out the
+// loopback and link local ones
+func interfaceNetworks(n *graph.Node) (networks []*net.IPNet) {
+	for _, family := range []string{"IPV4", "IPV6"} {
+		cidrs, _ := n.GetFieldStringList(family)
+		for _, cidr := range cidrs {
+			ip, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+				continue
+			}
+			ipnet.IP = ip
+			networks = append(networks, ipnet)
+		}
+	}
+	return
+}
+
+// layer2Edges returns the layer 2 edges with both of their nodes, sorted
+// so that the findings don't depend on the order of the graph
+func layer2Edges(g *graph.Graph) (edges []*graph.Edge) {
+	for _, e := range g.GetEdges(topology.Layer2Metadata()) {
+		if g.GetNode(e.Parent) != nil && g.GetNode(e.Child) != nil {
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].ID < edges[j].ID
+	})
+	return
+}
+
+type unionFind map[graph.Identifier]graph.Identifier
+
+func (u unionFind) find(id graph.Identifier) graph.Identifier {
+	parent, found := u[id]
+	if !found || parent == id {
+		return id
+	}
+	root := u.find(parent)
+	u[id] = root
+	return root
+}
+
+// union merges the sets of a and b, returning false if they were already
+// the same set
+func (u unionFind) union(a, b graph.Identifier) bool {
+	ra, rb := u.find(a), u.find(b)
+	if ra == rb {
+		return false
+	}
+	u[ra] = rb
+	return true
+}
+
+func sortFindings(findings []Finding) []Finding {
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Message < findings[j].Message
+	})
+	return findings
+}
+
+func checkDuplicateIPs(g *graph.Graph) (findings []Finding) {
+	domains := unionFind{}
+	for _, e := range layer2Edges(g) {
+		domains.union(e.Parent, e.Child)
+	}
+
+	type owner struct {
+		ip     string
+		domain graph.Identifier
+	}
+
+	owners := make(map[owner][]*graph.Node)
+	for _, n := range g.GetNodes(nil) {
+		for _, network := range interfaceNetworks(n) {
+			key := owner{ip: network.IP.String(), domain: domains.find(n.ID)}
+			owners[key] = append(owners[key], n)
+		}
+	}
+
+	for key, nodes := range owners {
+		if len(nodes) < 2 {
+			continue
+		}
+
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].ID < nodes[j].ID
+		})
+
+		var ids []graph.Identifier
+		var names []string
+		for _, n := range nodes {
+			ids = append(ids, n.ID)
+			names = append(names, nodeName(n))
+		}
+
+		findings = append(findings, Finding{
+			Severity: SeverityCritical,
+			Message:  fmt.Sprintf("IP address %s is configured on %s", key.ip, strings.Join(names, ", ")),
+			Nodes:    ids,
+			Details:  map[string]interface{}{"IP": key.ip},
+		})
+	}
+
+	return sortFindings(findings)
+}
+
+func checkMTUMismatches(g *graph.Graph) (findings []Finding) {
+	for _, e := range layer2Edges(g) {
+		parent, child := g.GetNode(e.Parent), g.GetNode(e.Child)
+
+		// the bridges and their ports don't forward packets themselves
+		if isBridge(parent) || isBridge(child) || nodeType(parent) == "ovsport" || nodeType(child) == "ovsport" {
+			continue
+		}
+
+		parentMTU, _ := parent.GetFieldInt64("MTU")
+		childMTU, _ := child.GetFieldInt64("MTU")
+		if parentMTU == 0 || childMTU == 0 || parentMTU == childMTU {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("MTU of %s is %d while MTU of %s is %d", nodeName(parent), parentMTU, nodeName(child), childMTU),
+			Nodes:    []graph.Identifier{parent.ID, child.ID},
+			Details:  map[string]interface{}{"MTUs": []int64{parentMTU, childMTU}},
+		})
+	}
+
+	return sortFindings(findings)
+}
+
+func checkInterfacesDown(g *graph.Graph) (findings []Finding) {
+	for _, n := range g.GetNodes(graph.Metadata{"State": "DOWN"}) {
+		var reasons []string
+		nodes := []graph.Identifier{n.ID}
+
+		if len(interfaceNetworks(n)) > 0 {
+			reasons = append(reasons, "it has IP addresses")
+		}
+
+		for _, e := range g.GetNodeEdges(n, topology.Layer2Metadata()) {
+			peerID := e.Child
+			if peerID == n.ID {
+				peerID = e.Parent
+			}
+
+			peer := g.GetNode(peerID)
+			if peer == nil || isBridge(peer) {
+				continue
+			}
+
+			if state, _ := peer.GetFieldString("State"); state == "UP" {
+				reasons = append(reasons, fmt.Sprintf("its peer %s is up", nodeName(peer)))
+				nodes = append(nodes, peer.ID)
+			}
+		}
+
+		if state, _ := n.GetFieldString("Capture.State"); state == "active" {
+			reasons = append(reasons, "it is captured")
+		}
+
+		if len(reasons) == 0 {
+			continue
+		}
+
+		// an interface administratively up but down has lost its carrier
+		severity := SeverityWarning
+		if topology.IsInterfaceUp(n) {
+			severity = SeverityCritical
+		}
+
+		findings = append(findings, Finding{
+			Severity: severity,
+			Message:  fmt.Sprintf("Interface %s is down while %s", nodeName(n), strings.Join(reasons, ", ")),
+			Nodes:    nodes,
+		})
+	}
+
+	return sortFindings(findings)
+}
+
+// forestPath returns the path between two nodes of a forest
+func forestPath(adjacency map[graph.Identifier][]graph.Identifier, from, to graph.Identifier) []graph.Identifier {
+	previous := map[graph.Identifier]graph.Identifier{from: from}
+	queue := []graph.Identifier{from}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		if id == to {
+			path := []graph.Identifier{to}
+			for id != from {
+				id = previous[id]
+				path = append(path, id)
+			}
+			return path
+		}
+
+		for _, next := range adjacency[id] {
+			if _, seen := previous[next]; !seen {
+				previous[next] = id
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkBridgeLoops(g *graph.Graph) (findings []Finding) {
+	forest := unionFind{}
+	adjacency := make(map[graph.Identifier][]graph.Identifier)
+	linked := make(map[[2]graph.Identifier]bool)
+
+	for _, e := range layer2Edges(g) {
+		pair := [2]graph.Identifier{e.Parent, e.Child}
+		if pair[0] > pair[1] {
+			pair[0], pair[1] = pair[1], pair[0]
+		}
+		if pair[0] == pair[1] || linked[pair] {
+			continue
+		}
+		linked[pair] = true
+
+		if forest.union(e.Parent, e.Child) {
+			adjacency[e.Parent] = append(adjacency[e.Parent], e.Child)
+			adjacency[e.Child] = append(adjacency[e.Child], e.Parent)
+			continue
+		}
+
+		// the edge closes a loop with the path already joining its nodes
+		loop := forestPath(adjacency, e.Parent, e.Child)
+
+		var bridges, names []string
+		protected := false
+		for _, id := range loop {
+			n := g.GetNode(id)
+			if isBridge(n) {
+				bridges = append(bridges, nodeName(n))
+			}
+			switch nodeType(n) {
+			case "bond", "team":
+				// links aggregated rather than looped
+				protected = true
+			}
+			if _, err := n.GetField(topology.STPMetadataKey); err == nil {
+				protected = true
+			}
+			names = append(names, nodeName(n))
+		}
+
+		if len(bridges) == 0 || protected {
+			continue
+		}
+
+		findings = append(findings, Finding{
+			Severity: SeverityCritical,
+			Message:  fmt.Sprintf("Layer 2 loop through %s without spanning tree: %s", strings.Join(bridges, ", "), strings.Join(names, " - ")),
+			Nodes:    loop,
+		})
+	}
+
+	return sortFindings(findings)
+}
+
+// routeOwners returns the interfaces holding the most specific route of
+// the main routing table to ip, among the given ones
+func routeOwners(nodes []*graph.Node, ip net.IP) (owners []*graph.Node) {
+	best := -1
+	for _, n := range nodes {
+		field, err := n.GetField("RoutingTables")
+		if err != nil {
+			continue
+		}
+		tables, ok := field.(*netlink.RoutingTables)
+		if !ok {
+			continue
+		}
+
+		length := -1
+		for _, table := range *tables {
+			if table.ID != mainRoutingTable {
+				continue
+			}
+			for _, route := range table.Routes {
+				if ones, _ := route.Prefix.Mask.Size(); ones > length && route.Prefix.Contains(ip) {
+					length = ones
+				}
+			}
+		}
+
+		if length < 0 || length < best {
+			continue
+		}
+
+		if length > best {
+			best, owners = length, []*graph.Node{n}
+		} else {
+			owners = append(owners, n)
+		}
+	}
+	return
+}
+
+func checkAsymmetricRoutes(g *graph.Graph) (findings []Finding) {
+	for _, n := range g.GetNodes(nil) {
+		networks := interfaceNetworks(n)
+		if len(networks) == 0 {
+			continue
+		}
+
+		parents := g.LookupParents(n, nil, topology.OwnershipMetadata())
+		if len(parents) == 0 {
+			continue
+		}
+		siblings := g.LookupChildren(parents[0], nil, topology.OwnershipMetadata())
+
+	networkLoop:
+		for _, network := range networks {
+			// a host route doesn't describe a subnet reachable through
+			// the interface
+			if ones, bits := network.Mask.Size(); ones == bits {
+				continue
+			}
+
+			subnet := &net.IPNet{IP: network.IP.Mask(network.Mask), Mask: network.Mask}
+			owners := routeOwners(siblings, subnet.IP)
+			if len(owners) == 0 {
+				continue
+			}
+
+			for _, owner := range owners {
+				if owner.ID == n.ID {
+					continue networkLoop
+				}
+			}
+
+			findings = append(findings, Finding{
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("Subnet %s of %s is routed through %s", subnet, nodeName(n), nodeName(owners[0])),
+				Nodes:    []graph.Identifier{n.ID, owners[0].ID},
+				Details:  map[string]interface{}{"Subnet": subnet.String()},
+			})
+		}
+	}
+
+	return sortFindings(findings)
+}
+
+// checkClockSkew reports the hosts whose clock skew, measured by the
+// analyzers, exceeds the allowed offset
+func checkClockSkew(g *graph.Graph) (findings []Finding) {
+	maxOffset := time.Duration(config.GetInt("analyzer.clock_skew.max_offset")) * time.Millisecond
+
+	for _, n := range g.GetNodes(graph.Metadata{"Type": "host"}) {
+		value, err := n.GetFieldInt64("ClockSkew.Offset")
+		if err != nil {
+			continue
+		}
+
+		offset := time.Duration(value)
+		if offset >= -maxOffset && offset <= maxOffset {
+			continue
+		}
+
+		// a skew above a second breaks the ordering of most of the events
+		severity := SeverityWarning
+		if offset < -time.Second || offset > time.Second {
+			severity = SeverityCritical
+		}
+
+		rtt, _ := n.GetFieldInt64("ClockSkew.RTT")
+		findings = append(findings, Finding{
+			Severity: severity,
+			Message:  fmt.Sprintf("Clock of host %s is skewed by %s", nodeName(n), offset),
+			Nodes:    []graph.Identifier{n.ID},
+			Details: map[string]interface{}{
+				"Offset": value,
+				"RTT":    rtt,
+			},
+		})
+	}
+
+	return sortFindings(findings)
+}
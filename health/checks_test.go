@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package health
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/netlink"
+)
+
+func newGraph(t *testing.T) *graph.Graph {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph.NewGraph("testhost", b, common.AnalyzerService)
+}
+
+func newNode(g *graph.Graph, id string, metadata graph.Metadata) *graph.Node {
+	metadata["Name"] = id
+	n, _ := g.NewNode(graph.Identifier(id), metadata)
+	return n
+}
+
+func layer2(g *graph.Graph, a, b *graph.Node) {
+	topology.AddLayer2Link(g, a, b, nil)
+}
+
+func run(t *testing.T, g *graph.Graph, check string) []Finding {
+	checker, err := NewChecker(g, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := checker.Run(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report.Findings
+}
+
+func TestDuplicateIPs(t *testing.T) {
+	g := newGraph(t)
+
+	g.Lock()
+	br := newNode(g, "br0", graph.Metadata{"Type": "bridge"})
+	a := newNode(g, "a", graph.Metadata{"Type": "veth", "IPV4": []string{"10.0.0.1/24"}})
+	b := newNode(g, "b", graph.Metadata{"Type": "veth", "IPV4": []string{"10.0.0.1/24"}})
+	newNode(g, "c", graph.Metadata{"Type": "device", "IPV4": []string{"10.0.0.1/24", "127.0.0.1/8"}})
+	layer2(g, br, a)
+	layer2(g, br, b)
+	g.Unlock()
+
+	findings := run(t, g, "duplicate-ips")
+	if len(findings) != 1 || len(findings[0].Nodes) != 2 {
+		t.Fatalf("Expected a duplicate between a and b only, got %+v", findings)
+	}
+	if findings[0].Check != "duplicate-ips" || findings[0].Severity != SeverityCritical {
+		t.Errorf("Wrong finding %+v", findings[0])
+	}
+}
+
+func TestMTUMismatches(t *testing.T) {
+	g := newGraph(t)
+
+	g.Lock()
+	br := newNode(g, "br0", graph.Metadata{"Type": "bridge", "MTU": int64(1500)})
+	a := newNode(g, "a", graph.Metadata{"Type": "veth", "MTU": int64(9000)})
+	b := newNode(g, "b", graph.Metadata{"Type": "veth", "MTU": int64(1500)})
+	c := newNode(g, "c", graph.Metadata{"Type": "veth", "MTU": int64(1500)})
+	layer2(g, br, a)
+	layer2(g, a, b)
+	layer2(g, b, c)
+	g.Unlock()
+
+	findings := run(t, g, "mtu-mismatches")
+	if len(findings) != 1 {
+		t.Fatalf("Expected a mismatch between a and b only, got %+v", findings)
+	}
+}
+
+func TestInterfacesDown(t *testing.T) {
+	g := newGraph(t)
+
+	g.Lock()
+	a := newNode(g, "a", graph.Metadata{"Type": "veth", "State": "DOWN", "LinkFlags": []string{"UP"}})
+	b := newNode(g, "b", graph.Metadata{"Type": "veth", "State": "UP"})
+	newNode(g, "c", graph.Metadata{"Type": "device", "State": "DOWN"})
+	newNode(g, "d", graph.Metadata{"Type": "device", "State": "DOWN", "IPV4": []string{"10.0.0.1/24"}})
+	layer2(g, a, b)
+	g.Unlock()
+
+	findings := run(t, g, "interfaces-down")
+	if len(findings) != 2 {
+		t.Fatalf("Expected a and d to be reported, got %+v", findings)
+	}
+	if findings[0].Nodes[0] != "a" || findings[0].Severity != SeverityCritical {
+		t.Errorf("Expected a to have lost its carrier, got %+v", findings[0])
+	}
+	if findings[1].Nodes[0] != "d" || findings[1].Severity != SeverityWarning {
+		t.Errorf("Expected d to be administratively down, got %+v", findings[1])
+	}
+}
+
+func TestBridgeLoops(t *testing.T) {
+	g := newGraph(t)
+
+	g.Lock()
+	br0 := newNode(g, "br0", graph.Metadata{"Type": "bridge"})
+	br1 := newNode(g, "br1", graph.Metadata{"Type": "bridge"})
+	a0 := newNode(g, "a0", graph.Metadata{"Type": "veth"})
+	a1 := newNode(g, "a1", graph.Metadata{"Type": "veth"})
+	b0 := newNode(g, "b0", graph.Metadata{"Type": "veth"})
+	b1 := newNode(g, "b1", graph.Metadata{"Type": "veth"})
+	layer2(g, br0, a0)
+	layer2(g, a0, a1)
+	layer2(g, a1, br1)
+	layer2(g, br0, b0)
+	layer2(g, b0, b1)
+	layer2(g, b1, br1)
+	g.Unlock()
+
+	findings := run(t, g, "bridge-loops")
+	if len(findings) != 1 || len(findings[0].Nodes) != 6 {
+		t.Fatalf("Expected a loop of 6 nodes, got %+v", findings)
+	}
+
+	g.Lock()
+	g.AddMetadata(br0, topology.STPMetadataKey, map[string]interface{}{"State": "forwarding"})
+	g.Unlock()
+
+	if findings := run(t, g, "bridge-loops"); len(findings) != 0 {
+		t.Errorf("Expected the spanning tree to protect the loop, got %+v", findings)
+	}
+}
+
+func routingTables(prefix string, ifIndex int64) *netlink.RoutingTables {
+	_, ipnet, _ := net.ParseCIDR(prefix)
+	return &netlink.RoutingTables{
+		&netlink.RoutingTable{
+			ID: mainRoutingTable,
+			Routes: []*netlink.Route{
+				{Prefix: netlink.Prefix{IPNet: *ipnet}, NextHops: []*netlink.NextHop{{IfIndex: ifIndex}}},
+			},
+		},
+	}
+}
+
+func TestAsymmetricRoutes(t *testing.T) {
+	g := newGraph(t)
+
+	g.Lock()
+	host := newNode(g, "host", graph.Metadata{"Type": "host"})
+	eth0 := newNode(g, "eth0", graph.Metadata{"Type": "device", "IfIndex": int64(2), "IPV4": []string{"10.0.0.2/24"}, "RoutingTables": routingTables("10.0.0.0/24", 2)})
+	eth1 := newNode(g, "eth1", graph.Metadata{"Type": "device", "IfIndex": int64(3), "IPV4": []string{"10.1.0.2/24"}, "RoutingTables": routingTables("10.1.0.0/16", 3)})
+	eth2 := newNode(g, "eth2", graph.Metadata{"Type": "device", "IfIndex": int64(4), "RoutingTables": routingTables("10.1.0.0/24", 4)})
+	topology.AddOwnershipLink(g, host, eth0, nil)
+	topology.AddOwnershipLink(g, host, eth1, nil)
+	topology.AddOwnershipLink(g, host, eth2, nil)
+	g.Unlock()
+
+	findings := run(t, g, "asymmetric-routes")
+	if len(findings) != 1 || findings[0].Nodes[0] != "eth1" || findings[0].Nodes[1] != "eth2" {
+		t.Fatalf("Expected the subnet of eth1 to be routed through eth2, got %+v", findings)
+	}
+}
+
+func TestUnknownCheck(t *testing.T) {
+	if _, err := NewChecker(newGraph(t), time.Minute, []string{"unknown"}); err == nil {
+		t.Error("Expected an error for an unknown check")
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	g := newGraph(t)
+
+	newNode(g, "host1", graph.Metadata{"Type": "host", "ClockSkew": map[string]interface{}{"Offset": int64(2 * time.Millisecond)}})
+	newNode(g, "host2", graph.Metadata{"Type": "host", "ClockSkew": map[string]interface{}{"Offset": int64(-300 * time.Millisecond)}})
+	newNode(g, "host3", graph.Metadata{"Type": "host", "ClockSkew": map[string]interface{}{"Offset": int64(5 * time.Second)}})
+	newNode(g, "host4", graph.Metadata{"Type": "host"})
+
+	findings := run(t, g, "clock-skew")
+	if len(findings) != 2 {
+		t.Fatalf("Expected 2 findings, got %+v", findings)
+	}
+
+	if findings[0].Nodes[0] != "host2" || findings[0].Severity != SeverityWarning {
+		t.Errorf("Unexpected finding: %+v", findings[0])
+	}
+	if findings[1].Nodes[0] != "host3" || findings[1].Severity != SeverityCritical {
+		t.Errorf("Unexpected finding: %+v", findings[1])
+	}
+}
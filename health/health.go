@@ -0,0 +1,204 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package health
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Severities of the findings
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Finding describes an issue reported by a check, Nodes holding the nodes
+// involved
+type Finding struct {
+	Check    string                 `json:"Check"`
+	Severity string                 `json:"Severity"`
+	Message  string                 `json:"Message"`
+	Nodes    []graph.Identifier     `json:"Nodes"`
+	Details  map[string]interface{} `json:"Details,omitempty"`
+}
+
+// Check describes a topology health check
+type Check struct {
+	Name        string `json:"Name"`
+	Description string `json:"Description"`
+	run         func(g *graph.Graph) []Finding
+}
+
+// Report holds the findings of a run of checks
+type Report struct {
+	Time     int64     `json:"Time"`
+	Checks   []string  `json:"Checks"`
+	Findings []Finding `json:"Findings"`
+}
+
+var checks = map[string]*Check{}
+
+func registerCheck(name, description string, run func(g *graph.Graph) []Finding) {
+	checks[name] = &Check{Name: name, Description: description, run: run}
+}
+
+// Checks returns the available checks sorted by name
+func Checks() []*Check {
+	list := make([]*Check, 0, len(checks))
+	for _, check := range checks {
+		list = append(list, check)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Checker runs the checks against the topology, on demand or periodically
+type Checker struct {
+	sync.RWMutex
+	graph    *graph.Graph
+	interval time.Duration
+	names    []string
+	last     *Report
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Run the checks of the given names, all the checks if none is given
+func (c *Checker) Run(names ...string) (*Report, error) {
+	if len(names) == 0 {
+		for _, check := range Checks() {
+			names = append(names, check.Name)
+		}
+	}
+
+	var selected []*Check
+	for _, name := range names {
+		check, found := checks[name]
+		if !found {
+			return nil, fmt.Errorf("Unknown check %s", name)
+		}
+		selected = append(selected, check)
+	}
+
+	report := &Report{
+		Time:     common.UnixMillis(time.Now()),
+		Checks:   names,
+		Findings: []Finding{},
+	}
+
+	c.graph.RLock()
+	for _, check := range selected {
+		for _, finding := range check.run(c.graph) {
+			finding.Check = check.Name
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+	c.graph.RUnlock()
+
+	return report, nil
+}
+
+// LastReport returns the report of the last scheduled run, nil if none
+func (c *Checker) LastReport() *Report {
+	c.RLock()
+	defer c.RUnlock()
+	return c.last
+}
+
+func (c *Checker) runScheduled() {
+	report, err := c.Run(c.names...)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to run the health checks: %s", err)
+		return
+	}
+
+	if len(report.Findings) > 0 {
+		logging.GetLogger().Warningf("Health checks reported %d findings", len(report.Findings))
+	}
+
+	c.Lock()
+	c.last = report
+	c.Unlock()
+}
+
+// Start running the checks periodically, if an interval is set
+func (c *Checker) Start() {
+	if c.interval <= 0 {
+		return
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.runScheduled()
+			case <-c.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the periodic run of the checks
+func (c *Checker) Stop() {
+	if c.interval <= 0 {
+		return
+	}
+
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// NewChecker returns a checker running the checks of the given names every
+// interval, only on demand if interval is 0
+func NewChecker(g *graph.Graph, interval time.Duration, names []string) (*Checker, error) {
+	for _, name := range names {
+		if _, found := checks[name]; !found {
+			return nil, fmt.Errorf("Unknown check %s", name)
+		}
+	}
+
+	return &Checker{
+		graph:    g,
+		interval: interval,
+		names:    names,
+		quit:     make(chan struct{}),
+	}, nil
+}
+
+// NewCheckerFromConfig returns a checker configured by analyzer.health
+func NewCheckerFromConfig(g *graph.Graph) (*Checker, error) {
+	interval := time.Duration(config.GetInt("analyzer.health.interval")) * time.Second
+	return NewChecker(g, interval, config.GetStringSlice("analyzer.health.checks"))
+}
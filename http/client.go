@@ -20,13 +20,16 @@ package http
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/skydive-project/skydive/common"
 )
@@ -70,6 +73,23 @@ func NewRestClient(url *url.URL, authOpts *AuthenticationOpts, tlsConfig *tls.Co
 	}
 }
 
+// SetUnixSocket makes the client send its requests on the unix socket at
+// the given path, the host of the URL being ignored
+func (c *RestClient) SetUnixSocket(path string) {
+	c.client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// SetTimeout sets the time limit of the requests, including the reading of
+// the response body, 0 for no limit
+func (c *RestClient) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
 // Request issues a request to the API
 func (c *RestClient) Request(method, path string, body io.Reader, header http.Header) (*http.Response, error) {
 	url := c.url.ResolveReference(&url.URL{Path: path})
@@ -20,6 +20,7 @@ package http
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -57,8 +58,10 @@ type Server struct {
 	Router      *mux.Router
 	Addr        string
 	Port        int
+	UnixSocket  *UnixSocketOpts
 	lock        sync.Mutex
 	listener    net.Listener
+	unixLn      net.Listener
 	wg          sync.WaitGroup
 }
 
@@ -82,7 +85,7 @@ func (s *Server) RegisterRoutes(routes []Route, auth AuthenticationBackend) {
 		r := s.Router.
 			Methods(route.Method).
 			Name(route.Name).
-			Handler(auth.Wrap(route.HandlerFunc))
+			Handler(s.wrapAuth(auth, route.HandlerFunc))
 		switch p := route.Path.(type) {
 		case string:
 			r.Path(p)
@@ -92,16 +95,40 @@ func (s *Server) RegisterRoutes(routes []Route, auth AuthenticationBackend) {
 	}
 }
 
-// Listen starts listening for TCP requests
+// Listen starts listening for TCP requests, and on the unix socket if
+// configured. The sockets passed by systemd socket activation are used
+// instead of creating new ones.
 func (s *Server) Listen() error {
-	listenAddrPort := fmt.Sprintf("%s:%d", s.Addr, s.Port)
-	ln, err := net.Listen("tcp", listenAddrPort)
+	ln, err := activatedListener("tcp")
 	if err != nil {
-		return fmt.Errorf("Failed to listen on %s:%d: %s", s.Addr, s.Port, err)
+		return err
+	}
+
+	if ln != nil {
+		logging.GetLogger().Infof("Listening on socket %s passed by systemd", ln.Addr())
+	} else {
+		listenAddrPort := fmt.Sprintf("%s:%d", s.Addr, s.Port)
+		if ln, err = net.Listen("tcp", listenAddrPort); err != nil {
+			return fmt.Errorf("Failed to listen on %s:%d: %s", s.Addr, s.Port, err)
+		}
+		logging.GetLogger().Infof("Listening on socket %s:%d", s.Addr, s.Port)
+	}
+
+	unixLn, err := activatedListener("unix")
+	if err == nil && unixLn == nil && s.UnixSocket != nil && s.UnixSocket.Path != "" {
+		unixLn, err = listenUnix(s.UnixSocket)
+	}
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	if unixLn != nil {
+		s.unixLn = &peerCredListener{Listener: unixLn}
+		logging.GetLogger().Infof("Listening on unix socket %s", unixLn.Addr())
 	}
 
 	s.listener = ln
-	logging.GetLogger().Infof("Listening on socket %s:%d", s.Addr, s.Port)
 	return nil
 }
 
@@ -121,6 +148,11 @@ func (s *Server) Serve() {
 
 	s.Handler = handlers.CompressHandler(s.Router)
 
+	if s.unixLn != nil {
+		s.wg.Add(1)
+		go s.serveUnix()
+	}
+
 	var err error
 	if s.TLSConfig != nil {
 		err = s.Server.ServeTLS(s.listener, "", "")
@@ -134,12 +166,36 @@ func (s *Server) Serve() {
 	logging.GetLogger().Errorf("Failed to serve on %s:%d: %s", s.Addr, s.Port, err)
 }
 
+func (s *Server) serveUnix() {
+	defer s.wg.Done()
+
+	if err := s.Server.Serve(s.unixLn); err != http.ErrServerClosed {
+		logging.GetLogger().Errorf("Failed to serve on %s: %s", s.unixLn.Addr(), err)
+	}
+}
+
 // Unauthorized returns a 401 response
 func Unauthorized(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusUnauthorized)
 	w.Write([]byte("401 Unauthorized\n"))
 }
 
+// WriteJSON writes the JSON encoding of value with the given status
+func WriteJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+// WriteError writes the message of err as a plain text response with the given status
+func WriteError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write([]byte(err.Error()))
+}
+
 // Stop the server
 func (s *Server) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -148,6 +204,9 @@ func (s *Server) Stop() {
 		logging.GetLogger().Error("Shutdown error :", err)
 	}
 	s.listener.Close()
+	if s.unixLn != nil {
+		s.unixLn.Close()
+	}
 	s.wg.Wait()
 }
 
@@ -165,7 +224,7 @@ func (s *Server) HandleFunc(path string, f auth.AuthenticatedHandlerFunc, authBa
 		f(w, r)
 	}
 
-	preAuthHandler := authBackend.Wrap(postAuthHandler)
+	preAuthHandler := s.wrapAuth(authBackend, postAuthHandler)
 
 	s.Router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
 		// set tls headers first
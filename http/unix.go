@@ -0,0 +1,187 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/abbot/go-http-auth"
+
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+const (
+	peerAddrPrefix = "unix-peer:"
+	peerAddrFormat = peerAddrPrefix + "uid=%d,gid=%d,pid=%d"
+	// peerUserPrefix distinguishes the local users authenticated on the unix
+	// socket from the users of the authentication backend
+	peerUserPrefix = "unix:"
+)
+
+// ErrPeerCredentialsUnsupported is returned when the credentials of the
+// unix socket peers can't be retrieved on the platform
+var ErrPeerCredentialsUnsupported = errors.New("Peer credentials not supported")
+
+// UnixSocketOpts describes the unix socket serving the API to the local
+// processes, authenticated by their credentials instead of the backend
+type UnixSocketOpts struct {
+	Path string
+	Mode os.FileMode
+	// role of the allowed local users, by name or uid
+	Users map[string]string
+}
+
+// PeerCredentials describes the process connected to the unix socket
+type PeerCredentials struct {
+	PID int
+	UID int
+	GID int
+}
+
+type peerAddr struct {
+	creds *PeerCredentials
+}
+
+func (a *peerAddr) Network() string {
+	return "unix"
+}
+
+func (a *peerAddr) String() string {
+	if a.creds == nil {
+		return peerAddrPrefix + "unknown"
+	}
+	return fmt.Sprintf(peerAddrFormat, a.creds.UID, a.creds.GID, a.creds.PID)
+}
+
+// peerConn reports the credentials of the peer as remote address, which is
+// the only connection information available to the HTTP handlers
+type peerConn struct {
+	net.Conn
+	addr *peerAddr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+type peerCredListener struct {
+	net.Listener
+}
+
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := peerCredentials(conn)
+	if err != nil {
+		// the requests of this connection will be rejected
+		logging.GetLogger().Warningf("Failed to get the credentials of the unix socket peer: %s", err)
+	}
+
+	return &peerConn{Conn: conn, addr: &peerAddr{creds: creds}}, nil
+}
+
+// peerFromRequest returns whether the request was received on the unix
+// socket and the credentials of its sender
+func peerFromRequest(r *http.Request) (*PeerCredentials, bool) {
+	if !strings.HasPrefix(r.RemoteAddr, peerAddrPrefix) {
+		return nil, false
+	}
+
+	creds := &PeerCredentials{}
+	if _, err := fmt.Sscanf(r.RemoteAddr, peerAddrFormat, &creds.UID, &creds.GID, &creds.PID); err != nil {
+		return nil, true
+	}
+	return creds, true
+}
+
+// authorize returns the user name and the role of an allowed local user
+func (o *UnixSocketOpts) authorize(creds *PeerCredentials) (string, string, bool) {
+	if o == nil || creds == nil {
+		return "", "", false
+	}
+
+	uid := strconv.Itoa(creds.UID)
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+
+	for _, key := range []string{uid, name} {
+		if role, ok := o.Users[key]; ok {
+			return peerUserPrefix + name, role, true
+		}
+	}
+	return "", "", false
+}
+
+// wrapAuth authenticates the requests received on the unix socket with the
+// credentials of the peer process and the other ones with the backend
+func (s *Server) wrapAuth(backend AuthenticationBackend, wrapped auth.AuthenticatedHandlerFunc) http.HandlerFunc {
+	backendHandler := backend.Wrap(wrapped)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		creds, isPeer := peerFromRequest(r)
+		if !isPeer {
+			backendHandler(w, r)
+			return
+		}
+
+		username, role, ok := s.UnixSocket.authorize(creds)
+		if !ok {
+			logging.GetLogger().Warningf("Unix socket request rejected for %s", r.RemoteAddr)
+			Unauthorized(w, r)
+			return
+		}
+
+		if roles := rbac.GetUserRoles(username); len(roles) == 0 {
+			rbac.AddRoleForUser(username, role)
+		}
+
+		authCallWrapped(w, r, username, wrapped)
+	}
+}
+
+func listenUnix(opts *UnixSocketOpts) (net.Listener, error) {
+	// remove the socket left by a previous instance
+	if fi, err := os.Stat(opts.Path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(opts.Path)
+	}
+
+	ln, err := net.Listen("unix", opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to listen on %s: %s", opts.Path, err)
+	}
+
+	if err = os.Chmod(opts.Path, opts.Mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("Failed to set the mode of %s: %s", opts.Path, err)
+	}
+
+	return ln, nil
+}
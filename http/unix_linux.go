@@ -0,0 +1,110 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// first file descriptor passed by systemd, see sd_listen_fds(3)
+const listenFdsStart = 3
+
+var (
+	activatedOnce      sync.Once
+	activatedLock      sync.Mutex
+	activatedSockets   []net.Listener
+	activatedSocketErr error
+)
+
+func peerCredentials(conn net.Conn) (*PeerCredentials, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, ErrPeerCredentialsUnsupported
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	if err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &PeerCredentials{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, nil
+}
+
+func loadActivatedSockets() {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return
+	}
+
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil {
+		return
+	}
+
+	// the sockets are not meant for the child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	for fd := listenFdsStart; fd < listenFdsStart+nfds; fd++ {
+		syscall.CloseOnExec(fd)
+
+		file := os.NewFile(uintptr(fd), "systemd-socket-"+strconv.Itoa(fd))
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			activatedSocketErr = fmt.Errorf("Failed to use the socket %d passed by systemd: %s", fd, err)
+			return
+		}
+		activatedSockets = append(activatedSockets, ln)
+	}
+}
+
+// activatedListener returns a listener of the given network passed by
+// systemd socket activation, nil if there is none left
+func activatedListener(network string) (net.Listener, error) {
+	activatedOnce.Do(loadActivatedSockets)
+
+	activatedLock.Lock()
+	defer activatedLock.Unlock()
+
+	for i, ln := range activatedSockets {
+		if ln.Addr().Network() == network {
+			activatedSockets = append(activatedSockets[:i], activatedSockets[i+1:]...)
+			return ln, nil
+		}
+	}
+	return nil, activatedSocketErr
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	auth "github.com/abbot/go-http-auth"
+)
+
+func TestUnixSocketPeerAuth(t *testing.T) {
+	s := &Server{UnixSocket: &UnixSocketOpts{Users: map[string]string{"4242": "guest"}}}
+
+	var username string
+	handler := s.wrapAuth(NewNoAuthenticationBackend(), func(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+		username = r.Username
+	})
+
+	request := func(remoteAddr string) *fakeResponseWriter {
+		username = ""
+		w := &fakeResponseWriter{headers: make(http.Header)}
+		handler(w, &http.Request{Header: make(http.Header), RemoteAddr: remoteAddr})
+		return w
+	}
+
+	// the TCP requests are authenticated by the backend
+	request("127.0.0.1:43210")
+	if username != "admin" {
+		t.Errorf("Expected the backend user, got %s", username)
+	}
+
+	request((&peerAddr{creds: &PeerCredentials{PID: 1, UID: 4242, GID: 4242}}).String())
+	if !strings.HasPrefix(username, peerUserPrefix) {
+		t.Errorf("Expected a unix socket user, got %s", username)
+	}
+
+	for _, addr := range []*peerAddr{{creds: &PeerCredentials{PID: 1, UID: 4343, GID: 4343}}, {}} {
+		if w := request(addr.String()); w.status != http.StatusUnauthorized || username != "" {
+			t.Errorf("Peer %s should have been rejected", addr)
+		}
+	}
+}
@@ -167,6 +167,9 @@ export class NodeRule extends APIObject {
 export class PacketInjection extends APIObject {
 }
 
+export class ThroughputTest extends APIObject {
+}
+
 export class Workflow extends APIObject {
 }
 
@@ -883,6 +886,7 @@ export class Client {
     edgeRules: API<EdgeRule>
     nodeRules: API<NodeRule>
     packetInjections: API<PacketInjection>
+    throughputTests: API<ThroughputTest>
     workflows: API<Workflow>
     gremlin: GremlinAPI
     G: G
@@ -897,6 +901,7 @@ export class Client {
         this.alerts = new API(this, "alert", Alert);
         this.captures = new API(this, "capture", Capture);
         this.packetInjections = new API(this, "injectpacket", PacketInjection);
+        this.throughputTests = new API(this, "throughputtest", ThroughputTest);
         this.nodeRules = new API(this, "noderule", NodeRule);
         this.edgeRules = new API(this, "edgerule", EdgeRule);
         this.workflows = new API(this, "workflow", Workflow);
@@ -36,4 +36,5 @@ window.Capture = apiLib.Capture
 window.EdgeRule = apiLib.EdgeRule
 window.NodeRule = apiLib.NodeRule
 window.PacketInjection = apiLib.PacketInjection
+window.ThroughputTest = apiLib.ThroughputTest
 window.Workflow = apiLib.Workflow
@@ -0,0 +1,363 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netflow
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+const (
+	maxDgramSize = 65535
+
+	// ExporterNodeType is the type of the nodes created for the exporters
+	// not already in the graph
+	ExporterNodeType = "netflowexporter"
+
+	tcpFlagFIN = 0x01
+	tcpFlagRST = 0x04
+)
+
+// TableAllocator allocates the flow table of an exporter
+type TableAllocator interface {
+	Alloc(nodeTID string, opts flow.TableOpts) *flow.Table
+	Release(t *flow.Table)
+}
+
+// aggregate is a bidirectional flow built from the records of both
+// directions
+type aggregate struct {
+	flow   *flow.Flow
+	metric flow.FlowMetric
+}
+
+// exporter is a device sending flow records, mapped to a graph node
+type exporter struct {
+	node       *graph.Node
+	tid        string
+	created    bool
+	table      *flow.Table
+	operations chan *flow.Operation
+	flows      map[string]*aggregate
+}
+
+// Collector receives NetFlow v5, v9 and IPFIX packets and feeds the flow
+// tables of the exporting devices. The records of both directions of a
+// conversation are merged into one flow.
+type Collector struct {
+	sync.RWMutex
+	Addr      *common.ServiceAddress
+	Graph     *graph.Graph
+	Node      *graph.Node
+	conn      *net.UDPConn
+	decoder   *Decoder
+	allocator TableAllocator
+	opts      flow.TableOpts
+	exporters map[string]*exporter
+	expire    int64
+	wg        sync.WaitGroup
+}
+
+// exporterNode returns the node of an exporter, an existing node with its
+// address or a new node owned by the capture node. The graph lock has to
+// be held.
+func (c *Collector) exporterNode(addr string) (*graph.Node, bool, error) {
+	if nodes := topology.LookupNodesByIP(c.Graph, addr); len(nodes) > 0 {
+		if tid, _ := nodes[0].GetFieldString("TID"); tid != "" {
+			return nodes[0], false, nil
+		}
+	}
+
+	captureTID, _ := c.Node.GetFieldString("TID")
+	u, _ := uuid.NewV5(uuid.NamespaceOID, []byte(captureTID+addr+ExporterNodeType))
+
+	ipKey := "IPV4"
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		ipKey = "IPV6"
+	}
+
+	metadata := graph.Metadata{
+		"Name":  addr,
+		"Type":  ExporterNodeType,
+		"TID":   u.String(),
+		"Probe": "netflow",
+		ipKey:   []string{addr},
+	}
+
+	node, err := c.Graph.NewNode(graph.GenID(), metadata)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err := topology.AddOwnershipLink(c.Graph, c.Node, node, nil); err != nil {
+		return nil, false, err
+	}
+
+	return node, true, nil
+}
+
+func (c *Collector) getExporter(addr string) (*exporter, error) {
+	if e, ok := c.exporters[addr]; ok {
+		return e, nil
+	}
+
+	c.Graph.Lock()
+	node, created, err := c.exporterNode(addr)
+	c.Graph.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tid, _ := node.GetFieldString("TID")
+	e := &exporter{
+		node:    node,
+		tid:     tid,
+		created: created,
+		table:   c.allocator.Alloc(tid, c.opts),
+		flows:   make(map[string]*aggregate),
+	}
+	_, e.operations = e.table.Start()
+	c.exporters[addr] = e
+
+	logging.GetLogger().Infof("New NetFlow exporter %s mapped to node %s", addr, node.ID)
+
+	return e, nil
+}
+
+func protocols(r *Record) (flow.FlowProtocol, flow.FlowProtocol, bool) {
+	network := flow.FlowProtocol_IPV4
+	if r.SrcAddr.To4() == nil {
+		network = flow.FlowProtocol_IPV6
+	}
+
+	switch r.Protocol {
+	case 6:
+		return network, flow.FlowProtocol_TCP, true
+	case 17:
+		return network, flow.FlowProtocol_UDP, true
+	case 132:
+		return network, flow.FlowProtocol_SCTP, true
+	}
+	return network, 0, false
+}
+
+// feed merges a record into the flow of its conversation, the first
+// direction seen being AB
+func (c *Collector) feed(e *exporter, r *Record, now int64) {
+	if r.SrcAddr == nil || r.DstAddr == nil {
+		return
+	}
+
+	src := r.SrcAddr.String() + ":" + strconv.Itoa(int(r.SrcPort))
+	dst := r.DstAddr.String() + ":" + strconv.Itoa(int(r.DstPort))
+
+	key := fmt.Sprintf("%d/%s/%s", r.Protocol, src, dst)
+	reverseKey := fmt.Sprintf("%d/%s/%s", r.Protocol, dst, src)
+
+	start, last := common.UnixMillis(r.Start), common.UnixMillis(r.End)
+	if r.Start.IsZero() {
+		start = now
+	}
+	if r.End.IsZero() {
+		last = now
+	}
+
+	agg, reverse := e.flows[key], false
+	if agg == nil {
+		if agg = e.flows[reverseKey]; agg != nil {
+			key, reverse = reverseKey, true
+		}
+	}
+
+	if agg == nil {
+		f := flow.NewFlow()
+		f.Init(start, e.tid, flow.UUIDs{})
+
+		networkProtocol, transportProtocol, hasTransport := protocols(r)
+		f.LayersPath = "IPv4"
+		if networkProtocol == flow.FlowProtocol_IPV6 {
+			f.LayersPath = "IPv6"
+		}
+		f.Network = &flow.FlowLayer{Protocol: networkProtocol, A: r.SrcAddr.String(), B: r.DstAddr.String()}
+		if len(r.SrcMAC) == 6 && len(r.DstMAC) == 6 {
+			f.Link = &flow.FlowLayer{Protocol: flow.FlowProtocol_ETHERNET, A: r.SrcMAC.String(), B: r.DstMAC.String(), ID: int64(r.VLAN)}
+			f.LayersPath = "Ethernet/" + f.LayersPath
+		}
+		if hasTransport {
+			f.Transport = &flow.TransportLayer{Protocol: transportProtocol, A: int64(r.SrcPort), B: int64(r.DstPort)}
+			f.LayersPath += "/" + transportProtocol.String()
+		}
+		f.Application = f.LayersPath[strings.LastIndex(f.LayersPath, "/")+1:]
+		f.UpdateUUID(key, flow.Opts{LayerKeyMode: flow.L3PreferedKeyMode})
+
+		agg = &aggregate{flow: f, metric: flow.FlowMetric{Start: start}}
+		e.flows[key] = agg
+	}
+
+	if reverse {
+		agg.metric.BABytes += int64(r.Bytes)
+		agg.metric.BAPackets += int64(r.Packets)
+	} else {
+		agg.metric.ABBytes += int64(r.Bytes)
+		agg.metric.ABPackets += int64(r.Packets)
+	}
+	if start < agg.metric.Start {
+		agg.metric.Start = start
+	}
+	if last > agg.metric.Last {
+		agg.metric.Last = last
+	}
+
+	// a new flow is given to the table each time, the table keeping a
+	// reference to it
+	f := *agg.flow
+	metric := agg.metric
+	f.Metric = &metric
+	f.Start, f.Last = metric.Start, metric.Last
+
+	if r.TCPFlags&tcpFlagRST != 0 {
+		f.FinishType = flow.FlowFinishType_TCP_RST
+	} else if r.TCPFlags&tcpFlagFIN != 0 {
+		f.FinishType = flow.FlowFinishType_TCP_FIN
+	}
+	if f.FinishType != flow.FlowFinishType_NOT_FINISHED {
+		delete(e.flows, key)
+	}
+
+	e.operations <- &flow.Operation{Type: flow.ReplaceOperation, Flow: &f, Key: key}
+}
+
+// expireFlows forgets the conversations idle for longer than the flow
+// expiration, the flow table having expired them as well
+func (c *Collector) expireFlows(now int64) {
+	for _, e := range c.exporters {
+		for key, agg := range e.flows {
+			if now-agg.metric.Last > c.expire {
+				delete(e.flows, key)
+			}
+		}
+	}
+}
+
+func (c *Collector) run() {
+	defer c.wg.Done()
+
+	var buf [maxDgramSize]byte
+	lastExpire := common.UnixMillis(time.Now())
+
+	for {
+		n, from, err := c.conn.ReadFromUDP(buf[:])
+		if err != nil {
+			return
+		}
+
+		addr := from.IP.String()
+		packet, err := c.decoder.Decode(addr, buf[:n])
+		if err != nil {
+			logging.GetLogger().Debugf("Unable to decode NetFlow packet from %s: %s", addr, err)
+			continue
+		}
+
+		c.Lock()
+		e, err := c.getExporter(addr)
+		if err != nil {
+			c.Unlock()
+			logging.GetLogger().Errorf("Unable to register NetFlow exporter %s: %s", addr, err)
+			continue
+		}
+
+		now := common.UnixMillis(time.Now())
+		for _, r := range packet.Records {
+			c.feed(e, r, now)
+		}
+
+		if now-lastExpire > c.expire {
+			c.expireFlows(now)
+			lastExpire = now
+		}
+		c.Unlock()
+	}
+}
+
+// Start listening for NetFlow packets
+func (c *Collector) Start() error {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(c.Addr.Addr), Port: c.Addr.Port})
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	c.wg.Add(1)
+	go c.run()
+
+	return nil
+}
+
+// Stop the collector, releasing the flow tables and removing the nodes
+// created for the exporters
+func (c *Collector) Stop() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.wg.Wait()
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.Graph.Lock()
+	defer c.Graph.Unlock()
+
+	for addr, e := range c.exporters {
+		e.table.Stop()
+		c.allocator.Release(e.table)
+		if e.created {
+			if err := c.Graph.DelNode(e.node); err != nil {
+				logging.GetLogger().Errorf("Unable to delete NetFlow exporter node %s: %s", addr, err)
+			}
+		}
+	}
+	c.exporters = make(map[string]*exporter)
+}
+
+// NewCollector returns a new collector listening on the given address, n
+// being the node of the capture
+func NewCollector(addr *common.ServiceAddress, g *graph.Graph, n *graph.Node, allocator TableAllocator, opts flow.TableOpts) *Collector {
+	return &Collector{
+		Addr:      addr,
+		Graph:     g,
+		Node:      n,
+		decoder:   NewDecoder(),
+		allocator: allocator,
+		opts:      opts,
+		exporters: make(map[string]*exporter),
+		expire:    int64(config.GetInt("flow.expire")) * 1000,
+	}
+}
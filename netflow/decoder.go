@@ -0,0 +1,383 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netflow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Export protocol versions
+const (
+	VersionNetFlow5 = 5
+	VersionNetFlow9 = 9
+	VersionIPFIX    = 10
+)
+
+// information elements decoded
+const (
+	ieOctetDeltaCount          = 1
+	iePacketDeltaCount         = 2
+	ieProtocolIdentifier       = 4
+	ieTCPControlBits           = 6
+	ieSourceTransportPort      = 7
+	ieSourceIPv4Address        = 8
+	ieIngressInterface         = 10
+	ieDestinationTransportPort = 11
+	ieDestinationIPv4Address   = 12
+	ieEgressInterface          = 14
+	ieFlowEndSysUpTime         = 21
+	ieFlowStartSysUpTime       = 22
+	ieSourceIPv6Address        = 27
+	ieDestinationIPv6Address   = 28
+	ieSourceMacAddress         = 56
+	ieVlanID                   = 58
+	ieDestinationMacAddress    = 80
+	ieOctetTotalCount          = 85
+	iePacketTotalCount         = 86
+	ieFlowStartSeconds         = 150
+	ieFlowEndSeconds           = 151
+	ieFlowStartMilliseconds    = 152
+	ieFlowEndMilliseconds      = 153
+	ieSystemInitTimeMillis     = 160
+)
+
+// ErrTruncated is returned when a packet is shorter than announced
+var ErrTruncated = errors.New("truncated NetFlow packet")
+
+// Record is a unidirectional flow record
+type Record struct {
+	SrcAddr  net.IP
+	DstAddr  net.IP
+	SrcPort  uint16
+	DstPort  uint16
+	Protocol uint8
+	TCPFlags uint8
+	SrcMAC   net.HardwareAddr
+	DstMAC   net.HardwareAddr
+	VLAN     uint16
+	InputIf  uint32
+	OutputIf uint32
+	Bytes    uint64
+	Packets  uint64
+	Start    time.Time
+	End      time.Time
+}
+
+// Packet is a decoded export packet
+type Packet struct {
+	Version  uint16
+	DomainID uint32
+	Records  []*Record
+}
+
+type field struct {
+	id     uint16
+	length uint16
+	// enterprise specific elements are skipped
+	enterprise bool
+}
+
+type templateKey struct {
+	exporter string
+	domainID uint32
+	id       uint16
+}
+
+// Decoder decodes NetFlow v5, v9 and IPFIX packets, keeping the templates
+// announced by each exporter and observation domain
+type Decoder struct {
+	sync.Mutex
+	templates map[templateKey][]field
+}
+
+func uintValue(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func decodeNetFlow5(data []byte) (*Packet, error) {
+	const headerSize, recordSize = 24, 48
+
+	if len(data) < headerSize {
+		return nil, ErrTruncated
+	}
+
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	if len(data) < headerSize+count*recordSize {
+		return nil, ErrTruncated
+	}
+
+	sysUptime := int64(binary.BigEndian.Uint32(data[4:]))
+	now := int64(binary.BigEndian.Uint32(data[8:]))*1000 + int64(binary.BigEndian.Uint32(data[12:]))/1000000
+	boot := now - sysUptime
+
+	packet := &Packet{Version: VersionNetFlow5, DomainID: uint32(data[20])<<8 | uint32(data[21])}
+	for i := 0; i < count; i++ {
+		r := data[headerSize+i*recordSize:]
+		packet.Records = append(packet.Records, &Record{
+			SrcAddr:  net.IP(append([]byte(nil), r[0:4]...)),
+			DstAddr:  net.IP(append([]byte(nil), r[4:8]...)),
+			InputIf:  uint32(binary.BigEndian.Uint16(r[12:])),
+			OutputIf: uint32(binary.BigEndian.Uint16(r[14:])),
+			Packets:  uint64(binary.BigEndian.Uint32(r[16:])),
+			Bytes:    uint64(binary.BigEndian.Uint32(r[20:])),
+			Start:    millis(boot + int64(binary.BigEndian.Uint32(r[24:]))),
+			End:      millis(boot + int64(binary.BigEndian.Uint32(r[28:]))),
+			SrcPort:  binary.BigEndian.Uint16(r[32:]),
+			DstPort:  binary.BigEndian.Uint16(r[34:]),
+			TCPFlags: r[37],
+			Protocol: r[38],
+		})
+	}
+
+	return packet, nil
+}
+
+func millis(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// decodeTemplates reads the template records of a template set
+func (d *Decoder) decodeTemplates(exporter string, domainID uint32, data []byte, ipfix bool) error {
+	for len(data) >= 4 {
+		id := binary.BigEndian.Uint16(data)
+		count := int(binary.BigEndian.Uint16(data[2:]))
+		data = data[4:]
+
+		// template withdrawal
+		if count == 0 {
+			delete(d.templates, templateKey{exporter, domainID, id})
+			continue
+		}
+
+		fields := make([]field, 0, count)
+		for i := 0; i < count; i++ {
+			if len(data) < 4 {
+				return ErrTruncated
+			}
+			f := field{id: binary.BigEndian.Uint16(data), length: binary.BigEndian.Uint16(data[2:])}
+			data = data[4:]
+
+			if ipfix && f.id&0x8000 != 0 {
+				if len(data) < 4 {
+					return ErrTruncated
+				}
+				f.id &^= 0x8000
+				f.enterprise = true
+				data = data[4:]
+			}
+			fields = append(fields, f)
+		}
+
+		d.templates[templateKey{exporter, domainID, id}] = fields
+	}
+	return nil
+}
+
+// decodeRecord reads a data record, returning its length
+func decodeRecord(fields []field, data []byte, boot int64) (*Record, int, error) {
+	r := &Record{}
+	var offset int
+	var start, end, initTime int64
+	var startUptime, endUptime int64 = -1, -1
+
+	for _, f := range fields {
+		length := int(f.length)
+		if f.length == 0xffff {
+			if offset >= len(data) {
+				return nil, 0, ErrTruncated
+			}
+			length = int(data[offset])
+			offset++
+			if length == 255 {
+				if offset+2 > len(data) {
+					return nil, 0, ErrTruncated
+				}
+				length = int(binary.BigEndian.Uint16(data[offset:]))
+				offset += 2
+			}
+		}
+		if offset+length > len(data) {
+			return nil, 0, ErrTruncated
+		}
+		value := data[offset : offset+length]
+		offset += length
+
+		if f.enterprise {
+			continue
+		}
+
+		switch f.id {
+		case ieOctetDeltaCount, ieOctetTotalCount:
+			r.Bytes = uintValue(value)
+		case iePacketDeltaCount, iePacketTotalCount:
+			r.Packets = uintValue(value)
+		case ieProtocolIdentifier:
+			r.Protocol = uint8(uintValue(value))
+		case ieTCPControlBits:
+			r.TCPFlags = uint8(uintValue(value))
+		case ieSourceTransportPort:
+			r.SrcPort = uint16(uintValue(value))
+		case ieDestinationTransportPort:
+			r.DstPort = uint16(uintValue(value))
+		case ieSourceIPv4Address, ieSourceIPv6Address:
+			r.SrcAddr = net.IP(append([]byte(nil), value...))
+		case ieDestinationIPv4Address, ieDestinationIPv6Address:
+			r.DstAddr = net.IP(append([]byte(nil), value...))
+		case ieSourceMacAddress:
+			r.SrcMAC = net.HardwareAddr(append([]byte(nil), value...))
+		case ieDestinationMacAddress:
+			r.DstMAC = net.HardwareAddr(append([]byte(nil), value...))
+		case ieVlanID:
+			r.VLAN = uint16(uintValue(value))
+		case ieIngressInterface:
+			r.InputIf = uint32(uintValue(value))
+		case ieEgressInterface:
+			r.OutputIf = uint32(uintValue(value))
+		case ieFlowStartSysUpTime:
+			startUptime = int64(uintValue(value))
+		case ieFlowEndSysUpTime:
+			endUptime = int64(uintValue(value))
+		case ieFlowStartSeconds:
+			start = int64(uintValue(value)) * 1000
+		case ieFlowEndSeconds:
+			end = int64(uintValue(value)) * 1000
+		case ieFlowStartMilliseconds:
+			start = int64(uintValue(value))
+		case ieFlowEndMilliseconds:
+			end = int64(uintValue(value))
+		case ieSystemInitTimeMillis:
+			initTime = int64(uintValue(value))
+		}
+	}
+
+	// the uptime based timestamps are relative to the boot of the exporter
+	if initTime != 0 {
+		boot = initTime
+	}
+	if start == 0 && startUptime >= 0 && boot != 0 {
+		start = boot + startUptime
+	}
+	if end == 0 && endUptime >= 0 && boot != 0 {
+		end = boot + endUptime
+	}
+	if start != 0 {
+		r.Start = millis(start)
+	}
+	if end != 0 {
+		r.End = millis(end)
+	}
+
+	return r, offset, nil
+}
+
+// decodeSets decodes the sets of NetFlow v9 or IPFIX packets
+func (d *Decoder) decodeSets(exporter string, packet *Packet, data []byte, boot int64) error {
+	ipfix := packet.Version == VersionIPFIX
+
+	templateSetID, optionsSetID := uint16(0), uint16(1)
+	if ipfix {
+		templateSetID, optionsSetID = 2, 3
+	}
+
+	for len(data) >= 4 {
+		id := binary.BigEndian.Uint16(data)
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < 4 || length > len(data) {
+			return ErrTruncated
+		}
+		body := data[4:length]
+		data = data[length:]
+
+		switch {
+		case id == templateSetID:
+			if err := d.decodeTemplates(exporter, packet.DomainID, body, ipfix); err != nil {
+				return err
+			}
+		case id == optionsSetID || id < 256:
+			// options templates are not used
+		default:
+			fields, ok := d.templates[templateKey{exporter, packet.DomainID, id}]
+			if !ok {
+				// data received before its template, dropped
+				continue
+			}
+
+			for len(body) > 0 {
+				r, n, err := decodeRecord(fields, body, boot)
+				if err == ErrTruncated || n == 0 {
+					// padding
+					break
+				}
+				body = body[n:]
+				packet.Records = append(packet.Records, r)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Decode decodes a packet received from an exporter, the data records of
+// unknown templates being dropped
+func (d *Decoder) Decode(exporter string, data []byte) (*Packet, error) {
+	if len(data) < 2 {
+		return nil, ErrTruncated
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	switch version := binary.BigEndian.Uint16(data); version {
+	case VersionNetFlow5:
+		return decodeNetFlow5(data)
+	case VersionNetFlow9:
+		if len(data) < 20 {
+			return nil, ErrTruncated
+		}
+		packet := &Packet{Version: version, DomainID: binary.BigEndian.Uint32(data[16:])}
+		sysUptime := int64(binary.BigEndian.Uint32(data[4:]))
+		boot := int64(binary.BigEndian.Uint32(data[8:]))*1000 - sysUptime
+		return packet, d.decodeSets(exporter, packet, data[20:], boot)
+	case VersionIPFIX:
+		if len(data) < 16 {
+			return nil, ErrTruncated
+		}
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < 16 || length > len(data) {
+			return nil, ErrTruncated
+		}
+		packet := &Packet{Version: version, DomainID: binary.BigEndian.Uint32(data[12:])}
+		return packet, d.decodeSets(exporter, packet, data[16:length], 0)
+	default:
+		return nil, fmt.Errorf("unsupported NetFlow version %d", version)
+	}
+}
+
+// NewDecoder returns a new NetFlow/IPFIX decoder
+func NewDecoder() *Decoder {
+	return &Decoder{templates: make(map[templateKey][]field)}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netflow
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func be16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func concat(parts ...[]byte) (b []byte) {
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return
+}
+
+func set(id uint16, body []byte) []byte {
+	return concat(be16(id), be16(uint16(4+len(body))), body)
+}
+
+func checkRecord(t *testing.T, r *Record, src, dst string, sport, dport uint16, bytes, packets uint64) {
+	if !r.SrcAddr.Equal(net.ParseIP(src)) || !r.DstAddr.Equal(net.ParseIP(dst)) {
+		t.Errorf("Wrong addresses: %s -> %s", r.SrcAddr, r.DstAddr)
+	}
+	if r.SrcPort != sport || r.DstPort != dport {
+		t.Errorf("Wrong ports: %d -> %d", r.SrcPort, r.DstPort)
+	}
+	if r.Bytes != bytes || r.Packets != packets {
+		t.Errorf("Wrong counters: %d bytes, %d packets", r.Bytes, r.Packets)
+	}
+}
+
+func TestDecodeNetFlow5(t *testing.T) {
+	record := make([]byte, 48)
+	copy(record[0:], net.ParseIP("10.0.0.1").To4())
+	copy(record[4:], net.ParseIP("10.0.0.2").To4())
+	binary.BigEndian.PutUint32(record[16:], 3)
+	binary.BigEndian.PutUint32(record[20:], 180)
+	binary.BigEndian.PutUint32(record[24:], 1000)
+	binary.BigEndian.PutUint32(record[28:], 2000)
+	binary.BigEndian.PutUint16(record[32:], 4242)
+	binary.BigEndian.PutUint16(record[34:], 80)
+	record[37] = 0x02
+	record[38] = 6
+
+	// exported at 100s after a boot 10s before
+	data := concat(be16(5), be16(1), be32(10000), be32(100), be32(0), be32(1), []byte{0, 0, 0, 0}, record)
+
+	packet, err := NewDecoder().Decode("192.168.0.1", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packet.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(packet.Records))
+	}
+
+	r := packet.Records[0]
+	checkRecord(t, r, "10.0.0.1", "10.0.0.2", 4242, 80, 180, 3)
+	if r.Protocol != 6 || r.TCPFlags != 0x02 {
+		t.Errorf("Wrong protocol or flags: %d %d", r.Protocol, r.TCPFlags)
+	}
+	if ms := r.Start.UnixNano() / 1000000; ms != 91000 {
+		t.Errorf("Wrong start time: %d", ms)
+	}
+}
+
+func TestDecodeNetFlow9(t *testing.T) {
+	template := concat(be16(256), be16(6),
+		be16(ieSourceIPv4Address), be16(4),
+		be16(ieDestinationIPv4Address), be16(4),
+		be16(ieSourceTransportPort), be16(2),
+		be16(ieDestinationTransportPort), be16(2),
+		be16(ieProtocolIdentifier), be16(1),
+		be16(ieOctetDeltaCount), be16(4))
+
+	record := concat(net.ParseIP("10.0.0.1").To4(), net.ParseIP("10.0.0.2").To4(), be16(53000), be16(53), []byte{17}, be32(64))
+
+	header := concat(be16(9), be16(2), be32(10000), be32(100), be32(1), be32(7))
+
+	decoder := NewDecoder()
+
+	// data received before the template is dropped
+	packet, err := decoder.Decode("192.168.0.1", concat(header, set(256, record)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet.Records) != 0 {
+		t.Fatalf("Expected no record, got %d", len(packet.Records))
+	}
+
+	// padded data set
+	packet, err = decoder.Decode("192.168.0.1", concat(header, set(0, template), set(256, concat(record, record, []byte{0, 0}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.DomainID != 7 {
+		t.Errorf("Wrong source ID: %d", packet.DomainID)
+	}
+	if len(packet.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(packet.Records))
+	}
+	checkRecord(t, packet.Records[0], "10.0.0.1", "10.0.0.2", 53000, 53, 64, 0)
+
+	// templates are scoped to the exporter
+	packet, err = decoder.Decode("192.168.0.2", concat(header, set(256, record)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet.Records) != 0 {
+		t.Fatalf("Expected no record, got %d", len(packet.Records))
+	}
+}
+
+func TestDecodeIPFIX(t *testing.T) {
+	template := concat(be16(300), be16(5),
+		be16(ieSourceIPv6Address), be16(16),
+		be16(ieDestinationIPv6Address), be16(16),
+		be16(0x8000|1), be16(0xffff), be32(12345),
+		be16(iePacketDeltaCount), be16(8),
+		be16(ieFlowStartMilliseconds), be16(8))
+
+	record := concat(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"),
+		[]byte{3, 'f', 'o', 'o'},
+		be32(0), be32(12),
+		be32(0), be32(1500))
+
+	sets := concat(set(2, template), set(300, record))
+	data := concat(be16(10), be16(uint16(16+len(sets))), be32(100), be32(1), be32(42), sets)
+
+	packet, err := NewDecoder().Decode("2001:db8::ff", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Version != VersionIPFIX || packet.DomainID != 42 {
+		t.Errorf("Wrong header: %+v", packet)
+	}
+	if len(packet.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(packet.Records))
+	}
+
+	r := packet.Records[0]
+	checkRecord(t, r, "2001:db8::1", "2001:db8::2", 0, 0, 0, 12)
+	if ms := r.Start.UnixNano() / 1000000; ms != 1500 {
+		t.Errorf("Wrong start time: %d", ms)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	if _, err := NewDecoder().Decode("192.168.0.1", concat(be16(5), be16(2), make([]byte, 22))); err != ErrTruncated {
+		t.Errorf("Expected truncated error, got %v", err)
+	}
+}
@@ -191,7 +191,8 @@ func (o *OvsClient) Exec(operations ...libovsdb.Operation) ([]libovsdb.Operation
 	return result, nil
 }
 
-func (o *OvsMonitor) isConnected() bool {
+// IsConnected returns whether the monitor is connected to the OVS database
+func (o *OvsMonitor) IsConnected() bool {
 	return atomic.LoadUint64(&o.OvsClient.connected) == 1
 }
 
@@ -547,7 +548,7 @@ func (o *OvsMonitor) startMonitoring() error {
 	for {
 		select {
 		case <-o.ticker.C:
-			if o.isConnected() {
+			if o.IsConnected() {
 				connectedOnce = true
 				continue
 			}
@@ -572,7 +573,7 @@ func (o *OvsMonitor) StartMonitoring() {
 func (o *OvsMonitor) StopMonitoring() {
 	if o.OvsClient != nil {
 		o.done <- struct{}{}
-		if o.isConnected() == true {
+		if o.IsConnected() == true {
 			o.OvsClient.RLock()
 			o.OvsClient.ovsdb.Disconnect()
 			o.OvsClient.RUnlock()
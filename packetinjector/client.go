@@ -241,6 +241,47 @@ func (pc *Client) requestToParams(pi *types.PacketInjection) (string, *PacketInj
 	return srcNode.Host, pip, nil
 }
 
+// preview resolves the parameters of a packet injection without injecting.
+// The random payload and ports are drawn so that the returned injection
+// can be submitted as is, only the TCP sequence number being drawn again.
+func (pc *Client) preview(pi *types.PacketInjection, packet bool) (*types.PacketInjectionPreview, error) {
+	injection := *pi
+	if len(injection.Pcap) == 0 && injection.Payload == "" {
+		// use same size as ping when no payload specified
+		injection.Payload = common.RandString(56)
+	}
+
+	host, pip, err := pc.requestToParams(&injection)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &types.PacketInjectionPreview{
+		Host:      host,
+		Injection: &injection,
+	}
+
+	if packet && len(pip.Pcap) == 0 {
+		pc.graph.RLock()
+		srcNode := pc.graph.GetNode(pip.SrcNodeID)
+		pc.graph.RUnlock()
+		if srcNode == nil {
+			return nil, errors.New("Not able to find a source node")
+		}
+
+		generator, err := NewForgedPacketGenerator(pip, srcNode)
+		if err != nil {
+			return nil, err
+		}
+
+		if preview.Packet, err = generator.FirstPacket(); err != nil {
+			return nil, err
+		}
+	}
+
+	return preview, nil
+}
+
 func (pc *Client) expirePI(id string, expireTime time.Duration) {
 	time.Sleep(expireTime)
 	pc.piHandler.BasicAPIHandler.Delete(id)
@@ -340,6 +381,7 @@ func NewClient(pool ws.StructSpeakerPool, etcdClient *etcd.Client, piHandler *ap
 	}
 
 	election.AddEventListener(pic)
+	piHandler.Previewer = pic.preview
 
 	pic.setTimeouts()
 	return pic
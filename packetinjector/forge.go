@@ -121,6 +121,13 @@ func forgePacket(packetType string, layerType gopacket.LayerType, srcMAC, dstMAC
 	return packetData, gopacket.NewPacket(packetData, layerType, gopacket.Default), nil
 }
 
+// FirstPacket returns the bytes of the first forged packet, the payload
+// having to be set
+func (f *ForgedPacketGenerator) FirstPacket() ([]byte, error) {
+	packetData, _, err := forgePacket(f.Type, f.layerType, f.srcMAC, f.dstMAC, f.TTL, f.srcIP, f.dstIP, f.SrcPort, f.DstPort, f.ID, f.Payload)
+	return packetData, err
+}
+
 // PacketSource returns a channel when forged packets are pushed
 func (f *ForgedPacketGenerator) PacketSource() chan *Packet {
 	ch := make(chan *Packet)
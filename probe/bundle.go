@@ -82,6 +82,22 @@ func (p *Bundle) AddProbe(name string, probe Probe) {
 	p.probes[name] = probe
 }
 
+// RemoveProbe stops a probe and removes it from the bundle, returning nil
+// if the probe is not part of the bundle
+func (p *Bundle) RemoveProbe(name string) Probe {
+	p.Lock()
+	probe, ok := p.probes[name]
+	delete(p.probes, name)
+	p.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	probe.Stop()
+	return probe
+}
+
 // NewBundle creates a new probe bundle
 func NewBundle(p map[string]Probe) *Bundle {
 	return &Bundle{
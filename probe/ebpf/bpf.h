@@ -33,6 +33,7 @@
  */
 #define MAP(NAME) struct bpf_map_def __section("maps/"#NAME) NAME =
 #define SOCKET(NAME) __section("socket_"#NAME)
+#define TRACEPOINT(CATEGORY, NAME) __section("tracepoint/"#CATEGORY"/"#NAME)
 #define LICENSE __section("license")
 
 /* llvm built-in functions */
@@ -69,6 +70,8 @@ static unsigned long long (*bpf_get_current_pid_tgid)(void) =
   (void *) BPF_FUNC_get_current_pid_tgid;
 static unsigned long long (*bpf_get_current_uid_gid)(void) =
   (void *) BPF_FUNC_get_current_uid_gid;
+static int (*bpf_probe_read)(void *dst, int size, void *unsafe_ptr) =
+  (void *) BPF_FUNC_probe_read;
 
 #define DEBUG
 #ifdef DEBUG
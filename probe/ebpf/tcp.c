@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+#include <linux/stddef.h>
+
+#include "bpf.h"
+#include "tcp.h"
+
+#ifndef NULL
+#define NULL ((void*)0)
+#endif
+
+#ifndef AF_INET
+#define AF_INET 2
+#endif
+#ifndef AF_INET6
+#define AF_INET6 10
+#endif
+
+MAP(tcp_offsets) {
+	.type = BPF_MAP_TYPE_ARRAY,
+	.key_size = sizeof(__u32),
+	.value_size = sizeof(__u32),
+	.max_entries = TCP_OFFSETS_SIZE,
+};
+
+MAP(tcp_stats) {
+	.type = BPF_MAP_TYPE_LRU_HASH,
+	.key_size = sizeof(struct tcp_key),
+	.value_size = sizeof(struct tcp_stats),
+	.max_entries = 65536,
+};
+
+/* offset 0 being the one of common_type, a null offset means the field is
+ * not available
+ */
+static inline int tcp_offset(__u32 field, __u32 *offset)
+{
+	__u32 *value = bpf_map_lookup_element(&tcp_offsets, &field);
+	if (value == NULL || *value == 0) {
+		return -1;
+	}
+	*offset = *value;
+	return 0;
+}
+
+static inline int read_field(void *ctx, __u32 field, void *dst, int size)
+{
+	__u32 offset;
+	if (tcp_offset(field, &offset)) {
+		return -1;
+	}
+	return bpf_probe_read(dst, size, ctx + offset);
+}
+
+/* tcp_probe reports the addresses as struct sockaddr_in or sockaddr_in6 */
+static inline int read_sockaddr(void *ctx, __u32 field, __u8 *ip)
+{
+	__u32 offset;
+	if (tcp_offset(field, &offset)) {
+		return -1;
+	}
+
+	__u16 family = 0;
+	bpf_probe_read(&family, sizeof(family), ctx + offset);
+	switch (family) {
+		case AF_INET:
+			return bpf_probe_read(&ip[12], 4, ctx + offset + 4);
+		case AF_INET6:
+			return bpf_probe_read(ip, 16, ctx + offset + 8);
+	}
+	return -1;
+}
+
+/* tcp_retransmit_skb reports the IPv4 addresses as IPv4-mapped addresses */
+static inline int read_in6_addr(void *ctx, __u32 field, __u8 *ip)
+{
+	if (read_field(ctx, field, ip, 16)) {
+		return -1;
+	}
+
+	if (ip[10] == 0xff && ip[11] == 0xff &&
+	    !(ip[0] | ip[1] | ip[2] | ip[3] | ip[4] | ip[5] | ip[6] | ip[7] | ip[8] | ip[9])) {
+		ip[10] = 0;
+		ip[11] = 0;
+	}
+	return 0;
+}
+
+static inline struct tcp_stats *lookup_stats(struct tcp_key *key)
+{
+	struct tcp_stats *stats = bpf_map_lookup_element(&tcp_stats, key);
+	if (stats != NULL) {
+		return stats;
+	}
+
+	struct tcp_stats zero;
+	memset(&zero, 0, sizeof(zero));
+	bpf_map_update_element(&tcp_stats, key, &zero, BPF_NOEXIST);
+
+	return bpf_map_lookup_element(&tcp_stats, key);
+}
+
+TRACEPOINT(tcp, tcp_probe)
+int tcp_probe(void *ctx)
+{
+	struct tcp_key key;
+	memset(&key, 0, sizeof(key));
+
+	if (read_sockaddr(ctx, TCP_PROBE_SADDR, key.ip_src) ||
+	    read_sockaddr(ctx, TCP_PROBE_DADDR, key.ip_dst) ||
+	    read_field(ctx, TCP_PROBE_SPORT, &key.port_src, sizeof(key.port_src)) ||
+	    read_field(ctx, TCP_PROBE_DPORT, &key.port_dst, sizeof(key.port_dst))) {
+		return 0;
+	}
+
+	__u32 snd_wnd = 0, srtt = 0;
+	if (read_field(ctx, TCP_PROBE_SND_WND, &snd_wnd, sizeof(snd_wnd)) ||
+	    read_field(ctx, TCP_PROBE_SRTT, &srtt, sizeof(srtt))) {
+		return 0;
+	}
+
+	struct tcp_stats *stats = lookup_stats(&key);
+	if (stats == NULL) {
+		return 0;
+	}
+
+	stats->srtt_us = srtt;
+	stats->last = bpf_ktime_get_ns();
+
+	/* count the transitions to a null window advertised by the peer */
+	if (snd_wnd == 0) {
+		if (!stats->zero_window) {
+			stats->zero_window = 1;
+			__sync_fetch_and_add(&stats->zero_windows, 1);
+		}
+	} else {
+		stats->zero_window = 0;
+	}
+
+	return 0;
+}
+
+TRACEPOINT(tcp, tcp_retransmit_skb)
+int tcp_retransmit_skb(void *ctx)
+{
+	struct tcp_key key;
+	memset(&key, 0, sizeof(key));
+
+	if (read_in6_addr(ctx, TCP_RETRANSMIT_SADDR_V6, key.ip_src) ||
+	    read_in6_addr(ctx, TCP_RETRANSMIT_DADDR_V6, key.ip_dst) ||
+	    read_field(ctx, TCP_RETRANSMIT_SPORT, &key.port_src, sizeof(key.port_src)) ||
+	    read_field(ctx, TCP_RETRANSMIT_DPORT, &key.port_dst, sizeof(key.port_dst))) {
+		return 0;
+	}
+
+	struct tcp_stats *stats = lookup_stats(&key);
+	if (stats == NULL) {
+		return 0;
+	}
+
+	__sync_fetch_and_add(&stats->retransmits, 1);
+	stats->last = bpf_ktime_get_ns();
+
+	return 0;
+}
+
+char _license[] LICENSE = "GPL";
@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+#ifndef __TCP_H
+#define __TCP_H
+
+#include <linux/types.h>
+
+/* fields of the tcp tracepoints whose offsets are set by the userland, the
+ * layout of the tracepoints changing with the kernel version
+ */
+enum {
+	TCP_PROBE_SADDR = 0,
+	TCP_PROBE_DADDR,
+	TCP_PROBE_SPORT,
+	TCP_PROBE_DPORT,
+	TCP_PROBE_SND_WND,
+	TCP_PROBE_SRTT,
+	TCP_RETRANSMIT_SADDR_V6,
+	TCP_RETRANSMIT_DADDR_V6,
+	TCP_RETRANSMIT_SPORT,
+	TCP_RETRANSMIT_DPORT,
+	TCP_OFFSETS_SIZE,
+};
+
+/* socket seen from its local endpoint, the IPv4 addresses being stored in
+ * the last 4 bytes like in the flow table
+ */
+struct tcp_key {
+	__u8   ip_src[16];
+	__u8   ip_dst[16];
+	__u16  port_src;
+	__u16  port_dst;
+};
+
+struct tcp_stats {
+	__u64  srtt_us;
+	__u64  retransmits;
+	__u64  zero_windows;
+	__u64  last;
+	__u8   zero_window;
+};
+
+#endif
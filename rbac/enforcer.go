@@ -32,6 +32,25 @@ type Permission struct {
 
 var enforcer *casbin.SyncedEnforcer
 
+var readOnly bool
+
+// websocket endpoints used to push data, denied in read-only mode
+var ingestionEndpoints = map[string]bool{
+	"/ws/agent/topology": true,
+	"/ws/agent/flow":     true,
+	"/ws/publisher":      true,
+}
+
+// SetReadOnly denies, whatever the policies, all the write permissions
+// and the websocket endpoints used to push data
+func SetReadOnly(ro bool) {
+	readOnly = ro
+}
+
+func deniedByReadOnly(obj, act string) bool {
+	return readOnly && (act == "write" || (obj == "websocket" && ingestionEndpoints[act]))
+}
+
 // Init loads the model from the configuration file then the policies.
 // 3 policies are applied, in that order :
 // - the policy uploaded in etcd and shared by all analyzers
@@ -71,6 +90,10 @@ func Init(model model.Model, kapi etcd.KeysAPI, loadPolicy func(model.Model) err
 
 // Enforce decides whether a "subject" can access an "object" with the operation "action"
 func Enforce(sub, obj, act string) bool {
+	if deniedByReadOnly(obj, act) {
+		return false
+	}
+
 	if enforcer == nil {
 		return true
 	}
@@ -108,7 +131,7 @@ func GetPermissionsForUser(user string) []Permission {
 	mperms := make(map[string]Permission)
 	for _, subject := range subjects {
 		for _, p := range enforcer.GetPermissionsForUser(subject) {
-			permission := Permission{Object: p[1], Action: p[2], Allowed: p[3] == "allow"}
+			permission := Permission{Object: p[1], Action: p[2], Allowed: p[3] == "allow" && !deniedByReadOnly(p[1], p[2])}
 
 			key := permission.Object + permission.Action
 			mperms[key] = permission
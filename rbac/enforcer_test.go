@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rbac
+
+import (
+	"testing"
+
+	"github.com/casbin/casbin"
+	"github.com/casbin/casbin/model"
+	fileadapter "github.com/casbin/casbin/persist/file-adapter"
+)
+
+// loadBundledPolicy enforces the bundled policy with the default model
+func loadBundledPolicy() {
+	m := model.Model{}
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub, obj, act, eft")
+	m.AddDef("g", "g", "_, _")
+	m.AddDef("e", "e", "some(where (p_eft == allow)) && !some(where (p_eft == deny))")
+	m.AddDef("m", "m", "g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act")
+
+	e := casbin.NewSyncedEnforcer()
+	e.InitWithModelAndAdapter(m, fileadapter.NewAdapter("policy.csv"))
+	enforcer = e
+}
+
+func TestReadOnly(t *testing.T) {
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+
+	if !Enforce("admin", "topology", "read") {
+		t.Error("Read permissions should be granted in read-only mode")
+	}
+
+	if Enforce("admin", "capture", "write") {
+		t.Error("Write permissions should be denied in read-only mode")
+	}
+
+	if !Enforce("admin", "websocket", "/ws/subscriber") {
+		t.Error("Subscriber endpoint should be allowed in read-only mode")
+	}
+
+	for _, endpoint := range []string{"/ws/agent/topology", "/ws/agent/flow", "/ws/publisher"} {
+		if Enforce("admin", "websocket", endpoint) {
+			t.Errorf("Endpoint %s should be denied in read-only mode", endpoint)
+		}
+	}
+
+	SetReadOnly(false)
+	if !Enforce("admin", "capture", "write") {
+		t.Error("Write permissions should be granted without read-only mode")
+	}
+}
+
+func TestWebSocketEndpointsPolicy(t *testing.T) {
+	loadBundledPolicy()
+	defer func() { enforcer = nil }()
+
+	for _, test := range []struct {
+		user     string
+		endpoint string
+		allowed  bool
+	}{
+		{"admin", "/ws/subscriber", true},
+		{"admin", "/ws/subscriber/query", true},
+		{"admin", "/ws/subscriber/flow/tail", true},
+		{"guest", "/ws/subscriber", true},
+		{"guest", "/ws/subscriber/query", true},
+		{"guest", "/ws/subscriber/flow/tail", false},
+		{"guest", "/ws/publisher", false},
+	} {
+		if allowed := Enforce(test.user, "websocket", test.endpoint); allowed != test.allowed {
+			t.Errorf("Expected %s connection to %s allowed to be %t", test.user, test.endpoint, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// Report formats
+const (
+	FormatHTML = "html"
+	FormatCSV  = "csv"
+	FormatPDF  = "pdf"
+)
+
+// Section is a table of a report
+type Section struct {
+	Title   string
+	Columns []string
+	Rows    [][]string
+	Error   string
+}
+
+// Document is a report generated for a period
+type Document struct {
+	Name        string
+	Description string
+	Start       time.Time
+	End         time.Time
+	Sections    []*Section
+}
+
+const htmlTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 20px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<p>From {{.Start.Format "2006-01-02 15:04:05 MST"}} to {{.End.Format "2006-01-02 15:04:05 MST"}}</p>
+{{range .Sections}}
+<h2>{{.Title}}</h2>
+{{if .Error}}<p class="error">{{.Error}}</p>{{else if not .Rows}}<p>No data</p>{{else}}
+<table>
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{end}}
+</body>
+</html>
+`
+
+var htmlReport = template.Must(template.New("report").Parse(htmlTemplate))
+
+// RenderHTML writes the document as an HTML page
+func (d *Document) RenderHTML(w io.Writer) error {
+	return htmlReport.Execute(w, d)
+}
+
+// RenderCSV writes the sections of the document one after the other, each
+// one starting with its title and its columns
+func (d *Document) RenderCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	for i, section := range d.Sections {
+		if i > 0 {
+			writer.Write([]string{})
+		}
+
+		writer.Write([]string{"# " + section.Title})
+		if section.Error != "" {
+			writer.Write([]string{"# Error: " + section.Error})
+			continue
+		}
+
+		writer.Write(section.Columns)
+		writer.WriteAll(section.Rows)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Render writes the document in the given format
+func (d *Document) Render(w io.Writer, format string) error {
+	switch format {
+	case FormatHTML, "":
+		return d.RenderHTML(w)
+	case FormatCSV:
+		return d.RenderCSV(w)
+	case FormatPDF:
+		return d.RenderPDF(w)
+	}
+	return fmt.Errorf("Unsupported report format: %s", format)
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=UTF-8"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "text/html; charset=UTF-8"
+}
+
+// Extension returns the file extension of a format
+func Extension(format string) string {
+	if format == "" {
+		return FormatHTML
+	}
+	return format
+}
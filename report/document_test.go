@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDocument(rows int) *Document {
+	talkers := &Section{
+		Title:   "Top talkers",
+		Columns: []string{"A", "B", "Bytes"},
+	}
+	for i := 0; i < rows; i++ {
+		talkers.Rows = append(talkers.Rows, []string{fmt.Sprintf("192.168.0.%d", i), "10.0.0.1", "1024"})
+	}
+
+	return &Document{
+		Name:  "Daily <report>",
+		Start: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC),
+		Sections: []*Section{
+			talkers,
+			{Title: "Broken (query)", Error: "Syntax error"},
+		},
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestDocument(2).Render(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# Top talkers\nA,B,Bytes\n192.168.0.0,10.0.0.1,1024\n192.168.0.1,10.0.0.1,1024\n\n# Broken (query)\n# Error: Syntax error\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestDocument(1).Render(&buf, FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+
+	html := buf.String()
+	if !strings.Contains(html, "<h1>Daily &lt;report&gt;</h1>") {
+		t.Error("Report name should be escaped")
+	}
+	if !strings.Contains(html, "<td>192.168.0.0</td>") {
+		t.Error("Row missing from the table")
+	}
+	if !strings.Contains(html, `<p class="error">Syntax error</p>`) {
+		t.Error("Section error missing")
+	}
+}
+
+func TestRenderPDF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := newTestDocument(150).Render(&buf, FormatPDF); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-1.4\n") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("Invalid PDF header or trailer")
+	}
+
+	// 150 rows and the headers need 3 pages
+	if !strings.Contains(pdf, "/Count 3") {
+		t.Error("Expected a 3 pages document")
+	}
+
+	if !strings.Contains(pdf, `(== Broken \(query\) ==) Tj`) {
+		t.Error("Parenthesis should be escaped")
+	}
+
+	// the offsets of the cross reference table have to point to the objects
+	xref := pdf[strings.Index(pdf, "xref\n"):]
+	var offset int
+	fmt.Sscanf(strings.Split(xref, "\n")[3], "%d", &offset)
+	if !strings.HasPrefix(pdf[offset:], "1 0 obj") {
+		t.Errorf("Wrong offset for the first object: %d", offset)
+	}
+}
+
+func TestRenderUnknownFormat(t *testing.T) {
+	if err := newTestDocument(1).Render(&bytes.Buffer{}, "xls"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
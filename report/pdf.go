@@ -0,0 +1,175 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 pages using a fixed width font so that columns can be aligned
+const (
+	pdfPageWidth    = 595
+	pdfPageHeight   = 842
+	pdfMargin       = 40
+	pdfFontSize     = 8
+	pdfLineHeight   = 11
+	pdfLineLength   = 105
+	pdfLinesPerPage = (pdfPageHeight - 2*pdfMargin) / pdfLineHeight
+	pdfMaxColumn    = 32
+)
+
+// pdfEscape escapes a PDF string literal, the characters not supported by
+// the standard fonts are replaced
+func pdfEscape(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 32 || r > 126:
+			buf.WriteByte('?')
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+func truncate(s string, length int) string {
+	if len(s) > length {
+		return s[:length-3] + "..."
+	}
+	return s
+}
+
+// tableLines formats a section as aligned columns
+func tableLines(section *Section) []string {
+	widths := make([]int, len(section.Columns))
+	for i, column := range section.Columns {
+		widths[i] = len(truncate(column, pdfMaxColumn))
+	}
+	for _, row := range section.Rows {
+		for i, cell := range row {
+			if i < len(widths) && len(truncate(cell, pdfMaxColumn)) > widths[i] {
+				widths[i] = len(truncate(cell, pdfMaxColumn))
+			}
+		}
+	}
+
+	format := func(cells []string) string {
+		var fields []string
+		for i, cell := range cells {
+			if i < len(widths) {
+				fields = append(fields, fmt.Sprintf("%-*s", widths[i], truncate(cell, pdfMaxColumn)))
+			}
+		}
+		return truncate(strings.TrimRight(strings.Join(fields, "  "), " "), pdfLineLength)
+	}
+
+	lines := []string{format(section.Columns)}
+	for _, row := range section.Rows {
+		lines = append(lines, format(row))
+	}
+	return lines
+}
+
+func (d *Document) textLines() []string {
+	lines := []string{d.Name}
+	if d.Description != "" {
+		lines = append(lines, truncate(d.Description, pdfLineLength))
+	}
+	lines = append(lines, fmt.Sprintf("From %s to %s", d.Start.Format("2006-01-02 15:04:05 MST"), d.End.Format("2006-01-02 15:04:05 MST")))
+
+	for _, section := range d.Sections {
+		lines = append(lines, "", "== "+section.Title+" ==")
+		switch {
+		case section.Error != "":
+			lines = append(lines, truncate("Error: "+section.Error, pdfLineLength))
+		case len(section.Rows) == 0:
+			lines = append(lines, "No data")
+		default:
+			lines = append(lines, tableLines(section)...)
+		}
+	}
+
+	return lines
+}
+
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (p *pdfWriter) object(id int, content string) {
+	p.offsets[id] = p.buf.Len()
+	fmt.Fprintf(&p.buf, "%d 0 obj\n%s\nendobj\n", id, content)
+}
+
+// RenderPDF writes the document as a text only PDF
+func (d *Document) RenderPDF(w io.Writer) error {
+	lines := d.textLines()
+
+	var pages [][]string
+	for len(lines) > pdfLinesPerPage {
+		pages = append(pages, lines[:pdfLinesPerPage])
+		lines = lines[pdfLinesPerPage:]
+	}
+	pages = append(pages, lines)
+
+	p := &pdfWriter{offsets: make(map[int]int)}
+	p.buf.WriteString("%PDF-1.4\n")
+
+	// objects 1 to 3 are the catalog, the page tree and the font, each page
+	// uses then a content and a page object
+	p.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	p.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+
+	var kids []string
+	for i, page := range pages {
+		contentID, pageID := 4+2*i, 5+2*i
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+
+		p.object(contentID, fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+		p.object(pageID, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, contentID))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+
+	p.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+
+	count := 4 + 2*len(pages)
+	xref := p.buf.Len()
+	fmt.Fprintf(&p.buf, "xref\n0 %d\n0000000000 65535 f \n", count)
+	for id := 1; id < count; id++ {
+		fmt.Fprintf(&p.buf, "%010d 00000 n \n", p.offsets[id])
+	}
+	fmt.Fprintf(&p.buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", count, xref)
+
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
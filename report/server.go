@@ -0,0 +1,624 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/alert"
+	api "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/forecast"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	// maxEvents is the number of topology changes and alerts kept to
+	// generate the reports
+	maxEvents = 10000
+
+	defaultTopTalkers = 10
+
+	// postTimeout bounds the delivery of a report to a web endpoint
+	postTimeout = 30 * time.Second
+)
+
+type topologyChange struct {
+	Time   time.Time
+	Action string
+	Type   string
+	ID     string
+	Name   string
+}
+
+type alertEvent struct {
+	Time time.Time
+	UUID string
+}
+
+// Server generates the reports on their schedule and delivers them. As for
+// the alerting server, only the elected analyzer generates the reports.
+type Server struct {
+	common.RWMutex
+	common.MasterElection
+	graph.DefaultGraphListener
+	Graph         *graph.Graph
+	ReportHandler api.Handler
+	AlertHandler  api.Handler
+	watcher       api.StoppableWatcher
+	gremlinParser *traversal.GremlinTraversalParser
+	schedules     map[string]chan bool
+	eventsLock    sync.Mutex
+	changes       []topologyChange
+	alerts        []alertEvent
+	mailer        *mailer
+	Forecaster    *forecast.Forecaster
+}
+
+func (s *Server) recordChange(action, typ string, id graph.Identifier, getter common.Getter) {
+	name, _ := getter.GetFieldString("Name")
+	if name == "" {
+		name, _ = getter.GetFieldString("RelationType")
+	}
+
+	s.eventsLock.Lock()
+	s.changes = append(s.changes, topologyChange{Time: time.Now().UTC(), Action: action, Type: typ, ID: string(id), Name: name})
+	if len(s.changes) > maxEvents {
+		s.changes = s.changes[len(s.changes)-maxEvents:]
+	}
+	s.eventsLock.Unlock()
+}
+
+// OnNodeAdded event
+func (s *Server) OnNodeAdded(n *graph.Node) {
+	s.recordChange("added", "node", n.ID, n)
+}
+
+// OnNodeDeleted event
+func (s *Server) OnNodeDeleted(n *graph.Node) {
+	s.recordChange("deleted", "node", n.ID, n)
+}
+
+// OnEdgeAdded event
+func (s *Server) OnEdgeAdded(e *graph.Edge) {
+	s.recordChange("added", "edge", e.ID, e)
+}
+
+// OnEdgeDeleted event
+func (s *Server) OnEdgeDeleted(e *graph.Edge) {
+	s.recordChange("deleted", "edge", e.ID, e)
+}
+
+// OnAlert records the triggered alerts
+func (s *Server) OnAlert(msg *alert.Message) {
+	s.eventsLock.Lock()
+	s.alerts = append(s.alerts, alertEvent{Time: msg.Timestamp, UUID: msg.UUID})
+	if len(s.alerts) > maxEvents {
+		s.alerts = s.alerts[len(s.alerts)-maxEvents:]
+	}
+	s.eventsLock.Unlock()
+}
+
+func (s *Server) query(query string) ([]interface{}, error) {
+	ts, err := s.gremlinParser.Parse(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ts.Exec(s.Graph, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Values(), nil
+}
+
+// fieldValue returns the value of a field, using the getter of the graph
+// elements and of the flows or the JSON representation of the value
+func fieldValue(value interface{}, field string) interface{} {
+	if getter, ok := value.(common.Getter); ok {
+		v, _ := getter.GetField(field)
+		return v
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func (s *Server) querySection(section *Section, rs *types.ReportSection) {
+	values, err := s.query(rs.GremlinQuery)
+	if err != nil {
+		section.Error = err.Error()
+		return
+	}
+
+	section.Columns = rs.Fields
+	if len(section.Columns) == 0 {
+		section.Columns = []string{"Value"}
+	}
+
+	for _, value := range values {
+		if rs.Limit > 0 && len(section.Rows) >= rs.Limit {
+			break
+		}
+
+		var row []string
+		if len(rs.Fields) == 0 {
+			row = []string{formatValue(value)}
+		} else {
+			for _, field := range rs.Fields {
+				row = append(row, formatValue(fieldValue(value, field)))
+			}
+		}
+		section.Rows = append(section.Rows, row)
+	}
+}
+
+type talkers struct {
+	A, B     string
+	Protocol string
+	Bytes    int64
+	Packets  int64
+	Flows    int64
+}
+
+// topTalkersSection sums the traffic of the flows updated during the
+// period by pair of network endpoints
+func (s *Server) topTalkersSection(section *Section, rs *types.ReportSection, start time.Time) {
+	query := rs.GremlinQuery
+	if query == "" {
+		query = "G.Flows()"
+	}
+	query += fmt.Sprintf(".Has('Last', GTE(%d))", common.UnixMillis(start))
+
+	values, err := s.query(query)
+	if err != nil {
+		section.Error = err.Error()
+		return
+	}
+
+	pairs := make(map[string]*talkers)
+	for _, value := range values {
+		f, ok := value.(*flow.Flow)
+		if !ok || f.Metric == nil {
+			continue
+		}
+
+		layer := f.Network
+		if layer == nil {
+			layer = f.Link
+		}
+		if layer == nil {
+			continue
+		}
+
+		a, b := layer.A, layer.B
+		if a > b {
+			a, b = b, a
+		}
+
+		key := a + "/" + b + "/" + layer.Protocol.String()
+		t, found := pairs[key]
+		if !found {
+			t = &talkers{A: a, B: b, Protocol: layer.Protocol.String()}
+			pairs[key] = t
+		}
+		t.Bytes += f.Metric.ABBytes + f.Metric.BABytes
+		t.Packets += f.Metric.ABPackets + f.Metric.BAPackets
+		t.Flows++
+	}
+
+	var top []*talkers
+	for _, t := range pairs {
+		top = append(top, t)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Bytes != top[j].Bytes {
+			return top[i].Bytes > top[j].Bytes
+		}
+		return top[i].A+top[i].B < top[j].A+top[j].B
+	})
+
+	limit := rs.Limit
+	if limit <= 0 {
+		limit = defaultTopTalkers
+	}
+	if len(top) > limit {
+		top = top[:limit]
+	}
+
+	section.Columns = []string{"A", "B", "Protocol", "Bytes", "Packets", "Flows"}
+	for _, t := range top {
+		section.Rows = append(section.Rows, []string{
+			t.A, t.B, t.Protocol,
+			strconv.FormatInt(t.Bytes, 10), strconv.FormatInt(t.Packets, 10), strconv.FormatInt(t.Flows, 10),
+		})
+	}
+}
+
+func (s *Server) topologyChangesSection(section *Section, rs *types.ReportSection, start, end time.Time) {
+	section.Columns = []string{"Time", "Action", "Type", "Name", "ID"}
+
+	s.eventsLock.Lock()
+	defer s.eventsLock.Unlock()
+
+	for _, change := range s.changes {
+		if change.Time.Before(start) || change.Time.After(end) {
+			continue
+		}
+		if rs.Limit > 0 && len(section.Rows) >= rs.Limit {
+			break
+		}
+		section.Rows = append(section.Rows, []string{
+			change.Time.Format(time.RFC3339), change.Action, change.Type, change.Name, change.ID,
+		})
+	}
+}
+
+func (s *Server) alertName(id string) string {
+	if s.AlertHandler != nil {
+		if resource, ok := s.AlertHandler.Get(id); ok {
+			if al, ok := resource.(*types.Alert); ok && al.Name != "" {
+				return al.Name
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Server) alertsSection(section *Section, rs *types.ReportSection, start, end time.Time) {
+	type alertCount struct {
+		uuid  string
+		count int64
+		last  time.Time
+	}
+
+	s.eventsLock.Lock()
+	counts := make(map[string]*alertCount)
+	for _, event := range s.alerts {
+		if event.Time.Before(start) || event.Time.After(end) {
+			continue
+		}
+		c, found := counts[event.UUID]
+		if !found {
+			c = &alertCount{uuid: event.UUID}
+			counts[event.UUID] = c
+		}
+		c.count++
+		c.last = event.Time
+	}
+	s.eventsLock.Unlock()
+
+	var sorted []*alertCount
+	for _, c := range counts {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].uuid < sorted[j].uuid
+	})
+
+	section.Columns = []string{"Alert", "Name", "Count", "Last"}
+	for _, c := range sorted {
+		if rs.Limit > 0 && len(section.Rows) >= rs.Limit {
+			break
+		}
+		section.Rows = append(section.Rows, []string{
+			c.uuid, s.alertName(c.uuid), strconv.FormatInt(c.count, 10), c.last.Format(time.RFC3339),
+		})
+	}
+}
+
+// linkForecastSection lists the utilization trend of the links, the links
+// closest to saturation first
+func (s *Server) linkForecastSection(section *Section, rs *types.ReportSection) {
+	if s.Forecaster == nil {
+		section.Error = "Link utilization forecasting is not enabled"
+		return
+	}
+
+	forecasts, err := s.Forecaster.Forecasts()
+	if err != nil {
+		section.Error = err.Error()
+		return
+	}
+
+	section.Columns = []string{"Edge", "Capacity", "Current", "Trend", "Utilization", "Saturation"}
+	for _, fc := range forecasts {
+		if rs.Limit > 0 && len(section.Rows) >= rs.Limit {
+			break
+		}
+
+		saturation := ""
+		if fc.SaturationTime != 0 {
+			saturation = time.Unix(0, fc.SaturationTime*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+		}
+
+		section.Rows = append(section.Rows, []string{
+			fc.EdgeID,
+			strconv.FormatInt(fc.Capacity, 10),
+			strconv.FormatFloat(fc.Current, 'f', 0, 64),
+			strconv.FormatFloat(fc.Trend, 'f', 0, 64),
+			strconv.FormatFloat(fc.Utilization, 'f', 2, 64),
+			saturation,
+		})
+	}
+}
+
+// Generate generates the document of a report for the period ending at the given time
+func (s *Server) Generate(report *types.Report, end time.Time) (*Document, error) {
+	interval, err := report.Interval()
+	if err != nil {
+		return nil, err
+	}
+	start := end.Add(-interval)
+
+	doc := &Document{
+		Name:        report.Name,
+		Description: report.Description,
+		Start:       start,
+		End:         end,
+	}
+
+	for i := range report.Sections {
+		rs := &report.Sections[i]
+
+		section := &Section{Title: rs.Title}
+		if section.Title == "" {
+			section.Title = rs.Type
+		}
+
+		switch rs.Type {
+		case "query":
+			s.querySection(section, rs)
+		case "top-talkers":
+			s.topTalkersSection(section, rs, start)
+		case "topology-changes":
+			s.topologyChangesSection(section, rs, start, end)
+		case "alerts":
+			s.alertsSection(section, rs, start, end)
+		case "link-forecast":
+			s.linkForecastSection(section, rs)
+		default:
+			section.Error = fmt.Sprintf("Unknown section type: %s", rs.Type)
+		}
+
+		doc.Sections = append(doc.Sections, section)
+	}
+
+	return doc, nil
+}
+
+func postReport(url string, contentType string, payload []byte) error {
+	client := &http.Client{Timeout: postTimeout}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("Failed to post report to %s: %s", url, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Close = true
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error while posting report to %s: %s", url, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Error while posting report to %s: %s", url, resp.Status)
+	}
+
+	return nil
+}
+
+// deliver renders the document and sends it to the report destinations
+func (s *Server) deliver(report *types.Report, doc *Document) error {
+	var buf bytes.Buffer
+	if err := doc.Render(&buf, report.Format); err != nil {
+		return err
+	}
+
+	var recipients []string
+	for _, destination := range report.Destinations {
+		if strings.HasPrefix(destination, "mailto:") {
+			recipients = append(recipients, strings.Split(strings.TrimPrefix(destination, "mailto:"), ",")...)
+			continue
+		}
+
+		if err := postReport(destination, ContentType(report.Format), buf.Bytes()); err != nil {
+			logging.GetLogger().Error(err)
+		}
+	}
+
+	if len(recipients) > 0 {
+		subject := fmt.Sprintf("%s - %s", report.Name, doc.End.Format("2006-01-02 15:04"))
+		filename := fmt.Sprintf("%s.%s", strings.Replace(report.Name, " ", "_", -1), Extension(report.Format))
+		if err := s.mailer.send(recipients, subject, filename, ContentType(report.Format), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) runReport(report *types.Report) {
+	if !s.IsMaster() {
+		return
+	}
+
+	logging.GetLogger().Debugf("Generating report %s (%s)", report.Name, report.UUID)
+
+	doc, err := s.Generate(report, time.Now().UTC())
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to generate report %s: %s", report.Name, err)
+		return
+	}
+
+	if err := s.deliver(report, doc); err != nil {
+		logging.GetLogger().Errorf("Failed to deliver report %s: %s", report.Name, err)
+	}
+}
+
+func (s *Server) registerReport(report *types.Report) error {
+	interval, err := report.Interval()
+	if err != nil {
+		return err
+	}
+
+	s.unregisterReport(report.UUID)
+
+	logging.GetLogger().Debugf("Registering report %s every %s", report.Name, interval)
+
+	done := make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.runReport(report)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	s.Lock()
+	s.schedules[report.UUID] = done
+	s.Unlock()
+
+	return nil
+}
+
+func (s *Server) unregisterReport(id string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if ch, found := s.schedules[id]; found {
+		logging.GetLogger().Debugf("Unregistering report: %s", id)
+		close(ch)
+		delete(s.schedules, id)
+	}
+}
+
+func (s *Server) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	switch action {
+	case "init", "create", "set", "update":
+		if err := s.registerReport(resource.(*types.Report)); err != nil {
+			logging.GetLogger().Errorf("Failed to register report: %s", err)
+		}
+	case "expire", "delete":
+		s.unregisterReport(id)
+	}
+}
+
+// Start the report server
+func (s *Server) Start() {
+	s.MasterElection.Start()
+
+	s.Graph.AddEventListener(s)
+	s.watcher = s.ReportHandler.AsyncWatch(s.onAPIWatcherEvent)
+}
+
+// Stop the report server
+func (s *Server) Stop() {
+	s.watcher.Stop()
+	s.Graph.RemoveEventListener(s)
+
+	s.Lock()
+	for id, ch := range s.schedules {
+		close(ch)
+		delete(s.schedules, id)
+	}
+	s.Unlock()
+
+	s.MasterElection.Stop()
+}
+
+// NewServer creates a new report server
+func NewServer(apiServer *api.Server, g *graph.Graph, parser *traversal.GremlinTraversalParser, etcdClient *etcd.Client) *Server {
+	return &Server{
+		MasterElection: etcdClient.NewElection("report-server"),
+		Graph:          g,
+		ReportHandler:  apiServer.GetHandler("report"),
+		AlertHandler:   apiServer.GetHandler("alert"),
+		gremlinParser:  parser,
+		schedules:      make(map[string]chan bool),
+		mailer: &mailer{
+			address:  config.GetString("analyzer.report.smtp.address"),
+			from:     config.GetString("analyzer.report.smtp.from"),
+			username: config.GetString("analyzer.report.smtp.username"),
+			password: config.GetString("analyzer.report.smtp.password"),
+		},
+	}
+}
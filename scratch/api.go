@@ -0,0 +1,217 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package scratch
+
+import (
+	"encoding/json"
+	"net/http"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	"github.com/skydive-project/skydive/api/types"
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/rbac"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// CreateParams describes the creation of a scratch context, GremlinQuery
+// returning the topology copied, like G or G.V().Has('Host', 'h1').SubGraph()
+type CreateParams struct {
+	Name         string
+	GremlinQuery string `valid:"isGremlinOrEmpty"`
+}
+
+// context returns the context of the request, writing the error if not found
+func (m *Manager) context(w http.ResponseWriter, r *auth.AuthenticatedRequest) *Context {
+	c, err := m.Get(mux.Vars(&r.Request)["name"])
+	if err != nil {
+		shttp.WriteError(w, http.StatusNotFound, err)
+		return nil
+	}
+	return c
+}
+
+func (m *Manager) scratchIndex(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "scratch", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, m.List())
+}
+
+func (m *Manager) scratchCreate(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "scratch", "write") || !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params CreateParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validator.Validate(params); err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	c, err := m.Create(params.Name, params.GremlinQuery)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == ErrConflict {
+			status = http.StatusConflict
+		}
+		shttp.WriteError(w, status, err)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, c.Info())
+}
+
+func (m *Manager) scratchGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "scratch", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if c := m.context(w, r); c != nil {
+		shttp.WriteJSON(w, http.StatusOK, c.Info())
+	}
+}
+
+func (m *Manager) scratchDelete(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "scratch", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := m.Delete(mux.Vars(&r.Request)["name"]); err != nil {
+		shttp.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (m *Manager) scratchChanges(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "scratch", "write") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	c := m.context(w, r)
+	if c == nil {
+		return
+	}
+
+	var changes []Change
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := c.Apply(changes); err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, c.Info())
+}
+
+func (m *Manager) scratchTopology(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "scratch", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	c := m.context(w, r)
+	if c == nil {
+		return
+	}
+
+	var params types.TopologyParam
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validator.Validate(params); err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	query, err := params.Query()
+	if err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	res, err := c.Query(m.gremlinParser, query)
+	if err != nil {
+		shttp.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	shttp.WriteJSON(w, http.StatusOK, res)
+}
+
+// RegisterEndpoints registers the endpoints of the scratch contexts
+func (m *Manager) RegisterEndpoints(s *shttp.Server, authBackend shttp.AuthenticationBackend) {
+	routes := []shttp.Route{
+		{
+			Name:        "ScratchIndex",
+			Method:      "GET",
+			Path:        "/api/scratch",
+			HandlerFunc: m.scratchIndex,
+		},
+		{
+			Name:        "ScratchCreate",
+			Method:      "POST",
+			Path:        "/api/scratch",
+			HandlerFunc: m.scratchCreate,
+		},
+		{
+			Name:        "ScratchGet",
+			Method:      "GET",
+			Path:        "/api/scratch/{name}",
+			HandlerFunc: m.scratchGet,
+		},
+		{
+			Name:        "ScratchDelete",
+			Method:      "DELETE",
+			Path:        "/api/scratch/{name}",
+			HandlerFunc: m.scratchDelete,
+		},
+		{
+			Name:        "ScratchChanges",
+			Method:      "POST",
+			Path:        "/api/scratch/{name}/changes",
+			HandlerFunc: m.scratchChanges,
+		},
+		{
+			Name:        "ScratchTopology",
+			Method:      "POST",
+			Path:        "/api/scratch/{name}/topology",
+			HandlerFunc: m.scratchTopology,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
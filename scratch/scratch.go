@@ -0,0 +1,401 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package scratch implements the scratch contexts, writable copies of the
+// topology on which changes are simulated - a link removed, a route
+// changed - and queried, without touching the live graph.
+package scratch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cache "github.com/pmylund/go-cache"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Operations of the changes applied to a scratch context
+const (
+	AddNode     = "add-node"
+	RemoveNode  = "remove-node"
+	AddEdge     = "add-edge"
+	RemoveEdge  = "remove-edge"
+	SetMetadata = "set-metadata"
+	DelMetadata = "del-metadata"
+)
+
+// ErrNotFound is returned when the scratch context does not exist
+var ErrNotFound = errors.New("Scratch context not found")
+
+// ErrConflict is returned when a scratch context with the same name exists
+var ErrConflict = errors.New("Scratch context already exists")
+
+// Change describes a change of the scratch topology. The edges are
+// identified either by ID or by their Parent and Child nodes, the first edge
+// matching Metadata being removed. The metadata Key of a node or an edge
+// identified by ID is set to Value or removed.
+type Change struct {
+	Op       string
+	ID       string         `json:",omitempty"`
+	Parent   string         `json:",omitempty"`
+	Child    string         `json:",omitempty"`
+	Key      string         `json:",omitempty"`
+	Value    interface{}    `json:",omitempty"`
+	Metadata graph.Metadata `json:",omitempty"`
+}
+
+// Info describes a scratch context, Changes being the changes applied since
+// its creation
+type Info struct {
+	Name         string
+	GremlinQuery string
+	CreatedAt    int64
+	Nodes        int
+	Edges        int
+	Changes      []Change
+}
+
+// Context is a scratch context, the graph being a copy of the topology
+// returned by the query when created
+type Context struct {
+	sync.Mutex
+	graph   *graph.Graph
+	name    string
+	query   string
+	created time.Time
+	changes []Change
+}
+
+// Manager holds the scratch contexts, a context being removed when not used
+// during the TTL
+type Manager struct {
+	sync.Mutex
+	graph         *graph.Graph
+	gremlinParser *traversal.GremlinTraversalParser
+	contexts      *cache.Cache
+	maxContexts   int
+	ttl           time.Duration
+}
+
+// Info returns the description of the context
+func (c *Context) Info() *Info {
+	c.Lock()
+	defer c.Unlock()
+
+	c.graph.RLock()
+	defer c.graph.RUnlock()
+
+	return &Info{
+		Name:         c.name,
+		GremlinQuery: c.query,
+		CreatedAt:    common.UnixMillis(c.created),
+		Nodes:        len(c.graph.GetNodes(nil)),
+		Edges:        len(c.graph.GetEdges(nil)),
+		Changes:      append([]Change{}, c.changes...),
+	}
+}
+
+// element returns the node or the edge with the given ID
+func (c *Context) element(id string) (interface{}, error) {
+	if n := c.graph.GetNode(graph.Identifier(id)); n != nil {
+		return n, nil
+	}
+	if e := c.graph.GetEdge(graph.Identifier(id)); e != nil {
+		return e, nil
+	}
+	return nil, fmt.Errorf("No node or edge %s", id)
+}
+
+func (c *Context) node(id string) (*graph.Node, error) {
+	if n := c.graph.GetNode(graph.Identifier(id)); n != nil {
+		return n, nil
+	}
+	return nil, fmt.Errorf("No node %s", id)
+}
+
+func (c *Context) apply(change *Change) error {
+	g := c.graph
+
+	switch change.Op {
+	case AddNode:
+		id := graph.Identifier(change.ID)
+		if id == "" {
+			id = graph.GenID()
+			change.ID = string(id)
+		}
+		_, err := g.NewNode(id, change.Metadata)
+		return err
+	case RemoveNode:
+		n, err := c.node(change.ID)
+		if err != nil {
+			return err
+		}
+		return g.DelNode(n)
+	case AddEdge:
+		parent, err := c.node(change.Parent)
+		if err != nil {
+			return err
+		}
+		child, err := c.node(change.Child)
+		if err != nil {
+			return err
+		}
+
+		metadata := graph.Metadata{"RelationType": "layer2"}
+		for k, v := range change.Metadata {
+			metadata[k] = v
+		}
+
+		id := graph.Identifier(change.ID)
+		if id == "" {
+			id = graph.GenID()
+			change.ID = string(id)
+		}
+		_, err = g.NewEdge(id, parent, child, metadata)
+		return err
+	case RemoveEdge:
+		if change.ID != "" {
+			e := g.GetEdge(graph.Identifier(change.ID))
+			if e == nil {
+				return fmt.Errorf("No edge %s", change.ID)
+			}
+			return g.DelEdge(e)
+		}
+
+		parent, err := c.node(change.Parent)
+		if err != nil {
+			return err
+		}
+		child, err := c.node(change.Child)
+		if err != nil {
+			return err
+		}
+
+		e := g.GetFirstLink(parent, child, change.Metadata)
+		if e == nil {
+			e = g.GetFirstLink(child, parent, change.Metadata)
+		}
+		if e == nil {
+			return fmt.Errorf("No edge between %s and %s", change.Parent, change.Child)
+		}
+		change.ID = string(e.ID)
+		return g.DelEdge(e)
+	case SetMetadata, DelMetadata:
+		if change.Key == "" {
+			return errors.New("No metadata key")
+		}
+
+		i, err := c.element(change.ID)
+		if err != nil {
+			return err
+		}
+
+		if change.Op == DelMetadata {
+			return g.DelMetadata(i, change.Key)
+		}
+		return g.AddMetadata(i, change.Key, change.Value)
+	}
+
+	return fmt.Errorf("Unknown change operation %s", change.Op)
+}
+
+// Apply applies the changes in order. The changes are applied up to the
+// first one failing, whose index is reported in the error.
+func (c *Context) Apply(changes []Change) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.graph.Lock()
+	defer c.graph.Unlock()
+
+	for i := range changes {
+		change := changes[i]
+		if err := c.apply(&change); err != nil {
+			return fmt.Errorf("Change %d (%s) failed: %s", i, change.Op, err)
+		}
+		c.changes = append(c.changes, change)
+	}
+	return nil
+}
+
+// Query runs a gremlin query against the scratch topology
+func (c *Context) Query(parser *traversal.GremlinTraversalParser, query string) (traversal.GraphTraversalStep, error) {
+	ts, err := parser.Parse(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	// the scratch graph has no history
+	return ts.Exec(c.graph, true)
+}
+
+// snapshot returns a copy of the elements of the topology returned by the
+// query, the copy sharing nothing with the live graph
+func (m *Manager) snapshot(query string) (*graph.Elements, error) {
+	ts, err := m.gremlinParser.Parse(strings.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ts.Exec(m.graph, true)
+	if err != nil {
+		return nil, err
+	}
+
+	graphTraversal, ok := res.(*traversal.GraphTraversal)
+	if !ok {
+		return nil, fmt.Errorf("Query %s doesn't return a topology", query)
+	}
+
+	g := graphTraversal.Graph
+	g.RLock()
+	data, err := json.Marshal(g.Elements())
+	g.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var elements graph.Elements
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+	return &elements, nil
+}
+
+// Create creates a scratch context from the topology returned by the
+// query, the whole topology if empty
+func (m *Manager) Create(name, query string) (*Context, error) {
+	if name == "" {
+		return nil, errors.New("No scratch context name")
+	}
+	if query == "" {
+		query = "G"
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if _, found := m.contexts.Get(name); found {
+		return nil, ErrConflict
+	}
+	if m.contexts.ItemCount() >= m.maxContexts {
+		return nil, fmt.Errorf("Too many scratch contexts, %d at most", m.maxContexts)
+	}
+
+	elements, err := m.snapshot(query)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := graph.NewMemoryBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	g := graph.NewGraph(m.graph.GetHost(), backend, common.AnalyzerService)
+	for _, n := range elements.Nodes {
+		if err := g.AddNode(n); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range elements.Edges {
+		// the edges of the query results may link nodes not returned
+		if g.GetNode(e.Parent) == nil || g.GetNode(e.Child) == nil {
+			continue
+		}
+		if err := g.AddEdge(e); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Context{graph: g, name: name, query: query, created: time.Now().UTC()}
+	m.contexts.Set(name, c, m.ttl)
+
+	logging.GetLogger().Infof("Scratch context %s created with %d nodes and %d edges", name, len(elements.Nodes), len(elements.Edges))
+
+	return c, nil
+}
+
+// Get returns a scratch context, its TTL being extended
+func (m *Manager) Get(name string) (*Context, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	c, found := m.contexts.Get(name)
+	if !found {
+		return nil, ErrNotFound
+	}
+	m.contexts.Set(name, c, m.ttl)
+	return c.(*Context), nil
+}
+
+// Delete removes a scratch context
+func (m *Manager) Delete(name string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, found := m.contexts.Get(name); !found {
+		return ErrNotFound
+	}
+	m.contexts.Delete(name)
+	return nil
+}
+
+// List returns the description of the scratch contexts sorted by name
+func (m *Manager) List() []*Info {
+	infos := []*Info{}
+	for _, item := range m.contexts.Items() {
+		infos = append(infos, item.Object.(*Context).Info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// NewManager returns a new scratch context manager of the given graph
+func NewManager(g *graph.Graph, parser *traversal.GremlinTraversalParser, maxContexts int, ttl time.Duration) *Manager {
+	return &Manager{
+		graph:         g,
+		gremlinParser: parser,
+		contexts:      cache.New(ttl, ttl),
+		maxContexts:   maxContexts,
+		ttl:           ttl,
+	}
+}
+
+// NewManagerFromConfig returns a new scratch context manager, nil if
+// disabled by the configuration
+func NewManagerFromConfig(g *graph.Graph, parser *traversal.GremlinTraversalParser) *Manager {
+	maxContexts := config.GetInt("analyzer.scratch.max_contexts")
+	if maxContexts <= 0 {
+		return nil
+	}
+
+	return NewManager(g, parser, maxContexts, time.Duration(config.GetInt("analyzer.scratch.ttl"))*time.Second)
+}
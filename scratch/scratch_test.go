@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package scratch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+)
+
+func newManager(t *testing.T) (*Manager, *graph.Graph) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AnalyzerService)
+
+	g.Lock()
+	a, _ := g.NewNode(graph.Identifier("a"), graph.Metadata{"Name": "a", "Type": "device"})
+	bn, _ := g.NewNode(graph.Identifier("b"), graph.Metadata{"Name": "b", "Type": "device"})
+	c, _ := g.NewNode(graph.Identifier("c"), graph.Metadata{"Name": "c", "Type": "device"})
+	g.NewEdge(graph.Identifier("ab"), a, bn, graph.Metadata{"RelationType": "layer2"})
+	g.NewEdge(graph.Identifier("bc"), bn, c, graph.Metadata{"RelationType": "layer2"})
+	g.Unlock()
+
+	return NewManager(g, traversal.NewGremlinTraversalParser(), 2, time.Minute), g
+}
+
+func count(t *testing.T, c *Context, m *Manager, query string) int {
+	res, err := c.Query(m.gremlinParser, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(res.Values())
+}
+
+func TestScratchChanges(t *testing.T) {
+	m, g := newManager(t)
+
+	c, err := m.Create("what-if", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.Apply([]Change{
+		{Op: RemoveEdge, Parent: "b", Child: "a"},
+		{Op: SetMetadata, ID: "c", Key: "State", Value: "DOWN"},
+		{Op: AddNode, ID: "d", Metadata: graph.Metadata{"Name": "d", "Type": "device"}},
+		{Op: AddEdge, Parent: "a", Child: "d"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, c, m, "G.V().Has('Name', 'a').Both().Has('Name', 'b')"); n != 0 {
+		t.Errorf("Expected the link between a and b removed, got %d neighbors", n)
+	}
+
+	if n := count(t, c, m, "G.V().Has('Name', 'a').Both().Has('Name', 'd')"); n != 1 {
+		t.Errorf("Expected a linked to d, got %d neighbors", n)
+	}
+
+	if n := count(t, c, m, "G.V().Has('State', 'DOWN')"); n != 1 {
+		t.Errorf("Expected c to be down, got %d nodes", n)
+	}
+
+	// the live graph is not changed
+	g.RLock()
+	if len(g.GetEdges(nil)) != 2 || len(g.GetNodes(nil)) != 3 {
+		t.Errorf("Expected the live graph to be unchanged, got %v", g)
+	}
+	if _, err := g.GetNode("c").GetFieldString("State"); err == nil {
+		t.Error("Expected no State on the live node")
+	}
+	g.RUnlock()
+
+	info := c.Info()
+	if len(info.Changes) != 4 || info.Changes[0].ID != "ab" || info.Nodes != 4 || info.Edges != 2 {
+		t.Errorf("Unexpected scratch context %+v", info)
+	}
+}
+
+func TestScratchFailingChange(t *testing.T) {
+	m, _ := newManager(t)
+
+	c, err := m.Create("what-if", "G.V().Has('Name', 'a').SubGraph()")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info := c.Info(); info.Nodes != 1 || info.Edges != 0 {
+		t.Errorf("Expected only the node a to be copied, got %+v", info)
+	}
+
+	err = c.Apply([]Change{
+		{Op: SetMetadata, ID: "a", Key: "State", Value: "DOWN"},
+		{Op: RemoveNode, ID: "b"},
+	})
+	if err == nil {
+		t.Fatal("Expected the removal of an unknown node to fail")
+	}
+
+	if len(c.Info().Changes) != 1 {
+		t.Errorf("Expected the changes preceding the failing one to be applied, got %+v", c.Info().Changes)
+	}
+}
+
+func TestScratchContexts(t *testing.T) {
+	m, _ := newManager(t)
+
+	if _, err := m.Create("s1", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Create("s1", ""); err != ErrConflict {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+
+	if _, err := m.Create("s2", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Create("s3", ""); err == nil {
+		t.Error("Expected the number of contexts to be limited")
+	}
+
+	if err := m.Delete("s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Get("s1"); err != ErrNotFound {
+		t.Errorf("Expected s1 to be deleted, got %v", err)
+	}
+
+	if infos := m.List(); len(infos) != 1 || infos[0].Name != "s2" {
+		t.Errorf("Expected only s2, got %+v", infos)
+	}
+}
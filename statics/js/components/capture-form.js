@@ -161,6 +161,7 @@ Vue.component('capture-form', {
       for (let t of this.$allowedTypes()) {
         options[t] = [
           {"type": "afpacket", "desc": "MMap'd AF_PACKET socket reading"},
+          {"type": "afxdp", "desc": "AF_XDP socket reading, falling back to afpacket"},
           {"type": "pcap", "desc": "Packet Capture library based probe"},
           {"type": "pcapsocket", "desc": "Socket reading PCAP format data"},
           {"type": "sflow", "desc": "Socket reading sFlow frames"},
@@ -0,0 +1,413 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/storage"
+)
+
+// Config describes the configuration of a ClickHouse client
+type Config struct {
+	URL          string
+	Database     string
+	Username     string
+	Password     string
+	BulkSize     int
+	BulkMaxDelay int
+	TTL          int
+}
+
+// ClientInterface describes the mechanism API of ClickHouse database client
+type ClientInterface interface {
+	Exec(query string) error
+	Query(query string) ([]json.RawMessage, error)
+	BulkInsert(table string, row interface{}) error
+	Flush() error
+	TTL(column string, where string) string
+	Connect() error
+	AddEventListener(listener storage.EventListener)
+	Start()
+	Stop()
+}
+
+// Client describes a ClickHouse client using the HTTP interface, the rows
+// being inserted by batches
+type Client struct {
+	sync.RWMutex
+	cfg       Config
+	client    *http.Client
+	bulk      map[string][]json.RawMessage
+	bulkLock  sync.Mutex
+	bulkRows  int
+	listeners []storage.EventListener
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Columns maps the filter keys to the table columns of the given types,
+// the other keys being extracted from the JSON document stored in the
+// JSON column
+type Columns struct {
+	Types map[string]string
+	JSON  string
+}
+
+// Quote returns a ClickHouse string literal
+func Quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func (c Columns) jsonPath(key string) string {
+	var path []string
+	for _, s := range strings.Split(key, ".") {
+		path = append(path, Quote(s))
+	}
+	return c.JSON + ", " + strings.Join(path, ", ")
+}
+
+// Value returns the expression of a key holding a value of the given type
+func (c Columns) Value(key, typ string) string {
+	if _, ok := c.Types[key]; ok || c.JSON == "" {
+		return "`" + key + "`"
+	}
+	return fmt.Sprintf("JSONExtract(%s, %s)", c.jsonPath(key), Quote(typ))
+}
+
+// Values returns the expression of a key holding an array of the given
+// type, empty for the columns
+func (c Columns) Values(key, typ string) string {
+	if _, ok := c.Types[key]; ok || c.JSON == "" {
+		return ""
+	}
+	return fmt.Sprintf("JSONExtract(%s, %s)", c.jsonPath(key), Quote("Array("+typ+")"))
+}
+
+// Null returns the expression testing the absence of a key
+func (c Columns) Null(key string) string {
+	typ, ok := c.Types[key]
+	switch {
+	case !ok && c.JSON != "":
+		return fmt.Sprintf("NOT JSONHas(%s)", c.jsonPath(key))
+	case strings.HasPrefix(typ, "Nullable"):
+		return fmt.Sprintf("isNull(`%s`)", key)
+	case typ == "String":
+		return fmt.Sprintf("`%s` = ''", key)
+	}
+	return fmt.Sprintf("`%s` = 0", key)
+}
+
+func termExpression(c Columns, key, typ, value string) string {
+	expr := fmt.Sprintf("%s = %s", c.Value(key, typ), value)
+	if values := c.Values(key, typ); values != "" {
+		// metadata values may be arrays, matching when one of the items does
+		expr = fmt.Sprintf("(%s OR has(%s, %s))", expr, values, value)
+	}
+	return expr
+}
+
+func matchExpression(c Columns, key, pattern string) string {
+	expr := fmt.Sprintf("match(%s, %s)", c.Value(key, "String"), Quote(pattern))
+	if values := c.Values(key, "String"); values != "" {
+		expr = fmt.Sprintf("(%s OR arrayExists(x -> match(x, %s), %s))", expr, Quote(pattern), values)
+	}
+	return expr
+}
+
+// FilterToExpression returns a ClickHouse expression based on filters
+func FilterToExpression(f *filters.Filter, c Columns) string {
+	if f == nil {
+		return ""
+	}
+
+	if f.BoolFilter != nil {
+		keyword := ""
+		switch f.BoolFilter.Op {
+		case filters.BoolFilterOp_NOT:
+			return "NOT (" + FilterToExpression(f.BoolFilter.Filters[0], c) + ")"
+		case filters.BoolFilterOp_OR:
+			keyword = "OR"
+		case filters.BoolFilterOp_AND:
+			keyword = "AND"
+		}
+		var conditions []string
+		for _, item := range f.BoolFilter.Filters {
+			if expr := FilterToExpression(item, c); expr != "" {
+				conditions = append(conditions, "("+expr+")")
+			}
+		}
+		return strings.Join(conditions, " "+keyword+" ")
+	}
+
+	if f.TermStringFilter != nil {
+		return termExpression(c, f.TermStringFilter.Key, "String", Quote(f.TermStringFilter.Value))
+	}
+
+	if f.TermInt64Filter != nil {
+		return termExpression(c, f.TermInt64Filter.Key, "Int64", fmt.Sprintf("%d", f.TermInt64Filter.Value))
+	}
+
+	if f.TermBoolFilter != nil {
+		return termExpression(c, f.TermBoolFilter.Key, "Bool", strconv.FormatBool(f.TermBoolFilter.Value))
+	}
+
+	if f.GtInt64Filter != nil {
+		return fmt.Sprintf("%s > %d", c.Value(f.GtInt64Filter.Key, "Int64"), f.GtInt64Filter.Value)
+	}
+
+	if f.LtInt64Filter != nil {
+		return fmt.Sprintf("%s < %d", c.Value(f.LtInt64Filter.Key, "Int64"), f.LtInt64Filter.Value)
+	}
+
+	if f.GteInt64Filter != nil {
+		return fmt.Sprintf("%s >= %d", c.Value(f.GteInt64Filter.Key, "Int64"), f.GteInt64Filter.Value)
+	}
+
+	if f.LteInt64Filter != nil {
+		return fmt.Sprintf("%s <= %d", c.Value(f.LteInt64Filter.Key, "Int64"), f.LteInt64Filter.Value)
+	}
+
+	if f.RegexFilter != nil {
+		return matchExpression(c, f.RegexFilter.Key, f.RegexFilter.Value)
+	}
+
+	if f.NullFilter != nil {
+		return c.Null(f.NullFilter.Key)
+	}
+
+	if f.IPV4RangeFilter != nil {
+		// ignore the error at this point it should have been catched earlier
+		regex, _ := common.IPV4CIDRToRegex(f.IPV4RangeFilter.Value)
+		return matchExpression(c, f.IPV4RangeFilter.Key, regex)
+	}
+
+	return ""
+}
+
+// TTL returns the TTL clause of a table whose rows expire after the
+// configured number of days from the given millisecond timestamp column,
+// only the rows matching the condition if any
+func (c *Client) TTL(column string, where string) string {
+	if c.cfg.TTL <= 0 {
+		return ""
+	}
+
+	ttl := fmt.Sprintf(" TTL toDateTime(intDiv(%s, 1000)) + INTERVAL %d DAY", column, c.cfg.TTL)
+	if where != "" {
+		ttl += " DELETE WHERE " + where
+	}
+	return ttl
+}
+
+func (c *Client) request(query string, body io.Reader, database bool) ([]byte, error) {
+	params := url.Values{}
+	if database {
+		params.Set("database", c.cfg.Database)
+	}
+	// 64 bits integers are quoted by default in the JSON formats
+	params.Set("output_format_json_quote_64bit_integers", "0")
+	params.Set("input_format_skip_unknown_fields", "1")
+
+	if body == nil {
+		body = strings.NewReader(query)
+	} else {
+		params.Set("query", query)
+	}
+
+	request, err := http.NewRequest("POST", c.cfg.URL+"/?"+params.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("X-ClickHouse-User", c.cfg.Username)
+	request.Header.Set("X-ClickHouse-Key", c.cfg.Password)
+
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ClickHouse error %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+// Exec executes a statement
+func (c *Client) Exec(query string) error {
+	_, err := c.request(query, nil, true)
+	return err
+}
+
+// Query executes a select statement and returns its rows
+func (c *Client) Query(query string) ([]json.RawMessage, error) {
+	data, err := c.request(query+" FORMAT JSONEachRow", nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []json.RawMessage
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) > 0 {
+			rows = append(rows, json.RawMessage(line))
+		}
+	}
+
+	return rows, nil
+}
+
+// BulkInsert queues a row to be inserted in a table, the rows being sent
+// when reaching the bulk size or after the bulk maximum delay
+func (c *Client) BulkInsert(table string, row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	c.bulkLock.Lock()
+	c.bulk[table] = append(c.bulk[table], json.RawMessage(data))
+	c.bulkRows++
+	full := c.bulkRows >= c.cfg.BulkSize
+	c.bulkLock.Unlock()
+
+	if full {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush sends the queued rows
+func (c *Client) Flush() error {
+	c.bulkLock.Lock()
+	bulk := c.bulk
+	c.bulk = make(map[string][]json.RawMessage)
+	c.bulkRows = 0
+	c.bulkLock.Unlock()
+
+	var errs []string
+	for table, rows := range bulk {
+		var body bytes.Buffer
+		for _, row := range rows {
+			body.Write(row)
+			body.WriteByte('\n')
+		}
+
+		if _, err := c.request(fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table), &body, true); err != nil {
+			errs = append(errs, fmt.Sprintf("%d rows lost for table %s: %s", len(rows), table, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// Connect creates the database if needed and notifies the listeners
+func (c *Client) Connect() error {
+	if _, err := c.request("CREATE DATABASE IF NOT EXISTS "+c.cfg.Database, nil, false); err != nil {
+		return fmt.Errorf("Failed to create ClickHouse database %s: %s", c.cfg.Database, err)
+	}
+
+	c.RLock()
+	for _, l := range c.listeners {
+		l.OnStarted()
+	}
+	c.RUnlock()
+
+	return nil
+}
+
+// AddEventListener add event listener
+func (c *Client) AddEventListener(listener storage.EventListener) {
+	c.Lock()
+	c.listeners = append(c.listeners, listener)
+	c.Unlock()
+}
+
+func (c *Client) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(c.cfg.BulkMaxDelay) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+			if err := c.Flush(); err != nil {
+				logging.GetLogger().Errorf("Error while inserting in ClickHouse: %s", err)
+			}
+		}
+	}
+}
+
+// Start the periodic sending of the queued rows
+func (c *Client) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop the client, sending the queued rows
+func (c *Client) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+
+	if err := c.Flush(); err != nil {
+		logging.GetLogger().Errorf("Error while inserting in ClickHouse: %s", err)
+	}
+}
+
+// NewClient creates a new ClickHouse client
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.BulkSize <= 0 {
+		return nil, fmt.Errorf("invalid ClickHouse bulk size (%d)", cfg.BulkSize)
+	}
+	if cfg.BulkMaxDelay <= 0 {
+		return nil, fmt.Errorf("invalid ClickHouse bulk maximum delay (%d)", cfg.BulkMaxDelay)
+	}
+
+	return &Client{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		bulk:   make(map[string][]json.RawMessage),
+		quit:   make(chan struct{}),
+	}, nil
+}
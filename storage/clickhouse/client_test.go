@@ -0,0 +1,72 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package clickhouse
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/filters"
+)
+
+var testColumns = Columns{
+	Types: map[string]string{
+		"UUID":       "String",
+		"Start":      "Int64",
+		"ArchivedAt": "Nullable(Int64)",
+	},
+	JSON: "Doc",
+}
+
+func TestFilterToExpression(t *testing.T) {
+	regex, _ := filters.NewRegexFilter("Network.A", "^192\\.168")
+
+	tests := []struct {
+		filter   *filters.Filter
+		expected string
+	}{
+		{
+			filters.NewTermStringFilter("UUID", "it's"),
+			"`UUID` = 'it\\'s'",
+		},
+		{
+			filters.NewTermStringFilter("Network.A", "192.168.0.1"),
+			"(JSONExtract(Doc, 'Network', 'A', 'String') = '192.168.0.1' OR has(JSONExtract(Doc, 'Network', 'A', 'Array(String)'), '192.168.0.1'))",
+		},
+		{
+			filters.NewAndFilter(
+				filters.NewGteInt64Filter("Start", 10),
+				filters.NewNullFilter("ArchivedAt"),
+			),
+			"(`Start` >= 10) AND (isNull(`ArchivedAt`))",
+		},
+		{
+			filters.NewNotFilter(filters.NewNullFilter("Transport")),
+			"NOT (NOT JSONHas(Doc, 'Transport'))",
+		},
+		{
+			&filters.Filter{RegexFilter: regex},
+			"(match(JSONExtract(Doc, 'Network', 'A', 'String'), '^192\\\\.168') OR arrayExists(x -> match(x, '^192\\\\.168'), JSONExtract(Doc, 'Network', 'A', 'Array(String)')))",
+		},
+	}
+
+	for _, test := range tests {
+		if expr := FilterToExpression(test.filter, testColumns); expr != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, expr)
+		}
+	}
+}
@@ -36,6 +36,7 @@ import (
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/storage"
+	"github.com/skydive-project/skydive/storage/migration"
 )
 
 const (
@@ -46,11 +47,15 @@ const (
 
 // Config describes configuration for elasticsearch
 type Config struct {
-	ElasticHost  string
-	BulkMaxDelay int
-	EntriesLimit int
-	AgeLimit     int
-	IndicesLimit int
+	ElasticHost      string
+	BulkMaxDelay     int
+	EntriesLimit     int
+	AgeLimit         int
+	IndicesLimit     int
+	ReadHosts        []string
+	HedgeDelay       int
+	HedgeMaxRequests int
+	Migration        migration.Options
 }
 
 // ClientInterface describes the mechanism API of ElasticSearch database client
@@ -68,18 +73,22 @@ type ClientInterface interface {
 
 // Index defines a Client Index
 type Index struct {
-	Name      string
-	Type      string
-	Mapping   string
-	RollIndex bool
-	URL       string
+	Name       string
+	Type       string
+	Mapping    string
+	RollIndex  bool
+	URL        string
+	Migrations []MappingMigration
 }
 
 // Client describes a ElasticSearch client connection
 type Client struct {
 	sync.RWMutex
 	url           *url.URL
+	readURLs      []*url.URL
 	esClient      *elastic.Client
+	readClients   []*elastic.Client
+	readIndex     uint32
 	bulkProcessor *elastic.BulkProcessor
 	started       atomic.Value
 	quit          chan bool
@@ -134,26 +143,29 @@ func (c *Client) addMapping(index Index) error {
 	return nil
 }
 
-func (c *Client) createIndices() error {
+func (c *Client) createIndices() (map[string]bool, error) {
+	created := make(map[string]bool)
 	for _, index := range c.indices {
 		if exists, _ := c.esClient.IndexExists(index.FullName()).Do(context.Background()); !exists {
 			if _, err := c.esClient.CreateIndex(index.FullName()).Do(context.Background()); err != nil {
-				return fmt.Errorf("Unable to create the skydive index: %s", err)
+				return nil, fmt.Errorf("Unable to create the skydive index: %s", err)
 			}
 
 			if index.Mapping != "" {
 				if err := c.addMapping(index); err != nil {
-					return err
+					return nil, err
 				}
 			}
 
 			if err := c.createAliases(index); err != nil {
-				return err
+				return nil, err
 			}
+
+			created[index.Name] = true
 		}
 	}
 
-	return nil
+	return created, nil
 }
 
 func (c *Client) start() error {
@@ -168,6 +180,25 @@ func (c *Client) start() error {
 	}
 	c.esClient = esClient
 
+	// the searches are sent to the read replicas if any, the writes
+	// always go to the main host
+	c.readClients = []*elastic.Client{esClient}
+	if len(c.readURLs) > 0 {
+		c.readClients = nil
+		for _, u := range c.readURLs {
+			readConfig, err := esconfig.Parse(u.String())
+			if err != nil {
+				return err
+			}
+
+			readClient, err := elastic.NewClientFromConfig(readConfig)
+			if err != nil {
+				return fmt.Errorf("Failed to connect to read replica %s: %s", u, err)
+			}
+			c.readClients = append(c.readClients, readClient)
+		}
+	}
+
 	bulkProcessor, err := esClient.BulkProcessor().
 		After(func(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
 			if err != nil {
@@ -205,10 +236,19 @@ func (c *Client) start() error {
 		return fmt.Errorf("Skydive support only version > %s, found: %s", minimalVersion, vt)
 	}
 
-	if err := c.createIndices(); err != nil {
+	created, err := c.createIndices()
+	if err != nil {
 		return fmt.Errorf("Failed to create index: %s", err)
 	}
 
+	for _, index := range c.indices {
+		if len(index.Migrations) > 0 {
+			if err := c.migrate(index, created[index.Name]); err != nil {
+				return err
+			}
+		}
+	}
+
 	c.bulkProcessor.Start(context.Background())
 
 	if c.rollService != nil {
@@ -355,31 +395,55 @@ func (c *Client) UpdateByScript(typ string, query elastic.Query, script *elastic
 	return nil
 }
 
-// Search an object
+// Search an object. The search is sent to the read replicas in turn and,
+// when hedging is enabled, reissued to the next one if it takes longer than
+// the hedging delay, the first result being returned.
 func (c *Client) Search(typ string, query elastic.Query, opts filters.SearchQuery, indices ...string) (*elastic.SearchResult, error) {
-	searchQuery := c.esClient.
-		Search().
-		Index(indices...).
-		Type(typ).
-		Query(query).
-		Size(10000)
-
-	if r := opts.PaginationRange; r != nil {
-		if r.To < r.From {
-			return nil, errors.New("Incorrect PaginationRange, To < From")
-		}
-		searchQuery = searchQuery.From(int(r.From)).Size(int(r.To - r.From))
+	if r := opts.PaginationRange; r != nil && r.To < r.From {
+		return nil, errors.New("Incorrect PaginationRange, To < From")
 	}
 
-	if opts.Sort {
-		searchQuery = searchQuery.SortWithInfo(elastic.SortInfo{
-			Field:        opts.SortBy,
-			Ascending:    common.SortOrder(opts.SortOrder) != common.SortDescending,
-			UnmappedType: "date",
-		})
+	maxRequests := 1
+	if c.cfg.HedgeDelay > 0 {
+		maxRequests = c.cfg.HedgeMaxRequests
 	}
 
-	return searchQuery.Do(context.Background())
+	clients := c.readClients
+	first := int(atomic.AddUint32(&c.readIndex, 1))
+
+	result, err := hedge(time.Duration(c.cfg.HedgeDelay)*time.Millisecond, maxRequests, func(ctx context.Context, attempt int) (interface{}, error) {
+		searchQuery := clients[(first+attempt)%len(clients)].
+			Search().
+			Index(indices...).
+			Type(typ).
+			Query(query).
+			Size(10000)
+
+		// a different preference makes the hedged searches likely
+		// to be served by other copies of the shards
+		if attempt > 0 {
+			searchQuery = searchQuery.Preference(fmt.Sprintf("hedge-%d", attempt))
+		}
+
+		if r := opts.PaginationRange; r != nil {
+			searchQuery = searchQuery.From(int(r.From)).Size(int(r.To - r.From))
+		}
+
+		if opts.Sort {
+			searchQuery = searchQuery.SortWithInfo(elastic.SortInfo{
+				Field:        opts.SortBy,
+				Ascending:    common.SortOrder(opts.SortOrder) != common.SortDescending,
+				UnmappedType: "date",
+			})
+		}
+
+		return searchQuery.Do(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*elastic.SearchResult), nil
 }
 
 // RollIndex forces a rolling index
@@ -409,6 +473,11 @@ func (c *Client) Stop() {
 		c.wg.Wait()
 
 		c.esClient.Stop()
+		for _, readClient := range c.readClients {
+			if readClient != c.esClient {
+				readClient.Stop()
+			}
+		}
 	}
 
 	c.RLock()
@@ -450,11 +519,20 @@ func (c *Client) AddEventListener(listener storage.EventListener) {
 
 // NewClient creates a new ElasticSearch client based on configuration
 func NewClient(indices []Index, cfg Config, electionService common.MasterElectionService) (*Client, error) {
-	url, err := urlFromHost(cfg.ElasticHost)
+	esURL, err := urlFromHost(cfg.ElasticHost)
 	if err != nil {
 		return nil, err
 	}
 
+	var readURLs []*url.URL
+	for _, host := range cfg.ReadHosts {
+		readURL, err := urlFromHost(host)
+		if err != nil {
+			return nil, err
+		}
+		readURLs = append(readURLs, readURL)
+	}
+
 	indicesMap := make(map[string]Index, 0)
 	rollIndices := []Index{}
 	for _, index := range indices {
@@ -463,13 +541,18 @@ func NewClient(indices []Index, cfg Config, electionService common.MasterElectio
 		if index.RollIndex {
 			rollIndices = append(rollIndices, index)
 		}
+
+		if len(index.Migrations) > 0 {
+			indicesMap[migrationIndex.Name] = migrationIndex
+		}
 	}
 
 	client := &Client{
-		url:     url,
-		quit:    make(chan bool, 1),
-		cfg:     cfg,
-		indices: indicesMap,
+		url:      esURL,
+		readURLs: readURLs,
+		quit:     make(chan bool, 1),
+		cfg:      cfg,
+		indices:  indicesMap,
 	}
 
 	if len(rollIndices) > 0 {
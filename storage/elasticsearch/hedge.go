@@ -0,0 +1,85 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package elasticsearch
+
+import (
+	"context"
+	"time"
+)
+
+type hedgeResult struct {
+	value interface{}
+	err   error
+}
+
+// hedge runs call and, if it has not returned after delay, issues up to
+// maxRequests - 1 additional calls, spaced by delay, returning the first
+// successful result. A failed call immediately triggers the next one.
+// The calls still running when a result is returned are cancelled.
+func hedge(delay time.Duration, maxRequests int, call func(ctx context.Context, attempt int) (interface{}, error)) (interface{}, error) {
+	if maxRequests < 1 {
+		maxRequests = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// buffered so that the cancelled calls don't block
+	results := make(chan hedgeResult, maxRequests)
+
+	launched, pending := 0, 0
+	launch := func() {
+		attempt := launched
+		launched++
+		pending++
+		go func() {
+			value, err := call(ctx, attempt)
+			results <- hedgeResult{value: value, err: err}
+		}()
+	}
+
+	var timer <-chan time.Time
+	if delay > 0 && maxRequests > 1 {
+		ticker := time.NewTicker(delay)
+		defer ticker.Stop()
+		timer = ticker.C
+	}
+
+	launch()
+
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer:
+			if launched < maxRequests {
+				launch()
+			}
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				return result.value, nil
+			}
+			err = result.err
+			if launched < maxRequests {
+				launch()
+			}
+		}
+	}
+
+	return nil, err
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHedgeSlowRequest(t *testing.T) {
+	value, err := hedge(10*time.Millisecond, 2, func(ctx context.Context, attempt int) (interface{}, error) {
+		if attempt == 0 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return attempt, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.(int) != 1 {
+		t.Errorf("Expected the hedged request to answer, got %v", value)
+	}
+}
+
+func TestHedgeFailover(t *testing.T) {
+	attempts := 0
+	value, err := hedge(time.Hour, 3, func(ctx context.Context, attempt int) (interface{}, error) {
+		attempts++
+		if attempt < 2 {
+			return nil, errors.New("unavailable")
+		}
+		return attempt, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.(int) != 2 || attempts != 3 {
+		t.Errorf("Expected the third request to answer, got %v after %d requests", value, attempts)
+	}
+}
+
+func TestHedgeDisabled(t *testing.T) {
+	_, err := hedge(0, 1, func(ctx context.Context, attempt int) (interface{}, error) {
+		if attempt > 0 {
+			t.Errorf("Unexpected request %d", attempt)
+		}
+		return nil, errors.New("unavailable")
+	})
+	if err == nil {
+		t.Error("Expected an error")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	elastic "github.com/olivere/elastic"
+
+	"github.com/skydive-project/skydive/storage/migration"
+)
+
+// migrationIndex holds the schema version of the indices, by alias
+var migrationIndex = Index{
+	Name: "migration",
+	Type: "migration",
+}
+
+// MappingMigration is a migration step applying the current mapping of an
+// index to its existing indices, the mapping changes being additive
+type MappingMigration struct {
+	Version     int
+	Description string
+}
+
+type versionStore struct {
+	client *Client
+}
+
+type versionDoc struct {
+	Version int
+}
+
+func (s *versionStore) GetVersion(name string) (int, bool, error) {
+	result, err := s.client.Get(migrationIndex, name)
+	if elastic.IsNotFound(err) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	var doc versionDoc
+	if err := json.Unmarshal(*result.Source, &doc); err != nil {
+		return 0, false, err
+	}
+
+	return doc.Version, true, nil
+}
+
+func (s *versionStore) SetVersion(name string, version int) error {
+	return s.client.Index(migrationIndex, name, &versionDoc{Version: version})
+}
+
+func (c *Client) updateMapping(index Index) error {
+	if _, err := c.esClient.PutMapping().Index(index.IndexWildcard()).Type(index.Type).BodyString(index.Mapping).Do(context.Background()); err != nil {
+		return fmt.Errorf("Unable to update %s mapping: %s", index.Alias(), err)
+	}
+	return nil
+}
+
+// migrate applies the mapping migrations of an index, an index just created
+// having the latest mapping
+func (c *Client) migrate(index Index, created bool) error {
+	var steps []migration.Step
+	for _, m := range index.Migrations {
+		steps = append(steps, migration.Step{
+			Version:     m.Version,
+			Description: m.Description,
+			Up: func() error {
+				return c.updateMapping(index)
+			},
+			// the mapped fields can't be removed, the previous versions
+			// of the mapping ignoring them
+			Down: func() error {
+				return nil
+			},
+		})
+	}
+
+	migrator, err := migration.NewMigrator(index.Alias(), &versionStore{client: c}, steps...)
+	if err != nil {
+		return err
+	}
+
+	if created {
+		return migrator.Stamp()
+	}
+	return migrator.Migrate(c.cfg.Migration)
+}
@@ -0,0 +1,543 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kafka API keys and versions used by the producer
+const (
+	apiProduce         = 0
+	apiMetadata        = 3
+	apiProduceVersion  = 3
+	apiMetadataVersion = 1
+)
+
+// Kafka error codes needing a metadata refresh
+const (
+	errUnknownTopicOrPartition = 3
+	errLeaderNotAvailable      = 5
+	errNotLeaderForPartition   = 6
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrNoBroker is returned when none of the brokers can be reached
+var ErrNoBroker = errors.New("No Kafka broker available")
+
+// Config describes the configuration of a Kafka producer. Acks is the
+// number of acknowledgments required, 1 for the leader only, -1 for all
+// the in sync replicas.
+type Config struct {
+	Brokers   []string
+	ClientID  string
+	Acks      int
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+}
+
+// Message is a record to publish
+type Message struct {
+	Key       []byte
+	Value     []byte
+	Timestamp time.Time
+}
+
+type partition struct {
+	id     int32
+	leader int32
+}
+
+type broker struct {
+	addr          string
+	conn          net.Conn
+	reader        *bufio.Reader
+	correlationID int32
+}
+
+// Producer publishes messages to Kafka topics, the messages with a key
+// being sent to the partition given by the murmur2 hash of the key, as
+// the Java client does, the others in a round robin manner
+type Producer struct {
+	sync.Mutex
+	cfg        Config
+	bootstrap  map[string]*broker
+	brokers    map[int32]*broker
+	partitions map[string][]partition
+	next       int
+}
+
+// Murmur2 returns the hash used by the Kafka clients to partition the keys
+func Murmur2(data []byte) int32 {
+	const m = uint32(0x5bd1e995)
+	const r = 24
+
+	length := len(data)
+	h := uint32(0x9747b28c) ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+
+	return int32(h)
+}
+
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) int8(v int8)   { e.WriteByte(byte(v)) }
+func (e *encoder) int16(v int16) { binary.Write(e, binary.BigEndian, v) }
+func (e *encoder) int32(v int32) { binary.Write(e, binary.BigEndian, v) }
+func (e *encoder) int64(v int64) { binary.Write(e, binary.BigEndian, v) }
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.Write(b)
+}
+
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) read(v interface{}) {
+	if d.err == nil {
+		d.err = binary.Read(d.r, binary.BigEndian, v)
+	}
+}
+
+func (d *decoder) int8() (v int8)   { d.read(&v); return }
+func (d *decoder) int16() (v int16) { d.read(&v); return }
+func (d *decoder) int32() (v int32) { d.read(&v); return }
+func (d *decoder) int64() (v int64) { d.read(&v); return }
+
+func (d *decoder) string() string {
+	l := d.int16()
+	if d.err != nil || l < 0 {
+		return ""
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(d.r, b); err != nil && d.err == nil {
+		d.err = err
+	}
+	return string(b)
+}
+
+func (d *decoder) int32s() {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
+
+// recordBatch encodes the messages as a v2 record batch
+func recordBatch(messages []Message) []byte {
+	first := messages[0].Timestamp
+	maxTimestamp := first
+
+	var records encoder
+	for i, msg := range messages {
+		if msg.Timestamp.After(maxTimestamp) {
+			maxTimestamp = msg.Timestamp
+		}
+
+		var record encoder
+		record.int8(0) // attributes
+		record.varint(int64(msg.Timestamp.Sub(first) / time.Millisecond))
+		record.varint(int64(i))
+		record.varbytes(msg.Key)
+		record.varbytes(msg.Value)
+		record.varint(0) // headers
+
+		records.varint(int64(record.Len()))
+		records.Write(record.Bytes())
+	}
+
+	// the part of the batch covered by the CRC
+	var body encoder
+	body.int16(0) // attributes, no compression
+	body.int32(int32(len(messages) - 1))
+	body.int64(first.UnixNano() / int64(time.Millisecond))
+	body.int64(maxTimestamp.UnixNano() / int64(time.Millisecond))
+	body.int64(-1) // producer id
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(messages)))
+	body.Write(records.Bytes())
+
+	var batch encoder
+	batch.int64(0)                             // base offset
+	batch.int32(int32(4 + 1 + 4 + body.Len())) // batch length
+	batch.int32(-1)                            // partition leader epoch
+	batch.int8(2)                              // magic
+	binary.Write(&batch, binary.BigEndian, crc32.Checksum(body.Bytes(), castagnoli))
+	batch.Write(body.Bytes())
+
+	return batch.Bytes()
+}
+
+func (p *Producer) connect(b *broker) error {
+	if b.conn != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if p.cfg.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.addr, p.cfg.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", b.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.conn, b.reader = conn, bufio.NewReader(conn)
+	return nil
+}
+
+func (b *broker) close() {
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+}
+
+// request sends a request to a broker and returns the response decoder, nil
+// when no response is expected
+func (p *Producer) request(b *broker, apiKey, apiVersion int16, body []byte, response bool) (*decoder, error) {
+	if err := p.connect(b); err != nil {
+		return nil, err
+	}
+
+	b.correlationID++
+
+	var header encoder
+	header.int16(apiKey)
+	header.int16(apiVersion)
+	header.int32(b.correlationID)
+	header.string(p.cfg.ClientID)
+
+	var req encoder
+	req.int32(int32(header.Len() + len(body)))
+	req.Write(header.Bytes())
+	req.Write(body)
+
+	b.conn.SetDeadline(time.Now().Add(p.cfg.Timeout))
+	if _, err := b.conn.Write(req.Bytes()); err != nil {
+		b.close()
+		return nil, err
+	}
+
+	if !response {
+		return nil, nil
+	}
+
+	d := &decoder{r: b.reader}
+	size := d.int32()
+	if d.err != nil {
+		b.close()
+		return nil, d.err
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(b.reader, data); err != nil {
+		b.close()
+		return nil, err
+	}
+
+	d = &decoder{r: bytes.NewReader(data)}
+	if correlationID := d.int32(); correlationID != b.correlationID {
+		b.close()
+		return nil, fmt.Errorf("Unexpected Kafka correlation ID %d, expected %d", correlationID, b.correlationID)
+	}
+
+	return d, nil
+}
+
+// refreshMetadata retrieves the brokers and the partitions of a topic
+func (p *Producer) refreshMetadata(topic string) error {
+	var req encoder
+	req.int32(1)
+	req.string(topic)
+
+	var lastErr error = ErrNoBroker
+	for _, addr := range p.cfg.Brokers {
+		b := p.bootstrapBroker(addr)
+
+		d, err := p.request(b, apiMetadata, apiMetadataVersion, req.Bytes(), true)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		brokers := make(map[int32]string)
+		for n := d.int32(); n > 0 && d.err == nil; n-- {
+			id := d.int32()
+			host := d.string()
+			port := d.int32()
+			d.string() // rack
+			brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		d.int32() // controller id
+
+		var partitions []partition
+		for n := d.int32(); n > 0 && d.err == nil; n-- {
+			errCode := d.int16()
+			name := d.string()
+			d.int8() // internal
+			for m := d.int32(); m > 0 && d.err == nil; m-- {
+				d.int16() // partition error
+				id := d.int32()
+				leader := d.int32()
+				d.int32s() // replicas
+				d.int32s() // isr
+				if name == topic {
+					partitions = append(partitions, partition{id: id, leader: leader})
+				}
+			}
+			if name == topic && errCode != 0 && len(partitions) == 0 {
+				return fmt.Errorf("Unable to get Kafka topic %s metadata: error %d", topic, errCode)
+			}
+		}
+
+		if d.err != nil {
+			b.close()
+			lastErr = d.err
+			continue
+		}
+
+		for id, addr := range brokers {
+			if existing, ok := p.brokers[id]; !ok || existing.addr != addr {
+				if ok {
+					existing.close()
+				}
+				p.brokers[id] = &broker{addr: addr}
+			}
+		}
+
+		if len(partitions) == 0 {
+			return fmt.Errorf("No partition found for Kafka topic %s", topic)
+		}
+		p.partitions[topic] = partitions
+		return nil
+	}
+
+	return lastErr
+}
+
+// bootstrapBroker returns the connection used to retrieve the metadata
+// from a bootstrap broker
+func (p *Producer) bootstrapBroker(addr string) *broker {
+	b, ok := p.bootstrap[addr]
+	if !ok {
+		b = &broker{addr: addr}
+		p.bootstrap[addr] = b
+	}
+	return b
+}
+
+func (p *Producer) partitionFor(key []byte, partitions []partition) partition {
+	if key == nil {
+		p.next++
+		return partitions[p.next%len(partitions)]
+	}
+	return partitions[int(Murmur2(key)&0x7fffffff)%len(partitions)]
+}
+
+// produce sends the messages to the partitions leaders, returning whether
+// the metadata have to be refreshed on failure
+func (p *Producer) produce(topic string, messages []Message) (bool, error) {
+	partitions := p.partitions[topic]
+
+	byPartition := make(map[partition][]Message)
+	for _, msg := range messages {
+		part := p.partitionFor(msg.Key, partitions)
+		byPartition[part] = append(byPartition[part], msg)
+	}
+
+	byLeader := make(map[int32]map[int32][]Message)
+	for part, msgs := range byPartition {
+		if byLeader[part.leader] == nil {
+			byLeader[part.leader] = make(map[int32][]Message)
+		}
+		byLeader[part.leader][part.id] = msgs
+	}
+
+	for leader, parts := range byLeader {
+		b, ok := p.brokers[leader]
+		if !ok {
+			return true, fmt.Errorf("Unknown Kafka broker %d", leader)
+		}
+
+		var req encoder
+		req.int16(-1) // no transactional id
+		req.int16(int16(p.cfg.Acks))
+		req.int32(int32(p.cfg.Timeout / time.Millisecond))
+		req.int32(1)
+		req.string(topic)
+		req.int32(int32(len(parts)))
+		for id, msgs := range parts {
+			batch := recordBatch(msgs)
+			req.int32(id)
+			req.int32(int32(len(batch)))
+			req.Write(batch)
+		}
+
+		d, err := p.request(b, apiProduce, apiProduceVersion, req.Bytes(), p.cfg.Acks != 0)
+		if err != nil {
+			return true, err
+		}
+		if d == nil {
+			continue
+		}
+
+		for n := d.int32(); n > 0 && d.err == nil; n-- {
+			d.string()
+			for m := d.int32(); m > 0 && d.err == nil; m-- {
+				id := d.int32()
+				errCode := d.int16()
+				d.int64() // base offset
+				d.int64() // log append time
+				if errCode != 0 {
+					refresh := errCode == errUnknownTopicOrPartition || errCode == errLeaderNotAvailable || errCode == errNotLeaderForPartition
+					return refresh, fmt.Errorf("Failed to produce to Kafka topic %s partition %d: error %d", topic, id, errCode)
+				}
+			}
+		}
+		if d.err != nil {
+			b.close()
+			return true, d.err
+		}
+	}
+
+	return false, nil
+}
+
+// Produce publishes the messages to a topic, the metadata being refreshed
+// and the messages sent again once on leadership changes
+func (p *Producer) Produce(topic string, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if _, ok := p.partitions[topic]; !ok {
+		if err := p.refreshMetadata(topic); err != nil {
+			return err
+		}
+	}
+
+	refresh, err := p.produce(topic, messages)
+	if err != nil && refresh {
+		if err := p.refreshMetadata(topic); err != nil {
+			return err
+		}
+		_, err = p.produce(topic, messages)
+	}
+
+	return err
+}
+
+// Close the connections to the brokers
+func (p *Producer) Close() {
+	p.Lock()
+	for _, b := range p.bootstrap {
+		b.close()
+	}
+	for _, b := range p.brokers {
+		b.close()
+	}
+	p.Unlock()
+}
+
+// NewProducer returns a new Kafka producer
+func NewProducer(cfg Config) (*Producer, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, ErrNoBroker
+	}
+
+	switch cfg.Acks {
+	case -1, 0, 1:
+	default:
+		return nil, fmt.Errorf("Invalid Kafka acks %d, expected -1, 0 or 1", cfg.Acks)
+	}
+
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &Producer{
+		cfg:        cfg,
+		bootstrap:  make(map[string]*broker),
+		brokers:    make(map[int32]*broker),
+		partitions: make(map[string][]partition),
+	}, nil
+}
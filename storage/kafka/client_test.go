@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMurmur2(t *testing.T) {
+	// values computed by the Java client
+	vectors := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+
+	for key, expected := range vectors {
+		if h := Murmur2([]byte(key)); h != expected {
+			t.Errorf("Wrong hash for %s, expected %d, got %d", key, expected, h)
+		}
+	}
+}
+
+type fakeBroker struct {
+	listener net.Listener
+	records  chan [][2]string
+}
+
+func (b *fakeBroker) serve(t *testing.T) {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(t, conn)
+	}
+}
+
+func (b *fakeBroker) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		var size int32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return
+		}
+
+		d := &decoder{r: bytes.NewReader(data)}
+		apiKey, _, correlationID := d.int16(), d.int16(), d.int32()
+		d.string()
+
+		var resp encoder
+		resp.int32(correlationID)
+
+		switch apiKey {
+		case apiMetadata:
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			p, _ := strconv.Atoi(port)
+
+			resp.int32(1)
+			resp.int32(1)
+			resp.string(host)
+			resp.int32(int32(p))
+			resp.int16(-1)
+			resp.int32(1) // controller
+			resp.int32(1)
+			resp.int16(0)
+			resp.string("flows")
+			resp.int8(0)
+			resp.int32(1)
+			resp.int16(0)
+			resp.int32(0) // partition
+			resp.int32(1) // leader
+			resp.int32(0)
+			resp.int32(0)
+		case apiProduce:
+			d.string()
+			d.int16()
+			d.int32()
+			d.int32()
+			topic := d.string()
+			d.int32()
+			d.int32() // partition
+			batch := make([]byte, d.int32())
+			io.ReadFull(d.r, batch)
+
+			bd := &decoder{r: bytes.NewReader(batch)}
+			bd.int64()
+			bd.int32()
+			bd.int32()
+			if magic := bd.int8(); magic != 2 {
+				t.Errorf("Wrong magic %d", magic)
+			}
+			var crc uint32
+			bd.read(&crc)
+			if crc != crc32.Checksum(batch[21:], castagnoli) {
+				t.Error("Wrong record batch CRC")
+			}
+			bd.r = bytes.NewReader(batch[61:])
+
+			var records [][2]string
+			r := bufio.NewReader(bd.r)
+			for {
+				if _, err := binary.ReadVarint(r); err != nil {
+					break
+				}
+				r.ReadByte()
+				binary.ReadVarint(r)
+				binary.ReadVarint(r)
+				kl, _ := binary.ReadVarint(r)
+				key := make([]byte, kl)
+				io.ReadFull(r, key)
+				vl, _ := binary.ReadVarint(r)
+				value := make([]byte, vl)
+				io.ReadFull(r, value)
+				binary.ReadVarint(r)
+				records = append(records, [2]string{string(key), string(value)})
+			}
+			b.records <- records
+
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(0)
+			resp.int16(0)
+			resp.int64(0)
+			resp.int64(-1)
+			resp.int32(0)
+		}
+
+		binary.Write(conn, binary.BigEndian, int32(resp.Len()))
+		conn.Write(resp.Bytes())
+	}
+}
+
+func TestProduce(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	broker := &fakeBroker{listener: listener, records: make(chan [][2]string, 1)}
+	go broker.serve(t)
+
+	producer, err := NewProducer(Config{Brokers: []string{listener.Addr().String()}, ClientID: "test", Acks: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer producer.Close()
+
+	now := time.Now()
+	messages := []Message{
+		{Key: []byte("node1"), Value: []byte("flow1"), Timestamp: now},
+		{Key: []byte("node2"), Value: []byte("flow2"), Timestamp: now.Add(time.Second)},
+	}
+	if err := producer.Produce("flows", messages); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case records := <-broker.records:
+		if len(records) != 2 || records[0] != [2]string{"node1", "flow1"} || records[1] != [2]string{"node2", "flow2"} {
+			t.Errorf("Wrong records received: %v", records)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No records received")
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+const (
+	// Latest is the target version of the migrations applying all the steps
+	Latest = 0
+	// Baseline is the version of the schemas created before the migrations
+	Baseline = 1
+)
+
+// ErrIrreversible is returned when rolling back a step without Down function
+var ErrIrreversible = errors.New("irreversible migration step")
+
+// Step upgrades the schema of a storage backend to its version, Down
+// reverting it to the previous one
+type Step struct {
+	Version     int
+	Description string
+	Up          func() error
+	Down        func() error
+}
+
+// VersionStore reads and records the schema version of a storage backend,
+// found being false when no version was ever recorded
+type VersionStore interface {
+	GetVersion(name string) (version int, found bool, err error)
+	SetVersion(name string, version int) error
+}
+
+// Options of the migrations
+type Options struct {
+	// DryRun only logs the steps that would be applied
+	DryRun bool
+	// Target is the version to migrate to, older versions rolling back the
+	// steps, Latest for all the steps
+	Target int
+}
+
+// Migrator upgrades the schema of a storage backend by applying in order
+// the steps newer than the recorded version
+type Migrator struct {
+	name  string
+	store VersionStore
+	steps []Step
+}
+
+// Latest returns the version of the last step
+func (m *Migrator) Latest() int {
+	if len(m.steps) == 0 {
+		return Baseline
+	}
+	return m.steps[len(m.steps)-1].Version
+}
+
+// Plan returns the steps to apply to go from a version to another one, the
+// steps to roll back being returned in reverse order with up being false
+func (m *Migrator) Plan(from, to int) (steps []Step, up bool) {
+	if to == Latest {
+		to = m.Latest()
+	}
+
+	if to >= from {
+		for _, step := range m.steps {
+			if step.Version > from && step.Version <= to {
+				steps = append(steps, step)
+			}
+		}
+		return steps, true
+	}
+
+	for i := len(m.steps) - 1; i >= 0; i-- {
+		if step := m.steps[i]; step.Version <= from && step.Version > to {
+			steps = append(steps, step)
+		}
+	}
+	return steps, false
+}
+
+func (m *Migrator) apply(step Step, up bool) error {
+	fn, version := step.Up, step.Version
+	if !up {
+		fn, version = step.Down, step.Version-1
+	}
+
+	if fn == nil {
+		return ErrIrreversible
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return m.store.SetVersion(m.name, version)
+}
+
+// Stamp records the latest version, used when the schema has just been
+// created and is thus up to date
+func (m *Migrator) Stamp() error {
+	return m.store.SetVersion(m.name, m.Latest())
+}
+
+// Migrate applies the steps needed to reach the target version. When a step
+// fails, the steps applied so far are reverted.
+func (m *Migrator) Migrate(opts Options) error {
+	current, found, err := m.store.GetVersion(m.name)
+	if err != nil {
+		return fmt.Errorf("Unable to get the %s schema version: %s", m.name, err)
+	}
+	if !found {
+		current = Baseline
+	}
+
+	steps, up := m.Plan(current, opts.Target)
+	if len(steps) == 0 {
+		return nil
+	}
+
+	action := "Upgrading"
+	if !up {
+		action = "Rolling back"
+	}
+
+	if opts.DryRun {
+		for _, step := range steps {
+			logging.GetLogger().Infof("%s %s schema to version %d: %s (dry run)", action, m.name, step.Version, step.Description)
+		}
+		return nil
+	}
+
+	for i, step := range steps {
+		logging.GetLogger().Infof("%s %s schema to version %d: %s", action, m.name, step.Version, step.Description)
+
+		if err := m.apply(step, up); err != nil {
+			err = fmt.Errorf("Failed to migrate %s schema to version %d: %s", m.name, step.Version, err)
+
+			for j := i - 1; j >= 0; j-- {
+				if rerr := m.apply(steps[j], !up); rerr != nil {
+					return fmt.Errorf("%s, unable to revert version %d: %s", err, steps[j].Version, rerr)
+				}
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewMigrator returns a migrator of the schema of the named storage backend,
+// the steps versions following the baseline without gap
+func NewMigrator(name string, store VersionStore, steps ...Step) (*Migrator, error) {
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Version < steps[j].Version
+	})
+
+	for i, step := range steps {
+		if step.Version != Baseline+i+1 {
+			return nil, fmt.Errorf("Missing %s migration step %d", name, Baseline+i+1)
+		}
+	}
+
+	return &Migrator{name: name, store: store, steps: steps}, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package migration
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type memoryStore struct {
+	versions map[string]int
+}
+
+func (s *memoryStore) GetVersion(name string) (int, bool, error) {
+	version, found := s.versions[name]
+	return version, found, nil
+}
+
+func (s *memoryStore) SetVersion(name string, version int) error {
+	s.versions[name] = version
+	return nil
+}
+
+func newTestMigrator(t *testing.T, applied *[]int, failAt int) (*Migrator, *memoryStore) {
+	store := &memoryStore{versions: make(map[string]int)}
+
+	var steps []Step
+	for i := 4; i > 1; i-- {
+		version := i
+		steps = append(steps, Step{
+			Version: version,
+			Up: func() error {
+				if version == failAt {
+					return errors.New("failure")
+				}
+				*applied = append(*applied, version)
+				return nil
+			},
+			Down: func() error {
+				*applied = append(*applied, -version)
+				return nil
+			},
+		})
+	}
+
+	m, err := NewMigrator("test", store, steps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, store
+}
+
+func TestMigrate(t *testing.T) {
+	var applied []int
+	m, store := newTestMigrator(t, &applied, 0)
+
+	if err := m.Migrate(Options{Target: Latest, DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 || len(store.versions) != 0 {
+		t.Fatalf("Dry run should not apply anything, got %v", applied)
+	}
+
+	if err := m.Migrate(Options{Target: Latest}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []int{2, 3, 4}) || store.versions["test"] != 4 {
+		t.Fatalf("Expected the 3 steps to be applied in order, got %v (version %d)", applied, store.versions["test"])
+	}
+
+	applied = nil
+	if err := m.Migrate(Options{Target: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []int{-4, -3}) || store.versions["test"] != 2 {
+		t.Fatalf("Expected the steps 4 and 3 to be rolled back, got %v (version %d)", applied, store.versions["test"])
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	var applied []int
+	m, store := newTestMigrator(t, &applied, 4)
+
+	if err := m.Migrate(Options{Target: Latest}); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if !reflect.DeepEqual(applied, []int{2, 3, -3, -2}) || store.versions["test"] != Baseline {
+		t.Fatalf("Expected the applied steps to be reverted, got %v (version %d)", applied, store.versions["test"])
+	}
+}
+
+func TestMissingStep(t *testing.T) {
+	if _, err := NewMigrator("test", &memoryStore{}, Step{Version: 2}, Step{Version: 4}); err == nil {
+		t.Fatal("Expected an error for the missing step 3")
+	}
+}
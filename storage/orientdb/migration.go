@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package orientdb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VersionStore records the schema versions in the Migration class, by name
+type VersionStore struct {
+	client ClientInterface
+}
+
+type versionDoc struct {
+	Class   string `json:"@class"`
+	Name    string
+	Version int
+}
+
+// GetVersion returns the recorded schema version
+func (s *VersionStore) GetVersion(name string) (int, bool, error) {
+	result, err := s.client.SQL(fmt.Sprintf("SELECT Name, Version FROM Migration WHERE Name = '%s'", name))
+	if err != nil {
+		return 0, false, err
+	}
+
+	docs := struct {
+		Result []versionDoc
+	}{}
+
+	if err := json.Unmarshal(result.Body, &docs); err != nil {
+		return 0, false, fmt.Errorf("Error while parsing schema version: %s, %s", err, string(result.Body))
+	}
+
+	if len(docs.Result) == 0 {
+		return 0, false, nil
+	}
+	return docs.Result[0].Version, true, nil
+}
+
+// SetVersion records the schema version
+func (s *VersionStore) SetVersion(name string, version int) error {
+	_, err := s.client.Upsert("Migration", &versionDoc{Class: "Migration", Name: name, Version: version}, "Name", name)
+	return err
+}
+
+// NewVersionStore returns a schema version store, creating the Migration
+// class if needed
+func NewVersionStore(client ClientInterface) (*VersionStore, error) {
+	if _, err := client.GetDocumentClass("Migration"); err != nil {
+		class := ClassDefinition{
+			Name: "Migration",
+			Properties: []Property{
+				{Name: "Name", Type: "STRING", Mandatory: true, NotNull: true},
+				{Name: "Version", Type: "INTEGER", Mandatory: true, NotNull: true},
+			},
+			Indexes: []Index{
+				{Name: "Migration.Name", Fields: []string{"Name"}, Type: "UNIQUE"},
+			},
+		}
+		if err := client.CreateDocumentClass(class); err != nil {
+			return nil, fmt.Errorf("Failed to register class Migration: %s", err)
+		}
+	}
+
+	return &VersionStore{client: client}, nil
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package throughput
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	apiServer "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/etcd"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	ge "github.com/skydive-project/skydive/gremlin/traversal"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// RelationType of the edges holding the results of the tests between
+	// two nodes
+	RelationType = "throughput"
+
+	// maxHistory is the number of results kept in the edge metadata
+	maxHistory = 10
+
+	// settleTime is the time given to the receiver to get the last packets
+	// before its result is collected
+	settleTime = 2 * time.Second
+)
+
+// Client orchestrates the throughput tests created through the API, only
+// the elected analyzer running them
+type Client struct {
+	sync.Mutex
+	common.MasterElection
+	pool    ws.StructSpeakerPool
+	watcher apiServer.StoppableWatcher
+	graph   *graph.Graph
+	handler *apiServer.ThroughputTestAPI
+	cancels map[string]chan struct{}
+}
+
+type testEndpoints struct {
+	srcNode, dstNode *graph.Node
+	address          string
+}
+
+func (c *Client) request(host, typ string, obj interface{}) (*Reply, error) {
+	msg := ws.NewStructMessage(Namespace, typ, obj)
+
+	resp, err := c.pool.Request(host, msg, ws.DefaultRequestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to send message to agent %s: %s", host, err)
+	}
+
+	var reply Reply
+	if err := json.Unmarshal(resp.Obj, &reply); err != nil {
+		return nil, fmt.Errorf("Failed to parse response from %s: %s", host, err)
+	}
+
+	if resp.Status != http.StatusOK {
+		return nil, errors.New(reply.Error)
+	}
+
+	return &reply, nil
+}
+
+func (c *Client) collect(host, uuid, role string) (*Stats, error) {
+	reply, err := c.request(host, "ResultRequest", &ResultParams{UUID: uuid, Role: role})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Stats == nil {
+		return nil, fmt.Errorf("No result returned by the %s of %s", role, host)
+	}
+	return reply.Stats, nil
+}
+
+func (c *Client) getNode(gremlinQuery string) *graph.Node {
+	res, err := ge.TopologyGremlinQuery(c.graph, gremlinQuery)
+	if err != nil {
+		return nil
+	}
+
+	for _, value := range res.Values() {
+		if node, ok := value.(*graph.Node); ok {
+			return node
+		}
+		return nil
+	}
+	return nil
+}
+
+// resolve returns the nodes of a test and the IP the receiver is reached at
+func (c *Client) resolve(tt *types.ThroughputTest) (*testEndpoints, error) {
+	c.graph.RLock()
+	defer c.graph.RUnlock()
+
+	te := &testEndpoints{srcNode: c.getNode(tt.Src), dstNode: c.getNode(tt.Dst)}
+	if te.srcNode == nil {
+		return nil, errors.New("Not able to find a source node")
+	}
+	if te.dstNode == nil {
+		return nil, errors.New("Not able to find a destination node")
+	}
+
+	ip := tt.DstIP
+	if ip == "" {
+		ips, _ := te.dstNode.GetFieldStringList("IPV4")
+		if len(ips) == 0 {
+			return nil, errors.New("No destination IP in node and user input")
+		}
+		ip = strings.Split(ips[0], "/")[0]
+	}
+	te.address = net.JoinHostPort(ip, fmt.Sprintf("%d", tt.Port))
+
+	return te, nil
+}
+
+// result computes the result of a test, the rate being the one observed by
+// the receiver
+func result(tt *types.ThroughputTest, sent, received *Stats) *types.ThroughputResult {
+	r := &types.ThroughputResult{
+		Time:            common.UnixMillis(tt.StartTime),
+		Protocol:        tt.Protocol,
+		SentBytes:       sent.Bytes,
+		SentPackets:     sent.Packets,
+		ReceivedBytes:   received.Bytes,
+		ReceivedPackets: received.Packets,
+		LostPackets:     received.Lost,
+	}
+
+	if tt.Protocol == "udp" && sent.Packets > received.Packets+received.Lost {
+		// the datagrams lost after the last one received are only known by the sender
+		r.LostPackets = sent.Packets - received.Packets
+	}
+
+	if received.Last > received.Start {
+		r.Duration = received.Last - received.Start
+		r.BitsPerSecond = received.Bytes * 8 * 1000 / r.Duration
+	}
+
+	return r
+}
+
+func resultMetadata(r *types.ThroughputResult) map[string]interface{} {
+	return map[string]interface{}{
+		"Time":            r.Time,
+		"Protocol":        r.Protocol,
+		"Duration":        r.Duration,
+		"SentBytes":       r.SentBytes,
+		"SentPackets":     r.SentPackets,
+		"ReceivedBytes":   r.ReceivedBytes,
+		"ReceivedPackets": r.ReceivedPackets,
+		"LostPackets":     r.LostPackets,
+		"BitsPerSecond":   r.BitsPerSecond,
+	}
+}
+
+// recordResult stores the result in the Throughput metadata of the edge
+// between the source and the destination nodes, along with the previous ones
+func (c *Client) recordResult(te *testEndpoints, r *types.ThroughputResult) error {
+	c.graph.Lock()
+	defer c.graph.Unlock()
+
+	src, dst := c.graph.GetNode(te.srcNode.ID), c.graph.GetNode(te.dstNode.ID)
+	if src == nil || dst == nil {
+		return errors.New("Source or destination node removed during the test")
+	}
+
+	last := resultMetadata(r)
+	history := []interface{}{last}
+
+	edge := c.graph.GetFirstLink(src, dst, graph.Metadata{"RelationType": RelationType})
+	if edge != nil {
+		if previous, err := edge.GetField("Throughput.History"); err == nil {
+			if entries, ok := previous.([]interface{}); ok {
+				history = append(append([]interface{}{}, entries...), last)
+			}
+		}
+		if len(history) > maxHistory {
+			history = history[len(history)-maxHistory:]
+		}
+	}
+
+	metadata := map[string]interface{}{"Last": last, "History": history}
+	if edge == nil {
+		_, err := topology.AddLink(c.graph, src, dst, RelationType, graph.Metadata{"Throughput": metadata})
+		return err
+	}
+	return c.graph.AddMetadata(edge, "Throughput", metadata)
+}
+
+// wait returns false if the test was deleted before the end of the duration
+func (c *Client) wait(cancel chan struct{}, duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-cancel:
+		return false
+	}
+}
+
+func (c *Client) run(tt *types.ThroughputTest, cancel chan struct{}) error {
+	te, err := c.resolve(tt)
+	if err != nil {
+		return err
+	}
+
+	duration := time.Duration(tt.Duration) * time.Second
+	reply, err := c.request(te.dstNode.Host, "ReceiveRequest", &ReceiveParams{
+		UUID:     tt.UUID,
+		Protocol: tt.Protocol,
+		Port:     tt.Port,
+		Lifetime: 2*tt.Duration + 60,
+	})
+	if err != nil {
+		return err
+	}
+
+	if tt.Port == 0 {
+		host, _, _ := net.SplitHostPort(te.address)
+		te.address = net.JoinHostPort(host, fmt.Sprintf("%d", reply.Port))
+	}
+
+	// the receiver is collected in any case so that it is cleaned up
+	collected := false
+	defer func() {
+		if !collected {
+			c.collect(te.dstNode.Host, tt.UUID, "receiver")
+		}
+	}()
+
+	_, err = c.request(te.srcNode.Host, "SendRequest", &SendParams{
+		UUID:       tt.UUID,
+		Protocol:   tt.Protocol,
+		Address:    te.address,
+		Duration:   tt.Duration,
+		Bandwidth:  tt.Bandwidth,
+		PacketSize: tt.PacketSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !c.wait(cancel, duration+settleTime) {
+		c.collect(te.srcNode.Host, tt.UUID, "sender")
+		return nil
+	}
+
+	sent, err := c.collect(te.srcNode.Host, tt.UUID, "sender")
+	if err != nil {
+		return err
+	}
+
+	received, err := c.collect(te.dstNode.Host, tt.UUID, "receiver")
+	collected = true
+	if err != nil {
+		return err
+	}
+
+	tt.Result = result(tt, sent, received)
+	if err := c.recordResult(te, tt.Result); err != nil {
+		logging.GetLogger().Errorf("Unable to record the result of throughput test %s: %s", tt.UUID, err)
+	}
+
+	return nil
+}
+
+func (c *Client) start(tt *types.ThroughputTest, cancel chan struct{}) {
+	tt.State = "running"
+	tt.StartTime = time.Now().UTC()
+	c.handler.BasicAPIHandler.Update(tt.UUID, tt)
+
+	err := c.run(tt, cancel)
+
+	c.Lock()
+	delete(c.cancels, tt.UUID)
+	c.Unlock()
+
+	select {
+	case <-cancel:
+		// the test was deleted, nothing to update
+		return
+	default:
+	}
+
+	if err != nil {
+		logging.GetLogger().Errorf("Throughput test %s failed: %s", tt.UUID, err)
+		tt.State, tt.Error = "failed", err.Error()
+	} else {
+		tt.State = "completed"
+	}
+	c.handler.BasicAPIHandler.Update(tt.UUID, tt)
+}
+
+// OnStartAsMaster event
+func (c *Client) OnStartAsMaster() {
+}
+
+// OnStartAsSlave event
+func (c *Client) OnStartAsSlave() {
+}
+
+// OnSwitchToMaster event
+func (c *Client) OnSwitchToMaster() {
+}
+
+// OnSwitchToSlave event
+func (c *Client) OnSwitchToSlave() {
+}
+
+func (c *Client) onAPIWatcherEvent(action string, id string, resource types.Resource) {
+	logging.GetLogger().Debugf("New watcher event %s for %s", action, id)
+	tt := resource.(*types.ThroughputTest)
+	switch action {
+	case "create", "set":
+		// the updates of the state are notified as well, only the new
+		// tests are run
+		if !c.IsMaster() || tt.State != "pending" {
+			return
+		}
+
+		c.Lock()
+		defer c.Unlock()
+		if _, running := c.cancels[id]; !running {
+			cancel := make(chan struct{})
+			c.cancels[id] = cancel
+			go c.start(tt, cancel)
+		}
+	case "expire", "delete":
+		c.Lock()
+		if cancel, found := c.cancels[id]; found {
+			close(cancel)
+			delete(c.cancels, id)
+		}
+		c.Unlock()
+	}
+}
+
+// Start the throughput test client
+func (c *Client) Start() {
+	c.MasterElection.StartAndWait()
+	c.watcher = c.handler.AsyncWatch(c.onAPIWatcherEvent)
+}
+
+// Stop the throughput test client
+func (c *Client) Stop() {
+	c.watcher.Stop()
+	c.MasterElection.Stop()
+}
+
+// NewClient returns a new throughput test client
+func NewClient(pool ws.StructSpeakerPool, etcdClient *etcd.Client, handler *apiServer.ThroughputTestAPI, g *graph.Graph) *Client {
+	election := etcdClient.NewElection("throughput-client")
+
+	c := &Client{
+		MasterElection: election,
+		pool:           pool,
+		handler:        handler,
+		graph:          g,
+		cancels:        make(map[string]chan struct{}),
+	}
+
+	election.AddEventListener(c)
+
+	return c
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package throughput
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// seqSize is the size of the sequence number heading the UDP datagrams,
+// used by the receiver to count the lost datagrams
+const seqSize = 8
+
+const readBufferSize = 65536
+
+// Stats describes the traffic sent or received by an endpoint of a test,
+// Start and Last being the times in milliseconds of the first and the last
+// packet. For TCP, Packets is the number of reads or writes of the stream.
+type Stats struct {
+	Bytes   int64
+	Packets int64
+	Lost    int64 `json:",omitempty"`
+	Start   int64
+	Last    int64
+}
+
+type endpoint interface {
+	Stats() Stats
+	Close()
+}
+
+type counter struct {
+	sync.Mutex
+	stats Stats
+}
+
+func (c *counter) account(bytes int) {
+	now := common.UnixMillis(time.Now())
+
+	c.Lock()
+	if c.stats.Start == 0 {
+		c.stats.Start = now
+	}
+	c.stats.Last = now
+	c.stats.Bytes += int64(bytes)
+	c.stats.Packets++
+	c.Unlock()
+}
+
+// Stats returns the traffic accounted so far
+func (c *counter) Stats() Stats {
+	c.Lock()
+	defer c.Unlock()
+	return c.stats
+}
+
+// receiver accounts the traffic received on a TCP or UDP port
+type receiver struct {
+	counter
+	listener net.Listener
+	conn     net.PacketConn
+	conns    []net.Conn
+	maxSeq   int64
+	closed   bool
+}
+
+func (r *receiver) serveTCP() {
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		r.Lock()
+		if r.closed {
+			r.Unlock()
+			conn.Close()
+			return
+		}
+		r.conns = append(r.conns, conn)
+		r.Unlock()
+
+		go func() {
+			buffer := make([]byte, readBufferSize)
+			for {
+				n, err := conn.Read(buffer)
+				if n > 0 {
+					r.account(n)
+				}
+				if err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (r *receiver) serveUDP() {
+	buffer := make([]byte, readBufferSize)
+	for {
+		n, _, err := r.conn.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+
+		r.account(n)
+		if n >= seqSize {
+			seq := int64(binary.BigEndian.Uint64(buffer[:seqSize]))
+			r.Lock()
+			if seq > r.maxSeq {
+				r.maxSeq = seq
+			}
+			r.Unlock()
+		}
+	}
+}
+
+// Port returns the port the receiver listens on
+func (r *receiver) Port() int {
+	if r.listener != nil {
+		return r.listener.Addr().(*net.TCPAddr).Port
+	}
+	return r.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Stats returns the traffic received, with the number of datagrams lost for UDP
+func (r *receiver) Stats() Stats {
+	r.Lock()
+	defer r.Unlock()
+
+	stats := r.stats
+	if r.conn != nil && stats.Packets > 0 {
+		if lost := r.maxSeq + 1 - stats.Packets; lost > 0 {
+			stats.Lost = lost
+		}
+	}
+	return stats
+}
+
+// Close stops listening and closes the accepted connections
+func (r *receiver) Close() {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.closed {
+		return
+	}
+	r.closed = true
+
+	if r.listener != nil {
+		r.listener.Close()
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	for _, conn := range r.conns {
+		conn.Close()
+	}
+}
+
+func newReceiver(protocol string, port int) (*receiver, error) {
+	r := &receiver{}
+	addr := fmt.Sprintf(":%d", port)
+
+	switch protocol {
+	case "tcp":
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		r.listener = listener
+		go r.serveTCP()
+	case "udp":
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		r.conn = conn
+		go r.serveUDP()
+	default:
+		return nil, fmt.Errorf("Unsupported protocol %s", protocol)
+	}
+
+	return r, nil
+}
+
+// sender generates TCP or UDP traffic to a receiver, at the given bandwidth
+// in bits per second if not zero
+type sender struct {
+	counter
+	conn      net.Conn
+	protocol  string
+	bandwidth int64
+	size      int
+	quit      chan struct{}
+	done      chan struct{}
+}
+
+// pace sleeps as long as the traffic sent is ahead of the bandwidth
+func (s *sender) pace(start time.Time, sent int64) {
+	if s.bandwidth <= 0 {
+		return
+	}
+
+	expected := time.Duration(float64(sent*8) / float64(s.bandwidth) * float64(time.Second))
+	if ahead := expected - time.Since(start); ahead > 0 {
+		select {
+		case <-time.After(ahead):
+		case <-s.quit:
+		}
+	}
+}
+
+func (s *sender) run(duration time.Duration) {
+	defer close(s.done)
+	defer s.conn.Close()
+
+	start := time.Now()
+	deadline := start.Add(duration)
+	s.conn.SetWriteDeadline(deadline)
+
+	buffer := make([]byte, s.size)
+	var seq uint64
+	var sent int64
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+
+		if s.protocol == "udp" {
+			binary.BigEndian.PutUint64(buffer, seq)
+			seq++
+		}
+
+		n, err := s.conn.Write(buffer)
+		if n > 0 {
+			s.account(n)
+			sent += int64(n)
+		}
+		// a UDP write may fail while the receiver is not reachable,
+		// the datagram is then accounted as lost
+		if err != nil && s.protocol == "tcp" {
+			return
+		}
+
+		s.pace(start, sent)
+	}
+}
+
+// Close stops the traffic generation
+func (s *sender) Close() {
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+	s.conn.SetWriteDeadline(time.Now())
+	<-s.done
+}
+
+func newSender(protocol, address string, duration time.Duration, bandwidth int64, size int) (*sender, error) {
+	if protocol == "udp" && size < seqSize {
+		return nil, fmt.Errorf("UDP packet size must be at least %d bytes", seqSize)
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("Invalid packet size %d", size)
+	}
+
+	conn, err := net.DialTimeout(protocol, address, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sender{
+		conn:      conn,
+		protocol:  protocol,
+		bandwidth: bandwidth,
+		size:      size,
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go s.run(duration)
+
+	return s, nil
+}
@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package throughput
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func runTest(t *testing.T, protocol string, bandwidth int64, size int) (Stats, Stats) {
+	r, err := newReceiver(protocol, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	s, err := newSender(protocol, fmt.Sprintf("127.0.0.1:%d", r.Port()), time.Second, bandwidth, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-s.done
+	time.Sleep(100 * time.Millisecond)
+
+	return s.Stats(), r.Stats()
+}
+
+func TestTCPThroughput(t *testing.T) {
+	sent, received := runTest(t, "tcp", 0, 32768)
+
+	if sent.Bytes == 0 {
+		t.Fatal("No traffic sent")
+	}
+
+	if received.Bytes != sent.Bytes {
+		t.Errorf("Expected %d bytes received, got %d", sent.Bytes, received.Bytes)
+	}
+}
+
+func TestUDPThroughput(t *testing.T) {
+	// 8 Mbit/s of 1000 bytes datagrams during one second
+	sent, received := runTest(t, "udp", 8000000, 1000)
+
+	if sent.Packets < 900 || sent.Packets > 1100 {
+		t.Errorf("Expected about 1000 datagrams sent at the given bandwidth, got %d", sent.Packets)
+	}
+
+	if received.Packets+received.Lost != sent.Packets {
+		t.Errorf("Expected %d datagrams received or lost, got %+v", sent.Packets, received)
+	}
+}
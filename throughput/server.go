@@ -0,0 +1,197 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package throughput
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/logging"
+	ws "github.com/skydive-project/skydive/websocket"
+)
+
+const (
+	// Namespace Throughput
+	Namespace = "Throughput"
+)
+
+// ReceiveParams describes the receiving side of a test
+type ReceiveParams struct {
+	UUID     string
+	Protocol string
+	Port     int
+	Lifetime int
+}
+
+// SendParams describes the sending side of a test, the traffic being sent
+// to Address during Duration seconds
+type SendParams struct {
+	UUID       string
+	Protocol   string
+	Address    string
+	Duration   int
+	Bandwidth  int64
+	PacketSize int
+}
+
+// ResultParams identifies the endpoint of a test whose result is
+// requested, Role being either receiver or sender as both endpoints may run
+// on the same agent
+type ResultParams struct {
+	UUID string
+	Role string
+}
+
+// Reply describes the reply to a throughput request
+type Reply struct {
+	Port  int    `json:",omitempty"`
+	Stats *Stats `json:",omitempty"`
+	Error string `json:",omitempty"`
+}
+
+// Server runs the endpoints of the throughput tests requested by the analyzer
+type Server struct {
+	sync.Mutex
+	endpoints map[string]endpoint
+	timers    map[string]*time.Timer
+}
+
+func (s *Server) add(key string, e endpoint, lifetime time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.endpoints[key] = e
+	// the endpoint is removed if the analyzer never collects its result
+	s.timers[key] = time.AfterFunc(lifetime, func() {
+		logging.GetLogger().Warningf("Throughput test endpoint %s expired", key)
+		s.remove(key)
+	})
+}
+
+func (s *Server) remove(key string) (endpoint, bool) {
+	s.Lock()
+	e, ok := s.endpoints[key]
+	if ok {
+		delete(s.endpoints, key)
+		s.timers[key].Stop()
+		delete(s.timers, key)
+	}
+	s.Unlock()
+
+	if ok {
+		e.Close()
+	}
+	return e, ok
+}
+
+func (s *Server) receive(msg *ws.StructMessage) (*Reply, error) {
+	var params ReceiveParams
+	if err := json.Unmarshal(msg.Obj, &params); err != nil {
+		return nil, fmt.Errorf("Unable to decode throughput receive message %v", msg)
+	}
+
+	r, err := newReceiver(params.Protocol, params.Port)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to listen for throughput test %s: %s", params.UUID, err)
+	}
+	s.add(params.UUID+"/receiver", r, time.Duration(params.Lifetime)*time.Second)
+
+	return &Reply{Port: r.Port()}, nil
+}
+
+func (s *Server) send(msg *ws.StructMessage) (*Reply, error) {
+	var params SendParams
+	if err := json.Unmarshal(msg.Obj, &params); err != nil {
+		return nil, fmt.Errorf("Unable to decode throughput send message %v", msg)
+	}
+
+	duration := time.Duration(params.Duration) * time.Second
+	sd, err := newSender(params.Protocol, params.Address, duration, params.Bandwidth, params.PacketSize)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to connect to %s for throughput test %s: %s", params.Address, params.UUID, err)
+	}
+	s.add(params.UUID+"/sender", sd, 2*duration+time.Minute)
+
+	return &Reply{}, nil
+}
+
+// result stops the endpoint of a test and returns its statistics
+func (s *Server) result(msg *ws.StructMessage) (*Reply, error) {
+	var params ResultParams
+	if err := json.Unmarshal(msg.Obj, &params); err != nil {
+		return nil, fmt.Errorf("Unable to decode throughput result message %v", msg)
+	}
+
+	e, ok := s.remove(params.UUID + "/" + params.Role)
+	if !ok {
+		return nil, fmt.Errorf("No throughput %s running on this ID: %s", params.Role, params.UUID)
+	}
+
+	stats := e.Stats()
+	return &Reply{Stats: &stats}, nil
+}
+
+// OnStructMessage event, websocket throughput requests
+func (s *Server) OnStructMessage(c ws.Speaker, msg *ws.StructMessage) {
+	var handler func(*ws.StructMessage) (*Reply, error)
+	switch msg.Type {
+	case "ReceiveRequest":
+		handler = s.receive
+	case "SendRequest":
+		handler = s.send
+	case "ResultRequest":
+		handler = s.result
+	default:
+		return
+	}
+
+	reply, err := handler(msg)
+	if err != nil {
+		logging.GetLogger().Error(err)
+		c.SendMessage(msg.Reply(&Reply{Error: err.Error()}, msg.Type+"Reply", http.StatusBadRequest))
+		return
+	}
+	c.SendMessage(msg.Reply(reply, msg.Type+"Reply", http.StatusOK))
+}
+
+// Stop the running endpoints
+func (s *Server) Stop() {
+	s.Lock()
+	var keys []string
+	for key := range s.endpoints {
+		keys = append(keys, key)
+	}
+	s.Unlock()
+
+	for _, key := range keys {
+		s.remove(key)
+	}
+}
+
+// NewServer creates a new throughput server handling the requests of the analyzers
+func NewServer(pool ws.StructSpeakerPool) *Server {
+	s := &Server{
+		endpoints: make(map[string]endpoint),
+		timers:    make(map[string]*time.Timer),
+	}
+	pool.AddStructMessageHandler(s, []string{Namespace})
+	return s
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	json "encoding/json"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// EdgeMetric the link counters of an edge. The latency is accumulated so
+// that metrics can be summed and split, Latency being the average latency
+// in microseconds of the samples.
+// easyjson:json
+type EdgeMetric struct {
+	Bytes          int64 `json:"Bytes,omitempty"`
+	Packets        int64 `json:"Packets,omitempty"`
+	Drops          int64 `json:"Drops,omitempty"`
+	Errors         int64 `json:"Errors,omitempty"`
+	LatencySum     int64 `json:"LatencySum,omitempty"`
+	LatencySamples int64 `json:"LatencySamples,omitempty"`
+	Start          int64 `json:"Start,omitempty"`
+	Last           int64 `json:"Last,omitempty"`
+}
+
+// EdgeMetricMetadataDecoder implements a json message raw decoder
+func EdgeMetricMetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var metric EdgeMetric
+	if err := json.Unmarshal(raw, &metric); err != nil {
+		return nil, err
+	}
+
+	return &metric, nil
+}
+
+// GetStart returns start time
+func (em *EdgeMetric) GetStart() int64 {
+	return em.Start
+}
+
+// SetStart set start time
+func (em *EdgeMetric) SetStart(start int64) {
+	em.Start = start
+}
+
+// GetLast returns last time
+func (em *EdgeMetric) GetLast() int64 {
+	return em.Last
+}
+
+// SetLast set last time
+func (em *EdgeMetric) SetLast(last int64) {
+	em.Last = last
+}
+
+// Latency returns the average latency of the samples
+func (em *EdgeMetric) Latency() int64 {
+	if em.LatencySamples == 0 {
+		return 0
+	}
+	return em.LatencySum / em.LatencySamples
+}
+
+// GetFieldInt64 implements Getter and Metrics interfaces
+func (em *EdgeMetric) GetFieldInt64(field string) (int64, error) {
+	switch field {
+	case "Start":
+		return em.Start, nil
+	case "Last":
+		return em.Last, nil
+	case "Bytes":
+		return em.Bytes, nil
+	case "Packets":
+		return em.Packets, nil
+	case "Drops":
+		return em.Drops, nil
+	case "Errors":
+		return em.Errors, nil
+	case "LatencySum":
+		return em.LatencySum, nil
+	case "LatencySamples":
+		return em.LatencySamples, nil
+	case "Latency":
+		return em.Latency(), nil
+	}
+	return 0, common.ErrFieldNotFound
+}
+
+// GetField implements Getter interface
+func (em *EdgeMetric) GetField(key string) (interface{}, error) {
+	return em.GetFieldInt64(key)
+}
+
+// GetFieldString implements Getter interface
+func (em *EdgeMetric) GetFieldString(key string) (string, error) {
+	return "", common.ErrFieldNotFound
+}
+
+// Add sum two metrics and return a new Metrics object
+func (em *EdgeMetric) Add(m common.Metric) common.Metric {
+	om := m.(*EdgeMetric)
+
+	return &EdgeMetric{
+		Bytes:          em.Bytes + om.Bytes,
+		Packets:        em.Packets + om.Packets,
+		Drops:          em.Drops + om.Drops,
+		Errors:         em.Errors + om.Errors,
+		LatencySum:     em.LatencySum + om.LatencySum,
+		LatencySamples: em.LatencySamples + om.LatencySamples,
+		Start:          em.Start,
+		Last:           em.Last,
+	}
+}
+
+// Sub subtracts two metrics and return a new metrics object
+func (em *EdgeMetric) Sub(m common.Metric) common.Metric {
+	om := m.(*EdgeMetric)
+
+	return &EdgeMetric{
+		Bytes:          em.Bytes - om.Bytes,
+		Packets:        em.Packets - om.Packets,
+		Drops:          em.Drops - om.Drops,
+		Errors:         em.Errors - om.Errors,
+		LatencySum:     em.LatencySum - om.LatencySum,
+		LatencySamples: em.LatencySamples - om.LatencySamples,
+		Start:          em.Start,
+		Last:           em.Last,
+	}
+}
+
+// IsZero returns true if all the values are equal to zero
+func (em *EdgeMetric) IsZero() bool {
+	// sum as these numbers can't be <= 0
+	return (em.Bytes +
+		em.Packets +
+		em.Drops +
+		em.Errors +
+		em.LatencySum +
+		em.LatencySamples) == 0
+}
+
+func (em *EdgeMetric) applyRatio(ratio float64) *EdgeMetric {
+	return &EdgeMetric{
+		Bytes:          int64(float64(em.Bytes) * ratio),
+		Packets:        int64(float64(em.Packets) * ratio),
+		Drops:          int64(float64(em.Drops) * ratio),
+		Errors:         int64(float64(em.Errors) * ratio),
+		LatencySum:     int64(float64(em.LatencySum) * ratio),
+		LatencySamples: int64(float64(em.LatencySamples) * ratio),
+		Start:          em.Start,
+		Last:           em.Last,
+	}
+}
+
+// Split splits a metric into two parts
+func (em *EdgeMetric) Split(cut int64) (common.Metric, common.Metric) {
+	if cut <= em.Start {
+		return nil, em
+	} else if cut >= em.Last || em.Start == em.Last {
+		return em, nil
+	}
+
+	duration := float64(em.Last - em.Start)
+
+	ratio1 := float64(cut-em.Start) / duration
+	ratio2 := float64(em.Last-cut) / duration
+
+	m1 := em.applyRatio(ratio1)
+	m1.Last = cut
+
+	m2 := em.applyRatio(ratio2)
+	m2.Start = cut
+
+	return m1, m2
+}
+
+// GetFieldKeys implements Getter and Metrics interfaces
+func (em *EdgeMetric) GetFieldKeys() []string {
+	return edgeMetricsFields
+}
+
+var edgeMetricsFields []string
+
+func init() {
+	edgeMetricsFields = append(common.StructFieldKeys(EdgeMetric{}), "Latency")
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEdgeMetricSlice(t *testing.T) {
+	m := &EdgeMetric{
+		Bytes:          100,
+		Packets:        100,
+		LatencySum:     400,
+		LatencySamples: 4,
+		Last:           100,
+	}
+
+	s1, s2 := m.Split(25)
+
+	expected := &EdgeMetric{
+		Bytes:          25,
+		Packets:        25,
+		LatencySum:     100,
+		LatencySamples: 1,
+		Start:          0,
+		Last:           25,
+	}
+
+	if !reflect.DeepEqual(expected, s1) {
+		t.Errorf("Slice 1 error, expected %+v, got %+v", expected, s1)
+	}
+
+	expected = &EdgeMetric{
+		Bytes:          75,
+		Packets:        75,
+		LatencySum:     300,
+		LatencySamples: 3,
+		Start:          25,
+		Last:           100,
+	}
+
+	if !reflect.DeepEqual(expected, s2) {
+		t.Errorf("Slice 2 error, expected %+v, got %+v", expected, s2)
+	}
+}
+
+func TestEdgeMetricLatency(t *testing.T) {
+	m1 := &EdgeMetric{LatencySum: 300, LatencySamples: 3}
+	m2 := &EdgeMetric{LatencySum: 500, LatencySamples: 1}
+
+	if latency, _ := m1.GetFieldInt64("Latency"); latency != 100 {
+		t.Errorf("Expected a latency of 100, got %d", latency)
+	}
+
+	sum := m1.Add(m2)
+	if latency, _ := sum.GetFieldInt64("Latency"); latency != 200 {
+		t.Errorf("Expected a latency of 200, got %d", latency)
+	}
+
+	if latency := (&EdgeMetric{}).Latency(); latency != 0 {
+		t.Errorf("Expected no latency without samples, got %d", latency)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package usertopology
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	uuid "github.com/nu7hatch/gouuid"
+
+	apiServer "github.com/skydive-project/skydive/api/server"
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+)
+
+// InventoryProbe is the Probe value of the nodes created from an inventory,
+// making them distinct from the nodes owned by the probes
+const InventoryProbe = "inventory"
+
+// InventoryNode describes a node of an inventory
+type InventoryNode struct {
+	Name        string
+	Type        string
+	Description string
+	Metadata    graph.Metadata
+}
+
+// InventoryLink describes a link of an inventory. Src and Dst are either
+// the name of an inventory node or a Gremlin expression.
+type InventoryLink struct {
+	Src          string
+	Dst          string
+	RelationType string
+	Description  string
+	Metadata     graph.Metadata
+}
+
+// Inventory describes a set of nodes and links that can't be discovered
+// by the probes, like routers or external devices
+type Inventory struct {
+	Nodes []InventoryNode
+	Links []InventoryLink
+}
+
+// LoadInventory reads an inventory from a YAML or JSON file
+func LoadInventory(path string) (*Inventory, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory Inventory
+	if err := yaml.Unmarshal(content, &inventory); err != nil {
+		return nil, fmt.Errorf("Unable to parse inventory %s: %s", path, err)
+	}
+
+	return &inventory, nil
+}
+
+func inventoryID(kind string, values ...string) string {
+	u, _ := uuid.NewV5(uuid.NamespaceOID, []byte(InventoryProbe+kind+strings.Join(values, "/")))
+	return u.String()
+}
+
+func inventoryNodeQuery(ref string) (string, error) {
+	if strings.HasPrefix(ref, "G.") {
+		return ref, nil
+	}
+
+	if ref == "" || strings.ContainsAny(ref, `'"`) {
+		return "", fmt.Errorf("Invalid inventory node reference: %s", ref)
+	}
+
+	return fmt.Sprintf("G.V().Has('Probe', '%s', 'Name', '%s')", InventoryProbe, ref), nil
+}
+
+// NodeRules returns the node rules creating the nodes of the inventory
+func (i *Inventory) NodeRules() ([]*types.NodeRule, error) {
+	var rules []*types.NodeRule
+	for _, node := range i.Nodes {
+		if node.Name == "" || node.Type == "" {
+			return nil, fmt.Errorf("Inventory nodes require a name and a type: %+v", node)
+		}
+
+		metadata := graph.Metadata{}
+		for k, v := range node.Metadata {
+			metadata[k] = v
+		}
+		metadata["Name"] = node.Name
+		metadata["Type"] = node.Type
+		metadata["Probe"] = InventoryProbe
+
+		rule := &types.NodeRule{
+			Name:        node.Name,
+			Description: node.Description,
+			Metadata:    metadata,
+			Action:      "create",
+		}
+		rule.SetID(inventoryID("node", node.Type, node.Name))
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// EdgeRules returns the edge rules creating the links of the inventory
+func (i *Inventory) EdgeRules() ([]*types.EdgeRule, error) {
+	var rules []*types.EdgeRule
+	for _, link := range i.Links {
+		src, err := inventoryNodeQuery(link.Src)
+		if err != nil {
+			return nil, err
+		}
+
+		dst, err := inventoryNodeQuery(link.Dst)
+		if err != nil {
+			return nil, err
+		}
+
+		relationType := link.RelationType
+		if relationType == "" {
+			relationType = "layer2"
+		}
+
+		metadata := graph.Metadata{}
+		for k, v := range link.Metadata {
+			metadata[k] = v
+		}
+		metadata["RelationType"] = relationType
+
+		rule := &types.EdgeRule{
+			Name:        fmt.Sprintf("%s-%s", link.Src, link.Dst),
+			Description: link.Description,
+			Src:         src,
+			Dst:         dst,
+			Metadata:    metadata,
+		}
+		rule.SetID(inventoryID("edge", link.Src, link.Dst, relationType))
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func seedResource(handler *apiServer.BasicAPIHandler, resource types.Resource) error {
+	// the rule may have been modified through the API since the last seeding
+	if _, found := handler.Get(resource.ID()); found {
+		return nil
+	}
+
+	if err := validator.Validate(resource); err != nil {
+		return err
+	}
+
+	return handler.Set(resource)
+}
+
+// SeedInventory creates the node and edge rules of the inventory that don't
+// exist yet. As they are regular rules, they can then be edited or removed
+// using the node rule and edge rule APIs.
+func SeedInventory(inventory *Inventory, nodeHandler *apiServer.NodeRuleAPI, edgeHandler *apiServer.EdgeRuleAPI) error {
+	nodeRules, err := inventory.NodeRules()
+	if err != nil {
+		return err
+	}
+
+	edgeRules, err := inventory.EdgeRules()
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range nodeRules {
+		if err := seedResource(&nodeHandler.BasicAPIHandler, rule); err != nil {
+			return fmt.Errorf("Unable to seed inventory node %s: %s", rule.Name, err)
+		}
+	}
+
+	for _, rule := range edgeRules {
+		if err := seedResource(&edgeHandler.BasicAPIHandler, rule); err != nil {
+			return fmt.Errorf("Unable to seed inventory link %s: %s", rule.Name, err)
+		}
+	}
+
+	logging.GetLogger().Infof("Topology seeded with %d nodes and %d links from inventory", len(nodeRules), len(edgeRules))
+
+	return nil
+}
+
+// SeedInventoryFromConfig seeds the inventory defined by the
+// analyzer.topology.inventory configuration key, if any
+func SeedInventoryFromConfig(nodeHandler *apiServer.NodeRuleAPI, edgeHandler *apiServer.EdgeRuleAPI) error {
+	path := config.GetString("analyzer.topology.inventory")
+	if path == "" {
+		return nil
+	}
+
+	inventory, err := LoadInventory(path)
+	if err != nil {
+		return err
+	}
+
+	return SeedInventory(inventory, nodeHandler, edgeHandler)
+}
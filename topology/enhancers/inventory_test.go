@@ -0,0 +1,105 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package usertopology
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testInventory = `
+nodes:
+  - name: router1
+    type: router
+    metadata:
+      Vendor: acme
+  - name: router2
+    type: router
+links:
+  - src: router1
+    dst: router2
+  - src: router2
+    dst: G.V().Has('Type', 'host')
+    relationtype: ownership
+`
+
+func TestInventory(t *testing.T) {
+	f, err := ioutil.TempFile("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString(testInventory)
+	f.Close()
+
+	inventory, err := LoadInventory(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeRules, err := inventory.NodeRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodeRules) != 2 {
+		t.Fatalf("Expected 2 node rules, got %d", len(nodeRules))
+	}
+
+	metadata := nodeRules[0].Metadata
+	if metadata["Name"] != "router1" || metadata["Type"] != "router" || metadata["Probe"] != InventoryProbe || metadata["Vendor"] != "acme" {
+		t.Errorf("Wrong node rule metadata: %+v", metadata)
+	}
+
+	// identifiers have to be stable to not seed the same node twice
+	again, _ := inventory.NodeRules()
+	if nodeRules[0].ID() == "" || nodeRules[0].ID() != again[0].ID() || nodeRules[0].ID() == nodeRules[1].ID() {
+		t.Errorf("Node rule identifiers should be stable and unique")
+	}
+
+	edgeRules, err := inventory.EdgeRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(edgeRules) != 2 {
+		t.Fatalf("Expected 2 edge rules, got %d", len(edgeRules))
+	}
+
+	if edgeRules[0].Src != "G.V().Has('Probe', 'inventory', 'Name', 'router1')" || edgeRules[0].Metadata["RelationType"] != "layer2" {
+		t.Errorf("Wrong edge rule: %+v", edgeRules[0])
+	}
+
+	if edgeRules[1].Dst != "G.V().Has('Type', 'host')" || edgeRules[1].Metadata["RelationType"] != "ownership" {
+		t.Errorf("Wrong edge rule: %+v", edgeRules[1])
+	}
+}
+
+func TestInventoryInvalidNode(t *testing.T) {
+	inventory := &Inventory{Nodes: []InventoryNode{{Name: "router1"}}}
+	if _, err := inventory.NodeRules(); err == nil {
+		t.Error("A node without a type should be rejected")
+	}
+
+	inventory = &Inventory{Links: []InventoryLink{{Src: "router'1", Dst: "router2"}}}
+	if _, err := inventory.EdgeRules(); err == nil {
+		t.Error("A link with an invalid reference should be rejected")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+const (
+	// BridgeFDBMetadataKey is the metadata key of the forwarding database
+	// of a bridge
+	BridgeFDBMetadataKey = "BridgeFDB"
+	// MACMovesMetadataKey is the metadata key of the last MAC moves of a
+	// bridge
+	MACMovesMetadataKey = "MACMoves"
+	// MACMoveCountMetadataKey is the metadata key of the number of MAC moves
+	// seen on a bridge
+	MACMoveCountMetadataKey = "MACMoveCount"
+)
+
+// FDBEntry describes an entry of the forwarding database of a bridge, Port
+// being the name of the port the MAC address was learnt on
+type FDBEntry struct {
+	MAC    string
+	Vlan   int64
+	Port   string
+	Static bool
+}
+
+// MACMove describes a MAC address learnt on another port of a bridge, which
+// happens on VM migrations but also on loops
+type MACMove struct {
+	MAC  string
+	Vlan int64
+	From string
+	To   string
+	Time int64
+}
+
+type fdbKey struct {
+	mac  string
+	vlan int64
+}
+
+// FDBTracker keeps the ports the MAC addresses of a bridge were learnt on
+// to detect the MAC addresses moving between ports
+type FDBTracker struct {
+	ports map[fdbKey]string
+}
+
+// Update records the current entries of the forwarding database and returns
+// the MAC addresses that moved since the previous update. The static entries
+// are ignored and the aged out entries are forgotten.
+func (t *FDBTracker) Update(entries []FDBEntry, now time.Time) (moves []MACMove) {
+	ports := make(map[fdbKey]string, len(entries))
+	for _, entry := range entries {
+		if entry.Static {
+			continue
+		}
+
+		key := fdbKey{mac: entry.MAC, vlan: entry.Vlan}
+		if previous, found := t.ports[key]; found && previous != entry.Port {
+			moves = append(moves, MACMove{
+				MAC:  entry.MAC,
+				Vlan: entry.Vlan,
+				From: previous,
+				To:   entry.Port,
+				Time: common.UnixMillis(now),
+			})
+		}
+		ports[key] = entry.Port
+	}
+	t.ports = ports
+
+	return moves
+}
+
+// NewFDBTracker returns a new forwarding database tracker
+func NewFDBTracker() *FDBTracker {
+	return &FDBTracker{ports: make(map[fdbKey]string)}
+}
+
+// SetBridgeFDB sets the forwarding database of a bridge and appends the MAC
+// moves to the last ones, keeping at most maxMoves moves. The caller must
+// hold the graph lock.
+func SetBridgeFDB(g *graph.Graph, bridge *graph.Node, entries []FDBEntry, moves []MACMove, maxMoves int) {
+	fdb := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		fdb[i] = map[string]interface{}{
+			"MAC":    entry.MAC,
+			"Vlan":   entry.Vlan,
+			"Port":   entry.Port,
+			"Static": entry.Static,
+		}
+	}
+
+	current, _ := bridge.GetField(BridgeFDBMetadataKey)
+	if len(moves) == 0 && reflect.DeepEqual(current, fdb) {
+		return
+	}
+
+	tr := g.StartMetadataTransaction(bridge)
+	tr.AddMetadata(BridgeFDBMetadataKey, fdb)
+
+	if len(moves) > 0 {
+		var last []interface{}
+		if value, err := bridge.GetField(MACMovesMetadataKey); err == nil {
+			previous, _ := value.([]interface{})
+			last = append(last, previous...)
+		}
+
+		for _, move := range moves {
+			last = append(last, map[string]interface{}{
+				"MAC":  move.MAC,
+				"Vlan": move.Vlan,
+				"From": move.From,
+				"To":   move.To,
+				"Time": move.Time,
+			})
+		}
+		if len(last) > maxMoves {
+			last = last[len(last)-maxMoves:]
+		}
+		tr.AddMetadata(MACMovesMetadataKey, last)
+
+		count, _ := bridge.GetFieldInt64(MACMoveCountMetadataKey)
+		tr.AddMetadata(MACMoveCountMetadataKey, count+int64(len(moves)))
+	}
+
+	tr.Commit()
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestFDBTracker(t *testing.T) {
+	tracker := NewFDBTracker()
+	now := time.Now()
+
+	entries := []FDBEntry{
+		{MAC: "52:54:00:00:00:01", Port: "tap1"},
+		{MAC: "52:54:00:00:00:02", Port: "tap2"},
+		{MAC: "52:54:00:00:00:03", Port: "br0", Static: true},
+	}
+	if moves := tracker.Update(entries, now); len(moves) != 0 {
+		t.Fatalf("No move expected, got %+v", moves)
+	}
+
+	entries = []FDBEntry{
+		{MAC: "52:54:00:00:00:01", Port: "vxlan0"},
+		{MAC: "52:54:00:00:00:02", Port: "tap2"},
+		{MAC: "52:54:00:00:00:03", Port: "tap3", Static: true},
+	}
+	moves := tracker.Update(entries, now)
+	if len(moves) != 1 || moves[0].MAC != "52:54:00:00:00:01" || moves[0].From != "tap1" || moves[0].To != "vxlan0" {
+		t.Fatalf("Expected a move of 52:54:00:00:00:01 from tap1 to vxlan0, got %+v", moves)
+	}
+
+	// the same address on another VLAN is another entry
+	entries = append(entries, FDBEntry{MAC: "52:54:00:00:00:02", Vlan: 10, Port: "tap4"})
+	if moves := tracker.Update(entries, now); len(moves) != 0 {
+		t.Fatalf("No move expected, got %+v", moves)
+	}
+}
+
+func TestSetBridgeFDB(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	bridge, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "br0", "Type": "bridge"})
+
+	entries := []FDBEntry{{MAC: "52:54:00:00:00:01", Port: "tap1"}}
+	for i := 0; i < 3; i++ {
+		moves := []MACMove{{MAC: "52:54:00:00:00:01", From: "tap1", To: "tap2", Time: int64(i)}}
+		SetBridgeFDB(g, bridge, entries, moves, 2)
+	}
+
+	fdb, _ := bridge.GetField(BridgeFDBMetadataKey)
+	if entries, ok := fdb.([]interface{}); !ok || len(entries) != 1 {
+		t.Errorf("Wrong FDB: %+v", fdb)
+	}
+
+	if count, _ := bridge.GetFieldInt64(MACMoveCountMetadataKey); count != 3 {
+		t.Errorf("Expected 3 moves, got %d", count)
+	}
+
+	moves, _ := bridge.GetField(MACMovesMetadataKey)
+	if last, ok := moves.([]interface{}); !ok || len(last) != 2 {
+		t.Errorf("Expected the 2 last moves, got %+v", moves)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// LLDPChassisID returns the ID of the node of a switch as generated by the
+// LLDP probe, using the system name and the management address if known and
+// falling back to the chassis ID and its type, so that the probes polling
+// the switches share the nodes discovered by LLDP.
+func LLDPChassisID(sysName, mgmtAddress, chassisID, chassisIDType string) graph.Identifier {
+	var discriminators []string
+	if sysName != "" {
+		discriminators = append(discriminators, sysName, "SysName")
+	}
+	if mgmtAddress != "" {
+		discriminators = append(discriminators, mgmtAddress, "MgmtAddress")
+	}
+	if len(discriminators) == 0 {
+		discriminators = append(discriminators, chassisID, chassisIDType)
+	}
+	return graph.GenID(discriminators...)
+}
+
+// LLDPPortID returns the ID of the node of a switch port as generated by the
+// LLDP probe
+func LLDPPortID(chassis graph.Identifier, portID, portIDType string) graph.Identifier {
+	return graph.GenID(string(chassis), portID, portIDType)
+}
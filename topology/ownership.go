@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// OwnerMetadataKey is the metadata holding the name of the probe owning a
+// node or an edge
+const OwnerMetadataKey = "Probe"
+
+// Ownership describes the elements and the metadata namespaces owned by a
+// probe. A node is owned by a probe when its Manager is one of Managers or,
+// having no Manager, when its Type is one of Types. An edge is owned by the
+// probe owning one of its nodes.
+type Ownership struct {
+	Managers   []string `json:",omitempty"`
+	Types      []string `json:",omitempty"`
+	Namespaces []string `json:",omitempty"`
+}
+
+// OwnershipTracker tags the nodes and the edges with the name of the probe
+// owning them, so that the elements of a disabled probe can be removed
+type OwnershipTracker struct {
+	common.RWMutex
+	graph.DefaultGraphListener
+	graph      *graph.Graph
+	ownerships map[string]Ownership
+}
+
+// Register declares the ownership of a probe
+func (t *OwnershipTracker) Register(probe string, ownership Ownership) {
+	t.Lock()
+	t.ownerships[probe] = ownership
+	t.Unlock()
+}
+
+// Ownerships returns the ownership of the registered probes
+func (t *OwnershipTracker) Ownerships() map[string]Ownership {
+	t.RLock()
+	defer t.RUnlock()
+
+	ownerships := make(map[string]Ownership, len(t.ownerships))
+	for probe, ownership := range t.ownerships {
+		ownerships[probe] = ownership
+	}
+	return ownerships
+}
+
+func inSlice(s string, l []string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *OwnershipTracker) nodeOwner(n *graph.Node) string {
+	manager, _ := n.GetFieldString("Manager")
+	tp, _ := n.GetFieldString("Type")
+
+	t.RLock()
+	defer t.RUnlock()
+
+	for probe, ownership := range t.ownerships {
+		if manager != "" {
+			if inSlice(manager, ownership.Managers) {
+				return probe
+			}
+		} else if tp != "" && inSlice(tp, ownership.Types) {
+			return probe
+		}
+	}
+	return ""
+}
+
+func (t *OwnershipTracker) tagNode(n *graph.Node) {
+	if _, err := n.GetFieldString(OwnerMetadataKey); err == nil {
+		return
+	}
+
+	if owner := t.nodeOwner(n); owner != "" {
+		t.graph.AddMetadata(n, OwnerMetadataKey, owner)
+	}
+}
+
+// OnNodeAdded event
+func (t *OwnershipTracker) OnNodeAdded(n *graph.Node) {
+	t.tagNode(n)
+}
+
+// OnNodeUpdated event, the Manager or the Type being possibly set after the
+// creation of the node
+func (t *OwnershipTracker) OnNodeUpdated(n *graph.Node) {
+	t.tagNode(n)
+}
+
+// OnEdgeAdded event
+func (t *OwnershipTracker) OnEdgeAdded(e *graph.Edge) {
+	for _, id := range []graph.Identifier{e.Child, e.Parent} {
+		if n := t.graph.GetNode(id); n != nil {
+			if owner, _ := n.GetFieldString(OwnerMetadataKey); owner != "" {
+				t.graph.AddMetadata(e, OwnerMetadataKey, owner)
+				return
+			}
+		}
+	}
+}
+
+// Owned returns the nodes and the edges owned by a probe. The graph lock
+// has to be held.
+func (t *OwnershipTracker) Owned(probe string) ([]*graph.Node, []*graph.Edge) {
+	m := graph.Metadata{OwnerMetadataKey: probe}
+	return t.graph.GetNodes(m), t.graph.GetEdges(m)
+}
+
+// Cleanup removes the nodes and the edges owned by a disabled probe, its
+// metadata namespaces and its errors from the other nodes. The graph lock
+// has to be held.
+func (t *OwnershipTracker) Cleanup(probe string) {
+	t.RLock()
+	ownership := t.ownerships[probe]
+	t.RUnlock()
+
+	nodes, edges := t.Owned(probe)
+	logging.GetLogger().Infof("Removing %d nodes and %d edges of probe %s", len(nodes), len(edges), probe)
+
+	for _, e := range edges {
+		t.graph.DelEdge(e)
+	}
+	for _, n := range nodes {
+		t.graph.DelNode(n)
+	}
+
+	namespaces := []string{ProbeErrorsMetadataKey + "." + probe}
+	for _, namespace := range append(namespaces, ownership.Namespaces...) {
+		filter := graph.NewElementFilter(filters.NewNotNullFilter(namespace))
+		for _, n := range t.graph.GetNodes(filter) {
+			t.graph.DelMetadata(n, namespace)
+		}
+	}
+}
+
+// Start tracking the ownership of the elements
+func (t *OwnershipTracker) Start() {
+	t.graph.AddEventListener(t)
+}
+
+// Stop tracking the ownership of the elements
+func (t *OwnershipTracker) Stop() {
+	t.graph.RemoveEventListener(t)
+}
+
+// NewOwnershipTracker returns a new ownership tracker for the given graph
+func NewOwnershipTracker(g *graph.Graph) *OwnershipTracker {
+	return &OwnershipTracker{
+		graph:      g,
+		ownerships: make(map[string]Ownership),
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestOwnershipTracker(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	tracker := NewOwnershipTracker(g)
+	tracker.Register("docker", Ownership{Managers: []string{"docker"}, Namespaces: []string{"Docker"}})
+	tracker.Register("lxd", Ownership{Types: []string{"container"}})
+	tracker.Start()
+	defer tracker.Stop()
+
+	g.Lock()
+	defer g.Unlock()
+
+	host, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "testhost", "Type": "host"})
+	netns, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "ns1", "Type": "netns"})
+	container, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "c1", "Type": "container", "Manager": "docker"})
+	AddOwnershipLink(g, host, netns, nil)
+	AddOwnershipLink(g, netns, container, nil)
+
+	g.AddMetadata(netns, "Docker", map[string]interface{}{"ContainerName": "c1"})
+	SetProbeError(g, "docker", errors.New("connection refused"), host)
+
+	if owner, _ := container.GetFieldString(OwnerMetadataKey); owner != "docker" {
+		t.Fatalf("The container should be owned by docker, got '%s'", owner)
+	}
+
+	if _, err := netns.GetFieldString(OwnerMetadataKey); err == nil {
+		t.Fatal("The namespace should not be owned by a probe")
+	}
+
+	nodes, edges := tracker.Owned("docker")
+	if len(nodes) != 1 || len(edges) != 1 {
+		t.Fatalf("Expected 1 node and 1 edge owned by docker, got %d nodes and %d edges", len(nodes), len(edges))
+	}
+
+	tracker.Cleanup("docker")
+
+	if g.GetNode(container.ID) != nil {
+		t.Error("The container should have been removed")
+	}
+
+	if _, err := netns.GetField("Docker"); err == nil {
+		t.Error("The Docker metadata of the namespace should have been removed")
+	}
+
+	if _, err := host.GetField("ProbeErrors.docker"); err == nil {
+		t.Error("The docker error should have been removed")
+	}
+
+	if g.GetNode(netns.ID) == nil || !HaveOwnershipLink(g, host, netns) {
+		t.Error("The namespace should have been kept")
+	}
+}
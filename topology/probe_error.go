@@ -0,0 +1,67 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// ProbeErrorsMetadataKey is the metadata holding the errors of the probes,
+// indexed by probe name. Each error holds the Error message and the time
+// in milliseconds Since when the error occurs.
+const ProbeErrorsMetadataKey = "ProbeErrors"
+
+// SetProbeError reports a persistent error of a probe on the nodes it
+// maintains, so that the staleness of their metadata is visible. The time
+// of the first occurrence of the error is kept while the error persists.
+// The graph lock has to be held.
+func SetProbeError(g *graph.Graph, probe string, err error, nodes ...*graph.Node) {
+	key := ProbeErrorsMetadataKey + "." + probe
+	msg := err.Error()
+	now := common.UnixMillis(time.Now())
+
+	for _, n := range nodes {
+		if current, _ := n.GetFieldString(key + ".Error"); current == msg {
+			continue
+		}
+
+		since, err := n.GetFieldInt64(key + ".Since")
+		if err != nil {
+			since = now
+		}
+
+		g.AddMetadata(n, key, map[string]interface{}{
+			"Error": msg,
+			"Since": since,
+		})
+	}
+}
+
+// ClearProbeError removes the error of a probe from the nodes once the probe
+// recovered. The graph lock has to be held.
+func ClearProbeError(g *graph.Graph, probe string, nodes ...*graph.Node) {
+	key := ProbeErrorsMetadataKey + "." + probe
+	for _, n := range nodes {
+		if _, err := n.GetField(key); err == nil {
+			g.DelMetadata(n, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestProbeError(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	host, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "testhost", "Type": "host"})
+	host.Metadata["ProbeErrors"] = map[string]interface{}{
+		"ovsdb": map[string]interface{}{"Error": "connection refused", "Since": int64(1000)},
+	}
+
+	SetProbeError(g, "ovsdb", errors.New("connection reset"), host)
+	SetProbeError(g, "opencontrail", errors.New("rt --monitor exited"), host)
+
+	if msg, _ := host.GetFieldString("ProbeErrors.ovsdb.Error"); msg != "connection reset" {
+		t.Errorf("Wrong error message: %s", msg)
+	}
+
+	if since, _ := host.GetFieldInt64("ProbeErrors.ovsdb.Since"); since != 1000 {
+		t.Errorf("The time of the first occurrence should be kept, got %d", since)
+	}
+
+	ClearProbeError(g, "ovsdb", host)
+	if _, err := host.GetField("ProbeErrors.ovsdb"); err == nil {
+		t.Error("The error should have been removed")
+	}
+
+	ClearProbeError(g, "opencontrail", host)
+	if _, err := host.GetField("ProbeErrors"); err == nil {
+		t.Error("The errors metadata should have been removed once empty")
+	}
+}
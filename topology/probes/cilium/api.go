@@ -0,0 +1,225 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cilium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+)
+
+// Endpoint describes a Cilium endpoint as returned by the agent API
+type Endpoint struct {
+	ID     int64          `json:"id"`
+	Status EndpointStatus `json:"status"`
+}
+
+// EndpointStatus describes the state of a Cilium endpoint
+type EndpointStatus struct {
+	State               string              `json:"state"`
+	Identity            *Identity           `json:"identity"`
+	Networking          *EndpointNetworking `json:"networking"`
+	Policy              *EndpointPolicy     `json:"policy"`
+	ExternalIdentifiers map[string]string   `json:"external-identifiers"`
+}
+
+// Identity describes a Cilium security identity
+type Identity struct {
+	ID     int64    `json:"id"`
+	Labels []string `json:"labels"`
+}
+
+// EndpointNetworking describes the addressing and the datapath interface
+// of a Cilium endpoint
+type EndpointNetworking struct {
+	Addressing []struct {
+		IPV4 string `json:"ipv4"`
+		IPV6 string `json:"ipv6"`
+	} `json:"addressing"`
+	InterfaceName  string `json:"interface-name"`
+	InterfaceIndex int64  `json:"interface-index"`
+	MAC            string `json:"mac"`
+	HostMAC        string `json:"host-mac"`
+}
+
+// EndpointPolicy describes the policy of a Cilium endpoint
+type EndpointPolicy struct {
+	Realized *struct {
+		PolicyEnabled            string  `json:"policy-enabled"`
+		PolicyRevision           int64   `json:"policy-revision"`
+		AllowedIngressIdentities []int64 `json:"allowed-ingress-identities"`
+		AllowedEgressIdentities  []int64 `json:"allowed-egress-identities"`
+		DeniedIngressIdentities  []int64 `json:"denied-ingress-identities"`
+		DeniedEgressIdentities   []int64 `json:"denied-egress-identities"`
+	} `json:"realized"`
+}
+
+// PolicyMap describes the content of the eBPF policy map of an endpoint
+// for one direction
+type PolicyMap struct {
+	Enforced          bool
+	AllowedIdentities []int64 `json:",omitempty"`
+	DeniedIdentities  []int64 `json:",omitempty"`
+}
+
+// Policy describes the eBPF policy maps of an endpoint
+type Policy struct {
+	Revision int64
+	Ingress  PolicyMap
+	Egress   PolicyMap
+}
+
+// client queries the REST API of the Cilium agent
+type client struct {
+	http *http.Client
+	url  string
+}
+
+func (c *client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequest("GET", c.url+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// endpoints returns the endpoints managed by the Cilium agent
+func (c *client) endpoints(ctx context.Context) ([]*Endpoint, error) {
+	var endpoints []*Endpoint
+	if err := c.get(ctx, "/v1/endpoint", &endpoints); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// identities returns the security identities known by the Cilium agent
+func (c *client) identities(ctx context.Context) (map[int64]*Identity, error) {
+	var list []*Identity
+	if err := c.get(ctx, "/v1/identity", &list); err != nil {
+		return nil, err
+	}
+
+	identities := make(map[int64]*Identity)
+	for _, identity := range list {
+		identities[identity.ID] = identity
+	}
+	return identities, nil
+}
+
+// newClient returns a client of the Cilium agent API listening at the
+// given address, either a unix socket or a tcp one
+func newClient(address string) (*client, error) {
+	protocol, target, err := common.ParseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+
+	url := "http://" + target
+	transport := &http.Transport{}
+	if protocol == "unix" {
+		url = "http://localhost"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", target)
+		}
+	}
+
+	return &client{http: &http.Client{Transport: transport}, url: url}, nil
+}
+
+// policyOf returns the eBPF policy maps realized for an endpoint
+func policyOf(ep *Endpoint) *Policy {
+	if ep.Status.Policy == nil || ep.Status.Policy.Realized == nil {
+		return nil
+	}
+	realized := ep.Status.Policy.Realized
+
+	sorted := func(ids []int64) []int64 {
+		if len(ids) == 0 {
+			return nil
+		}
+		s := append([]int64{}, ids...)
+		sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+		return s
+	}
+
+	enabled := realized.PolicyEnabled
+	return &Policy{
+		Revision: realized.PolicyRevision,
+		Ingress: PolicyMap{
+			Enforced:          enabled == "ingress" || enabled == "both",
+			AllowedIdentities: sorted(realized.AllowedIngressIdentities),
+			DeniedIdentities:  sorted(realized.DeniedIngressIdentities),
+		},
+		Egress: PolicyMap{
+			Enforced:          enabled == "egress" || enabled == "both",
+			AllowedIdentities: sorted(realized.AllowedEgressIdentities),
+			DeniedIdentities:  sorted(realized.DeniedEgressIdentities),
+		},
+	}
+}
+
+// peerIdentities returns the identities referenced by the policy maps of
+// the endpoints, with their labels when they are known
+func peerIdentities(policy *Policy, identities map[int64]*Identity) map[string][]string {
+	if policy == nil {
+		return nil
+	}
+
+	peers := make(map[string][]string)
+	for _, ids := range [][]int64{
+		policy.Ingress.AllowedIdentities, policy.Ingress.DeniedIdentities,
+		policy.Egress.AllowedIdentities, policy.Egress.DeniedIdentities,
+	} {
+		for _, id := range ids {
+			labels := []string{}
+			if identity, found := identities[id]; found && identity.Labels != nil {
+				labels = identity.Labels
+			}
+			peers[fmt.Sprintf("%d", id)] = labels
+		}
+	}
+
+	if len(peers) == 0 {
+		return nil
+	}
+	return peers
+}
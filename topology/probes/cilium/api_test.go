@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package cilium
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const endpointsJSON = `[{
+	"id": 1234,
+	"status": {
+		"state": "ready",
+		"identity": {"id": 5678, "labels": ["k8s:app=frontend"]},
+		"external-identifiers": {"container-id": "abcd", "pod-name": "default/frontend"},
+		"networking": {
+			"addressing": [{"ipv4": "10.0.0.5", "ipv6": "f00d::5"}],
+			"interface-name": "lxc1234",
+			"mac": "aa:bb:cc:dd:ee:ff",
+			"host-mac": "11:22:33:44:55:66"
+		},
+		"policy": {
+			"realized": {
+				"policy-enabled": "ingress",
+				"policy-revision": 7,
+				"allowed-ingress-identities": [9012, 2],
+				"allowed-egress-identities": []
+			}
+		}
+	}
+}]`
+
+const identitiesJSON = `[{"id": 9012, "labels": ["k8s:app=backend"]}]`
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/endpoint":
+			w.Write([]byte(endpointsJSON))
+		case "/v1/identity":
+			w.Write([]byte(identitiesJSON))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c, err := newClient("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := c.endpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != 1234 {
+		t.Fatalf("unexpected endpoints: %+v", endpoints)
+	}
+
+	identities, err := c.identities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := endpointMetadata(endpoints[0], identities)
+	if m.PodName != "default/frontend" || m.InterfaceName != "lxc1234" || m.MAC != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("unexpected endpoint metadata: %+v", m)
+	}
+	if !reflect.DeepEqual(m.IPV4, []string{"10.0.0.5"}) || !reflect.DeepEqual(m.IPV6, []string{"f00d::5"}) {
+		t.Errorf("unexpected addresses: %v %v", m.IPV4, m.IPV6)
+	}
+
+	expected := &Policy{
+		Revision: 7,
+		Ingress:  PolicyMap{Enforced: true, AllowedIdentities: []int64{2, 9012}},
+	}
+	if !reflect.DeepEqual(m.Policy, expected) {
+		t.Errorf("expected policy %+v, got %+v", expected, m.Policy)
+	}
+
+	peers := map[string][]string{"2": {}, "9012": {"k8s:app=backend"}}
+	if !reflect.DeepEqual(m.PeerIdentities, peers) {
+		t.Errorf("expected peer identities %v, got %v", peers, m.PeerIdentities)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "agent not ready", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c, err := newClient("tcp://" + strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.endpoints(context.Background()); err == nil || !strings.Contains(err.Error(), "agent not ready") {
+		t.Errorf("expected an error reporting the agent failure, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package cilium reports the endpoints managed by the Cilium agent running
+// on the host of the agent. Each endpoint is represented by a node holding
+// its security identity and the content of its eBPF policy maps, linked to
+// the veth interfaces of its datapath.
+package cilium
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Manager is the manager of the nodes created by the probe
+const Manager = "cilium"
+
+// RelationType of the links between the endpoints and their interfaces
+const RelationType = "cilium"
+
+// EndpointMetadata describes the Cilium metadata of an endpoint node
+type EndpointMetadata struct {
+	EndpointID     int64
+	State          string
+	Identity       *Identity
+	ContainerID    string `json:",omitempty"`
+	PodName        string `json:",omitempty"`
+	InterfaceName  string `json:",omitempty"`
+	MAC            string `json:",omitempty"`
+	IPV4           []string
+	IPV6           []string
+	Policy         *Policy
+	PeerIdentities map[string][]string `json:",omitempty"`
+}
+
+// Probe describes a probe polling the Cilium agent
+type Probe struct {
+	graph     *graph.Graph
+	root      *graph.Node
+	client    *client
+	interval  time.Duration
+	endpoints map[graph.Identifier]*EndpointMetadata
+	failed    bool
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func endpointMetadata(ep *Endpoint, identities map[int64]*Identity) *EndpointMetadata {
+	m := &EndpointMetadata{
+		EndpointID: ep.ID,
+		State:      ep.Status.State,
+		Identity:   ep.Status.Identity,
+		IPV4:       []string{},
+		IPV6:       []string{},
+		Policy:     policyOf(ep),
+	}
+	m.PeerIdentities = peerIdentities(m.Policy, identities)
+
+	if ids := ep.Status.ExternalIdentifiers; ids != nil {
+		m.ContainerID = ids["container-id"]
+		m.PodName = ids["pod-name"]
+	}
+
+	if networking := ep.Status.Networking; networking != nil {
+		m.InterfaceName = networking.InterfaceName
+		m.MAC = networking.MAC
+		for _, addr := range networking.Addressing {
+			if addr.IPV4 != "" {
+				m.IPV4 = append(m.IPV4, addr.IPV4)
+			}
+			if addr.IPV6 != "" {
+				m.IPV6 = append(m.IPV6, addr.IPV6)
+			}
+		}
+	}
+	return m
+}
+
+func (p *Probe) nodeName(m *EndpointMetadata) string {
+	if m.PodName != "" {
+		return m.PodName
+	}
+	return fmt.Sprintf("endpoint-%d", m.EndpointID)
+}
+
+// interfaces returns the interfaces of the datapath of an endpoint: the
+// container side veth, identified by the endpoint MAC address, and the host
+// side one, the graph lock being held
+func (p *Probe) interfaces(m *EndpointMetadata) map[graph.Identifier]*graph.Node {
+	nodes := make(map[graph.Identifier]*graph.Node)
+	if m.MAC != "" {
+		for _, n := range p.graph.GetNodes(graph.Metadata{"MAC": m.MAC, "Type": "veth"}) {
+			nodes[n.ID] = n
+		}
+	}
+	if m.InterfaceName != "" {
+		for _, n := range p.graph.LookupChildren(p.root, graph.Metadata{"Name": m.InterfaceName}, topology.OwnershipMetadata()) {
+			nodes[n.ID] = n
+		}
+	}
+	return nodes
+}
+
+// link links an endpoint node to its interfaces, removing the links to the
+// interfaces it does not use anymore
+func (p *Probe) link(node *graph.Node, m *EndpointMetadata) {
+	interfaces := p.interfaces(m)
+
+	for _, edge := range p.graph.GetNodeEdges(node, graph.Metadata{"RelationType": RelationType}) {
+		if _, found := interfaces[edge.Child]; !found {
+			p.graph.DelEdge(edge)
+		}
+	}
+
+	for _, intf := range interfaces {
+		if !topology.HaveLink(p.graph, node, intf, RelationType) {
+			if _, err := topology.AddLink(p.graph, node, intf, RelationType, nil); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+}
+
+func (p *Probe) update(ctx context.Context) {
+	endpoints, err := p.client.endpoints(ctx)
+
+	var identities map[int64]*Identity
+	if err == nil {
+		if identities, err = p.client.identities(ctx); err != nil {
+			logging.GetLogger().Debugf("Failed to retrieve the Cilium identities: %s", err)
+			err = nil
+		}
+	}
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.GetLogger().Errorf("Failed to retrieve the Cilium endpoints: %s", err)
+			topology.SetProbeError(p.graph, "cilium", err, p.root)
+			p.failed = true
+		}
+		return
+	}
+	if p.failed {
+		topology.ClearProbeError(p.graph, "cilium", p.root)
+		p.failed = false
+	}
+
+	updated := make(map[graph.Identifier]*EndpointMetadata)
+	for _, ep := range endpoints {
+		m := endpointMetadata(ep, identities)
+		id := graph.GenID(string(p.root.ID), "cilium", strconv.FormatInt(ep.ID, 10))
+		updated[id] = m
+
+		node := p.graph.GetNode(id)
+		if node == nil {
+			metadata := graph.Metadata{
+				"Type":    "cilium_endpoint",
+				"Manager": Manager,
+				"Name":    p.nodeName(m),
+				"Cilium":  m,
+			}
+
+			if node, err = p.graph.NewNode(id, metadata); err != nil {
+				logging.GetLogger().Error(err)
+				continue
+			}
+			if _, err = topology.AddOwnershipLink(p.graph, p.root, node, nil); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		} else if !reflect.DeepEqual(p.endpoints[id], m) {
+			tr := p.graph.StartMetadataTransaction(node)
+			tr.AddMetadata("Name", p.nodeName(m))
+			tr.AddMetadata("Cilium", m)
+			tr.Commit()
+		}
+
+		p.link(node, m)
+	}
+
+	for id := range p.endpoints {
+		if _, found := updated[id]; !found {
+			if node := p.graph.GetNode(id); node != nil {
+				p.graph.DelNode(node)
+			}
+		}
+	}
+	p.endpoints = updated
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.update(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// NewProbeFromConfig returns a new Cilium probe reporting the endpoints
+// of the Cilium agent running on the given host node
+func NewProbeFromConfig(g *graph.Graph, root *graph.Node) (*Probe, error) {
+	client, err := newClient(config.GetString("agent.topology.cilium.url"))
+	if err != nil {
+		return nil, err
+	}
+
+	interval := config.GetInt("agent.topology.cilium.interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid Cilium polling interval %d", interval)
+	}
+
+	return &Probe{
+		graph:     g,
+		root:      root,
+		client:    client,
+		interval:  time.Duration(interval) * time.Second,
+		endpoints: make(map[graph.Identifier]*EndpointMetadata),
+	}, nil
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package contrailconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+)
+
+// ref describes a reference between two objects of the config API
+type ref struct {
+	UUID string   `json:"uuid"`
+	To   []string `json:"to"`
+}
+
+type subnet struct {
+	IPPrefix    string `json:"ip_prefix"`
+	IPPrefixLen int    `json:"ip_prefix_len"`
+}
+
+type ipamRef struct {
+	Attr struct {
+		IPAMSubnets []struct {
+			Subnet         subnet `json:"subnet"`
+			DefaultGateway string `json:"default_gateway"`
+		} `json:"ipam_subnets"`
+	} `json:"attr"`
+}
+
+// virtualNetwork describes a virtual network, its routing instance being
+// named after its fully qualified name followed by its name
+type virtualNetwork struct {
+	UUID              string    `json:"uuid"`
+	FQName            []string  `json:"fq_name"`
+	DisplayName       string    `json:"display_name"`
+	NetworkID         int64     `json:"virtual_network_network_id"`
+	RouterExternal    bool      `json:"router_external"`
+	NetworkPolicyRefs []ref     `json:"network_policy_refs"`
+	NetworkIPAMRefs   []ipamRef `json:"network_ipam_refs"`
+	RouteTargetList   struct {
+		RouteTarget []string `json:"route_target"`
+	} `json:"route_target_list"`
+}
+
+type addressType struct {
+	VirtualNetwork string  `json:"virtual_network,omitempty"`
+	SecurityGroup  string  `json:"security_group,omitempty"`
+	Subnet         *subnet `json:"subnet,omitempty"`
+}
+
+type portType struct {
+	StartPort int `json:"start_port"`
+	EndPort   int `json:"end_port"`
+}
+
+type policyRule struct {
+	Direction  string        `json:"direction"`
+	Protocol   string        `json:"protocol"`
+	SrcAddress []addressType `json:"src_addresses"`
+	SrcPorts   []portType    `json:"src_ports"`
+	DstAddress []addressType `json:"dst_addresses"`
+	DstPorts   []portType    `json:"dst_ports"`
+	ActionList struct {
+		SimpleAction string `json:"simple_action"`
+	} `json:"action_list"`
+}
+
+// networkPolicy describes a network policy, applied to the virtual
+// networks referencing it
+type networkPolicy struct {
+	UUID                 string   `json:"uuid"`
+	FQName               []string `json:"fq_name"`
+	DisplayName          string   `json:"display_name"`
+	NetworkPolicyEntries struct {
+		PolicyRule []policyRule `json:"policy_rule"`
+	} `json:"network_policy_entries"`
+}
+
+// floatingIP describes a floating IP, its fully qualified name being the
+// one of its pool, itself made of the one of the virtual network
+type floatingIP struct {
+	UUID                        string   `json:"uuid"`
+	FQName                      []string `json:"fq_name"`
+	Address                     string   `json:"floating_ip_address"`
+	FixedIPAddress              string   `json:"floating_ip_fixed_ip_address"`
+	VirtualMachineInterfaceRefs []ref    `json:"virtual_machine_interface_refs"`
+}
+
+// configClient describes a client of the Contrail config API, authenticated
+// using Keystone when an authentication URL is given
+type configClient struct {
+	sync.Mutex
+	url        string
+	authOpts   *gophercloud.AuthOptions
+	token      string
+	httpClient *http.Client
+}
+
+func (c *configClient) authenticate() error {
+	provider, err := openstack.AuthenticatedClient(*c.authOpts)
+	if err != nil {
+		return fmt.Errorf("Keystone authentication failed: %s", err)
+	}
+	c.token = provider.TokenID
+	return nil
+}
+
+func (c *configClient) get(path string, v interface{}) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.authOpts != nil && c.token == "" {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+
+	for retry := true; ; retry = false {
+		req, err := http.NewRequest("GET", c.url+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if c.token != "" {
+			req.Header.Set("X-Auth-Token", c.token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		// the token expired, authenticate again once
+		if resp.StatusCode == http.StatusUnauthorized && c.authOpts != nil && retry {
+			resp.Body.Close()
+			if err := c.authenticate(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("Failed to get %s: %s", path, resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+}
+
+// list returns the objects of the given type, the config API wrapping the
+// list in the plural of the type and each object in its type
+func (c *configClient) list(typ, plural string, objects interface{}) error {
+	var resp map[string][]map[string]json.RawMessage
+	if err := c.get("/"+plural+"?detail=true", &resp); err != nil {
+		return err
+	}
+
+	var raws []json.RawMessage
+	for _, entry := range resp[plural] {
+		if raw, found := entry[typ]; found {
+			raws = append(raws, raw)
+		}
+	}
+
+	list, err := json.Marshal(raws)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(list, objects)
+}
+
+func newConfigClient(url string, authOpts *gophercloud.AuthOptions, timeout time.Duration) *configClient {
+	return &configClient{
+		url:        strings.TrimSuffix(url, "/"),
+		authOpts:   authOpts,
+		httpClient: &http.Client{Timeout: timeout},
+	}
+}
@@ -0,0 +1,407 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package contrailconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Relation types of the edges created by the probe
+const (
+	// policyLink links a network policy to the virtual networks it applies to
+	policyLink = "policy"
+	// routingInstanceLink links a virtual network to its VRF on the vrouters
+	routingInstanceLink = "routinginstance"
+	// memberLink links a virtual network to the interfaces of its VRF
+	memberLink = "member"
+	// floatingIPLink links a floating IP to the interfaces it is assigned to
+	floatingIPLink = "floatingip"
+)
+
+// Probe describes a probe reading the virtual networks, the network policies
+// and the floating IPs from the Contrail config API, reported as logical
+// nodes linked to the VRFs and the interfaces discovered by the vrouter
+// probe of the agents
+type Probe struct {
+	graph    *graph.Graph
+	client   *configClient
+	interval time.Duration
+	nodes    map[graph.Identifier]bool
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func nodeID(uuid string) graph.Identifier {
+	return graph.GenID("contrail", uuid)
+}
+
+func objectName(displayName string, fqName []string) string {
+	if displayName != "" {
+		return displayName
+	}
+	if len(fqName) > 0 {
+		return fqName[len(fqName)-1]
+	}
+	return ""
+}
+
+// routingInstanceName returns the name of the VRF of a virtual network, as
+// reported by the vrouter agent
+func routingInstanceName(fqName []string) string {
+	if len(fqName) == 0 {
+		return ""
+	}
+	return strings.Join(fqName, ":") + ":" + fqName[len(fqName)-1]
+}
+
+func formatAddress(a addressType) string {
+	switch {
+	case a.VirtualNetwork != "":
+		return a.VirtualNetwork
+	case a.SecurityGroup != "":
+		return "security-group:" + a.SecurityGroup
+	case a.Subnet != nil:
+		return fmt.Sprintf("%s/%d", a.Subnet.IPPrefix, a.Subnet.IPPrefixLen)
+	}
+	return "any"
+}
+
+func formatPorts(ports []portType) []string {
+	var ranges []string
+	for _, p := range ports {
+		switch {
+		case p.StartPort == -1:
+			ranges = append(ranges, "any")
+		case p.StartPort == p.EndPort:
+			ranges = append(ranges, strconv.Itoa(p.StartPort))
+		default:
+			ranges = append(ranges, fmt.Sprintf("%d-%d", p.StartPort, p.EndPort))
+		}
+	}
+	return ranges
+}
+
+func formatRules(rules []policyRule) []interface{} {
+	entries := make([]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		var src, dst []string
+		for _, a := range rule.SrcAddress {
+			src = append(src, formatAddress(a))
+		}
+		for _, a := range rule.DstAddress {
+			dst = append(dst, formatAddress(a))
+		}
+
+		entries = append(entries, map[string]interface{}{
+			"Action":    rule.ActionList.SimpleAction,
+			"Direction": rule.Direction,
+			"Protocol":  rule.Protocol,
+			"Src":       src,
+			"SrcPorts":  formatPorts(rule.SrcPorts),
+			"Dst":       dst,
+			"DstPorts":  formatPorts(rule.DstPorts),
+		})
+	}
+	return entries
+}
+
+func virtualNetworkMetadata(vn *virtualNetwork) graph.Metadata {
+	var subnets []string
+	for _, ref := range vn.NetworkIPAMRefs {
+		for _, s := range ref.Attr.IPAMSubnets {
+			subnets = append(subnets, fmt.Sprintf("%s/%d", s.Subnet.IPPrefix, s.Subnet.IPPrefixLen))
+		}
+	}
+
+	contrail := map[string]interface{}{
+		"UUID":            vn.UUID,
+		"FQName":          strings.Join(vn.FQName, ":"),
+		"NetworkID":       vn.NetworkID,
+		"RoutingInstance": routingInstanceName(vn.FQName),
+		"RouterExternal":  vn.RouterExternal,
+	}
+	if len(subnets) > 0 {
+		contrail["Subnets"] = subnets
+	}
+	if len(vn.RouteTargetList.RouteTarget) > 0 {
+		contrail["RouteTargets"] = vn.RouteTargetList.RouteTarget
+	}
+
+	return graph.Metadata{
+		"Name":     objectName(vn.DisplayName, vn.FQName),
+		"Type":     "virtualnetwork",
+		"Manager":  "opencontrail",
+		"Contrail": contrail,
+	}
+}
+
+func networkPolicyMetadata(np *networkPolicy) graph.Metadata {
+	return graph.Metadata{
+		"Name":    objectName(np.DisplayName, np.FQName),
+		"Type":    "networkpolicy",
+		"Manager": "opencontrail",
+		"Contrail": map[string]interface{}{
+			"UUID":   np.UUID,
+			"FQName": strings.Join(np.FQName, ":"),
+			"Rules":  formatRules(np.NetworkPolicyEntries.PolicyRule),
+		},
+	}
+}
+
+func floatingIPMetadata(fip *floatingIP) graph.Metadata {
+	contrail := map[string]interface{}{
+		"UUID":    fip.UUID,
+		"FQName":  strings.Join(fip.FQName, ":"),
+		"Address": fip.Address,
+	}
+	if len(fip.FQName) > 1 {
+		contrail["Pool"] = strings.Join(fip.FQName[:len(fip.FQName)-1], ":")
+	}
+	if fip.FixedIPAddress != "" {
+		contrail["FixedIPAddress"] = fip.FixedIPAddress
+	}
+
+	return graph.Metadata{
+		"Name":     fip.Address,
+		"Type":     "floatingip",
+		"Manager":  "opencontrail",
+		"Contrail": contrail,
+	}
+}
+
+// createOrUpdate creates a node or replaces the metadata of an existing one
+func (p *Probe) createOrUpdate(id graph.Identifier, m graph.Metadata) (*graph.Node, error) {
+	p.nodes[id] = true
+
+	node := p.graph.GetNode(id)
+	if node == nil {
+		return p.graph.NewNode(id, m)
+	}
+
+	tr := p.graph.StartMetadataTransaction(node)
+	for k, v := range m {
+		tr.AddMetadata(k, v)
+	}
+	tr.Commit()
+
+	return node, nil
+}
+
+// syncLinks links a node to the given children with edges of the relation
+// type, removing the edges to the other nodes
+func (p *Probe) syncLinks(parent *graph.Node, relationType string, children []*graph.Node) {
+	linked := make(map[graph.Identifier]bool)
+	for _, child := range children {
+		linked[child.ID] = true
+		if !topology.HaveLink(p.graph, parent, child, relationType) {
+			topology.AddLink(p.graph, parent, child, relationType, nil)
+		}
+	}
+
+	for _, edge := range p.graph.GetNodeEdges(parent, graph.Metadata{"RelationType": relationType}) {
+		if edge.Parent == parent.ID && !linked[edge.Child] {
+			p.graph.DelEdge(edge)
+		}
+	}
+}
+
+func (p *Probe) lookupContrail(key, value string) []*graph.Node {
+	return p.graph.GetNodes(graph.NewElementFilter(filters.NewTermStringFilter("Contrail."+key, value)))
+}
+
+// update reflects the objects of the config API in the graph, the nodes of
+// the objects that were removed being deleted. The graph lock must be held.
+func (p *Probe) update(vns []virtualNetwork, policies []networkPolicy, fips []floatingIP) {
+	previous := p.nodes
+	p.nodes = make(map[graph.Identifier]bool)
+
+	vnNodes := make(map[string]*graph.Node)
+	appliedTo := make(map[string][]*graph.Node)
+	for i := range vns {
+		vn := &vns[i]
+
+		node, err := p.createOrUpdate(nodeID(vn.UUID), virtualNetworkMetadata(vn))
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to create the node of virtual network %s: %s", vn.UUID, err)
+			continue
+		}
+		vnNodes[strings.Join(vn.FQName, ":")] = node
+
+		ri := routingInstanceName(vn.FQName)
+		p.syncLinks(node, routingInstanceLink, p.graph.GetNodes(graph.Metadata{"Type": "vrf", "Name": ri}))
+		p.syncLinks(node, memberLink, p.lookupContrail("VRF", ri))
+
+		for _, ref := range vn.NetworkPolicyRefs {
+			appliedTo[ref.UUID] = append(appliedTo[ref.UUID], node)
+		}
+	}
+
+	for i := range policies {
+		np := &policies[i]
+
+		node, err := p.createOrUpdate(nodeID(np.UUID), networkPolicyMetadata(np))
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to create the node of network policy %s: %s", np.UUID, err)
+			continue
+		}
+		p.syncLinks(node, policyLink, appliedTo[np.UUID])
+	}
+
+	pools := make(map[graph.Identifier][]*graph.Node)
+	for i := range fips {
+		fip := &fips[i]
+
+		node, err := p.createOrUpdate(nodeID(fip.UUID), floatingIPMetadata(fip))
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to create the node of floating IP %s: %s", fip.UUID, err)
+			continue
+		}
+
+		// the floating IPs are named after their pool, itself named after
+		// its virtual network
+		if len(fip.FQName) > 2 {
+			if vnNode := vnNodes[strings.Join(fip.FQName[:len(fip.FQName)-2], ":")]; vnNode != nil {
+				pools[vnNode.ID] = append(pools[vnNode.ID], node)
+			}
+		}
+
+		var intfs []*graph.Node
+		for _, ref := range fip.VirtualMachineInterfaceRefs {
+			intfs = append(intfs, p.lookupContrail("UUID", ref.UUID)...)
+		}
+		p.syncLinks(node, floatingIPLink, intfs)
+	}
+
+	for _, vnNode := range vnNodes {
+		p.syncLinks(vnNode, topology.OwnershipLink, pools[vnNode.ID])
+	}
+
+	for id := range previous {
+		if p.nodes[id] {
+			continue
+		}
+		if node := p.graph.GetNode(id); node != nil {
+			p.graph.DelNode(node)
+		}
+	}
+}
+
+func (p *Probe) poll() {
+	var (
+		vns      []virtualNetwork
+		policies []networkPolicy
+		fips     []floatingIP
+	)
+
+	if err := p.client.list("virtual-network", "virtual-networks", &vns); err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve the Contrail virtual networks: %s", err)
+		return
+	}
+	if err := p.client.list("network-policy", "network-policys", &policies); err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve the Contrail network policies: %s", err)
+		return
+	}
+	if err := p.client.list("floating-ip", "floating-ips", &fips); err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve the Contrail floating IPs: %s", err)
+		return
+	}
+
+	p.graph.Lock()
+	p.update(vns, policies, fips)
+	p.graph.Unlock()
+}
+
+func (p *Probe) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll()
+
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// NewProbe returns a new probe polling the Contrail config API at the given
+// URL every interval, authenticated using Keystone when authOpts is not nil
+func NewProbe(g *graph.Graph, url string, authOpts *gophercloud.AuthOptions, interval time.Duration) *Probe {
+	return &Probe{
+		graph:    g,
+		client:   newConfigClient(url, authOpts, 30*time.Second),
+		interval: interval,
+		nodes:    make(map[graph.Identifier]bool),
+		quit:     make(chan struct{}),
+	}
+}
+
+// NewProbeFromConfig returns a new Contrail config API probe based on the
+// configuration
+func NewProbeFromConfig(g *graph.Graph) (*Probe, error) {
+	url := config.GetString("analyzer.topology.contrail.url")
+	if url == "" {
+		return nil, fmt.Errorf("No Contrail config API URL defined")
+	}
+
+	interval := config.GetInt("analyzer.topology.contrail.interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid Contrail config API polling interval %d", interval)
+	}
+
+	var authOpts *gophercloud.AuthOptions
+	if authURL := config.GetString("analyzer.topology.contrail.auth_url"); authURL != "" {
+		authOpts = &gophercloud.AuthOptions{
+			IdentityEndpoint: authURL,
+			Username:         config.GetString("analyzer.topology.contrail.username"),
+			Password:         config.GetString("analyzer.topology.contrail.password"),
+			TenantName:       config.GetString("analyzer.topology.contrail.tenant_name"),
+			DomainName:       config.GetString("analyzer.topology.contrail.domain_name"),
+		}
+	}
+
+	return NewProbe(g, url, authOpts, time.Duration(interval)*time.Second), nil
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package contrailconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+const (
+	virtualNetworks = `{"virtual-networks": [{"virtual-network": {
+		"uuid": "vn1", "fq_name": ["default-domain", "admin", "net1"], "virtual_network_network_id": 4,
+		"network_policy_refs": [{"uuid": "np1", "to": ["default-domain", "admin", "policy1"]}],
+		"network_ipam_refs": [{"attr": {"ipam_subnets": [{"subnet": {"ip_prefix": "10.0.0.0", "ip_prefix_len": 24}}]}}]
+	}}]}`
+
+	networkPolicies = `{"network-policys": [{"network-policy": {
+		"uuid": "np1", "fq_name": ["default-domain", "admin", "policy1"],
+		"network_policy_entries": {"policy_rule": [{
+			"direction": "<>", "protocol": "tcp", "action_list": {"simple_action": "pass"},
+			"src_addresses": [{"virtual_network": "default-domain:admin:net1"}], "src_ports": [{"start_port": -1, "end_port": -1}],
+			"dst_addresses": [{"subnet": {"ip_prefix": "10.1.0.0", "ip_prefix_len": 16}}], "dst_ports": [{"start_port": 80, "end_port": 80}]
+		}]}
+	}}]}`
+
+	floatingIPs = `{"floating-ips": [{"floating-ip": {
+		"uuid": "fip1", "fq_name": ["default-domain", "admin", "net1", "pool1", "fip1"],
+		"floating_ip_address": "172.16.0.10", "virtual_machine_interface_refs": [{"uuid": "vmi1"}]
+	}}]}`
+)
+
+func newFakeConfigAPI(objects map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, found := objects[r.URL.Path]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func newGraph(t *testing.T) *graph.Graph {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph.NewGraph("testhost", b, common.AnalyzerService)
+}
+
+func TestProbe(t *testing.T) {
+	objects := map[string]string{
+		"/virtual-networks": virtualNetworks,
+		"/network-policys":  networkPolicies,
+		"/floating-ips":     floatingIPs,
+	}
+	server := newFakeConfigAPI(objects)
+	defer server.Close()
+
+	g := newGraph(t)
+	vrf, _ := g.NewNode(graph.GenID(), graph.Metadata{"Type": "vrf", "Name": "default-domain:admin:net1:net1"})
+	tap, _ := g.NewNode(graph.GenID(), graph.Metadata{"Type": "tun", "Contrail": map[string]interface{}{"UUID": "vmi1", "VRF": "default-domain:admin:net1:net1"}})
+
+	p := NewProbe(g, server.URL, nil, time.Minute)
+	p.poll()
+
+	vn := g.GetNode(nodeID("vn1"))
+	np := g.GetNode(nodeID("np1"))
+	fip := g.GetNode(nodeID("fip1"))
+	if vn == nil || np == nil || fip == nil {
+		t.Fatalf("Expected the virtual network, the policy and the floating IP nodes: %v", g.GetNodes(graph.Metadata{"Manager": "opencontrail"}))
+	}
+
+	if ri, _ := vn.GetFieldString("Contrail.RoutingInstance"); ri != "default-domain:admin:net1:net1" {
+		t.Errorf("Unexpected routing instance %s", ri)
+	}
+
+	rules, err := np.GetField("Contrail.Rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{map[string]interface{}{
+		"Action":    "pass",
+		"Direction": "<>",
+		"Protocol":  "tcp",
+		"Src":       []string{"default-domain:admin:net1"},
+		"SrcPorts":  []string{"any"},
+		"Dst":       []string{"10.1.0.0/16"},
+		"DstPorts":  []string{"80"},
+	}}
+	if !reflect.DeepEqual(rules, expected) {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+
+	links := []struct {
+		parent, child *graph.Node
+		relationType  string
+	}{
+		{vn, vrf, routingInstanceLink},
+		{vn, tap, memberLink},
+		{np, vn, policyLink},
+		{fip, tap, floatingIPLink},
+		{vn, fip, topology.OwnershipLink},
+	}
+	for _, link := range links {
+		if !topology.HaveLink(g, link.parent, link.child, link.relationType) {
+			t.Errorf("Expected a %s link", link.relationType)
+		}
+	}
+
+	// the floating IP is released and the policy removed
+	objects["/network-policys"] = `{"network-policys": []}`
+	objects["/floating-ips"] = `{"floating-ips": []}`
+	objects["/virtual-networks"] = `{"virtual-networks": [{"virtual-network": {"uuid": "vn1", "fq_name": ["default-domain", "admin", "net1"]}}]}`
+	p.poll()
+
+	if g.GetNode(nodeID("np1")) != nil || g.GetNode(nodeID("fip1")) != nil {
+		t.Error("Expected the policy and the floating IP nodes to be removed")
+	}
+	if !topology.HaveLink(g, vn, vrf, routingInstanceLink) {
+		t.Error("Expected the virtual network to stay linked to its VRF")
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c := newConfigClient(server.URL, nil, time.Second)
+
+	var vns []virtualNetwork
+	if err := c.list("virtual-network", "virtual-networks", &vns); err == nil {
+		t.Error("Expected an error")
+	}
+
+	// no authentication configured, no retry
+	if requests != 1 {
+		t.Errorf("Expected a single request, got %d", requests)
+	}
+}
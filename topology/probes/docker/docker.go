@@ -195,6 +195,10 @@ func (probe *Probe) connect() error {
 		return err
 	}
 
+	probe.Graph.Lock()
+	topology.ClearProbeError(probe.Graph, "docker", probe.Root)
+	probe.Graph.Unlock()
+
 	if probe.hostNs, err = netns.Get(); err != nil {
 		return err
 	}
@@ -262,7 +266,12 @@ func (probe *Probe) Start() {
 				break
 			}
 
-			if probe.connect() != nil {
+			if err := probe.connect(); err != nil {
+				if atomic.LoadInt64(&probe.state) == common.RunningState {
+					probe.Graph.Lock()
+					topology.SetProbeError(probe.Graph, "docker", err, probe.Root)
+					probe.Graph.Unlock()
+				}
 				time.Sleep(1 * time.Second)
 			}
 
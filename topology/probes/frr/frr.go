@@ -0,0 +1,279 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package frr reports the routing state of the FRRouting daemons running on
+// the host of the agent. The BGP and OSPF neighbors, the OSPF timers and
+// the routes learned by the routing protocols are read with vtysh and
+// written into the FRR metadata of the interfaces they are bound to, the
+// BGP neighbors being bound to the interface whose subnets include their
+// address.
+package frr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Probe describes a probe polling the FRRouting daemons
+type Probe struct {
+	graph     *graph.Graph
+	root      *graph.Node
+	vtysh     string
+	interval  time.Duration
+	maxRoutes int
+	states    map[graph.Identifier]*InterfaceState
+	failed    bool
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// run returns the JSON output of a vtysh command
+func (p *Probe) run(ctx context.Context, command string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, p.vtysh, "-c", command).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("'%s' failed: %s", command, exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("'%s' failed: %s", command, err)
+	}
+	return out, nil
+}
+
+// interfaceSubnets returns the interfaces of the host and their subnets,
+// the graph lock being held
+func (p *Probe) interfaceSubnets() (map[string]*graph.Node, map[string][]*net.IPNet) {
+	nodes := make(map[string]*graph.Node)
+	subnets := make(map[string][]*net.IPNet)
+
+	for _, n := range p.graph.LookupChildren(p.root, nil, topology.OwnershipMetadata()) {
+		name, _ := n.GetFieldString("Name")
+		if name == "" {
+			continue
+		}
+		nodes[name] = n
+		subnets[name] = []*net.IPNet{}
+
+		for _, key := range []string{"IPV4", "IPV6"} {
+			addrs, _ := n.GetFieldStringList(key)
+			for _, addr := range addrs {
+				if _, ipnet, err := net.ParseCIDR(addr); err == nil {
+					subnets[name] = append(subnets[name], ipnet)
+				}
+			}
+		}
+	}
+	return nodes, subnets
+}
+
+// dump reads the routing state of the interfaces from the daemons, the
+// protocols which are not running being ignored
+func (p *Probe) dump(ctx context.Context, subnets map[string][]*net.IPNet) (map[string]*InterfaceState, error) {
+	states := make(map[string]*InterfaceState)
+	state := func(name string) *InterfaceState {
+		if states[name] == nil {
+			states[name] = &InterfaceState{}
+		}
+		return states[name]
+	}
+
+	var errs []error
+	succeeded := 0
+	run := func(command string, parse func([]byte) error) {
+		out, err := p.run(ctx, command)
+		if err == nil {
+			if err = parse(out); err != nil {
+				err = fmt.Errorf("Failed to parse the output of '%s': %s", command, err)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		succeeded++
+	}
+
+	run("show bgp neighbors json", func(out []byte) error {
+		neighbors, err := parseBGPNeighbors(out)
+		for peer, neighbor := range neighbors {
+			name := interfaceOfAddress(neighbor.Address, subnets)
+			if name == "" {
+				// unnumbered neighbors are indexed by interface name
+				if _, found := subnets[peer]; !found {
+					continue
+				}
+				name = peer
+			}
+			state(name).BGP = append(state(name).BGP, *neighbor)
+		}
+		return err
+	})
+
+	run("show ip ospf interface json", func(out []byte) error {
+		interfaces, err := parseOSPFInterfaces(out)
+		for name, intf := range interfaces {
+			state(name).OSPF = intf
+		}
+		return err
+	})
+
+	run("show ip ospf neighbor json", func(out []byte) error {
+		neighbors, err := parseOSPFNeighbors(out)
+		for name, n := range neighbors {
+			if intf := states[name]; intf != nil && intf.OSPF != nil {
+				intf.OSPF.Neighbors = n
+			}
+		}
+		return err
+	})
+
+	for _, command := range []string{"show ip route json", "show ipv6 route json"} {
+		run(command, func(out []byte) error {
+			routes, err := parseRIB(out)
+			for name, r := range routes {
+				state(name).RIB = append(state(name).RIB, r...)
+			}
+			return err
+		})
+	}
+
+	// none of the daemons could be reached
+	if succeeded == 0 {
+		return nil, errs[0]
+	}
+	for _, err := range errs {
+		logging.GetLogger().Debugf("FRR state partially read: %s", err)
+	}
+
+	for _, s := range states {
+		s.RIBCount = len(s.RIB)
+		if p.maxRoutes > 0 && len(s.RIB) > p.maxRoutes {
+			s.RIB = s.RIB[:p.maxRoutes]
+		}
+	}
+	return states, nil
+}
+
+// update writes the routing state into the metadata of the interfaces,
+// only when it changed
+func (p *Probe) update(ctx context.Context) {
+	p.graph.RLock()
+	nodes, subnets := p.interfaceSubnets()
+	p.graph.RUnlock()
+
+	states, err := p.dump(ctx, subnets)
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.GetLogger().Errorf("Failed to read the FRR state: %s", err)
+			topology.SetProbeError(p.graph, "frr", err, p.root)
+			p.failed = true
+		}
+		return
+	}
+	if p.failed {
+		topology.ClearProbeError(p.graph, "frr", p.root)
+		p.failed = false
+	}
+
+	updated := make(map[graph.Identifier]*InterfaceState)
+	for name, state := range states {
+		node, found := nodes[name]
+		if !found || p.graph.GetNode(node.ID) == nil {
+			continue
+		}
+
+		updated[node.ID] = state
+		if !reflect.DeepEqual(p.states[node.ID], state) {
+			p.graph.AddMetadata(node, "FRR", state)
+		}
+	}
+
+	for id := range p.states {
+		if _, found := updated[id]; !found {
+			if node := p.graph.GetNode(id); node != nil {
+				p.graph.DelMetadata(node, "FRR")
+			}
+		}
+	}
+	p.states = updated
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.update(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// NewProbeFromConfig returns a new FRR probe reporting the routing state
+// of the interfaces of the given host node
+func NewProbeFromConfig(g *graph.Graph, root *graph.Node) (*Probe, error) {
+	vtysh, err := exec.LookPath(config.GetString("agent.topology.frr.vtysh_path"))
+	if err != nil {
+		return nil, err
+	}
+
+	interval := config.GetInt("agent.topology.frr.interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid FRR polling interval %d", interval)
+	}
+
+	return &Probe{
+		graph:     g,
+		root:      root,
+		vtysh:     vtysh,
+		interval:  time.Duration(interval) * time.Second,
+		maxRoutes: config.GetInt("agent.topology.frr.max_routes"),
+		states:    make(map[graph.Identifier]*InterfaceState),
+	}, nil
+}
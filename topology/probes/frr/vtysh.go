@@ -0,0 +1,316 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package frr
+
+import (
+	"encoding/json"
+	"net"
+	"sort"
+	"strings"
+)
+
+// BGPNeighbor describes a BGP session, the timers being in milliseconds
+type BGPNeighbor struct {
+	Address           string
+	RemoteAS          int64
+	LocalAS           int64  `json:",omitempty"`
+	Hostname          string `json:",omitempty"`
+	State             string
+	UpTime            int64 `json:",omitempty"`
+	HoldTime          int64 `json:",omitempty"`
+	KeepaliveInterval int64 `json:",omitempty"`
+	PrefixesReceived  int64
+}
+
+// OSPFNeighbor describes an OSPF adjacency, its dead timer being in
+// milliseconds
+type OSPFNeighbor struct {
+	RouterID string
+	Address  string
+	State    string
+	Priority int64
+	DeadTime int64 `json:",omitempty"`
+}
+
+// OSPFInterface describes the OSPF state of an interface, the timers
+// being in seconds
+type OSPFInterface struct {
+	Area               string
+	Cost               int64
+	State              string         `json:",omitempty"`
+	HelloInterval      int64          `json:",omitempty"`
+	DeadInterval       int64          `json:",omitempty"`
+	RetransmitInterval int64          `json:",omitempty"`
+	TransmitDelay      int64          `json:",omitempty"`
+	Neighbors          []OSPFNeighbor `json:",omitempty"`
+}
+
+// Route describes a route learned by a routing protocol
+type Route struct {
+	Prefix   string
+	Protocol string
+	Nexthop  string `json:",omitempty"`
+	Distance int64
+	Metric   int64
+	Selected bool
+	UpTime   string `json:",omitempty"`
+}
+
+// InterfaceState holds the routing state of an interface, reported in its
+// FRR metadata
+type InterfaceState struct {
+	BGP      []BGPNeighbor  `json:",omitempty"`
+	OSPF     *OSPFInterface `json:",omitempty"`
+	RIB      []Route        `json:",omitempty"`
+	RIBCount int            `json:",omitempty"`
+}
+
+// Protocols of the routes which are not learned
+var unlearnedProtocols = map[string]bool{
+	"connected": true,
+	"kernel":    true,
+	"local":     true,
+	"static":    true,
+}
+
+func jsonInt64(v interface{}) int64 {
+	if f, ok := v.(float64); ok {
+		return int64(f)
+	}
+	return 0
+}
+
+func jsonString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// bgpNeighbor is a neighbor of "show bgp neighbors json", the unnumbered
+// neighbors being indexed by interface name
+type bgpNeighbor struct {
+	RemoteAs                       int64  `json:"remoteAs"`
+	LocalAs                        int64  `json:"localAs"`
+	Hostname                       string `json:"hostname"`
+	BgpState                       string `json:"bgpState"`
+	BgpNeighborAddr                string `json:"bgpNeighborAddr"`
+	BgpTimerUpMsec                 int64  `json:"bgpTimerUpMsec"`
+	BgpTimerHoldTimeMsecs          int64  `json:"bgpTimerHoldTimeMsecs"`
+	BgpTimerKeepAliveIntervalMsecs int64  `json:"bgpTimerKeepAliveIntervalMsecs"`
+	AddressFamilyInfo              map[string]struct {
+		AcceptedPrefixCounter int64 `json:"acceptedPrefixCounter"`
+	} `json:"addressFamilyInfo"`
+}
+
+// parseBGPNeighbors returns the BGP neighbors indexed by the address or the
+// interface name used to establish the session
+func parseBGPNeighbors(data []byte) (map[string]*BGPNeighbor, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	neighbors := make(map[string]*BGPNeighbor)
+	for peer, msg := range raw {
+		var n bgpNeighbor
+		// skip the fields which are not neighbors
+		if err := json.Unmarshal(msg, &n); err != nil || n.BgpState == "" {
+			continue
+		}
+
+		neighbor := &BGPNeighbor{
+			Address:           peer,
+			RemoteAS:          n.RemoteAs,
+			LocalAS:           n.LocalAs,
+			Hostname:          n.Hostname,
+			State:             n.BgpState,
+			UpTime:            n.BgpTimerUpMsec,
+			HoldTime:          n.BgpTimerHoldTimeMsecs,
+			KeepaliveInterval: n.BgpTimerKeepAliveIntervalMsecs,
+		}
+		if n.BgpNeighborAddr != "" {
+			neighbor.Address = n.BgpNeighborAddr
+		}
+		for _, af := range n.AddressFamilyInfo {
+			neighbor.PrefixesReceived += af.AcceptedPrefixCounter
+		}
+		neighbors[peer] = neighbor
+	}
+	return neighbors, nil
+}
+
+// parseOSPFNeighbors returns the OSPF neighbors of "show ip ospf neighbor
+// json" indexed by interface name
+func parseOSPFNeighbors(data []byte) (map[string][]OSPFNeighbor, error) {
+	var raw struct {
+		Neighbors map[string][]map[string]interface{} `json:"neighbors"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	neighbors := make(map[string][]OSPFNeighbor)
+	for routerID, adjacencies := range raw.Neighbors {
+		for _, a := range adjacencies {
+			state := jsonString(a["state"])
+			if state == "" {
+				state = jsonString(a["nbrState"])
+			}
+			address := jsonString(a["address"])
+			if address == "" {
+				address = jsonString(a["ifaceAddress"])
+			}
+
+			// the interface name is followed by its address
+			ifName := jsonString(a["ifaceName"])
+			if i := strings.IndexByte(ifName, ':'); i >= 0 {
+				ifName = ifName[:i]
+			}
+
+			neighbors[ifName] = append(neighbors[ifName], OSPFNeighbor{
+				RouterID: routerID,
+				Address:  address,
+				State:    state,
+				Priority: jsonInt64(a["priority"]),
+				DeadTime: jsonInt64(a["deadTimeMsecs"]),
+			})
+		}
+	}
+
+	for _, n := range neighbors {
+		sort.Slice(n, func(i, j int) bool { return n[i].RouterID < n[j].RouterID })
+	}
+	return neighbors, nil
+}
+
+// parseOSPFInterfaces returns the OSPF interfaces of "show ip ospf interface
+// json", the interfaces being at the top level with the older versions
+func parseOSPFInterfaces(data []byte) (map[string]*OSPFInterface, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if wrapped, ok := raw["interfaces"]; ok {
+		raw = nil
+		if err := json.Unmarshal(wrapped, &raw); err != nil {
+			return nil, err
+		}
+	}
+
+	interfaces := make(map[string]*OSPFInterface)
+	for name, msg := range raw {
+		var i map[string]interface{}
+		if err := json.Unmarshal(msg, &i); err != nil {
+			continue
+		}
+
+		// skip the interfaces on which OSPF is not enabled
+		area := jsonString(i["area"])
+		if area == "" {
+			continue
+		}
+
+		interfaces[name] = &OSPFInterface{
+			Area:               area,
+			Cost:               jsonInt64(i["cost"]),
+			State:              jsonString(i["state"]),
+			HelloInterval:      jsonInt64(i["timerMsecs"]) / 1000,
+			DeadInterval:       jsonInt64(i["timerDeadSecs"]),
+			RetransmitInterval: jsonInt64(i["timerRetransmitSecs"]),
+			TransmitDelay:      jsonInt64(i["transmitDelaySecs"]),
+		}
+	}
+	return interfaces, nil
+}
+
+type ribEntry struct {
+	Prefix   string `json:"prefix"`
+	Protocol string `json:"protocol"`
+	Selected bool   `json:"selected"`
+	Distance int64  `json:"distance"`
+	Metric   int64  `json:"metric"`
+	Uptime   string `json:"uptime"`
+	Nexthops []struct {
+		IP            string `json:"ip"`
+		InterfaceName string `json:"interfaceName"`
+		Active        bool   `json:"active"`
+	} `json:"nexthops"`
+}
+
+// parseRIB returns the routes of "show ip route json" learned by a routing
+// protocol, indexed by the interface of their active nexthops
+func parseRIB(data []byte) (map[string][]Route, error) {
+	var raw map[string][]ribEntry
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string][]Route)
+	for prefix, entries := range raw {
+		for _, e := range entries {
+			if unlearnedProtocols[e.Protocol] {
+				continue
+			}
+			if e.Prefix == "" {
+				e.Prefix = prefix
+			}
+
+			for _, nh := range e.Nexthops {
+				if !nh.Active || nh.InterfaceName == "" {
+					continue
+				}
+				routes[nh.InterfaceName] = append(routes[nh.InterfaceName], Route{
+					Prefix:   e.Prefix,
+					Protocol: e.Protocol,
+					Nexthop:  nh.IP,
+					Distance: e.Distance,
+					Metric:   e.Metric,
+					Selected: e.Selected,
+					UpTime:   e.Uptime,
+				})
+			}
+		}
+	}
+
+	for _, r := range routes {
+		sort.Slice(r, func(i, j int) bool {
+			if r[i].Prefix != r[j].Prefix {
+				return r[i].Prefix < r[j].Prefix
+			}
+			return r[i].Nexthop < r[j].Nexthop
+		})
+	}
+	return routes, nil
+}
+
+// interfaceOfAddress returns the name of the interface whose subnets
+// include the given address
+func interfaceOfAddress(addr string, subnets map[string][]*net.IPNet) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+
+	for name, nets := range subnets {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package frr
+
+import (
+	"net"
+	"testing"
+)
+
+const bgpNeighbors = `{
+  "10.0.0.2": {
+    "remoteAs": 65002,
+    "localAs": 65001,
+    "hostname": "spine1",
+    "bgpState": "Established",
+    "bgpTimerUpMsec": 120000,
+    "bgpTimerHoldTimeMsecs": 9000,
+    "bgpTimerKeepAliveIntervalMsecs": 3000,
+    "addressFamilyInfo": {
+      "ipv4Unicast": {"acceptedPrefixCounter": 12},
+      "ipv6Unicast": {"acceptedPrefixCounter": 3}
+    }
+  },
+  "swp2": {
+    "remoteAs": 65003,
+    "bgpState": "Active",
+    "bgpNeighborAddr": "fe80::2"
+  }
+}`
+
+const ospfInterfaces = `{
+  "interfaces": {
+    "eth0": {"area": "0.0.0.0", "cost": 10, "state": "DR", "timerMsecs": 10000,
+             "timerDeadSecs": 40, "timerRetransmitSecs": 5, "transmitDelaySecs": 1},
+    "lo": {"ifUp": true}
+  }
+}`
+
+const ospfNeighbors = `{
+  "neighbors": {
+    "2.2.2.2": [{"priority": 1, "state": "Full/Backup", "deadTimeMsecs": 33000,
+                 "address": "10.0.0.2", "ifaceName": "eth0:10.0.0.1"}]
+  }
+}`
+
+const rib = `{
+  "192.168.1.0/24": [{"prefix": "192.168.1.0/24", "protocol": "bgp", "selected": true,
+    "distance": 20, "metric": 0, "uptime": "00:02:00",
+    "nexthops": [{"ip": "10.0.0.2", "interfaceName": "eth0", "active": true}]}],
+  "10.0.0.0/24": [{"prefix": "10.0.0.0/24", "protocol": "connected", "selected": true,
+    "nexthops": [{"interfaceName": "eth0", "active": true}]}],
+  "172.16.0.0/16": [{"prefix": "172.16.0.0/16", "protocol": "ospf", "selected": false,
+    "distance": 110, "metric": 20,
+    "nexthops": [{"ip": "10.0.0.2", "interfaceName": "eth0", "active": false}]}]
+}`
+
+func TestParseBGPNeighbors(t *testing.T) {
+	neighbors, err := parseBGPNeighbors([]byte(bgpNeighbors))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := neighbors["10.0.0.2"]
+	if n == nil || n.RemoteAS != 65002 || n.State != "Established" || n.HoldTime != 9000 || n.PrefixesReceived != 15 {
+		t.Fatalf("Wrong BGP neighbor: %+v", n)
+	}
+
+	if n := neighbors["swp2"]; n == nil || n.Address != "fe80::2" || n.State != "Active" {
+		t.Fatalf("Wrong unnumbered BGP neighbor: %+v", n)
+	}
+
+	_, subnet, _ := net.ParseCIDR("10.0.0.1/24")
+	subnets := map[string][]*net.IPNet{"eth0": {subnet}, "swp2": {}}
+	if name := interfaceOfAddress("10.0.0.2", subnets); name != "eth0" {
+		t.Errorf("Expected the neighbor to be bound to eth0, got '%s'", name)
+	}
+	if name := interfaceOfAddress("10.0.1.2", subnets); name != "" {
+		t.Errorf("Expected the neighbor not to be bound, got '%s'", name)
+	}
+}
+
+func TestParseOSPF(t *testing.T) {
+	interfaces, err := parseOSPFInterfaces([]byte(ospfInterfaces))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(interfaces) != 1 {
+		t.Fatalf("Expected only the OSPF enabled interfaces, got %v", interfaces)
+	}
+	if i := interfaces["eth0"]; i == nil || i.Area != "0.0.0.0" || i.HelloInterval != 10 || i.DeadInterval != 40 {
+		t.Fatalf("Wrong OSPF interface: %+v", i)
+	}
+
+	neighbors, err := parseOSPFNeighbors([]byte(ospfNeighbors))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := neighbors["eth0"]; len(n) != 1 || n[0].RouterID != "2.2.2.2" || n[0].State != "Full/Backup" || n[0].DeadTime != 33000 {
+		t.Fatalf("Wrong OSPF neighbors: %+v", neighbors)
+	}
+}
+
+func TestParseRIB(t *testing.T) {
+	routes, err := parseRIB([]byte(rib))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := routes["eth0"]
+	if len(r) != 1 || r[0].Prefix != "192.168.1.0/24" || r[0].Protocol != "bgp" || r[0].Nexthop != "10.0.0.2" || !r[0].Selected {
+		t.Fatalf("Expected only the active learned routes, got %+v", r)
+	}
+}
@@ -0,0 +1,508 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gnmi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+const (
+	subscribeMethod = "/gnmi.gNMI/Subscribe"
+	dialTimeout     = 10 * time.Second
+	retryDelay      = 5 * time.Second
+)
+
+// LLDP chassis and port ID subtypes of the OpenConfig identities, as
+// defined by IEEE 802.1AB
+var (
+	chassisIDTypes = map[string]layers.LLDPChassisIDSubType{
+		"CHASSIS_COMPONENT": 1,
+		"INTERFACE_ALIAS":   2,
+		"PORT_COMPONENT":    3,
+		"MAC_ADDRESS":       4,
+		"NETWORK_ADDRESS":   5,
+		"INTERFACE_NAME":    6,
+		"LOCAL":             7,
+	}
+	portIDTypes = map[string]layers.LLDPPortIDSubtype{
+		"INTERFACE_ALIAS":  1,
+		"PORT_COMPONENT":   2,
+		"MAC_ADDRESS":      3,
+		"NETWORK_ADDRESS":  4,
+		"INTERFACE_NAME":   5,
+		"AGENT_CIRCUIT_ID": 6,
+		"LOCAL":            7,
+	}
+)
+
+// counters maps the OpenConfig interface counters to the interface metric
+var counters = map[string]func(m *topology.InterfaceMetric, v int64){
+	"in-octets":          func(m *topology.InterfaceMetric, v int64) { m.RxBytes = v },
+	"out-octets":         func(m *topology.InterfaceMetric, v int64) { m.TxBytes = v },
+	"in-unicast-pkts":    func(m *topology.InterfaceMetric, v int64) { m.RxPackets += v },
+	"in-multicast-pkts":  func(m *topology.InterfaceMetric, v int64) { m.RxPackets += v; m.Multicast = v },
+	"in-broadcast-pkts":  func(m *topology.InterfaceMetric, v int64) { m.RxPackets += v },
+	"out-unicast-pkts":   func(m *topology.InterfaceMetric, v int64) { m.TxPackets += v },
+	"out-multicast-pkts": func(m *topology.InterfaceMetric, v int64) { m.TxPackets += v },
+	"out-broadcast-pkts": func(m *topology.InterfaceMetric, v int64) { m.TxPackets += v },
+	"in-discards":        func(m *topology.InterfaceMetric, v int64) { m.RxDropped = v },
+	"out-discards":       func(m *topology.InterfaceMetric, v int64) { m.TxDropped = v },
+	"in-errors":          func(m *topology.InterfaceMetric, v int64) { m.RxErrors = v },
+	"out-errors":         func(m *topology.InterfaceMetric, v int64) { m.TxErrors = v },
+	"in-fcs-errors":      func(m *topology.InterfaceMetric, v int64) { m.RxCrcErrors = v },
+}
+
+// target describes a device streaming its telemetry
+type target struct {
+	address string
+	host    string
+	state   *deviceState
+}
+
+// Probe describes a probe subscribing to the gNMI telemetry streams of the
+// network devices. The devices, their interfaces with their counters and
+// their LLDP neighbors are added to the graph with the IDs the LLDP probe
+// would use.
+type Probe struct {
+	graph          *graph.Graph
+	targets        []*target
+	username       string
+	password       string
+	tlsConfig      *tls.Config
+	encoding       Encoding
+	sampleInterval time.Duration
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+}
+
+func (p *Probe) subscribeRequest() (*SubscribeRequest, error) {
+	subscriptions := []struct {
+		path string
+		mode SubscriptionMode
+	}{
+		{"/system/state/hostname", SubscriptionMode_ON_CHANGE},
+		{"/interfaces/interface/state", SubscriptionMode_SAMPLE},
+		{"/interfaces/interface/ethernet/state/mac-address", SubscriptionMode_ON_CHANGE},
+		{"/lldp/interfaces/interface/neighbors/neighbor/state", SubscriptionMode_ON_CHANGE},
+	}
+
+	list := &SubscriptionList{Mode: SubscriptionList_STREAM, Encoding: p.encoding}
+	for _, s := range subscriptions {
+		path, err := ParsePath(s.path)
+		if err != nil {
+			return nil, err
+		}
+
+		subscription := &Subscription{Path: path, Mode: s.mode}
+		if s.mode == SubscriptionMode_SAMPLE {
+			subscription.SampleInterval = uint64(p.sampleInterval.Nanoseconds())
+		}
+		list.Subscription = append(list.Subscription, subscription)
+	}
+
+	return &SubscribeRequest{Request: &SubscribeRequest_Subscribe{Subscribe: list}}, nil
+}
+
+func (p *Probe) getOrCreate(id graph.Identifier, m graph.Metadata) (*graph.Node, error) {
+	if node := p.graph.GetNode(id); node != nil {
+		return node, nil
+	}
+	return p.graph.NewNode(id, m)
+}
+
+// createOrUpdate creates a node or updates the metadata of an existing one,
+// the latter being possibly created by the LLDP probe of an agent
+func (p *Probe) createOrUpdate(id graph.Identifier, m graph.Metadata) (*graph.Node, error) {
+	node := p.graph.GetNode(id)
+	if node == nil {
+		return p.graph.NewNode(id, m)
+	}
+
+	tr := p.graph.StartMetadataTransaction(node)
+	for k, v := range m {
+		if k != "Probe" {
+			tr.AddMetadata(k, v)
+		}
+	}
+	tr.Commit()
+
+	return node, nil
+}
+
+func (p *Probe) linkPort(chassis, port *graph.Node) {
+	if !topology.HaveOwnershipLink(p.graph, chassis, port) {
+		topology.AddOwnershipLink(p.graph, chassis, port, nil)
+		topology.AddLayer2Link(p.graph, chassis, port, nil)
+	}
+}
+
+// interfaceMetric returns the metric of an interface from its counters
+func interfaceMetric(l leaves, now time.Time) *topology.InterfaceMetric {
+	metric := &topology.InterfaceMetric{}
+	for name, set := range counters {
+		if v, ok := toInt64(l["state/counters/"+name]); ok {
+			set(metric, v)
+		}
+	}
+
+	if metric.IsZero() {
+		return nil
+	}
+	metric.Last = int64(common.UnixMillis(now))
+	return metric
+}
+
+// portMetadata returns the metadata of the node of an interface, with its
+// metrics computed against the previous ones of the node
+func portMetadata(t *target, name string, intf *interfaceState, node *graph.Node, now time.Time) graph.Metadata {
+	state := "DOWN"
+	if toIdentity(intf.leaves["state/oper-status"]) == "UP" {
+		state = "UP"
+	}
+
+	gnmi := map[string]interface{}{
+		"Target": t.address,
+	}
+	if ifType := toIdentity(intf.leaves["state/type"]); ifType != "" {
+		gnmi["IfType"] = ifType
+	}
+	if adminStatus := toIdentity(intf.leaves["state/admin-status"]); adminStatus != "" {
+		gnmi["AdminStatus"] = adminStatus
+	}
+
+	m := graph.Metadata{
+		"Name":  name,
+		"Type":  "switchport",
+		"Probe": "gnmi",
+		"State": state,
+		"GNMI":  gnmi,
+	}
+	if mtu, ok := toInt64(intf.leaves["state/mtu"]); ok {
+		m["MTU"] = mtu
+	}
+	if ifIndex, ok := toInt64(intf.leaves["state/ifindex"]); ok {
+		m["IfIndex"] = ifIndex
+	}
+	if mac := toString(intf.leaves["ethernet/state/mac-address"]); mac != "" {
+		m["MAC"] = strings.ToLower(mac)
+	}
+	if description := toString(intf.leaves["state/description"]); description != "" {
+		gnmi["Description"] = description
+	}
+
+	// the metrics are only updated when the counters changed
+	if metric := interfaceMetric(intf.leaves, now); metric != nil {
+		var prevMetric *topology.InterfaceMetric
+		if node != nil {
+			if prev, err := node.GetField("Metric"); err == nil {
+				prevMetric, _ = prev.(*topology.InterfaceMetric)
+			}
+		}
+
+		if prevMetric == nil {
+			m["Metric"] = metric
+		} else if lastUpdateMetric := metric.Sub(prevMetric).(*topology.InterfaceMetric); !lastUpdateMetric.IsZero() {
+			lastUpdateMetric.Start = prevMetric.Last
+			lastUpdateMetric.Last = metric.Last
+			m["Metric"] = metric
+			m["LastUpdateMetric"] = lastUpdateMetric
+		}
+	}
+
+	return m
+}
+
+// updateNeighbor links an interface to its LLDP neighbor
+func (p *Probe) updateNeighbor(port *graph.Node, neighbor leaves) error {
+	chassisID := toString(neighbor["state/chassis-id"])
+	portID := toString(neighbor["state/port-id"])
+	if chassisID == "" || portID == "" {
+		return nil
+	}
+
+	chassisIDSubtype := chassisIDTypes[toIdentity(neighbor["state/chassis-id-type"])]
+	if chassisIDSubtype == layers.LLDPChassisIDSubTypeMACAddr {
+		chassisID = strings.ToLower(chassisID)
+	}
+
+	chassisIDType := chassisIDSubtype.String()
+	portIDType := portIDTypes[toIdentity(neighbor["state/port-id-type"])].String()
+	sysName := toString(neighbor["state/system-name"])
+	mgmtAddress := toString(neighbor["state/management-address"])
+
+	chassisName := sysName
+	if chassisName == "" {
+		chassisName = chassisID
+	}
+
+	lldp := map[string]interface{}{
+		"ChassisID":     chassisID,
+		"ChassisIDType": chassisIDType,
+	}
+	if sysName != "" {
+		lldp["SysName"] = sysName
+	}
+	if mgmtAddress != "" {
+		lldp["MgmtAddress"] = mgmtAddress
+	}
+
+	remoteChassis, err := p.getOrCreate(topology.LLDPChassisID(sysName, mgmtAddress, chassisID, chassisIDType), graph.Metadata{
+		"Name":  chassisName,
+		"Type":  "switch",
+		"Probe": "gnmi",
+		"LLDP":  lldp,
+	})
+	if err != nil {
+		return err
+	}
+
+	remotePort, err := p.getOrCreate(topology.LLDPPortID(remoteChassis.ID, portID, portIDType), graph.Metadata{
+		"Name":  portID,
+		"Type":  "switchport",
+		"Probe": "gnmi",
+		"LLDP": map[string]interface{}{
+			"PortID":     portID,
+			"PortIDType": portIDType,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.linkPort(remoteChassis, remotePort)
+
+	if !topology.HaveLayer2Link(p.graph, port, remotePort) {
+		topology.AddLayer2Link(p.graph, port, remotePort, nil)
+	}
+
+	return nil
+}
+
+// updateTarget reflects the telemetry of a device in the graph, the caller
+// must hold the graph lock
+func (p *Probe) updateTarget(t *target, now time.Time) error {
+	name := t.state.hostname
+	if name == "" {
+		name = t.host
+	}
+
+	chassis, err := p.createOrUpdate(topology.LLDPChassisID(t.state.hostname, t.host, "", ""), graph.Metadata{
+		"Name":  name,
+		"Type":  "switch",
+		"Probe": "gnmi",
+		"GNMI": map[string]interface{}{
+			"Target": t.address,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	portIDType := layers.LLDPPortIDSubtypeIfaceName.String()
+	for ifName, intf := range t.state.interfaces {
+		id := topology.LLDPPortID(chassis.ID, ifName, portIDType)
+
+		port, err := p.createOrUpdate(id, portMetadata(t, ifName, intf, p.graph.GetNode(id), now))
+		if err != nil {
+			return err
+		}
+		p.linkPort(chassis, port)
+
+		for _, neighbor := range intf.neighbors {
+			if err := p.updateNeighbor(port, neighbor); err != nil {
+				return err
+			}
+		}
+	}
+
+	// remove the interfaces that disappeared
+	for _, port := range p.graph.LookupChildren(chassis, graph.Metadata{"Type": "switchport", "Probe": "gnmi"}, topology.OwnershipMetadata()) {
+		address, _ := port.GetFieldString("GNMI.Target")
+		ifName, _ := port.GetFieldString("Name")
+		if address == t.address && t.state.interfaces[ifName] == nil {
+			p.graph.DelNode(port)
+		}
+	}
+
+	return nil
+}
+
+func (p *Probe) handleResponse(t *target, response *SubscribeResponse, synced *bool) error {
+	switch {
+	case response.GetSyncResponse():
+		*synced = true
+	case response.GetUpdate() != nil:
+		if err := t.state.applyNotification(response.GetUpdate()); err != nil {
+			return err
+		}
+	case response.GetError() != nil:
+		return fmt.Errorf("%s (code %d)", response.GetError().Message, response.GetError().Code)
+	default:
+		return nil
+	}
+
+	// wait for the initial state to be received before updating the graph
+	if !*synced {
+		return nil
+	}
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	return p.updateTarget(t, time.Now().UTC())
+}
+
+func (p *Probe) subscribe(ctx context.Context, t *target) error {
+	opts := []grpc.DialOption{grpc.WithBlock()}
+	if p.tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(p.tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	conn, err := grpc.DialContext(dialCtx, t.address, opts...)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if p.username != "" {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("username", p.username, "password", p.password))
+	}
+
+	request, err := p.subscribeRequest()
+	if err != nil {
+		return err
+	}
+
+	desc := &grpc.StreamDesc{StreamName: "Subscribe", ServerStreams: true, ClientStreams: true}
+	stream, err := grpc.NewClientStream(ctx, desc, conn, subscribeMethod)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(request); err != nil {
+		return err
+	}
+
+	logging.GetLogger().Infof("Subscribed to the gNMI telemetry of %s", t.address)
+
+	var synced bool
+	for {
+		response := &SubscribeResponse{}
+		if err := stream.RecvMsg(response); err != nil {
+			return err
+		}
+
+		if err := p.handleResponse(t, response, &synced); err != nil {
+			logging.GetLogger().Errorf("Failed to handle the gNMI telemetry of %s: %s", t.address, err)
+		}
+	}
+}
+
+func (p *Probe) run(ctx context.Context, t *target) {
+	defer p.wg.Done()
+
+	for {
+		t.state = newDeviceState()
+		if err := p.subscribe(ctx, t); err != nil && ctx.Err() == nil {
+			logging.GetLogger().Errorf("gNMI subscription to %s failed: %s", t.address, err)
+		}
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for _, t := range p.targets {
+		p.wg.Add(1)
+		go p.run(ctx, t)
+	}
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// NewProbeFromConfig returns a new gNMI probe subscribing to the targets
+// listed in the configuration
+func NewProbeFromConfig(g *graph.Graph) (*Probe, error) {
+	encoding, found := Encoding_value[strings.ToUpper(config.GetString("analyzer.topology.gnmi.encoding"))]
+	if !found {
+		return nil, fmt.Errorf("Unsupported gNMI encoding %s", config.GetString("analyzer.topology.gnmi.encoding"))
+	}
+
+	p := &Probe{
+		graph:          g,
+		username:       config.GetString("analyzer.topology.gnmi.username"),
+		password:       config.GetString("analyzer.topology.gnmi.password"),
+		encoding:       Encoding(encoding),
+		sampleInterval: time.Duration(config.GetInt("analyzer.topology.gnmi.sample_interval")) * time.Second,
+	}
+
+	if config.GetBool("analyzer.topology.gnmi.tls") {
+		p.tlsConfig = &tls.Config{InsecureSkipVerify: config.GetBool("analyzer.topology.gnmi.skip_verify")}
+		if caCert := config.GetString("analyzer.topology.gnmi.ca_cert"); caCert != "" {
+			rootCAs, err := common.SetupTLSLoadCA(caCert)
+			if err != nil {
+				return nil, err
+			}
+			p.tlsConfig.RootCAs = rootCAs
+		}
+	}
+
+	for _, address := range config.GetStringSlice("analyzer.topology.gnmi.targets") {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid gNMI target %s: %s", address, err)
+		}
+		p.targets = append(p.targets, &target{address: address, host: host})
+	}
+
+	return p, nil
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gnmi
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParsePath(t *testing.T, s string) *Path {
+	path, err := ParsePath(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParsePath(t *testing.T) {
+	path := mustParsePath(t, "/interfaces/interface[name=Ethernet1/1]/state/counters")
+	if len(path.Elem) != 4 {
+		t.Fatalf("Expected 4 elements, got %+v", path.Elem)
+	}
+	if path.Elem[1].Name != "interface" || path.Elem[1].Key["name"] != "Ethernet1/1" || path.Elem[3].Name != "counters" {
+		t.Errorf("Unexpected path elements: %+v", path.Elem)
+	}
+
+	path = mustParsePath(t, "/lldp/interfaces/interface[name=Et1]/neighbors/neighbor[id=1][type=a]")
+	if path.Elem[4].Key["id"] != "1" || path.Elem[4].Key["type"] != "a" {
+		t.Errorf("Unexpected keys: %+v", path.Elem[4].Key)
+	}
+
+	for _, invalid := range []string{"/interfaces/interface[name=Et1", "/interfaces/interface[name]", "/interfaces//state"} {
+		if _, err := ParsePath(invalid); err == nil {
+			t.Errorf("Expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestApplyNotification(t *testing.T) {
+	state := newDeviceState()
+
+	notification := &Notification{
+		Prefix: mustParsePath(t, "/openconfig-interfaces:interfaces/interface[name=Et1]"),
+		Update: []*Update{
+			{
+				Path: mustParsePath(t, "/state"),
+				Val: &TypedValue{Value: &TypedValue_JsonIetfVal{JsonIetfVal: []byte(`{
+					"openconfig-interfaces:oper-status": "UP",
+					"mtu": 9214,
+					"counters": {"in-octets": "1000", "in-unicast-pkts": "10", "in-multicast-pkts": "2"}
+				}`)}},
+			},
+			{
+				Path: mustParsePath(t, "/ethernet/state/mac-address"),
+				Val:  &TypedValue{Value: &TypedValue_StringVal{StringVal: "52:54:00:12:34:56"}},
+			},
+		},
+	}
+
+	if err := state.applyNotification(notification); err != nil {
+		t.Fatal(err)
+	}
+
+	notification = &Notification{
+		Prefix: mustParsePath(t, "/lldp/interfaces/interface[name=Et1]/neighbors/neighbor[id=1]/state"),
+		Update: []*Update{
+			{Path: mustParsePath(t, "/chassis-id"), Val: &TypedValue{Value: &TypedValue_StringVal{StringVal: "node1"}}},
+			{Path: mustParsePath(t, "/port-id"), Val: &TypedValue{Value: &TypedValue_StringVal{StringVal: "eth0"}}},
+		},
+	}
+
+	if err := state.applyNotification(notification); err != nil {
+		t.Fatal(err)
+	}
+
+	state.applyNotification(&Notification{
+		Update: []*Update{{
+			Path: mustParsePath(t, "/system/state/hostname"),
+			Val:  &TypedValue{Value: &TypedValue_AsciiVal{AsciiVal: "tor1"}},
+		}},
+	})
+
+	intf := state.interfaces["Et1"]
+	if state.hostname != "tor1" || intf == nil {
+		t.Fatalf("Unexpected state: %+v", state)
+	}
+
+	if toIdentity(intf.leaves["state/oper-status"]) != "UP" || toString(intf.leaves["ethernet/state/mac-address"]) != "52:54:00:12:34:56" {
+		t.Errorf("Unexpected interface leaves: %+v", intf.leaves)
+	}
+
+	if mtu, ok := toInt64(intf.leaves["state/mtu"]); !ok || mtu != 9214 {
+		t.Errorf("Unexpected MTU: %+v", intf.leaves["state/mtu"])
+	}
+
+	metric := interfaceMetric(intf.leaves, time.Now())
+	if metric == nil || metric.RxBytes != 1000 || metric.RxPackets != 12 || metric.Multicast != 2 {
+		t.Errorf("Unexpected metric: %+v", metric)
+	}
+
+	if neighbor := intf.neighbors["1"]; neighbor == nil || toString(neighbor["state/port-id"]) != "eth0" {
+		t.Errorf("Unexpected neighbors: %+v", intf.neighbors)
+	}
+
+	// removing the counters and the interface
+	state.applyNotification(&Notification{Delete: []*Path{mustParsePath(t, "/interfaces/interface[name=Et1]/state/counters")}})
+	if metric := interfaceMetric(intf.leaves, time.Now()); metric != nil {
+		t.Errorf("Expected the counters to be removed: %+v", intf.leaves)
+	}
+
+	state.applyNotification(&Notification{Delete: []*Path{mustParsePath(t, "/interfaces/interface[name=Et1]")}})
+	if len(state.interfaces) != 0 {
+		t.Errorf("Expected the interface to be removed: %+v", state.interfaces)
+	}
+}
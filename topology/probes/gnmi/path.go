@@ -0,0 +1,195 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gnmi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParsePath parses a gNMI path in its string form, like
+// /interfaces/interface[name=Ethernet1/1]/state, the key values possibly
+// containing slashes
+func ParsePath(s string) (*Path, error) {
+	path := &Path{}
+
+	s = strings.TrimPrefix(s, "/")
+	for len(s) > 0 {
+		elem := &PathElem{}
+
+		end := strings.IndexAny(s, "/[")
+		if end == -1 {
+			end = len(s)
+		}
+		elem.Name, s = s[:end], s[end:]
+		if elem.Name == "" {
+			return nil, fmt.Errorf("Empty element in path")
+		}
+
+		for strings.HasPrefix(s, "[") {
+			closing := strings.Index(s, "]")
+			if closing == -1 {
+				return nil, fmt.Errorf("Unterminated key in path element %s", elem.Name)
+			}
+
+			kv := strings.SplitN(s[1:closing], "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("Invalid key '%s' in path element %s", s[1:closing], elem.Name)
+			}
+
+			if elem.Key == nil {
+				elem.Key = make(map[string]string)
+			}
+			elem.Key[kv[0]] = kv[1]
+			s = s[closing+1:]
+		}
+
+		path.Elem = append(path.Elem, elem)
+		s = strings.TrimPrefix(s, "/")
+	}
+
+	return path, nil
+}
+
+// trimModule removes the YANG module prefix of a name, like the
+// openconfig-interfaces: prefix of the JSON IETF encoded values
+func trimModule(name string) string {
+	if i := strings.Index(name, ":"); i != -1 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// joinPath returns the elements of a path relative to a prefix
+func joinPath(prefix, path *Path) []*PathElem {
+	var elems []*PathElem
+	for _, p := range []*Path{prefix, path} {
+		if p == nil {
+			continue
+		}
+		for _, elem := range p.Elem {
+			elems = append(elems, &PathElem{Name: trimModule(elem.Name), Key: elem.Key})
+		}
+	}
+	return elems
+}
+
+// pathString returns the string form of path elements
+func pathString(elems []*PathElem) string {
+	parts := make([]string, len(elems))
+	for i, elem := range elems {
+		parts[i] = elem.Name
+	}
+	return strings.Join(parts, "/")
+}
+
+// decodeValue returns the value of a typed value, the JSON encoded values
+// being decoded
+func decodeValue(v *TypedValue) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	var raw []byte
+	switch value := v.Value.(type) {
+	case *TypedValue_StringVal:
+		return value.StringVal, nil
+	case *TypedValue_IntVal:
+		return value.IntVal, nil
+	case *TypedValue_UintVal:
+		return value.UintVal, nil
+	case *TypedValue_BoolVal:
+		return value.BoolVal, nil
+	case *TypedValue_BytesVal:
+		return value.BytesVal, nil
+	case *TypedValue_FloatVal:
+		return float64(value.FloatVal), nil
+	case *TypedValue_AsciiVal:
+		return value.AsciiVal, nil
+	case *TypedValue_JsonVal:
+		raw = value.JsonVal
+	case *TypedValue_JsonIetfVal:
+		raw = value.JsonIetfVal
+	default:
+		return nil, fmt.Errorf("Unsupported value type %T", v.Value)
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// walkLeaves calls fn for each leaf of a value, the JSON objects being
+// walked with their member names appended to the path elements
+func walkLeaves(elems []*PathElem, value interface{}, fn func(elems []*PathElem, value interface{})) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		fn(elems, value)
+		return
+	}
+
+	for name, member := range object {
+		child := make([]*PathElem, len(elems), len(elems)+1)
+		copy(child, elems)
+		walkLeaves(append(child, &PathElem{Name: trimModule(name)}), member, fn)
+	}
+}
+
+// toInt64 converts a leaf value to an integer, the 64 bits integers being
+// encoded as strings in JSON IETF
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return math.MaxInt64, true
+		}
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// toString converts a leaf value to a string
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// toIdentity converts a leaf value holding an enumeration or a YANG
+// identity to a string, trimming the module prefix of the identity
+func toIdentity(value interface{}) string {
+	return trimModule(toString(value))
+}
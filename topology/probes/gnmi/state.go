@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package gnmi
+
+import (
+	"strings"
+)
+
+// leaves holds the leaf values of a subtree by path relative to its root,
+// like state/counters/in-octets
+type leaves map[string]interface{}
+
+func (l leaves) set(path string, value interface{}) {
+	l[path] = value
+}
+
+// delete removes a leaf or all the leaves of a subtree
+func (l leaves) delete(path string) {
+	for key := range l {
+		if key == path || strings.HasPrefix(key, path+"/") {
+			delete(l, key)
+		}
+	}
+}
+
+type interfaceState struct {
+	leaves    leaves
+	neighbors map[string]leaves
+}
+
+// deviceState accumulates the OpenConfig telemetry of a device
+type deviceState struct {
+	hostname   string
+	interfaces map[string]*interfaceState
+}
+
+func newDeviceState() *deviceState {
+	return &deviceState{interfaces: make(map[string]*interfaceState)}
+}
+
+func (s *deviceState) getInterface(name string, create bool) *interfaceState {
+	intf, found := s.interfaces[name]
+	if !found && create {
+		intf = &interfaceState{leaves: make(leaves), neighbors: make(map[string]leaves)}
+		s.interfaces[name] = intf
+	}
+	return intf
+}
+
+func matchElems(elems []*PathElem, names ...string) bool {
+	if len(elems) < len(names) {
+		return false
+	}
+	for i, name := range names {
+		if elems[i].Name != name {
+			return false
+		}
+	}
+	return true
+}
+
+// apply updates the state with a leaf value, or removes the subtree when
+// deleted. Only the system, interfaces and LLDP neighbors subtrees are kept.
+func (s *deviceState) apply(elems []*PathElem, value interface{}, deleted bool) {
+	switch {
+	case matchElems(elems, "system", "state", "hostname"):
+		s.hostname = ""
+		if !deleted {
+			s.hostname = toString(value)
+		}
+
+	case matchElems(elems, "interfaces", "interface"):
+		name := elems[1].Key["name"]
+		if name == "" {
+			return
+		}
+
+		if len(elems) == 2 {
+			if deleted {
+				delete(s.interfaces, name)
+			}
+			return
+		}
+
+		if intf := s.getInterface(name, !deleted); intf != nil {
+			if deleted {
+				intf.leaves.delete(pathString(elems[2:]))
+			} else {
+				intf.leaves.set(pathString(elems[2:]), value)
+			}
+		}
+
+	case matchElems(elems, "lldp", "interfaces", "interface"):
+		name := elems[2].Key["name"]
+		if name == "" {
+			return
+		}
+
+		// the LLDP updates may be received before the interface ones
+		intf := s.getInterface(name, !deleted)
+		if intf == nil {
+			return
+		}
+
+		if !matchElems(elems, "lldp", "interfaces", "interface", "neighbors", "neighbor") {
+			if deleted {
+				intf.neighbors = make(map[string]leaves)
+			}
+			return
+		}
+
+		id := elems[4].Key["id"]
+		if id == "" {
+			return
+		}
+
+		neighbor, found := intf.neighbors[id]
+		switch {
+		case deleted && len(elems) == 5:
+			delete(intf.neighbors, id)
+		case deleted && found:
+			neighbor.delete(pathString(elems[5:]))
+		case !deleted && len(elems) > 5:
+			if !found {
+				neighbor = make(leaves)
+				intf.neighbors[id] = neighbor
+			}
+			neighbor.set(pathString(elems[5:]), value)
+		}
+	}
+}
+
+// applyNotification applies the updates and the deletions of a notification
+func (s *deviceState) applyNotification(n *Notification) error {
+	for _, path := range n.Delete {
+		s.apply(joinPath(n.Prefix, path), nil, true)
+	}
+
+	for _, update := range n.Update {
+		value, err := decodeValue(update.Val)
+		if err != nil {
+			return err
+		}
+
+		walkLeaves(joinPath(n.Prefix, update.Path), value, func(elems []*PathElem, value interface{}) {
+			s.apply(elems, value, false)
+		})
+	}
+
+	return nil
+}
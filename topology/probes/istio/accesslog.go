@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+)
+
+const accessLogServiceName = "envoy.service.accesslog.v2.AccessLogService"
+
+type connectionLog struct {
+	layer  flow.L7Layer
+	expire time.Time
+}
+
+// AccessLogServer implements the Envoy access log service (ALS) so that
+// the Istio sidecars send it the logs of the HTTP requests they proxy. The
+// attributes of the requests are then added to the flows of the connections
+// carrying them.
+type AccessLogServer struct {
+	sync.RWMutex
+	listen      string
+	server      *grpc.Server
+	ttl         time.Duration
+	connections map[string]*connectionLog
+	quit        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// connectionKey returns the key of a TCP connection, independently of its
+// direction
+func connectionKey(ipA string, portA int64, ipB string, portB int64) string {
+	a, b := fmt.Sprintf("%s:%d", ipA, portA), fmt.Sprintf("%s:%d", ipB, portB)
+	if a > b {
+		a, b = b, a
+	}
+	return a + "-" + b
+}
+
+func addressKey(a, b *Address) string {
+	sa, sb := a.GetSocketAddress(), b.GetSocketAddress()
+	if sa == nil || sb == nil || sa.GetPortValue() == 0 || sb.GetPortValue() == 0 {
+		return ""
+	}
+	return connectionKey(sa.GetAddress(), int64(sa.GetPortValue()), sb.GetAddress(), int64(sb.GetPortValue()))
+}
+
+// spiffeID returns the identity, as an URI SAN, of a certificate
+func spiffeID(cert *TLSProperties_CertificateProperties) string {
+	for _, san := range cert.GetSubjectAltName() {
+		if uri := san.GetUri(); uri != "" {
+			return uri
+		}
+	}
+	return ""
+}
+
+func (s *AccessLogServer) handleEntry(entry *HTTPAccessLogEntry) {
+	props := entry.GetCommonProperties()
+	request, response := entry.GetRequest(), entry.GetResponse()
+
+	// the downstream connection is the one seen on the interface of the
+	// pod receiving the request, the upstream one on the interface of the
+	// pod sending it
+	var keys []string
+	if key := addressKey(props.GetDownstreamRemoteAddress(), props.GetDownstreamLocalAddress()); key != "" {
+		keys = append(keys, key)
+	}
+	if key := addressKey(props.GetUpstreamLocalAddress(), props.GetUpstreamRemoteAddress()); key != "" {
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	code := int64(response.GetResponseCode().GetValue())
+	layer := flow.L7Layer{
+		Protocol:             entry.GetProtocolVersion().String(),
+		Method:               request.GetRequestMethod().String(),
+		Host:                 request.GetAuthority(),
+		Path:                 request.GetPath(),
+		ResponseCode:         code,
+		SourcePrincipal:      spiffeID(props.GetTlsProperties().GetPeerCertificateProperties()),
+		DestinationPrincipal: spiffeID(props.GetTlsProperties().GetLocalCertificateProperties()),
+		UpstreamCluster:      props.GetUpstreamCluster(),
+	}
+
+	expire := time.Now().Add(s.ttl)
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, key := range keys {
+		conn, found := s.connections[key]
+		if !found {
+			conn = &connectionLog{}
+			s.connections[key] = conn
+		}
+
+		l := layer
+		l.Requests, l.Errors = conn.layer.Requests+1, conn.layer.Errors
+		if code >= 500 {
+			l.Errors++
+		}
+
+		// the principals are only known by the sidecar of the pod
+		// receiving the request, keep them when the other one reports
+		if l.SourcePrincipal == "" {
+			l.SourcePrincipal = conn.layer.SourcePrincipal
+		}
+		if l.DestinationPrincipal == "" {
+			l.DestinationPrincipal = conn.layer.DestinationPrincipal
+		}
+
+		conn.layer = l
+		conn.expire = expire
+	}
+}
+
+func (s *AccessLogServer) streamAccessLogs(srv interface{}, stream grpc.ServerStream) error {
+	var node string
+	for {
+		msg := &StreamAccessLogsMessage{}
+		if err := stream.RecvMsg(msg); err != nil {
+			if err == io.EOF {
+				return stream.SendMsg(&StreamAccessLogsResponse{})
+			}
+			return err
+		}
+
+		// the identifier is only sent with the first message of a stream
+		if id := msg.GetIdentifier().GetNode().GetId(); id != "" && id != node {
+			node = id
+			logging.GetLogger().Debugf("Receiving the access logs of %s", node)
+		}
+
+		for _, entry := range msg.GetHttpLogs().GetLogEntry() {
+			s.handleEntry(entry)
+		}
+	}
+}
+
+// Tag adds to a flow the attributes of the last HTTP request seen on its
+// connection
+func (s *AccessLogServer) Tag(f *flow.Flow) {
+	if f.Network == nil || f.Transport == nil || f.Transport.Protocol != flow.FlowProtocol_TCP {
+		return
+	}
+
+	key := connectionKey(f.Network.A, f.Transport.A, f.Network.B, f.Transport.B)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	if conn, found := s.connections[key]; found {
+		layer := conn.layer
+		f.L7 = &layer
+	}
+}
+
+func (s *AccessLogServer) expire() {
+	now := time.Now()
+
+	s.Lock()
+	defer s.Unlock()
+
+	for key, conn := range s.connections {
+		if now.After(conn.expire) {
+			delete(s.connections, key)
+		}
+	}
+}
+
+// Start listening for the access logs
+func (s *AccessLogServer) Start() {
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to listen for the Envoy access logs on %s: %s", s.listen, err)
+		return
+	}
+
+	logging.GetLogger().Infof("Listening for the Envoy access logs on %s", s.listen)
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(listener); err != nil {
+			logging.GetLogger().Errorf("Envoy access log server stopped: %s", err)
+		}
+	}()
+
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.ttl / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.expire()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Stop the access log server
+func (s *AccessLogServer) Stop() {
+	s.server.Stop()
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// NewAccessLogServerFromConfig returns a new Envoy access log server, or nil
+// if no listen address is configured
+func NewAccessLogServerFromConfig() (*AccessLogServer, error) {
+	listen := config.GetString("analyzer.topology.istio.access_log.listen")
+	if listen == "" {
+		return nil, nil
+	}
+
+	ttl := time.Duration(config.GetInt("analyzer.topology.istio.access_log.ttl")) * time.Second
+	if ttl <= 0 {
+		return nil, fmt.Errorf("Invalid Envoy access log ttl %s", ttl)
+	}
+
+	s := &AccessLogServer{
+		listen:      listen,
+		server:      grpc.NewServer(),
+		ttl:         ttl,
+		connections: make(map[string]*connectionLog),
+		quit:        make(chan struct{}),
+	}
+
+	s.server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: accessLogServiceName,
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "StreamAccessLogs",
+				Handler:       s.streamAccessLogs,
+				ClientStreams: true,
+			},
+		},
+		Metadata: "envoy/service/accesslog/v2/als.proto",
+	}, s)
+
+	return s, nil
+}
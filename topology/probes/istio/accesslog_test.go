@@ -0,0 +1,182 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package istio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/flow"
+)
+
+func newTestAccessLogServer(ttl time.Duration) *AccessLogServer {
+	return &AccessLogServer{
+		ttl:         ttl,
+		connections: make(map[string]*connectionLog),
+	}
+}
+
+func socketAddress(ip string, port uint32) *Address {
+	return &Address{
+		Address: &Address_SocketAddress{
+			SocketAddress: &SocketAddress{
+				Address:       ip,
+				PortSpecifier: &SocketAddress_PortValue{PortValue: port},
+			},
+		},
+	}
+}
+
+func certificate(uri string) *TLSProperties_CertificateProperties {
+	return &TLSProperties_CertificateProperties{
+		SubjectAltName: []*TLSProperties_CertificateProperties_SubjectAltName{
+			{San: &TLSProperties_CertificateProperties_SubjectAltName_Dns{Dns: "reviews"}},
+			{San: &TLSProperties_CertificateProperties_SubjectAltName_Uri{Uri: uri}},
+		},
+	}
+}
+
+// newEntry returns the entry reported by the sidecar of the pod receiving
+// a request from 10.0.0.1:40000 on 10.0.0.2:9080
+func newEntry(code uint32, tls *TLSProperties) *HTTPAccessLogEntry {
+	return &HTTPAccessLogEntry{
+		CommonProperties: &AccessLogCommon{
+			DownstreamRemoteAddress: socketAddress("10.0.0.1", 40000),
+			DownstreamLocalAddress:  socketAddress("10.0.0.2", 9080),
+			TlsProperties:           tls,
+			UpstreamCluster:         "inbound|9080||reviews.default.svc.cluster.local",
+		},
+		ProtocolVersion: HTTPAccessLogEntry_HTTP11,
+		Request: &HTTPRequestProperties{
+			RequestMethod: RequestMethod_GET,
+			Authority:     "reviews:9080",
+			Path:          "/reviews/0",
+		},
+		Response: &HTTPResponseProperties{
+			ResponseCode: &UInt32Value{Value: code},
+		},
+	}
+}
+
+func newTCPFlow(ipA string, portA int64, ipB string, portB int64) *flow.Flow {
+	return &flow.Flow{
+		Network:   &flow.FlowLayer{Protocol: flow.FlowProtocol_IPV4, A: ipA, B: ipB},
+		Transport: &flow.TransportLayer{Protocol: flow.FlowProtocol_TCP, A: portA, B: portB},
+	}
+}
+
+func TestConnectionKey(t *testing.T) {
+	ab := connectionKey("10.0.0.1", 40000, "10.0.0.2", 9080)
+	if ba := connectionKey("10.0.0.2", 9080, "10.0.0.1", 40000); ab != ba {
+		t.Errorf("Expected the same key for both directions, got %s and %s", ab, ba)
+	}
+
+	if other := connectionKey("10.0.0.1", 40001, "10.0.0.2", 9080); ab == other {
+		t.Errorf("Expected different keys for different connections, got %s", other)
+	}
+
+	if key := addressKey(socketAddress("10.0.0.1", 0), socketAddress("10.0.0.2", 9080)); key != "" {
+		t.Errorf("Expected no key for an address without port, got %s", key)
+	}
+
+	if key := addressKey(nil, socketAddress("10.0.0.2", 9080)); key != "" {
+		t.Errorf("Expected no key for a missing address, got %s", key)
+	}
+}
+
+func TestSpiffeID(t *testing.T) {
+	uri := "spiffe://cluster.local/ns/default/sa/reviews"
+	if id := spiffeID(certificate(uri)); id != uri {
+		t.Errorf("Expected the identity %s, got %s", uri, id)
+	}
+
+	if id := spiffeID(nil); id != "" {
+		t.Errorf("Expected no identity without certificate, got %s", id)
+	}
+}
+
+func TestAccessLogTag(t *testing.T) {
+	s := newTestAccessLogServer(time.Minute)
+
+	tls := &TLSProperties{
+		PeerCertificateProperties:  certificate("spiffe://cluster.local/ns/default/sa/productpage"),
+		LocalCertificateProperties: certificate("spiffe://cluster.local/ns/default/sa/reviews"),
+	}
+	s.handleEntry(newEntry(200, tls))
+	s.handleEntry(newEntry(503, nil))
+
+	f := newTCPFlow("10.0.0.2", 9080, "10.0.0.1", 40000)
+	s.Tag(f)
+
+	if f.L7 == nil {
+		t.Fatal("Expected the flow to be tagged with the HTTP attributes")
+	}
+
+	expected := flow.L7Layer{
+		Protocol:             "HTTP11",
+		Method:               "GET",
+		Host:                 "reviews:9080",
+		Path:                 "/reviews/0",
+		ResponseCode:         503,
+		Requests:             2,
+		Errors:               1,
+		SourcePrincipal:      "spiffe://cluster.local/ns/default/sa/productpage",
+		DestinationPrincipal: "spiffe://cluster.local/ns/default/sa/reviews",
+		UpstreamCluster:      "inbound|9080||reviews.default.svc.cluster.local",
+	}
+	if !reflect.DeepEqual(*f.L7, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, *f.L7)
+	}
+
+	// the layer of the flow must not be modified by the next requests
+	s.handleEntry(newEntry(200, nil))
+	if f.L7.Requests != 2 {
+		t.Errorf("Expected the tagged layer to be a copy, got %d requests", f.L7.Requests)
+	}
+
+	udp := newTCPFlow("10.0.0.2", 9080, "10.0.0.1", 40000)
+	udp.Transport.Protocol = flow.FlowProtocol_UDP
+	s.Tag(udp)
+	if udp.L7 != nil {
+		t.Error("Expected an UDP flow not to be tagged")
+	}
+
+	other := newTCPFlow("10.0.0.3", 9080, "10.0.0.1", 40000)
+	s.Tag(other)
+	if other.L7 != nil {
+		t.Error("Expected the flow of another connection not to be tagged")
+	}
+}
+
+func TestAccessLogExpire(t *testing.T) {
+	s := newTestAccessLogServer(-time.Second)
+
+	s.handleEntry(newEntry(200, nil))
+	if len(s.connections) != 1 {
+		t.Fatalf("Expected 1 connection, got %d", len(s.connections))
+	}
+
+	s.expire()
+
+	f := newTCPFlow("10.0.0.1", 40000, "10.0.0.2", 9080)
+	s.Tag(f)
+	if f.L7 != nil {
+		t.Error("Expected the expired connection not to tag the flow")
+	}
+}
@@ -0,0 +1,380 @@
+/*
+ * Copyright 2019 Red Hat
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/api/types"
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/flow"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/validator"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	captureKind      = "SkydiveCapture"
+	captureResources = "skydivecaptures"
+
+	// captures created for a SkydiveCapture are named after it, so that
+	// the controller can find back the ones it owns
+	captureNamePrefix = "skydivecapture/"
+
+	captureSyncInterval = 10 * time.Second
+)
+
+// Phases of a SkydiveCapture
+const (
+	CapturePhasePending = "Pending"
+	CapturePhaseActive  = "Active"
+	CapturePhaseFailed  = "Failed"
+)
+
+// CaptureGroupVersion is the API group and version of the SkydiveCapture
+// custom resource
+var CaptureGroupVersion = schema.GroupVersion{Group: "skydive.network", Version: "v1alpha1"}
+
+// SkydiveCaptureSpec holds the parameters of the capture declared by a
+// SkydiveCapture
+type SkydiveCaptureSpec struct {
+	GremlinQuery    string `json:"gremlinQuery"`
+	BPFFilter       string `json:"bpfFilter,omitempty"`
+	Type            string `json:"type,omitempty"`
+	Profile         string `json:"profile,omitempty"`
+	HeaderSize      int    `json:"headerSize,omitempty"`
+	SamplingRate    uint32 `json:"samplingRate,omitempty"`
+	PollingInterval uint32 `json:"pollingInterval,omitempty"`
+	RawPacketLimit  int    `json:"rawPacketLimit,omitempty"`
+	ExtraTCPMetric  bool   `json:"extraTCPMetric,omitempty"`
+}
+
+// SkydiveCaptureStatus reports the state of the capture created for a
+// SkydiveCapture
+type SkydiveCaptureStatus struct {
+	Phase              string `json:"phase,omitempty"`
+	CaptureID          string `json:"captureID,omitempty"`
+	Message            string `json:"message,omitempty"`
+	MatchedNodes       int    `json:"matchedNodes"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+}
+
+// SkydiveCapture is the custom resource used to declare a capture
+type SkydiveCapture struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              SkydiveCaptureSpec   `json:"spec"`
+	Status            SkydiveCaptureStatus `json:"status,omitempty"`
+}
+
+// SkydiveCaptureList is a list of SkydiveCapture
+type SkydiveCaptureList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SkydiveCapture `json:"items"`
+}
+
+// DeepCopy returns a copy of the SkydiveCapture
+func (c *SkydiveCapture) DeepCopy() *SkydiveCapture {
+	out := &SkydiveCapture{
+		TypeMeta: c.TypeMeta,
+		Spec:     c.Spec,
+		Status:   c.Status,
+	}
+	c.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return out
+}
+
+// DeepCopyObject implements the runtime.Object interface
+func (c *SkydiveCapture) DeepCopyObject() runtime.Object {
+	return c.DeepCopy()
+}
+
+// DeepCopyObject implements the runtime.Object interface
+func (l *SkydiveCaptureList) DeepCopyObject() runtime.Object {
+	out := &SkydiveCaptureList{
+		TypeMeta: l.TypeMeta,
+		ListMeta: *l.ListMeta.DeepCopy(),
+	}
+	for _, item := range l.Items {
+		out.Items = append(out.Items, *item.DeepCopy())
+	}
+	return out
+}
+
+// CaptureHandler is the subset of the capture API used by the controller
+type CaptureHandler interface {
+	Index() map[string]types.Resource
+	Get(id string) (types.Resource, bool)
+	Create(resource types.Resource) error
+	Delete(id string) error
+	Decorate(resource types.Resource)
+}
+
+// CaptureController translates the SkydiveCapture resources into captures
+// and reports their state back into the status of the resources
+type CaptureController struct {
+	common.MasterElection
+	client  rest.Interface
+	cache   *KubeCache
+	handler CaptureHandler
+	trigger chan struct{}
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newCaptureRESTClient(cfg *rest.Config) (*rest.RESTClient, error) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(CaptureGroupVersion, &SkydiveCapture{}, &SkydiveCaptureList{})
+	metav1.AddToGroupVersion(scheme, CaptureGroupVersion)
+
+	config := *cfg
+	config.GroupVersion = &CaptureGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)}
+
+	return rest.RESTClientFor(&config)
+}
+
+func captureKey(cr *SkydiveCapture) string {
+	return cr.Namespace + "/" + cr.Name
+}
+
+func (c *CaptureController) triggerSync() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// OnAdd is called when a SkydiveCapture is created
+func (c *CaptureController) OnAdd(obj interface{}) {
+	c.triggerSync()
+}
+
+// OnUpdate is called when a SkydiveCapture is updated
+func (c *CaptureController) OnUpdate(oldObj, newObj interface{}) {
+	// the status updates done by the controller itself don't
+	// change the generation of the resource
+	if oldObj.(*SkydiveCapture).Generation != newObj.(*SkydiveCapture).Generation {
+		c.triggerSync()
+	}
+}
+
+// OnDelete is called when a SkydiveCapture is deleted
+func (c *CaptureController) OnDelete(obj interface{}) {
+	c.triggerSync()
+}
+
+func (c *CaptureController) newCapture(cr *SkydiveCapture) *types.Capture {
+	spec := cr.Spec
+	return &types.Capture{
+		GremlinQuery:    spec.GremlinQuery,
+		BPFFilter:       spec.BPFFilter,
+		Type:            spec.Type,
+		Profile:         spec.Profile,
+		HeaderSize:      spec.HeaderSize,
+		SamplingRate:    spec.SamplingRate,
+		PollingInterval: spec.PollingInterval,
+		RawPacketLimit:  spec.RawPacketLimit,
+		ExtraTCPMetric:  spec.ExtraTCPMetric,
+		LayerKeyMode:    flow.DefaultLayerKeyModeName(),
+		Name:            captureNamePrefix + captureKey(cr),
+		Description:     fmt.Sprintf("Declared by the SkydiveCapture %s", captureKey(cr)),
+	}
+}
+
+func (c *CaptureController) createCapture(cr *SkydiveCapture) (*types.Capture, error) {
+	capture := c.newCapture(cr)
+	if err := validator.Validate(capture); err != nil {
+		return nil, err
+	}
+	if err := c.handler.Create(capture); err != nil {
+		return nil, err
+	}
+	return capture, nil
+}
+
+// reconcile makes sure the capture of a SkydiveCapture exists and matches
+// the last generation of its spec, and returns its up to date status
+func (c *CaptureController) reconcile(cr *SkydiveCapture, capture *types.Capture) SkydiveCaptureStatus {
+	status := SkydiveCaptureStatus{ObservedGeneration: cr.Generation}
+
+	if capture != nil && cr.Status.ObservedGeneration != cr.Generation {
+		logging.GetLogger().Infof("SkydiveCapture %s changed, replacing capture %s", captureKey(cr), capture.ID())
+		if err := c.handler.Delete(capture.ID()); err != nil {
+			status.Phase, status.Message = CapturePhaseFailed, err.Error()
+			return status
+		}
+		capture = nil
+	}
+
+	if capture == nil {
+		var err error
+		if capture, err = c.createCapture(cr); err != nil {
+			status.Phase, status.Message = CapturePhaseFailed, err.Error()
+			return status
+		}
+		logging.GetLogger().Infof("Capture %s created for SkydiveCapture %s", capture.ID(), captureKey(cr))
+	}
+
+	c.handler.Decorate(capture)
+
+	status.CaptureID = capture.ID()
+	status.MatchedNodes = capture.Count
+	if capture.Count > 0 {
+		status.Phase = CapturePhaseActive
+	} else {
+		status.Phase = CapturePhasePending
+	}
+
+	return status
+}
+
+func (c *CaptureController) updateStatus(cr *SkydiveCapture, status SkydiveCaptureStatus) error {
+	cr = cr.DeepCopy()
+	cr.APIVersion = CaptureGroupVersion.String()
+	cr.Kind = captureKind
+	cr.Status = status
+
+	return c.client.Put().
+		Namespace(cr.Namespace).
+		Resource(captureResources).
+		Name(cr.Name).
+		SubResource("status").
+		Body(cr).
+		Do().
+		Error()
+}
+
+// syncCaptures reconciles all the SkydiveCapture resources and deletes the
+// captures whose resource is gone. Only the master analyzer does it.
+func (c *CaptureController) syncCaptures() {
+	if !c.IsMaster() {
+		return
+	}
+
+	owned := make(map[string]*types.Capture)
+	for _, resource := range c.handler.Index() {
+		capture := resource.(*types.Capture)
+		if strings.HasPrefix(capture.Name, captureNamePrefix) {
+			owned[strings.TrimPrefix(capture.Name, captureNamePrefix)] = capture
+		}
+	}
+
+	for _, obj := range c.cache.List() {
+		cr := obj.(*SkydiveCapture)
+		key := captureKey(cr)
+
+		status := c.reconcile(cr, owned[key])
+		delete(owned, key)
+
+		if status != cr.Status {
+			if status.Phase == CapturePhaseFailed && status.Message != cr.Status.Message {
+				logging.GetLogger().Errorf("Failed to create capture for SkydiveCapture %s: %s", key, status.Message)
+			}
+			if err := c.updateStatus(cr, status); err != nil {
+				logging.GetLogger().Errorf("Failed to update status of SkydiveCapture %s: %s", key, err)
+			}
+		}
+	}
+
+	for key, capture := range owned {
+		logging.GetLogger().Infof("SkydiveCapture %s deleted, deleting capture %s", key, capture.ID())
+		if err := c.handler.Delete(capture.ID()); err != nil {
+			logging.GetLogger().Errorf("Failed to delete capture %s: %s", capture.ID(), err)
+		}
+	}
+}
+
+func (c *CaptureController) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(captureSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.trigger:
+			c.syncCaptures()
+		case <-ticker.C:
+			c.syncCaptures()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// Start watching the SkydiveCapture resources
+func (c *CaptureController) Start() {
+	c.MasterElection.Start()
+	c.cache.Start()
+
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop watching the SkydiveCapture resources. The captures are left
+// untouched so that the next master takes them over.
+func (c *CaptureController) Stop() {
+	close(c.quit)
+	c.wg.Wait()
+
+	c.cache.Stop()
+	c.MasterElection.Stop()
+}
+
+// NewCaptureControllerFromConfig returns a controller creating captures
+// from the SkydiveCapture resources, or nil if it is not enabled
+func NewCaptureControllerFromConfig(handler CaptureHandler, election common.MasterElection) (*CaptureController, error) {
+	if !config.GetBool("analyzer.topology.k8s.captures") {
+		return nil, nil
+	}
+
+	cfg, err := NewConfig(config.GetString("analyzer.topology.k8s.config_file"))
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newCaptureRESTClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create SkydiveCapture client: %s", err)
+	}
+
+	c := &CaptureController{
+		MasterElection: election,
+		client:         client,
+		handler:        handler,
+		trigger:        make(chan struct{}, 1),
+		quit:           make(chan struct{}),
+	}
+	c.cache = NewKubeCache(client, &SkydiveCapture{}, captureResources)
+	c.cache.handlers = append(c.cache.handlers, c)
+
+	return c, nil
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/skydive-project/skydive/api/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeCaptureHandler stores the captures in memory, the captures matching
+// count nodes once decorated
+type fakeCaptureHandler struct {
+	captures  map[string]*types.Capture
+	count     int
+	createErr error
+	created   int
+	deleted   []string
+}
+
+func (h *fakeCaptureHandler) Index() map[string]types.Resource {
+	resources := make(map[string]types.Resource)
+	for id, capture := range h.captures {
+		resources[id] = capture
+	}
+	return resources
+}
+
+func (h *fakeCaptureHandler) Get(id string) (types.Resource, bool) {
+	capture, ok := h.captures[id]
+	return capture, ok
+}
+
+func (h *fakeCaptureHandler) Create(resource types.Resource) error {
+	if h.createErr != nil {
+		return h.createErr
+	}
+	h.created++
+	resource.SetID(fmt.Sprintf("capture-%d", h.created))
+	h.captures[resource.ID()] = resource.(*types.Capture)
+	return nil
+}
+
+func (h *fakeCaptureHandler) Delete(id string) error {
+	h.deleted = append(h.deleted, id)
+	delete(h.captures, id)
+	return nil
+}
+
+func (h *fakeCaptureHandler) Decorate(resource types.Resource) {
+	resource.(*types.Capture).Count = h.count
+}
+
+func newTestSkydiveCapture(generation int64, observed int64) *SkydiveCapture {
+	return &SkydiveCapture{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Generation: generation},
+		Spec:       SkydiveCaptureSpec{GremlinQuery: "G.V().Has('Name', 'eth0')", Type: "pcap"},
+		Status:     SkydiveCaptureStatus{ObservedGeneration: observed},
+	}
+}
+
+func TestNewCaptureFromSkydiveCapture(t *testing.T) {
+	c := &CaptureController{}
+	cr := newTestSkydiveCapture(1, 0)
+	cr.Spec.HeaderSize = 128
+
+	capture := c.newCapture(cr)
+	if capture.GremlinQuery != cr.Spec.GremlinQuery || capture.Type != "pcap" || capture.HeaderSize != 128 {
+		t.Errorf("Expected the capture to hold the spec, got %+v", capture)
+	}
+	if capture.Name != "skydivecapture/default/web" {
+		t.Errorf("Expected the capture to be named after the resource, got %s", capture.Name)
+	}
+}
+
+func TestCaptureReconcile(t *testing.T) {
+	handler := &fakeCaptureHandler{captures: make(map[string]*types.Capture)}
+	c := &CaptureController{handler: handler}
+
+	// a new resource gets a capture, pending until it matches nodes
+	status := c.reconcile(newTestSkydiveCapture(1, 0), nil)
+	expected := SkydiveCaptureStatus{Phase: CapturePhasePending, CaptureID: "capture-1", ObservedGeneration: 1}
+	if status != expected {
+		t.Errorf("Expected %+v, got %+v", expected, status)
+	}
+
+	// an unchanged resource keeps its capture
+	handler.count = 2
+	status = c.reconcile(newTestSkydiveCapture(1, 1), handler.captures["capture-1"])
+	expected = SkydiveCaptureStatus{Phase: CapturePhaseActive, CaptureID: "capture-1", MatchedNodes: 2, ObservedGeneration: 1}
+	if status != expected || handler.created != 1 {
+		t.Errorf("Expected %+v, got %+v", expected, status)
+	}
+
+	// the capture is replaced when the spec changes
+	status = c.reconcile(newTestSkydiveCapture(2, 1), handler.captures["capture-1"])
+	expected = SkydiveCaptureStatus{Phase: CapturePhaseActive, CaptureID: "capture-2", MatchedNodes: 2, ObservedGeneration: 2}
+	if status != expected || len(handler.deleted) != 1 || handler.deleted[0] != "capture-1" {
+		t.Errorf("Expected %+v after deleting capture-1, got %+v, deleted %v", expected, status, handler.deleted)
+	}
+
+	// the creation errors are reported in the status
+	handler.createErr = errors.New("Duplicate capture")
+	status = c.reconcile(newTestSkydiveCapture(3, 2), nil)
+	expected = SkydiveCaptureStatus{Phase: CapturePhaseFailed, Message: "Duplicate capture", ObservedGeneration: 3}
+	if status != expected {
+		t.Errorf("Expected %+v, got %+v", expected, status)
+	}
+}
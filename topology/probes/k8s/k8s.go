@@ -98,6 +98,7 @@ func NewK8sProbe(g *graph.Graph) (*Probe, error) {
 		newNodePodLinker,
 		newIngressServiceLinker,
 		newNetworkPolicyLinker,
+		newPodReachabilityLinker,
 		newServiceEndpointsLinker,
 		newServicePodLinker,
 		newStatefulSetPodLinker,
@@ -0,0 +1,412 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/probe"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// reachabilitySyncDelay is the time waited after a change of a pod, a
+// namespace or a network policy, so that a burst of changes is evaluated once
+const reachabilitySyncDelay = time.Second
+
+// reachability tells whether a pod can send traffic to another one and the
+// policies allowing or denying it
+type reachability struct {
+	from     *v1.Pod
+	to       *v1.Pod
+	allowed  bool
+	policies []string
+}
+
+// isolation holds the policies selecting a pod, a pod being isolated for a
+// direction as soon as a policy of this direction selects it
+type isolation struct {
+	pod     *v1.Pod
+	ingress []*v1beta1.NetworkPolicy
+	egress  []*v1beta1.NetworkPolicy
+}
+
+func policyName(np *v1beta1.NetworkPolicy) string {
+	return np.Namespace + "/" + np.Name
+}
+
+func policySelects(np *v1beta1.NetworkPolicy, pod *v1.Pod) bool {
+	if np.Namespace != pod.Namespace {
+		return false
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(pod.Labels))
+}
+
+func ipBlockMatches(block *v1beta1.IPBlock, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	if _, cidr, err := net.ParseCIDR(block.CIDR); err != nil || !cidr.Contains(addr) {
+		return false
+	}
+
+	for _, except := range block.Except {
+		if _, cidr, err := net.ParseCIDR(except); err == nil && cidr.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// peerMatches returns whether a pod is selected by a peer of a rule, a pod
+// selector alone selecting pods of the namespace of the policy and a pod
+// selector along with a namespace selector selecting the pods matching both
+func peerMatches(np *v1beta1.NetworkPolicy, peer v1beta1.NetworkPolicyPeer, pod *v1.Pod, namespaces map[string]labels.Set) bool {
+	if peer.IPBlock != nil {
+		return ipBlockMatches(peer.IPBlock, pod.Status.PodIP)
+	}
+
+	if peer.NamespaceSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector)
+		if err != nil || !selector.Matches(namespaces[pod.Namespace]) {
+			return false
+		}
+	} else if pod.Namespace != np.Namespace {
+		return false
+	}
+
+	if peer.PodSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(peer.PodSelector)
+		if err != nil {
+			return false
+		}
+		return selector.Matches(labels.Set(pod.Labels))
+	}
+	return true
+}
+
+func peersMatch(np *v1beta1.NetworkPolicy, peers []v1beta1.NetworkPolicyPeer, pod *v1.Pod, namespaces map[string]labels.Set) bool {
+	// a rule without peers matches all the pods
+	if len(peers) == 0 {
+		return true
+	}
+
+	for _, peer := range peers {
+		if peerMatches(np, peer, pod, namespaces) {
+			return true
+		}
+	}
+	return false
+}
+
+func ingressAllows(np *v1beta1.NetworkPolicy, from *v1.Pod, namespaces map[string]labels.Set) bool {
+	for _, rule := range np.Spec.Ingress {
+		if peersMatch(np, rule.From, from, namespaces) {
+			return true
+		}
+	}
+	return false
+}
+
+func egressAllows(np *v1beta1.NetworkPolicy, to *v1.Pod, namespaces map[string]labels.Set) bool {
+	for _, rule := range np.Spec.Egress {
+		if peersMatch(np, rule.To, to, namespaces) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluatePolicies returns the policies allowing the traffic of a direction,
+// or all the policies isolating the pod when none allows it
+func evaluatePolicies(policies []*v1beta1.NetworkPolicy, allows func(np *v1beta1.NetworkPolicy) bool) (bool, []string) {
+	var allowing []string
+	for _, np := range policies {
+		if allows(np) {
+			allowing = append(allowing, policyName(np))
+		}
+	}
+
+	if len(allowing) > 0 {
+		return true, allowing
+	}
+
+	denying := make([]string, len(policies))
+	for i, np := range policies {
+		denying[i] = policyName(np)
+	}
+	return false, denying
+}
+
+// evaluateReachability returns the reachability of the pairs of pods for
+// which at least one of the pods is isolated, the traffic between the other
+// pods being allowed. The traffic is allowed when both the egress policies
+// of the source and the ingress policies of the destination allow it.
+func evaluateReachability(pods []*v1.Pod, policies []*v1beta1.NetworkPolicy, namespaces map[string]labels.Set) (result []reachability) {
+	isolations := make([]*isolation, 0, len(pods))
+	for _, pod := range pods {
+		iso := &isolation{pod: pod}
+
+		// policies do not apply to the pods of the host network
+		if !pod.Spec.HostNetwork {
+			for _, np := range policies {
+				if !policySelects(np, pod) {
+					continue
+				}
+				if isIngress(np) {
+					iso.ingress = append(iso.ingress, np)
+				}
+				if isEgress(np) {
+					iso.egress = append(iso.egress, np)
+				}
+			}
+		}
+		isolations = append(isolations, iso)
+	}
+
+	for _, from := range isolations {
+		for _, to := range isolations {
+			if from == to || (len(from.egress) == 0 && len(to.ingress) == 0) {
+				continue
+			}
+
+			r := reachability{from: from.pod, to: to.pod, allowed: true}
+
+			var allowing []string
+			if len(from.egress) > 0 {
+				allowed, names := evaluatePolicies(from.egress, func(np *v1beta1.NetworkPolicy) bool {
+					return egressAllows(np, to.pod, namespaces)
+				})
+				if allowed {
+					allowing = append(allowing, names...)
+				} else {
+					r.allowed, r.policies = false, names
+				}
+			}
+
+			if len(to.ingress) > 0 {
+				allowed, names := evaluatePolicies(to.ingress, func(np *v1beta1.NetworkPolicy) bool {
+					return ingressAllows(np, from.pod, namespaces)
+				})
+				if allowed {
+					allowing = append(allowing, names...)
+				} else {
+					r.allowed, r.policies = false, append(r.policies, names...)
+				}
+			}
+
+			if r.allowed {
+				r.policies = allowing
+			}
+			sort.Strings(r.policies)
+
+			result = append(result, r)
+		}
+	}
+	return
+}
+
+// podReachabilityLinker materializes the reachability of the pods as
+// "allows" and "denies" edges from the source pod to the destination pod,
+// holding the names of the policies responsible for the decision
+type podReachabilityLinker struct {
+	graph.DefaultGraphListener
+	graph          *graph.Graph
+	npCache        *ResourceCache
+	podCache       *ResourceCache
+	namespaceCache *ResourceCache
+	edges          map[graph.Identifier]bool
+	changed        chan struct{}
+	quit           chan struct{}
+	wg             sync.WaitGroup
+}
+
+func (l *podReachabilityLinker) notify() {
+	select {
+	case l.changed <- struct{}{}:
+	default:
+	}
+}
+
+// OnNodeAdded event
+func (l *podReachabilityLinker) OnNodeAdded(node *graph.Node) {
+	l.notify()
+}
+
+// OnNodeUpdated event
+func (l *podReachabilityLinker) OnNodeUpdated(node *graph.Node) {
+	l.notify()
+}
+
+// OnNodeDeleted event
+func (l *podReachabilityLinker) OnNodeDeleted(node *graph.Node) {
+	l.notify()
+}
+
+func (l *podReachabilityLinker) evaluate() []reachability {
+	var pods []*v1.Pod
+	for _, obj := range l.podCache.List() {
+		pods = append(pods, obj.(*v1.Pod))
+	}
+
+	var policies []*v1beta1.NetworkPolicy
+	for _, obj := range l.npCache.List() {
+		policies = append(policies, obj.(*v1beta1.NetworkPolicy))
+	}
+
+	namespaces := make(map[string]labels.Set)
+	for _, obj := range l.namespaceCache.List() {
+		ns := obj.(*v1.Namespace)
+		namespaces[ns.Name] = labels.Set(ns.Labels)
+	}
+
+	return evaluateReachability(pods, policies, namespaces)
+}
+
+// sync evaluates the reachability of the pods out of the graph lock and
+// updates the edges which changed
+func (l *podReachabilityLinker) sync() {
+	result := l.evaluate()
+
+	l.graph.Lock()
+	defer l.graph.Unlock()
+
+	edges := make(map[graph.Identifier]bool)
+	for _, r := range result {
+		fromNode, toNode := objectToNode(l.graph, r.from), objectToNode(l.graph, r.to)
+		if fromNode == nil || toNode == nil {
+			continue
+		}
+
+		relationType := "denies"
+		if r.allowed {
+			relationType = "allows"
+		}
+		m := NewEdgeMetadata(Manager, relationType)
+		m.SetField("Policies", r.policies)
+
+		// the same edge is kept when the decision changes
+		id := graph.GenID(string(fromNode.ID), string(toNode.ID), "RelationType", "reachability")
+		edges[id] = true
+
+		if edge := l.graph.GetEdge(id); edge != nil {
+			if !reflect.DeepEqual(edge.Metadata, m) {
+				if err := l.graph.SetMetadata(edge, m); err != nil {
+					logging.GetLogger().Error(err)
+				}
+			}
+			continue
+		}
+
+		if err := l.graph.AddEdge(l.graph.CreateEdge(id, fromNode, toNode, m, graph.TimeUTC(), "")); err != nil {
+			logging.GetLogger().Error(err)
+		}
+	}
+
+	for id := range l.edges {
+		if edges[id] {
+			continue
+		}
+		if edge := l.graph.GetEdge(id); edge != nil {
+			if err := l.graph.DelEdge(edge); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+	l.edges = edges
+}
+
+func (l *podReachabilityLinker) run() {
+	defer l.wg.Done()
+
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-l.quit:
+			return
+		case <-l.changed:
+			if timer == nil {
+				timer = time.After(reachabilitySyncDelay)
+			}
+		case <-timer:
+			timer = nil
+			l.sync()
+		}
+	}
+}
+
+// Start the linker
+func (l *podReachabilityLinker) Start() {
+	for _, cache := range []*ResourceCache{l.npCache, l.podCache, l.namespaceCache} {
+		cache.AddEventListener(l)
+	}
+
+	l.wg.Add(1)
+	go l.run()
+	l.notify()
+}
+
+// Stop the linker
+func (l *podReachabilityLinker) Stop() {
+	for _, cache := range []*ResourceCache{l.npCache, l.podCache, l.namespaceCache} {
+		cache.RemoveEventListener(l)
+	}
+
+	close(l.quit)
+	l.wg.Wait()
+}
+
+func newPodReachabilityLinker(g *graph.Graph) probe.Probe {
+	if !config.GetBool("analyzer.topology.k8s.reachability") {
+		return nil
+	}
+
+	npProbe := GetSubprobe(Manager, "networkpolicy")
+	podProbe := GetSubprobe(Manager, "pod")
+	namespaceProbe := GetSubprobe(Manager, "namespace")
+	if npProbe == nil || podProbe == nil || namespaceProbe == nil {
+		return nil
+	}
+
+	return &podReachabilityLinker{
+		graph:          g,
+		npCache:        npProbe.(*ResourceCache),
+		podCache:       podProbe.(*ResourceCache),
+		namespaceCache: namespaceProbe.(*ResourceCache),
+		edges:          make(map[graph.Identifier]bool),
+		changed:        make(chan struct{}, 1),
+		quit:           make(chan struct{}),
+	}
+}
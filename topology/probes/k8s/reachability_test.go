@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func newTestPod(namespace, name, app, ip string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": app}},
+		Status:     v1.PodStatus{PodIP: ip},
+	}
+}
+
+func newTestPolicy(namespace, name string, podSelector map[string]string, from ...v1beta1.NetworkPolicyPeer) *v1beta1.NetworkPolicy {
+	return &v1beta1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: v1beta1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: podSelector},
+			Ingress:     []v1beta1.NetworkPolicyIngressRule{{From: from}},
+		},
+	}
+}
+
+var testNamespaces = map[string]labels.Set{
+	"default": {"env": "dev"},
+	"prod":    {"env": "prod"},
+}
+
+func TestPolicySelects(t *testing.T) {
+	np := newTestPolicy("default", "db", map[string]string{"app": "db"})
+
+	for _, test := range []struct {
+		pod      *v1.Pod
+		np       *v1beta1.NetworkPolicy
+		selected bool
+	}{
+		{newTestPod("default", "db", "db", ""), np, true},
+		{newTestPod("default", "web", "web", ""), np, false},
+		{newTestPod("prod", "db", "db", ""), np, false},
+		{newTestPod("default", "web", "web", ""), newTestPolicy("default", "all", nil), true},
+	} {
+		if selected := policySelects(test.np, test.pod); selected != test.selected {
+			t.Errorf("Expected policy %s selecting %s/%s to be %v", policyName(test.np), test.pod.Namespace, test.pod.Name, test.selected)
+		}
+	}
+}
+
+func TestPeerMatches(t *testing.T) {
+	np := newTestPolicy("default", "db", map[string]string{"app": "db"})
+	web := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+	prod := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	block := &v1beta1.IPBlock{CIDR: "10.0.0.0/8", Except: []string{"10.1.0.0/16"}}
+
+	for _, test := range []struct {
+		name    string
+		peer    v1beta1.NetworkPolicyPeer
+		pod     *v1.Pod
+		matches bool
+	}{
+		{"pod selector", v1beta1.NetworkPolicyPeer{PodSelector: web}, newTestPod("default", "web", "web", ""), true},
+		{"pod selector with other labels", v1beta1.NetworkPolicyPeer{PodSelector: web}, newTestPod("default", "db", "db", ""), false},
+		{"pod selector in other namespace", v1beta1.NetworkPolicyPeer{PodSelector: web}, newTestPod("prod", "web", "web", ""), false},
+		{"namespace selector", v1beta1.NetworkPolicyPeer{NamespaceSelector: prod}, newTestPod("prod", "db", "db", ""), true},
+		{"namespace selector with other labels", v1beta1.NetworkPolicyPeer{NamespaceSelector: prod}, newTestPod("default", "db", "db", ""), false},
+		{"both selectors", v1beta1.NetworkPolicyPeer{NamespaceSelector: prod, PodSelector: web}, newTestPod("prod", "web", "web", ""), true},
+		{"both selectors with other labels", v1beta1.NetworkPolicyPeer{NamespaceSelector: prod, PodSelector: web}, newTestPod("prod", "db", "db", ""), false},
+		{"ip block", v1beta1.NetworkPolicyPeer{IPBlock: block}, newTestPod("prod", "web", "web", "10.2.0.1"), true},
+		{"ip block exception", v1beta1.NetworkPolicyPeer{IPBlock: block}, newTestPod("prod", "web", "web", "10.1.0.1"), false},
+		{"ip block without address", v1beta1.NetworkPolicyPeer{IPBlock: block}, newTestPod("prod", "web", "web", ""), false},
+	} {
+		if matches := peerMatches(np, test.peer, test.pod, testNamespaces); matches != test.matches {
+			t.Errorf("%s: expected %v, got %v", test.name, test.matches, matches)
+		}
+	}
+}
+
+func TestEvaluateReachability(t *testing.T) {
+	web := newTestPod("default", "web", "web", "")
+	db := newTestPod("default", "db", "db", "")
+	other := newTestPod("prod", "web", "web", "")
+
+	np := newTestPolicy("default", "db", map[string]string{"app": "db"}, v1beta1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+	})
+
+	// only the traffic to the isolated pod is evaluated
+	result := evaluateReachability([]*v1.Pod{web, db, other}, []*v1beta1.NetworkPolicy{np}, testNamespaces)
+	expected := []reachability{
+		{from: web, to: db, allowed: true, policies: []string{"default/db"}},
+		{from: other, to: db, allowed: false, policies: []string{"default/db"}},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+
+	// the policies do not apply to the pods of the host network
+	db.Spec.HostNetwork = true
+	if result = evaluateReachability([]*v1.Pod{web, db, other}, []*v1beta1.NetworkPolicy{np}, testNamespaces); len(result) != 0 {
+		t.Errorf("Expected no isolated pod, got %+v", result)
+	}
+}
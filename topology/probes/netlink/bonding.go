@@ -0,0 +1,574 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/netlink/nlattr"
+)
+
+// Not defined by the netlink package
+const (
+	iflaBondMode           = 1
+	iflaBondActiveSlave    = 2
+	iflaBondMiimon         = 3
+	iflaBondUpdelay        = 4
+	iflaBondDowndelay      = 5
+	iflaBondXmitHashPolicy = 14
+	iflaBondMinLinks       = 18
+	iflaBondAdLacpRate     = 21
+	iflaBondAdSelect       = 22
+	iflaBondAdInfo         = 23
+
+	iflaBondAdInfoAggregator = 1
+	iflaBondAdInfoNumPorts   = 2
+	iflaBondAdInfoActorKey   = 3
+	iflaBondAdInfoPartnerKey = 4
+	iflaBondAdInfoPartnerMac = 5
+
+	teamGenlName    = "team"
+	teamGenlVersion = 1
+
+	teamCmdOptionsGet  = 2
+	teamCmdPortListGet = 3
+
+	teamAttrTeamIfindex = 1
+	teamAttrListOption  = 2
+	teamAttrListPort    = 3
+
+	teamAttrOptionName        = 1
+	teamAttrOptionType        = 3
+	teamAttrOptionData        = 4
+	teamAttrOptionPortIfindex = 6
+
+	teamAttrPortIfindex = 1
+	teamAttrPortLinkup  = 3
+	teamAttrPortSpeed   = 4
+	teamAttrPortDuplex  = 5
+
+	nlaU32  = 3
+	nlaFlag = 6
+
+	bondModeActiveBackup = 1
+	bondMode8023AD       = 4
+)
+
+var (
+	bondModes            = []string{"balance-rr", "active-backup", "balance-xor", "broadcast", "802.3ad", "balance-tlb", "balance-alb"}
+	bondXmitHashPolicies = []string{"layer2", "layer3+4", "layer2+3", "encap2+3", "encap3+4"}
+	bondLacpRates        = []string{"slow", "fast"}
+	bondAdSelects        = []string{"stable", "bandwidth", "count"}
+
+	// bits of the LACP actor and partner port states
+	lacpStates = []string{"Activity", "ShortTimeout", "Aggregation", "Synchronization", "Collecting", "Distributing", "Defaulted", "Expired"}
+)
+
+// bondInfo describes the configuration and the state of a bond
+type bondInfo struct {
+	mode           uint8
+	activeSlave    uint32
+	miimon         uint32
+	updelay        uint32
+	downdelay      uint32
+	xmitHashPolicy uint8
+	minLinks       uint32
+	lacpRate       uint8
+	adSelect       uint8
+	ad             *bondADInfo
+}
+
+// bondADInfo describes the 802.3ad aggregator of a bond
+type bondADInfo struct {
+	aggregator uint16
+	numPorts   uint16
+	actorKey   uint16
+	partnerKey uint16
+	partnerMAC string
+}
+
+// teamPort describes the state of a port of a team
+type teamPort struct {
+	linkUp  bool
+	speed   uint32
+	duplex  uint8
+	enabled bool
+}
+
+// teamInfo describes the mode and the ports of a team
+type teamInfo struct {
+	mode       string
+	activePort uint32
+	ports      map[int]*teamPort
+}
+
+func enumName(names []string, value uint8) string {
+	if int(value) < len(names) {
+		return names[value]
+	}
+	return "unknown"
+}
+
+// lacpPortState returns the flags set in a LACP port state
+func lacpPortState(state uint8) []interface{} {
+	flags := []interface{}{}
+	for i, name := range lacpStates {
+		if state&(1<<uint(i)) != 0 {
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+func parseBondADInfo(attrs []syscall.NetlinkRouteAttr) *bondADInfo {
+	native := nl.NativeEndian()
+
+	ad := &bondADInfo{}
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case iflaBondAdInfoAggregator:
+			ad.aggregator = native.Uint16(attr.Value)
+		case iflaBondAdInfoNumPorts:
+			ad.numPorts = native.Uint16(attr.Value)
+		case iflaBondAdInfoActorKey:
+			ad.actorKey = native.Uint16(attr.Value)
+		case iflaBondAdInfoPartnerKey:
+			ad.partnerKey = native.Uint16(attr.Value)
+		case iflaBondAdInfoPartnerMac:
+			ad.partnerMAC = net.HardwareAddr(attr.Value).String()
+		}
+	}
+	return ad
+}
+
+// parseBondInfo decodes the IFLA_INFO_DATA attributes of a bond
+func parseBondInfo(attrs []syscall.NetlinkRouteAttr) (*bondInfo, error) {
+	native := nl.NativeEndian()
+
+	for _, attr := range attrs {
+		if nlattr.Type(attr) != syscall.IFLA_LINKINFO {
+			continue
+		}
+
+		infos, err := nlattr.Nested(attr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if nlattr.Type(info) != nl.IFLA_INFO_DATA {
+				continue
+			}
+
+			data, err := nlattr.Nested(info)
+			if err != nil {
+				return nil, err
+			}
+
+			bond := &bondInfo{}
+			for _, d := range data {
+				switch nlattr.Type(d) {
+				case iflaBondMode:
+					bond.mode = d.Value[0]
+				case iflaBondActiveSlave:
+					bond.activeSlave = native.Uint32(d.Value)
+				case iflaBondMiimon:
+					bond.miimon = native.Uint32(d.Value)
+				case iflaBondUpdelay:
+					bond.updelay = native.Uint32(d.Value)
+				case iflaBondDowndelay:
+					bond.downdelay = native.Uint32(d.Value)
+				case iflaBondXmitHashPolicy:
+					bond.xmitHashPolicy = d.Value[0]
+				case iflaBondMinLinks:
+					bond.minLinks = native.Uint32(d.Value)
+				case iflaBondAdLacpRate:
+					bond.lacpRate = d.Value[0]
+				case iflaBondAdSelect:
+					bond.adSelect = d.Value[0]
+				case iflaBondAdInfo:
+					ad, err := nlattr.Nested(d)
+					if err != nil {
+						return nil, err
+					}
+					bond.ad = parseBondADInfo(ad)
+				}
+			}
+			return bond, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// getLinkAttrs retrieves the attributes of a link
+func getLinkAttrs(socket *nl.NetlinkSocket, index int) ([]syscall.NetlinkRouteAttr, error) {
+	req := nl.NewNetlinkRequest(syscall.RTM_GETLINK, syscall.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(syscall.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+	req.Sockets = map[int]*nl.SocketHandle{
+		syscall.NETLINK_ROUTE: {Socket: socket},
+	}
+
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, syscall.RTM_NEWLINK)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range msgs {
+		ifmsg := nl.DeserializeIfInfomsg(m)
+		return nl.ParseRouteAttr(m[ifmsg.Len():])
+	}
+	return nil, nil
+}
+
+// parseTeamOptions decodes the team wide mode and active port options and
+// the enabled option of the ports
+func parseTeamOptions(team *teamInfo, attrs []syscall.NetlinkRouteAttr) error {
+	native := nl.NativeEndian()
+
+	for _, attr := range attrs {
+		if nlattr.Type(attr) != teamAttrListOption {
+			continue
+		}
+
+		items, err := nlattr.Nested(attr)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			option, err := nlattr.Nested(item)
+			if err != nil {
+				return err
+			}
+
+			var name string
+			var optionType uint8
+			var data []byte
+			var hasData bool
+			var port int
+			for _, o := range option {
+				switch nlattr.Type(o) {
+				case teamAttrOptionName:
+					name = strings.TrimRight(string(o.Value), "\x00")
+				case teamAttrOptionType:
+					optionType = o.Value[0]
+				case teamAttrOptionData:
+					data, hasData = o.Value, true
+				case teamAttrOptionPortIfindex:
+					port = int(native.Uint32(o.Value))
+				}
+			}
+
+			switch {
+			case name == "mode" && port == 0:
+				team.mode = strings.TrimRight(string(data), "\x00")
+			case name == "activeport" && port == 0 && optionType == nlaU32 && len(data) >= 4:
+				team.activePort = native.Uint32(data)
+			case name == "enabled" && port != 0 && optionType == nlaFlag:
+				// a flag is true when its data is present
+				team.port(port).enabled = hasData
+			}
+		}
+	}
+	return nil
+}
+
+// parseTeamPorts decodes the link state of the ports of a team
+func parseTeamPorts(team *teamInfo, attrs []syscall.NetlinkRouteAttr) error {
+	native := nl.NativeEndian()
+
+	for _, attr := range attrs {
+		if nlattr.Type(attr) != teamAttrListPort {
+			continue
+		}
+
+		items, err := nlattr.Nested(attr)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			attrs, err := nlattr.Nested(item)
+			if err != nil {
+				return err
+			}
+
+			var index int
+			state := &teamPort{}
+			for _, a := range attrs {
+				switch nlattr.Type(a) {
+				case teamAttrPortIfindex:
+					index = int(native.Uint32(a.Value))
+				case teamAttrPortLinkup:
+					state.linkUp = true
+				case teamAttrPortSpeed:
+					state.speed = native.Uint32(a.Value)
+				case teamAttrPortDuplex:
+					state.duplex = a.Value[0]
+				}
+			}
+
+			if index != 0 {
+				port := team.port(index)
+				port.linkUp, port.speed, port.duplex = state.linkUp, state.speed, state.duplex
+			}
+		}
+	}
+	return nil
+}
+
+func (t *teamInfo) port(index int) *teamPort {
+	port, found := t.ports[index]
+	if !found {
+		port = &teamPort{}
+		t.ports[index] = port
+	}
+	return port
+}
+
+// getTeamInfo retrieves the options and the ports of a team through the
+// team generic netlink family
+func getTeamInfo(socket *nl.NetlinkSocket, family uint16, index int) (*teamInfo, error) {
+	team := &teamInfo{ports: make(map[int]*teamPort)}
+
+	for _, cmd := range []uint8{teamCmdOptionsGet, teamCmdPortListGet} {
+		req := nl.NewNetlinkRequest(int(family), 0)
+		req.AddData(&nl.Genlmsg{Command: cmd, Version: teamGenlVersion})
+		req.AddData(nl.NewRtAttr(teamAttrTeamIfindex, nl.Uint32Attr(uint32(index))))
+		req.Sockets = map[int]*nl.SocketHandle{
+			syscall.NETLINK_GENERIC: {Socket: socket},
+		}
+
+		msgs, err := req.Execute(syscall.NETLINK_GENERIC, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range msgs {
+			attrs, err := nl.ParseRouteAttr(m[nl.SizeofGenlmsg:])
+			if err != nil {
+				return nil, err
+			}
+
+			if cmd == teamCmdOptionsGet {
+				err = parseTeamOptions(team, attrs)
+			} else {
+				err = parseTeamPorts(team, attrs)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return team, nil
+}
+
+func bondMetadata(bond *bondInfo, links map[int]*graph.Node) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"Mode":      enumName(bondModes, bond.mode),
+		"MiiMon":    int64(bond.miimon),
+		"UpDelay":   int64(bond.updelay),
+		"DownDelay": int64(bond.downdelay),
+		"MinLinks":  int64(bond.minLinks),
+	}
+
+	if bond.mode == bondModeActiveBackup {
+		if slave, found := links[int(bond.activeSlave)]; found {
+			metadata["ActiveSlave"], _ = slave.GetFieldString("Name")
+		}
+	} else {
+		metadata["XmitHashPolicy"] = enumName(bondXmitHashPolicies, bond.xmitHashPolicy)
+	}
+
+	if bond.mode == bondMode8023AD {
+		metadata["LACPRate"] = enumName(bondLacpRates, bond.lacpRate)
+		metadata["ADSelect"] = enumName(bondAdSelects, bond.adSelect)
+
+		if ad := bond.ad; ad != nil {
+			metadata["Aggregator"] = map[string]interface{}{
+				"ID":         int64(ad.aggregator),
+				"NumPorts":   int64(ad.numPorts),
+				"ActorKey":   int64(ad.actorKey),
+				"PartnerKey": int64(ad.partnerKey),
+				"PartnerMAC": ad.partnerMAC,
+			}
+		}
+	}
+
+	return metadata
+}
+
+func teamMetadata(team *teamInfo, links map[int]*graph.Node) map[string]interface{} {
+	metadata := map[string]interface{}{
+		"Mode": team.mode,
+	}
+
+	if port, found := links[int(team.activePort)]; found && team.activePort != 0 {
+		metadata["ActivePort"], _ = port.GetFieldString("Name")
+	}
+
+	return metadata
+}
+
+func teamPortMetadata(port *teamPort) map[string]interface{} {
+	duplex := "half"
+	if port.duplex != 0 {
+		duplex = "full"
+	}
+
+	return map[string]interface{}{
+		"LinkUp":  port.linkUp,
+		"Speed":   int64(port.speed),
+		"Duplex":  duplex,
+		"Enabled": port.enabled,
+	}
+}
+
+// bondSlaveLinkMetadata returns the metadata of the link between a bond and
+// one of its slaves, its state reporting the failovers
+func bondSlaveLinkMetadata(slave *netlink.BondSlave) graph.Metadata {
+	return graph.Metadata{
+		"Type":      "bond",
+		"State":     slave.State.String(),
+		"MiiStatus": slave.MiiStatus.String(),
+	}
+}
+
+// setMetadata updates a metadata of a node or of an edge when it changed
+func setMetadata(g *graph.Graph, element interface {
+	GetField(string) (interface{}, error)
+}, key string, value interface{}) {
+	if previous, err := element.GetField(key); err == nil && reflect.DeepEqual(previous, value) {
+		return
+	}
+	g.AddMetadata(element, key, value)
+}
+
+// updateSlaveLink updates the metadata of the link between a master and one
+// of its slaves. The caller must hold the graph lock.
+func (u *NetNsProbe) updateSlaveLink(intf *graph.Node, masterIndex int64, m graph.Metadata) {
+	master := u.Graph.LookupFirstChild(u.Root, graph.Metadata{"IfIndex": masterIndex})
+	if master == nil {
+		return
+	}
+
+	edge := u.Graph.GetFirstLink(master, intf, graph.Metadata{"RelationType": topology.Layer2Link})
+	if edge == nil {
+		return
+	}
+
+	for k, v := range m {
+		setMetadata(u.Graph, edge, k, v)
+	}
+}
+
+// updateBonds reports the configuration of the bonds and of the teams and
+// the state of the team ports. The state of the bond slaves being notified
+// by netlink, it is reported when they are updated. It shares the
+// statistics socket as both are only used by the probe goroutine.
+func (u *NetNsProbe) updateBonds() {
+	links := u.cloneLinkNodes()
+
+	u.Graph.RLock()
+	var bonds, teams []int
+	for index, node := range links {
+		switch linkType, _ := node.GetFieldString("Type"); linkType {
+		case "bond":
+			bonds = append(bonds, index)
+		case "team":
+			teams = append(teams, index)
+		}
+	}
+	u.Graph.RUnlock()
+
+	bondInfos := make(map[int]*bondInfo)
+	for _, index := range bonds {
+		attrs, err := getLinkAttrs(u.statsCollector.socket, index)
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to retrieve the state of bond %d within %s: %s", index, u.Root.ID, err)
+			continue
+		}
+
+		if bond, err := parseBondInfo(attrs); err != nil {
+			logging.GetLogger().Errorf("Failed to parse the state of bond %d within %s: %s", index, u.Root.ID, err)
+		} else if bond != nil {
+			bondInfos[index] = bond
+		}
+	}
+
+	teamInfos := make(map[int]*teamInfo)
+	if len(teams) > 0 && u.teamSocket != nil {
+		if family, err := netlink.GenlFamilyGet(teamGenlName); err != nil {
+			logging.GetLogger().Debugf("Team generic netlink family not available: %s", err)
+		} else {
+			for _, index := range teams {
+				team, err := getTeamInfo(u.teamSocket, family.ID, index)
+				if err != nil {
+					logging.GetLogger().Errorf("Failed to retrieve the state of team %d within %s: %s", index, u.Root.ID, err)
+					continue
+				}
+				teamInfos[index] = team
+			}
+		}
+	}
+
+	u.Graph.Lock()
+	defer u.Graph.Unlock()
+
+	for index, bond := range bondInfos {
+		if u.Graph.GetNode(links[index].ID) != nil {
+			setMetadata(u.Graph, links[index], "Bond", bondMetadata(bond, links))
+		}
+	}
+
+	for index, team := range teamInfos {
+		if u.Graph.GetNode(links[index].ID) == nil {
+			continue
+		}
+		setMetadata(u.Graph, links[index], "Team", teamMetadata(team, links))
+
+		for portIndex, port := range team.ports {
+			node, found := links[portIndex]
+			if !found || u.Graph.GetNode(node.ID) == nil {
+				continue
+			}
+			setMetadata(u.Graph, node, "TeamPort", teamPortMetadata(port))
+
+			state := "BACKUP"
+			if (team.mode == "activebackup" && uint32(portIndex) == team.activePort) || (team.mode != "activebackup" && port.enabled) {
+				state = "ACTIVE"
+			}
+			u.updateSlaveLink(node, int64(index), graph.Metadata{"Type": "team", "State": state, "LinkUp": port.linkUp})
+		}
+	}
+}
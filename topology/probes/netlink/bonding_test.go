@@ -0,0 +1,138 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestParseBondInfo(t *testing.T) {
+	native := nl.NativeEndian()
+
+	u16 := func(v uint16) []byte {
+		b := make([]byte, 2)
+		native.PutUint16(b, v)
+		return b
+	}
+
+	linkInfo := nl.NewRtAttr(syscall.IFLA_LINKINFO, nil)
+	nl.NewRtAttrChild(linkInfo, nl.IFLA_INFO_KIND, nl.ZeroTerminated("bond"))
+	data := nl.NewRtAttrChild(linkInfo, nl.IFLA_INFO_DATA, nil)
+	nl.NewRtAttrChild(data, iflaBondMode, []byte{bondMode8023AD})
+	nl.NewRtAttrChild(data, iflaBondMiimon, nl.Uint32Attr(100))
+	nl.NewRtAttrChild(data, iflaBondAdLacpRate, []byte{1})
+	ad := nl.NewRtAttrChild(data, iflaBondAdInfo, nil)
+	nl.NewRtAttrChild(ad, iflaBondAdInfoAggregator, u16(1))
+	nl.NewRtAttrChild(ad, iflaBondAdInfoNumPorts, u16(2))
+	nl.NewRtAttrChild(ad, iflaBondAdInfoActorKey, u16(15))
+	nl.NewRtAttrChild(ad, iflaBondAdInfoPartnerKey, u16(33))
+	nl.NewRtAttrChild(ad, iflaBondAdInfoPartnerMac, []byte{0, 1, 2, 3, 4, 5})
+
+	attrs, err := nl.ParseRouteAttr(linkInfo.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bond, err := parseBondInfo(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"Mode":           "802.3ad",
+		"MiiMon":         int64(100),
+		"UpDelay":        int64(0),
+		"DownDelay":      int64(0),
+		"MinLinks":       int64(0),
+		"XmitHashPolicy": "layer2",
+		"LACPRate":       "fast",
+		"ADSelect":       "stable",
+		"Aggregator": map[string]interface{}{
+			"ID":         int64(1),
+			"NumPorts":   int64(2),
+			"ActorKey":   int64(15),
+			"PartnerKey": int64(33),
+			"PartnerMAC": "00:01:02:03:04:05",
+		},
+	}
+
+	if metadata := bondMetadata(bond, nil); !reflect.DeepEqual(metadata, expected) {
+		t.Errorf("Expected %v, got %v", expected, metadata)
+	}
+}
+
+func TestParseTeam(t *testing.T) {
+	option := func(list *nl.RtAttr, name string, optionType uint8, data []byte, port uint32) {
+		item := nl.NewRtAttrChild(list, 1, nil)
+		nl.NewRtAttrChild(item, teamAttrOptionName, nl.ZeroTerminated(name))
+		nl.NewRtAttrChild(item, teamAttrOptionType, []byte{optionType})
+		if data != nil {
+			nl.NewRtAttrChild(item, teamAttrOptionData, data)
+		}
+		if port != 0 {
+			nl.NewRtAttrChild(item, teamAttrOptionPortIfindex, nl.Uint32Attr(port))
+		}
+	}
+
+	options := nl.NewRtAttr(teamAttrListOption, nil)
+	option(options, "mode", 5, nl.ZeroTerminated("activebackup"), 0)
+	option(options, "activeport", nlaU32, nl.Uint32Attr(3), 0)
+	option(options, "enabled", nlaFlag, []byte{}, 3)
+	option(options, "enabled", nlaFlag, nil, 4)
+
+	ports := nl.NewRtAttr(teamAttrListPort, nil)
+	port := nl.NewRtAttrChild(ports, 1, nil)
+	nl.NewRtAttrChild(port, teamAttrPortIfindex, nl.Uint32Attr(3))
+	nl.NewRtAttrChild(port, teamAttrPortLinkup, []byte{})
+	nl.NewRtAttrChild(port, teamAttrPortSpeed, nl.Uint32Attr(10000))
+	nl.NewRtAttrChild(port, teamAttrPortDuplex, []byte{1})
+	port = nl.NewRtAttrChild(ports, 1, nil)
+	nl.NewRtAttrChild(port, teamAttrPortIfindex, nl.Uint32Attr(4))
+
+	team := &teamInfo{ports: make(map[int]*teamPort)}
+	for _, attr := range []*nl.RtAttr{options, ports} {
+		attrs, err := nl.ParseRouteAttr(attr.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parseTeamOptions(team, attrs); err != nil {
+			t.Fatal(err)
+		}
+		if err := parseTeamPorts(team, attrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := &teamInfo{
+		mode:       "activebackup",
+		activePort: 3,
+		ports: map[int]*teamPort{
+			3: {linkUp: true, speed: 10000, duplex: 1, enabled: true},
+			4: {},
+		},
+	}
+	if !reflect.DeepEqual(team, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, team)
+	}
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// updateBridgeFDBs dumps the forwarding databases of the bridges of the
+// namespace, the entries being reported by their ports
+func (u *NetNsProbe) updateBridgeFDBs(now time.Time) {
+	neighs, err := u.handle.NeighList(0, syscall.AF_BRIDGE)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve the bridge forwarding databases within %s: %s", u.Root.ID, err)
+		return
+	}
+
+	links := u.cloneLinkNodes()
+	maxMoves := config.GetInt("agent.topology.fdb.max_moves")
+
+	u.Graph.Lock()
+	defer u.Graph.Unlock()
+
+	entries := make(map[int64][]topology.FDBEntry)
+	for _, neigh := range neighs {
+		// skip the entries of the device itself, like the remote VTEPs of
+		// the VXLAN interfaces, only the bridge ones are kept
+		if neigh.Flags&netlink.NTF_SELF != 0 {
+			continue
+		}
+
+		port, found := links[neigh.LinkIndex]
+		if !found {
+			continue
+		}
+
+		master, err := port.GetFieldInt64("MasterIndex")
+		if err != nil {
+			continue
+		}
+
+		name, _ := port.GetFieldString("Name")
+		entries[master] = append(entries[master], topology.FDBEntry{
+			MAC:    neigh.HardwareAddr.String(),
+			Vlan:   int64(neigh.Vlan),
+			Port:   name,
+			Static: neigh.State&(netlink.NUD_PERMANENT|netlink.NUD_NOARP) != 0,
+		})
+	}
+
+	bridges := make(map[int64]bool)
+	for index, node := range links {
+		if linkType, _ := node.GetFieldString("Type"); linkType != "bridge" {
+			continue
+		}
+
+		index := int64(index)
+		bridges[index] = true
+
+		tracker, found := u.fdbTrackers[index]
+		if !found {
+			tracker = topology.NewFDBTracker()
+			u.fdbTrackers[index] = tracker
+		}
+
+		moves := tracker.Update(entries[index], now)
+		for _, move := range moves {
+			logging.GetLogger().Warningf("MAC %s moved from %s to %s within %s", move.MAC, move.From, move.To, u.Root.ID)
+		}
+
+		topology.SetBridgeFDB(u.Graph, node, entries[index], moves, maxMoves)
+	}
+
+	for index := range u.fdbTrackers {
+		if !bridges[index] {
+			delete(u.fdbTrackers, index)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+const (
+	// MulticastGroupType is the type of the nodes representing the
+	// multicast groups joined within a namespace
+	MulticastGroupType = "multicastgroup"
+	// MembershipLink is the relation type of the edges linking an
+	// interface to the multicast groups it joined
+	MembershipLink = "membership"
+)
+
+// multicastMembership describes a multicast group joined by an interface
+type multicastMembership struct {
+	IfIndex int64
+	Group   net.IP
+	Users   int64
+	Version string
+}
+
+// parseIGMP parses the IPv4 group memberships from the /proc/net/igmp format
+// where the interfaces lines are followed by the lines of their groups:
+//
+//	Idx	Device    : Count Querier	Group    Users Timer	Reporter
+//	2	eth0      :     1      V3
+//					010000E0     1 0:00000000		0
+func parseIGMP(r io.Reader) ([]multicastMembership, error) {
+	var memberships []multicastMembership
+	var ifIndex int64
+	var version string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "Idx" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			// interface line
+			index, err := strconv.ParseInt(fields[0], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid interface index in '%s'", line)
+			}
+			ifIndex, version = index, ""
+			if len(fields) >= 5 {
+				version = "IGMP" + strings.TrimPrefix(fields[4], "V")
+			}
+			continue
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("Invalid group line '%s'", line)
+		}
+
+		// the address is dumped as an integer in host byte order
+		addr, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid group address in '%s'", line)
+		}
+		group := make(net.IP, net.IPv4len)
+		nl.NativeEndian().PutUint32(group, uint32(addr))
+
+		users, _ := strconv.ParseInt(fields[1], 10, 64)
+
+		memberships = append(memberships, multicastMembership{IfIndex: ifIndex, Group: group, Users: users, Version: version})
+	}
+
+	return memberships, scanner.Err()
+}
+
+// parseIGMP6 parses the IPv6 group memberships from the /proc/net/igmp6
+// format, one membership per line:
+//
+//	2    eth0            ff0200000000000000000001ff8b3d4e     1 00000004 0
+func parseIGMP6(r io.Reader) ([]multicastMembership, error) {
+	var memberships []multicastMembership
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("Invalid membership line '%s'", scanner.Text())
+		}
+
+		ifIndex, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid interface index in '%s'", scanner.Text())
+		}
+
+		group, err := hex.DecodeString(fields[2])
+		if err != nil || len(group) != net.IPv6len {
+			return nil, fmt.Errorf("Invalid group address in '%s'", scanner.Text())
+		}
+
+		users, _ := strconv.ParseInt(fields[3], 10, 64)
+
+		memberships = append(memberships, multicastMembership{IfIndex: ifIndex, Group: net.IP(group), Users: users, Version: "MLD"})
+	}
+
+	return memberships, scanner.Err()
+}
+
+func readMemberships(path string, parse func(io.Reader) ([]multicastMembership, error)) ([]multicastMembership, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		// IPv6 may be disabled
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return parse(f)
+}
+
+// getMulticastMemberships returns the group memberships of the namespace
+// as maintained by the kernel from the IGMP and MLD reports
+func (u *NetNsProbe) getMulticastMemberships() ([]multicastMembership, error) {
+	var context *common.NetNSContext
+	var err error
+
+	if u.NsPath != "" {
+		if context, err = common.NewNetNsContext(u.NsPath); err != nil {
+			context.Close()
+			return nil, err
+		}
+	}
+	defer context.Close()
+
+	// thread-self points to the namespace of the current thread whereas
+	// self points to the one of the main thread
+	memberships, err := readMemberships("/proc/thread-self/net/igmp", parseIGMP)
+	if err != nil {
+		return nil, err
+	}
+
+	memberships6, err := readMemberships("/proc/thread-self/net/igmp6", parseIGMP6)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(memberships, memberships6...), nil
+}
+
+func (u *NetNsProbe) multicastGroupID(group string) graph.Identifier {
+	return graph.GenID(string(u.Root.ID), "multicastgroup", group)
+}
+
+// updateMulticastGroups reflects the group memberships as multicast group
+// nodes owned by the namespace, linked to the member interfaces
+func (u *NetNsProbe) updateMulticastGroups() {
+	memberships, err := u.getMulticastMemberships()
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve multicast memberships within %s: %s", u.Root.ID, err)
+		return
+	}
+
+	links := u.cloneLinkNodes()
+
+	u.Graph.Lock()
+	defer u.Graph.Unlock()
+
+	groups := make(map[graph.Identifier]bool)
+	members := make(map[graph.Identifier]bool)
+
+	for _, membership := range memberships {
+		intf, found := links[int(membership.IfIndex)]
+		if !found {
+			continue
+		}
+
+		group := membership.Group.String()
+		id := u.multicastGroupID(group)
+
+		node := u.Graph.GetNode(id)
+		if node == nil {
+			family := "IPV4"
+			if membership.Group.To4() == nil {
+				family = "IPV6"
+			}
+
+			m := graph.Metadata{
+				"Name": group,
+				"Type": MulticastGroupType,
+				"Multicast": map[string]interface{}{
+					"Group":  group,
+					"Family": family,
+				},
+			}
+			if node, err = u.Graph.NewNode(id, m); err != nil {
+				logging.GetLogger().Error(err)
+				continue
+			}
+			topology.AddOwnershipLink(u.Graph, u.Root, node, nil)
+		}
+		groups[id] = true
+
+		m := graph.Metadata{"Users": membership.Users, "Version": membership.Version}
+		if edge := u.Graph.GetFirstLink(intf, node, graph.Metadata{"RelationType": MembershipLink}); edge == nil {
+			if edge, err = topology.AddLink(u.Graph, intf, node, MembershipLink, m); err != nil {
+				logging.GetLogger().Error(err)
+				continue
+			}
+			members[edge.ID] = true
+		} else {
+			tr := u.Graph.StartMetadataTransaction(edge)
+			for k, v := range m {
+				tr.AddMetadata(k, v)
+			}
+			tr.Commit()
+			members[edge.ID] = true
+		}
+	}
+
+	// remove the groups left and the memberships that ended
+	for _, node := range u.Graph.LookupChildren(u.Root, graph.Metadata{"Type": MulticastGroupType}, topology.OwnershipMetadata()) {
+		if !groups[node.ID] {
+			u.Graph.DelNode(node)
+			continue
+		}
+
+		for _, edge := range u.Graph.GetNodeEdges(node, graph.Metadata{"RelationType": MembershipLink}) {
+			if !members[edge.ID] {
+				u.Graph.DelEdge(edge)
+			}
+		}
+	}
+}
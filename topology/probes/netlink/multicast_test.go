@@ -0,0 +1,74 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestParseIGMP(t *testing.T) {
+	// the addresses are dumped in host byte order
+	group := "010000E0"
+	if nl.NativeEndian().Uint16([]byte{0, 1}) == 1 {
+		group = "E0000001"
+	}
+
+	content := "Idx\tDevice    : Count Querier\tGroup    Users Timer\tReporter\n" +
+		"1\tlo        :     1      V3\n" +
+		"\t\t\t\t" + group + "     1 0:00000000\t\t0\n" +
+		"2\teth0      :     2      V2\n" +
+		"\t\t\t\t" + group + "     3 0:00000000\t\t0\n"
+
+	memberships, err := parseIGMP(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(memberships) != 2 {
+		t.Fatalf("Expected 2 memberships, got %+v", memberships)
+	}
+
+	m := memberships[1]
+	if m.IfIndex != 2 || m.Group.String() != "224.0.0.1" || m.Users != 3 || m.Version != "IGMP2" {
+		t.Errorf("Wrong membership: %+v", m)
+	}
+}
+
+func TestParseIGMP6(t *testing.T) {
+	content := "1    lo              ff020000000000000000000000000001     1 0000000C 0\n" +
+		"2    eth0            ff0200000000000000000001ff8b3d4e     1 00000004 0\n"
+
+	memberships, err := parseIGMP6(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(memberships) != 2 {
+		t.Fatalf("Expected 2 memberships, got %+v", memberships)
+	}
+
+	m := memberships[1]
+	if m.IfIndex != 2 || m.Group.String() != "ff02::1:ff8b:3d4e" || m.Version != "MLD" {
+		t.Errorf("Wrong membership: %+v", m)
+	}
+}
@@ -20,7 +20,6 @@
 package netlink
 
 import (
-	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -77,6 +76,11 @@ type NetNsProbe struct {
 	quit                 chan bool
 	netNsNameTry         map[graph.Identifier]int
 	sriovProcessor       *graph.Processor
+	statsCollector       *statsCollector
+	teamSocket           *nl.NetlinkSocket
+	metricsSchedule      *metricsSchedule
+	fdbTrackers          map[int64]*topology.FDBTracker
+	vethPairer           *vethPairer
 }
 
 // Probe describes a list NetLink NameSpace probe to enhance the graph
@@ -89,6 +93,7 @@ type Probe struct {
 	state          int64
 	wg             sync.WaitGroup
 	sriovProcessor *graph.Processor
+	vethPairer     *vethPairer
 }
 
 func (u *NetNsProbe) linkPendingChildren(intf *graph.Node, index int64) {
@@ -138,7 +143,16 @@ func (u *NetNsProbe) handleIntfIsChild(intf *graph.Node, link netlink.Link) {
 
 	// interface being a part of a bridge
 	if link.Attrs().MasterIndex != 0 {
-		u.linkIntfToIndex(intf, int64(link.Attrs().MasterIndex), topology.Layer2Link, nil)
+		// the state of a bond slave is reported on its link to the bond
+		var m graph.Metadata
+		if slave := link.Attrs().BondSlave; slave != nil {
+			m = bondSlaveLinkMetadata(slave)
+		}
+
+		u.linkIntfToIndex(intf, int64(link.Attrs().MasterIndex), topology.Layer2Link, m)
+		if m != nil {
+			u.updateSlaveLink(intf, int64(link.Attrs().MasterIndex), m)
+		}
 	}
 
 	if link.Attrs().ParentIndex != 0 {
@@ -158,51 +172,30 @@ func (u *NetNsProbe) handleIntfIsVeth(intf *graph.Node, link netlink.Link) {
 		return
 	}
 
-	linkMetadata := graph.Metadata{"Type": "veth"}
-
-	if peerIndex, err := intf.GetFieldInt64("PeerIfIndex"); err == nil {
-		peerResolver := func(root *graph.Node) error {
-			u.Graph.Lock()
-			defer u.Graph.Unlock()
-
-			// re get the interface from the graph since the interface could have been deleted
-			if u.Graph.GetNode(intf.ID) == nil {
-				return errors.New("Node not found")
-			}
-
-			var peer *graph.Node
-			if root == nil {
-				peer = u.Graph.LookupFirstNode(graph.Metadata{"IfIndex": peerIndex, "Type": "veth"})
-			} else {
-				peer = u.Graph.LookupFirstChild(root, graph.Metadata{"IfIndex": peerIndex, "Type": "veth"})
-			}
-			if peer == nil {
-				return errors.New("Peer not found")
-			}
-			if !topology.HaveLayer2Link(u.Graph, peer, intf) {
-				topology.AddLayer2Link(u.Graph, peer, intf, linkMetadata)
-			}
+	peerIndex, err := intf.GetFieldInt64("PeerIfIndex")
+	if err != nil {
+		return
+	}
 
-			return nil
-		}
+	// the peer lives in another namespace when the link has a netns id,
+	// the name of this namespace being resolved later on
+	_, err = intf.GetFieldInt64("LinkNetNsID")
+	peerNsName, _ := intf.GetFieldString("LinkNetNsName")
 
-		if peerIndex > ifIndex {
-			go func() {
-				// lookup first in the local namespace then in the whole graph
-				// since we can have the exact same interface (name/index) in different namespaces
-				// we always take first the closer one.
-				localFnc := func() error {
-					if u.isRunning() == false {
-						return nil
-					}
-					return peerResolver(u.Root)
-				}
-				if err := common.Retry(localFnc, 10, 100*time.Millisecond); err != nil {
-					peerResolver(nil)
-				}
-			}()
-		}
+	var nsName string
+	if tp, _ := u.Root.GetFieldString("Type"); tp == "netns" {
+		nsName, _ = u.Root.GetFieldString("Name")
 	}
+
+	u.vethPairer.add(&vethEnd{
+		id:          intf.ID,
+		root:        u.Root.ID,
+		nsName:      nsName,
+		ifIndex:     ifIndex,
+		peerIfIndex: peerIndex,
+		remotePeer:  err == nil,
+		peerNsName:  peerNsName,
+	})
 }
 
 func (u *NetNsProbe) addGenericLinkToTopology(link netlink.Link, m graph.Metadata) *graph.Node {
@@ -328,7 +321,10 @@ func (u *NetNsProbe) getNeighbors(index, family int) *Neighbors {
 }
 
 func newInterfaceMetricsFromNetlink(link netlink.Link) *topology.InterfaceMetric {
-	statistics := link.Attrs().Statistics
+	return newInterfaceMetricsFromStatistics(link.Attrs().Statistics)
+}
+
+func newInterfaceMetricsFromStatistics(statistics *netlink.LinkStatistics) *topology.InterfaceMetric {
 	if statistics == nil {
 		return nil
 	}
@@ -484,6 +480,8 @@ func (u *NetNsProbe) addLinkToTopology(link netlink.Link) {
 			"AggregatorId":           int64(bondSlave.AggregatorId),
 			"AdActorOperPortState":   int64(bondSlave.AdActorOperPortState),
 			"AdPartnerOperPortState": int64(bondSlave.AdPartnerOperPortState),
+			"ActorState":             lacpPortState(bondSlave.AdActorOperPortState),
+			"PartnerState":           lacpPortState(uint8(bondSlave.AdPartnerOperPortState)),
 		}
 
 		if permMAC := bondSlave.PermHardwareAddr.String(); permMAC != "" {
@@ -532,6 +530,11 @@ func (u *NetNsProbe) addLinkToTopology(link netlink.Link) {
 		} else if index, ok := stats["peer_ifindex"]; ok {
 			metadata["PeerIfIndex"] = int64(index)
 		}
+
+		// IFLA_LINK holds the index of the peer of a veth
+		if _, ok := metadata["PeerIfIndex"]; !ok && attrs.ParentIndex != 0 {
+			metadata["PeerIfIndex"] = int64(attrs.ParentIndex)
+		}
 	}
 
 	ipv4 := u.getLinkIPs(link, netlink.FAMILY_V4)
@@ -704,6 +707,14 @@ func (u *NetNsProbe) onLinkDeleted(link netlink.Link) {
 			err = u.Graph.Unlink(u.Root, intf)
 		} else {
 			delete(u.netNsNameTry, intf.ID)
+			u.vethPairer.del(intf.ID)
+
+			// the nodes of the SR-IOV virtual functions go with their physical function
+			for _, vf := range u.Graph.LookupChildren(intf, graph.Metadata{"Type": "vf"}, topology.OwnershipMetadata()) {
+				if err := u.Graph.DelNode(vf); err != nil {
+					logging.GetLogger().Error(err)
+				}
+			}
 
 			err = u.Graph.DelNode(intf)
 		}
@@ -931,40 +942,75 @@ func (u *NetNsProbe) cloneLinkNodes() map[int]*graph.Node {
 	return links
 }
 
-func (u *NetNsProbe) updateIntfMetric(now, last time.Time) {
-	for index, node := range u.cloneLinkNodes() {
-		if link, err := u.handle.LinkByIndex(index); err == nil {
-			currMetric := newInterfaceMetricsFromNetlink(link)
-			if currMetric == nil || currMetric.IsZero() {
-				continue
-			}
-			currMetric.Last = int64(common.UnixMillis(now))
+func (u *NetNsProbe) updateIntfMetric(now time.Time) {
+	links := u.cloneLinkNodes()
 
-			u.Graph.Lock()
-			tr := u.Graph.StartMetadataTransaction(node)
+	// select the interfaces whose type has to be updated
+	dueTypes := make(map[string]bool)
+	dueLinks := make(map[int]string)
+	u.Graph.RLock()
+	for index, node := range links {
+		linkType, _ := node.GetFieldString("Type")
+		due, ok := dueTypes[linkType]
+		if !ok {
+			due = u.metricsSchedule.due(linkType, now)
+			dueTypes[linkType] = due
+		}
+		if due {
+			dueLinks[index] = linkType
+		}
+	}
+	u.Graph.RUnlock()
 
-			var lastUpdateMetric *topology.InterfaceMetric
+	if len(dueLinks) == 0 {
+		return
+	}
 
-			prevMetric, err := node.GetField("Metric")
-			if err == nil {
-				lastUpdateMetric = currMetric.Sub(prevMetric.(*topology.InterfaceMetric)).(*topology.InterfaceMetric)
-			}
+	stats, err := u.statsCollector.Stats()
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve interface statistics within %s: %s", u.Root.ID, err)
+		return
+	}
 
-			// nothing changed since last update
-			if lastUpdateMetric != nil && lastUpdateMetric.IsZero() {
-				u.Graph.Unlock()
-				continue
-			}
+	for index, linkType := range dueLinks {
+		node := links[index]
 
-			tr.AddMetadata("Metric", currMetric)
-			if lastUpdateMetric != nil {
-				lastUpdateMetric.Start = int64(common.UnixMillis(last))
-				lastUpdateMetric.Last = int64(common.UnixMillis(now))
-				tr.AddMetadata("LastUpdateMetric", lastUpdateMetric)
-			}
+		currMetric := newInterfaceMetricsFromStatistics(stats[index])
+		if currMetric == nil || currMetric.IsZero() {
+			continue
+		}
+		currMetric.Last = int64(common.UnixMillis(now))
+
+		u.Graph.Lock()
+		tr := u.Graph.StartMetadataTransaction(node)
+
+		var lastUpdateMetric *topology.InterfaceMetric
 
-			tr.Commit()
+		prevMetric, err := node.GetField("Metric")
+		if err == nil {
+			lastUpdateMetric = currMetric.Sub(prevMetric.(*topology.InterfaceMetric)).(*topology.InterfaceMetric)
+		}
+
+		// nothing changed since last update
+		if lastUpdateMetric != nil && lastUpdateMetric.IsZero() {
 			u.Graph.Unlock()
+			continue
+		}
+
+		tr.AddMetadata("Metric", currMetric)
+		if lastUpdateMetric != nil {
+			lastUpdateMetric.Start = int64(common.UnixMillis(u.metricsSchedule.last(linkType, now)))
+			lastUpdateMetric.Last = int64(common.UnixMillis(now))
+			tr.AddMetadata("LastUpdateMetric", lastUpdateMetric)
+		}
+
+		tr.Commit()
+		u.Graph.Unlock()
+	}
+
+	for linkType, due := range dueTypes {
+		if due {
+			u.metricsSchedule.updated(linkType, now)
 		}
 	}
 }
@@ -1039,22 +1085,63 @@ Ready:
 	}
 	u.initialize()
 
-	seconds := config.GetInt("agent.topology.netlink.metrics_update")
-	metricTicker := time.NewTicker(time.Duration(seconds) * time.Second)
+	metricTicker := time.NewTicker(u.metricsSchedule.tick)
 	defer metricTicker.Stop()
 
 	updateIntfsTicker := time.NewTicker(5 * time.Second)
 	defer updateIntfsTicker.Stop()
 
-	last := time.Now().UTC()
+	// multicast memberships are not notified by netlink, they are polled
+	var multicastTick <-chan time.Time
+	if interval := config.GetInt("agent.topology.netlink.multicast_update"); interval > 0 {
+		multicastTicker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer multicastTicker.Stop()
+
+		u.updateMulticastGroups()
+		multicastTick = multicastTicker.C
+	}
+
+	var fdbTick <-chan time.Time
+	if interval := config.GetInt("agent.topology.fdb.update"); interval > 0 {
+		fdbTicker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer fdbTicker.Stop()
+
+		u.updateBridgeFDBs(time.Now().UTC())
+		fdbTick = fdbTicker.C
+	}
+
+	var stpTick <-chan time.Time
+	if interval := config.GetInt("agent.topology.netlink.stp_update"); interval > 0 {
+		stpTicker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer stpTicker.Stop()
+
+		u.updateBridgesSTP()
+		stpTick = stpTicker.C
+	}
+
+	var bondingTick <-chan time.Time
+	if interval := config.GetInt("agent.topology.netlink.bonding_update"); interval > 0 {
+		bondingTicker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer bondingTicker.Stop()
+
+		u.updateBonds()
+		bondingTick = bondingTicker.C
+	}
+
 	for {
 		select {
 		case <-updateIntfsTicker.C:
 			u.updateIntfs()
+		case <-multicastTick:
+			u.updateMulticastGroups()
+		case t := <-fdbTick:
+			u.updateBridgeFDBs(t.UTC())
+		case <-stpTick:
+			u.updateBridgesSTP()
+		case <-bondingTick:
+			u.updateBonds()
 		case t := <-metricTicker.C:
-			now := t.UTC()
-			u.updateIntfMetric(now, last)
-			last = now
+			u.updateIntfMetric(t.UTC())
 		case <-u.quit:
 			return
 		}
@@ -1123,6 +1210,12 @@ func (u *NetNsProbe) closeFds() {
 	if u.ethtool != nil {
 		u.ethtool.Close()
 	}
+	if u.statsCollector != nil {
+		u.statsCollector.close()
+	}
+	if u.teamSocket != nil {
+		u.teamSocket.Close()
+	}
 	if u.epollFd != 0 {
 		syscall.Close(u.epollFd)
 	}
@@ -1136,7 +1229,7 @@ func (u *NetNsProbe) stop() {
 	u.closeFds()
 }
 
-func newNetNsProbe(g *graph.Graph, root *graph.Node, nsPath string, sriovProcessor *graph.Processor) (*NetNsProbe, error) {
+func newNetNsProbe(g *graph.Graph, root *graph.Node, nsPath string, sriovProcessor *graph.Processor, vethPairer *vethPairer) (*NetNsProbe, error) {
 	probe := &NetNsProbe{
 		Graph:                g,
 		Root:                 root,
@@ -1146,6 +1239,9 @@ func newNetNsProbe(g *graph.Graph, root *graph.Node, nsPath string, sriovProcess
 		quit:                 make(chan bool),
 		netNsNameTry:         make(map[graph.Identifier]int),
 		sriovProcessor:       sriovProcessor,
+		metricsSchedule:      newMetricsScheduleFromConfig(),
+		fdbTrackers:          make(map[int64]*topology.FDBTracker),
+		vethPairer:           vethPairer,
 	}
 	var context *common.NetNSContext
 	var err error
@@ -1174,6 +1270,15 @@ func newNetNsProbe(g *graph.Graph, root *graph.Node, nsPath string, sriovProcess
 		return errFnc(fmt.Errorf("Failed to subscribe to netlink messages: %s", err))
 	}
 
+	if probe.statsCollector, err = newStatsCollector(probe.handle); err != nil {
+		return errFnc(fmt.Errorf("Failed to create netlink statistics socket: %s", err))
+	}
+
+	// the state of the teams is retrieved through generic netlink
+	if probe.teamSocket, err = nl.Subscribe(syscall.NETLINK_GENERIC); err != nil {
+		logging.GetLogger().Warningf("Failed to create generic netlink socket, teams won't be reported: %s", err)
+	}
+
 	if probe.ethtool, err = ethtool.NewEthtool(); err != nil {
 		return errFnc(fmt.Errorf("Failed to create ethtool object: %s", err))
 	}
@@ -1190,7 +1295,7 @@ func newNetNsProbe(g *graph.Graph, root *graph.Node, nsPath string, sriovProcess
 
 // Register a new network netlink/namespace probe in the graph
 func (u *Probe) Register(nsPath string, root *graph.Node) (*NetNsProbe, error) {
-	probe, err := newNetNsProbe(u.Graph, root, nsPath, u.sriovProcessor)
+	probe, err := newNetNsProbe(u.Graph, root, nsPath, u.sriovProcessor, u.vethPairer)
 	if err != nil {
 		return nil, err
 	}
@@ -1223,6 +1328,7 @@ func (u *Probe) Unregister(nsPath string) error {
 			delete(u.probes, fd)
 
 			probe.stop()
+			u.vethPairer.delRoot(probe.Root.ID)
 
 			return nil
 		}
@@ -1263,6 +1369,7 @@ func (u *Probe) start() {
 // Start the probe
 func (u *Probe) Start() {
 	u.Register("", u.hostNode)
+	u.vethPairer.start()
 	go u.start()
 }
 
@@ -1274,6 +1381,7 @@ func (u *Probe) Stop() {
 		u.RLock()
 		defer u.RUnlock()
 		u.sriovProcessor.Stop()
+		u.vethPairer.stop()
 
 		for _, probe := range u.probes {
 			go probe.stop()
@@ -1299,5 +1407,6 @@ func NewProbe(g *graph.Graph, hostNode *graph.Node) (*Probe, error) {
 		epollFd:        epfd,
 		probes:         make(map[int32]*NetNsProbe),
 		sriovProcessor: sriovProcessor,
+		vethPairer:     newVethPairer(g),
 	}, nil
 }
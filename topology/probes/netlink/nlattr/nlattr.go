@@ -0,0 +1,42 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package nlattr provides helpers to decode netlink attributes not
+// handled by the netlink package
+package nlattr
+
+import (
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+// TypeMask removes the NLA_F_NESTED and NLA_F_NET_BYTEORDER flags from the
+// type of an attribute
+const TypeMask = 0x3fff
+
+// Type returns the type of a netlink attribute without its flags
+func Type(attr syscall.NetlinkRouteAttr) uint16 {
+	return attr.Attr.Type & TypeMask
+}
+
+// Nested parses the attributes nested in a netlink attribute
+func Nested(attr syscall.NetlinkRouteAttr) ([]syscall.NetlinkRouteAttr, error) {
+	return nl.ParseRouteAttr(attr.Value)
+}
@@ -0,0 +1,72 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nlattr
+
+import (
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestNested(t *testing.T) {
+	native := nl.NativeEndian()
+
+	// a nested attribute of type 2, flagged with NLA_F_NESTED, holding a
+	// 4 bytes attribute of type 1 and a padded 3 bytes attribute of type 3
+	b := make([]byte, 20)
+	native.PutUint16(b[0:2], 20)
+	native.PutUint16(b[2:4], 0x8000|2)
+	native.PutUint16(b[4:6], 8)
+	native.PutUint16(b[6:8], 1)
+	native.PutUint32(b[8:12], 42)
+	native.PutUint16(b[12:14], 7)
+	native.PutUint16(b[14:16], 3)
+	copy(b[16:19], "br0")
+
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(attrs) != 1 {
+		t.Fatalf("Expected 1 attribute, got %d", len(attrs))
+	}
+
+	if typ := Type(attrs[0]); typ != 2 {
+		t.Errorf("Expected the flags to be masked, got type %d", typ)
+	}
+
+	nested, err := Nested(attrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nested) != 2 {
+		t.Fatalf("Expected 2 nested attributes, got %d", len(nested))
+	}
+
+	if Type(nested[0]) != 1 || native.Uint32(nested[0].Value) != 42 {
+		t.Errorf("Unexpected first nested attribute: %+v", nested[0])
+	}
+
+	if Type(nested[1]) != 3 || string(nested[1].Value) != "br0" {
+		t.Errorf("Unexpected second nested attribute: %+v", nested[1])
+	}
+}
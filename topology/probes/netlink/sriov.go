@@ -24,16 +24,29 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
 	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/netlink/nlattr"
+)
+
+// Not defined by the netlink package
+const (
+	iflaExtMask    = 29
+	rtextFilterVf  = 1
+	iflaVfinfoList = 22
+	iflaVfInfo     = 1
+	iflaVfTrust    = 9
 )
 
 type pendingVf struct {
@@ -96,6 +109,116 @@ func (pending *pendingVf) ProcessNode(g *graph.Graph, node *graph.Node) bool {
 	return false
 }
 
+// parseVfTrust returns the trust setting of the virtual functions of a link,
+// which is not reported by the netlink package
+func parseVfTrust(attrs []syscall.NetlinkRouteAttr) (map[int]bool, error) {
+	native := nl.NativeEndian()
+
+	trust := make(map[int]bool)
+	for _, attr := range attrs {
+		if nlattr.Type(attr) != iflaVfinfoList {
+			continue
+		}
+
+		vfs, err := nlattr.Nested(attr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, vf := range vfs {
+			if nlattr.Type(vf) != iflaVfInfo {
+				continue
+			}
+
+			infos, err := nlattr.Nested(vf)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, info := range infos {
+				if nlattr.Type(info) == iflaVfTrust && len(info.Value) >= 8 {
+					trust[int(native.Uint32(info.Value[0:4]))] = native.Uint32(info.Value[4:8]) != 0
+				}
+			}
+		}
+	}
+	return trust, nil
+}
+
+// getVfTrust retrieves the trust setting of the virtual functions of a link
+func getVfTrust(index int) (map[int]bool, error) {
+	req := nl.NewNetlinkRequest(syscall.RTM_GETLINK, syscall.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(syscall.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+	req.AddData(nl.NewRtAttr(iflaExtMask, nl.Uint32Attr(rtextFilterVf)))
+
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, syscall.RTM_NEWLINK)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range msgs {
+		ifmsg := nl.DeserializeIfInfomsg(m)
+		attrs, err := nl.ParseRouteAttr(m[ifmsg.Len():])
+		if err != nil {
+			return nil, err
+		}
+		return parseVfTrust(attrs)
+	}
+	return nil, nil
+}
+
+// pciDriver returns the driver bound to a PCI device, vfio-pci for a
+// virtual function assigned to a VM
+func pciDriver(businfo string) string {
+	driver, err := os.Readlink(fmt.Sprintf("/sys/bus/pci/devices/%s/driver", businfo))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(driver)
+}
+
+// updateVfNodes creates a node owned by the physical function for each of
+// its virtual functions, whether it is bound to a network driver or assigned
+// to a VM, and removes the nodes of the functions which were released. The
+// graph lock must be held.
+func updateVfNodes(g *graph.Graph, intf *graph.Node, name string, vfs map[int]map[string]interface{}) {
+	for _, node := range g.LookupChildren(intf, graph.Metadata{"Type": "vf"}, topology.OwnershipMetadata()) {
+		if id, _ := node.GetFieldInt64("VfID"); vfs[int(id)] == nil {
+			if err := g.DelNode(node); err != nil {
+				logging.GetLogger().Error(err)
+			}
+		}
+	}
+
+	for id, metadata := range vfs {
+		metadata["Type"] = "vf"
+		metadata["Name"] = fmt.Sprintf("%s-vf%d", name, id)
+
+		nodeID := graph.GenID(string(intf.ID), "vf", strconv.Itoa(id))
+		if node := g.GetNode(nodeID); node != nil {
+			tr := g.StartMetadataTransaction(node)
+			for k, v := range metadata {
+				tr.AddMetadata(k, v)
+			}
+			if err := tr.Commit(); err != nil {
+				logging.GetLogger().Errorf("Metadata transaction failed: %s", err)
+			}
+			continue
+		}
+
+		node, err := g.NewNode(nodeID, metadata)
+		if err != nil {
+			logging.GetLogger().Error(err)
+			continue
+		}
+		if _, err := topology.AddOwnershipLink(g, intf, node, nil); err != nil {
+			logging.GetLogger().Error(err)
+		}
+	}
+}
+
 // errZeroVfs is used as a catchable exception rather than an error
 var errZeroVfs = errors.New("zero VFS")
 
@@ -181,7 +304,14 @@ func (u *NetNsProbe) handleSriov(
 		return
 	}
 
+	trust, err := getVfTrust(id)
+	if err != nil {
+		logging.GetLogger().Warningf(
+			"SR-IOV: cannot get trust setting of VFs - %s", err)
+	}
+
 	vfs := make([]interface{}, numVfs)
+	vfNodes := make(map[int]map[string]interface{})
 	for i, vf := range attrsVfs {
 		vfs[i] = map[string]interface{}{
 			"ID":        int64(vf.ID),
@@ -189,6 +319,21 @@ func (u *NetNsProbe) handleSriov(
 			"MAC":       vf.Mac.String(),
 			"Qos":       int64(vf.Qos),
 			"Spoofchk":  vf.Spoofchk,
+			"Trust":     trust[vf.ID],
+			"TxRate":    int64(vf.TxRate),
+			"Vlan":      int64(vf.Vlan),
+		}
+
+		vfAddress := PciToString(pciaddress + (uint32)(offset+vf.ID*stride))
+		vfNodes[vf.ID] = map[string]interface{}{
+			"VfID":      int64(vf.ID),
+			"BusInfo":   vfAddress,
+			"Driver":    pciDriver(vfAddress),
+			"LinkState": int64(vf.LinkState),
+			"MAC":       vf.Mac.String(),
+			"Qos":       int64(vf.Qos),
+			"Spoofchk":  vf.Spoofchk,
+			"Trust":     trust[vf.ID],
 			"TxRate":    int64(vf.TxRate),
 			"Vlan":      int64(vf.Vlan),
 		}
@@ -197,16 +342,21 @@ func (u *NetNsProbe) handleSriov(
 	graph.Lock()
 	defer graph.Unlock()
 
+	if graph.GetNode(intf.ID) == nil {
+		return
+	}
+
 	tr := graph.StartMetadataTransaction(intf)
 	tr.AddMetadata("Vfs", vfs)
 	if err = tr.Commit(); err != nil {
 		logging.GetLogger().Errorf("Metadata transaction failed: %s", err)
 	}
 
+	updateVfNodes(graph, intf, name, vfNodes)
+
 	for _, vf := range attrsVfs {
 		id := vf.ID
-		pciVf := pciaddress + (uint32)(offset+id*stride)
-		vfAddress := PciToString(pciVf)
+		vfAddress := vfNodes[id]["BusInfo"].(string)
 		pending := pendingVf{
 			intf: intf,
 			vfid: id,
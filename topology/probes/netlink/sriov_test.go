@@ -0,0 +1,71 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestPciAddress(t *testing.T) {
+	address, err := PciFromString("0000:3b:02.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := PciToString(address + 2); s != "0000:3b:02.3" {
+		t.Errorf("Expected 0000:3b:02.3, got %s", s)
+	}
+}
+
+func TestParseVfTrust(t *testing.T) {
+	native := nl.NativeEndian()
+
+	trust := func(vf, setting uint32) []byte {
+		b := make([]byte, 8)
+		native.PutUint32(b[0:4], vf)
+		native.PutUint32(b[4:8], setting)
+		return b
+	}
+
+	list := nl.NewRtAttr(iflaVfinfoList, nil)
+	for vf, setting := range []uint32{0, 1} {
+		info := nl.NewRtAttrChild(list, iflaVfInfo, nil)
+		nl.NewRtAttrChild(info, iflaVfTrust, trust(uint32(vf), setting))
+	}
+
+	attrs, err := nl.ParseRouteAttr(list.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vfs, err := parseVfTrust(append(attrs, syscall.NetlinkRouteAttr{Attr: syscall.RtAttr{Type: syscall.IFLA_MTU}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]bool{0: false, 1: true}
+	if !reflect.DeepEqual(vfs, expected) {
+		t.Errorf("Expected %v, got %v", expected, vfs)
+	}
+}
@@ -0,0 +1,232 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Not defined by the syscall package
+const (
+	rtmNewStats     = 92
+	rtmGetStats     = 94
+	iflaStatsLink64 = 1
+)
+
+const sizeofIfStatsMsg = 12
+
+// ifStatsMsg is the request header of RTM_GETSTATS, only the 64 bits link
+// statistics are requested so that the kernel doesn't have to fill all the
+// link attributes as with RTM_GETLINK
+type ifStatsMsg struct {
+	family     uint8
+	index      uint32
+	filterMask uint32
+}
+
+func (msg *ifStatsMsg) Len() int {
+	return sizeofIfStatsMsg
+}
+
+func (msg *ifStatsMsg) Serialize() []byte {
+	b := make([]byte, sizeofIfStatsMsg)
+	b[0] = msg.family
+	nl.NativeEndian().PutUint32(b[4:8], msg.index)
+	nl.NativeEndian().PutUint32(b[8:12], msg.filterMask)
+	return b
+}
+
+// statsCollector retrieves the statistics of all the interfaces of a
+// namespace with a single netlink dump
+type statsCollector struct {
+	socket      *nl.NetlinkSocket
+	handle      *netlink.Handle
+	useLinkDump bool
+}
+
+// newStatsCollector returns a collector using its own netlink socket. It has
+// to be called within the network namespace.
+func newStatsCollector(handle *netlink.Handle) (*statsCollector, error) {
+	socket, err := nl.Subscribe(syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	return &statsCollector{socket: socket, handle: handle}, nil
+}
+
+func parseLinkStats64(b []byte) (*netlink.LinkStatistics, error) {
+	stats := &netlink.LinkStatistics{}
+	if err := binary.Read(bytes.NewReader(b), nl.NativeEndian(), stats); err != nil {
+		return nil, fmt.Errorf("Invalid link statistics: %s", err)
+	}
+	return stats, nil
+}
+
+func (c *statsCollector) dumpStats() (map[int]*netlink.LinkStatistics, error) {
+	req := nl.NewNetlinkRequest(rtmGetStats, syscall.NLM_F_DUMP)
+	req.AddData(&ifStatsMsg{family: syscall.AF_UNSPEC, filterMask: 1 << (iflaStatsLink64 - 1)})
+	req.Sockets = map[int]*nl.SocketHandle{
+		syscall.NETLINK_ROUTE: {Socket: c.socket},
+	}
+
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, rtmNewStats)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseStatsMsgs(msgs)
+}
+
+// parseStatsMsgs returns the 64 bits link statistics of the RTM_NEWSTATS
+// messages indexed by interface index
+func parseStatsMsgs(msgs [][]byte) (map[int]*netlink.LinkStatistics, error) {
+	stats := make(map[int]*netlink.LinkStatistics, len(msgs))
+	for _, m := range msgs {
+		if len(m) < sizeofIfStatsMsg {
+			continue
+		}
+		index := int(nl.NativeEndian().Uint32(m[4:8]))
+
+		attrs, err := nl.ParseRouteAttr(m[sizeofIfStatsMsg:])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, attr := range attrs {
+			if attr.Attr.Type != iflaStatsLink64 {
+				continue
+			}
+			if stats[index], err = parseLinkStats64(attr.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// dumpLinks is used with the kernels not supporting RTM_GETSTATS, prior to 4.7
+func (c *statsCollector) dumpLinks() (map[int]*netlink.LinkStatistics, error) {
+	links, err := c.handle.LinkList()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int]*netlink.LinkStatistics, len(links))
+	for _, link := range links {
+		if link.Attrs().Statistics != nil {
+			stats[link.Attrs().Index] = link.Attrs().Statistics
+		}
+	}
+	return stats, nil
+}
+
+// Stats returns the statistics of the interfaces indexed by interface index
+func (c *statsCollector) Stats() (map[int]*netlink.LinkStatistics, error) {
+	if !c.useLinkDump {
+		stats, err := c.dumpStats()
+		if err == nil {
+			return stats, nil
+		}
+
+		if err != syscall.EOPNOTSUPP && err != syscall.EINVAL {
+			return nil, err
+		}
+
+		logging.GetLogger().Infof("RTM_GETSTATS not supported, falling back to link dumps: %s", err)
+		c.useLinkDump = true
+	}
+	return c.dumpLinks()
+}
+
+func (c *statsCollector) close() {
+	c.socket.Close()
+}
+
+// metricsSchedule holds the delay between two metric updates of each type
+// of interfaces, veth interfaces can for instance be updated less often
+// than physical ones
+type metricsSchedule struct {
+	defaultInterval time.Duration
+	intervals       map[string]time.Duration
+	lastUpdates     map[string]time.Time
+	tick            time.Duration
+}
+
+func newMetricsScheduleFromConfig() *metricsSchedule {
+	s := &metricsSchedule{
+		defaultInterval: time.Duration(config.GetInt("agent.topology.netlink.metrics_update")) * time.Second,
+		intervals:       make(map[string]time.Duration),
+		lastUpdates:     make(map[string]time.Time),
+	}
+	s.tick = s.defaultInterval
+
+	for linkType, value := range config.GetStringMapString("agent.topology.netlink.metrics_update_by_type") {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			logging.GetLogger().Errorf("Invalid metric update delay for %s interfaces: %s", linkType, value)
+			continue
+		}
+
+		interval := time.Duration(seconds) * time.Second
+		s.intervals[linkType] = interval
+		if interval < s.tick {
+			s.tick = interval
+		}
+	}
+
+	return s
+}
+
+func (s *metricsSchedule) interval(linkType string) time.Duration {
+	if interval, ok := s.intervals[linkType]; ok {
+		return interval
+	}
+	return s.defaultInterval
+}
+
+// last returns the time of the last update of an interface type
+func (s *metricsSchedule) last(linkType string, now time.Time) time.Time {
+	if last, ok := s.lastUpdates[linkType]; ok {
+		return last
+	}
+	return now.Add(-s.interval(linkType))
+}
+
+// due returns whether the interfaces of the given type have to be updated.
+// As the ticks are not exactly spaced, half a tick is tolerated.
+func (s *metricsSchedule) due(linkType string, now time.Time) bool {
+	return now.Sub(s.last(linkType, now))+s.tick/2 >= s.interval(linkType)
+}
+
+func (s *metricsSchedule) updated(linkType string, now time.Time) {
+	s.lastUpdates[linkType] = now
+}
@@ -0,0 +1,122 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+func newStatsMsg(t *testing.T, index uint32, stats *netlink.LinkStatistics) []byte {
+	header := &ifStatsMsg{family: syscall.AF_UNSPEC, index: index, filterMask: 1 << (iflaStatsLink64 - 1)}
+
+	var b bytes.Buffer
+	if err := binary.Write(&b, nl.NativeEndian(), stats); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := header.Serialize()
+	msg = append(msg, nl.NewRtAttr(iflaStatsLink64+1, []byte{0, 0, 0, 0}).Serialize()...)
+	return append(msg, nl.NewRtAttr(iflaStatsLink64, b.Bytes()).Serialize()...)
+}
+
+func TestParseStatsMsgs(t *testing.T) {
+	eth0 := &netlink.LinkStatistics{RxPackets: 10, TxPackets: 20, RxBytes: 1000, TxBytes: 2000}
+	veth := &netlink.LinkStatistics{RxPackets: 1, TxDropped: 3}
+
+	msgs := [][]byte{
+		newStatsMsg(t, 2, eth0),
+		newStatsMsg(t, 7, veth),
+		{0, 0, 0}, // truncated message
+	}
+
+	stats, err := parseStatsMsgs(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("Expected the statistics of 2 interfaces, got %d", len(stats))
+	}
+	if s := stats[2]; s == nil || *s != *eth0 {
+		t.Errorf("Expected %+v for index 2, got %+v", eth0, s)
+	}
+	if s := stats[7]; s == nil || *s != *veth {
+		t.Errorf("Expected %+v for index 7, got %+v", veth, s)
+	}
+
+	header := &ifStatsMsg{family: syscall.AF_UNSPEC, index: 3}
+	truncated := append(header.Serialize(), nl.NewRtAttr(iflaStatsLink64, make([]byte, 8)).Serialize()...)
+	if _, err := parseStatsMsgs([][]byte{truncated}); err == nil {
+		t.Error("Expected an error for truncated statistics")
+	}
+}
+
+func TestMetricsSchedule(t *testing.T) {
+	s := &metricsSchedule{
+		defaultInterval: 30 * time.Second,
+		intervals:       map[string]time.Duration{"veth": 60 * time.Second},
+		lastUpdates:     make(map[string]time.Time),
+		tick:            30 * time.Second,
+	}
+
+	start := time.Now()
+
+	// never updated interfaces are due right away
+	for _, linkType := range []string{"device", "veth"} {
+		if !s.due(linkType, start) {
+			t.Errorf("Expected the %s interfaces to be due", linkType)
+		}
+		s.updated(linkType, start)
+	}
+
+	for _, test := range []struct {
+		linkType string
+		elapsed  time.Duration
+		due      bool
+	}{
+		{"device", 10 * time.Second, false},
+		{"device", 29 * time.Second, true},
+		{"veth", 30 * time.Second, false},
+		{"veth", 44 * time.Second, false},
+		// half a tick is tolerated
+		{"veth", 45 * time.Second, true},
+		{"veth", 60 * time.Second, true},
+	} {
+		if due := s.due(test.linkType, start.Add(test.elapsed)); due != test.due {
+			t.Errorf("Expected due %t for %s after %s, got %t", test.due, test.linkType, test.elapsed, due)
+		}
+	}
+
+	if last := s.last("veth", start.Add(time.Minute)); !last.Equal(start) {
+		t.Errorf("Expected the last update at %s, got %s", start, last)
+	}
+
+	now := start.Add(time.Minute)
+	if last := s.last("bridge", now); !last.Equal(now.Add(-s.defaultInterval)) {
+		t.Errorf("Expected the last update of a new type one interval ago, got %s", last)
+	}
+}
@@ -0,0 +1,336 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+	"github.com/skydive-project/skydive/topology/probes/netlink/nlattr"
+)
+
+// Not defined by the netlink package
+const (
+	iflaBrStpState     = 5
+	iflaBrRootID       = 10
+	iflaBrBridgeID     = 11
+	iflaBrRootPort     = 12
+	iflaBrRootPathCost = 13
+
+	iflaBrportState          = 1
+	iflaBrportBridgeID       = 14
+	iflaBrportDesignatedPort = 15
+	iflaBrportDesignatedCost = 16
+	iflaBrportID             = 17
+	iflaBrportNo             = 18
+)
+
+var stpStates = []string{"disabled", "listening", "learning", "forwarding", "blocking"}
+
+// bridgeSTP describes the spanning tree state of a bridge
+type bridgeSTP struct {
+	enabled      bool
+	bridgeID     string
+	rootID       string
+	rootPort     uint16
+	rootPathCost uint32
+}
+
+// bridgePortSTP describes the spanning tree state of a bridge port
+type bridgePortSTP struct {
+	index            int
+	master           int
+	state            uint8
+	portID           uint16
+	portNo           uint16
+	designatedBridge string
+	designatedPort   uint16
+	designatedCost   uint32
+}
+
+// formatBridgeID formats a bridge identifier like sysfs, ie. the priority
+// followed by the MAC address
+func formatBridgeID(b []byte) string {
+	if len(b) < 8 {
+		return ""
+	}
+	return fmt.Sprintf("%02x%02x.%s", b[0], b[1], net.HardwareAddr(b[2:8]).String())
+}
+
+func parseBridgeSTP(attrs []syscall.NetlinkRouteAttr) (*bridgeSTP, error) {
+	native := nl.NativeEndian()
+
+	for _, attr := range attrs {
+		if nlattr.Type(attr) != syscall.IFLA_LINKINFO {
+			continue
+		}
+
+		infos, err := nlattr.Nested(attr)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, info := range infos {
+			if nlattr.Type(info) != nl.IFLA_INFO_DATA {
+				continue
+			}
+
+			data, err := nlattr.Nested(info)
+			if err != nil {
+				return nil, err
+			}
+
+			stp := &bridgeSTP{}
+			for _, d := range data {
+				switch nlattr.Type(d) {
+				case iflaBrStpState:
+					stp.enabled = native.Uint32(d.Value) != 0
+				case iflaBrRootID:
+					stp.rootID = formatBridgeID(d.Value)
+				case iflaBrBridgeID:
+					stp.bridgeID = formatBridgeID(d.Value)
+				case iflaBrRootPort:
+					stp.rootPort = native.Uint16(d.Value)
+				case iflaBrRootPathCost:
+					stp.rootPathCost = native.Uint32(d.Value)
+				}
+			}
+			return stp, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func parseBridgePortSTP(index int, attrs []syscall.NetlinkRouteAttr) (*bridgePortSTP, error) {
+	native := nl.NativeEndian()
+
+	port := &bridgePortSTP{index: index}
+	protinfo := false
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case syscall.IFLA_MASTER:
+			port.master = int(native.Uint32(attr.Value))
+		case syscall.IFLA_PROTINFO:
+			infos, err := nlattr.Nested(attr)
+			if err != nil {
+				return nil, err
+			}
+			protinfo = true
+
+			for _, info := range infos {
+				switch nlattr.Type(info) {
+				case iflaBrportState:
+					port.state = info.Value[0]
+				case iflaBrportBridgeID:
+					port.designatedBridge = formatBridgeID(info.Value)
+				case iflaBrportDesignatedPort:
+					port.designatedPort = native.Uint16(info.Value)
+				case iflaBrportDesignatedCost:
+					port.designatedCost = native.Uint32(info.Value)
+				case iflaBrportID:
+					port.portID = native.Uint16(info.Value)
+				case iflaBrportNo:
+					port.portNo = native.Uint16(info.Value)
+				}
+			}
+		}
+	}
+
+	if !protinfo || port.master == 0 {
+		return nil, nil
+	}
+	return port, nil
+}
+
+// getBridgeSTP retrieves the spanning tree state of a bridge
+func getBridgeSTP(socket *nl.NetlinkSocket, index int) (*bridgeSTP, error) {
+	req := nl.NewNetlinkRequest(syscall.RTM_GETLINK, syscall.NLM_F_ACK)
+	msg := nl.NewIfInfomsg(syscall.AF_UNSPEC)
+	msg.Index = int32(index)
+	req.AddData(msg)
+	req.Sockets = map[int]*nl.SocketHandle{
+		syscall.NETLINK_ROUTE: {Socket: socket},
+	}
+
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, syscall.RTM_NEWLINK)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range msgs {
+		ifmsg := nl.DeserializeIfInfomsg(m)
+		attrs, err := nl.ParseRouteAttr(m[ifmsg.Len():])
+		if err != nil {
+			return nil, err
+		}
+		return parseBridgeSTP(attrs)
+	}
+
+	return nil, nil
+}
+
+// dumpBridgePortsSTP retrieves the spanning tree state of all the bridge ports
+// of the namespace
+func dumpBridgePortsSTP(socket *nl.NetlinkSocket) ([]*bridgePortSTP, error) {
+	req := nl.NewNetlinkRequest(syscall.RTM_GETLINK, syscall.NLM_F_DUMP)
+	req.AddData(nl.NewIfInfomsg(syscall.AF_BRIDGE))
+	req.Sockets = map[int]*nl.SocketHandle{
+		syscall.NETLINK_ROUTE: {Socket: socket},
+	}
+
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, syscall.RTM_NEWLINK)
+	if err != nil {
+		return nil, err
+	}
+
+	var ports []*bridgePortSTP
+	for _, m := range msgs {
+		ifmsg := nl.DeserializeIfInfomsg(m)
+		attrs, err := nl.ParseRouteAttr(m[ifmsg.Len():])
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := parseBridgePortSTP(int(ifmsg.Index), attrs)
+		if err != nil {
+			return nil, err
+		}
+		if port != nil {
+			ports = append(ports, port)
+		}
+	}
+
+	return ports, nil
+}
+
+// stpRole derives the role of a port as the Linux bridge doesn't report it
+func stpRole(bridge *bridgeSTP, port *bridgePortSTP) string {
+	switch {
+	case port.state == 0:
+		return "disabled"
+	case port.portNo == bridge.rootPort:
+		return "root"
+	case port.designatedBridge == bridge.bridgeID && port.designatedPort == port.portID:
+		return "designated"
+	default:
+		return "alternate"
+	}
+}
+
+func stpState(state uint8) string {
+	if int(state) < len(stpStates) {
+		return stpStates[state]
+	}
+	return "unknown"
+}
+
+// updateBridgesSTP reports the spanning tree state of the bridges and of
+// their ports. It shares the statistics socket as both are only used by the
+// probe goroutine.
+func (u *NetNsProbe) updateBridgesSTP() {
+	links := u.cloneLinkNodes()
+
+	u.Graph.RLock()
+	var indexes []int
+	for index, node := range links {
+		if linkType, _ := node.GetFieldString("Type"); linkType == "bridge" {
+			indexes = append(indexes, index)
+		}
+	}
+	u.Graph.RUnlock()
+
+	if len(indexes) == 0 {
+		return
+	}
+
+	socket := u.statsCollector.socket
+
+	bridges := make(map[int]*bridgeSTP)
+	for _, index := range indexes {
+		stp, err := getBridgeSTP(socket, index)
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to retrieve the spanning tree state of bridge %d within %s: %s", index, u.Root.ID, err)
+			continue
+		}
+		if stp != nil && stp.enabled {
+			bridges[index] = stp
+		}
+	}
+
+	ports, err := dumpBridgePortsSTP(socket)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to retrieve the spanning tree state of the bridge ports within %s: %s", u.Root.ID, err)
+		return
+	}
+
+	u.Graph.Lock()
+	defer u.Graph.Unlock()
+
+	updated := make(map[int]bool)
+	portNames := make(map[int]map[uint16]string)
+	for _, port := range ports {
+		node, found := links[port.index]
+		bridge := bridges[port.master]
+		if !found || bridge == nil {
+			continue
+		}
+
+		if portNames[port.master] == nil {
+			portNames[port.master] = make(map[uint16]string)
+		}
+		portNames[port.master][port.portNo], _ = node.GetFieldString("Name")
+
+		topology.SetSTP(u.Graph, node, map[string]interface{}{
+			"State":            stpState(port.state),
+			"Role":             stpRole(bridge, port),
+			"PortID":           fmt.Sprintf("%x", port.portID),
+			"DesignatedBridge": port.designatedBridge,
+			"DesignatedCost":   int64(port.designatedCost),
+		})
+		updated[port.index] = true
+	}
+
+	for index, bridge := range bridges {
+		stp := map[string]interface{}{
+			"Protocol":     "stp",
+			"BridgeID":     bridge.bridgeID,
+			"RootID":       bridge.rootID,
+			"RootPathCost": int64(bridge.rootPathCost),
+		}
+		if name, found := portNames[index][bridge.rootPort]; found && bridge.rootPort != 0 {
+			stp["RootPort"] = name
+		}
+		topology.SetSTP(u.Graph, links[index], stp)
+		updated[index] = true
+	}
+
+	// remove the state of the bridges and ports no longer running STP
+	for index, node := range links {
+		if !updated[index] {
+			topology.SetSTP(u.Graph, node, nil)
+		}
+	}
+}
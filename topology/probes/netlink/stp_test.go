@@ -0,0 +1,126 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestParseBridgeSTP(t *testing.T) {
+	native := nl.NativeEndian()
+
+	uint16Attr := func(v uint16) []byte {
+		b := make([]byte, 2)
+		native.PutUint16(b, v)
+		return b
+	}
+
+	uint32Attr := func(v uint32) []byte {
+		b := make([]byte, 4)
+		native.PutUint32(b, v)
+		return b
+	}
+
+	bridgeID := []byte{0x80, 0x00, 0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+
+	linkinfo := nl.NewRtAttr(syscall.IFLA_LINKINFO, nil)
+	nl.NewRtAttrChild(linkinfo, nl.IFLA_INFO_KIND, nl.NonZeroTerminated("bridge"))
+	data := nl.NewRtAttrChild(linkinfo, nl.IFLA_INFO_DATA, nil)
+	nl.NewRtAttrChild(data, iflaBrStpState, uint32Attr(1))
+	nl.NewRtAttrChild(data, iflaBrRootID, bridgeID)
+	nl.NewRtAttrChild(data, iflaBrBridgeID, bridgeID)
+	nl.NewRtAttrChild(data, iflaBrRootPort, uint16Attr(0))
+	nl.NewRtAttrChild(data, iflaBrRootPathCost, uint32Attr(100))
+
+	attrs, err := nl.ParseRouteAttr(linkinfo.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stp, err := parseBridgeSTP(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bridgeSTP{
+		enabled:      true,
+		bridgeID:     "8000.52:54:00:12:34:56",
+		rootID:       "8000.52:54:00:12:34:56",
+		rootPathCost: 100,
+	}
+	if stp == nil || *stp != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stp)
+	}
+
+	if stp, _ = parseBridgeSTP(nil); stp != nil {
+		t.Errorf("Expected no spanning tree state without link info, got %+v", stp)
+	}
+}
+
+func TestParseBridgePortSTP(t *testing.T) {
+	native := nl.NativeEndian()
+
+	uint16Attr := func(v uint16) []byte {
+		b := make([]byte, 2)
+		native.PutUint16(b, v)
+		return b
+	}
+
+	master := nl.NewRtAttr(syscall.IFLA_MASTER, nl.Uint32Attr(3))
+	protinfo := nl.NewRtAttr(syscall.IFLA_PROTINFO, nil)
+	nl.NewRtAttrChild(protinfo, iflaBrportState, []byte{3})
+	nl.NewRtAttrChild(protinfo, iflaBrportBridgeID, []byte{0x80, 0x00, 0x52, 0x54, 0x00, 0x12, 0x34, 0x56})
+	nl.NewRtAttrChild(protinfo, iflaBrportDesignatedPort, uint16Attr(0x8001))
+	nl.NewRtAttrChild(protinfo, iflaBrportDesignatedCost, nl.Uint32Attr(4))
+	nl.NewRtAttrChild(protinfo, iflaBrportID, uint16Attr(0x8001))
+	nl.NewRtAttrChild(protinfo, iflaBrportNo, uint16Attr(1))
+
+	attrs, err := nl.ParseRouteAttr(append(master.Serialize(), protinfo.Serialize()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := parseBridgePortSTP(5, attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bridgePortSTP{
+		index:            5,
+		master:           3,
+		state:            3,
+		portID:           0x8001,
+		portNo:           1,
+		designatedBridge: "8000.52:54:00:12:34:56",
+		designatedPort:   0x8001,
+		designatedCost:   4,
+	}
+	if port == nil || *port != expected {
+		t.Errorf("Expected %+v, got %+v", expected, port)
+	}
+
+	// a port without protocol information is not enslaved to a bridge
+	if port, _ = parseBridgePortSTP(5, attrs[:1]); port != nil {
+		t.Errorf("Expected no port state without protocol information, got %+v", port)
+	}
+}
@@ -0,0 +1,259 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+const vethPairingInterval = time.Second
+
+// vethEnd describes one end of a veth pair as seen from its namespace
+type vethEnd struct {
+	id          graph.Identifier
+	root        graph.Identifier
+	nsName      string
+	ifIndex     int64
+	peerIfIndex int64
+	// the peer lives in another namespace, according to IFLA_LINK_NETNSID
+	remotePeer bool
+	peerNsName string
+	peer       *vethEnd
+}
+
+// vethPairer pairs the veths of all the namespaces. The ends are indexed
+// by interface index so that the peer of a veth is found without walking
+// the graph, the edges being created in batch under a single graph lock.
+// The graph lock is always taken before the pairer one.
+type vethPairer struct {
+	sync.Mutex
+	graph   *graph.Graph
+	ends    map[graph.Identifier]*vethEnd
+	byIndex map[int64]map[graph.Identifier]*vethEnd
+	pending map[graph.Identifier]*vethEnd
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func (p *vethPairer) index(end *vethEnd) {
+	ends, ok := p.byIndex[end.ifIndex]
+	if !ok {
+		ends = make(map[graph.Identifier]*vethEnd)
+		p.byIndex[end.ifIndex] = ends
+	}
+	ends[end.id] = end
+}
+
+func (p *vethPairer) unindex(end *vethEnd) {
+	if ends, ok := p.byIndex[end.ifIndex]; ok {
+		delete(ends, end.id)
+		if len(ends) == 0 {
+			delete(p.byIndex, end.ifIndex)
+		}
+	}
+}
+
+// add registers or refreshes a veth end, queueing it for pairing if needed
+func (p *vethPairer) add(end *vethEnd) {
+	p.Lock()
+	defer p.Unlock()
+
+	if old, ok := p.ends[end.id]; ok {
+		if old.ifIndex == end.ifIndex && old.peerIfIndex == end.peerIfIndex && old.root == end.root {
+			// only the namespace information can be refined
+			old.remotePeer, old.peerNsName, old.nsName = end.remotePeer, end.peerNsName, end.nsName
+			return
+		}
+		p.remove(old)
+	}
+
+	p.ends[end.id] = end
+	p.index(end)
+	p.pending[end.id] = end
+}
+
+func (p *vethPairer) remove(end *vethEnd) {
+	delete(p.ends, end.id)
+	delete(p.pending, end.id)
+	p.unindex(end)
+
+	// the peer may get a new end, after having been moved to another namespace
+	if peer := end.peer; peer != nil {
+		peer.peer = nil
+		if _, ok := p.ends[peer.id]; ok {
+			p.pending[peer.id] = peer
+		}
+	}
+}
+
+// del removes the end of a deleted interface
+func (p *vethPairer) del(id graph.Identifier) {
+	p.Lock()
+	defer p.Unlock()
+
+	if end, ok := p.ends[id]; ok {
+		p.remove(end)
+	}
+}
+
+// delRoot removes all the ends of a namespace
+func (p *vethPairer) delRoot(root graph.Identifier) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, end := range p.ends {
+		if end.root == root {
+			p.remove(end)
+		}
+	}
+}
+
+// accepts returns whether candidate can be the peer of end according to
+// the namespace information of end
+func (end *vethEnd) accepts(candidate *vethEnd) bool {
+	if candidate.id == end.id || candidate.peerIfIndex != end.ifIndex {
+		return false
+	}
+
+	if !end.remotePeer {
+		return candidate.root == end.root
+	}
+
+	if candidate.root == end.root {
+		return false
+	}
+
+	return end.peerNsName == "" || candidate.nsName == "" || end.peerNsName == candidate.nsName
+}
+
+// match returns the peer of an end, nil if not known yet or ambiguous
+func (p *vethPairer) match(end *vethEnd) *vethEnd {
+	var found *vethEnd
+	for _, candidate := range p.byIndex[end.peerIfIndex] {
+		if candidate.peer != nil || !end.accepts(candidate) || !candidate.accepts(end) {
+			continue
+		}
+
+		if found != nil {
+			// the same pair of indexes exists in several namespaces,
+			// wait for the namespace names to be resolved
+			return nil
+		}
+		found = candidate
+	}
+	return found
+}
+
+// resolve pairs the pending ends, returns the number of created pairs and
+// the number of ends still waiting for their peer
+func (p *vethPairer) resolve() (int, int) {
+	p.Lock()
+	empty := len(p.pending) == 0
+	p.Unlock()
+
+	if empty {
+		return 0, 0
+	}
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	p.Lock()
+	defer p.Unlock()
+
+	paired := 0
+	for id, end := range p.pending {
+		if end.peer != nil {
+			delete(p.pending, id)
+			continue
+		}
+
+		node := p.graph.GetNode(end.id)
+		if node == nil {
+			p.remove(end)
+			continue
+		}
+
+		peer := p.match(end)
+		if peer == nil {
+			continue
+		}
+
+		peerNode := p.graph.GetNode(peer.id)
+		if peerNode == nil {
+			p.remove(peer)
+			continue
+		}
+
+		if !topology.HaveLayer2Link(p.graph, peerNode, node) {
+			topology.AddLayer2Link(p.graph, peerNode, node, graph.Metadata{"Type": "veth"})
+		}
+
+		end.peer, peer.peer = peer, end
+		delete(p.pending, end.id)
+		delete(p.pending, peer.id)
+		paired++
+	}
+
+	return paired, len(p.pending)
+}
+
+func (p *vethPairer) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(vethPairingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+			if paired, unpaired := p.resolve(); paired > 0 {
+				logging.GetLogger().Debugf("%d veth pairs created, %d veths waiting for their peer", paired, unpaired)
+			}
+		}
+	}
+}
+
+func (p *vethPairer) start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+func (p *vethPairer) stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+func newVethPairer(g *graph.Graph) *vethPairer {
+	return &vethPairer{
+		graph:   g,
+		ends:    make(map[graph.Identifier]*vethEnd),
+		byIndex: make(map[int64]map[graph.Identifier]*vethEnd),
+		pending: make(map[graph.Identifier]*vethEnd),
+		quit:    make(chan struct{}),
+	}
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package netlink
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestVethMatch(t *testing.T) {
+	p := newVethPairer(nil)
+
+	// the same pair of indexes in two namespaces, the peers being in the host
+	p.add(&vethEnd{id: "host-a", root: "host", ifIndex: 10, peerIfIndex: 2, remotePeer: true, peerNsName: "ns1"})
+	p.add(&vethEnd{id: "host-b", root: "host", ifIndex: 11, peerIfIndex: 2, remotePeer: true, peerNsName: "ns2"})
+	p.add(&vethEnd{id: "ns1-eth0", root: "ns1", nsName: "ns1", ifIndex: 2, peerIfIndex: 10, remotePeer: true})
+	p.add(&vethEnd{id: "ns2-eth0", root: "ns2", nsName: "ns2", ifIndex: 2, peerIfIndex: 11, remotePeer: true})
+
+	// a local pair
+	p.add(&vethEnd{id: "host-c", root: "host", ifIndex: 20, peerIfIndex: 21})
+	p.add(&vethEnd{id: "host-d", root: "host", ifIndex: 21, peerIfIndex: 20})
+
+	expected := map[graph.Identifier]graph.Identifier{
+		"host-a":   "ns1-eth0",
+		"host-b":   "ns2-eth0",
+		"ns1-eth0": "host-a",
+		"ns2-eth0": "host-b",
+		"host-c":   "host-d",
+		"host-d":   "host-c",
+	}
+
+	for id, peerID := range expected {
+		peer := p.match(p.ends[id])
+		if peer == nil || peer.id != peerID {
+			t.Errorf("Expected %s to be paired with %s, got %+v", id, peerID, peer)
+		}
+	}
+}
+
+func TestVethMatchAmbiguous(t *testing.T) {
+	p := newVethPairer(nil)
+
+	// the namespace names are not resolved yet
+	p.add(&vethEnd{id: "host-a", root: "host", ifIndex: 10, peerIfIndex: 2, remotePeer: true})
+	p.add(&vethEnd{id: "ns1-eth0", root: "ns1", nsName: "ns1", ifIndex: 2, peerIfIndex: 10, remotePeer: true})
+	p.add(&vethEnd{id: "ns2-eth0", root: "ns2", nsName: "ns2", ifIndex: 2, peerIfIndex: 10, remotePeer: true})
+
+	if peer := p.match(p.ends["host-a"]); peer != nil {
+		t.Errorf("Expected no peer, got %+v", peer)
+	}
+
+	// the name of the peer namespace gets resolved
+	p.add(&vethEnd{id: "host-a", root: "host", ifIndex: 10, peerIfIndex: 2, remotePeer: true, peerNsName: "ns2"})
+
+	if peer := p.match(p.ends["host-a"]); peer == nil || peer.id != "ns2-eth0" {
+		t.Errorf("Expected ns2-eth0 as peer, got %+v", peer)
+	}
+}
+
+func TestVethPeerDeleted(t *testing.T) {
+	p := newVethPairer(nil)
+
+	a := &vethEnd{id: "a", root: "host", ifIndex: 1, peerIfIndex: 2}
+	b := &vethEnd{id: "b", root: "host", ifIndex: 2, peerIfIndex: 1}
+	p.add(a)
+	p.add(b)
+
+	a.peer, b.peer = b, a
+	delete(p.pending, a.id)
+	delete(p.pending, b.id)
+
+	p.del("b")
+
+	if a.peer != nil {
+		t.Error("Expected the peer to be reset")
+	}
+
+	if _, ok := p.pending["a"]; !ok {
+		t.Error("Expected the end to be pending again")
+	}
+
+	if _, ok := p.byIndex[2]; ok {
+		t.Error("Expected the deleted end to be unindexed")
+	}
+}
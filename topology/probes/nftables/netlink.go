@@ -0,0 +1,457 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftables
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/topology/probes/netlink/nlattr"
+)
+
+// Defined by the nf_tables uapi, not by the netlink package
+const (
+	nfnlSubsysNftables = 10
+	nfnetlinkV0        = 0
+	nfnlGrpNftables    = 7
+	sizeofNfgenmsg     = 4
+
+	nftMsgGetTable = 1
+	nftMsgGetChain = 4
+	nftMsgGetRule  = 7
+	nftMsgNewGen   = 16
+
+	nftaTableName   = 1
+	nftaTableFlags  = 2
+	nftaTableHandle = 4
+
+	nftaChainTable  = 1
+	nftaChainHandle = 2
+	nftaChainName   = 3
+	nftaChainHook   = 4
+	nftaChainPolicy = 5
+	nftaChainType   = 7
+
+	nftaHookHooknum  = 1
+	nftaHookPriority = 2
+	nftaHookDev      = 3
+
+	nftaRuleTable       = 1
+	nftaRuleChain       = 2
+	nftaRuleHandle      = 3
+	nftaRuleExpressions = 4
+	nftaRuleUserdata    = 7
+
+	nftaListElem = 1
+	nftaExprName = 1
+	nftaExprData = 2
+
+	nftaImmediateData = 2
+	nftaDataVerdict   = 2
+	nftaVerdictCode   = 1
+	nftaVerdictChain  = 2
+
+	nftnlUdataRuleComment = 0
+
+	nfprotoInet   = 1
+	nfprotoIPv4   = 2
+	nfprotoARP    = 3
+	nfprotoNetdev = 5
+	nfprotoBridge = 7
+	nfprotoIPv6   = 10
+)
+
+var verdicts = map[int32]string{
+	0:  "drop",
+	1:  "accept",
+	2:  "stolen",
+	3:  "queue",
+	4:  "repeat",
+	-1: "continue",
+	-2: "break",
+	-3: "jump",
+	-4: "goto",
+	-5: "return",
+}
+
+// nfgenmsg is the header of the netfilter netlink messages
+type nfgenmsg struct {
+	family  uint8
+	version uint8
+	resID   uint16
+}
+
+func (m *nfgenmsg) Len() int {
+	return sizeofNfgenmsg
+}
+
+func (m *nfgenmsg) Serialize() []byte {
+	b := make([]byte, sizeofNfgenmsg)
+	b[0], b[1] = m.family, m.version
+	binary.BigEndian.PutUint16(b[2:], m.resID)
+	return b
+}
+
+func attrString(attr syscall.NetlinkRouteAttr) string {
+	return strings.TrimRight(string(attr.Value), "\x00")
+}
+
+// the integers of nf_tables are in network byte order
+func attrUint32(attr syscall.NetlinkRouteAttr) uint32 {
+	if len(attr.Value) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(attr.Value)
+}
+
+func attrUint64(attr syscall.NetlinkRouteAttr) uint64 {
+	if len(attr.Value) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(attr.Value)
+}
+
+func familyName(family uint8) string {
+	switch family {
+	case nfprotoInet:
+		return "inet"
+	case nfprotoIPv4:
+		return "ip"
+	case nfprotoARP:
+		return "arp"
+	case nfprotoNetdev:
+		return "netdev"
+	case nfprotoBridge:
+		return "bridge"
+	case nfprotoIPv6:
+		return "ip6"
+	}
+	return strconv.Itoa(int(family))
+}
+
+func hookName(family uint8, hook uint32) string {
+	var hooks []string
+	switch family {
+	case nfprotoARP:
+		hooks = []string{"input", "output", "forward"}
+	case nfprotoNetdev:
+		hooks = []string{"ingress", "egress"}
+	default:
+		hooks = []string{"prerouting", "input", "forward", "output", "postrouting", "ingress"}
+	}
+
+	if int(hook) < len(hooks) {
+		return hooks[hook]
+	}
+	return strconv.Itoa(int(hook))
+}
+
+func verdictName(code int32, chain string) string {
+	name, ok := verdicts[code]
+	if !ok {
+		name = strconv.Itoa(int(code))
+	}
+
+	if chain != "" {
+		return name + " " + chain
+	}
+	return name
+}
+
+// splitMessage returns the family and the attributes of a nf_tables message
+func splitMessage(b []byte) (uint8, []syscall.NetlinkRouteAttr, error) {
+	if len(b) < sizeofNfgenmsg {
+		return 0, nil, fmt.Errorf("nf_tables message too short: %d", len(b))
+	}
+
+	attrs, err := nl.ParseRouteAttr(b[sizeofNfgenmsg:])
+	if err != nil {
+		return 0, nil, err
+	}
+	return b[0], attrs, nil
+}
+
+func parseTable(family uint8, attrs []syscall.NetlinkRouteAttr) *Table {
+	table := &Table{Family: familyName(family), Chains: []*Chain{}}
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case nftaTableName:
+			table.Name = attrString(attr)
+		case nftaTableFlags:
+			table.Flags = int64(attrUint32(attr))
+		case nftaTableHandle:
+			table.Handle = int64(attrUint64(attr))
+		}
+	}
+	return table
+}
+
+// parseChain returns a chain and the name of its table
+func parseChain(family uint8, attrs []syscall.NetlinkRouteAttr) (*Chain, string, error) {
+	var tableName string
+
+	chain := &Chain{Rules: []*Rule{}}
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case nftaChainTable:
+			tableName = attrString(attr)
+		case nftaChainName:
+			chain.Name = attrString(attr)
+		case nftaChainHandle:
+			chain.Handle = int64(attrUint64(attr))
+		case nftaChainType:
+			chain.Type = attrString(attr)
+		case nftaChainPolicy:
+			chain.Policy = verdictName(int32(attrUint32(attr)), "")
+		case nftaChainHook:
+			hookAttrs, err := nlattr.Nested(attr)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, hookAttr := range hookAttrs {
+				switch nlattr.Type(hookAttr) {
+				case nftaHookHooknum:
+					chain.Hook = hookName(family, attrUint32(hookAttr))
+				case nftaHookPriority:
+					chain.Priority = int64(int32(attrUint32(hookAttr)))
+				case nftaHookDev:
+					chain.Device = attrString(hookAttr)
+				}
+			}
+		}
+	}
+	return chain, tableName, nil
+}
+
+// parseVerdict returns the verdict of an immediate expression, if any
+func parseVerdict(attrs []syscall.NetlinkRouteAttr) (string, error) {
+	for _, attr := range attrs {
+		if nlattr.Type(attr) != nftaImmediateData {
+			continue
+		}
+
+		dataAttrs, err := nlattr.Nested(attr)
+		if err != nil {
+			return "", err
+		}
+		for _, dataAttr := range dataAttrs {
+			if nlattr.Type(dataAttr) != nftaDataVerdict {
+				continue
+			}
+
+			verdictAttrs, err := nlattr.Nested(dataAttr)
+			if err != nil {
+				return "", err
+			}
+
+			var code int32
+			var chain string
+			for _, verdictAttr := range verdictAttrs {
+				switch nlattr.Type(verdictAttr) {
+				case nftaVerdictCode:
+					code = int32(attrUint32(verdictAttr))
+				case nftaVerdictChain:
+					chain = attrString(verdictAttr)
+				}
+			}
+			return verdictName(code, chain), nil
+		}
+	}
+	return "", nil
+}
+
+// parseComment extracts the comment from the TLVs of the rule user data
+func parseComment(b []byte) string {
+	for len(b) >= 2 {
+		kind, length := b[0], int(b[1])
+		if len(b) < 2+length {
+			break
+		}
+		if kind == nftnlUdataRuleComment {
+			return strings.TrimRight(string(b[2:2+length]), "\x00")
+		}
+		b = b[2+length:]
+	}
+	return ""
+}
+
+// parseRule returns a rule and the names of its table and its chain
+func parseRule(attrs []syscall.NetlinkRouteAttr) (*Rule, string, string, error) {
+	var tableName, chainName string
+
+	rule := &Rule{Expressions: []string{}}
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case nftaRuleTable:
+			tableName = attrString(attr)
+		case nftaRuleChain:
+			chainName = attrString(attr)
+		case nftaRuleHandle:
+			rule.Handle = int64(attrUint64(attr))
+		case nftaRuleUserdata:
+			rule.Comment = parseComment(attr.Value)
+		case nftaRuleExpressions:
+			elems, err := nlattr.Nested(attr)
+			if err != nil {
+				return nil, "", "", err
+			}
+			for _, elem := range elems {
+				if nlattr.Type(elem) != nftaListElem {
+					continue
+				}
+
+				exprAttrs, err := nlattr.Nested(elem)
+				if err != nil {
+					return nil, "", "", err
+				}
+
+				var name string
+				var data []syscall.NetlinkRouteAttr
+				for _, exprAttr := range exprAttrs {
+					switch nlattr.Type(exprAttr) {
+					case nftaExprName:
+						name = attrString(exprAttr)
+					case nftaExprData:
+						if data, err = nlattr.Nested(exprAttr); err != nil {
+							return nil, "", "", err
+						}
+					}
+				}
+				rule.Expressions = append(rule.Expressions, name)
+
+				if name == "immediate" {
+					verdict, err := parseVerdict(data)
+					if err != nil {
+						return nil, "", "", err
+					}
+					if verdict != "" {
+						rule.Verdict = verdict
+					}
+				}
+			}
+		}
+	}
+	return rule, tableName, chainName, nil
+}
+
+// buildRuleset assembles the replies of the table, chain and rule dumps
+func buildRuleset(tables, chains, rules [][]byte) (*Ruleset, error) {
+	type chainKey struct {
+		family uint8
+		table  string
+		chain  string
+	}
+	type tableKey struct {
+		family uint8
+		table  string
+	}
+
+	ruleset := &Ruleset{Tables: []*Table{}}
+
+	tableIndex := make(map[tableKey]*Table)
+	for _, m := range tables {
+		family, attrs, err := splitMessage(m)
+		if err != nil {
+			return nil, err
+		}
+
+		table := parseTable(family, attrs)
+		tableIndex[tableKey{family, table.Name}] = table
+		ruleset.Tables = append(ruleset.Tables, table)
+	}
+
+	chainIndex := make(map[chainKey]*Chain)
+	for _, m := range chains {
+		family, attrs, err := splitMessage(m)
+		if err != nil {
+			return nil, err
+		}
+
+		chain, tableName, err := parseChain(family, attrs)
+		if err != nil {
+			return nil, err
+		}
+
+		// the table may have been added after the dump of the tables
+		table, ok := tableIndex[tableKey{family, tableName}]
+		if !ok {
+			continue
+		}
+		table.Chains = append(table.Chains, chain)
+		chainIndex[chainKey{family, tableName, chain.Name}] = chain
+	}
+
+	for _, m := range rules {
+		family, attrs, err := splitMessage(m)
+		if err != nil {
+			return nil, err
+		}
+
+		rule, tableName, chainName, err := parseRule(attrs)
+		if err != nil {
+			return nil, err
+		}
+
+		if chain, ok := chainIndex[chainKey{family, tableName, chainName}]; ok {
+			chain.Rules = append(chain.Rules, rule)
+		}
+	}
+
+	ruleset.sort()
+	return ruleset, nil
+}
+
+func dump(msgType int) ([][]byte, error) {
+	req := nl.NewNetlinkRequest(nfnlSubsysNftables<<8|msgType, syscall.NLM_F_DUMP)
+	req.AddData(&nfgenmsg{family: syscall.AF_UNSPEC, version: nfnetlinkV0})
+
+	return req.Execute(syscall.NETLINK_NETFILTER, 0)
+}
+
+// getRuleset retrieves the tables, the chains and the rules of all the
+// families
+func getRuleset() (*Ruleset, error) {
+	tables, err := dump(nftMsgGetTable)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dump nftables tables: %s", err)
+	}
+
+	chains, err := dump(nftMsgGetChain)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dump nftables chains: %s", err)
+	}
+
+	rules, err := dump(nftMsgGetRule)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dump nftables rules: %s", err)
+	}
+
+	return buildRuleset(tables, chains, rules)
+}
+
+// isNewGeneration returns whether a message notifies a ruleset commit
+func isNewGeneration(msg syscall.NetlinkMessage) bool {
+	return msg.Header.Type == nfnlSubsysNftables<<8|nftMsgNewGen
+}
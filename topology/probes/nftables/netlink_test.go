@@ -0,0 +1,178 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftables
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func message(family uint8, attrs ...*nl.RtAttr) []byte {
+	b := (&nfgenmsg{family: family, version: nfnetlinkV0}).Serialize()
+	for _, attr := range attrs {
+		b = append(b, attr.Serialize()...)
+	}
+	return b
+}
+
+func be32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func be64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func TestBuildRuleset(t *testing.T) {
+	tables := [][]byte{
+		message(nfprotoInet,
+			nl.NewRtAttr(nftaTableName, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaTableHandle, be64(1))),
+		message(nfprotoNetdev,
+			nl.NewRtAttr(nftaTableName, nl.ZeroTerminated("edge")),
+			nl.NewRtAttr(nftaTableHandle, be64(2))),
+	}
+
+	hook := nl.NewRtAttr(nftaChainHook, nil)
+	nl.NewRtAttrChild(hook, nftaHookHooknum, be32(1))
+	nl.NewRtAttrChild(hook, nftaHookPriority, be32(0xffffff9c)) // -100
+
+	devHook := nl.NewRtAttr(nftaChainHook, nil)
+	nl.NewRtAttrChild(devHook, nftaHookHooknum, be32(0))
+	nl.NewRtAttrChild(devHook, nftaHookPriority, be32(0))
+	nl.NewRtAttrChild(devHook, nftaHookDev, nl.ZeroTerminated("eth0"))
+
+	chains := [][]byte{
+		message(nfprotoInet,
+			nl.NewRtAttr(nftaChainTable, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaChainName, nl.ZeroTerminated("input")),
+			nl.NewRtAttr(nftaChainHandle, be64(3)),
+			nl.NewRtAttr(nftaChainType, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaChainPolicy, be32(0)),
+			hook),
+		message(nfprotoInet,
+			nl.NewRtAttr(nftaChainTable, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaChainName, nl.ZeroTerminated("allowed")),
+			nl.NewRtAttr(nftaChainHandle, be64(4))),
+		message(nfprotoNetdev,
+			nl.NewRtAttr(nftaChainTable, nl.ZeroTerminated("edge")),
+			nl.NewRtAttr(nftaChainName, nl.ZeroTerminated("ingress")),
+			nl.NewRtAttr(nftaChainHandle, be64(5)),
+			nl.NewRtAttr(nftaChainType, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaChainPolicy, be32(1)),
+			devHook),
+		// the chain of a table created after the dump of the tables
+		message(nfprotoIPv4,
+			nl.NewRtAttr(nftaChainTable, nl.ZeroTerminated("nat")),
+			nl.NewRtAttr(nftaChainName, nl.ZeroTerminated("postrouting"))),
+	}
+
+	expr := func(list *nl.RtAttr, name string) *nl.RtAttr {
+		elem := nl.NewRtAttrChild(list, nftaListElem, nil)
+		nl.NewRtAttrChild(elem, nftaExprName, nl.ZeroTerminated(name))
+		return elem
+	}
+
+	expressions := func(verdictCode uint32, verdictChain string, names ...string) *nl.RtAttr {
+		list := nl.NewRtAttr(nftaRuleExpressions, nil)
+		for _, name := range names {
+			expr(list, name)
+		}
+
+		data := nl.NewRtAttrChild(expr(list, "immediate"), nftaExprData, nil)
+		immediate := nl.NewRtAttrChild(data, nftaImmediateData, nil)
+		verdict := nl.NewRtAttrChild(immediate, nftaDataVerdict, nil)
+		nl.NewRtAttrChild(verdict, nftaVerdictCode, be32(verdictCode))
+		if verdictChain != "" {
+			nl.NewRtAttrChild(verdict, nftaVerdictChain, nl.ZeroTerminated(verdictChain))
+		}
+		return list
+	}
+
+	comment := append([]byte{nftnlUdataRuleComment, 4}, nl.ZeroTerminated("ssh")...)
+
+	rules := [][]byte{
+		message(nfprotoInet,
+			nl.NewRtAttr(nftaRuleTable, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaRuleChain, nl.ZeroTerminated("input")),
+			nl.NewRtAttr(nftaRuleHandle, be64(10)),
+			expressions(0xfffffffd, "allowed", "payload", "cmp")),
+		message(nfprotoInet,
+			nl.NewRtAttr(nftaRuleTable, nl.ZeroTerminated("filter")),
+			nl.NewRtAttr(nftaRuleChain, nl.ZeroTerminated("allowed")),
+			nl.NewRtAttr(nftaRuleHandle, be64(11)),
+			nl.NewRtAttr(nftaRuleUserdata, comment),
+			expressions(1, "", "meta", "cmp", "counter")),
+	}
+
+	ruleset, err := buildRuleset(tables, chains, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Ruleset{
+		Tables: []*Table{
+			{
+				Name:   "filter",
+				Family: "inet",
+				Handle: 1,
+				Chains: []*Chain{
+					{
+						Name:   "allowed",
+						Handle: 4,
+						Rules: []*Rule{
+							{Handle: 11, Expressions: []string{"meta", "cmp", "counter", "immediate"}, Verdict: "accept", Comment: "ssh"},
+						},
+					},
+					{
+						Name:     "input",
+						Handle:   3,
+						Type:     "filter",
+						Hook:     "input",
+						Priority: -100,
+						Policy:   "drop",
+						Rules: []*Rule{
+							{Handle: 10, Expressions: []string{"payload", "cmp", "immediate"}, Verdict: "jump allowed"},
+						},
+					},
+				},
+			},
+			{
+				Name:   "edge",
+				Family: "netdev",
+				Handle: 2,
+				Chains: []*Chain{
+					{Name: "ingress", Handle: 5, Type: "filter", Hook: "ingress", Policy: "accept", Device: "eth0", Rules: []*Rule{}},
+				},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(ruleset, expected) {
+		t.Errorf("Unexpected ruleset, got:\n%+v\nexpected:\n%+v", ruleset, expected)
+	}
+}
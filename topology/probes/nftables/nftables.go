@@ -0,0 +1,171 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftables
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Probe describes a probe reporting the nftables ruleset of the host
+type Probe struct {
+	graph   *graph.Graph
+	root    *graph.Node
+	resync  time.Duration
+	ruleset *Ruleset
+	failed  bool
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// update writes the ruleset into the metadata of the host node, only when
+// it changed so that each change is a single entry of the graph history
+func (p *Probe) update() {
+	ruleset, err := getRuleset()
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	if err != nil {
+		if !p.failed {
+			logging.GetLogger().Error(err)
+			topology.SetProbeError(p.graph, "nftables", err, p.root)
+			p.failed = true
+		}
+		return
+	}
+	if p.failed {
+		topology.ClearProbeError(p.graph, "nftables", p.root)
+		p.failed = false
+	}
+
+	if !reflect.DeepEqual(p.ruleset, ruleset) {
+		p.graph.AddMetadata(p.root, "Nftables", ruleset)
+		p.ruleset = ruleset
+	}
+}
+
+// monitor notifies the commits of new ruleset generations
+func (p *Probe) monitor(ctx context.Context, changed chan<- struct{}) {
+	defer p.wg.Done()
+
+	socket, err := nl.Subscribe(syscall.NETLINK_NETFILTER, nfnlGrpNftables)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to monitor nftables, the ruleset will be read every %s: %s", p.resync, err)
+		return
+	}
+
+	// closing the socket interrupts the reception
+	go func() {
+		<-ctx.Done()
+		socket.Close()
+	}()
+
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	for {
+		msgs, err := socket.Receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			// notifications were lost, read the whole ruleset again
+			if err == syscall.ENOBUFS {
+				notify()
+				continue
+			}
+
+			logging.GetLogger().Errorf("Failed to receive nftables notifications: %s", err)
+			return
+		}
+
+		for _, msg := range msgs {
+			if isNewGeneration(msg) {
+				notify()
+			}
+		}
+	}
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	changed := make(chan struct{}, 1)
+
+	p.wg.Add(2)
+	go p.monitor(ctx, changed)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.resync)
+		defer ticker.Stop()
+
+		for {
+			p.update()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// NewProbeFromConfig returns a new nftables probe reporting the ruleset of
+// the given host node
+func NewProbeFromConfig(g *graph.Graph, root *graph.Node) (*Probe, error) {
+	resync := config.GetInt("agent.topology.nftables.resync")
+	if resync <= 0 {
+		return nil, fmt.Errorf("Invalid nftables resync interval %d", resync)
+	}
+
+	return &Probe{
+		graph:  g,
+		root:   root,
+		resync: time.Duration(resync) * time.Second,
+	}, nil
+}
@@ -0,0 +1,42 @@
+// +build !linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nftables
+
+import (
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+// Probe describes a probe reporting the nftables ruleset of the host
+type Probe struct {
+}
+
+// Start the probe
+func (p *Probe) Start() {
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+}
+
+// NewProbeFromConfig returns a new nftables probe
+func NewProbeFromConfig(g *graph.Graph, root *graph.Node) (*Probe, error) {
+	return nil, common.ErrNotImplemented
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package nftables reports the nftables ruleset of the host of the agent.
+// The tables, the chains and the rules, read with the nf_tables netlink API,
+// are written into the Nftables metadata of the host node, which is updated
+// each time a new ruleset generation is committed.
+package nftables
+
+import (
+	"sort"
+)
+
+// Rule describes a rule of a chain
+type Rule struct {
+	Handle      int64
+	Expressions []string
+	Verdict     string `json:",omitempty"`
+	Comment     string `json:",omitempty"`
+}
+
+// Chain describes a chain of a table, a base chain being attached to a hook
+type Chain struct {
+	Name     string
+	Handle   int64
+	Type     string `json:",omitempty"`
+	Hook     string `json:",omitempty"`
+	Priority int64  `json:",omitempty"`
+	Policy   string `json:",omitempty"`
+	Device   string `json:",omitempty"`
+	Rules    []*Rule
+}
+
+// Table describes a table and its chains
+type Table struct {
+	Name   string
+	Family string
+	Handle int64
+	Flags  int64 `json:",omitempty"`
+	Chains []*Chain
+}
+
+// Ruleset describes the Nftables metadata of a host
+type Ruleset struct {
+	Tables []*Table
+}
+
+// sort orders the tables and the chains by name, the rules being kept in
+// their evaluation order
+func (r *Ruleset) sort() {
+	sort.Slice(r.Tables, func(i, j int) bool {
+		if r.Tables[i].Family != r.Tables[j].Family {
+			return r.Tables[i].Family < r.Tables[j].Family
+		}
+		return r.Tables[i].Name < r.Tables[j].Name
+	})
+
+	for _, table := range r.Tables {
+		sort.Slice(table.Chains, func(i, j int) bool { return table.Chains[i].Name < table.Chains[j].Name })
+	}
+}
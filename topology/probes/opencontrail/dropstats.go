@@ -0,0 +1,338 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// Sources of the vrouter drop statistics, selected with
+// opencontrail.drop_stats.source
+const (
+	dropStatsDropstats  = "dropstats"
+	dropStatsIntrospect = "introspect"
+)
+
+// Categories of the vrouter drop counters
+const (
+	dropCategoryInterface = "Interface"
+	dropCategoryFlow      = "Flow"
+	dropCategoryARP       = "ARP"
+	dropCategoryNexthop   = "Nexthop"
+	dropCategoryLabel     = "Label"
+	dropCategoryFragment  = "Fragment"
+	dropCategoryPacket    = "Packet"
+	dropCategoryOther     = "Other"
+)
+
+// dropCategoryKeywords maps the words of the counter names to their
+// category, the first matching word, in this order, giving the category
+var dropCategoryKeywords = []struct {
+	category string
+	words    []string
+}{
+	{dropCategoryFlow, []string{"flow", "flows"}},
+	{dropCategoryARP, []string{"arp", "arps", "garp", "rarp"}},
+	{dropCategoryFragment, []string{"frag", "fragment", "fragments", "fragmentation"}},
+	{dropCategoryLabel, []string{"label", "mpls", "vxlan", "vnid"}},
+	{dropCategoryNexthop, []string{"nh", "nexthop", "nexthops", "composite"}},
+	{dropCategoryInterface, []string{"if", "interface", "vif", "tx", "rx", "queue"}},
+	{dropCategoryPacket, []string{"invalid", "malformed", "checksum", "cksum", "ttl", "packet", "packets", "pkt", "protocol", "source", "mcast", "multicast", "l2", "l3"}},
+}
+
+// OpenContrailDropSample holds the drops of the vrouter during an interval,
+// in total and per category
+// easyjson:json
+type OpenContrailDropSample struct {
+	Time       int64
+	Total      int64
+	Categories map[string]int64
+}
+
+// OpenContrailDropStats holds the drop counters of the vrouter dataplane,
+// the non-null counters being reported by name and summed by category.
+// Delta holds the drops since the previous collection, History the last
+// ones.
+// easyjson:json
+type OpenContrailDropStats struct {
+	Time       int64
+	Total      int64
+	Counters   map[string]int64
+	Categories map[string]int64
+	Delta      OpenContrailDropSample
+	History    []OpenContrailDropSample `json:",omitempty"`
+}
+
+// dropStatsCollector periodically collects the drop counters of the
+// vrouter, either with the dropstats utility or from the agent introspect
+type dropStatsCollector struct {
+	source   string
+	cmd      rtCommand
+	url      string
+	client   *http.Client
+	interval time.Duration
+	history  int
+	last     *OpenContrailDropStats
+}
+
+// dropCounterName normalizes the name of a counter, the names printed by
+// dropstats and the ones of the introspect fields then being the same
+func dropCounterName(name string) string {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "ds_")
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '_' || r == '-'
+	}), "_")
+}
+
+// dropCategory returns the category of a counter
+func dropCategory(name string) string {
+	words := strings.Split(name, "_")
+	for _, k := range dropCategoryKeywords {
+		for _, w := range words {
+			for _, keyword := range k.words {
+				if w == keyword {
+					return k.category
+				}
+			}
+		}
+	}
+	return dropCategoryOther
+}
+
+// parseDropstats parses the output of dropstats, made of lines holding the
+// name of a counter followed by its value
+func parseDropstats(r io.Reader) (map[string]int64, error) {
+	counters := make(map[string]int64)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		value, err := strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		counters[dropCounterName(strings.Join(fields[:len(fields)-1], " "))] += value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+// parseDropStatsIntrospect parses the response of KDropStatsReq, the ds_
+// fields holding the counters. The counters reported per core are summed.
+func parseDropStatsIntrospect(r io.Reader) (map[string]int64, error) {
+	counters := make(map[string]int64)
+
+	decoder := xml.NewDecoder(r)
+	var field string
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return counters, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			field = ""
+			if strings.HasPrefix(t.Name.Local, "ds_") {
+				field = t.Name.Local
+			}
+		case xml.CharData:
+			if field == "" {
+				continue
+			}
+			if value, err := strconv.ParseInt(strings.TrimSpace(string(t)), 10, 64); err == nil {
+				counters[dropCounterName(field)] += value
+			}
+		case xml.EndElement:
+			field = ""
+		}
+	}
+}
+
+// newDropStats returns the statistics of the given counters, the drops
+// since the previous statistics being computed from their counters. A
+// counter lower than its previous value was reset, by a reload of the
+// vrouter module.
+func newDropStats(counters map[string]int64, previous *OpenContrailDropStats, now time.Time, history int) *OpenContrailDropStats {
+	stats := &OpenContrailDropStats{
+		Time:       common.UnixMillis(now),
+		Counters:   make(map[string]int64),
+		Categories: make(map[string]int64),
+		Delta: OpenContrailDropSample{
+			Time:       common.UnixMillis(now),
+			Categories: make(map[string]int64),
+		},
+	}
+
+	for name, value := range counters {
+		if value == 0 {
+			continue
+		}
+
+		category := dropCategory(name)
+		stats.Counters[name] = value
+		stats.Categories[category] += value
+		stats.Total += value
+
+		delta := value
+		if previous != nil {
+			if last := previous.Counters[name]; last <= value {
+				delta = value - last
+			}
+		}
+		if delta != 0 {
+			stats.Delta.Categories[category] += delta
+			stats.Delta.Total += delta
+		}
+	}
+
+	if previous != nil && history > 0 {
+		stats.History = append(stats.History, previous.History...)
+		stats.History = append(stats.History, stats.Delta)
+		if len(stats.History) > history {
+			stats.History = stats.History[len(stats.History)-history:]
+		}
+	}
+
+	return stats
+}
+
+func (c *dropStatsCollector) counters(ctx context.Context) (map[string]int64, error) {
+	if c.source == dropStatsIntrospect {
+		req, err := http.NewRequest("GET", c.url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Failed to get the drop statistics from %s: %s", c.url, resp.Status)
+		}
+		return parseDropStatsIntrospect(resp.Body)
+	}
+
+	stdout, wait, err := c.cmd.start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer wait()
+
+	return parseDropstats(stdout)
+}
+
+// setDropStats writes the drop statistics into the Contrail.DropStats
+// metadata of the vhost, of the host when the vhost is not known yet
+func (mapper *Probe) setDropStats(stats *OpenContrailDropStats) {
+	mapper.graph.Lock()
+	defer mapper.graph.Unlock()
+
+	node := mapper.vHost
+	if node == nil {
+		node = mapper.root
+	}
+	mapper.addMetadata(node, "Contrail.DropStats", stats)
+}
+
+// dropStatsUpdater periodically collects the drop counters of the vrouter
+func (mapper *Probe) dropStatsUpdater() {
+	logging.GetLogger().Debugf("Starting OpenContrail drop statistics updater")
+	defer logging.GetLogger().Debugf("Stopping OpenContrail drop statistics updater")
+
+	c := mapper.dropStats
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if counters, err := c.counters(mapper.ctx); err != nil {
+			if mapper.ctx.Err() == nil {
+				logging.GetLogger().Errorf("Failed to collect the vrouter drop statistics: %s", err)
+			}
+		} else {
+			c.last = newDropStats(counters, c.last, time.Now(), c.history)
+			mapper.setDropStats(c.last)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-mapper.ctx.Done():
+			return
+		}
+	}
+}
+
+// newDropStatsCollectorFromConfig returns the collector of the drop
+// statistics, nil if disabled
+func newDropStatsCollectorFromConfig(host string, port int) (*dropStatsCollector, error) {
+	interval := config.GetInt("opencontrail.drop_stats.interval")
+	if interval <= 0 {
+		return nil, nil
+	}
+
+	c := &dropStatsCollector{
+		source:   config.GetString("opencontrail.drop_stats.source"),
+		interval: time.Duration(interval) * time.Second,
+		history:  config.GetInt("opencontrail.drop_stats.history"),
+	}
+
+	switch c.source {
+	case dropStatsDropstats:
+		cmd, err := newRtCommandFromConfig(config.GetString("opencontrail.drop_stats.path"))
+		if err != nil {
+			return nil, err
+		}
+		c.cmd = cmd
+	case dropStatsIntrospect:
+		c.url = fmt.Sprintf("http://%s/Snh_KDropStatsReq", net.JoinHostPort(host, strconv.Itoa(port)))
+		c.client = &http.Client{Timeout: 10 * time.Second}
+	default:
+		return nil, fmt.Errorf("Invalid drop statistics source '%s', should be %s or %s", c.source, dropStatsDropstats, dropStatsIntrospect)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,105 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dropstatsOutput = `Invalid IF                    2
+Trap No IF                    0
+IF TX Discard                 0
+
+Flow Unusable                 5
+Flow No Memory                1
+Flow Queue Limit Exceeded     0
+
+Invalid ARPs                  3
+Invalid NH                    4
+Cloned Original               7
+`
+
+const dropStatsIntrospectOutput = `<?xml-stylesheet type="text/xsl" href="/universal_parse.xsl"?>
+<KDropStatsResp type="sandesh">
+<ds_discard type="u64" identifier="1">0</ds_discard>
+<ds_flow_unusable type="u64" identifier="7">5</ds_flow_unusable>
+<ds_invalid_arp type="u64" identifier="12">3</ds_invalid_arp>
+<ds_invalid_if type="u64" identifier="14">2</ds_invalid_if>
+<more type="bool">false</more>
+</KDropStatsResp>`
+
+func TestParseDropstats(t *testing.T) {
+	counters, err := parseDropstats(strings.NewReader(dropstatsOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counters["invalid_if"] != 2 || counters["flow_no_memory"] != 1 || counters["cloned_original"] != 7 {
+		t.Errorf("Wrong counters: %+v", counters)
+	}
+
+	stats := newDropStats(counters, nil, time.Now(), 10)
+	expected := map[string]int64{
+		dropCategoryInterface: 2,
+		dropCategoryFlow:      6,
+		dropCategoryARP:       3,
+		dropCategoryNexthop:   4,
+		dropCategoryOther:     7,
+	}
+	if !reflect.DeepEqual(expected, stats.Categories) {
+		t.Errorf("Expected categories %+v, got %+v", expected, stats.Categories)
+	}
+	if stats.Total != 22 || stats.Delta.Total != 22 {
+		t.Errorf("Wrong totals: %+v", stats)
+	}
+}
+
+func TestParseDropStatsIntrospect(t *testing.T) {
+	counters, err := parseDropStatsIntrospect(strings.NewReader(dropStatsIntrospectOutput))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{"discard": 0, "flow_unusable": 5, "invalid_arp": 3, "invalid_if": 2}
+	if !reflect.DeepEqual(expected, counters) {
+		t.Errorf("Expected %+v, got %+v", expected, counters)
+	}
+}
+
+func TestDropStatsHistory(t *testing.T) {
+	now := time.Now()
+
+	stats := newDropStats(map[string]int64{"flow_unusable": 5}, nil, now, 2)
+	for i, value := range []int64{8, 8, 2} {
+		stats = newDropStats(map[string]int64{"flow_unusable": value}, stats, now.Add(time.Duration(i+1)*time.Second), 2)
+	}
+
+	// the counter was reset by the last collection
+	if stats.Delta.Total != 2 || stats.Delta.Categories[dropCategoryFlow] != 2 {
+		t.Errorf("Wrong delta: %+v", stats.Delta)
+	}
+
+	if len(stats.History) != 2 || stats.History[0].Total != 0 || stats.History[1].Total != 2 {
+		t.Errorf("Wrong history: %+v", stats.History)
+	}
+}
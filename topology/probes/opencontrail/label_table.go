@@ -0,0 +1,217 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// OpenContrailLabel is an entry of the MPLS or VXLAN table of the vrouter,
+// mapping an incoming MPLS label or VNID to a nexthop. Vrf is the VRF of
+// the nexthop, when nh is available.
+// easyjson:json
+type OpenContrailLabel struct {
+	Label int  `json:"Label"`
+	NhId  int  `json:"NhId"`
+	Vrf   *int `json:"Vrf,omitempty"`
+}
+
+// OpenContrailLabelTable holds the MPLS and VXLAN tables of the vrouter,
+// used to decapsulate the overlay traffic received on the fabric
+// interfaces
+// easyjson:json
+type OpenContrailLabelTable struct {
+	MPLS  []OpenContrailLabel `json:"MPLS,omitempty"`
+	VXLAN []OpenContrailLabel `json:"VXLAN,omitempty"`
+}
+
+// labelTableDumper dumps the label tables with the mpls and vxlan
+// utilities, these tables not being reported by rt --monitor
+type labelTableDumper struct {
+	mpls     rtCommand
+	vxlan    rtCommand
+	interval time.Duration
+}
+
+// parseLabelDump parses the output of mpls --dump or vxlan --dump, the
+// entries being the lines made of a label and a nexthop ID
+func parseLabelDump(r io.Reader) ([]OpenContrailLabel, error) {
+	var labels []OpenContrailLabel
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		label, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		nhID, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		labels = append(labels, OpenContrailLabel{Label: label, NhId: nhID})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// filter returns the entries of the table whose nexthop is in the given VRF
+func (t *OpenContrailLabelTable) filter(vrfID int) *OpenContrailLabelTable {
+	match := func(labels []OpenContrailLabel) (filtered []OpenContrailLabel) {
+		for _, l := range labels {
+			if l.Vrf != nil && *l.Vrf == vrfID {
+				filtered = append(filtered, l)
+			}
+		}
+		return
+	}
+	return &OpenContrailLabelTable{MPLS: match(t.MPLS), VXLAN: match(t.VXLAN)}
+}
+
+func (mapper *Probe) dumpLabels(cmd rtCommand) ([]OpenContrailLabel, error) {
+	stdout, wait, err := cmd.start(mapper.ctx, "--dump")
+	if err != nil {
+		return nil, err
+	}
+	defer wait()
+
+	labels, err := parseLabelDump(stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapper.nh != nil {
+		for i := range labels {
+			if nh := mapper.nh.get(mapper.ctx, labels[i].NhId); nh != nil {
+				vrf := nh.Vrf
+				labels[i].Vrf = &vrf
+			}
+		}
+	}
+	return labels, nil
+}
+
+// dumpLabelTable dumps the MPLS and the VXLAN tables. The VXLAN table being
+// empty when the vrouter only uses MPLS, a failure to dump it is not fatal.
+func (mapper *Probe) dumpLabelTable() (*OpenContrailLabelTable, error) {
+	mpls, err := mapper.dumpLabels(mapper.labels.mpls)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to dump the MPLS table: %s", err)
+	}
+
+	vxlan, err := mapper.dumpLabels(mapper.labels.vxlan)
+	if err != nil {
+		logging.GetLogger().Debugf("Failed to dump the VXLAN table: %s", err)
+	}
+
+	return &OpenContrailLabelTable{MPLS: mpls, VXLAN: vxlan}, nil
+}
+
+// setLabelTable writes the label table into the Contrail.LabelTable
+// metadata of the vhost and of the interfaces, an interface getting the
+// entries leading to its VRF only. The metadata are only updated when
+// changed.
+func (mapper *Probe) setLabelTable(table *OpenContrailLabelTable) {
+	mapper.graph.Lock()
+	defer mapper.graph.Unlock()
+
+	update := func(node *graph.Node, table *OpenContrailLabelTable) {
+		if current, err := node.GetField("Contrail.LabelTable"); err == nil && reflect.DeepEqual(current, table) {
+			return
+		}
+		mapper.addMetadata(node, "Contrail.LabelTable", table)
+	}
+
+	if mapper.vHost != nil {
+		update(mapper.vHost, table)
+	}
+
+	filter := graph.NewElementFilter(filters.NewNotNullFilter("Contrail.VRFID"))
+	for _, node := range mapper.graph.GetNodes(filter) {
+		if vrfID, err := node.GetFieldInt64("Contrail.VRFID"); err == nil {
+			update(node, table.filter(int(vrfID)))
+		}
+	}
+}
+
+// labelTableUpdater periodically dumps the label tables, the mpls and vxlan
+// utilities having no monitor mode
+func (mapper *Probe) labelTableUpdater() {
+	logging.GetLogger().Debugf("Starting OpenContrail label table updater")
+	defer logging.GetLogger().Debugf("Stopping OpenContrail label table updater")
+
+	ticker := time.NewTicker(mapper.labels.interval)
+	defer ticker.Stop()
+
+	for {
+		if table, err := mapper.dumpLabelTable(); err != nil {
+			if mapper.ctx.Err() == nil {
+				logging.GetLogger().Error(err)
+			}
+		} else {
+			mapper.setLabelTable(table)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-mapper.ctx.Done():
+			return
+		}
+	}
+}
+
+// newLabelTableDumperFromConfig returns the dumper of the label tables, nil
+// if disabled
+func newLabelTableDumperFromConfig() (*labelTableDumper, error) {
+	interval := config.GetInt("opencontrail.label_table.interval")
+	if interval <= 0 {
+		return nil, nil
+	}
+
+	mpls, err := newRtCommandFromConfig(config.GetString("opencontrail.label_table.mpls_path"))
+	if err != nil {
+		return nil, err
+	}
+
+	vxlan, err := newRtCommandFromConfig(config.GetString("opencontrail.label_table.vxlan_path"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &labelTableDumper{mpls: mpls, vxlan: vxlan, interval: time.Duration(interval) * time.Second}, nil
+}
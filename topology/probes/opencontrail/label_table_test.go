@@ -0,0 +1,66 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mplsDump = `MPLS Input Label Map
+
+   Label    NextHop
+-------------------
+      16        11
+      17        23
+`
+
+func TestParseLabelDump(t *testing.T) {
+	labels, err := parseLabelDump(strings.NewReader(mplsDump))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OpenContrailLabel{{Label: 16, NhId: 11}, {Label: 17, NhId: 23}}
+	if !reflect.DeepEqual(expected, labels) {
+		t.Errorf("Expected %+v, got %+v", expected, labels)
+	}
+}
+
+func TestLabelTableFilter(t *testing.T) {
+	vrf1, vrf2 := 1, 2
+	table := &OpenContrailLabelTable{
+		MPLS: []OpenContrailLabel{
+			{Label: 16, NhId: 11, Vrf: &vrf1},
+			{Label: 17, NhId: 23, Vrf: &vrf2},
+			{Label: 18, NhId: 24},
+		},
+		VXLAN: []OpenContrailLabel{{Label: 4, NhId: 20, Vrf: &vrf1}},
+	}
+
+	expected := &OpenContrailLabelTable{
+		MPLS:  []OpenContrailLabel{{Label: 16, NhId: 11, Vrf: &vrf1}},
+		VXLAN: []OpenContrailLabel{{Label: 4, NhId: 20, Vrf: &vrf1}},
+	}
+	if filtered := table.filter(1); !reflect.DeepEqual(expected, filtered) {
+		t.Errorf("Expected %+v, got %+v", expected, filtered)
+	}
+}
@@ -0,0 +1,227 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+
+	cache "github.com/pmylund/go-cache"
+)
+
+// nhCacheExpiration is the time the nexthops are kept, the nexthops being
+// shared by many routes
+const nhCacheExpiration = time.Minute
+
+// OpenContrailNexthop describes the vrouter nexthop of a route, as reported
+// by nh --get. The Encapsulation and the tunnel addresses are set for the
+// tunnel nexthops, the Members for the composite ones, used by ECMP and
+// multicast routes.
+// easyjson:json
+type OpenContrailNexthop struct {
+	Type              string
+	Family            string                      `json:"Family,omitempty"`
+	Vrf               int                         `json:"Vrf"`
+	Flags             []string                    `json:"Flags,omitempty"`
+	OutputInterface   *int                        `json:"OutputInterface,omitempty"`
+	Encapsulation     string                      `json:"Encapsulation,omitempty"`
+	TunnelSource      string                      `json:"TunnelSource,omitempty"`
+	TunnelDestination string                      `json:"TunnelDestination,omitempty"`
+	Members           []OpenContrailNexthopMember `json:"Members,omitempty"`
+}
+
+// OpenContrailNexthopMember is a nexthop of a composite nexthop along with
+// the MPLS label used to reach it
+// easyjson:json
+type OpenContrailNexthopMember struct {
+	NhId  int `json:"NhId"`
+	Label int `json:"Label"`
+}
+
+// Encapsulations of the tunnel nexthops, indexed by their flag
+var nhEncapsulations = map[string]string{
+	"mplsogre": "MPLSoGRE",
+	"mplsoudp": "MPLSoUDP",
+	"vxlan":    "VXLAN",
+}
+
+var (
+	// a key starts a line or follows a space, "Fmly: AF_INET" having a
+	// space after the colon
+	nhKey    = regexp.MustCompile(`(^|\s)([A-Za-z_]+):`)
+	nhMember = regexp.MustCompile(`(\d+)\((-?\d+)\)`)
+)
+
+// nhFields returns the "Key:Value" fields of a line of nh --get, a value
+// extending up to the next key
+func nhFields(line string) map[string]string {
+	fields := make(map[string]string)
+
+	matches := nhKey.FindAllStringSubmatchIndex(line, -1)
+	for i, m := range matches {
+		end := len(line)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		fields[line[m[4]:m[5]]] = strings.TrimSpace(line[m[1]:end])
+	}
+	return fields
+}
+
+// parseNh parses the output of nh --get
+func parseNh(r io.Reader) (*OpenContrailNexthop, error) {
+	scanner := bufio.NewScanner(r)
+
+	var nh *OpenContrailNexthop
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "Sub NH(label):") {
+			if nh != nil {
+				for _, m := range nhMember.FindAllStringSubmatch(line, -1) {
+					id, _ := strconv.Atoi(m[1])
+					label, _ := strconv.Atoi(m[2])
+					nh.Members = append(nh.Members, OpenContrailNexthopMember{NhId: id, Label: label})
+				}
+			}
+			continue
+		}
+
+		fields := nhFields(line)
+		if _, ok := fields["Id"]; ok {
+			if nh != nil {
+				// only the first nexthop is returned
+				break
+			}
+			nh = &OpenContrailNexthop{Type: fields["Type"], Family: fields["Fmly"]}
+		}
+		if nh == nil {
+			continue
+		}
+
+		for key, value := range fields {
+			switch key {
+			case "Vrf":
+				nh.Vrf, _ = strconv.Atoi(value)
+			case "Oif":
+				if oif, err := strconv.Atoi(value); err == nil {
+					nh.OutputInterface = &oif
+				}
+			case "Sip":
+				nh.TunnelSource = value
+			case "Dip":
+				nh.TunnelDestination = value
+			case "Flags":
+				for _, flag := range strings.Split(value, ",") {
+					if flag = strings.TrimSpace(flag); flag == "" {
+						continue
+					}
+					nh.Flags = append(nh.Flags, flag)
+					if encap, ok := nhEncapsulations[strings.ToLower(flag)]; ok {
+						nh.Encapsulation = encap
+					}
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if nh == nil {
+		return nil, fmt.Errorf("No nexthop found in nh output")
+	}
+	return nh, nil
+}
+
+// nhResolver gets the details of the nexthops with nh --get
+type nhResolver struct {
+	nh    rtCommand
+	cache *cache.Cache
+}
+
+// get returns the nexthop of the given ID, nil if it can not be resolved.
+// The failures are cached as well so that nh is not run for each route.
+func (r *nhResolver) get(ctx context.Context, id int) *OpenContrailNexthop {
+	key := strconv.Itoa(id)
+	if nh, found := r.cache.Get(key); found {
+		return nh.(*OpenContrailNexthop)
+	}
+
+	nh, err := r.run(ctx, id)
+	if err != nil {
+		logging.GetLogger().Debugf("Failed to get nexthop %d: %s", id, err)
+	}
+	r.cache.Set(key, nh, cache.DefaultExpiration)
+	return nh
+}
+
+func (r *nhResolver) run(ctx context.Context, id int) (*OpenContrailNexthop, error) {
+	stdout, wait, err := r.nh.start(ctx, "--get", strconv.Itoa(id))
+	if err != nil {
+		return nil, err
+	}
+	defer wait()
+
+	return parseNh(stdout)
+}
+
+// flush forgets the nexthops, their IDs being reused by the vrouter
+func (r *nhResolver) flush() {
+	r.cache.Flush()
+}
+
+func newNhResolver(nh rtCommand) *nhResolver {
+	return &nhResolver{nh: nh, cache: cache.New(nhCacheExpiration, 2*nhCacheExpiration)}
+}
+
+// newNhResolverFromConfig returns the nexthop resolver, nil if no path is
+// configured for nh
+func newNhResolverFromConfig() (*nhResolver, error) {
+	path := config.GetString("opencontrail.nh.path")
+	if path == "" {
+		return nil, nil
+	}
+
+	nh, err := newRtCommandFromConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return newNhResolver(nh), nil
+}
+
+// resolveNexthops sets the nexthop details of the routes
+func (mapper *Probe) resolveNexthops(routes []OpenContrailRoute) {
+	if mapper.nh == nil {
+		return
+	}
+	for i := range routes {
+		routes[i].Nexthop = mapper.nh.get(mapper.ctx, routes[i].NhId)
+	}
+}
@@ -0,0 +1,110 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const nhTunnel = `Id:18         Type:Tunnel         Fmly: AF_INET  Rid:0  Ref_cnt:12         Vrf:0
+              Flags:Valid, MPLSoUDP, Etree Root, 
+              Oif:0 Len:14 Data:00 50 56 a2 e6 8b 00 50 56 a2 b6 1e 08 00 
+              Sip:10.0.0.1 Dip:10.0.0.2
+`
+
+const nhComposite = `Id:14         Type:Composite      Fmly: AF_INET  Rid:0  Ref_cnt:2          Vrf:1
+              Flags:Valid, Policy, Ecmp, Etree Root, 
+              Valid Hash Key Parameters: Proto,SrcIP,SrcPort,DstIp,DstPort
+              Sub NH(label): 18(25) 21(30)
+`
+
+func TestParseNhTunnel(t *testing.T) {
+	nh, err := parseNh(strings.NewReader(nhTunnel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oif := 0
+	expected := &OpenContrailNexthop{
+		Type:              "Tunnel",
+		Family:            "AF_INET",
+		Flags:             []string{"Valid", "MPLSoUDP", "Etree Root"},
+		OutputInterface:   &oif,
+		Encapsulation:     "MPLSoUDP",
+		TunnelSource:      "10.0.0.1",
+		TunnelDestination: "10.0.0.2",
+	}
+
+	if !reflect.DeepEqual(expected, nh) {
+		t.Errorf("Expected %+v, got %+v", expected, nh)
+	}
+}
+
+func TestParseNhComposite(t *testing.T) {
+	nh, err := parseNh(strings.NewReader(nhComposite))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nh.Type != "Composite" || nh.Vrf != 1 || nh.Encapsulation != "" {
+		t.Errorf("Unexpected nexthop %+v", nh)
+	}
+
+	expected := []OpenContrailNexthopMember{{NhId: 18, Label: 25}, {NhId: 21, Label: 30}}
+	if !reflect.DeepEqual(expected, nh.Members) {
+		t.Errorf("Expected members %+v, got %+v", expected, nh.Members)
+	}
+}
+
+func TestRouteNexthops(t *testing.T) {
+	mapper := &Probe{
+		ctx:           context.Background(),
+		routingTables: make(map[int]*RoutingTable),
+		rt:            fakeRtCommand{"inet": rtDumpNoMAC},
+		nh:            newNhResolver(fakeRtCommand{"18": nhTunnel}),
+	}
+
+	vrf, err := mapper.vrfInit(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range vrf.Routes {
+		switch route.NhId {
+		case 18:
+			if route.Nexthop == nil || route.Nexthop.TunnelDestination != "10.0.0.2" {
+				t.Errorf("Expected the tunnel nexthop for %s, got %+v", route.Prefix, route.Nexthop)
+			}
+		default:
+			if route.Nexthop != nil {
+				t.Errorf("Expected no nexthop for %s, got %+v", route.Prefix, route.Nexthop)
+			}
+		}
+	}
+
+	// a route is not added twice because of its nexthop details
+	mapper.addRoute(1, OpenContrailRoute{Family: afInetFamily, Prefix: "10.0.0.4/32", NhId: 18, Protocol: OpenContrailRouteProtocol, Preference: 32})
+	if len(mapper.routingTables[1].Routes) != len(vrf.Routes) {
+		t.Errorf("Expected %d routes, got %+v", len(vrf.Routes), mapper.routingTables[1].Routes)
+	}
+}
@@ -22,6 +22,7 @@ package opencontrail
 import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/graffiti/graph"
+	shttp "github.com/skydive-project/skydive/http"
 )
 
 // Probe describes a probe that reads OpenContrail database and updates the graph
@@ -40,3 +41,8 @@ func (mapper *Probe) Stop() {
 func NewProbeFromConfig(g *graph.Graph, r *graph.Node) (*Probe, error) {
 	return nil, common.ErrNotImplemented
 }
+
+// RegisterRoutingTableAPI registers the endpoint serving the full routing
+// table of a VRF
+func RegisterRoutingTableAPI(s *shttp.Server, p *Probe, authBackend shttp.AuthenticationBackend) {
+}
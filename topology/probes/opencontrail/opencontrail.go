@@ -50,6 +50,17 @@ type Probe struct {
 	mplsUDPPort             int
 	routingTables           map[int]*RoutingTable
 	routingTableUpdaterChan chan RoutingTableUpdate
+	routeUpdateWindow       time.Duration
+	routeLimit              *routeLimit
+	coalescer               *graph.MetadataCoalescer
+	rt                      rtCommand
+	nativeRt                *netlinkRtClient
+	rtFallback              bool
+	nh                      *nhResolver
+	labels                  *labelTableDumper
+	dropStats               *dropStatsCollector
+	monitorFailed           bool
+	agentCheckInterval      time.Duration
 	ctx                     context.Context
 	cancel                  context.CancelFunc
 }
@@ -312,7 +323,17 @@ func (mapper *Probe) OnNodeDeleted(n *graph.Node) {
 func (mapper *Probe) Start() {
 	mapper.graph.AddEventListener(mapper)
 	go mapper.nodeUpdater()
+	go mapper.routingTableUpdater()
 	go mapper.rtMonitor()
+	if mapper.labels != nil {
+		go mapper.labelTableUpdater()
+	}
+	if mapper.dropStats != nil {
+		go mapper.dropStatsUpdater()
+	}
+	if mapper.agentCheckInterval > 0 {
+		go mapper.agentWatcher()
+	}
 }
 
 // Stop the probe
@@ -320,10 +341,63 @@ func (mapper *Probe) Stop() {
 	mapper.cancel()
 	mapper.graph.RemoveEventListener(mapper)
 	close(mapper.nodeUpdaterChan)
+	mapper.coalescer.Stop()
+}
+
+// addMetadata sets a metadata of a node, the updates of the routing and
+// label tables being coalesced. The graph lock must be held.
+func (mapper *Probe) addMetadata(n *graph.Node, k string, v interface{}) {
+	if mapper.coalescer != nil {
+		mapper.coalescer.AddMetadata(n, k, v)
+	} else {
+		mapper.graph.AddMetadata(n, k, v)
+	}
+}
+
+// delMetadata removes a metadata of a node. The graph lock must be held.
+func (mapper *Probe) delMetadata(n *graph.Node, k string) {
+	if mapper.coalescer != nil {
+		mapper.coalescer.DelMetadata(n, k)
+	} else {
+		mapper.graph.DelMetadata(n, k)
+	}
 }
 
 // NewProbeFromConfig creates a new OpenContrail probe based on configuration
 func NewProbeFromConfig(g *graph.Graph, r *graph.Node) (*Probe, error) {
+	rt, err := newRtCommandFromConfig(config.GetString("opencontrail.rt.path"))
+	if err != nil {
+		return nil, err
+	}
+
+	nh, err := newNhResolverFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := newLabelTableDumperFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	agentHost := config.GetString("opencontrail.host")
+	agentPort := config.GetInt("opencontrail.port")
+
+	dropStats, err := newDropStatsCollectorFromConfig(agentHost, agentPort)
+	if err != nil {
+		return nil, err
+	}
+
+	routeLimit, err := newRouteLimitFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	nativeRt, rtFallback, err := newNetlinkRtClientFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Probe{
@@ -331,11 +405,21 @@ func NewProbeFromConfig(g *graph.Graph, r *graph.Node) (*Probe, error) {
 		cancel:                  cancel,
 		graph:                   g,
 		root:                    r,
-		agentHost:               config.GetString("opencontrail.host"),
-		agentPort:               config.GetInt("opencontrail.port"),
+		agentHost:               agentHost,
+		agentPort:               agentPort,
 		mplsUDPPort:             config.GetInt("opencontrail.mpls_udp_port"),
 		nodeUpdaterChan:         make(chan graph.Identifier, 500),
 		routingTables:           make(map[int]*RoutingTable),
 		routingTableUpdaterChan: make(chan RoutingTableUpdate, 500),
+		routeUpdateWindow:       time.Duration(config.GetConfig().GetFloat64("opencontrail.route_update_window") * float64(time.Second)),
+		routeLimit:              routeLimit,
+		coalescer:               graph.NewMetadataCoalescer(g, time.Duration(config.GetConfig().GetFloat64("opencontrail.metadata_update_interval")*float64(time.Second))),
+		rt:                      rt,
+		nativeRt:                nativeRt,
+		rtFallback:              rtFallback,
+		nh:                      nh,
+		labels:                  labels,
+		dropStats:               dropStats,
+		agentCheckInterval:      time.Duration(config.GetInt("opencontrail.agent_check_interval")) * time.Second,
 	}, nil
 }
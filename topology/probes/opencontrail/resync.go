@@ -0,0 +1,112 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// rtMonitorRestartDelay is the delay before respawning rt --monitor
+const rtMonitorRestartDelay = 5 * time.Second
+
+// Resync requests the resynchronization of all the routing tables, the
+// request being serialized with the route updates
+func (mapper *Probe) Resync() {
+	if mapper.ctx.Err() != nil {
+		return
+	}
+	mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: Resync}
+}
+
+// resyncRoutingTables forgets all the VRFs, removing their nodes, and the
+// nexthops and updates again the interfaces attached to a VRF, their VRFID
+// being retrieved from the vrouter agent and their VRF dumped again when
+// added back
+func (mapper *Probe) resyncRoutingTables() {
+	logging.GetLogger().Infof("Resynchronizing %d OpenContrail routing tables", len(mapper.routingTables))
+
+	for vrfId := range mapper.routingTables {
+		mapper.delVrfNode(vrfId)
+	}
+	mapper.routingTables = make(map[int]*RoutingTable)
+	if mapper.nh != nil {
+		mapper.nh.flush()
+	}
+
+	mapper.graph.RLock()
+	filter := vrfInterfacesFilter(filters.NewNotNullFilter("Contrail.VRFID"))
+	var ids []graph.Identifier
+	for _, node := range mapper.graph.GetNodes(filter) {
+		ids = append(ids, node.ID)
+	}
+	mapper.graph.RUnlock()
+
+	for _, id := range ids {
+		if mapper.ctx.Err() != nil {
+			return
+		}
+		mapper.nodeUpdaterChan <- id
+	}
+}
+
+// isAgentAlive checks whether the introspect port of the vrouter agent
+// accepts connections
+func (mapper *Probe) isAgentAlive() bool {
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", mapper.agentHost, mapper.agentPort), mapper.agentCheckInterval)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// agentWatcher resynchronizes the routing tables when the vrouter agent
+// comes back after being unreachable, as it is when restarted
+func (mapper *Probe) agentWatcher() {
+	ticker := time.NewTicker(mapper.agentCheckInterval)
+	defer ticker.Stop()
+
+	alive := mapper.isAgentAlive()
+	for {
+		select {
+		case <-ticker.C:
+			wasAlive := alive
+			if alive = mapper.isAgentAlive(); alive == wasAlive {
+				continue
+			}
+
+			if !alive {
+				logging.GetLogger().Warningf("OpenContrail vrouter agent %s:%d is unreachable", mapper.agentHost, mapper.agentPort)
+				continue
+			}
+
+			logging.GetLogger().Infof("OpenContrail vrouter agent %s:%d is back", mapper.agentHost, mapper.agentPort)
+			mapper.Resync()
+		case <-mapper.ctx.Done():
+			return
+		}
+	}
+}
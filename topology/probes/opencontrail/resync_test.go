@@ -0,0 +1,123 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestResyncRoutingTables(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AgentService)
+
+	g.Lock()
+	root, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host", "Type": "host"})
+	tap, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "tap1", "Type": "tap", "Contrail": map[string]interface{}{"VRF": "default-domain:admin:net1:net1", "VRFID": int64(2)}})
+	g.NewNode(graph.GenID(), graph.Metadata{"Name": "tap2", "Type": "tap"})
+	g.Unlock()
+
+	vrf := &RoutingTable{Routes: []OpenContrailRoute{{Family: afInetFamily, Prefix: "10.0.0.1/32", NhId: 12}}}
+	mapper := &Probe{
+		graph:           g,
+		root:            root,
+		ctx:             context.Background(),
+		routingTables:   map[int]*RoutingTable{2: vrf},
+		nodeUpdaterChan: make(chan graph.Identifier, 10),
+	}
+
+	g.Lock()
+	mapper.updateVrfNode(2, vrf.Routes, nil, []*graph.Node{tap})
+	g.Unlock()
+
+	mapper.resyncRoutingTables()
+
+	if len(mapper.routingTables) != 0 {
+		t.Errorf("Expected the routing tables to be forgotten, got %v", mapper.routingTables)
+	}
+
+	if g.GetNode(mapper.vrfNodeID(2)) != nil {
+		t.Error("Expected the VRF node to be deleted")
+	}
+
+	// only the interfaces attached to a VRF are updated again
+	if len(mapper.nodeUpdaterChan) != 1 || <-mapper.nodeUpdaterChan != tap.ID {
+		t.Error("Expected the interface attached to the VRF to be updated again")
+	}
+}
+
+func TestMonitorRestartResync(t *testing.T) {
+	mapper := &Probe{
+		ctx:                     context.Background(),
+		rt:                      fakeRtCommand{"--monitor": ""},
+		routingTableUpdaterChan: make(chan RoutingTableUpdate, 10),
+	}
+
+	if err := mapper.monitorRoutes(false); err == nil {
+		t.Error("Expected an error when rt --monitor exits")
+	}
+	if len(mapper.routingTableUpdaterChan) != 0 {
+		t.Error("Expected no resynchronization on the first start")
+	}
+
+	// route updates may have been missed while rt --monitor was not running
+	mapper.monitorRoutes(true)
+	if len(mapper.routingTableUpdaterChan) != 1 || (<-mapper.routingTableUpdaterChan).action != Resync {
+		t.Error("Expected the routing tables to be resynchronized on restart")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mapper.ctx = ctx
+	mapper.Resync()
+	if len(mapper.routingTableUpdaterChan) != 0 {
+		t.Error("Expected no resynchronization once the probe is stopped")
+	}
+}
+
+func TestAgentAlive(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapper := &Probe{
+		agentHost:          "127.0.0.1",
+		agentPort:          ln.Addr().(*net.TCPAddr).Port,
+		agentCheckInterval: time.Second,
+	}
+
+	if !mapper.isAgentAlive() {
+		t.Error("Expected the agent to be reachable")
+	}
+
+	ln.Close()
+	if mapper.isAgentAlive() {
+		t.Error("Expected the agent to be unreachable once stopped")
+	}
+}
@@ -0,0 +1,181 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skydive-project/skydive/config"
+)
+
+// Policies applied to the routing tables exceeding the route limit
+const (
+	// truncateRoutes keeps the least specific routes in the metadata
+	truncateRoutes = "truncate"
+	// summarizeRoutes only keeps the summary in the metadata
+	summarizeRoutes = "summary"
+)
+
+// OpenContrailRouteAggregate counts the routes of a VRF included in a prefix
+// easyjson:json
+type OpenContrailRouteAggregate struct {
+	Prefix string
+	Count  int
+}
+
+// OpenContrailRouteSummary describes a routing table exceeding the route
+// limit: the number of routes per family and per aggregated prefix, the
+// largest aggregates first. The full table is served by the agent API.
+// easyjson:json
+type OpenContrailRouteSummary struct {
+	Count      int
+	Families   map[string]int
+	Aggregates []OpenContrailRouteAggregate
+}
+
+// routeLimit limits the number of routes written into the metadata of the
+// nodes of a VRF
+type routeLimit struct {
+	max      int
+	policy   string
+	inetLen  int
+	inet6Len int
+}
+
+// prefixLength returns the length of a prefix, 0 if it can not be parsed
+func prefixLength(prefix string) int {
+	if i := strings.LastIndexByte(prefix, '/'); i >= 0 {
+		if length, err := strconv.Atoi(prefix[i+1:]); err == nil {
+			return length
+		}
+	}
+	return 0
+}
+
+// aggregatePrefix returns the prefix of the given length including the
+// given prefix, the prefix itself when it is less specific
+func aggregatePrefix(prefix string, length int) (string, error) {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	ones, bits := ipnet.Mask.Size()
+	if ones <= length {
+		return ipnet.String(), nil
+	}
+
+	mask := net.CIDRMask(length, bits)
+	aggregate := net.IPNet{IP: ipnet.IP.Mask(mask), Mask: mask}
+	return aggregate.String(), nil
+}
+
+// summarize counts the routes per family and per aggregated prefix, at
+// most max aggregates being kept
+func (l *routeLimit) summarize(routes []OpenContrailRoute) *OpenContrailRouteSummary {
+	summary := &OpenContrailRouteSummary{
+		Count:    len(routes),
+		Families: make(map[string]int),
+	}
+
+	counts := make(map[string]int)
+	for _, r := range routes {
+		summary.Families[r.Family]++
+
+		length := l.inetLen
+		if r.Family == afInet6Family {
+			length = l.inet6Len
+		}
+
+		aggregate, err := aggregatePrefix(r.Prefix, length)
+		if err != nil {
+			aggregate = r.Prefix
+		}
+		counts[aggregate]++
+	}
+
+	for prefix, count := range counts {
+		summary.Aggregates = append(summary.Aggregates, OpenContrailRouteAggregate{Prefix: prefix, Count: count})
+	}
+	sort.Slice(summary.Aggregates, func(i, j int) bool {
+		a, b := summary.Aggregates[i], summary.Aggregates[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Prefix < b.Prefix
+	})
+	if len(summary.Aggregates) > l.max {
+		summary.Aggregates = summary.Aggregates[:l.max]
+	}
+
+	return summary
+}
+
+// apply returns the routes to write into the metadata and, when the limit
+// is exceeded, the summary of the whole table
+func (l *routeLimit) apply(routes []OpenContrailRoute) ([]OpenContrailRoute, *OpenContrailRouteSummary) {
+	if l == nil || l.max <= 0 || len(routes) <= l.max {
+		return routes, nil
+	}
+
+	summary := l.summarize(routes)
+	if l.policy == summarizeRoutes {
+		return []OpenContrailRoute{}, summary
+	}
+
+	kept := make([]OpenContrailRoute, len(routes))
+	copy(kept, routes)
+	sort.SliceStable(kept, func(i, j int) bool {
+		if kept[i].Family != kept[j].Family {
+			return kept[i].Family < kept[j].Family
+		}
+		if li, lj := prefixLength(kept[i].Prefix), prefixLength(kept[j].Prefix); li != lj {
+			return li < lj
+		}
+		return kept[i].Prefix < kept[j].Prefix
+	})
+
+	return kept[:l.max], summary
+}
+
+func newRouteLimitFromConfig() (*routeLimit, error) {
+	l := &routeLimit{
+		max:      config.GetInt("opencontrail.routing_table.max_routes"),
+		policy:   config.GetString("opencontrail.routing_table.policy"),
+		inetLen:  config.GetInt("opencontrail.routing_table.inet_aggregation"),
+		inet6Len: config.GetInt("opencontrail.routing_table.inet6_aggregation"),
+	}
+
+	if l.policy != truncateRoutes && l.policy != summarizeRoutes {
+		return nil, fmt.Errorf("Invalid routing table policy '%s', should be %s or %s", l.policy, truncateRoutes, summarizeRoutes)
+	}
+	if l.inetLen < 0 || l.inetLen > 32 {
+		return nil, fmt.Errorf("Invalid IPv4 route aggregation length %d", l.inetLen)
+	}
+	if l.inet6Len < 0 || l.inet6Len > 128 {
+		return nil, fmt.Errorf("Invalid IPv6 route aggregation length %d", l.inet6Len)
+	}
+
+	return l, nil
+}
@@ -0,0 +1,68 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"testing"
+)
+
+func TestRouteLimit(t *testing.T) {
+	routes := []OpenContrailRoute{
+		{Family: afInetFamily, Prefix: "10.1.2.3/32"},
+		{Family: afInetFamily, Prefix: "10.1.0.0/16"},
+		{Family: afInetFamily, Prefix: "10.1.4.0/24"},
+		{Family: afInetFamily, Prefix: "10.2.0.1/32"},
+		{Family: afInet6Family, Prefix: "fd00:1:2::1/128"},
+	}
+
+	l := &routeLimit{max: 5, policy: truncateRoutes, inetLen: 16, inet6Len: 48}
+	if kept, summary := l.apply(routes); len(kept) != len(routes) || summary != nil {
+		t.Fatalf("Expected the routes to be kept under the limit, got %v, %v", kept, summary)
+	}
+
+	l.max = 3
+	kept, summary := l.apply(routes)
+	if len(kept) != 3 || kept[0].Prefix != "10.1.0.0/16" || kept[1].Prefix != "10.1.4.0/24" || kept[2].Prefix != "10.1.2.3/32" {
+		t.Fatalf("Expected the least specific routes to be kept, got %v", kept)
+	}
+
+	if summary == nil || summary.Count != 5 || summary.Families[afInetFamily] != 4 || summary.Families[afInet6Family] != 1 {
+		t.Fatalf("Wrong route summary: %+v", summary)
+	}
+
+	expected := []OpenContrailRouteAggregate{
+		{Prefix: "10.1.0.0/16", Count: 3},
+		{Prefix: "10.2.0.0/16", Count: 1},
+		{Prefix: "fd00:1:2::/48", Count: 1},
+	}
+	if len(summary.Aggregates) != len(expected) {
+		t.Fatalf("Expected aggregates %v, got %v", expected, summary.Aggregates)
+	}
+	for i, a := range expected {
+		if summary.Aggregates[i] != a {
+			t.Fatalf("Expected aggregates %v, got %v", expected, summary.Aggregates)
+		}
+	}
+
+	l.policy = summarizeRoutes
+	if kept, summary := l.apply(routes); len(kept) != 0 || summary == nil || summary.Count != 5 {
+		t.Fatalf("Expected only the summary to be kept, got %v, %v", kept, summary)
+	}
+}
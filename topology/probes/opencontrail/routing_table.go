@@ -19,18 +19,32 @@
 
 // When an interface node is created, the VRFID is get from the
 // Contrail Vrouter Agent and associated to this node. This VRF is
-// then dumped (with rt --dump) to populate the Contrail.RoutingTable
-// metadata.
+// then dumped to populate the Contrail.RoutingTable metadata.
 //
-// The process rt --monitor is spawn to get route update notifications
-// from the Contrail vrouter kernel module. All route updates contain
-// the VRFID. This VRFID is then used to get all interface nodes that
+// Route update notifications are received from the Contrail vrouter
+// kernel module. All route updates contain the VRFID. This VRFID is then used to get all interface nodes that
 // have this VRFID. The Contrail routing table of these nodes is then
 // updated according to the route update.
 //
-// LIMITATION: if the Contrail Vrouter Agent is restated, Skydive
-// routing tables are corrupted. Skydive agent then have to be
-// restarted when Contrail Vrouter agent is restarted.
+// The routes are dumped and monitored natively, by decoding the Sandesh
+// objects sent by the vrouter on its generic netlink family. The rt
+// utility (rt --dump and rt --monitor) is used when the vrouter is
+// remote or when its messages can not be decoded.
+//
+// When the Contrail Vrouter Agent is restarted, the VRFs may be
+// recreated with other IDs and route updates may be missed. The agent
+// introspect port is then watched and the route monitor is restarted
+// when it fails. In both cases, the routing tables are
+// resynchronized: all the VRFs are forgotten and the VRFID of the
+// interfaces is retrieved again, their VRF being dumped again.
+//
+// Beyond opencontrail.routing_table.max_routes routes, the routing table
+// written into the metadata is truncated and summarized in the
+// Contrail.RoutingTableSummary metadata, the full table being served by
+// the agent API.
+//
+// Each VRF is also represented by a node of type vrf, linked to its
+// interfaces with member edges and removed along with the VRF.
 
 package opencontrail
 
@@ -40,13 +54,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os/exec"
-	"regexp"
-	"strconv"
+	"time"
 
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
 )
 
 // This represents the data we get from rt --monitor stdout
@@ -60,17 +73,45 @@ type rtMonitorRoute struct {
 	NhId      int `json:"nh_id"`
 }
 
-const afInetFamily string = "AF_INET"
+// Families of the routes reported by rt
+const (
+	afInetFamily  string = "AF_INET"
+	afInet6Family string = "AF_INET6"
+)
+
+// rtDumpFamilies maps the families of the routes to the value of the
+// rt --family option
+var rtDumpFamilies = []struct {
+	family string
+	option string
+}{
+	{afInetFamily, "inet"},
+	{afInet6Family, "inet6"},
+}
 
 const OpenContrailRouteProtocol int64 = 200
 
-// The skydive representation of a Contrail route
+// The skydive representation of a Contrail route. Preference, Flags,
+// Label and StitchedMAC are only known for the routes read from rt --dump,
+// Preference being its PPL column. Nexthop holds the details of the
+// nexthop NhId, when nh is available.
 // easyjson:json
 type OpenContrailRoute struct {
-	Family   string
-	Prefix   string
-	NhId     int `json:"NhId"`
-	Protocol int64
+	Family      string
+	Prefix      string
+	NhId        int `json:"NhId"`
+	Protocol    int64
+	Preference  int                  `json:"Preference,omitempty"`
+	Flags       string               `json:"Flags,omitempty"`
+	Label       int                  `json:"Label,omitempty"`
+	StitchedMAC string               `json:"StitchedMAC,omitempty"`
+	Nexthop     *OpenContrailNexthop `json:"Nexthop,omitempty"`
+}
+
+// sameRoute compares two routes regardless of the details of their nexthop
+func sameRoute(a, b OpenContrailRoute) bool {
+	a.Nexthop, b.Nexthop = nil, nil
+	return a == b
 }
 
 // A VRF contains the list of interface that use this VRF in order to
@@ -93,47 +134,135 @@ const (
 	DelRoute
 	AddInterface
 	DelInterface
+	Resync
+	GetRoutes
 )
 
 type RoutingTableUpdate struct {
 	action routingTableUpdateType
 	route  rtMonitorRoute
 	intf   interfaceUpdate
+	vrfId  int
+	reply  chan []OpenContrailRoute
+}
+
+// applyRoutingTableUpdate applies an update to the routing tables and
+// returns the VRF whose routing table has to be written into the graph
+func (mapper *Probe) applyRoutingTableUpdate(a RoutingTableUpdate) (int, bool) {
+	switch a.action {
+	case AddRoute:
+		ocRoute := OpenContrailRoute{
+			Protocol: OpenContrailRouteProtocol,
+			Prefix:   fmt.Sprintf("%s/%d", a.route.Address, a.route.Prefix),
+			Family:   a.route.Family,
+			NhId:     a.route.NhId}
+		mapper.addRoute(a.route.VrfId, ocRoute)
+		return a.route.VrfId, true
+	case DelRoute:
+		ocRoute := OpenContrailRoute{
+			Protocol: OpenContrailRouteProtocol,
+			Prefix:   fmt.Sprintf("%s/%d", a.route.Address, a.route.Prefix),
+			Family:   a.route.Family,
+			NhId:     a.route.NhId}
+		mapper.delRoute(a.route.VrfId, ocRoute)
+		return a.route.VrfId, true
+	case AddInterface:
+		mapper.addInterface(a.intf.VrfId, a.intf.InterfaceUUID)
+		return a.intf.VrfId, true
+	case DelInterface:
+		vrfId, err := mapper.deleteInterface(a.intf.InterfaceUUID)
+		return vrfId, err == nil
+	}
+	return 0, false
 }
 
 // routingTableUpdater serializes route update on both routing tables
-// and interfaces.
+// and interfaces. The routing tables are written into the graph at most
+// once per update window, so that a burst of route updates results in a
+// single metadata update per node.
 func (mapper *Probe) routingTableUpdater() {
-	var vrfId int
 	logging.GetLogger().Debug("Starting routingTableUpdater...")
-	for a := range mapper.routingTableUpdaterChan {
-		switch a.action {
-		case AddRoute:
-			ocRoute := OpenContrailRoute{
-				Protocol: OpenContrailRouteProtocol,
-				Prefix:   fmt.Sprintf("%s/%d", a.route.Address, a.route.Prefix),
-				Family:   a.route.Family,
-				NhId:     a.route.NhId}
-			mapper.addRoute(a.route.VrfId, ocRoute)
-			vrfId = a.route.VrfId
-		case DelRoute:
-			ocRoute := OpenContrailRoute{
-				Protocol: OpenContrailRouteProtocol,
-				Prefix:   fmt.Sprintf("%s/%d", a.route.Address, a.route.Prefix),
-				Family:   a.route.Family,
-				NhId:     a.route.NhId}
-			mapper.delRoute(a.route.VrfId, ocRoute)
-			vrfId = a.route.VrfId
-		case AddInterface:
-			mapper.addInterface(a.intf.VrfId, a.intf.InterfaceUUID)
-			vrfId = a.intf.VrfId
-		case DelInterface:
-			var err error
-			if vrfId, err = mapper.deleteInterface(a.intf.InterfaceUUID); err != nil {
+
+	pending := make(map[int]bool)
+	var flush <-chan time.Time
+
+	for {
+		select {
+		case a, ok := <-mapper.routingTableUpdaterChan:
+			if !ok {
+				return
+			}
+
+			if a.action == Resync {
+				// the VRFs are dumped again when their interfaces are added back
+				pending = make(map[int]bool)
+				mapper.resyncRoutingTables()
+				continue
+			}
+
+			if a.action == GetRoutes {
+				var routes []OpenContrailRoute
+				if vrf, found := mapper.routingTables[a.vrfId]; found {
+					routes = make([]OpenContrailRoute, len(vrf.Routes))
+					copy(routes, vrf.Routes)
+				}
+				a.reply <- routes
+				continue
+			}
+
+			vrfId, changed := mapper.applyRoutingTableUpdate(a)
+			if !changed {
+				continue
+			}
+
+			if mapper.routeUpdateWindow <= 0 {
+				mapper.onRouteChanged(vrfId)
 				continue
 			}
+
+			pending[vrfId] = true
+			if flush == nil {
+				flush = time.After(mapper.routeUpdateWindow)
+			}
+		case <-flush:
+			logging.GetLogger().Debugf("Writing the routing tables of %d VRFs", len(pending))
+			for vrfId := range pending {
+				mapper.onRouteChanged(vrfId)
+			}
+			pending = make(map[int]bool)
+			flush = nil
 		}
-		mapper.onRouteChanged(vrfId)
+	}
+}
+
+// GetRoutingTable returns the full routing table of a VRF, whatever the
+// route limit, nil if the VRF is unknown
+func (mapper *Probe) GetRoutingTable(vrfId int) ([]OpenContrailRoute, error) {
+	reply := make(chan []OpenContrailRoute, 1)
+
+	select {
+	case mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: GetRoutes, vrfId: vrfId, reply: reply}:
+	case <-mapper.ctx.Done():
+		return nil, errors.New("OpenContrail probe stopped")
+	}
+
+	select {
+	case routes := <-reply:
+		return routes, nil
+	case <-mapper.ctx.Done():
+		return nil, errors.New("OpenContrail probe stopped")
+	}
+}
+
+// setRoutingTable writes the routes and their summary into the metadata of
+// a node, the summary being removed once the routes fit the limit again.
+// The graph lock must be held.
+func (mapper *Probe) setRoutingTable(n *graph.Node, routes []OpenContrailRoute, summary *OpenContrailRouteSummary) {
+	mapper.addMetadata(n, "Contrail.RoutingTable", routes)
+	if summary != nil {
+		mapper.addMetadata(n, "Contrail.RoutingTableSummary", summary)
+	} else if _, err := n.GetField("Contrail.RoutingTableSummary"); err == nil {
+		mapper.delMetadata(n, "Contrail.RoutingTableSummary")
 	}
 }
 
@@ -183,6 +312,7 @@ func (mapper *Probe) deleteInterface(interfaceUUID string) (vrfId int, err error
 			if len(vrf.InterfacesUUID) == 0 {
 				logging.GetLogger().Debugf("Delete VRF %d", k)
 				delete(mapper.routingTables, k)
+				mapper.delVrfNode(k)
 			}
 		}
 	}
@@ -197,35 +327,48 @@ func (mapper *Probe) OnInterfaceDeleted(interfaceUUID string) {
 }
 
 // onRouteChanged writes the Contrail routing table into the
-// Contrail.RoutingTable metadata attribute.
+// Contrail.RoutingTable metadata attribute of the interfaces and of the
+// VRF node.
 func (mapper *Probe) onRouteChanged(vrfId int) {
 	vrf := mapper.getOrCreateRoutingTable(vrfId)
 
 	mapper.graph.Lock()
 	defer mapper.graph.Unlock()
 
-	filter := graph.NewElementFilter(filters.NewTermInt64Filter("Contrail.VRFID", int64(vrfId)))
+	filter := vrfInterfacesFilter(filters.NewTermInt64Filter("Contrail.VRFID", int64(vrfId)))
 	intfs := mapper.graph.GetNodes(filter)
 
 	if len(intfs) == 0 {
 		logging.GetLogger().Debugf("No interface with VRF index %d was found (on route add)", vrfId)
 		return
 	}
+	if vrf == nil {
+		return
+	}
+
+	routes, summary := mapper.routeLimit.apply(vrf.Routes)
+	if summary != nil {
+		logging.GetLogger().Debugf("Routing table of VRF %d limited to %d of its %d routes", vrfId, len(routes), summary.Count)
+	}
+
 	for _, n := range intfs {
-		mapper.graph.AddMetadata(n, "Contrail.RoutingTable", vrf.Routes)
+		mapper.setRoutingTable(n, routes, summary)
 		logging.GetLogger().Debugf("Update routes on node %s", n.ID)
 	}
+	mapper.updateVrfNode(vrfId, routes, summary, intfs)
 }
 
 func (mapper *Probe) addRoute(vrfId int, route OpenContrailRoute) {
 	if vrf := mapper.getOrCreateRoutingTable(vrfId); vrf != nil {
 		logging.GetLogger().Debugf("Adding route %v to vrf %d", route, vrfId)
 		for _, r := range vrf.Routes {
-			if r == route {
+			if sameRoute(r, route) {
 				return
 			}
 		}
-		vrf.Routes = append(vrf.Routes, route)
+		routes := []OpenContrailRoute{route}
+		mapper.resolveNexthops(routes)
+		vrf.Routes = append(vrf.Routes, routes...)
 	}
 }
 
@@ -243,107 +386,183 @@ func (mapper *Probe) delRoute(vrfId int, route OpenContrailRoute) {
 	}
 }
 
-// vrfInit uses the Contrail binary rt --dump to get all routes of a VRF.
-func (mapper *Probe) vrfInit(vrfId int) (*RoutingTable, error) {
-	logging.GetLogger().Debugf("Initialization of VRF %d...", vrfId)
-
-	cmd := exec.Command("rt", "--dump", fmt.Sprint(vrfId))
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, err
+// dumpVrf gets the routes of a family of a VRF from the vrouter, falling
+// back to the Contrail binary rt --dump
+func (mapper *Probe) dumpVrf(vrfId int, family, option string) ([]OpenContrailRoute, error) {
+	if mapper.nativeRt.usable() {
+		routes, err := mapper.nativeRt.dump(vrfId, family)
+		if err == nil || !mapper.rtFallback {
+			return routes, err
+		}
+		logging.GetLogger().Warningf("Failed to dump VRF %d natively, using rt: %s", vrfId, err)
 	}
 
-	if err := cmd.Start(); err != nil {
+	stdout, wait, err := mapper.rt.start(mapper.ctx, "--dump", fmt.Sprint(vrfId), "--family", option)
+	if err != nil {
 		return nil, err
 	}
-	defer cmd.Wait()
+	defer wait()
 
-	scanner := bufio.NewScanner(stdout)
-	separator := regexp.MustCompile("[[:space:]]+")
+	return parseRtDump(stdout)
+}
 
-	// Remove the rt --dump stdout header
-	scanner.Scan()
-	scanner.Scan()
-	scanner.Scan()
+// vrfInit gets all the IPv4 and IPv6 routes of a VRF. The IPv6 routes
+// being optional, a VRF is initialized with its IPv4 routes only if the
+// IPv6 ones can not be dumped.
+func (mapper *Probe) vrfInit(vrfId int) (*RoutingTable, error) {
+	logging.GetLogger().Debugf("Initialization of VRF %d...", vrfId)
 
 	vrf := &RoutingTable{}
-	for scanner.Scan() {
-		s := separator.Split(scanner.Text(), -1)
-		// Ignore non complete entries
-		if len(s) != 6 {
-			continue
-		}
-
-		nhId, err := strconv.Atoi(s[4])
+	for _, f := range rtDumpFamilies {
+		routes, err := mapper.dumpVrf(vrfId, f.family, f.option)
 		if err != nil {
+			if f.family != afInetFamily {
+				logging.GetLogger().Warningf("Failed to dump %s routes of VRF %d: %s", f.option, vrfId, err)
+				continue
+			}
 			return nil, err
 		}
-		// These are not interesting routes
-		if nhId == 0 || nhId == 1 {
-			continue
-		}
-
-		// TODO add family
-		vrf.Routes = append(vrf.Routes, OpenContrailRoute{
-			Protocol: OpenContrailRouteProtocol,
-			Prefix:   s[0],
-			NhId:     nhId,
-			Family:   afInetFamily,
-		})
+		vrf.Routes = append(vrf.Routes, routes...)
 	}
+	mapper.resolveNexthops(vrf.Routes)
 
 	mapper.routingTables[vrfId] = vrf
 	return vrf, nil
 }
 
-// We use the binary program "rt" that comes with Contrail to get
-// notifications on Contrail route creations and deletions. These
-// notifications are broadcasted with Netlink by the linux kernel
-// Contrail module. We cannot just listen the Netlink bus because
-// messages are encoded with Sandesh which is bound to the Contrail
-// version. This is why we read the stdout of the "rt" tools.
-func (mapper *Probe) rtMonitor() {
-	cmd := exec.CommandContext(mapper.ctx, "rt", "--monitor")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		logging.GetLogger().Error(err)
+// monitoredNodes returns the host, the vhost and the interfaces whose
+// routing table is maintained by the route monitor
+func (mapper *Probe) monitoredNodes() []*graph.Node {
+	nodes := []*graph.Node{mapper.root}
+	if mapper.vHost != nil {
+		nodes = append(nodes, mapper.vHost)
+	}
+
+	filter := graph.NewElementFilter(filters.NewNotNullFilter("Contrail.VRFID"))
+	nodes = append(nodes, mapper.graph.GetNodes(filter)...)
+	return nodes
+}
+
+// setMonitorError reports the failure of the route monitor on the host, the
+// vhost and the interfaces whose routing table is not updated anymore
+func (mapper *Probe) setMonitorError(err error) {
+	// the monitor is expected to stop when the probe is stopped
+	if mapper.ctx.Err() != nil {
 		return
 	}
-	stdoutBuf := bufio.NewReader(stdout)
 
-	logging.GetLogger().Debugf("Starting OpenContrail route monitor")
-	if err := cmd.Start(); err != nil {
-		logging.GetLogger().Error(err)
+	logging.GetLogger().Error(err)
+
+	mapper.graph.Lock()
+	defer mapper.graph.Unlock()
+
+	topology.SetProbeError(mapper.graph, "opencontrail", err, mapper.monitoredNodes()...)
+	mapper.monitorFailed = true
+}
+
+// clearMonitorError removes the error reported by setMonitorError once the
+// route monitor is running again
+func (mapper *Probe) clearMonitorError() {
+	if !mapper.monitorFailed {
 		return
 	}
+
+	mapper.graph.Lock()
+	defer mapper.graph.Unlock()
+
+	topology.ClearProbeError(mapper.graph, "opencontrail", mapper.monitoredNodes()...)
+	mapper.monitorFailed = false
+}
+
+// rtMonitor gets notifications on Contrail route creations and
+// deletions. These notifications are broadcasted with Netlink by the
+// linux kernel Contrail module, encoded with Sandesh which is bound to
+// the Contrail version. When they can not be decoded, the stdout of the
+// "rt" tool, built with the vrouter, is read instead.
+func (mapper *Probe) rtMonitor() {
+	logging.GetLogger().Debugf("Starting OpenContrail route monitor")
 	defer logging.GetLogger().Debugf("Stopping OpenContrail route monitor")
 
-	go mapper.routingTableUpdater()
+	for restarted := false; ; restarted = true {
+		mapper.setMonitorError(mapper.monitorRoutes(restarted))
+
+		select {
+		case <-mapper.ctx.Done():
+			return
+		case <-time.After(rtMonitorRestartDelay):
+		}
+	}
+}
+
+// onMonitorStarted is called once the route monitor is running. When
+// restarted, the routing tables are resynchronized as route updates may have
+// been missed while the monitor was not running.
+func (mapper *Probe) onMonitorStarted(restarted bool) {
+	mapper.clearMonitorError()
+	if restarted {
+		mapper.Resync()
+	}
+}
+
+func (mapper *Probe) onMonitorRoute(route rtMonitorRoute) {
+	// bridge and EVPN routes are not supported
+	if route.Family != afInetFamily && route.Family != afInet6Family {
+		return
+	}
+	switch route.Operation {
+	case "add":
+		logging.GetLogger().Debugf("Route add %v", route)
+		mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: AddRoute, route: route}
+	case "delete":
+		logging.GetLogger().Debugf("Route delete %v", route)
+		mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: DelRoute, route: route}
+	}
+}
+
+// monitorRoutes reads the route updates until the monitor fails, rt
+// --monitor being used when the native monitor can not be started
+func (mapper *Probe) monitorRoutes(restarted bool) error {
+	if mapper.nativeRt.usable() {
+		started := false
+		onStarted := func() {
+			started = true
+			mapper.onMonitorStarted(restarted)
+		}
+
+		err := mapper.nativeRt.monitor(mapper.ctx, onStarted, mapper.onMonitorRoute)
+		if started || !mapper.rtFallback || mapper.ctx.Err() != nil {
+			return err
+		}
+		logging.GetLogger().Warningf("Failed to monitor routes natively, using rt: %s", err)
+	}
+
+	return mapper.rtMonitorRoutes(restarted)
+}
+
+// rtMonitorRoutes reads the route updates of rt --monitor until it exits
+func (mapper *Probe) rtMonitorRoutes(restarted bool) error {
+	stdout, wait, err := mapper.rt.start(mapper.ctx, "--monitor")
+	if err != nil {
+		return fmt.Errorf("Failed to start 'rt --monitor': %s", err)
+	}
+	stdoutBuf := bufio.NewReader(stdout)
+	defer wait()
+
+	mapper.onMonitorStarted(restarted)
 
 	var route rtMonitorRoute
 	for {
 		line, err := stdoutBuf.ReadString('\n')
 		if err != nil {
 			if err != io.EOF {
-				logging.GetLogger().Errorf("Failed to read 'rt --monitor' output: %s", err)
+				return fmt.Errorf("Failed to read 'rt --monitor' output: %s", err)
 			}
-			return
+			return errors.New("'rt --monitor' exited, routing tables are not updated until it is restarted")
 		}
 		if err := json.Unmarshal([]byte(line), &route); err != nil {
 			logging.GetLogger().Error(err)
 			continue
 		}
-		// We currently only support IPV4 routes
-		if route.Family != afInetFamily {
-			continue
-		}
-		switch route.Operation {
-		case "add":
-			logging.GetLogger().Debugf("Route add %v", route)
-			mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: AddRoute, route: route}
-		case "delete":
-			logging.GetLogger().Debugf("Route delete %v", route)
-			mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: DelRoute, route: route}
-		}
+		mapper.onMonitorRoute(route)
 	}
 }
@@ -0,0 +1,83 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	auth "github.com/abbot/go-http-auth"
+	"github.com/gorilla/mux"
+
+	shttp "github.com/skydive-project/skydive/http"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/rbac"
+)
+
+type routingTableAPI struct {
+	probe *Probe
+}
+
+func (a *routingTableAPI) routesGet(w http.ResponseWriter, r *auth.AuthenticatedRequest) {
+	if !rbac.Enforce(r.Username, "topology", "read") {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	vrfId, err := strconv.Atoi(mux.Vars(&r.Request)["ID"])
+	if err != nil {
+		http.Error(w, "Invalid VRF ID", http.StatusBadRequest)
+		return
+	}
+
+	routes, err := a.probe.GetRoutingTable(vrfId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if routes == nil {
+		http.Error(w, "Unknown VRF", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(routes); err != nil {
+		logging.GetLogger().Warningf("Error while writing response: %s", err)
+	}
+}
+
+// RegisterRoutingTableAPI registers the endpoint serving the full routing
+// table of a VRF, the one reported in the metadata being limited
+func RegisterRoutingTableAPI(s *shttp.Server, p *Probe, authBackend shttp.AuthenticationBackend) {
+	a := &routingTableAPI{probe: p}
+
+	routes := []shttp.Route{
+		{
+			Name:        "OpenContrailRoutingTableGet",
+			Method:      "GET",
+			Path:        "/api/opencontrail/vrf/{ID}/routes",
+			HandlerFunc: a.routesGet,
+		},
+	}
+
+	s.RegisterRoutes(routes, authBackend)
+}
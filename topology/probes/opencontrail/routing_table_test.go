@@ -0,0 +1,86 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+type nodeUpdateCounter struct {
+	graph.DefaultGraphListener
+	id      graph.Identifier
+	updates int64
+}
+
+func (c *nodeUpdateCounter) OnNodeUpdated(n *graph.Node) {
+	if n.ID == c.id {
+		atomic.AddInt64(&c.updates, 1)
+	}
+}
+
+func TestRouteUpdateCoalescing(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AgentService)
+
+	g.Lock()
+	root, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host", "Type": "host"})
+	tap, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "tap1", "Type": "tap", "Contrail": map[string]interface{}{"VRFID": int64(2)}})
+	g.Unlock()
+
+	counter := &nodeUpdateCounter{id: tap.ID}
+	g.AddEventListener(counter)
+
+	mapper := &Probe{
+		graph:                   g,
+		root:                    root,
+		routingTables:           map[int]*RoutingTable{2: {InterfacesUUID: []string{"uuid"}}},
+		routingTableUpdaterChan: make(chan RoutingTableUpdate, 500),
+		routeUpdateWindow:       100 * time.Millisecond,
+	}
+	go mapper.routingTableUpdater()
+	defer close(mapper.routingTableUpdaterChan)
+
+	for i := 0; i < 10; i++ {
+		route := rtMonitorRoute{Operation: "add", Family: afInetFamily, VrfId: 2, Prefix: 32, Address: fmt.Sprintf("10.0.0.%d", i), NhId: 12}
+		mapper.routingTableUpdaterChan <- RoutingTableUpdate{action: AddRoute, route: route}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if updates := atomic.LoadInt64(&counter.updates); updates != 1 {
+		t.Errorf("Expected a single update of the interface, got %d", updates)
+	}
+
+	g.RLock()
+	routes, _ := tap.GetField("Contrail.RoutingTable")
+	g.RUnlock()
+	if routes, ok := routes.([]OpenContrailRoute); !ok || len(routes) != 10 {
+		t.Errorf("Expected 10 routes, got %v", routes)
+	}
+}
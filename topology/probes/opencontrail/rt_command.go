@@ -0,0 +1,200 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// rtCommand runs a Contrail vrouter utility, rt or nh, either locally or
+// on a remote vrouter host
+type rtCommand interface {
+	// start runs the utility with the given arguments and returns its
+	// standard output and a function waiting for its termination
+	start(ctx context.Context, args ...string) (io.Reader, func() error, error)
+}
+
+// rtCommandLine returns the command line of a utility, run in the given network
+// namespace if any. A namespace is either a name, managed by ip netns, or
+// the path of a namespace file.
+func rtCommandLine(path, netns string, args ...string) []string {
+	cmdline := []string{path}
+	switch {
+	case netns == "":
+	case strings.HasPrefix(netns, "/"):
+		cmdline = []string{"nsenter", "--net=" + netns, path}
+	default:
+		cmdline = []string{"ip", "netns", "exec", netns, path}
+	}
+	return append(cmdline, args...)
+}
+
+type localRtCommand struct {
+	path  string
+	netns string
+}
+
+func (c *localRtCommand) start(ctx context.Context, args ...string) (io.Reader, func() error, error) {
+	cmdline := rtCommandLine(c.path, c.netns, args...)
+
+	cmd := exec.CommandContext(ctx, cmdline[0], cmdline[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	return stdout, cmd.Wait, nil
+}
+
+type sshRtCommand struct {
+	address      string
+	clientConfig *ssh.ClientConfig
+	path         string
+	netns        string
+}
+
+// shellQuote quotes an argument of a command run by the remote shell
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func (c *sshRtCommand) start(ctx context.Context, args ...string) (io.Reader, func() error, error) {
+	client, err := ssh.Dial("tcp", c.address, c.clientConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to connect to vrouter host %s: %s", c.address, err)
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	var quoted []string
+	for _, arg := range rtCommandLine(c.path, c.netns, args...) {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	if err := session.Start(strings.Join(quoted, " ")); err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	// closing the connection terminates the remote command
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	wait := func() error {
+		defer client.Close()
+		defer close(done)
+		return session.Wait()
+	}
+
+	return stdout, wait, nil
+}
+
+func newSSHClientConfig() (*ssh.ClientConfig, error) {
+	clientConfig := &ssh.ClientConfig{
+		User:    config.GetString("opencontrail.rt.ssh.user"),
+		Timeout: 10 * time.Second,
+	}
+
+	if keyFile := config.GetString("opencontrail.rt.ssh.key_file"); keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read SSH key: %s", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse SSH key %s: %s", keyFile, err)
+		}
+		clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(signer))
+	}
+
+	if password := config.GetString("opencontrail.rt.ssh.password"); password != "" {
+		clientConfig.Auth = append(clientConfig.Auth, ssh.Password(password))
+	}
+
+	if hostKey := config.GetString("opencontrail.rt.ssh.host_key"); hostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+		if err != nil {
+			return nil, fmt.Errorf("Unable to parse SSH host key: %s", err)
+		}
+		clientConfig.HostKeyCallback = ssh.FixedHostKey(key)
+	} else {
+		logging.GetLogger().Warning("No host key configured for the vrouter host, its identity won't be verified")
+		clientConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	}
+
+	return clientConfig, nil
+}
+
+// newRtCommandFromConfig returns the runner of the utility at the given
+// path, the utility being run over SSH when a vrouter host is configured
+func newRtCommandFromConfig(path string) (rtCommand, error) {
+	netns := config.GetString("opencontrail.rt.netns")
+
+	host := config.GetString("opencontrail.rt.ssh.host")
+	if host == "" {
+		return &localRtCommand{path: path, netns: netns}, nil
+	}
+
+	clientConfig, err := newSSHClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sshRtCommand{
+		address:      net.JoinHostPort(host, strconv.Itoa(config.GetInt("opencontrail.rt.ssh.port"))),
+		clientConfig: clientConfig,
+		path:         path,
+		netns:        netns,
+	}, nil
+}
@@ -0,0 +1,89 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/skydive-project/skydive/config"
+)
+
+func TestRtCommandLine(t *testing.T) {
+	for _, test := range []struct {
+		netns    string
+		expected []string
+	}{
+		{"", []string{"/usr/bin/rt", "--monitor"}},
+		{"vrouter", []string{"ip", "netns", "exec", "vrouter", "/usr/bin/rt", "--monitor"}},
+		{"/proc/1/ns/net", []string{"nsenter", "--net=/proc/1/ns/net", "/usr/bin/rt", "--monitor"}},
+	} {
+		if cmdline := rtCommandLine("/usr/bin/rt", test.netns, "--monitor"); !reflect.DeepEqual(cmdline, test.expected) {
+			t.Errorf("Expected %v for namespace '%s', got %v", test.expected, test.netns, cmdline)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for arg, expected := range map[string]string{
+		"--dump":     `'--dump'`,
+		"my netns":   `'my netns'`,
+		"it's; rm /": `'it'\''s; rm /'`,
+	} {
+		if quoted := shellQuote(arg); quoted != expected {
+			t.Errorf("Expected %s, got %s", expected, quoted)
+		}
+	}
+}
+
+func TestRtCommandFromConfig(t *testing.T) {
+	cfg := config.GetConfig()
+	defer func() {
+		cfg.Set("opencontrail.rt.netns", "")
+		cfg.Set("opencontrail.rt.ssh.host", "")
+		cfg.Set("opencontrail.rt.ssh.password", "")
+	}()
+
+	cfg.Set("opencontrail.rt.netns", "vrouter")
+	command, err := newRtCommandFromConfig("rt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local, ok := command.(*localRtCommand); !ok || local.path != "rt" || local.netns != "vrouter" {
+		t.Errorf("Expected a local command run in the vrouter namespace, got %+v", command)
+	}
+
+	cfg.Set("opencontrail.rt.ssh.host", "fd00::1")
+	cfg.Set("opencontrail.rt.ssh.password", "secret")
+	if command, err = newRtCommandFromConfig("nh"); err != nil {
+		t.Fatal(err)
+	}
+
+	remote, ok := command.(*sshRtCommand)
+	if !ok {
+		t.Fatalf("Expected a remote command, got %+v", command)
+	}
+	if remote.address != "[fd00::1]:22" || remote.path != "nh" || remote.netns != "vrouter" {
+		t.Errorf("Unexpected remote command: %+v", remote)
+	}
+	if remote.clientConfig.User != "root" || len(remote.clientConfig.Auth) != 1 {
+		t.Errorf("Expected a password authentication as root, got %+v", remote.clientConfig)
+	}
+}
@@ -0,0 +1,217 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Columns of the rt --dump output
+const (
+	rtColumnDestination = "Destination"
+	rtColumnPPL         = "PPL"
+	rtColumnFlags       = "Flags"
+	rtColumnLabel       = "Label"
+	rtColumnNexthop     = "Nexthop"
+	rtColumnStitchedMAC = "Stitched MAC"
+)
+
+// columns of the rt releases that do not print a header
+var rtLegacyColumns = []string{rtColumnDestination, rtColumnPPL, rtColumnFlags, rtColumnLabel, rtColumnNexthop, rtColumnStitchedMAC}
+
+var (
+	rtHeaderSeparator = regexp.MustCompile("[[:space:]]{2,}")
+	rtFieldSeparator  = regexp.MustCompile("[[:space:]]+")
+	rtFlags           = regexp.MustCompile("^[A-Za-z]+$")
+)
+
+// rtDumpParser maps the fields of the rt --dump routes to the columns
+// of the header, so that the columns added or removed by the different
+// Contrail releases are supported. As the flags column is empty for the
+// routes without flags, a route can have one field less than the header.
+type rtDumpParser struct {
+	columns []string
+}
+
+// rtColumnName normalizes a header column, "Stitched MAC(Index)" being
+// reported as "Stitched MAC"
+func rtColumnName(column string) string {
+	if i := strings.Index(column, "("); i > 0 {
+		column = column[:i]
+	}
+	return strings.TrimSpace(column)
+}
+
+func newRtDumpParser(header string) *rtDumpParser {
+	p := &rtDumpParser{}
+	for _, column := range rtHeaderSeparator.Split(strings.TrimSpace(header), -1) {
+		p.columns = append(p.columns, rtColumnName(column))
+	}
+	return p
+}
+
+func (p *rtDumpParser) hasColumn(name string) bool {
+	for _, column := range p.columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fields returns the fields of a route indexed by column
+func (p *rtDumpParser) fields(line string) (map[string]string, error) {
+	values := rtFieldSeparator.Split(strings.TrimSpace(line), -1)
+
+	columns := p.columns
+	switch {
+	case len(values) == len(columns):
+	case len(values) == len(columns)-1 && p.hasColumn(rtColumnFlags) && len(values) > 2 && !rtFlags.MatchString(values[2]):
+		// no flag set
+		columns = nil
+		for _, column := range p.columns {
+			if column != rtColumnFlags {
+				columns = append(columns, column)
+			}
+		}
+	case len(values) > len(columns) && len(columns) > 0 && columns[len(columns)-1] == rtColumnStitchedMAC:
+		// the last column may contain spaces
+		values = append(values[:len(columns)-1], strings.Join(values[len(columns)-1:], " "))
+	default:
+		return nil, fmt.Errorf("Unexpected number of fields %d for columns %v", len(values), p.columns)
+	}
+
+	fields := make(map[string]string, len(columns))
+	for i, column := range columns {
+		fields[column] = values[i]
+	}
+	return fields, nil
+}
+
+// rtAtoi parses an optional integer, "-" meaning no value
+func rtAtoi(value string) (int, error) {
+	if value == "" || value == "-" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// parse returns the route described by a line of the rt --dump output
+func (p *rtDumpParser) parse(line string) (*OpenContrailRoute, error) {
+	fields, err := p.fields(line)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fields[rtColumnDestination]
+	ip, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid destination: %s", prefix)
+	}
+
+	family := afInetFamily
+	if ip.To4() == nil {
+		family = afInet6Family
+	}
+
+	nhID, err := strconv.Atoi(fields[rtColumnNexthop])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid nexthop: %s", fields[rtColumnNexthop])
+	}
+
+	ppl, err := rtAtoi(fields[rtColumnPPL])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid PPL: %s", fields[rtColumnPPL])
+	}
+
+	label, err := rtAtoi(fields[rtColumnLabel])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid label: %s", fields[rtColumnLabel])
+	}
+
+	route := &OpenContrailRoute{
+		Protocol:   OpenContrailRouteProtocol,
+		Prefix:     prefix,
+		NhId:       nhID,
+		Family:     family,
+		Preference: ppl,
+		Label:      label,
+	}
+
+	if flags := fields[rtColumnFlags]; flags != "-" {
+		route.Flags = flags
+	}
+
+	if mac := fields[rtColumnStitchedMAC]; mac != "-" {
+		route.StitchedMAC = mac
+	}
+
+	return route, nil
+}
+
+// parseRtDump parses the output of rt --dump, the family of the routes
+// being the one of their destination. The routes are preceded by a
+// header whose columns are used to map the fields of the routes, the
+// legacy columns are used when no header is found.
+func parseRtDump(r io.Reader) (routes []OpenContrailRoute, err error) {
+	scanner := bufio.NewScanner(r)
+
+	var parser *rtDumpParser
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(line), rtColumnDestination) {
+			parser = newRtDumpParser(line)
+			continue
+		}
+
+		if parser == nil {
+			// skip the banner lines of the output
+			if !strings.Contains(strings.Fields(line)[0], "/") {
+				continue
+			}
+			parser = &rtDumpParser{columns: rtLegacyColumns}
+		}
+
+		route, err := parser.parse(line)
+		if err != nil {
+			// ignore non complete entries
+			continue
+		}
+
+		// these are not interesting routes
+		if route.NhId == 0 || route.NhId == 1 {
+			continue
+		}
+
+		routes = append(routes, *route)
+	}
+
+	return routes, scanner.Err()
+}
@@ -0,0 +1,167 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const rtDumpExtended = `Vrouter inet4 routing table 0/1/unicast
+Flags: L=Label Valid, P=Proxy ARP, T=Trap ARP, F=Flood ARP
+
+Destination           PPL        Flags        Label         Nexthop    Stitched MAC(Index)
+0.0.0.0/8               0                     -              1        -
+10.0.0.3/32            32           LP       25             21        2:b:e5:1f:d5:a4(79380)
+10.0.0.4/32            32            P        -             18        -
+169.254.169.254/32     32           PT        -             14        -
+`
+
+const rtDumpLegacy = `Kernel IP routing table 0/1/unicast
+Flags: L=Label Valid, P=Proxy ARP, T=Trap ARP, F=Flood ARP
+
+10.0.0.3/32            32           LP       25             21        2:b:e5:1f:d5:a4
+10.0.0.4/32            32                     -             18        -
+`
+
+const rtDumpNoMAC = `Destination           PPL        Flags        Label         Nexthop
+10.0.0.3/32            32           LP       25             21
+10.0.0.4/32            32                     -             18
+`
+
+const rtDumpInet6 = `Vrouter inet6 routing table 0/1/unicast
+Flags: L=Label Valid, P=Proxy ARP, T=Trap ARP, F=Flood ARP
+
+Destination                PPL        Flags        Label         Nexthop    Stitched MAC(Index)
+::/0                         0                     -              1        -
+fd00::3/128                128           LP       25             21        2:b:e5:1f:d5:a4(79380)
+fe80::/64                   64            T        -             14        -
+`
+
+// fakeRtCommand returns the output of rt --dump for the given family
+type fakeRtCommand map[string]string
+
+func (c fakeRtCommand) start(ctx context.Context, args ...string) (io.Reader, func() error, error) {
+	return strings.NewReader(c[args[len(args)-1]]), func() error { return nil }, nil
+}
+
+func TestParseRtDumpExtended(t *testing.T) {
+	routes, err := parseRtDump(strings.NewReader(rtDumpExtended))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OpenContrailRoute{
+		{Family: afInetFamily, Prefix: "10.0.0.3/32", NhId: 21, Protocol: OpenContrailRouteProtocol, Preference: 32, Flags: "LP", Label: 25, StitchedMAC: "2:b:e5:1f:d5:a4(79380)"},
+		{Family: afInetFamily, Prefix: "10.0.0.4/32", NhId: 18, Protocol: OpenContrailRouteProtocol, Preference: 32, Flags: "P"},
+		{Family: afInetFamily, Prefix: "169.254.169.254/32", NhId: 14, Protocol: OpenContrailRouteProtocol, Preference: 32, Flags: "PT"},
+	}
+
+	if !reflect.DeepEqual(expected, routes) {
+		t.Errorf("Expected %+v, got %+v", expected, routes)
+	}
+}
+
+func TestParseRtDumpLegacy(t *testing.T) {
+	routes, err := parseRtDump(strings.NewReader(rtDumpLegacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OpenContrailRoute{
+		{Family: afInetFamily, Prefix: "10.0.0.3/32", NhId: 21, Protocol: OpenContrailRouteProtocol, Preference: 32, Flags: "LP", Label: 25, StitchedMAC: "2:b:e5:1f:d5:a4"},
+		{Family: afInetFamily, Prefix: "10.0.0.4/32", NhId: 18, Protocol: OpenContrailRouteProtocol, Preference: 32},
+	}
+
+	if !reflect.DeepEqual(expected, routes) {
+		t.Errorf("Expected %+v, got %+v", expected, routes)
+	}
+}
+
+func TestParseRtDumpWithoutStitchedMAC(t *testing.T) {
+	routes, err := parseRtDump(strings.NewReader(rtDumpNoMAC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OpenContrailRoute{
+		{Family: afInetFamily, Prefix: "10.0.0.3/32", NhId: 21, Protocol: OpenContrailRouteProtocol, Preference: 32, Flags: "LP", Label: 25},
+		{Family: afInetFamily, Prefix: "10.0.0.4/32", NhId: 18, Protocol: OpenContrailRouteProtocol, Preference: 32},
+	}
+
+	if !reflect.DeepEqual(expected, routes) {
+		t.Errorf("Expected %+v, got %+v", expected, routes)
+	}
+}
+
+func TestParseRtDumpInet6(t *testing.T) {
+	routes, err := parseRtDump(strings.NewReader(rtDumpInet6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []OpenContrailRoute{
+		{Family: afInet6Family, Prefix: "fd00::3/128", NhId: 21, Protocol: OpenContrailRouteProtocol, Preference: 128, Flags: "LP", Label: 25, StitchedMAC: "2:b:e5:1f:d5:a4(79380)"},
+		{Family: afInet6Family, Prefix: "fe80::/64", NhId: 14, Protocol: OpenContrailRouteProtocol, Preference: 64, Flags: "T"},
+	}
+
+	if !reflect.DeepEqual(expected, routes) {
+		t.Errorf("Expected %+v, got %+v", expected, routes)
+	}
+}
+
+func TestVrfInitMixedFamilies(t *testing.T) {
+	mapper := &Probe{
+		ctx:           context.Background(),
+		routingTables: make(map[int]*RoutingTable),
+		rt:            fakeRtCommand{"inet": rtDumpNoMAC, "inet6": rtDumpInet6},
+	}
+
+	vrf, err := mapper.vrfInit(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	families := make(map[string]int)
+	for _, route := range vrf.Routes {
+		families[route.Family]++
+	}
+
+	if families[afInetFamily] != 2 || families[afInet6Family] != 2 {
+		t.Errorf("Expected 2 IPv4 and 2 IPv6 routes, got %+v", vrf.Routes)
+	}
+
+	// the routes of both families are updated by the monitor
+	mapper.addRoute(1, OpenContrailRoute{Family: afInet6Family, Prefix: "fd00::5/128", NhId: 22, Protocol: OpenContrailRouteProtocol})
+	mapper.delRoute(1, OpenContrailRoute{Family: afInet6Family, Prefix: "fd00::3/128", NhId: 21, Protocol: OpenContrailRouteProtocol})
+	mapper.delRoute(1, OpenContrailRoute{Family: afInetFamily, Prefix: "10.0.0.4/32", NhId: 18, Protocol: OpenContrailRouteProtocol})
+
+	var prefixes []string
+	for _, route := range mapper.routingTables[1].Routes {
+		prefixes = append(prefixes, route.Prefix)
+	}
+
+	if expected := []string{"10.0.0.3/32", "fe80::/64", "fd00::5/128"}; !reflect.DeepEqual(expected, prefixes) {
+		t.Errorf("Expected prefixes %v, got %v", expected, prefixes)
+	}
+}
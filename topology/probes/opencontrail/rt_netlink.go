@@ -0,0 +1,340 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/logging"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// Generic netlink family of the vrouter kernel module, its messages
+// carrying Sandesh objects in the NL_ATTR_VR_MESSAGE_PROTOCOL attribute
+const (
+	vrouterGenlFamily       = "vrouter"
+	vrouterGenlCommand      = 1 // SANDESH_REQUEST
+	nlAttrVrMessageProtocol = 1
+	sizeofGenlmsg           = 4
+)
+
+// Versions of the vrouter generic netlink family known by the decoder
+const (
+	vrouterGenlMinVersion = 1
+	vrouterGenlMaxVersion = 1
+)
+
+// rtBackends selected with opencontrail.rt.backend
+const (
+	rtBackendAuto   = "auto"
+	rtBackendNative = "native"
+	rtBackendExec   = "exec"
+)
+
+// netlinkRtClient dumps and monitors the vrouter routes through generic
+// netlink, without the rt utility
+type netlinkRtClient struct {
+	sync.Mutex
+	family   *netlink.GenlFamily
+	version  uint8
+	disabled int32
+}
+
+// resolve returns the vrouter family and the version used for the requests,
+// the highest one supported by both the vrouter and the decoder. The family
+// is resolved again after a failure as its ID changes when the vrouter
+// module is reloaded.
+func (c *netlinkRtClient) resolve() (*netlink.GenlFamily, uint8, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.family != nil {
+		return c.family, c.version, nil
+	}
+
+	family, err := netlink.GenlFamilyGet(vrouterGenlFamily)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to get the %s netlink family: %s", vrouterGenlFamily, err)
+	}
+
+	if family.Version < vrouterGenlMinVersion {
+		return nil, 0, layoutError("%s netlink family version %d, at least %d expected", vrouterGenlFamily, family.Version, vrouterGenlMinVersion)
+	}
+
+	version := family.Version
+	if version > vrouterGenlMaxVersion {
+		version = vrouterGenlMaxVersion
+	}
+	logging.GetLogger().Debugf("Using %s netlink family version %d (version %d supported by the vrouter)", vrouterGenlFamily, version, family.Version)
+
+	c.family, c.version = family, uint8(version)
+	return family, c.version, nil
+}
+
+func (c *netlinkRtClient) reset() {
+	c.Lock()
+	c.family = nil
+	c.Unlock()
+}
+
+// usable returns whether the native client can be used, the client being
+// disabled when the vrouter messages can not be decoded
+func (c *netlinkRtClient) usable() bool {
+	return c != nil && atomic.LoadInt32(&c.disabled) == 0
+}
+
+// failed handles an error of the native client, disabling it for good when
+// the messages of the vrouter are not supported
+func (c *netlinkRtClient) failed(err error) {
+	if _, ok := err.(*sandeshLayoutError); ok {
+		if atomic.CompareAndSwapInt32(&c.disabled, 0, 1) {
+			logging.GetLogger().Warningf("Native vrouter route decoder disabled, using rt: %s", err)
+		}
+		return
+	}
+	c.reset()
+}
+
+// messageObjects returns the Sandesh objects of a vrouter netlink message
+func messageObjects(msg []byte) ([]*sandeshObject, error) {
+	if len(msg) < sizeofGenlmsg {
+		return nil, errors.New("Truncated vrouter netlink message")
+	}
+
+	attrs, err := nl.ParseRouteAttr(msg[sizeofGenlmsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*sandeshObject
+	for _, attr := range attrs {
+		if attr.Attr.Type != nlAttrVrMessageProtocol {
+			continue
+		}
+
+		objs, err := decodeSandesh(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
+
+func (c *netlinkRtClient) request(payload []byte) ([]*sandeshObject, error) {
+	family, version, err := c.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	req := nl.NewNetlinkRequest(int(family.ID), 0)
+	req.AddData(&nl.Genlmsg{Command: vrouterGenlCommand, Version: version})
+	req.AddData(nl.NewRtAttr(nlAttrVrMessageProtocol, payload))
+
+	msgs, err := req.Execute(unix.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*sandeshObject
+	for _, msg := range msgs {
+		objs, err := messageObjects(msg)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, objs...)
+	}
+	return objects, nil
+}
+
+// dump returns the routes of a family of a VRF, requested by batches, each
+// request starting after the last route of the previous response
+func (c *netlinkRtClient) dump(vrfID int, family string) (routes []OpenContrailRoute, err error) {
+	defer func() {
+		if err != nil {
+			c.failed(err)
+		}
+	}()
+
+	var marker *vrRoute
+	for {
+		objects, err := c.request(encodeRouteDump(vrfID, family, marker))
+		if err != nil {
+			return nil, err
+		}
+
+		incomplete := false
+		for _, o := range objects {
+			switch o.name {
+			case vrResponseName:
+				code, err := vrResponseCode(o)
+				if err != nil {
+					return nil, err
+				}
+				if code < 0 {
+					return nil, fmt.Errorf("Failed to dump VRF %d: %s", vrfID, syscall.Errno(-code))
+				}
+				incomplete = code&vrMessageDumpIncomplete != 0
+			case vrRouteReqName:
+				r, err := decodeVrRoute(o)
+				if err != nil {
+					return nil, err
+				}
+				if r == nil || r.family != family {
+					continue
+				}
+				marker = r
+
+				// these are not interesting routes
+				if r.nhID == 0 || r.nhID == 1 {
+					continue
+				}
+				routes = append(routes, r.route())
+			}
+		}
+
+		if !incomplete || marker == nil {
+			return routes, nil
+		}
+	}
+}
+
+// monitor subscribes to the multicast groups of the vrouter family and
+// reports the route updates until the context is cancelled. onStarted is
+// called once subscribed.
+func (c *netlinkRtClient) monitor(ctx context.Context, onStarted func(), onRoute func(rtMonitorRoute)) (err error) {
+	defer func() {
+		if err != nil && ctx.Err() == nil {
+			c.failed(err)
+		}
+	}()
+
+	family, _, err := c.resolve()
+	if err != nil {
+		return err
+	}
+
+	if len(family.Groups) == 0 {
+		return layoutError("no multicast group in the %s netlink family", vrouterGenlFamily)
+	}
+
+	socket, err := nl.Subscribe(unix.NETLINK_GENERIC)
+	if err != nil {
+		return err
+	}
+	defer socket.Close()
+
+	for _, group := range family.Groups {
+		if err := unix.SetsockoptInt(socket.GetFd(), unix.SOL_NETLINK, unix.NETLINK_ADD_MEMBERSHIP, int(group.ID)); err != nil {
+			return fmt.Errorf("Failed to join the %s netlink group %s: %s", vrouterGenlFamily, group.Name, err)
+		}
+	}
+
+	// closing the socket interrupts the reception
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			socket.Close()
+		case <-done:
+		}
+	}()
+
+	onStarted()
+
+	for {
+		msgs, err := socket.Receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("Failed to receive vrouter route updates: %s", err)
+		}
+
+		for _, msg := range msgs {
+			if msg.Header.Type != family.ID {
+				continue
+			}
+
+			objects, err := messageObjects(msg.Data)
+			if err != nil {
+				return err
+			}
+
+			for _, o := range objects {
+				if o.name != vrRouteReqName {
+					continue
+				}
+
+				r, err := decodeVrRoute(o)
+				if err != nil {
+					return err
+				}
+				if r == nil {
+					continue
+				}
+
+				if route, ok := r.monitorRoute(); ok {
+					onRoute(route)
+				}
+			}
+		}
+	}
+}
+
+// newNetlinkRtClientFromConfig returns the native route client, nil when rt
+// has to be used. As the vrouter netlink family is only reachable locally,
+// rt is used when run over SSH or in another network namespace. The second
+// value tells whether rt is used when the native client fails.
+func newNetlinkRtClientFromConfig() (*netlinkRtClient, bool, error) {
+	switch backend := config.GetString("opencontrail.rt.backend"); backend {
+	case rtBackendExec:
+		return nil, false, nil
+	case rtBackendNative:
+		c := &netlinkRtClient{}
+		if _, _, err := c.resolve(); err != nil {
+			return nil, false, err
+		}
+		return c, false, nil
+	case rtBackendAuto, "":
+		if config.GetString("opencontrail.rt.ssh.host") != "" || config.GetString("opencontrail.rt.netns") != "" {
+			return nil, true, nil
+		}
+
+		c := &netlinkRtClient{}
+		if _, _, err := c.resolve(); err != nil {
+			logging.GetLogger().Infof("Using rt to get the vrouter routes: %s", err)
+			return nil, true, nil
+		}
+		return c, true, nil
+	default:
+		return nil, false, fmt.Errorf("Invalid OpenContrail rt backend %s, expected %s, %s or %s", backend, rtBackendAuto, rtBackendNative, rtBackendExec)
+	}
+}
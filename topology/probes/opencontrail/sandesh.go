@@ -0,0 +1,580 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Types of the Sandesh binary protocol, a Thrift binary protocol
+// extended with unsigned integers and addresses
+const (
+	sandeshStop   byte = 0
+	sandeshBool   byte = 2
+	sandeshByte   byte = 3
+	sandeshDouble byte = 4
+	sandeshI16    byte = 6
+	sandeshI32    byte = 8
+	sandeshI64    byte = 10
+	sandeshString byte = 11
+	sandeshStruct byte = 12
+	sandeshMap    byte = 13
+	sandeshSet    byte = 14
+	sandeshList   byte = 15
+	sandeshU16    byte = 17
+	sandeshU32    byte = 18
+	sandeshU64    byte = 19
+	sandeshIPv4   byte = 20
+	sandeshXML    byte = 21
+	sandeshUUID   byte = 22
+)
+
+// Operations of the vrouter Sandesh requests
+const (
+	sandeshOperAdd  int64 = 0
+	sandeshOperGet  int64 = 1
+	sandeshOperDel  int64 = 2
+	sandeshOperDump int64 = 3
+)
+
+// Names of the vrouter Sandesh objects
+const (
+	vrRouteReqName = "vr_route_req"
+	vrResponseName = "vr_response"
+)
+
+// vrMessageDumpIncomplete is set in the code of the vr_response of a dump
+// when more objects have to be requested
+const vrMessageDumpIncomplete = 0x40000000
+
+// Flags of the vrouter routes, in the order used by rt --dump
+var vrRouteFlags = []struct {
+	flag int64
+	name string
+}{
+	{0x1, "L"}, // label valid
+	{0x2, "P"}, // proxy ARP
+	{0x4, "T"}, // trap ARP
+	{0x8, "F"}, // flood ARP
+}
+
+// Fields of vr_route_req
+const (
+	rtrOp          int16 = 1
+	rtrVrfID       int16 = 2
+	rtrFamily      int16 = 3
+	rtrPrefix      int16 = 4
+	rtrPrefixLen   int16 = 5
+	rtrRid         int16 = 6
+	rtrLabelFlags  int16 = 7
+	rtrLabel       int16 = 8
+	rtrNhID        int16 = 9
+	rtrMarker      int16 = 10
+	rtrMarkerPlen  int16 = 11
+	rtrMAC         int16 = 12
+	rtrReplacePlen int16 = 13
+	rtrIndex       int16 = 14
+)
+
+// vrRespCode is the field of vr_response holding its code
+const vrRespCode int16 = 2
+
+// sandeshLayoutError is returned when the objects sent by the vrouter do
+// not match the layout known by the decoder. The rt utility, built with the
+// vrouter, has then to be used.
+type sandeshLayoutError struct {
+	msg string
+}
+
+func (e *sandeshLayoutError) Error() string {
+	return "Unsupported vrouter Sandesh layout: " + e.msg
+}
+
+func layoutError(format string, args ...interface{}) error {
+	return &sandeshLayoutError{msg: fmt.Sprintf(format, args...)}
+}
+
+// sandeshField is a decoded field, integers being decoded as int64, lists
+// of bytes as []byte and the other lists and sets as []interface{}.
+// Structures and maps are skipped, their value being nil.
+type sandeshField struct {
+	typ   byte
+	value interface{}
+}
+
+// sandeshObject is a Sandesh object, a named structure
+type sandeshObject struct {
+	name   string
+	fields map[int16]sandeshField
+}
+
+func isSandeshInteger(typ byte) bool {
+	switch typ {
+	case sandeshByte, sandeshI16, sandeshI32, sandeshI64, sandeshU16, sandeshU32, sandeshU64:
+		return true
+	}
+	return false
+}
+
+// int returns an integer field. The width of the integers may change
+// between the vrouter releases, only the kind of the field is checked.
+func (o *sandeshObject) int(id int16) (int64, bool, error) {
+	f, ok := o.fields[id]
+	if !ok {
+		return 0, false, nil
+	}
+	if !isSandeshInteger(f.typ) {
+		return 0, false, layoutError("field %d of %s has type %d, expected an integer", id, o.name, f.typ)
+	}
+	return f.value.(int64), true, nil
+}
+
+// bytes returns a list of bytes field
+func (o *sandeshObject) bytes(id int16) ([]byte, error) {
+	f, ok := o.fields[id]
+	if !ok {
+		return nil, nil
+	}
+	b, ok := f.value.([]byte)
+	if !ok {
+		return nil, layoutError("field %d of %s has type %d, expected a list of bytes", id, o.name, f.typ)
+	}
+	return b, nil
+}
+
+type sandeshDecoder struct {
+	r *bytes.Reader
+}
+
+func (d *sandeshDecoder) read(v interface{}) error {
+	return binary.Read(d.r, binary.BigEndian, v)
+}
+
+func (d *sandeshDecoder) readString() (string, error) {
+	var size int32
+	if err := d.read(&size); err != nil {
+		return "", err
+	}
+	if size < 0 || int(size) > d.r.Len() {
+		return "", fmt.Errorf("Invalid Sandesh string length %d", size)
+	}
+	b := make([]byte, size)
+	if _, err := d.r.Read(b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *sandeshDecoder) readInt(size int, signed bool) (int64, error) {
+	b := make([]byte, size)
+	if _, err := d.r.Read(b); err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+
+	if signed && size < 8 && b[0]&0x80 != 0 {
+		// sign extension
+		u |= ^uint64(0) << uint(size*8)
+	}
+	return int64(u), nil
+}
+
+func (d *sandeshDecoder) skip(size int) error {
+	if size > d.r.Len() {
+		return errors.New("Truncated Sandesh value")
+	}
+	_, err := d.r.Seek(int64(size), 1)
+	return err
+}
+
+func (d *sandeshDecoder) readValue(typ byte) (interface{}, error) {
+	switch typ {
+	case sandeshBool:
+		v, err := d.readInt(1, false)
+		return v != 0, err
+	case sandeshByte:
+		return d.readInt(1, true)
+	case sandeshI16:
+		return d.readInt(2, true)
+	case sandeshI32:
+		return d.readInt(4, true)
+	case sandeshI64:
+		return d.readInt(8, true)
+	case sandeshU16:
+		return d.readInt(2, false)
+	case sandeshU32:
+		return d.readInt(4, false)
+	case sandeshU64:
+		return d.readInt(8, false)
+	case sandeshDouble:
+		return nil, d.skip(8)
+	case sandeshIPv4:
+		return nil, d.skip(4)
+	case sandeshUUID:
+		return nil, d.skip(16)
+	case sandeshString, sandeshXML:
+		return d.readString()
+	case sandeshStruct:
+		_, err := d.readFields()
+		return nil, err
+	case sandeshMap:
+		var keyType, valueType byte
+		var size int32
+		if err := d.read(&keyType); err != nil {
+			return nil, err
+		}
+		if err := d.read(&valueType); err != nil {
+			return nil, err
+		}
+		if err := d.read(&size); err != nil {
+			return nil, err
+		}
+		for i := int32(0); i < size; i++ {
+			if _, err := d.readValue(keyType); err != nil {
+				return nil, err
+			}
+			if _, err := d.readValue(valueType); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	case sandeshSet, sandeshList:
+		var elemType byte
+		var size int32
+		if err := d.read(&elemType); err != nil {
+			return nil, err
+		}
+		if err := d.read(&size); err != nil {
+			return nil, err
+		}
+		if size < 0 || int(size) > d.r.Len() {
+			return nil, fmt.Errorf("Invalid Sandesh list size %d", size)
+		}
+
+		if elemType == sandeshByte {
+			b := make([]byte, size)
+			_, err := d.r.Read(b)
+			return b, err
+		}
+
+		values := make([]interface{}, 0, size)
+		for i := int32(0); i < size; i++ {
+			v, err := d.readValue(elemType)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("Unknown Sandesh type %d", typ)
+}
+
+func (d *sandeshDecoder) readFields() (map[int16]sandeshField, error) {
+	fields := make(map[int16]sandeshField)
+	for {
+		var typ byte
+		if err := d.read(&typ); err != nil {
+			return nil, err
+		}
+		if typ == sandeshStop {
+			return fields, nil
+		}
+
+		var id int16
+		if err := d.read(&id); err != nil {
+			return nil, err
+		}
+
+		value, err := d.readValue(typ)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode Sandesh field %d: %s", id, err)
+		}
+		fields[id] = sandeshField{typ: typ, value: value}
+	}
+}
+
+// decodeSandesh decodes the Sandesh objects of a vrouter netlink message.
+// The unknown fields are skipped so that the fields added by the newer
+// vrouter releases are ignored.
+func decodeSandesh(b []byte) ([]*sandeshObject, error) {
+	d := &sandeshDecoder{r: bytes.NewReader(b)}
+
+	var objects []*sandeshObject
+	for d.r.Len() > 0 {
+		name, err := d.readString()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode Sandesh object: %s", err)
+		}
+
+		fields, err := d.readFields()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode Sandesh object %s: %s", name, err)
+		}
+		objects = append(objects, &sandeshObject{name: name, fields: fields})
+	}
+	return objects, nil
+}
+
+// sandeshEncoder encodes the requests sent to the vrouter
+type sandeshEncoder struct {
+	bytes.Buffer
+}
+
+func (e *sandeshEncoder) write(v interface{}) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *sandeshEncoder) begin(name string) {
+	e.write(int32(len(name)))
+	e.WriteString(name)
+}
+
+func (e *sandeshEncoder) end() {
+	e.WriteByte(sandeshStop)
+}
+
+func (e *sandeshEncoder) fieldBegin(typ byte, id int16) {
+	e.WriteByte(typ)
+	e.write(id)
+}
+
+func (e *sandeshEncoder) i16(id int16, v int16) {
+	e.fieldBegin(sandeshI16, id)
+	e.write(v)
+}
+
+func (e *sandeshEncoder) i32(id int16, v int32) {
+	e.fieldBegin(sandeshI32, id)
+	e.write(v)
+}
+
+func (e *sandeshEncoder) bytes(id int16, b []byte) {
+	e.fieldBegin(sandeshList, id)
+	e.WriteByte(sandeshByte)
+	e.write(int32(len(b)))
+	e.Write(b)
+}
+
+// vrRoute is a route decoded from a vr_route_req object
+type vrRoute struct {
+	op          int64
+	vrfID       int
+	family      string
+	address     net.IP
+	prefixLen   int
+	replacePlen int
+	flags       int64
+	label       int
+	nhID        int
+	mac         net.HardwareAddr
+	index       int
+	hasIndex    bool
+}
+
+// routeFamilies maps the address families of the vrouter to the families
+// of the routes
+var routeFamilies = map[int64]string{
+	2:  afInetFamily,
+	10: afInet6Family,
+}
+
+func familyNumber(family string) int32 {
+	for n, f := range routeFamilies {
+		if f == family {
+			return int32(n)
+		}
+	}
+	return 0
+}
+
+// decodeVrRoute returns the route of a vr_route_req object, nil for the
+// bridge and EVPN routes
+func decodeVrRoute(o *sandeshObject) (*vrRoute, error) {
+	var values [8]int64
+	for i, id := range []int16{rtrOp, rtrVrfID, rtrFamily, rtrPrefixLen, rtrReplacePlen, rtrLabelFlags, rtrLabel, rtrNhID} {
+		v, _, err := o.int(id)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+
+	family, ok := routeFamilies[values[2]]
+	if !ok {
+		return nil, nil
+	}
+
+	prefix, err := o.bytes(rtrPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(prefix) != net.IPv4len && len(prefix) != net.IPv6len {
+		return nil, layoutError("invalid prefix %v", prefix)
+	}
+
+	mac, err := o.bytes(rtrMAC)
+	if err != nil {
+		return nil, err
+	}
+
+	index, hasIndex, err := o.int(rtrIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vrRoute{
+		op:          values[0],
+		vrfID:       int(values[1]),
+		family:      family,
+		address:     net.IP(prefix),
+		prefixLen:   int(values[3]),
+		replacePlen: int(values[4]),
+		flags:       values[5],
+		label:       int(values[6]),
+		nhID:        int(values[7]),
+		mac:         net.HardwareAddr(mac),
+		index:       int(index),
+		hasIndex:    hasIndex,
+	}, nil
+}
+
+// stitchedMAC formats the stitched MAC as rt --dump does
+func (r *vrRoute) stitchedMAC() string {
+	if len(r.mac) == 0 || bytes.Equal(r.mac, make([]byte, len(r.mac))) {
+		return ""
+	}
+
+	var parts []string
+	for _, b := range r.mac {
+		parts = append(parts, strconv.FormatUint(uint64(b), 16))
+	}
+
+	mac := strings.Join(parts, ":")
+	if r.hasIndex && r.index >= 0 {
+		mac += fmt.Sprintf("(%d)", r.index)
+	}
+	return mac
+}
+
+func (r *vrRoute) prefix() string {
+	return fmt.Sprintf("%s/%d", r.address, r.prefixLen)
+}
+
+// route returns the route as reported by rt --dump
+func (r *vrRoute) route() OpenContrailRoute {
+	route := OpenContrailRoute{
+		Family:      r.family,
+		Prefix:      r.prefix(),
+		NhId:        r.nhID,
+		Protocol:    OpenContrailRouteProtocol,
+		Preference:  r.replacePlen,
+		StitchedMAC: r.stitchedMAC(),
+	}
+
+	for _, f := range vrRouteFlags {
+		if r.flags&f.flag != 0 {
+			route.Flags += f.name
+		}
+	}
+
+	if r.flags&vrRouteFlags[0].flag != 0 {
+		route.Label = r.label
+	}
+
+	return route
+}
+
+// monitorRoute returns the route as reported by rt --monitor
+func (r *vrRoute) monitorRoute() (rtMonitorRoute, bool) {
+	route := rtMonitorRoute{
+		Family:  r.family,
+		VrfId:   r.vrfID,
+		Prefix:  r.prefixLen,
+		Address: r.address.String(),
+		NhId:    r.nhID,
+	}
+
+	switch r.op {
+	case sandeshOperAdd:
+		route.Operation = "add"
+	case sandeshOperDel:
+		route.Operation = "delete"
+	default:
+		return route, false
+	}
+	return route, true
+}
+
+// encodeRouteDump returns the vr_route_req requesting the routes of a VRF
+// following the marker, the last route of the previous response
+func encodeRouteDump(vrfID int, family string, marker *vrRoute) []byte {
+	addrLen := net.IPv4len
+	if family == afInet6Family {
+		addrLen = net.IPv6len
+	}
+
+	e := &sandeshEncoder{}
+	e.begin(vrRouteReqName)
+	e.i32(rtrOp, int32(sandeshOperDump))
+	e.i32(rtrVrfID, int32(vrfID))
+	e.i32(rtrFamily, familyNumber(family))
+	e.bytes(rtrPrefix, make([]byte, addrLen))
+	e.i32(rtrPrefixLen, 0)
+	e.i16(rtrRid, 0)
+	e.bytes(rtrMAC, make([]byte, 6))
+	if marker != nil {
+		address := marker.address
+		if family == afInetFamily {
+			address = address.To4()
+		}
+		e.bytes(rtrMarker, address)
+		e.i32(rtrMarkerPlen, int32(marker.prefixLen))
+	} else {
+		e.bytes(rtrMarker, make([]byte, addrLen))
+		e.i32(rtrMarkerPlen, 0)
+	}
+	e.end()
+
+	return e.Bytes()
+}
+
+// vrResponseCode returns the code of a vr_response object, a negative
+// errno on failure
+func vrResponseCode(o *sandeshObject) (int64, error) {
+	code, ok, err := o.int(vrRespCode)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, layoutError("no code in %s", vrResponseName)
+	}
+	return code, nil
+}
@@ -0,0 +1,160 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"reflect"
+	"testing"
+)
+
+// encodeVrRoute returns a vr_route_req as sent by the vrouter, with a field
+// unknown to the decoder
+func encodeVrRoute(op int64, prefix []byte, prefixLen int32, flags int16, mac []byte) []byte {
+	e := &sandeshEncoder{}
+	e.begin(vrRouteReqName)
+	e.i32(rtrOp, int32(op))
+	e.i32(rtrVrfID, 3)
+	family := afInetFamily
+	if len(prefix) == 16 {
+		family = afInet6Family
+	}
+	e.i32(rtrFamily, familyNumber(family))
+	e.bytes(rtrPrefix, prefix)
+	e.i32(rtrPrefixLen, prefixLen)
+	e.i16(rtrLabelFlags, flags)
+	e.i32(rtrLabel, 25)
+	e.i32(rtrNhID, 21)
+	e.bytes(rtrMAC, mac)
+	e.i32(rtrReplacePlen, prefixLen)
+	e.i32(rtrIndex, 79380)
+
+	e.fieldBegin(sandeshString, 42)
+	e.write(int32(3))
+	e.WriteString("new")
+	e.end()
+
+	return e.Bytes()
+}
+
+func encodeVrResponse(code int32) []byte {
+	e := &sandeshEncoder{}
+	e.begin(vrResponseName)
+	e.i32(rtrOp, int32(sandeshOperDump))
+	e.i32(vrRespCode, code)
+	e.end()
+	return e.Bytes()
+}
+
+func TestDecodeVrRoutes(t *testing.T) {
+	var msg []byte
+	msg = append(msg, encodeVrResponse(vrMessageDumpIncomplete)...)
+	msg = append(msg, encodeVrRoute(sandeshOperDump, []byte{10, 0, 0, 3}, 32, 0x3, []byte{2, 0xb, 0xe5, 0x1f, 0xd5, 0xa4})...)
+	msg = append(msg, encodeVrRoute(sandeshOperDump, []byte{0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 4}, 128, 0x4, make([]byte, 6))...)
+
+	objects, err := decodeSandesh(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(objects) != 3 || objects[0].name != vrResponseName {
+		t.Fatalf("Expected a response followed by 2 routes, got %+v", objects)
+	}
+
+	if code, err := vrResponseCode(objects[0]); err != nil || code&vrMessageDumpIncomplete == 0 {
+		t.Errorf("Expected an incomplete dump, got %d (%v)", code, err)
+	}
+
+	var routes []OpenContrailRoute
+	for _, o := range objects[1:] {
+		r, err := decodeVrRoute(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes = append(routes, r.route())
+	}
+
+	expected := []OpenContrailRoute{
+		{Family: afInetFamily, Prefix: "10.0.0.3/32", NhId: 21, Protocol: OpenContrailRouteProtocol, Preference: 32, Flags: "LP", Label: 25, StitchedMAC: "2:b:e5:1f:d5:a4(79380)"},
+		{Family: afInet6Family, Prefix: "fd00::4/128", NhId: 21, Protocol: OpenContrailRouteProtocol, Preference: 128, Flags: "T"},
+	}
+
+	if !reflect.DeepEqual(expected, routes) {
+		t.Errorf("Expected %+v, got %+v", expected, routes)
+	}
+}
+
+func TestDecodeVrRouteUpdate(t *testing.T) {
+	objects, err := decodeSandesh(encodeVrRoute(sandeshOperDel, []byte{10, 0, 0, 4}, 32, 0, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := decodeVrRoute(objects[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	route, ok := r.monitorRoute()
+	expected := rtMonitorRoute{Operation: "delete", Family: afInetFamily, VrfId: 3, Prefix: 32, Address: "10.0.0.4", NhId: 21}
+	if !ok || route != expected {
+		t.Errorf("Expected %+v, got %+v", expected, route)
+	}
+}
+
+func TestDecodeVrRouteLayoutMismatch(t *testing.T) {
+	e := &sandeshEncoder{}
+	e.begin(vrRouteReqName)
+	e.i32(rtrFamily, familyNumber(afInetFamily))
+	e.i32(rtrPrefix, 0x0a000003)
+	e.end()
+
+	objects, err := decodeSandesh(e.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decodeVrRoute(objects[0]); err == nil {
+		t.Error("Expected a layout error")
+	} else if _, ok := err.(*sandeshLayoutError); !ok {
+		t.Errorf("Expected a layout error, got %s", err)
+	}
+}
+
+func TestEncodeRouteDump(t *testing.T) {
+	marker := &vrRoute{address: []byte{10, 0, 0, 3}, prefixLen: 32}
+
+	objects, err := decodeSandesh(encodeRouteDump(3, afInetFamily, marker))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := objects[0]
+	if op, _, _ := o.int(rtrOp); op != sandeshOperDump {
+		t.Errorf("Expected a dump request, got operation %d", op)
+	}
+
+	if vrf, _, _ := o.int(rtrVrfID); vrf != 3 {
+		t.Errorf("Expected VRF 3, got %d", vrf)
+	}
+
+	if m, _ := o.bytes(rtrMarker); !reflect.DeepEqual(m, []byte{10, 0, 0, 3}) {
+		t.Errorf("Expected the marker 10.0.0.3, got %v", m)
+	}
+}
@@ -0,0 +1,114 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// vrfMemberLink is the relation type of the edges between a VRF node and
+// its interfaces
+const vrfMemberLink = "member"
+
+// vrfInterfacesFilter returns the filter of the interfaces matching the
+// given VRF filter, the VRF nodes having a Contrail.VRFID as well
+func vrfInterfacesFilter(vrfFilter *filters.Filter) *graph.ElementFilter {
+	return graph.NewElementFilter(filters.NewAndFilter(vrfFilter, filters.NewNotFilter(filters.NewTermStringFilter("Type", "vrf"))))
+}
+
+// vrfNodeID returns the ID of the node of a VRF, the VRF IDs being local
+// to a vrouter
+func (mapper *Probe) vrfNodeID(vrfId int) graph.Identifier {
+	return graph.GenID(string(mapper.root.ID), "vrf", strconv.Itoa(vrfId))
+}
+
+// updateVrfNode creates the node of a VRF, owned by the host, and links it
+// to the given interfaces with member edges, the edges of the interfaces
+// that left the VRF being removed. The routing table of the VRF, limited
+// like the one of its interfaces, is written into its Contrail.RoutingTable
+// metadata. The graph lock must be held.
+func (mapper *Probe) updateVrfNode(vrfId int, routes []OpenContrailRoute, summary *OpenContrailRouteSummary, intfs []*graph.Node) {
+	node := mapper.graph.GetNode(mapper.vrfNodeID(vrfId))
+	if node == nil {
+		name := fmt.Sprintf("vrf-%d", vrfId)
+		for _, intf := range intfs {
+			if vrfName, _ := intf.GetFieldString("Contrail.VRF"); vrfName != "" {
+				name = vrfName
+				break
+			}
+		}
+
+		contrail := map[string]interface{}{
+			"VRFID":        int64(vrfId),
+			"RoutingTable": routes,
+		}
+		if summary != nil {
+			contrail["RoutingTableSummary"] = summary
+		}
+
+		m := graph.Metadata{
+			"Name":     name,
+			"Type":     "vrf",
+			"Manager":  "opencontrail",
+			"Contrail": contrail,
+		}
+
+		var err error
+		if node, err = mapper.graph.NewNode(mapper.vrfNodeID(vrfId), m); err != nil {
+			logging.GetLogger().Errorf("Failed to create the node of VRF %d: %s", vrfId, err)
+			return
+		}
+		topology.AddOwnershipLink(mapper.graph, mapper.root, node, nil)
+	} else {
+		mapper.setRoutingTable(node, routes, summary)
+	}
+
+	members := make(map[graph.Identifier]bool)
+	for _, intf := range intfs {
+		members[intf.ID] = true
+		if !topology.HaveLink(mapper.graph, node, intf, vrfMemberLink) {
+			topology.AddLink(mapper.graph, node, intf, vrfMemberLink, nil)
+		}
+	}
+
+	for _, child := range mapper.graph.LookupChildren(node, nil, graph.Metadata{"RelationType": vrfMemberLink}) {
+		if !members[child.ID] {
+			mapper.graph.Unlink(node, child)
+		}
+	}
+}
+
+// delVrfNode removes the node of a VRF, when the VRF is garbage collected
+// or forgotten on resynchronization
+func (mapper *Probe) delVrfNode(vrfId int) {
+	mapper.graph.Lock()
+	defer mapper.graph.Unlock()
+
+	if node := mapper.graph.GetNode(mapper.vrfNodeID(vrfId)); node != nil {
+		logging.GetLogger().Debugf("Delete the node of VRF %d", vrfId)
+		mapper.graph.DelNode(node)
+	}
+}
@@ -0,0 +1,72 @@
+// +build linux,opencontrail
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package opencontrail
+
+import (
+	"testing"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+)
+
+func TestVrfNode(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.AgentService)
+
+	g.Lock()
+	root, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "host", "Type": "host"})
+	tap1, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "tap1", "Type": "tap", "Contrail": map[string]interface{}{"VRF": "default-domain:admin:net1:net1", "VRFID": int64(2)}})
+	tap2, _ := g.NewNode(graph.GenID(), graph.Metadata{"Name": "tap2", "Type": "tap", "Contrail": map[string]interface{}{"VRF": "default-domain:admin:net1:net1", "VRFID": int64(2)}})
+	g.Unlock()
+
+	mapper := &Probe{graph: g, root: root}
+	vrf := &RoutingTable{Routes: []OpenContrailRoute{{Family: afInetFamily, Prefix: "10.0.0.1/32", NhId: 12}}}
+
+	g.Lock()
+	mapper.updateVrfNode(2, vrf.Routes, nil, []*graph.Node{tap1, tap2})
+	mapper.updateVrfNode(2, vrf.Routes, nil, []*graph.Node{tap1})
+	g.Unlock()
+
+	node := g.GetNode(mapper.vrfNodeID(2))
+	if node == nil {
+		t.Fatal("VRF node not created")
+	}
+
+	if name, _ := node.GetFieldString("Name"); name != "default-domain:admin:net1:net1" {
+		t.Errorf("Wrong VRF node name: %s", name)
+	}
+
+	members := g.LookupChildren(node, nil, graph.Metadata{"RelationType": vrfMemberLink})
+	if len(members) != 1 || members[0].ID != tap1.ID {
+		t.Errorf("Expected tap1 to be the only member of the VRF, got %v", members)
+	}
+
+	if parents := g.LookupParents(node, nil, graph.Metadata{"RelationType": "ownership"}); len(parents) != 1 || parents[0].ID != root.ID {
+		t.Errorf("VRF node should be owned by the host, got %v", parents)
+	}
+
+	mapper.delVrfNode(2)
+	if g.GetNode(mapper.vrfNodeID(2)) != nil {
+		t.Error("VRF node not deleted")
+	}
+}
@@ -34,25 +34,32 @@ type ovnEvent func()
 // Probe describes an OVN probe
 type Probe struct {
 	graph.ListenerHandler
-	graph       *graph.Graph
-	wg          sync.WaitGroup
-	socketfile  string
-	protocol    string
-	server      string
-	port        int
-	ovndbapi    goovn.OVNDBApi
-	switchPorts map[string]*goovn.LogicalSwitch
-	eventChan   chan ovnEvent
-	aclIndexer  *graph.Indexer
-	lsIndexer   *graph.Indexer
-	lspIndexer  *graph.Indexer
-	lrIndexer   *graph.Indexer
-	lrpIndexer  *graph.Indexer
-	spLinker    *graph.ResourceLinker
-	srLinker    *graph.MetadataIndexerLinker
-	rpLinker    *graph.ResourceLinker
-	aclLinker   *graph.ResourceLinker
-	ifaceLinker *graph.MetadataIndexerLinker
+	graph              *graph.Graph
+	wg                 sync.WaitGroup
+	socketfile         string
+	protocol           string
+	server             string
+	port               int
+	ovndbapi           goovn.OVNDBApi
+	switchPorts        map[string]*goovn.LogicalSwitch
+	eventChan          chan ovnEvent
+	aclIndexer         *graph.Indexer
+	lsIndexer          *graph.Indexer
+	lspIndexer         *graph.Indexer
+	lrIndexer          *graph.Indexer
+	lrpIndexer         *graph.Indexer
+	spLinker           *graph.ResourceLinker
+	srLinker           *graph.MetadataIndexerLinker
+	rpLinker           *graph.ResourceLinker
+	aclLinker          *graph.ResourceLinker
+	ifaceLinker        *graph.MetadataIndexerLinker
+	southbound         *southbound
+	chassisIndexer     *graph.Indexer
+	hostIndexer        *graph.MetadataIndexer
+	chassisHostIndexer *graph.MetadataIndexer
+	portsIndexer       *graph.MetadataIndexer
+	hostLinker         *graph.MetadataIndexerLinker
+	bindingLinker      *graph.MetadataIndexerLinker
 }
 
 func uuidHasher(n *graph.Node) map[string]interface{} {
@@ -424,6 +431,15 @@ func (p *Probe) Start() {
 	p.srLinker.Start()
 	p.ifaceLinker.Start()
 
+	if p.southbound != nil {
+		p.chassisIndexer.Start()
+		p.hostIndexer.Start()
+		p.chassisHostIndexer.Start()
+		p.portsIndexer.Start()
+		p.hostLinker.Start()
+		p.bindingLinker.Start()
+	}
+
 	var err error
 	logging.GetLogger().Debugf("Trying to get an OVN DB api")
 	p.ovndbapi, err = goovn.GetInstance(p.socketfile, p.protocol, p.server, p.port, p)
@@ -468,10 +484,24 @@ func (p *Probe) Start() {
 			eventCallback()
 		}
 	}()
+
+	if p.southbound != nil {
+		p.southbound.start()
+	}
 }
 
 // Stop the probe
 func (p *Probe) Stop() {
+	if p.southbound != nil {
+		p.southbound.stop()
+		p.hostLinker.Stop()
+		p.bindingLinker.Stop()
+		p.hostIndexer.Stop()
+		p.chassisHostIndexer.Stop()
+		p.portsIndexer.Stop()
+		p.chassisIndexer.Stop()
+	}
+
 	close(p.eventChan)
 	p.wg.Wait()
 	p.lsIndexer.Stop()
@@ -485,8 +515,10 @@ func (p *Probe) Stop() {
 	p.ifaceLinker.Stop()
 }
 
-// NewProbe creates a new graph OVS database probe
-func NewProbe(g *graph.Graph, address string) (*Probe, error) {
+// NewProbe creates a new graph OVS database probe. When sbAddress is not
+// empty, the chassis are retrieved from the southbound database and linked
+// to their host and to the logical ports they bind.
+func NewProbe(g *graph.Graph, address string, sbAddress string) (*Probe, error) {
 	port, socketfile, server := 0, "", ""
 
 	protocol, target, err := common.ParseAddr(address)
@@ -568,5 +600,24 @@ func NewProbe(g *graph.Graph, address string) (*Probe, error) {
 	probe.srLinker.AddEventListener(probe)
 	probe.ifaceLinker.AddEventListener(probe)
 
+	if sbAddress != "" {
+		if probe.southbound, err = newSouthbound(probe, sbAddress); err != nil {
+			return nil, err
+		}
+		probe.chassisIndexer = graph.NewIndexer(g, nil, uuidHasher, false)
+
+		// Link the hosts to the chassis running on them
+		probe.hostIndexer = graph.NewMetadataIndexer(g, g, graph.Metadata{"Type": "host"}, "Hostname")
+		probe.chassisHostIndexer = graph.NewMetadataIndexer(g, probe.chassisIndexer, graph.Metadata{"Type": "ovn_chassis"}, "Hostname")
+		probe.hostLinker = graph.NewMetadataIndexerLinker(g, probe.hostIndexer, probe.chassisHostIndexer, topology.OwnershipMetadata())
+
+		// Link the chassis to the logical switch ports they bind, listed in their Ports attribute
+		probe.portsIndexer = graph.NewMetadataIndexer(g, probe.chassisIndexer, graph.Metadata{"Type": "ovn_chassis"}, "Ports")
+		probe.bindingLinker = graph.NewMetadataIndexerLinker(g, probe.portsIndexer, lspIndexer, graph.Metadata{"RelationType": "binding"})
+
+		probe.hostLinker.AddEventListener(probe)
+		probe.bindingLinker.AddEventListener(probe)
+	}
+
 	return probe, nil
 }
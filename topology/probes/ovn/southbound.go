@@ -0,0 +1,359 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovn
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/socketplane/libovsdb"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/ovs/ovsdb"
+)
+
+const southboundDatabase = "OVN_Southbound"
+
+type encap struct {
+	Type string
+	IP   string
+}
+
+type chassis struct {
+	name     string
+	hostname string
+	encaps   []string
+	extIDs   map[string]string
+}
+
+type portBinding struct {
+	logicalPort string
+	chassis     string
+}
+
+// southbound monitors the OVN southbound database to report the chassis
+// and the logical ports bound to each of them
+type southbound struct {
+	sync.Mutex
+	probe     *Probe
+	protocol  string
+	target    string
+	client    *libovsdb.OvsdbClient
+	connected bool
+	encaps    map[string]encap
+	chassis   map[string]*chassis
+	bindings  map[string]portBinding
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// rowUUID returns the UUID referenced by an optional column, which is
+// encoded either as a single UUID or as a set of zero or one UUID
+func rowUUID(value interface{}) string {
+	switch v := value.(type) {
+	case libovsdb.UUID:
+		return v.GoUUID
+	case libovsdb.OvsSet:
+		for _, e := range v.GoSet {
+			if uuid, ok := e.(libovsdb.UUID); ok {
+				return uuid.GoUUID
+			}
+		}
+	}
+	return ""
+}
+
+// rowUUIDs returns all the UUIDs referenced by a column
+func rowUUIDs(value interface{}) (uuids []string) {
+	switch v := value.(type) {
+	case libovsdb.UUID:
+		uuids = append(uuids, v.GoUUID)
+	case libovsdb.OvsSet:
+		for _, e := range v.GoSet {
+			if uuid, ok := e.(libovsdb.UUID); ok {
+				uuids = append(uuids, uuid.GoUUID)
+			}
+		}
+	}
+	return
+}
+
+func rowString(row libovsdb.Row, column string) string {
+	s, _ := row.Fields[column].(string)
+	return s
+}
+
+func rowMap(row libovsdb.Row, column string) map[string]string {
+	m := make(map[string]string)
+	if ovsMap, ok := row.Fields[column].(libovsdb.OvsMap); ok {
+		for k, v := range ovsMap.GoMap {
+			if ks, ok := k.(string); ok {
+				if vs, ok := v.(string); ok {
+					m[ks] = vs
+				}
+			}
+		}
+	}
+	return m
+}
+
+// boundPorts returns the sorted names of the logical ports bound to a chassis
+func boundPorts(bindings map[string]portBinding, chassisUUID string) []interface{} {
+	var names []string
+	for _, binding := range bindings {
+		if binding.chassis == chassisUUID && binding.logicalPort != "" {
+			names = append(names, binding.logicalPort)
+		}
+	}
+	sort.Strings(names)
+
+	ports := make([]interface{}, len(names))
+	for i, name := range names {
+		ports[i] = name
+	}
+	return ports
+}
+
+func (s *southbound) chassisMetadata(uuid string, c *chassis) graph.Metadata {
+	m := graph.Metadata{
+		"Type":     "ovn_chassis",
+		"Name":     c.name,
+		"Hostname": c.hostname,
+		"UUID":     uuid,
+		"Manager":  "ovn",
+		"Ports":    boundPorts(s.bindings, uuid),
+	}
+
+	var encaps []interface{}
+	for _, id := range c.encaps {
+		if e, found := s.encaps[id]; found {
+			encaps = append(encaps, map[string]interface{}{"Type": e.Type, "IP": e.IP})
+		}
+	}
+	if len(encaps) > 0 {
+		m["Encaps"] = encaps
+	}
+	if len(c.extIDs) > 0 {
+		m["ExtID"] = common.NormalizeValue(c.extIDs)
+	}
+	return m
+}
+
+// Update is called by libovsdb when the monitored tables are modified
+func (s *southbound) Update(context interface{}, tableUpdates libovsdb.TableUpdates) {
+	s.updateHandler(&tableUpdates)
+}
+
+// Locked is not used
+func (s *southbound) Locked([]interface{}) {
+}
+
+// Stolen is not used
+func (s *southbound) Stolen([]interface{}) {
+}
+
+// Echo is not used
+func (s *southbound) Echo([]interface{}) {
+}
+
+// Disconnected marks the connection as lost so that it gets retried
+func (s *southbound) Disconnected(*libovsdb.OvsdbClient) {
+	logging.GetLogger().Warningf("Disconnected from OVN southbound database %s", s.target)
+
+	s.Lock()
+	s.connected = false
+	s.Unlock()
+}
+
+func (s *southbound) updateHandler(updates *libovsdb.TableUpdates) {
+	s.Lock()
+	defer s.Unlock()
+
+	// chassis whose node has to be refreshed, mapped to whether they were deleted
+	changed := make(map[string]bool)
+
+	if table, ok := updates.Updates["Encap"]; ok {
+		for uuid, row := range table.Rows {
+			if row.New.Fields == nil {
+				delete(s.encaps, uuid)
+			} else {
+				s.encaps[uuid] = encap{Type: rowString(row.New, "type"), IP: rowString(row.New, "ip")}
+			}
+			for id, c := range s.chassis {
+				for _, e := range c.encaps {
+					if e == uuid {
+						changed[id] = false
+					}
+				}
+			}
+		}
+	}
+
+	if table, ok := updates.Updates["Chassis"]; ok {
+		for uuid, row := range table.Rows {
+			if row.New.Fields == nil {
+				delete(s.chassis, uuid)
+				changed[uuid] = true
+				continue
+			}
+
+			s.chassis[uuid] = &chassis{
+				name:     rowString(row.New, "name"),
+				hostname: rowString(row.New, "hostname"),
+				encaps:   rowUUIDs(row.New.Fields["encaps"]),
+				extIDs:   rowMap(row.New, "external_ids"),
+			}
+			changed[uuid] = false
+		}
+	}
+
+	if table, ok := updates.Updates["Port_Binding"]; ok {
+		for uuid, row := range table.Rows {
+			if previous, found := s.bindings[uuid]; found && previous.chassis != "" {
+				if _, deleted := changed[previous.chassis]; !deleted {
+					changed[previous.chassis] = false
+				}
+			}
+
+			if row.New.Fields == nil {
+				delete(s.bindings, uuid)
+				continue
+			}
+
+			binding := portBinding{
+				logicalPort: rowString(row.New, "logical_port"),
+				chassis:     rowUUID(row.New.Fields["chassis"]),
+			}
+			s.bindings[uuid] = binding
+
+			if binding.chassis != "" {
+				if _, deleted := changed[binding.chassis]; !deleted {
+					changed[binding.chassis] = false
+				}
+			}
+		}
+	}
+
+	for uuid, deleted := range changed {
+		uuid := uuid
+		if c, found := s.chassis[uuid]; found && !deleted {
+			metadata := s.chassisMetadata(uuid, c)
+			s.probe.eventChan <- func() { s.probe.registerNode(s.probe.chassisIndexer, uuid, metadata) }
+		} else if deleted {
+			s.probe.eventChan <- func() { s.probe.unregisterNode(s.probe.chassisIndexer, uuid) }
+		}
+	}
+}
+
+func (s *southbound) monitor() error {
+	client, err := libovsdb.ConnectUsingProtocol(s.protocol, s.target)
+	if err != nil {
+		return err
+	}
+	client.Register(s)
+
+	requests := make(map[string]libovsdb.MonitorRequest)
+	requests["Chassis"] = libovsdb.MonitorRequest{
+		Columns: []string{"name", "hostname", "encaps", "external_ids"},
+		Select:  libovsdb.MonitorSelect{Initial: true, Insert: true, Delete: true, Modify: true},
+	}
+	requests["Encap"] = libovsdb.MonitorRequest{
+		Columns: []string{"type", "ip"},
+		Select:  libovsdb.MonitorSelect{Initial: true, Insert: true, Delete: true, Modify: true},
+	}
+	requests["Port_Binding"] = libovsdb.MonitorRequest{
+		Columns: []string{"logical_port", "chassis"},
+		Select:  libovsdb.MonitorSelect{Initial: true, Insert: true, Delete: true, Modify: true},
+	}
+
+	updates, err := client.Monitor(southboundDatabase, "", requests)
+	if err != nil {
+		client.Disconnect()
+		return err
+	}
+
+	s.Lock()
+	s.client, s.connected = client, true
+	s.Unlock()
+
+	s.updateHandler(updates)
+
+	return nil
+}
+
+func (s *southbound) isConnected() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.connected
+}
+
+func (s *southbound) start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(ovsdb.ConnectionPollInterval)
+		defer ticker.Stop()
+
+		for {
+			if !s.isConnected() {
+				if err := s.monitor(); err != nil {
+					logging.GetLogger().Warningf("Could not connect to OVN southbound database %s (%s), will retry every %s", s.target, err, ovsdb.ConnectionPollInterval)
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (s *southbound) stop() {
+	close(s.quit)
+	s.wg.Wait()
+
+	s.Lock()
+	if s.client != nil && s.connected {
+		s.client.Disconnect()
+	}
+	s.connected = false
+	s.Unlock()
+}
+
+func newSouthbound(probe *Probe, address string) (*southbound, error) {
+	protocol, target, err := common.ParseAddr(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &southbound{
+		probe:    probe,
+		protocol: protocol,
+		target:   target,
+		encaps:   make(map[string]encap),
+		chassis:  make(map[string]*chassis),
+		bindings: make(map[string]portBinding),
+		quit:     make(chan struct{}),
+	}, nil
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovn
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/socketplane/libovsdb"
+)
+
+func TestRowUUID(t *testing.T) {
+	if uuid := rowUUID(libovsdb.UUID{GoUUID: "abc"}); uuid != "abc" {
+		t.Errorf("expected abc, got %s", uuid)
+	}
+
+	set := libovsdb.OvsSet{GoSet: []interface{}{libovsdb.UUID{GoUUID: "def"}}}
+	if uuid := rowUUID(set); uuid != "def" {
+		t.Errorf("expected def, got %s", uuid)
+	}
+
+	if uuid := rowUUID(libovsdb.OvsSet{}); uuid != "" {
+		t.Errorf("expected no UUID for an empty set, got %s", uuid)
+	}
+}
+
+func TestBoundPorts(t *testing.T) {
+	bindings := map[string]portBinding{
+		"b1": {logicalPort: "port-b", chassis: "c1"},
+		"b2": {logicalPort: "port-a", chassis: "c1"},
+		"b3": {logicalPort: "port-c", chassis: "c2"},
+		"b4": {logicalPort: "port-d"},
+	}
+
+	expected := []interface{}{"port-a", "port-b"}
+	if ports := boundPorts(bindings, "c1"); !reflect.DeepEqual(ports, expected) {
+		t.Errorf("expected %v, got %v", expected, ports)
+	}
+
+	if ports := boundPorts(bindings, "c3"); len(ports) != 0 {
+		t.Errorf("expected no port, got %v", ports)
+	}
+}
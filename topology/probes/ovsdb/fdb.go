@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovsdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// ovsFDBEntry describes an entry of the output of ovs-appctl fdb/show, Port
+// being the OpenFlow port number or LOCAL for the bridge port
+type ovsFDBEntry struct {
+	Port   string
+	Vlan   int64
+	MAC    string
+	Static bool
+}
+
+// parseFDBShow parses the output of ovs-appctl fdb/show:
+//
+//	 port  VLAN  MAC                Age
+//	    1     0  52:54:00:12:34:56    3
+//	LOCAL    10  fa:16:3e:00:00:01  static
+func parseFDBShow(out []byte) ([]ovsFDBEntry, error) {
+	var entries []ovsFDBEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] == "port" {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("Invalid FDB entry '%s'", scanner.Text())
+		}
+
+		vlan, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid VLAN in FDB entry '%s'", scanner.Text())
+		}
+
+		entries = append(entries, ovsFDBEntry{
+			Port:   fields[0],
+			Vlan:   vlan,
+			MAC:    fields[2],
+			Static: fields[3] == "static",
+		})
+	}
+
+	return entries, scanner.Err()
+}
+
+// bridgePortNames returns the names of the ports of a bridge by OpenFlow
+// port number, the caller must hold the graph lock
+func (o *Probe) bridgePortNames(bridge *graph.Node) map[string]string {
+	name, _ := bridge.GetFieldString("Name")
+	names := map[string]string{"LOCAL": name}
+
+	for _, port := range o.Graph.LookupChildren(bridge, graph.Metadata{"Type": "ovsport"}, topology.OwnershipMetadata()) {
+		portName, _ := port.GetFieldString("Name")
+		for _, intf := range o.Graph.LookupChildren(port, nil, topology.Layer2Metadata()) {
+			if ofport, err := intf.GetFieldInt64("OfPort"); err == nil {
+				names[strconv.FormatInt(ofport, 10)] = portName
+			}
+		}
+	}
+
+	return names
+}
+
+// updateBridgeFDBs dumps the forwarding databases of the bridges, which are
+// only exposed by ovs-vswitchd
+func (o *Probe) updateBridgeFDBs(trackers map[graph.Identifier]*topology.FDBTracker, now time.Time) {
+	o.Graph.RLock()
+	bridges := o.Graph.LookupChildren(o.Root, graph.Metadata{"Type": "ovsbridge"}, topology.OwnershipMetadata())
+	names := make(map[graph.Identifier]string, len(bridges))
+	for _, bridge := range bridges {
+		names[bridge.ID], _ = bridge.GetFieldString("Name")
+	}
+	o.Graph.RUnlock()
+
+	maxMoves := config.GetInt("agent.topology.fdb.max_moves")
+
+	seen := make(map[graph.Identifier]bool)
+	for _, bridge := range bridges {
+		seen[bridge.ID] = true
+
+		out, err := executor.ExecCommand("ovs-appctl", "fdb/show", names[bridge.ID])
+		if err != nil {
+			logging.GetLogger().Debugf("Failed to retrieve the forwarding database of %s: %s", names[bridge.ID], err)
+			continue
+		}
+
+		ovsEntries, err := parseFDBShow(out)
+		if err != nil {
+			logging.GetLogger().Errorf("Failed to parse the forwarding database of %s: %s", names[bridge.ID], err)
+			continue
+		}
+
+		o.Graph.Lock()
+		if o.Graph.GetNode(bridge.ID) == nil {
+			o.Graph.Unlock()
+			continue
+		}
+
+		portNames := o.bridgePortNames(bridge)
+		entries := make([]topology.FDBEntry, len(ovsEntries))
+		for i, entry := range ovsEntries {
+			port, found := portNames[entry.Port]
+			if !found {
+				port = entry.Port
+			}
+			entries[i] = topology.FDBEntry{MAC: entry.MAC, Vlan: entry.Vlan, Port: port, Static: entry.Static}
+		}
+
+		tracker, found := trackers[bridge.ID]
+		if !found {
+			tracker = topology.NewFDBTracker()
+			trackers[bridge.ID] = tracker
+		}
+
+		moves := tracker.Update(entries, now)
+		for _, move := range moves {
+			logging.GetLogger().Warningf("MAC %s moved from %s to %s on %s", move.MAC, move.From, move.To, names[bridge.ID])
+		}
+
+		topology.SetBridgeFDB(o.Graph, bridge, entries, moves, maxMoves)
+		o.Graph.Unlock()
+	}
+
+	for id := range trackers {
+		if !seen[id] {
+			delete(trackers, id)
+		}
+	}
+}
+
+// monitorBridgeFDBs periodically updates the forwarding databases of the
+// bridges until the context is cancelled
+func (o *Probe) monitorBridgeFDBs(ctx context.Context, interval time.Duration) {
+	trackers := make(map[graph.Identifier]*topology.FDBTracker)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case t := <-ticker.C:
+			o.updateBridgeFDBs(trackers, t.UTC())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
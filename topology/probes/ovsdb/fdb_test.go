@@ -0,0 +1,51 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovsdb
+
+import (
+	"testing"
+)
+
+func TestParseFDBShow(t *testing.T) {
+	out := []byte(` port  VLAN  MAC                Age
+    1     0  52:54:00:12:34:56    3
+LOCAL    10  fa:16:3e:00:00:01  static
+`)
+
+	entries, err := parseFDBShow(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ovsFDBEntry{
+		{Port: "1", Vlan: 0, MAC: "52:54:00:12:34:56"},
+		{Port: "LOCAL", Vlan: 10, MAC: "fa:16:3e:00:00:01", Static: true},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], entries[i])
+		}
+	}
+
+	if _, err := parseFDBShow([]byte("1 x 52:54:00:12:34:56 3")); err == nil {
+		t.Error("Invalid VLAN should be refused")
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/socketplane/libovsdb"
 
 	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
 	"github.com/skydive-project/skydive/filters"
 	"github.com/skydive-project/skydive/graffiti/graph"
 	"github.com/skydive-project/skydive/logging"
@@ -52,6 +53,7 @@ type Probe struct {
 	intfToPort   map[string]*graph.Node
 	portToIntf   map[string]*graph.Node
 	portToBridge map[string]*graph.Node
+	ctx          context.Context
 	cancel       context.CancelFunc
 	enableStats  bool
 }
@@ -190,12 +192,30 @@ func isOvsDrivenInterface(intf *graph.Node) bool {
 	return isOvsInterfaceType(t)
 }
 
+// ovsNodes returns the host and the bridges whose metadata are maintained
+// by the probe
+func (o *Probe) ovsNodes() []*graph.Node {
+	nodes := []*graph.Node{o.Root}
+	return append(nodes, o.Graph.LookupChildren(o.Root, graph.Metadata{"Type": "ovsbridge"}, topology.OwnershipMetadata())...)
+}
+
+func (o *Probe) setError(err error) {
+	o.Graph.Lock()
+	topology.SetProbeError(o.Graph, "ovsdb", err, o.ovsNodes()...)
+	o.Graph.Unlock()
+}
+
 // OnConnected event
 func (o *Probe) OnConnected(monitor *ovsdb.OvsMonitor) {
+	o.Graph.Lock()
+	topology.ClearProbeError(o.Graph, "ovsdb", o.ovsNodes()...)
+	o.Graph.Unlock()
 }
 
-// OnDisconnected event
+// OnDisconnected event, the OVS metadata are not updated until the
+// connection is back
 func (o *Probe) OnDisconnected(monitor *ovsdb.OvsMonitor) {
+	o.setError(fmt.Errorf("Disconnected from OVSDB %s", monitor.Target))
 }
 
 // OnOvsBridgeUpdate event
@@ -251,6 +271,8 @@ func (o *Probe) OnOvsBridgeAdd(monitor *ovsdb.OvsMonitor, uuid string, row *libo
 	}
 	tr.Commit()
 
+	topology.SetSTP(o.Graph, bridge, bridgeSTP(&row.New))
+
 	switch row.New.Fields["ports"].(type) {
 	case libovsdb.OvsSet:
 		set := row.New.Fields["ports"].(libovsdb.OvsSet)
@@ -739,6 +761,8 @@ func (o *Probe) OnOvsPortAdd(monitor *ovsdb.OvsMonitor, uuid string, row *libovs
 	}
 
 	tr.AddMetadata("Ovs", ovsMetadata)
+
+	topology.SetSTP(o.Graph, port, portSTP(&row.New))
 }
 
 // OnOvsPortUpdate event
@@ -813,6 +837,14 @@ func (o *Probe) OnOvsUpdate(monitor *ovsdb.OvsMonitor, row *libovsdb.RowUpdate)
 func (o *Probe) Start() {
 	o.OvsMon.AddMonitorHandler(o)
 	o.OvsMon.StartMonitoring()
+
+	if !o.OvsMon.IsConnected() {
+		o.setError(fmt.Errorf("Unable to connect to OVSDB %s", o.OvsMon.Target))
+	}
+
+	if interval := config.GetInt("agent.topology.fdb.update"); interval > 0 {
+		go o.monitorBridgeFDBs(o.ctx, time.Duration(interval)*time.Second)
+	}
 }
 
 // Stop the probe
@@ -841,6 +873,7 @@ func NewProbe(g *graph.Graph, n *graph.Node, p string, t string, enableStats boo
 		portToBridge: make(map[string]*graph.Node),
 		OvsMon:       mon,
 		OvsOfProbe:   NewOvsOfProbe(ctx, g, n, mon.Target),
+		ctx:          ctx,
 		cancel:       cancel,
 		enableStats:  enableStats,
 	}
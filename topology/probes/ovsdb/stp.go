@@ -0,0 +1,84 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package ovsdb
+
+import (
+	"strconv"
+
+	"github.com/socketplane/libovsdb"
+)
+
+func columnBoolValue(row *libovsdb.Row, col string) bool {
+	value, _ := row.Fields[col].(bool)
+	return value
+}
+
+// bridgeSTP returns the spanning tree state of a bridge, nil if neither STP
+// nor RSTP is enabled
+func bridgeSTP(row *libovsdb.Row) map[string]interface{} {
+	var protocol, col, bridgeID, rootID, rootPathCost string
+
+	switch {
+	case columnBoolValue(row, "rstp_enable"):
+		protocol, col = "rstp", "rstp_status"
+		bridgeID, rootID, rootPathCost = "rstp_bridge_id", "rstp_root_id", "rstp_root_path_cost"
+	case columnBoolValue(row, "stp_enable"):
+		protocol, col = "stp", "status"
+		bridgeID, rootID, rootPathCost = "stp_bridge_id", "stp_designated_root", "stp_root_path_cost"
+	default:
+		return nil
+	}
+
+	cost, _ := strconv.ParseInt(goMapStringValue(row, col, rootPathCost), 10, 64)
+
+	return map[string]interface{}{
+		"Protocol":     protocol,
+		"BridgeID":     goMapStringValue(row, col, bridgeID),
+		"RootID":       goMapStringValue(row, col, rootID),
+		"RootPathCost": cost,
+	}
+}
+
+// portSTP returns the spanning tree state of a port, as reported by
+// ovs-vswitchd in its status columns, nil if not running STP or RSTP
+func portSTP(row *libovsdb.Row) map[string]interface{} {
+	if state := goMapStringValue(row, "rstp_status", "rstp_port_state"); state != "" {
+		stp := map[string]interface{}{
+			"State":  state,
+			"Role":   goMapStringValue(row, "rstp_status", "rstp_port_role"),
+			"PortID": goMapStringValue(row, "rstp_status", "rstp_port_id"),
+		}
+		if bridge := goMapStringValue(row, "rstp_status", "rstp_designated_bridge_id"); bridge != "" {
+			stp["DesignatedBridge"] = bridge
+		}
+		if cost, err := strconv.ParseInt(goMapStringValue(row, "rstp_status", "rstp_designated_path_cost"), 10, 64); err == nil {
+			stp["DesignatedCost"] = cost
+		}
+		return stp
+	}
+
+	if state := goMapStringValue(row, "stp_status", "stp_port_state"); state != "" {
+		return map[string]interface{}{
+			"State":  state,
+			"Role":   goMapStringValue(row, "stp_status", "stp_port_role"),
+			"PortID": goMapStringValue(row, "stp_status", "stp_port_id"),
+		}
+	}
+
+	return nil
+}
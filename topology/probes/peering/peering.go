@@ -30,6 +30,9 @@ type Probe struct {
 	peerIntfMACIndexer *graph.MetadataIndexer
 	macIndexer         *graph.MetadataIndexer
 	linker             *graph.MetadataIndexerLinker
+	wgPeerKeysIndexer  *graph.MetadataIndexer
+	wgPublicKeyIndexer *graph.MetadataIndexer
+	wgLinker           *graph.MetadataIndexerLinker
 }
 
 // Start the MAC peering resolver probe
@@ -37,6 +40,9 @@ func (p *Probe) Start() {
 	p.peerIntfMACIndexer.Start()
 	p.macIndexer.Start()
 	p.linker.Start()
+	p.wgPeerKeysIndexer.Start()
+	p.wgPublicKeyIndexer.Start()
+	p.wgLinker.Start()
 }
 
 // Stop the probe
@@ -44,6 +50,9 @@ func (p *Probe) Stop() {
 	p.peerIntfMACIndexer.Stop()
 	p.macIndexer.Stop()
 	p.linker.Stop()
+	p.wgPeerKeysIndexer.Stop()
+	p.wgPublicKeyIndexer.Stop()
+	p.wgLinker.Stop()
 }
 
 // OnError implements the LinkerEventListener interface
@@ -58,13 +67,23 @@ func NewProbe(g *graph.Graph) *Probe {
 
 	linker := graph.NewMetadataIndexerLinker(g, peerIntfMACIndexer, macIndexer, graph.Metadata{"RelationType": topology.Layer2Link})
 
+	// link the WireGuard interfaces to the interfaces of their peers
+	wgPeerKeysIndexer := graph.NewMetadataIndexer(g, g, nil, "WireGuard.PeerKeys")
+	wgPublicKeyIndexer := graph.NewMetadataIndexer(g, g, nil, "WireGuard.PublicKey")
+
+	wgLinker := graph.NewMetadataIndexerLinker(g, wgPeerKeysIndexer, wgPublicKeyIndexer, graph.Metadata{"RelationType": "tunnel", "Protocol": "wireguard"})
+
 	probe := &Probe{
 		graph:              g,
 		peerIntfMACIndexer: peerIntfMACIndexer,
 		macIndexer:         macIndexer,
 		linker:             linker,
+		wgPeerKeysIndexer:  wgPeerKeysIndexer,
+		wgPublicKeyIndexer: wgPublicKeyIndexer,
+		wgLinker:           wgLinker,
 	}
 	linker.AddEventListener(probe)
+	wgLinker.AddEventListener(probe)
 
 	return probe
 }
@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// BER tags of the SNMP types
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagIPAddress      = 0x40
+	tagCounter32      = 0x41
+	tagGauge32        = 0x42
+	tagTimeTicks      = 0x43
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+	tagGetResponse    = 0xa2
+	tagGetBulkRequest = 0xa5
+)
+
+var errTruncated = errors.New("Truncated BER value")
+
+// Variable describes a variable binding of a SNMP response. Value is an
+// int64 for the integers, an uint64 for the counters, gauges and time ticks,
+// a []byte for the octet strings, a string for the OIDs and a net.IP for the
+// IP addresses.
+type Variable struct {
+	OID   string
+	Type  byte
+	Value interface{}
+}
+
+// String returns the value of an octet string variable
+func (v Variable) String() string {
+	if b, ok := v.Value.([]byte); ok {
+		return string(bytes.TrimRight(b, "\x00"))
+	}
+	return ""
+}
+
+// Int returns the value of a numeric variable
+func (v Variable) Int() int64 {
+	switch value := v.Value.(type) {
+	case int64:
+		return value
+	case uint64:
+		return int64(value)
+	}
+	return 0
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func encodeTLV(tag byte, data ...[]byte) []byte {
+	value := bytes.Join(data, nil)
+	b := append([]byte{tag}, encodeLength(len(value))...)
+	return append(b, value...)
+}
+
+func encodeInteger(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return encodeTLV(tagInteger, b)
+}
+
+func encodeOID(oid string) ([]byte, error) {
+	var arcs []uint64
+	for _, s := range strings.Split(strings.TrimPrefix(oid, "."), ".") {
+		arc, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid OID %s", oid)
+		}
+		arcs = append(arcs, arc)
+	}
+	if len(arcs) < 2 {
+		return nil, fmt.Errorf("Invalid OID %s", oid)
+	}
+
+	b := []byte{byte(arcs[0]*40 + arcs[1])}
+	for _, arc := range arcs[2:] {
+		sub := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			sub = append([]byte{0x80 | byte(arc&0x7f)}, sub...)
+		}
+		b = append(b, sub...)
+	}
+	return encodeTLV(tagOID, b), nil
+}
+
+// decodeTLV returns the tag and the value of the first BER element of b
+// followed by the remaining bytes
+func decodeTLV(b []byte) (tag byte, value []byte, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, errTruncated
+	}
+
+	tag, length, b := b[0], int(b[1]), b[2:]
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n > 4 || len(b) < n {
+			return 0, nil, nil, errTruncated
+		}
+		length = 0
+		for _, c := range b[:n] {
+			length = length<<8 | int(c)
+		}
+		b = b[n:]
+	}
+
+	if length > len(b) {
+		return 0, nil, nil, errTruncated
+	}
+	return tag, b[:length], b[length:], nil
+}
+
+func decodeInteger(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func decodeUnsigned(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func decodeOID(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	arcs := []string{strconv.Itoa(int(b[0]) / 40), strconv.Itoa(int(b[0]) % 40)}
+	var arc uint64
+	for _, c := range b[1:] {
+		arc = arc<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			arcs = append(arcs, strconv.FormatUint(arc, 10))
+			arc = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
+
+func decodeValue(tag byte, b []byte) interface{} {
+	switch tag {
+	case tagInteger:
+		return decodeInteger(b)
+	case tagOctetString:
+		return b
+	case tagOID:
+		return decodeOID(b)
+	case tagIPAddress:
+		return net.IP(b)
+	case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+		return decodeUnsigned(b)
+	}
+	return nil
+}
+
+// encodeGetBulkRequest encodes a SNMPv2c GetBulk request
+func encodeGetBulkRequest(community string, requestID int32, maxRepetitions int, oid string) ([]byte, error) {
+	name, err := encodeOID(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	varbinds := encodeTLV(tagSequence, encodeTLV(tagSequence, name, encodeTLV(tagNull, nil)))
+	pdu := encodeTLV(tagGetBulkRequest,
+		encodeInteger(int64(requestID)),
+		encodeInteger(0),
+		encodeInteger(int64(maxRepetitions)),
+		varbinds)
+
+	// version 1 stands for SNMPv2c
+	return encodeTLV(tagSequence, encodeInteger(1), encodeTLV(tagOctetString, []byte(community)), pdu), nil
+}
+
+// decodeResponse decodes a SNMPv2c response, returning its request ID
+func decodeResponse(b []byte) (int32, []Variable, error) {
+	tag, message, _, err := decodeTLV(b)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != tagSequence {
+		return 0, nil, fmt.Errorf("Unexpected message tag 0x%x", tag)
+	}
+
+	// version and community
+	var fields [2][]byte
+	for i := range fields {
+		if _, fields[i], message, err = decodeTLV(message); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	tag, pdu, _, err := decodeTLV(message)
+	if err != nil {
+		return 0, nil, err
+	}
+	if tag != tagGetResponse {
+		return 0, nil, fmt.Errorf("Unexpected PDU tag 0x%x", tag)
+	}
+
+	var header [3][]byte
+	for i := range header {
+		if _, header[i], pdu, err = decodeTLV(pdu); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	requestID := int32(decodeInteger(header[0]))
+	if status := decodeInteger(header[1]); status != 0 {
+		return requestID, nil, fmt.Errorf("SNMP error status %d at index %d", status, decodeInteger(header[2]))
+	}
+
+	_, varbinds, _, err := decodeTLV(pdu)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var variables []Variable
+	for len(varbinds) > 0 {
+		var varbind []byte
+		if _, varbind, varbinds, err = decodeTLV(varbinds); err != nil {
+			return 0, nil, err
+		}
+
+		_, name, varbind, err := decodeTLV(varbind)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		tag, value, _, err := decodeTLV(varbind)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		variables = append(variables, Variable{OID: decodeOID(name), Type: tag, Value: decodeValue(tag, value)})
+	}
+
+	return requestID, variables, nil
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const maxPacketSize = 65535
+
+// ErrTimeout is returned when a device doesn't answer
+var ErrTimeout = errors.New("Timeout while waiting for a SNMP response")
+
+// Client describes a minimal SNMPv2c client only able to walk MIB subtrees
+type Client struct {
+	Address        string
+	Community      string
+	Timeout        time.Duration
+	Retries        int
+	MaxRepetitions int
+	requestID      int32
+}
+
+// NewClient returns a new SNMPv2c client for the given address, the port 161
+// being used when not specified
+func NewClient(address, community string, timeout time.Duration, retries int) *Client {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "161")
+	}
+
+	return &Client{
+		Address:        address,
+		Community:      community,
+		Timeout:        timeout,
+		Retries:        retries,
+		MaxRepetitions: 25,
+	}
+}
+
+func (c *Client) getBulk(conn net.Conn, oid string) ([]Variable, error) {
+	requestID := atomic.AddInt32(&c.requestID, 1)
+
+	request, err := encodeGetBulkRequest(c.Community, requestID, c.MaxRepetitions, oid)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := make([]byte, maxPacketSize)
+	for i := 0; i <= c.Retries; i++ {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(c.Timeout)
+		for {
+			conn.SetReadDeadline(deadline)
+
+			n, err := conn.Read(buffer)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+
+			id, variables, err := decodeResponse(buffer[:n])
+			if err == nil && id != requestID {
+				// late response of a previous request
+				continue
+			}
+			return variables, err
+		}
+	}
+
+	return nil, ErrTimeout
+}
+
+// Walk returns all the variables of the MIB subtree rooted at the given OID
+func (c *Client) Walk(root string) ([]Variable, error) {
+	conn, err := net.Dial("udp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	root = strings.TrimPrefix(root, ".")
+	prefix := root + "."
+
+	var variables []Variable
+	for oid := root; ; {
+		response, err := c.getBulk(conn, oid)
+		if err != nil {
+			return nil, err
+		}
+
+		next := oid
+		for _, variable := range response {
+			// stop at the end of the subtree or when the agent doesn't
+			// return increasing OIDs to avoid looping forever
+			if variable.Type == tagEndOfMibView || !strings.HasPrefix(variable.OID, prefix) || variable.OID == oid {
+				return variables, nil
+			}
+			if variable.Type == tagNoSuchObject || variable.Type == tagNoSuchInstance {
+				continue
+			}
+
+			variables = append(variables, variable)
+			next = variable.OID
+		}
+
+		if next == oid {
+			return variables, nil
+		}
+		oid = next
+	}
+}
+
+// WalkColumn returns the values of a table column indexed by the OID suffix
+// following the column OID
+func (c *Client) WalkColumn(column string) (map[string]Variable, error) {
+	variables, err := c.Walk(column)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimPrefix(column, ".") + "."
+	values := make(map[string]Variable, len(variables))
+	for _, variable := range variables {
+		values[strings.TrimPrefix(variable.OID, prefix)] = variable
+	}
+	return values, nil
+}
@@ -0,0 +1,407 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/skydive-project/skydive/logging"
+)
+
+// OIDs of the polled objects of the SNMPv2, IF, LLDP, CISCO-CDP and BRIDGE MIBs
+const (
+	oidSysDescr     = "1.3.6.1.2.1.1.1"
+	oidSysName      = "1.3.6.1.2.1.1.5"
+	oidIPForwarding = "1.3.6.1.2.1.4.1"
+
+	oidIfDescr       = "1.3.6.1.2.1.2.2.1.2"
+	oidIfType        = "1.3.6.1.2.1.2.2.1.3"
+	oidIfMtu         = "1.3.6.1.2.1.2.2.1.4"
+	oidIfSpeed       = "1.3.6.1.2.1.2.2.1.5"
+	oidIfPhysAddress = "1.3.6.1.2.1.2.2.1.6"
+	oidIfOperStatus  = "1.3.6.1.2.1.2.2.1.8"
+	oidIfName        = "1.3.6.1.2.1.31.1.1.1.1"
+
+	oidLldpLocPortIDSubtype    = "1.0.8802.1.1.2.1.3.7.1.2"
+	oidLldpLocPortID           = "1.0.8802.1.1.2.1.3.7.1.3"
+	oidLldpLocManAddrLen       = "1.0.8802.1.1.2.1.3.8.1.3"
+	oidLldpRemChassisIDSubtype = "1.0.8802.1.1.2.1.4.1.1.4"
+	oidLldpRemChassisID        = "1.0.8802.1.1.2.1.4.1.1.5"
+	oidLldpRemPortIDSubtype    = "1.0.8802.1.1.2.1.4.1.1.6"
+	oidLldpRemPortID           = "1.0.8802.1.1.2.1.4.1.1.7"
+	oidLldpRemSysName          = "1.0.8802.1.1.2.1.4.1.1.9"
+	oidLldpRemManAddrIfSubtype = "1.0.8802.1.1.2.1.4.2.1.3"
+
+	oidCdpCacheAddressType = "1.3.6.1.4.1.9.9.23.1.2.1.1.3"
+	oidCdpCacheAddress     = "1.3.6.1.4.1.9.9.23.1.2.1.1.4"
+	oidCdpCacheDeviceID    = "1.3.6.1.4.1.9.9.23.1.2.1.1.6"
+	oidCdpCacheDevicePort  = "1.3.6.1.4.1.9.9.23.1.2.1.1.7"
+	oidCdpCachePlatform    = "1.3.6.1.4.1.9.9.23.1.2.1.1.8"
+
+	oidDot1dBasePortIfIndex = "1.3.6.1.2.1.17.1.4.1.2"
+	oidDot1dTpFdbPort       = "1.3.6.1.2.1.17.4.3.1.2"
+)
+
+// LLDP chassis and port ID subtypes holding MAC addresses, and the ones
+// used for the CDP device IDs and ports
+const (
+	lldpChassisIDSubtypeMAC   = 4
+	lldpChassisIDSubtypeLocal = 7
+	lldpPortIDSubtypeMAC      = 3
+	lldpPortIDSubtypeIfName   = 5
+)
+
+// cdpAddressTypeIP is the CDP address type of IPv4 addresses
+const cdpAddressTypeIP = 1
+
+type deviceInterface struct {
+	index   int64
+	name    string
+	ifType  int64
+	mtu     int64
+	speed   int64
+	mac     string
+	operUp  bool
+	lldpID  string
+	subtype int64
+}
+
+// neighbor describes a device advertised on a port using LLDP or CDP, the
+// CDP device IDs and ports being reported as LLDP chassis and port IDs
+type neighbor struct {
+	protocol         string
+	localPort        string
+	ifIndex          int64
+	chassisID        string
+	chassisIDSubtype int64
+	portID           string
+	portIDSubtype    int64
+	sysName          string
+	mgmtAddress      string
+	platform         string
+}
+
+type fdbEntry struct {
+	mac     string
+	ifIndex int64
+}
+
+// deviceInfo describes what was retrieved from a device
+type deviceInfo struct {
+	sysName     string
+	sysDescr    string
+	forwarding  bool
+	mgmtAddress string
+	interfaces  []*deviceInterface
+	neighbors   []*neighbor
+	bridged     bool
+	fdb         []fdbEntry
+}
+
+// formatLLDPID formats a chassis or port ID like the LLDP probe does
+func formatLLDPID(v Variable, isMAC bool) string {
+	if b, ok := v.Value.([]byte); ok && isMAC && len(b) == 6 {
+		return net.HardwareAddr(b).String()
+	}
+	return strings.Trim(v.String(), "\x00")
+}
+
+// parseAddressIndex decodes an address encoded in a table index as its
+// family, its length and its bytes, as in the LLDP management address tables
+func parseAddressIndex(parts []string) string {
+	if len(parts) < 2 {
+		return ""
+	}
+
+	length, err := strconv.Atoi(parts[1])
+	if err != nil || len(parts) < 2+length {
+		return ""
+	}
+
+	b := make([]byte, length)
+	for i, s := range parts[2 : 2+length] {
+		v, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return ""
+		}
+		b[i] = byte(v)
+	}
+
+	switch {
+	case parts[0] == "1" && length == net.IPv4len, parts[0] == "2" && length == net.IPv6len:
+		return net.IP(b).String()
+	}
+	return ""
+}
+
+// parseMACIndex decodes a MAC address encoded in a table index, as in the
+// forwarding database of the BRIDGE MIB
+func parseMACIndex(index string) string {
+	parts := strings.Split(index, ".")
+	if len(parts) != 6 {
+		return ""
+	}
+
+	mac := make(net.HardwareAddr, 6)
+	for i, s := range parts {
+		v, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return ""
+		}
+		mac[i] = byte(v)
+	}
+	return mac.String()
+}
+
+func sortedIndexes(column map[string]Variable) []string {
+	indexes := make([]string, 0, len(column))
+	for index := range column {
+		indexes = append(indexes, index)
+	}
+	sort.Strings(indexes)
+	return indexes
+}
+
+func parseInterfaces(columns map[string]map[string]Variable) []*deviceInterface {
+	var interfaces []*deviceInterface
+	for _, index := range sortedIndexes(columns[oidIfDescr]) {
+		ifIndex, err := strconv.ParseInt(index, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		descr := columns[oidIfDescr][index]
+		intf := &deviceInterface{index: ifIndex, name: descr.String()}
+		if v, found := columns[oidIfName][index]; found && v.String() != "" {
+			intf.name = v.String()
+		}
+		if v, found := columns[oidIfPhysAddress][index]; found {
+			if b, ok := v.Value.([]byte); ok && len(b) == 6 {
+				intf.mac = net.HardwareAddr(b).String()
+			}
+		}
+		intf.ifType = columns[oidIfType][index].Int()
+		intf.mtu = columns[oidIfMtu][index].Int()
+		// in Mb/s like the netlink probe
+		intf.speed = columns[oidIfSpeed][index].Int() / 1000000
+		intf.operUp = columns[oidIfOperStatus][index].Int() == 1
+
+		interfaces = append(interfaces, intf)
+	}
+	return interfaces
+}
+
+// matchLLDPPorts maps the LLDP local port numbers to the interfaces, using
+// the advertised port IDs and falling back to the interface index
+func matchLLDPPorts(interfaces []*deviceInterface, columns map[string]map[string]Variable) map[string]*deviceInterface {
+	ports := make(map[string]*deviceInterface)
+	for portNum, v := range columns[oidLldpLocPortID] {
+		subtype := columns[oidLldpLocPortIDSubtype][portNum].Int()
+		portID := formatLLDPID(v, subtype == lldpPortIDSubtypeMAC)
+
+		var match *deviceInterface
+		for _, intf := range interfaces {
+			if portID != "" && (portID == intf.name || portID == intf.mac) {
+				match = intf
+				break
+			}
+			if strconv.FormatInt(intf.index, 10) == portNum {
+				match = intf
+			}
+		}
+
+		if match != nil {
+			match.lldpID, match.subtype = portID, subtype
+			ports[portNum] = match
+		}
+	}
+	return ports
+}
+
+func parseNeighbors(columns map[string]map[string]Variable) []*neighbor {
+	// remote management addresses are indexed by the remote entry index
+	// followed by the address
+	addresses := make(map[string]string)
+	for _, index := range sortedIndexes(columns[oidLldpRemManAddrIfSubtype]) {
+		parts := strings.Split(index, ".")
+		if len(parts) < 3 {
+			continue
+		}
+
+		key := strings.Join(parts[:3], ".")
+		if _, found := addresses[key]; found {
+			continue
+		}
+		if addr := parseAddressIndex(parts[3:]); addr != "" {
+			addresses[key] = addr
+		}
+	}
+
+	var neighbors []*neighbor
+	for _, index := range sortedIndexes(columns[oidLldpRemChassisID]) {
+		// index is made of the time mark, the local port number and the
+		// remote entry index
+		parts := strings.Split(index, ".")
+		if len(parts) != 3 {
+			continue
+		}
+
+		neighbor := &neighbor{
+			protocol:         "LLDP",
+			localPort:        parts[1],
+			chassisIDSubtype: columns[oidLldpRemChassisIDSubtype][index].Int(),
+			portIDSubtype:    columns[oidLldpRemPortIDSubtype][index].Int(),
+			mgmtAddress:      addresses[index],
+		}
+		neighbor.chassisID = formatLLDPID(columns[oidLldpRemChassisID][index], neighbor.chassisIDSubtype == lldpChassisIDSubtypeMAC)
+		neighbor.portID = formatLLDPID(columns[oidLldpRemPortID][index], neighbor.portIDSubtype == lldpPortIDSubtypeMAC)
+		if v, found := columns[oidLldpRemSysName][index]; found {
+			neighbor.sysName = v.String()
+		}
+
+		if neighbor.portID != "" {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors
+}
+
+func parseCDPNeighbors(columns map[string]map[string]Variable) []*neighbor {
+	var neighbors []*neighbor
+	for _, index := range sortedIndexes(columns[oidCdpCacheDeviceID]) {
+		// index is made of the local interface index and the device index
+		parts := strings.Split(index, ".")
+		if len(parts) != 2 {
+			continue
+		}
+
+		ifIndex, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		deviceID := strings.Trim(columns[oidCdpCacheDeviceID][index].String(), "\x00")
+		neighbor := &neighbor{
+			protocol:         "CDP",
+			ifIndex:          ifIndex,
+			chassisID:        deviceID,
+			chassisIDSubtype: lldpChassisIDSubtypeLocal,
+			portID:           strings.Trim(columns[oidCdpCacheDevicePort][index].String(), "\x00"),
+			portIDSubtype:    lldpPortIDSubtypeIfName,
+			sysName:          deviceID,
+		}
+		if v, found := columns[oidCdpCachePlatform][index]; found {
+			neighbor.platform = strings.Trim(v.String(), "\x00")
+		}
+		if columns[oidCdpCacheAddressType][index].Int() == cdpAddressTypeIP {
+			if b, ok := columns[oidCdpCacheAddress][index].Value.([]byte); ok && len(b) == net.IPv4len {
+				neighbor.mgmtAddress = net.IP(b).String()
+			}
+		}
+
+		if deviceID != "" && neighbor.portID != "" {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors
+}
+
+func parseFDB(columns map[string]map[string]Variable) []fdbEntry {
+	var entries []fdbEntry
+	for _, index := range sortedIndexes(columns[oidDot1dTpFdbPort]) {
+		mac := parseMACIndex(index)
+		basePort := strconv.FormatInt(columns[oidDot1dTpFdbPort][index].Int(), 10)
+		ifIndex, found := columns[oidDot1dBasePortIfIndex][basePort]
+		if mac == "" || !found {
+			continue
+		}
+		entries = append(entries, fdbEntry{mac: mac, ifIndex: ifIndex.Int()})
+	}
+	return entries
+}
+
+// walkColumns walks the given table columns, the optional ones being left
+// empty when the device doesn't implement them
+func (c *Client) walkColumns(columns map[string]map[string]Variable, oids []string, optional bool) error {
+	for _, oid := range oids {
+		values, err := c.WalkColumn(oid)
+		if err != nil {
+			if !optional {
+				return fmt.Errorf("Failed to walk %s: %s", oid, err)
+			}
+			logging.GetLogger().Debugf("Failed to walk %s on %s: %s", oid, c.Address, err)
+		}
+		columns[oid] = values
+	}
+	return nil
+}
+
+// getDeviceInfo retrieves the system description, the interfaces, the LLDP
+// and CDP neighbors and the forwarding database of a device
+func getDeviceInfo(c *Client) (*deviceInfo, error) {
+	columns := make(map[string]map[string]Variable)
+
+	mandatory := []string{oidSysName, oidSysDescr, oidIfDescr, oidIfType, oidIfMtu, oidIfSpeed, oidIfPhysAddress, oidIfOperStatus}
+	if err := c.walkColumns(columns, mandatory, false); err != nil {
+		return nil, err
+	}
+
+	optional := []string{
+		oidIPForwarding, oidIfName,
+		oidLldpLocPortIDSubtype, oidLldpLocPortID, oidLldpLocManAddrLen,
+		oidLldpRemChassisIDSubtype, oidLldpRemChassisID, oidLldpRemPortIDSubtype, oidLldpRemPortID, oidLldpRemSysName, oidLldpRemManAddrIfSubtype,
+		oidCdpCacheAddressType, oidCdpCacheAddress, oidCdpCacheDeviceID, oidCdpCacheDevicePort, oidCdpCachePlatform,
+		oidDot1dBasePortIfIndex, oidDot1dTpFdbPort,
+	}
+	c.walkColumns(columns, optional, true)
+
+	info := &deviceInfo{
+		sysName:    columns[oidSysName]["0"].String(),
+		sysDescr:   columns[oidSysDescr]["0"].String(),
+		forwarding: columns[oidIPForwarding]["0"].Int() == 1,
+		bridged:    len(columns[oidDot1dBasePortIfIndex]) > 0,
+	}
+
+	// use the first advertised management address like the LLDP probe
+	for _, index := range sortedIndexes(columns[oidLldpLocManAddrLen]) {
+		if addr := parseAddressIndex(strings.Split(index, ".")); addr != "" {
+			info.mgmtAddress = addr
+			break
+		}
+	}
+
+	info.interfaces = parseInterfaces(columns)
+
+	// LLDP neighbors are attached to the LLDP local port numbers while CDP
+	// neighbors are attached to the interface indexes
+	lldpPorts := matchLLDPPorts(info.interfaces, columns)
+	for _, neighbor := range parseNeighbors(columns) {
+		if intf, found := lldpPorts[neighbor.localPort]; found {
+			neighbor.ifIndex = intf.index
+			info.neighbors = append(info.neighbors, neighbor)
+		}
+	}
+	info.neighbors = append(info.neighbors, parseCDPNeighbors(columns)...)
+	info.fdb = parseFDB(columns)
+
+	return info, nil
+}
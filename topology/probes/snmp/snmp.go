@@ -0,0 +1,398 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// device describes a polled device
+type device struct {
+	address string
+	client  *Client
+	fdb     *topology.FDBTracker
+}
+
+// Probe describes a probe polling the devices where no agent can run, like
+// switches and routers, using SNMP. The devices, their interfaces and their
+// LLDP and CDP neighbors are added to the graph with the IDs the LLDP probe
+// would use so that both probes share the same nodes. Ports facing servers
+// where an agent runs are linked to the interfaces of the servers.
+type Probe struct {
+	graph    *graph.Graph
+	devices  []*device
+	interval time.Duration
+	maxMoves int
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// parseDevice parses a device definition, [community@]address[:port]
+func parseDevice(def, community string, timeout time.Duration, retries int) (*device, error) {
+	address := def
+	if i := strings.LastIndex(def, "@"); i != -1 {
+		community, address = def[:i], def[i+1:]
+	}
+
+	if address == "" {
+		return nil, fmt.Errorf("Invalid SNMP device definition '%s'", def)
+	}
+
+	host := address
+	if h, _, err := net.SplitHostPort(address); err == nil {
+		host = h
+	}
+
+	return &device{
+		address: host,
+		client:  NewClient(address, community, timeout, retries),
+		fdb:     topology.NewFDBTracker(),
+	}, nil
+}
+
+func (p *Probe) getOrCreate(id graph.Identifier, m graph.Metadata) (*graph.Node, error) {
+	if node := p.graph.GetNode(id); node != nil {
+		return node, nil
+	}
+	return p.graph.NewNode(id, m)
+}
+
+// createOrUpdate creates a node or updates the metadata of an existing one,
+// the latter being possibly created by the LLDP probe of an agent
+func (p *Probe) createOrUpdate(id graph.Identifier, m graph.Metadata) (*graph.Node, error) {
+	node := p.graph.GetNode(id)
+	if node == nil {
+		return p.graph.NewNode(id, m)
+	}
+
+	tr := p.graph.StartMetadataTransaction(node)
+	for k, v := range m {
+		if k != "Probe" {
+			tr.AddMetadata(k, v)
+		}
+	}
+	tr.Commit()
+
+	return node, nil
+}
+
+// shortHostname returns a hostname without its domain
+func shortHostname(hostname string) string {
+	return strings.SplitN(hostname, ".", 2)[0]
+}
+
+// lookupServerInterface returns the interface of a server where an agent
+// runs matching a neighbor, using its system name and its port ID, or its
+// MAC address when it is unique
+func (p *Probe) lookupServerInterface(n *neighbor) *graph.Node {
+	var mac string
+	if n.portIDSubtype == lldpPortIDSubtypeMAC {
+		mac = n.portID
+	}
+
+	if n.sysName != "" {
+		filter := graph.Metadata{"Name": n.portID}
+		if mac != "" {
+			filter = graph.Metadata{"MAC": mac}
+		}
+
+		for _, host := range p.graph.GetNodes(graph.Metadata{"Type": "host"}) {
+			if hostname, _ := host.GetFieldString("Hostname"); shortHostname(hostname) != shortHostname(n.sysName) {
+				continue
+			}
+
+			if intfs := p.graph.LookupChildren(host, filter, topology.OwnershipMetadata()); len(intfs) > 0 {
+				return intfs[0]
+			}
+		}
+	}
+
+	if mac == "" {
+		return nil
+	}
+
+	var found *graph.Node
+	for _, node := range p.graph.GetNodes(graph.Metadata{"MAC": mac}) {
+		if nodeType, _ := node.GetFieldString("Type"); nodeType == "switchport" {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = node
+	}
+	return found
+}
+
+func (p *Probe) linkPort(chassis, port *graph.Node) {
+	if !topology.HaveOwnershipLink(p.graph, chassis, port) {
+		topology.AddOwnershipLink(p.graph, chassis, port, nil)
+		topology.AddLayer2Link(p.graph, chassis, port, nil)
+	}
+}
+
+// updateDevice reflects what was retrieved from a device in the graph, the
+// caller must hold the graph lock
+func (p *Probe) updateDevice(d *device, info *deviceInfo) error {
+	mgmtAddress := info.mgmtAddress
+	if mgmtAddress == "" {
+		mgmtAddress = d.address
+	}
+
+	name := info.sysName
+	if name == "" {
+		name = d.address
+	}
+
+	// routers are not expected to expose a forwarding database
+	deviceType := "switch"
+	if info.forwarding && !info.bridged {
+		deviceType = "router"
+	}
+
+	chassis, err := p.createOrUpdate(topology.LLDPChassisID(info.sysName, mgmtAddress, "", ""), graph.Metadata{
+		"Name":  name,
+		"Type":  deviceType,
+		"Probe": "snmp",
+		"SNMP": map[string]interface{}{
+			"Address":    d.client.Address,
+			"SysName":    info.sysName,
+			"SysDescr":   info.sysDescr,
+			"Forwarding": info.forwarding,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ports := make(map[int64]*graph.Node)
+	for _, intf := range info.interfaces {
+		id, subtype := intf.lldpID, intf.subtype
+		if id == "" {
+			id, subtype = intf.name, int64(layers.LLDPPortIDSubtypeIfaceName)
+		}
+
+		state := "DOWN"
+		if intf.operUp {
+			state = "UP"
+		}
+
+		m := graph.Metadata{
+			"Name":    intf.name,
+			"Type":    "switchport",
+			"Probe":   "snmp",
+			"IfIndex": intf.index,
+			"MTU":     intf.mtu,
+			"Speed":   intf.speed,
+			"State":   state,
+			"SNMP": map[string]interface{}{
+				"IfType": intf.ifType,
+			},
+		}
+		if intf.mac != "" {
+			m["MAC"] = intf.mac
+		}
+
+		port, err := p.createOrUpdate(topology.LLDPPortID(chassis.ID, id, layers.LLDPPortIDSubtype(subtype).String()), m)
+		if err != nil {
+			return err
+		}
+		p.linkPort(chassis, port)
+		ports[intf.index] = port
+	}
+
+	// remove the interfaces that disappeared, leaving the ports created
+	// when discovered as a LLDP neighbor
+	for _, port := range p.graph.LookupChildren(chassis, graph.Metadata{"Type": "switchport", "Probe": "snmp"}, topology.OwnershipMetadata()) {
+		if index, err := port.GetFieldInt64("IfIndex"); err == nil && ports[index] == nil {
+			p.graph.DelNode(port)
+		}
+	}
+
+	for _, neighbor := range info.neighbors {
+		localPort := ports[neighbor.ifIndex]
+		if localPort == nil {
+			continue
+		}
+
+		// link directly to the server interfaces even when the LLDP frames
+		// don't reach the agent
+		if intf := p.lookupServerInterface(neighbor); intf != nil {
+			if !topology.HaveLayer2Link(p.graph, localPort, intf) {
+				topology.AddLayer2Link(p.graph, localPort, intf, nil)
+			}
+			continue
+		}
+
+		chassisName := neighbor.sysName
+		if chassisName == "" {
+			chassisName = neighbor.chassisID
+		}
+
+		chassisIDType := layers.LLDPChassisIDSubType(neighbor.chassisIDSubtype).String()
+		portIDType := layers.LLDPPortIDSubtype(neighbor.portIDSubtype).String()
+
+		// the neighbor information is stored under the name of the protocol
+		// that advertised it, LLDP or CDP
+		chassisMetadata := graph.Metadata{"Name": chassisName, "Type": "switch", "Probe": "snmp"}
+		discovery := map[string]interface{}{
+			"ChassisID":     neighbor.chassisID,
+			"ChassisIDType": chassisIDType,
+		}
+		if neighbor.sysName != "" {
+			discovery["SysName"] = neighbor.sysName
+		}
+		if neighbor.mgmtAddress != "" {
+			discovery["MgmtAddress"] = neighbor.mgmtAddress
+		}
+		if neighbor.platform != "" {
+			discovery["Platform"] = neighbor.platform
+		}
+		chassisMetadata[neighbor.protocol] = discovery
+
+		remoteChassis, err := p.getOrCreate(topology.LLDPChassisID(neighbor.sysName, neighbor.mgmtAddress, neighbor.chassisID, chassisIDType), chassisMetadata)
+		if err != nil {
+			return err
+		}
+
+		portMetadata := graph.Metadata{"Name": neighbor.portID, "Type": "switchport", "Probe": "snmp"}
+		portMetadata[neighbor.protocol] = map[string]interface{}{
+			"PortID":     neighbor.portID,
+			"PortIDType": portIDType,
+		}
+
+		remotePort, err := p.getOrCreate(topology.LLDPPortID(remoteChassis.ID, neighbor.portID, portIDType), portMetadata)
+		if err != nil {
+			return err
+		}
+		p.linkPort(remoteChassis, remotePort)
+
+		if !topology.HaveLayer2Link(p.graph, localPort, remotePort) {
+			topology.AddLayer2Link(p.graph, localPort, remotePort, nil)
+		}
+	}
+
+	if info.bridged {
+		entries := make([]topology.FDBEntry, 0, len(info.fdb))
+		for _, entry := range info.fdb {
+			port := strconv.FormatInt(entry.ifIndex, 10)
+			if node := ports[entry.ifIndex]; node != nil {
+				port, _ = node.GetFieldString("Name")
+			}
+			entries = append(entries, topology.FDBEntry{MAC: entry.mac, Port: port})
+		}
+
+		moves := d.fdb.Update(entries, time.Now().UTC())
+		for _, move := range moves {
+			logging.GetLogger().Warningf("MAC %s moved from %s to %s on %s", move.MAC, move.From, move.To, name)
+		}
+
+		topology.SetBridgeFDB(p.graph, chassis, entries, moves, p.maxMoves)
+	}
+
+	return nil
+}
+
+func (p *Probe) pollDevice(d *device) {
+	info, err := getDeviceInfo(d.client)
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to poll SNMP device %s: %s", d.client.Address, err)
+		return
+	}
+
+	p.graph.Lock()
+	err = p.updateDevice(d, info)
+	p.graph.Unlock()
+
+	if err != nil {
+		logging.GetLogger().Errorf("Failed to update the topology of SNMP device %s: %s", d.client.Address, err)
+	}
+}
+
+func (p *Probe) monitorDevice(d *device) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.pollDevice(d)
+
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	for _, d := range p.devices {
+		p.wg.Add(1)
+		go p.monitorDevice(d)
+	}
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// NewProbeFromConfig returns a new SNMP probe polling the devices listed in
+// the configuration
+func NewProbeFromConfig(g *graph.Graph) (*Probe, error) {
+	community := config.GetString("analyzer.topology.snmp.community")
+	timeout := time.Duration(config.GetInt("analyzer.topology.snmp.timeout")) * time.Second
+	retries := config.GetInt("analyzer.topology.snmp.retries")
+
+	interval := config.GetInt("analyzer.topology.snmp.interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid SNMP polling interval %d", interval)
+	}
+
+	p := &Probe{
+		graph:    g,
+		interval: time.Duration(interval) * time.Second,
+		maxMoves: config.GetInt("analyzer.topology.snmp.max_moves"),
+		quit:     make(chan struct{}),
+	}
+
+	for _, def := range config.GetStringSlice("analyzer.topology.snmp.devices") {
+		d, err := parseDevice(def, community, timeout, retries)
+		if err != nil {
+			return nil, err
+		}
+		p.devices = append(p.devices, d)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package snmp
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAgent answers the GetBulk requests using a static MIB
+type fakeAgent struct {
+	conn *net.UDPConn
+	mib  map[string]Variable
+	oids []string
+}
+
+func oidLess(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] != pb[i] {
+			if len(pa[i]) != len(pb[i]) {
+				return len(pa[i]) < len(pb[i])
+			}
+			return pa[i] < pb[i]
+		}
+	}
+	return len(pa) < len(pb)
+}
+
+func newFakeAgent(t *testing.T, mib map[string]Variable) *fakeAgent {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &fakeAgent{conn: conn, mib: mib}
+	for oid := range mib {
+		agent.oids = append(agent.oids, oid)
+	}
+	sort.Slice(agent.oids, func(i, j int) bool { return oidLess(agent.oids[i], agent.oids[j]) })
+
+	go agent.serve()
+	return agent
+}
+
+func encodeVariable(v Variable) []byte {
+	name, _ := encodeOID(v.OID)
+
+	var value []byte
+	switch v.Type {
+	case tagInteger:
+		value = encodeInteger(v.Value.(int64))
+	case tagOctetString:
+		value = encodeTLV(tagOctetString, v.Value.([]byte))
+	default:
+		value = encodeTLV(v.Type, nil)
+	}
+	return encodeTLV(tagSequence, name, value)
+}
+
+func (a *fakeAgent) serve() {
+	buffer := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := a.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+
+		// decode the request ID, max repetitions and requested OID
+		_, message, _, _ := decodeTLV(buffer[:n])
+		_, _, message, _ = decodeTLV(message)
+		_, _, message, _ = decodeTLV(message)
+		_, pdu, _, _ := decodeTLV(message)
+		_, requestID, pdu, _ := decodeTLV(pdu)
+		_, _, pdu, _ = decodeTLV(pdu)
+		_, maxRepetitions, pdu, _ := decodeTLV(pdu)
+		_, varbinds, _, _ := decodeTLV(pdu)
+		_, varbind, _, _ := decodeTLV(varbinds)
+		_, name, _, _ := decodeTLV(varbind)
+		oid := decodeOID(name)
+
+		var response [][]byte
+		for _, o := range a.oids {
+			if len(response) == int(decodeInteger(maxRepetitions)) {
+				break
+			}
+			if oidLess(oid, o) {
+				response = append(response, encodeVariable(a.mib[o]))
+			}
+		}
+		if len(response) == 0 {
+			response = append(response, encodeVariable(Variable{OID: oid, Type: tagEndOfMibView}))
+		}
+
+		pdu = encodeTLV(tagGetResponse,
+			encodeInteger(decodeInteger(requestID)),
+			encodeInteger(0),
+			encodeInteger(0),
+			encodeTLV(tagSequence, response...))
+		a.conn.WriteToUDP(encodeTLV(tagSequence, encodeInteger(1), encodeTLV(tagOctetString, []byte("public")), pdu), addr)
+	}
+}
+
+func TestBERInteger(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 65535, 1 << 31} {
+		tag, value, rest, err := decodeTLV(encodeInteger(v))
+		if err != nil || tag != tagInteger || len(rest) != 0 {
+			t.Fatalf("Failed to decode %d: %v", v, err)
+		}
+		if decoded := decodeInteger(value); decoded != v {
+			t.Errorf("Expected %d, got %d", v, decoded)
+		}
+	}
+}
+
+func TestBEROID(t *testing.T) {
+	for _, oid := range []string{"1.3.6.1.2.1.1.5.0", "1.0.8802.1.1.2.1.4.1.1.9", "1.3.6.1.4.1.2636.3.1.13.1.8"} {
+		b, err := encodeOID(oid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, value, _, err := decodeTLV(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded := decodeOID(value); decoded != oid {
+			t.Errorf("Expected %s, got %s", oid, decoded)
+		}
+	}
+
+	if _, err := encodeOID("1.3.a"); err == nil {
+		t.Error("Expected an error for an invalid OID")
+	}
+}
+
+func TestBERLongLength(t *testing.T) {
+	data := make([]byte, 300)
+	_, value, _, err := decodeTLV(encodeTLV(tagOctetString, data))
+	if err != nil || len(value) != 300 {
+		t.Fatalf("Failed to decode a long octet string: %d %v", len(value), err)
+	}
+
+	if _, _, _, err := decodeTLV([]byte{tagOctetString, 0x82, 0x01}); err != errTruncated {
+		t.Errorf("Expected a truncated error, got %v", err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	mib := map[string]Variable{
+		"1.3.6.1.2.1.1.5.0":     {OID: "1.3.6.1.2.1.1.5.0", Type: tagOctetString, Value: []byte("tor1")},
+		"1.3.6.1.2.1.2.2.1.2.1": {OID: "1.3.6.1.2.1.2.2.1.2.1", Type: tagOctetString, Value: []byte("Ethernet1")},
+		"1.3.6.1.2.1.2.2.1.2.2": {OID: "1.3.6.1.2.1.2.2.1.2.2", Type: tagOctetString, Value: []byte("Ethernet2")},
+		"1.3.6.1.2.1.2.2.1.2.3": {OID: "1.3.6.1.2.1.2.2.1.2.3", Type: tagOctetString, Value: []byte("Ethernet3")},
+		"1.3.6.1.2.1.2.2.1.3.1": {OID: "1.3.6.1.2.1.2.2.1.3.1", Type: tagInteger, Value: int64(6)},
+	}
+
+	agent := newFakeAgent(t, mib)
+	defer agent.conn.Close()
+
+	client := NewClient(agent.conn.LocalAddr().String(), "public", time.Second, 0)
+	client.MaxRepetitions = 2
+
+	descrs, err := client.WalkColumn(oidIfDescr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(descrs) != 3 || descrs["2"].String() != "Ethernet2" {
+		t.Errorf("Unexpected ifDescr column: %+v", descrs)
+	}
+
+	sysName, err := client.WalkColumn(oidSysName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sysName["0"].String() != "tor1" {
+		t.Errorf("Unexpected sysName: %+v", sysName)
+	}
+
+	// the end of the MIB view is reached
+	types, err := client.WalkColumn(oidIfType)
+	if err != nil || types["1"].Int() != 6 {
+		t.Errorf("Unexpected ifType column: %+v, %v", types, err)
+	}
+}
+
+func TestWalkTimeout(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	client := NewClient(conn.LocalAddr().String(), "public", 100*time.Millisecond, 1)
+	if _, err := client.Walk(oidSysName); err != ErrTimeout {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+func TestParseNeighbors(t *testing.T) {
+	index := "0.3.1"
+	columns := map[string]map[string]Variable{
+		oidLldpRemChassisIDSubtype: {index: {Value: int64(lldpChassisIDSubtypeMAC)}},
+		oidLldpRemChassisID:        {index: {Value: []byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}}},
+		oidLldpRemPortIDSubtype:    {index: {Value: int64(5)}},
+		oidLldpRemPortID:           {index: {Value: []byte("eth0")}},
+		oidLldpRemSysName:          {index: {Value: []byte("node1\x00")}},
+		oidLldpRemManAddrIfSubtype: {index + ".1.4.192.168.0.10": {Value: int64(2)}},
+	}
+
+	neighbors := parseNeighbors(columns)
+	if len(neighbors) != 1 {
+		t.Fatalf("Expected one neighbor, got %d", len(neighbors))
+	}
+
+	n := neighbors[0]
+	if n.localPort != "3" || n.chassisID != "52:54:00:12:34:56" || n.portID != "eth0" || n.sysName != "node1" || n.mgmtAddress != "192.168.0.10" {
+		t.Errorf("Unexpected neighbor: %+v", n)
+	}
+}
+
+func TestParseFDB(t *testing.T) {
+	columns := map[string]map[string]Variable{
+		oidDot1dBasePortIfIndex: {"1": {Value: int64(10)}, "2": {Value: int64(20)}},
+		oidDot1dTpFdbPort: {
+			"82.84.0.18.52.86": {Value: int64(2)},
+			"82.84.0.18.52.87": {Value: int64(5)},
+		},
+	}
+
+	entries := parseFDB(columns)
+	if len(entries) != 1 || entries[0].mac != "52:54:00:12:34:56" || entries[0].ifIndex != 20 {
+		t.Errorf("Unexpected forwarding database: %+v", entries)
+	}
+}
+
+func TestMatchLLDPPorts(t *testing.T) {
+	interfaces := parseInterfaces(map[string]map[string]Variable{
+		oidIfDescr: {"1": {Value: []byte("Ethernet1")}, "2": {Value: []byte("Ethernet2")}},
+		oidIfName:  {"1": {Value: []byte("Et1")}, "2": {Value: []byte("Et2")}},
+		oidIfSpeed: {"1": {Value: uint64(10000000000)}},
+	})
+
+	if len(interfaces) != 2 || interfaces[0].name != "Et1" || interfaces[0].speed != 10000 {
+		t.Fatalf("Unexpected interfaces: %+v", interfaces)
+	}
+
+	ports := matchLLDPPorts(interfaces, map[string]map[string]Variable{
+		oidLldpLocPortIDSubtype: {"7": {Value: int64(5)}},
+		oidLldpLocPortID:        {"7": {Value: []byte("Et2")}},
+	})
+
+	if intf := ports["7"]; intf == nil || intf.index != 2 || intf.lldpID != "Et2" {
+		t.Errorf("Unexpected LLDP ports: %+v", ports)
+	}
+}
+
+func TestParseCDPNeighbors(t *testing.T) {
+	index := "12.4"
+	columns := map[string]map[string]Variable{
+		oidCdpCacheAddressType: {index: {Value: int64(cdpAddressTypeIP)}},
+		oidCdpCacheAddress:     {index: {Value: []byte{192, 168, 0, 20}}},
+		oidCdpCacheDeviceID:    {index: {Value: []byte("node2.example.com")}, "13": {Value: []byte("invalid")}},
+		oidCdpCacheDevicePort:  {index: {Value: []byte("eno1")}},
+		oidCdpCachePlatform:    {index: {Value: []byte("Linux")}},
+	}
+
+	neighbors := parseCDPNeighbors(columns)
+	if len(neighbors) != 1 {
+		t.Fatalf("Expected one neighbor, got %d", len(neighbors))
+	}
+
+	n := neighbors[0]
+	if n.protocol != "CDP" || n.ifIndex != 12 || n.sysName != "node2.example.com" || n.portID != "eno1" || n.mgmtAddress != "192.168.0.20" || n.platform != "Linux" {
+		t.Errorf("Unexpected neighbor: %+v", n)
+	}
+
+	if shortHostname(n.sysName) != "node2" {
+		t.Errorf("Unexpected short hostname: %s", shortHostname(n.sysName))
+	}
+}
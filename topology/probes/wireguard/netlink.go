@@ -0,0 +1,226 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package wireguard
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+
+	"github.com/skydive-project/skydive/topology/probes/netlink/nlattr"
+)
+
+// Defined by the WireGuard uapi, not by the netlink package
+const (
+	wgGenlName    = "wireguard"
+	wgGenlVersion = 1
+
+	wgCmdGetDevice = 0
+
+	wgDeviceAIfindex    = 1
+	wgDeviceAPublicKey  = 4
+	wgDeviceAListenPort = 6
+	wgDeviceAFwmark     = 7
+	wgDeviceAPeers      = 8
+
+	wgPeerAPublicKey                   = 1
+	wgPeerAEndpoint                    = 4
+	wgPeerAPersistentKeepaliveInterval = 5
+	wgPeerALastHandshakeTime           = 6
+	wgPeerARxBytes                     = 7
+	wgPeerATxBytes                     = 8
+	wgPeerAAllowedips                  = 9
+
+	wgAllowedipAFamily   = 1
+	wgAllowedipAIpaddr   = 2
+	wgAllowedipACidrMask = 3
+)
+
+// parseEndpoint decodes the sockaddr_in or sockaddr_in6 of a peer endpoint
+func parseEndpoint(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+
+	family := nl.NativeEndian().Uint16(b[0:2])
+	port := strconv.Itoa(int(binary.BigEndian.Uint16(b[2:4])))
+
+	switch {
+	case family == syscall.AF_INET && len(b) >= 8:
+		return net.JoinHostPort(net.IP(b[4:8]).String(), port)
+	case family == syscall.AF_INET6 && len(b) >= 24:
+		return net.JoinHostPort(net.IP(b[8:24]).String(), port)
+	}
+	return ""
+}
+
+func parseAllowedIP(attrs []syscall.NetlinkRouteAttr) string {
+	var ip net.IP
+	var mask uint8
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case wgAllowedipAIpaddr:
+			ip = net.IP(attr.Value)
+		case wgAllowedipACidrMask:
+			if len(attr.Value) > 0 {
+				mask = attr.Value[0]
+			}
+		}
+	}
+
+	if ip == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%d", ip, mask)
+}
+
+func parsePeer(attrs []syscall.NetlinkRouteAttr) (*Peer, error) {
+	native := nl.NativeEndian()
+
+	peer := &Peer{AllowedIPs: []string{}}
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case wgPeerAPublicKey:
+			peer.PublicKey = base64.StdEncoding.EncodeToString(attr.Value)
+		case wgPeerAEndpoint:
+			peer.Endpoint = parseEndpoint(attr.Value)
+		case wgPeerAPersistentKeepaliveInterval:
+			if len(attr.Value) >= 2 {
+				peer.PersistentKeepalive = int64(native.Uint16(attr.Value))
+			}
+		case wgPeerALastHandshakeTime:
+			// struct __kernel_timespec
+			if len(attr.Value) >= 16 {
+				sec, nsec := int64(native.Uint64(attr.Value[0:8])), int64(native.Uint64(attr.Value[8:16]))
+				if sec != 0 || nsec != 0 {
+					peer.LastHandshake = sec*1000 + nsec/1000000
+				}
+			}
+		case wgPeerARxBytes:
+			if len(attr.Value) >= 8 {
+				peer.RxBytes = int64(native.Uint64(attr.Value))
+			}
+		case wgPeerATxBytes:
+			if len(attr.Value) >= 8 {
+				peer.TxBytes = int64(native.Uint64(attr.Value))
+			}
+		case wgPeerAAllowedips:
+			ips, err := nlattr.Nested(attr)
+			if err != nil {
+				return nil, err
+			}
+			for _, ip := range ips {
+				ipAttrs, err := nlattr.Nested(ip)
+				if err != nil {
+					return nil, err
+				}
+				if allowedIP := parseAllowedIP(ipAttrs); allowedIP != "" {
+					peer.AllowedIPs = append(peer.AllowedIPs, allowedIP)
+				}
+			}
+		}
+	}
+	return peer, nil
+}
+
+// parseDevice merges the attributes of a WG_CMD_GET_DEVICE reply into a
+// device, the peers of a device being split over several messages when
+// they don't fit a single one
+func parseDevice(device *Device, attrs []syscall.NetlinkRouteAttr) error {
+	native := nl.NativeEndian()
+
+	for _, attr := range attrs {
+		switch nlattr.Type(attr) {
+		case wgDeviceAPublicKey:
+			device.PublicKey = base64.StdEncoding.EncodeToString(attr.Value)
+		case wgDeviceAListenPort:
+			if len(attr.Value) >= 2 {
+				device.ListenPort = int64(native.Uint16(attr.Value))
+			}
+		case wgDeviceAFwmark:
+			if len(attr.Value) >= 4 {
+				device.FwMark = int64(native.Uint32(attr.Value))
+			}
+		case wgDeviceAPeers:
+			peers, err := nlattr.Nested(attr)
+			if err != nil {
+				return err
+			}
+			for _, p := range peers {
+				peerAttrs, err := nlattr.Nested(p)
+				if err != nil {
+					return err
+				}
+
+				peer, err := parsePeer(peerAttrs)
+				if err != nil {
+					return err
+				}
+
+				// the allowed IPs of a peer can also be split
+				if n := len(device.Peers); n > 0 && device.Peers[n-1].PublicKey == peer.PublicKey {
+					device.Peers[n-1].AllowedIPs = append(device.Peers[n-1].AllowedIPs, peer.AllowedIPs...)
+					continue
+				}
+				device.Peers = append(device.Peers, peer)
+			}
+		}
+	}
+	return nil
+}
+
+// genlFamily returns the identifier of the WireGuard generic netlink family
+func genlFamily() (uint16, error) {
+	family, err := netlink.GenlFamilyGet(wgGenlName)
+	if err != nil {
+		return 0, fmt.Errorf("WireGuard generic netlink family not available: %s", err)
+	}
+	return family.ID, nil
+}
+
+// getDevice retrieves the configuration and the peers of a WireGuard interface
+func getDevice(family uint16, index int) (*Device, error) {
+	req := nl.NewNetlinkRequest(int(family), syscall.NLM_F_DUMP)
+	req.AddData(&nl.Genlmsg{Command: wgCmdGetDevice, Version: wgGenlVersion})
+	req.AddData(nl.NewRtAttr(wgDeviceAIfindex, nl.Uint32Attr(uint32(index))))
+
+	msgs, err := req.Execute(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	device := &Device{}
+	for _, m := range msgs {
+		attrs, err := nl.ParseRouteAttr(m[nl.SizeofGenlmsg:])
+		if err != nil {
+			return nil, err
+		}
+		if err := parseDevice(device, attrs); err != nil {
+			return nil, err
+		}
+	}
+	return device, nil
+}
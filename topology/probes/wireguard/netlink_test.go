@@ -0,0 +1,126 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package wireguard
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink/nl"
+)
+
+func TestParseDevice(t *testing.T) {
+	native := nl.NativeEndian()
+
+	key := func(b byte) []byte {
+		k := make([]byte, 32)
+		k[0] = b
+		return k
+	}
+
+	u16 := func(v uint16) []byte {
+		b := make([]byte, 2)
+		native.PutUint16(b, v)
+		return b
+	}
+
+	u64 := func(v uint64) []byte {
+		b := make([]byte, 8)
+		native.PutUint64(b, v)
+		return b
+	}
+
+	endpoint := make([]byte, 16)
+	native.PutUint16(endpoint[0:2], syscall.AF_INET)
+	binary.BigEndian.PutUint16(endpoint[2:4], 51820)
+	copy(endpoint[4:8], net.ParseIP("192.0.2.1").To4())
+
+	peer := func(parent *nl.RtAttr, k byte, ips ...string) {
+		p := nl.NewRtAttrChild(parent, 0, nil)
+		nl.NewRtAttrChild(p, wgPeerAPublicKey, key(k))
+		nl.NewRtAttrChild(p, wgPeerAEndpoint, endpoint)
+		nl.NewRtAttrChild(p, wgPeerAPersistentKeepaliveInterval, u16(25))
+		nl.NewRtAttrChild(p, wgPeerALastHandshakeTime, append(u64(1500000000), u64(500000000)...))
+		nl.NewRtAttrChild(p, wgPeerARxBytes, u64(100))
+		nl.NewRtAttrChild(p, wgPeerATxBytes, u64(200))
+
+		allowedIPs := nl.NewRtAttrChild(p, wgPeerAAllowedips, nil)
+		for _, ip := range ips {
+			_, ipnet, _ := net.ParseCIDR(ip)
+			ones, _ := ipnet.Mask.Size()
+			a := nl.NewRtAttrChild(allowedIPs, 0, nil)
+			nl.NewRtAttrChild(a, wgAllowedipAFamily, u16(syscall.AF_INET))
+			nl.NewRtAttrChild(a, wgAllowedipAIpaddr, ipnet.IP.To4())
+			nl.NewRtAttrChild(a, wgAllowedipACidrMask, []byte{byte(ones)})
+		}
+	}
+
+	// the peers are split over two messages
+	peers1 := nl.NewRtAttr(wgDeviceAPeers, nil)
+	peer(peers1, 2, "10.0.0.2/32")
+	msg1 := append(nl.NewRtAttr(wgDeviceAPublicKey, key(1)).Serialize(), nl.NewRtAttr(wgDeviceAListenPort, u16(51820)).Serialize()...)
+	msg1 = append(msg1, peers1.Serialize()...)
+
+	peers2 := nl.NewRtAttr(wgDeviceAPeers, nil)
+	peer(peers2, 2, "10.0.1.0/24")
+	peer(peers2, 3)
+
+	device := &Device{}
+	for _, msg := range [][]byte{msg1, peers2.Serialize()} {
+		attrs, err := nl.ParseRouteAttr(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parseDevice(device, attrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	device.finalize(time.Unix(1500000060, 0))
+
+	encoded := func(b byte) string { return base64.StdEncoding.EncodeToString(key(b)) }
+
+	peerState := func(k byte, ips ...string) *Peer {
+		return &Peer{
+			PublicKey:           encoded(k),
+			Endpoint:            "192.0.2.1:51820",
+			AllowedIPs:          append([]string{}, ips...),
+			PersistentKeepalive: 25,
+			LastHandshake:       1500000000500,
+			HandshakeAge:        59,
+			RxBytes:             100,
+			TxBytes:             200,
+		}
+	}
+
+	expected := &Device{
+		PublicKey:  encoded(1),
+		ListenPort: 51820,
+		Peers:      []*Peer{peerState(2, "10.0.0.2/32", "10.0.1.0/24"), peerState(3)},
+		PeerKeys:   []string{encoded(2), encoded(3)},
+	}
+	if !reflect.DeepEqual(device, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, device)
+	}
+}
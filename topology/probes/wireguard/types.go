@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package wireguard reports the WireGuard interfaces of the host of the
+// agent. The configuration and the state of the peers, read with the
+// WireGuard generic netlink API, are written into the WireGuard metadata of
+// the interfaces, the peering probe of the analyzer linking the interfaces
+// of the agents which are peers.
+package wireguard
+
+import (
+	"sort"
+	"time"
+)
+
+// Peer describes a peer of a WireGuard interface
+type Peer struct {
+	PublicKey           string
+	Endpoint            string `json:",omitempty"`
+	AllowedIPs          []string
+	PersistentKeepalive int64 `json:",omitempty"`
+	LastHandshake       int64 `json:",omitempty"`
+	HandshakeAge        int64 `json:",omitempty"`
+	RxBytes             int64
+	TxBytes             int64
+}
+
+// Device describes the WireGuard metadata of an interface
+type Device struct {
+	PublicKey  string
+	ListenPort int64
+	FwMark     int64 `json:",omitempty"`
+	Peers      []*Peer
+	PeerKeys   []string
+}
+
+// finalize sorts the peers and computes the age of their last handshake,
+// in seconds, and the list of their public keys used to link the peers
+func (d *Device) finalize(now time.Time) {
+	sort.Slice(d.Peers, func(i, j int) bool { return d.Peers[i].PublicKey < d.Peers[j].PublicKey })
+
+	d.PeerKeys = make([]string, len(d.Peers))
+	for i, peer := range d.Peers {
+		d.PeerKeys[i] = peer.PublicKey
+		if peer.LastHandshake > 0 {
+			peer.HandshakeAge = int64(now.Sub(time.Unix(0, peer.LastHandshake*int64(time.Millisecond))) / time.Second)
+		}
+		sort.Strings(peer.AllowedIPs)
+	}
+}
@@ -0,0 +1,165 @@
+// +build linux
+
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Probe describes a probe polling the WireGuard interfaces
+type Probe struct {
+	graph    *graph.Graph
+	root     *graph.Node
+	interval time.Duration
+	devices  map[graph.Identifier]*Device
+	failed   bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// interfaces returns the interface index of the WireGuard interfaces of the
+// host, the graph lock being held
+func (p *Probe) interfaces() map[graph.Identifier]int {
+	indexes := make(map[graph.Identifier]int)
+	for _, n := range p.graph.LookupChildren(p.root, graph.Metadata{"Type": "wireguard"}, topology.OwnershipMetadata()) {
+		if index, err := n.GetFieldInt64("IfIndex"); err == nil {
+			indexes[n.ID] = int(index)
+		}
+	}
+	return indexes
+}
+
+// update writes the WireGuard state into the metadata of the interfaces
+func (p *Probe) update() {
+	p.graph.RLock()
+	indexes := p.interfaces()
+	p.graph.RUnlock()
+
+	devices := make(map[graph.Identifier]*Device)
+
+	var err error
+	if len(indexes) > 0 {
+		var family uint16
+		if family, err = genlFamily(); err == nil {
+			now := time.Now()
+			for id, index := range indexes {
+				device, err := getDevice(family, index)
+				if err != nil {
+					logging.GetLogger().Errorf("Failed to retrieve the WireGuard state of interface %d: %s", index, err)
+					continue
+				}
+				device.finalize(now)
+				devices[id] = device
+			}
+		}
+	}
+
+	p.graph.Lock()
+	defer p.graph.Unlock()
+
+	if err != nil {
+		if !p.failed {
+			logging.GetLogger().Error(err)
+			topology.SetProbeError(p.graph, "wireguard", err, p.root)
+			p.failed = true
+		}
+		return
+	}
+	if p.failed {
+		topology.ClearProbeError(p.graph, "wireguard", p.root)
+		p.failed = false
+	}
+
+	for id, device := range devices {
+		node := p.graph.GetNode(id)
+		if node == nil {
+			delete(devices, id)
+			continue
+		}
+
+		if !reflect.DeepEqual(p.devices[id], device) {
+			p.graph.AddMetadata(node, "WireGuard", device)
+		}
+	}
+
+	for id := range p.devices {
+		if _, found := devices[id]; !found {
+			if node := p.graph.GetNode(id); node != nil {
+				p.graph.DelMetadata(node, "WireGuard")
+			}
+		}
+	}
+	p.devices = devices
+}
+
+// Start the probe
+func (p *Probe) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			p.update()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the probe
+func (p *Probe) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// NewProbeFromConfig returns a new WireGuard probe reporting the state of
+// the WireGuard interfaces of the given host node
+func NewProbeFromConfig(g *graph.Graph, root *graph.Node) (*Probe, error) {
+	interval := config.GetInt("agent.topology.wireguard.interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid WireGuard polling interval %d", interval)
+	}
+
+	return &Probe{
+		graph:    g,
+		root:     root,
+		interval: time.Duration(interval) * time.Second,
+		devices:  make(map[graph.Identifier]*Device),
+	}, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rollup
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// Metadata describes the Rollup metadata of the host, namespace and tenant
+// nodes, the sum of the counters of the interfaces they hold
+type Metadata struct {
+	Interfaces       int64                     `json:"Interfaces"`
+	Metric           *topology.InterfaceMetric `json:"Metric,omitempty"`
+	LastUpdateMetric *topology.InterfaceMetric `json:"LastUpdateMetric,omitempty"`
+}
+
+// MetadataDecoder implements a json message raw decoder
+func MetadataDecoder(raw json.RawMessage) (common.Getter, error) {
+	var md Metadata
+	if err := json.Unmarshal(raw, &md); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal rollup metadata %s: %s", string(raw), err)
+	}
+
+	return &md, nil
+}
+
+// GetFieldInt64 implements Getter interface
+func (md *Metadata) GetFieldInt64(key string) (int64, error) {
+	fields := strings.SplitN(key, ".", 2)
+
+	switch fields[0] {
+	case "Interfaces":
+		if len(fields) == 1 {
+			return md.Interfaces, nil
+		}
+	case "Metric":
+		if len(fields) == 2 {
+			if md.Metric != nil {
+				return md.Metric.GetFieldInt64(fields[1])
+			}
+			return new(topology.InterfaceMetric).GetFieldInt64(fields[1])
+		}
+	case "LastUpdateMetric":
+		if len(fields) == 2 {
+			if md.LastUpdateMetric != nil {
+				return md.LastUpdateMetric.GetFieldInt64(fields[1])
+			}
+			return new(topology.InterfaceMetric).GetFieldInt64(fields[1])
+		}
+	}
+
+	return 0, common.ErrFieldNotFound
+}
+
+// GetFieldString implements Getter interface
+func (md *Metadata) GetFieldString(key string) (string, error) {
+	return "", common.ErrFieldNotFound
+}
+
+// GetField implements Getter interface
+func (md *Metadata) GetField(key string) (interface{}, error) {
+	switch key {
+	case "Metric":
+		if md.Metric != nil {
+			return md.Metric, nil
+		}
+		return nil, common.ErrFieldNotFound
+	case "LastUpdateMetric":
+		if md.LastUpdateMetric != nil {
+			return md.LastUpdateMetric, nil
+		}
+		return nil, common.ErrFieldNotFound
+	}
+
+	return md.GetFieldInt64(key)
+}
+
+// GetFieldKeys returns the list of valid fields
+func (md *Metadata) GetFieldKeys() []string {
+	return metadataFields
+}
+
+var metadataFields []string
+
+func init() {
+	metadataFields = common.StructFieldKeys(Metadata{})
+}
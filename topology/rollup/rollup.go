@@ -0,0 +1,291 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rollup
+
+import (
+	"sync"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/config"
+	"github.com/skydive-project/skydive/filters"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+	"github.com/skydive-project/skydive/topology"
+)
+
+// maxOwnershipDepth bounds the walk from an interface up to its host
+const maxOwnershipDepth = 8
+
+// Rollup periodically sums the counters of the interfaces and reports
+// them in the Rollup metadata of their host, of their network namespace
+// and of their tenant. Tenants being not part of the topology, a node of
+// type tenant is created for each of them. As any other metadata, the
+// rollups are kept in the topology history so that they can be retrieved
+// with the Metrics('Rollup') step.
+type Rollup struct {
+	graph       *graph.Graph
+	interval    time.Duration
+	tenantField string
+	metrics     map[graph.Identifier]*topology.InterfaceMetric
+	rolledUp    map[graph.Identifier]bool
+	last        time.Time
+	quit        chan struct{}
+	wg          sync.WaitGroup
+}
+
+type aggregate struct {
+	interfaces int64
+	metric     *topology.InterfaceMetric
+	delta      *topology.InterfaceMetric
+}
+
+func (a *aggregate) add(metric, delta *topology.InterfaceMetric) {
+	a.interfaces++
+	a.metric = a.metric.Add(metric).(*topology.InterfaceMetric)
+	a.delta = a.delta.Add(delta).(*topology.InterfaceMetric)
+}
+
+func newAggregate() *aggregate {
+	return &aggregate{metric: &topology.InterfaceMetric{}, delta: &topology.InterfaceMetric{}}
+}
+
+// counterReset returns whether the counters of an interface went backward,
+// meaning that the interface was recreated or its counters were reset
+func counterReset(prev, curr *topology.InterfaceMetric) bool {
+	return curr.RxBytes < prev.RxBytes || curr.TxBytes < prev.TxBytes ||
+		curr.RxPackets < prev.RxPackets || curr.TxPackets < prev.TxPackets
+}
+
+// interfaceDelta returns the traffic of an interface since its previous
+// counters, none if they are unknown
+func interfaceDelta(prev, curr *topology.InterfaceMetric) *topology.InterfaceMetric {
+	switch {
+	case prev == nil:
+		return &topology.InterfaceMetric{}
+	case counterReset(prev, curr):
+		return curr
+	default:
+		return curr.Sub(prev).(*topology.InterfaceMetric)
+	}
+}
+
+// owners returns the network namespace and the host an interface
+// belongs to, following the ownership links
+func (r *Rollup) owners(n *graph.Node) (owners []*graph.Node) {
+	var netns bool
+	for i := 0; i < maxOwnershipDepth; i++ {
+		parents := r.graph.LookupParents(n, nil, topology.OwnershipMetadata())
+		if len(parents) == 0 {
+			return
+		}
+		n = parents[0]
+
+		switch typ, _ := n.GetFieldString("Type"); typ {
+		case "netns":
+			if !netns {
+				owners = append(owners, n)
+				netns = true
+			}
+		case "host":
+			return append(owners, n)
+		}
+	}
+	return
+}
+
+// compute sums the counters of the interfaces per owner node and per tenant
+func (r *Rollup) compute() (map[graph.Identifier]*aggregate, map[string]*aggregate) {
+	nodes := make(map[graph.Identifier]*aggregate)
+	tenants := make(map[string]*aggregate)
+	metrics := make(map[graph.Identifier]*topology.InterfaceMetric)
+
+	for _, n := range r.graph.GetNodes(graph.NewElementFilter(filters.NewNotNullFilter("Metric"))) {
+		metric, ok := n.Metadata["Metric"].(*topology.InterfaceMetric)
+		if !ok {
+			continue
+		}
+		metrics[n.ID] = metric
+		delta := interfaceDelta(r.metrics[n.ID], metric)
+
+		for _, owner := range r.owners(n) {
+			a, ok := nodes[owner.ID]
+			if !ok {
+				a = newAggregate()
+				nodes[owner.ID] = a
+			}
+			a.add(metric, delta)
+		}
+
+		if r.tenantField == "" {
+			continue
+		}
+
+		if tenant, _ := n.GetFieldString(r.tenantField); tenant != "" {
+			a, ok := tenants[tenant]
+			if !ok {
+				a = newAggregate()
+				tenants[tenant] = a
+			}
+			a.add(metric, delta)
+		}
+	}
+	r.metrics = metrics
+
+	return nodes, tenants
+}
+
+func (r *Rollup) metadata(a *aggregate, now time.Time) *Metadata {
+	md := &Metadata{Interfaces: a.interfaces, Metric: a.metric}
+	md.Metric.Start, md.Metric.Last = 0, common.UnixMillis(now)
+
+	// the first pass only records the counters of the interfaces
+	if !r.last.IsZero() {
+		md.LastUpdateMetric = a.delta
+		md.LastUpdateMetric.Start, md.LastUpdateMetric.Last = common.UnixMillis(r.last), common.UnixMillis(now)
+	}
+	return md
+}
+
+// changed returns whether the rollup of a node has to be updated, in order
+// not to fill the history with idle nodes
+func changed(n *graph.Node, md *Metadata) bool {
+	prev, ok := n.Metadata["Rollup"].(*Metadata)
+	if !ok || prev.Interfaces != md.Interfaces {
+		return true
+	}
+	return md.LastUpdateMetric != nil && !md.LastUpdateMetric.IsZero()
+}
+
+func tenantID(tenant string) graph.Identifier {
+	return graph.GenID("tenant", tenant)
+}
+
+func (r *Rollup) update(now time.Time) {
+	r.graph.Lock()
+	defer r.graph.Unlock()
+
+	nodes, tenants := r.compute()
+
+	for id := range r.rolledUp {
+		if _, ok := nodes[id]; ok {
+			continue
+		}
+		if n := r.graph.GetNode(id); n != nil {
+			r.graph.DelMetadata(n, "Rollup")
+		}
+	}
+	r.rolledUp = make(map[graph.Identifier]bool)
+
+	for id, a := range nodes {
+		n := r.graph.GetNode(id)
+		if n == nil {
+			continue
+		}
+		r.rolledUp[id] = true
+
+		if md := r.metadata(a, now); changed(n, md) {
+			r.graph.AddMetadata(n, "Rollup", md)
+		}
+	}
+
+	for tenant, a := range tenants {
+		md := r.metadata(a, now)
+
+		n := r.graph.GetNode(tenantID(tenant))
+		if n == nil {
+			m := graph.Metadata{
+				"Type":   "tenant",
+				"Name":   tenant,
+				"Probe":  "rollup",
+				"Rollup": md,
+			}
+			if _, err := r.graph.NewNode(tenantID(tenant), m); err != nil {
+				logging.GetLogger().Errorf("Failed to create tenant node %s: %s", tenant, err)
+			}
+			continue
+		}
+
+		if changed(n, md) {
+			r.graph.AddMetadata(n, "Rollup", md)
+		}
+	}
+
+	// tenants without any interface left
+	for _, n := range r.graph.GetNodes(graph.Metadata{"Type": "tenant", "Probe": "rollup"}) {
+		if name, _ := n.GetFieldString("Name"); tenants[name] == nil {
+			if err := r.graph.DelNode(n); err != nil {
+				logging.GetLogger().Errorf("Failed to delete tenant node %s: %s", name, err)
+			}
+		}
+	}
+
+	r.last = now
+}
+
+func (r *Rollup) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.quit:
+			return
+		case now := <-ticker.C:
+			r.update(now)
+		}
+	}
+}
+
+// Start the rollups
+func (r *Rollup) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Stop the rollups
+func (r *Rollup) Stop() {
+	close(r.quit)
+	r.wg.Wait()
+}
+
+// NewRollup returns a new rollup of the interface metrics, updated every
+// interval. The interfaces are grouped by tenant using the given metadata
+// field, empty to disable the tenant rollups.
+func NewRollup(g *graph.Graph, interval time.Duration, tenantField string) *Rollup {
+	return &Rollup{
+		graph:       g,
+		interval:    interval,
+		tenantField: tenantField,
+		metrics:     make(map[graph.Identifier]*topology.InterfaceMetric),
+		rolledUp:    make(map[graph.Identifier]bool),
+		quit:        make(chan struct{}),
+	}
+}
+
+// NewRollupFromConfig returns a new rollup as configured, nil if disabled
+func NewRollupFromConfig(g *graph.Graph) *Rollup {
+	interval := config.GetInt("analyzer.metrics_rollup.interval")
+	if interval <= 0 {
+		return nil
+	}
+
+	return NewRollup(g, time.Duration(interval)*time.Second, config.GetString("analyzer.metrics_rollup.tenant_field"))
+}
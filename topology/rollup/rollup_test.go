@@ -0,0 +1,124 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package rollup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/topology"
+)
+
+func newNode(t *testing.T, g *graph.Graph, parent *graph.Node, m graph.Metadata) *graph.Node {
+	n, err := g.NewNode(graph.GenID(), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parent != nil {
+		topology.AddOwnershipLink(g, parent, n, nil)
+	}
+	return n
+}
+
+func rollupOf(t *testing.T, n *graph.Node) *Metadata {
+	md, ok := n.Metadata["Rollup"].(*Metadata)
+	if !ok {
+		t.Fatalf("No rollup found for %s: %v", n.ID, n.Metadata)
+	}
+	return md
+}
+
+func TestRollup(t *testing.T) {
+	b, err := graph.NewMemoryBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := graph.NewGraph("testhost", b, common.UnknownService)
+
+	g.Lock()
+	host := newNode(t, g, nil, graph.Metadata{"Type": "host", "Name": "testhost"})
+	netns := newNode(t, g, host, graph.Metadata{"Type": "netns", "Name": "ns1"})
+	intf1 := newNode(t, g, netns, graph.Metadata{
+		"Type":    "veth",
+		"Neutron": map[string]interface{}{"TenantID": "tenant1"},
+		"Metric":  &topology.InterfaceMetric{RxBytes: 100, TxBytes: 10},
+	})
+	newNode(t, g, host, graph.Metadata{
+		"Type":   "device",
+		"Metric": &topology.InterfaceMetric{RxBytes: 1000, TxBytes: 20},
+	})
+	g.Unlock()
+
+	r := NewRollup(g, time.Second, "Neutron.TenantID")
+
+	first := time.Now()
+	r.update(first)
+
+	md := rollupOf(t, host)
+	if md.Interfaces != 2 || md.Metric.RxBytes != 1100 || md.Metric.TxBytes != 30 {
+		t.Fatalf("Wrong host rollup: %+v", md.Metric)
+	}
+	if md.LastUpdateMetric != nil {
+		t.Fatalf("No traffic expected on the first pass, got: %+v", md.LastUpdateMetric)
+	}
+
+	if md = rollupOf(t, netns); md.Interfaces != 1 || md.Metric.RxBytes != 100 {
+		t.Fatalf("Wrong namespace rollup: %+v", md)
+	}
+
+	tenant := g.GetNode(tenantID("tenant1"))
+	if tenant == nil {
+		t.Fatal("Tenant node not created")
+	}
+	if md = rollupOf(t, tenant); md.Interfaces != 1 || md.Metric.RxBytes != 100 {
+		t.Fatalf("Wrong tenant rollup: %+v", md)
+	}
+
+	g.Lock()
+	g.AddMetadata(intf1, "Metric", &topology.InterfaceMetric{RxBytes: 150, TxBytes: 15})
+	g.Unlock()
+
+	second := first.Add(time.Second)
+	r.update(second)
+
+	md = rollupOf(t, host)
+	if md.LastUpdateMetric == nil || md.LastUpdateMetric.RxBytes != 50 || md.LastUpdateMetric.TxBytes != 5 {
+		t.Fatalf("Wrong host traffic: %+v", md.LastUpdateMetric)
+	}
+	if md.LastUpdateMetric.Start != common.UnixMillis(first) || md.LastUpdateMetric.Last != common.UnixMillis(second) {
+		t.Fatalf("Wrong host traffic period: %+v", md.LastUpdateMetric)
+	}
+
+	// counters reset, the new counters are accounted as they are
+	g.Lock()
+	g.AddMetadata(intf1, "Metric", &topology.InterfaceMetric{RxBytes: 20, TxBytes: 2})
+	g.DelMetadata(intf1, "Neutron")
+	g.Unlock()
+
+	r.update(second.Add(time.Second))
+
+	if md = rollupOf(t, netns); md.LastUpdateMetric.RxBytes != 20 || md.LastUpdateMetric.TxBytes != 2 {
+		t.Fatalf("Wrong namespace traffic after reset: %+v", md.LastUpdateMetric)
+	}
+
+	if g.GetNode(tenantID("tenant1")) != nil {
+		t.Fatal("Tenant node without interface not deleted")
+	}
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package topology
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/skydive-project/skydive/common"
+	"github.com/skydive-project/skydive/graffiti/graph"
+	"github.com/skydive-project/skydive/logging"
+)
+
+// STPMetadataKey is the metadata key of the spanning tree state of the
+// bridges and of their ports
+const STPMetadataKey = "STP"
+
+// SetSTP sets the spanning tree state of a bridge or of a bridge port, nil
+// removing it when the spanning tree is disabled. The time of the last change
+// of the state or of the role of a port is kept in LastChange so that a port
+// recently blocked can be spotted. The caller must hold the graph lock.
+func SetSTP(g *graph.Graph, n *graph.Node, stp map[string]interface{}) {
+	value, err := n.GetField(STPMetadataKey)
+	if stp == nil {
+		if err == nil {
+			g.DelMetadata(n, STPMetadataKey)
+		}
+		return
+	}
+
+	previous, _ := value.(map[string]interface{})
+
+	lastChange, found := previous["LastChange"]
+	if !found || previous["State"] != stp["State"] || previous["Role"] != stp["Role"] {
+		lastChange = common.UnixMillis(time.Now().UTC())
+
+		if state, ok := stp["State"]; ok && previous != nil {
+			name, _ := n.GetFieldString("Name")
+			logging.GetLogger().Infof("Spanning tree port %s changed from %v/%v to %v/%v", name, previous["State"], previous["Role"], state, stp["Role"])
+		}
+	}
+
+	updated := make(map[string]interface{}, len(stp)+1)
+	for k, v := range stp {
+		updated[k] = v
+	}
+	updated["LastChange"] = lastChange
+
+	if reflect.DeepEqual(previous, updated) {
+		return
+	}
+
+	g.AddMetadata(n, STPMetadataKey, updated)
+}
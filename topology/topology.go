@@ -19,6 +19,7 @@ package topology
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	uuid "github.com/nu7hatch/gouuid"
@@ -189,3 +190,28 @@ func IsInterfaceUp(node *graph.Node) bool {
 	}
 	return false
 }
+
+// HasIP returns whether one of the IPv4 or IPv6 addresses of a node, in the
+// CIDR notation, is the given IP
+func HasIP(node *graph.Node, ip string) bool {
+	for _, key := range []string{"IPV4", "IPV6"} {
+		addrs, _ := node.GetFieldStringList(key)
+		for _, addr := range addrs {
+			if strings.Split(addr, "/")[0] == ip {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LookupNodesByIP returns the nodes having the given IP. The graph lock has
+// to be held.
+func LookupNodesByIP(g *graph.Graph, ip string) (nodes []*graph.Node) {
+	for _, node := range g.GetNodes(nil) {
+		if HasIP(node, ip) {
+			nodes = append(nodes, node)
+		}
+	}
+	return
+}
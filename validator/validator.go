@@ -29,6 +29,7 @@ import (
 	"github.com/skydive-project/skydive/common"
 	"github.com/skydive-project/skydive/flow"
 	"github.com/skydive-project/skydive/graffiti/graph/traversal"
+	"github.com/skydive-project/skydive/gremlin/sql"
 	ge "github.com/skydive-project/skydive/gremlin/traversal"
 )
 
@@ -48,6 +49,10 @@ var (
 	GremlinNotValid = func(err error) error {
 		return valid.TextErr{Err: fmt.Errorf("Not a valid Gremlin expression: %s", err)}
 	}
+	// SQLNotValid validator
+	SQLNotValid = func(err error) error {
+		return valid.TextErr{Err: fmt.Errorf("Not a valid SQL query: %s", err)}
+	}
 	// BPFFilterNotValid validator
 	BPFFilterNotValid = func(err error) error {
 		return valid.TextErr{Err: fmt.Errorf("Not a valid BPF expression: %s", err)}
@@ -60,6 +65,10 @@ var (
 	RawPacketLimitNotValid = func(min, max uint32) error {
 		return valid.TextErr{Err: fmt.Errorf("A valid raw packet limit size is > %d && <= %d", min, max)}
 	}
+	// PortNotValid validator
+	PortNotValid = func(port int) error {
+		return valid.TextErr{Err: fmt.Errorf("Not a valid port: %d", port)}
+	}
 	//LayerKeyModeNotValid validator
 	LayerKeyModeNotValid = func() error {
 		return valid.TextErr{Err: errors.New("Not a valid layer key mode")}
@@ -82,6 +91,13 @@ func isIP(v interface{}, param string) error {
 	return nil
 }
 
+func isIPOrEmpty(v interface{}, param string) error {
+	if ip, ok := v.(string); ok && ip == "" {
+		return nil
+	}
+	return isIP(v, param)
+}
+
 func isGremlinExpr(v interface{}, param string) error {
 	query, ok := v.(string)
 	if !ok {
@@ -91,10 +107,12 @@ func isGremlinExpr(v interface{}, param string) error {
 	tr := traversal.NewGremlinTraversalParser()
 	tr.AddTraversalExtension(ge.NewMetricsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewFlowTraversalExtension(nil, nil))
+	tr.AddTraversalExtension(ge.NewGroupByTraversalExtension())
 	tr.AddTraversalExtension(ge.NewSocketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewRawPacketsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewDescendantsTraversalExtension())
 	tr.AddTraversalExtension(ge.NewNextHopTraversalExtension())
+	tr.AddTraversalExtension(ge.NewShortestPathTraversalExtension())
 
 	if _, err := tr.Parse(strings.NewReader(query)); err != nil {
 		return GremlinNotValid(err)
@@ -111,6 +129,24 @@ func isGremlinOrEmpty(v interface{}, param string) error {
 	return isGremlinExpr(v, param)
 }
 
+func isSQLOrEmpty(v interface{}, param string) error {
+	query, ok := v.(string)
+	if !ok {
+		return SQLNotValid(errors.New("not a string"))
+	}
+
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+
+	gremlinQuery, err := sql.Compile(query)
+	if err != nil {
+		return SQLNotValid(err)
+	}
+
+	return isGremlinExpr(gremlinQuery, param)
+}
+
 func isBPFFilter(v interface{}, param string) error {
 	bpfFilter, ok := v.(string)
 	if !ok {
@@ -146,6 +182,21 @@ func isValidRawPacketLimit(v interface{}, param string) error {
 	return nil
 }
 
+func isValidPorts(v interface{}, param string) error {
+	ports, ok := v.([]int)
+	if !ok {
+		return valid.ErrUnsupported
+	}
+
+	for _, port := range ports {
+		if port <= 0 || port > 65535 {
+			return PortNotValid(port)
+		}
+	}
+
+	return nil
+}
+
 func isValidLayerKeyMode(v interface{}, param string) error {
 	name, ok := v.(string)
 	if !ok {
@@ -202,11 +253,14 @@ func Validate(value interface{}) error {
 
 func init() {
 	skydiveValidator.SetValidationFunc("isIP", isIP)
+	skydiveValidator.SetValidationFunc("isIPOrEmpty", isIPOrEmpty)
 	skydiveValidator.SetValidationFunc("isGremlinExpr", isGremlinExpr)
 	skydiveValidator.SetValidationFunc("isGremlinOrEmpty", isGremlinOrEmpty)
+	skydiveValidator.SetValidationFunc("isSQLOrEmpty", isSQLOrEmpty)
 	skydiveValidator.SetValidationFunc("isBPFFilter", isBPFFilter)
 	skydiveValidator.SetValidationFunc("isValidCaptureHeaderSize", isValidCaptureHeaderSize)
 	skydiveValidator.SetValidationFunc("isValidRawPacketLimit", isValidRawPacketLimit)
+	skydiveValidator.SetValidationFunc("isValidPorts", isValidPorts)
 	skydiveValidator.SetValidationFunc("isValidLayerKeyMode", isValidLayerKeyMode)
 	skydiveValidator.SetValidationFunc("isValidWorkflow", isValidWorkflow)
 	skydiveValidator.SetValidationFunc("isValidCaptureType", isValidCaptureType)
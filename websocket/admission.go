@@ -0,0 +1,95 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package websocket
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// minRetryDelay is the smallest delay given to the rejected clients, the
+// Retry-After header having a resolution of one second
+const minRetryDelay = time.Second
+
+// admissionController limits the rate at which the incoming connections
+// are accepted, so that a server restarted with thousands of clients is not
+// overwhelmed by their simultaneous reconnections. The rejected clients
+// are given a randomized delay to spread their next attempts.
+type admissionController struct {
+	sync.Mutex
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	maxDelay time.Duration
+}
+
+// admit returns whether a new connection is accepted or, if not, the delay
+// after which the client should try again
+func (a *admissionController) admit(now time.Time) (bool, time.Duration) {
+	if a == nil {
+		return true, 0
+	}
+
+	a.Lock()
+	defer a.Unlock()
+
+	a.tokens += now.Sub(a.last).Seconds() * a.rate
+	if a.tokens > a.burst {
+		a.tokens = a.burst
+	}
+	a.last = now
+
+	if a.tokens >= 1 {
+		a.tokens--
+		return true, 0
+	}
+
+	// spread the retries over the time needed to accept a full burst
+	wait := (1 - a.tokens) / a.rate
+	spread := a.burst / a.rate
+	delay := time.Duration((wait + rand.Float64()*spread) * float64(time.Second))
+
+	if delay < minRetryDelay {
+		delay = minRetryDelay
+	}
+	if a.maxDelay > 0 && delay > a.maxDelay {
+		delay = a.maxDelay
+	}
+	return false, delay
+}
+
+// newAdmissionController returns an admission controller accepting rate
+// connections per second with the given burst, nil if rate is not positive
+func newAdmissionController(rate float64, burst int, maxDelay time.Duration) *admissionController {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &admissionController{
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     time.Now(),
+		maxDelay: maxDelay,
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (C) 2019 Red Hat, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy ofthe License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specificlanguage governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdmissionController(t *testing.T) {
+	var disabled *admissionController
+	if ok, _ := disabled.admit(time.Now()); !ok {
+		t.Error("Connections should be accepted without admission control")
+	}
+
+	a := newAdmissionController(10, 5, 30*time.Second)
+	now := a.last
+
+	for i := 0; i < 5; i++ {
+		if ok, _ := a.admit(now); !ok {
+			t.Fatalf("Connection %d of the burst should be accepted", i)
+		}
+	}
+
+	ok, delay := a.admit(now)
+	if ok {
+		t.Fatal("Connection exceeding the burst should be rejected")
+	}
+	if delay < minRetryDelay || delay > 30*time.Second {
+		t.Errorf("Wrong retry delay: %s", delay)
+	}
+
+	// 10 connections per second
+	if ok, _ := a.admit(now.Add(100 * time.Millisecond)); !ok {
+		t.Error("Connection should be accepted once a token is available")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"encoding/json"
 	"errors"
 	fmt "fmt"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -37,8 +38,10 @@ import (
 )
 
 const (
-	maxMessageSize = 0
-	writeWait      = 10 * time.Second
+	maxMessageSize    = 0
+	writeWait         = 10 * time.Second
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
 )
 
 // ConnState describes the connection state
@@ -151,6 +154,17 @@ type Client struct {
 	tlsConfig *tls.Config
 }
 
+// retryAfterError is returned when the server refuses the connection and
+// asks the client to try again after a delay
+type retryAfterError struct {
+	endpoint string
+	delay    time.Duration
+}
+
+func (e *retryAfterError) Error() string {
+	return fmt.Sprintf("Connection to %s refused by the server, retrying in %s", e.endpoint, e.delay)
+}
+
 // ClientOpts defines some options that can be set when creating a new client
 type ClientOpts struct {
 	Protocol         Protocol
@@ -498,6 +512,11 @@ func (c *Client) Connect() error {
 	var resp *http.Response
 	c.conn, resp, err = d.Dial(endpoint, headers)
 	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusServiceUnavailable {
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				return &retryAfterError{endpoint: endpoint, delay: time.Duration(seconds) * time.Second}
+			}
+		}
 		return fmt.Errorf("Unable to create a WebSocket connection %s : %s", endpoint, err)
 	}
 
@@ -534,16 +553,34 @@ func (c *Client) Connect() error {
 	return nil
 }
 
-// Start connects to the server - and reconnect if necessary
+// jitter returns a random delay between half and the whole given delay
+func jitter(delay time.Duration) time.Duration {
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Start connects to the server - and reconnect if necessary. The delay
+// between two attempts is randomized and doubled after each failure, unless
+// the server gives one, so that the clients of a restarted server do not
+// reconnect all at once.
 func (c *Client) Start() {
 	go func() {
+		delay := minReconnectDelay
 		for c.running.Load() == true {
+			var wait time.Duration
 			if err := c.Connect(); err == nil {
 				c.Run()
+				delay, wait = minReconnectDelay, jitter(minReconnectDelay)
+			} else if ra, ok := err.(*retryAfterError); ok {
+				logging.GetLogger().Warning(err)
+				wait = ra.delay
 			} else {
 				logging.GetLogger().Error(err)
+				wait = jitter(delay)
+				if delay *= 2; delay > maxReconnectDelay {
+					delay = maxReconnectDelay
+				}
 			}
-			time.Sleep(1 * time.Second)
+			time.Sleep(wait)
 		}
 	}()
 }
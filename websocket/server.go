@@ -19,8 +19,10 @@ package websocket
 
 import (
 	fmt "fmt"
+	"math"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -44,14 +46,20 @@ type Server struct {
 	server         *shttp.Server
 	incomerHandler IncomerHandler
 	opts           ServerOpts
+	admission      *admissionController
 }
 
-// ServerOpts defines server options
+// ServerOpts defines server options. MaxConnRate limits the number of
+// connections accepted per second, with bursts of MaxConnBurst connections,
+// the other clients being asked to retry within MaxRetryDelay.
 type ServerOpts struct {
 	WriteCompression bool
 	QueueSize        int
 	PingDelay        time.Duration
 	PongTimeout      time.Duration
+	MaxConnRate      float64
+	MaxConnBurst     int
+	MaxRetryDelay    time.Duration
 }
 
 func getRequestParameter(r *http.Request, name string) string {
@@ -87,6 +95,14 @@ func (s *Server) serveMessages(w http.ResponseWriter, r *auth.AuthenticatedReque
 		return
 	}
 
+	if ok, delay := s.admission.admit(time.Now()); !ok {
+		logging.GetLogger().Debugf("Too many incoming connections, %s asked to retry in %s", host, delay)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
 	// reply with host-id and service type of the server
 	header := http.Header{}
 	header.Set("X-Host-ID", s.server.Host)
@@ -174,6 +190,7 @@ func NewServer(server *shttp.Server, endpoint string, authBackend shttp.Authenti
 		incomerPool: newIncomerPool(endpoint), // server inherits from a Speaker pool
 		server:      server,
 		opts:        opts,
+		admission:   newAdmissionController(opts.MaxConnRate, opts.MaxConnBurst, opts.MaxRetryDelay),
 	}
 
 	s.incomerHandler = func(conn *websocket.Conn, r *auth.AuthenticatedRequest) (Speaker, error) {